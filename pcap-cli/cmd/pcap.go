@@ -16,14 +16,19 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"regexp"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -38,19 +43,83 @@ var (
 	writeTo   = flag.String("w", "stdout", "Where to write packet capture to: stdout or a file path")
 	tsType    = flag.String("ts_type", "", "Type of timestamps to use")
 	promisc   = flag.Bool("promisc", true, "Set promiscuous mode")
-	format    = flag.String("fmt", "default", "Set the output format: default, text or json")
+	format    = flag.String("fmt", "default", "Set the output format: default, text, json, proto, pcapng, ecs, otlp or template")
 	filter    = flag.String("filter", "", "Set BPF filter to be used")
+	filterExp = flag.String("filter_expr", "", "filter expression compiled into both the BPF filter and userspace filters; i/e: 'host 10.0.0.0/8 and port (443,8443) and tcp.flags has SYN'; replaces 'filter'")
 	timeout   = flag.Int("timeout", 0, "Set packet capturing total duration in seconds")
 	interval  = flag.Int("interval", 0, "Set packet capture file rotation interval in seconds")
-	extension = flag.String("ext", "", "Set pcap files extension: pcap, json, txt")
+	extension = flag.String("ext", "", "Set pcap files extension: pcap, pcapng, json, pb, txt, parquet")
 	stdout    = flag.Bool("stdout", false, "Log translation to standard output; only if 'w' is not 'stdout'")
 	ordered   = flag.Bool("ordered", false, "write translation in the order in which packets were captured")
 	conntrack = flag.Bool("conntrack", false, "enable connection tracking (includes 'ordered')")
 	timezone  = flag.String("tz", "UTC", "timezone to be used by PCAP files template")
+	sessions  = flag.String("sessions", "", "comma separated list of cookies and 'header:' prefixed headers to be hashed")
+	otlp      = flag.String("otlp", "", "OTLP/gRPC endpoint to export translations to; requires 'fmt' to be 'otlp'")
+	chDSN     = flag.String("clickhouse", "", "ClickHouse native protocol DSN to insert translations into; requires 'fmt' to be 'json'")
+	chTable   = flag.String("clickhouse_table", "pcap_translations", "ClickHouse table to insert translations into; created if it does not exist")
+	ipfix     = flag.String("flow_collector", "", "'host:port' of an IPFIX or NetFlow v9 collector to send a record per direction of every TCP connection to, over UDP")
+	ipfixVer  = flag.String("flow_export", "ipfix", "protocol used to send records to 'flow_collector': ipfix or netflow9")
+	compact   = flag.Bool("compact_retransmissions", false, "translate retransmitted TCP segments as references to the original ones")
+	fields    = flag.String("fields", "", "comma separated list of field paths to be included in JSON translations; '-' prefixed paths are excluded")
+	encoding  = flag.String("encoding", "json", "encoding of JSON translations: json, cbor or msgpack; requires 'fmt' to be 'json' or 'ecs'")
+	anomalies = flag.Bool("anomalies", false, "score latency, loss, and connection rates against per destination baselines")
+	retries   = flag.Bool("retries", false, "flag duplicate HTTP requests sent over different connections as retries or hedges")
+	connSetup = flag.Bool("connection_setup", false, "attribute the latency of HTTP transactions to the DNS, TCP and TLS setup of new connections")
+	traces    = flag.String("trace_schemes", "", "comma separated list of trace context schemes extracted from HTTP headers, in order: cloud, w3c, grpc, b3, xray and datadog; all if empty")
+	trHeaders = flag.String("trace_headers", "", "semicolon separated list of '[hash:]{header}[={regex}]' rules to extract trace context from custom headers; i/e: 'hash:X-Request-Id'")
+	traceIDs  = flag.String("trace_ids", "", "comma separated list of trace IDs, or prefixes ending with '*', whose flows are the only ones written; i/e: '4bf92f35*'")
+	traceRate = flag.Uint("trace_rate", 0, "only write flows carrying 1 out of every N trace IDs; trace IDs are chosen by hashing them, so all instances choose the same traces; 0 disables it")
+	traceFile = flag.String("trace_ids_file", "", "path of a file with 1 trace ID, or prefix ending with '*', per line whose flows are written; re-read every time it is modified")
+	trackPct  = flag.Uint("trace_tracking_percent", 100, "percentage of flows carrying traces whose responses are linked to requests; flows are chosen by hashing them")
+	trackRate = flag.Uint("trace_tracking_rate", 0, "link responses to requests for at most N new flows carrying traces per second; 0 disables it")
+	labels    = flag.String("labels", "", "semicolon separated list of rules to stamp labels onto records of matching packets; i/e: 'team=payments@port=8080|8443,net=10.0.0.0/8'")
+	payRules  = flag.String("payload_rules", "", "semicolon separated list of '{name}={regex}' or '{name}=hex:{bytes}' rules matched against application payloads, use '\\;' to match ';'; i/e: 'sqli=(?i)union\\s+select;tls=hex:16 03 01'")
+	paySelect = flag.Bool("payload_select", false, "only translate packets whose payload matched any of the payload rules")
+	caches    = flag.String("cache_ports", "", "comma separated list of Redis and Memcached ports whose commands and replies are summarized; i/e: 'redis:6379,memcached:11211'")
+	hashKeys  = flag.Bool("hash_cache_keys", false, "hash the keys of Redis and Memcached commands instead of translating them verbatim")
+	dbPorts   = flag.String("db_ports", "", "comma separated list of PostgreSQL and MySQL ports whose messages are decoded; i/e: 'postgres:5432,mysql:3306'")
+	dbQueries = flag.Bool("db_queries", false, "include query text and error messages in translations of PostgreSQL and MySQL messages")
+	sampling  = flag.Uint("sample_flows", 1, "only translate packets of 1 out of every N flows; flows are chosen by hashing their 5-tuple, so all instances sample the same flows")
+	budget    = flag.Uint("flow_budget", 0, "only translate the first N packets of every flow per interval; packets beyond it are aggregated into top talkers; 0 disables it")
+	latBudget = flag.Uint("latency_budget", 0, "milliseconds which the p99 of the time since packets are captured until their translations are written must not exceed; a warning is logged every 10 seconds it is exceeded; 0 disables it")
+	latSample = flag.Uint("latency_sampling", 0, "while 'latency_budget' is exceeded, double the number of flows 'sample_flows' skips, up to N times; halved again once the p99 is within half of the budget; 0 or 1 only warn")
+	dropRecs  = flag.Uint("drop_records", 0, "log 1 out of every N packets dropped for each reason as a 'dropped' record; drops per reason are always counted; 0 logs none")
+	dropFull  = flag.Bool("drop_on_full_queue", false, "drop translations, instead of blocking all writers, if the queue of a slow writer is full; drops are counted as 'queue_full'")
+	budgetInt = flag.Uint("flow_budget_interval", 60, "seconds after which flow budgets are reset and top talkers are reported")
+	brokers   = flag.String("broker_ports", "", "comma separated list of AMQP 0-9-1 and Kafka ports whose frames are summarized; i/e: 'amqp:5672,kafka:9092'")
+	routes    = flag.String("routes", "", "semicolon separated list of '{target}@{route}' rules to route records into writers: stdout, file, otlp, clickhouse, or additional file paths; i/e: 'stdout@severity=error;/pcap/dns@proto=dns'")
+	tmpl      = flag.String("template", "", "path of the Go text/template used to render translations; requires 'fmt' to be 'template'")
+	debugAddr = flag.String("debug_addr", "", "'host:port' to serve how responses are linked to traced requests at '/debug/traces' and '/debug/flows'; i/e: 'localhost:6060'")
+	ctlAddr   = flag.String("control_addr", "", "'host:port' or 'unix:{path}' to serve the control API at '/control': status, stop, pause, resume and rotation of captures, and their BPF filters; i/e: 'localhost:6062'")
+	ctlGRPC   = flag.String("control_grpc_addr", "", "'host:port' or 'unix:{path}' to serve the 'PcapControl' gRPC service, which streams stats and translations; requires building with tag 'grpc'; i/e: 'localhost:6063'")
+	hcAddr    = flag.String("health_addr", "", "'host:port' to serve Kubernetes probes at '/healthz' and '/readyz', which fail with the reasons why captures stopped making progress, or are not ready; i/e: ':6064'")
+	sessQueue = flag.Bool("session_queue", false, "only capture during sessions queued by the config file, or by the control API at '/control/sessions'; without 'control_addr', the CLI exits once all sessions end")
+	cfgFile   = flag.String("config", "", "path of a YAML, or JSON if its extension is '.json', config file which replaces flags describing the capture, its filters, writers and format options; '${VAR}' and '${VAR:-default}' are replaced by environment variables")
+	schema    = flag.Bool("schema", false, "print the schema of translations produced by 'fmt' and exit")
+	profiles  = flag.String("profiles", "", "semicolon separated list of '{name}[:{interval}]@{filter expression}' capture profiles written into their own files, next to 'w'; i/e: 'dns@udp and port 53;egress-443:300@port 443'")
+	ephs      = flag.String("ephemerals", pcap.PcapEphemeralPortsFromHost, "comma separated range of ephemeral ports used to tell clients from services, i/e: '32768,60999'; 'host' reads it from '/proc/sys/net/ipv4/ip_local_port_range'")
+	ephs6     = flag.String("ephemerals6", "", "comma separated range of ephemeral ports of IPv6 sockets; if empty, 'ephemerals' applies to both IPv4 and IPv6")
+	triggers  = flag.String("triggers", "", "semicolon separated list of '{condition}[@{port}][>={packets per second}]' rules which start translating packets: tcp_rst, http_5xx or dns_servfail; i/e: 'tcp_rst>=20;http_5xx@8080'")
+	trWindow  = flag.Uint("trigger_window", 30, "seconds of packets captured before a trigger fires which are translated along with the ones that follow")
+	cooldown  = flag.Uint("trigger_cooldown", 60, "seconds without triggers firing after which packets are buffered again")
+	manifests = flag.Bool("manifests", false, "write a '{file}.manifest.json' next to every completed file: filter, interface, start and end time, packet, byte and drop counts, schema version and checksum")
+	drain     = flag.Uint("drain_deadline", 3, "seconds given to captures, once stopped, to translate and write the packets they already read, and to summarize open flows; translations which are not written in time are dumped into stderr")
+	selfOTLP  = flag.String("self_telemetry", "", "OTLP/gRPC endpoint to export how long packets spend in every stage of the pipeline to, as metrics, along with traces of sampled packets; requires building with tag 'otlp'")
+	selfRate  = flag.Uint("self_trace_rate", 1000, "trace 1 out of every N packets through the pipeline; requires 'self_telemetry'; 0 disables traces but not metrics")
+	statsInt  = flag.Uint("stats_interval", 0, "seconds after which a 'stats' JSON document with the packets and bytes read during the last second and minute, per L4 protocol, is logged into stderr; 0 disables it")
+	mtAddr    = flag.String("metrics_addr", "", "'host:port' to serve packets and bytes captured, and read during the last second and minute per L4 protocol, at '/metrics' using the Prometheus text format; also served by the control API; i/e: ':9090'")
+	logLevel  = flag.String("log_level", "", "minimum severity of the JSON logs written into stderr by captures: debug, info, warn or error; if empty, debug logs are only written while 'debug' is enabled by the config file")
+	dryRun    = flag.Bool("dry_run", false, "compile 'filter' or 'filter_expr' and print the resulting BPF program, as 'tcpdump -dd' does, and exit")
 )
 
 var logger = log.New(os.Stderr, "[pcap] - ", log.LstdFlags)
 
+// destinations listed per section by `diff` text reports
+const diffTextLimit = 20
+
+// cause of engines being stopped to be re-created with a new config file
+var errRestart = errors.New("restarting to apply a new config file")
+
 func handleError(prefix *string, err error) {
 	if errors.Is(err, context.Canceled) {
 		logger.Printf("%s cancelled\n", *prefix)
@@ -77,10 +146,65 @@ func newPcapEngine(engine *string, config *pcap.PcapConfig) (pcap.PcapEngine, er
 	return nil, fmt.Errorf("unavailable: %s", pcapEngine)
 }
 
-func main() {
-	flag.Parse()
+// diffCaptures reports significant differences between 2 captures; the report is JSON if 'fmt' is 'json'.
+func diffCaptures(args []string) {
+	if len(args) != 2 {
+		logger.Fatalf("usage: pcap [-fmt=json] diff {a} {b}\n")
+	}
+
+	diff, err := pcap.DiffCaptures(args[0], args[1])
+	if err != nil {
+		logger.Fatalf("%v\n", err)
+	}
+
+	if *format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(diff)
+	} else {
+		err = diff.WriteText(os.Stdout, diffTextLimit)
+	}
+	if err != nil {
+		logger.Fatalf("%v\n", err)
+	}
+}
+
+// exportFlowFeatures writes numeric features of all flows of a capture as CSV or Parquet; i/e: to train anomaly detection models.
+func exportFlowFeatures(args []string) {
+	if len(args) < 1 || len(args) > 2 {
+		logger.Fatalf("usage: pcap features {capture} [{output}.csv|{output}.parquet]\n")
+	}
+
+	output := ""
+	if len(args) == 2 {
+		output = args[1]
+	}
+
+	if err := pcap.ExportFlowFeatures(args[0], output, os.Stdout); err != nil {
+		logger.Fatalf("%v\n", err)
+	}
+}
+
+// newPcapConfig creates the configuration of engines out of flags.
+func newPcapConfig(compatFilters pcap.PcapFilters) *pcap.PcapConfig {
+	ephemerals, err := pcap.ParsePcapEphemeralPorts(*ephs, *ephs6)
+	if err != nil {
+		logger.Fatalf("%v\n", err)
+	}
+
+	pcapProfiles, err := pcap.NewPcapProfiles(*profiles)
+	if err != nil {
+		logger.Fatalf("%v\n", err)
+	}
 
-	config := &pcap.PcapConfig{
+	var pcapTriggers *pcap.PcapTriggers
+	if *triggers != "" {
+		if pcapTriggers, err = pcap.NewPcapTriggers(*triggers, time.Duration(*trWindow)*time.Second, time.Duration(*cooldown)*time.Second); err != nil {
+			logger.Fatalf("%v\n", err)
+		}
+	}
+
+	return &pcap.PcapConfig{
 		Promisc:   *promisc,
 		Snaplen:   *snaplen,
 		TsType:    *tsType,
@@ -91,10 +215,116 @@ func main() {
 		Extension: *extension,
 		Ordered:   *ordered,
 		ConnTrack: *conntrack,
+		Template:  *tmpl,
+
+		Ephemerals:    ephemerals,
+		CompatFilters: compatFilters,
+		Profiles:      pcapProfiles,
+		Triggers:      pcapTriggers,
+		Manifests:     *manifests,
+		DrainDeadline: time.Duration(*drain) * time.Second,
 	}
+}
 
-	exp, _ := regexp.Compile(fmt.Sprintf("^(?:ipvlan-)?%s.*", *iface))
-	devs, _ := pcap.FindDevicesByRegex(exp)
+// loadPcapConfigFile loads the config file at `path`, and creates the configuration of engines out of it.
+func loadPcapConfigFile(path string) (*pcap.PcapConfigFile, *pcap.PcapConfig, error) {
+	configFile, err := pcap.LoadPcapConfigFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	config, err := configFile.NewConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	return configFile, config, nil
+}
+
+func main() {
+	flag.Parse()
+
+	if *schema {
+		translationSchema, err := pcap.TranslationSchema(*format)
+		if err != nil {
+			logger.Fatalf("%v\n", err)
+		}
+		os.Stdout.Write(translationSchema)
+		return
+	}
+
+	var compatFilters pcap.PcapFilters
+	if *filterExp != "" {
+		if *filter != "" {
+			logger.Fatalf("'filter' and 'filter_expr' are mutually exclusive\n")
+		}
+		compatFilters = pcap.NewPcapFilters()
+		bpfFilter, err := pcap.CompilePcapFilterExpression(*filterExp, compatFilters)
+		if err != nil {
+			logger.Fatalf("%v\n", err)
+		}
+		*filter = bpfFilter
+	}
+
+	if *dryRun {
+		instructions, err := pcap.CompilePcapFilter(*filter, *snaplen)
+		if err != nil {
+			logger.Fatalf("%v\n", err)
+		}
+		for _, instruction := range instructions {
+			fmt.Printf("{ 0x%x, %d, %d, 0x%08x },\n", instruction.Code, instruction.Jt, instruction.Jf, instruction.K)
+		}
+		return
+	}
+
+	// i/e: `pcap -fmt=json diff good.pcap bad.json`
+	if flag.Arg(0) == "diff" {
+		diffCaptures(flag.Args()[1:])
+		return
+	}
+
+	// i/e: `pcap features capture.pcap flows.parquet`
+	if flag.Arg(0) == "features" {
+		exportFlowFeatures(flag.Args()[1:])
+		return
+	}
+
+	// the config file takes precedence over flags, even after it is reloaded
+	flagEngine, flagIface, flagFormat := *engine, *iface, *format
+	useConfigFile := func(configFile *pcap.PcapConfigFile) {
+		*engine, *iface, *format = flagEngine, flagIface, flagFormat
+		if configFile.Engine != "" {
+			*engine = configFile.Engine
+		}
+		if configFile.Iface != "" {
+			*iface = configFile.Iface
+		}
+		if configFile.Format != "" {
+			*format = configFile.Format
+		}
+	}
+
+	var configFile *pcap.PcapConfigFile
+	var config *pcap.PcapConfig
+	if *cfgFile != "" {
+		var err error
+		if configFile, config, err = loadPcapConfigFile(*cfgFile); err != nil {
+			logger.Fatalf("%v\n", err)
+		}
+		useConfigFile(configFile)
+	} else {
+		config = newPcapConfig(compatFilters)
+	}
+
+	// logs of captures may be silenced regardless of how the config is created
+	var captureLogger *slog.Logger
+	if *logLevel != "" {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(*logLevel)); err != nil {
+			logger.Fatalf("%v\n", err)
+		}
+		captureLogger = pcap.NewPcapLogger(os.Stderr, level)
+	}
+	config.Logger = captureLogger
+	config.StatsInterval = time.Duration(*statsInt) * time.Second
 
 	ctx := context.Background()
 	var cancel context.CancelFunc
@@ -102,6 +332,113 @@ func main() {
 	id := fmt.Sprintf("cli/%s", uuid.New())
 	ctx = context.WithValue(ctx, pcap.PcapContextID, id)
 	ctx = context.WithValue(ctx, pcap.PcapContextLogName, `log/`+id)
+	if *sessions != "" {
+		ctx = context.WithValue(ctx, pcap.PcapContextSessionKeys, strings.Split(*sessions, ","))
+	}
+	ctx = context.WithValue(ctx, pcap.PcapContextCompactRetransmissions, *compact)
+	ctx = context.WithValue(ctx, pcap.PcapContextAnomalies, *anomalies)
+	ctx = context.WithValue(ctx, pcap.PcapContextRetries, *retries)
+	ctx = context.WithValue(ctx, pcap.PcapContextConnectionSetup, *connSetup)
+	// Parquet and ClickHouse writers are fed with JSON translations
+	if *encoding != "json" && (*extension == "parquet" || *chDSN != "") {
+		logger.Printf("'%s' encoding disabled: Parquet and ClickHouse writers require 'json'\n", *encoding)
+		*encoding = "json"
+	}
+	ctx = context.WithValue(ctx, pcap.PcapContextEncoding, *encoding)
+	if *fields != "" {
+		ctx = context.WithValue(ctx, pcap.PcapContextFields, strings.Split(*fields, ","))
+	}
+	if *labels != "" {
+		ctx = context.WithValue(ctx, pcap.PcapContextLabels, strings.Split(*labels, ";"))
+	}
+	if *payRules != "" {
+		rules := pcap.SplitPcapPayloadRules(*payRules)
+		if err := pcap.ValidatePcapPayloadRules(rules); err != nil {
+			logger.Fatalf("%v\n", err)
+		}
+		ctx = context.WithValue(ctx, pcap.PcapContextPayloadRules, rules)
+		ctx = context.WithValue(ctx, pcap.PcapContextPayloadSelect, *paySelect)
+	}
+	if *traces != "" {
+		ctx = context.WithValue(ctx, pcap.PcapContextTraceSchemes, strings.Split(*traces, ","))
+	}
+	if *trHeaders != "" {
+		ctx = context.WithValue(ctx, pcap.PcapContextTraceHeaders, strings.Split(*trHeaders, ";"))
+	}
+	if *traceIDs != "" || *traceRate > 0 || *traceFile != "" {
+		scope := pcap.NewPcapTraceScope(strings.Split(*traceIDs, ","), *traceRate)
+		if *traceFile != "" {
+			go pcap.WatchPcapTraceScope(ctx, scope, *traceFile, 5*time.Second)
+		}
+		ctx = context.WithValue(ctx, pcap.PcapContextTraceScope, scope)
+	}
+	if *trackPct < 100 || *trackRate > 0 {
+		ctx = context.WithValue(ctx, pcap.PcapContextTraceTrackingPercent, *trackPct)
+		ctx = context.WithValue(ctx, pcap.PcapContextTraceTrackingRate, *trackRate)
+	}
+	if *caches != "" {
+		ctx = context.WithValue(ctx, pcap.PcapContextCachePorts, strings.Split(*caches, ","))
+	}
+	ctx = context.WithValue(ctx, pcap.PcapContextHashCacheKeys, *hashKeys)
+	if *dbPorts != "" {
+		ctx = context.WithValue(ctx, pcap.PcapContextDBPorts, strings.Split(*dbPorts, ","))
+	}
+	ctx = context.WithValue(ctx, pcap.PcapContextDBQueries, *dbQueries)
+	if *brokers != "" {
+		ctx = context.WithValue(ctx, pcap.PcapContextBrokerPorts, strings.Split(*brokers, ","))
+	}
+	ctx = context.WithValue(ctx, pcap.PcapContextFlowSampling, *sampling)
+	ctx = context.WithValue(ctx, pcap.PcapContextFlowBudget, *budget)
+	ctx = context.WithValue(ctx, pcap.PcapContextFlowBudgetInterval, time.Duration(*budgetInt)*time.Second)
+	ctx = context.WithValue(ctx, pcap.PcapContextLatencyBudget, time.Duration(*latBudget)*time.Millisecond)
+	ctx = context.WithValue(ctx, pcap.PcapContextLatencyBudgetSampling, *latSample)
+	ctx = context.WithValue(ctx, pcap.PcapContextDropRecords, *dropRecs)
+	ctx = context.WithValue(ctx, pcap.PcapContextDropOnFullQueue, *dropFull)
+	// debug logging may be toggled by reloading the config file
+	var debugSwitch *atomic.Bool
+	if configFile != nil {
+		debugSwitch = new(atomic.Bool)
+		debugSwitch.Store(config.Debug)
+		ctx = context.WithValue(ctx, pcap.PcapContextDebugSwitch, debugSwitch)
+	}
+
+	var flowExporter *pcap.PcapFlowExporter
+	var flowExclusion string
+	if *engine == "google" && *ipfix != "" {
+		var err error
+		// flows are summarized out of JSON translations, so all formats but `proto` are supported
+		flowExporter, err = pcap.NewPcapFlowExporter(*ipfix, pcap.PcapFlowExportVersion(*ipfixVer), 0)
+		if err == nil {
+			ctx = context.WithValue(ctx, pcap.PcapContextFlowEvents, &pcap.PcapFlowEventHandlers{
+				OnFlowSummary: flowExporter.OnFlowSummary,
+			})
+			// records sent to the collector must not be captured
+			flowExclusion = flowExporter.Exclusion()
+		} else {
+			logger.Printf("flow exporter disabled: %v\n", err)
+		}
+	}
+
+	var telemetryExporter *pcap.PcapTelemetryExporter
+	if *engine == "google" && *selfOTLP != "" {
+		var err error
+		telemetryExporter, err = pcap.NewPcapTelemetryExporter(*selfOTLP, *selfRate)
+		if err == nil {
+			ctx = context.WithValue(ctx, pcap.PcapContextPipelineTelemetry, telemetryExporter.Telemetry())
+		} else {
+			logger.Printf("pipeline telemetry disabled: %v\n", err)
+		}
+	}
+
+	if *engine == "google" && *debugAddr != "" {
+		correlations := pcap.NewPcapCorrelationIndex()
+		ctx = context.WithValue(ctx, pcap.PcapContextCorrelationIndex, correlations)
+		go func() {
+			if err := http.ListenAndServe(*debugAddr, pcap.NewPcapDebugHandler(correlations)); err != nil {
+				logger.Printf("debug server disabled: %v\n", err)
+			}
+		}()
+	}
 
 	if *timeout > 0 {
 		ctx, cancel = context.WithTimeout(ctx, time.Duration(*timeout)*time.Second)
@@ -109,24 +446,376 @@ func main() {
 		ctx, cancel = context.WithCancel(ctx)
 	}
 
-	var wg sync.WaitGroup
-
-	stopDeadlineChan := make(chan *time.Duration, 1)
-
+	terminating := make(chan struct{})
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
 	go func() {
 		<-signals
 		cancel()
-		deadline := 3 * time.Second
-		stopDeadlineChan <- &deadline
+		close(terminating)
+	}()
+
+	// reloads are requested by `SIGHUP`, or by the control API, and their outcome is sent back to the requester
+	reloads := make(chan chan error)
+	reload := func() error {
+		outcome := make(chan error, 1)
+		select {
+		case reloads <- outcome:
+			return <-outcome
+		case <-terminating:
+			return fmt.Errorf("already stopping")
+		}
+	}
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	go func() {
+		for range hangups {
+			if err := reload(); err != nil {
+				logger.Printf("reload failed: %v\n", err)
+			}
+		}
 	}()
 
+	// engines run once: captures may be stopped, but not started again; a restart re-creates them
+	control := pcap.NewPcapControl(config.CompatFilters, &pcap.PcapControlHooks{
+		Stop: func() error {
+			select {
+			case signals <- syscall.SIGTERM:
+				return nil
+			default:
+				return fmt.Errorf("already stopping")
+			}
+		},
+		Reload: reload,
+	})
+	if *ctlAddr != "" {
+		listener, err := pcap.ListenPcapControl(*ctlAddr)
+		if err != nil {
+			logger.Fatalf("%v\n", err)
+		}
+		go func() {
+			if err := http.Serve(listener, pcap.NewPcapControlHandler(control)); err != nil {
+				logger.Printf("control server disabled: %v\n", err)
+			}
+		}()
+	}
+	if *ctlGRPC != "" {
+		listener, err := pcap.ListenPcapControl(*ctlGRPC)
+		if err != nil {
+			logger.Fatalf("%v\n", err)
+		}
+		go func() {
+			if err := pcap.ServePcapControlGRPC(listener, control); err != nil {
+				logger.Printf("gRPC control service disabled: %v\n", err)
+			}
+		}()
+	}
+	if *hcAddr != "" {
+		go func() {
+			if err := http.ListenAndServe(*hcAddr, pcap.NewPcapHealthHandler(control)); err != nil {
+				logger.Printf("health server disabled: %v\n", err)
+			}
+		}()
+	}
+
+	if *mtAddr != "" {
+		go func() {
+			if err := http.ListenAndServe(*mtAddr, pcap.NewPcapMetricsHandler(control)); err != nil {
+				logger.Printf("metrics server disabled: %v\n", err)
+			}
+		}()
+	}
+
+	if flowExclusion != "" {
+		config.Exclude = append(config.Exclude, flowExclusion)
+	}
+	replaceConfig := func(nextConfigFile *pcap.PcapConfigFile, nextConfig *pcap.PcapConfig) {
+		configFile, config = nextConfigFile, nextConfig
+		config.Logger = captureLogger
+		config.StatsInterval = time.Duration(*statsInt) * time.Second
+		if flowExclusion != "" {
+			config.Exclude = append(config.Exclude, flowExclusion)
+		}
+		useConfigFile(configFile)
+		control.Reset(config.CompatFilters)
+		debugSwitch.Store(config.Debug)
+	}
+
+	var sessions *pcap.PcapSessions
+	if *sessQueue || (configFile != nil && len(configFile.Sessions) > 0) {
+		var err error
+		var configSessions []pcap.PcapSession
+		if configFile != nil {
+			configSessions = configFile.Sessions
+		}
+		if sessions, err = pcap.NewPcapSessions(configSessions...); err != nil {
+			logger.Fatalf("%v\n", err)
+		}
+		control.UseSessions(sessions)
+	}
+
+	type pcapSession struct {
+		ctx context.Context
+		end func()
+		ok  bool
+	}
+	var session *pcapSession
+	for {
+		runCtx := ctx
+		// engines are only created while sessions run: reloads in between replace the config used by the next one
+		if sessions != nil && session == nil {
+			started := make(chan *pcapSession, 1)
+			go func() {
+				sessionCtx, end, ok := sessions.Next(ctx, control, *ctlAddr != "")
+				started <- &pcapSession{sessionCtx, end, ok}
+			}()
+		awaiting:
+			for {
+				select {
+				case session = <-started:
+					break awaiting
+				case outcome := <-reloads:
+					if configFile == nil {
+						outcome <- errors.New("captures were not created from a config file")
+						continue
+					}
+					nextConfigFile, nextConfig, err := loadPcapConfigFile(*cfgFile)
+					if err == nil {
+						replaceConfig(nextConfigFile, nextConfig)
+						err = sessions.Merge(configFile.Sessions...)
+					}
+					outcome <- err
+				}
+			}
+			if !session.ok {
+				break
+			}
+			// captures of previous sessions are forgotten: bytes of sessions are measured by `control` since they started
+			control.Reset(config.CompatFilters)
+		}
+		if session != nil {
+			runCtx = session.ctx
+		}
+
+		nextConfigFile, nextConfig := runPCAP(runCtx, &id, config, control, configFile, sessions, debugSwitch, reloads)
+		if nextConfigFile != nil {
+			// engines of the running session, if any, are re-created out of the new config file
+			replaceConfig(nextConfigFile, nextConfig)
+			continue
+		}
+		if session == nil {
+			break
+		}
+		session.end()
+		session = nil
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	// summaries of connections still tracked are emitted when engines stop
+	if flowExporter != nil {
+		flowExporter.Close()
+	}
+	// engines are done: stats are final, and no more packets are traced
+	if telemetryExporter != nil {
+		telemetryExporter.Close()
+	}
+}
+
+// newPcapWriters creates the writers requested by flags for the device identified by `ifaceNameAndIndex`.
+func newPcapWriters(ctx context.Context, ifaceNameAndIndex string, config *pcap.PcapConfig) []pcap.PcapWriter {
+	if *writeTo == "stdout" {
+		*stdout = true
+	}
+
+	pcapWriters := []pcap.PcapWriter{}
+	var pcapWriter pcap.PcapWriter
+	var err error
+
+	pcapRoutes := pcap.NewPcapRoutes(*routes)
+
+	exportOTLP := *engine == "google" && *otlp != ""
+	if exportOTLP && *format != "otlp" {
+		logger.Printf("OTLP exporter disabled: format is '%s'\n", *format)
+		exportOTLP = false
+	}
+
+	// OTLP translations are binary: they should not be written into `stdout`
+	if *engine == "google" && *stdout && !exportOTLP {
+		pcapWriter, err = pcap.NewStdoutPcapWriter(ctx, &ifaceNameAndIndex)
+		if err == nil {
+			pcapWriters = append(pcapWriters, pcapRoutes.Route("stdout", pcapWriter))
+		}
+	}
+
+	if *engine == "google" && *writeTo != "stdout" {
+		if *extension == "parquet" {
+			// Parquet files are generated out of JSON translations
+			pcapWriter, err = pcap.NewParquetPcapWriter(ctx, &ifaceNameAndIndex, writeTo, timezone, *interval)
+		} else {
+			pcapWriter, err = pcap.NewPcapWriter(ctx, &ifaceNameAndIndex, writeTo, extension, timezone, *interval)
+		}
+		if err == nil {
+			pcapWriters = append(pcapWriters, pcapRoutes.Route("file", pcapWriter))
+		} else {
+			logger.Printf("%v\n", err)
+		}
+	}
+
+	if exportOTLP {
+		pcapWriter, err = pcap.NewOTLPPcapWriter(ctx, &ifaceNameAndIndex, otlp)
+		if err == nil {
+			pcapWriters = append(pcapWriters, pcapRoutes.Route("otlp", pcapWriter))
+		} else {
+			logger.Printf("%v\n", err)
+		}
+	}
+
+	if *engine == "google" && *chDSN != "" {
+		if *format == "json" {
+			pcapWriter, err = pcap.NewClickHousePcapWriter(ctx, &ifaceNameAndIndex, chDSN, chTable)
+			if err == nil {
+				pcapWriters = append(pcapWriters, pcapRoutes.Route("clickhouse", pcapWriter))
+			} else {
+				logger.Printf("%v\n", err)
+			}
+		} else {
+			logger.Printf("ClickHouse writer disabled: format is '%s'\n", *format)
+		}
+	}
+
+	// targets which are not writers are paths of additional files to route records into
+	for _, target := range pcapRoutes.Targets() {
+		switch target {
+		case "stdout", "file", "otlp", "clickhouse":
+			continue
+		}
+		if *engine != "google" || *extension == "parquet" {
+			logger.Printf("route to '%s' disabled: engine is '%s' and extension is '%s'\n", target, *engine, *extension)
+			continue
+		}
+		template := target
+		pcapWriter, err = pcap.NewPcapWriter(ctx, &ifaceNameAndIndex, &template, extension, timezone, *interval)
+		if err == nil {
+			pcapWriters = append(pcapWriters, pcapRoutes.Route(target, pcapWriter))
+		} else {
+			logger.Printf("%v\n", err)
+		}
+	}
+
+	// profiles write into their own files, named after the files of the capture
+	for _, profile := range config.Profiles {
+		if *engine != "google" || *writeTo == "stdout" {
+			logger.Printf("profile '%s' disabled: engine is '%s' and output is '%s'\n", profile.Name, *engine, *writeTo)
+			continue
+		}
+		template := fmt.Sprintf("%s-%s", *writeTo, profile.Name)
+		if *extension == "parquet" {
+			pcapWriter, err = pcap.NewParquetPcapWriter(ctx, &ifaceNameAndIndex, &template, timezone, profile.RotationInterval(*interval))
+		} else {
+			pcapWriter, err = pcap.NewPcapWriter(ctx, &ifaceNameAndIndex, &template, extension, timezone, profile.RotationInterval(*interval))
+		}
+		if err == nil {
+			pcapWriters = append(pcapWriters, profile.Writer(pcapWriter))
+		} else {
+			logger.Printf("%v\n", err)
+		}
+	}
+
+	return pcapWriters
+}
+
+// runPCAP starts an engine per device, and blocks until all of them stop;
+// if a reload requires engines to be re-created, it stops them and returns the new config file along with its configuration.
+func runPCAP(
+	ctx context.Context,
+	id *string,
+	config *pcap.PcapConfig,
+	control *pcap.PcapControl,
+	configFile *pcap.PcapConfigFile,
+	sessions *pcap.PcapSessions,
+	debugSwitch *atomic.Bool,
+	reloads <-chan chan error,
+) (*pcap.PcapConfigFile, *pcap.PcapConfig) {
+	exp, _ := regexp.Compile(fmt.Sprintf("^(?:ipvlan-)?%s.*", *iface))
+	devs, _ := pcap.FindDevicesByRegex(exp)
+
+	ctx, restart := context.WithCancelCause(ctx)
+	defer restart(nil)
+	// options set by the config file take precedence over flags
+	if configFile != nil {
+		ctx = configFile.Context(ctx)
+	}
+
+	stopDeadlineChan := make(chan *time.Duration, len(devs))
+	stop := func() {
+		// time given to engines to drain translations, and to flush their writers, when they are stopped
+		deadline := time.Duration(*drain) * time.Second
+		for range devs {
+			stopDeadlineChan <- &deadline
+		}
+	}
+
+	var wg sync.WaitGroup
 	for _, dev := range devs {
 		wg.Add(1)
-		go startPCAP(ctx, &id, dev, config, &wg, stopDeadlineChan)
+		go startPCAP(ctx, id, dev, config, control, configFile, &wg, stopDeadlineChan)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	for {
+		select {
+		case <-done:
+			return nil, nil
+
+		// terminated, timed out, or the session ended
+		case <-ctx.Done():
+			stop()
+			<-done
+			return nil, nil
+
+		case outcome := <-reloads:
+			if configFile == nil {
+				outcome <- errors.New("captures were not created from a config file")
+				continue
+			}
+			nextConfigFile, nextConfig, err := loadPcapConfigFile(*cfgFile)
+			if err != nil {
+				outcome <- err
+				continue
+			}
+			diff := pcap.DiffPcapConfigFiles(configFile, nextConfigFile)
+			if sessions != nil {
+				if err = sessions.Merge(nextConfigFile.Sessions...); err != nil {
+					outcome <- err
+					continue
+				}
+			}
+			for _, change := range diff.Changes {
+				logger.Printf("config changed: %s | restart: %t\n", change.Key, change.Restart)
+			}
+			if !diff.RequiresRestart() {
+				// running engines keep using `config`: only its filters are updated
+				if err = diff.Apply(config.CompatFilters, debugSwitch, control.Writers()...); err == nil {
+					configFile = nextConfigFile
+				}
+				outcome <- err
+				continue
+			}
+			// connection tracking state, and requests waiting for responses, are dropped along with engines
+			logger.Printf("restarting engines to apply '%s'\n", *cfgFile)
+			restart(errRestart)
+			stop()
+			<-done
+			outcome <- nil
+			return nextConfigFile, nextConfig
+		}
 	}
-	wg.Wait()
 }
 
 func startPCAP(
@@ -134,6 +823,8 @@ func startPCAP(
 	id *string,
 	dev *pcap.PcapDevice,
 	config *pcap.PcapConfig,
+	control *pcap.PcapControl,
+	configFile *pcap.PcapConfigFile,
 	wg *sync.WaitGroup,
 	stopDeadlineChan chan *time.Duration,
 ) {
@@ -158,32 +849,34 @@ func startPCAP(
 		return
 	}
 
-	if *writeTo == "stdout" {
-		*stdout = true
-	}
-
-	pcapWriters := []pcap.PcapWriter{}
-	var pcapWriter pcap.PcapWriter
-
-	if *engine == "google" && *stdout {
-		pcapWriter, err = pcap.NewStdoutPcapWriter(ctx, &ifaceNameAndIndex)
-		if err == nil {
-			pcapWriters = append(pcapWriters, pcapWriter)
+	var pcapWriters []pcap.PcapWriter
+	if configFile != nil {
+		if pcapWriters, err = configFile.NewWriters(ctx, &ifaceNameAndIndex, config.Profiles); err != nil {
+			logger.Fatalf("%v\n", err)
 		}
+	} else {
+		pcapWriters = newPcapWriters(ctx, ifaceNameAndIndex, config)
 	}
 
-	if *engine == "google" && *writeTo != "stdout" {
-		pcapWriter, err = pcap.NewPcapWriter(ctx, &ifaceNameAndIndex, writeTo, extension, timezone, *interval)
-		if err == nil {
-			pcapWriters = append(pcapWriters, pcapWriter)
-		}
+	// translations are only streamed to clients of the control API and of the gRPC control service
+	if *engine == "google" && (*ctlAddr != "" || *ctlGRPC != "") {
+		pcapWriters = append(pcapWriters, control.Writer(ifaceNameAndIndex, &ifaceNameAndIndex, *format))
 	}
+	control.Register(ifaceNameAndIndex, pcapEngine, pcapWriters)
 
 	prefix := fmt.Sprintf("[iface:%s] execution '%s'", iface, *id)
 	logger.Printf("%s started", prefix)
 	// this is a blocking call
 	err = pcapEngine.Start(ctx, pcapWriters, stopDeadlineChan)
-	if err != nil {
+	if cause := context.Cause(ctx); errors.Is(cause, errRestart) || errors.Is(cause, pcap.ErrPcapSessionEnded) {
+		// outputs are finalized: engines of the next session, or re-created ones, create their own writers; `stdout` must not be closed
+		for _, pcapWriter := range pcapWriters {
+			if !pcapWriter.IsStdOutOrErr() {
+				pcapWriter.Close()
+			}
+		}
+		logger.Printf("%s stopped: %v", prefix, cause)
+	} else if err != nil {
 		handleError(&prefix, err)
 	}
 	wg.Done()
@@ -14,7 +14,7 @@
 
 // Code generated by protoc-gen-go. DO NOT EDIT.
 // versions:
-// 	protoc-gen-go v1.28.1
+// 	protoc-gen-go v1.34.2
 // 	protoc        v3.21.6
 // source: packet.proto
 
@@ -35,6 +35,54 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+type Packet_Version int32
+
+const (
+	Packet_VERSION_UNSPECIFIED Packet_Version = 0
+	Packet_VERSION_1           Packet_Version = 1
+)
+
+// Enum value maps for Packet_Version.
+var (
+	Packet_Version_name = map[int32]string{
+		0: "VERSION_UNSPECIFIED",
+		1: "VERSION_1",
+	}
+	Packet_Version_value = map[string]int32{
+		"VERSION_UNSPECIFIED": 0,
+		"VERSION_1":           1,
+	}
+)
+
+func (x Packet_Version) Enum() *Packet_Version {
+	p := new(Packet_Version)
+	*p = x
+	return p
+}
+
+func (x Packet_Version) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Packet_Version) Descriptor() protoreflect.EnumDescriptor {
+	return file_packet_proto_enumTypes[0].Descriptor()
+}
+
+func (Packet_Version) Type() protoreflect.EnumType {
+	return &file_packet_proto_enumTypes[0]
+}
+
+func (x Packet_Version) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Packet_Version.Descriptor instead.
+func (Packet_Version) EnumDescriptor() ([]byte, []int) {
+	return file_packet_proto_rawDescGZIP(), []int{0, 0}
+}
+
+// Packet mirrors the structure of JSON translations:
+//   - `version` must be increased whenever a backwards incompatible change is introduced.
 type Packet struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -46,11 +94,28 @@ type Packet struct {
 	Iface     *Packet_Interface      `protobuf:"bytes,4,opt,name=iface,proto3" json:"iface,omitempty"`
 	L2        *Packet_Layer2         `protobuf:"bytes,5,opt,name=l2,proto3" json:"l2,omitempty"`
 	// Types that are assignable to L3:
-	//
 	//	*Packet_Ip
 	//	*Packet_Ip4
 	//	*Packet_Ip6
+	//	*Packet_Arp
 	L3 isPacket_L3 `protobuf_oneof:"l3"`
+	// Types that are assignable to L4:
+	//	*Packet_Udp
+	//	*Packet_Tcp
+	//	*Packet_Icmp
+	//	*Packet_Sctp
+	L4      isPacket_L4     `protobuf_oneof:"l4"`
+	Tls     *Packet_TLS     `protobuf:"bytes,13,opt,name=tls,proto3" json:"tls,omitempty"`
+	Dns     *Packet_DNS     `protobuf:"bytes,14,opt,name=dns,proto3" json:"dns,omitempty"`
+	Version Packet_Version  `protobuf:"varint,15,opt,name=version,proto3,enum=pcap.v1.Packet_Version" json:"version,omitempty"`
+	Flow    uint64          `protobuf:"varint,16,opt,name=flow,proto3" json:"flow,omitempty"`
+	Message string          `protobuf:"bytes,17,opt,name=message,proto3" json:"message,omitempty"`
+	Errors  []*Packet_Error `protobuf:"bytes,18,rep,name=errors,proto3" json:"errors,omitempty"`
+	Dhcp    *Packet_DHCP    `protobuf:"bytes,19,opt,name=dhcp,proto3" json:"dhcp,omitempty"`
+	// labels of the rules matching this packet
+	Labels map[string]string `protobuf:"bytes,21,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	Sip    *Packet_SIP       `protobuf:"bytes,22,opt,name=sip,proto3" json:"sip,omitempty"`
+	Ntp    *Packet_NTP       `protobuf:"bytes,23,opt,name=ntp,proto3" json:"ntp,omitempty"`
 }
 
 func (x *Packet) Reset() {
@@ -148,6 +213,118 @@ func (x *Packet) GetIp6() *Packet_IPv6 {
 	return nil
 }
 
+func (x *Packet) GetArp() *Packet_ARP {
+	if x, ok := x.GetL3().(*Packet_Arp); ok {
+		return x.Arp
+	}
+	return nil
+}
+
+func (m *Packet) GetL4() isPacket_L4 {
+	if m != nil {
+		return m.L4
+	}
+	return nil
+}
+
+func (x *Packet) GetUdp() *Packet_UDP {
+	if x, ok := x.GetL4().(*Packet_Udp); ok {
+		return x.Udp
+	}
+	return nil
+}
+
+func (x *Packet) GetTcp() *Packet_TCP {
+	if x, ok := x.GetL4().(*Packet_Tcp); ok {
+		return x.Tcp
+	}
+	return nil
+}
+
+func (x *Packet) GetIcmp() *Packet_ICMP {
+	if x, ok := x.GetL4().(*Packet_Icmp); ok {
+		return x.Icmp
+	}
+	return nil
+}
+
+func (x *Packet) GetSctp() *Packet_SCTP {
+	if x, ok := x.GetL4().(*Packet_Sctp); ok {
+		return x.Sctp
+	}
+	return nil
+}
+
+func (x *Packet) GetTls() *Packet_TLS {
+	if x != nil {
+		return x.Tls
+	}
+	return nil
+}
+
+func (x *Packet) GetDns() *Packet_DNS {
+	if x != nil {
+		return x.Dns
+	}
+	return nil
+}
+
+func (x *Packet) GetVersion() Packet_Version {
+	if x != nil {
+		return x.Version
+	}
+	return Packet_VERSION_UNSPECIFIED
+}
+
+func (x *Packet) GetFlow() uint64 {
+	if x != nil {
+		return x.Flow
+	}
+	return 0
+}
+
+func (x *Packet) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *Packet) GetErrors() []*Packet_Error {
+	if x != nil {
+		return x.Errors
+	}
+	return nil
+}
+
+func (x *Packet) GetDhcp() *Packet_DHCP {
+	if x != nil {
+		return x.Dhcp
+	}
+	return nil
+}
+
+func (x *Packet) GetLabels() map[string]string {
+	if x != nil {
+		return x.Labels
+	}
+	return nil
+}
+
+func (x *Packet) GetSip() *Packet_SIP {
+	if x != nil {
+		return x.Sip
+	}
+	return nil
+}
+
+func (x *Packet) GetNtp() *Packet_NTP {
+	if x != nil {
+		return x.Ntp
+	}
+	return nil
+}
+
 type isPacket_L3 interface {
 	isPacket_L3()
 }
@@ -164,12 +341,46 @@ type Packet_Ip6 struct {
 	Ip6 *Packet_IPv6 `protobuf:"bytes,8,opt,name=ip6,proto3,oneof"`
 }
 
+type Packet_Arp struct {
+	Arp *Packet_ARP `protobuf:"bytes,9,opt,name=arp,proto3,oneof"`
+}
+
 func (*Packet_Ip) isPacket_L3() {}
 
 func (*Packet_Ip4) isPacket_L3() {}
 
 func (*Packet_Ip6) isPacket_L3() {}
 
+func (*Packet_Arp) isPacket_L3() {}
+
+type isPacket_L4 interface {
+	isPacket_L4()
+}
+
+type Packet_Udp struct {
+	Udp *Packet_UDP `protobuf:"bytes,10,opt,name=udp,proto3,oneof"`
+}
+
+type Packet_Tcp struct {
+	Tcp *Packet_TCP `protobuf:"bytes,11,opt,name=tcp,proto3,oneof"`
+}
+
+type Packet_Icmp struct {
+	Icmp *Packet_ICMP `protobuf:"bytes,12,opt,name=icmp,proto3,oneof"`
+}
+
+type Packet_Sctp struct {
+	Sctp *Packet_SCTP `protobuf:"bytes,20,opt,name=sctp,proto3,oneof"`
+}
+
+func (*Packet_Udp) isPacket_L4() {}
+
+func (*Packet_Tcp) isPacket_L4() {}
+
+func (*Packet_Icmp) isPacket_L4() {}
+
+func (*Packet_Sctp) isPacket_L4() {}
+
 type Packet_Pcap struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -177,6 +388,7 @@ type Packet_Pcap struct {
 
 	Context string `protobuf:"bytes,1,opt,name=context,proto3" json:"context,omitempty"`
 	Serial  uint64 `protobuf:"varint,2,opt,name=serial,proto3" json:"serial,omitempty"`
+	Id      string `protobuf:"bytes,3,opt,name=id,proto3" json:"id,omitempty"`
 }
 
 func (x *Packet_Pcap) Reset() {
@@ -225,6 +437,13 @@ func (x *Packet_Pcap) GetSerial() uint64 {
 	return 0
 }
 
+func (x *Packet_Pcap) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
 type Packet_Metadata struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -469,19 +688,83 @@ func (x *Packet_Layer3) GetTarget() string {
 	return ""
 }
 
+type Packet_Protocol struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Num  uint32 `protobuf:"varint,1,opt,name=num,proto3" json:"num,omitempty"`
+	Name string `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+}
+
+func (x *Packet_Protocol) Reset() {
+	*x = Packet_Protocol{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_packet_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Packet_Protocol) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Packet_Protocol) ProtoMessage() {}
+
+func (x *Packet_Protocol) ProtoReflect() protoreflect.Message {
+	mi := &file_packet_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Packet_Protocol.ProtoReflect.Descriptor instead.
+func (*Packet_Protocol) Descriptor() ([]byte, []int) {
+	return file_packet_proto_rawDescGZIP(), []int{0, 5}
+}
+
+func (x *Packet_Protocol) GetNum() uint32 {
+	if x != nil {
+		return x.Num
+	}
+	return 0
+}
+
+func (x *Packet_Protocol) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
 type Packet_IPv4 struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Source uint32 `protobuf:"fixed32,1,opt,name=source,proto3" json:"source,omitempty"`
-	Target uint32 `protobuf:"fixed32,2,opt,name=target,proto3" json:"target,omitempty"`
+	Source         uint32           `protobuf:"fixed32,1,opt,name=source,proto3" json:"source,omitempty"`
+	Target         uint32           `protobuf:"fixed32,2,opt,name=target,proto3" json:"target,omitempty"`
+	Id             uint32           `protobuf:"varint,3,opt,name=id,proto3" json:"id,omitempty"`
+	Ihl            uint32           `protobuf:"varint,4,opt,name=ihl,proto3" json:"ihl,omitempty"`
+	Ttl            uint32           `protobuf:"varint,5,opt,name=ttl,proto3" json:"ttl,omitempty"`
+	Tos            uint32           `protobuf:"varint,6,opt,name=tos,proto3" json:"tos,omitempty"`
+	Length         uint32           `protobuf:"varint,7,opt,name=length,proto3" json:"length,omitempty"`
+	FragmentOffset uint32           `protobuf:"varint,8,opt,name=fragment_offset,json=fragmentOffset,proto3" json:"fragment_offset,omitempty"`
+	Checksum       uint32           `protobuf:"varint,9,opt,name=checksum,proto3" json:"checksum,omitempty"`
+	Protocol       *Packet_Protocol `protobuf:"bytes,10,opt,name=protocol,proto3" json:"protocol,omitempty"`
+	Flags          []string         `protobuf:"bytes,11,rep,name=flags,proto3" json:"flags,omitempty"`
 }
 
 func (x *Packet_IPv4) Reset() {
 	*x = Packet_IPv4{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_packet_proto_msgTypes[6]
+		mi := &file_packet_proto_msgTypes[7]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -494,7 +777,7 @@ func (x *Packet_IPv4) String() string {
 func (*Packet_IPv4) ProtoMessage() {}
 
 func (x *Packet_IPv4) ProtoReflect() protoreflect.Message {
-	mi := &file_packet_proto_msgTypes[6]
+	mi := &file_packet_proto_msgTypes[7]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -507,7 +790,7 @@ func (x *Packet_IPv4) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Packet_IPv4.ProtoReflect.Descriptor instead.
 func (*Packet_IPv4) Descriptor() ([]byte, []int) {
-	return file_packet_proto_rawDescGZIP(), []int{0, 5}
+	return file_packet_proto_rawDescGZIP(), []int{0, 6}
 }
 
 func (x *Packet_IPv4) GetSource() uint32 {
@@ -524,19 +807,87 @@ func (x *Packet_IPv4) GetTarget() uint32 {
 	return 0
 }
 
+func (x *Packet_IPv4) GetId() uint32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Packet_IPv4) GetIhl() uint32 {
+	if x != nil {
+		return x.Ihl
+	}
+	return 0
+}
+
+func (x *Packet_IPv4) GetTtl() uint32 {
+	if x != nil {
+		return x.Ttl
+	}
+	return 0
+}
+
+func (x *Packet_IPv4) GetTos() uint32 {
+	if x != nil {
+		return x.Tos
+	}
+	return 0
+}
+
+func (x *Packet_IPv4) GetLength() uint32 {
+	if x != nil {
+		return x.Length
+	}
+	return 0
+}
+
+func (x *Packet_IPv4) GetFragmentOffset() uint32 {
+	if x != nil {
+		return x.FragmentOffset
+	}
+	return 0
+}
+
+func (x *Packet_IPv4) GetChecksum() uint32 {
+	if x != nil {
+		return x.Checksum
+	}
+	return 0
+}
+
+func (x *Packet_IPv4) GetProtocol() *Packet_Protocol {
+	if x != nil {
+		return x.Protocol
+	}
+	return nil
+}
+
+func (x *Packet_IPv4) GetFlags() []string {
+	if x != nil {
+		return x.Flags
+	}
+	return nil
+}
+
 type Packet_IPv6 struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Source []byte `protobuf:"bytes,1,opt,name=source,proto3" json:"source,omitempty"`
-	Target []byte `protobuf:"bytes,2,opt,name=target,proto3" json:"target,omitempty"`
+	Source       []byte           `protobuf:"bytes,1,opt,name=source,proto3" json:"source,omitempty"`
+	Target       []byte           `protobuf:"bytes,2,opt,name=target,proto3" json:"target,omitempty"`
+	Length       uint32           `protobuf:"varint,3,opt,name=length,proto3" json:"length,omitempty"`
+	TrafficClass uint32           `protobuf:"varint,4,opt,name=traffic_class,json=trafficClass,proto3" json:"traffic_class,omitempty"`
+	FlowLabel    uint32           `protobuf:"varint,5,opt,name=flow_label,json=flowLabel,proto3" json:"flow_label,omitempty"`
+	HopLimit     uint32           `protobuf:"varint,6,opt,name=hop_limit,json=hopLimit,proto3" json:"hop_limit,omitempty"`
+	Protocol     *Packet_Protocol `protobuf:"bytes,7,opt,name=protocol,proto3" json:"protocol,omitempty"`
 }
 
 func (x *Packet_IPv6) Reset() {
 	*x = Packet_IPv6{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_packet_proto_msgTypes[7]
+		mi := &file_packet_proto_msgTypes[8]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -549,7 +900,7 @@ func (x *Packet_IPv6) String() string {
 func (*Packet_IPv6) ProtoMessage() {}
 
 func (x *Packet_IPv6) ProtoReflect() protoreflect.Message {
-	mi := &file_packet_proto_msgTypes[7]
+	mi := &file_packet_proto_msgTypes[8]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -562,7 +913,7 @@ func (x *Packet_IPv6) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Packet_IPv6.ProtoReflect.Descriptor instead.
 func (*Packet_IPv6) Descriptor() ([]byte, []int) {
-	return file_packet_proto_rawDescGZIP(), []int{0, 6}
+	return file_packet_proto_rawDescGZIP(), []int{0, 7}
 }
 
 func (x *Packet_IPv6) GetSource() []byte {
@@ -579,117 +930,1936 @@ func (x *Packet_IPv6) GetTarget() []byte {
 	return nil
 }
 
-var File_packet_proto protoreflect.FileDescriptor
+func (x *Packet_IPv6) GetLength() uint32 {
+	if x != nil {
+		return x.Length
+	}
+	return 0
+}
 
-var file_packet_proto_rawDesc = []byte{
-	0x0a, 0x0c, 0x70, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x1a, 0x1f,
-	0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f,
-	0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22,
-	0xa7, 0x06, 0x0a, 0x06, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x12, 0x20, 0x0a, 0x04, 0x70, 0x63,
-	0x61, 0x70, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0c, 0x2e, 0x50, 0x61, 0x63, 0x6b, 0x65,
-	0x74, 0x2e, 0x50, 0x63, 0x61, 0x70, 0x52, 0x04, 0x70, 0x63, 0x61, 0x70, 0x12, 0x24, 0x0a, 0x04,
-	0x6d, 0x65, 0x74, 0x61, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x10, 0x2e, 0x50, 0x61, 0x63,
-	0x6b, 0x65, 0x74, 0x2e, 0x4d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x52, 0x04, 0x6d, 0x65,
-	0x74, 0x61, 0x12, 0x38, 0x0a, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x18,
-	0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70,
-	0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d,
-	0x70, 0x52, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x12, 0x27, 0x0a, 0x05,
-	0x69, 0x66, 0x61, 0x63, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x11, 0x2e, 0x50, 0x61,
-	0x63, 0x6b, 0x65, 0x74, 0x2e, 0x49, 0x6e, 0x74, 0x65, 0x72, 0x66, 0x61, 0x63, 0x65, 0x52, 0x05,
-	0x69, 0x66, 0x61, 0x63, 0x65, 0x12, 0x1e, 0x0a, 0x02, 0x6c, 0x32, 0x18, 0x05, 0x20, 0x01, 0x28,
-	0x0b, 0x32, 0x0e, 0x2e, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x2e, 0x4c, 0x61, 0x79, 0x65, 0x72,
-	0x32, 0x52, 0x02, 0x6c, 0x32, 0x12, 0x20, 0x0a, 0x02, 0x69, 0x70, 0x18, 0x06, 0x20, 0x01, 0x28,
-	0x0b, 0x32, 0x0e, 0x2e, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x2e, 0x4c, 0x61, 0x79, 0x65, 0x72,
-	0x33, 0x48, 0x00, 0x52, 0x02, 0x69, 0x70, 0x12, 0x20, 0x0a, 0x03, 0x69, 0x70, 0x34, 0x18, 0x07,
-	0x20, 0x01, 0x28, 0x0b, 0x32, 0x0c, 0x2e, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x2e, 0x49, 0x50,
-	0x76, 0x34, 0x48, 0x00, 0x52, 0x03, 0x69, 0x70, 0x34, 0x12, 0x20, 0x0a, 0x03, 0x69, 0x70, 0x36,
-	0x18, 0x08, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0c, 0x2e, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x2e,
-	0x49, 0x50, 0x76, 0x36, 0x48, 0x00, 0x52, 0x03, 0x69, 0x70, 0x36, 0x1a, 0x38, 0x0a, 0x04, 0x50,
-	0x63, 0x61, 0x70, 0x12, 0x18, 0x0a, 0x07, 0x63, 0x6f, 0x6e, 0x74, 0x65, 0x78, 0x74, 0x18, 0x01,
-	0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x63, 0x6f, 0x6e, 0x74, 0x65, 0x78, 0x74, 0x12, 0x16, 0x0a,
-	0x06, 0x73, 0x65, 0x72, 0x69, 0x61, 0x6c, 0x18, 0x02, 0x20, 0x01, 0x28, 0x04, 0x52, 0x06, 0x73,
-	0x65, 0x72, 0x69, 0x61, 0x6c, 0x1a, 0x67, 0x0a, 0x08, 0x4d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74,
-	0x61, 0x12, 0x1c, 0x0a, 0x09, 0x74, 0x72, 0x75, 0x6e, 0x63, 0x61, 0x74, 0x65, 0x64, 0x18, 0x01,
-	0x20, 0x01, 0x28, 0x08, 0x52, 0x09, 0x74, 0x72, 0x75, 0x6e, 0x63, 0x61, 0x74, 0x65, 0x64, 0x12,
-	0x16, 0x0a, 0x06, 0x6c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x18, 0x02, 0x20, 0x01, 0x28, 0x04, 0x52,
-	0x06, 0x6c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x12, 0x25, 0x0a, 0x0e, 0x63, 0x61, 0x70, 0x74, 0x75,
-	0x72, 0x65, 0x5f, 0x6c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x18, 0x03, 0x20, 0x01, 0x28, 0x04, 0x52,
-	0x0d, 0x63, 0x61, 0x70, 0x74, 0x75, 0x72, 0x65, 0x4c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x1a, 0x4b,
-	0x0a, 0x09, 0x49, 0x6e, 0x74, 0x65, 0x72, 0x66, 0x61, 0x63, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x69,
-	0x6e, 0x64, 0x65, 0x78, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x05, 0x69, 0x6e, 0x64, 0x65,
-	0x78, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52,
-	0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x61, 0x64, 0x64, 0x72, 0x73, 0x18, 0x03,
-	0x20, 0x03, 0x28, 0x09, 0x52, 0x05, 0x61, 0x64, 0x64, 0x72, 0x73, 0x1a, 0x4c, 0x0a, 0x06, 0x4c,
-	0x61, 0x79, 0x65, 0x72, 0x32, 0x12, 0x16, 0x0a, 0x06, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x18,
-	0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x12, 0x16, 0x0a,
-	0x06, 0x74, 0x61, 0x72, 0x67, 0x65, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x74,
-	0x61, 0x72, 0x67, 0x65, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x74, 0x79, 0x70, 0x65, 0x18, 0x03, 0x20,
-	0x01, 0x28, 0x09, 0x52, 0x04, 0x74, 0x79, 0x70, 0x65, 0x1a, 0x38, 0x0a, 0x06, 0x4c, 0x61, 0x79,
-	0x65, 0x72, 0x33, 0x12, 0x16, 0x0a, 0x06, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x18, 0x01, 0x20,
-	0x01, 0x28, 0x09, 0x52, 0x06, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x74,
-	0x61, 0x72, 0x67, 0x65, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x74, 0x61, 0x72,
-	0x67, 0x65, 0x74, 0x1a, 0x36, 0x0a, 0x04, 0x49, 0x50, 0x76, 0x34, 0x12, 0x16, 0x0a, 0x06, 0x73,
-	0x6f, 0x75, 0x72, 0x63, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x07, 0x52, 0x06, 0x73, 0x6f, 0x75,
-	0x72, 0x63, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x74, 0x61, 0x72, 0x67, 0x65, 0x74, 0x18, 0x02, 0x20,
-	0x01, 0x28, 0x07, 0x52, 0x06, 0x74, 0x61, 0x72, 0x67, 0x65, 0x74, 0x1a, 0x36, 0x0a, 0x04, 0x49,
-	0x50, 0x76, 0x36, 0x12, 0x16, 0x0a, 0x06, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x18, 0x01, 0x20,
-	0x01, 0x28, 0x0c, 0x52, 0x06, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x74,
-	0x61, 0x72, 0x67, 0x65, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x06, 0x74, 0x61, 0x72,
-	0x67, 0x65, 0x74, 0x42, 0x04, 0x0a, 0x02, 0x6c, 0x33, 0x42, 0x42, 0x5a, 0x40, 0x67, 0x69, 0x74,
-	0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x47, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x43, 0x6c,
-	0x6f, 0x75, 0x64, 0x50, 0x6c, 0x61, 0x74, 0x66, 0x6f, 0x72, 0x6d, 0x2f, 0x70, 0x63, 0x61, 0x70,
-	0x2d, 0x73, 0x69, 0x64, 0x65, 0x63, 0x61, 0x72, 0x2f, 0x70, 0x63, 0x61, 0x70, 0x2d, 0x63, 0x6c,
-	0x69, 0x2f, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x2f, 0x70, 0x62, 0x62, 0x06, 0x70,
-	0x72, 0x6f, 0x74, 0x6f, 0x33,
+func (x *Packet_IPv6) GetTrafficClass() uint32 {
+	if x != nil {
+		return x.TrafficClass
+	}
+	return 0
 }
 
-var (
-	file_packet_proto_rawDescOnce sync.Once
-	file_packet_proto_rawDescData = file_packet_proto_rawDesc
-)
+func (x *Packet_IPv6) GetFlowLabel() uint32 {
+	if x != nil {
+		return x.FlowLabel
+	}
+	return 0
+}
 
-func file_packet_proto_rawDescGZIP() []byte {
-	file_packet_proto_rawDescOnce.Do(func() {
-		file_packet_proto_rawDescData = protoimpl.X.CompressGZIP(file_packet_proto_rawDescData)
-	})
-	return file_packet_proto_rawDescData
+func (x *Packet_IPv6) GetHopLimit() uint32 {
+	if x != nil {
+		return x.HopLimit
+	}
+	return 0
 }
 
-var file_packet_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
-var file_packet_proto_goTypes = []interface{}{
-	(*Packet)(nil),                // 0: Packet
-	(*Packet_Pcap)(nil),           // 1: Packet.Pcap
-	(*Packet_Metadata)(nil),       // 2: Packet.Metadata
-	(*Packet_Interface)(nil),      // 3: Packet.Interface
-	(*Packet_Layer2)(nil),         // 4: Packet.Layer2
-	(*Packet_Layer3)(nil),         // 5: Packet.Layer3
-	(*Packet_IPv4)(nil),           // 6: Packet.IPv4
-	(*Packet_IPv6)(nil),           // 7: Packet.IPv6
-	(*timestamppb.Timestamp)(nil), // 8: google.protobuf.Timestamp
+func (x *Packet_IPv6) GetProtocol() *Packet_Protocol {
+	if x != nil {
+		return x.Protocol
+	}
+	return nil
 }
-var file_packet_proto_depIdxs = []int32{
-	1, // 0: Packet.pcap:type_name -> Packet.Pcap
-	2, // 1: Packet.meta:type_name -> Packet.Metadata
-	8, // 2: Packet.timestamp:type_name -> google.protobuf.Timestamp
-	3, // 3: Packet.iface:type_name -> Packet.Interface
-	4, // 4: Packet.l2:type_name -> Packet.Layer2
-	5, // 5: Packet.ip:type_name -> Packet.Layer3
-	6, // 6: Packet.ip4:type_name -> Packet.IPv4
-	7, // 7: Packet.ip6:type_name -> Packet.IPv6
-	8, // [8:8] is the sub-list for method output_type
-	8, // [8:8] is the sub-list for method input_type
-	8, // [8:8] is the sub-list for extension type_name
-	8, // [8:8] is the sub-list for extension extendee
-	0, // [0:8] is the sub-list for field type_name
+
+type Packet_ARP struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Operation uint32               `protobuf:"varint,1,opt,name=operation,proto3" json:"operation,omitempty"`
+	Source    *Packet_ARP_Endpoint `protobuf:"bytes,2,opt,name=source,proto3" json:"source,omitempty"`
+	Target    *Packet_ARP_Endpoint `protobuf:"bytes,3,opt,name=target,proto3" json:"target,omitempty"`
 }
 
-func init() { file_packet_proto_init() }
-func file_packet_proto_init() {
-	if File_packet_proto != nil {
-		return
-	}
-	if !protoimpl.UnsafeEnabled {
-		file_packet_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+func (x *Packet_ARP) Reset() {
+	*x = Packet_ARP{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_packet_proto_msgTypes[9]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Packet_ARP) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Packet_ARP) ProtoMessage() {}
+
+func (x *Packet_ARP) ProtoReflect() protoreflect.Message {
+	mi := &file_packet_proto_msgTypes[9]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Packet_ARP.ProtoReflect.Descriptor instead.
+func (*Packet_ARP) Descriptor() ([]byte, []int) {
+	return file_packet_proto_rawDescGZIP(), []int{0, 8}
+}
+
+func (x *Packet_ARP) GetOperation() uint32 {
+	if x != nil {
+		return x.Operation
+	}
+	return 0
+}
+
+func (x *Packet_ARP) GetSource() *Packet_ARP_Endpoint {
+	if x != nil {
+		return x.Source
+	}
+	return nil
+}
+
+func (x *Packet_ARP) GetTarget() *Packet_ARP_Endpoint {
+	if x != nil {
+		return x.Target
+	}
+	return nil
+}
+
+type Packet_ICMP struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Version     uint32 `protobuf:"varint,1,opt,name=version,proto3" json:"version,omitempty"`
+	Type        uint32 `protobuf:"varint,2,opt,name=type,proto3" json:"type,omitempty"`
+	Code        uint32 `protobuf:"varint,3,opt,name=code,proto3" json:"code,omitempty"`
+	Checksum    uint32 `protobuf:"varint,4,opt,name=checksum,proto3" json:"checksum,omitempty"`
+	Message     string `protobuf:"bytes,5,opt,name=message,proto3" json:"message,omitempty"`
+	Id          uint32 `protobuf:"varint,6,opt,name=id,proto3" json:"id,omitempty"`
+	Seq         uint32 `protobuf:"varint,7,opt,name=seq,proto3" json:"seq,omitempty"`
+	Target      string `protobuf:"bytes,8,opt,name=target,proto3" json:"target,omitempty"`
+	Destination string `protobuf:"bytes,9,opt,name=destination,proto3" json:"destination,omitempty"`
+	// header of the packet which caused ICMPv6 errors; i/e: `PacketTooBig`
+	Ipv6 *Packet_IPv6 `protobuf:"bytes,10,opt,name=ipv6,proto3" json:"ipv6,omitempty"`
+}
+
+func (x *Packet_ICMP) Reset() {
+	*x = Packet_ICMP{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_packet_proto_msgTypes[10]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Packet_ICMP) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Packet_ICMP) ProtoMessage() {}
+
+func (x *Packet_ICMP) ProtoReflect() protoreflect.Message {
+	mi := &file_packet_proto_msgTypes[10]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Packet_ICMP.ProtoReflect.Descriptor instead.
+func (*Packet_ICMP) Descriptor() ([]byte, []int) {
+	return file_packet_proto_rawDescGZIP(), []int{0, 9}
+}
+
+func (x *Packet_ICMP) GetVersion() uint32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *Packet_ICMP) GetType() uint32 {
+	if x != nil {
+		return x.Type
+	}
+	return 0
+}
+
+func (x *Packet_ICMP) GetCode() uint32 {
+	if x != nil {
+		return x.Code
+	}
+	return 0
+}
+
+func (x *Packet_ICMP) GetChecksum() uint32 {
+	if x != nil {
+		return x.Checksum
+	}
+	return 0
+}
+
+func (x *Packet_ICMP) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *Packet_ICMP) GetId() uint32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Packet_ICMP) GetSeq() uint32 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *Packet_ICMP) GetTarget() string {
+	if x != nil {
+		return x.Target
+	}
+	return ""
+}
+
+func (x *Packet_ICMP) GetDestination() string {
+	if x != nil {
+		return x.Destination
+	}
+	return ""
+}
+
+func (x *Packet_ICMP) GetIpv6() *Packet_IPv6 {
+	if x != nil {
+		return x.Ipv6
+	}
+	return nil
+}
+
+type Packet_UDP struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Source   uint32 `protobuf:"varint,1,opt,name=source,proto3" json:"source,omitempty"`
+	Target   uint32 `protobuf:"varint,2,opt,name=target,proto3" json:"target,omitempty"`
+	Length   uint32 `protobuf:"varint,3,opt,name=length,proto3" json:"length,omitempty"`
+	Checksum uint32 `protobuf:"varint,4,opt,name=checksum,proto3" json:"checksum,omitempty"`
+	Size     uint32 `protobuf:"varint,5,opt,name=size,proto3" json:"size,omitempty"`
+}
+
+func (x *Packet_UDP) Reset() {
+	*x = Packet_UDP{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_packet_proto_msgTypes[11]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Packet_UDP) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Packet_UDP) ProtoMessage() {}
+
+func (x *Packet_UDP) ProtoReflect() protoreflect.Message {
+	mi := &file_packet_proto_msgTypes[11]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Packet_UDP.ProtoReflect.Descriptor instead.
+func (*Packet_UDP) Descriptor() ([]byte, []int) {
+	return file_packet_proto_rawDescGZIP(), []int{0, 10}
+}
+
+func (x *Packet_UDP) GetSource() uint32 {
+	if x != nil {
+		return x.Source
+	}
+	return 0
+}
+
+func (x *Packet_UDP) GetTarget() uint32 {
+	if x != nil {
+		return x.Target
+	}
+	return 0
+}
+
+func (x *Packet_UDP) GetLength() uint32 {
+	if x != nil {
+		return x.Length
+	}
+	return 0
+}
+
+func (x *Packet_UDP) GetChecksum() uint32 {
+	if x != nil {
+		return x.Checksum
+	}
+	return 0
+}
+
+func (x *Packet_UDP) GetSize() uint32 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+type Packet_TCP struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Source     uint32            `protobuf:"varint,1,opt,name=source,proto3" json:"source,omitempty"`
+	Target     uint32            `protobuf:"varint,2,opt,name=target,proto3" json:"target,omitempty"`
+	Seq        uint32            `protobuf:"varint,3,opt,name=seq,proto3" json:"seq,omitempty"`
+	Ack        uint32            `protobuf:"varint,4,opt,name=ack,proto3" json:"ack,omitempty"`
+	DataOffset uint32            `protobuf:"varint,5,opt,name=data_offset,json=dataOffset,proto3" json:"data_offset,omitempty"`
+	Window     uint32            `protobuf:"varint,6,opt,name=window,proto3" json:"window,omitempty"`
+	Checksum   uint32            `protobuf:"varint,7,opt,name=checksum,proto3" json:"checksum,omitempty"`
+	Urgent     uint32            `protobuf:"varint,8,opt,name=urgent,proto3" json:"urgent,omitempty"`
+	Length     uint32            `protobuf:"varint,9,opt,name=length,proto3" json:"length,omitempty"`
+	Flags      *Packet_TCP_Flags `protobuf:"bytes,10,opt,name=flags,proto3" json:"flags,omitempty"`
+}
+
+func (x *Packet_TCP) Reset() {
+	*x = Packet_TCP{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_packet_proto_msgTypes[12]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Packet_TCP) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Packet_TCP) ProtoMessage() {}
+
+func (x *Packet_TCP) ProtoReflect() protoreflect.Message {
+	mi := &file_packet_proto_msgTypes[12]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Packet_TCP.ProtoReflect.Descriptor instead.
+func (*Packet_TCP) Descriptor() ([]byte, []int) {
+	return file_packet_proto_rawDescGZIP(), []int{0, 11}
+}
+
+func (x *Packet_TCP) GetSource() uint32 {
+	if x != nil {
+		return x.Source
+	}
+	return 0
+}
+
+func (x *Packet_TCP) GetTarget() uint32 {
+	if x != nil {
+		return x.Target
+	}
+	return 0
+}
+
+func (x *Packet_TCP) GetSeq() uint32 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *Packet_TCP) GetAck() uint32 {
+	if x != nil {
+		return x.Ack
+	}
+	return 0
+}
+
+func (x *Packet_TCP) GetDataOffset() uint32 {
+	if x != nil {
+		return x.DataOffset
+	}
+	return 0
+}
+
+func (x *Packet_TCP) GetWindow() uint32 {
+	if x != nil {
+		return x.Window
+	}
+	return 0
+}
+
+func (x *Packet_TCP) GetChecksum() uint32 {
+	if x != nil {
+		return x.Checksum
+	}
+	return 0
+}
+
+func (x *Packet_TCP) GetUrgent() uint32 {
+	if x != nil {
+		return x.Urgent
+	}
+	return 0
+}
+
+func (x *Packet_TCP) GetLength() uint32 {
+	if x != nil {
+		return x.Length
+	}
+	return 0
+}
+
+func (x *Packet_TCP) GetFlags() *Packet_TCP_Flags {
+	if x != nil {
+		return x.Flags
+	}
+	return nil
+}
+
+type Packet_SCTP struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Source          uint32               `protobuf:"varint,1,opt,name=source,proto3" json:"source,omitempty"`
+	Target          uint32               `protobuf:"varint,2,opt,name=target,proto3" json:"target,omitempty"`
+	VerificationTag uint32               `protobuf:"varint,3,opt,name=verification_tag,json=verificationTag,proto3" json:"verification_tag,omitempty"`
+	Checksum        uint32               `protobuf:"varint,4,opt,name=checksum,proto3" json:"checksum,omitempty"`
+	Size            uint32               `protobuf:"varint,5,opt,name=size,proto3" json:"size,omitempty"`
+	Chunks          []*Packet_SCTP_Chunk `protobuf:"bytes,6,rep,name=chunks,proto3" json:"chunks,omitempty"`
+}
+
+func (x *Packet_SCTP) Reset() {
+	*x = Packet_SCTP{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_packet_proto_msgTypes[13]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Packet_SCTP) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Packet_SCTP) ProtoMessage() {}
+
+func (x *Packet_SCTP) ProtoReflect() protoreflect.Message {
+	mi := &file_packet_proto_msgTypes[13]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Packet_SCTP.ProtoReflect.Descriptor instead.
+func (*Packet_SCTP) Descriptor() ([]byte, []int) {
+	return file_packet_proto_rawDescGZIP(), []int{0, 12}
+}
+
+func (x *Packet_SCTP) GetSource() uint32 {
+	if x != nil {
+		return x.Source
+	}
+	return 0
+}
+
+func (x *Packet_SCTP) GetTarget() uint32 {
+	if x != nil {
+		return x.Target
+	}
+	return 0
+}
+
+func (x *Packet_SCTP) GetVerificationTag() uint32 {
+	if x != nil {
+		return x.VerificationTag
+	}
+	return 0
+}
+
+func (x *Packet_SCTP) GetChecksum() uint32 {
+	if x != nil {
+		return x.Checksum
+	}
+	return 0
+}
+
+func (x *Packet_SCTP) GetSize() uint32 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *Packet_SCTP) GetChunks() []*Packet_SCTP_Chunk {
+	if x != nil {
+		return x.Chunks
+	}
+	return nil
+}
+
+type Packet_TLS struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Records []*Packet_TLS_Record `protobuf:"bytes,1,rep,name=records,proto3" json:"records,omitempty"`
+}
+
+func (x *Packet_TLS) Reset() {
+	*x = Packet_TLS{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_packet_proto_msgTypes[14]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Packet_TLS) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Packet_TLS) ProtoMessage() {}
+
+func (x *Packet_TLS) ProtoReflect() protoreflect.Message {
+	mi := &file_packet_proto_msgTypes[14]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Packet_TLS.ProtoReflect.Descriptor instead.
+func (*Packet_TLS) Descriptor() ([]byte, []int) {
+	return file_packet_proto_rawDescGZIP(), []int{0, 13}
+}
+
+func (x *Packet_TLS) GetRecords() []*Packet_TLS_Record {
+	if x != nil {
+		return x.Records
+	}
+	return nil
+}
+
+type Packet_DNS struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Id           uint32                 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Op           string                 `protobuf:"bytes,2,opt,name=op,proto3" json:"op,omitempty"`
+	ResponseCode string                 `protobuf:"bytes,3,opt,name=response_code,json=responseCode,proto3" json:"response_code,omitempty"`
+	Questions    []*Packet_DNS_Question `protobuf:"bytes,4,rep,name=questions,proto3" json:"questions,omitempty"`
+	Answers      []*Packet_DNS_Answer   `protobuf:"bytes,5,rep,name=answers,proto3" json:"answers,omitempty"`
+}
+
+func (x *Packet_DNS) Reset() {
+	*x = Packet_DNS{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_packet_proto_msgTypes[15]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Packet_DNS) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Packet_DNS) ProtoMessage() {}
+
+func (x *Packet_DNS) ProtoReflect() protoreflect.Message {
+	mi := &file_packet_proto_msgTypes[15]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Packet_DNS.ProtoReflect.Descriptor instead.
+func (*Packet_DNS) Descriptor() ([]byte, []int) {
+	return file_packet_proto_rawDescGZIP(), []int{0, 14}
+}
+
+func (x *Packet_DNS) GetId() uint32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Packet_DNS) GetOp() string {
+	if x != nil {
+		return x.Op
+	}
+	return ""
+}
+
+func (x *Packet_DNS) GetResponseCode() string {
+	if x != nil {
+		return x.ResponseCode
+	}
+	return ""
+}
+
+func (x *Packet_DNS) GetQuestions() []*Packet_DNS_Question {
+	if x != nil {
+		return x.Questions
+	}
+	return nil
+}
+
+func (x *Packet_DNS) GetAnswers() []*Packet_DNS_Answer {
+	if x != nil {
+		return x.Answers
+	}
+	return nil
+}
+
+type Packet_DHCP struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// 4 or 6
+	Version     uint32 `protobuf:"varint,1,opt,name=version,proto3" json:"version,omitempty"`
+	MessageType string `protobuf:"bytes,2,opt,name=message_type,json=messageType,proto3" json:"message_type,omitempty"`
+	Xid         uint32 `protobuf:"varint,3,opt,name=xid,proto3" json:"xid,omitempty"`
+	ClientIp    string `protobuf:"bytes,4,opt,name=client_ip,json=clientIp,proto3" json:"client_ip,omitempty"`
+	// DHCPv4: `yiaddr`
+	AssignedIp  string `protobuf:"bytes,5,opt,name=assigned_ip,json=assignedIp,proto3" json:"assigned_ip,omitempty"`
+	ServerIp    string `protobuf:"bytes,6,opt,name=server_ip,json=serverIp,proto3" json:"server_ip,omitempty"`
+	RelayIp     string `protobuf:"bytes,7,opt,name=relay_ip,json=relayIp,proto3" json:"relay_ip,omitempty"`
+	ClientMac   string `protobuf:"bytes,8,opt,name=client_mac,json=clientMac,proto3" json:"client_mac,omitempty"`
+	RequestedIp string `protobuf:"bytes,9,opt,name=requested_ip,json=requestedIp,proto3" json:"requested_ip,omitempty"`
+	// DHCPv6: addresses carried by IA_NA and IA_TA options
+	Addresses []string              `protobuf:"bytes,10,rep,name=addresses,proto3" json:"addresses,omitempty"`
+	Options   []*Packet_DHCP_Option `protobuf:"bytes,11,rep,name=options,proto3" json:"options,omitempty"`
+}
+
+func (x *Packet_DHCP) Reset() {
+	*x = Packet_DHCP{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_packet_proto_msgTypes[16]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Packet_DHCP) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Packet_DHCP) ProtoMessage() {}
+
+func (x *Packet_DHCP) ProtoReflect() protoreflect.Message {
+	mi := &file_packet_proto_msgTypes[16]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Packet_DHCP.ProtoReflect.Descriptor instead.
+func (*Packet_DHCP) Descriptor() ([]byte, []int) {
+	return file_packet_proto_rawDescGZIP(), []int{0, 15}
+}
+
+func (x *Packet_DHCP) GetVersion() uint32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *Packet_DHCP) GetMessageType() string {
+	if x != nil {
+		return x.MessageType
+	}
+	return ""
+}
+
+func (x *Packet_DHCP) GetXid() uint32 {
+	if x != nil {
+		return x.Xid
+	}
+	return 0
+}
+
+func (x *Packet_DHCP) GetClientIp() string {
+	if x != nil {
+		return x.ClientIp
+	}
+	return ""
+}
+
+func (x *Packet_DHCP) GetAssignedIp() string {
+	if x != nil {
+		return x.AssignedIp
+	}
+	return ""
+}
+
+func (x *Packet_DHCP) GetServerIp() string {
+	if x != nil {
+		return x.ServerIp
+	}
+	return ""
+}
+
+func (x *Packet_DHCP) GetRelayIp() string {
+	if x != nil {
+		return x.RelayIp
+	}
+	return ""
+}
+
+func (x *Packet_DHCP) GetClientMac() string {
+	if x != nil {
+		return x.ClientMac
+	}
+	return ""
+}
+
+func (x *Packet_DHCP) GetRequestedIp() string {
+	if x != nil {
+		return x.RequestedIp
+	}
+	return ""
+}
+
+func (x *Packet_DHCP) GetAddresses() []string {
+	if x != nil {
+		return x.Addresses
+	}
+	return nil
+}
+
+func (x *Packet_DHCP) GetOptions() []*Packet_DHCP_Option {
+	if x != nil {
+		return x.Options
+	}
+	return nil
+}
+
+type Packet_SIP struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Version string `protobuf:"bytes,1,opt,name=version,proto3" json:"version,omitempty"`
+	// responses: method of the `CSeq` header
+	Method    string `protobuf:"bytes,2,opt,name=method,proto3" json:"method,omitempty"`
+	Uri       string `protobuf:"bytes,3,opt,name=uri,proto3" json:"uri,omitempty"`
+	CallId    string `protobuf:"bytes,4,opt,name=call_id,json=callId,proto3" json:"call_id,omitempty"`
+	Cseq      int64  `protobuf:"varint,5,opt,name=cseq,proto3" json:"cseq,omitempty"`
+	Code      uint32 `protobuf:"varint,6,opt,name=code,proto3" json:"code,omitempty"`
+	Status    string `protobuf:"bytes,7,opt,name=status,proto3" json:"status,omitempty"`
+	UserAgent string `protobuf:"bytes,8,opt,name=user_agent,json=userAgent,proto3" json:"user_agent,omitempty"`
+	// RTP endpoints announced by SDP offers and answers
+	Media []string `protobuf:"bytes,9,rep,name=media,proto3" json:"media,omitempty"`
+}
+
+func (x *Packet_SIP) Reset() {
+	*x = Packet_SIP{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_packet_proto_msgTypes[17]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Packet_SIP) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Packet_SIP) ProtoMessage() {}
+
+func (x *Packet_SIP) ProtoReflect() protoreflect.Message {
+	mi := &file_packet_proto_msgTypes[17]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Packet_SIP.ProtoReflect.Descriptor instead.
+func (*Packet_SIP) Descriptor() ([]byte, []int) {
+	return file_packet_proto_rawDescGZIP(), []int{0, 16}
+}
+
+func (x *Packet_SIP) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+func (x *Packet_SIP) GetMethod() string {
+	if x != nil {
+		return x.Method
+	}
+	return ""
+}
+
+func (x *Packet_SIP) GetUri() string {
+	if x != nil {
+		return x.Uri
+	}
+	return ""
+}
+
+func (x *Packet_SIP) GetCallId() string {
+	if x != nil {
+		return x.CallId
+	}
+	return ""
+}
+
+func (x *Packet_SIP) GetCseq() int64 {
+	if x != nil {
+		return x.Cseq
+	}
+	return 0
+}
+
+func (x *Packet_SIP) GetCode() uint32 {
+	if x != nil {
+		return x.Code
+	}
+	return 0
+}
+
+func (x *Packet_SIP) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *Packet_SIP) GetUserAgent() string {
+	if x != nil {
+		return x.UserAgent
+	}
+	return ""
+}
+
+func (x *Packet_SIP) GetMedia() []string {
+	if x != nil {
+		return x.Media
+	}
+	return nil
+}
+
+type Packet_NTP struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Version  uint32                 `protobuf:"varint,1,opt,name=version,proto3" json:"version,omitempty"`
+	Mode     string                 `protobuf:"bytes,2,opt,name=mode,proto3" json:"mode,omitempty"`
+	Stratum  uint32                 `protobuf:"varint,3,opt,name=stratum,proto3" json:"stratum,omitempty"`
+	Refid    string                 `protobuf:"bytes,4,opt,name=refid,proto3" json:"refid,omitempty"`
+	Origin   *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=origin,proto3" json:"origin,omitempty"`
+	Receive  *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=receive,proto3" json:"receive,omitempty"`
+	Transmit *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=transmit,proto3" json:"transmit,omitempty"`
+	// server responses: clock offset and round trip delay estimates in milliseconds
+	Offset float64 `protobuf:"fixed64,8,opt,name=offset,proto3" json:"offset,omitempty"`
+	Delay  float64 `protobuf:"fixed64,9,opt,name=delay,proto3" json:"delay,omitempty"`
+}
+
+func (x *Packet_NTP) Reset() {
+	*x = Packet_NTP{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_packet_proto_msgTypes[18]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Packet_NTP) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Packet_NTP) ProtoMessage() {}
+
+func (x *Packet_NTP) ProtoReflect() protoreflect.Message {
+	mi := &file_packet_proto_msgTypes[18]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Packet_NTP.ProtoReflect.Descriptor instead.
+func (*Packet_NTP) Descriptor() ([]byte, []int) {
+	return file_packet_proto_rawDescGZIP(), []int{0, 17}
+}
+
+func (x *Packet_NTP) GetVersion() uint32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *Packet_NTP) GetMode() string {
+	if x != nil {
+		return x.Mode
+	}
+	return ""
+}
+
+func (x *Packet_NTP) GetStratum() uint32 {
+	if x != nil {
+		return x.Stratum
+	}
+	return 0
+}
+
+func (x *Packet_NTP) GetRefid() string {
+	if x != nil {
+		return x.Refid
+	}
+	return ""
+}
+
+func (x *Packet_NTP) GetOrigin() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Origin
+	}
+	return nil
+}
+
+func (x *Packet_NTP) GetReceive() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Receive
+	}
+	return nil
+}
+
+func (x *Packet_NTP) GetTransmit() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Transmit
+	}
+	return nil
+}
+
+func (x *Packet_NTP) GetOffset() float64 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+func (x *Packet_NTP) GetDelay() float64 {
+	if x != nil {
+		return x.Delay
+	}
+	return 0
+}
+
+type Packet_Error struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Msg   string `protobuf:"bytes,1,opt,name=msg,proto3" json:"msg,omitempty"`
+	Layer string `protobuf:"bytes,2,opt,name=layer,proto3" json:"layer,omitempty"`
+}
+
+func (x *Packet_Error) Reset() {
+	*x = Packet_Error{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_packet_proto_msgTypes[19]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Packet_Error) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Packet_Error) ProtoMessage() {}
+
+func (x *Packet_Error) ProtoReflect() protoreflect.Message {
+	mi := &file_packet_proto_msgTypes[19]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Packet_Error.ProtoReflect.Descriptor instead.
+func (*Packet_Error) Descriptor() ([]byte, []int) {
+	return file_packet_proto_rawDescGZIP(), []int{0, 18}
+}
+
+func (x *Packet_Error) GetMsg() string {
+	if x != nil {
+		return x.Msg
+	}
+	return ""
+}
+
+func (x *Packet_Error) GetLayer() string {
+	if x != nil {
+		return x.Layer
+	}
+	return ""
+}
+
+type Packet_ARP_Endpoint struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Ip  string `protobuf:"bytes,1,opt,name=ip,proto3" json:"ip,omitempty"`
+	Mac string `protobuf:"bytes,2,opt,name=mac,proto3" json:"mac,omitempty"`
+}
+
+func (x *Packet_ARP_Endpoint) Reset() {
+	*x = Packet_ARP_Endpoint{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_packet_proto_msgTypes[21]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Packet_ARP_Endpoint) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Packet_ARP_Endpoint) ProtoMessage() {}
+
+func (x *Packet_ARP_Endpoint) ProtoReflect() protoreflect.Message {
+	mi := &file_packet_proto_msgTypes[21]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Packet_ARP_Endpoint.ProtoReflect.Descriptor instead.
+func (*Packet_ARP_Endpoint) Descriptor() ([]byte, []int) {
+	return file_packet_proto_rawDescGZIP(), []int{0, 8, 0}
+}
+
+func (x *Packet_ARP_Endpoint) GetIp() string {
+	if x != nil {
+		return x.Ip
+	}
+	return ""
+}
+
+func (x *Packet_ARP_Endpoint) GetMac() string {
+	if x != nil {
+		return x.Mac
+	}
+	return ""
+}
+
+type Packet_TCP_Flags struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Dec uint32 `protobuf:"varint,1,opt,name=dec,proto3" json:"dec,omitempty"`
+	Str string `protobuf:"bytes,2,opt,name=str,proto3" json:"str,omitempty"`
+}
+
+func (x *Packet_TCP_Flags) Reset() {
+	*x = Packet_TCP_Flags{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_packet_proto_msgTypes[22]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Packet_TCP_Flags) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Packet_TCP_Flags) ProtoMessage() {}
+
+func (x *Packet_TCP_Flags) ProtoReflect() protoreflect.Message {
+	mi := &file_packet_proto_msgTypes[22]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Packet_TCP_Flags.ProtoReflect.Descriptor instead.
+func (*Packet_TCP_Flags) Descriptor() ([]byte, []int) {
+	return file_packet_proto_rawDescGZIP(), []int{0, 11, 0}
+}
+
+func (x *Packet_TCP_Flags) GetDec() uint32 {
+	if x != nil {
+		return x.Dec
+	}
+	return 0
+}
+
+func (x *Packet_TCP_Flags) GetStr() string {
+	if x != nil {
+		return x.Str
+	}
+	return ""
+}
+
+type Packet_SCTP_Chunk struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Type   string `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	Flags  uint32 `protobuf:"varint,2,opt,name=flags,proto3" json:"flags,omitempty"`
+	Length uint32 `protobuf:"varint,3,opt,name=length,proto3" json:"length,omitempty"`
+	// DATA: TSN; SACK: cumulative TSN ack; INIT/INIT_ACK: initial TSN
+	Tsn uint32 `protobuf:"varint,4,opt,name=tsn,proto3" json:"tsn,omitempty"`
+	// DATA
+	Stream uint32 `protobuf:"varint,5,opt,name=stream,proto3" json:"stream,omitempty"`
+	Ssn    uint32 `protobuf:"varint,6,opt,name=ssn,proto3" json:"ssn,omitempty"`
+	Ppid   uint32 `protobuf:"varint,7,opt,name=ppid,proto3" json:"ppid,omitempty"`
+	// INIT/INIT_ACK
+	InitiateTag uint32 `protobuf:"varint,8,opt,name=initiate_tag,json=initiateTag,proto3" json:"initiate_tag,omitempty"`
+}
+
+func (x *Packet_SCTP_Chunk) Reset() {
+	*x = Packet_SCTP_Chunk{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_packet_proto_msgTypes[23]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Packet_SCTP_Chunk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Packet_SCTP_Chunk) ProtoMessage() {}
+
+func (x *Packet_SCTP_Chunk) ProtoReflect() protoreflect.Message {
+	mi := &file_packet_proto_msgTypes[23]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Packet_SCTP_Chunk.ProtoReflect.Descriptor instead.
+func (*Packet_SCTP_Chunk) Descriptor() ([]byte, []int) {
+	return file_packet_proto_rawDescGZIP(), []int{0, 12, 0}
+}
+
+func (x *Packet_SCTP_Chunk) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Packet_SCTP_Chunk) GetFlags() uint32 {
+	if x != nil {
+		return x.Flags
+	}
+	return 0
+}
+
+func (x *Packet_SCTP_Chunk) GetLength() uint32 {
+	if x != nil {
+		return x.Length
+	}
+	return 0
+}
+
+func (x *Packet_SCTP_Chunk) GetTsn() uint32 {
+	if x != nil {
+		return x.Tsn
+	}
+	return 0
+}
+
+func (x *Packet_SCTP_Chunk) GetStream() uint32 {
+	if x != nil {
+		return x.Stream
+	}
+	return 0
+}
+
+func (x *Packet_SCTP_Chunk) GetSsn() uint32 {
+	if x != nil {
+		return x.Ssn
+	}
+	return 0
+}
+
+func (x *Packet_SCTP_Chunk) GetPpid() uint32 {
+	if x != nil {
+		return x.Ppid
+	}
+	return 0
+}
+
+func (x *Packet_SCTP_Chunk) GetInitiateTag() uint32 {
+	if x != nil {
+		return x.InitiateTag
+	}
+	return 0
+}
+
+type Packet_TLS_Record struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	ContentType string `protobuf:"bytes,1,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	Version     string `protobuf:"bytes,2,opt,name=version,proto3" json:"version,omitempty"`
+	Length      uint32 `protobuf:"varint,3,opt,name=length,proto3" json:"length,omitempty"`
+}
+
+func (x *Packet_TLS_Record) Reset() {
+	*x = Packet_TLS_Record{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_packet_proto_msgTypes[24]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Packet_TLS_Record) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Packet_TLS_Record) ProtoMessage() {}
+
+func (x *Packet_TLS_Record) ProtoReflect() protoreflect.Message {
+	mi := &file_packet_proto_msgTypes[24]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Packet_TLS_Record.ProtoReflect.Descriptor instead.
+func (*Packet_TLS_Record) Descriptor() ([]byte, []int) {
+	return file_packet_proto_rawDescGZIP(), []int{0, 13, 0}
+}
+
+func (x *Packet_TLS_Record) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+func (x *Packet_TLS_Record) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+func (x *Packet_TLS_Record) GetLength() uint32 {
+	if x != nil {
+		return x.Length
+	}
+	return 0
+}
+
+type Packet_DNS_Question struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name  string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Type  string `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	Class string `protobuf:"bytes,3,opt,name=class,proto3" json:"class,omitempty"`
+}
+
+func (x *Packet_DNS_Question) Reset() {
+	*x = Packet_DNS_Question{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_packet_proto_msgTypes[25]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Packet_DNS_Question) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Packet_DNS_Question) ProtoMessage() {}
+
+func (x *Packet_DNS_Question) ProtoReflect() protoreflect.Message {
+	mi := &file_packet_proto_msgTypes[25]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Packet_DNS_Question.ProtoReflect.Descriptor instead.
+func (*Packet_DNS_Question) Descriptor() ([]byte, []int) {
+	return file_packet_proto_rawDescGZIP(), []int{0, 14, 0}
+}
+
+func (x *Packet_DNS_Question) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Packet_DNS_Question) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Packet_DNS_Question) GetClass() string {
+	if x != nil {
+		return x.Class
+	}
+	return ""
+}
+
+type Packet_DNS_Answer struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name  string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Type  string `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	Class string `protobuf:"bytes,3,opt,name=class,proto3" json:"class,omitempty"`
+	Ttl   uint32 `protobuf:"varint,4,opt,name=ttl,proto3" json:"ttl,omitempty"`
+	Data  string `protobuf:"bytes,5,opt,name=data,proto3" json:"data,omitempty"`
+}
+
+func (x *Packet_DNS_Answer) Reset() {
+	*x = Packet_DNS_Answer{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_packet_proto_msgTypes[26]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Packet_DNS_Answer) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Packet_DNS_Answer) ProtoMessage() {}
+
+func (x *Packet_DNS_Answer) ProtoReflect() protoreflect.Message {
+	mi := &file_packet_proto_msgTypes[26]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Packet_DNS_Answer.ProtoReflect.Descriptor instead.
+func (*Packet_DNS_Answer) Descriptor() ([]byte, []int) {
+	return file_packet_proto_rawDescGZIP(), []int{0, 14, 1}
+}
+
+func (x *Packet_DNS_Answer) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Packet_DNS_Answer) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Packet_DNS_Answer) GetClass() string {
+	if x != nil {
+		return x.Class
+	}
+	return ""
+}
+
+func (x *Packet_DNS_Answer) GetTtl() uint32 {
+	if x != nil {
+		return x.Ttl
+	}
+	return 0
+}
+
+func (x *Packet_DNS_Answer) GetData() string {
+	if x != nil {
+		return x.Data
+	}
+	return ""
+}
+
+type Packet_DHCP_Option struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Type  string `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	Value string `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+}
+
+func (x *Packet_DHCP_Option) Reset() {
+	*x = Packet_DHCP_Option{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_packet_proto_msgTypes[27]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Packet_DHCP_Option) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Packet_DHCP_Option) ProtoMessage() {}
+
+func (x *Packet_DHCP_Option) ProtoReflect() protoreflect.Message {
+	mi := &file_packet_proto_msgTypes[27]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Packet_DHCP_Option.ProtoReflect.Descriptor instead.
+func (*Packet_DHCP_Option) Descriptor() ([]byte, []int) {
+	return file_packet_proto_rawDescGZIP(), []int{0, 15, 0}
+}
+
+func (x *Packet_DHCP_Option) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Packet_DHCP_Option) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+var File_packet_proto protoreflect.FileDescriptor
+
+var file_packet_proto_rawDesc = []byte{
+	0x0a, 0x0c, 0x70, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x07,
+	0x70, 0x63, 0x61, 0x70, 0x2e, 0x76, 0x31, 0x1a, 0x1f, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61,
+	0x6d, 0x70, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x8d, 0x26, 0x0a, 0x06, 0x50, 0x61, 0x63,
+	0x6b, 0x65, 0x74, 0x12, 0x28, 0x0a, 0x04, 0x70, 0x63, 0x61, 0x70, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x0b, 0x32, 0x14, 0x2e, 0x70, 0x63, 0x61, 0x70, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x61, 0x63, 0x6b,
+	0x65, 0x74, 0x2e, 0x50, 0x63, 0x61, 0x70, 0x52, 0x04, 0x70, 0x63, 0x61, 0x70, 0x12, 0x2c, 0x0a,
+	0x04, 0x6d, 0x65, 0x74, 0x61, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x18, 0x2e, 0x70, 0x63,
+	0x61, 0x70, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x2e, 0x4d, 0x65, 0x74,
+	0x61, 0x64, 0x61, 0x74, 0x61, 0x52, 0x04, 0x6d, 0x65, 0x74, 0x61, 0x12, 0x38, 0x0a, 0x09, 0x74,
+	0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a,
+	0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66,
+	0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x09, 0x74, 0x69, 0x6d, 0x65,
+	0x73, 0x74, 0x61, 0x6d, 0x70, 0x12, 0x2f, 0x0a, 0x05, 0x69, 0x66, 0x61, 0x63, 0x65, 0x18, 0x04,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x19, 0x2e, 0x70, 0x63, 0x61, 0x70, 0x2e, 0x76, 0x31, 0x2e, 0x50,
+	0x61, 0x63, 0x6b, 0x65, 0x74, 0x2e, 0x49, 0x6e, 0x74, 0x65, 0x72, 0x66, 0x61, 0x63, 0x65, 0x52,
+	0x05, 0x69, 0x66, 0x61, 0x63, 0x65, 0x12, 0x26, 0x0a, 0x02, 0x6c, 0x32, 0x18, 0x05, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x16, 0x2e, 0x70, 0x63, 0x61, 0x70, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x61, 0x63,
+	0x6b, 0x65, 0x74, 0x2e, 0x4c, 0x61, 0x79, 0x65, 0x72, 0x32, 0x52, 0x02, 0x6c, 0x32, 0x12, 0x28,
+	0x0a, 0x02, 0x69, 0x70, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x70, 0x63, 0x61,
+	0x70, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x2e, 0x4c, 0x61, 0x79, 0x65,
+	0x72, 0x33, 0x48, 0x00, 0x52, 0x02, 0x69, 0x70, 0x12, 0x28, 0x0a, 0x03, 0x69, 0x70, 0x34, 0x18,
+	0x07, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x70, 0x63, 0x61, 0x70, 0x2e, 0x76, 0x31, 0x2e,
+	0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x2e, 0x49, 0x50, 0x76, 0x34, 0x48, 0x00, 0x52, 0x03, 0x69,
+	0x70, 0x34, 0x12, 0x28, 0x0a, 0x03, 0x69, 0x70, 0x36, 0x18, 0x08, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x14, 0x2e, 0x70, 0x63, 0x61, 0x70, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74,
+	0x2e, 0x49, 0x50, 0x76, 0x36, 0x48, 0x00, 0x52, 0x03, 0x69, 0x70, 0x36, 0x12, 0x27, 0x0a, 0x03,
+	0x61, 0x72, 0x70, 0x18, 0x09, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x13, 0x2e, 0x70, 0x63, 0x61, 0x70,
+	0x2e, 0x76, 0x31, 0x2e, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x2e, 0x41, 0x52, 0x50, 0x48, 0x00,
+	0x52, 0x03, 0x61, 0x72, 0x70, 0x12, 0x27, 0x0a, 0x03, 0x75, 0x64, 0x70, 0x18, 0x0a, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x13, 0x2e, 0x70, 0x63, 0x61, 0x70, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x61, 0x63,
+	0x6b, 0x65, 0x74, 0x2e, 0x55, 0x44, 0x50, 0x48, 0x01, 0x52, 0x03, 0x75, 0x64, 0x70, 0x12, 0x27,
+	0x0a, 0x03, 0x74, 0x63, 0x70, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x13, 0x2e, 0x70, 0x63,
+	0x61, 0x70, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x2e, 0x54, 0x43, 0x50,
+	0x48, 0x01, 0x52, 0x03, 0x74, 0x63, 0x70, 0x12, 0x2a, 0x0a, 0x04, 0x69, 0x63, 0x6d, 0x70, 0x18,
+	0x0c, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x70, 0x63, 0x61, 0x70, 0x2e, 0x76, 0x31, 0x2e,
+	0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x2e, 0x49, 0x43, 0x4d, 0x50, 0x48, 0x01, 0x52, 0x04, 0x69,
+	0x63, 0x6d, 0x70, 0x12, 0x2a, 0x0a, 0x04, 0x73, 0x63, 0x74, 0x70, 0x18, 0x14, 0x20, 0x01, 0x28,
+	0x0b, 0x32, 0x14, 0x2e, 0x70, 0x63, 0x61, 0x70, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x61, 0x63, 0x6b,
+	0x65, 0x74, 0x2e, 0x53, 0x43, 0x54, 0x50, 0x48, 0x01, 0x52, 0x04, 0x73, 0x63, 0x74, 0x70, 0x12,
+	0x25, 0x0a, 0x03, 0x74, 0x6c, 0x73, 0x18, 0x0d, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x13, 0x2e, 0x70,
+	0x63, 0x61, 0x70, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x2e, 0x54, 0x4c,
+	0x53, 0x52, 0x03, 0x74, 0x6c, 0x73, 0x12, 0x25, 0x0a, 0x03, 0x64, 0x6e, 0x73, 0x18, 0x0e, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x13, 0x2e, 0x70, 0x63, 0x61, 0x70, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x61,
+	0x63, 0x6b, 0x65, 0x74, 0x2e, 0x44, 0x4e, 0x53, 0x52, 0x03, 0x64, 0x6e, 0x73, 0x12, 0x31, 0x0a,
+	0x07, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x0f, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x17,
+	0x2e, 0x70, 0x63, 0x61, 0x70, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x2e,
+	0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x52, 0x07, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e,
+	0x12, 0x12, 0x0a, 0x04, 0x66, 0x6c, 0x6f, 0x77, 0x18, 0x10, 0x20, 0x01, 0x28, 0x04, 0x52, 0x04,
+	0x66, 0x6c, 0x6f, 0x77, 0x12, 0x18, 0x0a, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x18,
+	0x11, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x2d,
+	0x0a, 0x06, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x73, 0x18, 0x12, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x15,
+	0x2e, 0x70, 0x63, 0x61, 0x70, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x2e,
+	0x45, 0x72, 0x72, 0x6f, 0x72, 0x52, 0x06, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x73, 0x12, 0x28, 0x0a,
+	0x04, 0x64, 0x68, 0x63, 0x70, 0x18, 0x13, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x70, 0x63,
+	0x61, 0x70, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x2e, 0x44, 0x48, 0x43,
+	0x50, 0x52, 0x04, 0x64, 0x68, 0x63, 0x70, 0x12, 0x33, 0x0a, 0x06, 0x6c, 0x61, 0x62, 0x65, 0x6c,
+	0x73, 0x18, 0x15, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x1b, 0x2e, 0x70, 0x63, 0x61, 0x70, 0x2e, 0x76,
+	0x31, 0x2e, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x2e, 0x4c, 0x61, 0x62, 0x65, 0x6c, 0x73, 0x45,
+	0x6e, 0x74, 0x72, 0x79, 0x52, 0x06, 0x6c, 0x61, 0x62, 0x65, 0x6c, 0x73, 0x12, 0x25, 0x0a, 0x03,
+	0x73, 0x69, 0x70, 0x18, 0x16, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x13, 0x2e, 0x70, 0x63, 0x61, 0x70,
+	0x2e, 0x76, 0x31, 0x2e, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x2e, 0x53, 0x49, 0x50, 0x52, 0x03,
+	0x73, 0x69, 0x70, 0x12, 0x25, 0x0a, 0x03, 0x6e, 0x74, 0x70, 0x18, 0x17, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x13, 0x2e, 0x70, 0x63, 0x61, 0x70, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x61, 0x63, 0x6b, 0x65,
+	0x74, 0x2e, 0x4e, 0x54, 0x50, 0x52, 0x03, 0x6e, 0x74, 0x70, 0x1a, 0x48, 0x0a, 0x04, 0x50, 0x63,
+	0x61, 0x70, 0x12, 0x18, 0x0a, 0x07, 0x63, 0x6f, 0x6e, 0x74, 0x65, 0x78, 0x74, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x07, 0x63, 0x6f, 0x6e, 0x74, 0x65, 0x78, 0x74, 0x12, 0x16, 0x0a, 0x06,
+	0x73, 0x65, 0x72, 0x69, 0x61, 0x6c, 0x18, 0x02, 0x20, 0x01, 0x28, 0x04, 0x52, 0x06, 0x73, 0x65,
+	0x72, 0x69, 0x61, 0x6c, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x02, 0x69, 0x64, 0x1a, 0x67, 0x0a, 0x08, 0x4d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61,
+	0x12, 0x1c, 0x0a, 0x09, 0x74, 0x72, 0x75, 0x6e, 0x63, 0x61, 0x74, 0x65, 0x64, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x08, 0x52, 0x09, 0x74, 0x72, 0x75, 0x6e, 0x63, 0x61, 0x74, 0x65, 0x64, 0x12, 0x16,
+	0x0a, 0x06, 0x6c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x18, 0x02, 0x20, 0x01, 0x28, 0x04, 0x52, 0x06,
+	0x6c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x12, 0x25, 0x0a, 0x0e, 0x63, 0x61, 0x70, 0x74, 0x75, 0x72,
+	0x65, 0x5f, 0x6c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x18, 0x03, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0d,
+	0x63, 0x61, 0x70, 0x74, 0x75, 0x72, 0x65, 0x4c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x1a, 0x4b, 0x0a,
+	0x09, 0x49, 0x6e, 0x74, 0x65, 0x72, 0x66, 0x61, 0x63, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x69, 0x6e,
+	0x64, 0x65, 0x78, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x05, 0x69, 0x6e, 0x64, 0x65, 0x78,
+	0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04,
+	0x6e, 0x61, 0x6d, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x61, 0x64, 0x64, 0x72, 0x73, 0x18, 0x03, 0x20,
+	0x03, 0x28, 0x09, 0x52, 0x05, 0x61, 0x64, 0x64, 0x72, 0x73, 0x1a, 0x4c, 0x0a, 0x06, 0x4c, 0x61,
+	0x79, 0x65, 0x72, 0x32, 0x12, 0x16, 0x0a, 0x06, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x12, 0x16, 0x0a, 0x06,
+	0x74, 0x61, 0x72, 0x67, 0x65, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x74, 0x61,
+	0x72, 0x67, 0x65, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x74, 0x79, 0x70, 0x65, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x04, 0x74, 0x79, 0x70, 0x65, 0x1a, 0x38, 0x0a, 0x06, 0x4c, 0x61, 0x79, 0x65,
+	0x72, 0x33, 0x12, 0x16, 0x0a, 0x06, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x06, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x74, 0x61,
+	0x72, 0x67, 0x65, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x74, 0x61, 0x72, 0x67,
+	0x65, 0x74, 0x1a, 0x30, 0x0a, 0x08, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x12, 0x10,
+	0x0a, 0x03, 0x6e, 0x75, 0x6d, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x03, 0x6e, 0x75, 0x6d,
+	0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04,
+	0x6e, 0x61, 0x6d, 0x65, 0x1a, 0xa5, 0x02, 0x0a, 0x04, 0x49, 0x50, 0x76, 0x34, 0x12, 0x16, 0x0a,
+	0x06, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x07, 0x52, 0x06, 0x73,
+	0x6f, 0x75, 0x72, 0x63, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x74, 0x61, 0x72, 0x67, 0x65, 0x74, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x07, 0x52, 0x06, 0x74, 0x61, 0x72, 0x67, 0x65, 0x74, 0x12, 0x0e, 0x0a,
+	0x02, 0x69, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x02, 0x69, 0x64, 0x12, 0x10, 0x0a,
+	0x03, 0x69, 0x68, 0x6c, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x03, 0x69, 0x68, 0x6c, 0x12,
+	0x10, 0x0a, 0x03, 0x74, 0x74, 0x6c, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x03, 0x74, 0x74,
+	0x6c, 0x12, 0x10, 0x0a, 0x03, 0x74, 0x6f, 0x73, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x03,
+	0x74, 0x6f, 0x73, 0x12, 0x16, 0x0a, 0x06, 0x6c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x18, 0x07, 0x20,
+	0x01, 0x28, 0x0d, 0x52, 0x06, 0x6c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x12, 0x27, 0x0a, 0x0f, 0x66,
+	0x72, 0x61, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x5f, 0x6f, 0x66, 0x66, 0x73, 0x65, 0x74, 0x18, 0x08,
+	0x20, 0x01, 0x28, 0x0d, 0x52, 0x0e, 0x66, 0x72, 0x61, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x4f, 0x66,
+	0x66, 0x73, 0x65, 0x74, 0x12, 0x1a, 0x0a, 0x08, 0x63, 0x68, 0x65, 0x63, 0x6b, 0x73, 0x75, 0x6d,
+	0x18, 0x09, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x08, 0x63, 0x68, 0x65, 0x63, 0x6b, 0x73, 0x75, 0x6d,
+	0x12, 0x34, 0x0a, 0x08, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x18, 0x0a, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x18, 0x2e, 0x70, 0x63, 0x61, 0x70, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x61, 0x63,
+	0x6b, 0x65, 0x74, 0x2e, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x52, 0x08, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x12, 0x14, 0x0a, 0x05, 0x66, 0x6c, 0x61, 0x67, 0x73, 0x18,
+	0x0b, 0x20, 0x03, 0x28, 0x09, 0x52, 0x05, 0x66, 0x6c, 0x61, 0x67, 0x73, 0x1a, 0xe5, 0x01, 0x0a,
+	0x04, 0x49, 0x50, 0x76, 0x36, 0x12, 0x16, 0x0a, 0x06, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x06, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x12, 0x16, 0x0a,
+	0x06, 0x74, 0x61, 0x72, 0x67, 0x65, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x06, 0x74,
+	0x61, 0x72, 0x67, 0x65, 0x74, 0x12, 0x16, 0x0a, 0x06, 0x6c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x18,
+	0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x06, 0x6c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x12, 0x23, 0x0a,
+	0x0d, 0x74, 0x72, 0x61, 0x66, 0x66, 0x69, 0x63, 0x5f, 0x63, 0x6c, 0x61, 0x73, 0x73, 0x18, 0x04,
+	0x20, 0x01, 0x28, 0x0d, 0x52, 0x0c, 0x74, 0x72, 0x61, 0x66, 0x66, 0x69, 0x63, 0x43, 0x6c, 0x61,
+	0x73, 0x73, 0x12, 0x1d, 0x0a, 0x0a, 0x66, 0x6c, 0x6f, 0x77, 0x5f, 0x6c, 0x61, 0x62, 0x65, 0x6c,
+	0x18, 0x05, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x09, 0x66, 0x6c, 0x6f, 0x77, 0x4c, 0x61, 0x62, 0x65,
+	0x6c, 0x12, 0x1b, 0x0a, 0x09, 0x68, 0x6f, 0x70, 0x5f, 0x6c, 0x69, 0x6d, 0x69, 0x74, 0x18, 0x06,
+	0x20, 0x01, 0x28, 0x0d, 0x52, 0x08, 0x68, 0x6f, 0x70, 0x4c, 0x69, 0x6d, 0x69, 0x74, 0x12, 0x34,
+	0x0a, 0x08, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x18, 0x07, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x18, 0x2e, 0x70, 0x63, 0x61, 0x70, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x61, 0x63, 0x6b, 0x65,
+	0x74, 0x2e, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x52, 0x08, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x63, 0x6f, 0x6c, 0x1a, 0xbd, 0x01, 0x0a, 0x03, 0x41, 0x52, 0x50, 0x12, 0x1c, 0x0a, 0x09,
+	0x6f, 0x70, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52,
+	0x09, 0x6f, 0x70, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x34, 0x0a, 0x06, 0x73, 0x6f,
+	0x75, 0x72, 0x63, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1c, 0x2e, 0x70, 0x63, 0x61,
+	0x70, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x2e, 0x41, 0x52, 0x50, 0x2e,
+	0x45, 0x6e, 0x64, 0x70, 0x6f, 0x69, 0x6e, 0x74, 0x52, 0x06, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65,
+	0x12, 0x34, 0x0a, 0x06, 0x74, 0x61, 0x72, 0x67, 0x65, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x1c, 0x2e, 0x70, 0x63, 0x61, 0x70, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x61, 0x63, 0x6b, 0x65,
+	0x74, 0x2e, 0x41, 0x52, 0x50, 0x2e, 0x45, 0x6e, 0x64, 0x70, 0x6f, 0x69, 0x6e, 0x74, 0x52, 0x06,
+	0x74, 0x61, 0x72, 0x67, 0x65, 0x74, 0x1a, 0x2c, 0x0a, 0x08, 0x45, 0x6e, 0x64, 0x70, 0x6f, 0x69,
+	0x6e, 0x74, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x70, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02,
+	0x69, 0x70, 0x12, 0x10, 0x0a, 0x03, 0x6d, 0x61, 0x63, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x03, 0x6d, 0x61, 0x63, 0x1a, 0x84, 0x02, 0x0a, 0x04, 0x49, 0x43, 0x4d, 0x50, 0x12, 0x18, 0x0a,
+	0x07, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x07,
+	0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x12, 0x0a, 0x04, 0x74, 0x79, 0x70, 0x65, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x04, 0x74, 0x79, 0x70, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x63,
+	0x6f, 0x64, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x04, 0x63, 0x6f, 0x64, 0x65, 0x12,
+	0x1a, 0x0a, 0x08, 0x63, 0x68, 0x65, 0x63, 0x6b, 0x73, 0x75, 0x6d, 0x18, 0x04, 0x20, 0x01, 0x28,
+	0x0d, 0x52, 0x08, 0x63, 0x68, 0x65, 0x63, 0x6b, 0x73, 0x75, 0x6d, 0x12, 0x18, 0x0a, 0x07, 0x6d,
+	0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x6d, 0x65,
+	0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x06, 0x20, 0x01, 0x28,
+	0x0d, 0x52, 0x02, 0x69, 0x64, 0x12, 0x10, 0x0a, 0x03, 0x73, 0x65, 0x71, 0x18, 0x07, 0x20, 0x01,
+	0x28, 0x0d, 0x52, 0x03, 0x73, 0x65, 0x71, 0x12, 0x16, 0x0a, 0x06, 0x74, 0x61, 0x72, 0x67, 0x65,
+	0x74, 0x18, 0x08, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x74, 0x61, 0x72, 0x67, 0x65, 0x74, 0x12,
+	0x20, 0x0a, 0x0b, 0x64, 0x65, 0x73, 0x74, 0x69, 0x6e, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x09,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x64, 0x65, 0x73, 0x74, 0x69, 0x6e, 0x61, 0x74, 0x69, 0x6f,
+	0x6e, 0x12, 0x28, 0x0a, 0x04, 0x69, 0x70, 0x76, 0x36, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x14, 0x2e, 0x70, 0x63, 0x61, 0x70, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74,
+	0x2e, 0x49, 0x50, 0x76, 0x36, 0x52, 0x04, 0x69, 0x70, 0x76, 0x36, 0x1a, 0x7d, 0x0a, 0x03, 0x55,
+	0x44, 0x50, 0x12, 0x16, 0x0a, 0x06, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x0d, 0x52, 0x06, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x74, 0x61,
+	0x72, 0x67, 0x65, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x06, 0x74, 0x61, 0x72, 0x67,
+	0x65, 0x74, 0x12, 0x16, 0x0a, 0x06, 0x6c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x0d, 0x52, 0x06, 0x6c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x12, 0x1a, 0x0a, 0x08, 0x63, 0x68,
+	0x65, 0x63, 0x6b, 0x73, 0x75, 0x6d, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x08, 0x63, 0x68,
+	0x65, 0x63, 0x6b, 0x73, 0x75, 0x6d, 0x12, 0x12, 0x0a, 0x04, 0x73, 0x69, 0x7a, 0x65, 0x18, 0x05,
+	0x20, 0x01, 0x28, 0x0d, 0x52, 0x04, 0x73, 0x69, 0x7a, 0x65, 0x1a, 0xbc, 0x02, 0x0a, 0x03, 0x54,
+	0x43, 0x50, 0x12, 0x16, 0x0a, 0x06, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x0d, 0x52, 0x06, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x74, 0x61,
+	0x72, 0x67, 0x65, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x06, 0x74, 0x61, 0x72, 0x67,
+	0x65, 0x74, 0x12, 0x10, 0x0a, 0x03, 0x73, 0x65, 0x71, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52,
+	0x03, 0x73, 0x65, 0x71, 0x12, 0x10, 0x0a, 0x03, 0x61, 0x63, 0x6b, 0x18, 0x04, 0x20, 0x01, 0x28,
+	0x0d, 0x52, 0x03, 0x61, 0x63, 0x6b, 0x12, 0x1f, 0x0a, 0x0b, 0x64, 0x61, 0x74, 0x61, 0x5f, 0x6f,
+	0x66, 0x66, 0x73, 0x65, 0x74, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0a, 0x64, 0x61, 0x74,
+	0x61, 0x4f, 0x66, 0x66, 0x73, 0x65, 0x74, 0x12, 0x16, 0x0a, 0x06, 0x77, 0x69, 0x6e, 0x64, 0x6f,
+	0x77, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x06, 0x77, 0x69, 0x6e, 0x64, 0x6f, 0x77, 0x12,
+	0x1a, 0x0a, 0x08, 0x63, 0x68, 0x65, 0x63, 0x6b, 0x73, 0x75, 0x6d, 0x18, 0x07, 0x20, 0x01, 0x28,
+	0x0d, 0x52, 0x08, 0x63, 0x68, 0x65, 0x63, 0x6b, 0x73, 0x75, 0x6d, 0x12, 0x16, 0x0a, 0x06, 0x75,
+	0x72, 0x67, 0x65, 0x6e, 0x74, 0x18, 0x08, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x06, 0x75, 0x72, 0x67,
+	0x65, 0x6e, 0x74, 0x12, 0x16, 0x0a, 0x06, 0x6c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x18, 0x09, 0x20,
+	0x01, 0x28, 0x0d, 0x52, 0x06, 0x6c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x12, 0x2f, 0x0a, 0x05, 0x66,
+	0x6c, 0x61, 0x67, 0x73, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x19, 0x2e, 0x70, 0x63, 0x61,
+	0x70, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x2e, 0x54, 0x43, 0x50, 0x2e,
+	0x46, 0x6c, 0x61, 0x67, 0x73, 0x52, 0x05, 0x66, 0x6c, 0x61, 0x67, 0x73, 0x1a, 0x2b, 0x0a, 0x05,
+	0x46, 0x6c, 0x61, 0x67, 0x73, 0x12, 0x10, 0x0a, 0x03, 0x64, 0x65, 0x63, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x0d, 0x52, 0x03, 0x64, 0x65, 0x63, 0x12, 0x10, 0x0a, 0x03, 0x73, 0x74, 0x72, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x73, 0x74, 0x72, 0x1a, 0x84, 0x03, 0x0a, 0x04, 0x53, 0x43,
+	0x54, 0x50, 0x12, 0x16, 0x0a, 0x06, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x0d, 0x52, 0x06, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x74, 0x61,
+	0x72, 0x67, 0x65, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x06, 0x74, 0x61, 0x72, 0x67,
+	0x65, 0x74, 0x12, 0x29, 0x0a, 0x10, 0x76, 0x65, 0x72, 0x69, 0x66, 0x69, 0x63, 0x61, 0x74, 0x69,
+	0x6f, 0x6e, 0x5f, 0x74, 0x61, 0x67, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0f, 0x76, 0x65,
+	0x72, 0x69, 0x66, 0x69, 0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x54, 0x61, 0x67, 0x12, 0x1a, 0x0a,
+	0x08, 0x63, 0x68, 0x65, 0x63, 0x6b, 0x73, 0x75, 0x6d, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0d, 0x52,
+	0x08, 0x63, 0x68, 0x65, 0x63, 0x6b, 0x73, 0x75, 0x6d, 0x12, 0x12, 0x0a, 0x04, 0x73, 0x69, 0x7a,
+	0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x04, 0x73, 0x69, 0x7a, 0x65, 0x12, 0x32, 0x0a,
+	0x06, 0x63, 0x68, 0x75, 0x6e, 0x6b, 0x73, 0x18, 0x06, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x1a, 0x2e,
+	0x70, 0x63, 0x61, 0x70, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x2e, 0x53,
+	0x43, 0x54, 0x50, 0x2e, 0x43, 0x68, 0x75, 0x6e, 0x6b, 0x52, 0x06, 0x63, 0x68, 0x75, 0x6e, 0x6b,
+	0x73, 0x1a, 0xbc, 0x01, 0x0a, 0x05, 0x43, 0x68, 0x75, 0x6e, 0x6b, 0x12, 0x12, 0x0a, 0x04, 0x74,
+	0x79, 0x70, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x74, 0x79, 0x70, 0x65, 0x12,
+	0x14, 0x0a, 0x05, 0x66, 0x6c, 0x61, 0x67, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x05,
+	0x66, 0x6c, 0x61, 0x67, 0x73, 0x12, 0x16, 0x0a, 0x06, 0x6c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x18,
+	0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x06, 0x6c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x12, 0x10, 0x0a,
+	0x03, 0x74, 0x73, 0x6e, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x03, 0x74, 0x73, 0x6e, 0x12,
+	0x16, 0x0a, 0x06, 0x73, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0d, 0x52,
+	0x06, 0x73, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x12, 0x10, 0x0a, 0x03, 0x73, 0x73, 0x6e, 0x18, 0x06,
+	0x20, 0x01, 0x28, 0x0d, 0x52, 0x03, 0x73, 0x73, 0x6e, 0x12, 0x12, 0x0a, 0x04, 0x70, 0x70, 0x69,
+	0x64, 0x18, 0x07, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x04, 0x70, 0x70, 0x69, 0x64, 0x12, 0x21, 0x0a,
+	0x0c, 0x69, 0x6e, 0x69, 0x74, 0x69, 0x61, 0x74, 0x65, 0x5f, 0x74, 0x61, 0x67, 0x18, 0x08, 0x20,
+	0x01, 0x28, 0x0d, 0x52, 0x0b, 0x69, 0x6e, 0x69, 0x74, 0x69, 0x61, 0x74, 0x65, 0x54, 0x61, 0x67,
+	0x1a, 0x9a, 0x01, 0x0a, 0x03, 0x54, 0x4c, 0x53, 0x12, 0x34, 0x0a, 0x07, 0x72, 0x65, 0x63, 0x6f,
+	0x72, 0x64, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x70, 0x63, 0x61, 0x70,
+	0x2e, 0x76, 0x31, 0x2e, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x2e, 0x54, 0x4c, 0x53, 0x2e, 0x52,
+	0x65, 0x63, 0x6f, 0x72, 0x64, 0x52, 0x07, 0x72, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x73, 0x1a, 0x5d,
+	0x0a, 0x06, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x12, 0x21, 0x0a, 0x0c, 0x63, 0x6f, 0x6e, 0x74,
+	0x65, 0x6e, 0x74, 0x5f, 0x74, 0x79, 0x70, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b,
+	0x63, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x54, 0x79, 0x70, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x76,
+	0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x76, 0x65,
+	0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x16, 0x0a, 0x06, 0x6c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x18,
+	0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x06, 0x6c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x1a, 0xf4, 0x02,
+	0x0a, 0x03, 0x44, 0x4e, 0x53, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x0d, 0x52, 0x02, 0x69, 0x64, 0x12, 0x0e, 0x0a, 0x02, 0x6f, 0x70, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x02, 0x6f, 0x70, 0x12, 0x23, 0x0a, 0x0d, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73,
+	0x65, 0x5f, 0x63, 0x6f, 0x64, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x72, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x43, 0x6f, 0x64, 0x65, 0x12, 0x3a, 0x0a, 0x09, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0x04, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x1c, 0x2e,
+	0x70, 0x63, 0x61, 0x70, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x2e, 0x44,
+	0x4e, 0x53, 0x2e, 0x51, 0x75, 0x65, 0x73, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x09, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x12, 0x34, 0x0a, 0x07, 0x61, 0x6e, 0x73, 0x77, 0x65, 0x72,
+	0x73, 0x18, 0x05, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x70, 0x63, 0x61, 0x70, 0x2e, 0x76,
+	0x31, 0x2e, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x2e, 0x44, 0x4e, 0x53, 0x2e, 0x41, 0x6e, 0x73,
+	0x77, 0x65, 0x72, 0x52, 0x07, 0x61, 0x6e, 0x73, 0x77, 0x65, 0x72, 0x73, 0x1a, 0x48, 0x0a, 0x08,
+	0x51, 0x75, 0x65, 0x73, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x12, 0x0a, 0x04,
+	0x74, 0x79, 0x70, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x74, 0x79, 0x70, 0x65,
+	0x12, 0x14, 0x0a, 0x05, 0x63, 0x6c, 0x61, 0x73, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x05, 0x63, 0x6c, 0x61, 0x73, 0x73, 0x1a, 0x6c, 0x0a, 0x06, 0x41, 0x6e, 0x73, 0x77, 0x65, 0x72,
+	0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04,
+	0x6e, 0x61, 0x6d, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x74, 0x79, 0x70, 0x65, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x04, 0x74, 0x79, 0x70, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x63, 0x6c, 0x61, 0x73,
+	0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x63, 0x6c, 0x61, 0x73, 0x73, 0x12, 0x10,
+	0x0a, 0x03, 0x74, 0x74, 0x6c, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x03, 0x74, 0x74, 0x6c,
+	0x12, 0x12, 0x0a, 0x04, 0x64, 0x61, 0x74, 0x61, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04,
+	0x64, 0x61, 0x74, 0x61, 0x1a, 0x96, 0x03, 0x0a, 0x04, 0x44, 0x48, 0x43, 0x50, 0x12, 0x18, 0x0a,
+	0x07, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x07,
+	0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x21, 0x0a, 0x0c, 0x6d, 0x65, 0x73, 0x73, 0x61,
+	0x67, 0x65, 0x5f, 0x74, 0x79, 0x70, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x6d,
+	0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x54, 0x79, 0x70, 0x65, 0x12, 0x10, 0x0a, 0x03, 0x78, 0x69,
+	0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x03, 0x78, 0x69, 0x64, 0x12, 0x1b, 0x0a, 0x09,
+	0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x5f, 0x69, 0x70, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x08, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x49, 0x70, 0x12, 0x1f, 0x0a, 0x0b, 0x61, 0x73, 0x73,
+	0x69, 0x67, 0x6e, 0x65, 0x64, 0x5f, 0x69, 0x70, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a,
+	0x61, 0x73, 0x73, 0x69, 0x67, 0x6e, 0x65, 0x64, 0x49, 0x70, 0x12, 0x1b, 0x0a, 0x09, 0x73, 0x65,
+	0x72, 0x76, 0x65, 0x72, 0x5f, 0x69, 0x70, 0x18, 0x06, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x73,
+	0x65, 0x72, 0x76, 0x65, 0x72, 0x49, 0x70, 0x12, 0x19, 0x0a, 0x08, 0x72, 0x65, 0x6c, 0x61, 0x79,
+	0x5f, 0x69, 0x70, 0x18, 0x07, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x72, 0x65, 0x6c, 0x61, 0x79,
+	0x49, 0x70, 0x12, 0x1d, 0x0a, 0x0a, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x5f, 0x6d, 0x61, 0x63,
+	0x18, 0x08, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x4d, 0x61,
+	0x63, 0x12, 0x21, 0x0a, 0x0c, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x65, 0x64, 0x5f, 0x69,
+	0x70, 0x18, 0x09, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x65, 0x64, 0x49, 0x70, 0x12, 0x1c, 0x0a, 0x09, 0x61, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x65,
+	0x73, 0x18, 0x0a, 0x20, 0x03, 0x28, 0x09, 0x52, 0x09, 0x61, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73,
+	0x65, 0x73, 0x12, 0x35, 0x0a, 0x07, 0x6f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0x0b, 0x20,
+	0x03, 0x28, 0x0b, 0x32, 0x1b, 0x2e, 0x70, 0x63, 0x61, 0x70, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x61,
+	0x63, 0x6b, 0x65, 0x74, 0x2e, 0x44, 0x48, 0x43, 0x50, 0x2e, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e,
+	0x52, 0x07, 0x6f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x1a, 0x32, 0x0a, 0x06, 0x4f, 0x70, 0x74,
+	0x69, 0x6f, 0x6e, 0x12, 0x12, 0x0a, 0x04, 0x74, 0x79, 0x70, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x04, 0x74, 0x79, 0x70, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x1a, 0xd7, 0x01,
+	0x0a, 0x03, 0x53, 0x49, 0x50, 0x12, 0x18, 0x0a, 0x07, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12,
+	0x16, 0x0a, 0x06, 0x6d, 0x65, 0x74, 0x68, 0x6f, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x06, 0x6d, 0x65, 0x74, 0x68, 0x6f, 0x64, 0x12, 0x10, 0x0a, 0x03, 0x75, 0x72, 0x69, 0x18, 0x03,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x75, 0x72, 0x69, 0x12, 0x17, 0x0a, 0x07, 0x63, 0x61, 0x6c,
+	0x6c, 0x5f, 0x69, 0x64, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x63, 0x61, 0x6c, 0x6c,
+	0x49, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x63, 0x73, 0x65, 0x71, 0x18, 0x05, 0x20, 0x01, 0x28, 0x03,
+	0x52, 0x04, 0x63, 0x73, 0x65, 0x71, 0x12, 0x12, 0x0a, 0x04, 0x63, 0x6f, 0x64, 0x65, 0x18, 0x06,
+	0x20, 0x01, 0x28, 0x0d, 0x52, 0x04, 0x63, 0x6f, 0x64, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x73, 0x74,
+	0x61, 0x74, 0x75, 0x73, 0x18, 0x07, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x73, 0x74, 0x61, 0x74,
+	0x75, 0x73, 0x12, 0x1d, 0x0a, 0x0a, 0x75, 0x73, 0x65, 0x72, 0x5f, 0x61, 0x67, 0x65, 0x6e, 0x74,
+	0x18, 0x08, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x75, 0x73, 0x65, 0x72, 0x41, 0x67, 0x65, 0x6e,
+	0x74, 0x12, 0x14, 0x0a, 0x05, 0x6d, 0x65, 0x64, 0x69, 0x61, 0x18, 0x09, 0x20, 0x03, 0x28, 0x09,
+	0x52, 0x05, 0x6d, 0x65, 0x64, 0x69, 0x61, 0x1a, 0xb3, 0x02, 0x0a, 0x03, 0x4e, 0x54, 0x50, 0x12,
+	0x18, 0x0a, 0x07, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d,
+	0x52, 0x07, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x12, 0x0a, 0x04, 0x6d, 0x6f, 0x64,
+	0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6d, 0x6f, 0x64, 0x65, 0x12, 0x18, 0x0a,
+	0x07, 0x73, 0x74, 0x72, 0x61, 0x74, 0x75, 0x6d, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x07,
+	0x73, 0x74, 0x72, 0x61, 0x74, 0x75, 0x6d, 0x12, 0x14, 0x0a, 0x05, 0x72, 0x65, 0x66, 0x69, 0x64,
+	0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x72, 0x65, 0x66, 0x69, 0x64, 0x12, 0x32, 0x0a,
+	0x06, 0x6f, 0x72, 0x69, 0x67, 0x69, 0x6e, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e,
+	0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e,
+	0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x06, 0x6f, 0x72, 0x69, 0x67, 0x69,
+	0x6e, 0x12, 0x34, 0x0a, 0x07, 0x72, 0x65, 0x63, 0x65, 0x69, 0x76, 0x65, 0x18, 0x06, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x07,
+	0x72, 0x65, 0x63, 0x65, 0x69, 0x76, 0x65, 0x12, 0x36, 0x0a, 0x08, 0x74, 0x72, 0x61, 0x6e, 0x73,
+	0x6d, 0x69, 0x74, 0x18, 0x07, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67,
+	0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65,
+	0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x08, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x6d, 0x69, 0x74, 0x12,
+	0x16, 0x0a, 0x06, 0x6f, 0x66, 0x66, 0x73, 0x65, 0x74, 0x18, 0x08, 0x20, 0x01, 0x28, 0x01, 0x52,
+	0x06, 0x6f, 0x66, 0x66, 0x73, 0x65, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x64, 0x65, 0x6c, 0x61, 0x79,
+	0x18, 0x09, 0x20, 0x01, 0x28, 0x01, 0x52, 0x05, 0x64, 0x65, 0x6c, 0x61, 0x79, 0x1a, 0x2f, 0x0a,
+	0x05, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x12, 0x10, 0x0a, 0x03, 0x6d, 0x73, 0x67, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x03, 0x6d, 0x73, 0x67, 0x12, 0x14, 0x0a, 0x05, 0x6c, 0x61, 0x79, 0x65,
+	0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x6c, 0x61, 0x79, 0x65, 0x72, 0x1a, 0x39,
+	0x0a, 0x0b, 0x4c, 0x61, 0x62, 0x65, 0x6c, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a,
+	0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12,
+	0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05,
+	0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x22, 0x31, 0x0a, 0x07, 0x56, 0x65, 0x72,
+	0x73, 0x69, 0x6f, 0x6e, 0x12, 0x17, 0x0a, 0x13, 0x56, 0x45, 0x52, 0x53, 0x49, 0x4f, 0x4e, 0x5f,
+	0x55, 0x4e, 0x53, 0x50, 0x45, 0x43, 0x49, 0x46, 0x49, 0x45, 0x44, 0x10, 0x00, 0x12, 0x0d, 0x0a,
+	0x09, 0x56, 0x45, 0x52, 0x53, 0x49, 0x4f, 0x4e, 0x5f, 0x31, 0x10, 0x01, 0x42, 0x04, 0x0a, 0x02,
+	0x6c, 0x33, 0x42, 0x04, 0x0a, 0x02, 0x6c, 0x34, 0x42, 0x42, 0x5a, 0x40, 0x67, 0x69, 0x74, 0x68,
+	0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x47, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x43, 0x6c, 0x6f,
+	0x75, 0x64, 0x50, 0x6c, 0x61, 0x74, 0x66, 0x6f, 0x72, 0x6d, 0x2f, 0x70, 0x63, 0x61, 0x70, 0x2d,
+	0x73, 0x69, 0x64, 0x65, 0x63, 0x61, 0x72, 0x2f, 0x70, 0x63, 0x61, 0x70, 0x2d, 0x63, 0x6c, 0x69,
+	0x2f, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x2f, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_packet_proto_rawDescOnce sync.Once
+	file_packet_proto_rawDescData = file_packet_proto_rawDesc
+)
+
+func file_packet_proto_rawDescGZIP() []byte {
+	file_packet_proto_rawDescOnce.Do(func() {
+		file_packet_proto_rawDescData = protoimpl.X.CompressGZIP(file_packet_proto_rawDescData)
+	})
+	return file_packet_proto_rawDescData
+}
+
+var file_packet_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_packet_proto_msgTypes = make([]protoimpl.MessageInfo, 28)
+var file_packet_proto_goTypes = []any{
+	(Packet_Version)(0),           // 0: pcap.v1.Packet.Version
+	(*Packet)(nil),                // 1: pcap.v1.Packet
+	(*Packet_Pcap)(nil),           // 2: pcap.v1.Packet.Pcap
+	(*Packet_Metadata)(nil),       // 3: pcap.v1.Packet.Metadata
+	(*Packet_Interface)(nil),      // 4: pcap.v1.Packet.Interface
+	(*Packet_Layer2)(nil),         // 5: pcap.v1.Packet.Layer2
+	(*Packet_Layer3)(nil),         // 6: pcap.v1.Packet.Layer3
+	(*Packet_Protocol)(nil),       // 7: pcap.v1.Packet.Protocol
+	(*Packet_IPv4)(nil),           // 8: pcap.v1.Packet.IPv4
+	(*Packet_IPv6)(nil),           // 9: pcap.v1.Packet.IPv6
+	(*Packet_ARP)(nil),            // 10: pcap.v1.Packet.ARP
+	(*Packet_ICMP)(nil),           // 11: pcap.v1.Packet.ICMP
+	(*Packet_UDP)(nil),            // 12: pcap.v1.Packet.UDP
+	(*Packet_TCP)(nil),            // 13: pcap.v1.Packet.TCP
+	(*Packet_SCTP)(nil),           // 14: pcap.v1.Packet.SCTP
+	(*Packet_TLS)(nil),            // 15: pcap.v1.Packet.TLS
+	(*Packet_DNS)(nil),            // 16: pcap.v1.Packet.DNS
+	(*Packet_DHCP)(nil),           // 17: pcap.v1.Packet.DHCP
+	(*Packet_SIP)(nil),            // 18: pcap.v1.Packet.SIP
+	(*Packet_NTP)(nil),            // 19: pcap.v1.Packet.NTP
+	(*Packet_Error)(nil),          // 20: pcap.v1.Packet.Error
+	nil,                           // 21: pcap.v1.Packet.LabelsEntry
+	(*Packet_ARP_Endpoint)(nil),   // 22: pcap.v1.Packet.ARP.Endpoint
+	(*Packet_TCP_Flags)(nil),      // 23: pcap.v1.Packet.TCP.Flags
+	(*Packet_SCTP_Chunk)(nil),     // 24: pcap.v1.Packet.SCTP.Chunk
+	(*Packet_TLS_Record)(nil),     // 25: pcap.v1.Packet.TLS.Record
+	(*Packet_DNS_Question)(nil),   // 26: pcap.v1.Packet.DNS.Question
+	(*Packet_DNS_Answer)(nil),     // 27: pcap.v1.Packet.DNS.Answer
+	(*Packet_DHCP_Option)(nil),    // 28: pcap.v1.Packet.DHCP.Option
+	(*timestamppb.Timestamp)(nil), // 29: google.protobuf.Timestamp
+}
+var file_packet_proto_depIdxs = []int32{
+	2,  // 0: pcap.v1.Packet.pcap:type_name -> pcap.v1.Packet.Pcap
+	3,  // 1: pcap.v1.Packet.meta:type_name -> pcap.v1.Packet.Metadata
+	29, // 2: pcap.v1.Packet.timestamp:type_name -> google.protobuf.Timestamp
+	4,  // 3: pcap.v1.Packet.iface:type_name -> pcap.v1.Packet.Interface
+	5,  // 4: pcap.v1.Packet.l2:type_name -> pcap.v1.Packet.Layer2
+	6,  // 5: pcap.v1.Packet.ip:type_name -> pcap.v1.Packet.Layer3
+	8,  // 6: pcap.v1.Packet.ip4:type_name -> pcap.v1.Packet.IPv4
+	9,  // 7: pcap.v1.Packet.ip6:type_name -> pcap.v1.Packet.IPv6
+	10, // 8: pcap.v1.Packet.arp:type_name -> pcap.v1.Packet.ARP
+	12, // 9: pcap.v1.Packet.udp:type_name -> pcap.v1.Packet.UDP
+	13, // 10: pcap.v1.Packet.tcp:type_name -> pcap.v1.Packet.TCP
+	11, // 11: pcap.v1.Packet.icmp:type_name -> pcap.v1.Packet.ICMP
+	14, // 12: pcap.v1.Packet.sctp:type_name -> pcap.v1.Packet.SCTP
+	15, // 13: pcap.v1.Packet.tls:type_name -> pcap.v1.Packet.TLS
+	16, // 14: pcap.v1.Packet.dns:type_name -> pcap.v1.Packet.DNS
+	0,  // 15: pcap.v1.Packet.version:type_name -> pcap.v1.Packet.Version
+	20, // 16: pcap.v1.Packet.errors:type_name -> pcap.v1.Packet.Error
+	17, // 17: pcap.v1.Packet.dhcp:type_name -> pcap.v1.Packet.DHCP
+	21, // 18: pcap.v1.Packet.labels:type_name -> pcap.v1.Packet.LabelsEntry
+	18, // 19: pcap.v1.Packet.sip:type_name -> pcap.v1.Packet.SIP
+	19, // 20: pcap.v1.Packet.ntp:type_name -> pcap.v1.Packet.NTP
+	7,  // 21: pcap.v1.Packet.IPv4.protocol:type_name -> pcap.v1.Packet.Protocol
+	7,  // 22: pcap.v1.Packet.IPv6.protocol:type_name -> pcap.v1.Packet.Protocol
+	22, // 23: pcap.v1.Packet.ARP.source:type_name -> pcap.v1.Packet.ARP.Endpoint
+	22, // 24: pcap.v1.Packet.ARP.target:type_name -> pcap.v1.Packet.ARP.Endpoint
+	9,  // 25: pcap.v1.Packet.ICMP.ipv6:type_name -> pcap.v1.Packet.IPv6
+	23, // 26: pcap.v1.Packet.TCP.flags:type_name -> pcap.v1.Packet.TCP.Flags
+	24, // 27: pcap.v1.Packet.SCTP.chunks:type_name -> pcap.v1.Packet.SCTP.Chunk
+	25, // 28: pcap.v1.Packet.TLS.records:type_name -> pcap.v1.Packet.TLS.Record
+	26, // 29: pcap.v1.Packet.DNS.questions:type_name -> pcap.v1.Packet.DNS.Question
+	27, // 30: pcap.v1.Packet.DNS.answers:type_name -> pcap.v1.Packet.DNS.Answer
+	28, // 31: pcap.v1.Packet.DHCP.options:type_name -> pcap.v1.Packet.DHCP.Option
+	29, // 32: pcap.v1.Packet.NTP.origin:type_name -> google.protobuf.Timestamp
+	29, // 33: pcap.v1.Packet.NTP.receive:type_name -> google.protobuf.Timestamp
+	29, // 34: pcap.v1.Packet.NTP.transmit:type_name -> google.protobuf.Timestamp
+	35, // [35:35] is the sub-list for method output_type
+	35, // [35:35] is the sub-list for method input_type
+	35, // [35:35] is the sub-list for extension type_name
+	35, // [35:35] is the sub-list for extension extendee
+	0,  // [0:35] is the sub-list for field type_name
+}
+
+func init() { file_packet_proto_init() }
+func file_packet_proto_init() {
+	if File_packet_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_packet_proto_msgTypes[0].Exporter = func(v any, i int) any {
 			switch v := v.(*Packet); i {
 			case 0:
 				return &v.state
@@ -701,7 +2871,7 @@ func file_packet_proto_init() {
 				return nil
 			}
 		}
-		file_packet_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+		file_packet_proto_msgTypes[1].Exporter = func(v any, i int) any {
 			switch v := v.(*Packet_Pcap); i {
 			case 0:
 				return &v.state
@@ -713,7 +2883,7 @@ func file_packet_proto_init() {
 				return nil
 			}
 		}
-		file_packet_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+		file_packet_proto_msgTypes[2].Exporter = func(v any, i int) any {
 			switch v := v.(*Packet_Metadata); i {
 			case 0:
 				return &v.state
@@ -725,7 +2895,7 @@ func file_packet_proto_init() {
 				return nil
 			}
 		}
-		file_packet_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+		file_packet_proto_msgTypes[3].Exporter = func(v any, i int) any {
 			switch v := v.(*Packet_Interface); i {
 			case 0:
 				return &v.state
@@ -737,7 +2907,7 @@ func file_packet_proto_init() {
 				return nil
 			}
 		}
-		file_packet_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+		file_packet_proto_msgTypes[4].Exporter = func(v any, i int) any {
 			switch v := v.(*Packet_Layer2); i {
 			case 0:
 				return &v.state
@@ -749,7 +2919,7 @@ func file_packet_proto_init() {
 				return nil
 			}
 		}
-		file_packet_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+		file_packet_proto_msgTypes[5].Exporter = func(v any, i int) any {
 			switch v := v.(*Packet_Layer3); i {
 			case 0:
 				return &v.state
@@ -761,7 +2931,19 @@ func file_packet_proto_init() {
 				return nil
 			}
 		}
-		file_packet_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+		file_packet_proto_msgTypes[6].Exporter = func(v any, i int) any {
+			switch v := v.(*Packet_Protocol); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_packet_proto_msgTypes[7].Exporter = func(v any, i int) any {
 			switch v := v.(*Packet_IPv4); i {
 			case 0:
 				return &v.state
@@ -773,7 +2955,7 @@ func file_packet_proto_init() {
 				return nil
 			}
 		}
-		file_packet_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+		file_packet_proto_msgTypes[8].Exporter = func(v any, i int) any {
 			switch v := v.(*Packet_IPv6); i {
 			case 0:
 				return &v.state
@@ -785,24 +2967,246 @@ func file_packet_proto_init() {
 				return nil
 			}
 		}
+		file_packet_proto_msgTypes[9].Exporter = func(v any, i int) any {
+			switch v := v.(*Packet_ARP); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_packet_proto_msgTypes[10].Exporter = func(v any, i int) any {
+			switch v := v.(*Packet_ICMP); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_packet_proto_msgTypes[11].Exporter = func(v any, i int) any {
+			switch v := v.(*Packet_UDP); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_packet_proto_msgTypes[12].Exporter = func(v any, i int) any {
+			switch v := v.(*Packet_TCP); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_packet_proto_msgTypes[13].Exporter = func(v any, i int) any {
+			switch v := v.(*Packet_SCTP); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_packet_proto_msgTypes[14].Exporter = func(v any, i int) any {
+			switch v := v.(*Packet_TLS); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_packet_proto_msgTypes[15].Exporter = func(v any, i int) any {
+			switch v := v.(*Packet_DNS); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_packet_proto_msgTypes[16].Exporter = func(v any, i int) any {
+			switch v := v.(*Packet_DHCP); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_packet_proto_msgTypes[17].Exporter = func(v any, i int) any {
+			switch v := v.(*Packet_SIP); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_packet_proto_msgTypes[18].Exporter = func(v any, i int) any {
+			switch v := v.(*Packet_NTP); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_packet_proto_msgTypes[19].Exporter = func(v any, i int) any {
+			switch v := v.(*Packet_Error); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_packet_proto_msgTypes[21].Exporter = func(v any, i int) any {
+			switch v := v.(*Packet_ARP_Endpoint); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_packet_proto_msgTypes[22].Exporter = func(v any, i int) any {
+			switch v := v.(*Packet_TCP_Flags); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_packet_proto_msgTypes[23].Exporter = func(v any, i int) any {
+			switch v := v.(*Packet_SCTP_Chunk); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_packet_proto_msgTypes[24].Exporter = func(v any, i int) any {
+			switch v := v.(*Packet_TLS_Record); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_packet_proto_msgTypes[25].Exporter = func(v any, i int) any {
+			switch v := v.(*Packet_DNS_Question); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_packet_proto_msgTypes[26].Exporter = func(v any, i int) any {
+			switch v := v.(*Packet_DNS_Answer); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_packet_proto_msgTypes[27].Exporter = func(v any, i int) any {
+			switch v := v.(*Packet_DHCP_Option); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
 	}
-	file_packet_proto_msgTypes[0].OneofWrappers = []interface{}{
+	file_packet_proto_msgTypes[0].OneofWrappers = []any{
 		(*Packet_Ip)(nil),
 		(*Packet_Ip4)(nil),
 		(*Packet_Ip6)(nil),
+		(*Packet_Arp)(nil),
+		(*Packet_Udp)(nil),
+		(*Packet_Tcp)(nil),
+		(*Packet_Icmp)(nil),
+		(*Packet_Sctp)(nil),
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_packet_proto_rawDesc,
-			NumEnums:      0,
-			NumMessages:   8,
+			NumEnums:      1,
+			NumMessages:   28,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
 		GoTypes:           file_packet_proto_goTypes,
 		DependencyIndexes: file_packet_proto_depIdxs,
+		EnumInfos:         file_packet_proto_enumTypes,
 		MessageInfos:      file_packet_proto_msgTypes,
 	}.Build()
 	File_packet_proto = out.File
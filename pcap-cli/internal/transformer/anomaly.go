@@ -0,0 +1,219 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type (
+	anomalyMetric string
+
+	// ewma is an exponentially weighted moving average and variance
+	ewma struct {
+		mean, variance float64
+		samples        uint64
+		// minimum standard deviation: prevents flat baselines from producing huge scores
+		floor float64
+	}
+
+	// anomalyWindow counts events within a fixed time window
+	anomalyWindow struct {
+		start           time.Time
+		connections     uint64
+		segments        uint64
+		retransmissions uint64
+	}
+
+	// anomalyBaseline contains the baselines of a single destination
+	anomalyBaseline struct {
+		latency     *ewma
+		connections *ewma
+		loss        *ewma
+		window      *anomalyWindow
+	}
+
+	anomaly struct {
+		metric   anomalyMetric
+		value    float64
+		baseline float64
+		score    float64
+	}
+
+	// anomalyDetector maintains EWMA baselines per destination:
+	//   - `latency`: HTTP response latency in milliseconds,
+	//   - `connections`: connection attempts ( `SYN` ) per window,
+	//   - `loss`: ratio of retransmitted data segments per window.
+	//
+	// values are scored as the number of standard deviations away from their baseline.
+	anomalyDetector struct {
+		mu        *sync.Mutex
+		baselines map[string]*anomalyBaseline
+	}
+)
+
+const (
+	anomalyMetricLatency     = anomalyMetric("latency")
+	anomalyMetricConnections = anomalyMetric("connections")
+	anomalyMetricLoss        = anomalyMetric("loss")
+
+	anomalyAlpha = 0.1
+	// baselines are not reliable until enough samples are available
+	anomalyWarmUpSamples = 10
+	anomalyThreshold     = 3.0
+	anomalyWindowSize    = 10 * time.Second
+	// loss ratios of windows with less segments are too noisy to be scored
+	anomalyMinSegments = 10
+	// destinations beyond this limit are not tracked to bound memory usage
+	anomalyMaxDestinations = 4096
+)
+
+func newEWMA(floor float64) *ewma {
+	return &ewma{floor: floor}
+}
+
+// score returns how many standard deviations `value` is away from the baseline, or `0` during warm up.
+func (e *ewma) score(value float64) float64 {
+	if e.samples < anomalyWarmUpSamples {
+		return 0
+	}
+	return (value - e.mean) / math.Max(math.Sqrt(e.variance), e.floor)
+}
+
+func (e *ewma) update(value float64) {
+	e.samples += 1
+	if e.samples == 1 {
+		e.mean = value
+		return
+	}
+	diff := value - e.mean
+	increment := anomalyAlpha * diff
+	e.mean += increment
+	e.variance = (1 - anomalyAlpha) * (e.variance + diff*increment)
+}
+
+func newAnomaly(metric anomalyMetric, value float64, baseline *ewma) *anomaly {
+	score := baseline.score(value)
+	if math.Abs(score) < anomalyThreshold {
+		return nil
+	}
+	return &anomaly{
+		metric:   metric,
+		value:    value,
+		baseline: baseline.mean,
+		score:    score,
+	}
+}
+
+func anomalyDestination(ip net.IP, port uint16) string {
+	return net.JoinHostPort(ip.String(), strconv.FormatUint(uint64(port), 10))
+}
+
+func newAnomalyDetector() *anomalyDetector {
+	return &anomalyDetector{
+		mu:        new(sync.Mutex),
+		baselines: make(map[string]*anomalyBaseline),
+	}
+}
+
+// baseline must be called while holding `d.mu`; it returns `nil` if `destination` cannot be tracked.
+func (d *anomalyDetector) baseline(destination string, timestamp time.Time) *anomalyBaseline {
+	baseline, ok := d.baselines[destination]
+	if !ok {
+		if len(d.baselines) >= anomalyMaxDestinations {
+			return nil
+		}
+		baseline = &anomalyBaseline{
+			latency:     newEWMA(1 /* millisecond */),
+			connections: newEWMA(1 /* connection */),
+			loss:        newEWMA(0.01 /* 1% */),
+			window:      &anomalyWindow{start: timestamp},
+		}
+		d.baselines[destination] = baseline
+	}
+
+	// windows are driven by packets timestamps: only windows with activity update baselines
+	if window := baseline.window; timestamp.Sub(window.start) >= anomalyWindowSize {
+		baseline.connections.update(float64(window.connections))
+		if window.segments >= anomalyMinSegments {
+			baseline.loss.update(float64(window.retransmissions) / float64(window.segments))
+		}
+		baseline.window = &anomalyWindow{start: timestamp}
+	}
+
+	return baseline
+}
+
+func (d *anomalyDetector) observeLatency(destination string, timestamp time.Time, latency time.Duration) *anomaly {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	baseline := d.baseline(destination, timestamp)
+	if baseline == nil {
+		return nil
+	}
+
+	value := float64(latency.Milliseconds())
+	anomaly := newAnomaly(anomalyMetricLatency, value, baseline.latency)
+	baseline.latency.update(value)
+	return anomaly
+}
+
+func (d *anomalyDetector) observeConnection(destination string, timestamp time.Time) *anomaly {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	baseline := d.baseline(destination, timestamp)
+	if baseline == nil {
+		return nil
+	}
+
+	baseline.window.connections += 1
+	// only connection rates higher than usual are anomalous while the window is still open
+	if anomaly := newAnomaly(anomalyMetricConnections,
+		float64(baseline.window.connections), baseline.connections); anomaly != nil && anomaly.score > 0 {
+		return anomaly
+	}
+	return nil
+}
+
+func (d *anomalyDetector) observeSegment(destination string, timestamp time.Time, isRetransmission bool) *anomaly {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	baseline := d.baseline(destination, timestamp)
+	if baseline == nil {
+		return nil
+	}
+
+	window := baseline.window
+	window.segments += 1
+	if isRetransmission {
+		window.retransmissions += 1
+	}
+
+	if window.segments < anomalyMinSegments {
+		return nil
+	}
+	if anomaly := newAnomaly(anomalyMetricLoss,
+		float64(window.retransmissions)/float64(window.segments), baseline.loss); anomaly != nil && anomaly.score > 0 {
+		return anomaly
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestAnomalyDetector verifies that values are only scored once baselines are warm, and only when they deviate strongly.
+func TestAnomalyDetector(t *testing.T) {
+	t.Parallel()
+
+	detector := newAnomalyDetector()
+	destination := anomalyDestination(net.IPv4(10, 0, 0, 2), 443)
+	assert.Equal(t, "10.0.0.2:443", destination)
+
+	ts := time.Unix(1700000000, 0)
+	at := func(seconds int) time.Time {
+		return ts.Add(time.Duration(seconds) * time.Second)
+	}
+
+	t.Run("latency", func(t *testing.T) {
+		// outliers are not scored during warm up, and eventually fade away from the baseline
+		assert.Nil(t, detector.observeLatency(destination, at(0), time.Second))
+		for i := 1; i < 10*anomalyWarmUpSamples; i++ {
+			latency := time.Duration(100+(i%3)) * time.Millisecond
+			assert.Nil(t, detector.observeLatency(destination, at(0), latency))
+		}
+
+		anomaly := detector.observeLatency(destination, at(0), time.Second)
+		assert.NotNil(t, anomaly)
+		assert.Equal(t, anomalyMetricLatency, anomaly.metric)
+		assert.Equal(t, float64(1000), anomaly.value)
+		assert.Greater(t, anomaly.score, anomalyThreshold)
+		assert.Less(t, anomaly.baseline, anomaly.value)
+	})
+
+	t.Run("connections", func(t *testing.T) {
+		destination := anomalyDestination(net.IPv4(10, 0, 0, 3), 80)
+
+		// 2 connections per window
+		seconds := 0
+		for window := 0; window <= anomalyWarmUpSamples; window++ {
+			seconds = window * int(anomalyWindowSize/time.Second)
+			assert.Nil(t, detector.observeConnection(destination, at(seconds)))
+			assert.Nil(t, detector.observeConnection(destination, at(seconds+1)))
+		}
+
+		var anomaly *anomaly
+		for i := 0; i < 10 && anomaly == nil; i++ {
+			anomaly = detector.observeConnection(destination, at(seconds+2))
+		}
+		assert.NotNil(t, anomaly)
+		assert.Equal(t, anomalyMetricConnections, anomaly.metric)
+		assert.InDelta(t, 2, anomaly.baseline, 0.01)
+	})
+
+	t.Run("loss", func(t *testing.T) {
+		destination := anomalyDestination(net.IPv4(10, 0, 0, 4), 8080)
+
+		// windows without retransmissions
+		seconds := 0
+		for window := 0; window <= anomalyWarmUpSamples; window++ {
+			seconds = window * int(anomalyWindowSize/time.Second)
+			for i := 0; i < anomalyMinSegments; i++ {
+				assert.Nil(t, detector.observeSegment(destination, at(seconds), false))
+			}
+		}
+
+		var anomaly *anomaly
+		for i := 0; i < anomalyMinSegments; i++ {
+			anomaly = detector.observeSegment(destination, at(seconds+1), true)
+		}
+		assert.NotNil(t, anomaly)
+		assert.Equal(t, anomalyMetricLoss, anomaly.metric)
+		assert.Equal(t, float64(0), anomaly.baseline)
+		assert.Equal(t, 0.5, anomaly.value)
+	})
+}
@@ -0,0 +1,501 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Jeffail/gabs/v2"
+)
+
+type (
+	brokerProtocol string
+
+	// brokerFrame summarizes an AMQP 0-9-1 frame or a Kafka request/response; message payloads are never stored.
+	brokerFrame struct {
+		// AMQP: `protocol`, `method`, `header`, `body` or `heartbeat`
+		kind    string
+		channel uint16
+		method  string
+		// `basic.publish`, `basic.deliver` and `basic.return` targets, declared/bound queues and exchanges
+		exchange   string
+		routingKey string
+		queue      string
+		// `connection.close`, `channel.close` and `basic.return` reply codes
+		code uint16
+		// Kafka: API name, key and version, and correlation ID
+		api           string
+		apiKey        *int16
+		version       int16
+		correlationID *int32
+		clientID      string
+		// only available for Kafka responses whose request was observed
+		latency *time.Duration
+		size    int
+	}
+
+	kafkaRequest struct {
+		api       string
+		apiKey    int16
+		version   int16
+		timestamp time.Time
+	}
+
+	// brokerFlow skips the continuation of frames larger than a segment, and pairs Kafka responses with requests.
+	brokerFlow struct {
+		// bytes of the frame in progress, per direction: client ( `0` ) and server ( `1` )
+		remaining [2]int
+		pending   map[int32]*kafkaRequest
+	}
+
+	// brokerPorts identifies message broker flows by the server port; i/e: `amqp:5672`, `kafka:9092`.
+	brokerPorts struct {
+		ports map[uint16]brokerProtocol
+	}
+)
+
+const (
+	brokerProtocolAMQP  brokerProtocol = "amqp"
+	brokerProtocolKafka brokerProtocol = "kafka"
+
+	// frames beyond this limit are not reported for a single TCP segment
+	brokerFramesLimit = 16
+	// Kafka requests beyond this limit are not paired with their responses
+	brokerFlowPendingLimit = 128
+	// exchanges, routing keys, queues and client IDs longer than this limit are truncated
+	brokerNameLimit = 128
+
+	// see: https://www.rabbitmq.com/resources/specs/amqp0-9-1.pdf ( section 4.2.3 )
+	amqpFrameHeaderLen = 7
+	amqpFrameEnd       = 0xce
+	amqpMaxFrameSize   = 128 << 20
+
+	// see: https://kafka.apache.org/protocol#protocol_messages
+	kafkaRequestHeaderLen  = 12
+	kafkaResponseHeaderLen = 8
+	kafkaMaxMessageSize    = 128 << 20
+	kafkaMaxAPIVersion     = 32
+)
+
+var (
+	amqpProtocolHeader = []byte("AMQP")
+
+	amqpFrameTypes = map[byte]string{
+		1: "method", 2: "header", 3: "body", 8: "heartbeat",
+	}
+
+	amqpClasses = map[uint16]string{
+		10: "connection", 20: "channel", 40: "exchange", 50: "queue",
+		60: "basic", 85: "confirm", 90: "tx",
+	}
+
+	// methods are keyed by `{class-id} << 16 | {method-id}`
+	amqpMethods = map[uint32]string{
+		10<<16 | 10: "start", 10<<16 | 11: "start-ok", 10<<16 | 20: "secure", 10<<16 | 21: "secure-ok",
+		10<<16 | 30: "tune", 10<<16 | 31: "tune-ok", 10<<16 | 40: "open", 10<<16 | 41: "open-ok",
+		10<<16 | 50: "close", 10<<16 | 51: "close-ok", 10<<16 | 60: "blocked", 10<<16 | 61: "unblocked",
+		20<<16 | 10: "open", 20<<16 | 11: "open-ok", 20<<16 | 20: "flow", 20<<16 | 21: "flow-ok",
+		20<<16 | 40: "close", 20<<16 | 41: "close-ok",
+		40<<16 | 10: "declare", 40<<16 | 11: "declare-ok", 40<<16 | 20: "delete", 40<<16 | 21: "delete-ok",
+		40<<16 | 30: "bind", 40<<16 | 31: "bind-ok", 40<<16 | 40: "unbind", 40<<16 | 51: "unbind-ok",
+		50<<16 | 10: "declare", 50<<16 | 11: "declare-ok", 50<<16 | 20: "bind", 50<<16 | 21: "bind-ok",
+		50<<16 | 30: "purge", 50<<16 | 31: "purge-ok", 50<<16 | 40: "delete", 50<<16 | 41: "delete-ok",
+		50<<16 | 50: "unbind", 50<<16 | 51: "unbind-ok",
+		60<<16 | 10: "qos", 60<<16 | 11: "qos-ok", 60<<16 | 20: "consume", 60<<16 | 21: "consume-ok",
+		60<<16 | 30: "cancel", 60<<16 | 31: "cancel-ok", 60<<16 | 40: "publish", 60<<16 | 50: "return",
+		60<<16 | 60: "deliver", 60<<16 | 70: "get", 60<<16 | 71: "get-ok", 60<<16 | 72: "get-empty",
+		60<<16 | 80: "ack", 60<<16 | 90: "reject", 60<<16 | 100: "recover-async", 60<<16 | 110: "recover",
+		60<<16 | 111: "recover-ok", 60<<16 | 120: "nack",
+		85<<16 | 10: "select", 85<<16 | 11: "select-ok",
+		90<<16 | 10: "select", 90<<16 | 11: "select-ok", 90<<16 | 20: "commit", 90<<16 | 21: "commit-ok",
+		90<<16 | 30: "rollback", 90<<16 | 31: "rollback-ok",
+	}
+
+	// see: https://kafka.apache.org/protocol#protocol_api_keys
+	kafkaAPIs = map[int16]string{
+		0: "Produce", 1: "Fetch", 2: "ListOffsets", 3: "Metadata", 4: "LeaderAndIsr", 5: "StopReplica",
+		6: "UpdateMetadata", 7: "ControlledShutdown", 8: "OffsetCommit", 9: "OffsetFetch",
+		10: "FindCoordinator", 11: "JoinGroup", 12: "Heartbeat", 13: "LeaveGroup", 14: "SyncGroup",
+		15: "DescribeGroups", 16: "ListGroups", 17: "SaslHandshake", 18: "ApiVersions", 19: "CreateTopics",
+		20: "DeleteTopics", 21: "DeleteRecords", 22: "InitProducerId", 23: "OffsetForLeaderEpoch",
+		24: "AddPartitionsToTxn", 25: "AddOffsetsToTxn", 26: "EndTxn", 27: "WriteTxnMarkers",
+		28: "TxnOffsetCommit", 29: "DescribeAcls", 30: "CreateAcls", 31: "DeleteAcls", 32: "DescribeConfigs",
+		33: "AlterConfigs", 34: "AlterReplicaLogDirs", 35: "DescribeLogDirs", 36: "SaslAuthenticate",
+		37: "CreatePartitions", 38: "CreateDelegationToken", 39: "RenewDelegationToken",
+		40: "ExpireDelegationToken", 41: "DescribeDelegationToken", 42: "DeleteGroups", 43: "ElectLeaders",
+		44: "IncrementalAlterConfigs", 45: "AlterPartitionReassignments", 46: "ListPartitionReassignments",
+		47: "OffsetDelete", 48: "DescribeClientQuotas", 49: "AlterClientQuotas",
+		50: "DescribeUserScramCredentials", 51: "AlterUserScramCredentials", 55: "DescribeQuorum",
+		57: "UpdateFeatures", 60: "DescribeCluster", 61: "DescribeProducers", 64: "UnregisterBroker",
+		65: "DescribeTransactions", 66: "ListTransactions", 67: "AllocateProducerIds",
+		68: "ConsumerGroupHeartbeat", 69: "ConsumerGroupDescribe", 71: "GetTelemetrySubscriptions",
+		72: "PushTelemetry", 74: "ListClientMetricsResources", 75: "DescribeTopicPartitions",
+	}
+)
+
+// newBrokerPorts returns `nil` if no broker ports are configured; entries are `{protocol}:{port}`.
+func newBrokerPorts(entries []string) *brokerPorts {
+	ports := make(map[uint16]brokerProtocol, len(entries))
+	for _, entry := range entries {
+		rawProtocol, rawPort, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok {
+			continue
+		}
+		port, err := strconv.ParseUint(rawPort, 10, 16)
+		if err != nil {
+			continue
+		}
+		switch protocol := brokerProtocol(strings.ToLower(rawProtocol)); protocol {
+		case brokerProtocolAMQP, brokerProtocolKafka:
+			ports[uint16(port)] = protocol
+		}
+	}
+	if len(ports) == 0 {
+		return nil
+	}
+	return &brokerPorts{ports: ports}
+}
+
+// lookup returns whether the segment was sent by the client: segments sent to the server port are.
+func (b *brokerPorts) lookup(srcPort, dstPort uint16) (brokerProtocol, bool, bool) {
+	if protocol, ok := b.ports[dstPort]; ok {
+		return protocol, true, true
+	}
+	if protocol, ok := b.ports[srcPort]; ok {
+		return protocol, false, true
+	}
+	return "", false, false
+}
+
+func brokerName(name []byte) string {
+	if len(name) > brokerNameLimit {
+		return string(name[:brokerNameLimit-3]) + "..."
+	}
+	return string(name)
+}
+
+func newBrokerFlow() *brokerFlow {
+	return &brokerFlow{pending: make(map[int32]*kafkaRequest)}
+}
+
+func brokerDirection(fromClient bool) int {
+	if fromClient {
+		return 0
+	}
+	return 1
+}
+
+// skip drops the continuation of the frame in progress; it returns `nil` if the segment only carries the continuation.
+func (f *brokerFlow) skip(data []byte, fromClient bool) []byte {
+	direction := brokerDirection(fromClient)
+	remaining := f.remaining[direction]
+	if remaining >= len(data) {
+		f.remaining[direction] = remaining - len(data)
+		return nil
+	}
+	f.remaining[direction] = 0
+	return data[remaining:]
+}
+
+// frames returns the frames carried by a segment; frames are only decoded if their header is valid.
+func (f *brokerFlow) frames(protocol brokerProtocol, data []byte, fromClient bool, timestamp time.Time) []*brokerFrame {
+	if data = f.skip(data, fromClient); len(data) == 0 {
+		return nil
+	}
+	if protocol == brokerProtocolAMQP {
+		return f.amqpFrames(data, fromClient)
+	}
+	return f.kafkaFrames(data, fromClient, timestamp)
+}
+
+// amqpShortString returns the short string at the beginning of data, and the remaining data.
+func amqpShortString(data []byte) ([]byte, []byte, bool) {
+	if len(data) < 1 || len(data) < 1+int(data[0]) {
+		return nil, nil, false
+	}
+	size := 1 + int(data[0])
+	return data[1:size], data[size:], true
+}
+
+// amqpArguments extracts targets and reply codes out of method arguments; arguments may be incomplete.
+func (frame *brokerFrame) amqpArguments(classID, methodID uint16, args []byte) {
+	var name []byte
+	var ok bool
+
+	switch uint32(classID)<<16 | uint32(methodID) {
+	case 10<<16 | 50, 20<<16 | 40:
+		// `connection.close` and `channel.close`: reply-code, reply-text, class-id, method-id
+		if len(args) >= 2 {
+			frame.code = binary.BigEndian.Uint16(args[:2])
+		}
+	case 40<<16 | 10, 40<<16 | 20:
+		// `exchange.declare` and `exchange.delete`: reserved, exchange
+		if len(args) >= 2 {
+			if name, _, ok = amqpShortString(args[2:]); ok {
+				frame.exchange = brokerName(name)
+			}
+		}
+	case 50<<16 | 10, 50<<16 | 30, 50<<16 | 40, 60<<16 | 20, 60<<16 | 70:
+		// `queue.declare`, `queue.purge`, `queue.delete`, `basic.consume` and `basic.get`: reserved, queue
+		if len(args) >= 2 {
+			if name, _, ok = amqpShortString(args[2:]); ok {
+				frame.queue = brokerName(name)
+			}
+		}
+	case 50<<16 | 11:
+		// `queue.declare-ok`: queue
+		if name, _, ok = amqpShortString(args); ok {
+			frame.queue = brokerName(name)
+		}
+	case 50<<16 | 20, 50<<16 | 50:
+		// `queue.bind` and `queue.unbind`: reserved, queue, exchange, routing-key
+		if len(args) >= 2 {
+			frame.queue, frame.exchange, frame.routingKey = amqpNames(args[2:], 3)
+		}
+	case 60<<16 | 40:
+		// `basic.publish`: reserved, exchange, routing-key
+		if len(args) >= 2 {
+			_, frame.exchange, frame.routingKey = amqpNames(args[2:], 2)
+		}
+	case 60<<16 | 50:
+		// `basic.return`: reply-code, reply-text, exchange, routing-key
+		if len(args) >= 2 {
+			frame.code = binary.BigEndian.Uint16(args[:2])
+			if _, args, ok = amqpShortString(args[2:]); ok {
+				_, frame.exchange, frame.routingKey = amqpNames(args, 2)
+			}
+		}
+	case 60<<16 | 60:
+		// `basic.deliver`: consumer-tag, delivery-tag, redelivered, exchange, routing-key
+		if _, args, ok = amqpShortString(args); ok && len(args) >= 9 {
+			_, frame.exchange, frame.routingKey = amqpNames(args[9:], 2)
+		}
+	case 60<<16 | 71:
+		// `basic.get-ok`: delivery-tag, redelivered, exchange, routing-key
+		if len(args) >= 9 {
+			_, frame.exchange, frame.routingKey = amqpNames(args[9:], 2)
+		}
+	}
+}
+
+// amqpNames returns up to 3 consecutive short strings as queue, exchange and routing key;
+// if `count` is 2, the 1st short string is the exchange.
+func amqpNames(data []byte, count int) (string, string, string) {
+	names := make([]string, 3)
+	for i := 3 - count; i < 3; i++ {
+		name, rest, ok := amqpShortString(data)
+		if !ok {
+			break
+		}
+		names[i], data = brokerName(name), rest
+	}
+	return names[0], names[1], names[2]
+}
+
+func (f *brokerFlow) amqpFrames(data []byte, fromClient bool) []*brokerFrame {
+	// clients start connections by sending the protocol header; i/e: `AMQP\x00\x00\x09\x01`
+	if fromClient && bytes.HasPrefix(data, amqpProtocolHeader) && len(data) >= 8 {
+		version := strconv.Itoa(int(data[5])) + "-" + strconv.Itoa(int(data[6])) + "-" + strconv.Itoa(int(data[7]))
+		return []*brokerFrame{{kind: "protocol", method: version, size: 8}}
+	}
+
+	frames := make([]*brokerFrame, 0, 1)
+	for len(data) >= amqpFrameHeaderLen && len(frames) < brokerFramesLimit {
+		kind, ok := amqpFrameTypes[data[0]]
+		size := int(binary.BigEndian.Uint32(data[3:7]))
+		if !ok || size > amqpMaxFrameSize {
+			break
+		}
+		end := amqpFrameHeaderLen + size
+		if end < len(data) && data[end] != amqpFrameEnd {
+			break
+		}
+
+		frame := &brokerFrame{kind: kind, channel: binary.BigEndian.Uint16(data[1:3]), size: size}
+		payload := data[amqpFrameHeaderLen:min(end, len(data))]
+		if data[0] == 1 && len(payload) >= 4 {
+			classID := binary.BigEndian.Uint16(payload[:2])
+			methodID := binary.BigEndian.Uint16(payload[2:4])
+			class, ok := amqpClasses[classID]
+			if !ok {
+				class = strconv.Itoa(int(classID))
+			}
+			method, ok := amqpMethods[uint32(classID)<<16|uint32(methodID)]
+			if !ok {
+				method = strconv.Itoa(int(methodID))
+			}
+			frame.method = class + "." + method
+			frame.amqpArguments(classID, methodID, payload[4:])
+		}
+		frames = append(frames, frame)
+
+		if end+1 > len(data) {
+			// the frame continues in the following segments
+			f.remaining[brokerDirection(fromClient)] = end + 1 - len(data)
+			break
+		}
+		data = data[end+1:]
+	}
+	return frames
+}
+
+func (f *brokerFlow) kafkaFrames(data []byte, fromClient bool, timestamp time.Time) []*brokerFrame {
+	frames := make([]*brokerFrame, 0, 1)
+	for len(frames) < brokerFramesLimit {
+		var frame *brokerFrame
+		if fromClient {
+			frame = f.kafkaRequest(data, timestamp)
+		} else {
+			frame = f.kafkaResponse(data, timestamp)
+		}
+		if frame == nil {
+			break
+		}
+		frames = append(frames, frame)
+
+		end := 4 + frame.size
+		if end > len(data) {
+			// the message continues in the following segments
+			f.remaining[brokerDirection(fromClient)] = end - len(data)
+			break
+		}
+		data = data[end:]
+	}
+	return frames
+}
+
+// kafkaRequest decodes the request header: size, API key and version, correlation ID and client ID.
+func (f *brokerFlow) kafkaRequest(data []byte, timestamp time.Time) *brokerFrame {
+	if len(data) < kafkaRequestHeaderLen {
+		return nil
+	}
+	size := int(binary.BigEndian.Uint32(data[:4]))
+	apiKey := int16(binary.BigEndian.Uint16(data[4:6]))
+	version := int16(binary.BigEndian.Uint16(data[6:8]))
+	api, ok := kafkaAPIs[apiKey]
+	if !ok || size < kafkaRequestHeaderLen-4 || size > kafkaMaxMessageSize ||
+		version < 0 || version > kafkaMaxAPIVersion {
+		return nil
+	}
+	correlationID := int32(binary.BigEndian.Uint32(data[8:12]))
+
+	frame := &brokerFrame{
+		api:           api,
+		apiKey:        &apiKey,
+		version:       version,
+		correlationID: &correlationID,
+		size:          size,
+	}
+	// client ID is a nullable string: `-1` is `null`
+	if len(data) >= kafkaRequestHeaderLen+2 {
+		length := int(int16(binary.BigEndian.Uint16(data[12:14])))
+		if start := kafkaRequestHeaderLen + 2; length > 0 && start+length <= len(data) {
+			frame.clientID = brokerName(data[start : start+length])
+		}
+	}
+
+	if len(f.pending) < brokerFlowPendingLimit {
+		f.pending[correlationID] = &kafkaRequest{api, apiKey, version, timestamp}
+	}
+	return frame
+}
+
+// kafkaResponse only decodes responses to observed requests: responses do not carry the API key.
+func (f *brokerFlow) kafkaResponse(data []byte, timestamp time.Time) *brokerFrame {
+	if len(data) < kafkaResponseHeaderLen {
+		return nil
+	}
+	size := int(binary.BigEndian.Uint32(data[:4]))
+	correlationID := int32(binary.BigEndian.Uint32(data[4:8]))
+	request, ok := f.pending[correlationID]
+	if !ok || size < kafkaResponseHeaderLen-4 || size > kafkaMaxMessageSize {
+		return nil
+	}
+	delete(f.pending, correlationID)
+
+	latency := timestamp.Sub(request.timestamp)
+	return &brokerFrame{
+		api:           request.api,
+		apiKey:        &request.apiKey,
+		version:       request.version,
+		correlationID: &correlationID,
+		latency:       &latency,
+		size:          size,
+	}
+}
+
+func (frame *brokerFrame) summary() string {
+	if frame.api != "" {
+		return frame.api + "/v" + strconv.Itoa(int(frame.version)) + "#" + strconv.Itoa(int(*frame.correlationID))
+	}
+	if frame.method == "" {
+		return frame.kind
+	}
+	if frame.kind == "protocol" {
+		return "AMQP/" + frame.method
+	}
+	summary := frame.method
+	if frame.exchange != "" || frame.routingKey != "" {
+		summary += ":" + frame.exchange + "/" + frame.routingKey
+	} else if frame.queue != "" {
+		summary += ":" + frame.queue
+	}
+	if frame.code != 0 {
+		summary += ":" + strconv.Itoa(int(frame.code))
+	}
+	return summary
+}
+
+func (frame *brokerFrame) toJSON() *gabs.Container {
+	frameJSON := gabs.New()
+	frameJSON.Set(frame.size, "size")
+	if frame.api != "" {
+		frameJSON.Set(frame.api, "api")
+		frameJSON.Set(*frame.apiKey, "api_key")
+		frameJSON.Set(frame.version, "version")
+		frameJSON.Set(*frame.correlationID, "correlation_id")
+		if frame.clientID != "" {
+			frameJSON.Set(frame.clientID, "client_id")
+		}
+		if frame.latency != nil {
+			frameJSON.Set(frame.latency.Milliseconds(), "latency")
+		}
+		return frameJSON
+	}
+	frameJSON.Set(frame.kind, "type")
+	if frame.kind != "protocol" {
+		frameJSON.Set(frame.channel, "channel")
+	}
+	if frame.method != "" {
+		frameJSON.Set(frame.method, "method")
+	}
+	if frame.exchange != "" {
+		frameJSON.Set(frame.exchange, "exchange")
+	}
+	if frame.routingKey != "" {
+		frameJSON.Set(frame.routingKey, "routing_key")
+	}
+	if frame.queue != "" {
+		frameJSON.Set(frame.queue, "queue")
+	}
+	if frame.code != 0 {
+		frameJSON.Set(frame.code, "code")
+	}
+	return frameJSON
+}
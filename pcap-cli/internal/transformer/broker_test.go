@@ -0,0 +1,182 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func amqpTestFrame(kind byte, channel uint16, payload []byte) []byte {
+	frame := []byte{kind, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint16(frame[1:3], channel)
+	binary.BigEndian.PutUint32(frame[3:7], uint32(len(payload)))
+	return append(append(frame, payload...), amqpFrameEnd)
+}
+
+func amqpTestMethod(classID, methodID uint16, args ...[]byte) []byte {
+	payload := binary.BigEndian.AppendUint16(nil, classID)
+	payload = binary.BigEndian.AppendUint16(payload, methodID)
+	for _, arg := range args {
+		payload = append(payload, arg...)
+	}
+	return payload
+}
+
+func amqpTestShortString(value string) []byte {
+	return append([]byte{byte(len(value))}, value...)
+}
+
+func kafkaTestRequest(apiKey, version int16, correlationID int32, clientID string, body int) []byte {
+	data := make([]byte, 4, 16+len(clientID)+body)
+	data = binary.BigEndian.AppendUint16(data, uint16(apiKey))
+	data = binary.BigEndian.AppendUint16(data, uint16(version))
+	data = binary.BigEndian.AppendUint32(data, uint32(correlationID))
+	data = binary.BigEndian.AppendUint16(data, uint16(len(clientID)))
+	data = append(data, clientID...)
+	data = append(data, make([]byte, body)...)
+	binary.BigEndian.PutUint32(data[:4], uint32(len(data)-4))
+	return data
+}
+
+// TestBrokerPorts verifies that invalid entries are ignored, and that clients send segments to the server port.
+func TestBrokerPorts(t *testing.T) {
+	t.Parallel()
+
+	assert.Nil(t, newBrokerPorts([]string{"", "redis:6379", "kafka", "kafka:port"}))
+
+	brokers := newBrokerPorts([]string{" AMQP:5672", "kafka:9092"})
+	assert.NotNil(t, brokers)
+
+	protocol, fromClient, ok := brokers.lookup(40000, 5672)
+	assert.True(t, ok)
+	assert.True(t, fromClient)
+	assert.Equal(t, brokerProtocolAMQP, protocol)
+
+	protocol, fromClient, ok = brokers.lookup(9092, 40000)
+	assert.True(t, ok)
+	assert.False(t, fromClient)
+	assert.Equal(t, brokerProtocolKafka, protocol)
+
+	_, _, ok = brokers.lookup(40000, 8080)
+	assert.False(t, ok)
+}
+
+// TestAMQPFrames verifies that methods are named, that publish targets are reported, and that bodies are not.
+func TestAMQPFrames(t *testing.T) {
+	t.Parallel()
+
+	flow := newBrokerFlow()
+	now := time.Now()
+
+	frames := flow.frames(brokerProtocolAMQP, []byte("AMQP\x00\x00\x09\x01"), true, now)
+	if assert.Len(t, frames, 1) {
+		assert.Equal(t, "AMQP/0-9-1", frames[0].summary())
+	}
+
+	frames = flow.frames(brokerProtocolAMQP, amqpTestFrame(1, 0, amqpTestMethod(10, 10, []byte{0, 9})), false, now)
+	if assert.Len(t, frames, 1) {
+		assert.Equal(t, "connection.start", frames[0].summary())
+	}
+
+	publish := amqpTestMethod(60, 40, []byte{0, 0}, amqpTestShortString("orders"), amqpTestShortString("eu.created"), []byte{0})
+	data := amqpTestFrame(1, 1, publish)
+	data = append(data, amqpTestFrame(2, 1, make([]byte, 14))...)
+	data = append(data, amqpTestFrame(3, 1, []byte("secret message payload"))...)
+	frames = flow.frames(brokerProtocolAMQP, data, true, now)
+	if assert.Len(t, frames, 3) {
+		assert.Equal(t, "basic.publish:orders/eu.created", frames[0].summary())
+		assert.Equal(t, "orders", frames[0].exchange)
+		assert.Equal(t, "eu.created", frames[0].routingKey)
+		assert.Equal(t, uint16(1), frames[0].channel)
+		assert.Equal(t, "header", frames[1].summary())
+		assert.Equal(t, "body", frames[2].summary())
+		assert.NotContains(t, frames[2].toJSON().String(), "secret")
+	}
+
+	closing := amqpTestMethod(20, 40, []byte{0x01, 0x94}, amqpTestShortString("NOT_FOUND - no exchange"), []byte{0, 60, 0, 40})
+	frames = flow.frames(brokerProtocolAMQP, amqpTestFrame(1, 1, closing), false, now)
+	if assert.Len(t, frames, 1) {
+		assert.Equal(t, "channel.close:404", frames[0].summary())
+		assert.NotContains(t, frames[0].toJSON().String(), "NOT_FOUND")
+	}
+
+	// segments starting in the middle of a frame are not decoded
+	assert.Empty(t, flow.frames(brokerProtocolAMQP, []byte("some payload that is not a frame"), true, now))
+}
+
+// TestAMQPFrameContinuation verifies that the continuation of a frame larger than a segment is skipped.
+func TestAMQPFrameContinuation(t *testing.T) {
+	t.Parallel()
+
+	flow := newBrokerFlow()
+	now := time.Now()
+
+	body := amqpTestFrame(3, 1, make([]byte, 100))
+	frames := flow.frames(brokerProtocolAMQP, body[:50], true, now)
+	if assert.Len(t, frames, 1) {
+		assert.Equal(t, 100, frames[0].size)
+	}
+	assert.Empty(t, flow.frames(brokerProtocolAMQP, body[50:80], true, now))
+
+	// the remaining bytes of the body are followed by a heartbeat
+	frames = flow.frames(brokerProtocolAMQP, append(body[80:], amqpTestFrame(8, 0, nil)...), true, now)
+	if assert.Len(t, frames, 1) {
+		assert.Equal(t, "heartbeat", frames[0].summary())
+	}
+}
+
+// TestKafkaFrames verifies that responses are paired with requests using correlation IDs.
+func TestKafkaFrames(t *testing.T) {
+	t.Parallel()
+
+	flow := newBrokerFlow()
+	now := time.Now()
+
+	data := append(kafkaTestRequest(18, 3, 1, "producer-1", 0), kafkaTestRequest(3, 12, 2, "producer-1", 8)...)
+	frames := flow.frames(brokerProtocolKafka, data, true, now)
+	if assert.Len(t, frames, 2) {
+		assert.Equal(t, "ApiVersions/v3#1", frames[0].summary())
+		assert.Equal(t, "producer-1", frames[0].clientID)
+		assert.Equal(t, "Metadata/v12#2", frames[1].summary())
+	}
+
+	// a produce request larger than the segment
+	produce := kafkaTestRequest(0, 9, 3, "producer-1", 1024)
+	frames = flow.frames(brokerProtocolKafka, produce[:512], true, now)
+	if assert.Len(t, frames, 1) {
+		assert.Equal(t, "Produce", frames[0].api)
+		assert.Equal(t, int16(0), *frames[0].apiKey)
+	}
+	assert.Empty(t, flow.frames(brokerProtocolKafka, produce[512:], true, now))
+
+	response := binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(nil, 12), 3)
+	response = append(response, make([]byte, 8)...)
+	frames = flow.frames(brokerProtocolKafka, response, false, now.Add(25*time.Millisecond))
+	if assert.Len(t, frames, 1) {
+		assert.Equal(t, "Produce/v9#3", frames[0].summary())
+		if assert.NotNil(t, frames[0].latency) {
+			assert.Equal(t, 25*time.Millisecond, *frames[0].latency)
+		}
+	}
+
+	// responses to unknown requests are not decoded
+	unknown := binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(nil, 4), 42)
+	assert.Empty(t, flow.frames(brokerProtocolKafka, unknown, false, now))
+	assert.Len(t, flow.pending, 2)
+}
@@ -0,0 +1,378 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Jeffail/gabs/v2"
+)
+
+type (
+	cacheProtocol string
+
+	// cacheOperation summarizes a command or a reply; values are never stored.
+	cacheOperation struct {
+		command string
+		key     string
+		reply   string
+		// only available for replies whose command was observed
+		latency *time.Duration
+	}
+
+	cacheCommand struct {
+		name      string
+		timestamp time.Time
+	}
+
+	// cacheFlow pairs replies with commands: both Redis and Memcached reply in the order in which commands were sent.
+	cacheFlow struct {
+		pending []*cacheCommand
+	}
+
+	// cachePorts identifies cache flows by the server port; i/e: `redis:6379`, `memcached:11211`.
+	cachePorts struct {
+		ports    map[uint16]cacheProtocol
+		hashKeys bool
+	}
+)
+
+const (
+	cacheProtocolRedis     cacheProtocol = "redis"
+	cacheProtocolMemcached cacheProtocol = "memcached"
+
+	// pipelined commands beyond this limit are not paired with their replies
+	cacheFlowPendingLimit = 128
+	// commands beyond this limit are not reported for a single TCP segment
+	cacheOperationsLimit = 16
+	// keys longer than this limit are truncated
+	cacheKeyLimit = 128
+
+	// see: https://github.com/memcached/memcached/blob/master/protocol_binary.h
+	memcachedBinaryRequest   = 0x80
+	memcachedBinaryResponse  = 0x81
+	memcachedBinaryHeaderLen = 24
+)
+
+var (
+	respSeparator = []byte("\r\n")
+
+	// see: https://redis.io/docs/latest/develop/reference/protocol-spec/#resp-protocol-description
+	respReplyTypes = map[byte]string{
+		'+': "string",
+		'-': "error",
+		':': "integer",
+		'$': "bulk",
+		'*': "array",
+		'_': "null",
+		'#': "boolean",
+		',': "double",
+		'(': "bignumber",
+		'!': "error",
+		'=': "verbatim",
+		'%': "map",
+		'~': "set",
+		'>': "push",
+	}
+
+	memcachedBinaryOpcodes = map[byte]string{
+		0x00: "get", 0x01: "set", 0x02: "add", 0x03: "replace", 0x04: "delete",
+		0x05: "incr", 0x06: "decr", 0x07: "quit", 0x08: "flush", 0x09: "getq",
+		0x0a: "noop", 0x0b: "version", 0x0c: "getk", 0x0d: "getkq", 0x0e: "append",
+		0x0f: "prepend", 0x10: "stat", 0x11: "setq", 0x12: "addq", 0x13: "replaceq",
+		0x14: "deleteq", 0x15: "incrq", 0x16: "decrq", 0x17: "quitq", 0x18: "flushq",
+		0x19: "appendq", 0x1a: "prependq", 0x1c: "touch", 0x1d: "gat", 0x1e: "gatq",
+	}
+
+	// see: https://github.com/memcached/memcached/blob/master/protocol_binary.h#L76-L98
+	memcachedBinaryStatuses = map[uint16]string{
+		0x00: "OK", 0x01: "NOT_FOUND", 0x02: "EXISTS", 0x03: "TOO_LARGE", 0x04: "INVALID",
+		0x05: "NOT_STORED", 0x06: "NON_NUMERIC", 0x81: "UNKNOWN_COMMAND", 0x82: "NO_MEMORY",
+	}
+)
+
+// newCachePorts returns `nil` if no cache ports are configured; entries are `{protocol}:{port}`.
+func newCachePorts(entries []string, hashKeys bool) *cachePorts {
+	ports := make(map[uint16]cacheProtocol, len(entries))
+	for _, entry := range entries {
+		rawProtocol, rawPort, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok {
+			continue
+		}
+		port, err := strconv.ParseUint(rawPort, 10, 16)
+		if err != nil {
+			continue
+		}
+		switch protocol := cacheProtocol(strings.ToLower(rawProtocol)); protocol {
+		case cacheProtocolRedis, cacheProtocolMemcached:
+			ports[uint16(port)] = protocol
+		}
+	}
+	if len(ports) == 0 {
+		return nil
+	}
+	return &cachePorts{ports: ports, hashKeys: hashKeys}
+}
+
+// lookup returns whether the segment carries commands: segments sent to the server port do.
+func (c *cachePorts) lookup(srcPort, dstPort uint16) (cacheProtocol, bool, bool) {
+	if protocol, ok := c.ports[dstPort]; ok {
+		return protocol, true, true
+	}
+	if protocol, ok := c.ports[srcPort]; ok {
+		return protocol, false, true
+	}
+	return "", false, false
+}
+
+func (c *cachePorts) key(key string) string {
+	if c.hashKeys {
+		return (&httpSessionHasher{key: httpSessionKey()}).hash(key)
+	}
+	if len(key) > cacheKeyLimit {
+		return key[:cacheKeyLimit-3] + "..."
+	}
+	return key
+}
+
+func newCacheFlow() *cacheFlow {
+	return &cacheFlow{pending: make([]*cacheCommand, 0, 4)}
+}
+
+func (f *cacheFlow) sent(command string, timestamp time.Time) {
+	if len(f.pending) >= cacheFlowPendingLimit {
+		return
+	}
+	f.pending = append(f.pending, &cacheCommand{command, timestamp})
+}
+
+func (f *cacheFlow) replied(operation *cacheOperation, timestamp time.Time) {
+	if len(f.pending) == 0 {
+		return
+	}
+	command := f.pending[0]
+	f.pending = f.pending[1:]
+	latency := timestamp.Sub(command.timestamp)
+	operation.command = command.name
+	operation.latency = &latency
+}
+
+// respValue returns the size of the RESP value at the beginning of data, or `-1` if it is incomplete.
+func respValue(data []byte, depth int) int {
+	end := bytes.Index(data, respSeparator)
+	if end < 1 || depth > 8 {
+		return -1
+	}
+	size := end + len(respSeparator)
+	switch data[0] {
+	case '$', '=', '!':
+		length, err := strconv.Atoi(string(data[1:end]))
+		if err != nil {
+			return -1
+		}
+		if length < 0 {
+			return size
+		}
+		if size += length + len(respSeparator); size > len(data) {
+			return -1
+		}
+		return size
+	case '*', '~', '>', '%', '|':
+		count, err := strconv.Atoi(string(data[1:end]))
+		if err != nil {
+			return -1
+		}
+		if data[0] == '%' || data[0] == '|' {
+			count *= 2
+		}
+		for i := 0; i < count; i++ {
+			itemSize := respValue(data[size:], depth+1)
+			if itemSize < 0 {
+				return -1
+			}
+			size += itemSize
+		}
+		return size
+	}
+	return size
+}
+
+// respBulkStrings returns the items of a RESP array of bulk strings; i/e: a command.
+func respBulkStrings(data []byte, limit int) []string {
+	end := bytes.Index(data, respSeparator)
+	if end < 1 || data[0] != '*' {
+		return nil
+	}
+	count, err := strconv.Atoi(string(data[1:end]))
+	if err != nil || count < 1 {
+		return nil
+	}
+	items := make([]string, 0, min(count, limit))
+	data = data[end+len(respSeparator):]
+	for i := 0; i < count && len(items) < limit; i++ {
+		end = bytes.Index(data, respSeparator)
+		if end < 1 || data[0] != '$' {
+			break
+		}
+		length, err := strconv.Atoi(string(data[1:end]))
+		if err != nil || length < 0 {
+			break
+		}
+		data = data[end+len(respSeparator):]
+		if length > len(data) {
+			// commands larger than the segment are only reported if the name and the key are available
+			items = append(items, string(data))
+			break
+		}
+		items = append(items, string(data[:length]))
+		if length+len(respSeparator) > len(data) {
+			break
+		}
+		data = data[length+len(respSeparator):]
+	}
+	return items
+}
+
+// redisOperations returns commands or replies carried by a segment; pipelined commands are all reported.
+func (c *cachePorts) redisOperations(data []byte, isCommand bool) []*cacheOperation {
+	operations := make([]*cacheOperation, 0, 1)
+	for len(data) > 0 && len(operations) < cacheOperationsLimit {
+		if !isCommand {
+			replyType, ok := respReplyTypes[data[0]]
+			if !ok {
+				break
+			}
+			if data[0] == '$' && bytes.HasPrefix(data, []byte("$-1\r\n")) ||
+				data[0] == '*' && bytes.HasPrefix(data, []byte("*-1\r\n")) {
+				replyType = "null"
+			}
+			operations = append(operations, &cacheOperation{reply: replyType})
+		} else if data[0] == '*' {
+			items := respBulkStrings(data, 2)
+			if len(items) == 0 {
+				break
+			}
+			operation := &cacheOperation{command: strings.ToUpper(items[0])}
+			if len(items) > 1 {
+				operation.key = c.key(items[1])
+			}
+			operations = append(operations, operation)
+		} else {
+			// inline commands; i/e: `PING`
+			line, _, _ := bytes.Cut(data, respSeparator)
+			fields := strings.Fields(string(line))
+			if len(fields) == 0 {
+				break
+			}
+			operation := &cacheOperation{command: strings.ToUpper(fields[0])}
+			if len(fields) > 1 {
+				operation.key = c.key(fields[1])
+			}
+			operations = append(operations, operation)
+		}
+		size := respValue(data, 0)
+		if data[0] != '*' && isCommand {
+			if end := bytes.Index(data, respSeparator); end >= 0 {
+				size = end + len(respSeparator)
+			}
+		}
+		if size <= 0 {
+			break
+		}
+		data = data[size:]
+	}
+	return operations
+}
+
+// memcachedOperations returns the 1st command or reply carried by a segment.
+func (c *cachePorts) memcachedOperations(data []byte, isCommand bool) []*cacheOperation {
+	if len(data) == 0 {
+		return nil
+	}
+
+	// binary protocol
+	if data[0] == memcachedBinaryRequest || data[0] == memcachedBinaryResponse {
+		if len(data) < memcachedBinaryHeaderLen {
+			return nil
+		}
+		opcode, ok := memcachedBinaryOpcodes[data[1]]
+		if !ok {
+			opcode = "0x" + strconv.FormatUint(uint64(data[1]), 16)
+		}
+		if data[0] == memcachedBinaryResponse {
+			status := binary.BigEndian.Uint16(data[6:8])
+			reply, ok := memcachedBinaryStatuses[status]
+			if !ok {
+				reply = strconv.FormatUint(uint64(status), 10)
+			}
+			return []*cacheOperation{{command: opcode, reply: reply}}
+		}
+		operation := &cacheOperation{command: opcode}
+		keyLength := int(binary.BigEndian.Uint16(data[2:4]))
+		extrasLength := int(data[4])
+		if start := memcachedBinaryHeaderLen + extrasLength; keyLength > 0 && start+keyLength <= len(data) {
+			operation.key = c.key(string(data[start : start+keyLength]))
+		}
+		return []*cacheOperation{operation}
+	}
+
+	// text and meta protocols
+	line, _, _ := bytes.Cut(data, respSeparator)
+	fields := strings.Fields(string(line))
+	if len(fields) == 0 {
+		return nil
+	}
+	if !isCommand {
+		// i/e: `VALUE`, `END`, `STORED`, `NOT_FOUND`; meta protocol: `HD`, `VA`, `EN`
+		reply := fields[0]
+		if _, err := strconv.ParseUint(reply, 10, 64); err == nil {
+			reply = "NUMBER" // `incr` and `decr`
+		}
+		return []*cacheOperation{{reply: reply}}
+	}
+	operation := &cacheOperation{command: strings.ToLower(fields[0])}
+	if len(fields) > 1 {
+		operation.key = c.key(fields[1])
+	}
+	return []*cacheOperation{operation}
+}
+
+func (o *cacheOperation) toJSON() *gabs.Container {
+	operationJSON := gabs.New()
+	if o.command != "" {
+		operationJSON.Set(o.command, "command")
+	}
+	if o.key != "" {
+		operationJSON.Set(o.key, "key")
+	}
+	if o.reply != "" {
+		operationJSON.Set(o.reply, "reply")
+	}
+	if o.latency != nil {
+		operationJSON.Set(o.latency.Milliseconds(), "latency")
+	}
+	return operationJSON
+}
+
+func (c *cachePorts) operations(protocol cacheProtocol, data []byte, isCommand bool) []*cacheOperation {
+	if protocol == cacheProtocolRedis {
+		return c.redisOperations(data, isCommand)
+	}
+	return c.memcachedOperations(data, isCommand)
+}
@@ -0,0 +1,180 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestCachePorts verifies that invalid entries are ignored, and that commands are sent to the server port.
+func TestCachePorts(t *testing.T) {
+	t.Parallel()
+
+	assert.Nil(t, newCachePorts([]string{"", "mysql:3306", "redis", "redis:port"}, false))
+
+	caches := newCachePorts([]string{" Redis:6379", "memcached:11211"}, false)
+	assert.NotNil(t, caches)
+
+	protocol, isCommand, ok := caches.lookup(40000, 6379)
+	assert.True(t, ok)
+	assert.True(t, isCommand)
+	assert.Equal(t, cacheProtocolRedis, protocol)
+
+	protocol, isCommand, ok = caches.lookup(11211, 40000)
+	assert.True(t, ok)
+	assert.False(t, isCommand)
+	assert.Equal(t, cacheProtocolMemcached, protocol)
+
+	_, _, ok = caches.lookup(40000, 8080)
+	assert.False(t, ok)
+}
+
+// TestRedisCommands verifies that pipelined and inline commands are reported, and that values are not.
+func TestRedisCommands(t *testing.T) {
+	t.Parallel()
+
+	caches := newCachePorts([]string{"redis:6379"}, false)
+
+	data := []byte("*3\r\n$3\r\nset\r\n$7\r\nuser:42\r\n$5\r\nvalue\r\n*2\r\n$3\r\nGET\r\n$7\r\nuser:42\r\nPING\r\n")
+	operations := caches.redisOperations(data, true)
+	if assert.Len(t, operations, 3) {
+		assert.Equal(t, "SET", operations[0].command)
+		assert.Equal(t, "user:42", operations[0].key)
+		assert.Equal(t, "GET", operations[1].command)
+		assert.Equal(t, "user:42", operations[1].key)
+		assert.Equal(t, "PING", operations[2].command)
+		assert.Empty(t, operations[2].key)
+	}
+	assert.NotContains(t, operations[0].toJSON().String(), "value")
+
+	// the value does not fit in the segment
+	operations = caches.redisOperations([]byte("*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$1024\r\nval"), true)
+	if assert.Len(t, operations, 1) {
+		assert.Equal(t, "SET", operations[0].command)
+		assert.Equal(t, "key", operations[0].key)
+	}
+}
+
+// TestRedisReplies verifies that reply types are reported, including nulls and errors.
+func TestRedisReplies(t *testing.T) {
+	t.Parallel()
+
+	caches := newCachePorts([]string{"redis:6379"}, false)
+
+	data := []byte("+OK\r\n$5\r\nvalue\r\n$-1\r\n-ERR wrong type\r\n*2\r\n:1\r\n$1\r\na\r\n")
+	operations := caches.redisOperations(data, false)
+	replies := make([]string, 0, len(operations))
+	for _, operation := range operations {
+		replies = append(replies, operation.reply)
+	}
+	assert.Equal(t, []string{"string", "bulk", "null", "error", "array"}, replies)
+
+	// segments that start with the continuation of a value are not reported
+	assert.Empty(t, caches.redisOperations([]byte("lue\r\n"), false))
+}
+
+// TestMemcachedOperations verifies that text, meta and binary commands and replies are reported.
+func TestMemcachedOperations(t *testing.T) {
+	t.Parallel()
+
+	caches := newCachePorts([]string{"memcached:11211"}, false)
+
+	operations := caches.memcachedOperations([]byte("set user:42 0 60 5\r\nvalue\r\n"), true)
+	if assert.Len(t, operations, 1) {
+		assert.Equal(t, "set", operations[0].command)
+		assert.Equal(t, "user:42", operations[0].key)
+	}
+
+	operations = caches.memcachedOperations([]byte("mg user:42 v\r\n"), true)
+	if assert.Len(t, operations, 1) {
+		assert.Equal(t, "mg", operations[0].command)
+	}
+
+	operations = caches.memcachedOperations([]byte("STORED\r\n"), false)
+	if assert.Len(t, operations, 1) {
+		assert.Equal(t, "STORED", operations[0].reply)
+	}
+
+	operations = caches.memcachedOperations([]byte("42\r\n"), false)
+	if assert.Len(t, operations, 1) {
+		assert.Equal(t, "NUMBER", operations[0].reply)
+	}
+
+	// binary GET request: key length 3, no extras
+	request := make([]byte, memcachedBinaryHeaderLen, memcachedBinaryHeaderLen+3)
+	request[0], request[1], request[3] = memcachedBinaryRequest, 0x00, 3
+	request = append(request, "key"...)
+	operations = caches.memcachedOperations(request, true)
+	if assert.Len(t, operations, 1) {
+		assert.Equal(t, "get", operations[0].command)
+		assert.Equal(t, "key", operations[0].key)
+	}
+
+	// binary GET response: status `NOT_FOUND`
+	response := make([]byte, memcachedBinaryHeaderLen)
+	response[0], response[1], response[7] = memcachedBinaryResponse, 0x00, 0x01
+	operations = caches.memcachedOperations(response, false)
+	if assert.Len(t, operations, 1) {
+		assert.Equal(t, "get", operations[0].command)
+		assert.Equal(t, "NOT_FOUND", operations[0].reply)
+	}
+
+	assert.Empty(t, caches.memcachedOperations(response[:8], false))
+}
+
+// TestCacheFlow verifies that replies are paired with commands in the order in which they were sent.
+func TestCacheFlow(t *testing.T) {
+	t.Parallel()
+
+	flow := newCacheFlow()
+	start := time.Now()
+
+	flow.sent("GET", start)
+	flow.sent("SET", start.Add(time.Millisecond))
+
+	reply := &cacheOperation{reply: "bulk"}
+	flow.replied(reply, start.Add(5*time.Millisecond))
+	assert.Equal(t, "GET", reply.command)
+	if assert.NotNil(t, reply.latency) {
+		assert.Equal(t, 5*time.Millisecond, *reply.latency)
+	}
+
+	reply = &cacheOperation{reply: "string"}
+	flow.replied(reply, start.Add(5*time.Millisecond))
+	assert.Equal(t, "SET", reply.command)
+	assert.Equal(t, 4*time.Millisecond, *reply.latency)
+
+	// unsolicited replies are not paired; i/e: the command was sent before the capture started
+	reply = &cacheOperation{reply: "push"}
+	flow.replied(reply, start)
+	assert.Empty(t, reply.command)
+	assert.Nil(t, reply.latency)
+}
+
+// TestCacheKeys verifies that keys are hashed if requested, and truncated otherwise.
+func TestCacheKeys(t *testing.T) {
+	t.Parallel()
+
+	hashed := newCachePorts([]string{"redis:6379"}, true)
+	assert.NotEqual(t, "user:42", hashed.key("user:42"))
+	assert.Equal(t, hashed.key("user:42"), hashed.key("user:42"))
+
+	plain := newCachePorts([]string{"redis:6379"}, false)
+	key := plain.key(string(make([]byte, 2*cacheKeyLimit)))
+	assert.Len(t, key, cacheKeyLimit)
+}
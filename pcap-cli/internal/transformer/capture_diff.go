@@ -0,0 +1,685 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+type (
+	// captureSegment is what is needed out of a packet, or out of its JSON translation, to profile a capture.
+	captureSegment struct {
+		timestamp        time.Time
+		length           int
+		src, dst         string
+		srcPort, dstPort uint16
+		isTCP            bool
+		syn              bool
+		ack              bool
+		rst              bool
+		fin              bool
+		psh              bool
+		urg              bool
+		// HTTP/1.1 request line, or response status code
+		isRequest bool
+		code      int
+		// milliseconds; only available in JSON translations of HTTP responses
+		latency *int64
+		// advertised TCP window; `nil` if unknown
+		window *uint16
+		// only available when reading PCAP and PCAPNG files
+		tcp *tcpRTTSegment
+		// milliseconds; only available in JSON translations of TCP segments
+		rtt *float64
+	}
+
+	captureFlowKey struct {
+		client, server string
+	}
+
+	captureEndpoint struct {
+		packets           uint64
+		connections       uint64
+		failedConnections uint64
+		responses         uint64
+		serverErrors      uint64
+		// milliseconds
+		connectLatencies []float64
+		httpLatencies    []float64
+	}
+
+	// captureProfile aggregates a capture by server endpoint ( `{ip}:{port}` ).
+	captureProfile struct {
+		name       string
+		packets    uint64
+		last       time.Time
+		endpoints  map[string]*captureEndpoint
+		handshakes map[captureFlowKey]time.Time
+		requests   map[captureFlowKey]time.Time
+	}
+
+	CaptureDiffSide struct {
+		Name         string `json:"name"`
+		Packets      uint64 `json:"packets"`
+		Destinations int    `json:"destinations"`
+	}
+
+	CaptureLatency struct {
+		Samples int     `json:"samples"`
+		P50     float64 `json:"p50"`
+		P95     float64 `json:"p95"`
+	}
+
+	// CaptureLatencyDiff is a significant change of latency; `Z` is positive when `B` is slower.
+	CaptureLatencyDiff struct {
+		Destination string         `json:"destination"`
+		Kind        string         `json:"kind"`
+		A           CaptureLatency `json:"a"`
+		B           CaptureLatency `json:"b"`
+		Z           float64        `json:"z"`
+	}
+
+	CaptureErrorRate struct {
+		Errors uint64  `json:"errors"`
+		Total  uint64  `json:"total"`
+		Rate   float64 `json:"rate"`
+	}
+
+	// CaptureErrorDiff is a significant change of an error rate; `Z` is positive when `B` fails more often.
+	CaptureErrorDiff struct {
+		Destination string           `json:"destination"`
+		Kind        string           `json:"kind"`
+		A           CaptureErrorRate `json:"a"`
+		B           CaptureErrorRate `json:"b"`
+		Z           float64          `json:"z"`
+	}
+
+	// CaptureDiff reports the significant differences between captures `A` and `B`;
+	// destination `*` aggregates all destinations.
+	CaptureDiff struct {
+		A                CaptureDiffSide      `json:"a"`
+		B                CaptureDiffSide      `json:"b"`
+		NewDestinations  []CaptureDestination `json:"new_destinations"`
+		GoneDestinations []CaptureDestination `json:"gone_destinations"`
+		Latencies        []CaptureLatencyDiff `json:"latencies"`
+		Errors           []CaptureErrorDiff   `json:"errors"`
+	}
+
+	captureJSONRecord struct {
+		Meta struct {
+			Timestamp time.Time `json:"timestamp"`
+			Len       int       `json:"len"`
+		} `json:"meta"`
+		L3 struct {
+			Src string `json:"src"`
+			Dst string `json:"dst"`
+		} `json:"L3"`
+		L4 struct {
+			Src   uint16 `json:"src"`
+			Dst   uint16 `json:"dst"`
+			Flags struct {
+				Map map[string]bool `json:"map"`
+			} `json:"flags"`
+			RTT *float64 `json:"rtt_ms"`
+			Win *uint16  `json:"win"`
+		} `json:"L4"`
+		HTTP *struct {
+			Kind    string `json:"kind"`
+			Code    int    `json:"code"`
+			Request struct {
+				Latency *int64 `json:"latency"`
+			} `json:"request"`
+		} `json:"HTTP"`
+	}
+)
+
+const (
+	captureDiffConnect = "connect"
+	captureDiffHTTP    = "http"
+	captureDiffAll     = "*"
+
+	// both captures must have at least this many samples for a difference to be significant
+	captureDiffMinSamples = 5
+	// two-tailed 99% confidence
+	captureDiffZ = 2.576
+	// handshakes without a reply are only failed if the capture continued for this long after the SYN
+	captureHandshakeTimeout = 3 * time.Second
+
+	captureSamplesLimit = 10000
+	captureFlowsLimit   = 65536
+	// JSON translations of HTTP messages may include bodies
+	captureJSONLineLimit = 16 * 1024 * 1024
+)
+
+var (
+	pcapMagics = [][]byte{
+		{0xa1, 0xb2, 0xc3, 0xd4}, {0xd4, 0xc3, 0xb2, 0xa1},
+		{0xa1, 0xb2, 0x3c, 0x4d}, {0x4d, 0x3c, 0xb2, 0xa1},
+	}
+	pcapngMagic = []byte{0x0a, 0x0d, 0x0d, 0x0a}
+	gzipMagic   = []byte{0x1f, 0x8b}
+)
+
+func newCaptureProfile(name string) *captureProfile {
+	return &captureProfile{
+		name:       name,
+		endpoints:  make(map[string]*captureEndpoint),
+		handshakes: make(map[captureFlowKey]time.Time),
+		requests:   make(map[captureFlowKey]time.Time),
+	}
+}
+
+func (p *captureProfile) endpoint(address string) *captureEndpoint {
+	endpoint, ok := p.endpoints[address]
+	if !ok {
+		endpoint = &captureEndpoint{}
+		p.endpoints[address] = endpoint
+	}
+	return endpoint
+}
+
+func appendSample(samples []float64, sample time.Duration) []float64 {
+	if len(samples) >= captureSamplesLimit {
+		return samples
+	}
+	return append(samples, float64(sample.Microseconds())/1000)
+}
+
+// server returns the client and server endpoints of a segment:
+//   - the server is the endpoint which receives SYNs, or an endpoint already known to be a server,
+//   - otherwise, servers are assumed to listen on lower ports than the ephemeral ports used by clients.
+func (p *captureProfile) server(segment *captureSegment) (string, string) {
+	switch {
+	case segment.syn && !segment.ack:
+		return segment.src, segment.dst
+	case segment.syn && segment.ack:
+		return segment.dst, segment.src
+	}
+	if _, ok := p.endpoints[segment.dst]; ok {
+		return segment.src, segment.dst
+	}
+	if _, ok := p.endpoints[segment.src]; ok || segment.srcPort < segment.dstPort {
+		return segment.dst, segment.src
+	}
+	return segment.src, segment.dst
+}
+
+func (p *captureProfile) observe(segment *captureSegment) {
+	p.packets++
+	if segment.timestamp.After(p.last) {
+		p.last = segment.timestamp
+	}
+
+	if len(p.handshakes) >= captureFlowsLimit {
+		p.handshakes = make(map[captureFlowKey]time.Time)
+	}
+	if len(p.requests) >= captureFlowsLimit {
+		p.requests = make(map[captureFlowKey]time.Time)
+	}
+
+	client, server := p.server(segment)
+	endpoint := p.endpoint(server)
+	endpoint.packets++
+	flow := captureFlowKey{client, server}
+
+	if !segment.isTCP {
+		return
+	}
+
+	switch {
+	case segment.syn && !segment.ack:
+		// retransmitted SYNs are not new connections
+		if _, ok := p.handshakes[flow]; !ok {
+			p.handshakes[flow] = segment.timestamp
+			endpoint.connections++
+		}
+	case segment.syn && segment.ack:
+		if start, ok := p.handshakes[flow]; ok {
+			endpoint.connectLatencies = appendSample(endpoint.connectLatencies, segment.timestamp.Sub(start))
+			delete(p.handshakes, flow)
+		}
+	case segment.rst:
+		if _, ok := p.handshakes[flow]; ok {
+			endpoint.failedConnections++
+			delete(p.handshakes, flow)
+		}
+	}
+
+	if segment.isRequest {
+		if _, ok := p.requests[flow]; !ok {
+			p.requests[flow] = segment.timestamp
+		}
+	} else if segment.code > 0 {
+		endpoint.responses++
+		if segment.code >= 500 {
+			endpoint.serverErrors++
+		}
+		if segment.latency != nil {
+			endpoint.httpLatencies = appendSample(endpoint.httpLatencies, time.Duration(*segment.latency)*time.Millisecond)
+		} else if start, ok := p.requests[flow]; ok {
+			endpoint.httpLatencies = appendSample(endpoint.httpLatencies, segment.timestamp.Sub(start))
+		}
+		delete(p.requests, flow)
+	}
+}
+
+// finalize accounts handshakes which were never answered as failed connections.
+func (p *captureProfile) finalize() {
+	for flow, start := range p.handshakes {
+		if p.last.Sub(start) >= captureHandshakeTimeout {
+			p.endpoint(flow.server).failedConnections++
+		}
+	}
+	clear(p.handshakes)
+	clear(p.requests)
+}
+
+// aggregate returns the sum of all endpoints; samples are merged.
+func (p *captureProfile) aggregate() *captureEndpoint {
+	all := &captureEndpoint{}
+	for _, endpoint := range p.endpoints {
+		all.packets += endpoint.packets
+		all.connections += endpoint.connections
+		all.failedConnections += endpoint.failedConnections
+		all.responses += endpoint.responses
+		all.serverErrors += endpoint.serverErrors
+		all.connectLatencies = append(all.connectLatencies, endpoint.connectLatencies...)
+		all.httpLatencies = append(all.httpLatencies, endpoint.httpLatencies...)
+	}
+	return all
+}
+
+func captureEndpointAddress(ip net.IP, port uint16) string {
+	return net.JoinHostPort(ip.String(), strconv.FormatUint(uint64(port), 10))
+}
+
+func newCaptureSegment(packet gopacket.Packet) *captureSegment {
+	network := packet.NetworkLayer()
+	if network == nil {
+		return nil
+	}
+	var srcIP, dstIP net.IP
+	switch ip := network.(type) {
+	case *layers.IPv4:
+		srcIP, dstIP = ip.SrcIP, ip.DstIP
+	case *layers.IPv6:
+		srcIP, dstIP = ip.SrcIP, ip.DstIP
+	default:
+		return nil
+	}
+
+	segment := &captureSegment{
+		timestamp: packet.Metadata().Timestamp,
+		length:    packet.Metadata().Length,
+	}
+	switch l4 := packet.TransportLayer().(type) {
+	case *layers.TCP:
+		segment.isTCP, segment.syn, segment.ack, segment.rst = true, l4.SYN, l4.ACK, l4.RST
+		segment.fin, segment.psh, segment.urg = l4.FIN, l4.PSH, l4.URG
+		segment.srcPort, segment.dstPort = uint16(l4.SrcPort), uint16(l4.DstPort)
+		segment.src = captureEndpointAddress(srcIP, uint16(l4.SrcPort))
+		segment.dst = captureEndpointAddress(dstIP, uint16(l4.DstPort))
+		segment.tcp, segment.window = newTCPRTTSegment(l4), &l4.Window
+		// only the 1st line is needed
+		line, _, _ := bytes.Cut(l4.Payload, http11Separator)
+		if http11RequestPayloadRegex.Match(line) {
+			segment.isRequest = true
+		} else if parts := http11ResponsePayloadRegex.FindSubmatch(line); parts != nil {
+			segment.code, _ = strconv.Atoi(string(parts[1]))
+		}
+	case *layers.UDP:
+		segment.srcPort, segment.dstPort = uint16(l4.SrcPort), uint16(l4.DstPort)
+		segment.src = captureEndpointAddress(srcIP, uint16(l4.SrcPort))
+		segment.dst = captureEndpointAddress(dstIP, uint16(l4.DstPort))
+	default:
+		return nil
+	}
+	return segment
+}
+
+func newCaptureSegmentFromJSON(line []byte) *captureSegment {
+	record := &captureJSONRecord{}
+	if err := json.Unmarshal(line, record); err != nil || record.L3.Src == "" || record.L4.Dst == 0 {
+		return nil
+	}
+
+	segment := &captureSegment{
+		timestamp: record.Meta.Timestamp,
+		length:    record.Meta.Len,
+		srcPort:   record.L4.Src,
+		dstPort:   record.L4.Dst,
+		src:       captureEndpointAddress(net.ParseIP(record.L3.Src), record.L4.Src),
+		dst:       captureEndpointAddress(net.ParseIP(record.L3.Dst), record.L4.Dst),
+	}
+	if flags := record.L4.Flags.Map; flags != nil {
+		segment.isTCP, segment.syn, segment.ack, segment.rst = true, flags["SYN"], flags["ACK"], flags["RST"]
+		segment.fin, segment.psh, segment.urg = flags["FIN"], flags["PSH"], flags["URG"]
+		segment.rtt, segment.window = record.L4.RTT, record.L4.Win
+	}
+	if record.HTTP != nil {
+		segment.isRequest = record.HTTP.Kind == "request"
+		if record.HTTP.Kind == "response" {
+			segment.code = record.HTTP.Code
+			segment.latency = record.HTTP.Request.Latency
+		}
+	}
+	return segment
+}
+
+// readCapture feeds `observe` with all segments of PCAP, PCAPNG or JSON translations ( 1 per line ); files may be gzip compressed.
+func readCapture(path string, observe func(*captureSegment)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	if magic, _ := reader.Peek(len(gzipMagic)); bytes.Equal(magic, gzipMagic) {
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		defer gzipReader.Close()
+		reader = bufio.NewReader(gzipReader)
+	}
+
+	magic, _ := reader.Peek(len(pcapngMagic))
+	switch {
+	case bytes.Equal(magic, pcapngMagic):
+		ngReader, err := pcapgo.NewNgReader(reader, pcapgo.DefaultNgReaderOptions)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		return readCapturePackets(path, ngReader, ngReader.LinkType(), observe)
+
+	case slices.ContainsFunc(pcapMagics, func(m []byte) bool { return bytes.Equal(magic, m) }):
+		pcapReader, err := pcapgo.NewReader(reader)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		return readCapturePackets(path, pcapReader, pcapReader.LinkType(), observe)
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), captureJSONLineLimit)
+	for scanner.Scan() {
+		if segment := newCaptureSegmentFromJSON(scanner.Bytes()); segment != nil {
+			observe(segment)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func readCapturePackets(
+	path string,
+	source gopacket.PacketDataSource,
+	linkType layers.LinkType,
+	observe func(*captureSegment),
+) error {
+	options := gopacket.DecodeOptions{Lazy: true, NoCopy: true}
+	for {
+		data, info, err := source.ReadPacketData()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		packet := gopacket.NewPacket(data, linkType, options)
+		packet.Metadata().CaptureInfo = info
+		if segment := newCaptureSegment(packet); segment != nil {
+			observe(segment)
+		}
+	}
+}
+
+func loadCaptureProfile(path string) (*captureProfile, error) {
+	profile := newCaptureProfile(path)
+	if err := readCapture(path, profile.observe); err != nil {
+		return nil, err
+	}
+	profile.finalize()
+	return profile, nil
+}
+
+// percentile expects sorted samples.
+func percentile(samples []float64, p float64) float64 {
+	if len(samples) == 0 {
+		return 0
+	}
+	index := int(math.Ceil(p*float64(len(samples)))) - 1
+	return samples[max(index, 0)]
+}
+
+func newCaptureLatency(samples []float64) CaptureLatency {
+	sorted := slices.Clone(samples)
+	slices.Sort(sorted)
+	return CaptureLatency{
+		Samples: len(sorted),
+		P50:     percentile(sorted, 0.50),
+		P95:     percentile(sorted, 0.95),
+	}
+}
+
+// mannWhitneyZ returns the normal approximation of the Mann-Whitney U statistic of `b` against `a`.
+func mannWhitneyZ(a, b []float64) float64 {
+	type rankedSample struct {
+		value float64
+		fromB bool
+	}
+	samples := make([]rankedSample, 0, len(a)+len(b))
+	for _, value := range a {
+		samples = append(samples, rankedSample{value, false})
+	}
+	for _, value := range b {
+		samples = append(samples, rankedSample{value, true})
+	}
+	slices.SortFunc(samples, func(x, y rankedSample) int { return cmp.Compare(x.value, y.value) })
+
+	// ties share the average of their ranks
+	rankSumB := 0.0
+	for i := 0; i < len(samples); {
+		j := i
+		for j < len(samples) && samples[j].value == samples[i].value {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if samples[k].fromB {
+				rankSumB += rank
+			}
+		}
+		i = j
+	}
+
+	n1, n2 := float64(len(a)), float64(len(b))
+	u := rankSumB - n2*(n2+1)/2
+	sigma := math.Sqrt(n1 * n2 * (n1 + n2 + 1) / 12)
+	if sigma == 0 {
+		return 0
+	}
+	return (u - n1*n2/2) / sigma
+}
+
+// proportionsZ returns the two-proportion z-test statistic of `b` against `a`.
+func proportionsZ(a, b CaptureErrorRate) float64 {
+	pooled := float64(a.Errors+b.Errors) / float64(a.Total+b.Total)
+	se := math.Sqrt(pooled * (1 - pooled) * (1/float64(a.Total) + 1/float64(b.Total)))
+	if se == 0 {
+		return 0
+	}
+	return (b.Rate - a.Rate) / se
+}
+
+func newCaptureErrorRate(errors, total uint64) CaptureErrorRate {
+	rate := CaptureErrorRate{Errors: errors, Total: total}
+	if total > 0 {
+		rate.Rate = float64(errors) / float64(total)
+	}
+	return rate
+}
+
+func (d *CaptureDiff) compareLatencies(destination, kind string, a, b []float64) {
+	if len(a) < captureDiffMinSamples || len(b) < captureDiffMinSamples {
+		return
+	}
+	if z := mannWhitneyZ(a, b); math.Abs(z) >= captureDiffZ {
+		d.Latencies = append(d.Latencies, CaptureLatencyDiff{
+			Destination: destination, Kind: kind,
+			A: newCaptureLatency(a), B: newCaptureLatency(b), Z: math.Round(z*100) / 100,
+		})
+	}
+}
+
+func (d *CaptureDiff) compareErrors(destination, kind string, a, b CaptureErrorRate) {
+	if a.Total < captureDiffMinSamples || b.Total < captureDiffMinSamples {
+		return
+	}
+	if z := proportionsZ(a, b); math.Abs(z) >= captureDiffZ {
+		d.Errors = append(d.Errors, CaptureErrorDiff{
+			Destination: destination, Kind: kind, A: a, B: b, Z: math.Round(z*100) / 100,
+		})
+	}
+}
+
+func (d *CaptureDiff) compareEndpoints(destination string, a, b *captureEndpoint) {
+	d.compareLatencies(destination, captureDiffConnect, a.connectLatencies, b.connectLatencies)
+	d.compareLatencies(destination, captureDiffHTTP, a.httpLatencies, b.httpLatencies)
+	d.compareErrors(destination, captureDiffConnect,
+		newCaptureErrorRate(a.failedConnections, a.connections),
+		newCaptureErrorRate(b.failedConnections, b.connections))
+	d.compareErrors(destination, captureDiffHTTP,
+		newCaptureErrorRate(a.serverErrors, a.responses),
+		newCaptureErrorRate(b.serverErrors, b.responses))
+}
+
+func sortCaptureDestinations(destinations []CaptureDestination) {
+	slices.SortFunc(destinations, func(x, y CaptureDestination) int {
+		if c := cmp.Compare(y.Packets, x.Packets); c != 0 {
+			return c
+		}
+		return cmp.Compare(x.Address, y.Address)
+	})
+}
+
+func diffCaptureProfiles(a, b *captureProfile) *CaptureDiff {
+	diff := &CaptureDiff{
+		A:                CaptureDiffSide{Name: a.name, Packets: a.packets, Destinations: len(a.endpoints)},
+		B:                CaptureDiffSide{Name: b.name, Packets: b.packets, Destinations: len(b.endpoints)},
+		NewDestinations:  []CaptureDestination{},
+		GoneDestinations: []CaptureDestination{},
+		Latencies:        []CaptureLatencyDiff{},
+		Errors:           []CaptureErrorDiff{},
+	}
+
+	diff.compareEndpoints(captureDiffAll, a.aggregate(), b.aggregate())
+
+	for _, address := range slices.Sorted(maps.Keys(b.endpoints)) {
+		endpointB := b.endpoints[address]
+		if endpointA, ok := a.endpoints[address]; ok {
+			diff.compareEndpoints(address, endpointA, endpointB)
+		} else {
+			diff.NewDestinations = append(diff.NewDestinations, CaptureDestination{Address: address, Packets: endpointB.packets})
+		}
+	}
+	for address, endpointA := range a.endpoints {
+		if _, ok := b.endpoints[address]; !ok {
+			diff.GoneDestinations = append(diff.GoneDestinations, CaptureDestination{Address: address, Packets: endpointA.packets})
+		}
+	}
+
+	sortCaptureDestinations(diff.NewDestinations)
+	sortCaptureDestinations(diff.GoneDestinations)
+	slices.SortStableFunc(diff.Latencies, func(x, y CaptureLatencyDiff) int { return cmp.Compare(math.Abs(y.Z), math.Abs(x.Z)) })
+	slices.SortStableFunc(diff.Errors, func(x, y CaptureErrorDiff) int { return cmp.Compare(math.Abs(y.Z), math.Abs(x.Z)) })
+
+	return diff
+}
+
+// DiffCaptures compares destinations, latency distributions and error rates of captures `a` and `b`:
+//   - captures are PCAP or PCAPNG files, or JSON translations ( 1 per line ); any of them may be gzip compressed,
+//   - only differences which are statistically significant are reported.
+func DiffCaptures(a, b string) (*CaptureDiff, error) {
+	profileA, err := loadCaptureProfile(a)
+	if err != nil {
+		return nil, err
+	}
+	profileB, err := loadCaptureProfile(b)
+	if err != nil {
+		return nil, err
+	}
+	return diffCaptureProfiles(profileA, profileB), nil
+}
+
+// WriteText renders a human readable report of all differences; at most `limit` destinations are listed per section.
+func (d *CaptureDiff) WriteText(writer io.Writer, limit int) error {
+	text := new(bytes.Buffer)
+
+	fmt.Fprintf(text, "A: %s ( %d packets, %d destinations )\n", d.A.Name, d.A.Packets, d.A.Destinations)
+	fmt.Fprintf(text, "B: %s ( %d packets, %d destinations )\n", d.B.Name, d.B.Packets, d.B.Destinations)
+
+	sections := []struct {
+		title        string
+		destinations []CaptureDestination
+		sign         string
+	}{
+		{"new destinations", d.NewDestinations, "+"},
+		{"gone destinations", d.GoneDestinations, "-"},
+	}
+	for _, section := range sections {
+		fmt.Fprintf(text, "\n%s: %d\n", section.title, len(section.destinations))
+		for _, destination := range section.destinations[:min(len(section.destinations), limit)] {
+			fmt.Fprintf(text, "  %s %s ( %d packets )\n", section.sign, destination.Address, destination.Packets)
+		}
+	}
+
+	fmt.Fprintf(text, "\nlatency changes: %d\n", len(d.Latencies))
+	for _, latency := range d.Latencies[:min(len(d.Latencies), limit)] {
+		fmt.Fprintf(text, "  %s %s: p50 %.1fms -> %.1fms | p95 %.1fms -> %.1fms | samples %d/%d | z=%.2f\n",
+			latency.Destination, latency.Kind, latency.A.P50, latency.B.P50,
+			latency.A.P95, latency.B.P95, latency.A.Samples, latency.B.Samples, latency.Z)
+	}
+
+	fmt.Fprintf(text, "\nerror rate changes: %d\n", len(d.Errors))
+	for _, rate := range d.Errors[:min(len(d.Errors), limit)] {
+		fmt.Fprintf(text, "  %s %s: %.1f%% ( %d/%d ) -> %.1f%% ( %d/%d ) | z=%.2f\n",
+			rate.Destination, rate.Kind, rate.A.Rate*100, rate.A.Errors, rate.A.Total,
+			rate.B.Rate*100, rate.B.Errors, rate.B.Total, rate.Z)
+	}
+
+	_, err := writer.Write(text.Bytes())
+	return err
+}
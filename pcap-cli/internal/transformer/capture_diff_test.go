@@ -0,0 +1,157 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/stretchr/testify/assert"
+)
+
+type captureDiffTestWriter struct {
+	t      *testing.T
+	writer *pcapgo.Writer
+}
+
+func (w *captureDiffTestWriter) tcp(ts time.Time, src, dst net.IP, srcPort, dstPort layers.TCPPort, syn, ack, rst bool) {
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: src, DstIP: dst}
+	tcp := &layers.TCP{SrcPort: srcPort, DstPort: dstPort, SYN: syn, ACK: ack, RST: rst, Window: 1024}
+	tcp.SetNetworkLayerForChecksum(ip)
+	w.write(ts, &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0x02, 0, 0, 0, 0, 1},
+		DstMAC:       net.HardwareAddr{0x02, 0, 0, 0, 0, 2},
+		EthernetType: layers.EthernetTypeIPv4,
+	}, ip, tcp)
+}
+
+func (w *captureDiffTestWriter) write(ts time.Time, serializable ...gopacket.SerializableLayer) {
+	buffer := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	assert.NoError(w.t, gopacket.SerializeLayers(buffer, opts, serializable...))
+	data := buffer.Bytes()
+	assert.NoError(w.t, w.writer.WritePacket(gopacket.CaptureInfo{Timestamp: ts, CaptureLength: len(data), Length: len(data)}, data))
+}
+
+// writeCaptureDiffTestPCAP writes 10 connections to `10.0.0.2:443` answered after `rtt`; the last `failed` are reset.
+func writeCaptureDiffTestPCAP(t *testing.T, path string, rtt time.Duration, failed int) {
+	file, err := os.Create(path)
+	assert.NoError(t, err)
+	defer file.Close()
+
+	writer := pcapgo.NewWriter(file)
+	assert.NoError(t, writer.WriteFileHeader(65536, layers.LinkTypeEthernet))
+	w := &captureDiffTestWriter{t, writer}
+
+	client, server := net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)
+	start := time.Unix(1700000000, 0)
+	for i := range 10 {
+		ts := start.Add(time.Duration(i) * time.Second)
+		port := layers.TCPPort(40000 + i)
+		w.tcp(ts, client, server, port, 443, true, false, false)
+		if i >= 10-failed {
+			w.tcp(ts.Add(rtt), server, client, 443, port, false, true, true)
+		} else {
+			// jitter keeps samples distinct
+			w.tcp(ts.Add(rtt+time.Duration(i)*100*time.Microsecond), server, client, 443, port, true, true, false)
+		}
+	}
+}
+
+func TestDiffCaptures(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.pcap"), filepath.Join(dir, "b.pcap")
+	writeCaptureDiffTestPCAP(t, a, time.Millisecond, 0)
+	writeCaptureDiffTestPCAP(t, b, 50*time.Millisecond, 5)
+
+	diff, err := DiffCaptures(a, b)
+	assert.NoError(t, err)
+
+	assert.Equal(t, uint64(20), diff.A.Packets)
+	assert.Equal(t, 1, diff.B.Destinations)
+	assert.Empty(t, diff.NewDestinations)
+
+	if assert.NotEmpty(t, diff.Latencies) {
+		latency := diff.Latencies[0]
+		assert.Equal(t, captureDiffConnect, latency.Kind)
+		assert.Greater(t, latency.Z, 0.0)
+		assert.Equal(t, 10, latency.A.Samples)
+		assert.Equal(t, 5, latency.B.Samples)
+	}
+
+	destinations := []string{}
+	for _, rate := range diff.Errors {
+		assert.Equal(t, captureDiffConnect, rate.Kind)
+		assert.Equal(t, uint64(5), rate.B.Errors)
+		destinations = append(destinations, rate.Destination)
+	}
+	assert.ElementsMatch(t, []string{captureDiffAll, "10.0.0.2:443"}, destinations)
+
+	text := new(strings.Builder)
+	assert.NoError(t, diff.WriteText(text, 20))
+	assert.Contains(t, text.String(), "10.0.0.2:443 connect: 0.0% ( 0/10 ) -> 50.0% ( 5/10 )")
+}
+
+// TestDiffCapturesJSON verifies that JSON translations are profiled using HTTP latencies and status codes.
+func TestDiffCapturesJSON(t *testing.T) {
+	t.Parallel()
+
+	line := `{"meta":{"timestamp":"2024-01-01T00:00:%02dZ"},"L3":{"src":"%s","dst":"%s"},` +
+		`"L4":{"src":%d,"dst":%d,"flags":{"map":{"ACK":true,"PSH":true}}},` +
+		`"HTTP":{"kind":"response","code":%d,"request":{"latency":%d}}}`
+
+	dir := t.TempDir()
+	writeJSON := func(name string, code int, latency int, server string) string {
+		lines := []string{}
+		for i := range 10 {
+			lines = append(lines, fmt.Sprintf(line, i, server, "10.0.0.1", 8080, 40000+i, code, latency+i))
+		}
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0o644))
+		return path
+	}
+
+	diff, err := DiffCaptures(writeJSON("a.json", 200, 10, "10.0.0.2"), writeJSON("b.json", 503, 10, "10.0.0.3"))
+	assert.NoError(t, err)
+
+	assert.Equal(t, []CaptureDestination{{Address: "10.0.0.3:8080", Packets: 10}}, diff.NewDestinations)
+	assert.Equal(t, []CaptureDestination{{Address: "10.0.0.2:8080", Packets: 10}}, diff.GoneDestinations)
+	// same latencies, different destinations: only the aggregate is compared
+	assert.Empty(t, diff.Latencies)
+	if assert.Len(t, diff.Errors, 1) {
+		assert.Equal(t, captureDiffAll, diff.Errors[0].Destination)
+		assert.Equal(t, captureDiffHTTP, diff.Errors[0].Kind)
+		assert.InDelta(t, 1.0, diff.Errors[0].B.Rate, 0.001)
+	}
+}
+
+func TestMannWhitneyZ(t *testing.T) {
+	t.Parallel()
+
+	a := []float64{1, 2, 3, 4, 5, 6, 7, 8}
+	assert.InDelta(t, 0.0, mannWhitneyZ(a, a), 0.001)
+	assert.Greater(t, mannWhitneyZ(a, []float64{11, 12, 13, 14, 15, 16, 17, 18}), captureDiffZ)
+	assert.Less(t, mannWhitneyZ([]float64{11, 12, 13, 14, 15, 16, 17, 18}, a), -captureDiffZ)
+}
@@ -0,0 +1,176 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/gopacket"
+)
+
+type (
+	// CaptureDestination is a destination address along with the number of packets sent to it.
+	CaptureDestination struct {
+		Address string
+		Packets uint64
+	}
+
+	// CaptureTotals is a snapshot of the counters of a capture session.
+	CaptureTotals struct {
+		Packets         uint64
+		Bytes           uint64
+		Errors          uint64
+		Anomalies       uint64
+		TopDestinations []CaptureDestination
+		// protocol hierarchy of all packets
+		Protocols []CaptureProtocol
+		// TCP connections by state, as tracked in capture order
+		TCP CaptureTCPConnections
+	}
+
+	// CaptureSummary counts packets, translation errors and anomalies for the whole lifetime of a PCAP engine.
+	CaptureSummary struct {
+		packets   atomic.Uint64
+		bytes     atomic.Uint64
+		errors    atomic.Uint64
+		anomalies atomic.Uint64
+
+		tcpHalfOpen        atomic.Int64
+		tcpEstablished     atomic.Int64
+		tcpResets          atomic.Uint64
+		tcpHalfOpenExpired atomic.Uint64
+
+		mu           sync.Mutex
+		destinations map[string]uint64
+
+		protocols *protocolHierarchy
+	}
+)
+
+const (
+	captureTopDestinations = 10
+	// destinations first seen after the limit is reached are not counted; totals are
+	captureDestinationsLimit = 4096
+)
+
+func NewCaptureSummary() *CaptureSummary {
+	return &CaptureSummary{
+		destinations: make(map[string]uint64),
+		protocols:    newProtocolHierarchy(),
+	}
+}
+
+// Observe counts `packet`, its network layer destination and its protocols; `nil` safe.
+func (s *CaptureSummary) Observe(packet gopacket.Packet) {
+	if s == nil || packet == nil {
+		return
+	}
+
+	s.packets.Add(1)
+	s.bytes.Add(uint64(packet.Metadata().Length))
+	s.protocols.observe(packet)
+
+	network := packet.NetworkLayer()
+	if network == nil {
+		return
+	}
+	destination := network.NetworkFlow().Dst().String()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.destinations[destination]; ok || len(s.destinations) < captureDestinationsLimit {
+		s.destinations[destination]++
+	}
+}
+
+// ObserveError counts a packet which could not be translated; `nil` safe.
+func (s *CaptureSummary) ObserveError() {
+	if s != nil {
+		s.errors.Add(1)
+	}
+}
+
+func (s *CaptureSummary) observeAnomaly() {
+	if s != nil {
+		s.anomalies.Add(1)
+	}
+}
+
+// observeTCPState moves a connection between the counters of its states.
+func (s *CaptureSummary) observeTCPState(from, to tcpState) {
+	if s == nil || from == to {
+		return
+	}
+	if from.isHalfOpen() {
+		s.tcpHalfOpen.Add(-1)
+	} else if from.isEstablished() {
+		s.tcpEstablished.Add(-1)
+	}
+	if to.isHalfOpen() {
+		s.tcpHalfOpen.Add(1)
+	} else if to.isEstablished() {
+		s.tcpEstablished.Add(1)
+	} else if to == tcpStateClose {
+		s.tcpResets.Add(1)
+	}
+}
+
+func (s *CaptureSummary) observeTCPHalfOpenExpired() {
+	if s != nil {
+		s.tcpHalfOpenExpired.Add(1)
+	}
+}
+
+// Totals returns a snapshot of all counters, the destinations which received the most packets,
+// and the protocol hierarchy; `nil` safe.
+func (s *CaptureSummary) Totals() *CaptureTotals {
+	if s == nil {
+		return nil
+	}
+
+	totals := &CaptureTotals{
+		Packets:   s.packets.Load(),
+		Bytes:     s.bytes.Load(),
+		Errors:    s.errors.Load(),
+		Anomalies: s.anomalies.Load(),
+		Protocols: s.protocols.snapshot(),
+		TCP: CaptureTCPConnections{
+			HalfOpen:        s.tcpHalfOpen.Load(),
+			Established:     s.tcpEstablished.Load(),
+			Resets:          s.tcpResets.Load(),
+			HalfOpenExpired: s.tcpHalfOpenExpired.Load(),
+		},
+	}
+
+	s.mu.Lock()
+	destinations := make([]CaptureDestination, 0, len(s.destinations))
+	for address, packets := range s.destinations {
+		destinations = append(destinations, CaptureDestination{Address: address, Packets: packets})
+	}
+	s.mu.Unlock()
+
+	slices.SortFunc(destinations, func(a, b CaptureDestination) int {
+		if c := cmp.Compare(b.Packets, a.Packets); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Address, b.Address)
+	})
+	totals.TopDestinations = destinations[:min(len(destinations), captureTopDestinations)]
+
+	return totals
+}
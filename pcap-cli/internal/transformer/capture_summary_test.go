@@ -0,0 +1,65 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+func newCaptureSummaryTestPacket(t *testing.T, dst net.IP) gopacket.Packet {
+	return newTestPacket(t, newTestIPv4(net.IPv4(10, 0, 0, 1), dst),
+		&layers.UDP{SrcPort: 40000, DstPort: 53}, gopacket.Payload("query"))
+}
+
+// TestCaptureSummary verifies that destinations are ranked by packets, and ties are broken by address.
+func TestCaptureSummary(t *testing.T) {
+	t.Parallel()
+
+	summary := NewCaptureSummary()
+	for i, dst := range []net.IP{
+		net.IPv4(10, 0, 0, 3),
+		net.IPv4(10, 0, 0, 2),
+		net.IPv4(10, 0, 0, 2),
+		net.IPv4(10, 0, 0, 4),
+	} {
+		packet := newCaptureSummaryTestPacket(t, dst)
+		summary.Observe(packet)
+		if i == 0 {
+			summary.ObserveError()
+		}
+	}
+	summary.observeAnomaly()
+
+	totals := summary.Totals()
+	assert.Equal(t, uint64(4), totals.Packets)
+	assert.Equal(t, uint64(4*(20+8+5)), totals.Bytes)
+	assert.Equal(t, uint64(1), totals.Errors)
+	assert.Equal(t, uint64(1), totals.Anomalies)
+	assert.Equal(t, []CaptureDestination{
+		{Address: "10.0.0.2", Packets: 2},
+		{Address: "10.0.0.3", Packets: 1},
+		{Address: "10.0.0.4", Packets: 1},
+	}, totals.TopDestinations)
+
+	var disabled *CaptureSummary
+	disabled.Observe(newCaptureSummaryTestPacket(t, net.IPv4(10, 0, 0, 2)))
+	disabled.ObserveError()
+	assert.Nil(t, disabled.Totals())
+}
@@ -0,0 +1,225 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+type (
+	connectionPhaseName string
+
+	// connectionPhase is a step required to establish a connection before it can carry requests
+	connectionPhase struct {
+		name       connectionPhaseName
+		start, end time.Time
+		// DNS: question name; TLS: SNI
+		serverName string
+	}
+
+	dnsQueryKey struct {
+		client string
+		id     uint16
+	}
+
+	// flowPhases contains the phases observed for a single TCP connection
+	flowPhases struct {
+		connectedAt time.Time
+		// when the `SYN+ACK` was observed: completes the TCP handshake from the client's perspective
+		establishedAt time.Time
+		// endpoint that sent the `ClientHello`
+		client    string
+		handshake *connectionPhase
+		reported  bool
+		// number of HTTP transactions carried by the connection
+		transactions uint64
+	}
+
+	// connectionPhasesTracker learns the timing of DNS lookups and TLS handshakes,
+	// so that they can be reported as part of the trace of the 1st request carried by each connection:
+	//   - DNS lookups are linked to connections using the resolved IP address,
+	//   - TLS handshakes start with the `ClientHello`, and end with the 1st `application_data` record sent by the client.
+	connectionPhasesTracker struct {
+		mu      *sync.Mutex
+		queries map[dnsQueryKey]time.Time
+		lookups map[string]*connectionPhase
+		flows   map[uint64]*flowPhases
+		// connection setup costs per destination; only available if connection setup is attributed
+		setups map[string]*connectionSetupStats
+	}
+)
+
+const (
+	connectionPhaseDNS = connectionPhaseName("dns")
+	connectionPhaseTLS = connectionPhaseName("tls")
+
+	// state is discarded when limits are reached, instead of keeping stale entries forever
+	connectionPhasesLimit = 4096
+
+	tlsRecordTypeApplicationData = uint8(23)
+)
+
+func newConnectionPhasesTracker() *connectionPhasesTracker {
+	return &connectionPhasesTracker{
+		mu:      new(sync.Mutex),
+		queries: make(map[dnsQueryKey]time.Time),
+		lookups: make(map[string]*connectionPhase),
+		flows:   make(map[uint64]*flowPhases),
+	}
+}
+
+// observeDNSQuery must be invoked with the endpoint that sent the query
+func (c *connectionPhasesTracker) observeDNSQuery(client string, id uint16, timestamp time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.queries) >= connectionPhasesLimit {
+		c.queries = make(map[dnsQueryKey]time.Time)
+	}
+	c.queries[dnsQueryKey{client, id}] = timestamp
+}
+
+// observeDNSResponse must be invoked with the endpoint that will receive the response
+func (c *connectionPhasesTracker) observeDNSResponse(
+	client string,
+	id uint16,
+	timestamp time.Time,
+	name string,
+	addresses []net.IP,
+) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := dnsQueryKey{client, id}
+	start, ok := c.queries[key]
+	if !ok {
+		return
+	}
+	delete(c.queries, key)
+
+	lookup := &connectionPhase{name: connectionPhaseDNS, start: start, end: timestamp, serverName: name}
+	for _, address := range addresses {
+		if len(c.lookups) >= connectionPhasesLimit {
+			c.lookups = make(map[string]*connectionPhase)
+		}
+		c.lookups[address.String()] = lookup
+	}
+}
+
+// flow must be invoked while holding `c.mu`
+func (c *connectionPhasesTracker) flow(flowID uint64) *flowPhases {
+	flow, ok := c.flows[flowID]
+	if !ok {
+		if len(c.flows) >= connectionPhasesLimit {
+			c.flows = make(map[uint64]*flowPhases)
+		}
+		flow = &flowPhases{}
+		c.flows[flowID] = flow
+	}
+	return flow
+}
+
+// observeConnection must be invoked with the `SYN` that opens the connection
+func (c *connectionPhasesTracker) observeConnection(flowID uint64, timestamp time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.flow(flowID).connectedAt = timestamp
+}
+
+// observeEstablished must be invoked with the `SYN+ACK` that accepts the connection
+func (c *connectionPhasesTracker) observeEstablished(flowID uint64, timestamp time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if flow, ok := c.flows[flowID]; ok && flow.establishedAt.IsZero() {
+		flow.establishedAt = timestamp
+	}
+}
+
+// observeTLS inspects the 1st TLS record carried by TCP segments sent by `src`
+func (c *connectionPhasesTracker) observeTLS(flowID uint64, src string, data []byte, timestamp time.Time) {
+	if len(data) < 6 {
+		return
+	}
+
+	isClientHello := data[0] == tlsRecordTypeHandshake && data[5] == tlsHandshakeTypeClientHello
+	isApplicationData := data[0] == tlsRecordTypeApplicationData
+	if !isClientHello && !isApplicationData {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if isClientHello {
+		flow := c.flow(flowID)
+		if flow.handshake == nil {
+			serverName, _ := tlsServerName(data)
+			flow.client = src
+			flow.handshake = &connectionPhase{name: connectionPhaseTLS, start: timestamp, serverName: serverName}
+		}
+		return
+	}
+
+	if flow, ok := c.flows[flowID]; ok && flow.handshake != nil &&
+		flow.handshake.end.IsZero() && flow.client == src {
+		flow.handshake.end = timestamp
+	}
+}
+
+// phases returns the phases that preceded the 1st traced request carried by the connection `flowID`;
+// subsequent requests reuse the connection, so phases are only returned once.
+func (c *connectionPhasesTracker) phases(flowID uint64, server net.IP) []*connectionPhase {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	flow, ok := c.flows[flowID]
+	if ok && flow.reported {
+		return nil
+	}
+	if !ok {
+		flow = c.flow(flowID)
+	}
+	flow.reported = true
+
+	phases := make([]*connectionPhase, 0, 2)
+
+	if lookup := c.lookup(flow, server); lookup != nil {
+		phases = append(phases, lookup)
+	}
+
+	if flow.handshake != nil && !flow.handshake.end.IsZero() {
+		phases = append(phases, flow.handshake)
+	}
+
+	return phases
+}
+
+// lookup must be invoked while holding `c.mu`; it returns the DNS lookup that resolved `server` for `flow`.
+func (c *connectionPhasesTracker) lookup(flow *flowPhases, server net.IP) *connectionPhase {
+	lookup, ok := c.lookups[server.String()]
+	if !ok {
+		return nil
+	}
+	// the lookup must have completed before the connection was established
+	connectedAt := flow.connectedAt
+	if connectedAt.IsZero() && flow.handshake != nil {
+		connectedAt = flow.handshake.start
+	}
+	if connectedAt.IsZero() || !lookup.end.After(connectedAt) {
+		return lookup
+	}
+	return nil
+}
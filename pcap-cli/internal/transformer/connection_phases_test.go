@@ -0,0 +1,69 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestConnectionPhases verifies that DNS lookups and TLS handshakes are linked to the connections they preceded.
+func TestConnectionPhases(t *testing.T) {
+	t.Parallel()
+
+	start := time.Now()
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+
+	client := "10.0.0.1:40000"
+	server := net.ParseIP("10.0.0.2")
+	flowID := uint64(1)
+
+	tracker := newConnectionPhasesTracker()
+
+	tracker.observeDNSQuery("10.0.0.1:53000", 7, at(0))
+	// responses for unknown queries are ignored
+	tracker.observeDNSResponse("10.0.0.1:53000", 8, at(1), "other.example", []net.IP{server})
+	tracker.observeDNSResponse("10.0.0.1:53000", 7, at(5), "api.example", []net.IP{server})
+
+	tracker.observeConnection(flowID, at(6))
+	clientHello := newTLSClientHello(t, "api.example")
+	tracker.observeTLS(flowID, client, clientHello, at(8))
+	// only the client completes the handshake
+	tracker.observeTLS(flowID, "10.0.0.2:443", []byte{tlsRecordTypeApplicationData, 3, 3, 0, 1, 0}, at(10))
+	tracker.observeTLS(flowID, client, []byte{tlsRecordTypeApplicationData, 3, 3, 0, 1, 0}, at(12))
+
+	phases := tracker.phases(flowID, server)
+	assert.Len(t, phases, 2)
+
+	assert.Equal(t, connectionPhaseDNS, phases[0].name)
+	assert.Equal(t, "api.example", phases[0].serverName)
+	assert.Equal(t, 5*time.Millisecond, phases[0].end.Sub(phases[0].start))
+
+	assert.Equal(t, connectionPhaseTLS, phases[1].name)
+	assert.Equal(t, "api.example", phases[1].serverName)
+	assert.Equal(t, 4*time.Millisecond, phases[1].end.Sub(phases[1].start))
+
+	// phases are only reported for the 1st traced request
+	assert.Empty(t, tracker.phases(flowID, server))
+
+	// lookups completed after the connection was established did not precede it
+	tracker.observeConnection(2, at(20))
+	tracker.observeDNSQuery("10.0.0.1:53000", 9, at(19))
+	tracker.observeDNSResponse("10.0.0.1:53000", 9, at(21), "api.example", []net.IP{server})
+	assert.Empty(t, tracker.phases(2, server))
+}
@@ -0,0 +1,96 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"net"
+	"time"
+)
+
+type (
+	// connectionSetup attributes the latency of an HTTP transaction to the setup of its connection
+	connectionSetup struct {
+		// the transaction did not pay for the connection setup; connections opened before the capture started are reused
+		reused bool
+		// ordinal of the transaction within the connection
+		transaction   uint64
+		dns, tcp, tls time.Duration
+		stats         *connectionSetupStats
+	}
+
+	// connectionSetupStats is the "connection setup tax" paid by transactions sent to a single destination
+	connectionSetupStats struct {
+		new, reused uint64
+		setup       time.Duration
+	}
+)
+
+func (s *connectionSetup) total() time.Duration {
+	return s.dns + s.tcp + s.tls
+}
+
+// tax is the connection setup cost amortized across all transactions sent to the destination
+func (s *connectionSetupStats) tax() time.Duration {
+	if transactions := s.new + s.reused; transactions > 0 {
+		return s.setup / time.Duration(transactions)
+	}
+	return 0
+}
+
+// setup attributes a transaction carried by the connection `flowID` which was sent to `destination` ( `server` IP and port );
+// the 1st transaction of connections whose opening was observed pays for: DNS lookup, TCP handshake, and TLS handshake.
+func (c *connectionPhasesTracker) setup(flowID uint64, server net.IP, destination string) *connectionSetup {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	flow := c.flow(flowID)
+	flow.transactions += 1
+
+	setup := &connectionSetup{
+		reused:      flow.transactions > 1 || flow.connectedAt.IsZero(),
+		transaction: flow.transactions,
+	}
+
+	if !setup.reused {
+		if lookup := c.lookup(flow, server); lookup != nil {
+			setup.dns = lookup.end.Sub(lookup.start)
+		}
+		if !flow.establishedAt.IsZero() {
+			setup.tcp = flow.establishedAt.Sub(flow.connectedAt)
+		}
+		if flow.handshake != nil && !flow.handshake.end.IsZero() {
+			setup.tls = flow.handshake.end.Sub(flow.handshake.start)
+		}
+	}
+
+	stats, ok := c.setups[destination]
+	if !ok {
+		if c.setups == nil || len(c.setups) >= connectionPhasesLimit {
+			c.setups = make(map[string]*connectionSetupStats)
+		}
+		stats = &connectionSetupStats{}
+		c.setups[destination] = stats
+	}
+	if setup.reused {
+		stats.reused += 1
+	} else {
+		stats.new += 1
+		stats.setup += setup.total()
+	}
+	// stats are copied as they keep changing after the lock is released
+	setup.stats = &connectionSetupStats{stats.new, stats.reused, stats.setup}
+
+	return setup
+}
@@ -0,0 +1,66 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestConnectionSetup verifies that only the 1st transaction of a new connection pays for its setup.
+func TestConnectionSetup(t *testing.T) {
+	t.Parallel()
+
+	start := time.Now()
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+
+	client := "10.0.0.1:40000"
+	server := net.ParseIP("10.0.0.2")
+	destination := "10.0.0.2:443"
+
+	tracker := newConnectionPhasesTracker()
+
+	tracker.observeDNSQuery("10.0.0.1:53000", 7, at(0))
+	tracker.observeDNSResponse("10.0.0.1:53000", 7, at(10), "api.example", []net.IP{server})
+	tracker.observeConnection(1, at(12))
+	tracker.observeEstablished(1, at(42))
+	tracker.observeTLS(1, client, newTLSClientHello(t, "api.example"), at(43))
+	tracker.observeTLS(1, client, []byte{tlsRecordTypeApplicationData, 3, 3, 0, 1, 0}, at(103))
+
+	setup := tracker.setup(1, server, destination)
+	assert.False(t, setup.reused)
+	assert.Equal(t, uint64(1), setup.transaction)
+	assert.Equal(t, 10*time.Millisecond, setup.dns)
+	assert.Equal(t, 30*time.Millisecond, setup.tcp)
+	assert.Equal(t, 60*time.Millisecond, setup.tls)
+	assert.Equal(t, 100*time.Millisecond, setup.total())
+
+	setup = tracker.setup(1, server, destination)
+	assert.True(t, setup.reused)
+	assert.Equal(t, uint64(2), setup.transaction)
+	assert.Zero(t, setup.total())
+
+	// connections opened before the capture started are reused
+	setup = tracker.setup(2, server, destination)
+	assert.True(t, setup.reused)
+
+	// the setup of the only new connection is amortized across all transactions
+	assert.Equal(t, uint64(1), setup.stats.new)
+	assert.Equal(t, uint64(2), setup.stats.reused)
+	assert.Equal(t, 100*time.Millisecond/3, setup.stats.tax())
+}
@@ -0,0 +1,173 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+	"time"
+)
+
+type (
+	// CorrelationIndex exposes the state used by JSON translators to link responses to traced requests;
+	// it allows to verify why responses are not being linked while the capture is running.
+	CorrelationIndex struct {
+		mu sync.RWMutex
+		// the most recent JSON translator of every interface
+		sources map[string]*flowMutex
+	}
+
+	// CorrelationTrace is a traced request that responses carrying the same trace ID are linked to.
+	CorrelationTrace struct {
+		Iface     string    `json:"iface"`
+		TraceID   string    `json:"trace"`
+		Method    string    `json:"method,omitempty"`
+		URL       string    `json:"url,omitempty"`
+		RPC       string    `json:"rpc,omitempty"`
+		Timestamp time.Time `json:"timestamp"`
+		Age       float64   `json:"age_ms"`
+		// streams of connections which carried requests of this trace
+		Streams []CorrelationStreamRef `json:"streams,omitempty"`
+	}
+
+	CorrelationStreamRef struct {
+		FlowID   uint64 `json:"flow"`
+		StreamID uint32 `json:"stream"`
+	}
+
+	// CorrelationFlow is a connection which carried traced requests; untraced responses are linked to them by TCP sequence.
+	CorrelationFlow struct {
+		Iface   string              `json:"iface"`
+		FlowID  uint64              `json:"flow"`
+		Serial  uint64              `json:"serial"`
+		Age     float64             `json:"age_ms"`
+		Streams []CorrelationStream `json:"streams"`
+	}
+
+	CorrelationStream struct {
+		StreamID uint32               `json:"stream"`
+		Requests []CorrelationRequest `json:"requests"`
+	}
+
+	CorrelationRequest struct {
+		Sequence uint32 `json:"seq"`
+		TraceID  string `json:"trace"`
+		SpanID   string `json:"span,omitempty"`
+		// connection termination waits for active requests until their responses are seen, or for up to 10 seconds
+		Active bool    `json:"active"`
+		Age    float64 `json:"age_ms"`
+	}
+)
+
+func NewCorrelationIndex() *CorrelationIndex {
+	return &CorrelationIndex{sources: make(map[string]*flowMutex)}
+}
+
+func (x *CorrelationIndex) register(iface string, fm *flowMutex) {
+	if x == nil {
+		return
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.sources[iface] = fm
+}
+
+func (x *CorrelationIndex) forEachSource(fn func(iface string, fm *flowMutex)) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	for iface, fm := range x.sources {
+		fn(iface, fm)
+	}
+}
+
+// Traces returns the traced requests of all interfaces, oldest first.
+func (x *CorrelationIndex) Traces() []CorrelationTrace {
+	now := time.Now()
+	traces := []CorrelationTrace{}
+	x.forEachSource(func(iface string, fm *flowMutex) {
+		streams := make(map[string][]CorrelationStreamRef)
+		fm.forEachTracedFlow(func(flowID uint64, streamID uint32, _ uint32, tf *TracedFlow) {
+			traceID := *tf.ts.traceID
+			streams[traceID] = append(streams[traceID], CorrelationStreamRef{FlowID: flowID, StreamID: streamID})
+		})
+
+		fm.traceToHttpRequestMap.ForEach(func(traceID string, request *httpRequest) bool {
+			trace := CorrelationTrace{
+				Iface:     iface,
+				TraceID:   traceID,
+				Timestamp: *request.timestamp,
+				Age:       durationMillis(now.Sub(*request.timestamp)),
+				Streams:   streams[traceID],
+			}
+			if request.method != nil {
+				trace.Method = *request.method
+			}
+			if request.url != nil {
+				trace.URL = *request.url
+			}
+			if request.rpc != nil {
+				trace.RPC = *request.rpc
+			}
+			traces = append(traces, trace)
+			return true
+		})
+	})
+	slices.SortFunc(traces, func(a, b CorrelationTrace) int {
+		return a.Timestamp.Compare(b.Timestamp)
+	})
+	return traces
+}
+
+// Flows returns the connections of all interfaces which carried traced requests, along with their streams.
+func (x *CorrelationIndex) Flows() []CorrelationFlow {
+	now := time.Now()
+	flows := []CorrelationFlow{}
+	x.forEachSource(func(iface string, fm *flowMutex) {
+		index := make(map[uint64]int)
+		fm.forEachTracedFlow(func(flowID uint64, streamID uint32, sequence uint32, tf *TracedFlow) {
+			i, ok := index[flowID]
+			if !ok {
+				i = len(flows)
+				index[flowID] = i
+				flows = append(flows, CorrelationFlow{
+					Iface:  iface,
+					FlowID: flowID,
+					Serial: *tf.lock.serial,
+					Age:    durationMillis(now.Sub(*tf.lock.createdAt)),
+				})
+			}
+			flow := &flows[i]
+			if len(flow.Streams) == 0 || flow.Streams[len(flow.Streams)-1].StreamID != streamID {
+				flow.Streams = append(flow.Streams, CorrelationStream{StreamID: streamID})
+			}
+			stream := &flow.Streams[len(flow.Streams)-1]
+			request := CorrelationRequest{
+				Sequence: sequence,
+				TraceID:  *tf.ts.traceID,
+				Active:   tf.isActive.Load(),
+				Age:      durationMillis(now.Sub(tf.trackedAt)),
+			}
+			if tf.ts.spanID != nil {
+				request.SpanID = *tf.ts.spanID
+			}
+			stream.Requests = append(stream.Requests, request)
+		})
+	})
+	slices.SortFunc(flows, func(a, b CorrelationFlow) int {
+		return cmp.Compare(b.Age, a.Age)
+	})
+	return flows
+}
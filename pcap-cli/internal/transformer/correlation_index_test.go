@@ -0,0 +1,76 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alphadose/haxmap"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestCorrelationIndex verifies that traced requests are reported per trace and per flow, and that untracked flows are forgotten.
+func TestCorrelationIndex(t *testing.T) {
+	t.Parallel()
+
+	fm := &flowMutex{
+		MutexMap:                  haxmap.New[uint64, *flowLockCarrier](),
+		flowToStreamToSequenceMap: haxmap.New[uint64, STSM](),
+		traceToHttpRequestMap:     haxmap.New[string, *httpRequest](),
+	}
+	index := NewCorrelationIndex()
+	index.register("eth0", fm)
+	assert.Empty(t, index.Traces())
+	assert.Empty(t, index.Flows())
+
+	serial, flowID := uint64(7), uint64(42)
+	lock := fm.newFlowLockCarrier(&serial, &flowID)
+	traceID, spanID, streamID := "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", uint32(1)
+	method, url := "GET", "example.com/ping"
+	timestamp := time.Now().Add(-time.Second)
+	fm.traceToHttpRequestMap.Set(traceID, &httpRequest{timestamp: &timestamp, method: &method, url: &url})
+
+	var tcpFlags uint8
+	seq, ack := uint32(1000), uint32(2000)
+	_, tracked := fm.trackConnection(context.Background(), lock, &serial, &flowID, &tcpFlags, &seq, &ack, false,
+		&traceAndSpan{traceID: &traceID, spanID: &spanID, streamID: &streamID})
+	assert.True(t, tracked)
+
+	traces := index.Traces()
+	if assert.Len(t, traces, 1) {
+		assert.Equal(t, "eth0", traces[0].Iface)
+		assert.Equal(t, "GET", traces[0].Method)
+		assert.Equal(t, "example.com/ping", traces[0].URL)
+		assert.GreaterOrEqual(t, traces[0].Age, 1000.0)
+		assert.Equal(t, []CorrelationStreamRef{{FlowID: 42, StreamID: 1}}, traces[0].Streams)
+	}
+
+	flows := index.Flows()
+	if assert.Len(t, flows, 1) && assert.Len(t, flows[0].Streams, 1) {
+		assert.Equal(t, uint64(7), flows[0].Serial)
+		requests := flows[0].Streams[0].Requests
+		if assert.Len(t, requests, 1) {
+			assert.Equal(t, uint32(1000), requests[0].Sequence)
+			assert.Equal(t, spanID, requests[0].SpanID)
+			assert.True(t, requests[0].Active)
+		}
+	}
+
+	fm.untrackConnection(context.Background(), &flowID, lock, "test")
+	assert.Empty(t, index.Traces())
+	assert.Empty(t, index.Flows())
+}
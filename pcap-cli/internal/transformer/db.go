@@ -0,0 +1,476 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+	"strings"
+
+	"github.com/Jeffail/gabs/v2"
+)
+
+type (
+	dbProtocol string
+
+	// dbMessage summarizes a database wire protocol message;
+	// query text and error messages are only available if explicitly enabled.
+	dbMessage struct {
+		kind     string
+		count    int
+		tag      string
+		auth     string
+		status   string
+		user     string
+		database string
+		version  string
+		severity string
+		sqlstate string
+		code     uint16
+		message  string
+		query    string
+	}
+
+	// dbPorts identifies database flows by the server port; i/e: `postgres:5432`, `mysql:3306`.
+	dbPorts struct {
+		ports   map[uint16]dbProtocol
+		queries bool
+	}
+)
+
+const (
+	dbProtocolPostgres dbProtocol = "postgres"
+	dbProtocolMySQL    dbProtocol = "mysql"
+
+	// messages beyond this limit are not reported for a single TCP segment
+	dbMessagesLimit = 16
+	// query text longer than this limit is truncated
+	dbQueryLimit = 512
+
+	// see: https://www.postgresql.org/docs/current/protocol-message-formats.html
+	postgresProtocolVersion3 = 196608
+	postgresCancelRequest    = 80877102
+	postgresSSLRequest       = 80877103
+	postgresGSSENCRequest    = 80877104
+
+	// see: https://dev.mysql.com/doc/dev/mysql-server/latest/page_protocol_basic_packets.html
+	mysqlHeaderLen              = 4
+	mysqlProtocolVersion10      = 0x0a
+	mysqlClientSSL              = 0x00000800
+	mysqlSSLRequestLen          = 32
+	mysqlHandshakeResponseFixed = 32
+)
+
+var (
+	postgresFrontendMessages = map[byte]string{
+		'B': "Bind", 'C': "Close", 'd': "CopyData", 'c': "CopyDone", 'f': "CopyFail",
+		'D': "Describe", 'E': "Execute", 'H': "Flush", 'F': "FunctionCall", 'P': "Parse",
+		'p': "PasswordMessage", 'Q': "Query", 'S': "Sync", 'X': "Terminate",
+	}
+
+	postgresBackendMessages = map[byte]string{
+		'R': "Authentication", 'K': "BackendKeyData", '2': "BindComplete", '3': "CloseComplete",
+		'C': "CommandComplete", 'd': "CopyData", 'c': "CopyDone", 'G': "CopyInResponse",
+		'H': "CopyOutResponse", 'W': "CopyBothResponse", 'D': "DataRow", 'I': "EmptyQueryResponse",
+		'E': "ErrorResponse", 'V': "FunctionCallResponse", 'v': "NegotiateProtocolVersion",
+		'n': "NoData", 'N': "NoticeResponse", 'A': "NotificationResponse", 't': "ParameterDescription",
+		'S': "ParameterStatus", '1': "ParseComplete", 's': "PortalSuspended", 'Z': "ReadyForQuery",
+		'T': "RowDescription",
+	}
+
+	postgresAuthentications = map[uint32]string{
+		0: "ok", 2: "kerberos", 3: "cleartext", 5: "md5", 7: "gss", 8: "gss_continue",
+		9: "sspi", 10: "sasl", 11: "sasl_continue", 12: "sasl_final",
+	}
+
+	// see: https://www.postgresql.org/docs/current/protocol-message-types.html#PROTOCOL-MESSAGE-TYPES-READY-FOR-QUERY
+	postgresTransactionStatuses = map[byte]string{
+		'I': "idle", 'T': "transaction", 'E': "failed",
+	}
+
+	mysqlCommands = map[byte]string{
+		0x01: "COM_QUIT", 0x02: "COM_INIT_DB", 0x03: "COM_QUERY", 0x04: "COM_FIELD_LIST",
+		0x08: "COM_SHUTDOWN", 0x09: "COM_STATISTICS", 0x0a: "COM_PROCESS_INFO", 0x0d: "COM_DEBUG",
+		0x0e: "COM_PING", 0x11: "COM_CHANGE_USER", 0x12: "COM_BINLOG_DUMP", 0x16: "COM_STMT_PREPARE",
+		0x17: "COM_STMT_EXECUTE", 0x18: "COM_STMT_SEND_LONG_DATA", 0x19: "COM_STMT_CLOSE",
+		0x1a: "COM_STMT_RESET", 0x1b: "COM_SET_OPTION", 0x1c: "COM_STMT_FETCH", 0x1f: "COM_RESET_CONNECTION",
+	}
+
+	// the class of SQLSTATE codes is shared by PostgreSQL and MySQL;
+	// see: https://www.postgresql.org/docs/current/errcodes-appendix.html
+	dbSQLStateClasses = map[string]string{
+		"08": "connection_exception",
+		"0A": "feature_not_supported",
+		"22": "data_exception",
+		"23": "integrity_constraint_violation",
+		"25": "invalid_transaction_state",
+		"28": "invalid_authorization_specification",
+		"3D": "invalid_catalog_name",
+		"40": "transaction_rollback",
+		"42": "syntax_error_or_access_rule_violation",
+		"53": "insufficient_resources",
+		"54": "program_limit_exceeded",
+		"55": "object_not_in_prerequisite_state",
+		"57": "operator_intervention",
+		"58": "system_error",
+		"HY": "general_error",
+		"XX": "internal_error",
+	}
+)
+
+// newDBPorts returns `nil` if no database ports are configured; entries are `{protocol}:{port}`.
+func newDBPorts(entries []string, queries bool) *dbPorts {
+	ports := make(map[uint16]dbProtocol, len(entries))
+	for _, entry := range entries {
+		rawProtocol, rawPort, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok {
+			continue
+		}
+		port, err := strconv.ParseUint(rawPort, 10, 16)
+		if err != nil {
+			continue
+		}
+		switch protocol := dbProtocol(strings.ToLower(rawProtocol)); protocol {
+		case dbProtocolPostgres, dbProtocolMySQL:
+			ports[uint16(port)] = protocol
+		case "postgresql":
+			ports[uint16(port)] = dbProtocolPostgres
+		}
+	}
+	if len(ports) == 0 {
+		return nil
+	}
+	return &dbPorts{ports: ports, queries: queries}
+}
+
+// lookup returns whether the segment was sent by the client: segments sent to the server port are.
+func (d *dbPorts) lookup(srcPort, dstPort uint16) (dbProtocol, bool, bool) {
+	if protocol, ok := d.ports[dstPort]; ok {
+		return protocol, true, true
+	}
+	if protocol, ok := d.ports[srcPort]; ok {
+		return protocol, false, true
+	}
+	return "", false, false
+}
+
+func (d *dbPorts) query(query []byte) string {
+	if !d.queries {
+		return ""
+	}
+	if len(query) > dbQueryLimit {
+		return string(query[:dbQueryLimit-3]) + "..."
+	}
+	return string(query)
+}
+
+// isDBTLSRecord returns whether data is a TLS record: connections are encrypted after a TLS request is accepted.
+func isDBTLSRecord(data []byte) bool {
+	return len(data) >= 3 && data[0] >= 0x14 && data[0] <= 0x17 && data[1] == 0x03 && data[2] <= 0x04
+}
+
+func dbCString(data []byte) (string, []byte) {
+	value, rest, ok := bytes.Cut(data, []byte{0})
+	if !ok {
+		return "", nil
+	}
+	return string(value), rest
+}
+
+func (d *dbPorts) messages(protocol dbProtocol, data []byte, fromClient bool) []*dbMessage {
+	if isDBTLSRecord(data) {
+		return nil
+	}
+	if protocol == dbProtocolPostgres {
+		return d.postgresMessages(data, fromClient)
+	}
+	return d.mysqlMessages(data, fromClient)
+}
+
+// postgresMessages returns all complete messages carried by a segment; consecutive messages of the same type are collapsed.
+func (d *dbPorts) postgresMessages(data []byte, fromClient bool) []*dbMessage {
+	messages := make([]*dbMessage, 0, 1)
+
+	// startup messages do not have a type; their length is always lower than 2^24
+	if fromClient && len(data) >= 8 && data[0] == 0 {
+		length := int(binary.BigEndian.Uint32(data[0:4]))
+		if length < 8 || length > len(data) {
+			return nil
+		}
+		switch code := binary.BigEndian.Uint32(data[4:8]); code {
+		case postgresSSLRequest:
+			messages = append(messages, &dbMessage{kind: "SSLRequest"})
+		case postgresGSSENCRequest:
+			messages = append(messages, &dbMessage{kind: "GSSENCRequest"})
+		case postgresCancelRequest:
+			messages = append(messages, &dbMessage{kind: "CancelRequest"})
+		default:
+			message := &dbMessage{
+				kind:    "StartupMessage",
+				version: strconv.FormatUint(uint64(code>>16), 10) + "." + strconv.FormatUint(uint64(code&0xffff), 10),
+			}
+			// parameters are pairs of null terminated strings
+			parameters := data[8:length]
+			for len(parameters) > 1 {
+				var key, value string
+				key, parameters = dbCString(parameters)
+				value, parameters = dbCString(parameters)
+				switch key {
+				case "user":
+					message.user = value
+				case "database":
+					message.database = value
+				}
+			}
+			messages = append(messages, message)
+		}
+		return messages
+	}
+
+	// the answer to `SSLRequest` and `GSSENCRequest` is a single byte
+	if !fromClient && len(data) == 1 && (data[0] == 'S' || data[0] == 'N') {
+		return append(messages, &dbMessage{kind: "SSLResponse", status: map[byte]string{'S': "accepted", 'N': "rejected"}[data[0]]})
+	}
+
+	names := postgresBackendMessages
+	if fromClient {
+		names = postgresFrontendMessages
+	}
+
+	for len(data) >= 5 && len(messages) < dbMessagesLimit {
+		name, ok := names[data[0]]
+		if !ok {
+			break
+		}
+		length := int(binary.BigEndian.Uint32(data[1:5]))
+		if length < 4 {
+			break
+		}
+		body := data[5:min(len(data), length+1)]
+
+		if last := len(messages) - 1; last >= 0 && messages[last].kind == name && data[0] != 'E' {
+			messages[last].count += 1
+		} else {
+			messages = append(messages, d.postgresMessage(name, data[0], body, fromClient))
+		}
+
+		if length+1 > len(data) {
+			// the rest of the message is carried by the next segments
+			break
+		}
+		data = data[length+1:]
+	}
+
+	return messages
+}
+
+func (d *dbPorts) postgresMessage(name string, kind byte, body []byte, fromClient bool) *dbMessage {
+	message := &dbMessage{kind: name, count: 1}
+
+	if fromClient {
+		switch kind {
+		case 'Q':
+			query, _, _ := bytes.Cut(body, []byte{0})
+			message.query = d.query(query)
+		case 'P':
+			// statement name, and then the query text
+			_, rest := dbCString(body)
+			query, _, _ := bytes.Cut(rest, []byte{0})
+			message.query = d.query(query)
+		}
+		return message
+	}
+
+	switch kind {
+	case 'R':
+		if len(body) >= 4 {
+			code := binary.BigEndian.Uint32(body[0:4])
+			if auth, ok := postgresAuthentications[code]; ok {
+				message.auth = auth
+			} else {
+				message.auth = strconv.FormatUint(uint64(code), 10)
+			}
+		}
+	case 'C':
+		// i/e: `SELECT 5`, `INSERT 0 1`; only the command is kept
+		tag, _ := dbCString(body)
+		message.tag, _, _ = strings.Cut(tag, " ")
+	case 'Z':
+		if len(body) >= 1 {
+			message.status = postgresTransactionStatuses[body[0]]
+		}
+	case 'E', 'N':
+		// fields are a type byte followed by a null terminated string
+		for len(body) > 1 && body[0] != 0 {
+			field := body[0]
+			var value string
+			value, body = dbCString(body[1:])
+			switch field {
+			case 'V':
+				message.severity = value
+			case 'S':
+				if message.severity == "" {
+					message.severity = value
+				}
+			case 'C':
+				message.sqlstate = value
+			case 'M':
+				if d.queries {
+					message.message = value
+				}
+			}
+		}
+	}
+
+	return message
+}
+
+// mysqlMessages returns the 1st packet carried by a segment: the other ones are usually parts of the same response.
+func (d *dbPorts) mysqlMessages(data []byte, fromClient bool) []*dbMessage {
+	if len(data) < mysqlHeaderLen+1 {
+		return nil
+	}
+
+	length := int(data[0]) | int(data[1])<<8 | int(data[2])<<16
+	sequence := data[3]
+	payload := data[mysqlHeaderLen:min(len(data), mysqlHeaderLen+length)]
+	if length == 0 || len(payload) == 0 {
+		return nil
+	}
+
+	message := &dbMessage{count: 1}
+
+	if fromClient {
+		if sequence == 0 {
+			// the sequence is reset for every command
+			command, ok := mysqlCommands[payload[0]]
+			if !ok {
+				command = "0x" + strconv.FormatUint(uint64(payload[0]), 16)
+			}
+			message.kind = command
+			switch payload[0] {
+			case 0x03, 0x16:
+				message.query = d.query(payload[1:])
+			case 0x02:
+				message.database = string(payload[1:])
+			}
+			return []*dbMessage{message}
+		}
+
+		if len(payload) < mysqlHandshakeResponseFixed {
+			message.kind = "AuthData"
+			return []*dbMessage{message}
+		}
+
+		capabilities := binary.LittleEndian.Uint32(payload[0:4])
+		if length == mysqlSSLRequestLen && capabilities&mysqlClientSSL != 0 {
+			message.kind = "SSLRequest"
+			return []*dbMessage{message}
+		}
+
+		message.kind = "HandshakeResponse"
+		message.user, _ = dbCString(payload[mysqlHandshakeResponseFixed:])
+		return []*dbMessage{message}
+	}
+
+	switch payload[0] {
+	case 0x00:
+		message.kind = "OK"
+	case 0xff:
+		message.kind = "ERR"
+		if len(payload) >= 3 {
+			message.code = binary.LittleEndian.Uint16(payload[1:3])
+		}
+		rest := payload[min(len(payload), 3):]
+		if len(rest) >= 6 && rest[0] == '#' {
+			message.sqlstate = string(rest[1:6])
+			rest = rest[6:]
+		}
+		if d.queries {
+			message.message = string(rest)
+		}
+	case 0xfe:
+		if length < 9 {
+			message.kind = "EOF"
+		} else {
+			message.kind = "AuthSwitchRequest"
+			message.auth, _ = dbCString(payload[1:])
+		}
+	case 0x01:
+		message.kind = "AuthMoreData"
+	case mysqlProtocolVersion10:
+		if sequence != 0 {
+			message.kind = "ResultSet"
+			break
+		}
+		message.kind = "Handshake"
+		message.version, _ = dbCString(payload[1:])
+	default:
+		// the 1st packet of a result set is the number of columns
+		message.kind = "ResultSet"
+	}
+
+	return []*dbMessage{message}
+}
+
+func (m *dbMessage) toJSON() *gabs.Container {
+	messageJSON := gabs.New()
+	messageJSON.Set(m.kind, "type")
+	if m.count > 1 {
+		messageJSON.Set(m.count, "count")
+	}
+	fields := []struct {
+		key, value string
+	}{
+		{"tag", m.tag}, {"auth", m.auth}, {"status", m.status}, {"user", m.user},
+		{"database", m.database}, {"version", m.version}, {"severity", m.severity},
+		{"sqlstate", m.sqlstate}, {"message", m.message}, {"query", m.query},
+	}
+	for _, field := range fields {
+		if field.value != "" {
+			messageJSON.Set(field.value, field.key)
+		}
+	}
+	if m.code != 0 {
+		messageJSON.Set(m.code, "code")
+	}
+	if class, ok := dbSQLStateClasses[m.sqlstateClass()]; ok {
+		messageJSON.Set(class, "class")
+	}
+	return messageJSON
+}
+
+func (m *dbMessage) sqlstateClass() string {
+	if len(m.sqlstate) < 2 {
+		return ""
+	}
+	return m.sqlstate[:2]
+}
+
+// summary is used in translation messages; i/e: `ErrorResponse:28P01`, `CommandComplete:SELECT`.
+func (m *dbMessage) summary() string {
+	switch {
+	case m.sqlstate != "":
+		return m.kind + ":" + m.sqlstate
+	case m.tag != "":
+		return m.kind + ":" + m.tag
+	case m.auth != "":
+		return m.kind + ":" + m.auth
+	case m.status != "":
+		return m.kind + ":" + m.status
+	}
+	return m.kind
+}
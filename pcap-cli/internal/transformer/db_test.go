@@ -0,0 +1,173 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newPostgresTestMessage(kind byte, body ...byte) []byte {
+	message := []byte{kind, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(message[1:5], uint32(len(body)+4))
+	return append(message, body...)
+}
+
+func newMySQLTestPacket(sequence byte, payload ...byte) []byte {
+	return append([]byte{byte(len(payload)), byte(len(payload) >> 8), byte(len(payload) >> 16), sequence}, payload...)
+}
+
+// TestDBPorts verifies that invalid entries are ignored, and that clients send segments to the server port.
+func TestDBPorts(t *testing.T) {
+	t.Parallel()
+
+	assert.Nil(t, newDBPorts([]string{"", "redis:6379", "mysql", "mysql:port"}, false))
+
+	dbs := newDBPorts([]string{"postgresql:5432", " MySQL:3306"}, false)
+	assert.NotNil(t, dbs)
+
+	protocol, fromClient, ok := dbs.lookup(40000, 5432)
+	assert.True(t, ok)
+	assert.True(t, fromClient)
+	assert.Equal(t, dbProtocolPostgres, protocol)
+
+	protocol, fromClient, ok = dbs.lookup(3306, 40000)
+	assert.True(t, ok)
+	assert.False(t, fromClient)
+	assert.Equal(t, dbProtocolMySQL, protocol)
+}
+
+// TestPostgresStartup verifies that TLS requests and startup parameters are decoded.
+func TestPostgresStartup(t *testing.T) {
+	t.Parallel()
+
+	dbs := newDBPorts([]string{"postgres:5432"}, false)
+
+	messages := dbs.messages(dbProtocolPostgres, []byte{0, 0, 0, 8, 0x04, 0xd2, 0x16, 0x2f}, true)
+	if assert.Len(t, messages, 1) {
+		assert.Equal(t, "SSLRequest", messages[0].kind)
+	}
+
+	messages = dbs.messages(dbProtocolPostgres, []byte{'S'}, false)
+	if assert.Len(t, messages, 1) {
+		assert.Equal(t, "SSLResponse:accepted", messages[0].summary())
+	}
+
+	parameters := []byte("user\x00app\x00database\x00orders\x00\x00")
+	startup := make([]byte, 8, 8+len(parameters))
+	binary.BigEndian.PutUint32(startup[0:4], uint32(8+len(parameters)))
+	binary.BigEndian.PutUint32(startup[4:8], postgresProtocolVersion3)
+	messages = dbs.messages(dbProtocolPostgres, append(startup, parameters...), true)
+	if assert.Len(t, messages, 1) {
+		assert.Equal(t, "StartupMessage", messages[0].kind)
+		assert.Equal(t, "3.0", messages[0].version)
+		assert.Equal(t, "app", messages[0].user)
+		assert.Equal(t, "orders", messages[0].database)
+	}
+
+	// connections are encrypted after the TLS request is accepted
+	assert.Empty(t, dbs.messages(dbProtocolPostgres, []byte{0x16, 0x03, 0x01, 0x00, 0x10}, true))
+}
+
+// TestPostgresMessages verifies that errors are reported with their SQLSTATE, and that queries are only reported if enabled.
+func TestPostgresMessages(t *testing.T) {
+	t.Parallel()
+
+	query := newPostgresTestMessage('Q', []byte("SELECT 1\x00")...)
+
+	messages := newDBPorts([]string{"postgres:5432"}, false).messages(dbProtocolPostgres, query, true)
+	if assert.Len(t, messages, 1) {
+		assert.Equal(t, "Query", messages[0].kind)
+		assert.Empty(t, messages[0].query)
+	}
+
+	dbs := newDBPorts([]string{"postgres:5432"}, true)
+	messages = dbs.messages(dbProtocolPostgres, query, true)
+	if assert.Len(t, messages, 1) {
+		assert.Equal(t, "SELECT 1", messages[0].query)
+	}
+
+	data := newPostgresTestMessage('E', []byte("SFATAL\x00VFATAL\x00C28P01\x00Mpassword authentication failed\x00\x00")...)
+	messages = dbs.messages(dbProtocolPostgres, data, false)
+	if assert.Len(t, messages, 1) {
+		assert.Equal(t, "ErrorResponse:28P01", messages[0].summary())
+		assert.Equal(t, "FATAL", messages[0].severity)
+		assert.Equal(t, "password authentication failed", messages[0].message)
+		assert.Equal(t, "invalid_authorization_specification", messages[0].toJSON().S("class").Data())
+	}
+
+	// consecutive messages of the same type are collapsed
+	data = newPostgresTestMessage('R', 0, 0, 0, 0)
+	data = append(data, newPostgresTestMessage('S', []byte("TimeZone\x00UTC\x00")...)...)
+	data = append(data, newPostgresTestMessage('S', []byte("DateStyle\x00ISO\x00")...)...)
+	data = append(data, newPostgresTestMessage('C', []byte("SELECT 5\x00")...)...)
+	data = append(data, newPostgresTestMessage('Z', 'I')...)
+	messages = dbs.messages(dbProtocolPostgres, data, false)
+	summaries := make([]string, 0, len(messages))
+	for _, message := range messages {
+		summaries = append(summaries, message.summary())
+	}
+	assert.Equal(t, []string{"Authentication:ok", "ParameterStatus", "CommandComplete:SELECT", "ReadyForQuery:idle"}, summaries)
+	assert.Equal(t, 2, messages[1].count)
+}
+
+// TestMySQLMessages verifies that handshakes, commands, and errors are decoded.
+func TestMySQLMessages(t *testing.T) {
+	t.Parallel()
+
+	dbs := newDBPorts([]string{"mysql:3306"}, false)
+
+	messages := dbs.messages(dbProtocolMySQL, newMySQLTestPacket(0, append([]byte{mysqlProtocolVersion10}, "8.0.36\x00"...)...), false)
+	if assert.Len(t, messages, 1) {
+		assert.Equal(t, "Handshake", messages[0].kind)
+		assert.Equal(t, "8.0.36", messages[0].version)
+	}
+
+	sslRequest := make([]byte, mysqlSSLRequestLen)
+	binary.LittleEndian.PutUint32(sslRequest[0:4], mysqlClientSSL)
+	messages = dbs.messages(dbProtocolMySQL, newMySQLTestPacket(1, sslRequest...), true)
+	if assert.Len(t, messages, 1) {
+		assert.Equal(t, "SSLRequest", messages[0].kind)
+	}
+
+	handshakeResponse := make([]byte, mysqlHandshakeResponseFixed)
+	handshakeResponse = append(handshakeResponse, "app\x00"...)
+	messages = dbs.messages(dbProtocolMySQL, newMySQLTestPacket(1, handshakeResponse...), true)
+	if assert.Len(t, messages, 1) {
+		assert.Equal(t, "HandshakeResponse", messages[0].kind)
+		assert.Equal(t, "app", messages[0].user)
+	}
+
+	messages = dbs.messages(dbProtocolMySQL, newMySQLTestPacket(0, append([]byte{0x03}, "SELECT 1"...)...), true)
+	if assert.Len(t, messages, 1) {
+		assert.Equal(t, "COM_QUERY", messages[0].kind)
+		assert.Empty(t, messages[0].query)
+	}
+
+	errPayload := append([]byte{0xff, 0x15, 0x04}, "#28000Access denied"...)
+	messages = dbs.messages(dbProtocolMySQL, newMySQLTestPacket(2, errPayload...), false)
+	if assert.Len(t, messages, 1) {
+		assert.Equal(t, "ERR:28000", messages[0].summary())
+		assert.Equal(t, uint16(1045), messages[0].code)
+		assert.Empty(t, messages[0].message)
+	}
+
+	messages = dbs.messages(dbProtocolMySQL, newMySQLTestPacket(1, 0x02), false)
+	if assert.Len(t, messages, 1) {
+		assert.Equal(t, "ResultSet", messages[0].kind)
+	}
+}
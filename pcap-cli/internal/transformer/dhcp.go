@@ -0,0 +1,131 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/google/gopacket/layers"
+)
+
+type (
+	dhcpOption struct {
+		name, value string
+	}
+)
+
+const (
+	// IA_NA and IA_TA options contain IAADDR options after their fixed fields
+	//   - see: https://www.rfc-editor.org/rfc/rfc8415#section-21.4
+	dhcpv6IANAHeaderLen = 12
+	dhcpv6IATAHeaderLen = 4
+	// IAADDR: IPv6 address, preferred and valid lifetimes
+	//   - see: https://www.rfc-editor.org/rfc/rfc8415#section-21.6
+	dhcpv6IAAddrLen = 24
+)
+
+// dhcpOptionValue strips the `Option({name}:...)` decoration added by `gopacket` to option values.
+func dhcpOptionValue(option fmt.Stringer, name string) string {
+	value := strings.TrimPrefix(option.String(), "Option("+name+":")
+	return strings.TrimSuffix(value, ")")
+}
+
+func dhcpv4Options(dhcp *layers.DHCPv4) []*dhcpOption {
+	options := make([]*dhcpOption, 0, len(dhcp.Options))
+	for _, option := range dhcp.Options {
+		if option.Type == layers.DHCPOptPad || option.Type == layers.DHCPOptEnd {
+			continue
+		}
+		name := option.Type.String()
+		options = append(options, &dhcpOption{name, dhcpOptionValue(option, name)})
+	}
+	return options
+}
+
+// dhcpv4MessageType returns the value of option `53`; i/e: `Discover`, `Offer`, `Request` or `Ack`.
+func dhcpv4MessageType(dhcp *layers.DHCPv4) string {
+	for _, option := range dhcp.Options {
+		if option.Type == layers.DHCPOptMessageType && len(option.Data) == 1 {
+			return layers.DHCPMsgType(option.Data[0]).String()
+		}
+	}
+	return dhcp.Operation.String()
+}
+
+// dhcpv4IPOption returns the IP address carried by option `optionType`; i/e: requested IP or server ID.
+func dhcpv4IPOption(dhcp *layers.DHCPv4, optionType layers.DHCPOpt) net.IP {
+	for _, option := range dhcp.Options {
+		if option.Type == optionType && len(option.Data) == net.IPv4len {
+			return net.IP(option.Data)
+		}
+	}
+	return nil
+}
+
+func dhcpv6Options(dhcp *layers.DHCPv6) []*dhcpOption {
+	options := make([]*dhcpOption, 0, len(dhcp.Options))
+	for _, option := range dhcp.Options {
+		name := option.Code.String()
+		options = append(options, &dhcpOption{name, dhcpOptionValue(option, name)})
+	}
+	return options
+}
+
+// dhcpv6TransactionID returns the 24 bits transaction ID
+func dhcpv6TransactionID(dhcp *layers.DHCPv6) uint32 {
+	if len(dhcp.TransactionID) != 3 {
+		return 0
+	}
+	return binary.BigEndian.Uint32(append([]byte{0}, dhcp.TransactionID...))
+}
+
+// dhcpv6Addresses returns the addresses carried by IA_NA and IA_TA options:
+// requested by clients in `Solicit`/`Request`, and assigned by servers in `Advertise`/`Reply`.
+func dhcpv6Addresses(dhcp *layers.DHCPv6) []net.IP {
+	addresses := []net.IP{}
+	for _, option := range dhcp.Options {
+		var data []byte
+		switch option.Code {
+		case layers.DHCPv6OptIANA:
+			if len(option.Data) < dhcpv6IANAHeaderLen {
+				continue
+			}
+			data = option.Data[dhcpv6IANAHeaderLen:]
+		case layers.DHCPv6OptIATA:
+			if len(option.Data) < dhcpv6IATAHeaderLen {
+				continue
+			}
+			data = option.Data[dhcpv6IATAHeaderLen:]
+		default:
+			continue
+		}
+		// nested options: code ( 2 bytes ), length ( 2 bytes ), and data
+		for len(data) >= 4 {
+			code := layers.DHCPv6Opt(binary.BigEndian.Uint16(data[0:2]))
+			length := int(binary.BigEndian.Uint16(data[2:4]))
+			if len(data) < 4+length {
+				break
+			}
+			if code == layers.DHCPv6OptIAAddr && length >= dhcpv6IAAddrLen {
+				addresses = append(addresses, net.IP(data[4:4+net.IPv6len]))
+			}
+			data = data[4+length:]
+		}
+	}
+	return addresses
+}
@@ -0,0 +1,86 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestDHCPv4 verifies that message types and addresses are extracted from DHCPv4 options.
+func TestDHCPv4(t *testing.T) {
+	t.Parallel()
+
+	request := &layers.DHCPv4{
+		Operation:    layers.DHCPOpRequest,
+		HardwareType: layers.LinkTypeEthernet,
+		HardwareLen:  6,
+		Xid:          0x3903f326,
+		ClientIP:     net.IPv4zero,
+		YourClientIP: net.IPv4zero,
+		NextServerIP: net.IPv4zero,
+		RelayAgentIP: net.IPv4zero,
+		ClientHWAddr: net.HardwareAddr{0x42, 0x01, 0x0a, 0x80, 0x00, 0x02},
+		Options: layers.DHCPOptions{
+			layers.NewDHCPOption(layers.DHCPOptMessageType, []byte{byte(layers.DHCPMsgTypeRequest)}),
+			layers.NewDHCPOption(layers.DHCPOptRequestIP, net.IPv4(10, 128, 0, 2).To4()),
+			layers.NewDHCPOption(layers.DHCPOptHostname, []byte("gke-node")),
+			layers.NewDHCPOption(layers.DHCPOptEnd, nil),
+		},
+	}
+
+	buffer := gopacket.NewSerializeBuffer()
+	assert.NoError(t, gopacket.SerializeLayers(buffer, gopacket.SerializeOptions{FixLengths: true}, request))
+
+	packet := gopacket.NewPacket(buffer.Bytes(), layers.LayerTypeDHCPv4, gopacket.Default)
+	dhcp, ok := packet.Layer(layers.LayerTypeDHCPv4).(*layers.DHCPv4)
+	assert.True(t, ok)
+
+	assert.Equal(t, "Request", dhcpv4MessageType(dhcp))
+	assert.Equal(t, "10.128.0.2", dhcpv4IPOption(dhcp, layers.DHCPOptRequestIP).String())
+	assert.Nil(t, dhcpv4IPOption(dhcp, layers.DHCPOptServerID))
+
+	options := dhcpv4Options(dhcp)
+	assert.Len(t, options, 3)
+	assert.Equal(t, &dhcpOption{"Hostname", "gke-node"}, options[2])
+}
+
+// TestDHCPv6 verifies that addresses are extracted from the IAADDR options nested in IA_NA options.
+func TestDHCPv6(t *testing.T) {
+	t.Parallel()
+
+	address := net.ParseIP("2001:db8::10")
+	iaAddr := append([]byte{0x00, 0x05, 0x00, 0x18}, address...)
+	iaAddr = append(iaAddr, 0, 0, 0x0e, 0x10, 0, 0, 0x1c, 0x20)
+	iaNA := append([]byte{0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0}, iaAddr...)
+
+	reply := &layers.DHCPv6{
+		MsgType:       layers.DHCPv6MsgTypeReply,
+		TransactionID: []byte{0x0a, 0x0b, 0x0c},
+		Options: layers.DHCPv6Options{
+			layers.NewDHCPv6Option(layers.DHCPv6OptIANA, iaNA),
+			// truncated options are ignored
+			layers.NewDHCPv6Option(layers.DHCPv6OptIATA, []byte{0, 0}),
+		},
+	}
+
+	assert.Equal(t, uint32(0x0a0b0c), dhcpv6TransactionID(reply))
+	assert.Equal(t, []net.IP{address}, dhcpv6Addresses(reply))
+	assert.Len(t, dhcpv6Options(reply), 2)
+}
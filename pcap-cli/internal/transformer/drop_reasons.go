@@ -0,0 +1,126 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"log/slog"
+	"sync/atomic"
+)
+
+type (
+	// DropReason is why a packet was read, but its translation was not written.
+	DropReason uint8
+
+	// DropCounters count packets which were not written, per reason:
+	//   - engines count the packets they discard before applying them, and share their counters with their transformers,
+	//   - `DropQueueFull`, and `DropCancelled` once a translation was published, count translations per writer.
+	DropCounters struct {
+		counters [dropReasons]atomic.Uint64
+	}
+
+	// packetDrops counts the drops of a transformer, and logs 1 out of every `rate` of them per reason as a `dropped` record.
+	packetDrops struct {
+		counters *DropCounters
+		rate     uint64
+		logger   *slog.Logger
+	}
+)
+
+const (
+	// rejected by the filters of the engine, the filters of the transformer, or payload rules
+	DropFiltered DropReason = iota
+	// read while the engine was paused
+	DropPaused
+	// the flow was not sampled; see `ContextFlowSampling` and `ContextLatencyBudgetSampling`
+	DropSampled
+	// the flow exhausted its budget; see `ContextFlowBudget`
+	DropFlowBudget
+	// the flow did not carry a trace of interest; see `ContextTraceScope`
+	DropOutOfScope
+	// the transformer was done before the translation was written
+	DropCancelled
+	// translating the packet panicked, and the panic was recovered
+	DropPanic
+	// the translator did not produce a translation
+	DropFailed
+	// the queue of a writer was full; see `ContextDropOnFullQueue`
+	DropQueueFull
+	dropReasons
+)
+
+var dropReasonNames = [dropReasons]string{
+	"filtered", "paused", "sampled", "flow_budget", "out_of_scope", "cancelled", "panic", "failed", "queue_full",
+}
+
+func (r DropReason) String() string {
+	if r < dropReasons {
+		return dropReasonNames[r]
+	}
+	return "unknown"
+}
+
+func NewDropCounters() *DropCounters {
+	return &DropCounters{}
+}
+
+// Add counts 1 packet dropped for `reason`, and returns how many were dropped for it so far.
+func (c *DropCounters) Add(reason DropReason) uint64 {
+	if c == nil || reason >= dropReasons {
+		return 0
+	}
+	return c.counters[reason].Add(1)
+}
+
+// Counts returns how many packets were dropped per reason, including reasons without drops.
+func (c *DropCounters) Counts() map[string]uint64 {
+	counts := make(map[string]uint64, dropReasons)
+	for reason := range dropReasons {
+		var dropped uint64
+		if c != nil {
+			dropped = c.counters[reason].Load()
+		}
+		counts[reason.String()] = dropped
+	}
+	return counts
+}
+
+// newPacketDrops counts into `counters`, which are not shared with the engine if `nil`; `rate` 0 logs no records.
+func newPacketDrops(counters *DropCounters, rate uint, logger *slog.Logger) *packetDrops {
+	if counters == nil {
+		counters = NewDropCounters()
+	}
+	return &packetDrops{
+		counters: counters,
+		rate:     uint64(rate),
+		logger:   logger,
+	}
+}
+
+// drop counts a packet dropped for `reason`; `serial` is `nil` if the packet is not known.
+func (d *packetDrops) drop(reason DropReason, serial *uint64) {
+	if d == nil {
+		return
+	}
+	dropped := d.counters.Add(reason)
+	// the 1st drop of every reason is always logged
+	if d.rate == 0 || (dropped-1)%d.rate != 0 {
+		return
+	}
+	attrs := []any{"reason", reason.String(), "dropped", dropped}
+	if serial != nil {
+		attrs = append(attrs, "serial", *serial)
+	}
+	d.logger.Info("dropped", attrs...)
+}
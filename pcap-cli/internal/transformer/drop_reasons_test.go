@@ -0,0 +1,61 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestPacketDrops verifies that drops are counted into the counters shared with engines,
+// and that only the 1st out of every `rate` drops of each reason is logged.
+func TestPacketDrops(t *testing.T) {
+	t.Parallel()
+
+	var logs bytes.Buffer
+	counters := NewDropCounters()
+	drops := newPacketDrops(counters, 3, NewLogger(&logs, slog.LevelInfo))
+
+	serial := uint64(7)
+	for range 4 {
+		drops.drop(DropQueueFull, &serial)
+	}
+	drops.drop(DropCancelled, nil)
+	counters.Add(DropFiltered)
+
+	counts := counters.Counts()
+	assert.Len(t, counts, int(dropReasons))
+	assert.Equal(t, uint64(4), counts["queue_full"])
+	assert.Equal(t, uint64(1), counts["cancelled"])
+	assert.Equal(t, uint64(1), counts["filtered"])
+	assert.Zero(t, counts["panic"])
+
+	// engines count without logging: only drops of the transformer are logged
+	records := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	assert.Len(t, records, 3)
+	assert.Contains(t, records[0], `"reason":"queue_full","dropped":1,"serial":7`)
+	assert.Contains(t, records[1], `"reason":"queue_full","dropped":4,"serial":7`)
+	assert.Contains(t, records[2], `"reason":"cancelled","dropped":1}`)
+
+	// transformers created without counters, and workers created outside of `Apply`, still work
+	assert.Zero(t, newPacketDrops(nil, 0, transformerLogger).counters.Counts()["sampled"])
+	var none *packetDrops
+	none.drop(DropPanic, &serial)
+	assert.Equal(t, "unknown", dropReasons.String())
+}
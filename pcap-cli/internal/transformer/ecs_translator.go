@@ -0,0 +1,328 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build json && ecs
+
+package transformer
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/Jeffail/gabs/v2"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+type (
+	// ECSPcapTranslator relies on `JSONPcapTranslator` to analyze packets,
+	// and then reshapes translations using Elastic Common Schema fields.
+	//   - see: https://www.elastic.co/guide/en/ecs/current/ecs-field-reference.html
+	ECSPcapTranslator struct {
+		*JSONPcapTranslator
+	}
+)
+
+const (
+	ecsVersion = "8.11.0"
+
+	ecsEventKind     = "event"
+	ecsEventCategory = "network"
+	ecsEventDataset  = "pcap.packet"
+)
+
+var ecsDNSAnswerDataKeys = []string{"A", "AAAA", "CNAME", "NS", "PTR"}
+
+func init() {
+	registerTranslator(ECS, newECSPcapTranslator)
+}
+
+// for ECS translator, this method maps the JSON translation into ECS fields:
+//   - fields which are not available in ECS are kept under the custom field set `pcap`
+func (t *ECSPcapTranslator) finalize(
+	ctx context.Context,
+	ifaces netIfaceIndex,
+	iface *PcapIface,
+	serial *uint64,
+	p *gopacket.Packet,
+	conntrack bool,
+	packet fmt.Stringer,
+) (fmt.Stringer, error) {
+	// JSON translation is always available, even if `finalize` fails
+	translation, err := t.JSONPcapTranslator.finalizeJSON(ctx, ifaces, iface, serial, p, conntrack, packet)
+
+	json := t.asTranslation(translation)
+	ecs := gabs.New()
+
+	ecs.Set(json.S("meta", "timestamp").Data(), "@timestamp")
+	ecs.Set(ecsVersion, "ecs", "version")
+	ecs.Set(json.S("message").Data(), "message")
+
+	event, _ := ecs.Object("event")
+	event.Set(ecsEventKind, "kind")
+	event.Set([]string{ecsEventCategory}, "category")
+	event.Set([]string{"connection"}, "type")
+	event.Set(ecsEventDataset, "dataset")
+	event.Set(*serial, "sequence")
+
+	pcap, _ := ecs.Object("pcap")
+	pcap.Set(json.S("pcap", "id").Data(), "id")
+	pcap.Set(json.S("pcap", "ctx").Data(), "ctx")
+	pcap.Set(*serial, "serial")
+	if flowID, ok := json.S("flow").Data().(string); ok {
+		pcap.Set(flowID, "flow")
+	}
+	if local, ok := json.S("local").Data().(bool); ok {
+		pcap.Set(local, "local")
+	}
+
+	// see: https://www.elastic.co/guide/en/ecs/current/ecs-base.html#field-labels
+	t.labels.apply(*p, func(key, value string) {
+		ecs.Set(value, "labels", key)
+	})
+
+	observer, _ := ecs.Object("observer")
+	observer.Set(json.S("iface", "index").Data(), "ingress", "interface", "id")
+	observer.Set(json.S("iface", "name").Data(), "ingress", "interface", "name")
+
+	network, _ := ecs.Object("network")
+	network.Set(json.S("meta", "len").Data(), "bytes")
+
+	t.setEndpoints(json, ecs, network)
+	t.setTransport(json, ecs, network, pcap)
+	t.setHTTP(json, ecs, network, event)
+	t.setDNS(json, ecs, network, event)
+	t.setTLS(p, ecs, network)
+
+	if trace, ok := json.S("logging.googleapis.com/trace").Data().(string); ok {
+		ecs.Set(trace[strings.LastIndex(trace, "/")+1:], "trace", "id")
+		ecs.Set(json.S("logging.googleapis.com/spanId").Data(), "span", "id")
+	}
+
+	if errors := json.S("err").Children(); len(errors) > 0 {
+		if msg, ok := errors[0].S("msg").Data().(string); ok {
+			ecs.Set(msg, "error", "message")
+		}
+	}
+
+	return ecs, err
+}
+
+func (t *ECSPcapTranslator) setEndpoints(json, ecs, network *gabs.Container) {
+	if json.Exists("ARP") {
+		ecs.Set(json.S("ARP", "src", "IP").Data(), "source", "ip")
+		ecs.Set(json.S("ARP", "src", "MAC").Data(), "source", "mac")
+		ecs.Set(json.S("ARP", "dst", "IP").Data(), "destination", "ip")
+		ecs.Set(json.S("ARP", "dst", "MAC").Data(), "destination", "mac")
+		network.Set("arp", "type")
+		return
+	}
+
+	if mac, ok := json.S("L2", "src").Data().(string); ok {
+		ecs.Set(strings.ReplaceAll(strings.ToUpper(mac), ":", "-"), "source", "mac")
+	}
+	if mac, ok := json.S("L2", "dst").Data().(string); ok {
+		ecs.Set(strings.ReplaceAll(strings.ToUpper(mac), ":", "-"), "destination", "mac")
+	}
+	// outermost tag is `network.vlan`; with QinQ, the next one is `network.inner.vlan`
+	if vlans := json.S("L2", "vlan").Children(); len(vlans) > 0 {
+		network.Set(fmt.Sprint(vlans[0].S("id").Data()), "vlan", "id")
+		if len(vlans) > 1 {
+			network.Set(fmt.Sprint(vlans[1].S("id").Data()), "inner", "vlan", "id")
+		}
+	}
+
+	srcIP, srcOK := json.S("L3", "src").Data().(net.IP)
+	dstIP, dstOK := json.S("L3", "dst").Data().(net.IP)
+	if !srcOK || !dstOK {
+		return
+	}
+
+	ecs.Set(srcIP.String(), "source", "ip")
+	ecs.Set(srcIP.String(), "source", "address")
+	ecs.Set(dstIP.String(), "destination", "ip")
+	ecs.Set(dstIP.String(), "destination", "address")
+
+	if srcIP.To4() != nil {
+		network.Set("ipv4", "type")
+	} else {
+		network.Set("ipv6", "type")
+	}
+
+	if proto, ok := json.S("L3", "proto", "num").Data().(layers.IPProtocol); ok {
+		network.Set(strconv.FormatUint(uint64(proto), 10), "iana_number")
+	}
+}
+
+func (t *ECSPcapTranslator) setTransport(json, ecs, network, pcap *gabs.Container) {
+	proto, ok := json.S("L3", "proto", "num").Data().(layers.IPProtocol)
+	if !ok {
+		return
+	}
+
+	switch proto {
+	case layers.IPProtocolTCP:
+		network.Set("tcp", "transport")
+		srcPort, _ := json.S("L4", "src").Data().(layers.TCPPort)
+		dstPort, _ := json.S("L4", "dst").Data().(layers.TCPPort)
+		ecs.Set(uint16(srcPort), "source", "port")
+		ecs.Set(uint16(dstPort), "destination", "port")
+		pcap.Set(json.S("L4", "flags", "str").Data(), "tcp", "flags")
+		pcap.Set(json.S("L4", "seq").Data(), "tcp", "seq")
+		pcap.Set(json.S("L4", "ack").Data(), "tcp", "ack")
+		pcap.Set(json.S("L4", "len").Data(), "tcp", "len")
+	case layers.IPProtocolUDP:
+		network.Set("udp", "transport")
+		srcPort, _ := json.S("L4", "src").Data().(layers.UDPPort)
+		dstPort, _ := json.S("L4", "dst").Data().(layers.UDPPort)
+		ecs.Set(uint16(srcPort), "source", "port")
+		ecs.Set(uint16(dstPort), "destination", "port")
+	case layers.IPProtocolSCTP:
+		network.Set("sctp", "transport")
+		srcPort, _ := json.S("L4", "src").Data().(layers.SCTPPort)
+		dstPort, _ := json.S("L4", "dst").Data().(layers.SCTPPort)
+		ecs.Set(uint16(srcPort), "source", "port")
+		ecs.Set(uint16(dstPort), "destination", "port")
+		pcap.Set(json.S("L4", "vtag").Data(), "sctp", "vtag")
+		pcap.Set(json.S("L4", "types").Data(), "sctp", "chunks")
+	case layers.IPProtocolICMPv4, layers.IPProtocolICMPv6:
+		if proto == layers.IPProtocolICMPv4 {
+			network.Set("icmp", "transport")
+		} else {
+			network.Set("ipv6-icmp", "transport")
+		}
+		pcap.Set(json.S("ICMP", "type").Data(), "icmp", "type")
+		pcap.Set(json.S("ICMP", "code").Data(), "icmp", "code")
+		pcap.Set(json.S("ICMP", "msg").Data(), "icmp", "msg")
+	default:
+		network.Set(strings.ToLower(proto.String()), "transport")
+	}
+}
+
+func (t *ECSPcapTranslator) setHTTP(json, ecs, network, event *gabs.Container) {
+	if !json.Exists("HTTP") {
+		return
+	}
+
+	HTTP := json.S("HTTP")
+	network.Set("http", "protocol")
+	event.Set([]string{"connection", "protocol"}, "type")
+
+	if proto, ok := HTTP.S("proto").Data().(string); ok {
+		switch proto {
+		case "h2c":
+			ecs.Set("2", "http", "version")
+		default:
+			ecs.Set(strings.TrimPrefix(proto, "HTTP/"), "http", "version")
+		}
+	}
+
+	if method, ok := HTTP.S("method").Data().(string); ok {
+		ecs.Set(method, "http", "request", "method")
+	}
+	if url, ok := HTTP.S("url").Data().(string); ok {
+		ecs.Set(url, "url", "original")
+	}
+	if code, ok := HTTP.S("code").Data().(int); ok {
+		ecs.Set(code, "http", "response", "status_code")
+	}
+	if userAgent, ok := HTTP.S("headers", httpUserAgentHeader).Data().([]string); ok && len(userAgent) > 0 {
+		ecs.Set(userAgent[0], "user_agent", "original")
+	}
+	if family, ok := HTTP.S("user_agent", "family").Data().(string); ok {
+		ecs.Set(family, "user_agent", "name")
+		if version, ok := HTTP.S("user_agent", "version").Data().(string); ok {
+			ecs.Set(version, "user_agent", "version")
+		}
+		ecs.Set(HTTP.S("user_agent", "class").Data(), "pcap", "user_agent", "class")
+		ecs.Set(HTTP.S("user_agent", "bot").Data(), "pcap", "user_agent", "bot")
+	}
+	// ECS durations are expressed in nanoseconds
+	if latency, ok := HTTP.S("request", "latency_ms").Data().(float64); ok {
+		event.Set(int64(math.Round(latency*1_000_000)), "duration")
+	} else if latency, ok := HTTP.S("request", "latency").Data().(int64); ok {
+		event.Set(latency*1_000_000, "duration")
+	}
+}
+
+func (t *ECSPcapTranslator) setDNS(json, ecs, network, event *gabs.Container) {
+	if !json.Exists("DNS") {
+		return
+	}
+
+	DNS := json.S("DNS")
+	network.Set("dns", "protocol")
+	event.Set([]string{"connection", "protocol"}, "type")
+
+	dns, _ := ecs.Object("dns")
+	dns.Set(DNS.S("id").Data(), "id")
+	dns.Set(DNS.S("op").Data(), "op_code")
+	dns.Set(DNS.S("response_code").Data(), "response_code")
+
+	if questions := DNS.S("questions").Children(); len(questions) > 0 {
+		question := questions[0]
+		dns.Set(question.S("name").Data(), "question", "name")
+		dns.Set(question.S("type").Data(), "question", "type")
+		dns.Set(question.S("class").Data(), "question", "class")
+	}
+
+	answers := DNS.S("answers").Children()
+	if len(answers) == 0 {
+		dns.Set("query", "type")
+		return
+	}
+
+	dns.Set("answer", "type")
+	ecsAnswers, _ := dns.ArrayOfSize(len(answers), "answers")
+	for i, answer := range answers {
+		a, _ := ecsAnswers.ObjectI(i)
+		a.Set(answer.S("name").Data(), "name")
+		a.Set(answer.S("type").Data(), "type")
+		a.Set(answer.S("class").Data(), "class")
+		a.Set(answer.S("ttl").Data(), "ttl")
+		for _, key := range ecsDNSAnswerDataKeys {
+			if data, ok := answer.S(key).Data().(string); ok {
+				a.Set(data, "data")
+				break
+			}
+		}
+	}
+}
+
+func (t *ECSPcapTranslator) setTLS(p *gopacket.Packet, ecs, network *gabs.Container) {
+	appLayer := (*p).ApplicationLayer()
+	if appLayer == nil {
+		return
+	}
+	if serverName, ok := tlsServerName(appLayer.LayerContents()); ok {
+		network.Set("tls", "protocol")
+		ecs.Set(serverName, "tls", "client", "server_name")
+		ecs.Set(serverName, "tls", "server", "name")
+	}
+}
+
+func newECSPcapTranslator(
+	ctx context.Context,
+	debug bool,
+	iface *PcapIface,
+	ephemerals *PcapEphemeralPorts,
+) PcapTranslator {
+	return &ECSPcapTranslator{
+		JSONPcapTranslator: newJSONPcapTranslator(ctx, debug, iface, ephemerals).(*JSONPcapTranslator),
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"cmp"
+	"context"
+	"log/slog"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+type (
+	// FlowTalker accounts for the packets of 1 flow during 1 interval; `Src` and `Dst` are those of its 1st packet in the interval.
+	FlowTalker struct {
+		Protocol       string
+		Src, Dst       netip.AddrPort
+		Packets, Bytes uint64
+		// packets beyond the budget of the flow: counted, but not translated
+		AggregatedPackets, AggregatedBytes uint64
+	}
+
+	// TopTalkersEvent is produced once per interval by every transformer that aggregated packets, and once more when it stops.
+	TopTalkersEvent struct {
+		Iface string
+		// timestamps of the 1st and last packets of the interval
+		Start, End                         time.Time
+		Flows                              uint64
+		Packets, Bytes                     uint64
+		AggregatedPackets, AggregatedBytes uint64
+		// flows that sent the most bytes during the interval; at most `flowTopTalkers`
+		Talkers []FlowTalker
+	}
+
+	// flowAggregator translates at most `budget` packets per flow and interval: the rest are only counted.
+	flowAggregator struct {
+		mu           sync.Mutex
+		iface        string
+		logger       *slog.Logger
+		budget       uint64
+		interval     time.Duration
+		start, end   time.Time
+		flows        map[uint64]*FlowTalker
+		onTopTalkers func(*TopTalkersEvent)
+	}
+)
+
+const (
+	flowTopTalkers = 10
+	// flows beyond this limit are admitted without being accounted for until the next interval
+	flowAggregatorLimit = 65536
+
+	flowAggregatorDefaultInterval = time.Minute
+)
+
+// newFlowAggregator returns `nil` if all packets must be translated.
+func newFlowAggregator(
+	iface *PcapIface,
+	budget uint,
+	interval time.Duration,
+	onTopTalkers func(*TopTalkersEvent),
+) *flowAggregator {
+	if budget == 0 {
+		return nil
+	}
+	if interval <= 0 {
+		interval = flowAggregatorDefaultInterval
+	}
+	return &flowAggregator{
+		iface:        iface.Name,
+		logger:       transformerLogger,
+		budget:       uint64(budget),
+		interval:     interval,
+		flows:        make(map[uint64]*FlowTalker),
+		onTopTalkers: onTopTalkers,
+	}
+}
+
+func newFlowTalker(packet gopacket.Packet) *FlowTalker {
+	talker := &FlowTalker{}
+	switch ip := packet.NetworkLayer().(type) {
+	case *layers.IPv4:
+		talker.Protocol = ip.Protocol.String()
+	case *layers.IPv6:
+		talker.Protocol = ip.NextHeader.String()
+	}
+	event := newFlowEvent(&packet, 0, 0)
+	talker.Src, talker.Dst = event.Src, event.Dst
+	return talker
+}
+
+// isFlowControlSegment returns whether the packet opens or closes a TCP connection:
+// these are always translated so that connections can be followed even if most of their segments are aggregated.
+func isFlowControlSegment(packet gopacket.Packet) bool {
+	tcp, ok := packet.TransportLayer().(*layers.TCP)
+	return ok && (tcp.SYN || tcp.FIN || tcp.RST)
+}
+
+// admit returns whether the packet must be translated; packets without IP addresses are always translated.
+func (a *flowAggregator) admit(packet gopacket.Packet) bool {
+	if a == nil {
+		return true
+	}
+	hash, ok := flowSamplingHash(packet)
+	if !ok {
+		return true
+	}
+
+	metadata := packet.Metadata()
+	size := uint64(metadata.Length)
+	if size == 0 {
+		size = uint64(len(packet.Data()))
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	talker, found := a.flows[hash]
+	if !found {
+		if len(a.flows) >= flowAggregatorLimit {
+			return true
+		}
+		talker = newFlowTalker(packet)
+		a.flows[hash] = talker
+	}
+
+	if a.start.IsZero() || metadata.Timestamp.Before(a.start) {
+		a.start = metadata.Timestamp
+	}
+	if metadata.Timestamp.After(a.end) {
+		a.end = metadata.Timestamp
+	}
+
+	talker.Packets++
+	talker.Bytes += size
+	if talker.Packets <= a.budget || isFlowControlSegment(packet) {
+		return true
+	}
+	talker.AggregatedPackets++
+	talker.AggregatedBytes += size
+	return false
+}
+
+// flush returns the top talkers of the current interval, and starts a new one; it returns `nil` if no packets were seen.
+func (a *flowAggregator) flush() *TopTalkersEvent {
+	a.mu.Lock()
+	flows := a.flows
+	start, end := a.start, a.end
+	a.flows = make(map[uint64]*FlowTalker)
+	a.start, a.end = time.Time{}, time.Time{}
+	a.mu.Unlock()
+
+	if len(flows) == 0 {
+		return nil
+	}
+
+	event := &TopTalkersEvent{
+		Iface: a.iface,
+		Start: start,
+		End:   end,
+		Flows: uint64(len(flows)),
+	}
+	talkers := make([]FlowTalker, 0, len(flows))
+	for _, talker := range flows {
+		event.Packets += talker.Packets
+		event.Bytes += talker.Bytes
+		event.AggregatedPackets += talker.AggregatedPackets
+		event.AggregatedBytes += talker.AggregatedBytes
+		talkers = append(talkers, *talker)
+	}
+	slices.SortFunc(talkers, func(a, b FlowTalker) int {
+		return cmp.Or(cmp.Compare(b.Bytes, a.Bytes), cmp.Compare(b.Packets, a.Packets))
+	})
+	event.Talkers = talkers[:min(len(talkers), flowTopTalkers)]
+	return event
+}
+
+// report flushes counters every interval until `ctx` is done, and once more when it is.
+func (a *flowAggregator) report(ctx context.Context) {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			a.notify(a.flush())
+			return
+		case <-ticker.C:
+			a.notify(a.flush())
+		}
+	}
+}
+
+func (a *flowAggregator) notify(event *TopTalkersEvent) {
+	if event == nil {
+		return
+	}
+	if a.onTopTalkers != nil {
+		a.onTopTalkers(event)
+	}
+	a.logger.Info("top talkers", "flows", event.Flows, "packets", event.Packets,
+		"aggregated_packets", event.AggregatedPackets, "aggregated_bytes", event.AggregatedBytes)
+}
@@ -0,0 +1,94 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+func newFlowBudgetTestPacket(t *testing.T, srcPort layers.TCPPort, payload int, syn bool) gopacket.Packet {
+	return newTestPacket(t, newTestIPv4(net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)),
+		&layers.TCP{SrcPort: srcPort, DstPort: 443, SYN: syn, ACK: !syn, Window: 1024},
+		gopacket.Payload(make([]byte, payload)))
+}
+
+// TestFlowAggregatorBudget verifies that only the first N packets of a flow are translated,
+// that connection control segments are always translated, and that budgets are reset every interval.
+func TestFlowAggregatorBudget(t *testing.T) {
+	t.Parallel()
+
+	assert.Nil(t, newFlowAggregator(&PcapIface{Name: "eth0"}, 0, time.Second, nil))
+	var disabled *flowAggregator
+	assert.True(t, disabled.admit(newFlowBudgetTestPacket(t, 40000, 0, false)))
+
+	aggregator := newFlowAggregator(&PcapIface{Name: "eth0"}, 2, time.Second, nil)
+	assert.True(t, aggregator.admit(newFlowBudgetTestPacket(t, 40000, 0, true)))
+	assert.True(t, aggregator.admit(newFlowBudgetTestPacket(t, 40000, 100, false)))
+	assert.False(t, aggregator.admit(newFlowBudgetTestPacket(t, 40000, 100, false)))
+	assert.True(t, aggregator.admit(newFlowBudgetTestPacket(t, 40000, 0, true)))
+	assert.True(t, aggregator.admit(newFlowBudgetTestPacket(t, 40001, 100, false)))
+
+	arp := gopacket.NewPacket([]byte{0, 1, 8, 0, 6, 4, 0, 1}, layers.LayerTypeARP, gopacket.Default)
+	assert.True(t, aggregator.admit(arp))
+
+	event := aggregator.flush()
+	assert.NotNil(t, event)
+	assert.Equal(t, uint64(2), event.Flows)
+	assert.Equal(t, uint64(5), event.Packets)
+	assert.Equal(t, uint64(1), event.AggregatedPackets)
+	assert.Equal(t, uint64(140), event.AggregatedBytes)
+
+	// budgets are reset along with counters
+	assert.True(t, aggregator.admit(newFlowBudgetTestPacket(t, 40000, 100, false)))
+	assert.True(t, aggregator.admit(newFlowBudgetTestPacket(t, 40000, 100, false)))
+	assert.False(t, aggregator.admit(newFlowBudgetTestPacket(t, 40000, 100, false)))
+}
+
+// TestFlowAggregatorTopTalkers verifies that talkers are ranked by bytes, and that only the top ones are reported.
+func TestFlowAggregatorTopTalkers(t *testing.T) {
+	t.Parallel()
+
+	aggregator := newFlowAggregator(&PcapIface{Index: 1, Name: "eth0"}, 1, time.Second, nil)
+	assert.Nil(t, aggregator.flush())
+
+	for i := range flowTopTalkers + 5 {
+		for range i + 1 {
+			aggregator.admit(newFlowBudgetTestPacket(t, layers.TCPPort(40000+i), 10, false))
+		}
+	}
+
+	event := aggregator.flush()
+	assert.Equal(t, "eth0", event.Iface)
+	assert.Equal(t, uint64(flowTopTalkers+5), event.Flows)
+	assert.Len(t, event.Talkers, flowTopTalkers)
+
+	top := event.Talkers[0]
+	assert.Equal(t, "TCP", top.Protocol)
+	assert.Equal(t, netip.MustParseAddrPort("10.0.0.1:40014"), top.Src)
+	assert.Equal(t, netip.MustParseAddrPort("10.0.0.2:443"), top.Dst)
+	assert.Equal(t, uint64(15), top.Packets)
+	assert.Equal(t, uint64(14), top.AggregatedPackets)
+	assert.Equal(t, uint64(50*15), top.Bytes)
+	for i := 1; i < len(event.Talkers); i++ {
+		assert.GreaterOrEqual(t, event.Talkers[i-1].Bytes, event.Talkers[i].Bytes)
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+)
+
+type (
+	// FlowEvent identifies the packet that produced an event, and the TCP connection it belongs to.
+	FlowEvent struct {
+		Serial    uint64
+		FlowID    uint64
+		Timestamp time.Time
+		Src, Dst  netip.AddrPort
+	}
+
+	FlowStartEvent struct {
+		FlowEvent
+	}
+
+	// FlowEndEvent is produced once per connection: by the 1st `FIN` or `RST`.
+	FlowEndEvent struct {
+		FlowEvent
+		Reset bool
+		// zero if the connection was not observed for long enough to estimate them
+		HandshakeRTT, RTT time.Duration
+		// total time the connection was stalled by zero windows
+		Stalled time.Duration
+	}
+
+	// FlowStallEvent is produced when `StalledBy` advertises a zero window for longer than 1 second, and again when the stall ends.
+	FlowStallEvent struct {
+		FlowEvent
+		StalledBy netip.AddrPort
+		Duration  time.Duration
+		Ended     bool
+	}
+
+	HTTPRequestEvent struct {
+		FlowEvent
+		Proto, Method, Host, URL string
+		// HTTP/1.1 requests are always sent over stream `1`
+		StreamID uint32
+		// only available if the request carries trace context
+		TraceID, SpanID string
+	}
+
+	HTTPResponseEvent struct {
+		FlowEvent
+		Proto      string
+		StatusCode int
+		StreamID   uint32
+		// only available if the response carries trace context, or if it belongs to a traced request
+		TraceID, SpanID string
+	}
+
+	// FlowEventHandlers allows programs embedding pcap-cli to react to network events without parsing translations:
+	//   - handlers are optional, and they are invoked synchronously while translating packets,
+	//   - handlers are invoked concurrently, so they must be thread-safe and must not block,
+	//   - events are produced by all translators based on `json`; i/e: all formats but `proto`.
+	FlowEventHandlers struct {
+		OnFlowStart func(*FlowStartEvent)
+		OnRequest   func(*HTTPRequestEvent)
+		OnResponse  func(*HTTPResponseEvent)
+		OnFlowEnd   func(*FlowEndEvent)
+		OnStall     func(*FlowStallEvent)
+		// invoked once per TCP connection when it is no longer tracked
+		OnFlowSummary func(*FlowSummaryEvent)
+		// invoked by every transformer once per interval if packets beyond the per flow budget are aggregated; available for all formats
+		OnTopTalkers func(*TopTalkersEvent)
+	}
+
+	// flowEvents dispatches events to `FlowEventHandlers`
+	flowEvents struct {
+		handlers *FlowEventHandlers
+		mu       *sync.Mutex
+		// connections whose end was already reported: both endpoints send `FIN`
+		ended map[uint64]struct{}
+	}
+)
+
+// connections beyond this limit reset the state used to report connections ends only once
+const flowEventsLimit = 4096
+
+func newFlowEvents(handlers *FlowEventHandlers) *flowEvents {
+	if handlers == nil {
+		return nil
+	}
+	return &flowEvents{
+		handlers: handlers,
+		mu:       new(sync.Mutex),
+		ended:    make(map[uint64]struct{}),
+	}
+}
+
+func newFlowEvent(packet *gopacket.Packet, serial, flowID uint64) FlowEvent {
+	event := FlowEvent{
+		Serial:    serial,
+		FlowID:    flowID,
+		Timestamp: (*packet).Metadata().Timestamp,
+	}
+	networkLayer := (*packet).NetworkLayer()
+	transportLayer := (*packet).TransportLayer()
+	if networkLayer == nil || transportLayer == nil {
+		return event
+	}
+	networkFlow := networkLayer.NetworkFlow()
+	transportFlow := transportLayer.TransportFlow()
+	src, _ := netip.AddrFromSlice(networkFlow.Src().Raw())
+	dst, _ := netip.AddrFromSlice(networkFlow.Dst().Raw())
+	event.Src = netip.AddrPortFrom(src.Unmap(), flowEventPort(transportFlow.Src().Raw()))
+	event.Dst = netip.AddrPortFrom(dst.Unmap(), flowEventPort(transportFlow.Dst().Raw()))
+	return event
+}
+
+// ids returns empty IDs if trace context is not available
+func (ts *traceAndSpan) ids() (string, string) {
+	if ts == nil {
+		return "", ""
+	}
+	traceID, spanID := "", ""
+	if ts.traceID != nil {
+		traceID = *ts.traceID
+	}
+	if ts.spanID != nil {
+		spanID = *ts.spanID
+	}
+	return traceID, spanID
+}
+
+func flowEventPort(raw []byte) uint16 {
+	if len(raw) != 2 {
+		return 0
+	}
+	return uint16(raw[0])<<8 | uint16(raw[1])
+}
+
+func (e *flowEvents) flowStart(event FlowEvent) {
+	e.mu.Lock()
+	// flow IDs are reused when connections are re-established using the same 5-tuple
+	delete(e.ended, event.FlowID)
+	e.mu.Unlock()
+
+	if e.handlers.OnFlowStart != nil {
+		e.handlers.OnFlowStart(&FlowStartEvent{event})
+	}
+}
+
+func (e *flowEvents) flowEnd(event FlowEvent, reset bool, rtt *tcpRTTEstimate, stalled time.Duration) {
+	e.mu.Lock()
+	_, ended := e.ended[event.FlowID]
+	if !ended {
+		if len(e.ended) >= flowEventsLimit {
+			e.ended = make(map[uint64]struct{})
+		}
+		e.ended[event.FlowID] = struct{}{}
+	}
+	e.mu.Unlock()
+
+	if !ended && e.handlers.OnFlowEnd != nil {
+		flowEnd := &FlowEndEvent{FlowEvent: event, Reset: reset, Stalled: stalled}
+		if rtt != nil {
+			flowEnd.HandshakeRTT, flowEnd.RTT = rtt.handshake, rtt.smoothed
+		}
+		e.handlers.OnFlowEnd(flowEnd)
+	}
+}
+
+func (e *flowEvents) stall(event *FlowStallEvent) {
+	if e.handlers.OnStall != nil {
+		e.handlers.OnStall(event)
+	}
+}
+
+func (e *flowEvents) request(event *HTTPRequestEvent) {
+	if e.handlers.OnRequest != nil {
+		e.handlers.OnRequest(event)
+	}
+}
+
+func (e *flowEvents) response(event *HTTPResponseEvent) {
+	if e.handlers.OnResponse != nil {
+		e.handlers.OnResponse(event)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestFlowEvents verifies that events carry the endpoints of the packet, and that connections end only once.
+func TestFlowEvents(t *testing.T) {
+	t.Parallel()
+
+	assert.Nil(t, newFlowEvents(nil))
+
+	ip := &layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Protocol: layers.IPProtocolTCP,
+		SrcIP:    net.IPv4(10, 0, 0, 1),
+		DstIP:    net.IPv4(10, 0, 0, 2),
+	}
+	tcp := &layers.TCP{SrcPort: 40000, DstPort: 443, FIN: true, ACK: true}
+	assert.NoError(t, tcp.SetNetworkLayerForChecksum(ip))
+
+	buffer := gopacket.NewSerializeBuffer()
+	assert.NoError(t, gopacket.SerializeLayers(buffer,
+		gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}, ip, tcp))
+	packet := gopacket.NewPacket(buffer.Bytes(), layers.LayerTypeIPv4, gopacket.Default)
+
+	event := newFlowEvent(&packet, 7, 42)
+	assert.Equal(t, uint64(7), event.Serial)
+	assert.Equal(t, uint64(42), event.FlowID)
+	assert.Equal(t, "10.0.0.1:40000", event.Src.String())
+	assert.Equal(t, "10.0.0.2:443", event.Dst.String())
+
+	starts, ends := 0, []*FlowEndEvent{}
+	events := newFlowEvents(&FlowEventHandlers{
+		OnFlowStart: func(*FlowStartEvent) { starts += 1 },
+		OnFlowEnd:   func(event *FlowEndEvent) { ends = append(ends, event) },
+	})
+
+	// handlers are optional
+	events.request(&HTTPRequestEvent{FlowEvent: event})
+
+	events.flowStart(event)
+	events.flowEnd(event, false, nil, 0)
+	events.flowEnd(event, true, nil, 0)
+	assert.Equal(t, 1, starts)
+	assert.Len(t, ends, 1)
+	assert.False(t, ends[0].Reset)
+
+	// connections re-established using the same 5-tuple end again
+	events.flowStart(event)
+	events.flowEnd(event, true, nil, 0)
+	assert.Len(t, ends, 2)
+	assert.True(t, ends[1].Reset)
+
+	traceID, spanID := (*traceAndSpan)(nil).ids()
+	assert.Empty(t, traceID)
+	assert.Empty(t, spanID)
+}
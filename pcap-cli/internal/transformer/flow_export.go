@@ -0,0 +1,379 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	FlowExportVersion string
+
+	// FlowRecordEncoder encodes `FlowSummaryEvent`s into IPFIX ( RFC 7011 ) or NetFlow v9 ( RFC 3954 ) messages:
+	//   - every connection becomes 2 unidirectional records: client to server, and server to client,
+	//   - IPv4 and IPv6 connections use different templates, which are sent along with the 1st message
+	//     and then every `flowExportTemplateRefresh`; as collectors receiving UDP may lose or restart,
+	//   - trace context, retransmissions, HTTP requests and RTTs are carried by enterprise IEs.
+	//
+	// It is not thread-safe.
+	FlowRecordEncoder struct {
+		version  FlowExportVersion
+		domain   uint32
+		start    time.Time
+		messages uint32
+		records  uint32
+		// when templates were last sent
+		templates time.Time
+	}
+
+	flowExportField struct {
+		id, length uint16
+		enterprise bool
+	}
+
+	flowExportMessage struct {
+		buffer   []byte
+		set      uint16
+		setStart int
+		// all records ( NetFlow v9 ) and data records ( IPFIX )
+		count, data uint32
+	}
+)
+
+const (
+	FlowExportIPFIX    FlowExportVersion = "ipfix"
+	FlowExportNetFlow9 FlowExportVersion = "netflow9"
+)
+
+const (
+	// Google's Private Enterprise Number: https://www.iana.org/assignments/enterprise-numbers/
+	flowExportEnterprise = uint32(11129)
+	// NetFlow v9 has no enterprise IEs: they become vendor field types
+	flowExportNetFlow9Vendor = uint16(0x8000)
+
+	flowExportTemplateIPv4 = uint16(256)
+	flowExportTemplateIPv6 = uint16(257)
+
+	flowExportTemplateRefresh = 60 * time.Second
+	// unfragmented UDP datagrams on most networks
+	flowExportMaxMessageSize = 1400
+
+	// https://www.iana.org/assignments/ipfix/ipfix.xhtml#ipfix-flow-end-reason
+	flowEndReasonIdleTimeout = uint8(0x01)
+	flowEndReasonEndOfFlow   = uint8(0x03)
+	flowEndReasonForcedEnd   = uint8(0x04)
+
+	// https://www.iana.org/assignments/ipfix/ipfix.xhtml#ipfix-biflow-direction
+	biflowDirectionInitiator        = uint8(0x01)
+	biflowDirectionReverseInitiator = uint8(0x02)
+)
+
+// enterprise IEs; their IDs are also used as NetFlow v9 vendor field types: `0x8000 | id`
+const (
+	flowExportTraceID uint16 = iota + 1
+	flowExportSpanID
+	flowExportRetransmissions
+	flowExportHTTPRequests
+	flowExportHandshakeRTT // microseconds
+	flowExportRTT          // microseconds
+)
+
+func NewFlowRecordEncoder(version FlowExportVersion, domain uint32) (*FlowRecordEncoder, error) {
+	switch version {
+	case FlowExportIPFIX, FlowExportNetFlow9:
+	default:
+		return nil, fmt.Errorf("invalid flow export version: %s", version)
+	}
+	return &FlowRecordEncoder{
+		version: version,
+		domain:  domain,
+		start:   time.Now(),
+	}, nil
+}
+
+func (e *FlowRecordEncoder) fields(ipv6 bool) []flowExportField {
+	// https://www.iana.org/assignments/ipfix/ipfix.xhtml
+	fields := make([]flowExportField, 0, 18)
+	if ipv6 {
+		fields = append(fields, flowExportField{27, 16, false}, flowExportField{28, 16, false})
+	} else {
+		fields = append(fields, flowExportField{8, 4, false}, flowExportField{12, 4, false})
+	}
+	fields = append(fields,
+		flowExportField{7, 2, false},   // sourceTransportPort
+		flowExportField{11, 2, false},  // destinationTransportPort
+		flowExportField{4, 1, false},   // protocolIdentifier
+		flowExportField{1, 8, false},   // octetDeltaCount
+		flowExportField{2, 8, false},   // packetDeltaCount
+		flowExportField{136, 1, false}, // flowEndReason
+		flowExportField{239, 1, false}, // biflowDirection
+	)
+	if e.version == FlowExportIPFIX {
+		// flowStartMilliseconds, flowEndMilliseconds
+		fields = append(fields, flowExportField{152, 8, false}, flowExportField{153, 8, false})
+	} else {
+		// FIRST_SWITCHED, LAST_SWITCHED: milliseconds of system uptime
+		fields = append(fields, flowExportField{22, 4, false}, flowExportField{21, 4, false})
+	}
+	return append(fields,
+		flowExportField{flowExportTraceID, 16, true},
+		flowExportField{flowExportSpanID, 8, true},
+		flowExportField{flowExportRetransmissions, 8, true},
+		flowExportField{flowExportHTTPRequests, 8, true},
+		flowExportField{flowExportHandshakeRTT, 4, true},
+		flowExportField{flowExportRTT, 4, true},
+	)
+}
+
+func (e *FlowRecordEncoder) headerSize() int {
+	if e.version == FlowExportIPFIX {
+		return 16
+	}
+	return 20
+}
+
+func (e *FlowRecordEncoder) templateSetID() uint16 {
+	if e.version == FlowExportIPFIX {
+		return 2
+	}
+	return 0
+}
+
+// Encode returns the messages carrying the records of all `events`; messages are never larger than `flowExportMaxMessageSize`.
+func (e *FlowRecordEncoder) Encode(events []*FlowSummaryEvent, now time.Time) [][]byte {
+	messages := [][]byte{}
+	message := e.newMessage()
+
+	if e.templates.IsZero() || now.Sub(e.templates) >= flowExportTemplateRefresh {
+		e.appendTemplates(message)
+		e.templates = now
+	}
+
+	for _, event := range events {
+		for _, initiator := range []bool{true, false} {
+			record, template := e.record(event, initiator)
+			if record == nil {
+				continue
+			}
+			// sets are padded to 4 octets
+			if len(message.buffer)+len(record)+4+3 > flowExportMaxMessageSize && message.count > 0 {
+				messages = append(messages, e.finish(message, now))
+				message = e.newMessage()
+			}
+			message.openSet(template)
+			message.buffer = append(message.buffer, record...)
+			message.count++
+			message.data++
+		}
+	}
+
+	if message.count > 0 {
+		messages = append(messages, e.finish(message, now))
+	}
+	return messages
+}
+
+func (e *FlowRecordEncoder) newMessage() *flowExportMessage {
+	return &flowExportMessage{
+		buffer: make([]byte, e.headerSize(), flowExportMaxMessageSize),
+	}
+}
+
+func (e *FlowRecordEncoder) appendTemplates(message *flowExportMessage) {
+	message.openSet(e.templateSetID())
+	for _, template := range []uint16{flowExportTemplateIPv4, flowExportTemplateIPv6} {
+		fields := e.fields(template == flowExportTemplateIPv6)
+		message.buffer = binary.BigEndian.AppendUint16(message.buffer, template)
+		message.buffer = binary.BigEndian.AppendUint16(message.buffer, uint16(len(fields)))
+		for _, field := range fields {
+			switch {
+			case !field.enterprise:
+				message.buffer = binary.BigEndian.AppendUint16(message.buffer, field.id)
+				message.buffer = binary.BigEndian.AppendUint16(message.buffer, field.length)
+			case e.version == FlowExportIPFIX:
+				message.buffer = binary.BigEndian.AppendUint16(message.buffer, 0x8000|field.id)
+				message.buffer = binary.BigEndian.AppendUint16(message.buffer, field.length)
+				message.buffer = binary.BigEndian.AppendUint32(message.buffer, flowExportEnterprise)
+			default:
+				message.buffer = binary.BigEndian.AppendUint16(message.buffer, flowExportNetFlow9Vendor|field.id)
+				message.buffer = binary.BigEndian.AppendUint16(message.buffer, field.length)
+			}
+		}
+		message.count++
+	}
+}
+
+func (m *flowExportMessage) openSet(id uint16) {
+	if m.setStart > 0 && m.set == id {
+		return
+	}
+	m.closeSet()
+	m.set, m.setStart = id, len(m.buffer)
+	m.buffer = binary.BigEndian.AppendUint16(m.buffer, id)
+	m.buffer = binary.BigEndian.AppendUint16(m.buffer, 0)
+}
+
+func (m *flowExportMessage) closeSet() {
+	if m.setStart == 0 {
+		return
+	}
+	for (len(m.buffer)-m.setStart)%4 != 0 {
+		m.buffer = append(m.buffer, 0)
+	}
+	binary.BigEndian.PutUint16(m.buffer[m.setStart+2:], uint16(len(m.buffer)-m.setStart))
+	m.setStart = 0
+}
+
+func (e *FlowRecordEncoder) finish(message *flowExportMessage, now time.Time) []byte {
+	message.closeSet()
+	header := message.buffer[:e.headerSize()]
+	if e.version == FlowExportIPFIX {
+		binary.BigEndian.PutUint16(header[0:], 10)
+		binary.BigEndian.PutUint16(header[2:], uint16(len(message.buffer)))
+		binary.BigEndian.PutUint32(header[4:], uint32(now.Unix()))
+		// IPFIX sequence numbers count data records sent before this message
+		binary.BigEndian.PutUint32(header[8:], e.records)
+		binary.BigEndian.PutUint32(header[12:], e.domain)
+	} else {
+		binary.BigEndian.PutUint16(header[0:], 9)
+		binary.BigEndian.PutUint16(header[2:], uint16(message.count))
+		binary.BigEndian.PutUint32(header[4:], e.uptime(now))
+		binary.BigEndian.PutUint32(header[8:], uint32(now.Unix()))
+		// NetFlow v9 sequence numbers count messages
+		binary.BigEndian.PutUint32(header[12:], e.messages)
+		binary.BigEndian.PutUint32(header[16:], e.domain)
+	}
+	e.messages++
+	e.records += message.data
+	return message.buffer
+}
+
+// uptime is the number of milliseconds since the encoder was created; timestamps before are 0.
+func (e *FlowRecordEncoder) uptime(ts time.Time) uint32 {
+	if ts.Before(e.start) {
+		return 0
+	}
+	return uint32(ts.Sub(e.start).Milliseconds())
+}
+
+// record returns `nil` if the connection did not send packets in the requested direction.
+func (e *FlowRecordEncoder) record(event *FlowSummaryEvent, initiator bool) ([]byte, uint16) {
+	src, dst := event.Client, event.Server
+	packets, bytes := event.FwdPackets, event.FwdBytes
+	direction := biflowDirectionInitiator
+	if !initiator {
+		src, dst = dst, src
+		packets, bytes = event.BwdPackets, event.BwdBytes
+		direction = biflowDirectionReverseInitiator
+	}
+	if packets == 0 || !src.IsValid() || !dst.IsValid() {
+		return nil, 0
+	}
+
+	srcAddr, dstAddr := src.Addr().Unmap(), dst.Addr().Unmap()
+	if srcAddr.Is4() != dstAddr.Is4() {
+		return nil, 0
+	}
+
+	template := flowExportTemplateIPv4
+	if !srcAddr.Is4() {
+		template = flowExportTemplateIPv6
+	}
+
+	record := make([]byte, 0, 128)
+	record = append(record, srcAddr.AsSlice()...)
+	record = append(record, dstAddr.AsSlice()...)
+	record = binary.BigEndian.AppendUint16(record, src.Port())
+	record = binary.BigEndian.AppendUint16(record, dst.Port())
+	record = append(record, 6 /* TCP */)
+	record = binary.BigEndian.AppendUint64(record, bytes)
+	record = binary.BigEndian.AppendUint64(record, packets)
+	record = append(record, flowEndReasonOf(event.Reason), direction)
+
+	if e.version == FlowExportIPFIX {
+		record = binary.BigEndian.AppendUint64(record, uint64(event.Start.UnixMilli()))
+		record = binary.BigEndian.AppendUint64(record, uint64(event.End.UnixMilli()))
+	} else {
+		record = binary.BigEndian.AppendUint32(record, e.uptime(event.Start))
+		record = binary.BigEndian.AppendUint32(record, e.uptime(event.End))
+	}
+
+	// trace context identifies the connection in both directions
+	record = append(record, flowExportTraceIDOf(event.TraceID)...)
+	record = append(record, flowExportSpanIDOf(event.SpanID)...)
+
+	// counters of the connection are only reported by the initiator's record
+	var retransmissions, requests uint64
+	var handshake, rtt uint32
+	if initiator {
+		retransmissions, requests = event.Retransmissions, event.HTTPRequests
+		handshake, rtt = flowExportMicros(event.HandshakeRTT), flowExportMicros(event.RTT)
+	}
+	record = binary.BigEndian.AppendUint64(record, retransmissions)
+	record = binary.BigEndian.AppendUint64(record, requests)
+	record = binary.BigEndian.AppendUint32(record, handshake)
+	record = binary.BigEndian.AppendUint32(record, rtt)
+
+	return record, template
+}
+
+func flowEndReasonOf(reason string) uint8 {
+	switch reason {
+	case flowSummaryReaped:
+		return flowEndReasonIdleTimeout
+	case flowSummaryCaptureEnd:
+		return flowEndReasonForcedEnd
+	default:
+		return flowEndReasonEndOfFlow
+	}
+}
+
+func flowExportMicros(d time.Duration) uint32 {
+	if us := d.Microseconds(); us < 0xFFFFFFFF {
+		return uint32(us)
+	}
+	return 0xFFFFFFFF
+}
+
+// flowExportTraceIDOf returns 16 zeroes if `traceID` is not a W3C/Cloud Trace ID: 32 hex characters.
+func flowExportTraceIDOf(traceID string) []byte {
+	id := make([]byte, 16)
+	if len(traceID) == 32 {
+		if _, err := hex.Decode(id, []byte(strings.ToLower(traceID))); err == nil {
+			return id
+		}
+	}
+	return make([]byte, 16)
+}
+
+// flowExportSpanIDOf supports W3C span IDs ( 16 hex characters ) and Cloud Trace span IDs ( decimal ).
+func flowExportSpanIDOf(spanID string) []byte {
+	id := make([]byte, 8)
+	if len(spanID) == 16 {
+		if _, err := hex.Decode(id, []byte(strings.ToLower(spanID))); err == nil {
+			return id
+		}
+	}
+	if value, err := strconv.ParseUint(spanID, 10, 64); err == nil {
+		binary.BigEndian.PutUint64(id, value)
+		return id
+	}
+	return make([]byte, 8)
+}
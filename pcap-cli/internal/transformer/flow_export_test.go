@@ -0,0 +1,143 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newFlowExportTestEvent(client, server string) *FlowSummaryEvent {
+	start := time.Unix(1700000000, 0)
+	return &FlowSummaryEvent{
+		FlowID:          42,
+		Client:          netip.MustParseAddrPort(client),
+		Server:          netip.MustParseAddrPort(server),
+		Start:           start,
+		End:             start.Add(320 * time.Millisecond),
+		FwdPackets:      5,
+		FwdBytes:        210,
+		BwdPackets:      2,
+		BwdBytes:        86,
+		HandshakeRTT:    11 * time.Millisecond,
+		RTT:             13 * time.Millisecond,
+		Retransmissions: 1,
+		HTTPRequests:    1,
+		TraceID:         "4bf92f3577b34da6a3ce929d0e0e4736",
+		SpanID:          "00f067aa0ba902b7",
+		Reason:          flowSummaryRST,
+	}
+}
+
+func TestFlowRecordEncoderIPFIX(t *testing.T) {
+	t.Parallel()
+
+	encoder, err := NewFlowRecordEncoder(FlowExportIPFIX, 7)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	now := time.Unix(1700000100, 0)
+	messages := encoder.Encode([]*FlowSummaryEvent{
+		newFlowExportTestEvent("10.0.0.1:40000", "10.0.0.2:443"),
+		newFlowExportTestEvent("[2001:db8::1]:40000", "[2001:db8::2]:443"),
+	}, now)
+	if !assert.Len(t, messages, 1) {
+		return
+	}
+
+	message := messages[0]
+	assert.Equal(t, uint16(10), binary.BigEndian.Uint16(message[0:]))
+	assert.Equal(t, uint16(len(message)), binary.BigEndian.Uint16(message[2:]))
+	assert.Equal(t, uint32(now.Unix()), binary.BigEndian.Uint32(message[4:]))
+	assert.Equal(t, uint32(0), binary.BigEndian.Uint32(message[8:]))
+	assert.Equal(t, uint32(7), binary.BigEndian.Uint32(message[12:]))
+
+	// sets: templates, IPv4 records, IPv6 records
+	sets := map[uint16][]byte{}
+	for offset := 16; offset < len(message); {
+		id, length := binary.BigEndian.Uint16(message[offset:]), int(binary.BigEndian.Uint16(message[offset+2:]))
+		if !assert.Greater(t, length, 4) || !assert.LessOrEqual(t, offset+length, len(message)) {
+			return
+		}
+		assert.Zero(t, length%4)
+		sets[id] = message[offset+4 : offset+length]
+		offset += length
+	}
+	assert.Contains(t, sets, uint16(2))
+	assert.Contains(t, sets, flowExportTemplateIPv4)
+	assert.Contains(t, sets, flowExportTemplateIPv6)
+
+	// 1st IPv4 record is sent by the client
+	ipv4 := sets[flowExportTemplateIPv4]
+	assert.Equal(t, []byte{10, 0, 0, 1, 10, 0, 0, 2}, ipv4[0:8])
+	assert.Equal(t, uint16(40000), binary.BigEndian.Uint16(ipv4[8:]))
+	assert.Equal(t, uint16(443), binary.BigEndian.Uint16(ipv4[10:]))
+	assert.Equal(t, uint8(6), ipv4[12])
+	assert.Equal(t, uint64(210), binary.BigEndian.Uint64(ipv4[13:]))
+	assert.Equal(t, uint64(5), binary.BigEndian.Uint64(ipv4[21:]))
+	assert.Equal(t, flowEndReasonEndOfFlow, ipv4[29])
+	assert.Equal(t, biflowDirectionInitiator, ipv4[30])
+	assert.Equal(t, uint64(1700000000000), binary.BigEndian.Uint64(ipv4[31:]))
+	assert.Equal(t, uint64(1700000000320), binary.BigEndian.Uint64(ipv4[39:]))
+	assert.Equal(t, byte(0x4b), ipv4[47])
+	assert.Equal(t, byte(0x00), ipv4[63])
+	assert.Equal(t, uint64(1), binary.BigEndian.Uint64(ipv4[71:]))
+	assert.Equal(t, uint32(11000), binary.BigEndian.Uint32(ipv4[87:]))
+
+	// sequence numbers count data records
+	messages = encoder.Encode([]*FlowSummaryEvent{newFlowExportTestEvent("10.0.0.1:40001", "10.0.0.2:443")}, now.Add(time.Second))
+	if assert.Len(t, messages, 1) {
+		assert.Equal(t, uint32(4), binary.BigEndian.Uint32(messages[0][8:]))
+		// templates are not sent again until they must be refreshed
+		assert.Equal(t, flowExportTemplateIPv4, binary.BigEndian.Uint16(messages[0][16:]))
+	}
+}
+
+func TestFlowRecordEncoderNetFlow9(t *testing.T) {
+	t.Parallel()
+
+	encoder, err := NewFlowRecordEncoder(FlowExportNetFlow9, 7)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	events := make([]*FlowSummaryEvent, 0, 32)
+	for i := 0; i < 32; i++ {
+		events = append(events, newFlowExportTestEvent("10.0.0.1:40000", "10.0.0.2:443"))
+	}
+
+	messages := encoder.Encode(events, time.Now())
+	if !assert.Greater(t, len(messages), 1) {
+		return
+	}
+
+	records := 0
+	for i, message := range messages {
+		assert.LessOrEqual(t, len(message), flowExportMaxMessageSize)
+		assert.Equal(t, uint16(9), binary.BigEndian.Uint16(message[0:]))
+		assert.Equal(t, uint32(i), binary.BigEndian.Uint32(message[12:]))
+		records += int(binary.BigEndian.Uint16(message[2:]))
+	}
+	// 2 templates, and 2 records per connection
+	assert.Equal(t, 2+2*len(events), records)
+
+	_, err = NewFlowRecordEncoder("sflow", 0)
+	assert.Error(t, err)
+}
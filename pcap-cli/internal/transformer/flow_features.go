@@ -0,0 +1,379 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"cmp"
+	"encoding/csv"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+)
+
+type (
+	// CaptureFlowFeatures is a fixed-schema vector of numeric features describing a flow; suitable for training models:
+	//   - `Client`, `Server` and `Start` identify the flow, and should not be used as features,
+	//   - `Fwd*` features describe packets sent by the client, and `Bwd*` features packets sent by the server,
+	//   - sizes are bytes on the wire, and times are milliseconds,
+	//   - handshake times are `-1` if they were not observed; i/e: UDP flows, or TCP flows which started before the capture,
+	//   - `RTT` is the smoothed RTT of TCP flows when they end, or `-1` if it could not be estimated,
+	//   - `Stalled` is the total time TCP flows were stalled by either endpoint advertising zero windows.
+	//
+	// columns must only be appended, and never removed nor renamed.
+	CaptureFlowFeatures struct {
+		Start        time.Time `parquet:"start,timestamp(nanosecond)"`
+		Proto        string    `parquet:"proto,dict"`
+		Client       string    `parquet:"client"`
+		Server       string    `parquet:"server"`
+		ServerPort   int32     `parquet:"server_port"`
+		Duration     float64   `parquet:"duration_ms"`
+		Packets      uint64    `parquet:"packets"`
+		Bytes        uint64    `parquet:"bytes"`
+		FwdPackets   uint64    `parquet:"fwd_packets"`
+		FwdBytes     uint64    `parquet:"fwd_bytes"`
+		BwdPackets   uint64    `parquet:"bwd_packets"`
+		BwdBytes     uint64    `parquet:"bwd_bytes"`
+		SizeMin      float64   `parquet:"size_min"`
+		SizeMax      float64   `parquet:"size_max"`
+		SizeMean     float64   `parquet:"size_mean"`
+		SizeStd      float64   `parquet:"size_std"`
+		IATMin       float64   `parquet:"iat_min_ms"`
+		IATMax       float64   `parquet:"iat_max_ms"`
+		IATMean      float64   `parquet:"iat_mean_ms"`
+		IATStd       float64   `parquet:"iat_std_ms"`
+		SYN          uint64    `parquet:"syn"`
+		FIN          uint64    `parquet:"fin"`
+		RST          uint64    `parquet:"rst"`
+		PSH          uint64    `parquet:"psh"`
+		ACK          uint64    `parquet:"ack"`
+		URG          uint64    `parquet:"urg"`
+		HandshakeRTT float64   `parquet:"handshake_ms"`
+		HandshakeACK float64   `parquet:"handshake_ack_ms"`
+		RTT          float64   `parquet:"rtt_ms"`
+		Stalled      float64   `parquet:"stall_ms"`
+	}
+
+	// runningStats computes min, max, mean and standard deviation in a single pass ( Welford ).
+	runningStats struct {
+		n                  uint64
+		min, max, mean, m2 float64
+	}
+
+	flowFeaturesKey struct {
+		tcp  bool
+		a, b string
+	}
+
+	flowFeaturesState struct {
+		features      CaptureFlowFeatures
+		last          time.Time
+		sizes, iats   runningStats
+		syn, synACK   time.Time
+		rtt           tcpRTT
+		stalls        [2]tcpWindowStall
+		finFromClient bool
+		finFromServer bool
+		reset         bool
+	}
+
+	// flowFeatures splits segments into flows; flows end when they are reset, when both endpoints send `FIN`
+	// and a new connection reuses the same 5-tuple, when they are idle for too long, or when the capture ends.
+	flowFeatures struct {
+		flows map[flowFeaturesKey]*flowFeaturesState
+		done  []CaptureFlowFeatures
+	}
+)
+
+// flows without packets for this long are ended; i/e: UDP flows reusing the same 5-tuple
+const flowFeaturesIdleTimeout = 2 * time.Minute
+
+var flowFeaturesColumns = []string{
+	"start", "proto", "client", "server", "server_port", "duration_ms",
+	"packets", "bytes", "fwd_packets", "fwd_bytes", "bwd_packets", "bwd_bytes",
+	"size_min", "size_max", "size_mean", "size_std",
+	"iat_min_ms", "iat_max_ms", "iat_mean_ms", "iat_std_ms",
+	"syn", "fin", "rst", "psh", "ack", "urg",
+	"handshake_ms", "handshake_ack_ms", "rtt_ms", "stall_ms",
+}
+
+func (s *runningStats) add(x float64) {
+	if s.n == 0 || x < s.min {
+		s.min = x
+	}
+	if s.n == 0 || x > s.max {
+		s.max = x
+	}
+	s.n++
+	delta := x - s.mean
+	s.mean += delta / float64(s.n)
+	s.m2 += delta * (x - s.mean)
+}
+
+// std is the population standard deviation
+func (s *runningStats) std() float64 {
+	if s.n == 0 {
+		return 0
+	}
+	return math.Sqrt(s.m2 / float64(s.n))
+}
+
+func durationMillis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func newFlowFeatures() *flowFeatures {
+	return &flowFeatures{flows: make(map[flowFeaturesKey]*flowFeaturesState)}
+}
+
+func newFlowFeaturesKey(segment *captureSegment) flowFeaturesKey {
+	key := flowFeaturesKey{tcp: segment.isTCP, a: segment.src, b: segment.dst}
+	if key.b < key.a {
+		key.a, key.b = key.b, key.a
+	}
+	return key
+}
+
+// newFlowFeaturesState decides which endpoint is the client:
+// the sender of a SYN, the receiver of a SYN-ACK, or the endpoint using the higher port.
+func newFlowFeaturesState(segment *captureSegment) *flowFeaturesState {
+	state := &flowFeaturesState{
+		features: CaptureFlowFeatures{
+			Start:        segment.timestamp,
+			Proto:        "udp",
+			Client:       segment.src,
+			Server:       segment.dst,
+			ServerPort:   int32(segment.dstPort),
+			HandshakeRTT: -1,
+			HandshakeACK: -1,
+			RTT:          -1,
+		},
+	}
+	if segment.isTCP {
+		state.features.Proto = "tcp"
+	}
+
+	switch {
+	case segment.syn && !segment.ack:
+		// the sender is the client
+	case segment.syn && segment.ack, segment.srcPort < segment.dstPort:
+		state.features.Client, state.features.Server = segment.dst, segment.src
+		state.features.ServerPort = int32(segment.srcPort)
+	}
+	return state
+}
+
+// ended reports whether `segment` does not belong to the flow described by `s`.
+func (s *flowFeaturesState) ended(segment *captureSegment) bool {
+	if segment.timestamp.Sub(s.last) >= flowFeaturesIdleTimeout {
+		return true
+	}
+	closed := s.reset || (s.finFromClient && s.finFromServer)
+	return closed && segment.syn && !segment.ack
+}
+
+func (s *flowFeaturesState) observe(segment *captureSegment) {
+	features := &s.features
+	size := uint64(segment.length)
+
+	if features.Packets > 0 {
+		s.iats.add(durationMillis(segment.timestamp.Sub(s.last)))
+	}
+	s.last = segment.timestamp
+	s.sizes.add(float64(size))
+
+	features.Packets++
+	features.Bytes += size
+	fromClient := segment.src == features.Client
+	if fromClient {
+		features.FwdPackets++
+		features.FwdBytes += size
+	} else {
+		features.BwdPackets++
+		features.BwdBytes += size
+	}
+
+	if !segment.isTCP {
+		return
+	}
+
+	if segment.syn {
+		features.SYN++
+	}
+	if segment.fin {
+		features.FIN++
+		s.finFromClient = s.finFromClient || fromClient
+		s.finFromServer = s.finFromServer || !fromClient
+	}
+	if segment.rst {
+		features.RST++
+		s.reset = true
+	}
+	if segment.psh {
+		features.PSH++
+	}
+	if segment.ack {
+		features.ACK++
+	}
+	if segment.urg {
+		features.URG++
+	}
+
+	direction := 0
+	if !fromClient {
+		direction = 1
+	}
+	if segment.window != nil && segment.ack && !segment.syn && !segment.fin && !segment.rst {
+		s.stalls[direction].update(*segment.window, segment.timestamp)
+	}
+
+	// JSON translations carry the RTT estimated while capturing
+	if segment.rtt != nil {
+		features.RTT = *segment.rtt
+	} else if segment.tcp != nil {
+		s.rtt.observe(direction, segment.tcp, segment.timestamp)
+		if rtt := s.rtt.estimate(); rtt != nil {
+			features.RTT = durationMillis(rtt.smoothed)
+		}
+	}
+
+	switch {
+	case segment.syn && !segment.ack && fromClient:
+		// retransmitted SYNs do not restart the handshake
+		if s.syn.IsZero() {
+			s.syn = segment.timestamp
+		}
+	case segment.syn && segment.ack && !fromClient:
+		if !s.syn.IsZero() && s.synACK.IsZero() {
+			s.synACK = segment.timestamp
+			features.HandshakeRTT = durationMillis(s.synACK.Sub(s.syn))
+		}
+	case !segment.syn && segment.ack && fromClient:
+		if !s.synACK.IsZero() && features.HandshakeACK < 0 {
+			features.HandshakeACK = durationMillis(segment.timestamp.Sub(s.synACK))
+		}
+	}
+}
+
+func (s *flowFeaturesState) finalize() CaptureFlowFeatures {
+	features := s.features
+	features.Duration = durationMillis(s.last.Sub(features.Start))
+	features.SizeMin, features.SizeMax = s.sizes.min, s.sizes.max
+	features.SizeMean, features.SizeStd = s.sizes.mean, s.sizes.std()
+	features.IATMin, features.IATMax = s.iats.min, s.iats.max
+	features.IATMean, features.IATStd = s.iats.mean, s.iats.std()
+	features.Stalled = durationMillis(s.stalls[0].stalled(s.last) + s.stalls[1].stalled(s.last))
+	return features
+}
+
+func (f *flowFeatures) observe(segment *captureSegment) {
+	key := newFlowFeaturesKey(segment)
+	state, ok := f.flows[key]
+	if ok && state.ended(segment) {
+		f.done = append(f.done, state.finalize())
+		ok = false
+	}
+	if !ok {
+		f.expire(segment.timestamp)
+		state = newFlowFeaturesState(segment)
+		f.flows[key] = state
+	}
+	state.observe(segment)
+}
+
+// expire ends idle flows when too many flows are being tracked.
+func (f *flowFeatures) expire(now time.Time) {
+	if len(f.flows) < captureFlowsLimit {
+		return
+	}
+	for key, state := range f.flows {
+		if now.Sub(state.last) >= flowFeaturesIdleTimeout {
+			f.done = append(f.done, state.finalize())
+			delete(f.flows, key)
+		}
+	}
+}
+
+// finalize ends all flows, and sorts them by start time.
+func (f *flowFeatures) finalize() []CaptureFlowFeatures {
+	for _, state := range f.flows {
+		f.done = append(f.done, state.finalize())
+	}
+	clear(f.flows)
+
+	slices.SortFunc(f.done, func(a, b CaptureFlowFeatures) int {
+		if c := a.Start.Compare(b.Start); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Client, b.Client)
+	})
+	return f.done
+}
+
+// ExtractFlowFeatures computes the features of all TCP and UDP flows of a capture:
+// a PCAP or PCAPNG file, or JSON translations ( 1 per line ); any of them may be gzip compressed.
+func ExtractFlowFeatures(path string) ([]CaptureFlowFeatures, error) {
+	features := newFlowFeatures()
+	if err := readCapture(path, features.observe); err != nil {
+		return nil, err
+	}
+	return features.finalize(), nil
+}
+
+func formatFeature(value float64) string {
+	return strconv.FormatFloat(value, 'f', 3, 64)
+}
+
+func (f *CaptureFlowFeatures) csvRecord() []string {
+	counters := []uint64{
+		f.Packets, f.Bytes, f.FwdPackets, f.FwdBytes, f.BwdPackets, f.BwdBytes,
+	}
+	stats := []float64{
+		f.SizeMin, f.SizeMax, f.SizeMean, f.SizeStd,
+		f.IATMin, f.IATMax, f.IATMean, f.IATStd,
+	}
+	flags := []uint64{f.SYN, f.FIN, f.RST, f.PSH, f.ACK, f.URG}
+
+	record := make([]string, 0, len(flowFeaturesColumns))
+	record = append(record,
+		f.Start.UTC().Format(time.RFC3339Nano), f.Proto, f.Client, f.Server,
+		strconv.FormatInt(int64(f.ServerPort), 10), formatFeature(f.Duration))
+	for _, counter := range counters {
+		record = append(record, strconv.FormatUint(counter, 10))
+	}
+	for _, stat := range stats {
+		record = append(record, formatFeature(stat))
+	}
+	for _, flag := range flags {
+		record = append(record, strconv.FormatUint(flag, 10))
+	}
+	return append(record, formatFeature(f.HandshakeRTT), formatFeature(f.HandshakeACK), formatFeature(f.RTT), formatFeature(f.Stalled))
+}
+
+// WriteFlowFeaturesCSV writes a header followed by 1 row per flow; columns follow the order of `CaptureFlowFeatures`.
+func WriteFlowFeaturesCSV(writer io.Writer, features []CaptureFlowFeatures) error {
+	csvWriter := csv.NewWriter(writer)
+	if err := csvWriter.Write(flowFeaturesColumns); err != nil {
+		return err
+	}
+	for i := range features {
+		if err := csvWriter.Write(features[i].csvRecord()); err != nil {
+			return err
+		}
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
@@ -0,0 +1,132 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newFlowFeaturesTestSegment(ts time.Time, src, dst string, srcPort, dstPort uint16, flags string) *captureSegment {
+	return &captureSegment{
+		timestamp: ts,
+		length:    100,
+		src:       src,
+		dst:       dst,
+		srcPort:   srcPort,
+		dstPort:   dstPort,
+		isTCP:     true,
+		syn:       bytes.ContainsRune([]byte(flags), 'S'),
+		ack:       bytes.ContainsRune([]byte(flags), 'A'),
+		fin:       bytes.ContainsRune([]byte(flags), 'F'),
+		psh:       bytes.ContainsRune([]byte(flags), 'P'),
+	}
+}
+
+// TestFlowFeatures verifies handshake times, directions, and that a closed connection is not extended by a new one using the same 5-tuple.
+func TestFlowFeatures(t *testing.T) {
+	t.Parallel()
+
+	client, server := "10.0.0.1:40000", "10.0.0.2:443"
+	start := time.Unix(1700000000, 0)
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+
+	features := newFlowFeatures()
+	for _, segment := range []*captureSegment{
+		newFlowFeaturesTestSegment(at(0), client, server, 40000, 443, "S"),
+		newFlowFeaturesTestSegment(at(10), server, client, 443, 40000, "SA"),
+		newFlowFeaturesTestSegment(at(11), client, server, 40000, 443, "A"),
+		newFlowFeaturesTestSegment(at(20), client, server, 40000, 443, "PA"),
+		newFlowFeaturesTestSegment(at(30), client, server, 40000, 443, "FA"),
+		newFlowFeaturesTestSegment(at(40), server, client, 443, 40000, "FA"),
+		// same 5-tuple
+		newFlowFeaturesTestSegment(at(1000), client, server, 40000, 443, "S"),
+	} {
+		features.observe(segment)
+	}
+
+	flows := features.finalize()
+	if !assert.Len(t, flows, 2) {
+		return
+	}
+
+	flow := flows[0]
+	assert.Equal(t, "tcp", flow.Proto)
+	assert.Equal(t, client, flow.Client)
+	assert.Equal(t, server, flow.Server)
+	assert.Equal(t, int32(443), flow.ServerPort)
+	assert.Equal(t, 40.0, flow.Duration)
+	assert.Equal(t, uint64(6), flow.Packets)
+	assert.Equal(t, uint64(4), flow.FwdPackets)
+	assert.Equal(t, uint64(200), flow.BwdBytes)
+	assert.Equal(t, uint64(2), flow.SYN)
+	assert.Equal(t, uint64(2), flow.FIN)
+	assert.Equal(t, uint64(1), flow.PSH)
+	assert.Equal(t, 10.0, flow.HandshakeRTT)
+	assert.Equal(t, 1.0, flow.HandshakeACK)
+	assert.Equal(t, 1.0, flow.IATMin)
+	assert.Equal(t, 10.0, flow.IATMax)
+	assert.Equal(t, 8.0, flow.IATMean)
+	assert.Equal(t, 0.0, flow.SizeStd)
+
+	assert.Equal(t, at(1000), flows[1].Start)
+	assert.Equal(t, -1.0, flows[1].HandshakeRTT)
+}
+
+// TestFlowFeaturesServerPort verifies that the endpoint using the lower port is the server when the handshake is not captured.
+func TestFlowFeaturesServerPort(t *testing.T) {
+	t.Parallel()
+
+	features := newFlowFeatures()
+	features.observe(newFlowFeaturesTestSegment(time.Unix(1700000000, 0), "10.0.0.2:8080", "10.0.0.1:50000", 8080, 50000, "PA"))
+
+	flows := features.finalize()
+	if assert.Len(t, flows, 1) {
+		assert.Equal(t, "10.0.0.1:50000", flows[0].Client)
+		assert.Equal(t, int32(8080), flows[0].ServerPort)
+		assert.Equal(t, uint64(1), flows[0].BwdPackets)
+	}
+}
+
+func TestExtractFlowFeatures(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "capture.pcap")
+	writeCaptureDiffTestPCAP(t, path, time.Millisecond, 0)
+
+	flows, err := ExtractFlowFeatures(path)
+	assert.NoError(t, err)
+	assert.Len(t, flows, 10)
+
+	buffer := new(bytes.Buffer)
+	assert.NoError(t, WriteFlowFeaturesCSV(buffer, flows))
+
+	records, err := csv.NewReader(buffer).ReadAll()
+	assert.NoError(t, err)
+	if assert.Len(t, records, 11) {
+		assert.Equal(t, flowFeaturesColumns, records[0])
+		assert.Len(t, records[1], len(flowFeaturesColumns))
+		assert.Equal(t, "10.0.0.1:40000", records[1][2])
+		assert.Equal(t, "1.000", records[1][slices.Index(flowFeaturesColumns, "handshake_ms")])
+		// segments are not acknowledged
+		assert.Equal(t, "-1.000", records[1][slices.Index(flowFeaturesColumns, "rtt_ms")])
+	}
+}
@@ -17,14 +17,12 @@ package transformer
 import (
 	"context"
 	"fmt"
-	"io"
-	"os"
+	"log/slog"
 	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/Jeffail/gabs/v2"
 	"github.com/alphadose/haxmap"
 	sf "github.com/wissance/stringFormatter"
 	"github.com/zhangyunhao116/skipmap"
@@ -51,14 +49,37 @@ type (
 	Unlock = func(context.Context) (bool, *time.Duration)
 
 	flowMutex struct {
-		Debug                     bool
+		// may be shared with, and toggled by, the program embedding PCAP CLI; see `ContextDebugSwitch`
+		debug                     *atomic.Bool
+		logs                      *slog.Logger
 		MutexMap                  *haxmap.Map[uint64, *flowLockCarrier]
 		traceToHttpRequestMap     *haxmap.Map[string, *httpRequest]
 		flowToStreamToSequenceMap FTSTSM
+		// connections are only summarized if there is someone to report summaries to
+		onSummary func(*FlowSummaryEvent)
+		// `nil` if all flows are trace-tracked
+		sampler *traceTrackingSampler
+		// clients of connections whose handshake was not captured are the endpoints using ephemeral ports
+		ephemerals *PcapEphemeralPorts
+		// unix nanos of the last iteration of the reaper; shared with the transformer to report its health
+		reapedAt *atomic.Int64
 	}
 
 	flowLock struct {
 		IsHTTP2                func() bool
+		Serial                 func() uint64
+		ProxyProtocol          func() *proxyProtocolHeader
+		InspectProxyProtocol   func(seq uint32, data []byte) (*proxyProtocolHeader, int)
+		HTTP2HeadersDecoder    func(srcPort uint16) *http2HeadersDecoder
+		GRPCCalls              func() *grpcCalls
+		WebSocket              func() *webSocketFlow
+		UpgradeToWebSocket     func()
+		CacheFlow              func() *cacheFlow
+		MailFlow               func() *mailFlow
+		BrokerFlow             func() *brokerFlow
+		ICMPError              func() *icmpFlowError
+		Summary                func() *flowSummary
+		TraceTracked           func() bool
 		Unlock                 Unlock
 		UnlockAndRelease       Unlock
 		UnlockWithTCPFlags     UnlockWithTCPFlags
@@ -76,6 +97,26 @@ type (
 		lastUnlockedAt *time.Time
 		isHTTP2        bool
 		activeRequests *atomic.Int64
+		// PROXY protocol header is only sent once at the beginning of the connection
+		proxyProtocol proxyProtocolFlow
+		// HPACK state is kept per direction: the source port identifies the direction within a flow
+		http2Decoders map[uint16]*http2HeadersDecoder
+		// gRPC calls are tracked by stream: `DATA` frames and trailers do not carry the RPC
+		grpcCalls *grpcCalls
+		// connections upgraded to WebSocket ( HTTP/1.1 `101` ) carry WebSocket frames instead of HTTP messages
+		webSocket *webSocketFlow
+		// Redis and Memcached commands waiting for their replies
+		cacheFlow *cacheFlow
+		// SMTP, IMAP and POP3 message bodies and `STARTTLS` transitions
+		mailFlow *mailFlow
+		// AMQP and Kafka frames in progress, and Kafka requests waiting for their responses
+		brokerFlow *brokerFlow
+		// the most recent ICMP error referencing this flow; i/e: `packet too big`
+		icmpErrors *icmpFlowErrors
+		// counters reported when the connection is untracked; `nil` if summaries are disabled
+		summary *flowSummary
+		// sampling decision taken when the 1st request carrying trace information is seen; `nil` until then
+		traceTracked *bool
 	}
 
 	TracedFlow struct {
@@ -85,6 +126,7 @@ type (
 		ts        *traceAndSpan
 		isActive  *atomic.Bool
 		unblocker *time.Timer
+		trackedAt time.Time
 	}
 
 	STTFM  = *skipmap.Uint32Map[*TracedFlow] // SequenceTo[TracedFlow]Map
@@ -102,18 +144,48 @@ func newFlowMutex(
 	debug bool,
 	flowToStreamToSequenceMap FTSTSM,
 	traceToHttpRequestMap *haxmap.Map[string, *httpRequest],
+	onSummary func(*FlowSummaryEvent),
+	sampler *traceTrackingSampler,
+	ephemerals *PcapEphemeralPorts,
 ) *flowMutex {
 	fm := &flowMutex{
-		Debug:                     debug,
 		MutexMap:                  haxmap.New[uint64, *flowLockCarrier](),
 		flowToStreamToSequenceMap: flowToStreamToSequenceMap,
 		traceToHttpRequestMap:     traceToHttpRequestMap,
+		onSummary:                 onSummary,
+		sampler:                   sampler,
+		ephemerals:                ephemerals,
+		logs:                      loggerOf(ctx),
+	}
+	if debugSwitch, ok := ctx.Value(ContextDebugSwitch).(*atomic.Bool); ok {
+		fm.debug = debugSwitch
+	} else {
+		fm.debug = new(atomic.Bool)
+		fm.debug.Store(debug)
+	}
+	if reapedAt, ok := ctx.Value(contextReapedAt).(*atomic.Int64); ok {
+		fm.reapedAt = reapedAt
+	} else {
+		fm.reapedAt = new(atomic.Int64)
 	}
 	// reap orphaned `flowLockCarrier`s
 	go fm.startReaper(ctx) // don't fear the reaper
 	return fm
 }
 
+// logger is `nil` safe: tests create flow mutexes without `newFlowMutex`.
+func (fm *flowMutex) logger() *slog.Logger {
+	if fm.logs == nil {
+		return transformerLogger
+	}
+	return fm.logs
+}
+
+// isDebug is `nil` safe: tests create flow mutexes without `newFlowMutex`.
+func (fm *flowMutex) isDebug() bool {
+	return fm.debug != nil && fm.debug.Load()
+}
+
 func (fm *flowMutex) log(
 	ctx context.Context,
 	serial *uint64,
@@ -123,46 +195,30 @@ func (fm *flowMutex) log(
 	timestamp *time.Time,
 	message *string,
 ) {
-	if !fm.Debug {
+	logger := fm.logger()
+	if !fm.isDebug() || !logger.Enabled(ctx, slog.LevelDebug) {
 		return
 	}
 
-	json := gabs.New()
-
 	id := ctx.Value(ContextID)
 	logName := ctx.Value(ContextLogName)
 
-	pcap, _ := json.Object("pcap")
-	pcap.Set(id, "id")
-	pcap.Set(logName, "ctx")
-
 	serialStr := strconv.FormatUint(*serial, 10)
-	pcap.Set(serialStr, "num")
-
 	flowIDstr := strconv.FormatUint(*flowID, 10)
-	json.Set(flowIDstr, "flow")
-
-	tcpJSON, _ := json.Object("tcp")
-	tcpJSON.Set(tcpFlagsStr[*tcpFlags], "flags")
-	tcpJSON.Set(*seq, "seq")
-	tcpJSON.Set(*ack, "ack")
-
-	timestampJSON, _ := json.Object("timestamp")
-	timestampJSON.Set(timestamp.Unix(), "seconds")
-	timestampJSON.Set(timestamp.Nanosecond(), "nanos")
-
-	labels, _ := json.Object("logging.googleapis.com/labels")
-	labels.Set("pcap", "run.googleapis.com/tool")
-	labels.Set(id, "run.googleapis.com/pcap/id")
-	labels.Set(logName, "run.googleapis.com/pcap/name")
-
-	operation, _ := json.Object("logging.googleapis.com/operation")
-	operation.Set(sf.Format("{0}/debug", logName), "producer")
-	operation.Set(sf.Format("{0}/flow/{1}/debug", id, flowIDstr), "id")
 
-	json.Set(sf.Format("#:{0} | flow:{1} | {2}", serialStr, flowIDstr, *message), "message")
-
-	io.WriteString(os.Stderr, json.String()+"\n")
+	logger.LogAttrs(ctx, slog.LevelDebug,
+		sf.Format("#:{0} | flow:{1} | {2}", serialStr, flowIDstr, *message),
+		slog.Group("pcap", slog.Any("id", id), slog.Any("ctx", logName), slog.String("num", serialStr)),
+		slog.String("flow", flowIDstr),
+		slog.Group("tcp", slog.String("flags", tcpFlagsStr[*tcpFlags]), slog.Any("seq", *seq), slog.Any("ack", *ack)),
+		slog.Group("timestamp", slog.Int64("seconds", timestamp.Unix()), slog.Int("nanos", timestamp.Nanosecond())),
+		slog.Group("logging.googleapis.com/labels",
+			slog.String("run.googleapis.com/tool", "pcap"),
+			slog.Any("run.googleapis.com/pcap/id", id),
+			slog.Any("run.googleapis.com/pcap/name", logName)),
+		slog.Group("logging.googleapis.com/operation",
+			slog.String("producer", sf.Format("{0}/debug", logName)),
+			slog.String("id", sf.Format("{0}/flow/{1}/debug", id, flowIDstr))))
 }
 
 func (fm *flowMutex) startReaper(ctx context.Context) {
@@ -171,6 +227,7 @@ func (fm *flowMutex) startReaper(ctx context.Context) {
 	//   - a new carrier will be created to hold its flow lock, and this new carrier will not be organically reaped.
 	// additionally: for connection pooling, long running not-used connections should be dropped to reclaim memory.
 	ticker := time.NewTicker(carrierDeadline)
+	fm.reapedAt.Store(time.Now().UnixNano())
 
 	for {
 		select {
@@ -178,6 +235,7 @@ func (fm *flowMutex) startReaper(ctx context.Context) {
 			ticker.Stop()
 			return
 		case <-ticker.C:
+			fm.reapedAt.Store(time.Now().UnixNano())
 			fm.MutexMap.ForEach(
 				func(flowID uint64, carrier *flowLockCarrier) bool {
 					if carrier == nil ||
@@ -188,10 +246,9 @@ func (fm *flowMutex) startReaper(ctx context.Context) {
 					defer carrier.mu.Unlock()
 					lastUnlocked := time.Since(*carrier.lastUnlockedAt)
 					if lastUnlocked >= carrierDeadline {
-						fm.untrackConnection(ctx, &flowID, carrier)
+						fm.untrackConnection(ctx, &flowID, carrier, flowSummaryReaped)
 						fm.MutexMap.Del(flowID)
-						io.WriteString(os.Stderr,
-							sf.Format("reaped flow '{0}' after {1}\n", flowID, lastUnlocked.String()))
+						fm.logger().Debug("reaped flow", "flow", flowID, "unlocked", lastUnlocked.String())
 					}
 					return true
 				})
@@ -293,11 +350,12 @@ func (fm *flowMutex) trackConnection(
 	var isActive atomic.Bool
 
 	tf := &TracedFlow{
-		lock:     lock,
-		serial:   serial,
-		flowID:   flowID,
-		ts:       ts,
-		isActive: &isActive,
+		lock:      lock,
+		serial:    serial,
+		flowID:    flowID,
+		ts:        ts,
+		isActive:  &isActive,
+		trackedAt: time.Now(),
 	}
 
 	isActive.Store(true)
@@ -348,14 +406,29 @@ func (fm *flowMutex) trackConnection(
 	return tf, true
 }
 
+// forEachTracedFlow visits the traced requests of all flows; streams are visited in full before moving to the next one.
+func (fm *flowMutex) forEachTracedFlow(fn func(flowID uint64, streamID uint32, sequence uint32, tf *TracedFlow)) {
+	fm.flowToStreamToSequenceMap.ForEach(func(flowID uint64, stsm STSM) bool {
+		stsm.ForEach(func(streamID uint32, sttfm STTFM) bool {
+			sttfm.Range(func(sequence uint32, tf *TracedFlow) bool {
+				fn(flowID, streamID, sequence, tf)
+				return true
+			})
+			return true
+		})
+		return true
+	})
+}
+
 func (fm *flowMutex) untrackConnection(
 	_ context.Context,
 	flowID *uint64,
 	lock *flowLockCarrier,
+	reason string,
 ) {
 	defer func() {
-		if r := recover(); r != nil && fm.Debug {
-			transformerLogger.Println("panic@untrackConnection: ", r)
+		if r := recover(); r != nil && fm.isDebug() {
+			fm.logger().Error("panic@untrackConnection", "error", fmt.Sprint(r))
 		}
 	}()
 
@@ -402,6 +475,18 @@ func (fm *flowMutex) untrackConnection(
 	}
 
 	fm.MutexMap.Del(*flowID)
+
+	fm.summarize(flowID, lock, reason)
+}
+
+// summarize emits the summary of a flow at most once; it does not require holding the flow lock.
+func (fm *flowMutex) summarize(flowID *uint64, lock *flowLockCarrier, reason string) {
+	if fm.onSummary == nil {
+		return
+	}
+	if summary := lock.summary.finalize(*flowID, reason); summary != nil {
+		fm.onSummary(summary)
+	}
 }
 
 func (fm *flowMutex) newFlowLockCarrier(
@@ -414,6 +499,11 @@ func (fm *flowMutex) newFlowLockCarrier(
 	released.Store(false)
 	createdAt := time.Now()
 
+	var summary *flowSummary = nil
+	if fm.onSummary != nil {
+		summary = newFlowSummary(fm.ephemerals)
+	}
+
 	return &flowLockCarrier{
 		mu:             new(sync.Mutex),
 		wg:             new(sync.WaitGroup),
@@ -422,6 +512,8 @@ func (fm *flowMutex) newFlowLockCarrier(
 		released:       &released,
 		createdAt:      &createdAt,
 		activeRequests: &activeRequests,
+		icmpErrors:     new(icmpFlowErrors),
+		summary:        summary,
 	}
 }
 
@@ -485,13 +577,16 @@ func (fm *flowMutex) lock(
 	lockAcquiredTS := time.Now()
 	carrier.lastLockedAt = &lockAcquiredTS
 
+	if *tcpFlags&(tcpSyn|tcpAck) == tcpSyn {
+		carrier.proxyProtocol.observeSYN(*seq)
+	}
+
 	tracedFlowProvider, _ := fm.getTracedFlow(flowID, seq, ack, local)
 
 	_unlock := func() {
 		defer func(mu *sync.Mutex) {
 			if err := recover(); err != nil {
-				io.WriteString(os.Stderr,
-					fmt.Sprintf("error at flow[%d]: %+v | %+v\n", *flowID, err, mu))
+				fm.logger().Error("failed to unlock flow", "flow", *flowID, "error", fmt.Sprintf("%+v", err))
 			}
 		}(mu)
 		defer mu.Unlock()
@@ -506,18 +601,23 @@ func (fm *flowMutex) lock(
 		// then both will release the lock, but just 1 must yield connection untracking.
 		if carrier.activeRequests.Load() == 0 &&
 			carrier.released.CompareAndSwap(false, true) {
+			reason := flowSummaryFIN
+			if *tcpFlags&tcpRst != 0 {
+				reason = flowSummaryRST
+			}
+			carrier.summary.terminate(reason)
 			// termination packets will clean the tracing info available for each flow:
 			//   - give some margin for all other packets to access flow state, and then flush it.
 			select {
 			case <-ctx.Done():
 				// untrack connection immediately if the context is done
-				fm.untrackConnection(ctx, flowID, carrier)
+				fm.untrackConnection(ctx, flowID, carrier, reason)
 			default:
 				time.AfterFunc(trackingDeadline, func() {
 					timestamp := time.Now()
 					message := "untracking"
 					go fm.log(ctx, serial, flowID, tcpFlags, seq, ack, &timestamp, &message)
-					fm.untrackConnection(ctx, flowID, carrier)
+					fm.untrackConnection(ctx, flowID, carrier, reason)
 				})
 			}
 			lockLatency := time.Since(lockAcquiredTS)
@@ -547,6 +647,75 @@ func (fm *flowMutex) lock(
 
 	IsHTTP2FN := func() bool { return carrier.isHTTP2 }
 
+	SerialFN := func() uint64 { return *serial }
+	ProxyProtocolFN := func() *proxyProtocolHeader { return carrier.proxyProtocol.header }
+	InspectProxyProtocolFN := func(seq uint32, data []byte) (*proxyProtocolHeader, int) {
+		return carrier.proxyProtocol.inspect(seq, data)
+	}
+
+	HTTP2HeadersDecoderFN := func(srcPort uint16) *http2HeadersDecoder {
+		if carrier.http2Decoders == nil {
+			carrier.http2Decoders = make(map[uint16]*http2HeadersDecoder, 2)
+		}
+		decoder, ok := carrier.http2Decoders[srcPort]
+		if !ok {
+			decoder = newHTTP2HeadersDecoder()
+			carrier.http2Decoders[srcPort] = decoder
+		}
+		return decoder
+	}
+
+	GRPCCallsFN := func() *grpcCalls {
+		if carrier.grpcCalls == nil {
+			carrier.grpcCalls = newGRPCCalls()
+		}
+		return carrier.grpcCalls
+	}
+
+	WebSocketFN := func() *webSocketFlow { return carrier.webSocket }
+	UpgradeToWebSocketFN := func() {
+		if carrier.webSocket == nil {
+			carrier.webSocket = newWebSocketFlow()
+		}
+	}
+
+	CacheFlowFN := func() *cacheFlow {
+		if carrier.cacheFlow == nil {
+			carrier.cacheFlow = newCacheFlow()
+		}
+		return carrier.cacheFlow
+	}
+
+	MailFlowFN := func() *mailFlow {
+		if carrier.mailFlow == nil {
+			carrier.mailFlow = newMailFlow()
+		}
+		return carrier.mailFlow
+	}
+
+	BrokerFlowFN := func() *brokerFlow {
+		if carrier.brokerFlow == nil {
+			carrier.brokerFlow = newBrokerFlow()
+		}
+		return carrier.brokerFlow
+	}
+
+	ICMPErrorFN := func() *icmpFlowError {
+		return carrier.icmpErrors.get()
+	}
+
+	SummaryFN := func() *flowSummary { return carrier.summary }
+
+	// flows that are not sampled bypass trace tracking entirely:
+	//   - no requests are recorded for them, so termination packets never wait on them.
+	TraceTrackedFN := func() bool {
+		if carrier.traceTracked == nil {
+			tracked := fm.sampler.sample(*carrier.flowID, lockAcquiredTS)
+			carrier.traceTracked = &tracked
+		}
+		return *carrier.traceTracked
+	}
+
 	// since all TCP data is known:
 	//   - it is possible to return a `traceID`
 	//   - since this is guarded by a lock, it is thread-safe
@@ -554,10 +723,23 @@ func (fm *flowMutex) lock(
 
 	// these are the only methods for consumers to interact with the lock
 	lock := &flowLock{
-		IsHTTP2:            IsHTTP2FN,
-		Unlock:             UnlockFn,
-		UnlockAndRelease:   UnlockAndReleaseFN,
-		UnlockWithTCPFlags: UnlockWithTCPFlagsFN,
+		IsHTTP2:              IsHTTP2FN,
+		Serial:               SerialFN,
+		ProxyProtocol:        ProxyProtocolFN,
+		InspectProxyProtocol: InspectProxyProtocolFN,
+		HTTP2HeadersDecoder:  HTTP2HeadersDecoderFN,
+		GRPCCalls:            GRPCCallsFN,
+		WebSocket:            WebSocketFN,
+		UpgradeToWebSocket:   UpgradeToWebSocketFN,
+		CacheFlow:            CacheFlowFN,
+		MailFlow:             MailFlowFN,
+		BrokerFlow:           BrokerFlowFN,
+		ICMPError:            ICMPErrorFN,
+		Summary:              SummaryFN,
+		TraceTracked:         TraceTrackedFN,
+		Unlock:               UnlockFn,
+		UnlockAndRelease:     UnlockAndReleaseFN,
+		UnlockWithTCPFlags:   UnlockWithTCPFlagsFN,
 	}
 
 	if *tcpFlags&(tcpSyn|tcpFin|tcpRst) == 0 {
@@ -591,7 +773,8 @@ func (fm *flowMutex) lock(
 			// handle flow `unlock` for requests
 			if sizeOfRequestTraceAndSpans > 0 || sizeOfRequestStreams > 0 {
 				for _, stream := range requestStreams {
-					if ts, tsAvailable := requestTS[stream]; tsAvailable {
+					// flows that are not sampled are never trace-tracked, so they never block termination packets
+					if ts, tsAvailable := requestTS[stream]; tsAvailable && TraceTrackedFN() {
 						// tracking connections allows for HTTP responses without trace headers
 						// to be correlated with the request that brought them to existence.
 						if tf, tracked := fm.trackConnection(ctx,
@@ -0,0 +1,86 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/segmentio/fasthash/fnv1a"
+)
+
+// flowSampler keeps all packets of 1 out of every `rate` flows: flows are sampled if `hash(flow) mod rate == 0`.
+// The hash does not depend on interfaces nor on direction, so all instances sample the same flows.
+type flowSampler struct {
+	rate uint64
+}
+
+// newFlowSampler returns `nil` if all flows must be kept.
+func newFlowSampler(rate uint) *flowSampler {
+	if rate <= 1 {
+		return nil
+	}
+	return &flowSampler{rate: uint64(rate)}
+}
+
+// flowSamplingHash is FNV-1a 64 of the IP protocol followed by the lower and then the higher endpoint:
+// 16 bytes IP addresses ( IPv4 addresses are IPv4-mapped ), and big-endian ports; ports are `0` if not available.
+func flowSamplingHash(packet gopacket.Packet) (uint64, bool) {
+	var srcIP, dstIP net.IP
+	var protocol layers.IPProtocol
+	switch ip := packet.NetworkLayer().(type) {
+	case *layers.IPv4:
+		srcIP, dstIP, protocol = ip.SrcIP.To16(), ip.DstIP.To16(), ip.Protocol
+	case *layers.IPv6:
+		srcIP, dstIP, protocol = ip.SrcIP.To16(), ip.DstIP.To16(), ip.NextHeader
+	default:
+		return 0, false
+	}
+	if srcIP == nil || dstIP == nil {
+		return 0, false
+	}
+
+	var srcPort, dstPort uint16
+	switch l4 := packet.TransportLayer().(type) {
+	case *layers.TCP:
+		srcPort, dstPort = uint16(l4.SrcPort), uint16(l4.DstPort)
+	case *layers.UDP:
+		srcPort, dstPort = uint16(l4.SrcPort), uint16(l4.DstPort)
+	case *layers.SCTP:
+		srcPort, dstPort = uint16(l4.SrcPort), uint16(l4.DstPort)
+	}
+
+	src := binary.BigEndian.AppendUint16(append(make([]byte, 0, net.IPv6len+2), srcIP...), srcPort)
+	dst := binary.BigEndian.AppendUint16(append(make([]byte, 0, net.IPv6len+2), dstIP...), dstPort)
+	if bytes.Compare(src, dst) > 0 {
+		src, dst = dst, src
+	}
+
+	hash := fnv1a.AddBytes64(fnv1a.Init64, []byte{byte(protocol)})
+	hash = fnv1a.AddBytes64(hash, src)
+	return fnv1a.AddBytes64(hash, dst), true
+}
+
+// sample returns whether the packet must be translated; packets without IP addresses are always translated.
+func (s *flowSampler) sample(packet gopacket.Packet) bool {
+	if s == nil {
+		return true
+	}
+	hash, ok := flowSamplingHash(packet)
+	return !ok || hash%s.rate == 0
+}
@@ -0,0 +1,72 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestFlowSamplingHash verifies that both directions of a flow share the same hash, and that the hash is stable:
+// other implementations must be able to sample the same flows.
+func TestFlowSamplingHash(t *testing.T) {
+	t.Parallel()
+
+	client, server := net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)
+
+	hash, ok := flowSamplingHash(newTestTCPPacket(t, client, server, 40000, 443))
+	assert.True(t, ok)
+	assert.Equal(t, uint64(971415374661625888), hash)
+
+	reply, ok := flowSamplingHash(newTestTCPPacket(t, server, client, 443, 40000))
+	assert.True(t, ok)
+	assert.Equal(t, hash, reply)
+
+	other, _ := flowSamplingHash(newTestTCPPacket(t, client, server, 40001, 443))
+	assert.NotEqual(t, hash, other)
+
+	arp := gopacket.NewPacket([]byte{0, 1, 8, 0, 6, 4, 0, 1}, layers.LayerTypeARP, gopacket.Default)
+	_, ok = flowSamplingHash(arp)
+	assert.False(t, ok)
+	assert.True(t, newFlowSampler(10).sample(arp))
+}
+
+// TestFlowSampler verifies that about 1 out of every N flows is sampled, and that all of their packets are.
+func TestFlowSampler(t *testing.T) {
+	t.Parallel()
+
+	assert.Nil(t, newFlowSampler(0))
+	assert.Nil(t, newFlowSampler(1))
+
+	client, server := net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)
+	var nilSampler *flowSampler
+	assert.True(t, nilSampler.sample(newTestTCPPacket(t, client, server, 40000, 443)))
+
+	sampler := newFlowSampler(10)
+	sampled := 0
+	for port := range 10000 {
+		request := newTestTCPPacket(t, client, server, layers.TCPPort(20000+port), 443)
+		response := newTestTCPPacket(t, server, client, 443, layers.TCPPort(20000+port))
+		assert.Equal(t, sampler.sample(request), sampler.sample(response))
+		if sampler.sample(request) {
+			sampled++
+		}
+	}
+	assert.InDelta(t, 1000, sampled, 150)
+}
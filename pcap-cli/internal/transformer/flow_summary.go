@@ -0,0 +1,226 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"encoding/json"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+)
+
+type (
+	// FlowSummaryEvent describes a TCP connection once it is no longer tracked; just like a NetFlow record:
+	//   - `Fwd*` counters describe segments sent by the client, and `Bwd*` counters segments sent by the server,
+	//   - the client is the sender of the `SYN`, or the endpoint using the higher port if the handshake was not translated,
+	//   - RTTs are zero if the connection was not observed for long enough to estimate them.
+	FlowSummaryEvent struct {
+		FlowID          uint64
+		Client, Server  netip.AddrPort
+		Start, End      time.Time
+		FwdPackets      uint64
+		FwdBytes        uint64
+		BwdPackets      uint64
+		BwdBytes        uint64
+		HandshakeRTT    time.Duration
+		RTT             time.Duration
+		Retransmissions uint64
+		HTTPRequests    uint64
+		// trace context of the most recent traced HTTP request sent over the connection
+		TraceID, SpanID string
+		// `fin`, `rst`, `reaped` if the connection was idle for too long, or `capture_end`
+		Reason string
+	}
+
+	// flowSummary accumulates the counters of 1 connection; translations of the same connection run concurrently.
+	flowSummary struct {
+		mu             sync.Mutex
+		endpoints      [2]netip.AddrPort
+		packets, bytes [2]uint64
+		client         int
+		// tells clients from servers when the handshake was not captured
+		ephemerals      *PcapEphemeralPorts
+		start, end      time.Time
+		rtt             *tcpRTTEstimate
+		rttSerial       uint64
+		retransmissions uint64
+		httpRequests    uint64
+		traceID, spanID string
+		reason          string
+		emitted         bool
+	}
+)
+
+const (
+	flowSummaryFIN        = "fin"
+	flowSummaryRST        = "rst"
+	flowSummaryReaped     = "reaped"
+	flowSummaryCaptureEnd = "capture_end"
+)
+
+func newFlowSummary(ephemerals *PcapEphemeralPorts) *flowSummary {
+	return &flowSummary{client: -1, ephemerals: ephemerals}
+}
+
+// MarshalJSON renders durations as milliseconds.
+func (e *FlowSummaryEvent) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&struct {
+		FlowID          uint64  `json:"flow,string"`
+		Client          string  `json:"client"`
+		Server          string  `json:"server"`
+		Start           string  `json:"start"`
+		End             string  `json:"end"`
+		Duration        float64 `json:"duration_ms"`
+		FwdPackets      uint64  `json:"fwd_packets"`
+		FwdBytes        uint64  `json:"fwd_bytes"`
+		BwdPackets      uint64  `json:"bwd_packets"`
+		BwdBytes        uint64  `json:"bwd_bytes"`
+		HandshakeRTT    float64 `json:"handshake_rtt_ms,omitempty"`
+		RTT             float64 `json:"rtt_ms,omitempty"`
+		Retransmissions uint64  `json:"retransmissions"`
+		HTTPRequests    uint64  `json:"http_requests"`
+		TraceID         string  `json:"trace_id,omitempty"`
+		SpanID          string  `json:"span_id,omitempty"`
+		Reason          string  `json:"reason"`
+	}{
+		e.FlowID, e.Client.String(), e.Server.String(),
+		e.Start.UTC().Format(time.RFC3339Nano), e.End.UTC().Format(time.RFC3339Nano),
+		durationMillis(e.End.Sub(e.Start)),
+		e.FwdPackets, e.FwdBytes, e.BwdPackets, e.BwdBytes,
+		durationMillis(e.HandshakeRTT), durationMillis(e.RTT),
+		e.Retransmissions, e.HTTPRequests, e.TraceID, e.SpanID, e.Reason,
+	})
+}
+
+// observe must be invoked by every translation of a TCP segment of the connection.
+func (s *flowSummary) observe(packet *gopacket.Packet, serial, flowID uint64, syn, ack bool) {
+	if s == nil {
+		return
+	}
+	event := newFlowEvent(packet, serial, flowID)
+	src, dst := event.Src, event.Dst
+	metadata := (*packet).Metadata()
+	analysis := tcpAnalysisOf(*packet)
+	rtt := tcpRTTOf(*packet)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	endpoint := 0
+	switch {
+	case !s.endpoints[0].IsValid() || s.endpoints[0] == src:
+		s.endpoints[0] = src
+	default:
+		endpoint = 1
+		s.endpoints[1] = src
+	}
+	if !s.endpoints[1-endpoint].IsValid() {
+		s.endpoints[1-endpoint] = dst
+	}
+
+	s.packets[endpoint]++
+	s.bytes[endpoint] += uint64(metadata.Length)
+
+	if s.start.IsZero() || event.Timestamp.Before(s.start) {
+		s.start = event.Timestamp
+	}
+	if event.Timestamp.After(s.end) {
+		s.end = event.Timestamp
+	}
+
+	if syn && !ack {
+		s.client = endpoint
+	} else if syn && ack {
+		s.client = 1 - endpoint
+	}
+
+	// translations are concurrent: the estimate attached to the latest segment is the most accurate
+	if rtt != nil && serial >= s.rttSerial {
+		s.rtt, s.rttSerial = rtt, serial
+	}
+	if analysis.isRetransmission() {
+		s.retransmissions++
+	}
+}
+
+func (s *flowSummary) observeHTTPRequest(traceID, spanID string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.httpRequests++
+	if traceID != "" {
+		s.traceID, s.spanID = traceID, spanID
+	}
+	s.mu.Unlock()
+}
+
+// terminate records the reason why the connection is no longer tracked; only the 1st reason is kept.
+func (s *flowSummary) terminate(reason string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.reason == "" {
+		s.reason = reason
+	}
+	s.mu.Unlock()
+}
+
+// finalize returns `nil` if the summary was already emitted, or if no segments were observed.
+func (s *flowSummary) finalize(flowID uint64, reason string) *FlowSummaryEvent {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.emitted || s.start.IsZero() {
+		return nil
+	}
+	s.emitted = true
+	if s.reason == "" {
+		s.reason = reason
+	}
+
+	client := s.client
+	if client < 0 {
+		client = s.ephemerals.clientOf(&s.endpoints)
+	}
+	server := 1 - client
+
+	event := &FlowSummaryEvent{
+		FlowID:          flowID,
+		Client:          s.endpoints[client],
+		Server:          s.endpoints[server],
+		Start:           s.start,
+		End:             s.end,
+		FwdPackets:      s.packets[client],
+		FwdBytes:        s.bytes[client],
+		BwdPackets:      s.packets[server],
+		BwdBytes:        s.bytes[server],
+		Retransmissions: s.retransmissions,
+		HTTPRequests:    s.httpRequests,
+		TraceID:         s.traceID,
+		SpanID:          s.spanID,
+		Reason:          s.reason,
+	}
+	if s.rtt != nil {
+		event.HandshakeRTT, event.RTT = s.rtt.handshake, s.rtt.smoothed
+	}
+	return event
+}
@@ -0,0 +1,108 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type flowSummaryTestConn struct {
+	*tcpAnalysisTestConn
+	summary *flowSummary
+}
+
+func (c *flowSummaryTestConn) segment(ms int, fromClient bool, seq, ack uint32, payload string, flags string) {
+	c.tcpAnalysisTestConn.segment(ms, fromClient, seq, ack, payload, flags)
+	c.last.Metadata().Length = len(c.last.Data())
+	c.summary.observe(&c.last, c.serial, 42, strings.Contains(flags, "S"), strings.Contains(flags, "A"))
+}
+
+func newFlowSummaryTestConn(t *testing.T) *flowSummaryTestConn {
+	return &flowSummaryTestConn{
+		tcpAnalysisTestConn: &tcpAnalysisTestConn{
+			t: t, analyzer: newTCPAnalyzer(nil), start: time.Unix(1700000000, 0), window: 1024,
+		},
+		summary: newFlowSummary(nil),
+	}
+}
+
+func TestFlowSummary(t *testing.T) {
+	t.Parallel()
+
+	c := newFlowSummaryTestConn(t)
+	c.segment(0, true, 1000, 0, "", "S")
+	c.segment(10, false, 5000, 1001, "", "SA")
+	c.segment(11, true, 1001, 5001, "", "A")
+	c.segment(20, true, 1001, 5001, "hello", "A")
+	c.segment(300, true, 1001, 5001, "hello", "A")
+	c.segment(310, false, 5001, 1006, "world!", "A")
+	c.summary.observeHTTPRequest("4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7")
+	c.summary.terminate(flowSummaryRST)
+	c.segment(320, true, 1006, 5007, "", "RA")
+
+	event := c.summary.finalize(42, flowSummaryCaptureEnd)
+	if !assert.NotNil(t, event) {
+		return
+	}
+	assert.Equal(t, "10.0.0.1:40000", event.Client.String())
+	assert.Equal(t, "10.0.0.2:443", event.Server.String())
+	assert.Equal(t, 320*time.Millisecond, event.End.Sub(event.Start))
+	assert.Equal(t, uint64(5), event.FwdPackets)
+	assert.Equal(t, uint64(2), event.BwdPackets)
+	assert.Equal(t, uint64(5*40+10), event.FwdBytes)
+	assert.Equal(t, uint64(2*40+6), event.BwdBytes)
+	assert.Equal(t, uint64(1), event.Retransmissions)
+	assert.Equal(t, uint64(1), event.HTTPRequests)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", event.TraceID)
+	assert.Equal(t, flowSummaryRST, event.Reason)
+	assert.Equal(t, 11*time.Millisecond, event.HandshakeRTT)
+
+	// summaries are emitted only once
+	assert.Nil(t, c.summary.finalize(42, flowSummaryReaped))
+
+	raw, err := json.Marshal(event)
+	assert.NoError(t, err)
+	assert.Contains(t, string(raw), `"flow":"42"`)
+	assert.Contains(t, string(raw), `"duration_ms":320`)
+	assert.Contains(t, string(raw), `"reason":"rst"`)
+}
+
+func TestFlowSummaryWithoutHandshake(t *testing.T) {
+	t.Parallel()
+
+	c := newFlowSummaryTestConn(t)
+	c.segment(0, false, 5001, 1001, "world!", "A")
+	c.segment(5, true, 1001, 5007, "", "A")
+
+	event := c.summary.finalize(42, flowSummaryReaped)
+	if assert.NotNil(t, event) {
+		// the endpoint using the higher port is the client
+		assert.Equal(t, "10.0.0.1:40000", event.Client.String())
+		assert.Equal(t, uint64(1), event.FwdPackets)
+		assert.Equal(t, flowSummaryReaped, event.Reason)
+		assert.Zero(t, event.HandshakeRTT)
+	}
+
+	// connections without translated segments are not summarized
+	var disabled *flowSummary
+	disabled.observeHTTPRequest("", "")
+	assert.Nil(t, disabled.finalize(42, flowSummaryFIN))
+	assert.Nil(t, newFlowSummary(nil).finalize(42, flowSummaryFIN))
+}
@@ -0,0 +1,261 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"encoding/binary"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Jeffail/gabs/v2"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+type (
+	grpcMessage struct {
+		compressed bool
+		length     uint32
+		// the message continues in subsequent `DATA` frames
+		partial bool
+	}
+
+	// grpcCall is a single RPC: gRPC maps every call to its own HTTP/2 stream.
+	//   - see: https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-HTTP2.md
+	grpcCall struct {
+		rpc, service, method, authority string
+		// source port of the client: identifies the direction of `DATA` frames
+		client uint16
+		// when request headers were seen; trace context carried by trailers is bound to the request using it
+		start time.Time
+		// bytes of partial messages to be skipped from the next `DATA` frame; per direction: [request, response]
+		pending [2]uint32
+	}
+
+	// grpcCalls are the in-flight RPCs of a single HTTP/2 connection;
+	// it is not thread-safe: it must only be used while holding the flow lock.
+	grpcCalls struct {
+		calls map[uint32]*grpcCall
+	}
+
+	// grpcHeaders are the gRPC relevant fields of a header block
+	grpcHeaders struct {
+		path, authority, contentType string
+		status, message              string
+		hasStatus                    bool
+	}
+)
+
+const (
+	grpcContentType      = "application/grpc"
+	grpcMessageHeaderLen = 5
+	// RPCs whose trailers are never seen are eventually discarded
+	grpcCallsLimit = 1024
+)
+
+// see: https://grpc.github.io/grpc/core/md_doc_statuscodes.html
+var grpcStatusNames = []string{
+	"OK", "CANCELLED", "UNKNOWN", "INVALID_ARGUMENT", "DEADLINE_EXCEEDED", "NOT_FOUND",
+	"ALREADY_EXISTS", "PERMISSION_DENIED", "RESOURCE_EXHAUSTED", "FAILED_PRECONDITION",
+	"ABORTED", "OUT_OF_RANGE", "UNIMPLEMENTED", "INTERNAL", "UNAVAILABLE", "DATA_LOSS", "UNAUTHENTICATED",
+}
+
+func newGRPCCalls() *grpcCalls {
+	return &grpcCalls{calls: make(map[uint32]*grpcCall)}
+}
+
+func newGRPCHeaders(fields []hpack.HeaderField) *grpcHeaders {
+	headers := &grpcHeaders{}
+	for _, field := range fields {
+		switch field.Name {
+		case ":path":
+			headers.path = field.Value
+		case ":authority":
+			headers.authority = field.Value
+		case "content-type":
+			headers.contentType = field.Value
+		case "grpc-status":
+			headers.status = field.Value
+			headers.hasStatus = true
+		case "grpc-message":
+			// `grpc-message` is percent-encoded
+			if message, err := url.PathUnescape(field.Value); err == nil {
+				headers.message = message
+			} else {
+				headers.message = field.Value
+			}
+		}
+	}
+	return headers
+}
+
+// isGRPC also matches content subtypes; i/e: `application/grpc+proto`
+func (h *grpcHeaders) isGRPC() bool {
+	return strings.HasPrefix(h.contentType, grpcContentType)
+}
+
+// start tracks the RPC initiated by request headers; it returns `nil` if headers are not gRPC.
+func (c *grpcCalls) start(streamID uint32, client uint16, headers *grpcHeaders) *grpcCall {
+	if !headers.isGRPC() || headers.path == "" {
+		return nil
+	}
+	if len(c.calls) >= grpcCallsLimit {
+		c.calls = make(map[uint32]*grpcCall)
+	}
+	call := &grpcCall{rpc: headers.path, authority: headers.authority, client: client}
+	// `:path` is `/{package}.{service}/{method}`
+	if service, method, ok := strings.Cut(strings.TrimPrefix(headers.path, "/"), "/"); ok {
+		call.service, call.method = service, method
+	}
+	c.calls[streamID] = call
+	return call
+}
+
+func (c *grpcCalls) get(streamID uint32) *grpcCall {
+	return c.calls[streamID]
+}
+
+func (c *grpcCalls) end(streamID uint32) {
+	delete(c.calls, streamID)
+}
+
+// messages decodes the gRPC message headers carried by a `DATA` frame sent from `srcPort`:
+//   - every message is prefixed by a compressed flag ( 1 byte ) and its length ( 4 bytes big-endian ),
+//   - messages may span multiple `DATA` frames, and frames may carry multiple messages.
+func (c *grpcCall) messages(srcPort uint16, data []byte) []*grpcMessage {
+	direction := 1
+	if srcPort == c.client {
+		direction = 0
+	}
+
+	skip := c.pending[direction]
+	if uint64(skip) >= uint64(len(data)) {
+		c.pending[direction] = skip - uint32(len(data))
+		return nil
+	}
+	data = data[skip:]
+	c.pending[direction] = 0
+
+	messages := []*grpcMessage{}
+	for len(data) >= grpcMessageHeaderLen {
+		message := &grpcMessage{
+			compressed: data[0] == 1,
+			length:     binary.BigEndian.Uint32(data[1:grpcMessageHeaderLen]),
+		}
+		messages = append(messages, message)
+		data = data[grpcMessageHeaderLen:]
+		if uint64(message.length) > uint64(len(data)) {
+			message.partial = true
+			c.pending[direction] = message.length - uint32(len(data))
+			break
+		}
+		data = data[message.length:]
+	}
+	return messages
+}
+
+func grpcStatusName(status string) string {
+	if code, err := strconv.Atoi(status); err == nil && code >= 0 && code < len(grpcStatusNames) {
+		return grpcStatusNames[code]
+	}
+	return status
+}
+
+func (c *grpcCall) toJSON(streamID uint32) *gabs.Container {
+	json := gabs.New()
+	json.Set(streamID, "stream")
+	json.Set(c.rpc, "rpc")
+	if c.service != "" {
+		json.Set(c.service, "service")
+		json.Set(c.method, "method")
+	}
+	return json
+}
+
+// frameToJSON translates the gRPC semantics of an HTTP/2 frame sent from `srcPort`:
+//   - `fields` are the decoded header block; `nil` if the frame does not complete one,
+//   - it returns `nil` if the frame does not belong to a gRPC call.
+func (c *grpcCalls) frameToJSON(
+	frame http2.Frame,
+	srcPort uint16,
+	fields []hpack.HeaderField,
+) (*gabs.Container, *grpcCall) {
+	streamID := frame.Header().StreamID
+
+	switch frame := frame.(type) {
+	case *http2.HeadersFrame, *http2.ContinuationFrame:
+		if fields == nil {
+			return nil, nil
+		}
+		headers := newGRPCHeaders(fields)
+		if call := c.start(streamID, srcPort, headers); call != nil {
+			json := call.toJSON(streamID)
+			json.Set("request", "kind")
+			return json, call
+		}
+		call := c.get(streamID)
+		if call == nil {
+			return nil, nil
+		}
+		json := call.toJSON(streamID)
+		if !headers.hasStatus {
+			json.Set("response", "kind")
+			return json, call
+		}
+		// trailers complete the call; responses without messages are `trailers-only`
+		json.Set("trailers", "kind")
+		json.Set(headers.status, "status")
+		json.Set(grpcStatusName(headers.status), "code")
+		if headers.message != "" {
+			json.Set(headers.message, "message")
+		}
+		c.end(streamID)
+		return json, call
+
+	case *http2.DataFrame:
+		call := c.get(streamID)
+		if call == nil {
+			return nil, nil
+		}
+		json := call.toJSON(streamID)
+		json.Set("data", "kind")
+		_, _ = json.Array("messages")
+		for _, message := range call.messages(srcPort, frame.Data()) {
+			messageJSON := gabs.New()
+			messageJSON.Set(message.compressed, "compressed")
+			messageJSON.Set(message.length, "len")
+			if message.partial {
+				messageJSON.Set(true, "partial")
+			}
+			json.ArrayAppend(messageJSON.Data(), "messages")
+		}
+		return json, call
+
+	case *http2.RSTStreamFrame:
+		call := c.get(streamID)
+		if call == nil {
+			return nil, nil
+		}
+		json := call.toJSON(streamID)
+		json.Set("cancelled", "kind")
+		json.Set(frame.ErrCode.String(), "error")
+		c.end(streamID)
+		return json, call
+	}
+
+	return nil, nil
+}
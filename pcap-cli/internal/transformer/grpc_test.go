@@ -0,0 +1,122 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/Jeffail/gabs/v2"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// grpcTestFrames translates the gRPC semantics of the frames sent from `srcPort`.
+func grpcTestFrames(
+	t *testing.T,
+	raw []byte,
+	srcPort uint16,
+	calls *grpcCalls,
+) []*gabs.Container {
+	decoder := newHTTP2HeadersDecoder()
+	framer := http2.NewFramer(io.Discard, bytes.NewReader(raw))
+	translations := []*gabs.Container{}
+	for {
+		frame, err := framer.ReadFrame()
+		if err == io.EOF {
+			return translations
+		}
+		assert.NoError(t, err)
+		_, headerFields := http2FrameToJSON(frame, decoder)
+		json, _ := calls.frameToJSON(frame, srcPort, headerFields)
+		translations = append(translations, json)
+	}
+}
+
+func grpcTestHeaders(t *testing.T, framer *http2.Framer, streamID uint32, endStream bool, fields ...string) {
+	var block bytes.Buffer
+	encoder := hpack.NewEncoder(&block)
+	for i := 0; i < len(fields); i += 2 {
+		assert.NoError(t, encoder.WriteField(hpack.HeaderField{Name: fields[i], Value: fields[i+1]}))
+	}
+	assert.NoError(t, framer.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      streamID,
+		BlockFragment: block.Bytes(),
+		EndStream:     endStream,
+		EndHeaders:    true,
+	}))
+}
+
+// TestGRPC verifies that gRPC calls are tracked across the frames of both directions.
+func TestGRPC(t *testing.T) {
+	t.Parallel()
+
+	const clientPort, serverPort = 40000, 443
+
+	calls := newGRPCCalls()
+
+	var request bytes.Buffer
+	framer := http2.NewFramer(&request, nil)
+	grpcTestHeaders(t, framer, 1, false,
+		":method", "POST", ":path", "/helloworld.Greeter/SayHello",
+		":authority", "greeter.example", "content-type", "application/grpc+proto")
+	// a complete message, and the header of a message which continues in the next frame
+	assert.NoError(t, framer.WriteData(1, false, []byte{0, 0, 0, 0, 2, 'h', 'i', 1, 0, 0, 0, 4, 'a', 'b'}))
+	assert.NoError(t, framer.WriteData(1, true, []byte{'c', 'd', 0, 0, 0, 0, 0}))
+	// plain HTTP/2 streams are ignored
+	grpcTestHeaders(t, framer, 3, true, ":method", "GET", ":path", "/", "content-type", "text/html")
+
+	frames := grpcTestFrames(t, request.Bytes(), clientPort, calls)
+	assert.Len(t, frames, 4)
+	assert.Nil(t, frames[3])
+
+	assert.Equal(t, "request", frames[0].S("kind").Data())
+	assert.Equal(t, "helloworld.Greeter", frames[0].S("service").Data())
+	assert.Equal(t, "SayHello", frames[0].S("method").Data())
+	assert.Equal(t, "greeter.example", calls.get(1).authority)
+
+	messages := frames[1].S("messages").Children()
+	assert.Len(t, messages, 2)
+	assert.Equal(t, false, messages[0].S("compressed").Data())
+	assert.Equal(t, uint32(2), messages[0].S("len").Data())
+	assert.Equal(t, true, messages[1].S("compressed").Data())
+	assert.Equal(t, true, messages[1].S("partial").Data())
+
+	// the remainder of the partial message is skipped
+	messages = frames[2].S("messages").Children()
+	assert.Len(t, messages, 1)
+	assert.Equal(t, uint32(0), messages[0].S("len").Data())
+
+	var response bytes.Buffer
+	framer = http2.NewFramer(&response, nil)
+	grpcTestHeaders(t, framer, 1, false, ":status", "200", "content-type", "application/grpc")
+	assert.NoError(t, framer.WriteData(1, false, []byte{0, 0, 0, 0, 1, 'x'}))
+	grpcTestHeaders(t, framer, 1, true, "grpc-status", "5", "grpc-message", "user%20not%20found")
+
+	frames = grpcTestFrames(t, response.Bytes(), serverPort, calls)
+	assert.Len(t, frames, 3)
+	assert.Equal(t, "response", frames[0].S("kind").Data())
+	assert.Len(t, frames[1].S("messages").Children(), 1)
+	assert.Equal(t, "trailers", frames[2].S("kind").Data())
+	assert.Equal(t, "5", frames[2].S("status").Data())
+	assert.Equal(t, "NOT_FOUND", frames[2].S("code").Data())
+	assert.Equal(t, "user not found", frames[2].S("message").Data())
+	assert.Equal(t, "/helloworld.Greeter/SayHello", frames[2].S("rpc").Data())
+
+	// trailers complete the call
+	assert.Nil(t, calls.get(1))
+}
@@ -0,0 +1,84 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"time"
+)
+
+// TransformerHealth describes whether the goroutines of a transformer are making progress.
+type TransformerHealth struct {
+	// translations accepted by `Apply` which have not been written yet
+	Pending int64
+	// translations waiting to be consumed, and how many fit, in the queue of each writer
+	Queued, Capacity []int
+	// writers whose queue is full: publishing translations blocks until it is drained
+	Saturated []int
+	// writers whose queue is no longer consumed
+	Stopped []int
+	// last time a translation was written; creation time of the transformer if none was written yet
+	WrittenAt time.Time
+	// last iteration of the reaper of orphaned flow locks; zero if translations do not track flows
+	ReapedAt time.Time
+}
+
+// unexported: reapers of translators created by `newTransformer` share their heartbeat with it
+const contextReapedAt = ContextKey("reapedAt")
+
+// reaperStallFactor is how many reaper intervals may be missed before the reaper is considered stalled.
+const reaperStallFactor = 2
+
+func (t *PcapTransformer) Health() *TransformerHealth {
+	health := &TransformerHealth{
+		Pending:   t.counter.Load(),
+		Queued:    make([]int, len(t.writeQueues)),
+		Capacity:  make([]int, len(t.writeQueues)),
+		Saturated: make([]int, 0),
+		Stopped:   make([]int, 0),
+	}
+
+	for i, writeQueue := range t.writeQueues {
+		health.Queued[i] = len(writeQueue)
+		health.Capacity[i] = cap(writeQueue)
+		if health.Capacity[i] > 0 && health.Queued[i] >= health.Capacity[i] {
+			health.Saturated = append(health.Saturated, i)
+		}
+		select {
+		case <-t.writeQueuesDone[i]:
+			health.Stopped = append(health.Stopped, i)
+		default:
+		}
+	}
+
+	if writtenAt := t.writtenAt.Load(); writtenAt > 0 {
+		health.WrittenAt = time.Unix(0, writtenAt)
+	}
+	if reapedAt := t.reapedAt.Load(); reapedAt > 0 {
+		health.ReapedAt = time.Unix(0, reapedAt)
+	}
+
+	return health
+}
+
+// IsReaperStalled reports if the reaper of orphaned flow locks missed its iterations; i/e: it is blocked.
+func (h *TransformerHealth) IsReaperStalled() bool {
+	return !h.ReapedAt.IsZero() &&
+		time.Since(h.ReapedAt) > reaperStallFactor*carrierDeadline
+}
+
+// IsStalled reports if translations are pending, but none was written within `deadline`.
+func (h *TransformerHealth) IsStalled(deadline time.Duration) bool {
+	return h.Pending > 0 && time.Since(h.WrittenAt) > deadline
+}
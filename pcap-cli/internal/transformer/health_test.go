@@ -0,0 +1,74 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newHealthCheckedTransformer(capacity int, writers int) *PcapTransformer {
+	writeQueues := make([]chan *pcapRecord, writers)
+	writeQueuesDone := make([]chan struct{}, writers)
+	for i := range writeQueues {
+		writeQueues[i] = make(chan *pcapRecord, capacity)
+		writeQueuesDone[i] = make(chan struct{})
+	}
+	return &PcapTransformer{
+		writeQueues:     writeQueues,
+		writeQueuesDone: writeQueuesDone,
+		counter:         new(atomic.Int64),
+		writtenAt:       new(atomic.Int64),
+		reapedAt:        new(atomic.Int64),
+	}
+}
+
+// TestTransformerHealth verifies that full queues, queues which are no longer consumed, and stalled goroutines are reported.
+func TestTransformerHealth(t *testing.T) {
+	t.Parallel()
+
+	transformer := newHealthCheckedTransformer(2, 2)
+	transformer.writtenAt.Store(time.Now().UnixNano())
+
+	health := transformer.Health()
+	assert.Empty(t, health.Saturated)
+	assert.False(t, health.IsReaperStalled(), "translations which do not track flows have no reaper")
+	assert.False(t, health.IsStalled(time.Millisecond), "nothing is pending")
+	assert.Empty(t, health.Stopped)
+
+	var translation fmt.Stringer = time.Second
+	transformer.writeQueues[1] <- &pcapRecord{translation: &translation}
+	transformer.writeQueues[1] <- &pcapRecord{translation: &translation}
+	transformer.counter.Add(2)
+	close(transformer.writeQueuesDone[0])
+
+	health = transformer.Health()
+	assert.Equal(t, []int{1}, health.Saturated)
+	assert.Equal(t, []int{0, 2}, health.Queued)
+	assert.Equal(t, []int{2, 2}, health.Capacity)
+	assert.Equal(t, []int{0}, health.Stopped)
+	assert.False(t, health.IsStalled(time.Minute))
+
+	transformer.writtenAt.Store(time.Now().Add(-time.Minute).UnixNano())
+	transformer.reapedAt.Store(time.Now().Add(-3 * carrierDeadline).UnixNano())
+
+	health = transformer.Health()
+	assert.True(t, health.IsStalled(time.Second))
+	assert.True(t, health.IsReaperStalled())
+}
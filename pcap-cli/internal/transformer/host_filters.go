@@ -0,0 +1,274 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/btree"
+	"github.com/google/gopacket/layers"
+)
+
+type (
+	pcapHostAddrKey struct {
+		prefix netip.Prefix
+		deny   bool
+	}
+
+	// pcapHostFilters resolves watched names using the DNS responses being captured, instead of resolving them once:
+	//   - IPs in A and AAAA answers for allowed names, or their aliases, are added to their own allow-list:
+	//     names are servers, so packets are allowed if either side is one of their IPs,
+	//   - IPs in A and AAAA answers for denied names, or their aliases, are added to the deny-list,
+	//   - IPs are removed once the TTL of the last answer that included them expires.
+	//
+	// It is shared by all snapshots: learned IPs are published as regular filter updates.
+	pcapHostFilters struct {
+		filters *pcapFilters
+
+		mu sync.Mutex
+		// watched names; `true` if the name is denied. `*.example.com` watches all subdomains of `example.com`
+		names   map[string]bool
+		watched atomic.Int32
+		// watched names which are allowed: IPs not learned for them yet are not allowed either
+		allowed atomic.Int32
+		// when each learned IP expires; IPs also configured as regular filters are never learned
+		learned   map[pcapHostAddrKey]time.Time
+		nextSweep time.Time
+	}
+)
+
+const (
+	// answers with shorter TTLs, i/e: `0`, are used right away by clients; so their IPs are kept at least this long
+	hostFilterMinTTL = 30 * time.Second
+	// how often expired IPs are looked for
+	hostFilterSweepInterval = time.Second
+)
+
+func newPcapHostFilters(filters *pcapFilters) *pcapHostFilters {
+	return &pcapHostFilters{
+		filters: filters,
+		names:   make(map[string]bool),
+		learned: make(map[pcapHostAddrKey]time.Time),
+	}
+}
+
+// hostNetworks returns where IPs learned for watched names are added to.
+func (l3 *pcapL3Filters) hostNetworks(prefix netip.Prefix, deny bool) *btree.BTreeG[netip.Prefix] {
+	switch {
+	case deny && prefix.Addr().Is6():
+		return l3.noNetworks6
+	case deny:
+		return l3.noNetworks4
+	case prefix.Addr().Is6():
+		return l3.hosts6
+	default:
+		return l3.hosts4
+	}
+}
+
+func normalizeHostName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(name), "."))
+}
+
+// match returns whether `name` is watched, either verbatim or by a wildcard.
+func (h *pcapHostFilters) match(name string) (deny bool, ok bool) {
+	if deny, ok = h.names[name]; ok {
+		return deny, ok
+	}
+	for parent := name; strings.Contains(parent, "."); {
+		parent = parent[strings.IndexByte(parent, '.')+1:]
+		if deny, ok = h.names["*."+parent]; ok {
+			return deny, ok
+		}
+	}
+	return false, false
+}
+
+func (h *pcapHostFilters) watch(deny bool, names ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, name := range names {
+		if name = normalizeHostName(name); name != "" {
+			h.names[name] = deny
+		}
+	}
+	h.count()
+}
+
+func (h *pcapHostFilters) unwatch(deny bool, names ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, name := range names {
+		name = normalizeHostName(name)
+		if denied, ok := h.names[name]; ok && denied == deny {
+			delete(h.names, name)
+		}
+	}
+	h.count()
+
+	// learned IPs are not tracked per name, as names often share IPs: they are forgotten once their TTL expires
+	if len(h.names) == 0 {
+		h.forget(func(pcapHostAddrKey, time.Time) bool { return true })
+	}
+}
+
+// count must be called while holding `h.mu`
+func (h *pcapHostFilters) count() {
+	allowed := 0
+	for _, deny := range h.names {
+		if !deny {
+			allowed += 1
+		}
+	}
+	h.watched.Store(int32(len(h.names)))
+	h.allowed.Store(int32(allowed))
+}
+
+// forget removes the learned IPs for which `expired` is `true` from the filters.
+func (h *pcapHostFilters) forget(expired func(pcapHostAddrKey, time.Time) bool) {
+	keys := []pcapHostAddrKey{}
+	for key, expiry := range h.learned {
+		if expired(key, expiry) {
+			keys = append(keys, key)
+			delete(h.learned, key)
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+	h.filters.update(func(s *pcapFilterSet) {
+		for _, key := range keys {
+			s.removeNetworks(s.l3.hostNetworks(key.prefix, key.deny), key.prefix.String())
+		}
+	})
+}
+
+// resolve returns the names in `answers` which are watched, along with the aliases they point to.
+func (h *pcapHostFilters) resolve(answers []layers.DNSResourceRecord) map[string]bool {
+	resolved := make(map[string]bool)
+	for _, answer := range answers {
+		name := normalizeHostName(string(answer.Name))
+		if deny, ok := h.match(name); ok {
+			resolved[name] = deny
+		}
+	}
+	// aliases may be chained, and not listed in order; each pass follows at least 1 more link
+	for range answers {
+		followed := false
+		for _, answer := range answers {
+			if answer.Type != layers.DNSTypeCNAME {
+				continue
+			}
+			deny, ok := resolved[normalizeHostName(string(answer.Name))]
+			alias := normalizeHostName(string(answer.CNAME))
+			if _, known := resolved[alias]; ok && !known {
+				resolved[alias] = deny
+				followed = true
+			}
+		}
+		if !followed {
+			break
+		}
+	}
+	return resolved
+}
+
+// observe learns the IPs of watched names from DNS responses; `timestamp` is when the response was captured.
+func (h *pcapHostFilters) observe(dns *layers.DNS, timestamp time.Time) {
+	if h.watched.Load() == 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if timestamp.After(h.nextSweep) {
+		h.nextSweep = timestamp.Add(hostFilterSweepInterval)
+		h.forget(func(_ pcapHostAddrKey, expiry time.Time) bool {
+			return timestamp.After(expiry)
+		})
+	}
+
+	if !dns.QR || dns.ResponseCode != layers.DNSResponseCodeNoErr || len(dns.Answers) == 0 {
+		return
+	}
+
+	resolved := h.resolve(dns.Answers)
+	if len(resolved) == 0 {
+		return
+	}
+
+	snapshot := h.filters.load()
+	learned := []pcapHostAddrKey{}
+	for _, answer := range dns.Answers {
+		if answer.Type != layers.DNSTypeA && answer.Type != layers.DNSTypeAAAA {
+			continue
+		}
+		deny, ok := resolved[normalizeHostName(string(answer.Name))]
+		if !ok {
+			continue
+		}
+		addr, ok := netip.AddrFromSlice(answer.IP)
+		if !ok {
+			continue
+		}
+		addr = addr.Unmap()
+
+		key := pcapHostAddrKey{netip.PrefixFrom(addr, addr.BitLen()), deny}
+		expiry := timestamp.Add(max(time.Duration(answer.TTL)*time.Second, hostFilterMinTTL))
+		if current, ok := h.learned[key]; ok {
+			if expiry.After(current) {
+				h.learned[key] = expiry
+			}
+			continue
+		}
+		if network, ok := snapshot.l3.hostNetworks(key.prefix, deny).Get(key.prefix); deny && ok && network == key.prefix {
+			// already denied by regular filters: it must not be removed when the answer expires
+			continue
+		}
+		h.learned[key] = expiry
+		learned = append(learned, key)
+	}
+
+	if len(learned) == 0 {
+		return
+	}
+	h.filters.update(func(s *pcapFilterSet) {
+		for _, key := range learned {
+			s.addNetwork(s.l3.hostNetworks(key.prefix, key.deny), key.prefix.Addr().Is6(), key.prefix.String())
+		}
+	})
+}
+
+func (h *pcapHostFilters) view(deny bool) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	names := []string{}
+	for name, denied := range h.names {
+		if denied == deny {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
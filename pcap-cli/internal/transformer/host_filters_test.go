@@ -0,0 +1,184 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+func newHostFiltersTestResponse(answers ...layers.DNSResourceRecord) *layers.DNS {
+	return &layers.DNS{QR: true, ResponseCode: layers.DNSResponseCodeNoErr, Answers: answers}
+}
+
+func TestHostFiltersLearnFromDNS(t *testing.T) {
+	t.Parallel()
+
+	filters := NewPcapFilters()
+	filters.AddHost("api.example.com")
+	filters.DenyHost("*.ads.example.net")
+	assert.True(t, filters.HasHosts())
+
+	now := time.Unix(1700000000, 0)
+	filters.ObserveDNS(newHostFiltersTestResponse(
+		layers.DNSResourceRecord{Name: []byte("api.example.com"), Type: layers.DNSTypeCNAME, CNAME: []byte("edge.cdn.example.org")},
+		layers.DNSResourceRecord{Name: []byte("edge.cdn.example.org"), Type: layers.DNSTypeA, TTL: 60, IP: net.IPv4(203, 0, 113, 7)},
+		layers.DNSResourceRecord{Name: []byte("edge.cdn.example.org"), Type: layers.DNSTypeAAAA, TTL: 60, IP: net.ParseIP("2001:db8::7")},
+		layers.DNSResourceRecord{Name: []byte("unrelated.example.com"), Type: layers.DNSTypeA, TTL: 60, IP: net.IPv4(203, 0, 113, 8)},
+	), now)
+	filters.ObserveDNS(newHostFiltersTestResponse(
+		layers.DNSResourceRecord{Name: []byte("x.ads.example.net."), Type: layers.DNSTypeA, TTL: 3600, IP: net.IPv4(198, 51, 100, 1)},
+	), now)
+
+	allowed4 := netip.MustParseAddr("203.0.113.7")
+	allowed6 := netip.MustParseAddr("2001:db8::7")
+	unrelated := netip.MustParseAddr("203.0.113.8")
+	denied := netip.MustParseAddr("198.51.100.1")
+
+	assert.True(t, filters.AllowsHostAddr(&allowed4))
+	assert.True(t, filters.AllowsHostAddr(&allowed6))
+	assert.False(t, filters.AllowsHostAddr(&unrelated))
+	assert.True(t, filters.DeniesIPv4Addr(&denied))
+	// learned IPs are not added to the allow-list, which requires both sides of packets to be allowed
+	assert.False(t, filters.HasIPs())
+
+	view := filters.View()
+	assert.Equal(t, []string{"api.example.com"}, view.Hosts)
+	assert.Equal(t, []string{"*.ads.example.net"}, view.DeniedHosts)
+
+	// answers with short TTLs are kept for at least `hostFilterMinTTL`
+	later := now.Add(hostFilterMinTTL + 2*time.Minute)
+	filters.ObserveDNS(newHostFiltersTestResponse(), later)
+
+	assert.False(t, filters.AllowsHostAddr(&allowed4))
+	assert.False(t, filters.AllowsHostAddr(&allowed6))
+	assert.True(t, filters.DeniesIPv4Addr(&denied))
+}
+
+func TestHostFiltersKeepConfiguredIPs(t *testing.T) {
+	t.Parallel()
+
+	filters := NewPcapFilters()
+	filters.AddIPv4("203.0.113.7")
+	filters.AddHost("api.example.com")
+
+	now := time.Unix(1700000000, 0)
+	filters.ObserveDNS(newHostFiltersTestResponse(
+		layers.DNSResourceRecord{Name: []byte("api.example.com"), Type: layers.DNSTypeA, TTL: 1, IP: net.IPv4(203, 0, 113, 7)},
+	), now)
+	filters.ObserveDNS(newHostFiltersTestResponse(), now.Add(time.Hour))
+
+	configured := netip.MustParseAddr("203.0.113.7")
+	assert.True(t, filters.AllowsIPv4Addr(&configured))
+	assert.False(t, filters.AllowsHostAddr(&configured))
+
+	filters.RemoveHost("api.example.com")
+	assert.False(t, filters.HasHosts())
+	assert.True(t, filters.AllowsIPv4Addr(&configured))
+}
+
+// TestHostFiltersAllowEitherSide verifies that packets to and from the learned IPs of allowed names are allowed,
+// regardless of the IP of the other side, while denied names and allowed networks keep their semantics.
+func TestHostFiltersAllowEitherSide(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	isAllowed := func(filters PcapFilters, src, dst string) bool {
+		worker := &pcapTranslatorWorker{filters: filters.Snapshot()}
+		srcIP, dstIP := net.ParseIP(src), net.ParseIP(dst)
+		if srcIP.To4() != nil {
+			_, _, allowed := worker.isIPv4Allowed(ctx, &layers.IPv4{SrcIP: srcIP, DstIP: dstIP})
+			return allowed
+		}
+		_, _, allowed := worker.isIPv6Allowed(ctx, &layers.IPv6{SrcIP: srcIP, DstIP: dstIP})
+		return allowed
+	}
+
+	filters := NewPcapFilters()
+	filters.AddHost("api.example.com")
+	filters.DenyHost("*.ads.example.net")
+	filters.ObserveDNS(newHostFiltersTestResponse(
+		layers.DNSResourceRecord{Name: []byte("api.example.com"), Type: layers.DNSTypeA, TTL: 60, IP: net.IPv4(203, 0, 113, 7)},
+		layers.DNSResourceRecord{Name: []byte("api.example.com"), Type: layers.DNSTypeAAAA, TTL: 60, IP: net.ParseIP("2001:db8::7")},
+	), time.Unix(1700000000, 0))
+	filters.ObserveDNS(newHostFiltersTestResponse(
+		layers.DNSResourceRecord{Name: []byte("x.ads.example.net"), Type: layers.DNSTypeA, TTL: 60, IP: net.IPv4(198, 51, 100, 1)},
+	), time.Unix(1700000000, 0))
+
+	assert.True(t, isAllowed(filters, "10.0.0.1", "203.0.113.7"))
+	assert.True(t, isAllowed(filters, "203.0.113.7", "10.0.0.1"))
+	assert.True(t, isAllowed(filters, "2001:db8::1", "2001:db8::7"))
+	assert.True(t, isAllowed(filters, "2001:db8::7", "2001:db8::1"))
+	assert.False(t, isAllowed(filters, "10.0.0.1", "203.0.113.8"))
+	assert.False(t, isAllowed(filters, "2001:db8::1", "2001:db8::8"))
+	// deny overrides allow
+	assert.False(t, isAllowed(filters, "198.51.100.1", "203.0.113.7"))
+
+	// allowed networks still require both sides to be allowed, unless the other side is an allowed name
+	filters.AddIPv4Range("10.0.0.0/8")
+	assert.True(t, isAllowed(filters, "10.0.0.1", "10.0.0.2"))
+	assert.True(t, isAllowed(filters, "10.0.0.1", "203.0.113.7"))
+	assert.False(t, isAllowed(filters, "10.0.0.1", "203.0.113.8"))
+}
+
+// TestHostFiltersDoNotFailOpen verifies that allowed names allow nothing until their IPs are learned, and once they expire,
+// while denied names do not restrict traffic which is not denied.
+func TestHostFiltersDoNotFailOpen(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client, server := net.IPv4(10, 0, 0, 1), net.IPv4(203, 0, 113, 7)
+	isAllowed := func(filters PcapFilters) bool {
+		worker := &pcapTranslatorWorker{filters: filters.Snapshot()}
+		_, _, allowed4 := worker.isIPv4Allowed(ctx, &layers.IPv4{SrcIP: client, DstIP: server})
+		_, _, allowed6 := worker.isIPv6Allowed(ctx, &layers.IPv6{SrcIP: net.ParseIP("2001:db8::1"), DstIP: net.ParseIP("2001:db8::7")})
+		assert.Equal(t, allowed4, allowed6)
+		return allowed4
+	}
+
+	denied := NewPcapFilters()
+	denied.DenyHost("*.ads.example.net")
+	assert.True(t, isAllowed(denied))
+
+	filters := NewPcapFilters()
+	filters.AddHost("api.example.com")
+	filters.DenyHost("*.ads.example.net")
+	assert.True(t, filters.HasAllowedHosts())
+	assert.False(t, isAllowed(filters))
+
+	now := time.Unix(1700000000, 0)
+	filters.ObserveDNS(newHostFiltersTestResponse(
+		layers.DNSResourceRecord{Name: []byte("api.example.com"), Type: layers.DNSTypeA, TTL: 60, IP: server},
+	), now)
+	learned := netip.MustParseAddr("203.0.113.7")
+	assert.True(t, filters.AllowsHostAddr(&learned))
+	filters.ObserveDNS(newHostFiltersTestResponse(), now.Add(time.Hour))
+	assert.False(t, filters.AllowsHostAddr(&learned))
+	assert.False(t, isAllowed(filters))
+
+	// denied names are only un-watched by `RemoveDeniedHosts`, and allowed ones by `RemoveHosts`
+	filters.RemoveDeniedHosts("api.example.com")
+	assert.True(t, filters.HasAllowedHosts())
+	filters.RemoveHosts("api.example.com")
+	assert.False(t, filters.HasAllowedHosts())
+	assert.True(t, filters.HasHosts())
+	assert.True(t, isAllowed(filters))
+}
@@ -0,0 +1,223 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"encoding/hex"
+	"slices"
+	"strings"
+
+	"github.com/Jeffail/gabs/v2"
+	"github.com/pkg/errors"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+type (
+	// http2HeadersDecoder keeps the HPACK state of 1 direction of an HTTP/2 connection:
+	//   - header blocks reference the dynamic table populated by previous header blocks, so decoding is stateful,
+	//   - header blocks may be split across `HEADERS`/`PUSH_PROMISE` and `CONTINUATION` frames.
+	// It is not thread-safe: it must only be used while holding the flow lock.
+	http2HeadersDecoder struct {
+		decoder   *hpack.Decoder
+		fragments map[uint32][]byte
+		// this direction sends requests: a header block carrying `:method` has been decoded
+		client bool
+	}
+)
+
+const (
+	// see: https://datatracker.ietf.org/doc/html/rfc9113#name-defined-settings
+	http2HeaderTableSize = 4096
+	// peers may increase the size of the dynamic table using `SETTINGS_HEADER_TABLE_SIZE`
+	http2MaxHeaderTableSize = 64 * 1024
+	// header blocks larger than this are not reassembled
+	http2MaxHeaderBlockSize = 256 * 1024
+)
+
+var errHTTP2HeaderBlockTooLarge = errors.New("header block too large")
+
+func newHTTP2HeadersDecoder() *http2HeadersDecoder {
+	d := &http2HeadersDecoder{fragments: make(map[uint32][]byte)}
+	d.reset()
+	return d
+}
+
+func (d *http2HeadersDecoder) reset() {
+	d.decoder = hpack.NewDecoder(http2HeaderTableSize, nil)
+	d.decoder.SetAllowedMaxDynamicTableSize(http2MaxHeaderTableSize)
+}
+
+// decode returns `nil` fields until the header block for `streamID` is complete:
+//   - the dynamic table is lost if decoding fails, i/e: capturing started mid-connection or packets were lost;
+//     so the decoder is reset to allow decoding header blocks which only use the static table.
+func (d *http2HeadersDecoder) decode(
+	streamID uint32,
+	fragment []byte,
+	endHeaders bool,
+) ([]hpack.HeaderField, error) {
+	block := append(d.fragments[streamID], fragment...)
+	if !endHeaders {
+		if len(block) > http2MaxHeaderBlockSize {
+			delete(d.fragments, streamID)
+			return nil, errHTTP2HeaderBlockTooLarge
+		}
+		d.fragments[streamID] = block
+		return nil, nil
+	}
+	delete(d.fragments, streamID)
+
+	fields, err := d.decoder.DecodeFull(block)
+	if err != nil {
+		d.reset()
+		return nil, errors.Wrap(err, "HPACK")
+	}
+	if !d.client {
+		d.client = slices.ContainsFunc(fields, func(field hpack.HeaderField) bool {
+			return field.Name == ":method"
+		})
+	}
+	return fields, nil
+}
+
+// http2IsTrailers returns whether a header block is a trailer section: the only header blocks without pseudo-headers;
+//   - see: https://datatracker.ietf.org/doc/html/rfc9113#section-8.1
+func http2IsTrailers(fields []hpack.HeaderField) bool {
+	return len(fields) > 0 && !slices.ContainsFunc(fields, func(field hpack.HeaderField) bool {
+		return strings.HasPrefix(field.Name, ":")
+	})
+}
+
+func http2ErrCode(json *gabs.Container, code http2.ErrCode) {
+	json.Set(uint32(code), "error_code")
+	json.Set(code.String(), "error")
+}
+
+func http2HeaderFields(json *gabs.Container, fields []hpack.HeaderField) {
+	headers, _ := json.Object("headers")
+	for _, field := range fields {
+		value := field.Value
+		// repeated fields are combined the same way as HTTP/1.1 headers
+		if current, ok := headers.Search(field.Name).Data().(string); ok {
+			value = current + ", " + value
+		}
+		headers.Set(value, field.Name)
+	}
+}
+
+// http2FrameToJSON decodes frame-level details of `frame`;
+// `decoder` is used to decode header blocks, and it is `nil` if HPACK state is not available.
+func http2FrameToJSON(
+	frame http2.Frame,
+	decoder *http2HeadersDecoder,
+) (*gabs.Container, []hpack.HeaderField) {
+	header := frame.Header()
+
+	json := gabs.New()
+	json.Set(header.StreamID, "stream")
+	json.Set(strings.ToLower(header.Type.String()), "type")
+	json.Set(header.Length, "len")
+
+	// see: https://datatracker.ietf.org/doc/html/rfc9113#name-frame-definitions
+	flags, _ := json.Object("flags")
+	flags.Set(uint8(header.Flags), "raw")
+	if header.Flags.Has(http2.FlagDataEndStream) {
+		// `0x01` is `ACK` for `SETTINGS` and `PING` frames
+		if header.Type == http2.FrameSettings || header.Type == http2.FramePing {
+			flags.Set(true, "ack")
+		} else {
+			flags.Set(true, "end_stream")
+		}
+	}
+	if header.Flags.Has(http2.FlagHeadersEndHeaders) {
+		flags.Set(true, "end_headers")
+	}
+	if header.Flags.Has(http2.FlagHeadersPadded) {
+		flags.Set(true, "padded")
+	}
+	if header.Flags.Has(http2.FlagHeadersPriority) && header.Type == http2.FrameHeaders {
+		flags.Set(true, "priority")
+	}
+
+	var fragment []byte
+	endHeaders := header.Flags.Has(http2.FlagHeadersEndHeaders)
+
+	switch frame := frame.(type) {
+	case *http2.DataFrame:
+		json.Set(len(frame.Data()), "data")
+		// `len` includes padding
+		json.Set(int(header.Length)-len(frame.Data()), "padding")
+
+	case *http2.HeadersFrame:
+		fragment = frame.HeaderBlockFragment()
+		if frame.HasPriority() {
+			priority, _ := json.Object("priority")
+			priority.Set(frame.Priority.StreamDep, "depends_on")
+			priority.Set(frame.Priority.Exclusive, "exclusive")
+			priority.Set(int(frame.Priority.Weight)+1, "weight")
+		}
+
+	case *http2.PushPromiseFrame:
+		fragment = frame.HeaderBlockFragment()
+		json.Set(frame.PromiseID, "promised_stream")
+
+	case *http2.ContinuationFrame:
+		fragment = frame.HeaderBlockFragment()
+
+	case *http2.PriorityFrame:
+		priority, _ := json.Object("priority")
+		priority.Set(frame.StreamDep, "depends_on")
+		priority.Set(frame.Exclusive, "exclusive")
+		priority.Set(int(frame.Weight)+1, "weight")
+
+	case *http2.RSTStreamFrame:
+		http2ErrCode(json, frame.ErrCode)
+
+	case *http2.SettingsFrame:
+		settings, _ := json.Object("settings")
+		frame.ForeachSetting(func(s http2.Setting) error {
+			settings.Set(s.Val, strings.ToLower(s.ID.String()))
+			return nil
+		})
+
+	case *http2.PingFrame:
+		json.Set(hex.EncodeToString(frame.Data[:]), "opaque")
+
+	case *http2.GoAwayFrame:
+		json.Set(frame.LastStreamID, "last_stream")
+		http2ErrCode(json, frame.ErrCode)
+		if debug := frame.DebugData(); len(debug) > 0 {
+			json.Set(string(debug), "debug")
+		}
+
+	case *http2.WindowUpdateFrame:
+		json.Set(frame.Increment, "increment")
+	}
+
+	if fragment == nil || decoder == nil {
+		return json, nil
+	}
+
+	fields, err := decoder.decode(header.StreamID, fragment, endHeaders)
+	if err != nil {
+		json.Set(err.Error(), "hpack_error")
+	} else if fields != nil {
+		http2HeaderFields(json, fields)
+		if http2IsTrailers(fields) {
+			json.Set(true, "trailers")
+		}
+	}
+	return json, fields
+}
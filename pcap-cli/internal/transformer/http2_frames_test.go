@@ -0,0 +1,164 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/Jeffail/gabs/v2"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// http2TestFrames translates the frames in `raw` skipping the first `skip` ones;
+// frames must be translated as soon as they are read, as frames are reused by `http2.Framer`.
+func http2TestFrames(
+	t *testing.T,
+	raw []byte,
+	skip int,
+	decoder *http2HeadersDecoder,
+) ([]*gabs.Container, [][]hpack.HeaderField) {
+	framer := http2.NewFramer(io.Discard, bytes.NewReader(raw))
+	translations := []*gabs.Container{}
+	fields := [][]hpack.HeaderField{}
+	for index := 0; ; index++ {
+		frame, err := framer.ReadFrame()
+		if err == io.EOF {
+			return translations, fields
+		}
+		assert.NoError(t, err)
+		if index >= skip {
+			json, headerFields := http2FrameToJSON(frame, decoder)
+			translations = append(translations, json)
+			fields = append(fields, headerFields)
+		}
+	}
+}
+
+// TestHTTP2Frames verifies that header blocks are decoded using the HPACK state of the flow.
+func TestHTTP2Frames(t *testing.T) {
+	t.Parallel()
+
+	var raw, block bytes.Buffer
+	framer := http2.NewFramer(&raw, nil)
+	encoder := hpack.NewEncoder(&block)
+
+	for _, stream := range []uint32{1, 3} {
+		block.Reset()
+		encoder.WriteField(hpack.HeaderField{Name: ":method", Value: "GET"})
+		encoder.WriteField(hpack.HeaderField{Name: "x-cloud-trace-context", Value: "trace/1;o=1"})
+		encoder.WriteField(hpack.HeaderField{Name: "accept", Value: "a"})
+		encoder.WriteField(hpack.HeaderField{Name: "accept", Value: "b"})
+		fragment := block.Bytes()
+		if stream == 1 {
+			framer.WriteHeaders(http2.HeadersFrameParam{
+				StreamID: stream, BlockFragment: fragment, EndStream: true, EndHeaders: true,
+			})
+			continue
+		}
+		// 2nd header block is split and references the dynamic table
+		framer.WriteHeaders(http2.HeadersFrameParam{
+			StreamID: stream, BlockFragment: fragment[:2], EndStream: true,
+		})
+		framer.WriteContinuation(stream, true, fragment[2:])
+	}
+	framer.WriteSettings(http2.Setting{ID: http2.SettingHeaderTableSize, Val: 8192})
+	framer.WriteRSTStream(3, http2.ErrCodeCancel)
+	framer.WriteGoAway(3, http2.ErrCodeNo, []byte("bye"))
+
+	frames, fields := http2TestFrames(t, raw.Bytes(), 0, newHTTP2HeadersDecoder())
+	assert.Len(t, frames, 6)
+
+	assert.Len(t, fields[0], 4)
+	assert.Equal(t, "headers", frames[0].S("type").Data())
+	assert.Equal(t, true, frames[0].S("flags", "end_stream").Data())
+	assert.Equal(t, "a, b", frames[0].S("headers", "accept").Data())
+
+	assert.Nil(t, fields[1])
+	assert.Nil(t, frames[1].S("headers").Data())
+
+	assert.Len(t, fields[2], 4)
+	assert.Equal(t, "continuation", frames[2].S("type").Data())
+	assert.Equal(t, uint32(3), frames[2].S("stream").Data())
+	assert.Equal(t, "trace/1;o=1", frames[2].S("headers", "x-cloud-trace-context").Data())
+
+	assert.Equal(t, uint32(8192), frames[3].S("settings", "header_table_size").Data())
+
+	assert.Equal(t, "rst_stream", frames[4].S("type").Data())
+	assert.Equal(t, "CANCEL", frames[4].S("error").Data())
+
+	assert.Equal(t, uint32(3), frames[5].S("last_stream").Data())
+	assert.Equal(t, "NO_ERROR", frames[5].S("error").Data())
+	assert.Equal(t, "bye", frames[5].S("debug").Data())
+
+	// without the dynamic table, the 2nd header block cannot be decoded
+	frames, fields = http2TestFrames(t, raw.Bytes(), 1, newHTTP2HeadersDecoder())
+	assert.Nil(t, fields[1])
+	assert.NotNil(t, frames[1].S("hpack_error").Data())
+}
+
+// TestHTTP2Trailers verifies that trailer sections are detected, and that the direction sending requests is identified.
+func TestHTTP2Trailers(t *testing.T) {
+	t.Parallel()
+
+	var request, response, block bytes.Buffer
+	clientEncoder, serverEncoder := hpack.NewEncoder(&block), hpack.NewEncoder(&block)
+
+	block.Reset()
+	clientEncoder.WriteField(hpack.HeaderField{Name: ":method", Value: "POST"})
+	clientEncoder.WriteField(hpack.HeaderField{Name: ":path", Value: "/pkg.Service/Method"})
+	http2.NewFramer(&request, nil).WriteHeaders(http2.HeadersFrameParam{
+		StreamID: 1, BlockFragment: bytes.Clone(block.Bytes()), EndHeaders: true,
+	})
+	block.Reset()
+	clientEncoder.WriteField(hpack.HeaderField{Name: "traceparent", Value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"})
+	http2.NewFramer(&request, nil).WriteHeaders(http2.HeadersFrameParam{
+		StreamID: 1, BlockFragment: bytes.Clone(block.Bytes()), EndStream: true, EndHeaders: true,
+	})
+
+	block.Reset()
+	serverEncoder.WriteField(hpack.HeaderField{Name: ":status", Value: "200"})
+	http2.NewFramer(&response, nil).WriteHeaders(http2.HeadersFrameParam{
+		StreamID: 1, BlockFragment: bytes.Clone(block.Bytes()), EndHeaders: true,
+	})
+	block.Reset()
+	serverEncoder.WriteField(hpack.HeaderField{Name: "grpc-status", Value: "0"})
+	http2.NewFramer(&response, nil).WriteHeaders(http2.HeadersFrameParam{
+		StreamID: 1, BlockFragment: bytes.Clone(block.Bytes()), EndStream: true, EndHeaders: true,
+	})
+
+	clientDecoder := newHTTP2HeadersDecoder()
+	frames, fields := http2TestFrames(t, request.Bytes(), 0, clientDecoder)
+	if assert.Len(t, frames, 2) {
+		assert.False(t, http2IsTrailers(fields[0]))
+		assert.Nil(t, frames[0].S("trailers").Data())
+		assert.True(t, http2IsTrailers(fields[1]))
+		assert.Equal(t, true, frames[1].S("trailers").Data())
+	}
+	assert.True(t, clientDecoder.client)
+
+	serverDecoder := newHTTP2HeadersDecoder()
+	frames, fields = http2TestFrames(t, response.Bytes(), 0, serverDecoder)
+	if assert.Len(t, frames, 2) {
+		assert.False(t, http2IsTrailers(fields[0]))
+		assert.True(t, http2IsTrailers(fields[1]))
+	}
+	assert.False(t, serverDecoder.client)
+
+	assert.False(t, http2IsTrailers(nil))
+}
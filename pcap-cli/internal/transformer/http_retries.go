@@ -0,0 +1,145 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"sync"
+	"time"
+)
+
+type (
+	httpAttempt struct {
+		serial, flowID uint64
+		timestamp      time.Time
+	}
+
+	// httpRetry links a request to previous attempts of the same request:
+	//   - `hedge`: the previous attempt was still waiting for a response,
+	//   - `retry`: the previous attempt had already been answered; i/e: with an error.
+	httpRetry struct {
+		// `trace` if attempts share the same trace ID, `request` if they share the same request line
+		by              string
+		attempt         int
+		hedge           bool
+		first, previous *httpAttempt
+	}
+
+	// httpRetryDetector finds duplicate requests sent over different connections within `httpRetryWindow`:
+	//   - requests are duplicates if they carry the same trace ID,
+	//   - or if the same client sends the same request line ( method, host and URL ).
+	httpRetryDetector struct {
+		mu       *sync.Mutex
+		attempts map[string][]*httpAttempt
+		// when each flow received its latest response
+		responses map[uint64]time.Time
+	}
+)
+
+const (
+	httpRetryByTrace   = "trace"
+	httpRetryByRequest = "request"
+
+	httpRetryWindow = 5 * time.Second
+	// requests and flows beyond this limit reset the detector to bound memory usage
+	httpRetryLimit = 4096
+)
+
+func newHTTPRetryDetector() *httpRetryDetector {
+	return &httpRetryDetector{
+		mu:        new(sync.Mutex),
+		attempts:  make(map[string][]*httpAttempt),
+		responses: make(map[uint64]time.Time),
+	}
+}
+
+func (r *httpRetry) kind() string {
+	if r.hedge {
+		return "hedge"
+	}
+	return "retry"
+}
+
+// track must be called while holding `d.mu`; it records `attempt` and returns the previous attempts within the window.
+func (d *httpRetryDetector) track(key string, attempt *httpAttempt) []*httpAttempt {
+	if len(d.attempts) >= httpRetryLimit {
+		d.attempts = make(map[string][]*httpAttempt)
+	}
+
+	previous := d.attempts[key][:0:0]
+	for _, a := range d.attempts[key] {
+		if attempt.timestamp.Sub(a.timestamp) <= httpRetryWindow {
+			previous = append(previous, a)
+		}
+	}
+	d.attempts[key] = append(previous, attempt)
+	return previous
+}
+
+// observeRequest returns `nil` if the request is not a duplicate of a request sent over a different connection;
+// `traceID` may be `nil`, and `request` identifies the client and the request line.
+func (d *httpRetryDetector) observeRequest(
+	serial, flowID uint64,
+	timestamp time.Time,
+	traceID *string,
+	request string,
+) *httpRetry {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	attempt := &httpAttempt{serial, flowID, timestamp}
+
+	var retry *httpRetry = nil
+	if traceID != nil && *traceID != "" {
+		retry = d.newRetry(httpRetryByTrace, attempt, d.track(httpRetryByTrace+":"+*traceID, attempt))
+	}
+	if previous := d.track(httpRetryByRequest+":"+request, attempt); retry == nil {
+		retry = d.newRetry(httpRetryByRequest, attempt, previous)
+	}
+	return retry
+}
+
+// newRetry must be called while holding `d.mu`.
+func (d *httpRetryDetector) newRetry(by string, attempt *httpAttempt, previous []*httpAttempt) *httpRetry {
+	attempts := []*httpAttempt{}
+	for _, a := range previous {
+		// requests sent over the same connection are not retries; i/e: polling
+		if a.flowID != attempt.flowID {
+			attempts = append(attempts, a)
+		}
+	}
+	if len(attempts) == 0 {
+		return nil
+	}
+
+	last := attempts[len(attempts)-1]
+	answeredAt, answered := d.responses[last.flowID]
+	return &httpRetry{
+		by:       by,
+		attempt:  len(attempts) + 1,
+		hedge:    !answered || answeredAt.Before(last.timestamp),
+		first:    attempts[0],
+		previous: last,
+	}
+}
+
+func (d *httpRetryDetector) observeResponse(flowID uint64, timestamp time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.responses[flowID]; !ok && len(d.responses) >= httpRetryLimit {
+		d.responses = make(map[uint64]time.Time)
+	}
+	d.responses[flowID] = timestamp
+}
@@ -0,0 +1,64 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestHTTPRetryDetector verifies that only duplicates sent over different connections within the window are flagged.
+func TestHTTPRetryDetector(t *testing.T) {
+	t.Parallel()
+
+	detector := newHTTPRetryDetector()
+
+	ts := time.Unix(1700000000, 0)
+	at := func(millis int) time.Time {
+		return ts.Add(time.Duration(millis) * time.Millisecond)
+	}
+
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	request := "10.0.0.1 GET api.example/items"
+
+	assert.Nil(t, detector.observeRequest(1, 100, at(0), &traceID, request))
+	// requests sent over the same connection are not retries
+	assert.Nil(t, detector.observeRequest(2, 100, at(10), nil, request))
+
+	// the first attempt has not been answered yet
+	hedge := detector.observeRequest(3, 200, at(50), &traceID, request)
+	assert.NotNil(t, hedge)
+	assert.Equal(t, "hedge", hedge.kind())
+	assert.Equal(t, httpRetryByTrace, hedge.by)
+	assert.Equal(t, 2, hedge.attempt)
+	assert.Equal(t, uint64(1), hedge.first.serial)
+	assert.Equal(t, uint64(1), hedge.previous.serial)
+
+	detector.observeResponse(200, at(100))
+
+	// the same request line without a trace ID is also a duplicate
+	retry := detector.observeRequest(4, 300, at(200), nil, request)
+	assert.NotNil(t, retry)
+	assert.Equal(t, "retry", retry.kind())
+	assert.Equal(t, httpRetryByRequest, retry.by)
+	assert.Equal(t, 4, retry.attempt)
+	assert.Equal(t, uint64(3), retry.previous.serial)
+
+	// attempts outside of the window are forgotten
+	assert.Nil(t, detector.observeRequest(5, 400, at(200).Add(httpRetryWindow+time.Millisecond), nil, request))
+	assert.Nil(t, detector.observeRequest(6, 500, at(0), nil, "10.0.0.2 GET api.example/items"))
+}
@@ -0,0 +1,156 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	mapset "github.com/deckarep/golang-set/v2"
+)
+
+type (
+	// httpSessionHasher replaces the values of selected cookies and headers with their keyed hash:
+	//   - requests from the same session can be correlated across connections,
+	//   - the raw credentials are never written into translations.
+	httpSessionHasher struct {
+		key     []byte
+		cookies mapset.Set[string]
+		headers mapset.Set[string]
+	}
+)
+
+const (
+	httpSessionSaltEnvVarName = "PCAP_SESSION_SALT"
+	httpSessionHeaderPrefix   = "header:"
+	httpSessionHashSize       = 16 // bytes
+	httpCookieHeader          = "Cookie"
+	httpSetCookieHeader       = "Set-Cookie"
+)
+
+// when no salt is provided, a random key is shared by all translators;
+// so that hashes are consistent across interfaces, but not across executions.
+var httpSessionKey = sync.OnceValue(func() []byte {
+	if salt := os.Getenv(httpSessionSaltEnvVarName); salt != "" {
+		return []byte(salt)
+	}
+	key := make([]byte, sha256.BlockSize)
+	rand.Read(key)
+	return key
+})
+
+// newHTTPSessionHasher returns `nil` if no session keys are selected:
+//   - keys prefixed with `header:` select HTTP headers; i/e: `header:X-Session-Id`,
+//   - all other keys select cookies; i/e: `SESSIONID`.
+func newHTTPSessionHasher(keys []string) *httpSessionHasher {
+	cookies := mapset.NewThreadUnsafeSet[string]()
+	headers := mapset.NewThreadUnsafeSet[string]()
+
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		if header, ok := strings.CutPrefix(key, httpSessionHeaderPrefix); ok && header != "" {
+			headers.Add(http.CanonicalHeaderKey(header))
+		} else if key != "" && key != httpSessionHeaderPrefix {
+			cookies.Add(key)
+		}
+	}
+
+	if cookies.IsEmpty() && headers.IsEmpty() {
+		return nil
+	}
+
+	return &httpSessionHasher{
+		key:     httpSessionKey(),
+		cookies: cookies,
+		headers: headers,
+	}
+}
+
+func (h *httpSessionHasher) hash(value string) string {
+	mac := hmac.New(sha256.New, h.key)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil)[:httpSessionHashSize])
+}
+
+func (h *httpSessionHasher) hashCookies(
+	headers http.Header,
+	sessions map[string]string,
+) {
+	values := headers.Values(httpCookieHeader)
+	for i, value := range values {
+		cookies, err := http.ParseCookie(value)
+		if err != nil {
+			// cookies cannot be rewritten, so it is not safe to keep them
+			values[i] = ""
+			continue
+		}
+		pairs := make([]string, len(cookies))
+		for j, cookie := range cookies {
+			if h.cookies.ContainsOne(cookie.Name) {
+				cookie.Value = h.hash(cookie.Value)
+				sessions[cookie.Name] = cookie.Value
+			}
+			pairs[j] = cookie.Name + "=" + cookie.Value
+		}
+		values[i] = strings.Join(pairs, "; ")
+	}
+}
+
+func (h *httpSessionHasher) hashSetCookies(
+	headers http.Header,
+	sessions map[string]string,
+) {
+	values := headers.Values(httpSetCookieHeader)
+	for i, value := range values {
+		cookie, err := http.ParseSetCookie(value)
+		if err != nil {
+			values[i] = ""
+			continue
+		}
+		if h.cookies.ContainsOne(cookie.Name) {
+			cookie.Value = h.hash(cookie.Value)
+			sessions[cookie.Name] = cookie.Value
+			values[i] = cookie.String()
+		}
+	}
+}
+
+// apply rewrites `headers` in place, and returns the hashes of all the selected session keys that were found.
+func (h *httpSessionHasher) apply(headers http.Header) map[string]string {
+	sessions := make(map[string]string)
+
+	h.headers.Each(func(header string) bool {
+		// `Values(...)` does not copy: header values are replaced in place
+		values := headers.Values(header)
+		for i, value := range values {
+			values[i] = h.hash(value)
+			sessions[header] = values[i]
+		}
+		return false
+	})
+
+	if !h.cookies.IsEmpty() {
+		h.hashCookies(headers, sessions)
+		h.hashSetCookies(headers, sessions)
+	}
+
+	return sessions
+}
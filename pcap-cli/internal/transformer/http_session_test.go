@@ -0,0 +1,64 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestHTTPSessionHasher verifies that selected session keys are hashed consistently and never leaked.
+func TestHTTPSessionHasher(t *testing.T) {
+	t.Parallel()
+
+	assert.Nil(t, newHTTPSessionHasher(nil))
+	assert.Nil(t, newHTTPSessionHasher([]string{" ", "header:"}))
+
+	hasher := newHTTPSessionHasher([]string{"SESSIONID", "header:x-session-id"})
+	assert.NotNil(t, hasher)
+
+	request := http.Header{}
+	request.Set("Cookie", "SESSIONID=s3cr3t; theme=dark")
+	request.Set("X-Session-Id", "t0k3n")
+
+	requestSessions := hasher.apply(request)
+	assert.Len(t, requestSessions, 2)
+	assert.Len(t, requestSessions["SESSIONID"], 2*httpSessionHashSize)
+	assert.Equal(t, "SESSIONID="+requestSessions["SESSIONID"]+"; theme=dark", request.Get("Cookie"))
+	assert.Equal(t, requestSessions["X-Session-Id"], request.Get("X-Session-Id"))
+
+	response := http.Header{}
+	response.Add("Set-Cookie", "SESSIONID=s3cr3t; Path=/; HttpOnly")
+	response.Add("Set-Cookie", "theme=dark")
+
+	responseSessions := hasher.apply(response)
+	// the same session must produce the same hash in requests and responses
+	assert.Equal(t, requestSessions["SESSIONID"], responseSessions["SESSIONID"])
+	assert.Equal(t, "theme=dark", response.Values("Set-Cookie")[1])
+
+	for _, headers := range []http.Header{request, response} {
+		for _, values := range headers {
+			for _, value := range values {
+				assert.False(t, strings.Contains(value, "s3cr3t"))
+				assert.False(t, strings.Contains(value, "t0k3n"))
+			}
+		}
+	}
+
+	assert.Empty(t, hasher.apply(http.Header{"Cookie": []string{"theme=dark"}}))
+}
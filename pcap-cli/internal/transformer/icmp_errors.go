@@ -0,0 +1,196 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/segmentio/fasthash/fnv1a"
+)
+
+type (
+	// icmpEmbeddedPacket is the original packet embedded in ICMP errors:
+	// the IP header and, if available, the ports of its transport layer.
+	icmpEmbeddedPacket struct {
+		version  uint8
+		proto    layers.IPProtocol
+		src, dst netip.Addr
+		srcPort  uint16
+		dstPort  uint16
+		hasPorts bool
+		// only available if the original packet is a TCP segment
+		seq *uint32
+	}
+
+	// icmpFlowError is the most recent ICMP error that referenced a tracked TCP flow.
+	icmpFlowError struct {
+		serial    uint64
+		timestamp time.Time
+		version   uint8
+		msg       string
+		// only available for ICMPv4 `fragmentation needed` and ICMPv6 `packet too big`
+		mtu uint32
+	}
+
+	// icmpFlowErrors is guarded by its own mutex: ICMP errors are annotated without locking the flow they reference.
+	icmpFlowErrors struct {
+		mu   sync.Mutex
+		last *icmpFlowError
+	}
+)
+
+// icmpEmbeddedPayload returns the original packet embedded in the ICMP error carried by `packet`; if any.
+func icmpEmbeddedPayload(packet gopacket.Packet) []byte {
+	if icmp4, ok := packet.Layer(layers.LayerTypeICMPv4).(*layers.ICMPv4); ok {
+		switch icmp4.TypeCode.Type() {
+		case layers.ICMPv4TypeDestinationUnreachable,
+			layers.ICMPv4TypeTimeExceeded,
+			layers.ICMPv4TypeParameterProblem,
+			layers.ICMPv4TypeSourceQuench,
+			layers.ICMPv4TypeRedirect:
+			return icmp4.LayerPayload()
+		}
+	} else if icmp6, ok := packet.Layer(layers.LayerTypeICMPv6).(*layers.ICMPv6); ok {
+		switch icmp6.TypeCode.Type() {
+		case layers.ICMPv6TypeDestinationUnreachable,
+			layers.ICMPv6TypePacketTooBig,
+			layers.ICMPv6TypeTimeExceeded,
+			layers.ICMPv6TypeParameterProblem:
+			// the 1st 4 bytes are either unused, the MTU or the pointer
+			if payload := icmp6.LayerPayload(); len(payload) > 4 {
+				return payload[4:]
+			}
+		}
+	}
+	return nil
+}
+
+// icmpMTU returns the next-hop MTU of ICMPv4 `fragmentation needed` and ICMPv6 `packet too big` errors.
+func icmpMTU(packet gopacket.Packet) (uint32, bool) {
+	if icmp4, ok := packet.Layer(layers.LayerTypeICMPv4).(*layers.ICMPv4); ok {
+		// see: https://datatracker.ietf.org/doc/html/rfc1191#section-4
+		if icmp4.TypeCode == layers.CreateICMPv4TypeCode(layers.ICMPv4TypeDestinationUnreachable, layers.ICMPv4CodeFragmentationNeeded) {
+			return uint32(icmp4.Seq), true
+		}
+	} else if icmp6, ok := packet.Layer(layers.LayerTypeICMPv6).(*layers.ICMPv6); ok {
+		// see: https://datatracker.ietf.org/doc/html/rfc4443#section-3.2
+		if payload := icmp6.LayerPayload(); icmp6.TypeCode.Type() == layers.ICMPv6TypePacketTooBig && len(payload) >= 4 {
+			return binary.BigEndian.Uint32(payload[:4]), true
+		}
+	}
+	return 0, false
+}
+
+// parseICMPEmbedded decodes the IP header of the original packet, and the 1st 8 bytes of its payload.
+func parseICMPEmbedded(embedded []byte) (*icmpEmbeddedPacket, bool) {
+	if len(embedded) == 0 {
+		return nil, false
+	}
+
+	var packet *icmpEmbeddedPacket
+	var payload []byte
+
+	switch embedded[0] >> 4 {
+	case 4:
+		headerSize := int(embedded[0]&0x0F) * 4
+		if headerSize < 20 || len(embedded) < headerSize {
+			return nil, false
+		}
+		packet = &icmpEmbeddedPacket{
+			version: 4,
+			proto:   layers.IPProtocol(embedded[9]),
+			src:     netip.AddrFrom4([4]byte(embedded[12:16])),
+			dst:     netip.AddrFrom4([4]byte(embedded[16:20])),
+		}
+		// only the 1st fragment carries the transport header
+		if binary.BigEndian.Uint16(embedded[6:8])&0x1FFF == 0 {
+			payload = embedded[headerSize:]
+		}
+	case 6:
+		if len(embedded) < ipv6HeaderSize {
+			return nil, false
+		}
+		packet = &icmpEmbeddedPacket{
+			version: 6,
+			proto:   layers.IPProtocol(embedded[6]),
+			src:     netip.AddrFrom16([16]byte(embedded[8:24])),
+			dst:     netip.AddrFrom16([16]byte(embedded[24:40])),
+		}
+		payload = embedded[ipv6HeaderSize:]
+	default:
+		return nil, false
+	}
+
+	switch packet.proto {
+	case layers.IPProtocolTCP, layers.IPProtocolUDP, layers.IPProtocolSCTP:
+		// TCP, UDP and SCTP headers start with the source and destination ports
+		if len(payload) >= 4 {
+			packet.srcPort = binary.BigEndian.Uint16(payload[0:2])
+			packet.dstPort = binary.BigEndian.Uint16(payload[2:4])
+			packet.hasPorts = true
+		}
+		if packet.proto == layers.IPProtocolTCP && len(payload) >= 8 {
+			seq := binary.BigEndian.Uint32(payload[4:8])
+			packet.seq = &seq
+		}
+	}
+
+	return packet, true
+}
+
+// flowID calculates the same `flowID` as translations of packets of the original flow; see `JSONPcapTranslator.finalize`.
+func (p *icmpEmbeddedPacket) flowID(ifaceIndex uint8) uint64 {
+	flowID := fnv1a.AddUint64(fnv1a.Init64, uint64(ifaceIndex))
+
+	if p.version == 4 {
+		src, dst := p.src.As4(), p.dst.As4()
+		flowID = fnv1a.AddUint64(flowID, fnv1a.HashUint64(uint64(4)+fnv1a.HashBytes64(src[:])+fnv1a.HashBytes64(dst[:])))
+	} else {
+		src, dst := p.src.As16(), p.dst.As16()
+		flowID = fnv1a.AddUint64(flowID, fnv1a.HashUint64(uint64(41)+fnv1a.HashBytes64(src[:])+fnv1a.HashBytes64(dst[:])))
+	}
+
+	if !p.hasPorts {
+		return fnv1a.AddUint64(flowID, 255) // RESERVED (0xFF)
+	}
+	return fnv1a.AddUint64(flowID, fnv1a.HashUint64(uint64(p.proto)+uint64(p.srcPort)+uint64(p.dstPort)))
+}
+
+func (e *icmpFlowErrors) set(err *icmpFlowError) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.last = err
+}
+
+func (e *icmpFlowErrors) get() *icmpFlowError {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.last
+}
+
+// annotateICMP records an ICMP error on the tracked TCP flow it references; it returns `false` if the flow is not tracked.
+func (fm *flowMutex) annotateICMP(flowID uint64, err *icmpFlowError) bool {
+	carrier, ok := fm.MutexMap.Get(flowID)
+	if !ok {
+		return false
+	}
+	carrier.icmpErrors.set(err)
+	return true
+}
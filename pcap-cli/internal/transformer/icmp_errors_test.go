@@ -0,0 +1,159 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/alphadose/haxmap"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/segmentio/fasthash/fnv1a"
+	"github.com/stretchr/testify/assert"
+)
+
+func newICMPErrorsTestTCPSegment(t *testing.T, src, dst net.IP, srcPort, dstPort layers.TCPPort) []byte {
+	ip := &layers.IPv4{Version: 4, Id: 1234, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: src, DstIP: dst}
+	tcp := &layers.TCP{SrcPort: srcPort, DstPort: dstPort, Seq: 1000, ACK: true, PSH: true, Window: 1024}
+	tcp.SetNetworkLayerForChecksum(ip)
+	buffer := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	assert.NoError(t, gopacket.SerializeLayers(buffer, opts, ip, tcp, gopacket.Payload(make([]byte, 1400))))
+	return buffer.Bytes()
+}
+
+// TestICMPEmbeddedIPv4 verifies that `fragmentation needed` errors report the MTU and the flow of the original segment.
+func TestICMPEmbeddedIPv4(t *testing.T) {
+	t.Parallel()
+
+	client, server := net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)
+	original := newICMPErrorsTestTCPSegment(t, client, server, 40000, 443)
+
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolICMPv4, SrcIP: net.IPv4(10, 0, 0, 254), DstIP: client}
+	icmp := &layers.ICMPv4{
+		TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeDestinationUnreachable, layers.ICMPv4CodeFragmentationNeeded),
+		Seq:      1400,
+	}
+	buffer := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	assert.NoError(t, gopacket.SerializeLayers(buffer, opts, ip, icmp, gopacket.Payload(original[:28])))
+	packet := gopacket.NewPacket(buffer.Bytes(), layers.LayerTypeIPv4, gopacket.Default)
+
+	mtu, ok := icmpMTU(packet)
+	assert.True(t, ok)
+	assert.Equal(t, uint32(1400), mtu)
+
+	embedded, ok := parseICMPEmbedded(icmpEmbeddedPayload(packet))
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Equal(t, uint8(4), embedded.version)
+	assert.Equal(t, layers.IPProtocolTCP, embedded.proto)
+	assert.Equal(t, netip.MustParseAddr("10.0.0.1"), embedded.src)
+	assert.Equal(t, netip.MustParseAddr("10.0.0.2"), embedded.dst)
+	assert.True(t, embedded.hasPorts)
+	assert.Equal(t, uint16(40000), embedded.srcPort)
+	assert.Equal(t, uint16(443), embedded.dstPort)
+	if assert.NotNil(t, embedded.seq) {
+		assert.Equal(t, uint32(1000), *embedded.seq)
+	}
+
+	// same calculation as translations of the packets of the original flow
+	flowID := fnv1a.AddUint64(fnv1a.Init64, uint64(2))
+	flowID = fnv1a.AddUint64(flowID, fnv1a.HashUint64(uint64(4)+fnv1a.HashBytes64(server.To4())+fnv1a.HashBytes64(client.To4())))
+	flowID = fnv1a.AddUint64(flowID, fnv1a.HashUint64(uint64(6)+uint64(443)+uint64(40000)))
+	assert.Equal(t, flowID, embedded.flowID(2))
+
+	// time exceeded errors do not carry the MTU
+	_, ok = icmpMTU(newPacketIndexTestICMPError(t, original[:28]))
+	assert.False(t, ok)
+}
+
+// TestICMPEmbeddedIPv6 verifies that `packet too big` errors report the MTU and the ports of the original datagram.
+func TestICMPEmbeddedIPv6(t *testing.T) {
+	t.Parallel()
+
+	client, server := net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2")
+
+	ip6 := &layers.IPv6{Version: 6, HopLimit: 64, NextHeader: layers.IPProtocolUDP, SrcIP: client, DstIP: server}
+	udp := &layers.UDP{SrcPort: 50000, DstPort: 443}
+	udp.SetNetworkLayerForChecksum(ip6)
+	buffer := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	assert.NoError(t, gopacket.SerializeLayers(buffer, opts, ip6, udp, gopacket.Payload(make([]byte, 1400))))
+	original := buffer.Bytes()
+
+	// MTU ( 1280 ) followed by the original packet
+	payload := append([]byte{0, 0, 0x05, 0x00}, original[:ipv6HeaderSize+8]...)
+	icmp6 := &layers.ICMPv6{TypeCode: layers.CreateICMPv6TypeCode(layers.ICMPv6TypePacketTooBig, 0)}
+	ip := &layers.IPv6{Version: 6, HopLimit: 64, NextHeader: layers.IPProtocolICMPv6, SrcIP: net.ParseIP("2001:db8::fe"), DstIP: client}
+	assert.NoError(t, icmp6.SetNetworkLayerForChecksum(ip))
+	buffer = gopacket.NewSerializeBuffer()
+	assert.NoError(t, gopacket.SerializeLayers(buffer, opts, ip, icmp6, gopacket.Payload(payload)))
+	packet := gopacket.NewPacket(buffer.Bytes(), layers.LayerTypeIPv6, gopacket.Default)
+
+	mtu, ok := icmpMTU(packet)
+	assert.True(t, ok)
+	assert.Equal(t, uint32(1280), mtu)
+
+	embedded, ok := parseICMPEmbedded(icmpEmbeddedPayload(packet))
+	if assert.True(t, ok) {
+		assert.Equal(t, uint8(6), embedded.version)
+		assert.Equal(t, layers.IPProtocolUDP, embedded.proto)
+		assert.Equal(t, netip.MustParseAddr("2001:db8::2"), embedded.dst)
+		assert.Equal(t, uint16(50000), embedded.srcPort)
+		assert.Equal(t, uint16(443), embedded.dstPort)
+		assert.Nil(t, embedded.seq)
+	}
+}
+
+// TestICMPEmbeddedFragment verifies that ports are not read from non-initial fragments.
+func TestICMPEmbeddedFragment(t *testing.T) {
+	t.Parallel()
+
+	original := newICMPErrorsTestTCPSegment(t, net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2), 40000, 443)
+	fragment := append([]byte{}, original[:28]...)
+	fragment[6], fragment[7] = 0x00, 0xb9 // offset: 185 * 8 bytes
+
+	embedded, ok := parseICMPEmbedded(fragment)
+	if assert.True(t, ok) {
+		assert.False(t, embedded.hasPorts)
+		assert.Nil(t, embedded.seq)
+	}
+
+	_, ok = parseICMPEmbedded(original[:12])
+	assert.False(t, ok)
+	_, ok = parseICMPEmbedded(nil)
+	assert.False(t, ok)
+}
+
+// TestAnnotateICMP verifies that only tracked flows are annotated.
+func TestAnnotateICMP(t *testing.T) {
+	t.Parallel()
+
+	fm := &flowMutex{MutexMap: haxmap.New[uint64, *flowLockCarrier]()}
+	serial, flowID := uint64(1), uint64(42)
+	carrier := fm.newFlowLockCarrier(&serial, &flowID)
+	fm.MutexMap.Set(flowID, carrier)
+
+	icmpError := &icmpFlowError{serial: 7, version: 4, msg: "DestinationUnreachable(FragmentationNeeded)", mtu: 1400}
+	assert.False(t, fm.annotateICMP(43, icmpError))
+	assert.Nil(t, carrier.icmpErrors.get())
+
+	assert.True(t, fm.annotateICMP(flowID, icmpError))
+	assert.Equal(t, icmpError, carrier.icmpErrors.get())
+}
@@ -0,0 +1,206 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+type (
+	// ipv4Fragmented is the number of fragments a datagram was reassembled from; it is attached to reassembled packets.
+	ipv4Fragmented int
+
+	// see: https://datatracker.ietf.org/doc/html/rfc791#section-3.2
+	ipv4DefragKey struct {
+		src, dst netip.Addr
+		id       uint16
+		protocol layers.IPProtocol
+	}
+
+	ipv4Fragment struct {
+		offset int
+		data   []byte
+	}
+
+	ipv4Datagram struct {
+		fragments []ipv4Fragment
+		// length of the payload, only known when the last fragment is received
+		length int
+		bytes  int
+		first  time.Time
+	}
+
+	// ipv4Defragmenter must observe packets sequentially in capture order: it is not thread-safe.
+	ipv4Defragmenter struct {
+		datagrams map[ipv4DefragKey]*ipv4Datagram
+	}
+)
+
+const (
+	// fragments of datagrams not completed within this time are dropped; same default as Linux `ipfrag_time`
+	ipv4DefragTimeout = 30 * time.Second
+	// see: https://datatracker.ietf.org/doc/html/rfc791#section-3.1
+	ipv4MaxDatagramLength   = 65535
+	ipv4DefragFragmentLimit = 64
+	ipv4DefragLimit         = 1024
+)
+
+func newIPv4Defragmenter() *ipv4Defragmenter {
+	return &ipv4Defragmenter{datagrams: make(map[ipv4DefragKey]*ipv4Datagram)}
+}
+
+func isIPv4Fragment(ip4 *layers.IPv4) bool {
+	return ip4.Flags&layers.IPv4MoreFragments != 0 || ip4.FragOffset != 0
+}
+
+// add returns the payload of the datagram once all its fragments have been received;
+// overlapping bytes are taken from the fragment received 1st.
+func (d *ipv4Datagram) add(offset int, data []byte, last bool) ([]byte, bool) {
+	if last {
+		d.length = offset + len(data)
+	}
+	d.fragments = append(d.fragments, ipv4Fragment{offset: offset, data: slices.Clone(data)})
+	d.bytes += len(data)
+	if d.length == 0 || d.bytes < d.length {
+		return nil, false
+	}
+
+	slices.SortStableFunc(d.fragments, func(a, b ipv4Fragment) int {
+		return a.offset - b.offset
+	})
+	payload := make([]byte, 0, d.length)
+	for _, fragment := range d.fragments {
+		if fragment.offset > len(payload) {
+			// there is a hole: more fragments are expected
+			return nil, false
+		}
+		if end := fragment.offset + len(fragment.data); end > len(payload) {
+			payload = append(payload, fragment.data[len(payload)-fragment.offset:]...)
+		}
+	}
+	if len(payload) < d.length {
+		return nil, false
+	}
+	return payload[:d.length], true
+}
+
+// expire drops datagrams which were not completed in time.
+func (d *ipv4Defragmenter) expire(now time.Time) {
+	for key, datagram := range d.datagrams {
+		if now.Sub(datagram.first) >= ipv4DefragTimeout {
+			delete(d.datagrams, key)
+		}
+	}
+	if len(d.datagrams) >= ipv4DefragLimit {
+		clear(d.datagrams)
+	}
+}
+
+// defragment returns the reassembled IPv4 layer when `ip4` is the fragment completing a datagram.
+func (d *ipv4Defragmenter) defragment(ip4 *layers.IPv4, timestamp time.Time) (*layers.IPv4, int) {
+	src, _ := netip.AddrFromSlice(ip4.SrcIP.To4())
+	dst, _ := netip.AddrFromSlice(ip4.DstIP.To4())
+	key := ipv4DefragKey{src: src, dst: dst, id: ip4.Id, protocol: ip4.Protocol}
+
+	datagram, ok := d.datagrams[key]
+	if !ok {
+		if len(d.datagrams) >= ipv4DefragLimit {
+			d.expire(timestamp)
+		}
+		datagram = &ipv4Datagram{first: timestamp}
+		d.datagrams[key] = datagram
+	} else if timestamp.Sub(datagram.first) >= ipv4DefragTimeout {
+		// the identification field has been reused: previous fragments are stale
+		datagram = &ipv4Datagram{first: timestamp}
+		d.datagrams[key] = datagram
+	}
+
+	offset := int(ip4.FragOffset) * 8
+	last := ip4.Flags&layers.IPv4MoreFragments == 0
+	if offset+len(ip4.Payload) > ipv4MaxDatagramLength-int(ip4.IHL)*4 ||
+		len(datagram.fragments) >= ipv4DefragFragmentLimit {
+		delete(d.datagrams, key)
+		return nil, 0
+	}
+
+	payload, complete := datagram.add(offset, ip4.Payload, last)
+	if !complete {
+		return nil, 0
+	}
+	delete(d.datagrams, key)
+
+	reassembled := *ip4
+	reassembled.Flags &^= layers.IPv4MoreFragments
+	reassembled.FragOffset = 0
+	reassembled.Payload = payload
+	return &reassembled, len(datagram.fragments)
+}
+
+// observe returns the packet to be translated instead of `packet` when it is the fragment completing a datagram:
+// the reassembled datagram is decoded with the same link layer as its last fragment.
+func (d *ipv4Defragmenter) observe(packet gopacket.Packet) gopacket.Packet {
+	if d == nil {
+		return nil
+	}
+	ip4, ok := packet.NetworkLayer().(*layers.IPv4)
+	if !ok || !isIPv4Fragment(ip4) || packet.Metadata().Truncated {
+		return nil
+	}
+
+	reassembled, fragments := d.defragment(ip4, packet.Metadata().Timestamp)
+	if reassembled == nil {
+		return nil
+	}
+
+	// bytes ahead of the IPv4 header: link layer and encapsulations
+	header := 0
+	for _, layer := range packet.Layers() {
+		if layer.LayerType() == layers.LayerTypeIPv4 {
+			break
+		}
+		header += len(layer.LayerContents())
+	}
+	if header > len(packet.Data()) {
+		return nil
+	}
+
+	buffer := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buffer, opts, reassembled, gopacket.Payload(reassembled.Payload)); err != nil {
+		return nil
+	}
+	data := append(slices.Clone(packet.Data()[:header]), buffer.Bytes()...)
+
+	datagram := gopacket.NewPacket(data, packet.Layers()[0].LayerType(), gopacket.NoCopy)
+	metadata := datagram.Metadata()
+	metadata.CaptureInfo = packet.Metadata().CaptureInfo
+	metadata.CaptureLength, metadata.Length = len(data), len(data)
+	metadata.AncillaryData = append(slices.Clone(packet.Metadata().AncillaryData), ipv4Fragmented(fragments))
+	return datagram
+}
+
+func ipv4FragmentsOf(packet gopacket.Packet) int {
+	for _, data := range packet.Metadata().AncillaryData {
+		if fragments, ok := data.(ipv4Fragmented); ok {
+			return int(fragments)
+		}
+	}
+	return 0
+}
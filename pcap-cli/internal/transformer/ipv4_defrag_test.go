@@ -0,0 +1,123 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+// ipv4DefragTestFragments splits a DNS response into fragments carrying `size` bytes of the UDP datagram.
+func ipv4DefragTestFragments(t *testing.T, protocol layers.IPProtocol, size int) ([]gopacket.Packet, []byte) {
+	dns := &layers.DNS{ID: 0xcafe, QR: true, RD: true, RA: true, ResponseCode: layers.DNSResponseCodeNoErr}
+	dns.Questions = []layers.DNSQuestion{{Name: []byte("example.com"), Type: layers.DNSTypeTXT, Class: layers.DNSClassIN}}
+	for range 8 {
+		dns.Answers = append(dns.Answers, layers.DNSResourceRecord{
+			Name: []byte("example.com"), Type: layers.DNSTypeTXT, Class: layers.DNSClassIN, TTL: 60,
+			TXTs: [][]byte{[]byte("v=spf1 include:_spf.example.com include:_spf.example.net ~all")},
+		})
+	}
+	ip := &layers.IPv4{Version: 4, TTL: 64, Id: 0x1234, Protocol: protocol, SrcIP: net.IPv4(8, 8, 8, 8), DstIP: net.IPv4(10, 0, 0, 1)}
+	udp := &layers.UDP{SrcPort: 53, DstPort: 40000}
+	udp.SetNetworkLayerForChecksum(ip)
+
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	datagram := gopacket.NewSerializeBuffer()
+	assert.NoError(t, gopacket.SerializeLayers(datagram, opts, udp, dns))
+	payload := datagram.Bytes()
+
+	eth := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0, 1, 2, 3, 4, 5},
+		DstMAC:       net.HardwareAddr{0, 1, 2, 3, 4, 6},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	fragments := []gopacket.Packet{}
+	for offset := 0; offset < len(payload); offset += size {
+		end := min(offset+size, len(payload))
+		fragment := *ip
+		fragment.FragOffset = uint16(offset / 8)
+		if end < len(payload) {
+			fragment.Flags = layers.IPv4MoreFragments
+		}
+		buffer := gopacket.NewSerializeBuffer()
+		assert.NoError(t, gopacket.SerializeLayers(buffer, opts, eth, &fragment, gopacket.Payload(payload[offset:end])))
+		packet := gopacket.NewPacket(buffer.Bytes(), layers.LayerTypeEthernet, gopacket.Default)
+		packet.Metadata().Timestamp = time.Unix(1700000000, 0)
+		fragments = append(fragments, packet)
+	}
+	return fragments, payload
+}
+
+func TestIPv4DefragDNSResponse(t *testing.T) {
+	t.Parallel()
+
+	fragments, payload := ipv4DefragTestFragments(t, layers.IPProtocolUDP, 248)
+	if !assert.Len(t, fragments, 3) {
+		return
+	}
+
+	d := newIPv4Defragmenter()
+	// fragments may be captured in any order
+	assert.Nil(t, d.observe(fragments[2]))
+	assert.Nil(t, d.observe(fragments[0]))
+
+	datagram := d.observe(fragments[1])
+	if assert.NotNil(t, datagram) {
+		assert.Equal(t, 3, ipv4FragmentsOf(datagram))
+		assert.NotNil(t, datagram.Layer(layers.LayerTypeEthernet))
+
+		ip4, _ := datagram.NetworkLayer().(*layers.IPv4)
+		if assert.NotNil(t, ip4) {
+			assert.False(t, isIPv4Fragment(ip4))
+			assert.Equal(t, payload, ip4.Payload)
+		}
+		dns, _ := datagram.Layer(layers.LayerTypeDNS).(*layers.DNS)
+		if assert.NotNil(t, dns) {
+			assert.Equal(t, uint16(0xcafe), dns.ID)
+			assert.Len(t, dns.Answers, 8)
+		}
+	}
+	assert.Empty(t, d.datagrams)
+}
+
+func TestIPv4DefragDuplicatesAndTimeout(t *testing.T) {
+	t.Parallel()
+
+	d := newIPv4Defragmenter()
+	fragments, _ := ipv4DefragTestFragments(t, layers.IPProtocolUDP, 248)
+
+	assert.Nil(t, d.observe(fragments[0]))
+	// duplicated fragments do not complete datagrams
+	assert.Nil(t, d.observe(fragments[0]))
+	assert.Nil(t, d.observe(fragments[2]))
+
+	// fragments of stale datagrams are dropped
+	fragments[1].Metadata().Timestamp = fragments[1].Metadata().Timestamp.Add(ipv4DefragTimeout)
+	assert.Nil(t, d.observe(fragments[1]))
+
+	// datagrams are identified by protocol as well
+	others, _ := ipv4DefragTestFragments(t, layers.IPProtocolUDPLite, 248)
+	assert.Nil(t, d.observe(others[0]))
+	assert.Len(t, d.datagrams, 2)
+
+	// packets which are not fragments are not reassembled
+	unfragmented, _ := ipv4DefragTestFragments(t, layers.IPProtocolUDP, 1500)
+	assert.Nil(t, d.observe(unfragmented[0]))
+}
@@ -0,0 +1,106 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/pkg/errors"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+type (
+	// jsonEncoding re-encodes JSON translations using a binary format:
+	//   - the document structure is identical, so binary translations can be transcoded back into JSON,
+	//   - binary translations are self-delimiting, so they are written one after the other without separators.
+	jsonEncoding struct {
+		name    string
+		marshal func(any) ([]byte, error)
+	}
+)
+
+const (
+	jsonEncodingJSON    = "json"
+	jsonEncodingCBOR    = "cbor"
+	jsonEncodingMsgPack = "msgpack"
+)
+
+var errUnavailableEncoding = errors.New("unavailable encoding")
+
+var jsonEncodings = map[string]func(any) ([]byte, error){
+	jsonEncodingCBOR:    cbor.Marshal,
+	jsonEncodingMsgPack: msgpack.Marshal,
+}
+
+// newJSONEncoding returns `nil` when translations must be written as JSON.
+func newJSONEncoding(name string) (*jsonEncoding, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" || name == jsonEncodingJSON {
+		return nil, nil
+	}
+	if marshal, ok := jsonEncodings[name]; ok {
+		return &jsonEncoding{name, marshal}, nil
+	}
+	return nil, errors.Wrap(errUnavailableEncoding, name)
+}
+
+// jsonNumber keeps integers as integers: `float64` would lose precision and change the document structure.
+func jsonNumber(number json.Number) any {
+	if value, err := strconv.ParseInt(number.String(), 10, 64); err == nil {
+		return value
+	}
+	if value, err := strconv.ParseUint(number.String(), 10, 64); err == nil {
+		return value
+	}
+	value, _ := number.Float64()
+	return value
+}
+
+func jsonValue(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		return jsonNumber(v)
+	case map[string]any:
+		for key, item := range v {
+			v[key] = jsonValue(item)
+		}
+	case []any:
+		for index, item := range v {
+			v[index] = jsonValue(item)
+		}
+	}
+	return value
+}
+
+// encode re-encodes the JSON document `translation`.
+func (e *jsonEncoding) encode(translation []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(translation))
+	decoder.UseNumber()
+
+	var document any
+	if err := decoder.Decode(&document); err != nil {
+		return nil, errors.Wrap(err, "invalid JSON translation")
+	}
+
+	encoded, err := e.marshal(jsonValue(document))
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s encoding failed", e.name)
+	}
+	return encoded, nil
+}
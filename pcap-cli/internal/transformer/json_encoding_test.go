@@ -0,0 +1,70 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const jsonEncodingTestTranslation = `{"pcap":{"num":"18446744073709551615"},"L3":{"src":"10.0.0.1","ttl":64},"L4":{"seq":4294967295,"len":"0","flags":{"map":{"SYN":true}}},"HTTP":{"request":{"latency":-1}},"ratio":0.5,"err":[{"msg":"x"}],"trace":null}`
+
+// TestJSONEncoding verifies that binary encodings preserve the structure of JSON translations.
+func TestJSONEncoding(t *testing.T) {
+	t.Parallel()
+
+	encoding, err := newJSONEncoding(" JSON ")
+	assert.NoError(t, err)
+	assert.Nil(t, encoding)
+
+	_, err = newJSONEncoding("xml")
+	assert.ErrorIs(t, err, errUnavailableEncoding)
+
+	tests := []struct {
+		name      string
+		unmarshal func([]byte, any) error
+	}{
+		{name: jsonEncodingCBOR, unmarshal: cbor.Unmarshal},
+		{name: jsonEncodingMsgPack, unmarshal: msgpack.Unmarshal},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			encoding, err := newJSONEncoding(tc.name)
+			assert.NoError(t, err)
+			assert.NotNil(t, encoding)
+
+			encoded, err := encoding.encode([]byte(jsonEncodingTestTranslation + "\n"))
+			assert.NoError(t, err)
+			assert.Less(t, len(encoded), len(jsonEncodingTestTranslation))
+
+			var document map[string]any
+			assert.NoError(t, tc.unmarshal(encoded, &document))
+
+			transcoded, err := json.Marshal(document)
+			assert.NoError(t, err)
+			assert.JSONEq(t, jsonEncodingTestTranslation, string(transcoded))
+		})
+	}
+
+	_, err = (&jsonEncoding{jsonEncodingCBOR, cbor.Marshal}).encode([]byte("{"))
+	assert.Error(t, err)
+}
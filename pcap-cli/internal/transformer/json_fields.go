@@ -0,0 +1,237 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/Jeffail/gabs/v2"
+)
+
+type (
+	// jsonFieldsNode is a tree of field paths: a node selects its whole subtree if `all` is set.
+	jsonFieldsNode struct {
+		all      bool
+		children map[string]*jsonFieldsNode
+	}
+
+	// jsonFieldsSelector shrinks JSON translations to the selected fields:
+	//   - if fields are included, only those are retained; otherwise all fields are retained,
+	//   - excluded fields are then removed from the retained ones.
+	jsonFieldsSelector struct {
+		include *jsonFieldsNode
+		exclude *jsonFieldsNode
+	}
+)
+
+const (
+	jsonFieldsSeparator     = "."
+	jsonFieldsWildcard      = "*"
+	jsonFieldsExcludePrefix = "-"
+	// keys with this prefix are consumed by Cloud Logging, so they are always retained
+	jsonFieldsLoggingPrefix = "logging.googleapis.com/"
+)
+
+// aliases allow to select fields using protocol names; i/e: `tcp.flags` instead of `L4.flags`
+var jsonFieldsAliases = map[string]string{
+	"eth":  "l2",
+	"ip":   "l3",
+	"ipv4": "l3",
+	"ipv6": "l3",
+	"tcp":  "l4",
+	"udp":  "l4",
+	"sctp": "l4",
+}
+
+// always retained as Cloud Logging uses them to populate the `LogEntry`, and consumers rely on `schemaVersion`
+var jsonFieldsRequired = []string{"schemaversion", "timestamp", "severity"}
+
+func newJSONFieldsNode() *jsonFieldsNode {
+	return &jsonFieldsNode{children: make(map[string]*jsonFieldsNode)}
+}
+
+func (n *jsonFieldsNode) add(path []string) {
+	// `http.*` is the same as `http`
+	for len(path) > 1 && path[len(path)-1] == jsonFieldsWildcard {
+		path = path[:len(path)-1]
+	}
+
+	node := n
+	for _, key := range path {
+		if node.all {
+			return
+		}
+		child, ok := node.children[key]
+		if !ok {
+			child = newJSONFieldsNode()
+			node.children[key] = child
+		}
+		node = child
+	}
+	node.all = true
+	node.children = nil
+}
+
+func (n *jsonFieldsNode) isEmpty() bool {
+	return !n.all && len(n.children) == 0
+}
+
+func (n *jsonFieldsNode) get(key string) *jsonFieldsNode {
+	if child, ok := n.children[strings.ToLower(key)]; ok {
+		return child
+	}
+	return n.children[jsonFieldsWildcard]
+}
+
+// newJSONFieldsSelector returns `nil` if no fields are selected:
+//   - fields are dot separated paths matched case insensitively; i/e: `L4.flags`, `tcp.flags` or `http.*`,
+//   - `*` matches any key; i/e: `HTTP.*.url`, paths apply to every item of arrays; i/e: `DNS.answers.name`,
+//   - fields prefixed with `-` are excluded; i/e: `-HTTP.headers`.
+func newJSONFieldsSelector(fields []string) *jsonFieldsSelector {
+	include := newJSONFieldsNode()
+	exclude := newJSONFieldsNode()
+
+	for _, field := range fields {
+		field = strings.ToLower(strings.TrimSpace(field))
+
+		node := include
+		if _field, ok := strings.CutPrefix(field, jsonFieldsExcludePrefix); ok {
+			node = exclude
+			field = _field
+		}
+		if field == "" {
+			continue
+		}
+
+		path := strings.Split(field, jsonFieldsSeparator)
+		if alias, ok := jsonFieldsAliases[path[0]]; ok {
+			path[0] = alias
+		}
+		node.add(path)
+	}
+
+	if include.isEmpty() && exclude.isEmpty() {
+		return nil
+	}
+
+	if !include.isEmpty() {
+		for _, key := range jsonFieldsRequired {
+			include.add([]string{key})
+		}
+	}
+
+	return &jsonFieldsSelector{include: include, exclude: exclude}
+}
+
+// NewJSONFieldsProjection shrinks JSON translations, as written by captures using the `json` format, to `fields`;
+// `fields` use the syntax of `ContextFields`, and it returns `nil` if none is selected.
+func NewJSONFieldsProjection(fields []string) func([]byte) ([]byte, error) {
+	selector := newJSONFieldsSelector(fields)
+	if selector == nil {
+		return nil
+	}
+	return func(data []byte) ([]byte, error) {
+		json, err := gabs.ParseJSON(data)
+		if err != nil {
+			return nil, err
+		}
+		projection := selector.apply(json).Bytes()
+		// translations are written 1 per line
+		if bytes.HasSuffix(data, []byte("\n")) {
+			projection = append(projection, '\n')
+		}
+		return projection, nil
+	}
+}
+
+// apply produces a new translation: the original one is never modified.
+func (s *jsonFieldsSelector) apply(json *gabs.Container) *gabs.Container {
+	translation, ok := json.Data().(map[string]any)
+	if !ok {
+		return json
+	}
+
+	if !s.include.isEmpty() {
+		translation = s.project(translation, s.include, true)
+	}
+	if !s.exclude.isEmpty() {
+		translation = s.project(translation, s.exclude, false)
+	}
+
+	return gabs.Wrap(translation)
+}
+
+// project copies the fields of `src` selected by `node` if `include` is set, or all other fields otherwise.
+func (s *jsonFieldsSelector) project(src map[string]any, node *jsonFieldsNode, include bool) map[string]any {
+	dst := make(map[string]any, len(src))
+
+	for key, value := range src {
+		if include && strings.HasPrefix(key, jsonFieldsLoggingPrefix) {
+			dst[key] = value
+			continue
+		}
+
+		child := node.get(key)
+
+		if child == nil {
+			if !include {
+				dst[key] = value
+			}
+			continue
+		}
+
+		if child.all {
+			if include {
+				dst[key] = value
+			}
+			continue
+		}
+
+		if value = s.projectValue(value, child, include); value != nil {
+			dst[key] = value
+		}
+	}
+
+	return dst
+}
+
+func (s *jsonFieldsSelector) projectValue(value any, node *jsonFieldsNode, include bool) any {
+	switch value := value.(type) {
+	case map[string]any:
+		if projection := s.project(value, node, include); !include || len(projection) > 0 {
+			return projection
+		}
+
+	case []any:
+		items := make([]any, 0, len(value))
+		for _, item := range value {
+			if item = s.projectValue(item, node, include); item != nil {
+				items = append(items, item)
+			}
+		}
+		if !include || len(items) > 0 {
+			return items
+		}
+
+	default:
+		// scalars cannot be partially selected
+		if !include {
+			return value
+		}
+	}
+
+	return nil
+}
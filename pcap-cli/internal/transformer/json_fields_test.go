@@ -0,0 +1,84 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"testing"
+
+	"github.com/Jeffail/gabs/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+const jsonFieldsTestTranslation = `{
+	"schemaVersion": "1.0.0",
+	"timestamp": {"seconds": 1, "nanos": 2},
+	"logging.googleapis.com/trace": "projects/p/traces/t",
+	"message": "summary",
+	"L3": {"src": "10.0.0.1", "dst": "10.0.0.2"},
+	"L4": {"src": 8080, "flags": {"str": "PSH|ACK", "dec": 24}, "seq": 1},
+	"HTTP": {"method": "GET", "headers": {"Cookie": ["a=b"]}},
+	"DNS": {"answers": [{"name": "a.example", "ttl": 60}, {"name": "b.example", "ttl": 60}]}
+}`
+
+// TestJSONFieldsSelector verifies that translations are shrunk to the selected fields.
+func TestJSONFieldsSelector(t *testing.T) {
+	t.Parallel()
+
+	assert.Nil(t, newJSONFieldsSelector(nil))
+	assert.Nil(t, newJSONFieldsSelector([]string{" ", "-"}))
+
+	tests := []struct {
+		name     string
+		fields   []string
+		expected string
+	}{
+		{
+			name:     "include",
+			fields:   []string{"tcp.flags", "ip.src", "http.*"},
+			expected: `{"HTTP":{"headers":{"Cookie":["a=b"]},"method":"GET"},"L3":{"src":"10.0.0.1"},"L4":{"flags":{"dec":24,"str":"PSH|ACK"}},"logging.googleapis.com/trace":"projects/p/traces/t","schemaVersion":"1.0.0","timestamp":{"nanos":2,"seconds":1}}`,
+		},
+		{
+			name:     "exclude",
+			fields:   []string{"-HTTP.headers", "-L3", "-DNS", "-tcp.flags.dec"},
+			expected: `{"HTTP":{"method":"GET"},"L4":{"flags":{"str":"PSH|ACK"},"seq":1,"src":8080},"logging.googleapis.com/trace":"projects/p/traces/t","message":"summary","schemaVersion":"1.0.0","timestamp":{"nanos":2,"seconds":1}}`,
+		},
+		{
+			name:     "include_and_exclude",
+			fields:   []string{"L4", "message", "-l4.flags"},
+			expected: `{"L4":{"seq":1,"src":8080},"logging.googleapis.com/trace":"projects/p/traces/t","message":"summary","schemaVersion":"1.0.0","timestamp":{"nanos":2,"seconds":1}}`,
+		},
+		{
+			name:     "arrays_and_wildcards",
+			fields:   []string{"DNS.answers.name", "*.src"},
+			expected: `{"DNS":{"answers":[{"name":"a.example"},{"name":"b.example"}]},"L3":{"src":"10.0.0.1"},"L4":{"src":8080},"logging.googleapis.com/trace":"projects/p/traces/t","schemaVersion":"1.0.0","timestamp":{"nanos":2,"seconds":1}}`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			translation, err := gabs.ParseJSON([]byte(jsonFieldsTestTranslation))
+			assert.NoError(t, err)
+			original := translation.String()
+
+			selector := newJSONFieldsSelector(tc.fields)
+			assert.NotNil(t, selector)
+			assert.JSONEq(t, tc.expected, selector.apply(translation).String())
+			// the original translation must not be modified
+			assert.Equal(t, original, translation.String())
+		})
+	}
+}
@@ -21,13 +21,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/binary"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"math"
 	"net"
 	"net/http"
 	"net/netip"
-	"os"
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -39,7 +39,6 @@ import (
 	"github.com/segmentio/fasthash/fnv1a"
 	"github.com/wissance/stringFormatter"
 	"golang.org/x/net/http2"
-	"golang.org/x/net/http2/hpack"
 
 	"github.com/alphadose/haxmap"
 	mapset "github.com/deckarep/golang-set/v2"
@@ -52,22 +51,64 @@ type (
 		ephemerals                *PcapEphemeralPorts
 		traceToHttpRequestMap     *haxmap.Map[string, *httpRequest]
 		flowToStreamToSequenceMap FTSTSM
+		sessions                  *httpSessionHasher
+		compactRetransmissions    bool
+		fields                    *jsonFieldsSelector
+		packets                   *packetIndex
+		anomalies                 *anomalyDetector
+		retries                   *httpRetryDetector
+		encoding                  *jsonEncoding
+		quic                      *quicConnectionIDs
+		// only available when connection phases are reported; i/e: by the OTLP translator
+		phases *connectionPhasesTracker
+		// attribute the connection setup latency to HTTP transactions; requires `phases`
+		connectionSetup bool
+		// only available when programs embedding pcap-cli subscribe to flow events
+		events *flowEvents
+		// how trace context is extracted, and which non HTTP protocols are trace-tracked
+		traces *TraceStrategy
+		// labels stamped onto records of packets matching label rules
+		labels *recordLabels
+		// only available if cache ports are configured
+		caches *cachePorts
+		// only available if database ports are configured
+		dbs *dbPorts
+		// only available if broker ports are configured
+		brokers *brokerPorts
+		// RTP endpoints announced by SIP, and counters of RTP streams
+		rtp *rtpTracker
+		// packet counters of IPsec and WireGuard tunnels
+		vpn *vpnTunnels
+		// only available when the engine tracks multicast groups
+		multicast *MulticastGroups
+		// only available when the engine summarizes the capture session
+		summary *CaptureSummary
+		// only available when the capture is scoped to traces of interest
+		scope *TraceScope
 	}
 )
 
 const (
-	jsonTranslationFlowTemplate     = "{0}/iface/{1}/flow/{2}:{3}"
-	jsonTranslationTemplate         = "#{serial} | @{ifaceIndex}/{ifaceName}"
-	jsonTranslationSummary          = jsonTranslationTemplate + " | flow:{flowID}"
-	jsonTranslationSummaryWithoutL4 = jsonTranslationSummary + " | {L3Src} > {L3Dst}"
-	jsonTranslationSummaryARP       = jsonTranslationSummary + " | ARP | {L3Src} > {L3Dst}"
-	jsonTranslationSummaryICMP      = jsonTranslationSummary + " | ICMPv{icmpVersion} | {L3Src} > {L3Dst} | {icmpMessage}"
-	jsonTranslationSummaryUDP       = jsonTranslationSummary + " | {L4Proto} | {srcProto}/{L3Src}:{L4Src} > {dstProto}/{L3Dst}:{L4Dst}"
-	jsonTranslationSummaryTCP       = jsonTranslationSummaryUDP + " | [{tcpFlags}] | len/seq/ack:{tcpLen}/{tcpSeq}/{tcpAck}"
+	jsonTranslationFlowTemplate       = "{0}/iface/{1}/flow/{2}:{3}"
+	jsonTranslationTemplate           = "#{serial} | @{ifaceIndex}/{ifaceName}"
+	jsonTranslationSummary            = jsonTranslationTemplate + " | flow:{flowID}"
+	jsonTranslationSummaryWithoutL4   = jsonTranslationSummary + " | {L3Src} > {L3Dst}"
+	jsonTranslationSummaryARP         = jsonTranslationSummary + " | ARP | {L3Src} > {L3Dst}"
+	jsonTranslationSummaryICMP        = jsonTranslationSummary + " | ICMPv{icmpVersion} | {L3Src} > {L3Dst} | {icmpMessage}"
+	jsonTranslationSummaryICMPWithRef = jsonTranslationSummaryICMP + " | ref #{icmpRef}"
+	jsonTranslationSummaryUDP         = jsonTranslationSummary + " | {L4Proto} | {srcProto}/{L3Src}:{L4Src} > {dstProto}/{L3Dst}:{L4Dst}"
+	jsonTranslationSummaryTCP         = jsonTranslationSummaryUDP + " | [{tcpFlags}] | len/seq/ack:{tcpLen}/{tcpSeq}/{tcpAck}"
+	jsonTranslationSummarySCTP        = jsonTranslationSummaryUDP + " | {sctpChunks} | vtag:{sctpTag}"
 )
 
+// top level keys available in compact translations of retransmissions
+var jsonTranslationCompactKeys = []string{
+	"schemaVersion", "pcap", "meta", "timestamp", "iface", "flow", "local",
+	"logging.googleapis.com/labels", "logging.googleapis.com/operation",
+}
+
 func init() {
-	translators.Store(JSON, newJSONPcapTranslator)
+	registerTranslator(JSON, newJSONPcapTranslator)
 }
 
 func (t *JSONPcapTranslator) translate(_ *gopacket.Packet) error {
@@ -77,9 +118,12 @@ func (t *JSONPcapTranslator) translate(_ *gopacket.Packet) error {
 func (t *JSONPcapTranslator) done(ctx context.Context) {
 	t.fm.MutexMap.ForEach(func(flowID uint64, lock *flowLockCarrier) bool {
 		if lock.mu.TryLock() {
-			t.fm.untrackConnection(ctx, &flowID, lock)
-			transformerLogger.Printf("[%d/%s] – untracked flow: %d\n", t.iface.Index, t.iface.Name, flowID)
+			t.fm.untrackConnection(ctx, &flowID, lock, flowSummaryCaptureEnd)
+			t.fm.logger().Debug("untracked flow", "flow", flowID)
 			lock.mu.Unlock()
+		} else {
+			// flows locked by translations which were not drained in time are still summarized
+			t.fm.summarize(&flowID, lock, flowSummaryCaptureEnd)
 		}
 		return true
 	})
@@ -100,6 +144,8 @@ func (t *JSONPcapTranslator) next(
 
 	json := gabs.New()
 
+	json.Set(jsonTranslationSchemaVersion, "schemaVersion")
+
 	id := ctx.Value(ContextID)
 	logName := ctx.Value(ContextLogName)
 
@@ -119,6 +165,10 @@ func (t *JSONPcapTranslator) next(
 	meta.Set(info.CaptureLength, "cap_len")
 	meta.Set(flowIDstr, "flow")
 	meta.Set(info.Timestamp.Format(time.RFC3339Nano), "timestamp")
+	// names of the payload rules matched by this packet; i/e: IDS-style alerts
+	if match := payloadMatchOf(*packet); match != nil {
+		meta.Set(match.rules, "matches")
+	}
 
 	timestamp, _ := json.Object("timestamp")
 	timestamp.Set(info.Timestamp.Unix(), "seconds")
@@ -142,6 +192,10 @@ func (t *JSONPcapTranslator) next(
 	labels.Set(id, "run.googleapis.com/pcap/id")
 	labels.Set(logName, "run.googleapis.com/pcap/name")
 	labels.Set(t.iface.Name, "run.googleapis.com/pcap/iface")
+	// labels allow Cloud Logging to route records, and to attribute them to tenants
+	t.labels.apply(*packet, func(key, value string) {
+		labels.Set(value, key)
+	})
 
 	return json
 }
@@ -205,6 +259,14 @@ func (t *JSONPcapTranslator) translateEthernetLayer(ctx context.Context, eth *la
 	L2.Set(eth.SrcMAC.String(), "src")
 	L2.Set(eth.DstMAC.String(), "dst")
 
+	for _, tag := range vlanTags(eth) {
+		vlanJSON := gabs.New()
+		vlanJSON.Set(tag.id, "id")
+		vlanJSON.Set(tag.priority, "pcp")
+		vlanJSON.Set(tag.dei, "dei")
+		L2.ArrayAppend(vlanJSON.Data(), "vlan")
+	}
+
 	return json
 }
 
@@ -456,6 +518,11 @@ func (t *JSONPcapTranslator) translateICMPv6L3HeaderLayer(
 
 	_json, ICMP6 := t.asICMPv6(ctx, json)
 
+	// the 1st 4 bytes are either unused, the MTU or the pointer
+	if len(icmp6.LayerPayload()) < 4+ipv6HeaderSize {
+		return _json
+	}
+
 	IPv6, _ := ICMP6.Object("IPv6")
 
 	ipHeader := icmp6.LayerPayload()[4:]
@@ -548,6 +615,67 @@ func (t *JSONPcapTranslator) translateUDPLayer(ctx context.Context, udp *layers.
 	return json
 }
 
+func (t *JSONPcapTranslator) translateSCTPLayer(ctx context.Context, sctp *layers.SCTP) fmt.Stringer {
+	json := gabs.New()
+
+	// https://github.com/google/gopacket/blob/master/layers/sctp.go#L19-L25
+
+	L4, _ := json.Object("L4")
+
+	transportFlow := sctp.TransportFlow()
+	t.addEndpoints(L4, &transportFlow)
+
+	L4.Set(len(sctp.Payload), "size")
+
+	L4.Set(sctp.Checksum, "xsum")
+	// associations are identified by the verification tag chosen by each endpoint
+	L4.Set(sctp.VerificationTag, "vtag")
+
+	L4.Set(sctp.SrcPort, "src")
+	if name, ok := layers.SCTPPortNames[sctp.SrcPort]; ok {
+		L4.Set(name, "sproto")
+	}
+
+	L4.Set(sctp.DstPort, "dst")
+	if name, ok := layers.SCTPPortNames[sctp.DstPort]; ok {
+		L4.Set(name, "dproto")
+	}
+
+	chunks := parseSCTPChunks(sctp.Payload)
+	chunksJSON, _ := L4.ArrayOfSize(len(chunks), "chunks")
+	for i, chunk := range chunks {
+		chunkJSON, _ := chunksJSON.ObjectI(i)
+		chunkJSON.Set(chunk.name(), "type")
+		chunkJSON.Set(chunk.flags, "flags")
+		chunkJSON.Set(chunk.length, "len")
+		switch chunk.kind {
+		case sctpChunkData:
+			chunkJSON.Set(chunk.tsn, "tsn")
+			chunkJSON.Set(chunk.stream, "stream")
+			chunkJSON.Set(chunk.ssn, "ssn")
+			chunkJSON.Set(chunk.ppid, "ppid")
+		case sctpChunkInit, sctpChunkInitAck:
+			chunkJSON.Set(chunk.initiateTag, "itag")
+			chunkJSON.Set(chunk.outbound, "os")
+			chunkJSON.Set(chunk.inbound, "is")
+			chunkJSON.Set(chunk.tsn, "tsn")
+		case sctpChunkSack:
+			chunkJSON.Set(chunk.tsn, "ack")
+		}
+	}
+	kinds, streams := sctpChunksSummary(chunks)
+	L4.Set(kinds, "types")
+	L4.Set(streams, "streams")
+
+	// SCTP(132) (0x84) | `SrcPort` and `DstPort` are `uint16`:
+	//   - verification tags are not used as each endpoint of the association chooses its own
+	flowID := fnv1a.HashUint64(uint64(132) + uint64(sctp.SrcPort) + uint64(sctp.DstPort))
+	flowIDstr := strconv.FormatUint(flowID, 10)
+	L4.Set(flowIDstr, "flow")
+
+	return json
+}
+
 func (t *JSONPcapTranslator) addTCPWindowScale(
 	tcp *layers.TCP,
 	optKey, optHexVal *string,
@@ -715,6 +843,128 @@ func (t *JSONPcapTranslator) translateTLSLayer(ctx context.Context, tls *layers.
 	return json
 }
 
+func (t *JSONPcapTranslator) translateDHCPv4Layer(ctx context.Context, dhcp *layers.DHCPv4) fmt.Stringer {
+	json := gabs.New()
+
+	DHCP, _ := json.Object("DHCP")
+	DHCP.Set(4, "version")
+	DHCP.Set(dhcp.Operation.String(), "op")
+	DHCP.Set(dhcpv4MessageType(dhcp), "message_type")
+	DHCP.Set(dhcp.Xid, "xid")
+	DHCP.Set(dhcp.ClientHWAddr.String(), "client_mac")
+
+	// unspecified addresses are `0.0.0.0`, so they are omitted
+	for name, ip := range map[string]net.IP{
+		"client_ip":    dhcp.ClientIP,
+		"assigned_ip":  dhcp.YourClientIP,
+		"server_ip":    dhcp.NextServerIP,
+		"relay_ip":     dhcp.RelayAgentIP,
+		"requested_ip": dhcpv4IPOption(dhcp, layers.DHCPOptRequestIP),
+		"server_id":    dhcpv4IPOption(dhcp, layers.DHCPOptServerID),
+	} {
+		if ip != nil && !ip.IsUnspecified() {
+			DHCP.Set(ip.String(), name)
+		}
+	}
+
+	t.addDHCPOptions(DHCP, dhcpv4Options(dhcp))
+
+	return json
+}
+
+func (t *JSONPcapTranslator) translateDHCPv6Layer(ctx context.Context, dhcp *layers.DHCPv6) fmt.Stringer {
+	json := gabs.New()
+
+	DHCP, _ := json.Object("DHCP")
+	DHCP.Set(6, "version")
+	DHCP.Set(dhcp.MsgType.String(), "message_type")
+	DHCP.Set(dhcpv6TransactionID(dhcp), "xid")
+
+	// relay messages do not carry a transaction ID, but link and peer addresses
+	if dhcp.MsgType == layers.DHCPv6MsgTypeRelayForward || dhcp.MsgType == layers.DHCPv6MsgTypeRelayReply {
+		DHCP.Set(dhcp.LinkAddr.String(), "relay_ip")
+		DHCP.Set(dhcp.PeerAddr.String(), "client_ip")
+	}
+
+	addresses := dhcpv6Addresses(dhcp)
+	addressesJSON, _ := DHCP.ArrayOfSize(len(addresses), "addresses")
+	for i, address := range addresses {
+		addressesJSON.SetIndex(address.String(), i)
+	}
+
+	t.addDHCPOptions(DHCP, dhcpv6Options(dhcp))
+
+	return json
+}
+
+func (t *JSONPcapTranslator) translateSIPLayer(ctx context.Context, sip *layers.SIP) fmt.Stringer {
+	json := gabs.New()
+
+	SIP, _ := json.Object("SIP")
+	SIP.Set(sip.Version.String(), "version")
+
+	sequence, method := sipCSeq(sip)
+	if sip.IsResponse {
+		SIP.Set(sip.ResponseCode, "code")
+		SIP.Set(sip.ResponseStatus, "status")
+	} else {
+		method = sip.Method.String()
+		SIP.Set(sip.RequestURI, "uri")
+	}
+	SIP.Set(method, "method")
+	SIP.Set(sip.GetCallID(), "call_id")
+	SIP.Set(sequence, "cseq")
+
+	if userAgent := sip.GetUserAgent(); userAgent != "" {
+		SIP.Set(userAgent, "user_agent")
+	}
+
+	// `From` and `To` are not included: they usually carry phone numbers
+	endpoints := parseSDP(sip.Payload())
+	if len(endpoints) > 0 {
+		media, _ := SIP.ArrayOfSize(len(endpoints), "media")
+		for i, endpoint := range sortedEndpoints(endpoints) {
+			o, _ := media.ObjectI(i)
+			o.Set(endpoints[endpoint].kind, "kind")
+			o.Set(endpoint, "endpoint")
+		}
+		t.rtp.announce(endpoints)
+	}
+
+	return json
+}
+
+func (t *JSONPcapTranslator) translateNTPLayer(ctx context.Context, ntp *layers.NTP) fmt.Stringer {
+	json := gabs.New()
+
+	NTP, _ := json.Object("ntp")
+	NTP.Set(uint8(ntp.Version), "version")
+	NTP.Set(ntpMode(ntp), "mode")
+	NTP.Set(uint8(ntp.Stratum), "stratum")
+	NTP.Set(ntpReferenceID(ntp), "refid")
+
+	for name, timestamp := range map[string]layers.NTPTimestamp{
+		"origin":   ntp.OriginTimestamp,
+		"receive":  ntp.ReceiveTimestamp,
+		"transmit": ntp.TransmitTimestamp,
+	} {
+		if timestamp != 0 {
+			NTP.Set(ntpTime(timestamp).Format(time.RFC3339Nano), name)
+		}
+	}
+
+	return json
+}
+
+func (t *JSONPcapTranslator) addDHCPOptions(DHCP *gabs.Container, options []*dhcpOption) {
+	optionsJSON, _ := DHCP.ArrayOfSize(len(options), "options")
+	for i, option := range options {
+		o, _ := optionsJSON.ObjectI(i)
+		o.Set(option.name, "type")
+		o.Set(option.value, "value")
+	}
+}
+
 func (t *JSONPcapTranslator) translateDNSLayer(ctx context.Context, dns *layers.DNS) fmt.Stringer {
 	json := gabs.New()
 
@@ -839,10 +1089,30 @@ func (t *JSONPcapTranslator) merge(ctx context.Context, tgt fmt.Stringer, src fm
 	return tgt, t.asTranslation(tgt).Merge(t.asTranslation(src))
 }
 
-// for JSON translator, this mmethod generates:
+// for JSON translator, this method produces the complete translation,
+// and then shrinks it to the selected fields; if any.
+func (t *JSONPcapTranslator) finalize(
+	ctx context.Context,
+	ifaces netIfaceIndex,
+	iface *PcapIface,
+	serial *uint64,
+	p *gopacket.Packet,
+	conntrack bool,
+	packet fmt.Stringer,
+) (fmt.Stringer, error) {
+	translation, err := t.finalizeJSON(ctx, ifaces, iface, serial, p, conntrack, packet)
+	if t.fields == nil || translation == nil {
+		return translation, err
+	}
+	return t.fields.apply(t.asTranslation(translation)), err
+}
+
+// finalizeJSON generates:
 //   - the `flowID` for any 6-tuple conversation
 //   - the summary line at {`message`: $summary}
-func (t *JSONPcapTranslator) finalize(
+//
+// formats relying on JSON translations must use this method, as fields selection only applies to the `json` format.
+func (t *JSONPcapTranslator) finalizeJSON(
 	ctx context.Context,
 	ifaces netIfaceIndex,
 	iface *PcapIface,
@@ -915,14 +1185,23 @@ func (t *JSONPcapTranslator) finalize(
 	data["L3Src"] = l3Src
 	data["L3Dst"] = l3Dst
 
+	if fragments := ipv4FragmentsOf(*p); fragments > 0 {
+		json.Set(true, "L3", "fragmented")
+		json.Set(fragments, "L3", "fragments")
+	}
+
 	// report complete interface details when capturing for `any` interface
 	t.checkL3Address(ctx, json, data, ifaces, iface, l3Src, l3Dst)
 
 	isSrcLocal := iface.Addrs.Contains(l3Src.String())
 
+	// ICMP errors may reference this packet
+	t.packets.add(*p, *serial)
+
 	proto := json.S("L3", "proto", "num").Data().(layers.IPProtocol)
 	isTCP := proto == layers.IPProtocolTCP
 	isUDP := proto == layers.IPProtocolUDP
+	isSCTP := proto == layers.IPProtocolSCTP
 	isICMPv4 := proto == layers.IPProtocolICMPv4
 	isICMPv6 := proto == layers.IPProtocolICMPv6
 
@@ -946,7 +1225,7 @@ func (t *JSONPcapTranslator) finalize(
 	data["flowID"] = flowIDstr
 	json.Set(flowIDstr, "flow")
 
-	if !isTCP && !isUDP {
+	if !isTCP && !isUDP && !isSCTP {
 		if isICMPv4 || isICMPv6 {
 			if isICMPv6 {
 				data["icmpVersion"] = 6
@@ -956,14 +1235,33 @@ func (t *JSONPcapTranslator) finalize(
 			data["icmpMessage"] = json.S("ICMP", "msg").Data().(string)
 
 			operation.Set(stringFormatter.Format(jsonTranslationFlowTemplate, id, t.iface.Name, "icmp", flowIDstr), "id")
-			json.Set(stringFormatter.FormatComplex(jsonTranslationSummaryICMP, data), "message")
+
+			var message string
+			// allow to join ICMP errors with the translation of the packet that caused them
+			if original, ok := t.packets.lookupICMP(*p); ok {
+				data["icmpRef"] = strconv.FormatUint(original, 10)
+				json.Set(data["icmpRef"], "ICMP", "ref")
+				message = stringFormatter.FormatComplex(jsonTranslationSummaryICMPWithRef, data)
+			} else {
+				message = stringFormatter.FormatComplex(jsonTranslationSummaryICMP, data)
+				t.addMulticast(json, &message, *p, l3Src)
+			}
+			t.addICMPError(json, &message, *p, *serial)
+			json.Set(message, "message")
 
 			return json, nil
 		}
 
 		// unhandled L3 protocol
 		operation.Set(stringFormatter.Format(jsonTranslationFlowTemplate, id, t.iface.Name, "l3", flowIDstr), "id")
-		json.Set(stringFormatter.FormatComplex(jsonTranslationSummaryWithoutL4, data), "message")
+		message := stringFormatter.FormatComplex(jsonTranslationSummaryWithoutL4, data)
+		if vpn := t.vpn.parseIPSec(*p, flowID); vpn != nil {
+			t.addVPN(json, &message, vpn)
+		} else {
+			// MLD messages carry a Hop-by-Hop Options header, so they are not handled as ICMPv6
+			t.addMulticast(json, &message, *p, l3Src)
+		}
+		json.Set(message, "message")
 
 		return json, nil
 	}
@@ -974,6 +1272,34 @@ func (t *JSONPcapTranslator) finalize(
 	l4DstProto, _ := json.S("L4", "dproto").Data().(string)
 	data["dstProto"] = l4DstProto
 
+	if isSCTP {
+		data["L4Proto"] = "SCTP"
+		srcPort, _ := json.S("L4", "src").Data().(layers.SCTPPort)
+		data["L4Src"] = uint16(srcPort)
+		dstPort, _ := json.S("L4", "dst").Data().(layers.SCTPPort)
+		data["L4Dst"] = uint16(dstPort)
+		data["sctpTag"] = json.S("L4", "vtag").Data()
+		data["sctpChunks"] = json.S("L4", "types").Data()
+
+		json.Set(isSrcLocal, "local")
+
+		operation.Set(stringFormatter.Format(jsonTranslationFlowTemplate, id, t.iface.Name, "sctp", flowIDstr), "id")
+		message := stringFormatter.FormatComplex(jsonTranslationSummarySCTP, data)
+		if streams, ok := json.S("L4", "streams").Data().([]uint16); ok && len(streams) > 0 {
+			message = stringFormatter.Format("{0} | streams:{1}", message, streams)
+		}
+
+		// associations are conntracked through the flow mutex, the same as TCP connections
+		lock, setFlags := t.lockSCTPAssociation(ctx, p, serial, &flowID, isSrcLocal)
+		if icmpError := lock.ICMPError(); icmpError != nil {
+			t.addFlowICMPError(json, &message, icmpError)
+		}
+		lock.UnlockWithTCPFlags(ctx, &setFlags)
+
+		json.Set(message, "message")
+		return json, nil
+	}
+
 	if isUDP {
 		data["L4Proto"] = "UDP"
 		srcPort, _ := json.S("L4", "src").Data().(layers.UDPPort)
@@ -981,11 +1307,46 @@ func (t *JSONPcapTranslator) finalize(
 		dstPort, _ := json.S("L4", "dst").Data().(layers.UDPPort)
 		data["L4Dst"] = uint16(dstPort)
 
-		isSrcLocal = isSrcLocal && !t.ephemerals.isEphemeralUDPPort(&srcPort)
+		isSrcLocal = isSrcLocal && !t.ephemerals.isEphemeralUDPPort(l3Src, &srcPort)
 		json.Set(isSrcLocal, "local")
 
 		operation.Set(stringFormatter.Format(jsonTranslationFlowTemplate, id, t.iface.Name, "udp", flowIDstr), "id")
-		json.Set(stringFormatter.FormatComplex(jsonTranslationSummaryUDP, data), "message")
+		message := stringFormatter.FormatComplex(jsonTranslationSummaryUDP, data)
+		if dns, ok := (*p).Layer(layers.LayerTypeDNS).(*layers.DNS); ok && t.phases != nil {
+			t.observeDNS(dns, (*p).Metadata().Timestamp,
+				net.JoinHostPort(l3Src.String(), strconv.FormatUint(uint64(srcPort), 10)),
+				net.JoinHostPort(l3Dst.String(), strconv.FormatUint(uint64(dstPort), 10)))
+		}
+		if messageType, ok := json.S("DHCP", "message_type").Data().(string); ok {
+			message = stringFormatter.Format("{0} | DHCPv{1} {2}", message, json.S("DHCP", "version").Data(), messageType)
+		}
+		if json.Exists("SIP") {
+			t.addSIPSummary(json, &message)
+		}
+		if ntp, ok := (*p).Layer(layers.LayerTypeNTP).(*layers.NTP); ok {
+			t.addNTPSummary(json, &message, ntp, (*p).Metadata().Timestamp)
+		}
+		if transportLayer := (*p).TransportLayer(); transportLayer != nil {
+			// QUIC is commonly used on port 443; i/e: HTTP/3
+			isQUICPort := srcPort == 443 || dstPort == 443
+			if quic := t.quic.parseQUIC(transportLayer.LayerPayload(),
+				net.JoinHostPort(l3Src.String(), strconv.FormatUint(uint64(srcPort), 10)),
+				net.JoinHostPort(l3Dst.String(), strconv.FormatUint(uint64(dstPort), 10)),
+				isQUICPort); quic != nil {
+				t.addQUIC(json, &message, quic)
+			} else if media, ok := t.rtp.lookup(
+				net.JoinHostPort(l3Src.String(), strconv.FormatUint(uint64(srcPort), 10)),
+				net.JoinHostPort(l3Dst.String(), strconv.FormatUint(uint64(dstPort), 10))); ok {
+				if header, ok := parseRTP(transportLayer.LayerPayload()); ok {
+					stats := t.rtp.observe(flowID, header, (*p).Metadata().Timestamp, media.clockRate(header.payloadType))
+					t.addRTP(json, &message, header, stats)
+				}
+			} else if vpn := t.vpn.parseUDP(transportLayer.LayerPayload(),
+				uint16(srcPort), uint16(dstPort), flowID); vpn != nil {
+				t.addVPN(json, &message, vpn)
+			}
+		}
+		json.Set(message, "message")
 		return json, nil
 	}
 
@@ -1012,7 +1373,7 @@ func (t *JSONPcapTranslator) finalize(
 	// local means: a service running within the sandbox
 	//   - so it is not a client which created a socket to communicate with a remote host using an ephemeral port
 	// this approach is best effort as a client may use a `not ephemeral port` to create a socket for egress networking.
-	isSrcLocal = isSrcLocal && !t.ephemerals.isEphemeralTCPPort(&srcPort)
+	isSrcLocal = isSrcLocal && !t.ephemerals.isEphemeralTCPPort(l3Src, &srcPort)
 	json.Set(isSrcLocal, "local")
 
 	// `finalize` is invoked from a `worker` via a go-routine `pool`:
@@ -1021,12 +1382,79 @@ func (t *JSONPcapTranslator) finalize(
 	// minimize locking: lock per-flow instead of across-flows.
 	// Locking is done in the name of throubleshoot-ability, so some contention at the flow level should be acceptable...
 	lock, traceAndSpanProvider := t.fm.lock(ctx, serial, &flowID, &setFlags, &seq, &ack, isSrcLocal)
+	lock.Summary().observe(p, *serial, flowID, setFlags&tcpSyn != 0, setFlags&tcpAck != 0)
+
+	if t.anomalies != nil && setFlags == tcpSyn {
+		t.addAnomaly(json, t.anomalies.observeConnection(
+			anomalyDestination(l3Dst, uint16(dstPort)), (*p).Metadata().Timestamp))
+	}
+
+	// pure retransmissions of data segments already seen in this flow are not fully translated
+	if (t.compactRetransmissions || t.anomalies != nil) && (tcpSyn|tcpFin|tcpRst)&setFlags == 0 {
+		if length, err := strconv.ParseUint(tcpLen, 10, 32); err == nil && length > 0 {
+			// segments are tracked by the TCP analysis, which observes packets in capture order
+			analysis := tcpAnalysisOf(*p)
+			if t.anomalies != nil {
+				t.addAnomaly(json, t.anomalies.observeSegment(
+					anomalyDestination(l3Dst, uint16(dstPort)), (*p).Metadata().Timestamp, analysis.isRetransmission()))
+			}
+			if analysis.isRetransmission() && analysis.retransmissionOf > 0 && t.compactRetransmissions {
+				_, lockLatency := lock.UnlockWithTCPFlags(ctx, &setFlags)
+				return t.compactRetransmission(json, &message, analysis.retransmissionOf, lockLatency), nil
+			}
+		}
+	}
+
+	// traffic behind proxies/load balancers:
+	//   - annotate all packets in this flow with the real client address
+	if proxyProtocol := lock.ProxyProtocol(); proxyProtocol != nil {
+		t.addProxyProtocol(json, &message, proxyProtocol)
+	}
+
+	// path MTU issues: annotate all packets in this flow with the most recent ICMP error that referenced it
+	if icmpError := lock.ICMPError(); icmpError != nil {
+		t.addFlowICMPError(json, &message, icmpError)
+	}
 
 	if conntrack {
-		t.analyzeConnection(p, &flowID, &setFlags, json)
+		t.analyzeConnection(p, &flowID, &setFlags, json, &message)
+	}
+
+	rtt := tcpRTTOf(*p)
+	if rtt != nil {
+		t.addRTT(json, rtt)
 	}
 
 	appLayer := (*p).ApplicationLayer()
+
+	if t.phases != nil {
+		if setFlags == tcpSyn {
+			t.phases.observeConnection(flowID, (*p).Metadata().Timestamp)
+		} else if setFlags == tcpSynAck {
+			t.phases.observeEstablished(flowID, (*p).Metadata().Timestamp)
+		} else if appLayer != nil {
+			t.phases.observeTLS(flowID,
+				net.JoinHostPort(l3Src.String(), strconv.FormatUint(uint64(srcPort), 10)),
+				appLayer.LayerContents(), (*p).Metadata().Timestamp)
+		}
+	}
+
+	if t.events != nil {
+		if setFlags == tcpSyn {
+			t.events.flowStart(newFlowEvent(p, *serial, flowID))
+		} else if setFlags&(tcpFin|tcpRst) != 0 {
+			t.events.flowEnd(newFlowEvent(p, *serial, flowID), setFlags&tcpRst != 0, rtt, tcpStalledOf(*p))
+		}
+		if analysis := tcpAnalysisOf(*p); analysis != nil && analysis.stall > 0 {
+			t.events.stall(&FlowStallEvent{
+				FlowEvent: newFlowEvent(p, *serial, flowID),
+				StalledBy: analysis.stalledBy,
+				Duration:  analysis.stall,
+				Ended:     analysis.stallEnded,
+			})
+		}
+	}
+
 	if ((tcpSyn|tcpFin|tcpRst)&setFlags == 0) && appLayer != nil {
 		return t.addAppLayerData(ctx, p, lock, &flowID, &setFlags, &seq, &appLayer, json, &message, traceAndSpanProvider)
 	}
@@ -1049,6 +1477,63 @@ func (t *JSONPcapTranslator) finalize(
 	return json, nil
 }
 
+// compactRetransmission produces a translation which only contains packet metadata, the flow and TCP details,
+// and a reference to the translation of the packet that carried the original segment.
+func (t *JSONPcapTranslator) compactRetransmission(
+	json *gabs.Container,
+	message *string,
+	original uint64,
+	lockLatency *time.Duration,
+) *gabs.Container {
+	compact := gabs.New()
+
+	for _, key := range jsonTranslationCompactKeys {
+		if value := json.S(key); value != nil {
+			compact.Set(value.Data(), key)
+		}
+	}
+
+	L3, _ := compact.Object("L3")
+	L3.Set(json.S("L3", "src").Data(), "src")
+	L3.Set(json.S("L3", "dst").Data(), "dst")
+	L3.Set(json.S("L3", "proto").Data(), "proto")
+
+	L4, _ := compact.Object("L4")
+	for _, key := range []string{"src", "dst", "seq", "ack", "len", "flags"} {
+		L4.Set(json.S("L4", key).Data(), key)
+	}
+
+	originalStr := strconv.FormatUint(original, 10)
+	compact.Set(originalStr, "retransmission", "of")
+	compact.Set(stringFormatter.Format("{0} | retransmission of #{1}", *message, originalStr), "message")
+	compact.Set(lockLatency.String(), "ll")
+
+	if anomaly := json.S("anomaly"); anomaly != nil {
+		compact.Set(anomaly.Data(), "anomaly")
+	}
+
+	return compact
+}
+
+// addAnomaly records `anomaly` at {`anomaly`: {$metric: {...}}}, and keeps the highest score at {`anomaly`: {`score`: $score}}.
+func (t *JSONPcapTranslator) addAnomaly(json *gabs.Container, anomaly *anomaly) {
+	if anomaly == nil {
+		return
+	}
+
+	t.summary.observeAnomaly()
+
+	score := math.Round(anomaly.score*100) / 100
+	if current, ok := json.S("anomaly", "score").Data().(float64); !ok || math.Abs(score) > math.Abs(current) {
+		json.Set(score, "anomaly", "score")
+	}
+
+	metric, _ := json.Object("anomaly", string(anomaly.metric))
+	metric.Set(anomaly.value, "value")
+	metric.Set(anomaly.baseline, "baseline")
+	metric.Set(score, "score")
+}
+
 func (t *JSONPcapTranslator) checkL3Address(
 	ctx context.Context,
 	json *gabs.Container,
@@ -1090,13 +1575,103 @@ func (t *JSONPcapTranslator) checkL3Address(
 	}
 }
 
+// analyzeConnection adds the state of the connection, and the `L4.analysis` node to segments flagged by the TCP analysis
+// done in capture order: retransmissions, fast retransmissions, out-of-order segments, lost segments, keep-alives and duplicate ACKs.
+// lockSCTPAssociation acquires the flow lock of an SCTP association; the returned flags must be used to unlock it.
+func (t *JSONPcapTranslator) lockSCTPAssociation(
+	ctx context.Context,
+	p *gopacket.Packet,
+	serial, flowID *uint64,
+	local bool,
+) (*flowLock, uint8) {
+	var setFlags uint8 = tcpAck
+	if sctp, ok := (*p).Layer(layers.LayerTypeSCTP).(*layers.SCTP); ok {
+		setFlags = sctpFlowFlags(parseSCTPChunks(sctp.Payload))
+	}
+	// SCTP has no connection wide sequence numbers: TSNs are only carried by some chunks
+	var seq, ack uint32 = 0, 0
+	lock, _ := t.fm.lock(ctx, serial, flowID, &setFlags, &seq, &ack, local)
+	lock.Summary().observe(p, *serial, *flowID, setFlags&tcpSyn != 0, setFlags&tcpAck != 0)
+	return lock, setFlags
+}
+
 func (t *JSONPcapTranslator) analyzeConnection(
-	_ *gopacket.Packet,
+	p *gopacket.Packet,
 	_ *uint64, /* flowID */
 	_ *uint8, /* TCP flags */
-	_ *gabs.Container, /* JSON object */
+	json *gabs.Container, /* JSON object */
+	message *string,
 ) {
-	// implement connection tracking
+	if transition := tcpStateOf(*p); transition != nil {
+		json.Set(transition.to.String(), "L4", "state")
+		if transition.from != transition.to {
+			json.Set(transition.from.String(), "L4", "transition", "from")
+			json.Set(transition.to.String(), "L4", "transition", "to")
+		}
+	}
+
+	analysis := tcpAnalysisOf(*p)
+	if analysis == nil {
+		return
+	}
+
+	analysisJSON, _ := json.Object("L4", "analysis")
+	if analysis.retransmission {
+		analysisJSON.Set(true, "retransmission")
+	}
+	if analysis.fastRetransmission {
+		analysisJSON.Set(true, "fast_retransmission")
+	}
+	if analysis.outOfOrder {
+		analysisJSON.Set(true, "out_of_order")
+	}
+	if analysis.lostSegment {
+		analysisJSON.Set(true, "lost_segment")
+	}
+	if analysis.keepAlive {
+		analysisJSON.Set(true, "keep_alive")
+	}
+	if analysis.zeroWindow {
+		analysisJSON.Set(true, "zero_window")
+	}
+	if analysis.windowFull {
+		analysisJSON.Set(true, "window_full")
+	}
+	if analysis.dupACK > 0 {
+		analysisJSON.Set(analysis.dupACK, "duplicate_ack_num")
+		analysisJSON.Set(strconv.FormatUint(analysis.dupACKOf, 10), "duplicate_ack_frame")
+	}
+	if analysis.stall > 0 {
+		analysisJSON.Set(durationMillis(analysis.stall), "stall", "duration_ms")
+		analysisJSON.Set(analysis.stallEnded, "stall", "ended")
+		analysisJSON.Set(analysis.stalledBy.String(), "stall", "by")
+	}
+
+	str := analysis.String()
+	analysisJSON.Set(str, "str")
+	*message = stringFormatter.Format("{0} | [{1}]", *message, str)
+}
+
+// addRTT adds the RTT estimated for the connection so far: the handshake RTT is only known if the handshake was captured.
+func (t *JSONPcapTranslator) addRTT(json *gabs.Container, rtt *tcpRTTEstimate) {
+	json.Set(durationMillis(rtt.smoothed), "L4", "rtt_ms")
+	if rtt.handshake > 0 {
+		json.Set(durationMillis(rtt.handshake), "L4", "handshake_rtt_ms")
+	}
+}
+
+func (t *JSONPcapTranslator) addReassembly(json *gabs.Container, reassembly *tcpReassembly) {
+	L4Reassembly, _ := json.Object("L4", "reassembly")
+	if reassembly.data != nil {
+		L4Reassembly.Set(reassembly.segments, "segments")
+		L4Reassembly.Set(len(reassembly.data), "length")
+	}
+	if reassembly.pending {
+		L4Reassembly.Set(true, "pending")
+	}
+	if reassembly.retransmission {
+		L4Reassembly.Set(true, "retransmission")
+	}
 }
 
 func (t *JSONPcapTranslator) addAppLayerData(
@@ -1120,13 +1695,101 @@ func (t *JSONPcapTranslator) addAppLayerData(
 		return json, errors.New("AppLayer is empty")
 	}
 
+	seq := *sequence
+	// messages spanning multiple segments are decoded along with the segment carrying their last byte
+	if reassembly := tcpReassemblyOf(*packet); reassembly != nil {
+		t.addReassembly(json, reassembly)
+		if reassembly.data == nil {
+			json.Set(stringFormatter.Format("{0} | [TCP segment of a reassembled PDU]", *message), "message")
+			_, lockLatency := lock.UnlockWithTCPFlags(ctx, tcpFlags)
+			json.Set(lockLatency.String(), "ll")
+			return json, nil
+		}
+		appLayerData = reassembly.data
+		seq = reassembly.seq
+	}
+
+	// PROXY protocol header is sent by the proxy ahead of any data sent by the client
+	if proxyProtocol, size := lock.InspectProxyProtocol(seq, appLayerData); proxyProtocol != nil {
+		t.addProxyProtocol(json, message, proxyProtocol)
+		// continue analyzing data sent by the client
+		appLayerData = appLayerData[size:]
+	}
+
+	if len(appLayerData) == 0 {
+		json.Set(*message, "message")
+		_, lockLatency := lock.UnlockWithTCPFlags(ctx, tcpFlags)
+		json.Set(lockLatency.String(), "ll")
+		return json, nil
+	}
+
+	// upgraded connections do not carry HTTP messages anymore
+	if webSocket := lock.WebSocket(); webSocket != nil {
+		t.addWebSocket(packet, webSocket, appLayerData, json, message)
+		_, lockLatency := lock.UnlockWithTCPFlags(ctx, tcpFlags)
+		json.Set(lockLatency.String(), "ll")
+		return json, nil
+	}
+
+	// cache protocols are only decoded for configured ports: they are not self-describing
+	if t.caches != nil {
+		if tcp, ok := (*packet).TransportLayer().(*layers.TCP); ok {
+			if protocol, isCommand, ok := t.caches.lookup(uint16(tcp.SrcPort), uint16(tcp.DstPort)); ok {
+				t.addCache(packet, lock.CacheFlow(), protocol, isCommand, appLayerData, json, message)
+				_, lockLatency := lock.UnlockWithTCPFlags(ctx, tcpFlags)
+				json.Set(lockLatency.String(), "ll")
+				return json, nil
+			}
+		}
+	}
+
+	// database protocols are only decoded for configured ports: startup messages are not self-describing
+	if t.dbs != nil {
+		if tcp, ok := (*packet).TransportLayer().(*layers.TCP); ok {
+			if protocol, fromClient, ok := t.dbs.lookup(uint16(tcp.SrcPort), uint16(tcp.DstPort)); ok {
+				t.addDB(protocol, fromClient, appLayerData, json, message)
+				_, lockLatency := lock.UnlockWithTCPFlags(ctx, tcpFlags)
+				json.Set(lockLatency.String(), "ll")
+				return json, nil
+			}
+		}
+	}
+
+	// message broker protocols are only decoded for configured ports: frames are not self-describing
+	if t.brokers != nil {
+		if tcp, ok := (*packet).TransportLayer().(*layers.TCP); ok {
+			if protocol, fromClient, ok := t.brokers.lookup(uint16(tcp.SrcPort), uint16(tcp.DstPort)); ok {
+				t.addBroker(packet, lock.BrokerFlow(), protocol, fromClient, appLayerData, json, message)
+				_, lockLatency := lock.UnlockWithTCPFlags(ctx, tcpFlags)
+				json.Set(lockLatency.String(), "ll")
+				return json, nil
+			}
+		}
+	}
+
+	// mail protocols are decoded on well-known ports; message bodies are never translated
+	if tcp, ok := (*packet).TransportLayer().(*layers.TCP); ok {
+		if protocol, fromClient, ok := mailLookup(uint16(tcp.SrcPort), uint16(tcp.DstPort)); ok {
+			t.addMail(lock.MailFlow(), protocol, fromClient, appLayerData, json, message)
+			_, lockLatency := lock.UnlockWithTCPFlags(ctx, tcpFlags)
+			json.Set(lockLatency.String(), "ll")
+			return json, nil
+		}
+	}
+
+	if L7, handled := t.trySetFlowStrategy(ctx, packet, lock, flowID,
+		tcpFlags, appLayerData, json, message, tsp); handled {
+		L7.Set(sizeOfAppLayerData, "size")
+		return json, nil
+	}
+
 	if L7, handled, isHTTP2 := t.trySetHTTP(ctx, packet, lock, flowID,
 		tcpFlags, sequence, appLayerData, json, message, tsp); handled {
 		// this `size` is not the same as `length`:
 		//   - `size` includes everything, not only the HTTP `payload`
 		L7.Set(sizeOfAppLayerData, "size")
 		// HTTP/2.0 is binary so not showing it raw
-		if !isHTTP2 && sizeOfAppLayerData > 512 {
+		if !isHTTP2 && len(appLayerData) > 512 {
 			L7.Set(string(appLayerData[:512-3])+"...", "raw")
 		} else if !isHTTP2 {
 			L7.Set(string(appLayerData), "raw")
@@ -1139,9 +1802,9 @@ func (t *JSONPcapTranslator) addAppLayerData(
 		*message, sizeOfAppLayerData), "message")
 
 	L7, _ := json.Object("L7")
-	L7.Set(sizeOfAppLayerData, "length")
+	L7.Set(len(appLayerData), "length")
 
-	if sizeOfAppLayerData > 128 {
+	if len(appLayerData) > 128 {
 		L7.Set(string(appLayerData[:128-3])+"...", "sample")
 	} else {
 		L7.Set(string(appLayerData), "content")
@@ -1153,31 +1816,464 @@ func (t *JSONPcapTranslator) addAppLayerData(
 	return json, nil
 }
 
-func (t *JSONPcapTranslator) trySetHTTP(
-	ctx context.Context,
-	packet *gopacket.Packet,
-	lock *flowLock,
-	flowID *uint64,
-	tcpFlags *uint8,
-	sequence *uint32,
-	appLayerData []byte,
-	json *gabs.Container,
-	message *string,
-	tsp TraceAndSpanProvider,
-) (*gabs.Container, bool /* handled */, bool /* isHTTP2 */) {
-	isHTTP11Request := http11RequestPayloadRegex.Match(appLayerData)
-	isHTTP11Response := !isHTTP11Request && http11ResponsePayloadRegex.Match(appLayerData)
+// observeDNS learns the timing of DNS lookups: `src` and `dst` are the endpoints of the DNS message.
+func (t *JSONPcapTranslator) observeDNS(dns *layers.DNS, timestamp time.Time, src, dst string) {
+	if !dns.QR {
+		t.phases.observeDNSQuery(src, dns.ID, timestamp)
+		return
+	}
 
-	isHTTP2 := !isHTTP11Request && !isHTTP11Response && http2PrefaceRegex.Match(appLayerData)
-	framer := http2.NewFramer(io.Discard, bytes.NewReader(appLayerData))
-	frame, frameErr := framer.ReadFrame()
+	if len(dns.Questions) == 0 {
+		return
+	}
 
-	// if content is not HTTP in clear text, abort
-	if !isHTTP11Request && !isHTTP11Response && !isHTTP2 && frame == nil {
-		return json, false, false
+	addresses := make([]net.IP, 0, len(dns.Answers))
+	for _, answer := range dns.Answers {
+		if answer.Type == layers.DNSTypeA || answer.Type == layers.DNSTypeAAAA {
+			addresses = append(addresses, answer.IP)
+		}
 	}
+	t.phases.observeDNSResponse(dst, dns.ID, timestamp, string(dns.Questions[0].Name), addresses)
+}
 
-	// SETs are used to avoid duplicates
+func (t *JSONPcapTranslator) addQUIC(
+	json *gabs.Container,
+	message *string,
+	packet *quicPacket,
+) {
+	QUIC, _ := json.Object("quic")
+
+	QUIC.Set(packet.packetType, "type")
+	if packet.dcid != nil {
+		QUIC.Set(hex.EncodeToString(packet.dcid), "dcid")
+	}
+
+	if !packet.long {
+		QUIC.Set("short", "header")
+		*message = stringFormatter.Format("{0} | QUIC | {1}", *message, packet.packetType)
+		return
+	}
+
+	QUIC.Set("long", "header")
+	QUIC.Set(quicVersionString(packet.version), "version")
+	QUIC.Set(hex.EncodeToString(packet.scid), "scid")
+	if packet.coalesced > 1 {
+		QUIC.Set(packet.coalesced, "coalesced")
+	}
+	if len(packet.versions) > 0 {
+		versions := make([]string, len(packet.versions))
+		for i, version := range packet.versions {
+			versions[i] = quicVersionString(version)
+		}
+		QUIC.Set(versions, "versions")
+	}
+
+	if !packet.decrypted {
+		*message = stringFormatter.Format("{0} | QUIC/{1} | {2}",
+			*message, quicVersionString(packet.version), packet.packetType)
+		return
+	}
+
+	clientHello, _ := QUIC.Object("client_hello")
+	if packet.serverName != "" {
+		clientHello.Set(packet.serverName, "sni")
+	}
+	if len(packet.alpn) > 0 {
+		clientHello.Set(packet.alpn, "alpn")
+	}
+
+	*message = stringFormatter.Format("{0} | QUIC/{1} | {2} | sni:{3}",
+		*message, quicVersionString(packet.version), packet.packetType, packet.serverName)
+}
+
+func (t *JSONPcapTranslator) addSIPSummary(json *gabs.Container, message *string) {
+	SIP := json.S("SIP")
+	if code, ok := SIP.S("code").Data().(int); ok {
+		*message = stringFormatter.Format("{0} | SIP {1} {2} | {3}",
+			*message, code, SIP.S("status").Data(), SIP.S("method").Data())
+		return
+	}
+	*message = stringFormatter.Format("{0} | SIP {1} {2}", *message, SIP.S("method").Data(), SIP.S("uri").Data())
+}
+
+func (t *JSONPcapTranslator) addNTPSummary(
+	json *gabs.Container,
+	message *string,
+	ntp *layers.NTP,
+	arrival time.Time,
+) {
+	mode := ntpMode(ntp)
+	if ntp.Mode != ntpModeServer {
+		*message = stringFormatter.Format("{0} | NTPv{1} {2}", *message, uint8(ntp.Version), mode)
+		return
+	}
+
+	offset, delay, ok := ntpOffset(ntpTime(ntp.OriginTimestamp),
+		ntpTime(ntp.ReceiveTimestamp), ntpTime(ntp.TransmitTimestamp), arrival)
+	if !ok {
+		*message = stringFormatter.Format("{0} | NTPv{1} {2} | stratum:{3}",
+			*message, uint8(ntp.Version), mode, uint8(ntp.Stratum))
+		return
+	}
+
+	if NTP := json.S("ntp"); NTP != nil {
+		NTP.Set(ntpMillis(offset), "offset")
+		NTP.Set(ntpMillis(delay), "delay")
+	}
+
+	*message = stringFormatter.Format("{0} | NTPv{1} {2} | stratum:{3} | offset:{4}ms delay:{5}ms",
+		*message, uint8(ntp.Version), mode, uint8(ntp.Stratum), ntpMillis(offset), ntpMillis(delay))
+}
+
+func (t *JSONPcapTranslator) addMulticast(
+	json *gabs.Container,
+	message *string,
+	packet gopacket.Packet,
+	member net.IP,
+) {
+	multicast := parseMulticast(packet)
+	if multicast == nil {
+		return
+	}
+
+	t.multicast.observe(t.iface.Name, member.String(), multicast, packet.Metadata().Timestamp)
+
+	MULTICAST, _ := json.Object("multicast")
+	MULTICAST.Set(multicast.proto, "proto")
+	MULTICAST.Set(multicast.version, "version")
+	MULTICAST.Set(multicast.messageType, "type")
+
+	*message = stringFormatter.Format("{0} | {1}v{2} {3}", *message,
+		strings.ToUpper(multicast.proto), multicast.version, multicast.messageType)
+
+	if multicast.group != nil {
+		MULTICAST.Set(multicast.group.String(), "group")
+		*message = stringFormatter.Format("{0} {1}", *message, multicast.group)
+	}
+
+	if len(multicast.records) == 0 {
+		return
+	}
+
+	records, _ := MULTICAST.ArrayOfSize(len(multicast.records), "records")
+	groups := make([]string, len(multicast.records))
+	for i, record := range multicast.records {
+		r, _ := records.ObjectI(i)
+		r.Set(record.group.String(), "group")
+		r.Set(record.join, "join")
+		if record.mode != "" {
+			r.Set(record.mode, "mode")
+		}
+		if len(record.sources) > 0 {
+			sources := make([]string, len(record.sources))
+			for j, source := range record.sources {
+				sources[j] = source.String()
+			}
+			r.Set(sources, "sources")
+		}
+		groups[i] = record.group.String()
+	}
+	*message = stringFormatter.Format("{0} {1}", *message, strings.Join(groups, ","))
+}
+
+func (t *JSONPcapTranslator) addVPN(
+	json *gabs.Container,
+	message *string,
+	vpn *vpnPacket,
+) {
+	VPN, _ := json.Object("vpn")
+	VPN.Set(vpn.proto, "proto")
+	VPN.Set(vpn.packets, "packets")
+	if vpn.hasCounter {
+		VPN.Set(vpn.counter, "counter")
+	}
+
+	if vpn.proto != vpnProtoWireGuard {
+		spi := fmt.Sprintf("0x%08x", vpn.spi)
+		VPN.Set(spi, "spi")
+		*message = stringFormatter.Format("{0} | {1} spi:{2} seq:{3}",
+			*message, strings.ToUpper(vpn.proto), spi, vpn.counter)
+		return
+	}
+
+	VPN.Set(vpn.messageType, "type")
+	*message = stringFormatter.Format("{0} | WireGuard {1}", *message, vpn.messageType)
+	if vpn.sender != 0 {
+		VPN.Set(vpn.sender, "sender")
+		*message = stringFormatter.Format("{0} sender:{1}", *message, vpn.sender)
+	}
+	if vpn.receiver != 0 {
+		VPN.Set(vpn.receiver, "receiver")
+		*message = stringFormatter.Format("{0} receiver:{1}", *message, vpn.receiver)
+	}
+	if vpn.hasCounter {
+		*message = stringFormatter.Format("{0} counter:{1}", *message, vpn.counter)
+	}
+}
+
+func (t *JSONPcapTranslator) addRTP(
+	json *gabs.Container,
+	message *string,
+	header *rtpHeader,
+	stats *rtpStreamStats,
+) {
+	RTP, _ := json.Object("rtp")
+
+	ssrc := fmt.Sprintf("0x%08x", header.ssrc)
+	RTP.Set(ssrc, "ssrc")
+	RTP.Set(header.payloadType, "pt")
+	RTP.Set(header.sequence, "seq")
+	RTP.Set(header.timestamp, "ts")
+	RTP.Set(header.marker, "marker")
+
+	statsJSON, _ := RTP.Object("stats")
+	statsJSON.Set(stats.received, "received")
+	statsJSON.Set(stats.lost, "lost")
+
+	*message = stringFormatter.Format("{0} | RTP ssrc:{1} pt:{2} seq:{3} | lost:{4}",
+		*message, ssrc, header.payloadType, header.sequence, stats.lost)
+
+	if stats.jitter != nil {
+		jitter := math.Round(*stats.jitter*1000) / 1000
+		statsJSON.Set(jitter, "jitter")
+		*message = stringFormatter.Format("{0} jitter:{1}ms", *message, jitter)
+	}
+}
+
+// addICMPError decodes the original packet embedded in ICMP errors, and annotates the tracked TCP flow it belongs to.
+func (t *JSONPcapTranslator) addICMPError(
+	json *gabs.Container,
+	message *string,
+	packet gopacket.Packet,
+	serial uint64,
+) {
+	embedded, ok := parseICMPEmbedded(icmpEmbeddedPayload(packet))
+	if !ok {
+		return
+	}
+
+	ICMP := json.S("ICMP")
+	origJSON, _ := ICMP.Object("orig")
+	origJSON.Set(embedded.version, "v")
+	origJSON.Set(embedded.proto.String(), "proto")
+	origJSON.Set(embedded.src.String(), "src")
+	origJSON.Set(embedded.dst.String(), "dst")
+	if embedded.hasPorts {
+		origJSON.Set(embedded.srcPort, "sport")
+		origJSON.Set(embedded.dstPort, "dport")
+	}
+	if embedded.seq != nil {
+		origJSON.Set(*embedded.seq, "seq")
+	}
+
+	flowID := embedded.flowID(t.iface.Index)
+	flowIDstr := strconv.FormatUint(flowID, 10)
+	origJSON.Set(flowIDstr, "flow")
+
+	icmpError := &icmpFlowError{
+		serial:    serial,
+		timestamp: packet.Metadata().Timestamp,
+		version:   embedded.version,
+	}
+	icmpError.msg, _ = ICMP.S("msg").Data().(string)
+
+	mtu, hasMTU := icmpMTU(packet)
+	if hasMTU {
+		icmpError.mtu = mtu
+		ICMP.Set(mtu, "mtu")
+	}
+
+	// only TCP flows are tracked
+	tracked := embedded.proto == layers.IPProtocolTCP && t.fm.annotateICMP(flowID, icmpError)
+	origJSON.Set(tracked, "tracked")
+
+	if hasMTU {
+		*message = stringFormatter.Format("{0} | mtu:{1}", *message, mtu)
+	}
+	if embedded.hasPorts {
+		*message = stringFormatter.Format("{0} | orig:{1} {2} > {3} | flow:{4}", *message, embedded.proto,
+			netip.AddrPortFrom(embedded.src, embedded.srcPort), netip.AddrPortFrom(embedded.dst, embedded.dstPort), flowIDstr)
+	} else {
+		*message = stringFormatter.Format("{0} | orig:{1} {2} > {3} | flow:{4}", *message, embedded.proto,
+			embedded.src, embedded.dst, flowIDstr)
+	}
+}
+
+// addFlowICMPError annotates packets of a TCP flow referenced by an ICMP error.
+func (t *JSONPcapTranslator) addFlowICMPError(
+	json *gabs.Container,
+	message *string,
+	icmpError *icmpFlowError,
+) {
+	icmpJSON, _ := json.Object("icmp")
+	icmpJSON.Set(icmpError.version, "v")
+	icmpJSON.Set(icmpError.msg, "msg")
+	icmpJSON.Set(strconv.FormatUint(icmpError.serial, 10), "ref")
+	icmpJSON.Set(icmpError.timestamp.Format(time.RFC3339Nano), "timestamp")
+	if icmpError.mtu > 0 {
+		icmpJSON.Set(icmpError.mtu, "mtu")
+		*message = stringFormatter.Format("{0} | icmp:{1} mtu:{2}", *message, icmpError.msg, icmpError.mtu)
+		return
+	}
+	*message = stringFormatter.Format("{0} | icmp:{1}", *message, icmpError.msg)
+}
+
+func (t *JSONPcapTranslator) addProxyProtocol(
+	json *gabs.Container,
+	message *string,
+	proxyProtocol *proxyProtocolHeader,
+) {
+	PROXY, _ := json.Object("PROXY")
+
+	PROXY.Set(proxyProtocol.version, "version")
+	PROXY.Set(proxyProtocol.command, "cmd")
+	PROXY.Set(proxyProtocol.transport, "proto")
+
+	if proxyProtocol.authority != "" {
+		PROXY.Set(proxyProtocol.authority, "authority")
+	}
+
+	if !proxyProtocol.hasAddresses() {
+		return
+	}
+
+	srcJSON, _ := PROXY.Object("src")
+	srcJSON.Set(proxyProtocol.src.Addr().String(), "IP")
+	srcJSON.Set(proxyProtocol.src.Port(), "port")
+
+	dstJSON, _ := PROXY.Object("dst")
+	dstJSON.Set(proxyProtocol.dst.Addr().String(), "IP")
+	dstJSON.Set(proxyProtocol.dst.Port(), "port")
+
+	*message = stringFormatter.Format("{0} | PROXY:{1} > {2}",
+		*message, proxyProtocol.src.String(), proxyProtocol.dst.String())
+}
+
+// trySetFlowStrategy translates messages detected by `FlowStrategy`s provided by programs embedding pcap-cli:
+//   - messages are trace-tracked the same way HTTP messages are,
+//   - responses without trace context are linked to the traced request sent over the same stream.
+func (t *JSONPcapTranslator) trySetFlowStrategy(
+	ctx context.Context,
+	packet *gopacket.Packet,
+	lock *flowLock,
+	flowID *uint64,
+	tcpFlags *uint8,
+	appLayerData []byte,
+	json *gabs.Container,
+	message *string,
+	tsp TraceAndSpanProvider,
+) (*gabs.Container, bool /* handled */) {
+	if len(t.traces.Flows) == 0 {
+		return nil, false
+	}
+
+	tcp, ok := (*packet).TransportLayer().(*layers.TCP)
+	if !ok {
+		return nil, false
+	}
+
+	flow, messages := t.traces.messages(uint16(tcp.SrcPort), uint16(tcp.DstPort), appLayerData)
+	if flow == nil {
+		return nil, false
+	}
+
+	requestStreams := mapset.NewThreadUnsafeSet[uint32]()
+	responseStreams := mapset.NewThreadUnsafeSet[uint32]()
+	requestTS := make(map[uint32]*traceAndSpan)
+	responseTS := make(map[uint32]*traceAndSpan)
+
+	L7, _ := json.Object("RPC")
+	L7.Set(flow.Protocol(), "proto")
+	_, _ = L7.Array("messages")
+
+	var traced *traceAndSpan = nil
+	for _, m := range messages {
+		streamID := m.StreamID
+		messageJSON := gabs.New()
+		messageJSON.Set(m.Kind.String(), "kind")
+		messageJSON.Set(streamID, "stream")
+		if m.Name != "" {
+			messageJSON.Set(m.Name, "name")
+		}
+
+		var ts *traceAndSpan = nil
+		if m.TraceID != "" && m.SpanID != "" {
+			traceID, spanID := m.TraceID, m.SpanID
+			ts = &traceAndSpan{traceID: &traceID, spanID: &spanID, streamID: &streamID}
+		}
+
+		if m.Kind == FlowMessageRequest {
+			requestStreams.Add(streamID)
+			if ts != nil {
+				requestTS[streamID] = ts
+				t.recordFlowMessageRequest(packet, lock, ts, m.Name)
+			}
+		} else {
+			responseStreams.Add(streamID)
+			if ts != nil {
+				responseTS[streamID] = ts
+			} else if _ts, ok := tsp(&streamID); ok {
+				ts = _ts
+				responseTS[streamID] = ts
+			}
+			if ts != nil {
+				// responses of requests not seen by this capture are not linked
+				t.linkHTTP11ResponseToRequest(packet, flowID, json, messageJSON, ts)
+			}
+		}
+
+		if ts != nil {
+			t.setTraceAndSpan(messageJSON, ts)
+			t.scope.observe(*packet, ts)
+			traced = ts
+		}
+		L7.ArrayAppend(messageJSON.Data(), "messages")
+	}
+
+	// messages carried by the same segment may belong to different traces: the last one is reported
+	if traced != nil {
+		t.setTraceAndSpan(json, traced)
+	}
+
+	json.Set(stringFormatter.Format("{0} | {1} | req:{2} | res:{3}", *message, flow.Protocol(),
+		requestStreams.ToSlice(), responseStreams.ToSlice()), "message")
+
+	_, lockLatency := lock.UnlockWithTraceAndSpan(
+		ctx, tcpFlags, flow.Multiplexed(),
+		requestStreams.ToSlice(),
+		responseStreams.ToSlice(),
+		requestTS, responseTS,
+	)
+	json.Set(lockLatency.String(), "ll")
+
+	return L7, true
+}
+
+func (t *JSONPcapTranslator) trySetHTTP(
+	ctx context.Context,
+	packet *gopacket.Packet,
+	lock *flowLock,
+	flowID *uint64,
+	tcpFlags *uint8,
+	sequence *uint32,
+	appLayerData []byte,
+	json *gabs.Container,
+	message *string,
+	tsp TraceAndSpanProvider,
+) (*gabs.Container, bool /* handled */, bool /* isHTTP2 */) {
+	isHTTP11Request := http11RequestPayloadRegex.Match(appLayerData)
+	isHTTP11Response := !isHTTP11Request && http11ResponsePayloadRegex.Match(appLayerData)
+
+	isHTTP2 := !isHTTP11Request && !isHTTP11Response && http2PrefaceRegex.Match(appLayerData)
+	framer := http2.NewFramer(io.Discard, bytes.NewReader(appLayerData))
+	frame, frameErr := framer.ReadFrame()
+
+	// if content is not HTTP in clear text, abort
+	if !isHTTP11Request && !isHTTP11Response && !isHTTP2 && frame == nil {
+		return json, false, false
+	}
+
+	// SETs are used to avoid duplicates
 	streams := mapset.NewThreadUnsafeSet[uint32]()
 	requestStreams := mapset.NewThreadUnsafeSet[uint32]()
 	responseStreams := mapset.NewThreadUnsafeSet[uint32]()
@@ -1185,9 +2281,8 @@ func (t *JSONPcapTranslator) trySetHTTP(
 	requestTS := make(map[uint32]*traceAndSpan)
 	responseTS := make(map[uint32]*traceAndSpan)
 
-	// making at least 1 big assumption:
-	//   HTTP request/status line and headers fit in 1 packet ( TCP segment )
-	//     which is not always the case when fragmentation occurs
+	// request/status line and headers spanning multiple TCP segments are reassembled in capture order:
+	//   `appLayerData` contains them if this segment carries their last byte
 	L7, _ := json.Object("HTTP")
 
 	defer func() {
@@ -1225,6 +2320,19 @@ func (t *JSONPcapTranslator) trySetHTTP(
 		L7.Set("h2c", "proto")
 		streamsJSON, _ := L7.Object("streams")
 
+		// HPACK state must be shared by all packets flowing in the same direction
+		var decoder *http2HeadersDecoder = nil
+		var calls *grpcCalls = nil
+		srcPort := uint16(0)
+		if tcp, ok := (*packet).TransportLayer().(*layers.TCP); ok {
+			srcPort = uint16(tcp.SrcPort)
+			decoder = lock.HTTP2HeadersDecoder(srcPort)
+			calls = lock.GRPCCalls()
+		}
+		rpcs := mapset.NewThreadUnsafeSet[string]()
+		HTTP2, _ := json.Object("http2")
+		_, _ = HTTP2.Array("frames")
+
 		// multple h2 frames ( from multiple streams ) may be delivered by the same packet
 		for frame != nil {
 
@@ -1272,6 +2380,10 @@ func (t *JSONPcapTranslator) trySetHTTP(
 			flagsJSON.Set("0x"+strconv.FormatUint(uint64(frameHeader.Flags /* uint8 */), 16), "hex")
 			flagsJSON.Set(strconv.FormatUint(uint64(frameHeader.Flags /* uint8 */), 10), "dec")
 
+			// frame-level details, including header blocks decoded using HPACK state
+			frameHTTP2, headerFields := http2FrameToJSON(frame, decoder)
+			HTTP2.ArrayAppend(frameHTTP2, "frames")
+
 			var _ts *traceAndSpan = nil
 
 			switch frame := frame.(type) {
@@ -1297,18 +2409,26 @@ func (t *JSONPcapTranslator) trySetHTTP(
 				})
 				frameJSON.Set(frame.IsAck(), "ack")
 
-			case *http2.HeadersFrame:
-				frameJSON.Set("headers", "type")
-				decoder := hpack.NewDecoder(2048, nil)
-				hf, _ := decoder.DecodeFull(frame.HeaderBlockFragment())
+			case *http2.HeadersFrame, *http2.ContinuationFrame:
+				if _, ok := frame.(*http2.HeadersFrame); ok {
+					frameJSON.Set("headers", "type")
+				} else {
+					frameJSON.Set("continuation", "type")
+				}
+				// header blocks are only available after the frame flagged with `END_HEADERS`
+				if headerFields == nil {
+					break
+				}
 				headers := http.Header{}
-				for _, header := range hf {
+				for _, header := range headerFields {
 					isRequest = (isRequest || (header.Name == ":method"))
 					isResponse = (isResponse || (header.Name == ":status"))
 					// `Add(...)` internally applies `http.CanonicalHeaderKey(...)`
 					headers.Add(header.Name, header.Value)
 				}
-				decoder.Close()
+				if isRequest {
+					t.addHTTPUserAgent(frameJSON, headers.Get(httpUserAgentHeader))
+				}
 				if _ts = t.addHTTPHeaders(frameJSON, &headers); _ts != nil {
 					_ts.streamID = &StreamID
 					if isRequest {
@@ -1319,6 +2439,39 @@ func (t *JSONPcapTranslator) trySetHTTP(
 				} else if traced && isResponse {
 					responseTS[StreamID] = ts
 				}
+				if _ts != nil && !traced && http2IsTrailers(headerFields) {
+					// trailers follow `DATA` frames: trace context they carry is bound to the stream after the fact
+					frameJSON.Set(true, "trailers")
+					if decoder.client {
+						// tracking the stream from now on allows to link the response to the trace
+						requestStreams.Add(StreamID)
+						requestTS[StreamID] = _ts
+					}
+					var call *grpcCall = nil
+					if calls != nil {
+						call = calls.get(StreamID)
+					}
+					t.bindHTTP2Trailers(packet, lock, json, frameJSON, call, _ts, decoder.client)
+				}
+				if isRequest {
+					var traceID *string = nil
+					if _ts != nil {
+						traceID = _ts.traceID
+					} else if traced {
+						traceID = ts.traceID
+					}
+					t.addHTTPRetry(packet, lock, flowID, nil, frameJSON, traceID,
+						headers.Get(":method"), headers.Get(":authority")+headers.Get(":path"))
+					t.addConnectionSetup(packet, flowID, frameJSON)
+					t.emitHTTPRequest(packet, lock, flowID, StreamID, requestTS[StreamID], "HTTP/2",
+						headers.Get(":method"), headers.Get(":authority"), headers.Get(":path"))
+				} else if isResponse {
+					if t.retries != nil {
+						t.retries.observeResponse(*flowID, (*packet).Metadata().Timestamp)
+					}
+					statusCode, _ := strconv.Atoi(headers.Get(":status"))
+					t.emitHTTPResponse(packet, lock, flowID, StreamID, responseTS[StreamID], "HTTP/2", statusCode)
+				}
 
 			case *http2.MetaHeadersFrame:
 				frameJSON.Set("metadata", "type")
@@ -1343,6 +2496,12 @@ func (t *JSONPcapTranslator) trySetHTTP(
 				frameJSON.Set("response", "kind")
 			}
 
+			if calls != nil {
+				grpcJSON, call := calls.frameToJSON(frame, srcPort, headerFields)
+				t.addGRPC(packet, lock, json, frameJSON, grpcJSON, call,
+					isRequest, isResponse, _ts, ts, traced, rpcs)
+			}
+
 			// multiple streams with frames for req/res
 			// might arrive within the same TCP segment
 			if _ts != nil {
@@ -1376,6 +2535,10 @@ func (t *JSONPcapTranslator) trySetHTTP(
 				streams.ToSlice(), requestStreams.ToSlice(), responseStreams.ToSlice(), dataStreams.ToSlice()), "message")
 		}
 
+		if rpcs.Cardinality() > 0 {
+			json.Set(stringFormatter.Format("{0} | grpc:{1}", json.S("message").Data(), rpcs.ToSlice()), "message")
+		}
+
 		return L7, true, true
 	}
 
@@ -1476,12 +2639,16 @@ func (t *JSONPcapTranslator) trySetHTTP(
 		L7.Set(request.Proto, "proto")
 		L7.Set(request.Method, "method")
 
+		t.addHTTPUserAgent(L7, request.UserAgent())
+
+		var traceID *string = nil
 		if _ts := t.addHTTPHeaders(L7, &request.Header); _ts != nil {
 			_ts.streamID = &StreamID
 			requestTS[StreamID] = _ts
 			// include trace and span id for traceability
 			t.setTraceAndSpan(json, _ts)
-			t.recordHTTP11Request(packet, flowID, sequence, _ts, &request.Method, &request.Host, &url)
+			t.recordHTTP11Request(packet, lock, flowID, sequence, _ts, &request.Method, &request.Host, &url)
+			traceID = _ts.traceID
 		}
 
 		sizeOfBody := t.addHTTPBodyDetails(L7, &request.ContentLength, request.Body)
@@ -1494,6 +2661,11 @@ func (t *JSONPcapTranslator) trySetHTTP(
 
 		json.Set(stringFormatter.Format("{0} | {1} {2} {3}", *message, request.Proto, request.Method, url), "message")
 
+		t.addHTTPRetry(packet, lock, flowID, json, L7, traceID, request.Method, request.Host+url)
+		t.addConnectionSetup(packet, flowID, L7)
+		t.emitHTTPRequest(packet, lock, flowID, StreamID, requestTS[StreamID],
+			request.Proto, request.Method, request.Host, url)
+
 		return L7, true, false
 	}
 
@@ -1527,18 +2699,29 @@ func (t *JSONPcapTranslator) trySetHTTP(
 		L7.Set(response.StatusCode, "code")
 		L7.Set(response.Status, "status")
 
+		if t.retries != nil {
+			t.retries.observeResponse(*flowID, (*packet).Metadata().Timestamp)
+		}
+
+		// see: https://www.rfc-editor.org/rfc/rfc6455#section-4.2.2
+		if response.StatusCode == http.StatusSwitchingProtocols &&
+			strings.EqualFold(response.Header.Get("Upgrade"), webSocketUpgrade) {
+			lock.UpgradeToWebSocket()
+			L7.Set(webSocketUpgrade, "upgrade")
+		}
+
 		if _ts := t.addHTTPHeaders(L7, &response.Header); _ts != nil {
 			_ts.streamID = &StreamID
 			responseTS[StreamID] = _ts
 			// include trace and span id for traceability
 			t.setTraceAndSpan(json, _ts)
-			if linkErr := t.linkHTTP11ResponseToRequest(packet, flowID, L7, _ts); linkErr != nil {
-				io.WriteString(os.Stderr, linkErr.Error()+"\n")
+			if linkErr := t.linkHTTP11ResponseToRequest(packet, flowID, json, L7, _ts); linkErr != nil {
+				t.fm.logger().Warn("failed to link response to request", "error", linkErr.Error())
 			}
 		} else if traced {
 			responseTS[StreamID] = ts
 			t.setTraceAndSpan(json, ts)
-			t.linkHTTP11ResponseToRequest(packet, flowID, L7, ts)
+			t.linkHTTP11ResponseToRequest(packet, flowID, json, L7, ts)
 		}
 
 		sizeOfBody := t.addHTTPBodyDetails(L7, &response.ContentLength, response.Body)
@@ -1553,12 +2736,321 @@ func (t *JSONPcapTranslator) trySetHTTP(
 
 		json.Set(stringFormatter.Format("{0} | {1} {2}", *message, response.Proto, response.Status), "message")
 
+		t.emitHTTPResponse(packet, lock, flowID, StreamID, responseTS[StreamID], response.Proto, response.StatusCode)
+
 		return L7, true, false
 	}
 
 	return json, true, false
 }
 
+func (t *JSONPcapTranslator) emitHTTPRequest(
+	packet *gopacket.Packet,
+	lock *flowLock,
+	flowID *uint64,
+	streamID uint32,
+	ts *traceAndSpan,
+	proto, method, host, url string,
+) {
+	t.scope.observe(*packet, ts)
+	lock.Summary().observeHTTPRequest(ts.ids())
+	if t.events == nil {
+		return
+	}
+	event := &HTTPRequestEvent{
+		FlowEvent: newFlowEvent(packet, lock.Serial(), *flowID),
+		Proto:     proto,
+		Method:    method,
+		Host:      host,
+		URL:       url,
+		StreamID:  streamID,
+	}
+	event.TraceID, event.SpanID = ts.ids()
+	t.events.request(event)
+}
+
+func (t *JSONPcapTranslator) emitHTTPResponse(
+	packet *gopacket.Packet,
+	lock *flowLock,
+	flowID *uint64,
+	streamID uint32,
+	ts *traceAndSpan,
+	proto string,
+	statusCode int,
+) {
+	t.scope.observe(*packet, ts)
+	if t.events == nil {
+		return
+	}
+	event := &HTTPResponseEvent{
+		FlowEvent:  newFlowEvent(packet, lock.Serial(), *flowID),
+		Proto:      proto,
+		StatusCode: statusCode,
+		StreamID:   streamID,
+	}
+	event.TraceID, event.SpanID = ts.ids()
+	t.events.response(event)
+}
+
+// addConnectionSetup records whether the HTTP transaction started by `packet` paid for the setup of its connection,
+// and the connection setup cost amortized across all transactions sent to the same destination.
+func (t *JSONPcapTranslator) addConnectionSetup(packet *gopacket.Packet, flowID *uint64, L7 *gabs.Container) {
+	if !t.connectionSetup || t.phases == nil {
+		return
+	}
+
+	networkFlow := (*packet).NetworkLayer().NetworkFlow()
+	transportFlow := (*packet).TransportLayer().TransportFlow()
+	server := net.IP(networkFlow.Dst().Raw())
+	destination := net.JoinHostPort(networkFlow.Dst().String(), transportFlow.Dst().String())
+
+	setup := t.phases.setup(*flowID, server, destination)
+
+	connection, _ := L7.Object("connection")
+	connection.Set(setup.reused, "reused")
+	connection.Set(setup.transaction, "transaction")
+	if !setup.reused {
+		connection.Set(setup.dns.Milliseconds(), "setup", "dns")
+		connection.Set(setup.tcp.Milliseconds(), "setup", "tcp")
+		connection.Set(setup.tls.Milliseconds(), "setup", "tls")
+		connection.Set(setup.total().Milliseconds(), "setup", "total")
+	}
+	connection.Set(destination, "destination", "address")
+	connection.Set(setup.stats.new, "destination", "new")
+	connection.Set(setup.stats.reused, "destination", "reused")
+	connection.Set(setup.stats.tax().Milliseconds(), "destination", "tax")
+}
+
+// addWebSocket translates the frames carried by a connection upgraded to WebSocket.
+func (t *JSONPcapTranslator) addWebSocket(
+	packet *gopacket.Packet,
+	webSocket *webSocketFlow,
+	appLayerData []byte,
+	json *gabs.Container,
+	message *string,
+) {
+	srcPort := uint16(0)
+	if tcp, ok := (*packet).TransportLayer().(*layers.TCP); ok {
+		srcPort = uint16(tcp.SrcPort)
+	}
+
+	webSocketJSON, _ := json.Object("websocket")
+	webSocketJSON.Set(len(appLayerData), "size")
+	_, _ = webSocketJSON.Array("frames")
+
+	types := []string{}
+	for _, frame := range webSocket.frames(srcPort, appLayerData) {
+		webSocketJSON.ArrayAppend(frame.toJSON(), "frames")
+		frameType := webSocketOpcodeName(frame.opcode)
+		if frame.opcode == 0x8 && frame.closeCode != 0 {
+			frameType = stringFormatter.Format("{0}:{1}", frameType, frame.closeCode)
+		}
+		types = append(types, frameType)
+	}
+
+	if len(types) == 0 {
+		// the segment only carries the payload of a frame started by a previous segment
+		json.Set(stringFormatter.Format("{0} | WebSocket | size:{1}", *message, len(appLayerData)), "message")
+		return
+	}
+	json.Set(stringFormatter.Format("{0} | WebSocket | {1}", *message, strings.Join(types, ",")), "message")
+}
+
+// addCache summarizes Redis and Memcached commands and replies without including keys' values.
+func (t *JSONPcapTranslator) addCache(
+	packet *gopacket.Packet,
+	flow *cacheFlow,
+	protocol cacheProtocol,
+	isCommand bool,
+	appLayerData []byte,
+	json *gabs.Container,
+	message *string,
+) {
+	timestamp := (*packet).Metadata().Timestamp
+
+	cacheJSON, _ := json.Object("cache")
+	cacheJSON.Set(string(protocol), "proto")
+	cacheJSON.Set(len(appLayerData), "size")
+	_, _ = cacheJSON.Array("ops")
+
+	kind := "reply"
+	if isCommand {
+		kind = "command"
+	}
+	cacheJSON.Set(kind, "kind")
+
+	summaries := []string{}
+	for _, operation := range t.caches.operations(protocol, appLayerData, isCommand) {
+		if isCommand {
+			flow.sent(operation.command, timestamp)
+			summaries = append(summaries, operation.command)
+		} else if flow.replied(operation, timestamp); operation.command != "" {
+			summaries = append(summaries, stringFormatter.Format("{0}:{1}", operation.command, operation.reply))
+		} else {
+			summaries = append(summaries, operation.reply)
+		}
+		cacheJSON.ArrayAppend(operation.toJSON().Data(), "ops")
+	}
+
+	if len(summaries) == 0 {
+		// the segment only carries the continuation of a value
+		json.Set(stringFormatter.Format("{0} | {1} | size:{2}", *message, protocol, len(appLayerData)), "message")
+		return
+	}
+	json.Set(stringFormatter.Format("{0} | {1} | {2}", *message, protocol, strings.Join(summaries, ",")), "message")
+}
+
+// addDB summarizes PostgreSQL and MySQL messages; query text is only included if explicitly enabled.
+func (t *JSONPcapTranslator) addDB(
+	protocol dbProtocol,
+	fromClient bool,
+	appLayerData []byte,
+	json *gabs.Container,
+	message *string,
+) {
+	dbJSON, _ := json.Object("db")
+	dbJSON.Set(string(protocol), "proto")
+	dbJSON.Set(len(appLayerData), "size")
+	_, _ = dbJSON.Array("msgs")
+
+	if isDBTLSRecord(appLayerData) {
+		dbJSON.Set(true, "tls")
+		json.Set(stringFormatter.Format("{0} | {1} | tls | size:{2}", *message, protocol, len(appLayerData)), "message")
+		return
+	}
+
+	summaries := []string{}
+	for _, msg := range t.dbs.messages(protocol, appLayerData, fromClient) {
+		summaries = append(summaries, msg.summary())
+		dbJSON.ArrayAppend(msg.toJSON().Data(), "msgs")
+	}
+
+	if len(summaries) == 0 {
+		// the segment only carries the continuation of a message
+		json.Set(stringFormatter.Format("{0} | {1} | size:{2}", *message, protocol, len(appLayerData)), "message")
+		return
+	}
+	json.Set(stringFormatter.Format("{0} | {1} | {2}", *message, protocol, strings.Join(summaries, ",")), "message")
+}
+
+// addBroker summarizes AMQP 0-9-1 frames and Kafka requests and responses; message payloads are never translated.
+func (t *JSONPcapTranslator) addBroker(
+	packet *gopacket.Packet,
+	flow *brokerFlow,
+	protocol brokerProtocol,
+	fromClient bool,
+	appLayerData []byte,
+	json *gabs.Container,
+	message *string,
+) {
+	timestamp := (*packet).Metadata().Timestamp
+
+	brokerJSON, _ := json.Object("broker")
+	brokerJSON.Set(string(protocol), "proto")
+	brokerJSON.Set(len(appLayerData), "size")
+	_, _ = brokerJSON.Array("frames")
+
+	from := "server"
+	if fromClient {
+		from = "client"
+	}
+	brokerJSON.Set(from, "from")
+
+	summaries := []string{}
+	for _, frame := range flow.frames(protocol, appLayerData, fromClient, timestamp) {
+		summaries = append(summaries, frame.summary())
+		brokerJSON.ArrayAppend(frame.toJSON().Data(), "frames")
+	}
+
+	if len(summaries) == 0 {
+		// the segment only carries the continuation of a frame
+		json.Set(stringFormatter.Format("{0} | {1} | size:{2}", *message, protocol, len(appLayerData)), "message")
+		return
+	}
+	json.Set(stringFormatter.Format("{0} | {1} | {2}", *message, protocol, strings.Join(summaries, ",")), "message")
+}
+
+// addMail summarizes SMTP, IMAP and POP3 commands and replies; only domains of addresses are included.
+func (t *JSONPcapTranslator) addMail(
+	flow *mailFlow,
+	protocol mailProtocol,
+	fromClient bool,
+	appLayerData []byte,
+	json *gabs.Container,
+	message *string,
+) {
+	mailJSON, _ := json.Object("mail")
+	mailJSON.Set(string(protocol), "proto")
+	mailJSON.Set(len(appLayerData), "size")
+	_, _ = mailJSON.Array("lines")
+
+	kind := "reply"
+	if fromClient {
+		kind = "command"
+	}
+	mailJSON.Set(kind, "kind")
+
+	// connections are encrypted after `STARTTLS`: the transition may have happened before capturing started
+	if flow.tls || isDBTLSRecord(appLayerData) {
+		mailJSON.Set(true, "tls")
+		json.Set(stringFormatter.Format("{0} | {1} | tls | size:{2}", *message, protocol, len(appLayerData)), "message")
+		return
+	}
+
+	summaries := []string{}
+	for _, line := range flow.lines(protocol, appLayerData, fromClient) {
+		summaries = append(summaries, line.summary())
+		mailJSON.ArrayAppend(line.toJSON().Data(), "lines")
+	}
+
+	if len(summaries) == 0 {
+		// the segment only carries a message body, or the continuation of a line
+		json.Set(stringFormatter.Format("{0} | {1} | size:{2}", *message, protocol, len(appLayerData)), "message")
+		return
+	}
+	json.Set(stringFormatter.Format("{0} | {1} | {2}", *message, protocol, strings.Join(summaries, ",")), "message")
+}
+
+// addHTTPRetry links requests to previous attempts sent over different connections;
+// `json` may be `nil` if the translation message must not be modified; i/e: for HTTP/2 frames.
+func (t *JSONPcapTranslator) addHTTPRetry(
+	packet *gopacket.Packet,
+	lock *flowLock,
+	flowID *uint64,
+	json, L7 *gabs.Container,
+	traceID *string,
+	method, url string,
+) {
+	if t.retries == nil {
+		return
+	}
+
+	// the same request line is only a duplicate if it was sent by the same client
+	client := (*packet).NetworkLayer().NetworkFlow().Src().String()
+	retry := t.retries.observeRequest(lock.Serial(), *flowID, (*packet).Metadata().Timestamp,
+		traceID, stringFormatter.Format("{0} {1} {2}", client, method, url))
+	if retry == nil {
+		return
+	}
+
+	retryJSON, _ := L7.Object("retry")
+	retryJSON.Set(retry.kind(), "kind")
+	retryJSON.Set(retry.by, "by")
+	retryJSON.Set(retry.attempt, "attempt")
+	for name, attempt := range map[string]*httpAttempt{"first": retry.first, "previous": retry.previous} {
+		attemptJSON, _ := retryJSON.Object(name)
+		attemptJSON.Set(strconv.FormatUint(attempt.serial, 10), "num")
+		attemptJSON.Set(strconv.FormatUint(attempt.flowID, 10), "flow")
+		attemptJSON.Set(attempt.timestamp.Format(time.RFC3339Nano), "timestamp")
+	}
+	retryJSON.Set((*packet).Metadata().Timestamp.Sub(retry.first.timestamp).Milliseconds(), "elapsed")
+
+	if json != nil {
+		json.Set(stringFormatter.Format("{0} | {1} #{2} of #{3}",
+			json.S("message").Data(), retry.kind(), retry.attempt, retry.first.serial), "message")
+	}
+}
+
 func (t *JSONPcapTranslator) addHTTPBodyDetails(L7 *gabs.Container, contentLength *int64, body io.Reader) uint64 {
 	bodyBytes, err := io.ReadAll(body)
 	if err != nil {
@@ -1581,13 +3073,19 @@ func (t *JSONPcapTranslator) addHTTPBodyDetails(L7 *gabs.Container, contentLengt
 	return sizeOfBody
 }
 
+// recordHTTP11Request records a traced HTTP/1.1 request so that its response is linked to it;
+// requests are not recorded for flows that are not trace-tracked, as nothing would ever remove them.
 func (t *JSONPcapTranslator) recordHTTP11Request(
 	packet *gopacket.Packet,
+	lock *flowLock,
 	_ *uint64, /* flowID */
 	_ *uint32, /* TCP sequence */
 	ts *traceAndSpan,
 	method, host, url *string,
 ) {
+	if !lock.TraceTracked() {
+		return
+	}
 	fullURL := stringFormatter.Format("{0}{1}", *host, *url)
 	_httpRequest := &httpRequest{
 		timestamp: &(*packet).Metadata().Timestamp,
@@ -1597,10 +3095,111 @@ func (t *JSONPcapTranslator) recordHTTP11Request(
 	t.traceToHttpRequestMap.Set(*ts.traceID, _httpRequest)
 }
 
+// recordFlowMessageRequest records a traced request detected by a `FlowStrategy` so that its response is linked to it.
+func (t *JSONPcapTranslator) recordFlowMessageRequest(
+	packet *gopacket.Packet,
+	lock *flowLock,
+	ts *traceAndSpan,
+	name string,
+) {
+	if !lock.TraceTracked() {
+		return
+	}
+	request := &httpRequest{
+		timestamp: &(*packet).Metadata().Timestamp,
+	}
+	if name != "" {
+		request.rpc = &name
+	}
+	t.traceToHttpRequestMap.Set(*ts.traceID, request)
+}
+
+// addGRPC appends the gRPC details of an HTTP/2 frame, and links gRPC responses to their requests.
+func (t *JSONPcapTranslator) addGRPC(
+	packet *gopacket.Packet,
+	lock *flowLock,
+	json, frameJSON *gabs.Container,
+	grpcJSON *gabs.Container,
+	call *grpcCall,
+	isRequest, isResponse bool,
+	frameTS, streamTS *traceAndSpan,
+	traced bool,
+	rpcs mapset.Set[string],
+) {
+	if grpcJSON == nil {
+		return
+	}
+
+	json.ArrayAppend(grpcJSON, "grpc")
+	rpcs.Add(call.rpc)
+	if isRequest {
+		call.start = (*packet).Metadata().Timestamp
+	}
+
+	ts := frameTS
+	if ts == nil && traced {
+		ts = streamTS
+	}
+	if ts == nil || ts.traceID == nil {
+		return
+	}
+
+	if isRequest {
+		if !lock.TraceTracked() {
+			return
+		}
+		// the RPC is recorded so that responses within the same trace are linked to it
+		url := call.authority + call.rpc
+		method := http.MethodPost
+		t.traceToHttpRequestMap.Set(*ts.traceID, &httpRequest{
+			timestamp: &(*packet).Metadata().Timestamp,
+			method:    &method,
+			url:       &url,
+			rpc:       &call.rpc,
+		})
+	} else if isResponse {
+		t.linkHTTP11ResponseToRequest(packet, nil, json, frameJSON, ts)
+	}
+}
+
+// bindHTTP2Trailers binds trace context found in trailers of a stream whose headers did not carry it:
+//   - gRPC calls are recorded as if the request carried the trace, using the timestamp of its headers,
+//   - response trailers are linked to the request right away, as the stream ends with them.
+func (t *JSONPcapTranslator) bindHTTP2Trailers(
+	packet *gopacket.Packet,
+	lock *flowLock,
+	json, trailers *gabs.Container,
+	call *grpcCall,
+	ts *traceAndSpan,
+	fromClient bool,
+) {
+	t.scope.observe(*packet, ts)
+	if call == nil || call.start.IsZero() {
+		return
+	}
+
+	url := call.authority + call.rpc
+	method := http.MethodPost
+	request := &httpRequest{
+		timestamp: &call.start,
+		method:    &method,
+		url:       &url,
+		rpc:       &call.rpc,
+	}
+	if fromClient {
+		if lock.TraceTracked() {
+			t.traceToHttpRequestMap.Set(*ts.traceID, request)
+		}
+		return
+	}
+	// the stream is not tracked, so the request is not recorded: it would outlive the connection
+	t.linkResponseToRequest(packet, json, trailers, request)
+}
+
 func (t *JSONPcapTranslator) linkHTTP11ResponseToRequest(
 	packet *gopacket.Packet,
 	_ *uint64, /* flowID */
-	response *gabs.Container,
+	json, response *gabs.Container,
 	ts *traceAndSpan,
 ) error {
 	jsonTranslatorRequest, ok := t.traceToHttpRequestMap.Get(*ts.traceID)
@@ -1608,45 +3207,82 @@ func (t *JSONPcapTranslator) linkHTTP11ResponseToRequest(
 		return errors.New(stringFormatter.Format("no request found for trace-id: {0}", *ts.traceID))
 	}
 
+	t.linkResponseToRequest(packet, json, response, jsonTranslatorRequest)
+
+	// intentionally not removing from `traceToHttpRequestMap`:
+	//   - it will be done by `untrackConnection` on `RST` or `FIN+ACK`
+	//   - allows to link multiple `traceID`s with the same flow
+	return nil
+}
+
+func (t *JSONPcapTranslator) linkResponseToRequest(
+	packet *gopacket.Packet,
+	json, response *gabs.Container,
+	jsonTranslatorRequest *httpRequest,
+) {
 	translatorRequest := *jsonTranslatorRequest
 	// hydrate response with information from request
 	request, _ := response.Object("request")
-	request.Set(*translatorRequest.method, "method")
-	request.Set(*translatorRequest.url, "url")
+	if translatorRequest.method != nil {
+		request.Set(*translatorRequest.method, "method")
+	}
+	if translatorRequest.url != nil {
+		request.Set(*translatorRequest.url, "url")
+	}
+	if translatorRequest.rpc != nil {
+		request.Set(*translatorRequest.rpc, "rpc")
+	}
 	requestTimestamp := *translatorRequest.timestamp
 	responseTimestamp := (*packet).Metadata().Timestamp
 	latency := responseTimestamp.Sub(requestTimestamp)
 	request.Set(requestTimestamp.Format(time.RFC3339Nano), "timestamp")
 	request.Set(latency.Milliseconds(), "latency")
-
-	// intentionally not removing from `traceToHttpRequestMap`:
-	//   - it will be done by `untrackConnection` on `RST` or `FIN+ACK`
-	//   - allows to link multiple `traceID`s with the same flow
-	return nil
+	// sub-millisecond latencies are common between co-located services
+	request.Set(durationMillis(latency), "latency_ms")
+
+	if t.anomalies != nil {
+		// responses are sent by the destination whose latency is being measured
+		networkFlow := (*packet).NetworkLayer().NetworkFlow()
+		transportFlow := (*packet).TransportLayer().TransportFlow()
+		destination := net.JoinHostPort(networkFlow.Src().String(), transportFlow.Src().String())
+		t.addAnomaly(json, t.anomalies.observeLatency(destination, responseTimestamp, latency))
+	}
 }
 
 func (t *JSONPcapTranslator) addHTTPHeaders(L7 *gabs.Container, headers *http.Header) *traceAndSpan {
+	if t.sessions != nil {
+		// must be applied before headers are added to avoid leaking credentials
+		if sessions := t.sessions.apply(*headers); len(sessions) > 0 {
+			L7.Set(sessions, "sessions")
+		}
+	}
 	jsonHeaders, _ := L7.Object("headers")
-	var traceAndSpan *traceAndSpan = nil
 	for key, value := range *headers {
 		jsonHeaders.Set(value, key)
-		for headerStr, headerRgx := range traceAndSpanRegex {
-			if strings.EqualFold(key, headerStr) {
-				traceAndSpan = t.getTraceAndSpan(headerRgx, &value[0])
-			}
+	}
+	ts := t.traces.extract(headers)
+	if ts != nil && ts.scheme != "" {
+		L7.Set(string(ts.scheme), "trace", "scheme")
+		if len(ts.state) > 0 {
+			L7.Set(ts.state, "trace", "state")
 		}
 	}
-	return traceAndSpan
+	return ts
 }
 
-func (t *JSONPcapTranslator) getTraceAndSpan(
-	headerRgx *regexp.Regexp,
-	rawTraceAndSpan *string,
-) *traceAndSpan {
-	if ts := headerRgx.FindStringSubmatch(*rawTraceAndSpan); ts != nil {
-		return &traceAndSpan{traceID: &ts[1], spanID: &ts[2]}
+func (t *JSONPcapTranslator) addHTTPUserAgent(L7 *gabs.Container, rawUserAgent string) {
+	ua := parseUserAgent(rawUserAgent)
+	if ua == nil {
+		return
 	}
-	return nil
+	userAgent, _ := L7.Object("user_agent")
+	userAgent.Set(ua.family, "family")
+	if ua.version != "" {
+		userAgent.Set(ua.version, "version")
+	}
+	userAgent.Set(string(ua.class), "class")
+	// allows to filter out crawlers and probes noise
+	userAgent.Set(ua.isAutomated(), "bot")
 }
 
 func (t *JSONPcapTranslator) setTraceAndSpan(json *gabs.Container, ts *traceAndSpan) bool {
@@ -1677,6 +3313,12 @@ func (t *JSONPcapTranslator) write(ctx context.Context, writer io.Writer, packet
 	if err != nil {
 		return 0, errors.Wrap(err, "JSON translation failed")
 	}
+	if t.encoding != nil {
+		if translationBytes, err = t.encoding.encode(translationBytes); err != nil {
+			return 0, err
+		}
+		bytesCount = len(translationBytes)
+	}
 	writtenBytes, err := writer.Write(translationBytes)
 	if err != nil {
 		return 0, errors.Wrap(err, "failed to write JSON translation")
@@ -1695,7 +3337,61 @@ func newJSONPcapTranslator(
 ) PcapTranslator {
 	flowToStreamToSequenceMap := haxmap.New[uint64, STSM]()
 	traceToHttpRequestMap := haxmap.New[string, *httpRequest]()
-	flowMutex := newFlowMutex(ctx, debug, flowToStreamToSequenceMap, traceToHttpRequestMap)
+	events, _ := ctx.Value(ContextFlowEvents).(*FlowEventHandlers)
+	var onSummary func(*FlowSummaryEvent) = nil
+	if events != nil {
+		onSummary = events.OnFlowSummary
+	}
+	trackingPercent, ok := ctx.Value(ContextTraceTrackingPercent).(uint)
+	if !ok {
+		trackingPercent = 100
+	}
+	trackingRate, _ := ctx.Value(ContextTraceTrackingRate).(uint)
+	sampler := newTraceTrackingSampler(trackingPercent, trackingRate)
+	flowMutex := newFlowMutex(ctx, debug, flowToStreamToSequenceMap, traceToHttpRequestMap, onSummary, sampler, ephemerals)
+	if correlations, ok := ctx.Value(ContextCorrelationIndex).(*CorrelationIndex); ok {
+		correlations.register(iface.Name, flowMutex)
+	}
+
+	sessionKeys, _ := ctx.Value(ContextSessionKeys).([]string)
+	compactRetransmissions, _ := ctx.Value(ContextCompactRetransmissions).(bool)
+	fields, _ := ctx.Value(ContextFields).([]string)
+
+	encodingName, _ := ctx.Value(ContextEncoding).(string)
+	encoding, err := newJSONEncoding(encodingName)
+	if err != nil {
+		// translations are written as JSON instead
+		loggerOf(ctx).Warn("translations are encoded as JSON", "error", err.Error())
+	}
+
+	var anomalies *anomalyDetector = nil
+	if enabled, _ := ctx.Value(ContextAnomalies).(bool); enabled {
+		anomalies = newAnomalyDetector()
+	}
+
+	var retries *httpRetryDetector = nil
+	if enabled, _ := ctx.Value(ContextRetries).(bool); enabled {
+		retries = newHTTPRetryDetector()
+	}
+
+	traces, _ := ctx.Value(ContextTraceStrategy).(*TraceStrategy)
+	traceSchemes, _ := ctx.Value(ContextTraceSchemes).([]string)
+	traceHeaders, _ := ctx.Value(ContextTraceHeaders).([]string)
+	scope, _ := ctx.Value(ContextTraceScope).(*TraceScope)
+	labels, _ := ctx.Value(ContextLabels).([]string)
+	cachePorts, _ := ctx.Value(ContextCachePorts).([]string)
+	hashCacheKeys, _ := ctx.Value(ContextHashCacheKeys).(bool)
+	dbPorts, _ := ctx.Value(ContextDBPorts).([]string)
+	dbQueries, _ := ctx.Value(ContextDBQueries).(bool)
+	brokerPorts, _ := ctx.Value(ContextBrokerPorts).([]string)
+	multicast, _ := ctx.Value(ContextMulticastGroups).(*MulticastGroups)
+	summary, _ := ctx.Value(ContextCaptureSummary).(*CaptureSummary)
+
+	var phases *connectionPhasesTracker = nil
+	connectionSetup, _ := ctx.Value(ContextConnectionSetup).(bool)
+	if connectionSetup {
+		phases = newConnectionPhasesTracker()
+	}
 
 	return &JSONPcapTranslator{
 		fm:                        flowMutex,
@@ -1703,5 +3399,26 @@ func newJSONPcapTranslator(
 		ephemerals:                ephemerals,
 		traceToHttpRequestMap:     traceToHttpRequestMap,
 		flowToStreamToSequenceMap: flowToStreamToSequenceMap,
+		sessions:                  newHTTPSessionHasher(sessionKeys),
+		compactRetransmissions:    compactRetransmissions,
+		fields:                    newJSONFieldsSelector(fields),
+		packets:                   newPacketIndex(),
+		anomalies:                 anomalies,
+		retries:                   retries,
+		encoding:                  encoding,
+		quic:                      newQUICConnectionIDs(),
+		phases:                    phases,
+		connectionSetup:           connectionSetup,
+		events:                    newFlowEvents(events),
+		traces:                    newTraceStrategy(traces, traceSchemes, traceHeaders),
+		labels:                    newRecordLabels(labels),
+		caches:                    newCachePorts(cachePorts, hashCacheKeys),
+		dbs:                       newDBPorts(dbPorts, dbQueries),
+		brokers:                   newBrokerPorts(brokerPorts),
+		rtp:                       newRTPTracker(),
+		vpn:                       newVPNTunnels(),
+		multicast:                 multicast,
+		summary:                   summary,
+		scope:                     scope,
 	}
 }
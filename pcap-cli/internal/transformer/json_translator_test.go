@@ -0,0 +1,106 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build json
+
+package transformer
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/Jeffail/gabs/v2"
+	"github.com/alphadose/haxmap"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSCTPTestPacket(t *testing.T, src, dst net.IP, srcPort, dstPort layers.SCTPPort, chunk ...byte) gopacket.Packet {
+	return newTestPacket(t, newTestIPv4(src, dst),
+		&layers.SCTP{SrcPort: srcPort, DstPort: dstPort, VerificationTag: 0x0a0b0c0d}, gopacket.Payload(chunk))
+}
+
+// TestSCTPAssociationTracking verifies that both directions of an association share the same conntrack state, which is released by ABORT.
+func TestSCTPAssociationTracking(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	summaries := make(chan *FlowSummaryEvent, 1)
+	translator := &JSONPcapTranslator{
+		fm: newFlowMutex(ctx, false,
+			haxmap.New[uint64, STSM](), haxmap.New[string, *httpRequest](),
+			func(summary *FlowSummaryEvent) { summaries <- summary }, nil, nil),
+	}
+
+	client, server := net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)
+	initChunk := []byte{0x01, 0x00, 0x00, 0x14, 0x00, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01}
+	initAckChunk := append([]byte{0x02}, initChunk[1:]...)
+	abortChunk := []byte{0x06, 0x00, 0x00, 0x04}
+
+	packets := []gopacket.Packet{
+		newSCTPTestPacket(t, client, server, 36412, 38412, initChunk...),
+		newSCTPTestPacket(t, server, client, 38412, 36412, initAckChunk...),
+		newSCTPTestPacket(t, client, server, 36412, 38412, abortChunk...),
+	}
+
+	flowIDs := make([]uint64, len(packets))
+	for i, packet := range packets {
+		sctp, ok := packet.Layer(layers.LayerTypeSCTP).(*layers.SCTP)
+		require.True(t, ok)
+		L4, ok := translator.translateSCTPLayer(ctx, sctp).(*gabs.Container)
+		require.True(t, ok)
+		flowIDs[i], _ = strconv.ParseUint(L4.S("L4", "flow").Data().(string), 10, 64)
+	}
+	// SCTP flow hashing does not depend on the direction of the packet
+	assert.Equal(t, flowIDs[0], flowIDs[1])
+	assert.Equal(t, flowIDs[0], flowIDs[2])
+	flowID := flowIDs[0]
+
+	serial := uint64(1)
+	lock, flags := translator.lockSCTPAssociation(ctx, &packets[0], &serial, &flowID, false)
+	assert.Equal(t, tcpSyn, flags)
+	summary := lock.Summary()
+	released, _ := lock.UnlockWithTCPFlags(ctx, &flags)
+	assert.False(t, released)
+
+	serial = 2
+	lock, flags = translator.lockSCTPAssociation(ctx, &packets[1], &serial, &flowID, true)
+	assert.Equal(t, tcpSyn|tcpAck, flags)
+	// the reply is tracked by the state created by the request
+	assert.Same(t, summary, lock.Summary())
+	assert.Equal(t, uintptr(1), translator.fm.MutexMap.Len())
+	lock.UnlockWithTCPFlags(ctx, &flags)
+
+	// once the capture is done, terminated associations are untracked immediately
+	done, stop := context.WithCancel(ctx)
+	stop()
+	serial = 3
+	lock, flags = translator.lockSCTPAssociation(done, &packets[2], &serial, &flowID, false)
+	assert.Equal(t, tcpRst, flags)
+	released, _ = lock.UnlockWithTCPFlags(done, &flags)
+	assert.True(t, released)
+	assert.Equal(t, uintptr(0), translator.fm.MutexMap.Len())
+
+	event := <-summaries
+	assert.Equal(t, "10.0.0.1:36412", event.Client.String())
+	assert.Equal(t, uint64(2), event.FwdPackets)
+	assert.Equal(t, uint64(1), event.BwdPackets)
+	assert.Equal(t, flowSummaryRST, event.Reason)
+}
@@ -0,0 +1,144 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"context"
+	"log/slog"
+	"math/bits"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/gopacket"
+)
+
+// latencyBudget tracks how long packets take since they are captured until their translations are written:
+//   - the p99 of every interval is estimated out of power of 2 buckets of microseconds, so observing is lock-free,
+//   - if the p99 exceeds the budget, a warning is logged; and if `maxFactor > 1`, fewer flows are translated:
+//     the sampling rate is doubled every interval the budget is exceeded, and halved once the p99 is within half of it.
+//
+// Flows sampled automatically are a subset of those sampled by `ContextFlowSampling`, so flows are never resumed midway.
+type latencyBudget struct {
+	budget    time.Duration
+	interval  time.Duration
+	baseRate  uint64
+	maxFactor uint64
+	factor    atomic.Uint64
+	buckets   [latencyBudgetBuckets]atomic.Uint64
+	logger    *slog.Logger
+}
+
+const (
+	// the last bucket holds all latencies above 2^38 microseconds; i/e: replayed captures
+	latencyBudgetBuckets  = 40
+	latencyBudgetInterval = 10 * time.Second
+)
+
+// newLatencyBudget returns `nil` if `budget` is not positive; `samplingRate` is the rate of `ContextFlowSampling`.
+func newLatencyBudget(budget time.Duration, samplingRate, maxFactor uint, logger *slog.Logger) *latencyBudget {
+	if budget <= 0 {
+		return nil
+	}
+	b := &latencyBudget{
+		budget:    budget,
+		interval:  latencyBudgetInterval,
+		baseRate:  uint64(max(samplingRate, 1)),
+		maxFactor: uint64(max(maxFactor, 1)),
+		logger:    logger,
+	}
+	b.factor.Store(1)
+	return b
+}
+
+// observe counts the latency of a written translation; `nil` safe.
+func (b *latencyBudget) observe(capturedAt, writtenAt time.Time) {
+	if b == nil || capturedAt.IsZero() {
+		return
+	}
+	latency := writtenAt.Sub(capturedAt).Microseconds()
+	bucket := 0
+	if latency > 0 {
+		bucket = min(bits.Len64(uint64(latency)), latencyBudgetBuckets-1)
+	}
+	b.buckets[bucket].Add(1)
+}
+
+// sample returns whether the packet must be translated while sampling is engaged; `nil` safe.
+func (b *latencyBudget) sample(packet gopacket.Packet) bool {
+	if b == nil {
+		return true
+	}
+	factor := b.factor.Load()
+	if factor <= 1 {
+		return true
+	}
+	hash, ok := flowSamplingHash(packet)
+	return !ok || hash%(b.baseRate*factor) == 0
+}
+
+// p99 resets all buckets, and returns the upper bound of the bucket holding the 99th percentile.
+func (b *latencyBudget) p99() (time.Duration, uint64) {
+	var counts [latencyBudgetBuckets]uint64
+	total := uint64(0)
+	for i := range b.buckets {
+		counts[i] = b.buckets[i].Swap(0)
+		total += counts[i]
+	}
+	if total == 0 {
+		return 0, 0
+	}
+	// the p99 is the smallest latency below which, at least, 99% of latencies are
+	rank, seen := total-total/100, uint64(0)
+	for i, count := range counts {
+		if seen += count; seen >= rank {
+			return time.Duration(uint64(1)<<i) * time.Microsecond, total
+		}
+	}
+	return time.Duration(uint64(1)<<(latencyBudgetBuckets-1)) * time.Microsecond, total
+}
+
+// evaluate compares the p99 of the last interval with the budget, and engages or disengages sampling accordingly.
+func (b *latencyBudget) evaluate() {
+	p99, packets := b.p99()
+	if packets == 0 {
+		return
+	}
+	factor := b.factor.Load()
+	if p99 > b.budget {
+		next := min(factor*2, b.maxFactor)
+		b.factor.Store(next)
+		b.logger.Warn("latency budget exceeded",
+			"p99", p99.String(), "budget", b.budget.String(), "packets", packets,
+			"sampling", b.baseRate*next, "engaged", next > factor)
+	} else if factor > 1 && p99 <= b.budget/2 {
+		next := factor / 2
+		b.factor.Store(next)
+		b.logger.Info("latency budget recovered",
+			"p99", p99.String(), "budget", b.budget.String(), "packets", packets, "sampling", b.baseRate*next)
+	}
+}
+
+func (b *latencyBudget) watch(ctx context.Context) {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			b.evaluate()
+		}
+	}
+}
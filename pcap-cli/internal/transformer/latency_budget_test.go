@@ -0,0 +1,78 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"bytes"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestLatencyBudget verifies that sampling is engaged, up to its max factor, while the p99 exceeds the budget,
+// that it is disengaged once latency recovers, and that automatically sampled flows are also sampled by the base rate.
+func TestLatencyBudget(t *testing.T) {
+	t.Parallel()
+
+	assert.Nil(t, newLatencyBudget(0, 1, 4, transformerLogger))
+
+	var logs bytes.Buffer
+	budget := newLatencyBudget(10*time.Millisecond, 2, 4, NewLogger(&logs, slog.LevelInfo))
+
+	observe := func(fast, slow int) {
+		now := time.Now()
+		for range fast {
+			budget.observe(now.Add(-time.Millisecond), now)
+		}
+		for range slow {
+			budget.observe(now.Add(-time.Second), now)
+		}
+	}
+
+	// 1% of slow packets is within the p99
+	observe(99, 1)
+	budget.evaluate()
+	assert.Equal(t, uint64(1), budget.factor.Load())
+	assert.Empty(t, logs.String())
+
+	for _, factor := range []uint64{2, 4, 4} {
+		observe(90, 10)
+		budget.evaluate()
+		assert.Equal(t, factor, budget.factor.Load())
+	}
+	assert.Contains(t, logs.String(), `"message":"latency budget exceeded"`)
+	assert.Contains(t, logs.String(), `"sampling":8`)
+
+	client, server := net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)
+	for port := range 1000 {
+		packet := newTestTCPPacket(t, client, server, layers.TCPPort(20000+port), 443)
+		if budget.sample(packet) {
+			assert.True(t, newFlowSampler(2).sample(packet))
+		}
+	}
+
+	// no packets: nothing to evaluate
+	budget.evaluate()
+	assert.Equal(t, uint64(4), budget.factor.Load())
+
+	observe(100, 0)
+	budget.evaluate()
+	assert.Equal(t, uint64(2), budget.factor.Load())
+	assert.Contains(t, logs.String(), `"message":"latency budget recovered"`)
+}
@@ -0,0 +1,92 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"sync/atomic"
+)
+
+// debugLevel logs debug records only while debugging is switched on; see `ContextDebugSwitch`.
+type debugLevel struct {
+	debug *atomic.Bool
+}
+
+func (l *debugLevel) Level() slog.Level {
+	if l.debug != nil && l.debug.Load() {
+		return slog.LevelDebug
+	}
+	return slog.LevelInfo
+}
+
+// Cloud Logging severities; see: https://cloud.google.com/logging/docs/reference/v2/rest/v2/LogEntry#LogSeverity
+func logSeverity(level slog.Level) string {
+	switch {
+	case level < slog.LevelInfo:
+		return "DEBUG"
+	case level < slog.LevelWarn:
+		return "INFO"
+	case level < slog.LevelError:
+		return "WARNING"
+	default:
+		return "ERROR"
+	}
+}
+
+// NewLogger creates a logger which writes JSON lines understood by Cloud Logging: `severity`, `message` and `time`;
+// records less severe than `level` are dropped.
+func NewLogger(w io.Writer, level slog.Leveler) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if len(groups) > 0 {
+				return attr
+			}
+			switch attr.Key {
+			case slog.LevelKey:
+				level, _ := attr.Value.Any().(slog.Level)
+				return slog.String("severity", logSeverity(level))
+			case slog.MessageKey:
+				attr.Key = "message"
+			}
+			return attr
+		},
+	}))
+}
+
+// newContextLogger returns the logger set as `ContextLogger`, or one which writes into `stderr`;
+// the latter only writes debug records while `debug`, or the debug switch, is on.
+func newContextLogger(ctx context.Context, debug bool) *slog.Logger {
+	if logger, ok := ctx.Value(ContextLogger).(*slog.Logger); ok && logger != nil {
+		return logger
+	}
+	debugSwitch, ok := ctx.Value(ContextDebugSwitch).(*atomic.Bool)
+	if !ok {
+		debugSwitch = new(atomic.Bool)
+		debugSwitch.Store(debug)
+	}
+	return NewLogger(os.Stderr, &debugLevel{debug: debugSwitch})
+}
+
+// loggerOf returns the logger of transformers created with `ctx`.
+func loggerOf(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(ContextLogger).(*slog.Logger); ok && logger != nil {
+		return logger
+	}
+	return transformerLogger
+}
@@ -0,0 +1,65 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestLogger verifies that logs are written using Cloud Logging severities, and that debug logs of the default logger
+// follow the debug switch while injected loggers are used as they are.
+func TestLogger(t *testing.T) {
+	t.Parallel()
+
+	var buffer bytes.Buffer
+	logger := NewLogger(&buffer, slog.LevelDebug)
+	logger.Debug("debug")
+	logger.Info("info", "writer", 1)
+	logger.Warn("warning")
+	logger.Error("error")
+
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	if !assert.Len(t, lines, 4) {
+		return
+	}
+	for i, severity := range []string{"DEBUG", "INFO", "WARNING", "ERROR"} {
+		entry := map[string]any{}
+		assert.NoError(t, json.Unmarshal([]byte(lines[i]), &entry))
+		assert.Equal(t, severity, entry["severity"])
+		assert.Equal(t, strings.ToLower(severity), entry["message"])
+		assert.NotContains(t, entry, "level")
+		assert.NotContains(t, entry, "msg")
+	}
+
+	debugSwitch := new(atomic.Bool)
+	ctx := context.WithValue(context.Background(), ContextDebugSwitch, debugSwitch)
+	defaultLogger := newContextLogger(ctx, true /* debug */)
+	assert.False(t, defaultLogger.Enabled(ctx, slog.LevelDebug))
+	debugSwitch.Store(true)
+	assert.True(t, defaultLogger.Enabled(ctx, slog.LevelDebug))
+
+	ctx = context.WithValue(ctx, ContextLogger, logger)
+	assert.Same(t, logger, newContextLogger(ctx, false /* debug */))
+	assert.Same(t, logger, loggerOf(ctx))
+	assert.Same(t, transformerLogger, loggerOf(context.Background()))
+}
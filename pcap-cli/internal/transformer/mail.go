@@ -0,0 +1,359 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"bytes"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Jeffail/gabs/v2"
+)
+
+type (
+	mailProtocol string
+
+	// mailLine summarizes a command or a reply; addresses, credentials and message bodies are never stored.
+	mailLine struct {
+		// commands only
+		verb string
+		// domain of `EHLO`/`HELO`/`MAIL FROM`/`RCPT TO`, or the `AUTH` mechanism
+		arg string
+		// IMAP commands and replies are tagged
+		tag string
+		// replies only; i/e: `250`, `+OK` or `NO`
+		code string
+		// SMTP enhanced status code; i/e: `5.7.1`
+		status string
+		// the reply switches the connection to TLS
+		startTLS bool
+	}
+
+	// mailFlow tracks the state of a mail connection which is needed to avoid decoding message bodies.
+	mailFlow struct {
+		// the client is sending a message body, or the server is sending a multi-line POP3 reply
+		data bool
+		// a POP3 command whose positive reply is multi-line was sent
+		multiline bool
+		// bytes of the current SMTP `BDAT` chunk which are yet to be sent
+		chunk uint64
+		// `STARTTLS` or `STLS` was sent: a positive reply switches the connection to TLS
+		startTLS bool
+		// IMAP replies to pipelined commands may precede the reply to `STARTTLS`
+		startTLSTag string
+		tls         bool
+	}
+)
+
+const (
+	mailProtocolSMTP mailProtocol = "smtp"
+	mailProtocolIMAP mailProtocol = "imap"
+	mailProtocolPOP3 mailProtocol = "pop3"
+
+	// lines beyond this limit are not reported for a single TCP segment
+	mailLinesLimit = 16
+)
+
+var (
+	// implicit TLS ports ( 465, 993, 995 ) are not included: nothing can be decoded
+	mailPorts = map[uint16]mailProtocol{
+		25:   mailProtocolSMTP,
+		587:  mailProtocolSMTP,
+		2525: mailProtocolSMTP,
+		110:  mailProtocolPOP3,
+		143:  mailProtocolIMAP,
+	}
+
+	mailDataTerminator = []byte("\r\n.\r\n")
+
+	smtpVerbs = map[string]struct{}{
+		"EHLO": {}, "HELO": {}, "LHLO": {}, "MAIL": {}, "RCPT": {}, "DATA": {}, "BDAT": {},
+		"RSET": {}, "NOOP": {}, "QUIT": {}, "VRFY": {}, "EXPN": {}, "HELP": {}, "AUTH": {},
+		"STARTTLS": {},
+	}
+
+	imapVerbs = map[string]struct{}{
+		"CAPABILITY": {}, "NOOP": {}, "LOGOUT": {}, "STARTTLS": {}, "AUTHENTICATE": {}, "LOGIN": {},
+		"SELECT": {}, "EXAMINE": {}, "CREATE": {}, "DELETE": {}, "RENAME": {}, "SUBSCRIBE": {},
+		"UNSUBSCRIBE": {}, "LIST": {}, "LSUB": {}, "STATUS": {}, "APPEND": {}, "CHECK": {},
+		"CLOSE": {}, "EXPUNGE": {}, "SEARCH": {}, "FETCH": {}, "STORE": {}, "COPY": {}, "MOVE": {},
+		"UID": {}, "IDLE": {}, "ENABLE": {}, "NAMESPACE": {}, "ID": {},
+	}
+
+	pop3Verbs = map[string]struct{}{
+		"USER": {}, "PASS": {}, "APOP": {}, "AUTH": {}, "STAT": {}, "LIST": {}, "RETR": {}, "DELE": {},
+		"NOOP": {}, "RSET": {}, "QUIT": {}, "TOP": {}, "UIDL": {}, "CAPA": {}, "STLS": {},
+	}
+
+	// see: https://datatracker.ietf.org/doc/html/rfc3463#section-2
+	smtpEnhancedStatus = regexp.MustCompile(`^[245]\.\d{1,3}\.\d{1,3}$`)
+)
+
+func newMailFlow() *mailFlow {
+	return &mailFlow{}
+}
+
+// mailLookup returns whether the segment was sent by the client: segments sent to the server port are.
+func mailLookup(srcPort, dstPort uint16) (mailProtocol, bool, bool) {
+	if protocol, ok := mailPorts[dstPort]; ok {
+		return protocol, true, true
+	}
+	if protocol, ok := mailPorts[srcPort]; ok {
+		return protocol, false, true
+	}
+	return "", false, false
+}
+
+// mailDomain returns the domain of an SMTP path; i/e: `<user@example.com> SIZE=1024` yields `example.com`.
+func mailDomain(path string) string {
+	path, _, _ = strings.Cut(strings.TrimSpace(path), " ")
+	if path == "<>" {
+		// null reverse-path: bounces
+		return "<>"
+	}
+	address, err := mail.ParseAddress(path)
+	if err != nil {
+		return ""
+	}
+	_, domain, _ := strings.Cut(address.Address, "@")
+	return strings.ToLower(domain)
+}
+
+// skipData consumes a message body, or a multi-line reply, up to its terminating line; it returns what follows it.
+func (f *mailFlow) skipData(data []byte) []byte {
+	if bytes.HasPrefix(data, mailDataTerminator[2:]) {
+		f.data = false
+		return data[len(mailDataTerminator)-2:]
+	}
+	if _, rest, ok := bytes.Cut(data, mailDataTerminator); ok {
+		f.data = false
+		return rest
+	}
+	return nil
+}
+
+// skipChunk consumes the current `BDAT` chunk; it returns what follows it.
+func (f *mailFlow) skipChunk(data []byte) []byte {
+	size := min(f.chunk, uint64(len(data)))
+	f.chunk -= size
+	return data[size:]
+}
+
+// lines decodes all complete lines in `data`; segments within message bodies or after `STARTTLS` yield no lines.
+func (f *mailFlow) lines(protocol mailProtocol, data []byte, fromClient bool) []*mailLine {
+	if f.tls {
+		return nil
+	}
+
+	// message bodies are sent by SMTP clients, and multi-line replies by POP3 servers
+	isData := fromClient == (protocol == mailProtocolSMTP)
+	if f.data && isData {
+		if data = f.skipData(data); len(data) == 0 {
+			return nil
+		}
+	}
+	if f.chunk > 0 && fromClient {
+		if data = f.skipChunk(data); len(data) == 0 {
+			return nil
+		}
+	}
+
+	lines := []*mailLine{}
+	for len(data) > 0 && len(lines) < mailLinesLimit {
+		rawLine, rest, ok := bytes.Cut(data, respSeparator)
+		if !ok {
+			break
+		}
+		data = rest
+
+		var line *mailLine
+		if fromClient {
+			line = f.command(protocol, string(rawLine))
+		} else {
+			line = f.reply(protocol, string(rawLine))
+		}
+		if line == nil {
+			continue
+		}
+		lines = append(lines, line)
+
+		if f.tls {
+			// anything after the reply is TLS
+			break
+		}
+		if f.data && isData {
+			// pipelined commands may follow the message body
+			if data = f.skipData(data); data == nil {
+				break
+			}
+		}
+		if f.chunk > 0 && fromClient {
+			data = f.skipChunk(data)
+		}
+	}
+	return lines
+}
+
+func (f *mailFlow) command(protocol mailProtocol, rawLine string) *mailLine {
+	line := &mailLine{}
+
+	fields := strings.Fields(rawLine)
+	if protocol == mailProtocolIMAP {
+		if len(fields) < 2 {
+			return nil
+		}
+		line.tag, fields = fields[0], fields[1:]
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+
+	line.verb = strings.ToUpper(fields[0])
+	verbs := smtpVerbs
+	switch protocol {
+	case mailProtocolIMAP:
+		verbs = imapVerbs
+	case mailProtocolPOP3:
+		verbs = pop3Verbs
+	}
+	if _, ok := verbs[line.verb]; !ok {
+		return nil
+	}
+
+	switch line.verb {
+	case "STARTTLS", "STLS":
+		f.startTLS, f.startTLSTag = true, line.tag
+	case "EHLO", "HELO", "LHLO":
+		if len(fields) > 1 {
+			line.arg = strings.ToLower(fields[1])
+		}
+	case "MAIL", "RCPT":
+		// `MAIL FROM:<...>` and `RCPT TO:<...>`: only the domain is reported
+		if _, path, ok := strings.Cut(rawLine, ":"); ok {
+			line.arg = mailDomain(path)
+		}
+	case "AUTH", "AUTHENTICATE":
+		if len(fields) > 1 {
+			line.arg = strings.ToUpper(fields[1])
+		}
+	case "BDAT":
+		// `BDAT {size} [LAST]`: the chunk immediately follows the command
+		if len(fields) > 1 {
+			f.chunk, _ = strconv.ParseUint(fields[1], 10, 64)
+		}
+	case "RETR", "TOP":
+		f.multiline = true
+	case "LIST", "UIDL", "CAPA":
+		// without arguments, the positive reply is a multi-line listing
+		f.multiline = protocol == mailProtocolPOP3 && len(fields) == 1
+	}
+	return line
+}
+
+func (f *mailFlow) reply(protocol mailProtocol, rawLine string) *mailLine {
+	line := &mailLine{}
+
+	switch protocol {
+	case mailProtocolSMTP:
+		// only the last line of multi-line replies is reported: `250-...` lines are continuations
+		if len(rawLine) < 3 || (len(rawLine) > 3 && rawLine[3] != ' ') {
+			return nil
+		}
+		line.code = rawLine[:3]
+		if fields := strings.Fields(rawLine[3:]); len(fields) > 0 && smtpEnhancedStatus.MatchString(fields[0]) {
+			line.status = fields[0]
+		}
+		switch line.code {
+		case "354":
+			f.data = true
+		case "220":
+			line.startTLS = f.startTLS
+		}
+		if line.code[0] != '2' && line.code[0] != '3' {
+			f.startTLS = false
+		}
+
+	case mailProtocolIMAP:
+		fields := strings.Fields(rawLine)
+		if len(fields) < 2 {
+			return nil
+		}
+		line.tag, line.code = fields[0], strings.ToUpper(fields[1])
+		switch line.code {
+		case "OK", "NO", "BAD", "PREAUTH", "BYE":
+		default:
+			// untagged data and continuation requests are not reported
+			return nil
+		}
+		if f.startTLS && line.tag == f.startTLSTag {
+			line.startTLS = line.code == "OK"
+			f.startTLS = false
+		}
+
+	case mailProtocolPOP3:
+		code, _, _ := strings.Cut(rawLine, " ")
+		if code != "+OK" && code != "-ERR" {
+			return nil
+		}
+		line.code = code
+		line.startTLS = f.startTLS && code == "+OK"
+		f.startTLS = false
+		f.data, f.multiline = f.multiline && code == "+OK", false
+	}
+
+	if line.startTLS {
+		f.startTLS = false
+		f.tls = true
+	}
+	return line
+}
+
+func (l *mailLine) toJSON() *gabs.Container {
+	lineJSON := gabs.New()
+	fields := []struct {
+		key, value string
+	}{
+		{"tag", l.tag}, {"verb", l.verb}, {"arg", l.arg}, {"code", l.code}, {"status", l.status},
+	}
+	for _, field := range fields {
+		if field.value != "" {
+			lineJSON.Set(field.value, field.key)
+		}
+	}
+	if l.startTLS {
+		lineJSON.Set(true, "starttls")
+	}
+	return lineJSON
+}
+
+func (l *mailLine) summary() string {
+	var summary string
+	switch {
+	case l.verb != "" && l.arg != "":
+		summary = l.verb + ":" + l.arg
+	case l.verb != "":
+		summary = l.verb
+	case l.status != "":
+		summary = l.code + ":" + l.status
+	default:
+		summary = l.code
+	}
+	if l.startTLS {
+		summary += ":starttls"
+	}
+	return summary
+}
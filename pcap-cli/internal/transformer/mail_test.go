@@ -0,0 +1,103 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mailSummaries(lines []*mailLine) []string {
+	summaries := make([]string, len(lines))
+	for i, line := range lines {
+		summaries[i] = line.summary()
+	}
+	return summaries
+}
+
+// TestMailSMTP verifies that addresses are reduced to domains, bodies are skipped, and `STARTTLS` switches the flow to TLS.
+func TestMailSMTP(t *testing.T) {
+	t.Parallel()
+
+	flow := newMailFlow()
+	smtp := func(data string, fromClient bool) []string {
+		return mailSummaries(flow.lines(mailProtocolSMTP, []byte(data), fromClient))
+	}
+
+	assert.Equal(t, []string{"220"}, smtp("220 mx.example.com ESMTP ready\r\n", false))
+	assert.Equal(t, []string{"EHLO:client.example.org"}, smtp("EHLO client.example.org\r\n", true))
+	assert.Equal(t, []string{"250"}, smtp("250-mx.example.com\r\n250-PIPELINING\r\n250 STARTTLS\r\n", false))
+	assert.Equal(t,
+		[]string{"MAIL:example.org", "RCPT:example.com", "DATA"},
+		smtp("MAIL FROM:<Sender@Example.org> SIZE=42\r\nRCPT TO:<rcpt@example.com>\r\nDATA\r\n", true))
+	assert.Equal(t, []string{"250:2.1.0", "250:2.1.5", "354"}, smtp("250 2.1.0 Ok\r\n250 2.1.5 Ok\r\n354 End data\r\n", false))
+
+	// message bodies may look like commands
+	assert.Empty(t, smtp("Subject: test\r\nRSET\r\n", true))
+	assert.Equal(t, []string{"QUIT"}, smtp("more\r\n.\r\nQUIT\r\n", true))
+	assert.Equal(t, []string{"550:5.7.1"}, smtp("550 5.7.1 <rcpt@example.com>: Relay access denied\r\n", false))
+
+	// `BDAT` chunks immediately follow the command
+	assert.Equal(t, []string{"BDAT", "NOOP"}, smtp("BDAT 6 LAST\r\nRSET\r\nNOOP\r\n", true))
+
+	assert.Equal(t, []string{"STARTTLS"}, smtp("STARTTLS\r\n", true))
+	assert.Equal(t, []string{"220:2.0.0:starttls"}, smtp("220 2.0.0 Ready to start TLS\r\n", false))
+	assert.True(t, flow.tls)
+	assert.Empty(t, smtp("EHLO client.example.org\r\n", true))
+}
+
+// TestMailPOP3 verifies that multi-line replies are skipped, and credentials are never translated.
+func TestMailPOP3(t *testing.T) {
+	t.Parallel()
+
+	flow := newMailFlow()
+	pop3 := func(data string, fromClient bool) []*mailLine {
+		return flow.lines(mailProtocolPOP3, []byte(data), fromClient)
+	}
+
+	lines := pop3("USER alice\r\nPASS secret\r\n", true)
+	assert.Equal(t, []string{"USER", "PASS"}, mailSummaries(lines))
+	assert.Empty(t, lines[0].arg)
+	assert.Empty(t, lines[1].arg)
+
+	assert.Equal(t, []string{"RETR"}, mailSummaries(pop3("RETR 1\r\n", true)))
+	assert.Equal(t, []string{"+OK"}, mailSummaries(pop3("+OK 120 octets\r\n-ERR inside body\r\n", false)))
+	assert.Equal(t, []string{"-ERR"}, mailSummaries(pop3("+OK still body\r\n.\r\n-ERR no such message\r\n", false)))
+}
+
+func TestMailIMAP(t *testing.T) {
+	t.Parallel()
+
+	flow := newMailFlow()
+	lines := flow.lines(mailProtocolIMAP, []byte("a1 LOGIN alice secret\r\na2 STARTTLS\r\n"), true)
+	if assert.Len(t, lines, 2) {
+		assert.Equal(t, "a1", lines[0].tag)
+		assert.Equal(t, "LOGIN", lines[0].verb)
+		assert.Empty(t, lines[0].arg)
+	}
+
+	lines = flow.lines(mailProtocolIMAP, []byte("* CAPABILITY IMAP4rev1\r\na1 NO [AUTHENTICATIONFAILED]\r\na2 OK Begin TLS\r\n"), false)
+	assert.Equal(t, []string{"NO", "OK:starttls"}, mailSummaries(lines))
+	assert.True(t, flow.tls)
+}
+
+func TestMailDomain(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "example.com", mailDomain("<user@Example.COM> SIZE=1024"))
+	assert.Equal(t, "<>", mailDomain("<>"))
+	assert.Empty(t, mailDomain("not an address"))
+}
@@ -0,0 +1,234 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"maps"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+type (
+	// multicastRecord is a change, or the current state, of the membership of a host to a multicast group.
+	multicastRecord struct {
+		group   net.IP
+		mode    string
+		sources []net.IP
+		// `false` means that the host stops listening to the group
+		join bool
+	}
+
+	// multicastMessage is an IGMP or MLD message:
+	//   - see: https://datatracker.ietf.org/doc/html/rfc3376#section-4
+	//   - see: https://datatracker.ietf.org/doc/html/rfc3810#section-5
+	multicastMessage struct {
+		proto       string
+		version     uint8
+		messageType string
+		// only available for group specific queries
+		group   net.IP
+		records []*multicastRecord
+	}
+
+	// MulticastMembership is a multicast group joined by hosts reachable through an interface.
+	MulticastMembership struct {
+		Iface      string
+		Group      string
+		Members    []string
+		LastReport time.Time
+	}
+
+	// MulticastGroups tracks the multicast groups joined by hosts, as reported by IGMP and MLD messages.
+	MulticastGroups struct {
+		mu sync.Mutex
+		// memberships indexed by interface and group
+		memberships map[string]*MulticastMembership
+	}
+)
+
+const (
+	multicastProtoIGMP = "igmp"
+	multicastProtoMLD  = "mld"
+
+	multicastQuery  = "query"
+	multicastReport = "report"
+	multicastLeave  = "leave"
+
+	multicastGroupsLimit  = 1024
+	multicastMembersLimit = 256
+)
+
+func NewMulticastGroups() *MulticastGroups {
+	return &MulticastGroups{memberships: make(map[string]*MulticastMembership)}
+}
+
+// Memberships returns a snapshot of the multicast groups joined by at least one host; `nil` safe.
+func (g *MulticastGroups) Memberships() []MulticastMembership {
+	if g == nil {
+		return nil
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	memberships := make([]MulticastMembership, 0, len(g.memberships))
+	for _, key := range slices.Sorted(maps.Keys(g.memberships)) {
+		membership := *g.memberships[key]
+		membership.Members = slices.Clone(membership.Members)
+		memberships = append(memberships, membership)
+	}
+	return memberships
+}
+
+// observe applies the records reported by `member` to the memberships of `iface`; queries do not change memberships.
+func (g *MulticastGroups) observe(iface, member string, message *multicastMessage, timestamp time.Time) {
+	if g == nil || message.messageType == multicastQuery {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, record := range message.records {
+		group := record.group.String()
+		key := iface + "/" + group
+		membership, ok := g.memberships[key]
+
+		if !record.join {
+			if !ok {
+				continue
+			}
+			if membership.Members = slices.DeleteFunc(membership.Members,
+				func(m string) bool { return m == member }); len(membership.Members) == 0 {
+				delete(g.memberships, key)
+			}
+			continue
+		}
+
+		if !ok {
+			if len(g.memberships) >= multicastGroupsLimit {
+				// groups are not expired: start over instead of growing forever
+				g.memberships = make(map[string]*MulticastMembership)
+			}
+			membership = &MulticastMembership{Iface: iface, Group: group}
+			g.memberships[key] = membership
+		}
+		if !slices.Contains(membership.Members, member) && len(membership.Members) < multicastMembersLimit {
+			membership.Members = append(membership.Members, member)
+		}
+		membership.LastReport = timestamp
+	}
+}
+
+// multicastJoins tells if a IGMPv3/MLDv2 record type, along with its sources, means that the host listens to the group:
+//   - `INCLUDE` mode without sources means that the host does not listen to the group,
+//   - `BLOCK_OLD_SOURCES` does not change whether the host listens to the group, so it is reported as a join.
+func multicastJoins(recordType uint8, sources int) bool {
+	switch recordType {
+	// MODE_IS_INCLUDE, CHANGE_TO_INCLUDE_MODE
+	case 0x01, 0x03:
+		return sources > 0
+	default:
+		return true
+	}
+}
+
+// parseMulticast returns the IGMP or MLD message carried by `packet`.
+func parseMulticast(packet gopacket.Packet) *multicastMessage {
+	for _, layer := range packet.Layers() {
+		switch l := layer.(type) {
+		case *layers.IGMPv1or2:
+			message := &multicastMessage{proto: multicastProtoIGMP, version: l.Version}
+			switch l.Type {
+			case layers.IGMPMembershipQuery:
+				message.messageType = multicastQuery
+				if !l.GroupAddress.IsUnspecified() {
+					message.group = l.GroupAddress
+				}
+			case layers.IGMPLeaveGroup:
+				message.messageType = multicastLeave
+				message.records = []*multicastRecord{{group: l.GroupAddress}}
+			default:
+				message.messageType = multicastReport
+				message.records = []*multicastRecord{{group: l.GroupAddress, join: true}}
+			}
+			return message
+
+		case *layers.IGMP:
+			message := &multicastMessage{proto: multicastProtoIGMP, version: l.Version}
+			if l.Type == layers.IGMPMembershipQuery {
+				message.messageType = multicastQuery
+				if !l.GroupAddress.IsUnspecified() {
+					message.group = l.GroupAddress
+				}
+				return message
+			}
+			message.messageType = multicastReport
+			for _, record := range l.GroupRecords {
+				message.records = append(message.records, &multicastRecord{
+					group:   record.MulticastAddress,
+					mode:    record.Type.String(),
+					sources: record.SourceAddresses,
+					join:    multicastJoins(uint8(record.Type), len(record.SourceAddresses)),
+				})
+			}
+			return message
+
+		case *layers.MLDv1MulticastListenerQueryMessage:
+			message := &multicastMessage{proto: multicastProtoMLD, version: 1, messageType: multicastQuery}
+			if !l.MulticastAddress.IsUnspecified() {
+				message.group = l.MulticastAddress
+			}
+			return message
+
+		case *layers.MLDv2MulticastListenerQueryMessage:
+			message := &multicastMessage{proto: multicastProtoMLD, version: 2, messageType: multicastQuery}
+			if !l.MulticastAddress.IsUnspecified() {
+				message.group = l.MulticastAddress
+			}
+			return message
+
+		case *layers.MLDv1MulticastListenerReportMessage:
+			return &multicastMessage{
+				proto: multicastProtoMLD, version: 1, messageType: multicastReport,
+				records: []*multicastRecord{{group: l.MulticastAddress, join: true}},
+			}
+
+		case *layers.MLDv1MulticastListenerDoneMessage:
+			return &multicastMessage{
+				proto: multicastProtoMLD, version: 1, messageType: multicastLeave,
+				records: []*multicastRecord{{group: l.MulticastAddress}},
+			}
+
+		case *layers.MLDv2MulticastListenerReportMessage:
+			message := &multicastMessage{proto: multicastProtoMLD, version: 2, messageType: multicastReport}
+			for _, record := range l.MulticastAddressRecords {
+				message.records = append(message.records, &multicastRecord{
+					group:   record.MulticastAddress,
+					mode:    record.RecordType.String(),
+					sources: record.SourceAddresses,
+					join:    multicastJoins(uint8(record.RecordType), len(record.SourceAddresses)),
+				})
+			}
+			return message
+		}
+	}
+	return nil
+}
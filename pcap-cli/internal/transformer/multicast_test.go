@@ -0,0 +1,75 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newMulticastReport(join bool, groups ...string) *multicastMessage {
+	message := &multicastMessage{proto: multicastProtoIGMP, version: 3, messageType: multicastReport}
+	for _, group := range groups {
+		message.records = append(message.records, &multicastRecord{group: net.ParseIP(group), join: join})
+	}
+	return message
+}
+
+// TestMulticastGroups verifies that reports add members, leaves remove them, and groups without members are forgotten.
+func TestMulticastGroups(t *testing.T) {
+	t.Parallel()
+
+	groups := NewMulticastGroups()
+	timestamp := time.Unix(1700000000, 0)
+
+	groups.observe("eth0", "10.0.0.2", newMulticastReport(true, "239.1.1.1", "239.2.2.2"), timestamp)
+	groups.observe("eth0", "10.0.0.3", newMulticastReport(true, "239.1.1.1"), timestamp.Add(time.Second))
+	groups.observe("eth0", "10.0.0.3", &multicastMessage{messageType: multicastQuery}, timestamp.Add(2*time.Second))
+
+	memberships := groups.Memberships()
+	if assert.Len(t, memberships, 2) {
+		assert.Equal(t, "239.1.1.1", memberships[0].Group)
+		assert.Equal(t, []string{"10.0.0.2", "10.0.0.3"}, memberships[0].Members)
+		assert.Equal(t, timestamp.Add(time.Second), memberships[0].LastReport)
+		assert.Equal(t, "239.2.2.2", memberships[1].Group)
+	}
+
+	// snapshots must not be affected by later reports
+	memberships[0].Members[0] = "10.0.0.9"
+	groups.observe("eth0", "10.0.0.2", newMulticastReport(false, "239.1.1.1", "239.2.2.2"), timestamp)
+
+	memberships = groups.Memberships()
+	if assert.Len(t, memberships, 1) {
+		assert.Equal(t, "eth0", memberships[0].Iface)
+		assert.Equal(t, []string{"10.0.0.3"}, memberships[0].Members)
+	}
+
+	var disabled *MulticastGroups
+	disabled.observe("eth0", "10.0.0.2", newMulticastReport(true, "239.1.1.1"), timestamp)
+	assert.Nil(t, disabled.Memberships())
+}
+
+func TestMulticastJoins(t *testing.T) {
+	t.Parallel()
+
+	// INCLUDE mode without sources is how IGMPv3 and MLDv2 hosts leave a group
+	assert.False(t, multicastJoins(0x03, 0))
+	assert.True(t, multicastJoins(0x03, 2))
+	assert.True(t, multicastJoins(0x04, 0))
+	assert.True(t, multicastJoins(0x02, 0))
+}
@@ -0,0 +1,89 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	ntpModeServer = 4
+	// seconds between the NTP prime epoch ( 1900-01-01 ) and the UNIX epoch
+	ntpEpochOffset = 2208988800
+)
+
+// see: https://datatracker.ietf.org/doc/html/rfc5905#section-7.3
+var ntpModes = [8]string{
+	"reserved",
+	"symmetric_active",
+	"symmetric_passive",
+	"client",
+	"server",
+	"broadcast",
+	"control",
+	"private",
+}
+
+func ntpMode(ntp *layers.NTP) string {
+	return ntpModes[ntp.Mode&0x07]
+}
+
+// ntpTime returns the zero time for unset timestamps; timestamps with the most significant bit unset
+// are assumed to belong to era 1 ( after 2036-02-07 ); see: https://datatracker.ietf.org/doc/html/rfc5905#section-6
+func ntpTime(timestamp layers.NTPTimestamp) time.Time {
+	if timestamp == 0 {
+		return time.Time{}
+	}
+	seconds := int64(timestamp >> 32)
+	if seconds&0x80000000 == 0 {
+		seconds += 1 << 32
+	}
+	fraction := int64(uint32(timestamp))
+	return time.Unix(seconds-ntpEpochOffset, (fraction*int64(time.Second))>>32).UTC()
+}
+
+// ntpReferenceID returns the clock source or kiss code for stratum 0 and 1, and the upstream server otherwise;
+// IPv6 upstream servers are hashed, so they look like IPv4 addresses; see: https://datatracker.ietf.org/doc/html/rfc5905#section-7.3
+func ntpReferenceID(ntp *layers.NTP) string {
+	id := uint32(ntp.ReferenceID)
+	if ntp.Stratum > 1 {
+		return net.IPv4(byte(id>>24), byte(id>>16), byte(id>>8), byte(id)).String()
+	}
+	return strings.TrimRight(string([]byte{byte(id >> 24), byte(id >> 16), byte(id >> 8), byte(id)}), "\x00")
+}
+
+// ntpOffset estimates the clock offset and round trip delay of the client receiving a server response:
+//   - `origin` is the time when the request left the client,
+//   - `receive` and `transmit` are the times when the server received the request and sent the response,
+//   - `arrival` is the time when the response was captured; the estimate is only meaningful if the capture happens on the client.
+//
+// A positive offset means the client clock is behind the server clock; see: https://datatracker.ietf.org/doc/html/rfc5905#section-8
+func ntpOffset(origin, receive, transmit, arrival time.Time) (offset, delay time.Duration, ok bool) {
+	if origin.IsZero() || receive.IsZero() || transmit.IsZero() || arrival.IsZero() {
+		return 0, 0, false
+	}
+	offset = (receive.Sub(origin) + transmit.Sub(arrival)) / 2
+	delay = arrival.Sub(origin) - transmit.Sub(receive)
+	return offset, delay, true
+}
+
+// ntpMillis renders durations as milliseconds with microsecond precision.
+func ntpMillis(duration time.Duration) float64 {
+	return float64(duration.Microseconds()) / 1000
+}
@@ -0,0 +1,67 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestNTPTime verifies that NTP timestamps are converted from the prime epoch, including era 1.
+func TestNTPTime(t *testing.T) {
+	t.Parallel()
+
+	assert.True(t, ntpTime(0).IsZero())
+
+	// 2024-01-01T00:00:00.5Z
+	timestamp := layers.NTPTimestamp(uint64(1704067200+ntpEpochOffset)<<32 | 1<<31)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 500000000, time.UTC), ntpTime(timestamp))
+
+	// 2036-02-07T06:28:16Z is the first second of era 1
+	assert.Equal(t, time.Date(2036, 2, 7, 6, 28, 17, 0, time.UTC), ntpTime(layers.NTPTimestamp(1)<<32))
+}
+
+// TestNTPReferenceID verifies that reference IDs are rendered as clock sources for primary servers, and as addresses otherwise.
+func TestNTPReferenceID(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "GPS", ntpReferenceID(&layers.NTP{Stratum: 1, ReferenceID: 0x47505300}))
+	assert.Equal(t, "RATE", ntpReferenceID(&layers.NTP{Stratum: 0, ReferenceID: 0x52415445}))
+	assert.Equal(t, "169.254.169.254", ntpReferenceID(&layers.NTP{Stratum: 2, ReferenceID: 0xa9fea9fe}))
+}
+
+// TestNTPOffset verifies the offset and delay estimates of a client whose clock is behind the server clock.
+func TestNTPOffset(t *testing.T) {
+	t.Parallel()
+
+	origin := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	// the client clock is 50ms behind, and each direction takes 10ms
+	receive := origin.Add(60 * time.Millisecond)
+	transmit := receive.Add(time.Millisecond)
+	arrival := origin.Add(21 * time.Millisecond)
+
+	offset, delay, ok := ntpOffset(origin, receive, transmit, arrival)
+	if assert.True(t, ok) {
+		assert.Equal(t, 50*time.Millisecond, offset)
+		assert.Equal(t, 20*time.Millisecond, delay)
+		assert.Equal(t, 50.0, ntpMillis(offset))
+	}
+
+	_, _, ok = ntpOffset(time.Time{}, receive, transmit, arrival)
+	assert.False(t, ok)
+}
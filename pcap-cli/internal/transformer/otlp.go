@@ -0,0 +1,127 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"github.com/Jeffail/gabs/v2"
+)
+
+// otlpHTTPExchange is a response linked to its request by trace ID; it is exported as a `Span` lasting from
+// the request until the response.
+type otlpHTTPExchange struct {
+	method, url, rpc string
+	start            time.Time
+	// zero if not available; i/e: gRPC responses whose status is only sent in trailers
+	code int
+}
+
+const (
+	otlpTraceIDSize = 16 // bytes
+	otlpSpanIDSize  = 8  // bytes
+
+	// W3C trace flags are available in the lower 8 bits of `LogRecord.flags`
+	//   - see: https://www.w3.org/TR/trace-context/#sampled-flag
+	otlpTraceFlagsSampled = uint32(0x01)
+)
+
+// OTLPSpanFrame flags the size of length-prefixed records that are `Span`s instead of `LogRecord`s;
+// records are much smaller than 2GiB, so the most significant bit of their size is always available.
+const OTLPSpanFrame = uint32(1) << 31
+
+// otlpTraceAndSpanIDs converts trace and span IDs extracted from HTTP headers into OTLP binary IDs:
+//   - `traceparent` carries both IDs as hex strings,
+//   - `X-Cloud-Trace-Context` carries the span ID as a decimal number.
+//
+// `nil` is returned for any ID that cannot be converted.
+func otlpTraceAndSpanIDs(traceID, spanID string) ([]byte, []byte) {
+	var traceIDBytes, spanIDBytes []byte
+
+	if b, err := hex.DecodeString(traceID); err == nil && len(b) == otlpTraceIDSize {
+		traceIDBytes = b
+	}
+
+	if b, err := hex.DecodeString(spanID); err == nil && len(spanID) == 2*otlpSpanIDSize {
+		spanIDBytes = b
+	} else if id, err := strconv.ParseUint(spanID, 10, 64); err == nil {
+		spanIDBytes = binary.BigEndian.AppendUint64(nil, id)
+	}
+
+	return traceIDBytes, spanIDBytes
+}
+
+// otlpHTTPExchanges returns the exchanges completed by responses in the translation:
+//   - HTTP/1.1 responses are translated into the `HTTP` node,
+//   - HTTP/2 responses are translated into the frames of each stream.
+func otlpHTTPExchanges(json *gabs.Container) []*otlpHTTPExchange {
+	HTTP := json.S("HTTP")
+	if HTTP == nil {
+		return nil
+	}
+
+	exchanges := []*otlpHTTPExchange{}
+	if exchange := otlpHTTPExchangeOf(HTTP); exchange != nil {
+		exchange.code, _ = HTTP.S("code").Data().(int)
+		exchanges = append(exchanges, exchange)
+	}
+
+	for _, stream := range HTTP.S("streams").ChildrenMap() {
+		for _, frame := range stream.S("frames").Children() {
+			// frames are appended as containers
+			if container, ok := frame.Data().(*gabs.Container); ok {
+				frame = container
+			}
+			exchange := otlpHTTPExchangeOf(frame)
+			if exchange == nil {
+				continue
+			}
+			if status, ok := frame.S("headers", ":status").Data().([]string); ok && len(status) > 0 {
+				exchange.code, _ = strconv.Atoi(status[0])
+			}
+			exchanges = append(exchanges, exchange)
+		}
+	}
+
+	return exchanges
+}
+
+func otlpHTTPExchangeOf(message *gabs.Container) *otlpHTTPExchange {
+	if kind, _ := message.S("kind").Data().(string); kind != "response" {
+		return nil
+	}
+	request := message.S("request")
+	if request == nil {
+		return nil
+	}
+	rawTimestamp, _ := request.S("timestamp").Data().(string)
+	start, err := time.Parse(time.RFC3339Nano, rawTimestamp)
+	if err != nil {
+		return nil
+	}
+	exchange := &otlpHTTPExchange{start: start}
+	exchange.method, _ = request.S("method").Data().(string)
+	exchange.url, _ = request.S("url").Data().(string)
+	exchange.rpc, _ = request.S("rpc").Data().(string)
+	return exchange
+}
+
+// isError follows OpenTelemetry semantic conventions: `4xx` responses are only errors for clients.
+func (e *otlpHTTPExchange) isError(client bool) bool {
+	return e.code >= 500 || (client && e.code >= 400)
+}
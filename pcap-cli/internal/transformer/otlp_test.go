@@ -0,0 +1,100 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Jeffail/gabs/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestOTLPTraceAndSpanIDs verifies conversion of both `traceparent` and `X-Cloud-Trace-Context` IDs.
+func TestOTLPTraceAndSpanIDs(t *testing.T) {
+	t.Parallel()
+
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	expectedTraceID := []byte{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36}
+
+	tests := []struct {
+		name            string
+		traceID         string
+		spanID          string
+		expectedTraceID []byte
+		expectedSpanID  []byte
+	}{
+		{"traceparent", traceID, "00f067aa0ba902b7", expectedTraceID, []byte{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7}},
+		{"x-cloud-trace-context", traceID, "1", expectedTraceID, []byte{0, 0, 0, 0, 0, 0, 0, 1}},
+		{"invalid trace", "4bf92f35", "1", nil, []byte{0, 0, 0, 0, 0, 0, 0, 1}},
+		{"invalid span", traceID, "span", expectedTraceID, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			traceID, spanID := otlpTraceAndSpanIDs(tc.traceID, tc.spanID)
+			assert.Equal(t, tc.expectedTraceID, traceID)
+			assert.Equal(t, tc.expectedSpanID, spanID)
+		})
+	}
+}
+
+// TestOTLPHTTPExchanges verifies that HTTP/1.1 and HTTP/2 responses linked to their requests become exchanges.
+func TestOTLPHTTPExchanges(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	json := gabs.New()
+	json.Set("response", "HTTP", "kind")
+	json.Set(503, "HTTP", "code")
+	json.Set("GET", "HTTP", "request", "method")
+	json.Set("/health", "HTTP", "request", "url")
+	json.Set(start.Format(time.RFC3339Nano), "HTTP", "request", "timestamp")
+
+	exchanges := otlpHTTPExchanges(json)
+	if assert.Len(t, exchanges, 1) {
+		assert.Equal(t, "GET", exchanges[0].method)
+		assert.Equal(t, "/health", exchanges[0].url)
+		assert.Equal(t, start, exchanges[0].start)
+		assert.True(t, exchanges[0].isError(false))
+	}
+
+	// requests are not exchanges, and neither are responses not linked to a request
+	json = gabs.New()
+	json.Set("request", "HTTP", "kind")
+	assert.Empty(t, otlpHTTPExchanges(json))
+	json.Set("response", "HTTP", "kind")
+	assert.Empty(t, otlpHTTPExchanges(json))
+	assert.Empty(t, otlpHTTPExchanges(gabs.New()))
+
+	frame := gabs.New()
+	frame.Set("response", "kind")
+	frame.Set([]string{"404"}, "headers", ":status")
+	frame.Set("POST", "request", "method")
+	frame.Set("/pkg.Service/Method", "request", "rpc")
+	frame.Set(start.Format(time.RFC3339Nano), "request", "timestamp")
+	json = gabs.New()
+	json.ArrayAppend(frame, "HTTP", "streams", "1", "frames")
+
+	exchanges = otlpHTTPExchanges(json)
+	if assert.Len(t, exchanges, 1) {
+		assert.Equal(t, 404, exchanges[0].code)
+		assert.Equal(t, "/pkg.Service/Method", exchanges[0].rpc)
+		assert.False(t, exchanges[0].isError(false))
+		assert.True(t, exchanges[0].isError(true))
+	}
+}
@@ -0,0 +1,370 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build json && otlp
+
+package transformer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Jeffail/gabs/v2"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/pkg/errors"
+	commonv1 "go.opentelemetry.io/proto/otlp/common/v1"
+	logsv1 "go.opentelemetry.io/proto/otlp/logs/v1"
+	tracev1 "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+type (
+	// OTLPPcapTranslator relies on `JSONPcapTranslator` to analyze packets,
+	// and then wraps translations into OpenTelemetry `LogRecord`s:
+	//   - the JSON translation is the body of the `LogRecord`,
+	//   - `trace_id` and `span_id` are populated from HTTP tracing headers,
+	//   - DNS lookups and TLS handshakes that preceded the 1st traced request of a connection are reported as child `Span`s,
+	//   - responses linked to their requests are reported as `Span`s lasting from the request until the response.
+	OTLPPcapTranslator struct {
+		*JSONPcapTranslator
+	}
+
+	otlpTranslation struct {
+		*logsv1.LogRecord
+		spans []*tracev1.Span
+	}
+)
+
+const (
+	otlpSeverityTextInfo  = "INFO"
+	otlpSeverityTextError = "ERROR"
+)
+
+func init() {
+	registerTranslator(OTLP, newOTLPPcapTranslator)
+}
+
+func otlpStringAttribute(key, value string) *commonv1.KeyValue {
+	return &commonv1.KeyValue{
+		Key: key,
+		Value: &commonv1.AnyValue{
+			Value: &commonv1.AnyValue_StringValue{StringValue: value},
+		},
+	}
+}
+
+func otlpIntAttribute(key string, value int64) *commonv1.KeyValue {
+	return &commonv1.KeyValue{
+		Key: key,
+		Value: &commonv1.AnyValue{
+			Value: &commonv1.AnyValue_IntValue{IntValue: value},
+		},
+	}
+}
+
+func (t *OTLPPcapTranslator) attributes(json *gabs.Container) []*commonv1.KeyValue {
+	attributes := make([]*commonv1.KeyValue, 0, 10)
+
+	if flowID, ok := json.S("flow").Data().(string); ok {
+		attributes = append(attributes, otlpStringAttribute("pcap.flow", flowID))
+	}
+	if index, ok := json.S("iface", "index").Data().(uint8); ok {
+		attributes = append(attributes, otlpIntAttribute("pcap.iface.index", int64(index)))
+	}
+	if name, ok := json.S("iface", "name").Data().(string); ok {
+		attributes = append(attributes, otlpStringAttribute("network.interface.name", name))
+	}
+
+	srcIP, srcOK := json.S("L3", "src").Data().(net.IP)
+	dstIP, dstOK := json.S("L3", "dst").Data().(net.IP)
+	if !srcOK || !dstOK {
+		return attributes
+	}
+
+	if srcIP.To4() != nil {
+		attributes = append(attributes, otlpStringAttribute("network.type", "ipv4"))
+	} else {
+		attributes = append(attributes, otlpStringAttribute("network.type", "ipv6"))
+	}
+	attributes = append(attributes,
+		otlpStringAttribute("source.address", srcIP.String()),
+		otlpStringAttribute("destination.address", dstIP.String()))
+
+	switch proto, _ := json.S("L3", "proto", "num").Data().(layers.IPProtocol); proto {
+	case layers.IPProtocolTCP:
+		srcPort, _ := json.S("L4", "src").Data().(layers.TCPPort)
+		dstPort, _ := json.S("L4", "dst").Data().(layers.TCPPort)
+		attributes = append(attributes,
+			otlpStringAttribute("network.transport", "tcp"),
+			otlpIntAttribute("source.port", int64(srcPort)),
+			otlpIntAttribute("destination.port", int64(dstPort)))
+	case layers.IPProtocolUDP:
+		srcPort, _ := json.S("L4", "src").Data().(layers.UDPPort)
+		dstPort, _ := json.S("L4", "dst").Data().(layers.UDPPort)
+		attributes = append(attributes,
+			otlpStringAttribute("network.transport", "udp"),
+			otlpIntAttribute("source.port", int64(srcPort)),
+			otlpIntAttribute("destination.port", int64(dstPort)))
+	case layers.IPProtocolSCTP:
+		srcPort, _ := json.S("L4", "src").Data().(layers.SCTPPort)
+		dstPort, _ := json.S("L4", "dst").Data().(layers.SCTPPort)
+		attributes = append(attributes,
+			otlpStringAttribute("network.transport", "sctp"),
+			otlpIntAttribute("source.port", int64(srcPort)),
+			otlpIntAttribute("destination.port", int64(dstPort)))
+	}
+
+	return attributes
+}
+
+// for OTLP translator, this method wraps the JSON translation into an OpenTelemetry `LogRecord`
+func (t *OTLPPcapTranslator) finalize(
+	ctx context.Context,
+	ifaces netIfaceIndex,
+	iface *PcapIface,
+	serial *uint64,
+	p *gopacket.Packet,
+	conntrack bool,
+	packet fmt.Stringer,
+) (fmt.Stringer, error) {
+	// JSON translation is always available, even if `finalize` fails
+	translation, err := t.JSONPcapTranslator.finalizeJSON(ctx, ifaces, iface, serial, p, conntrack, packet)
+
+	json := t.asTranslation(translation)
+
+	record := &logsv1.LogRecord{
+		TimeUnixNano:         uint64((*p).Metadata().Timestamp.UnixNano()),
+		ObservedTimeUnixNano: uint64(time.Now().UnixNano()),
+		SeverityNumber:       logsv1.SeverityNumber_SEVERITY_NUMBER_INFO,
+		SeverityText:         otlpSeverityTextInfo,
+		Body: &commonv1.AnyValue{
+			Value: &commonv1.AnyValue_StringValue{StringValue: json.String()},
+		},
+		Attributes: t.attributes(json),
+	}
+
+	t.labels.apply(*p, func(key, value string) {
+		record.Attributes = append(record.Attributes, otlpStringAttribute(key, value))
+	})
+
+	if severity, ok := json.S("severity").Data().(string); ok && severity == otlpSeverityTextError {
+		record.SeverityNumber = logsv1.SeverityNumber_SEVERITY_NUMBER_ERROR
+		record.SeverityText = otlpSeverityTextError
+	}
+
+	if trace, ok := json.S("logging.googleapis.com/trace").Data().(string); ok {
+		span, _ := json.S("logging.googleapis.com/spanId").Data().(string)
+		record.TraceId, record.SpanId = otlpTraceAndSpanIDs(trace[strings.LastIndex(trace, "/")+1:], span)
+		if record.TraceId != nil && record.SpanId != nil {
+			record.Flags = otlpTraceFlagsSampled
+		}
+	}
+
+	output := &otlpTranslation{LogRecord: record}
+	if record.TraceId != nil && record.SpanId != nil {
+		output.spans = t.connectionSpans(json, record.TraceId, record.SpanId)
+		output.spans = append(output.spans,
+			t.exchangeSpans(json, ifaces, (*p).Metadata().Timestamp, record.TraceId, record.SpanId)...)
+	}
+
+	return output, err
+}
+
+func (t *OTLPPcapTranslator) connectionSpans(
+	json *gabs.Container,
+	traceID, parentSpanID []byte,
+) []*tracev1.Span {
+	if proto, _ := json.S("L3", "proto", "num").Data().(layers.IPProtocol); proto != layers.IPProtocolTCP {
+		return nil
+	}
+	flowIDstr, _ := json.S("flow").Data().(string)
+	flowID, err := strconv.ParseUint(flowIDstr, 10, 64)
+	if err != nil {
+		return nil
+	}
+	// requests are sent to the server
+	server, ok := json.S("L3", "dst").Data().(net.IP)
+	if !ok {
+		return nil
+	}
+
+	phases := t.phases.phases(flowID, server)
+	if len(phases) == 0 {
+		return nil
+	}
+
+	spans := make([]*tracev1.Span, 0, len(phases))
+	for _, phase := range phases {
+		spanID := make([]byte, otlpSpanIDSize)
+		if _, err := rand.Read(spanID); err != nil {
+			continue
+		}
+
+		span := &tracev1.Span{
+			TraceId:           traceID,
+			SpanId:            spanID,
+			ParentSpanId:      parentSpanID,
+			Kind:              tracev1.Span_SPAN_KIND_CLIENT,
+			StartTimeUnixNano: uint64(phase.start.UnixNano()),
+			EndTimeUnixNano:   uint64(phase.end.UnixNano()),
+			Flags:             otlpTraceFlagsSampled,
+			Attributes:        []*commonv1.KeyValue{otlpStringAttribute("pcap.flow", flowIDstr)},
+		}
+
+		switch phase.name {
+		case connectionPhaseDNS:
+			span.Name = "DNS lookup"
+			span.Attributes = append(span.Attributes, otlpStringAttribute("dns.question.name", phase.serverName))
+		case connectionPhaseTLS:
+			span.Name = "TLS handshake"
+			span.Attributes = append(span.Attributes, otlpStringAttribute("server.address", server.String()))
+			if phase.serverName != "" {
+				span.Attributes = append(span.Attributes, otlpStringAttribute("tls.client.server_name", phase.serverName))
+			}
+		}
+
+		spans = append(spans, span)
+	}
+
+	return spans
+}
+
+// exchangeSpans turns the network into a tracer: every HTTP exchange observed on the wire becomes a `Span`.
+// Responses are sent by servers, so exchanges are `CLIENT` spans if responses are sent to local addresses.
+func (t *OTLPPcapTranslator) exchangeSpans(
+	json *gabs.Container,
+	ifaces netIfaceIndex,
+	end time.Time,
+	traceID, parentSpanID []byte,
+) []*tracev1.Span {
+	exchanges := otlpHTTPExchanges(json)
+	if len(exchanges) == 0 {
+		return nil
+	}
+
+	client := false
+	if dst, ok := json.S("L3", "dst").Data().(net.IP); ok {
+		_, client = ifaces[dst.String()]
+	}
+	kind := tracev1.Span_SPAN_KIND_SERVER
+	if client {
+		kind = tracev1.Span_SPAN_KIND_CLIENT
+	}
+	flowIDstr, _ := json.S("flow").Data().(string)
+	server, _ := json.S("L3", "src").Data().(net.IP)
+
+	spans := make([]*tracev1.Span, 0, len(exchanges))
+	for _, exchange := range exchanges {
+		spanID := make([]byte, otlpSpanIDSize)
+		if _, err := rand.Read(spanID); err != nil {
+			continue
+		}
+
+		span := &tracev1.Span{
+			TraceId:           traceID,
+			SpanId:            spanID,
+			ParentSpanId:      parentSpanID,
+			Name:              exchange.method,
+			Kind:              kind,
+			StartTimeUnixNano: uint64(exchange.start.UnixNano()),
+			EndTimeUnixNano:   uint64(end.UnixNano()),
+			Flags:             otlpTraceFlagsSampled,
+			Attributes: []*commonv1.KeyValue{
+				otlpStringAttribute("pcap.flow", flowIDstr),
+				otlpStringAttribute("http.request.method", exchange.method),
+				otlpStringAttribute("url.full", exchange.url),
+			},
+		}
+		if server != nil {
+			span.Attributes = append(span.Attributes, otlpStringAttribute("server.address", server.String()))
+		}
+		if exchange.rpc != "" {
+			span.Name = exchange.rpc
+			span.Attributes = append(span.Attributes, otlpStringAttribute("rpc.method", exchange.rpc))
+		}
+		if exchange.code > 0 {
+			span.Attributes = append(span.Attributes, otlpIntAttribute("http.response.status_code", int64(exchange.code)))
+		}
+		if exchange.isError(client) {
+			span.Status = &tracev1.Status{Code: tracev1.Status_STATUS_CODE_ERROR}
+		}
+
+		spans = append(spans, span)
+	}
+
+	return spans
+}
+
+// for OTLP translator, translations are written using the same framing as the PROTO translator:
+//   - every `LogRecord` is prefixed with its size: 4 bytes little-endian,
+//   - `Span`s follow the `LogRecord` they belong to, and their size is flagged with `OTLPSpanFrame`.
+func (t *OTLPPcapTranslator) write(
+	_ context.Context,
+	writer io.Writer,
+	packet *fmt.Stringer,
+) (int, error) {
+	translation, ok := (*packet).(*otlpTranslation)
+	if !ok {
+		return 0, errors.New("invalid OTLP translation")
+	}
+
+	recordBytes, err := proto.Marshal(translation.LogRecord)
+	if err != nil {
+		return 0, errors.Wrap(err, "OTLP translation failed")
+	}
+
+	buf := binary.LittleEndian.AppendUint32(nil, uint32(len(recordBytes)))
+	buf = append(buf, recordBytes...)
+
+	for _, span := range translation.spans {
+		spanBytes, err := proto.Marshal(span)
+		if err != nil {
+			return 0, errors.Wrap(err, "OTLP span translation failed")
+		}
+		buf = binary.LittleEndian.AppendUint32(buf, OTLPSpanFrame|uint32(len(spanBytes)))
+		buf = append(buf, spanBytes...)
+	}
+
+	// a single `Write` per `LogRecord` allows writers to export every record as is
+	writtenBytes, err := writer.Write(buf)
+	if err != nil {
+		return writtenBytes, errors.Wrap(err, "failed to write OTLP translation")
+	}
+
+	return writtenBytes, nil
+}
+
+func newOTLPPcapTranslator(
+	ctx context.Context,
+	debug bool,
+	iface *PcapIface,
+	ephemerals *PcapEphemeralPorts,
+) PcapTranslator {
+	translator := newJSONPcapTranslator(ctx, debug, iface, ephemerals).(*JSONPcapTranslator)
+	if translator.phases == nil {
+		translator.phases = newConnectionPhasesTracker()
+	}
+
+	return &OTLPPcapTranslator{
+		JSONPcapTranslator: translator,
+	}
+}
@@ -15,10 +15,18 @@
 package transformer
 
 import (
+	"cmp"
+	"encoding/binary"
+	"net"
 	"net/netip"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	mapset "github.com/deckarep/golang-set/v2"
 	"github.com/google/btree"
+	"github.com/google/gopacket/layers"
 	"github.com/segmentio/fasthash/fnv1a"
 	"github.com/wissance/stringFormatter"
 )
@@ -31,11 +39,25 @@ type (
 
 	L4Proto uint8
 
+	pcapL2Filters struct {
+		// filter MACs and VLAN IDs in O(1); MACs are stored as their 48 bits
+		macs    mapset.Set[uint64]
+		noMACs  mapset.Set[uint64]
+		vlans   mapset.Set[uint16]
+		noVLANs mapset.Set[uint16]
+	}
+
 	pcapL3Filters struct {
 		// filter IPs in O(log N)
 		networks4 *btree.BTreeG[netip.Prefix]
 		networks6 *btree.BTreeG[netip.Prefix]
-		protos    mapset.Set[uint8]
+		// denied networks take precedence over allowed ones
+		noNetworks4 *btree.BTreeG[netip.Prefix]
+		noNetworks6 *btree.BTreeG[netip.Prefix]
+		// IPs learned for allowed names: unlike allowed networks, either side of a packet may match them
+		hosts4 *btree.BTreeG[netip.Prefix]
+		hosts6 *btree.BTreeG[netip.Prefix]
+		protos mapset.Set[uint8]
 	}
 
 	pcapL4Filters struct {
@@ -46,21 +68,56 @@ type (
 		protos  mapset.Set[uint8]
 	}
 
-	pcapFilters struct {
+	// pcapSocketHasher hashes sockets regardless of direction; it holds no state.
+	pcapSocketHasher struct{}
+
+	// pcapFilterSet is an immutable snapshot of filters: it is never modified once published.
+	pcapFilterSet struct {
+		pcapSocketHasher
+		l2        *pcapL2Filters
 		l3        *pcapL3Filters
 		l4        *pcapL4Filters
 		noSockets mapset.Set[uint64]
+		// shared by all snapshots
+		hosts *pcapHostFilters
+	}
+
+	// pcapFilters may be updated at any time, i/e: while packets are being translated:
+	//   - updates are serialized, and each of them publishes a new snapshot ( copy-on-write ),
+	//   - each packet is checked against a single snapshot, so it never observes a partial update.
+	pcapFilters struct {
+		pcapSocketHasher
+		mu       sync.Mutex
+		snapshot atomic.Pointer[pcapFilterSet]
 	}
 
 	PcapFilters interface {
+		// Snapshot returns filters which are not affected by later updates
+		Snapshot() PcapFilters
+
+		HasL2Addrs() bool
+		HasVLANs() bool
+
 		HasL3Protos() bool
 		HasIPs() bool
 		HasIPv4s() bool
 		HasIPv6s() bool
+		HasDeniedIPv4s() bool
+		HasDeniedIPv6s() bool
 
 		HasL4Protos() bool
 		HasTCPflags() bool
 		HasL4Addrs() bool
+		HasHosts() bool
+		// HasAllowedHosts is `true` while names are allowed, even if none of their IPs were learned yet
+		HasAllowedHosts() bool
+		// AllowsHostAddr is `true` if the IP was learned for an allowed name
+		AllowsHostAddr(*netip.Addr) bool
+
+		AllowsAnyL2Addr(...net.HardwareAddr) bool
+		DeniesAnyL2Addr(...net.HardwareAddr) bool
+		AllowsAnyVLAN(...uint16) bool
+		DeniesAnyVLAN(...uint16) bool
 
 		AllowsL3Proto(*uint8) bool
 		AllowsIP(*netip.Addr) bool
@@ -70,10 +127,13 @@ type (
 		AllowsIPv6() bool
 		AllowsIPv6Addr(*netip.Addr) bool
 		AllowsIPv6Bytes([16]byte) bool
+		DeniesIPv4Addr(*netip.Addr) bool
+		DeniesIPv6Addr(*netip.Addr) bool
 
 		AllowsL4Proto(*uint8) bool
 		AllowsTCP() bool
 		AllowsUDP() bool
+		AllowsSCTP() bool
 		AllowsL4Addr(*uint16) bool
 		AllowsAnyL4Addr(...uint16) bool
 		DeniesAnyL4Addr(...uint16) bool
@@ -82,21 +142,46 @@ type (
 		DeniesSocket(*netip.Addr, *uint16, *netip.Addr, *uint16) bool
 
 		AllowsAnyTCPflags(*uint8) bool
+
+		// ObserveDNS learns the IPs of watched names from DNS responses
+		ObserveDNS(*layers.DNS, time.Time)
+	}
+
+	// PcapFiltersView describes the filters being enforced; sockets are hashed, so only how many are denied is known.
+	PcapFiltersView struct {
+		MACs          []string `json:"macs"`
+		DeniedMACs    []string `json:"denied_macs"`
+		VLANs         []uint16 `json:"vlans"`
+		DeniedVLANs   []uint16 `json:"denied_vlans"`
+		L3Protos      []uint8  `json:"l3_protos"`
+		IPv4          []string `json:"ipv4"`
+		IPv6          []string `json:"ipv6"`
+		DeniedIPv4    []string `json:"denied_ipv4"`
+		DeniedIPv6    []string `json:"denied_ipv6"`
+		L4Protos      []uint8  `json:"l4_protos"`
+		Ports         []uint16 `json:"ports"`
+		DeniedPorts   []uint16 `json:"denied_ports"`
+		TCPFlags      []string `json:"tcp_flags"`
+		DeniedSockets int      `json:"denied_sockets"`
+		Hosts         []string `json:"hosts"`
+		DeniedHosts   []string `json:"denied_hosts"`
 	}
 
 	Addr netip.Addr
 )
 
-func (f *pcapFilters) hashAddrAndPort(
+func (f *pcapSocketHasher) hashAddrAndPort(
 	addr *netip.Addr,
 	port *uint16,
 ) *uint64 {
-	hash := fnv1a.HashBytes64(addr.AsSlice())
+	// dual-stack sockets report IPv4 peers as IPv4-mapped IPv6 addresses, i/e: `[::ffff:10.0.0.1]:443`;
+	// while packets carry plain IPv4 addresses. Zones ( `%eth0` ) are never available in packets.
+	hash := fnv1a.HashBytes64(addr.Unmap().WithZone("").AsSlice())
 	hash += uint64(*port)
 	return &hash
 }
 
-func (f *pcapFilters) hashAddrPort(
+func (f *pcapSocketHasher) hashAddrPort(
 	addrPort *netip.AddrPort,
 ) *uint64 {
 	addr := addrPort.Addr()
@@ -104,7 +189,7 @@ func (f *pcapFilters) hashAddrPort(
 	return f.hashAddrAndPort(&addr, &port)
 }
 
-func (f *pcapFilters) hash2tuple(
+func (f *pcapSocketHasher) hash2tuple(
 	ipAndPort string,
 ) (*uint64, bool) {
 	addrPort, err := netip.ParseAddrPort(ipAndPort)
@@ -114,7 +199,7 @@ func (f *pcapFilters) hash2tuple(
 	return f.hashAddrPort(&addrPort), true
 }
 
-func (f *pcapFilters) hashUint64s(
+func (f *pcapSocketHasher) hashUint64s(
 	hashes ...*uint64,
 ) *uint64 {
 	hash := uint64(0)
@@ -128,7 +213,7 @@ func (f *pcapFilters) hashUint64s(
 	return &hash
 }
 
-func (f *pcapFilters) hashSocketFrom2tuples(
+func (f *pcapSocketHasher) hashSocketFrom2tuples(
 	local string, remote string,
 ) (*uint64, bool) {
 	localHash, localOK := f.hash2tuple(local)
@@ -139,7 +224,7 @@ func (f *pcapFilters) hashSocketFrom2tuples(
 	return f.hashUint64s(localHash, remoteHash), true
 }
 
-func (f *pcapFilters) hashSocketFromAddrsAndPorts(
+func (f *pcapSocketHasher) hashSocketFromAddrsAndPorts(
 	srcAddr *netip.Addr, srcPort *uint16,
 	dstAddr *netip.Addr, dstPort *uint16,
 ) *uint64 {
@@ -164,7 +249,7 @@ func mergeTCPFlags(flags ...TCPFlag) uint8 {
 	return mergedFlags
 }
 
-func (f *pcapFilters) addNetwork(
+func (f *pcapFilterSet) addNetwork(
 	networks *btree.BTreeG[netip.Prefix],
 	isIPv6 bool, ipRange string,
 ) {
@@ -176,7 +261,7 @@ func (f *pcapFilters) addNetwork(
 	}
 }
 
-func (f *pcapFilters) addNetworks(
+func (f *pcapFilterSet) addNetworks(
 	networks *btree.BTreeG[netip.Prefix],
 	isIPv6 bool, ipRanges ...string,
 ) {
@@ -185,119 +270,485 @@ func (f *pcapFilters) addNetworks(
 	}
 }
 
+func (f *pcapFilterSet) removeNetworks(
+	networks *btree.BTreeG[netip.Prefix],
+	ipRanges ...string,
+) {
+	for _, ipRange := range ipRanges {
+		prefix, err := netip.ParsePrefix(ipRange)
+		if err != nil {
+			continue
+		}
+		// overlapping networks compare as equal: only remove the very same network, not the one containing it
+		if network, ok := networks.Get(prefix); ok && network == prefix {
+			networks.Delete(prefix)
+		}
+	}
+}
+
+func (f *pcapFilterSet) clone() *pcapFilterSet {
+	return &pcapFilterSet{
+		l2: &pcapL2Filters{
+			macs:    f.l2.macs.Clone(),
+			noMACs:  f.l2.noMACs.Clone(),
+			vlans:   f.l2.vlans.Clone(),
+			noVLANs: f.l2.noVLANs.Clone(),
+		},
+		l3: &pcapL3Filters{
+			networks4:   f.l3.networks4.Clone(),
+			networks6:   f.l3.networks6.Clone(),
+			noNetworks4: f.l3.noNetworks4.Clone(),
+			noNetworks6: f.l3.noNetworks6.Clone(),
+			hosts4:      f.l3.hosts4.Clone(),
+			hosts6:      f.l3.hosts6.Clone(),
+			protos:      f.l3.protos.Clone(),
+		},
+		l4: &pcapL4Filters{
+			ports:   f.l4.ports.Clone(),
+			noPorts: f.l4.noPorts.Clone(),
+			flags:   f.l4.flags,
+			protos:  f.l4.protos.Clone(),
+		},
+		noSockets: f.noSockets.Clone(),
+		hosts:     f.hosts,
+	}
+}
+
+// update applies `fn` to a copy of the current snapshot, and then publishes it.
+func (f *pcapFilters) update(fn func(*pcapFilterSet)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	next := f.snapshot.Load().clone()
+	fn(next)
+	f.snapshot.Store(next)
+}
+
+func (f *pcapFilters) load() *pcapFilterSet {
+	return f.snapshot.Load()
+}
+
+// macToUint64 packs EUI-48 addresses into the lower 48 bits; other hardware addresses are not supported.
+func macToUint64(mac net.HardwareAddr) (uint64, bool) {
+	if len(mac) != 6 {
+		return 0, false
+	}
+	var bytes [8]byte
+	copy(bytes[2:], mac)
+	return binary.BigEndian.Uint64(bytes[:]), true
+}
+
+func uint64ToMAC(mac uint64) net.HardwareAddr {
+	var bytes [8]byte
+	binary.BigEndian.PutUint64(bytes[:], mac)
+	return net.HardwareAddr(bytes[2:])
+}
+
+func parseMACs(MACs ...string) []uint64 {
+	macs := make([]uint64, 0, len(MACs))
+	for _, MAC := range MACs {
+		if hwAddr, err := net.ParseMAC(MAC); err == nil {
+			if mac, ok := macToUint64(hwAddr); ok {
+				macs = append(macs, mac)
+			}
+		}
+	}
+	return macs
+}
+
+func ipv4Networks(IPv4s ...string) []string {
+	networks := make([]string, len(IPv4s))
+	for i, IPv4 := range IPv4s {
+		networks[i] = stringFormatter.Format("{0}/32", IPv4)
+	}
+	return networks
+}
+
+func ipv6Networks(IPv6s ...string) []string {
+	networks := make([]string, len(IPv6s))
+	for i, IPv6 := range IPv6s {
+		networks[i] = stringFormatter.Format("{0}/128", IPv6)
+	}
+	return networks
+}
+
 /* methods for filter's users */
 
 func (flag *TCPFlag) ToUint8() uint8 {
 	return flag.materialize()
 }
 
+func (f *pcapFilters) AddMAC(MAC string) {
+	f.AddMACs(MAC)
+}
+
+func (f *pcapFilters) AddMACs(MACs ...string) {
+	macs := parseMACs(MACs...)
+	f.update(func(s *pcapFilterSet) {
+		s.l2.macs.Append(macs...)
+	})
+}
+
+func (f *pcapFilters) RemoveMAC(MAC string) {
+	f.RemoveMACs(MAC)
+}
+
+func (f *pcapFilters) RemoveMACs(MACs ...string) {
+	macs := parseMACs(MACs...)
+	f.update(func(s *pcapFilterSet) {
+		s.l2.macs.RemoveAll(macs...)
+	})
+}
+
+func (f *pcapFilters) DenyMAC(MAC string) {
+	f.DenyMACs(MAC)
+}
+
+func (f *pcapFilters) DenyMACs(MACs ...string) {
+	macs := parseMACs(MACs...)
+	f.update(func(s *pcapFilterSet) {
+		s.l2.noMACs.Append(macs...)
+	})
+}
+
+func (f *pcapFilters) AllowMAC(MAC string) {
+	f.AllowMACs(MAC)
+}
+
+func (f *pcapFilters) AllowMACs(MACs ...string) {
+	macs := parseMACs(MACs...)
+	f.update(func(s *pcapFilterSet) {
+		s.l2.noMACs.RemoveAll(macs...)
+	})
+}
+
+func (f *pcapFilters) AddVLAN(vlan uint16) {
+	f.AddVLANs(vlan)
+}
+
+func (f *pcapFilters) AddVLANs(vlans ...uint16) {
+	f.update(func(s *pcapFilterSet) {
+		s.l2.vlans.Append(vlans...)
+	})
+}
+
+func (f *pcapFilters) RemoveVLAN(vlan uint16) {
+	f.RemoveVLANs(vlan)
+}
+
+func (f *pcapFilters) RemoveVLANs(vlans ...uint16) {
+	f.update(func(s *pcapFilterSet) {
+		s.l2.vlans.RemoveAll(vlans...)
+	})
+}
+
+func (f *pcapFilters) DenyVLAN(vlan uint16) {
+	f.DenyVLANs(vlan)
+}
+
+func (f *pcapFilters) DenyVLANs(vlans ...uint16) {
+	f.update(func(s *pcapFilterSet) {
+		s.l2.noVLANs.Append(vlans...)
+	})
+}
+
+func (f *pcapFilters) AllowVLAN(vlan uint16) {
+	f.AllowVLANs(vlan)
+}
+
+func (f *pcapFilters) AllowVLANs(vlans ...uint16) {
+	f.update(func(s *pcapFilterSet) {
+		s.l2.noVLANs.RemoveAll(vlans...)
+	})
+}
+
 func (f *pcapFilters) AddIPv4(IPv4 string) {
-	f.addNetwork(f.l3.networks4, false /* isIPv6 */, stringFormatter.Format("{0}/32", IPv4))
+	f.AddIPv4s(IPv4)
 }
 
 func (f *pcapFilters) AddIPv4s(IPv4s ...string) {
-	for _, IPv4 := range IPv4s {
-		f.AddIPv4(IPv4)
-	}
+	f.AddIPv4Ranges(ipv4Networks(IPv4s...)...)
 }
 
 func (f *pcapFilters) AddIPv4Range(IPv4Range string) {
-	f.addNetwork(f.l3.networks4, false /* isIPv6 */, IPv4Range)
+	f.AddIPv4Ranges(IPv4Range)
 }
 
 func (f *pcapFilters) AddIPv4Ranges(IPv4Ranges ...string) {
-	for _, IPv4Range := range IPv4Ranges {
-		f.AddIPv4Range(IPv4Range)
-	}
+	f.update(func(s *pcapFilterSet) {
+		s.addNetworks(s.l3.networks4, false /* isIPv6 */, IPv4Ranges...)
+	})
+}
+
+func (f *pcapFilters) RemoveIPv4(IPv4 string) {
+	f.RemoveIPv4s(IPv4)
+}
+
+func (f *pcapFilters) RemoveIPv4s(IPv4s ...string) {
+	f.RemoveIPv4Ranges(ipv4Networks(IPv4s...)...)
+}
+
+func (f *pcapFilters) RemoveIPv4Range(IPv4Range string) {
+	f.RemoveIPv4Ranges(IPv4Range)
+}
+
+func (f *pcapFilters) RemoveIPv4Ranges(IPv4Ranges ...string) {
+	f.update(func(s *pcapFilterSet) {
+		s.removeNetworks(s.l3.networks4, IPv4Ranges...)
+	})
 }
 
 func (f *pcapFilters) AddIPv6(IPv6 string) {
-	f.addNetwork(f.l3.networks6, true /* isIPv6 */, stringFormatter.Format("{0}/128", IPv6))
+	f.AddIPv6s(IPv6)
 }
 
 func (f *pcapFilters) AddIPv6s(IPv6s ...string) {
-	for _, IPv6 := range IPv6s {
-		f.AddIPv6(IPv6)
-	}
+	f.AddIPv6Ranges(ipv6Networks(IPv6s...)...)
 }
 
 func (f *pcapFilters) AddIPv6Range(IPv6Range string) {
-	f.addNetwork(f.l3.networks6, true /* isIPv6 */, IPv6Range)
+	f.AddIPv6Ranges(IPv6Range)
 }
 
 func (f *pcapFilters) AddIPv6Ranges(IPv6Ranges ...string) {
-	for _, IPv6Range := range IPv6Ranges {
-		f.AddIPv6Range(IPv6Range)
-	}
+	f.update(func(s *pcapFilterSet) {
+		s.addNetworks(s.l3.networks6, true /* isIPv6 */, IPv6Ranges...)
+	})
+}
+
+func (f *pcapFilters) RemoveIPv6(IPv6 string) {
+	f.RemoveIPv6s(IPv6)
+}
+
+func (f *pcapFilters) RemoveIPv6s(IPv6s ...string) {
+	f.RemoveIPv6Ranges(ipv6Networks(IPv6s...)...)
+}
+
+func (f *pcapFilters) RemoveIPv6Range(IPv6Range string) {
+	f.RemoveIPv6Ranges(IPv6Range)
+}
+
+func (f *pcapFilters) RemoveIPv6Ranges(IPv6Ranges ...string) {
+	f.update(func(s *pcapFilterSet) {
+		s.removeNetworks(s.l3.networks6, IPv6Ranges...)
+	})
+}
+
+func (f *pcapFilters) DenyIPv4(IPv4 string) {
+	f.DenyIPv4s(IPv4)
+}
+
+func (f *pcapFilters) DenyIPv4s(IPv4s ...string) {
+	f.DenyIPv4Ranges(ipv4Networks(IPv4s...)...)
+}
+
+func (f *pcapFilters) DenyIPv4Range(IPv4Range string) {
+	f.DenyIPv4Ranges(IPv4Range)
+}
+
+func (f *pcapFilters) DenyIPv4Ranges(IPv4Ranges ...string) {
+	f.update(func(s *pcapFilterSet) {
+		s.addNetworks(s.l3.noNetworks4, false /* isIPv6 */, IPv4Ranges...)
+	})
+}
+
+func (f *pcapFilters) AllowIPv4(IPv4 string) {
+	f.AllowIPv4s(IPv4)
+}
+
+func (f *pcapFilters) AllowIPv4s(IPv4s ...string) {
+	f.AllowIPv4Ranges(ipv4Networks(IPv4s...)...)
+}
+
+func (f *pcapFilters) AllowIPv4Range(IPv4Range string) {
+	f.AllowIPv4Ranges(IPv4Range)
+}
+
+// AllowIPv4Ranges removes networks from the deny-list; networks must be the same that were denied.
+func (f *pcapFilters) AllowIPv4Ranges(IPv4Ranges ...string) {
+	f.update(func(s *pcapFilterSet) {
+		s.removeNetworks(s.l3.noNetworks4, IPv4Ranges...)
+	})
+}
+
+func (f *pcapFilters) DenyIPv6(IPv6 string) {
+	f.DenyIPv6s(IPv6)
+}
+
+func (f *pcapFilters) DenyIPv6s(IPv6s ...string) {
+	f.DenyIPv6Ranges(ipv6Networks(IPv6s...)...)
+}
+
+func (f *pcapFilters) DenyIPv6Range(IPv6Range string) {
+	f.DenyIPv6Ranges(IPv6Range)
+}
+
+func (f *pcapFilters) DenyIPv6Ranges(IPv6Ranges ...string) {
+	f.update(func(s *pcapFilterSet) {
+		s.addNetworks(s.l3.noNetworks6, true /* isIPv6 */, IPv6Ranges...)
+	})
+}
+
+func (f *pcapFilters) AllowIPv6(IPv6 string) {
+	f.AllowIPv6s(IPv6)
+}
+
+func (f *pcapFilters) AllowIPv6s(IPv6s ...string) {
+	f.AllowIPv6Ranges(ipv6Networks(IPv6s...)...)
+}
+
+func (f *pcapFilters) AllowIPv6Range(IPv6Range string) {
+	f.AllowIPv6Ranges(IPv6Range)
+}
+
+// AllowIPv6Ranges removes networks from the deny-list; networks must be the same that were denied.
+func (f *pcapFilters) AllowIPv6Ranges(IPv6Ranges ...string) {
+	f.update(func(s *pcapFilterSet) {
+		s.removeNetworks(s.l3.noNetworks6, IPv6Ranges...)
+	})
 }
 
 func (f *pcapFilters) AddPort(port uint16) {
-	f.l4.ports.Add(port)
+	f.AddPorts(port)
 }
 
 func (f *pcapFilters) AddPorts(ports ...uint16) {
-	for _, port := range ports {
-		f.AddPort(port)
-	}
+	f.update(func(s *pcapFilterSet) {
+		s.l4.ports.Append(ports...)
+	})
+}
+
+func (f *pcapFilters) RemovePort(port uint16) {
+	f.RemovePorts(port)
+}
+
+func (f *pcapFilters) RemovePorts(ports ...uint16) {
+	f.update(func(s *pcapFilterSet) {
+		s.l4.ports.RemoveAll(ports...)
+	})
 }
 
 func (f *pcapFilters) DenyPort(port uint16) {
-	f.l4.noPorts.Add(port)
+	f.DenyPorts(port)
 }
 
 func (f *pcapFilters) DenyPorts(ports ...uint16) {
-	for _, port := range ports {
-		f.DenyPort(port)
-	}
+	f.update(func(s *pcapFilterSet) {
+		s.l4.noPorts.Append(ports...)
+	})
 }
 
 func (f *pcapFilters) AllowPort(port uint16) {
-	f.l4.noPorts.Remove(port)
+	f.AllowPorts(port)
 }
 
 func (f *pcapFilters) AllowPorts(ports ...uint16) {
-	for _, port := range ports {
-		f.AllowPort(port)
-	}
+	f.update(func(s *pcapFilterSet) {
+		s.l4.noPorts.RemoveAll(ports...)
+	})
 }
 
 func (f *pcapFilters) AddTCPFlags(flags ...TCPFlag) {
-	for _, flag := range flags {
-		f.l4.flags |= flag.materialize()
-	}
+	f.update(func(s *pcapFilterSet) {
+		for _, flag := range flags {
+			s.l4.flags |= flag.materialize()
+		}
+	})
 }
 
 func (f *pcapFilters) CombineAndAddTCPFlags(flag ...TCPFlag) {
-	f.l4.flags |= mergeTCPFlags(flag...)
+	f.update(func(s *pcapFilterSet) {
+		s.l4.flags |= mergeTCPFlags(flag...)
+	})
 }
 
-func (f *pcapFilters) addProtos(
-	protosSet mapset.Set[uint8],
-	protos ...uint8,
-) {
-	for _, proto := range protos {
-		protosSet.Add(proto)
-	}
+func (f *pcapFilters) RemoveTCPFlags(flags ...TCPFlag) {
+	f.update(func(s *pcapFilterSet) {
+		s.l4.flags &^= mergeTCPFlags(flags...)
+	})
 }
 
 func (f *pcapFilters) AddL3Proto(proto L3Proto) {
-	f.l3.protos.Add(uint8(proto))
+	f.AddL3Protos(proto)
 }
 
 func (f *pcapFilters) AddL3Protos(protos ...L3Proto) {
-	for _, proto := range protos {
-		f.AddL3Proto(proto)
-	}
+	f.update(func(s *pcapFilterSet) {
+		for _, proto := range protos {
+			s.l3.protos.Add(uint8(proto))
+		}
+	})
+}
+
+func (f *pcapFilters) RemoveL3Proto(proto L3Proto) {
+	f.RemoveL3Protos(proto)
+}
+
+func (f *pcapFilters) RemoveL3Protos(protos ...L3Proto) {
+	f.update(func(s *pcapFilterSet) {
+		for _, proto := range protos {
+			s.l3.protos.Remove(uint8(proto))
+		}
+	})
 }
 
 func (f *pcapFilters) AddL4Proto(proto L4Proto) {
-	f.l4.protos.Add(uint8(proto))
+	f.AddL4Protos(proto)
 }
 
 func (f *pcapFilters) AddL4Protos(protos ...L4Proto) {
-	for _, proto := range protos {
-		f.AddL4Proto(proto)
-	}
+	f.update(func(s *pcapFilterSet) {
+		for _, proto := range protos {
+			s.l4.protos.Add(uint8(proto))
+		}
+	})
+}
+
+func (f *pcapFilters) RemoveL4Proto(proto L4Proto) {
+	f.RemoveL4Protos(proto)
+}
+
+func (f *pcapFilters) RemoveL4Protos(protos ...L4Proto) {
+	f.update(func(s *pcapFilterSet) {
+		for _, proto := range protos {
+			s.l4.protos.Remove(uint8(proto))
+		}
+	})
+}
+
+// AddHost allows IPs resolved for `host` by the DNS responses being captured, until their TTL expires;
+// `*.example.com` allows all subdomains of `example.com`. IPs are not allowed until they are learned.
+func (f *pcapFilters) AddHost(host string) {
+	f.AddHosts(host)
+}
+
+func (f *pcapFilters) AddHosts(hosts ...string) {
+	f.load().hosts.watch(false /* deny */, hosts...)
+}
+
+func (f *pcapFilters) RemoveHost(host string) {
+	f.RemoveHosts(host)
+}
+
+func (f *pcapFilters) RemoveHosts(hosts ...string) {
+	f.load().hosts.unwatch(false /* deny */, hosts...)
+}
+
+// DenyHost denies IPs resolved for `host` by the DNS responses being captured, until their TTL expires.
+func (f *pcapFilters) DenyHost(host string) {
+	f.DenyHosts(host)
+}
+
+func (f *pcapFilters) DenyHosts(hosts ...string) {
+	f.load().hosts.watch(true /* deny */, hosts...)
+}
+
+// RemoveDeniedHost stops denying IPs resolved for `host`; use `AddHost` to allow them.
+func (f *pcapFilters) RemoveDeniedHost(host string) {
+	f.RemoveDeniedHosts(host)
+}
+
+func (f *pcapFilters) RemoveDeniedHosts(hosts ...string) {
+	f.load().hosts.unwatch(true /* deny */, hosts...)
 }
 
 func (f *pcapFilters) updateNoSockets(
@@ -305,15 +756,18 @@ func (f *pcapFilters) updateNoSockets(
 	remote string,
 	allowed bool,
 ) bool {
-	if hash, ok := f.hashSocketFrom2tuples(local, remote); ok {
+	hash, ok := f.hashSocketFrom2tuples(local, remote)
+	if !ok {
+		return false
+	}
+	f.update(func(s *pcapFilterSet) {
 		if allowed {
-			f.noSockets.Remove(*hash)
+			s.noSockets.Remove(*hash)
 		} else {
-			f.noSockets.Add(*hash)
+			s.noSockets.Add(*hash)
 		}
-		return ok
-	}
-	return false
+	})
+	return true
 }
 
 func (f *pcapFilters) AllowSocket(
@@ -328,112 +782,260 @@ func (f *pcapFilters) DenySocket(
 	return f.updateNoSockets(local, remote, false /* allowed */)
 }
 
+func sortedSet[T cmp.Ordered](set mapset.Set[T]) []T {
+	values := set.ToSlice()
+	slices.Sort(values)
+	return values
+}
+
+// View describes the filters being enforced.
+func (f *pcapFilters) View() *PcapFiltersView {
+	s := f.load()
+
+	view := &PcapFiltersView{
+		MACs:          []string{},
+		DeniedMACs:    []string{},
+		VLANs:         sortedSet(s.l2.vlans),
+		DeniedVLANs:   sortedSet(s.l2.noVLANs),
+		L3Protos:      sortedSet(s.l3.protos),
+		IPv4:          []string{},
+		IPv6:          []string{},
+		DeniedIPv4:    []string{},
+		DeniedIPv6:    []string{},
+		L4Protos:      sortedSet(s.l4.protos),
+		Ports:         sortedSet(s.l4.ports),
+		DeniedPorts:   sortedSet(s.l4.noPorts),
+		TCPFlags:      []string{},
+		DeniedSockets: s.noSockets.Cardinality(),
+		Hosts:         s.hosts.view(false /* deny */),
+		DeniedHosts:   s.hosts.view(true /* deny */),
+	}
+	for _, mac := range sortedSet(s.l2.macs) {
+		view.MACs = append(view.MACs, uint64ToMAC(mac).String())
+	}
+	for _, mac := range sortedSet(s.l2.noMACs) {
+		view.DeniedMACs = append(view.DeniedMACs, uint64ToMAC(mac).String())
+	}
+	s.l3.networks4.Ascend(func(network netip.Prefix) bool {
+		view.IPv4 = append(view.IPv4, network.String())
+		return true
+	})
+	s.l3.networks6.Ascend(func(network netip.Prefix) bool {
+		view.IPv6 = append(view.IPv6, network.String())
+		return true
+	})
+	s.l3.noNetworks4.Ascend(func(network netip.Prefix) bool {
+		view.DeniedIPv4 = append(view.DeniedIPv4, network.String())
+		return true
+	})
+	s.l3.noNetworks6.Ascend(func(network netip.Prefix) bool {
+		view.DeniedIPv6 = append(view.DeniedIPv6, network.String())
+		return true
+	})
+	for name, flag := range tcpFlags {
+		if s.l4.flags&flag != 0 {
+			view.TCPFlags = append(view.TCPFlags, name)
+		}
+	}
+	slices.Sort(view.TCPFlags)
+	return view
+}
+
 /* methods for fulter's consumers */
 /* methods to check if a packet is allowed */
 
-func (f *pcapFilters) HasL3Protos() bool {
+func (f *pcapFilterSet) Snapshot() PcapFilters {
+	return f
+}
+
+func (f *pcapFilterSet) HasL2Addrs() bool {
+	return !f.l2.macs.IsEmpty() || !f.l2.noMACs.IsEmpty()
+}
+
+func (f *pcapFilterSet) HasVLANs() bool {
+	return !f.l2.vlans.IsEmpty() || !f.l2.noVLANs.IsEmpty()
+}
+
+func (f *pcapFilterSet) AllowsAnyL2Addr(hwAddrs ...net.HardwareAddr) bool {
+	if f.DeniesAnyL2Addr(hwAddrs...) {
+		return false
+	}
+	if f.l2.macs.IsEmpty() {
+		return true
+	}
+	for _, hwAddr := range hwAddrs {
+		if mac, ok := macToUint64(hwAddr); ok && f.l2.macs.ContainsOne(mac) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *pcapFilterSet) DeniesAnyL2Addr(hwAddrs ...net.HardwareAddr) bool {
+	if f.l2.noMACs.IsEmpty() {
+		return false
+	}
+	for _, hwAddr := range hwAddrs {
+		if mac, ok := macToUint64(hwAddr); ok && f.l2.noMACs.ContainsOne(mac) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsAnyVLAN checks the VLAN IDs of all the tags of a frame; untagged frames are not allowed if there are allowed VLANs.
+func (f *pcapFilterSet) AllowsAnyVLAN(vlans ...uint16) bool {
+	return !f.DeniesAnyVLAN(vlans...) && (f.l2.vlans.IsEmpty() || f.l2.vlans.ContainsAny(vlans...))
+}
+
+func (f *pcapFilterSet) DeniesAnyVLAN(vlans ...uint16) bool {
+	return !f.l2.noVLANs.IsEmpty() && f.l2.noVLANs.ContainsAny(vlans...)
+}
+
+func (f *pcapFilterSet) HasL3Protos() bool {
 	return !f.l3.protos.IsEmpty()
 }
 
-func (f *pcapFilters) HasIPv4s() bool {
+func (f *pcapFilterSet) HasIPv4s() bool {
 	return f.l3.networks4.Len() > 0
 }
 
-func (f *pcapFilters) HasIPv6s() bool {
+func (f *pcapFilterSet) HasIPv6s() bool {
 	return f.l3.networks6.Len() > 0
 }
 
-func (f *pcapFilters) HasIPs() bool {
+func (f *pcapFilterSet) HasIPs() bool {
 	return f.HasIPv4s() || f.HasIPv6s()
 }
 
-func (f *pcapFilters) AllowsL3Proto(proto *uint8) bool {
+func (f *pcapFilterSet) HasDeniedIPv4s() bool {
+	return f.l3.noNetworks4.Len() > 0
+}
+
+func (f *pcapFilterSet) HasDeniedIPv6s() bool {
+	return f.l3.noNetworks6.Len() > 0
+}
+
+func (f *pcapFilterSet) AllowsL3Proto(proto *uint8) bool {
 	return f.l3.protos.ContainsOne(*proto)
 }
 
-func (f *pcapFilters) AllowsIPv4() bool {
+func (f *pcapFilterSet) AllowsIPv4() bool {
 	return f.l3.protos.ContainsOne(0x04)
 }
 
-func (f *pcapFilters) AllowsIPv6() bool {
+func (f *pcapFilterSet) AllowsIPv6() bool {
 	return f.l3.protos.Contains(0x29)
 }
 
-func (f *pcapFilters) allowsIPaddr(
+func (f *pcapFilterSet) allowsIPaddr(
 	networks *btree.BTreeG[netip.Prefix],
 	network *netip.Prefix,
 ) bool {
 	return networks.Has(*network)
 }
 
-func (f *pcapFilters) AllowsIPv4Addr(ip4 *netip.Addr) bool {
+func (f *pcapFilterSet) AllowsIPv4Addr(ip4 *netip.Addr) bool {
 	prefix := netip.PrefixFrom(*ip4, 32)
 	return f.allowsIPaddr(f.l3.networks4, &prefix)
 }
 
-func (f *pcapFilters) AllowsIPv4Bytes(ip4 [4]byte) bool {
+func (f *pcapFilterSet) AllowsIPv4Bytes(ip4 [4]byte) bool {
 	IPv4 := netip.AddrFrom4(ip4)
 	return f.AllowsIPv4Addr(&IPv4)
 }
 
-func (f *pcapFilters) AllowsIPv6Addr(ip6 *netip.Addr) bool {
+func (f *pcapFilterSet) AllowsIPv6Addr(ip6 *netip.Addr) bool {
 	prefix := netip.PrefixFrom(*ip6, 128)
 	return f.allowsIPaddr(f.l3.networks6, &prefix)
 }
 
-func (f *pcapFilters) AllowsIPv6Bytes(ip6 [16]byte) bool {
+func (f *pcapFilterSet) AllowsIPv6Bytes(ip6 [16]byte) bool {
 	IPv6 := netip.AddrFrom16(ip6)
 	return f.AllowsIPv4Addr(&IPv6)
 }
 
-func (f *pcapFilters) AllowsIP(ip *netip.Addr) bool {
+func (f *pcapFilterSet) DeniesIPv4Addr(ip4 *netip.Addr) bool {
+	prefix := netip.PrefixFrom(*ip4, 32)
+	return f.allowsIPaddr(f.l3.noNetworks4, &prefix)
+}
+
+func (f *pcapFilterSet) DeniesIPv6Addr(ip6 *netip.Addr) bool {
+	prefix := netip.PrefixFrom(*ip6, 128)
+	return f.allowsIPaddr(f.l3.noNetworks6, &prefix)
+}
+
+func (f *pcapFilterSet) AllowsIP(ip *netip.Addr) bool {
 	if ip.Is4() {
 		return f.AllowsIPv4Addr(ip)
 	}
 	return f.AllowsIPv6Addr(ip)
 }
 
-func (f *pcapFilters) HasL4Protos() bool {
+func (f *pcapFilterSet) HasL4Protos() bool {
 	return !f.l4.protos.IsEmpty()
 }
 
-func (f *pcapFilters) AllowsL4Proto(proto *uint8) bool {
+func (f *pcapFilterSet) AllowsL4Proto(proto *uint8) bool {
 	return f.l4.protos.ContainsOne(*proto)
 }
 
-func (f *pcapFilters) AllowsTCP() bool {
+func (f *pcapFilterSet) AllowsTCP() bool {
 	return f.l4.protos.ContainsOne(0x06)
 }
 
-func (f *pcapFilters) AllowsUDP() bool {
+func (f *pcapFilterSet) AllowsUDP() bool {
 	return f.l4.protos.ContainsOne(0x11)
 }
 
-func (f *pcapFilters) HasL4Addrs() bool {
+func (f *pcapFilterSet) AllowsSCTP() bool {
+	return f.l4.protos.ContainsOne(0x84)
+}
+
+func (f *pcapFilterSet) HasL4Addrs() bool {
 	return !f.l4.ports.IsEmpty() || !f.l4.noPorts.IsEmpty()
 }
 
-func (f *pcapFilters) AllowsL4Addr(port *uint16) bool {
+func (f *pcapFilterSet) AllowsL4Addr(port *uint16) bool {
 	return !f.l4.noPorts.ContainsOne(*port) && (f.l4.ports.IsEmpty() || f.l4.ports.ContainsOne(*port))
 }
 
-func (f *pcapFilters) AllowsAnyL4Addr(ports ...uint16) bool {
+func (f *pcapFilterSet) AllowsAnyL4Addr(ports ...uint16) bool {
 	return !f.DeniesAnyL4Addr(ports...) && (f.l4.ports.IsEmpty() || f.l4.ports.ContainsAny(ports...))
 }
 
-func (f *pcapFilters) DeniesAnyL4Addr(ports ...uint16) bool {
+func (f *pcapFilterSet) DeniesAnyL4Addr(ports ...uint16) bool {
 	return !f.l4.noPorts.IsEmpty() && f.l4.noPorts.ContainsAny(ports...)
 }
 
-func (f *pcapFilters) HasTCPflags() bool {
+func (f *pcapFilterSet) HasHosts() bool {
+	return f.hosts.watched.Load() > 0
+}
+
+func (f *pcapFilterSet) HasAllowedHosts() bool {
+	return f.hosts.allowed.Load() > 0
+}
+
+func (f *pcapFilterSet) AllowsHostAddr(ip *netip.Addr) bool {
+	if ip.Is4() {
+		return f.l3.hosts4.Has(netip.PrefixFrom(*ip, 32))
+	}
+	return f.l3.hosts6.Has(netip.PrefixFrom(*ip, 128))
+}
+
+func (f *pcapFilterSet) ObserveDNS(dns *layers.DNS, timestamp time.Time) {
+	f.hosts.observe(dns, timestamp)
+}
+
+func (f *pcapFilterSet) HasTCPflags() bool {
 	return f.l4.flags > tcpFlagNil
 }
 
-func (f *pcapFilters) AllowsAnyTCPflags(flags *uint8) bool {
+func (f *pcapFilterSet) AllowsAnyTCPflags(flags *uint8) bool {
 	return (*flags & f.l4.flags) > tcpFlagNil
 }
 
-func (f *pcapFilters) DeniesSocket(
+func (f *pcapFilterSet) DeniesSocket(
 	srcAddr *netip.Addr, srcPort *uint16,
 	dstAddr *netip.Addr, dstPort *uint16,
 ) bool {
@@ -441,13 +1043,181 @@ func (f *pcapFilters) DeniesSocket(
 	return !f.noSockets.IsEmpty() && f.noSockets.ContainsOne(*hash)
 }
 
-func (f *pcapFilters) AllowsSocket(
+func (f *pcapFilterSet) AllowsSocket(
 	srcAddr *netip.Addr, srcPort *uint16,
 	dstAddr *netip.Addr, dstPort *uint16,
 ) bool {
 	return !f.DeniesSocket(srcAddr, srcPort, dstAddr, dstPort)
 }
 
+/* methods to check if a packet is allowed by the latest snapshot */
+
+func (f *pcapFilters) Snapshot() PcapFilters {
+	return f.load()
+}
+
+func (f *pcapFilters) HasL2Addrs() bool {
+	return f.load().HasL2Addrs()
+}
+
+func (f *pcapFilters) HasVLANs() bool {
+	return f.load().HasVLANs()
+}
+
+func (f *pcapFilters) AllowsAnyL2Addr(hwAddrs ...net.HardwareAddr) bool {
+	return f.load().AllowsAnyL2Addr(hwAddrs...)
+}
+
+func (f *pcapFilters) DeniesAnyL2Addr(hwAddrs ...net.HardwareAddr) bool {
+	return f.load().DeniesAnyL2Addr(hwAddrs...)
+}
+
+func (f *pcapFilters) AllowsAnyVLAN(vlans ...uint16) bool {
+	return f.load().AllowsAnyVLAN(vlans...)
+}
+
+func (f *pcapFilters) DeniesAnyVLAN(vlans ...uint16) bool {
+	return f.load().DeniesAnyVLAN(vlans...)
+}
+
+func (f *pcapFilters) HasL3Protos() bool {
+	return f.load().HasL3Protos()
+}
+
+func (f *pcapFilters) HasIPv4s() bool {
+	return f.load().HasIPv4s()
+}
+
+func (f *pcapFilters) HasIPv6s() bool {
+	return f.load().HasIPv6s()
+}
+
+func (f *pcapFilters) HasIPs() bool {
+	return f.load().HasIPs()
+}
+
+func (f *pcapFilters) HasDeniedIPv4s() bool {
+	return f.load().HasDeniedIPv4s()
+}
+
+func (f *pcapFilters) HasDeniedIPv6s() bool {
+	return f.load().HasDeniedIPv6s()
+}
+
+func (f *pcapFilters) AllowsL3Proto(proto *uint8) bool {
+	return f.load().AllowsL3Proto(proto)
+}
+
+func (f *pcapFilters) AllowsIPv4() bool {
+	return f.load().AllowsIPv4()
+}
+
+func (f *pcapFilters) AllowsIPv6() bool {
+	return f.load().AllowsIPv6()
+}
+
+func (f *pcapFilters) AllowsIPv4Addr(ip4 *netip.Addr) bool {
+	return f.load().AllowsIPv4Addr(ip4)
+}
+
+func (f *pcapFilters) AllowsIPv4Bytes(ip4 [4]byte) bool {
+	return f.load().AllowsIPv4Bytes(ip4)
+}
+
+func (f *pcapFilters) AllowsIPv6Addr(ip6 *netip.Addr) bool {
+	return f.load().AllowsIPv6Addr(ip6)
+}
+
+func (f *pcapFilters) AllowsIPv6Bytes(ip6 [16]byte) bool {
+	return f.load().AllowsIPv6Bytes(ip6)
+}
+
+func (f *pcapFilters) DeniesIPv4Addr(ip4 *netip.Addr) bool {
+	return f.load().DeniesIPv4Addr(ip4)
+}
+
+func (f *pcapFilters) DeniesIPv6Addr(ip6 *netip.Addr) bool {
+	return f.load().DeniesIPv6Addr(ip6)
+}
+
+func (f *pcapFilters) AllowsIP(ip *netip.Addr) bool {
+	return f.load().AllowsIP(ip)
+}
+
+func (f *pcapFilters) HasL4Protos() bool {
+	return f.load().HasL4Protos()
+}
+
+func (f *pcapFilters) AllowsL4Proto(proto *uint8) bool {
+	return f.load().AllowsL4Proto(proto)
+}
+
+func (f *pcapFilters) AllowsTCP() bool {
+	return f.load().AllowsTCP()
+}
+
+func (f *pcapFilters) AllowsUDP() bool {
+	return f.load().AllowsUDP()
+}
+
+func (f *pcapFilters) AllowsSCTP() bool {
+	return f.load().AllowsSCTP()
+}
+
+func (f *pcapFilters) HasL4Addrs() bool {
+	return f.load().HasL4Addrs()
+}
+
+func (f *pcapFilters) AllowsL4Addr(port *uint16) bool {
+	return f.load().AllowsL4Addr(port)
+}
+
+func (f *pcapFilters) AllowsAnyL4Addr(ports ...uint16) bool {
+	return f.load().AllowsAnyL4Addr(ports...)
+}
+
+func (f *pcapFilters) DeniesAnyL4Addr(ports ...uint16) bool {
+	return f.load().DeniesAnyL4Addr(ports...)
+}
+
+func (f *pcapFilters) HasHosts() bool {
+	return f.load().HasHosts()
+}
+
+func (f *pcapFilters) HasAllowedHosts() bool {
+	return f.load().HasAllowedHosts()
+}
+
+func (f *pcapFilters) AllowsHostAddr(ip *netip.Addr) bool {
+	return f.load().AllowsHostAddr(ip)
+}
+
+func (f *pcapFilters) ObserveDNS(dns *layers.DNS, timestamp time.Time) {
+	f.load().ObserveDNS(dns, timestamp)
+}
+
+func (f *pcapFilters) HasTCPflags() bool {
+	return f.load().HasTCPflags()
+}
+
+func (f *pcapFilters) AllowsAnyTCPflags(flags *uint8) bool {
+	return f.load().AllowsAnyTCPflags(flags)
+}
+
+func (f *pcapFilters) DeniesSocket(
+	srcAddr *netip.Addr, srcPort *uint16,
+	dstAddr *netip.Addr, dstPort *uint16,
+) bool {
+	return f.load().DeniesSocket(srcAddr, srcPort, dstAddr, dstPort)
+}
+
+func (f *pcapFilters) AllowsSocket(
+	srcAddr *netip.Addr, srcPort *uint16,
+	dstAddr *netip.Addr, dstPort *uint16,
+) bool {
+	return f.load().AllowsSocket(srcAddr, srcPort, dstAddr, dstPort)
+}
+
 func ipLessThanFunc(a, b netip.Prefix) bool {
 	if a.Overlaps(b) {
 		return false
@@ -456,11 +1226,22 @@ func ipLessThanFunc(a, b netip.Prefix) bool {
 }
 
 func NewPcapFilters() *pcapFilters {
-	return &pcapFilters{
+	filters := &pcapFilters{}
+	filters.snapshot.Store(&pcapFilterSet{
+		l2: &pcapL2Filters{
+			macs:    mapset.NewSet[uint64](),
+			noMACs:  mapset.NewSet[uint64](),
+			vlans:   mapset.NewSet[uint16](),
+			noVLANs: mapset.NewSet[uint16](),
+		},
 		l3: &pcapL3Filters{
-			networks4: btree.NewG[netip.Prefix](2, ipLessThanFunc),
-			networks6: btree.NewG[netip.Prefix](2, ipLessThanFunc),
-			protos:    mapset.NewSet[uint8](),
+			networks4:   btree.NewG[netip.Prefix](2, ipLessThanFunc),
+			networks6:   btree.NewG[netip.Prefix](2, ipLessThanFunc),
+			noNetworks4: btree.NewG[netip.Prefix](2, ipLessThanFunc),
+			noNetworks6: btree.NewG[netip.Prefix](2, ipLessThanFunc),
+			hosts4:      btree.NewG[netip.Prefix](2, ipLessThanFunc),
+			hosts6:      btree.NewG[netip.Prefix](2, ipLessThanFunc),
+			protos:      mapset.NewSet[uint8](),
 		},
 		l4: &pcapL4Filters{
 			ports:   mapset.NewSet[uint16](),
@@ -469,5 +1250,7 @@ func NewPcapFilters() *pcapFilters {
 			protos:  mapset.NewSet[uint8](),
 		},
 		noSockets: mapset.NewSet[uint64](),
-	}
+		hosts:     newPcapHostFilters(filters),
+	})
+	return filters
 }
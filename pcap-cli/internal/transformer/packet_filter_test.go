@@ -15,11 +15,15 @@
 package transformer
 
 import (
+	"context"
+	"net"
 	"net/netip"
 	"strconv"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
 	"github.com/stretchr/testify/assert"
 	sf "github.com/wissance/stringFormatter"
 )
@@ -414,3 +418,182 @@ func TestHashSocket(
 		})
 	}
 }
+
+func TestDenyDualStackSocket(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	f := NewPcapFilters()
+
+	// `ss` reports IPv4 peers of sockets bound to `[::]` as IPv4-mapped IPv6 addresses
+	a.True(f.DenySocket("[::ffff:10.0.0.1]:8080", "[::ffff:10.0.0.2]:55555"))
+
+	local, remote := netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("10.0.0.2")
+	localPort, remotePort := uint16(8080), uint16(55555)
+	a.False(f.AllowsSocket(&remote, &remotePort, &local, &localPort))
+
+	// zones are not available in packets
+	a.True(f.DenySocket("[fe80::1%eth0]:8080", "[fe80::2%eth0]:55555"))
+
+	local, remote = netip.MustParseAddr("fe80::1"), netip.MustParseAddr("fe80::2")
+	a.False(f.AllowsSocket(&local, &localPort, &remote, &remotePort))
+}
+
+func TestRemoveFilters(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	f := newPcapFilters(t)
+	snapshot := f.Snapshot()
+
+	ip := netip.MustParseAddr("10.1.2.3")
+	port := uint16(8022)
+	flags := tcpFlags[tcpSynStr]
+
+	// removing an address does not remove the network which contains it
+	f.RemoveIPv4("10.1.2.3")
+	a.True(f.AllowsIP(&ip))
+
+	f.RemoveIPv4Range("10.0.0.0/8")
+	f.RemovePort(8022)
+	f.RemoveTCPFlags(TCP_FLAG_SYN)
+	f.RemoveL4Protos(L4_PROTO_TCP)
+
+	a.False(f.AllowsIP(&ip))
+	a.False(f.HasL4Addrs())
+	a.False(f.AllowsAnyTCPflags(&flags))
+	a.False(f.AllowsTCP())
+
+	// snapshots are not affected by later updates
+	a.True(snapshot.AllowsIP(&ip))
+	a.True(snapshot.AllowsL4Addr(&port))
+	a.True(snapshot.AllowsAnyTCPflags(&flags))
+	a.True(snapshot.AllowsTCP())
+
+	view := f.View()
+	a.Equal([]string{"127.0.0.1/32", "169.254.0.0/16"}, view.IPv4)
+	a.Equal([]string{"::1/128"}, view.IPv6)
+	a.Equal([]uint8{0x01, 0x11, 0x3A}, view.L4Protos)
+	a.Empty(view.Ports)
+	a.Equal([]string{"FIN", "RST"}, view.TCPFlags)
+}
+
+// TestDenyFiltersPrecedence verifies that denied networks and ports are never translated, even if they are allowed.
+func TestDenyFiltersPrecedence(t *testing.T) {
+	t.Parallel()
+
+	f := NewPcapFilters()
+	f.AddIPv4Ranges("10.0.0.0/8", "169.254.0.0/16")
+	f.DenyIPv4s("169.254.169.254")
+	f.DenyIPv4Range("10.10.0.0/16")
+	f.DenyPort(8080)
+
+	for _, tc := range []struct {
+		src, dst         net.IP
+		srcPort, dstPort layers.TCPPort
+		translated       bool
+	}{
+		{net.IPv4(10, 0, 0, 1), net.IPv4(169, 254, 1, 1), 40000, 443, true},
+		{net.IPv4(10, 0, 0, 1), net.IPv4(169, 254, 169, 254), 40000, 80, false},
+		{net.IPv4(10, 10, 0, 1), net.IPv4(10, 0, 0, 2), 40000, 443, false},
+		{net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2), 8080, 40000, false},
+		{net.IPv4(192, 168, 0, 1), net.IPv4(10, 0, 0, 2), 40000, 443, false},
+	} {
+		packet := newTestTCPPacket(t, tc.src, tc.dst, tc.srcPort, tc.dstPort)
+		w := &pcapTranslatorWorker{filters: f.Snapshot(), packet: &packet}
+		assert.Equal(t, tc.translated, w.shouldTranslate(context.Background()),
+			sf.Format("{0}:{1} > {2}:{3}", tc.src, tc.srcPort, tc.dst, tc.dstPort))
+	}
+
+	// denied networks are allowed again using the very same network
+	f.AllowIPv4("169.254.169.254")
+	f.AllowIPv4Range("10.10.0.0/16")
+	f.AllowPort(8080)
+	assert.False(t, f.HasDeniedIPv4s())
+	assert.False(t, f.HasL4Addrs())
+}
+
+func newL2FiltersTestFrame(t *testing.T, src, dst net.HardwareAddr, vlans ...uint16) gopacket.Packet {
+	eth := &layers.Ethernet{SrcMAC: src, DstMAC: dst, EthernetType: layers.EthernetTypeIPv4}
+	frame := []gopacket.SerializableLayer{eth}
+	for i, vlan := range vlans {
+		if i == 0 {
+			eth.EthernetType = layers.EthernetTypeDot1Q
+		}
+		tag := &layers.Dot1Q{VLANIdentifier: vlan, Priority: 5, Type: layers.EthernetTypeIPv4}
+		if i < len(vlans)-1 {
+			tag.Type = layers.EthernetTypeDot1Q
+		}
+		frame = append(frame, tag)
+	}
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolUDP, SrcIP: net.IPv4(10, 0, 0, 1), DstIP: net.IPv4(10, 0, 0, 2)}
+	udp := &layers.UDP{SrcPort: 40000, DstPort: 53}
+	udp.SetNetworkLayerForChecksum(ip)
+	frame = append(frame, ip, udp)
+
+	buffer := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	assert.NoError(t, gopacket.SerializeLayers(buffer, opts, frame...))
+	return gopacket.NewPacket(buffer.Bytes(), layers.LayerTypeEthernet, gopacket.Default)
+}
+
+func TestVLANTags(t *testing.T) {
+	t.Parallel()
+
+	local, _ := net.ParseMAC("42:01:0a:80:00:02")
+	gateway, _ := net.ParseMAC("42:01:0a:80:00:01")
+
+	packet := newL2FiltersTestFrame(t, local, gateway, 100, 7)
+	eth := packet.Layer(layers.LayerTypeEthernet).(*layers.Ethernet)
+	assert.Equal(t, []vlanTag{{id: 100, priority: 5}, {id: 7, priority: 5}}, vlanTags(eth))
+
+	packet = newL2FiltersTestFrame(t, local, gateway)
+	eth = packet.Layer(layers.LayerTypeEthernet).(*layers.Ethernet)
+	assert.Empty(t, vlanTags(eth))
+}
+
+func TestL2Filters(t *testing.T) {
+	t.Parallel()
+
+	local, _ := net.ParseMAC("42:01:0a:80:00:02")
+	gateway, _ := net.ParseMAC("42:01:0a:80:00:01")
+	tenant, _ := net.ParseMAC("42:01:0a:80:00:99")
+
+	f := NewPcapFilters()
+	f.AddMAC(local.String())
+	f.DenyMAC(tenant.String())
+	f.AddVLANs(100, 200)
+	f.DenyVLAN(7)
+
+	for _, tc := range []struct {
+		name       string
+		src, dst   net.HardwareAddr
+		vlans      []uint16
+		translated bool
+	}{
+		{"allowed", local, gateway, []uint16{100}, true},
+		{"reply", gateway, local, []uint16{200}, true},
+		{"untagged", local, gateway, nil, false},
+		{"other VLAN", local, gateway, []uint16{300}, false},
+		{"denied inner VLAN", local, gateway, []uint16{100, 7}, false},
+		{"other MACs", gateway, gateway, []uint16{100}, false},
+		{"denied MAC", local, tenant, []uint16{100}, false},
+	} {
+		packet := newL2FiltersTestFrame(t, tc.src, tc.dst, tc.vlans...)
+		w := &pcapTranslatorWorker{filters: f.Snapshot(), packet: &packet}
+		assert.Equal(t, tc.translated, w.shouldTranslate(context.Background()), tc.name)
+	}
+
+	view := f.View()
+	assert.Equal(t, []string{local.String()}, view.MACs)
+	assert.Equal(t, []string{tenant.String()}, view.DeniedMACs)
+	assert.Equal(t, []uint16{100, 200}, view.VLANs)
+	assert.Equal(t, []uint16{7}, view.DeniedVLANs)
+
+	f.RemoveMAC(local.String())
+	f.AllowMAC(tenant.String())
+	f.RemoveVLANs(100, 200)
+	f.AllowVLAN(7)
+	assert.False(t, f.HasL2Addrs())
+	assert.False(t, f.HasVLANs())
+}
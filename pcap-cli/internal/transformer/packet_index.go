@@ -0,0 +1,146 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+type (
+	packetIndexEntry struct {
+		digest uint64
+		serial uint64
+	}
+
+	// packetIndex maps digests of recently translated IP packets to their serials,
+	// so that ICMP errors can reference the translation of the packet that caused them:
+	//   - ICMP errors embed the IP header and at least 8 bytes of the payload of the original packet,
+	//   - digests only include fields which do not change in transit; i/e: TTL and checksum are not included.
+	packetIndex struct {
+		mu      *sync.Mutex
+		serials map[uint64]uint64
+		entries []packetIndexEntry
+		next    int
+	}
+)
+
+const (
+	// ICMP errors are expected shortly after the original packet, so only the most recent packets are indexed
+	packetIndexWindow = 4096
+	// minimum amount of bytes of the original packet's payload embedded in ICMP errors; see RFC 792
+	packetDigestPayloadSize = 8
+	ipv6HeaderSize          = 40
+)
+
+func newPacketIndex() *packetIndex {
+	return &packetIndex{
+		mu:      new(sync.Mutex),
+		serials: make(map[uint64]uint64, packetIndexWindow),
+		entries: make([]packetIndexEntry, packetIndexWindow),
+	}
+}
+
+func ipv4PacketDigest(header, payload []byte) (uint64, bool) {
+	if len(header) < 20 || len(payload) < packetDigestPayloadSize {
+		return 0, false
+	}
+	digest := fnv.New64a()
+	digest.Write(header[4:6])   // identification
+	digest.Write(header[9:10])  // protocol
+	digest.Write(header[12:20]) // source and destination addresses
+	digest.Write(payload[:packetDigestPayloadSize])
+	return digest.Sum64(), true
+}
+
+func ipv6PacketDigest(header, payload []byte) (uint64, bool) {
+	if len(header) < ipv6HeaderSize || len(payload) < packetDigestPayloadSize {
+		return 0, false
+	}
+	digest := fnv.New64a()
+	digest.Write([]byte{header[1] & 0x0F, header[2], header[3]}) // flow label
+	digest.Write(header[6:7])                                    // next header
+	digest.Write(header[8:ipv6HeaderSize])                       // source and destination addresses
+	digest.Write(payload[:packetDigestPayloadSize])
+	return digest.Sum64(), true
+}
+
+// embeddedPacketDigest calculates the digest of the original packet embedded in ICMP errors.
+func embeddedPacketDigest(packet []byte) (uint64, bool) {
+	if len(packet) == 0 {
+		return 0, false
+	}
+	switch packet[0] >> 4 {
+	case 4:
+		headerSize := int(packet[0]&0x0F) * 4
+		if len(packet) < headerSize {
+			return 0, false
+		}
+		return ipv4PacketDigest(packet[:headerSize], packet[headerSize:])
+	case 6:
+		if len(packet) < ipv6HeaderSize {
+			return 0, false
+		}
+		return ipv6PacketDigest(packet[:ipv6HeaderSize], packet[ipv6HeaderSize:])
+	}
+	return 0, false
+}
+
+func packetDigest(packet gopacket.Packet) (uint64, bool) {
+	switch ip := packet.NetworkLayer().(type) {
+	case *layers.IPv4:
+		return ipv4PacketDigest(ip.Contents, ip.Payload)
+	case *layers.IPv6:
+		return ipv6PacketDigest(ip.Contents, ip.Payload)
+	}
+	return 0, false
+}
+
+// add indexes `packet`; if the same packet is seen more than once, the most recent serial is retained.
+func (i *packetIndex) add(packet gopacket.Packet, serial uint64) {
+	digest, ok := packetDigest(packet)
+	if !ok {
+		return
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	// evict the oldest entry only if it was not overwritten by a more recent one
+	if evicted := i.entries[i.next]; evicted.serial != 0 && i.serials[evicted.digest] == evicted.serial {
+		delete(i.serials, evicted.digest)
+	}
+
+	i.entries[i.next] = packetIndexEntry{digest, serial}
+	i.serials[digest] = serial
+	i.next = (i.next + 1) % packetIndexWindow
+}
+
+// lookupICMP returns the serial of the packet embedded in the ICMP error carried by `packet`; if any.
+func (i *packetIndex) lookupICMP(packet gopacket.Packet) (uint64, bool) {
+	digest, ok := embeddedPacketDigest(icmpEmbeddedPayload(packet))
+	if !ok {
+		return 0, false
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	serial, ok := i.serials[digest]
+	return serial, ok
+}
@@ -0,0 +1,72 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+func newPacketIndexTestPacket(t *testing.T, ttl uint8, srcPort layers.UDPPort) []byte {
+	ip := newTestIPv4(net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2))
+	ip.Id = 4321
+	ip.TTL = ttl
+	return serializeTestPacket(t, ip, &layers.UDP{SrcPort: srcPort, DstPort: 53}, gopacket.Payload("query"))
+}
+
+func newPacketIndexTestICMPError(t *testing.T, embedded []byte) gopacket.Packet {
+	return newTestPacket(t, newTestIPv4(net.IPv4(10, 0, 0, 254), net.IPv4(10, 0, 0, 1)),
+		&layers.ICMPv4{
+			TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeTimeExceeded, layers.ICMPv4CodeTTLExceeded),
+		},
+		gopacket.Payload(embedded))
+}
+
+// TestPacketIndex verifies that ICMP errors are linked to the packets embedded in them.
+func TestPacketIndex(t *testing.T) {
+	t.Parallel()
+
+	index := newPacketIndex()
+
+	original := newPacketIndexTestPacket(t, 64, 40000)
+	index.add(gopacket.NewPacket(original, layers.LayerTypeIPv4, gopacket.Default), 7)
+	index.add(gopacket.NewPacket(newPacketIndexTestPacket(t, 64, 40001), layers.LayerTypeIPv4, gopacket.Default), 8)
+
+	// routers embed the packet as they received it: TTL and checksum are different
+	inTransit := newPacketIndexTestPacket(t, 1, 40000)
+	assert.NotEqual(t, original, inTransit)
+
+	// only the IP header and the 1st 8 bytes of the payload are required
+	serial, ok := index.lookupICMP(newPacketIndexTestICMPError(t, inTransit[:28]))
+	assert.True(t, ok)
+	assert.Equal(t, uint64(7), serial)
+
+	_, ok = index.lookupICMP(newPacketIndexTestICMPError(t, newPacketIndexTestPacket(t, 1, 40002)))
+	assert.False(t, ok)
+
+	_, ok = index.lookupICMP(newPacketIndexTestICMPError(t, inTransit[:24]))
+	assert.False(t, ok)
+
+	// older packets are evicted
+	for i := 0; i < packetIndexWindow; i++ {
+		index.add(gopacket.NewPacket(newPacketIndexTestPacket(t, 64, 40001), layers.LayerTypeIPv4, gopacket.Default), uint64(9+i))
+	}
+	_, ok = index.lookupICMP(newPacketIndexTestICMPError(t, inTransit))
+	assert.False(t, ok)
+}
@@ -0,0 +1,71 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/require"
+)
+
+// testPacketTimestamp is the capture time given to every packet built by newTestPacket.
+var testPacketTimestamp = time.Unix(1700000000, 0)
+
+// newTestIPv4 returns the IPv4 header used by test packets; callers may adjust it before serializing.
+func newTestIPv4(src, dst net.IP) *layers.IPv4 {
+	return &layers.IPv4{Version: 4, TTL: 64, SrcIP: src, DstIP: dst}
+}
+
+// serializeTestPacket serializes ip followed by transport and payload, fixing lengths and checksums.
+// The IP protocol is taken from the transport layer.
+func serializeTestPacket(t *testing.T, ip *layers.IPv4, transport gopacket.SerializableLayer, payload ...gopacket.SerializableLayer) []byte {
+	switch l4 := transport.(type) {
+	case *layers.TCP:
+		ip.Protocol = layers.IPProtocolTCP
+		require.NoError(t, l4.SetNetworkLayerForChecksum(ip))
+	case *layers.UDP:
+		ip.Protocol = layers.IPProtocolUDP
+		require.NoError(t, l4.SetNetworkLayerForChecksum(ip))
+	case *layers.SCTP:
+		ip.Protocol = layers.IPProtocolSCTP
+	case *layers.ICMPv4:
+		ip.Protocol = layers.IPProtocolICMPv4
+	}
+
+	buffer := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	require.NoError(t, gopacket.SerializeLayers(buffer, opts,
+		append([]gopacket.SerializableLayer{ip, transport}, payload...)...))
+	return buffer.Bytes()
+}
+
+// newTestPacket decodes a serialized test packet, with its capture length and timestamp set.
+func newTestPacket(t *testing.T, ip *layers.IPv4, transport gopacket.SerializableLayer, payload ...gopacket.SerializableLayer) gopacket.Packet {
+	data := serializeTestPacket(t, ip, transport, payload...)
+	packet := gopacket.NewPacket(data, layers.LayerTypeIPv4, gopacket.Default)
+	packet.Metadata().Timestamp = testPacketTimestamp
+	packet.Metadata().Length = len(data)
+	return packet
+}
+
+// newTestTCPPacket builds an ACK segment without payload from src:srcPort to dst:dstPort.
+func newTestTCPPacket(t *testing.T, src, dst net.IP, srcPort, dstPort layers.TCPPort) gopacket.Packet {
+	return newTestPacket(t, newTestIPv4(src, dst),
+		&layers.TCP{SrcPort: srcPort, DstPort: dstPort, ACK: true, Window: 1024})
+}
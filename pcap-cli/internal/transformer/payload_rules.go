@@ -0,0 +1,196 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/gopacket"
+)
+
+type (
+	// payloadRule matches application payloads either with a RE2 regex, or with a sequence of bytes:
+	// regexes match UTF-8 text, so binary patterns must be written as bytes instead.
+	payloadRule struct {
+		name    string
+		pattern *regexp.Regexp
+		bytes   []byte
+	}
+
+	// payloadRules tags translations with the names of the rules matched by their payload;
+	// if `selects` is set, packets whose payload does not match any rule are not translated.
+	payloadRules struct {
+		rules   []*payloadRule
+		selects bool
+	}
+
+	// payloadMatch is attached to the metadata of packets whose payload matched any rule.
+	payloadMatch struct {
+		rules []string
+	}
+)
+
+const (
+	payloadRulePattern   = "="
+	payloadRuleHexPrefix = "hex:"
+
+	payloadRulesSeparator = ';'
+	payloadRulesEscape    = '\\'
+)
+
+var errPayloadRuleInvalid = errors.New("invalid payload rule")
+
+// newPayloadRules parses rules formatted as `{name}={regex}` or `{name}=hex:{bytes}`;
+// it fails naming the first invalid rule, and it returns `nil` if no rules are available.
+//
+// i/e: `sqli=(?i)union\s+select`, `tls-hello=hex:16 03 01`
+func newPayloadRules(rules []string, selects bool) (*payloadRules, error) {
+	payload := &payloadRules{rules: make([]*payloadRule, 0, len(rules)), selects: selects}
+	for _, rawRule := range rules {
+		if strings.TrimSpace(rawRule) == "" {
+			continue
+		}
+		rule, err := parsePayloadRule(rawRule)
+		if err != nil {
+			return nil, fmt.Errorf("%w '%s': %w", errPayloadRuleInvalid, rawRule, err)
+		}
+		payload.rules = append(payload.rules, rule)
+	}
+	if len(payload.rules) == 0 {
+		return nil, nil
+	}
+	return payload, nil
+}
+
+func parsePayloadRule(rawRule string) (*payloadRule, error) {
+	name, rawPattern, ok := strings.Cut(strings.TrimSpace(rawRule), payloadRulePattern)
+	if !ok {
+		return nil, errors.New("must be '{name}={regex}' or '{name}=hex:{bytes}'")
+	}
+	if name = strings.TrimSpace(name); name == "" {
+		return nil, errors.New("name is empty")
+	}
+	if rawPattern == "" {
+		return nil, errors.New("pattern is empty")
+	}
+
+	rule := &payloadRule{name: name}
+	if !strings.HasPrefix(strings.ToLower(rawPattern), payloadRuleHexPrefix) {
+		pattern, err := regexp.Compile(rawPattern)
+		if err != nil {
+			return nil, err
+		}
+		rule.pattern = pattern
+		return rule, nil
+	}
+
+	// bytes may be separated by spaces or colons; i/e: `16 03 01` or `16:03:01`
+	rawBytes := strings.NewReplacer(" ", "", ":", "").Replace(rawPattern[len(payloadRuleHexPrefix):])
+	patternBytes, err := hex.DecodeString(rawBytes)
+	if err != nil {
+		return nil, err
+	}
+	if len(patternBytes) == 0 {
+		return nil, errors.New("bytes are empty")
+	}
+	rule.bytes = patternBytes
+	return rule, nil
+}
+
+// ValidatePayloadRules fails naming the first rule which is not `{name}={regex}` nor `{name}=hex:{bytes}`.
+func ValidatePayloadRules(rules []string) error {
+	_, err := newPayloadRules(rules, false)
+	return err
+}
+
+// SplitPayloadRules splits `rules` separated by `;`: separators escaped as `\;` are kept as part of the rule,
+// which RE2 matches as a literal `;`; i/e: `stmt=SELECT 1\;;tls=hex:16 03 01`.
+func SplitPayloadRules(rules string) []string {
+	split := []string{}
+	start := 0
+	escaped := false
+	for i := 0; i < len(rules); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case rules[i] == payloadRulesEscape:
+			escaped = true
+		case rules[i] == payloadRulesSeparator:
+			split = append(split, rules[start:i])
+			start = i + 1
+		}
+	}
+	return append(split, rules[start:])
+}
+
+func (r *payloadRule) matches(payload []byte) bool {
+	if r.pattern != nil {
+		return r.pattern.Match(payload)
+	}
+	return bytes.Contains(payload, r.bytes)
+}
+
+// payloadOf returns the application payload of `packet`: if its TCP stream is being reassembled,
+// segments which only carry the beginning of a message have no payload; it is matched along with the segment completing it.
+func payloadOf(packet gopacket.Packet) []byte {
+	if reassembly := tcpReassemblyOf(packet); reassembly != nil {
+		return reassembly.data
+	}
+	if transport := packet.TransportLayer(); transport != nil {
+		return transport.LayerPayload()
+	}
+	return nil
+}
+
+// match attaches the names of the rules matched by the payload of `packet` to its metadata;
+// it returns whether the packet must be translated.
+func (p *payloadRules) match(packet gopacket.Packet) bool {
+	if p == nil {
+		return true
+	}
+
+	payload := payloadOf(packet)
+	if len(payload) == 0 {
+		return !p.selects
+	}
+
+	matched := []string{}
+	for _, rule := range p.rules {
+		if rule.matches(payload) {
+			matched = append(matched, rule.name)
+		}
+	}
+	if len(matched) == 0 {
+		return !p.selects
+	}
+
+	metadata := packet.Metadata()
+	metadata.AncillaryData = append(metadata.AncillaryData, &payloadMatch{rules: matched})
+	return true
+}
+
+func payloadMatchOf(packet gopacket.Packet) *payloadMatch {
+	for _, data := range packet.Metadata().AncillaryData {
+		if match, ok := data.(*payloadMatch); ok {
+			return match
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newPayloadRulesTestPacket(t *testing.T, payload []byte) gopacket.Packet {
+	return newTestPacket(t, newTestIPv4(net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)),
+		&layers.UDP{SrcPort: 40000, DstPort: 9999}, gopacket.Payload(payload))
+}
+
+// TestPayloadRules verifies that regex and byte-pattern rules tag packets with the names of all matching rules.
+func TestPayloadRules(t *testing.T) {
+	t.Parallel()
+
+	rules, err := newPayloadRules(nil, false)
+	assert.NoError(t, err)
+	assert.Nil(t, rules)
+
+	rules, err = newPayloadRules([]string{
+		`sqli=(?i)union\s+select`,
+		"tls-hello=hex:16 03 01",
+		"select=SELECT",
+	}, false)
+	require.NoError(t, err)
+	assert.Len(t, rules.rules, 3)
+
+	packet := newPayloadRulesTestPacket(t, []byte("id=1 UNION  SELECT password"))
+	assert.True(t, rules.match(packet))
+	assert.Equal(t, []string{"sqli", "select"}, payloadMatchOf(packet).rules)
+
+	packet = newPayloadRulesTestPacket(t, []byte{0x16, 0x03, 0x01, 0x02, 0x00, 0xff})
+	assert.True(t, rules.match(packet))
+	assert.Equal(t, []string{"tls-hello"}, payloadMatchOf(packet).rules)
+
+	// packets not matching any rule are still translated, but not tagged
+	packet = newPayloadRulesTestPacket(t, []byte("hello"))
+	assert.True(t, rules.match(packet))
+	assert.Nil(t, payloadMatchOf(packet))
+
+	// `nil` rules translate all packets
+	var noRules *payloadRules = nil
+	assert.True(t, noRules.match(packet))
+}
+
+// TestPayloadRulesSelect verifies that only packets matching any rule are translated when rules select packets.
+func TestPayloadRulesSelect(t *testing.T) {
+	t.Parallel()
+
+	rules, err := newPayloadRules([]string{"tls-hello=hex:16:03:01"}, true)
+	require.NoError(t, err)
+
+	assert.True(t, rules.match(newPayloadRulesTestPacket(t, []byte{0x16, 0x03, 0x01, 0x00})))
+	assert.False(t, rules.match(newPayloadRulesTestPacket(t, []byte("hello"))))
+	// packets without payload never match
+	assert.False(t, rules.match(newPayloadRulesTestPacket(t, nil)))
+
+	// segments which only carry the beginning of a reassembled message are matched along with the segment completing it
+	packet := newPayloadRulesTestPacket(t, []byte{0x16, 0x03, 0x01, 0x00})
+	metadata := packet.Metadata()
+	metadata.AncillaryData = append(metadata.AncillaryData, &tcpReassembly{pending: true})
+	assert.False(t, rules.match(packet))
+}
+
+// TestPayloadRulesInvalid verifies that invalid rules are reported by name instead of being ignored:
+// ignoring all rules would translate all packets even if rules select packets.
+func TestPayloadRulesInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, rule := range []string{"sqli", "=union", "bad=(", "bin=hex:zz", "empty=hex:", "none="} {
+		t.Run(rule, func(t *testing.T) {
+			t.Parallel()
+
+			rules, err := newPayloadRules([]string{"tls-hello=hex:16 03 01", rule}, true)
+			assert.Nil(t, rules)
+			assert.ErrorIs(t, err, errPayloadRuleInvalid)
+			assert.ErrorContains(t, err, "'"+rule+"'")
+			assert.Equal(t, err, ValidatePayloadRules([]string{"tls-hello=hex:16 03 01", rule}))
+		})
+	}
+}
+
+// TestSplitPayloadRules verifies that escaped separators are kept as part of regexes.
+func TestSplitPayloadRules(t *testing.T) {
+	t.Parallel()
+
+	// escaped backslashes do not escape separators
+	assert.Equal(t, []string{`dir=C:\\`, "tls=hex:16 03 01"}, SplitPayloadRules(`dir=C:\\;tls=hex:16 03 01`))
+
+	rules := SplitPayloadRules(`stmt=SELECT 1\;;tls=hex:16 03 01`)
+	assert.Equal(t, []string{`stmt=SELECT 1\;`, "tls=hex:16 03 01"}, rules)
+
+	payload, err := newPayloadRules(rules, true)
+	require.NoError(t, err)
+	assert.Len(t, payload.rules, 2)
+
+	packet := newPayloadRulesTestPacket(t, []byte("SELECT 1;"))
+	assert.True(t, payload.match(packet))
+	assert.Equal(t, []string{"stmt"}, payloadMatchOf(packet).rules)
+}
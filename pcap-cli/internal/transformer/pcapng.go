@@ -0,0 +1,203 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// see: https://www.ietf.org/archive/id/draft-ietf-opsawg-pcapng-02.html
+
+type (
+	pcapngOption struct {
+		code  uint16
+		value []byte
+	}
+
+	// pcapngInterfaces assigns stable IDs to interfaces: every file declares interfaces in the same order,
+	// so that packets do not need to know which file they are written into.
+	pcapngInterfaces struct {
+		mutex sync.Mutex
+		ids   map[string]uint32
+		// IDBs indexed by interface ID
+		blocks [][]byte
+	}
+)
+
+const (
+	pcapngBlockTypeSHB = uint32(0x0A0D0D0A)
+	pcapngBlockTypeIDB = uint32(0x00000001)
+	pcapngBlockTypeEPB = uint32(0x00000006)
+
+	pcapngByteOrderMagic = uint32(0x1A2B3C4D)
+
+	pcapngOptionEndOfOpt = uint16(0)
+	pcapngOptionComment  = uint16(1)
+
+	pcapngOptionSHBUserAppl = uint16(4)
+
+	pcapngOptionIfName        = uint16(2)
+	pcapngOptionIfDescription = uint16(3)
+	pcapngOptionIfTsResol     = uint16(9)
+
+	// timestamps are written with nanosecond resolution: 10^-9
+	pcapngTsResolNanos = byte(9)
+
+	pcapngUserAppl = "pcap-sidecar"
+)
+
+var pcapngByteOrder = binary.LittleEndian
+
+func pcapngPad(size int) int {
+	return (4 - (size % 4)) % 4
+}
+
+func newPcapngInterfaces() *pcapngInterfaces {
+	return &pcapngInterfaces{ids: make(map[string]uint32)}
+}
+
+// id returns the ID of the interface, which is assigned the 1st time it is seen.
+func (i *pcapngInterfaces) id(linkType uint16, name, description string) uint32 {
+	key := fmt.Sprintf("%d/%s/%s", linkType, name, description)
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if id, ok := i.ids[key]; ok {
+		return id
+	}
+	id := uint32(len(i.blocks))
+	i.ids[key] = id
+	i.blocks = append(i.blocks, appendPcapngInterfaceDescriptionBlock(nil, linkType, name, description))
+	return id
+}
+
+// header returns the SHB if nothing was written into the file yet, followed by the IDBs which `block` requires and the file did not declare yet:
+// interfaces are declared in the order of their IDs, so a file which declared `declared` interfaces declared IDs `[0, declared)`.
+func (i *pcapngInterfaces) header(block []byte, declared int) ([]byte, int) {
+	var header []byte
+	if declared < 0 {
+		header = appendPcapngSectionHeaderBlock(nil)
+		declared = 0
+	}
+
+	// the interface ID is the 1st field of the body of EPBs
+	if len(block) < 12 || pcapngByteOrder.Uint32(block) != pcapngBlockTypeEPB {
+		return header, declared
+	}
+	id := int(pcapngByteOrder.Uint32(block[8:]))
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	for ; declared <= id && declared < len(i.blocks); declared++ {
+		header = append(header, i.blocks[declared]...)
+	}
+	return header, declared
+}
+
+func newPcapngStringOption(code uint16, value string) pcapngOption {
+	return pcapngOption{code: code, value: []byte(value)}
+}
+
+func appendPcapngOptions(b []byte, options []pcapngOption) []byte {
+	if len(options) == 0 {
+		return b
+	}
+	for _, option := range options {
+		b = pcapngByteOrder.AppendUint16(b, option.code)
+		b = pcapngByteOrder.AppendUint16(b, uint16(len(option.value)))
+		b = append(b, option.value...)
+		b = append(b, make([]byte, pcapngPad(len(option.value)))...)
+	}
+	// opt_endofopt
+	b = pcapngByteOrder.AppendUint16(b, pcapngOptionEndOfOpt)
+	return pcapngByteOrder.AppendUint16(b, 0)
+}
+
+// appendPcapngBlock appends a complete block: `type`, `total length`, `body`, `options`, and `total length`.
+func appendPcapngBlock(b []byte, blockType uint32, body []byte, options []pcapngOption) []byte {
+	body = appendPcapngOptions(body, options)
+	// `type` + 2*`total length` = 12 bytes
+	totalLength := uint32(12 + len(body))
+
+	b = pcapngByteOrder.AppendUint32(b, blockType)
+	b = pcapngByteOrder.AppendUint32(b, totalLength)
+	b = append(b, body...)
+	return pcapngByteOrder.AppendUint32(b, totalLength)
+}
+
+func appendPcapngSectionHeaderBlock(b []byte) []byte {
+	body := make([]byte, 0, 16)
+	body = pcapngByteOrder.AppendUint32(body, pcapngByteOrderMagic)
+	body = pcapngByteOrder.AppendUint16(body, 1) // major version
+	body = pcapngByteOrder.AppendUint16(body, 0) // minor version
+	// section length is not known in advance: -1
+	body = pcapngByteOrder.AppendUint64(body, 0xFFFFFFFFFFFFFFFF)
+
+	return appendPcapngBlock(b, pcapngBlockTypeSHB, body, []pcapngOption{
+		newPcapngStringOption(pcapngOptionSHBUserAppl, pcapngUserAppl),
+	})
+}
+
+func appendPcapngInterfaceDescriptionBlock(
+	b []byte,
+	linkType uint16,
+	name, description string,
+) []byte {
+	body := make([]byte, 0, 8)
+	body = pcapngByteOrder.AppendUint16(body, linkType)
+	body = pcapngByteOrder.AppendUint16(body, 0) // reserved
+	body = pcapngByteOrder.AppendUint32(body, 0) // snaplen: no limit
+
+	options := []pcapngOption{
+		newPcapngStringOption(pcapngOptionIfName, name),
+		{code: pcapngOptionIfTsResol, value: []byte{pcapngTsResolNanos}},
+	}
+	if description != "" {
+		options = append(options, newPcapngStringOption(pcapngOptionIfDescription, description))
+	}
+
+	return appendPcapngBlock(b, pcapngBlockTypeIDB, body, options)
+}
+
+func appendPcapngEnhancedPacketBlock(
+	b []byte,
+	interfaceID uint32,
+	timestamp time.Time,
+	length int,
+	data []byte,
+	comment string,
+) []byte {
+	body := make([]byte, 0, 20+len(data)+pcapngPad(len(data)))
+	ts := uint64(timestamp.UnixNano())
+	body = pcapngByteOrder.AppendUint32(body, interfaceID)
+	body = pcapngByteOrder.AppendUint32(body, uint32(ts>>32))
+	body = pcapngByteOrder.AppendUint32(body, uint32(ts))
+	body = pcapngByteOrder.AppendUint32(body, uint32(len(data)))
+	body = pcapngByteOrder.AppendUint32(body, uint32(length))
+	body = append(body, data...)
+	body = append(body, make([]byte, pcapngPad(len(data)))...)
+
+	var options []pcapngOption = nil
+	if comment != "" {
+		options = []pcapngOption{newPcapngStringOption(pcapngOptionComment, comment)}
+	}
+
+	return appendPcapngBlock(b, pcapngBlockTypeEPB, body, options)
+}
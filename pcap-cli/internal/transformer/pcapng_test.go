@@ -0,0 +1,132 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"bytes"
+	"io"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPcapngSections verifies that self-contained pcapng sections can be concatenated and read back.
+func TestPcapngSections(t *testing.T) {
+	t.Parallel()
+
+	packets := [][]byte{
+		{0x01, 0x02, 0x03},
+		{0x01, 0x02, 0x03, 0x04},
+		{0x01, 0x02, 0x03, 0x04, 0x05},
+	}
+	timestamp := time.Unix(1700000000, 123456789).UTC()
+
+	var file []byte
+	for i, packet := range packets {
+		section := appendPcapngSectionHeaderBlock(nil)
+		section = appendPcapngInterfaceDescriptionBlock(section, uint16(layers.LinkTypeEthernet), "eth0", "2/eth0")
+		section = appendPcapngEnhancedPacketBlock(section, 0, timestamp, len(packet)+i, packet, "flow:1")
+		// all blocks must be 32-bit aligned
+		assert.Zero(t, len(section)%4)
+		file = append(file, section...)
+	}
+
+	reader, err := pcapgo.NewNgReader(bytes.NewReader(file), pcapgo.DefaultNgReaderOptions)
+	assert.NoError(t, err)
+	assert.Equal(t, layers.LinkTypeEthernet, reader.LinkType())
+
+	for i, packet := range packets {
+		data, ci, err := reader.ReadPacketData()
+		assert.NoError(t, err)
+		assert.Equal(t, packet, data)
+		assert.Equal(t, len(packet), ci.CaptureLength)
+		assert.Equal(t, len(packet)+i, ci.Length)
+		assert.True(t, timestamp.Equal(ci.Timestamp))
+	}
+
+	_, _, err = reader.ReadPacketData()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+// TestPcapngInterfaces verifies that interfaces keep their IDs across files, and that every file declares them before they are used.
+func TestPcapngInterfaces(t *testing.T) {
+	t.Parallel()
+
+	interfaces := newPcapngInterfaces()
+	eth0 := interfaces.id(uint16(layers.LinkTypeEthernet), "eth0", "2/eth0")
+	lo := interfaces.id(uint16(layers.LinkTypeEthernet), "lo", "1/lo")
+	assert.Equal(t, uint32(0), eth0)
+	assert.Equal(t, uint32(1), lo)
+	assert.Equal(t, eth0, interfaces.id(uint16(layers.LinkTypeEthernet), "eth0", "2/eth0"))
+
+	timestamp := time.Unix(1700000000, 0).UTC()
+	write := func(ids ...uint32) []byte {
+		var file []byte
+		declared := -1
+		for i, id := range ids {
+			block := appendPcapngEnhancedPacketBlock(nil, id, timestamp, 1, []byte{byte(i)}, "")
+			var header []byte
+			header, declared = interfaces.header(block, declared)
+			file = append(append(file, header...), block...)
+		}
+		return file
+	}
+
+	for _, ids := range [][]uint32{{eth0, lo, eth0}, {lo, eth0}, {lo}} {
+		file := write(ids...)
+		reader, err := pcapgo.NewNgReader(bytes.NewReader(file), pcapgo.DefaultNgReaderOptions)
+		require.NoError(t, err)
+		for i, id := range ids {
+			data, ci, err := reader.ReadPacketData()
+			require.NoError(t, err)
+			assert.Equal(t, []byte{byte(i)}, data)
+			assert.Equal(t, int(id), ci.InterfaceIndex)
+		}
+		_, _, err = reader.ReadPacketData()
+		assert.ErrorIs(t, err, io.EOF)
+
+		// interfaces are declared once per file, in the order of their IDs
+		assert.Equal(t, int(slices.Max(ids))+1, reader.NInterfaces())
+		assert.Equal(t, 1, bytes.Count(file, pcapngByteOrder.AppendUint32(nil, pcapngByteOrderMagic)))
+		iface, err := reader.Interface(int(lo))
+		require.NoError(t, err)
+		assert.Equal(t, "lo", iface.Name)
+	}
+
+	// blocks which do not refer to interfaces only require the SHB
+	header, declared := interfaces.header(appendPcapngSectionHeaderBlock(nil), -1)
+	assert.Equal(t, appendPcapngSectionHeaderBlock(nil), header)
+	assert.Zero(t, declared)
+}
+
+// TestPcapngOptions verifies options padding and termination.
+func TestPcapngOptions(t *testing.T) {
+	t.Parallel()
+
+	options := appendPcapngOptions(nil, []pcapngOption{
+		newPcapngStringOption(pcapngOptionComment, "abcde"),
+	})
+	// code(2) + length(2) + value(5) + padding(3) + opt_endofopt(4)
+	assert.Len(t, options, 16)
+	assert.Equal(t, []byte("abcde\x00\x00\x00"), options[4:12])
+	assert.Equal(t, []byte{0, 0, 0, 0}, options[12:])
+
+	assert.Empty(t, appendPcapngOptions(nil, nil))
+}
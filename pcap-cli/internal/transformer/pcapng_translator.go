@@ -0,0 +1,143 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build json && pcapng
+
+package transformer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/pkg/errors"
+	"github.com/wissance/stringFormatter"
+)
+
+type (
+	// PcapngPcapTranslator relies on `JSONPcapTranslator` to analyze packets:
+	//   - flow and trace tracking is exactly the same for both formats,
+	//   - only the output is different: raw packets + comments.
+	PcapngPcapTranslator struct {
+		*JSONPcapTranslator
+		interfaces *pcapngInterfaces
+	}
+
+	pcapngTranslation struct {
+		block []byte
+	}
+)
+
+const pcapngTranslationCommentTemplate = "{0} | trace:{1} | span:{2}"
+
+func init() {
+	registerTranslator(PCAPNG, newPcapngPcapTranslator)
+}
+
+func (t *pcapngTranslation) String() string {
+	return string(t.block)
+}
+
+func (t *PcapngPcapTranslator) linkType(p *gopacket.Packet) layers.LinkType {
+	if linkLayer := (*p).LinkLayer(); linkLayer != nil {
+		switch linkLayer.LayerType() {
+		case layers.LayerTypeEthernet:
+			return layers.LinkTypeEthernet
+		case layers.LayerTypeLinuxSLL:
+			return layers.LinkTypeLinuxSLL
+		}
+	}
+	// packets captured on L3 devices; i/e: `tun`
+	return layers.LinkTypeRaw
+}
+
+// for pcapng translator, this method generates an Enhanced Packet Block:
+//   - it refers to its interface by the ID assigned by `interfaces`,
+//   - the Section Header Block and the Interface Description Blocks are written by writers once per file; see `Header`.
+func (t *PcapngPcapTranslator) finalize(
+	ctx context.Context,
+	ifaces netIfaceIndex,
+	iface *PcapIface,
+	serial *uint64,
+	p *gopacket.Packet,
+	conntrack bool,
+	packet fmt.Stringer,
+) (fmt.Stringer, error) {
+	// JSON translation is always available, even if `finalize` fails
+	translation, err := t.JSONPcapTranslator.finalizeJSON(ctx, ifaces, iface, serial, p, conntrack, packet)
+
+	json := t.asTranslation(translation)
+
+	comment, _ := json.S("message").Data().(string)
+	if trace, ok := json.S("logging.googleapis.com/trace").Data().(string); ok {
+		span, _ := json.S("logging.googleapis.com/spanId").Data().(string)
+		comment = stringFormatter.Format(pcapngTranslationCommentTemplate,
+			comment, trace[strings.LastIndex(trace, "/")+1:], span)
+	}
+
+	ifaceIndex, ifaceName := t.iface.Index, t.iface.Name
+	if index, ok := json.S("iface", "index").Data().(uint8); ok {
+		ifaceIndex = index
+		ifaceName, _ = json.S("iface", "name").Data().(string)
+	}
+
+	info := (*p).Metadata().CaptureInfo
+	data := (*p).Data()
+
+	interfaceID := t.interfaces.id(uint16(t.linkType(p)),
+		ifaceName, stringFormatter.Format("{0}/{1}", ifaceIndex, ifaceName))
+
+	block := make([]byte, 0, 64+len(data)+len(comment))
+	block = appendPcapngEnhancedPacketBlock(block, interfaceID,
+		info.Timestamp, info.Length, data, comment)
+
+	return &pcapngTranslation{block}, err
+}
+
+// Header implements `PcapFileHeader`: files start with a Section Header Block,
+// and interfaces are declared right before the 1st packet which refers to them.
+func (t *PcapngPcapTranslator) Header(translation []byte, declared int) ([]byte, int) {
+	return t.interfaces.header(translation, declared)
+}
+
+func (t *PcapngPcapTranslator) write(
+	_ context.Context,
+	writer io.Writer,
+	packet *fmt.Stringer,
+) (int, error) {
+	translation, ok := (*packet).(*pcapngTranslation)
+	if !ok {
+		return 0, errors.New("invalid pcapng translation")
+	}
+	writtenBytes, err := writer.Write(translation.block)
+	if err != nil {
+		return writtenBytes, errors.Wrap(err, "failed to write pcapng translation")
+	}
+	return writtenBytes, nil
+}
+
+func newPcapngPcapTranslator(
+	ctx context.Context,
+	debug bool,
+	iface *PcapIface,
+	ephemerals *PcapEphemeralPorts,
+) PcapTranslator {
+	return &PcapngPcapTranslator{
+		JSONPcapTranslator: newJSONPcapTranslator(ctx, debug, iface, ephemerals).(*JSONPcapTranslator),
+		interfaces:         newPcapngInterfaces(),
+	}
+}
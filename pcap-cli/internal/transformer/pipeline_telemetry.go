@@ -0,0 +1,216 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// PipelineStage is a step taken by packets from the moment they are captured until their translations are written.
+	PipelineStage uint8
+
+	// PipelineStageStats describes how long packets spent in a stage since the telemetry was created.
+	PipelineStageStats struct {
+		Stage PipelineStage
+		Count uint64
+		Sum   time.Duration
+		Max   time.Duration
+		// `Buckets[i]` counts observations not greater than `PipelineLatencyBounds[i]`; the last one counts all others
+		Buckets []uint64
+	}
+
+	// PipelineSpan is the time a traced packet spent in a stage.
+	PipelineSpan struct {
+		Stage      PipelineStage
+		Start, End time.Time
+	}
+
+	// PipelineTrace describes how a traced packet went through all stages but `PipelineWrite`:
+	// translations are written once per writer, so writes are only measured.
+	PipelineTrace struct {
+		Iface  string
+		Serial uint64
+		Spans  []PipelineSpan
+	}
+
+	// PipelineTelemetry measures every stage of the pipeline of all transformers sharing it, and traces 1 out of every N packets:
+	//   - i/e: `context.WithValue(ctx, ContextPipelineTelemetry, NewPipelineTelemetry(1000, onTrace))`,
+	//   - all methods are safe to be used on `nil`, which disables telemetry.
+	PipelineTelemetry struct {
+		createdAt  time.Time
+		sampleRate uint64
+		onTrace    func(*PipelineTrace)
+		stages     [pipelineStages]pipelineStageCounters
+	}
+
+	pipelineStageCounters struct {
+		count, sum, max atomic.Uint64
+		buckets         [pipelineBuckets]atomic.Uint64
+	}
+
+	// pipelineTracer collects the spans of a traced packet; it is `nil` if the packet is not traced.
+	pipelineTracer struct {
+		telemetry *PipelineTelemetry
+		trace     *PipelineTrace
+	}
+)
+
+const (
+	// from the moment the packet was captured until it is applied to the transformer
+	PipelineCapture PipelineStage = iota
+	// all layers translated and merged, along with the translation of the packet itself
+	PipelineTranslate
+	// translations of layers merged into the translation of the packet; it is part of `PipelineTranslate`
+	PipelineMerge
+	PipelineFinalize
+	// translations pushed into the queues of writers: it blocks if any writer is saturated
+	PipelinePublish
+	// translations written by writers
+	PipelineWrite
+	pipelineStages
+)
+
+var (
+	PipelineLatencyBounds = []time.Duration{
+		10 * time.Microsecond, 50 * time.Microsecond, 100 * time.Microsecond, 500 * time.Microsecond,
+		time.Millisecond, 5 * time.Millisecond, 10 * time.Millisecond, 50 * time.Millisecond,
+		100 * time.Millisecond, 500 * time.Millisecond, time.Second,
+	}
+
+	pipelineStageNames = [pipelineStages]string{"capture", "translate", "merge", "finalize", "publish", "write"}
+)
+
+const pipelineBuckets = 12 // 1 per bound, and 1 for all others
+
+func (s PipelineStage) String() string {
+	if s >= pipelineStages {
+		return "unknown"
+	}
+	return pipelineStageNames[s]
+}
+
+// NewPipelineTelemetry creates the telemetry of transformers; `onTrace` is called with 1 out of every `sampleRate` packets,
+// unless `sampleRate` is 0 or `onTrace` is `nil`.
+func NewPipelineTelemetry(sampleRate uint, onTrace func(*PipelineTrace)) *PipelineTelemetry {
+	if onTrace == nil {
+		sampleRate = 0
+	}
+	return &PipelineTelemetry{
+		createdAt:  time.Now(),
+		sampleRate: uint64(sampleRate),
+		onTrace:    onTrace,
+	}
+}
+
+// CreatedAt is the start of all stats; i/e: of cumulative metrics.
+func (t *PipelineTelemetry) CreatedAt() time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return t.createdAt
+}
+
+// Stats returns the stats of all stages, in the order in which packets go through them.
+func (t *PipelineTelemetry) Stats() []PipelineStageStats {
+	if t == nil {
+		return nil
+	}
+	stats := make([]PipelineStageStats, pipelineStages)
+	for i := range t.stages {
+		counters := &t.stages[i]
+		stats[i] = PipelineStageStats{
+			Stage:   PipelineStage(i),
+			Count:   counters.count.Load(),
+			Sum:     time.Duration(counters.sum.Load()),
+			Max:     time.Duration(counters.max.Load()),
+			Buckets: make([]uint64, pipelineBuckets),
+		}
+		for j := range counters.buckets {
+			stats[i].Buckets[j] = counters.buckets[j].Load()
+		}
+	}
+	return stats
+}
+
+// now returns the zero time if telemetry is disabled: packets are not slowed down by reading the clock.
+func (t *PipelineTelemetry) now() time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+func (t *PipelineTelemetry) observe(stage PipelineStage, start, end time.Time) {
+	if t == nil || start.IsZero() || end.Before(start) {
+		return
+	}
+	t.record(stage, end.Sub(start))
+}
+
+// record accounts for stages which are not contiguous; i/e: merging is interleaved with translating layers.
+func (t *PipelineTelemetry) record(stage PipelineStage, duration time.Duration) {
+	if t == nil {
+		return
+	}
+	latency := uint64(duration)
+	counters := &t.stages[stage]
+	counters.count.Add(1)
+	counters.sum.Add(latency)
+	for _max := counters.max.Load(); latency > _max; _max = counters.max.Load() {
+		if counters.max.CompareAndSwap(_max, latency) {
+			break
+		}
+	}
+	bucket := len(PipelineLatencyBounds)
+	for i, bound := range PipelineLatencyBounds {
+		if latency <= uint64(bound) {
+			bucket = i
+			break
+		}
+	}
+	counters.buckets[bucket].Add(1)
+}
+
+// trace returns a tracer for 1 out of every `sampleRate` packets, and `nil` for all others.
+func (t *PipelineTelemetry) trace(iface *PcapIface, serial uint64) *pipelineTracer {
+	if t == nil || t.sampleRate == 0 || serial%t.sampleRate != 0 {
+		return nil
+	}
+	return &pipelineTracer{
+		telemetry: t,
+		trace: &PipelineTrace{
+			Iface:  iface.Name,
+			Serial: serial,
+			Spans:  make([]PipelineSpan, 0, pipelineStages),
+		},
+	}
+}
+
+// span must only be called by the goroutine which owns the packet at `stage`: stages do not overlap.
+func (tr *pipelineTracer) span(stage PipelineStage, start, end time.Time) {
+	if tr == nil || start.IsZero() {
+		return
+	}
+	tr.trace.Spans = append(tr.trace.Spans, PipelineSpan{Stage: stage, Start: start, End: end})
+}
+
+func (tr *pipelineTracer) end() {
+	if tr == nil {
+		return
+	}
+	tr.telemetry.onTrace(tr.trace)
+}
@@ -0,0 +1,72 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestPipelineTelemetry verifies that stages are measured into buckets, that only sampled packets are traced,
+// and that disabled telemetry is safe to be used.
+func TestPipelineTelemetry(t *testing.T) {
+	t.Parallel()
+
+	var disabled *PipelineTelemetry
+	disabled.observe(PipelineWrite, time.Now(), time.Now())
+	assert.True(t, disabled.now().IsZero())
+	assert.Nil(t, disabled.Stats())
+	assert.Nil(t, disabled.trace(&PcapIface{Name: "eth0"}, 0))
+
+	traces := []*PipelineTrace{}
+	telemetry := NewPipelineTelemetry(10, func(trace *PipelineTrace) {
+		traces = append(traces, trace)
+	})
+
+	start := time.Now()
+	telemetry.observe(PipelineWrite, start, start.Add(20*time.Microsecond))
+	telemetry.observe(PipelineWrite, start, start.Add(2*time.Second))
+	telemetry.record(PipelineMerge, time.Millisecond)
+	// the clock of captured packets may be skewed: negative latencies are ignored
+	telemetry.observe(PipelineCapture, start, start.Add(-time.Second))
+	// packets without timestamp are not measured
+	telemetry.observe(PipelineCapture, time.Time{}, start)
+
+	stats := telemetry.Stats()
+	assert.Len(t, stats, int(pipelineStages))
+	assert.Equal(t, "write", stats[PipelineWrite].Stage.String())
+	assert.Equal(t, uint64(2), stats[PipelineWrite].Count)
+	assert.Equal(t, 2*time.Second+20*time.Microsecond, stats[PipelineWrite].Sum)
+	assert.Equal(t, 2*time.Second, stats[PipelineWrite].Max)
+	assert.Equal(t, uint64(1), stats[PipelineWrite].Buckets[1])
+	assert.Equal(t, uint64(1), stats[PipelineWrite].Buckets[len(PipelineLatencyBounds)])
+	assert.Equal(t, uint64(1), stats[PipelineMerge].Buckets[4])
+	assert.Zero(t, stats[PipelineCapture].Count)
+
+	iface := &PcapIface{Name: "eth0"}
+	assert.Nil(t, telemetry.trace(iface, 7))
+	tracer := telemetry.trace(iface, 20)
+	tracer.span(PipelineTranslate, start, start.Add(time.Millisecond))
+	tracer.span(PipelineFinalize, time.Time{}, start)
+	tracer.end()
+	assert.Len(t, traces, 1)
+	assert.Equal(t, uint64(20), traces[0].Serial)
+	assert.Equal(t, []PipelineSpan{{Stage: PipelineTranslate, Start: start, End: start.Add(time.Millisecond)}}, traces[0].Spans)
+
+	// packets are not traced without a handler
+	assert.Nil(t, NewPipelineTelemetry(10, nil).trace(iface, 20))
+}
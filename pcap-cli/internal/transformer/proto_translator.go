@@ -21,22 +21,39 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
 
 	"github.com/GoogleCloudPlatform/pcap-sidecar/pcap-cli/internal/pb"
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
+	"github.com/pkg/errors"
+	"github.com/segmentio/fasthash/fnv1a"
+	"github.com/wissance/stringFormatter"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type (
 	ProtoPcapTranslator struct {
-		iface *PcapIface
+		iface  *PcapIface
+		labels *recordLabels
 	}
 )
 
+const (
+	protoTranslationVersion = pb.Packet_VERSION_1
+
+	protoTranslationTemplate       = "#{serial} | @{ifaceIndex}/{ifaceName} | flow:{flowID}"
+	protoTranslationSummaryWithL3  = protoTranslationTemplate + " | {L3Src} > {L3Dst}"
+	protoTranslationSummaryWithL4  = protoTranslationTemplate + " | {L4Proto} | {L3Src}:{L4Src} > {L3Dst}:{L4Dst}"
+	protoTranslationSummaryWithTCP = protoTranslationSummaryWithL4 + " | [{tcpFlags}] | len/seq/ack:{tcpLen}/{tcpSeq}/{tcpAck}"
+)
+
 func init() {
-	translators.Store(PROTO, newPROTOPcapTranslator)
+	registerTranslator(PROTO, newPROTOPcapTranslator)
 }
 
 func (t *ProtoPcapTranslator) done(_ context.Context) {
@@ -50,85 +67,501 @@ func (t *ProtoPcapTranslator) next(
 	packet *gopacket.Packet,
 ) fmt.Stringer {
 	// `next` returns the container to be used for merging all layers
-	p := &pb.Packet{}
-
 	metadata := (*packet).Metadata()
 	info := metadata.CaptureInfo
 
-	p.Timestamp = timestamppb.New(info.Timestamp)
-
-	pcap := p.GetPcap()
-	pcap.Context = ctx.Value(ContextID).(string)
-	pcap.Serial = *serial
-
-	meta := p.GetMeta()
-	meta.Truncated = metadata.Truncated
-	meta.Length = uint64(info.Length)
-	meta.CaptureLength = uint64(info.CaptureLength)
+	id, _ := ctx.Value(ContextID).(string)
+	logName, _ := ctx.Value(ContextLogName).(string)
+
+	p := &pb.Packet{
+		Version:   protoTranslationVersion,
+		Timestamp: timestamppb.New(info.Timestamp),
+		Pcap: &pb.Packet_Pcap{
+			Id:      id,
+			Context: logName,
+			Serial:  *serial,
+		},
+		Meta: &pb.Packet_Metadata{
+			Truncated:     metadata.Truncated,
+			Length:        uint64(info.Length),
+			CaptureLength: uint64(info.CaptureLength),
+		},
+		Iface: &pb.Packet_Interface{
+			Index: uint32(nic.Index),
+			Name:  nic.Name,
+			Addrs: nic.Addrs.ToSlice(),
+		},
+	}
 
-	iface := p.GetIface()
-	iface.Index = uint32(t.iface.Index)
-	iface.Name = t.iface.Name
+	t.labels.apply(*packet, func(key, value string) {
+		if p.Labels == nil {
+			p.Labels = make(map[string]string)
+		}
+		p.Labels[key] = value
+	})
 
 	return p
 }
 
 func (t *ProtoPcapTranslator) asTranslation(buffer fmt.Stringer) *pb.Packet {
-	// [TODO]: implement Ethernet layer translation
+	if buffer == nil {
+		return nil
+	}
 	return buffer.(*pb.Packet)
 }
 
+func (t *ProtoPcapTranslator) newError(err error, layer string) fmt.Stringer {
+	return &pb.Packet{
+		Errors: []*pb.Packet_Error{{Msg: err.Error(), Layer: layer}},
+	}
+}
+
+func (t *ProtoPcapTranslator) translateError(ctx context.Context, err error) fmt.Stringer {
+	return t.newError(err, "")
+}
+
+func (t *ProtoPcapTranslator) translateLayerError(ctx context.Context, lType gopacket.LayerType, err error) fmt.Stringer {
+	return t.newError(err, lType.String())
+}
+
+func (t *ProtoPcapTranslator) translateErrorLayer(ctx context.Context, err *gopacket.DecodeFailure) fmt.Stringer {
+	return t.newError(err.Error(), gopacket.LayerTypeDecodeFailure.String())
+}
+
 func (t *ProtoPcapTranslator) translateEthernetLayer(ctx context.Context, eth *layers.Ethernet) fmt.Stringer {
-	p := &pb.Packet{}
+	return &pb.Packet{
+		L2: &pb.Packet_Layer2{
+			Type:   eth.EthernetType.String(),
+			Source: eth.SrcMAC.String(),
+			Target: eth.DstMAC.String(),
+		},
+	}
+}
 
-	L2 := p.GetL2()
+func (t *ProtoPcapTranslator) translateARPLayer(ctx context.Context, arp *layers.ARP) fmt.Stringer {
+	var ipBytes [4]byte
 
-	L2.Source = eth.SrcMAC.String()
-	L2.Target = eth.DstMAC.String()
+	copy(ipBytes[:], arp.SourceProtAddress)
+	src := &pb.Packet_ARP_Endpoint{
+		Ip:  netip.AddrFrom4(ipBytes).String(),
+		Mac: net.HardwareAddr(arp.SourceHwAddress).String(),
+	}
 
-	return p
+	copy(ipBytes[:], arp.DstProtAddress)
+	dst := &pb.Packet_ARP_Endpoint{
+		Ip:  netip.AddrFrom4(ipBytes).String(),
+		Mac: net.HardwareAddr(arp.DstHwAddress).String(),
+	}
+
+	return &pb.Packet{
+		L3: &pb.Packet_Arp{
+			Arp: &pb.Packet_ARP{
+				Operation: uint32(arp.Operation),
+				Source:    src,
+				Target:    dst,
+			},
+		},
+	}
+}
+
+func (t *ProtoPcapTranslator) translateIPv4Layer(ctx context.Context, ip4 *layers.IPv4) fmt.Stringer {
+	// https://github.com/google/gopacket/blob/master/layers/ip4.go#L43
+	return &pb.Packet{
+		L3: &pb.Packet_Ip4{
+			Ip4: &pb.Packet_IPv4{
+				Source:         binary.BigEndian.Uint32(ip4.SrcIP.To4()),
+				Target:         binary.BigEndian.Uint32(ip4.DstIP.To4()),
+				Id:             uint32(ip4.Id),
+				Ihl:            uint32(ip4.IHL),
+				Ttl:            uint32(ip4.TTL),
+				Tos:            uint32(ip4.TOS),
+				Length:         uint32(ip4.Length),
+				FragmentOffset: uint32(ip4.FragOffset),
+				Checksum:       uint32(ip4.Checksum),
+				Protocol: &pb.Packet_Protocol{
+					Num:  uint32(ip4.Protocol),
+					Name: ip4.Protocol.String(),
+				},
+				// https://github.com/google/gopacket/blob/master/layers/ip4.go#L28-L40
+				Flags: strings.Split(ip4.Flags.String(), "|"),
+			},
+		},
+	}
 }
 
-func (t *ProtoPcapTranslator) translateIPv4Layer(ctx context.Context, ip *layers.IPv4) fmt.Stringer {
-	// [TODO]: implement IPv4 layer translation
-	p := &pb.Packet{}
+func (t *ProtoPcapTranslator) translateIPv6Layer(ctx context.Context, ip6 *layers.IPv6) fmt.Stringer {
+	// https://github.com/google/gopacket/blob/master/layers/ip6.go#L28-L43
+	return &pb.Packet{
+		L3: &pb.Packet_Ip6{
+			Ip6: &pb.Packet_IPv6{
+				Source:       ip6.SrcIP.To16(),
+				Target:       ip6.DstIP.To16(),
+				Length:       uint32(ip6.Length),
+				TrafficClass: uint32(ip6.TrafficClass),
+				FlowLabel:    ip6.FlowLabel,
+				HopLimit:     uint32(ip6.HopLimit),
+				Protocol: &pb.Packet_Protocol{
+					Num:  uint32(ip6.NextHeader),
+					Name: ip6.NextHeader.String(),
+				},
+			},
+		},
+	}
+}
 
-	L3 := p.GetIp()
+func (t *ProtoPcapTranslator) translateICMPv4Layer(ctx context.Context, icmp4 *layers.ICMPv4) fmt.Stringer {
+	// see: https://github.com/google/gopacket/blob/master/layers/icmp4.go#L208-L215
+	ICMP := &pb.Packet_ICMP{
+		Version:  4,
+		Type:     uint32(icmp4.TypeCode.Type()),
+		Code:     uint32(icmp4.TypeCode.Code()),
+		Checksum: uint32(icmp4.Checksum),
+		Message:  icmp4.TypeCode.String(),
+	}
 
-	L3.Source = ip.SrcIP.String()
-	L3.Target = ip.DstIP.String()
+	switch icmp4.TypeCode.Type() {
+	case layers.ICMPv4TypeEchoRequest, layers.ICMPv4TypeEchoReply:
+		ICMP.Id = uint32(icmp4.Id)
+		ICMP.Seq = uint32(icmp4.Seq)
+	case layers.ICMPv4TypeRedirect:
+		// see: https://github.com/google/gopacket/blob/master/layers/icmp4.go#L230
+		var ipBytes [4]byte
+		copy(ipBytes[:], icmp4.LayerContents()[4:8])
+		ICMP.Target = netip.AddrFrom4(ipBytes).String()
+	}
 
-	return p
+	return &pb.Packet{L4: &pb.Packet_Icmp{Icmp: ICMP}}
+}
+
+func (t *ProtoPcapTranslator) translateICMPv6Layer(ctx context.Context, icmp6 *layers.ICMPv6) fmt.Stringer {
+	// see: https://github.com/google/gopacket/blob/master/layers/icmp6.go#L174-L183
+	return &pb.Packet{
+		L4: &pb.Packet_Icmp{
+			Icmp: &pb.Packet_ICMP{
+				Version:  6,
+				Type:     uint32(icmp6.TypeCode.Type()),
+				Code:     uint32(icmp6.TypeCode.Code()),
+				Checksum: uint32(icmp6.Checksum),
+				Message:  icmp6.TypeCode.String(),
+			},
+		},
+	}
 }
 
-func (t *ProtoPcapTranslator) translateIPv6Layer(ctx context.Context, packet *layers.IPv6) fmt.Stringer {
-	// [TODO]: implement IPv6 layer translation
-	p := &pb.Packet{}
+func (t *ProtoPcapTranslator) asICMPv6(buffer fmt.Stringer) (*pb.Packet, *pb.Packet_ICMP) {
+	p := t.asTranslation(buffer)
+	if p == nil {
+		p = &pb.Packet{}
+	}
+	if p.GetIcmp() == nil {
+		p.L4 = &pb.Packet_Icmp{Icmp: &pb.Packet_ICMP{Version: 6}}
+	}
+	return p, p.GetIcmp()
+}
+
+func (t *ProtoPcapTranslator) translateICMPv6EchoLayer(
+	ctx context.Context, buffer fmt.Stringer, icmp6 *layers.ICMPv6Echo,
+) fmt.Stringer {
+	// see: https://github.com/google/gopacket/blob/master/layers/icmp6msg.go#L57-L62
+	p, ICMP := t.asICMPv6(buffer)
+	ICMP.Id = uint32(icmp6.Identifier)
+	ICMP.Seq = uint32(icmp6.SeqNumber)
 	return p
 }
 
-func (t *ProtoPcapTranslator) translateUDPLayer(ctx context.Context, packet *layers.UDP) fmt.Stringer {
-	// [TODO]: implement UDP layer translation
-	p := &pb.Packet{}
+func (t *ProtoPcapTranslator) translateICMPv6RedirectLayer(
+	ctx context.Context, buffer fmt.Stringer, icmp6 *layers.ICMPv6Redirect,
+) fmt.Stringer {
+	// see: https://github.com/google/gopacket/blob/master/layers/icmp6msg.go#L97-L104
+	p, ICMP := t.asICMPv6(buffer)
+	ICMP.Target = icmp6.TargetAddress.String()
+	ICMP.Destination = icmp6.DestinationAddress.String()
 	return p
 }
 
-func (t *ProtoPcapTranslator) translateTCPLayer(ctx context.Context, packet *layers.TCP) fmt.Stringer {
-	// [TODO]: implement TCP layer translation
-	p := &pb.Packet{}
+func (t *ProtoPcapTranslator) translateICMPv6L3HeaderLayer(
+	ctx context.Context, buffer fmt.Stringer, icmp6 *layers.ICMPv6,
+) fmt.Stringer {
+	p, ICMP := t.asICMPv6(buffer)
+
+	// the 1st 4 bytes are either unused, the MTU or the pointer
+	if len(icmp6.LayerPayload()) < 4+ipv6HeaderSize {
+		return p
+	}
+
+	ipHeader := icmp6.LayerPayload()[4:]
+
+	// Version (4 bits), TrafficClass (8 bits) and FlowLabel (20 bits)
+	ipHeaderBytes0to3 := binary.BigEndian.Uint32(ipHeader[:4])
+	nextHeader := layers.IPProtocol(ipHeader[6])
+
+	ICMP.Ipv6 = &pb.Packet_IPv6{
+		Source:       slices.Clone(ipHeader[8:24]),
+		Target:       slices.Clone(ipHeader[24:40]),
+		Length:       uint32(binary.BigEndian.Uint16(ipHeader[4:6])),
+		TrafficClass: (ipHeaderBytes0to3 & uint32(0x0FF00000)) >> 20,
+		FlowLabel:    ipHeaderBytes0to3 & uint32(0x000FFFFF),
+		HopLimit:     uint32(ipHeader[7]),
+		Protocol: &pb.Packet_Protocol{
+			Num:  uint32(nextHeader),
+			Name: nextHeader.String(),
+		},
+	}
+
 	return p
 }
 
+func (t *ProtoPcapTranslator) translateUDPLayer(ctx context.Context, udp *layers.UDP) fmt.Stringer {
+	// https://github.com/google/gopacket/blob/master/layers/udp.go#L17-L25
+	return &pb.Packet{
+		L4: &pb.Packet_Udp{
+			Udp: &pb.Packet_UDP{
+				Source:   uint32(udp.SrcPort),
+				Target:   uint32(udp.DstPort),
+				Length:   uint32(udp.Length),
+				Checksum: uint32(udp.Checksum),
+				Size:     uint32(len(udp.Payload)),
+			},
+		},
+	}
+}
+
+func (t *ProtoPcapTranslator) translateSCTPLayer(ctx context.Context, sctp *layers.SCTP) fmt.Stringer {
+	// https://github.com/google/gopacket/blob/master/layers/sctp.go#L19-L25
+	chunks := parseSCTPChunks(sctp.Payload)
+	pbChunks := make([]*pb.Packet_SCTP_Chunk, len(chunks))
+	for i, chunk := range chunks {
+		pbChunks[i] = &pb.Packet_SCTP_Chunk{
+			Type:        chunk.name(),
+			Flags:       uint32(chunk.flags),
+			Length:      uint32(chunk.length),
+			Tsn:         chunk.tsn,
+			Stream:      uint32(chunk.stream),
+			Ssn:         uint32(chunk.ssn),
+			Ppid:        chunk.ppid,
+			InitiateTag: chunk.initiateTag,
+		}
+	}
+	return &pb.Packet{
+		L4: &pb.Packet_Sctp{
+			Sctp: &pb.Packet_SCTP{
+				Source:          uint32(sctp.SrcPort),
+				Target:          uint32(sctp.DstPort),
+				VerificationTag: sctp.VerificationTag,
+				Checksum:        sctp.Checksum,
+				Size:            uint32(len(sctp.Payload)),
+				Chunks:          pbChunks,
+			},
+		},
+	}
+}
+
+func (t *ProtoPcapTranslator) translateTCPLayer(ctx context.Context, tcp *layers.TCP) fmt.Stringer {
+	// https://github.com/google/gopacket/blob/master/layers/tcp.go#L19-L35
+	setFlags := parseTCPflags(tcp)
+
+	flagsStr, ok := tcpFlagsStr[setFlags]
+	if !ok {
+		// this scenario is slow, but it should also be exceedingly rare
+		flags := make([]string, 0, len(tcpFlags))
+		for key, flag := range tcpFlags {
+			if setFlags&flag != 0 {
+				flags = append(flags, key)
+			}
+		}
+		flagsStr = strings.Join(flags, "|")
+	}
+
+	return &pb.Packet{
+		L4: &pb.Packet_Tcp{
+			Tcp: &pb.Packet_TCP{
+				Source:     uint32(tcp.SrcPort),
+				Target:     uint32(tcp.DstPort),
+				Seq:        tcp.Seq,
+				Ack:        tcp.Ack,
+				DataOffset: uint32(tcp.DataOffset),
+				Window:     uint32(tcp.Window),
+				Checksum:   uint32(tcp.Checksum),
+				Urgent:     uint32(tcp.Urgent),
+				Length:     uint32(len(tcp.Payload)),
+				Flags: &pb.Packet_TCP_Flags{
+					Dec: uint32(setFlags),
+					Str: flagsStr,
+				},
+			},
+		},
+	}
+}
+
 func (t *ProtoPcapTranslator) translateTLSLayer(ctx context.Context, tls *layers.TLS) fmt.Stringer {
-	// [TODO]: implement TLS layer translation
-	p := &pb.Packet{}
-	return p
+	records := make([]*pb.Packet_TLS_Record, 0,
+		len(tls.ChangeCipherSpec)+len(tls.Handshake)+len(tls.AppData)+len(tls.Alert))
+
+	addRecord := func(header *layers.TLSRecordHeader) {
+		records = append(records, &pb.Packet_TLS_Record{
+			ContentType: header.ContentType.String(),
+			Version:     header.Version.String(),
+			Length:      uint32(header.Length),
+		})
+	}
+
+	for _, record := range tls.ChangeCipherSpec {
+		addRecord(&record.TLSRecordHeader)
+	}
+	for _, record := range tls.Handshake {
+		addRecord(&record.TLSRecordHeader)
+	}
+	for _, record := range tls.AppData {
+		addRecord(&record.TLSRecordHeader)
+	}
+	for _, record := range tls.Alert {
+		addRecord(&record.TLSRecordHeader)
+	}
+
+	return &pb.Packet{Tls: &pb.Packet_TLS{Records: records}}
+}
+
+func (t *ProtoPcapTranslator) translateDHCPv4Layer(ctx context.Context, dhcp *layers.DHCPv4) fmt.Stringer {
+	DHCP := &pb.Packet_DHCP{
+		Version:     4,
+		MessageType: dhcpv4MessageType(dhcp),
+		Xid:         dhcp.Xid,
+		ClientMac:   dhcp.ClientHWAddr.String(),
+		Options:     t.toDHCPOptions(dhcpv4Options(dhcp)),
+	}
+
+	// unspecified addresses are `0.0.0.0`, so they are omitted
+	toString := func(ip net.IP) string {
+		if ip == nil || ip.IsUnspecified() {
+			return ""
+		}
+		return ip.String()
+	}
+	DHCP.ClientIp = toString(dhcp.ClientIP)
+	DHCP.AssignedIp = toString(dhcp.YourClientIP)
+	DHCP.ServerIp = toString(dhcp.NextServerIP)
+	DHCP.RelayIp = toString(dhcp.RelayAgentIP)
+	DHCP.RequestedIp = toString(dhcpv4IPOption(dhcp, layers.DHCPOptRequestIP))
+
+	return &pb.Packet{Dhcp: DHCP}
+}
+
+func (t *ProtoPcapTranslator) translateDHCPv6Layer(ctx context.Context, dhcp *layers.DHCPv6) fmt.Stringer {
+	DHCP := &pb.Packet_DHCP{
+		Version:     6,
+		MessageType: dhcp.MsgType.String(),
+		Xid:         dhcpv6TransactionID(dhcp),
+		Options:     t.toDHCPOptions(dhcpv6Options(dhcp)),
+	}
+
+	// relay messages do not carry a transaction ID, but link and peer addresses
+	if dhcp.MsgType == layers.DHCPv6MsgTypeRelayForward || dhcp.MsgType == layers.DHCPv6MsgTypeRelayReply {
+		DHCP.RelayIp = dhcp.LinkAddr.String()
+		DHCP.ClientIp = dhcp.PeerAddr.String()
+	}
+
+	for _, address := range dhcpv6Addresses(dhcp) {
+		DHCP.Addresses = append(DHCP.Addresses, address.String())
+	}
+
+	return &pb.Packet{Dhcp: DHCP}
+}
+
+func (t *ProtoPcapTranslator) translateSIPLayer(ctx context.Context, sip *layers.SIP) fmt.Stringer {
+	sequence, method := sipCSeq(sip)
+	SIP := &pb.Packet_SIP{
+		Version:   sip.Version.String(),
+		CallId:    sip.GetCallID(),
+		Cseq:      sequence,
+		UserAgent: sip.GetUserAgent(),
+	}
+
+	if sip.IsResponse {
+		SIP.Code = uint32(sip.ResponseCode)
+		SIP.Status = sip.ResponseStatus
+	} else {
+		method = sip.Method.String()
+		SIP.Uri = sip.RequestURI
+	}
+	SIP.Method = method
+
+	SIP.Media = sortedEndpoints(parseSDP(sip.Payload()))
+
+	return &pb.Packet{Sip: SIP}
+}
+
+func (t *ProtoPcapTranslator) translateNTPLayer(ctx context.Context, ntp *layers.NTP) fmt.Stringer {
+	NTP := &pb.Packet_NTP{
+		Version: uint32(ntp.Version),
+		Mode:    ntpMode(ntp),
+		Stratum: uint32(ntp.Stratum),
+		Refid:   ntpReferenceID(ntp),
+	}
+
+	if ntp.OriginTimestamp != 0 {
+		NTP.Origin = timestamppb.New(ntpTime(ntp.OriginTimestamp))
+	}
+	if ntp.ReceiveTimestamp != 0 {
+		NTP.Receive = timestamppb.New(ntpTime(ntp.ReceiveTimestamp))
+	}
+	if ntp.TransmitTimestamp != 0 {
+		NTP.Transmit = timestamppb.New(ntpTime(ntp.TransmitTimestamp))
+	}
+
+	return &pb.Packet{Ntp: NTP}
+}
+
+// addNTPOffset estimates the clock offset of the client receiving a server response; see `ntpOffset`.
+func (t *ProtoPcapTranslator) addNTPOffset(p *pb.Packet) {
+	NTP := p.GetNtp()
+	if NTP == nil || NTP.GetMode() != ntpModes[ntpModeServer] ||
+		NTP.Origin == nil || NTP.Receive == nil || NTP.Transmit == nil || p.Timestamp == nil {
+		return
+	}
+	if offset, delay, ok := ntpOffset(NTP.Origin.AsTime(),
+		NTP.Receive.AsTime(), NTP.Transmit.AsTime(), p.Timestamp.AsTime()); ok {
+		NTP.Offset = ntpMillis(offset)
+		NTP.Delay = ntpMillis(delay)
+	}
+}
+
+func (t *ProtoPcapTranslator) toDHCPOptions(options []*dhcpOption) []*pb.Packet_DHCP_Option {
+	pbOptions := make([]*pb.Packet_DHCP_Option, len(options))
+	for i, option := range options {
+		pbOptions[i] = &pb.Packet_DHCP_Option{Type: option.name, Value: option.value}
+	}
+	return pbOptions
 }
 
 func (t *ProtoPcapTranslator) translateDNSLayer(ctx context.Context, dns *layers.DNS) fmt.Stringer {
-	// [TODO]: implement DNS layer translation
-	p := &pb.Packet{}
-	return p
+	DNS := &pb.Packet_DNS{
+		Id:           uint32(dns.ID),
+		Op:           dns.OpCode.String(),
+		ResponseCode: dns.ResponseCode.String(),
+		Questions:    make([]*pb.Packet_DNS_Question, len(dns.Questions)),
+		Answers:      make([]*pb.Packet_DNS_Answer, len(dns.Answers)),
+	}
+
+	for i, question := range dns.Questions {
+		DNS.Questions[i] = &pb.Packet_DNS_Question{
+			Name:  string(question.Name),
+			Type:  question.Type.String(),
+			Class: question.Class.String(),
+		}
+	}
+
+	for i, answer := range dns.Answers {
+		DNS.Answers[i] = &pb.Packet_DNS_Answer{
+			Name:  string(answer.Name),
+			Type:  answer.Type.String(),
+			Class: answer.Class.String(),
+			Ttl:   answer.TTL,
+			// see: https://github.com/google/gopacket/blob/master/layers/dns.go#L1070
+			Data: answer.String(),
+		}
+	}
+
+	return &pb.Packet{Dns: DNS}
 }
 
 func (t *ProtoPcapTranslator) merge(ctx context.Context, tgt fmt.Stringer, src fmt.Stringer) (fmt.Stringer, error) {
@@ -136,37 +569,176 @@ func (t *ProtoPcapTranslator) merge(ctx context.Context, tgt fmt.Stringer, src f
 	return tgt, nil
 }
 
-func (t *ProtoPcapTranslator) finalize(ctx context.Context, iface *PcapIface, serial *uint64, p *gopacket.Packet, connTrack bool, packet fmt.Stringer) (fmt.Stringer, error) {
-	return packet, nil
+// for PROTO translator, this method generates:
+//   - the `flowID` for any 6-tuple conversation; it is the same `flowID` generated by the JSON translator.
+//   - the summary line at `message`
+func (t *ProtoPcapTranslator) finalize(
+	ctx context.Context,
+	ifaces netIfaceIndex,
+	iface *PcapIface,
+	serial *uint64,
+	_ *gopacket.Packet,
+	_ bool,
+	packet fmt.Stringer,
+) (fmt.Stringer, error) {
+	p := t.asTranslation(packet)
+
+	data := make(map[string]any, 12)
+
+	data["serial"] = *serial
+	data["ifaceIndex"] = t.iface.Index
+	data["ifaceName"] = t.iface.Name
+
+	flowID := fnv1a.AddUint64(fnv1a.Init64, uint64(t.iface.Index))
+
+	var srcIP, dstIP netip.Addr
+
+	switch L3 := p.GetL3().(type) {
+	default:
+		p.Flow = flowID
+		data["flowID"] = flowID
+		p.Message = stringFormatter.FormatComplex(protoTranslationTemplate, data)
+		return p, nil
+	case *pb.Packet_Arp:
+		srcIP, _ = netip.ParseAddr(L3.Arp.GetSource().GetIp())
+		dstIP, _ = netip.ParseAddr(L3.Arp.GetTarget().GetIp())
+		srcIPv4, dstIPv4 := srcIP.As4(), dstIP.As4()
+		flowID = fnv1a.AddUint64(flowID, fnv1a.HashUint64(
+			fnv1a.HashBytes64(srcIPv4[:])+fnv1a.HashBytes64(dstIPv4[:])))
+		data["L3Src"] = srcIP
+		data["L3Dst"] = dstIP
+		t.checkL3Address(p, data, ifaces, iface, &srcIP, &dstIP)
+		// ARP packets do not carry L4 flow information
+		p.Flow = flowID
+		data["flowID"] = flowID
+		p.Message = stringFormatter.FormatComplex(protoTranslationSummaryWithL3, data)
+		return p, nil
+	case *pb.Packet_Ip4:
+		var src, dst [4]byte
+		binary.BigEndian.PutUint32(src[:], L3.Ip4.GetSource())
+		binary.BigEndian.PutUint32(dst[:], L3.Ip4.GetTarget())
+		srcIP, dstIP = netip.AddrFrom4(src), netip.AddrFrom4(dst)
+		// IPv4(4) (0x04)
+		flowID = fnv1a.AddUint64(flowID, fnv1a.HashUint64(
+			uint64(4)+fnv1a.HashBytes64(src[:])+fnv1a.HashBytes64(dst[:])))
+	case *pb.Packet_Ip6:
+		srcIP, _ = netip.AddrFromSlice(L3.Ip6.GetSource())
+		dstIP, _ = netip.AddrFromSlice(L3.Ip6.GetTarget())
+		// IPv6(41) (0x29)
+		flowID = fnv1a.AddUint64(flowID, fnv1a.HashUint64(
+			uint64(41)+fnv1a.HashBytes64(L3.Ip6.GetSource())+fnv1a.HashBytes64(L3.Ip6.GetTarget())))
+	}
+
+	data["L3Src"] = srcIP
+	data["L3Dst"] = dstIP
+
+	// report complete interface details when capturing for `any` interface
+	t.checkL3Address(p, data, ifaces, iface, &srcIP, &dstIP)
+
+	var template string
+
+	switch L4 := p.GetL4().(type) {
+	default:
+		flowID = fnv1a.AddUint64(flowID, 255) // RESERVED (0xFF)
+		template = protoTranslationSummaryWithL3
+	case *pb.Packet_Icmp:
+		flowID = fnv1a.AddUint64(flowID, 255) // RESERVED (0xFF)
+		template = protoTranslationSummaryWithL3 + " | " + L4.Icmp.GetMessage()
+	case *pb.Packet_Udp:
+		// UDP(17) (0x11)
+		flowID = fnv1a.AddUint64(flowID, fnv1a.HashUint64(
+			uint64(17)+uint64(L4.Udp.GetSource())+uint64(L4.Udp.GetTarget())))
+		data["L4Proto"] = "UDP"
+		data["L4Src"] = L4.Udp.GetSource()
+		data["L4Dst"] = L4.Udp.GetTarget()
+		template = protoTranslationSummaryWithL4
+		t.addNTPOffset(p)
+	case *pb.Packet_Sctp:
+		// SCTP(132) (0x84)
+		flowID = fnv1a.AddUint64(flowID, fnv1a.HashUint64(
+			uint64(132)+uint64(L4.Sctp.GetSource())+uint64(L4.Sctp.GetTarget())))
+		data["L4Proto"] = "SCTP"
+		data["L4Src"] = L4.Sctp.GetSource()
+		data["L4Dst"] = L4.Sctp.GetTarget()
+		template = protoTranslationSummaryWithL4
+	case *pb.Packet_Tcp:
+		// TCP(6) (0x06)
+		flowID = fnv1a.AddUint64(flowID, fnv1a.HashUint64(
+			uint64(6)+uint64(L4.Tcp.GetSource())+uint64(L4.Tcp.GetTarget())))
+		data["L4Proto"] = "TCP"
+		data["L4Src"] = L4.Tcp.GetSource()
+		data["L4Dst"] = L4.Tcp.GetTarget()
+		data["tcpFlags"] = L4.Tcp.GetFlags().GetStr()
+		data["tcpLen"] = L4.Tcp.GetLength()
+		data["tcpSeq"] = L4.Tcp.GetSeq()
+		data["tcpAck"] = L4.Tcp.GetAck()
+		template = protoTranslationSummaryWithTCP
+	}
+
+	p.Flow = flowID
+	data["flowID"] = flowID
+	p.Message = stringFormatter.FormatComplex(template, data)
+
+	return p, nil
+}
+
+func (t *ProtoPcapTranslator) checkL3Address(
+	p *pb.Packet,
+	data map[string]any,
+	ifaces netIfaceIndex,
+	iface *PcapIface,
+	srcIP, dstIP *netip.Addr,
+) {
+	if iface.Index != 0 {
+		return
+	}
+
+	// O(1) interface lookups by IP
+	_iface, ok := ifaces[srcIP.String()]
+	if !ok {
+		if _iface, ok = ifaces[dstIP.String()]; !ok {
+			return
+		}
+	}
+
+	data["ifaceIndex"] = _iface.Index
+	data["ifaceName"] = _iface.Name
+
+	p.Iface = &pb.Packet_Interface{
+		Index: uint32(_iface.Index),
+		Name:  _iface.Name,
+		Addrs: _iface.Addrs.ToSlice(),
+	}
 }
 
 func (t *ProtoPcapTranslator) write(ctx context.Context, writer io.Writer, packet *fmt.Stringer) (int, error) {
 	protoBytes, err := proto.Marshal(t.asTranslation(*packet))
 	if err != nil {
-		return 0, err
+		return 0, errors.Wrap(err, "PROTO translation failed")
 	}
 
 	protoBytesLen := len(protoBytes)
 
 	// https://protobuf.dev/programming-guides/techniques/#streaming
-	buf := make([]byte, 4)
+	//   - every translation is prefixed with its size: 4 bytes little-endian
+	buf := make([]byte, 4+protoBytesLen)
 	binary.LittleEndian.PutUint32(buf, uint32(protoBytesLen))
-	if _, err := writer.Write(buf); err != nil {
-		return protoBytesLen + 4, err
-	}
+	copy(buf[4:], protoBytes)
 
-	if _, err := writer.Write(protoBytes); err != nil {
-		return protoBytesLen, err
+	writtenBytes, err := writer.Write(buf)
+	if err != nil {
+		return writtenBytes, errors.Wrap(err, "failed to write PROTO translation")
 	}
 
-	return protoBytesLen, nil
+	return writtenBytes, nil
 }
 
 func newPROTOPcapTranslator(
-	_ context.Context,
+	ctx context.Context,
 	_ bool,
 	iface *PcapIface,
 	_ *PcapEphemeralPorts,
 ) PcapTranslator {
-	return &ProtoPcapTranslator{iface: iface}
+	labels, _ := ctx.Value(ContextLabels).([]string)
+	return &ProtoPcapTranslator{iface: iface, labels: newRecordLabels(labels)}
 }
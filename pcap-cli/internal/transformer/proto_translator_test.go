@@ -0,0 +1,82 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build proto
+
+package transformer
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestProtoICMPv6L3Header verifies that ICMPv6 errors carry the IPv6 header of the packet which caused them.
+func TestProtoICMPv6L3Header(t *testing.T) {
+	t.Parallel()
+
+	client, server := net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2")
+
+	ip6 := &layers.IPv6{
+		Version: 6, TrafficClass: 0xB9, FlowLabel: 12345, HopLimit: 63,
+		NextHeader: layers.IPProtocolUDP, SrcIP: client, DstIP: server,
+	}
+	udp := &layers.UDP{SrcPort: 50000, DstPort: 443}
+	require.NoError(t, udp.SetNetworkLayerForChecksum(ip6))
+	buffer := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	require.NoError(t, gopacket.SerializeLayers(buffer, opts, ip6, udp, gopacket.Payload(make([]byte, 1400))))
+	original := buffer.Bytes()
+
+	// MTU ( 1280 ) followed by the original packet
+	payload := append([]byte{0, 0, 0x05, 0x00}, original[:ipv6HeaderSize+8]...)
+	icmp6 := &layers.ICMPv6{TypeCode: layers.CreateICMPv6TypeCode(layers.ICMPv6TypePacketTooBig, 0)}
+	ip := &layers.IPv6{Version: 6, HopLimit: 64, NextHeader: layers.IPProtocolICMPv6, SrcIP: net.ParseIP("2001:db8::fe"), DstIP: client}
+	require.NoError(t, icmp6.SetNetworkLayerForChecksum(ip))
+	buffer = gopacket.NewSerializeBuffer()
+	require.NoError(t, gopacket.SerializeLayers(buffer, opts, ip, icmp6, gopacket.Payload(payload)))
+	packet := gopacket.NewPacket(buffer.Bytes(), layers.LayerTypeIPv6, gopacket.Default)
+
+	layer, ok := packet.Layer(layers.LayerTypeICMPv6).(*layers.ICMPv6)
+	require.True(t, ok)
+
+	translator := &ProtoPcapTranslator{}
+	translation := translator.translateICMPv6L3HeaderLayer(context.Background(),
+		translator.translateICMPv6Layer(context.Background(), layer), layer)
+	ICMP := translator.asTranslation(translation).GetIcmp()
+	require.NotNil(t, ICMP)
+	assert.Equal(t, uint32(6), ICMP.Version)
+	assert.Equal(t, uint32(layers.ICMPv6TypePacketTooBig), ICMP.Type)
+
+	embedded := ICMP.GetIpv6()
+	require.NotNil(t, embedded)
+	assert.Equal(t, []byte(client.To16()), embedded.Source)
+	assert.Equal(t, []byte(server.To16()), embedded.Target)
+	assert.Equal(t, uint32(8+1400), embedded.Length)
+	assert.Equal(t, uint32(0xB9), embedded.TrafficClass)
+	assert.Equal(t, uint32(12345), embedded.FlowLabel)
+	assert.Equal(t, uint32(63), embedded.HopLimit)
+	assert.Equal(t, uint32(layers.IPProtocolUDP), embedded.Protocol.Num)
+	assert.Equal(t, "UDP", embedded.Protocol.Name)
+
+	// errors which do not carry the whole header are not annotated
+	layer.Payload = layer.Payload[:4+ipv6HeaderSize-1]
+	translation = translator.translateICMPv6L3HeaderLayer(context.Background(), nil, layer)
+	assert.Nil(t, translator.asTranslation(translation).GetIcmp().GetIpv6())
+}
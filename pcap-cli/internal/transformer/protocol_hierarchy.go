@@ -0,0 +1,105 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/google/gopacket"
+)
+
+type (
+	// CaptureProtocol is a node of the protocol hierarchy: packets and bytes of all packets containing the layers in `Path`;
+	// i/e: `Ethernet/IPv4/TCP/TLS` counts TLS records sent over TCP over IPv4, just like Wireshark's protocol hierarchy.
+	CaptureProtocol struct {
+		Path     string `json:"path"`
+		Protocol string `json:"protocol"`
+		Depth    int    `json:"depth"`
+		Packets  uint64 `json:"packets"`
+		Bytes    uint64 `json:"bytes"`
+	}
+
+	protocolHierarchy struct {
+		mu    sync.Mutex
+		nodes map[string]*CaptureProtocol
+	}
+)
+
+const (
+	protocolPathSeparator = "/"
+	// paths first seen after the limit is reached are not counted; i/e: deeply nested tunnels
+	protocolHierarchyLimit = 1024
+)
+
+func newProtocolHierarchy() *protocolHierarchy {
+	return &protocolHierarchy{nodes: make(map[string]*CaptureProtocol)}
+}
+
+// protocolPath returns the names of the layers of `packet`; raw payloads and decoding failures are not protocols.
+func protocolPath(packet gopacket.Packet) []string {
+	path := make([]string, 0, 4)
+	for _, layer := range packet.Layers() {
+		switch layerType := layer.LayerType(); layerType {
+		case gopacket.LayerTypePayload, gopacket.LayerTypeFragment, gopacket.LayerTypeDecodeFailure:
+			continue
+		default:
+			path = append(path, layerType.String())
+		}
+	}
+	return path
+}
+
+// observe counts `packet` in all the nodes along its path.
+func (h *protocolHierarchy) observe(packet gopacket.Packet) {
+	path := protocolPath(packet)
+	if len(path) == 0 {
+		return
+	}
+	size := uint64(packet.Metadata().Length)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for depth := range path {
+		key := strings.Join(path[:depth+1], protocolPathSeparator)
+		node, ok := h.nodes[key]
+		if !ok {
+			if len(h.nodes) >= protocolHierarchyLimit {
+				return
+			}
+			node = &CaptureProtocol{Path: key, Protocol: path[depth], Depth: depth}
+			h.nodes[key] = node
+		}
+		node.Packets++
+		node.Bytes += size
+	}
+}
+
+// snapshot returns all nodes sorted by path, so that children follow their parents.
+func (h *protocolHierarchy) snapshot() []CaptureProtocol {
+	h.mu.Lock()
+	protocols := make([]CaptureProtocol, 0, len(h.nodes))
+	for _, node := range h.nodes {
+		protocols = append(protocols, *node)
+	}
+	h.mu.Unlock()
+
+	slices.SortFunc(protocols, func(a, b CaptureProtocol) int {
+		return cmp.Compare(a.Path, b.Path)
+	})
+	return protocols
+}
@@ -0,0 +1,68 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+func newProtocolHierarchyTestPacket(t *testing.T, transport gopacket.SerializableLayer) gopacket.Packet {
+	return newTestPacket(t, newTestIPv4(net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)), transport, gopacket.Payload("data"))
+}
+
+// TestProtocolHierarchy verifies that packets are counted by all the nodes along their path, and that payloads are not protocols.
+func TestProtocolHierarchy(t *testing.T) {
+	t.Parallel()
+
+	summary := NewCaptureSummary()
+
+	tcp := newProtocolHierarchyTestPacket(t, &layers.TCP{SrcPort: 40000, DstPort: 8080, ACK: true, Window: 1024})
+	udp := newProtocolHierarchyTestPacket(t, &layers.UDP{SrcPort: 40000, DstPort: 9999})
+	summary.Observe(tcp)
+	summary.Observe(tcp)
+	summary.Observe(udp)
+
+	tcpSize := uint64(tcp.Metadata().Length)
+	udpSize := uint64(udp.Metadata().Length)
+
+	assert.Equal(t, []CaptureProtocol{
+		{Path: "IPv4", Protocol: "IPv4", Depth: 0, Packets: 3, Bytes: 2*tcpSize + udpSize},
+		{Path: "IPv4/TCP", Protocol: "TCP", Depth: 1, Packets: 2, Bytes: 2 * tcpSize},
+		{Path: "IPv4/UDP", Protocol: "UDP", Depth: 1, Packets: 1, Bytes: udpSize},
+	}, summary.Totals().Protocols)
+}
+
+// TestProtocolHierarchyLimit verifies that new paths are not counted once the limit is reached, while known ones still are.
+func TestProtocolHierarchyLimit(t *testing.T) {
+	t.Parallel()
+
+	hierarchy := newProtocolHierarchy()
+	for i := range protocolHierarchyLimit - 1 {
+		hierarchy.nodes[string(rune('a'+i))] = &CaptureProtocol{}
+	}
+
+	packet := newProtocolHierarchyTestPacket(t, &layers.UDP{SrcPort: 40000, DstPort: 9999})
+	hierarchy.observe(packet)
+	hierarchy.observe(packet)
+
+	assert.Len(t, hierarchy.nodes, protocolHierarchyLimit)
+	assert.Equal(t, uint64(2), hierarchy.nodes["IPv4"].Packets)
+	assert.NotContains(t, hierarchy.nodes, "IPv4/UDP")
+}
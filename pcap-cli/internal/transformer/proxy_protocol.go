@@ -0,0 +1,274 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// see: https://www.haproxy.org/download/2.9/doc/proxy-protocol.txt
+
+type (
+	proxyProtocolHeader struct {
+		version   uint8
+		command   string
+		transport string
+		src       netip.AddrPort
+		dst       netip.AddrPort
+		authority string
+	}
+
+	// proxyProtocolFlow tracks the PROXY protocol header of a connection: proxies send it ahead of any data sent by
+	// the client, so it is only decoded out of the first bytes sent by the client; later payloads starting with the
+	// PROXY protocol signature, i/e: HTTP bodies, never replace the client address.
+	proxyProtocolFlow struct {
+		header *proxyProtocolHeader
+		// initial sequence number sent by the client, if its `SYN` was seen
+		isn    uint32
+		hasISN bool
+		// whether any payload of the connection was already inspected
+		inspected bool
+	}
+)
+
+const (
+	proxyProtocolV1MaxLength = 107
+	proxyProtocolV2MinLength = 16
+
+	proxyProtocolCommandLocal = "LOCAL"
+	proxyProtocolCommandProxy = "PROXY"
+
+	proxyProtocolTransportUnknown = "UNKNOWN"
+
+	proxyProtocolV2AddrLengthIPv4 = 12
+	proxyProtocolV2AddrLengthIPv6 = 36
+
+	proxyProtocolV2TypeAuthority = 0x02
+)
+
+var (
+	proxyProtocolV1Signature = []byte("PROXY ")
+	proxyProtocolV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+	errProxyProtocolTruncated = errors.New("PROXY protocol header is truncated")
+	errProxyProtocolInvalid   = errors.New("PROXY protocol header is invalid")
+)
+
+var proxyProtocolV2Transports = map[byte]string{
+	0x00: proxyProtocolTransportUnknown,
+	0x11: "TCP4",
+	0x12: "UDP4",
+	0x21: "TCP6",
+	0x22: "UDP6",
+	0x31: "UNIX_STREAM",
+	0x32: "UNIX_DGRAM",
+}
+
+func isProxyProtocol(data []byte) bool {
+	return bytes.HasPrefix(data, proxyProtocolV2Signature) ||
+		bytes.HasPrefix(data, proxyProtocolV1Signature)
+}
+
+// parseProxyProtocolHeader decodes a PROXY protocol v1 or v2 header at the beginning of `data`;
+// it returns the decoded header and its size so that the remaining bytes can be further analyzed.
+func parseProxyProtocolHeader(data []byte) (*proxyProtocolHeader, int, error) {
+	if bytes.HasPrefix(data, proxyProtocolV2Signature) {
+		return parseProxyProtocolV2Header(data)
+	}
+	if bytes.HasPrefix(data, proxyProtocolV1Signature) {
+		return parseProxyProtocolV1Header(data)
+	}
+	return nil, 0, errProxyProtocolInvalid
+}
+
+// observeSYN learns the initial sequence number of the client out of its `SYN`.
+func (f *proxyProtocolFlow) observeSYN(seq uint32) {
+	f.isn, f.hasISN = seq, true
+}
+
+// inspect decodes the PROXY protocol header at the beginning of `data`, whose first byte is at sequence number `seq`;
+// it returns the header and its size only if `data` is the first payload of the connection: the 1 at `ISN+1`
+// if the handshake was seen, or the first 1 inspected otherwise.
+func (f *proxyProtocolFlow) inspect(seq uint32, data []byte) (*proxyProtocolHeader, int) {
+	first := !f.inspected
+	f.inspected = true
+
+	if f.hasISN {
+		// retransmissions of the first payload carry the same header
+		if seq != f.isn+1 {
+			return nil, 0
+		}
+	} else if !first {
+		return nil, 0
+	}
+
+	if !isProxyProtocol(data) {
+		return nil, 0
+	}
+	header, size, err := parseProxyProtocolHeader(data)
+	if err != nil {
+		return nil, 0
+	}
+	f.header = header
+	return header, size
+}
+
+func parseProxyProtocolV1Header(data []byte) (*proxyProtocolHeader, int, error) {
+	maxLength := min(len(data), proxyProtocolV1MaxLength)
+
+	end := bytes.Index(data[:maxLength], []byte("\r\n"))
+	if end < 0 {
+		return nil, 0, errProxyProtocolTruncated
+	}
+
+	// PROXY <TCP4|TCP6|UNKNOWN> <src> <dst> <sport> <dport>\r\n
+	fields := strings.Split(string(data[:end]), " ")
+
+	header := &proxyProtocolHeader{
+		version:   1,
+		command:   proxyProtocolCommandProxy,
+		transport: proxyProtocolTransportUnknown,
+	}
+
+	if len(fields) < 2 {
+		return nil, 0, errProxyProtocolInvalid
+	}
+
+	header.transport = fields[1]
+
+	// receivers must ignore everything past `UNKNOWN`
+	if header.transport == proxyProtocolTransportUnknown {
+		return header, end + 2, nil
+	}
+
+	if (header.transport != "TCP4" && header.transport != "TCP6") || len(fields) != 6 {
+		return nil, 0, errProxyProtocolInvalid
+	}
+
+	var err error
+	if header.src, err = parseProxyProtocolV1AddrPort(fields[2], fields[4]); err != nil {
+		return nil, 0, err
+	}
+	if header.dst, err = parseProxyProtocolV1AddrPort(fields[3], fields[5]); err != nil {
+		return nil, 0, err
+	}
+
+	return header, end + 2, nil
+}
+
+func parseProxyProtocolV1AddrPort(addr, port string) (netip.AddrPort, error) {
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return netip.AddrPort{}, fmt.Errorf("%w: %w", errProxyProtocolInvalid, err)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return netip.AddrPort{}, fmt.Errorf("%w: %w", errProxyProtocolInvalid, err)
+	}
+	return netip.AddrPortFrom(ip, uint16(p)), nil
+}
+
+func parseProxyProtocolV2Header(data []byte) (*proxyProtocolHeader, int, error) {
+	if len(data) < proxyProtocolV2MinLength {
+		return nil, 0, errProxyProtocolTruncated
+	}
+
+	versionAndCommand := data[12]
+	if versionAndCommand>>4 != 2 {
+		return nil, 0, errProxyProtocolInvalid
+	}
+
+	header := &proxyProtocolHeader{version: 2}
+
+	switch versionAndCommand & 0x0F {
+	case 0x00:
+		header.command = proxyProtocolCommandLocal
+	case 0x01:
+		header.command = proxyProtocolCommandProxy
+	default:
+		return nil, 0, errProxyProtocolInvalid
+	}
+
+	transport, ok := proxyProtocolV2Transports[data[13]]
+	if !ok {
+		return nil, 0, errProxyProtocolInvalid
+	}
+	header.transport = transport
+
+	length := int(binary.BigEndian.Uint16(data[14:16]))
+	size := proxyProtocolV2MinLength + length
+	if len(data) < size {
+		return nil, 0, errProxyProtocolTruncated
+	}
+
+	payload := data[proxyProtocolV2MinLength:size]
+
+	// `LOCAL` connections are health checks from the proxy itself:
+	//   - address block must be ignored
+	if header.command == proxyProtocolCommandLocal {
+		return header, size, nil
+	}
+
+	var addrLength int
+	switch data[13] >> 4 {
+	case 0x1: // AF_INET
+		if len(payload) < proxyProtocolV2AddrLengthIPv4 {
+			return nil, 0, errProxyProtocolInvalid
+		}
+		src, _ := netip.AddrFromSlice(payload[0:4])
+		dst, _ := netip.AddrFromSlice(payload[4:8])
+		header.src = netip.AddrPortFrom(src, binary.BigEndian.Uint16(payload[8:10]))
+		header.dst = netip.AddrPortFrom(dst, binary.BigEndian.Uint16(payload[10:12]))
+		addrLength = proxyProtocolV2AddrLengthIPv4
+	case 0x2: // AF_INET6
+		if len(payload) < proxyProtocolV2AddrLengthIPv6 {
+			return nil, 0, errProxyProtocolInvalid
+		}
+		src, _ := netip.AddrFromSlice(payload[0:16])
+		dst, _ := netip.AddrFromSlice(payload[16:32])
+		header.src = netip.AddrPortFrom(src, binary.BigEndian.Uint16(payload[32:34]))
+		header.dst = netip.AddrPortFrom(dst, binary.BigEndian.Uint16(payload[34:36]))
+		addrLength = proxyProtocolV2AddrLengthIPv6
+	default:
+		// `AF_UNSPEC` and `AF_UNIX` do not carry IP addresses
+		return header, size, nil
+	}
+
+	// Type-Length-Value vectors follow the address block
+	tlvs := payload[addrLength:]
+	for len(tlvs) >= 3 {
+		tlvType := tlvs[0]
+		tlvLength := int(binary.BigEndian.Uint16(tlvs[1:3]))
+		if len(tlvs) < 3+tlvLength {
+			break
+		}
+		if tlvType == proxyProtocolV2TypeAuthority {
+			header.authority = string(tlvs[3 : 3+tlvLength])
+		}
+		tlvs = tlvs[3+tlvLength:]
+	}
+
+	return header, size, nil
+}
+
+func (h *proxyProtocolHeader) hasAddresses() bool {
+	return h.src.IsValid() && h.dst.IsValid()
+}
@@ -0,0 +1,236 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newProxyProtocolV2Header(command, transport byte, payload []byte) []byte {
+	header := append([]byte{}, proxyProtocolV2Signature...)
+	header = append(header, 0x20|command, transport)
+	header = append(header, byte(len(payload)>>8), byte(len(payload)))
+	return append(header, payload...)
+}
+
+// TestParseProxyProtocolHeader verifies decoding of PROXY protocol v1 and v2 headers.
+func TestParseProxyProtocolHeader(t *testing.T) {
+	t.Parallel()
+
+	ipv4Payload := []byte{
+		10, 0, 0, 1, // src
+		10, 0, 0, 2, // dst
+		0x30, 0x39, // 12345
+		0x01, 0xBB, // 443
+	}
+	authorityTLV := []byte{proxyProtocolV2TypeAuthority, 0x00, 0x0B}
+	authorityTLV = append(authorityTLV, []byte("example.com")...)
+
+	ipv6Payload := make([]byte, proxyProtocolV2AddrLengthIPv6)
+	ipv6Payload[15] = 1 // ::1
+	ipv6Payload[31] = 2 // ::2
+	ipv6Payload[32], ipv6Payload[33] = 0x00, 0x50
+	ipv6Payload[34], ipv6Payload[35] = 0x1F, 0x90
+
+	tests := []struct {
+		name      string
+		data      []byte
+		version   uint8
+		command   string
+		transport string
+		src       string
+		dst       string
+		authority string
+		size      int
+		wantErr   bool
+	}{
+		{
+			name:      "v1_TCP4",
+			data:      []byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\nGET / HTTP/1.1\r\n"),
+			version:   1,
+			command:   proxyProtocolCommandProxy,
+			transport: "TCP4",
+			src:       "192.168.0.1:56324",
+			dst:       "192.168.0.11:443",
+			size:      47,
+		},
+		{
+			name:      "v1_TCP6",
+			data:      []byte("PROXY TCP6 2001:db8::1 2001:db8::2 4000 80\r\n"),
+			version:   1,
+			command:   proxyProtocolCommandProxy,
+			transport: "TCP6",
+			src:       "[2001:db8::1]:4000",
+			dst:       "[2001:db8::2]:80",
+			size:      44,
+		},
+		{
+			name:      "v1_UNKNOWN",
+			data:      []byte("PROXY UNKNOWN ffff::1 ffff::2 1 2\r\n"),
+			version:   1,
+			command:   proxyProtocolCommandProxy,
+			transport: proxyProtocolTransportUnknown,
+			size:      35,
+		},
+		{
+			name:    "v1_truncated",
+			data:    []byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324"),
+			wantErr: true,
+		},
+		{
+			name:    "v1_invalid_port",
+			data:    []byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 99999\r\n"),
+			wantErr: true,
+		},
+		{
+			name:      "v2_TCP4",
+			data:      newProxyProtocolV2Header(0x01, 0x11, ipv4Payload),
+			version:   2,
+			command:   proxyProtocolCommandProxy,
+			transport: "TCP4",
+			src:       "10.0.0.1:12345",
+			dst:       "10.0.0.2:443",
+			size:      proxyProtocolV2MinLength + len(ipv4Payload),
+		},
+		{
+			name:      "v2_TCP4_authority",
+			data:      newProxyProtocolV2Header(0x01, 0x11, append(append([]byte{}, ipv4Payload...), authorityTLV...)),
+			version:   2,
+			command:   proxyProtocolCommandProxy,
+			transport: "TCP4",
+			src:       "10.0.0.1:12345",
+			dst:       "10.0.0.2:443",
+			authority: "example.com",
+			size:      proxyProtocolV2MinLength + len(ipv4Payload) + len(authorityTLV),
+		},
+		{
+			name:      "v2_TCP6",
+			data:      newProxyProtocolV2Header(0x01, 0x21, ipv6Payload),
+			version:   2,
+			command:   proxyProtocolCommandProxy,
+			transport: "TCP6",
+			src:       "[::1]:80",
+			dst:       "[::2]:8080",
+			size:      proxyProtocolV2MinLength + len(ipv6Payload),
+		},
+		{
+			name:      "v2_LOCAL",
+			data:      newProxyProtocolV2Header(0x00, 0x00, nil),
+			version:   2,
+			command:   proxyProtocolCommandLocal,
+			transport: proxyProtocolTransportUnknown,
+			size:      proxyProtocolV2MinLength,
+		},
+		{
+			name:    "v2_truncated",
+			data:    newProxyProtocolV2Header(0x01, 0x11, ipv4Payload)[:20],
+			wantErr: true,
+		},
+		{
+			name:    "not_proxy_protocol",
+			data:    []byte("GET / HTTP/1.1\r\n"),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			header, size, err := parseProxyProtocolHeader(tt.data)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, header)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.version, header.version)
+			assert.Equal(t, tt.command, header.command)
+			assert.Equal(t, tt.transport, header.transport)
+			assert.Equal(t, tt.authority, header.authority)
+			assert.Equal(t, tt.size, size)
+
+			if tt.src == "" {
+				assert.False(t, header.hasAddresses())
+				return
+			}
+
+			assert.True(t, header.hasAddresses())
+			assert.Equal(t, netip.MustParseAddrPort(tt.src), header.src)
+			assert.Equal(t, netip.MustParseAddrPort(tt.dst), header.dst)
+		})
+	}
+}
+
+// TestProxyProtocolFlow verifies that only the first payload of a connection may set its client address.
+func TestProxyProtocolFlow(t *testing.T) {
+	t.Parallel()
+
+	header := []byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n")
+	later := []byte("PROXY TCP4 10.0.0.66 10.0.0.67 1111 80\r\n")
+	client := netip.MustParseAddrPort("192.168.0.1:56324")
+
+	t.Run("handshake", func(t *testing.T) {
+		t.Parallel()
+
+		var flow proxyProtocolFlow
+		flow.observeSYN(1000)
+
+		// segments sent after the first one are translated ahead of it
+		proxyProtocol, _ := flow.inspect(1001+uint32(len(header)), later)
+		assert.Nil(t, proxyProtocol)
+
+		proxyProtocol, size := flow.inspect(1001, header)
+		if assert.NotNil(t, proxyProtocol) {
+			assert.Equal(t, client, proxyProtocol.src)
+			assert.Equal(t, len(header), size)
+		}
+
+		proxyProtocol, _ = flow.inspect(5000, later)
+		assert.Nil(t, proxyProtocol)
+		assert.Equal(t, client, flow.header.src)
+	})
+
+	t.Run("mid-connection", func(t *testing.T) {
+		t.Parallel()
+
+		var flow proxyProtocolFlow
+
+		proxyProtocol, _ := flow.inspect(1001, header)
+		assert.NotNil(t, proxyProtocol)
+
+		// i/e: an HTTP body starting with the PROXY protocol signature
+		proxyProtocol, _ = flow.inspect(2002, later)
+		assert.Nil(t, proxyProtocol)
+		assert.Equal(t, client, flow.header.src)
+	})
+
+	t.Run("not-first", func(t *testing.T) {
+		t.Parallel()
+
+		var flow proxyProtocolFlow
+
+		proxyProtocol, _ := flow.inspect(1001, []byte("GET / HTTP/1.1\r\n\r\n"))
+		assert.Nil(t, proxyProtocol)
+
+		proxyProtocol, _ = flow.inspect(2002, later)
+		assert.Nil(t, proxyProtocol)
+		assert.Nil(t, flow.header)
+	})
+}
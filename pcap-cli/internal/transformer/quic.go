@@ -0,0 +1,416 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"sort"
+	"sync"
+
+	"golang.org/x/crypto/cryptobyte"
+	"golang.org/x/crypto/hkdf"
+)
+
+type (
+	quicVersion struct {
+		name  string
+		salt  []byte
+		label string
+		// long header packet types are encoded differently by each version
+		types [4]string
+	}
+
+	// quicPacket is the clear text part of a QUIC packet;
+	// the `ClientHello` is only available for client `Initial` packets, which are protected with well-known keys.
+	//   - see: https://datatracker.ietf.org/doc/html/rfc9000#name-packet-formats
+	quicPacket struct {
+		long       bool
+		packetType string
+		version    uint32
+		dcid, scid []byte
+		versions   []uint32 // Version Negotiation
+		serverName string
+		alpn       []string
+		decrypted  bool
+		coalesced  int
+	}
+
+	// quicConnectionIDs remembers the length of the connection IDs chosen by each endpoint:
+	//   - short header packets do not carry the length of the destination connection ID,
+	//   - endpoints announce the connection IDs they want to receive using the source connection ID of long header packets.
+	quicConnectionIDs struct {
+		mu      sync.Mutex
+		lengths map[string]int
+	}
+)
+
+const (
+	quicLongHeaderForm = 0x80
+	quicFixedBit       = 0x40
+	quicMaxCIDLength   = 20
+
+	quicPacketInitial            = "initial"
+	quicPacketZeroRTT            = "0rtt"
+	quicPacketHandshake          = "handshake"
+	quicPacketRetry              = "retry"
+	quicPacketVersionNegotiation = "version_negotiation"
+	quicPacketOneRTT             = "1rtt"
+
+	quicFramePadding = 0x00
+	quicFramePing    = 0x01
+	quicFrameACK     = 0x02
+	quicFrameACKECN  = 0x03
+	quicFrameCrypto  = 0x06
+
+	quicConnectionIDsLimit = 4096
+)
+
+var quicVersions = map[uint32]*quicVersion{
+	// see: https://datatracker.ietf.org/doc/html/rfc9001#name-initial-secrets
+	0x00000001: {
+		name:  "v1",
+		salt:  mustDecodeHex("38762cf7f55934b34d179ae6a4c80cadccbb7f0a"),
+		label: "quic",
+		types: [4]string{quicPacketInitial, quicPacketZeroRTT, quicPacketHandshake, quicPacketRetry},
+	},
+	// see: https://datatracker.ietf.org/doc/html/rfc9369#name-initial-salt
+	0x6b3343cf: {
+		name:  "v2",
+		salt:  mustDecodeHex("0dede3def700a6db819381be6e269dcbf9bd2ed9"),
+		label: "quicv2",
+		types: [4]string{quicPacketRetry, quicPacketInitial, quicPacketZeroRTT, quicPacketHandshake},
+	},
+}
+
+func mustDecodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func newQUICConnectionIDs() *quicConnectionIDs {
+	return &quicConnectionIDs{lengths: make(map[string]int)}
+}
+
+func (c *quicConnectionIDs) learn(endpoint string, length int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.lengths[endpoint]; !ok && len(c.lengths) >= quicConnectionIDsLimit {
+		// connections come and go: start over instead of keeping stale endpoints forever
+		c.lengths = make(map[string]int)
+	}
+	c.lengths[endpoint] = length
+}
+
+func (c *quicConnectionIDs) lookup(endpoint string) (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	length, ok := c.lengths[endpoint]
+	return length, ok
+}
+
+// quicVarint decodes a variable-length integer.
+//   - see: https://datatracker.ietf.org/doc/html/rfc9000#name-variable-length-integer-enc
+func quicVarint(s *cryptobyte.String) (uint64, bool) {
+	var b uint8
+	if !s.ReadUint8(&b) {
+		return 0, false
+	}
+	value := uint64(b & 0x3f)
+	length := 1 << (b >> 6)
+	for i := 1; i < length; i++ {
+		if !s.ReadUint8(&b) {
+			return 0, false
+		}
+		value = value<<8 | uint64(b)
+	}
+	return value, true
+}
+
+// parseQUIC decodes the clear text headers of the QUIC packets carried by a UDP datagram:
+//   - `src` and `dst` are the endpoints that sent and will receive the datagram,
+//   - `isQUICPort` allows to recognize long header packets of unknown versions.
+//
+// It returns `nil` if the datagram does not look like QUIC.
+func (c *quicConnectionIDs) parseQUIC(datagram []byte, src, dst string, isQUICPort bool) *quicPacket {
+	if len(datagram) == 0 || datagram[0]&quicLongHeaderForm == 0 {
+		return c.parseQUICShortHeader(datagram, dst)
+	}
+
+	var packet *quicPacket
+	for data := datagram; len(data) > 0 && data[0]&quicLongHeaderForm != 0; {
+		p, size := parseQUICLongHeader(data, isQUICPort)
+		if p == nil {
+			break
+		}
+		if packet == nil {
+			packet = p
+		}
+		packet.coalesced++
+		if size <= 0 {
+			break
+		}
+		data = data[size:]
+	}
+
+	if packet != nil && packet.version != 0 {
+		c.learn(src, len(packet.scid))
+	}
+	return packet
+}
+
+func (c *quicConnectionIDs) parseQUICShortHeader(datagram []byte, dst string) *quicPacket {
+	if len(datagram) == 0 || datagram[0]&quicFixedBit == 0 {
+		return nil
+	}
+	length, ok := c.lookup(dst)
+	if !ok || len(datagram) < 1+length {
+		return nil
+	}
+	return &quicPacket{
+		packetType: quicPacketOneRTT,
+		dcid:       datagram[1 : 1+length],
+		coalesced:  1,
+	}
+}
+
+// parseQUICLongHeader returns the size of the packet, or `0` if the packet extends to the end of the datagram.
+func parseQUICLongHeader(data []byte, isQUICPort bool) (*quicPacket, int) {
+	s := cryptobyte.String(data)
+
+	var firstByte uint8
+	var version uint32
+	var dcid, scid cryptobyte.String
+	if !s.ReadUint8(&firstByte) ||
+		!s.ReadUint32(&version) ||
+		!s.ReadUint8LengthPrefixed(&dcid) || len(dcid) > quicMaxCIDLength ||
+		!s.ReadUint8LengthPrefixed(&scid) || len(scid) > quicMaxCIDLength {
+		return nil, 0
+	}
+
+	packet := &quicPacket{long: true, version: version, dcid: dcid, scid: scid}
+
+	// Version Negotiation packets are not versioned, so they are too easy to confuse with non-QUIC data
+	if version == 0 {
+		if !isQUICPort {
+			return nil, 0
+		}
+		packet.packetType = quicPacketVersionNegotiation
+		for !s.Empty() {
+			var supported uint32
+			if !s.ReadUint32(&supported) {
+				break
+			}
+			packet.versions = append(packet.versions, supported)
+		}
+		return packet, 0
+	}
+
+	qv, known := quicVersions[version]
+	if !known {
+		// packets of unknown versions cannot be decoded beyond connection IDs
+		if !isQUICPort || firstByte&quicFixedBit == 0 {
+			return nil, 0
+		}
+		return packet, 0
+	}
+
+	packet.packetType = qv.types[(firstByte>>4)&0x03]
+
+	if packet.packetType == quicPacketRetry {
+		return packet, 0
+	}
+
+	if packet.packetType == quicPacketInitial {
+		if tokenLength, ok := quicVarint(&s); !ok || !s.Skip(int(tokenLength)) {
+			return packet, 0
+		}
+	}
+
+	length, ok := quicVarint(&s)
+	if !ok || length > uint64(len(s)) {
+		return packet, 0
+	}
+	pnOffset := len(data) - len(s)
+	size := pnOffset + int(length)
+
+	if packet.packetType == quicPacketInitial {
+		if plaintext, ok := qv.decryptInitial(data[:size], pnOffset, dcid); ok {
+			packet.decrypted = true
+			packet.serverName, packet.alpn = tlsClientHelloNames(quicCryptoData(plaintext))
+		}
+	}
+
+	return packet, size
+}
+
+// hkdfExpandLabel implements `HKDF-Expand-Label` with an empty context.
+//   - see: https://datatracker.ietf.org/doc/html/rfc8446#section-7.1
+func hkdfExpandLabel(secret []byte, label string, length int) []byte {
+	var info cryptobyte.Builder
+	info.AddUint16(uint16(length))
+	info.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes([]byte("tls13 " + label))
+	})
+	info.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {})
+
+	out := make([]byte, length)
+	if _, err := hkdf.Expand(sha256.New, secret, info.BytesOrPanic()).Read(out); err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// clientInitialKeys derives the keys protecting client `Initial` packets; they only depend on the DCID.
+//   - see: https://datatracker.ietf.org/doc/html/rfc9001#name-initial-secrets
+func (qv *quicVersion) clientInitialKeys(dcid []byte) (key, iv, hp []byte) {
+	initialSecret := hkdf.Extract(sha256.New, dcid, qv.salt)
+	clientSecret := hkdfExpandLabel(initialSecret, "client in", sha256.Size)
+	return hkdfExpandLabel(clientSecret, qv.label+" key", 16),
+		hkdfExpandLabel(clientSecret, qv.label+" iv", 12),
+		hkdfExpandLabel(clientSecret, qv.label+" hp", 16)
+}
+
+// decryptInitial removes header protection and decrypts the payload of a client `Initial` packet;
+// decryption fails for server `Initial` packets, as they are protected using different keys.
+//   - see: https://datatracker.ietf.org/doc/html/rfc9001#name-header-protection
+func (qv *quicVersion) decryptInitial(packet []byte, pnOffset int, dcid []byte) ([]byte, bool) {
+	// the sample is taken assuming that the packet number is 4 bytes long
+	if len(packet) < pnOffset+4+aes.BlockSize {
+		return nil, false
+	}
+
+	key, iv, hp := qv.clientInitialKeys(dcid)
+
+	hpCipher, err := aes.NewCipher(hp)
+	if err != nil {
+		return nil, false
+	}
+	mask := make([]byte, aes.BlockSize)
+	hpCipher.Encrypt(mask, packet[pnOffset+4:pnOffset+4+aes.BlockSize])
+
+	firstByte := packet[0] ^ (mask[0] & 0x0f)
+	pnLength := int(firstByte&0x03) + 1
+
+	header := make([]byte, pnOffset+pnLength)
+	copy(header, packet)
+	header[0] = firstByte
+	pn := uint64(0)
+	for i := 0; i < pnLength; i++ {
+		header[pnOffset+i] ^= mask[1+i]
+		pn = pn<<8 | uint64(header[pnOffset+i])
+	}
+
+	nonce := make([]byte, len(iv))
+	copy(nonce, iv)
+	for i := 0; i < 8; i++ {
+		nonce[len(nonce)-1-i] ^= byte(pn >> (8 * i))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, false
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, false
+	}
+	plaintext, err := aead.Open(nil, nonce, packet[pnOffset+pnLength:], header)
+	if err != nil {
+		return nil, false
+	}
+	return plaintext, true
+}
+
+// quicCryptoData reassembles the contiguous prefix of the TLS handshake carried by `CRYPTO` frames;
+// clients may reorder `CRYPTO` frames, and intersperse them with `PING` and `PADDING` frames.
+//   - see: https://datatracker.ietf.org/doc/html/rfc9000#name-crypto-frames
+func quicCryptoData(payload []byte) []byte {
+	type chunk struct {
+		offset uint64
+		data   []byte
+	}
+	chunks := []chunk{}
+
+	s := cryptobyte.String(payload)
+frames:
+	for !s.Empty() {
+		frameType, ok := quicVarint(&s)
+		if !ok {
+			break
+		}
+		switch frameType {
+		case quicFramePadding, quicFramePing:
+		case quicFrameACK, quicFrameACKECN:
+			// largest acknowledged, delay, range count and first range
+			var fields [4]uint64
+			for i := range fields {
+				if fields[i], ok = quicVarint(&s); !ok {
+					break frames
+				}
+			}
+			ranges := 2 * fields[2]
+			if frameType == quicFrameACKECN {
+				ranges += 3
+			}
+			for i := uint64(0); i < ranges; i++ {
+				if _, ok = quicVarint(&s); !ok {
+					break frames
+				}
+			}
+		case quicFrameCrypto:
+			offset, ok := quicVarint(&s)
+			if !ok {
+				break frames
+			}
+			var data cryptobyte.String
+			length, ok := quicVarint(&s)
+			if !ok || !s.ReadBytes((*[]byte)(&data), int(length)) {
+				break frames
+			}
+			chunks = append(chunks, chunk{offset, data})
+		default:
+			// `Initial` packets may only carry the frames above, or `CONNECTION_CLOSE`
+			break frames
+		}
+	}
+
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].offset < chunks[j].offset })
+
+	var handshake []byte
+	for _, c := range chunks {
+		end := c.offset + uint64(len(c.data))
+		if c.offset > uint64(len(handshake)) {
+			break
+		}
+		if end > uint64(len(handshake)) {
+			handshake = append(handshake, c.data[uint64(len(handshake))-c.offset:]...)
+		}
+	}
+	return handshake
+}
+
+func quicVersionString(version uint32) string {
+	if qv, ok := quicVersions[version]; ok {
+		return qv.name
+	}
+	return "0x" + hex.EncodeToString(binary.BigEndian.AppendUint32(nil, version))
+}
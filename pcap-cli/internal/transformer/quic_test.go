@@ -0,0 +1,134 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/cryptobyte"
+)
+
+// newQUICInitial protects a client `Initial` packet carrying `handshake` split into 2 reordered `CRYPTO` frames.
+func newQUICInitial(t *testing.T, dcid, scid, handshake []byte) []byte {
+	half := len(handshake) / 2
+
+	var frames cryptobyte.Builder
+	frames.AddUint8(quicFramePing)
+	for _, offset := range []int{half, 0} {
+		data := handshake[offset:]
+		if offset == 0 {
+			data = handshake[:half]
+		}
+		frames.AddUint8(quicFrameCrypto)
+		frames.AddUint16(0x4000 | uint16(offset))
+		frames.AddUint16(0x4000 | uint16(len(data)))
+		frames.AddBytes(data)
+	}
+	payload := append(frames.BytesOrPanic(), make([]byte, 1200)...)
+
+	pnLength := 2
+	pn := uint64(0x0102)
+
+	var header cryptobyte.Builder
+	header.AddUint8(quicLongHeaderForm | quicFixedBit | byte(pnLength-1))
+	header.AddUint32(0x00000001)
+	header.AddUint8(uint8(len(dcid)))
+	header.AddBytes(dcid)
+	header.AddUint8(uint8(len(scid)))
+	header.AddBytes(scid)
+	header.AddUint8(0) // token length
+	header.AddUint16(0x4000 | uint16(pnLength+len(payload)+16))
+	pnOffset := len(header.BytesOrPanic())
+	header.AddUint16(uint16(pn))
+	aad := header.BytesOrPanic()
+
+	key, iv, hp := quicVersions[0x00000001].clientInitialKeys(dcid)
+	block, _ := aes.NewCipher(key)
+	aead, _ := cipher.NewGCM(block)
+	nonce := append([]byte{}, iv...)
+	nonce[len(nonce)-1] ^= byte(pn)
+	nonce[len(nonce)-2] ^= byte(pn >> 8)
+	packet := aead.Seal(append([]byte{}, aad...), nonce, payload, aad)
+
+	hpCipher, _ := aes.NewCipher(hp)
+	mask := make([]byte, aes.BlockSize)
+	hpCipher.Encrypt(mask, packet[pnOffset+4:pnOffset+4+aes.BlockSize])
+	packet[0] ^= mask[0] & 0x0f
+	for i := 0; i < pnLength; i++ {
+		packet[pnOffset+i] ^= mask[1+i]
+	}
+	return packet
+}
+
+// TestQUICInitialKeys verifies key derivation using the test vectors from RFC 9001.
+//   - see: https://datatracker.ietf.org/doc/html/rfc9001#name-keys
+func TestQUICInitialKeys(t *testing.T) {
+	t.Parallel()
+
+	key, iv, hp := quicVersions[0x00000001].clientInitialKeys(mustDecodeHex("8394c8f03e515708"))
+	assert.Equal(t, "1f369613dd76d5467730efcbe3b1a22d", hex.EncodeToString(key))
+	assert.Equal(t, "fa044b2f42a3fd3b46fb255c", hex.EncodeToString(iv))
+	assert.Equal(t, "9f50449e04a0e810283a1e9933adedd2", hex.EncodeToString(hp))
+}
+
+// TestQUIC verifies that QUIC headers are decoded, and that the `ClientHello` is decrypted from client `Initial` packets.
+func TestQUIC(t *testing.T) {
+	t.Parallel()
+
+	// `Initial` packets carry handshake messages without TLS records
+	handshake := newTLSClientHello(t, "example.com")[5:]
+	dcid := mustDecodeHex("8394c8f03e515708")
+	scid := mustDecodeHex("c0ffee")
+
+	cids := newQUICConnectionIDs()
+
+	packet := cids.parseQUIC(newQUICInitial(t, dcid, scid, handshake), "10.0.0.1:50000", "10.0.0.2:443", true)
+	assert.NotNil(t, packet)
+	assert.True(t, packet.long)
+	assert.Equal(t, quicPacketInitial, packet.packetType)
+	assert.Equal(t, "v1", quicVersionString(packet.version))
+	assert.Equal(t, dcid, packet.dcid)
+	assert.Equal(t, scid, packet.scid)
+	assert.True(t, packet.decrypted)
+	assert.Equal(t, "example.com", packet.serverName)
+	assert.Equal(t, 1, packet.coalesced)
+
+	// the client chose a 3 bytes connection ID, so it is possible to decode short headers sent to it
+	packet = cids.parseQUIC(append([]byte{quicFixedBit}, scid...), "10.0.0.2:443", "10.0.0.1:50000", true)
+	assert.NotNil(t, packet)
+	assert.False(t, packet.long)
+	assert.Equal(t, quicPacketOneRTT, packet.packetType)
+	assert.Equal(t, scid, packet.dcid)
+
+	assert.Nil(t, cids.parseQUIC([]byte{quicFixedBit, 1, 2, 3}, "10.0.0.3:443", "10.0.0.4:50000", true))
+
+	// packets protected with keys derived from a different DCID, i/e: server `Initial` packets, cannot be decrypted
+	initial := newQUICInitial(t, dcid, scid, handshake)
+	initial[6] ^= 0xff
+	packet = cids.parseQUIC(initial, "10.0.0.1:50000", "10.0.0.2:443", true)
+	assert.Equal(t, quicPacketInitial, packet.packetType)
+	assert.False(t, packet.decrypted)
+	assert.Empty(t, packet.serverName)
+
+	versionNegotiation := []byte{quicLongHeaderForm, 0, 0, 0, 0, 1, 0xaa, 1, 0xbb, 0, 0, 0, 1}
+	packet = cids.parseQUIC(versionNegotiation, "10.0.0.2:443", "10.0.0.1:50000", true)
+	assert.Equal(t, quicPacketVersionNegotiation, packet.packetType)
+	assert.Equal(t, []uint32{1}, packet.versions)
+	assert.Nil(t, cids.parseQUIC(versionNegotiation, "10.0.0.2:53", "10.0.0.1:50000", false))
+}
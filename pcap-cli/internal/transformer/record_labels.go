@@ -0,0 +1,202 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"net/netip"
+	"strconv"
+	"strings"
+
+	mapset "github.com/deckarep/golang-set/v2"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+type (
+	recordLabel struct {
+		key, value string
+	}
+
+	// recordLabelRule stamps its labels onto records of packets matching all of its conditions;
+	// each condition matches if any of its values matches either side of the packet.
+	recordLabelRule struct {
+		labels []*recordLabel
+		nets   []netip.Prefix
+		ports  mapset.Set[uint16]
+		protos []gopacket.LayerType
+	}
+
+	// recordLabels applies rules in order: if many rules set the same label, the 1st one wins.
+	recordLabels struct {
+		rules []*recordLabelRule
+	}
+)
+
+const (
+	recordLabelsConditions      = "@"
+	recordLabelsSeparator       = ","
+	recordLabelsValueSeparator  = "="
+	recordLabelsValuesSeparator = "|"
+)
+
+var recordLabelsProtos = map[string]gopacket.LayerType{
+	"tcp":   layers.LayerTypeTCP,
+	"udp":   layers.LayerTypeUDP,
+	"sctp":  layers.LayerTypeSCTP,
+	"icmp":  layers.LayerTypeICMPv4,
+	"icmp4": layers.LayerTypeICMPv4,
+	"icmp6": layers.LayerTypeICMPv6,
+	"arp":   layers.LayerTypeARP,
+}
+
+// newRecordLabels returns `nil` if no valid rules are available:
+//   - rules are `{labels}@{conditions}`; i/e: `team=payments,env=prod@port=8080|8443,net=10.0.0.0/8,proto=tcp`,
+//   - conditions are: `port`, `net` ( IPs or CIDRs ), and `proto`; rules without conditions match all records,
+//   - rules with invalid labels or conditions are ignored, so that they do not label unrelated records.
+func newRecordLabels(rules []string) *recordLabels {
+	labels := &recordLabels{rules: make([]*recordLabelRule, 0, len(rules))}
+	for _, rawRule := range rules {
+		if rule, ok := parseRecordLabelRule(rawRule); ok {
+			labels.rules = append(labels.rules, rule)
+		}
+	}
+	if len(labels.rules) == 0 {
+		return nil
+	}
+	return labels
+}
+
+func parseRecordLabelRule(rawRule string) (*recordLabelRule, bool) {
+	rawLabels, rawConditions, _ := strings.Cut(strings.TrimSpace(rawRule), recordLabelsConditions)
+
+	rule := &recordLabelRule{ports: mapset.NewThreadUnsafeSet[uint16]()}
+	for _, rawLabel := range strings.Split(rawLabels, recordLabelsSeparator) {
+		key, value, ok := strings.Cut(rawLabel, recordLabelsValueSeparator)
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || key == "" || value == "" {
+			return nil, false
+		}
+		rule.labels = append(rule.labels, &recordLabel{key, value})
+	}
+
+	if strings.TrimSpace(rawConditions) == "" {
+		return rule, true
+	}
+
+	for _, rawCondition := range strings.Split(rawConditions, recordLabelsSeparator) {
+		key, rawValues, ok := strings.Cut(rawCondition, recordLabelsValueSeparator)
+		if !ok {
+			return nil, false
+		}
+		for _, value := range strings.Split(rawValues, recordLabelsValuesSeparator) {
+			value = strings.TrimSpace(value)
+			switch strings.ToLower(strings.TrimSpace(key)) {
+			case "port":
+				port, err := strconv.ParseUint(value, 10, 16)
+				if err != nil {
+					return nil, false
+				}
+				rule.ports.Add(uint16(port))
+			case "net":
+				prefix, err := netip.ParsePrefix(value)
+				if err != nil {
+					addr, addrErr := netip.ParseAddr(value)
+					if addrErr != nil {
+						return nil, false
+					}
+					prefix = netip.PrefixFrom(addr, addr.BitLen())
+				}
+				rule.nets = append(rule.nets, prefix.Masked())
+			case "proto":
+				proto, ok := recordLabelsProtos[strings.ToLower(value)]
+				if !ok {
+					return nil, false
+				}
+				rule.protos = append(rule.protos, proto)
+			default:
+				return nil, false
+			}
+		}
+	}
+
+	return rule, true
+}
+
+func (r *recordLabelRule) matches(packet gopacket.Packet) bool {
+	if len(r.protos) > 0 {
+		matched := false
+		for _, proto := range r.protos {
+			if packet.Layer(proto) != nil {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if !r.ports.IsEmpty() {
+		transportLayer := packet.TransportLayer()
+		if transportLayer == nil {
+			return false
+		}
+		flow := transportLayer.TransportFlow()
+		if !r.ports.ContainsAny(flowEventPort(flow.Src().Raw()), flowEventPort(flow.Dst().Raw())) {
+			return false
+		}
+	}
+
+	if len(r.nets) > 0 {
+		networkLayer := packet.NetworkLayer()
+		if networkLayer == nil {
+			return false
+		}
+		flow := networkLayer.NetworkFlow()
+		src, _ := netip.AddrFromSlice(flow.Src().Raw())
+		dst, _ := netip.AddrFromSlice(flow.Dst().Raw())
+		src, dst = src.Unmap(), dst.Unmap()
+		matched := false
+		for _, prefix := range r.nets {
+			if prefix.Contains(src) || prefix.Contains(dst) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+// apply invokes `set` once per label of all rules matching the packet
+func (l *recordLabels) apply(packet gopacket.Packet, set func(key, value string)) {
+	if l == nil {
+		return
+	}
+	keys := mapset.NewThreadUnsafeSet[string]()
+	for _, rule := range l.rules {
+		if !rule.matches(packet) {
+			continue
+		}
+		for _, label := range rule.labels {
+			if keys.Add(label.key) {
+				set(label.key, label.value)
+			}
+		}
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRecordLabelsTestPacket(t *testing.T, dstPort layers.TCPPort) gopacket.Packet {
+	return newTestPacket(t, newTestIPv4(net.IPv4(10, 0, 0, 1), net.IPv4(192, 168, 0, 2)),
+		&layers.TCP{SrcPort: 40000, DstPort: dstPort, ACK: true})
+}
+
+// TestRecordLabels verifies that labels of all matching rules are applied, and that the 1st rule setting a label wins.
+func TestRecordLabels(t *testing.T) {
+	t.Parallel()
+
+	assert.Nil(t, newRecordLabels(nil))
+	// invalid rules are ignored
+	assert.Nil(t, newRecordLabels([]string{"team", "team=payments@port=http", "team=payments@host=example.com"}))
+
+	labels := newRecordLabels([]string{
+		"team=payments,env=prod@port=8080|8443,net=10.0.0.0/8",
+		"team=search@proto=tcp",
+		"team=dns@proto=udp,port=53",
+		"cluster=shared",
+	})
+
+	apply := func(packet gopacket.Packet) map[string]string {
+		applied := make(map[string]string)
+		labels.apply(packet, func(key, value string) {
+			applied[key] = value
+		})
+		return applied
+	}
+
+	assert.Equal(t, map[string]string{
+		"team":    "payments",
+		"env":     "prod",
+		"cluster": "shared",
+	}, apply(newRecordLabelsTestPacket(t, 8443)))
+
+	assert.Equal(t, map[string]string{
+		"team":    "search",
+		"cluster": "shared",
+	}, apply(newRecordLabelsTestPacket(t, 9200)))
+
+	// `nil` labels do not apply anything
+	var noLabels *recordLabels = nil
+	noLabels.apply(newRecordLabelsTestPacket(t, 8443), func(_, _ string) {
+		assert.Fail(t, "labels must not be applied")
+	})
+}
@@ -0,0 +1,301 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	mapset "github.com/deckarep/golang-set/v2"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+type (
+	// recordRoutedWriter is implemented by writers that only accept records matching any of their routes.
+	recordRoutedWriter interface {
+		Route() []string
+	}
+
+	// recordProfiledWriter is implemented by writers of capture profiles:
+	// they only accept records of packets allowed by the filters of their profile; `nil` filters allow all packets.
+	recordProfiledWriter interface {
+		Profile() (string, PcapFilters)
+	}
+
+	// recordAttributes are derived from packets instead of translations, so that routes work with all formats.
+	recordAttributes struct {
+		protos    mapset.Set[string]
+		direction string
+		labels    map[string]string
+		severity  string
+		// names of the capture profiles whose filters allowed the packet
+		profiles mapset.Set[string]
+		// the packet was only translated for capture profiles: writers without profile must not write it
+		filtered bool
+	}
+
+	// recordRoute matches records matching all of its conditions;
+	// each condition matches if any of its values matches the record.
+	recordRoute struct {
+		protos     mapset.Set[string]
+		directions mapset.Set[string]
+		labels     []*recordLabel
+		severities mapset.Set[string]
+	}
+
+	// recordRouter holds the routes of every writer: writers without routes accept all records.
+	recordRouter struct {
+		routes [][]*recordRoute
+		labels *recordLabels
+		// profile of every writer: empty for writers without profile
+		profiles []string
+		// filters of every capture profile; translations are shared by all writers, so packets are decoded once
+		profileFilters map[string]PcapFilters
+	}
+)
+
+const (
+	recordRouteLabelSeparator = ":"
+
+	recordDirectionIn    = "in"
+	recordDirectionOut   = "out"
+	recordDirectionLocal = "local"
+
+	recordSeverityDefault = "DEFAULT"
+	recordSeverityError   = "ERROR"
+)
+
+var recordRoutesProtos = map[string]gopacket.LayerType{
+	"arp":   layers.LayerTypeARP,
+	"ipv4":  layers.LayerTypeIPv4,
+	"ipv6":  layers.LayerTypeIPv6,
+	"icmp4": layers.LayerTypeICMPv4,
+	"icmp6": layers.LayerTypeICMPv6,
+	"tcp":   layers.LayerTypeTCP,
+	"udp":   layers.LayerTypeUDP,
+	"sctp":  layers.LayerTypeSCTP,
+	"dns":   layers.LayerTypeDNS,
+	"dhcp4": layers.LayerTypeDHCPv4,
+	"dhcp6": layers.LayerTypeDHCPv6,
+	"tls":   layers.LayerTypeTLS,
+	"sip":   layers.LayerTypeSIP,
+	"ntp":   layers.LayerTypeNTP,
+}
+
+// newRecordRouter returns `nil` if none of the writers is routed, nor belongs to a capture profile:
+//   - routes are comma separated conditions; i/e: `proto=dns|http,dir=out,label=team:payments,severity=error`,
+//   - conditions are: `proto`, `dir` ( `in`, `out` or `local` ), `label` ( `key` or `key:value` ), and `severity`,
+//   - invalid routes are ignored; writers whose routes are all invalid do not accept any records.
+func newRecordRouter(ctx context.Context, writers []io.Writer) *recordRouter {
+	router := &recordRouter{
+		routes:         make([][]*recordRoute, len(writers)),
+		profiles:       make([]string, len(writers)),
+		profileFilters: make(map[string]PcapFilters),
+	}
+
+	isRouted := false
+	usesLabels := false
+	for i, writer := range writers {
+		if profiledWriter, ok := writer.(recordProfiledWriter); ok {
+			isRouted = true
+			profile, filters := profiledWriter.Profile()
+			router.profiles[i], router.profileFilters[profile] = profile, filters
+		}
+		routedWriter, ok := writer.(recordRoutedWriter)
+		if !ok {
+			continue
+		}
+		isRouted = true
+		router.routes[i] = make([]*recordRoute, 0)
+		for _, rawRoute := range routedWriter.Route() {
+			if route, ok := parseRecordRoute(rawRoute); ok {
+				router.routes[i] = append(router.routes[i], route)
+				usesLabels = usesLabels || len(route.labels) > 0
+			}
+		}
+	}
+
+	if !isRouted {
+		return nil
+	}
+
+	if rules, ok := ctx.Value(ContextLabels).([]string); ok && usesLabels {
+		router.labels = newRecordLabels(rules)
+	}
+
+	return router
+}
+
+func parseRecordRoute(rawRoute string) (*recordRoute, bool) {
+	route := &recordRoute{
+		protos:     mapset.NewThreadUnsafeSet[string](),
+		directions: mapset.NewThreadUnsafeSet[string](),
+		severities: mapset.NewThreadUnsafeSet[string](),
+	}
+
+	if strings.TrimSpace(rawRoute) == "" {
+		return route, true
+	}
+
+	for _, rawCondition := range strings.Split(rawRoute, recordLabelsSeparator) {
+		key, rawValues, ok := strings.Cut(rawCondition, recordLabelsValueSeparator)
+		if !ok {
+			return nil, false
+		}
+		for _, value := range strings.Split(rawValues, recordLabelsValuesSeparator) {
+			value = strings.TrimSpace(value)
+			switch strings.ToLower(strings.TrimSpace(key)) {
+			case "proto":
+				proto := strings.ToLower(value)
+				if _, ok := recordRoutesProtos[proto]; !ok && proto != "http" && proto != "icmp" {
+					return nil, false
+				}
+				route.protos.Add(proto)
+			case "dir":
+				switch direction := strings.ToLower(value); direction {
+				case recordDirectionIn, recordDirectionOut, recordDirectionLocal:
+					route.directions.Add(direction)
+				default:
+					return nil, false
+				}
+			case "label":
+				key, value, _ := strings.Cut(value, recordRouteLabelSeparator)
+				if key = strings.TrimSpace(key); key == "" {
+					return nil, false
+				}
+				route.labels = append(route.labels, &recordLabel{key, strings.TrimSpace(value)})
+			case "severity":
+				route.severities.Add(strings.ToUpper(value))
+			default:
+				return nil, false
+			}
+		}
+	}
+
+	return route, true
+}
+
+// attributes returns `nil` if none of the writers is routed
+func (r *recordRouter) attributes(ifaces netIfaceIndex, packet gopacket.Packet) *recordAttributes {
+	if r == nil {
+		return nil
+	}
+
+	attributes := &recordAttributes{
+		protos:    mapset.NewThreadUnsafeSet[string](),
+		direction: "",
+		severity:  recordSeverityDefault,
+	}
+
+	for proto, layerType := range recordRoutesProtos {
+		if packet.Layer(layerType) != nil {
+			attributes.protos.Add(proto)
+		}
+	}
+	if attributes.protos.ContainsAny("icmp4", "icmp6") {
+		attributes.protos.Add("icmp")
+	}
+	if tcp, ok := packet.Layer(layers.LayerTypeTCP).(*layers.TCP); ok && len(tcp.Payload) > 0 {
+		// best-effort: only HTTP/1.1 messages and HTTP/2 connection prefaces are detected
+		if http11RequestPayloadRegex.Match(tcp.Payload) ||
+			http11ResponsePayloadRegex.Match(tcp.Payload) ||
+			http2PrefaceRegex.Match(tcp.Payload) {
+			attributes.protos.Add("http")
+		}
+	}
+
+	if networkLayer := packet.NetworkLayer(); networkLayer != nil {
+		flow := networkLayer.NetworkFlow()
+		_, isSrcLocal := ifaces[flow.Src().String()]
+		_, isDstLocal := ifaces[flow.Dst().String()]
+		switch {
+		case isSrcLocal && isDstLocal:
+			attributes.direction = recordDirectionLocal
+		case isSrcLocal:
+			attributes.direction = recordDirectionOut
+		case isDstLocal:
+			attributes.direction = recordDirectionIn
+		}
+	}
+
+	if r.labels != nil {
+		attributes.labels = make(map[string]string)
+		r.labels.apply(packet, func(key, value string) {
+			attributes.labels[key] = value
+		})
+	}
+
+	if packet.ErrorLayer() != nil {
+		attributes.severity = recordSeverityError
+	}
+
+	return attributes
+}
+
+// accepts returns whether the writer at `index` must write the record;
+// records without attributes are written by all writers.
+func (r *recordRouter) accepts(index int, attributes *recordAttributes) bool {
+	if r == nil || attributes == nil {
+		return true
+	}
+	if profile := r.profiles[index]; profile != "" {
+		if attributes.profiles == nil || !attributes.profiles.Contains(profile) {
+			return false
+		}
+	} else if attributes.filtered {
+		return false
+	}
+	if r.routes[index] == nil {
+		return true
+	}
+	for _, route := range r.routes[index] {
+		if route.matches(attributes) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *recordRoute) matches(attributes *recordAttributes) bool {
+	if !r.protos.IsEmpty() && !attributes.protos.ContainsAny(r.protos.ToSlice()...) {
+		return false
+	}
+
+	if !r.directions.IsEmpty() && !r.directions.Contains(attributes.direction) {
+		return false
+	}
+
+	if !r.severities.IsEmpty() && !r.severities.Contains(attributes.severity) {
+		return false
+	}
+
+	if len(r.labels) > 0 {
+		matched := false
+		for _, label := range r.labels {
+			value, ok := attributes.labels[label.key]
+			if ok && (label.value == "" || label.value == value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	return true
+}
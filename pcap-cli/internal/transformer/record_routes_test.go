@@ -0,0 +1,147 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+type testRoutedWriter struct {
+	io.Writer
+	routes []string
+}
+
+func (w *testRoutedWriter) Route() []string {
+	return w.routes
+}
+
+func newRecordRoutesTestPacket(t *testing.T, transport gopacket.SerializableLayer, payload ...gopacket.SerializableLayer) gopacket.Packet {
+	return newTestPacket(t, newTestIPv4(net.IPv4(10, 0, 0, 1), net.IPv4(192, 168, 0, 2)), transport, payload...)
+}
+
+// TestRecordRouter verifies that writers only accept records matching any of their routes.
+func TestRecordRouter(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.WithValue(context.Background(), ContextLabels, []string{"team=payments@port=8080"})
+
+	// none of the writers is routed
+	assert.Nil(t, newRecordRouter(ctx, []io.Writer{new(bytes.Buffer)}))
+
+	router := newRecordRouter(ctx, []io.Writer{
+		new(bytes.Buffer),
+		&testRoutedWriter{new(bytes.Buffer), []string{"proto=dns"}},
+		&testRoutedWriter{new(bytes.Buffer), []string{"proto=http,dir=out", "label=team:payments"}},
+		&testRoutedWriter{new(bytes.Buffer), []string{"severity=error"}},
+		// invalid routes are ignored: the writer does not accept any records
+		&testRoutedWriter{new(bytes.Buffer), []string{"proto=smtp", "host=example.com"}},
+	})
+	assert.NotNil(t, router)
+
+	ifaces := netIfaceIndex{"10.0.0.1": &PcapIface{Index: 1, Name: "eth0"}}
+
+	dns := router.attributes(ifaces, newRecordRoutesTestPacket(t,
+		&layers.UDP{SrcPort: 40000, DstPort: 53},
+		&layers.DNS{ID: 1, RD: true, Questions: []layers.DNSQuestion{
+			{Name: []byte("example.com"), Type: layers.DNSTypeA, Class: layers.DNSClassIN},
+		}}))
+	assert.True(t, dns.protos.Contains("dns"))
+	assert.Equal(t, recordDirectionOut, dns.direction)
+	assert.Equal(t, recordSeverityDefault, dns.severity)
+	assert.Equal(t, []bool{true, true, false, false, false}, []bool{
+		router.accepts(0, dns), router.accepts(1, dns), router.accepts(2, dns),
+		router.accepts(3, dns), router.accepts(4, dns),
+	})
+
+	http := router.attributes(ifaces, newRecordRoutesTestPacket(t,
+		&layers.TCP{SrcPort: 40000, DstPort: 80, PSH: true, ACK: true},
+		gopacket.Payload("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")))
+	assert.True(t, http.protos.Contains("http"))
+	assert.Equal(t, []bool{true, false, true, false, false}, []bool{
+		router.accepts(0, http), router.accepts(1, http), router.accepts(2, http),
+		router.accepts(3, http), router.accepts(4, http),
+	})
+
+	labeled := router.attributes(ifaces, newRecordRoutesTestPacket(t,
+		&layers.TCP{SrcPort: 40000, DstPort: 8080, ACK: true}))
+	assert.Equal(t, map[string]string{"team": "payments"}, labeled.labels)
+	assert.True(t, router.accepts(2, labeled))
+
+	// records without attributes are accepted by all writers
+	assert.True(t, router.accepts(4, nil))
+}
+
+type testProfiledWriter struct {
+	io.Writer
+	profile string
+	filters PcapFilters
+}
+
+func (w *testProfiledWriter) Profile() (string, PcapFilters) {
+	return w.profile, w.filters
+}
+
+// TestRecordRouterProfiles verifies that packets are written by the writers of the capture
+// and of every profile whose filters allow them, and that writers of the capture skip packets only allowed by profiles.
+func TestRecordRouterProfiles(t *testing.T) {
+	t.Parallel()
+
+	filters := NewPcapFilters()
+	filters.AddPort(8080)
+	dnsFilters := NewPcapFilters()
+	dnsFilters.AddL4Proto(L4_PROTO_UDP)
+	dnsFilters.AddPort(53)
+	httpsFilters := NewPcapFilters()
+	httpsFilters.AddPort(443)
+
+	router := newRecordRouter(context.Background(), []io.Writer{
+		new(bytes.Buffer),
+		&testProfiledWriter{new(bytes.Buffer), "dns", dnsFilters},
+		&testProfiledWriter{new(bytes.Buffer), "egress-443", httpsFilters},
+	})
+	assert.NotNil(t, router)
+
+	iface := &PcapIface{Index: 1, Name: "eth0"}
+	ifaces := netIfaceIndex{"10.0.0.1": iface}
+
+	accepts := func(packet gopacket.Packet) []bool {
+		serial := uint64(1)
+		worker := newPcapTranslatorWorker(ifaces, iface, filters, &serial, &packet, nil, router, nil, nil, false, false)
+		allowed := worker.shouldTranslate(context.Background())
+		profiles := worker.allowedProfiles(context.Background())
+
+		attributes := router.attributes(ifaces, packet)
+		attributes.profiles, attributes.filtered = profiles, !allowed
+		return []bool{router.accepts(0, attributes), router.accepts(1, attributes), router.accepts(2, attributes)}
+	}
+
+	assert.Equal(t, []bool{false, true, false}, accepts(newRecordRoutesTestPacket(t,
+		&layers.UDP{SrcPort: 40000, DstPort: 53})))
+	assert.Equal(t, []bool{false, false, true}, accepts(newRecordRoutesTestPacket(t,
+		&layers.TCP{SrcPort: 40000, DstPort: 443, ACK: true})))
+	assert.Equal(t, []bool{true, false, false}, accepts(newRecordRoutesTestPacket(t,
+		&layers.TCP{SrcPort: 40000, DstPort: 8080, ACK: true})))
+	// TCP is not allowed by the `dns` profile
+	assert.Equal(t, []bool{false, false, false}, accepts(newRecordRoutesTestPacket(t,
+		&layers.TCP{SrcPort: 40000, DstPort: 53, ACK: true})))
+}
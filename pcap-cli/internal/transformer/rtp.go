@@ -0,0 +1,304 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/segmentio/fasthash/fnv1a"
+)
+
+type (
+	// see: https://datatracker.ietf.org/doc/html/rfc3550#section-5.1
+	rtpHeader struct {
+		marker      bool
+		payloadType uint8
+		sequence    uint16
+		timestamp   uint32
+		ssrc        uint32
+	}
+
+	// rtpStream keeps the counters of a synchronization source:
+	//   - see: https://datatracker.ietf.org/doc/html/rfc3550#appendix-A.1
+	//   - see: https://datatracker.ietf.org/doc/html/rfc3550#appendix-A.8
+	rtpStream struct {
+		baseSequence uint16
+		maxSequence  uint16
+		cycles       uint32
+		received     uint32
+		// relative transit time of the previous packet, in RTP timestamp units
+		transit int64
+		// interarrival jitter, in RTP timestamp units
+		jitter float64
+	}
+
+	rtpStreamStats struct {
+		received, lost uint32
+		// interarrival jitter in milliseconds; only available if the clock rate of the payload type is known
+		jitter *float64
+	}
+
+	// rtpMedia is an RTP endpoint announced by a SDP offer or answer carried by a SIP message.
+	rtpMedia struct {
+		kind string
+		// clock rates of dynamic payload types; i/e: `a=rtpmap:96 opus/48000/2`
+		clockRates map[uint8]uint32
+	}
+
+	// rtpTracker decodes RTP only for endpoints announced via SIP: RTP uses dynamic ports and has no magic numbers.
+	rtpTracker struct {
+		mu        sync.Mutex
+		endpoints map[string]*rtpMedia
+		streams   map[uint64]*rtpStream
+	}
+)
+
+const (
+	rtpVersion      = 2
+	rtpHeaderLen    = 12
+	rtpEndpointsMax = 1024
+	rtpStreamsMax   = 4096
+	// sequence numbers jumps smaller than this are considered in order; see: https://datatracker.ietf.org/doc/html/rfc3550#appendix-A.1
+	rtpMaxDropout = 3000
+)
+
+// clock rates of static payload types; see: https://www.iana.org/assignments/rtp-parameters/rtp-parameters.xhtml
+var rtpStaticClockRates = map[uint8]uint32{
+	0: 8000, 3: 8000, 4: 8000, 5: 8000, 6: 16000, 7: 8000, 8: 8000, 9: 8000,
+	10: 44100, 11: 44100, 12: 8000, 13: 8000, 14: 90000, 15: 8000, 16: 11025,
+	17: 22050, 18: 8000, 25: 90000, 26: 90000, 28: 90000, 31: 90000, 32: 90000,
+	33: 90000, 34: 90000,
+}
+
+func newRTPTracker() *rtpTracker {
+	return &rtpTracker{
+		endpoints: make(map[string]*rtpMedia),
+		streams:   make(map[uint64]*rtpStream),
+	}
+}
+
+// sipCSeq returns the sequence number and the method of the `CSeq` header;
+// responses do not carry a method in their start line, so it is the only way to know what they answer to.
+func sipCSeq(sip *layers.SIP) (int64, string) {
+	rawSequence, method, _ := strings.Cut(strings.TrimSpace(sip.GetFirstHeader("CSeq")), " ")
+	sequence, _ := strconv.ParseInt(rawSequence, 10, 64)
+	return sequence, strings.TrimSpace(method)
+}
+
+// parseRTP returns `false` for RTCP packets: their payload type overlaps with the RTP marker bit.
+func parseRTP(data []byte) (*rtpHeader, bool) {
+	if len(data) < rtpHeaderLen || data[0]>>6 != rtpVersion {
+		return nil, false
+	}
+	// RTCP packet types are 200 to 204; see: https://datatracker.ietf.org/doc/html/rfc5761#section-4
+	if data[1] >= 200 && data[1] <= 204 {
+		return nil, false
+	}
+	headerLen := rtpHeaderLen + 4*int(data[0]&0x0f)
+	if len(data) < headerLen {
+		return nil, false
+	}
+	return &rtpHeader{
+		marker:      data[1]&0x80 != 0,
+		payloadType: data[1] & 0x7f,
+		sequence:    binary.BigEndian.Uint16(data[2:4]),
+		timestamp:   binary.BigEndian.Uint32(data[4:8]),
+		ssrc:        binary.BigEndian.Uint32(data[8:12]),
+	}, true
+}
+
+// parseSDP returns the RTP endpoints announced by a session description; see: https://datatracker.ietf.org/doc/html/rfc4566#section-5
+func parseSDP(body []byte) map[string]*rtpMedia {
+	endpoints := make(map[string]*rtpMedia)
+
+	sessionAddress := ""
+	mediaAddress := ""
+	var media *rtpMedia = nil
+	mediaPort := ""
+
+	flush := func() {
+		if media == nil || mediaPort == "" || mediaPort == "0" {
+			return
+		}
+		address := mediaAddress
+		if address == "" {
+			address = sessionAddress
+		}
+		if address != "" {
+			endpoints[net.JoinHostPort(address, mediaPort)] = media
+		}
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) < 2 || line[1] != '=' {
+			continue
+		}
+		value := line[2:]
+		switch line[0] {
+		case 'c':
+			// i/e: `c=IN IP4 10.0.0.1`
+			fields := strings.Fields(value)
+			if len(fields) < 3 {
+				continue
+			}
+			address, _, _ := strings.Cut(fields[2], "/")
+			if media == nil {
+				sessionAddress = address
+			} else {
+				mediaAddress = address
+			}
+		case 'm':
+			// i/e: `m=audio 49170 RTP/AVP 0 8 96`
+			flush()
+			fields := strings.Fields(value)
+			media, mediaPort, mediaAddress = nil, "", ""
+			if len(fields) < 3 || !strings.Contains(fields[2], "RTP") {
+				continue
+			}
+			port, _, _ := strings.Cut(fields[1], "/")
+			media = &rtpMedia{kind: fields[0], clockRates: make(map[uint8]uint32)}
+			mediaPort = port
+		case 'a':
+			// i/e: `a=rtpmap:96 opus/48000/2`
+			if media == nil || !strings.HasPrefix(value, "rtpmap:") {
+				continue
+			}
+			rawPayloadType, encoding, ok := strings.Cut(strings.TrimPrefix(value, "rtpmap:"), " ")
+			if !ok {
+				continue
+			}
+			payloadType, err := strconv.ParseUint(rawPayloadType, 10, 7)
+			if err != nil {
+				continue
+			}
+			parts := strings.Split(encoding, "/")
+			if len(parts) < 2 {
+				continue
+			}
+			if clockRate, err := strconv.ParseUint(parts[1], 10, 32); err == nil {
+				media.clockRates[uint8(payloadType)] = uint32(clockRate)
+			}
+		}
+	}
+	flush()
+
+	return endpoints
+}
+
+// sortedEndpoints makes translations of the same SDP stable.
+func sortedEndpoints(endpoints map[string]*rtpMedia) []string {
+	return slices.Sorted(maps.Keys(endpoints))
+}
+
+// announce makes endpoints of SDP offers and answers available for RTP decoding.
+func (r *rtpTracker) announce(endpoints map[string]*rtpMedia) {
+	if len(endpoints) == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.endpoints)+len(endpoints) > rtpEndpointsMax {
+		// endpoints are not expired: calls are not tracked, so start over
+		r.endpoints = make(map[string]*rtpMedia)
+	}
+	for endpoint, media := range endpoints {
+		r.endpoints[endpoint] = media
+	}
+}
+
+// lookup returns the media of either endpoint; RTP is usually symmetric, so both directions are decoded.
+func (r *rtpTracker) lookup(src, dst string) (*rtpMedia, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if media, ok := r.endpoints[dst]; ok {
+		return media, true
+	}
+	media, ok := r.endpoints[src]
+	return media, ok
+}
+
+func (m *rtpMedia) clockRate(payloadType uint8) uint32 {
+	if clockRate, ok := m.clockRates[payloadType]; ok {
+		return clockRate
+	}
+	return rtpStaticClockRates[payloadType]
+}
+
+// observe updates the counters of the stream identified by the flow and the SSRC.
+func (r *rtpTracker) observe(flowID uint64, header *rtpHeader, arrival time.Time, clockRate uint32) *rtpStreamStats {
+	key := fnv1a.AddUint64(flowID, uint64(header.ssrc))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// relative transit time in RTP timestamp units
+	transit := int64(0)
+	if clockRate > 0 {
+		transit = arrival.UnixNano()*int64(clockRate)/int64(time.Second) - int64(header.timestamp)
+	}
+
+	stream, ok := r.streams[key]
+	if !ok {
+		if len(r.streams) >= rtpStreamsMax {
+			r.streams = make(map[uint64]*rtpStream)
+		}
+		stream = &rtpStream{
+			baseSequence: header.sequence,
+			maxSequence:  header.sequence,
+			transit:      transit,
+		}
+		r.streams[key] = stream
+	} else {
+		if delta := header.sequence - stream.maxSequence; delta > 0 && delta < rtpMaxDropout {
+			if header.sequence < stream.maxSequence {
+				// sequence number wrapped around
+				stream.cycles += 1 << 16
+			}
+			stream.maxSequence = header.sequence
+		}
+		if clockRate > 0 {
+			d := transit - stream.transit
+			if d < 0 {
+				d = -d
+			}
+			stream.jitter += (float64(d) - stream.jitter) / 16
+			stream.transit = transit
+		}
+	}
+	stream.received += 1
+
+	stats := &rtpStreamStats{received: stream.received}
+	expected := stream.cycles + uint32(stream.maxSequence) - uint32(stream.baseSequence) + 1
+	if expected > stream.received {
+		stats.lost = expected - stream.received
+	}
+	if clockRate > 0 {
+		jitter := stream.jitter * 1000 / float64(clockRate)
+		stats.jitter = &jitter
+	}
+	return stats
+}
@@ -0,0 +1,154 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRTPPacket(payloadType uint8, sequence uint16, timestamp, ssrc uint32) []byte {
+	return []byte{
+		0x80, payloadType, byte(sequence >> 8), byte(sequence),
+		byte(timestamp >> 24), byte(timestamp >> 16), byte(timestamp >> 8), byte(timestamp),
+		byte(ssrc >> 24), byte(ssrc >> 16), byte(ssrc >> 8), byte(ssrc),
+	}
+}
+
+// TestParseRTP verifies that RTP headers are decoded, and that RTCP packets are not mistaken for RTP.
+func TestParseRTP(t *testing.T) {
+	t.Parallel()
+
+	header, ok := parseRTP(newRTPPacket(0x80|96, 513, 160, 0xdeadbeef))
+	if assert.True(t, ok) {
+		assert.True(t, header.marker)
+		assert.Equal(t, uint8(96), header.payloadType)
+		assert.Equal(t, uint16(513), header.sequence)
+		assert.Equal(t, uint32(160), header.timestamp)
+		assert.Equal(t, uint32(0xdeadbeef), header.ssrc)
+	}
+
+	// RTCP sender report
+	_, ok = parseRTP(newRTPPacket(200, 0, 0, 1))
+	assert.False(t, ok)
+
+	// version 1
+	packet := newRTPPacket(0, 1, 1, 1)
+	packet[0] = 0x40
+	_, ok = parseRTP(packet)
+	assert.False(t, ok)
+
+	// CSRC count exceeds the packet length
+	packet = newRTPPacket(0, 1, 1, 1)
+	packet[0] = 0x82
+	_, ok = parseRTP(packet)
+	assert.False(t, ok)
+}
+
+// TestParseSDP verifies that media level connections override the session level one, and that rejected or non RTP media are ignored.
+func TestParseSDP(t *testing.T) {
+	t.Parallel()
+
+	sdp := []byte("v=0\r\n" +
+		"o=- 1 1 IN IP4 10.0.0.1\r\n" +
+		"c=IN IP4 10.0.0.1\r\n" +
+		"m=audio 49170 RTP/AVP 0 96\r\n" +
+		"a=rtpmap:96 opus/48000/2\r\n" +
+		"m=video 51372 RTP/AVP 31\r\n" +
+		"c=IN IP4 10.0.0.2\r\n" +
+		"m=video 0 RTP/AVP 31\r\n" +
+		"m=application 5000 udp wb\r\n")
+
+	endpoints := parseSDP(sdp)
+	assert.Equal(t, []string{"10.0.0.1:49170", "10.0.0.2:51372"}, sortedEndpoints(endpoints))
+
+	audio := endpoints["10.0.0.1:49170"]
+	if assert.NotNil(t, audio) {
+		assert.Equal(t, "audio", audio.kind)
+		assert.Equal(t, uint32(48000), audio.clockRate(96))
+		assert.Equal(t, uint32(8000), audio.clockRate(0))
+		assert.Equal(t, uint32(0), audio.clockRate(97))
+	}
+}
+
+// TestRTPTrackerLookup verifies that both directions of an announced endpoint are decoded.
+func TestRTPTrackerLookup(t *testing.T) {
+	t.Parallel()
+
+	tracker := newRTPTracker()
+	tracker.announce(parseSDP([]byte("c=IN IP4 10.0.0.1\r\nm=audio 49170 RTP/AVP 0\r\n")))
+
+	_, ok := tracker.lookup("10.0.0.2:30000", "10.0.0.1:49170")
+	assert.True(t, ok)
+	_, ok = tracker.lookup("10.0.0.1:49170", "10.0.0.2:30000")
+	assert.True(t, ok)
+	_, ok = tracker.lookup("10.0.0.2:30000", "10.0.0.1:49172")
+	assert.False(t, ok)
+}
+
+// TestRTPTrackerObserve verifies that lost packets are counted across sequence number wrap around, and that jitter is reported in milliseconds.
+func TestRTPTrackerObserve(t *testing.T) {
+	t.Parallel()
+
+	tracker := newRTPTracker()
+	arrival := time.Unix(1700000000, 0)
+
+	// 20ms of 8kHz audio per packet, arriving evenly spaced: no jitter
+	var stats *rtpStreamStats
+	for i, sequence := range []uint16{65534, 65535, 1, 2} {
+		header := &rtpHeader{sequence: sequence, timestamp: uint32(160 * i), ssrc: 1}
+		stats = tracker.observe(1, header, arrival.Add(time.Duration(i)*20*time.Millisecond), 8000)
+	}
+	assert.Equal(t, uint32(4), stats.received)
+	assert.Equal(t, uint32(1), stats.lost)
+	if assert.NotNil(t, stats.jitter) {
+		assert.InDelta(t, 0, *stats.jitter, 0.001)
+	}
+
+	// a packet arriving 16ms late increases the jitter by 1/16 of its transit difference
+	header := &rtpHeader{sequence: 3, timestamp: 160 * 4, ssrc: 1}
+	stats = tracker.observe(1, header, arrival.Add(80*time.Millisecond+16*time.Millisecond), 8000)
+	if assert.NotNil(t, stats.jitter) {
+		assert.InDelta(t, 1, *stats.jitter, 0.001)
+	}
+
+	// unknown clock rate
+	stats = tracker.observe(1, &rtpHeader{sequence: 1, ssrc: 2}, arrival, 0)
+	assert.Nil(t, stats.jitter)
+	assert.Equal(t, uint32(1), stats.received)
+}
+
+// TestSIPCSeq verifies that responses are attributed to the method of their `CSeq` header.
+func TestSIPCSeq(t *testing.T) {
+	t.Parallel()
+
+	response := []byte("SIP/2.0 486 Busy Here\r\n" +
+		"Call-ID: a84b4c76e66710\r\n" +
+		"CSeq: 314159 INVITE\r\n" +
+		"Content-Length: 0\r\n\r\n")
+
+	packet := gopacket.NewPacket(response, layers.LayerTypeSIP, gopacket.Default)
+	sip, ok := packet.Layer(layers.LayerTypeSIP).(*layers.SIP)
+	if assert.True(t, ok) {
+		sequence, method := sipCSeq(sip)
+		assert.Equal(t, int64(314159), sequence)
+		assert.Equal(t, "INVITE", method)
+		assert.Equal(t, "a84b4c76e66710", sip.GetCallID())
+	}
+}
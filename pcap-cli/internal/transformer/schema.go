@@ -0,0 +1,59 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/pcap-sidecar/pcap-cli/schema"
+)
+
+// jsonTranslationSchemaVersion must be increased whenever JSON translations change:
+//   - MINOR when fields are added,
+//   - MAJOR when fields are renamed, removed or their type changes.
+//
+// it must always match the `schemaVersion` defined by `schema/json/translation.schema.json`.
+const jsonTranslationSchemaVersion = "1.33.0"
+
+var errUnavailableSchema = errors.New("translation schema is not available")
+
+// TranslationSchema returns the machine-readable schema of translations produced by `format`:
+//   - `json`: JSON Schema,
+//   - `proto`: Protocol Buffers definition.
+func TranslationSchema(format string) ([]byte, error) {
+	pcapFmt, ok := pcapTranslatorFmts[format]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown format '%s'", errUnavailableSchema, format)
+	}
+
+	switch pcapFmt {
+	case JSON:
+		return schema.JSON, nil
+	case PROTO:
+		return schema.Proto, nil
+	}
+
+	return nil, fmt.Errorf("%w: '%s'", errUnavailableSchema, format)
+}
+
+// TranslationSchemaVersion returns the `schemaVersion` of translations produced by `format`;
+// it is empty for formats whose translations are not versioned by PCAP CLI.
+func TranslationSchemaVersion(format string) string {
+	if pcapFmt, ok := pcapTranslatorFmts[format]; ok && pcapFmt == JSON {
+		return jsonTranslationSchemaVersion
+	}
+	return ""
+}
@@ -0,0 +1,54 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestTranslationSchema verifies that the JSON Schema is valid JSON and matches the version of translations.
+func TestTranslationSchema(t *testing.T) {
+	t.Parallel()
+
+	jsonSchema, err := TranslationSchema("json")
+	assert.NoError(t, err)
+
+	var document struct {
+		Properties struct {
+			SchemaVersion struct {
+				Const string `json:"const"`
+			} `json:"schemaVersion"`
+		} `json:"properties"`
+	}
+	assert.NoError(t, json.Unmarshal(jsonSchema, &document))
+	assert.Equal(t, jsonTranslationSchemaVersion, document.Properties.SchemaVersion.Const)
+
+	protoSchema, err := TranslationSchema("proto")
+	assert.NoError(t, err)
+	assert.Contains(t, string(protoSchema), "message Packet")
+
+	_, err = TranslationSchema("pcapng")
+	assert.ErrorIs(t, err, errUnavailableSchema)
+
+	_, err = TranslationSchema("xml")
+	assert.ErrorIs(t, err, errUnavailableSchema)
+
+	assert.Equal(t, jsonTranslationSchemaVersion, TranslationSchemaVersion("json"))
+	assert.Empty(t, TranslationSchemaVersion("pcapng"))
+	assert.Empty(t, TranslationSchemaVersion("xml"))
+}
@@ -0,0 +1,168 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"encoding/binary"
+	"slices"
+	"strconv"
+
+	mapset "github.com/deckarep/golang-set/v2"
+)
+
+type (
+	// sctpChunk contains the fields of the chunk header, and the fields of the chunks used to follow associations.
+	sctpChunk struct {
+		kind   uint8
+		flags  uint8
+		length uint16
+		// DATA: `TSN`; SACK: cumulative `TSN` ack; INIT/INIT_ACK: initial `TSN`
+		tsn uint32
+		// DATA: stream identifier and stream sequence number
+		stream, ssn uint16
+		// DATA: payload protocol identifier
+		ppid uint32
+		// INIT/INIT_ACK: the verification tag to be used by the peer
+		initiateTag uint32
+		// INIT/INIT_ACK: number of outbound and inbound streams
+		outbound, inbound uint16
+	}
+)
+
+const (
+	// see: https://www.rfc-editor.org/rfc/rfc9260#section-3.2
+	sctpChunkHeaderLen        = 4
+	sctpChunkData             = 0
+	sctpChunkInit             = 1
+	sctpChunkInitAck          = 2
+	sctpChunkSack             = 3
+	sctpChunkAbort            = 6
+	sctpChunkShutdownComplete = 14
+)
+
+// see: https://www.iana.org/assignments/sctp-parameters/sctp-parameters.xhtml#sctp-parameters-1
+var sctpChunkNames = map[uint8]string{
+	0:   "DATA",
+	1:   "INIT",
+	2:   "INIT_ACK",
+	3:   "SACK",
+	4:   "HEARTBEAT",
+	5:   "HEARTBEAT_ACK",
+	6:   "ABORT",
+	7:   "SHUTDOWN",
+	8:   "SHUTDOWN_ACK",
+	9:   "ERROR",
+	10:  "COOKIE_ECHO",
+	11:  "COOKIE_ACK",
+	14:  "SHUTDOWN_COMPLETE",
+	64:  "I_DATA",
+	128: "ASCONF_ACK",
+	130: "RE_CONFIG",
+	132: "PAD",
+	192: "FORWARD_TSN",
+	193: "ASCONF",
+}
+
+func (c *sctpChunk) name() string {
+	if name, ok := sctpChunkNames[c.kind]; ok {
+		return name
+	}
+	return strconv.FormatUint(uint64(c.kind), 10)
+}
+
+// parseSCTPChunks returns all complete chunks carried by an SCTP packet; chunks are padded to 4 bytes.
+func parseSCTPChunks(data []byte) []*sctpChunk {
+	chunks := make([]*sctpChunk, 0, 1)
+	for len(data) >= sctpChunkHeaderLen {
+		chunk := &sctpChunk{
+			kind:   data[0],
+			flags:  data[1],
+			length: binary.BigEndian.Uint16(data[2:4]),
+		}
+		length := int(chunk.length)
+		if length < sctpChunkHeaderLen || length > len(data) {
+			break
+		}
+
+		value := data[sctpChunkHeaderLen:length]
+		switch chunk.kind {
+		case sctpChunkData:
+			if len(value) >= 12 {
+				chunk.tsn = binary.BigEndian.Uint32(value[0:4])
+				chunk.stream = binary.BigEndian.Uint16(value[4:6])
+				chunk.ssn = binary.BigEndian.Uint16(value[6:8])
+				chunk.ppid = binary.BigEndian.Uint32(value[8:12])
+			}
+		case sctpChunkInit, sctpChunkInitAck:
+			if len(value) >= 16 {
+				chunk.initiateTag = binary.BigEndian.Uint32(value[0:4])
+				chunk.outbound = binary.BigEndian.Uint16(value[8:10])
+				chunk.inbound = binary.BigEndian.Uint16(value[10:12])
+				chunk.tsn = binary.BigEndian.Uint32(value[12:16])
+			}
+		case sctpChunkSack:
+			if len(value) >= 4 {
+				chunk.tsn = binary.BigEndian.Uint32(value[0:4])
+			}
+		}
+		chunks = append(chunks, chunk)
+
+		if padded := (length + 3) &^ 3; padded < len(data) {
+			data = data[padded:]
+		} else {
+			break
+		}
+	}
+	return chunks
+}
+
+// sctpChunksSummary returns the names of the chunks, and the streams carrying DATA.
+func sctpChunksSummary(chunks []*sctpChunk) ([]string, []uint16) {
+	names := mapset.NewThreadUnsafeSet[string]()
+	streams := mapset.NewThreadUnsafeSet[uint16]()
+	kinds := make([]string, 0, len(chunks))
+	for _, chunk := range chunks {
+		if names.Add(chunk.name()) {
+			kinds = append(kinds, chunk.name())
+		}
+		if chunk.kind == sctpChunkData {
+			streams.Add(chunk.stream)
+		}
+	}
+	sortedStreams := streams.ToSlice()
+	slices.Sort(sortedStreams)
+	return kinds, sortedStreams
+}
+
+// sctpFlowFlags returns the TCP flags equivalent to the chunks of an SCTP packet, so that associations are tracked like TCP connections:
+// INIT and INIT_ACK open the association, while ABORT and SHUTDOWN_COMPLETE terminate it.
+func sctpFlowFlags(chunks []*sctpChunk) uint8 {
+	var flags uint8 = 0
+	for _, chunk := range chunks {
+		switch chunk.kind {
+		case sctpChunkInit:
+			flags |= tcpSyn
+		case sctpChunkInitAck:
+			flags |= tcpSyn | tcpAck
+		case sctpChunkAbort:
+			flags |= tcpRst
+		case sctpChunkShutdownComplete:
+			flags |= tcpFin
+		default:
+			flags |= tcpAck
+		}
+	}
+	return flags
+}
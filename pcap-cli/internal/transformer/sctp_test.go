@@ -0,0 +1,65 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSCTP verifies that complete chunks are parsed, and that streams carrying DATA are reported.
+func TestSCTP(t *testing.T) {
+	t.Parallel()
+
+	data := []byte{
+		// common header: ports 36412 > 38412, verification tag, checksum
+		0x8e, 0x3c, 0x96, 0x0c, 0x0a, 0x0b, 0x0c, 0x0d, 0x00, 0x00, 0x00, 0x00,
+		// DATA: len 19 ( padded to 20 ), TSN 7, stream 2, SSN 3, PPID 60 ( NGAP )
+		0x00, 0x03, 0x00, 0x13, 0x00, 0x00, 0x00, 0x07, 0x00, 0x02, 0x00, 0x03, 0x00, 0x00, 0x00, 0x3c,
+		0x01, 0x02, 0x03, 0x00,
+		// SACK: cumulative TSN ack 5
+		0x03, 0x00, 0x00, 0x10, 0x00, 0x00, 0x00, 0x05, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		// truncated chunk
+		0x00, 0x00, 0x00, 0x20,
+	}
+
+	packet := gopacket.NewPacket(data, layers.LayerTypeSCTP, gopacket.Default)
+	sctp, ok := packet.Layer(layers.LayerTypeSCTP).(*layers.SCTP)
+	if !assert.True(t, ok) {
+		return
+	}
+
+	chunks := parseSCTPChunks(sctp.Payload)
+	if assert.Len(t, chunks, 2) {
+		assert.Equal(t, "DATA", chunks[0].name())
+		assert.Equal(t, uint32(7), chunks[0].tsn)
+		assert.Equal(t, uint16(2), chunks[0].stream)
+		assert.Equal(t, uint16(3), chunks[0].ssn)
+		assert.Equal(t, uint32(60), chunks[0].ppid)
+		assert.Equal(t, "SACK", chunks[1].name())
+		assert.Equal(t, uint32(5), chunks[1].tsn)
+	}
+
+	kinds, streams := sctpChunksSummary(chunks)
+	assert.Equal(t, []string{"DATA", "SACK"}, kinds)
+	assert.Equal(t, []uint16{2}, streams)
+
+	assert.Equal(t, uint32(0x0a0b0c0d), sctp.VerificationTag)
+	assert.Equal(t, "13", (&sctpChunk{kind: 13}).name())
+	assert.Empty(t, parseSCTPChunks([]byte{0x00, 0x00, 0x00, 0x02}))
+}
@@ -0,0 +1,463 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+type (
+	// tcpAnalysis describes how a segment relates to the previous segments of its connection; just like Wireshark's `tcp.analysis`.
+	tcpAnalysis struct {
+		retransmission     bool
+		fastRetransmission bool
+		outOfOrder         bool
+		lostSegment        bool
+		keepAlive          bool
+		zeroWindow         bool
+		windowFull         bool
+		// serial of the packet which carried the same segment; zero if retransmitted bytes were segmented differently
+		retransmissionOf uint64
+		// length of the streak of duplicate ACKs this segment belongs to, and serial of the ACK being duplicated
+		dupACK   uint32
+		dupACKOf uint64
+		// how long `stalledBy` has been advertising a zero window; only set once per stall:
+		// when it persists beyond `tcpAnalysisStallThreshold`, and when it ends
+		stall      time.Duration
+		stallEnded bool
+		stalledBy  netip.AddrPort
+	}
+
+	// tcpStalled is the total time a connection was stalled by zero windows; it is attached to segments ending connections.
+	tcpStalled time.Duration
+
+	// tcpWindowStall measures how long 1 endpoint advertises a zero window.
+	tcpWindowStall struct {
+		since    time.Time
+		reported bool
+		total    time.Duration
+	}
+
+	tcpAnalysisKey struct {
+		a, b netip.AddrPort
+	}
+
+	// tcpAnalysisDirection is the state of 1 direction of a connection: segments sent by 1 of its endpoints.
+	tcpAnalysisDirection struct {
+		seen    bool
+		nextSeq uint32
+		// when the highest segment was sent
+		nextSeqAt time.Time
+
+		acked     bool
+		lastACK   uint32
+		lastWin   uint16
+		lastACKOf uint64
+		dupACKs   uint32
+
+		// window scaling is only known if the handshake was captured, and it is only used if both endpoints agree to it
+		synSeen  bool
+		winScale int8
+		stall    tcpWindowStall
+	}
+
+	tcpAnalysisFlow struct {
+		key        tcpAnalysisKey
+		directions [2]tcpAnalysisDirection
+		rtt        tcpRTT
+		last       time.Time
+		// data segments carried by both directions; only allocated once the connection carries data
+		segments *tcpSegments
+
+		state            tcpState
+		initiator, finBy int
+	}
+
+	// tcpAnalyzer must observe packets sequentially in capture order: it is not thread-safe.
+	tcpAnalyzer struct {
+		flows map[tcpAnalysisKey]*tcpAnalysisFlow
+		// counts connections by state; `nil` if counters are not reported
+		summary *CaptureSummary
+	}
+)
+
+const (
+	// segments filling a gap within this time are reordered rather than retransmitted; same default as Wireshark
+	tcpAnalysisOutOfOrderThreshold = 3 * time.Millisecond
+	// fast retransmissions follow at least this many duplicate ACKs
+	tcpAnalysisFastRetransmissionACKs = 2
+	// zero windows advertised for longer than this are reported as stalls; i/e: backpressure from slow upstreams
+	tcpAnalysisStallThreshold = time.Second
+
+	tcpAnalysisFlowsLimit  = 65536
+	tcpAnalysisIdleTimeout = 2 * time.Minute
+)
+
+func newTCPAnalyzer(summary *CaptureSummary) *tcpAnalyzer {
+	return &tcpAnalyzer{
+		flows:   make(map[tcpAnalysisKey]*tcpAnalysisFlow),
+		summary: summary,
+	}
+}
+
+// seqAfter compares sequence numbers considering wrap around.
+func seqAfter(a, b uint32) bool {
+	return int32(a-b) > 0
+}
+
+func newTCPAnalysisKey(src, dst netip.AddrPort) (tcpAnalysisKey, int) {
+	if src.Compare(dst) > 0 {
+		return tcpAnalysisKey{dst, src}, 1
+	}
+	return tcpAnalysisKey{src, dst}, 0
+}
+
+// isRetransmission is safe to call on packets without analysis.
+func (a *tcpAnalysis) isRetransmission() bool {
+	return a != nil && (a.retransmission || a.fastRetransmission)
+}
+
+func (a *tcpAnalysis) isEmpty() bool {
+	return !a.retransmission && !a.fastRetransmission && !a.outOfOrder &&
+		!a.lostSegment && !a.keepAlive && !a.zeroWindow && !a.windowFull &&
+		a.dupACK == 0 && a.stall == 0
+}
+
+// update returns the duration of the stall ended by `window`, or zero if `window` does not end a stall.
+func (s *tcpWindowStall) update(window uint16, timestamp time.Time) time.Duration {
+	if window == 0 {
+		if s.since.IsZero() {
+			s.since = timestamp
+		}
+		return 0
+	}
+	if s.since.IsZero() {
+		return 0
+	}
+	stall := timestamp.Sub(s.since)
+	s.total += stall
+	s.since, s.reported = time.Time{}, false
+	return stall
+}
+
+// stalled returns the total time spent advertising zero windows, including the ongoing stall.
+func (s *tcpWindowStall) stalled(now time.Time) time.Duration {
+	if s.since.IsZero() {
+		return s.total
+	}
+	return s.total + now.Sub(s.since)
+}
+
+func tcpWindowScaleOf(tcp *layers.TCP) int8 {
+	for _, option := range tcp.Options {
+		if option.OptionType == layers.TCPOptionKindWindowScale && len(option.OptionData) == 1 {
+			// RFC 7323: shift counts greater than 14 are treated as 14
+			return int8(min(option.OptionData[0], 14))
+		}
+	}
+	return -1
+}
+
+// String produces labels as rendered by Wireshark; i/e: `TCP Dup ACK 10#2`.
+func (a *tcpAnalysis) String() string {
+	labels := make([]string, 0, 2)
+	switch {
+	case a.fastRetransmission:
+		labels = append(labels, "TCP Fast Retransmission")
+	case a.retransmission:
+		labels = append(labels, "TCP Retransmission")
+	case a.outOfOrder:
+		labels = append(labels, "TCP Out-Of-Order")
+	}
+	if a.lostSegment {
+		labels = append(labels, "TCP Previous segment not captured")
+	}
+	if a.keepAlive {
+		labels = append(labels, "TCP Keep-Alive")
+	}
+	if a.zeroWindow {
+		labels = append(labels, "TCP ZeroWindow")
+	}
+	if a.windowFull {
+		labels = append(labels, "TCP Window Full")
+	}
+	if a.stall > 0 && a.stallEnded {
+		labels = append(labels, "TCP Window Stall ended after "+a.stall.String())
+	} else if a.stall > 0 {
+		labels = append(labels, "TCP Window Stall for "+a.stall.String())
+	}
+	if a.dupACK > 0 {
+		labels = append(labels, "TCP Dup ACK "+
+			strconv.FormatUint(a.dupACKOf, 10)+"#"+strconv.FormatUint(uint64(a.dupACK), 10))
+	}
+	return strings.Join(labels, ", ")
+}
+
+// analyze returns a `nil` analysis if there is nothing remarkable about `packet`,
+// and a `nil` estimate if the RTT of its connection is not known yet.
+func (t *tcpAnalyzer) analyze(packet gopacket.Packet, serial uint64) (*tcpAnalysis, *tcpRTTEstimate, *tcpStateTransition) {
+	tcp, ok := packet.TransportLayer().(*layers.TCP)
+	if !ok || packet.NetworkLayer() == nil {
+		return nil, nil, nil
+	}
+	networkFlow := packet.NetworkLayer().NetworkFlow()
+	srcIP, _ := netip.AddrFromSlice(networkFlow.Src().Raw())
+	dstIP, _ := netip.AddrFromSlice(networkFlow.Dst().Raw())
+	key, direction := newTCPAnalysisKey(
+		netip.AddrPortFrom(srcIP.Unmap(), uint16(tcp.SrcPort)),
+		netip.AddrPortFrom(dstIP.Unmap(), uint16(tcp.DstPort)))
+
+	timestamp := packet.Metadata().Timestamp
+	flow, ok := t.flows[key]
+	// connections re-established using the same 5-tuple start with a new initial sequence number
+	if !ok || (tcp.SYN && !tcp.ACK && flow.directions[direction].nextSeq != tcp.Seq+1) {
+		if ok {
+			flow.forget(t.summary)
+		}
+		t.expire(timestamp)
+		flow = &tcpAnalysisFlow{key: key}
+		t.flows[key] = flow
+	}
+	flow.last = timestamp
+	transition := flow.transition(tcp, direction, t.summary)
+
+	if tcp.RST {
+		// connection is gone: retransmitted `RST`s are not analyzed
+		delete(t.flows, key)
+		t.attachStalled(packet, flow, timestamp)
+		return nil, flow.rtt.estimate(), transition
+	}
+	if tcp.FIN {
+		t.attachStalled(packet, flow, timestamp)
+	}
+
+	analysis := flow.analyze(tcp, direction, serial, timestamp)
+	flow.rtt.observe(direction, newTCPRTTSegment(tcp), timestamp)
+	if analysis.isEmpty() {
+		return nil, flow.rtt.estimate(), transition
+	}
+	return analysis, flow.rtt.estimate(), transition
+}
+
+// attachStalled attaches the total time the connection of `packet` was stalled, if any.
+func (t *tcpAnalyzer) attachStalled(packet gopacket.Packet, flow *tcpAnalysisFlow, timestamp time.Time) {
+	stalled := flow.directions[0].stall.stalled(timestamp) + flow.directions[1].stall.stalled(timestamp)
+	if stalled > 0 {
+		metadata := packet.Metadata()
+		metadata.AncillaryData = append(metadata.AncillaryData, tcpStalled(stalled))
+	}
+}
+
+// scaledWindow returns `false` if the scale of windows advertised by `sender` is not known.
+func (f *tcpAnalysisFlow) scaledWindow(sender, receiver *tcpAnalysisDirection, window uint16) (uint32, bool) {
+	if !sender.synSeen || !receiver.synSeen {
+		return 0, false
+	}
+	if sender.winScale < 0 || receiver.winScale < 0 {
+		return uint32(window), true
+	}
+	return uint32(window) << sender.winScale, true
+}
+
+// analyzeWindow flags zero windows, and segments filling the window advertised by the receiver;
+// it also tracks how long each endpoint stalls the connection by advertising zero windows.
+func (f *tcpAnalysisFlow) analyzeWindow(
+	tcp *layers.TCP,
+	direction int,
+	length uint32,
+	analysis *tcpAnalysis,
+	timestamp time.Time,
+) {
+	sender, receiver := &f.directions[direction], &f.directions[1-direction]
+
+	if tcp.SYN {
+		sender.synSeen = true
+		sender.winScale = tcpWindowScaleOf(tcp)
+	}
+
+	if length > 0 && !tcp.SYN && !tcp.FIN && receiver.acked {
+		if window, ok := f.scaledWindow(receiver, sender, receiver.lastWin); ok &&
+			window > 0 && tcp.Seq+length == receiver.lastACK+window {
+			analysis.windowFull = true
+		}
+	}
+
+	if tcp.ACK && !tcp.SYN && !tcp.FIN {
+		analysis.zeroWindow = tcp.Window == 0
+		if stall := sender.stall.update(tcp.Window, timestamp); stall >= tcpAnalysisStallThreshold {
+			analysis.stall, analysis.stallEnded = stall, true
+			analysis.stalledBy = f.endpoint(direction)
+		}
+	}
+
+	// stalls persisting beyond the threshold are reported once, by the 1st segment captured afterwards; i/e: zero window probes
+	for i := range f.directions {
+		stall := &f.directions[i].stall
+		if !stall.since.IsZero() && !stall.reported && timestamp.Sub(stall.since) >= tcpAnalysisStallThreshold {
+			stall.reported = true
+			analysis.stall, analysis.stallEnded = timestamp.Sub(stall.since), false
+			analysis.stalledBy = f.endpoint(i)
+		}
+	}
+}
+
+// endpoint returns the sender of segments flowing in `direction`.
+func (f *tcpAnalysisFlow) endpoint(direction int) netip.AddrPort {
+	if direction == 0 {
+		return f.key.a
+	}
+	return f.key.b
+}
+
+func (f *tcpAnalysisFlow) analyze(tcp *layers.TCP, direction int, serial uint64, timestamp time.Time) *tcpAnalysis {
+	analysis := &tcpAnalysis{}
+	sender, receiver := &f.directions[direction], &f.directions[1-direction]
+
+	// `SYN` and `FIN` consume 1 sequence number
+	length := uint32(len(tcp.Payload))
+	if tcp.SYN || tcp.FIN {
+		length += 1
+	}
+	seq, nextSeq := tcp.Seq, tcp.Seq+length
+
+	// segments carried before are retransmissions regardless of how long it took to retransmit them
+	original, retransmitted := uint64(0), false
+	if len(tcp.Payload) > 0 && !tcp.SYN && !tcp.FIN {
+		if f.segments == nil {
+			f.segments = newTCPSegments()
+		}
+		original, retransmitted = f.segments.track(tcpSegmentKey{uint16(tcp.SrcPort), seq, uint32(len(tcp.Payload))}, serial)
+	}
+
+	switch {
+	case !sender.seen:
+		sender.seen = true
+		sender.nextSeq, sender.nextSeqAt = nextSeq, timestamp
+
+	case length <= 1 && !tcp.SYN && !tcp.FIN && seq == sender.nextSeq-1:
+		// a single garbage byte, or no data at all, right before the next expected sequence number
+		analysis.keepAlive = true
+
+	case length > 0 && seqAfter(seq, sender.nextSeq):
+		analysis.lostSegment = true
+		sender.nextSeq, sender.nextSeqAt = nextSeq, timestamp
+
+	case length > 0 && seqAfter(sender.nextSeq, seq):
+		switch {
+		case receiver.dupACKs >= tcpAnalysisFastRetransmissionACKs && receiver.lastACK == seq:
+			analysis.fastRetransmission = true
+		case !retransmitted && timestamp.Sub(sender.nextSeqAt) < tcpAnalysisOutOfOrderThreshold:
+			analysis.outOfOrder = true
+		default:
+			analysis.retransmission = true
+		}
+		if analysis.isRetransmission() {
+			analysis.retransmissionOf = original
+		}
+		if seqAfter(nextSeq, sender.nextSeq) {
+			sender.nextSeq, sender.nextSeqAt = nextSeq, timestamp
+		}
+
+	case length > 0:
+		sender.nextSeq, sender.nextSeqAt = nextSeq, timestamp
+	}
+
+	f.analyzeWindow(tcp, direction, length, analysis, timestamp)
+
+	if !tcp.ACK {
+		return analysis
+	}
+
+	// duplicate ACKs do not carry data nor update the window, and acknowledge data which is not the last sent by the receiver;
+	// zero windows are not duplicate ACKs: they are repeated while the receiver stalls the connection
+	if sender.acked && length == 0 && !analysis.keepAlive && tcp.Window != 0 &&
+		tcp.Ack == sender.lastACK && tcp.Window == sender.lastWin &&
+		receiver.seen && seqAfter(receiver.nextSeq, tcp.Ack) {
+		sender.dupACKs++
+		analysis.dupACK, analysis.dupACKOf = sender.dupACKs, sender.lastACKOf
+		return analysis
+	}
+
+	if !sender.acked || tcp.Ack != sender.lastACK {
+		sender.dupACKs = 0
+		sender.lastACKOf = serial
+	}
+	sender.acked = true
+	sender.lastACK, sender.lastWin = tcp.Ack, tcp.Window
+
+	return analysis
+}
+
+// expire forgets idle connections when too many connections are being analyzed.
+func (t *tcpAnalyzer) expire(now time.Time) {
+	if len(t.flows) < tcpAnalysisFlowsLimit {
+		return
+	}
+	for key, flow := range t.flows {
+		if now.Sub(flow.last) >= tcpAnalysisIdleTimeout {
+			flow.forget(t.summary)
+			delete(t.flows, key)
+		}
+	}
+	if len(t.flows) >= tcpAnalysisFlowsLimit {
+		for _, flow := range t.flows {
+			flow.forget(t.summary)
+		}
+		clear(t.flows)
+	}
+}
+
+// observe attaches the analysis of `packet`, the RTT estimate and the state of its connection,
+// to its metadata so that they are available to translators.
+func (t *tcpAnalyzer) observe(packet gopacket.Packet, serial uint64) {
+	if t == nil {
+		return
+	}
+	analysis, rtt, transition := t.analyze(packet, serial)
+	metadata := packet.Metadata()
+	if transition != nil {
+		metadata.AncillaryData = append(metadata.AncillaryData, transition)
+	}
+	if analysis != nil {
+		metadata.AncillaryData = append(metadata.AncillaryData, analysis)
+	}
+	if rtt != nil {
+		metadata.AncillaryData = append(metadata.AncillaryData, rtt)
+	}
+}
+
+func tcpStalledOf(packet gopacket.Packet) time.Duration {
+	for _, data := range packet.Metadata().AncillaryData {
+		if stalled, ok := data.(tcpStalled); ok {
+			return time.Duration(stalled)
+		}
+	}
+	return 0
+}
+
+func tcpAnalysisOf(packet gopacket.Packet) *tcpAnalysis {
+	for _, data := range packet.Metadata().AncillaryData {
+		if analysis, ok := data.(*tcpAnalysis); ok {
+			return analysis
+		}
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+type tcpAnalysisTestConn struct {
+	t        *testing.T
+	analyzer *tcpAnalyzer
+	start    time.Time
+	serial   uint64
+	window   uint16
+	last     gopacket.Packet
+}
+
+// segment sends a segment from the client ( `fromClient` ) or from the server at `ms` milliseconds.
+func (c *tcpAnalysisTestConn) segment(ms int, fromClient bool, seq, ack uint32, payload string, flags string) *tcpAnalysis {
+	client, server := net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: client, DstIP: server}
+	tcp := &layers.TCP{SrcPort: 40000, DstPort: 443, Seq: seq, Ack: ack, Window: c.window}
+	if !fromClient {
+		ip.SrcIP, ip.DstIP = server, client
+		tcp.SrcPort, tcp.DstPort = 443, 40000
+	}
+	for _, flag := range flags {
+		switch flag {
+		case 'S':
+			tcp.SYN = true
+		case 'A':
+			tcp.ACK = true
+		case 'F':
+			tcp.FIN = true
+		case 'R':
+			tcp.RST = true
+		}
+	}
+	tcp.SetNetworkLayerForChecksum(ip)
+
+	buffer := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	assert.NoError(c.t, gopacket.SerializeLayers(buffer, opts, ip, tcp, gopacket.Payload(payload)))
+
+	packet := gopacket.NewPacket(buffer.Bytes(), layers.LayerTypeIPv4, gopacket.Default)
+	packet.Metadata().Timestamp = c.start.Add(time.Duration(ms) * time.Millisecond)
+
+	c.serial++
+	c.analyzer.observe(packet, c.serial)
+	c.last = packet
+	return tcpAnalysisOf(packet)
+}
+
+func newTCPAnalysisTestConn(t *testing.T) *tcpAnalysisTestConn {
+	c := &tcpAnalysisTestConn{t: t, analyzer: newTCPAnalyzer(nil), start: time.Unix(1700000000, 0), window: 1024}
+	assert.Nil(t, c.segment(0, true, 1000, 0, "", "S"))
+	assert.Nil(t, c.segment(10, false, 5000, 1001, "", "SA"))
+	assert.Nil(t, c.segment(11, true, 1001, 5001, "", "A"))
+	return c
+}
+
+func TestTCPAnalysisRetransmission(t *testing.T) {
+	t.Parallel()
+
+	c := newTCPAnalysisTestConn(t)
+	assert.Nil(t, c.segment(20, true, 1001, 5001, "hello", "A"))
+
+	analysis := c.segment(300, true, 1001, 5001, "hello", "A")
+	if assert.NotNil(t, analysis) {
+		assert.True(t, analysis.retransmission)
+		assert.Equal(t, uint64(4), analysis.retransmissionOf)
+		assert.Equal(t, "TCP Retransmission", analysis.String())
+	}
+}
+
+// TestTCPAnalysisRetransmissionTracking verifies that segments carried before are retransmissions even if they are
+// retransmitted right away, and that retransmitted bytes segmented differently do not reference any packet.
+func TestTCPAnalysisRetransmissionTracking(t *testing.T) {
+	t.Parallel()
+
+	c := newTCPAnalysisTestConn(t)
+	assert.Nil(t, c.segment(20, true, 1001, 5001, "hello", "A"))
+
+	analysis := c.segment(21, true, 1001, 5001, "hello", "A")
+	if assert.NotNil(t, analysis) {
+		assert.True(t, analysis.retransmission)
+		assert.False(t, analysis.outOfOrder)
+		assert.Equal(t, uint64(4), analysis.retransmissionOf)
+	}
+
+	analysis = c.segment(300, true, 1001, 5001, "hel", "A")
+	if assert.NotNil(t, analysis) {
+		assert.True(t, analysis.retransmission)
+		assert.Zero(t, analysis.retransmissionOf)
+	}
+}
+
+func TestTCPAnalysisLostAndOutOfOrder(t *testing.T) {
+	t.Parallel()
+
+	c := newTCPAnalysisTestConn(t)
+	// 1006 is sent before 1001
+	analysis := c.segment(20, true, 1006, 5001, "world", "A")
+	if assert.NotNil(t, analysis) {
+		assert.True(t, analysis.lostSegment)
+	}
+
+	analysis = c.segment(21, true, 1001, 5001, "hello", "A")
+	if assert.NotNil(t, analysis) {
+		assert.True(t, analysis.outOfOrder)
+		assert.False(t, analysis.retransmission)
+	}
+}
+
+func TestTCPAnalysisDupACKsAndFastRetransmission(t *testing.T) {
+	t.Parallel()
+
+	c := newTCPAnalysisTestConn(t)
+	assert.Nil(t, c.segment(20, true, 1001, 5001, "aaaaa", "A"))
+	assert.Nil(t, c.segment(21, true, 1006, 5001, "bbbbb", "A"))
+	assert.Nil(t, c.segment(22, true, 1011, 5001, "ccccc", "A"))
+
+	// `aaaaa` is lost: the server keeps acknowledging 1001, which was 1st acknowledged by the `SYN+ACK` ( serial #2 )
+	for i, num := range []uint32{1, 2, 3} {
+		analysis := c.segment(30+i, false, 5001, 1001, "", "A")
+		if assert.NotNil(t, analysis) {
+			assert.Equal(t, num, analysis.dupACK)
+			assert.Equal(t, uint64(2), analysis.dupACKOf)
+		}
+	}
+	assert.Equal(t, "TCP Dup ACK 2#3", (&tcpAnalysis{dupACK: 3, dupACKOf: 2}).String())
+
+	analysis := c.segment(40, true, 1001, 5001, "aaaaa", "A")
+	if assert.NotNil(t, analysis) {
+		assert.True(t, analysis.fastRetransmission)
+		assert.Equal(t, "TCP Fast Retransmission", analysis.String())
+	}
+
+	// the streak ends when new data is acknowledged
+	assert.Nil(t, c.segment(50, false, 5001, 1016, "", "A"))
+}
+
+func TestTCPAnalysisKeepAlive(t *testing.T) {
+	t.Parallel()
+
+	c := newTCPAnalysisTestConn(t)
+	analysis := c.segment(60000, true, 1000, 5001, "", "A")
+	if assert.NotNil(t, analysis) {
+		assert.True(t, analysis.keepAlive)
+		assert.Zero(t, analysis.dupACK)
+	}
+}
+
+// TestTCPAnalysisNewConnection verifies that a new connection reusing the same 5-tuple does not inherit state.
+func TestTCPAnalysisNewConnection(t *testing.T) {
+	t.Parallel()
+
+	c := newTCPAnalysisTestConn(t)
+	assert.Nil(t, c.segment(20, true, 1001, 5001, "", "R"))
+	assert.Nil(t, c.segment(1000, true, 90000, 0, "", "S"))
+	assert.Nil(t, c.segment(1010, false, 70000, 90001, "", "SA"))
+
+	// retransmitted SYN of the new connection
+	analysis := c.segment(2000, true, 90000, 0, "", "S")
+	if assert.NotNil(t, analysis) {
+		assert.True(t, analysis.retransmission)
+	}
+}
+
+func TestTCPAnalysisWindowFull(t *testing.T) {
+	t.Parallel()
+
+	c := newTCPAnalysisTestConn(t)
+	c.window = 10
+	assert.Nil(t, c.segment(20, false, 5001, 1001, "", "A"))
+
+	analysis := c.segment(21, true, 1001, 5001, "0123456789", "A")
+	if assert.NotNil(t, analysis) {
+		assert.True(t, analysis.windowFull)
+		assert.Equal(t, "TCP Window Full", analysis.String())
+	}
+}
+
+// TestTCPAnalysisZeroWindowStall verifies that stalls are reported once while they persist, once when they end,
+// and that their total duration is attached to the segment ending the connection.
+func TestTCPAnalysisZeroWindowStall(t *testing.T) {
+	t.Parallel()
+
+	c := newTCPAnalysisTestConn(t)
+	assert.Nil(t, c.segment(20, true, 1001, 5001, "hello", "A"))
+
+	c.window = 0
+	analysis := c.segment(30, false, 5001, 1006, "", "A")
+	if assert.NotNil(t, analysis) {
+		assert.True(t, analysis.zeroWindow)
+		assert.Zero(t, analysis.dupACK)
+		assert.Equal(t, "TCP ZeroWindow", analysis.String())
+	}
+
+	// zero window probe
+	c.window = 1024
+	analysis = c.segment(1530, true, 1006, 5001, "w", "A")
+	if assert.NotNil(t, analysis) {
+		assert.Equal(t, 1500*time.Millisecond, analysis.stall)
+		assert.False(t, analysis.stallEnded)
+		assert.Equal(t, "10.0.0.2:443", analysis.stalledBy.String())
+	}
+
+	analysis = c.segment(2030, false, 5001, 1007, "", "A")
+	if assert.NotNil(t, analysis) {
+		assert.Equal(t, 2*time.Second, analysis.stall)
+		assert.True(t, analysis.stallEnded)
+		assert.Equal(t, "TCP Window Stall ended after 2s", analysis.String())
+	}
+
+	c.segment(2040, true, 1007, 5001, "", "FA")
+	assert.Equal(t, 2*time.Second, tcpStalledOf(c.last))
+}
@@ -0,0 +1,436 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+type (
+	// tcpReassembly is how the payload of a segment must be decoded by L7 translators:
+	//   - `data` contains complete messages which started in previous segments, followed by the payload of the segment,
+	//   - if `data` is `nil` the segment carries no complete message: its bytes are decoded along with a later segment.
+	tcpReassembly struct {
+		data []byte
+		// sequence number of the first byte of `data`
+		seq uint32
+		// segments carrying `data`
+		segments int
+		// the segment ends with a message which continues in subsequent segments
+		pending bool
+		// the segment only carries bytes which were already reassembled
+		retransmission bool
+	}
+
+	// tcpStreamFramer returns how many leading bytes of `data` are complete messages;
+	// remaining bytes are the beginning of a message which continues in subsequent segments.
+	// It returns `false` if `data` is not framed by its protocol.
+	tcpStreamFramer func(data []byte) (int, bool)
+
+	// tcpReassemblyStream is 1 direction of a connection: bytes sent by 1 of its endpoints.
+	tcpReassemblyStream struct {
+		seen    bool
+		nextSeq uint32
+		// beginning of a message which continues in subsequent segments, and how many segments carried it
+		pending  []byte
+		segments int
+		// segments received ahead of `nextSeq`
+		outOfOrder      map[uint32][]byte
+		outOfOrderBytes int
+	}
+
+	tcpReassemblyFlow struct {
+		streams [2]tcpReassemblyStream
+		framer  tcpStreamFramer
+		// framers of protocols identified by their port are not replaced by detected ones
+		fixed bool
+		last  time.Time
+	}
+
+	// tcpReassembler must observe packets sequentially in capture order: it is not thread-safe.
+	tcpReassembler struct {
+		flows map[tcpAnalysisKey]*tcpReassemblyFlow
+		dbs   *dbPorts
+	}
+)
+
+const (
+	// messages larger than this are not reassembled: their segments are decoded on their own
+	tcpReassemblyLimit = 64 * 1024
+	// segments received ahead of a gap larger than this are dropped, and the stream is resynchronized
+	tcpReassemblyOutOfOrderLimit = 64
+
+	tcpReassemblyFlowsLimit  = 65536
+	tcpReassemblyIdleTimeout = 2 * time.Minute
+
+	http2FrameHeaderLen = 9
+	http2FrameTypeMax   = 0x09
+)
+
+func newTCPReassembler(dbs *dbPorts) *tcpReassembler {
+	return &tcpReassembler{
+		flows: make(map[tcpAnalysisKey]*tcpReassemblyFlow),
+		dbs:   dbs,
+	}
+}
+
+// http11Framer only reassembles the request or status line and headers of HTTP/1.1 messages:
+// bodies are decoded from the segments that carry them.
+func http11Framer(data []byte) (int, bool) {
+	if !http11RequestPayloadRegex.Match(data) && !http11ResponsePayloadRegex.Match(data) {
+		return 0, false
+	}
+	if bytes.Contains(data, http11BodySeparator) {
+		return len(data), true
+	}
+	return 0, true
+}
+
+func http2Framer(data []byte) (int, bool) {
+	offset := 0
+	if preface := http2PrefaceRegex.FindIndex(data); preface != nil {
+		offset = preface[1]
+	}
+	for len(data)-offset >= http2FrameHeaderLen {
+		length := int(data[offset])<<16 | int(data[offset+1])<<8 | int(data[offset+2])
+		if data[offset+3] > http2FrameTypeMax || http2FrameHeaderLen+length > tcpReassemblyLimit {
+			return 0, false
+		}
+		if offset+http2FrameHeaderLen+length > len(data) {
+			break
+		}
+		offset += http2FrameHeaderLen + length
+	}
+	return offset, true
+}
+
+// see: https://www.postgresql.org/docs/current/protocol-overview.html#PROTOCOL-MESSAGE-CONCEPTS
+func postgresFramer(data []byte) (int, bool) {
+	if isDBTLSRecord(data) {
+		return 0, false
+	}
+	// response to `SSLRequest` and `GSSENCRequest`
+	if len(data) == 1 && (data[0] == 'S' || data[0] == 'N' || data[0] == 'G') {
+		return 1, true
+	}
+	offset := 0
+	for offset < len(data) {
+		message := data[offset:]
+		size := 0
+		if message[0] == 0 {
+			// startup messages are not typed
+			if len(message) < 4 {
+				break
+			}
+			size = int(binary.BigEndian.Uint32(message))
+			if size < 8 {
+				return 0, false
+			}
+		} else {
+			_, isFrontend := postgresFrontendMessages[message[0]]
+			_, isBackend := postgresBackendMessages[message[0]]
+			if !isFrontend && !isBackend {
+				return 0, false
+			}
+			if len(message) < 5 {
+				break
+			}
+			length := int(binary.BigEndian.Uint32(message[1:]))
+			if length < 4 {
+				return 0, false
+			}
+			size = 1 + length
+		}
+		if size > tcpReassemblyLimit {
+			return 0, false
+		}
+		if size > len(message) {
+			break
+		}
+		offset += size
+	}
+	return offset, true
+}
+
+// see: https://dev.mysql.com/doc/dev/mysql-server/latest/page_protocol_basic_packets.html
+func mysqlFramer(data []byte) (int, bool) {
+	if isDBTLSRecord(data) {
+		return 0, false
+	}
+	offset := 0
+	for len(data)-offset >= mysqlHeaderLen {
+		message := data[offset:]
+		size := mysqlHeaderLen + (int(message[0]) | int(message[1])<<8 | int(message[2])<<16)
+		if size > tcpReassemblyLimit {
+			return 0, false
+		}
+		if size > len(message) {
+			break
+		}
+		offset += size
+	}
+	return offset, true
+}
+
+func (r *tcpReassembler) newFlow(srcPort, dstPort uint16) *tcpReassemblyFlow {
+	flow := &tcpReassemblyFlow{}
+	if r.dbs == nil {
+		return flow
+	}
+	if protocol, _, ok := r.dbs.lookup(srcPort, dstPort); ok {
+		switch protocol {
+		case dbProtocolPostgres:
+			flow.framer, flow.fixed = postgresFramer, true
+		case dbProtocolMySQL:
+			flow.framer, flow.fixed = mysqlFramer, true
+		}
+	}
+	return flow
+}
+
+// frame detects the protocol of the flow out of the 1st bytes of its messages;
+// HTTP/1.1 connections may be upgraded, so other protocols are detected when framing fails.
+func (f *tcpReassemblyFlow) frame(data []byte) (int, bool) {
+	offset := 0
+	// PROXY protocol header is sent ahead of the 1st message
+	if isProxyProtocol(data) {
+		_, size, err := parseProxyProtocolHeader(data)
+		if err != nil {
+			return 0, false
+		}
+		offset = size
+	}
+	message := data[offset:]
+
+	if f.framer != nil {
+		if complete, ok := f.framer(message); ok || f.fixed {
+			return offset + complete, ok
+		}
+	}
+
+	switch {
+	case http2PrefaceRegex.Match(message):
+		f.framer = http2Framer
+	case http11RequestPayloadRegex.Match(message) || http11ResponsePayloadRegex.Match(message):
+		f.framer = http11Framer
+	default:
+		f.framer = nil
+		return 0, false
+	}
+	complete, ok := f.framer(message)
+	return offset + complete, ok
+}
+
+func (s *tcpReassemblyStream) reset() {
+	s.pending, s.segments = nil, 0
+	s.outOfOrder, s.outOfOrderBytes = nil, 0
+}
+
+// drain appends segments received ahead of `nextSeq` which are now contiguous; it returns how many were appended.
+func (s *tcpReassemblyStream) drain(data []byte) ([]byte, int) {
+	drained := 0
+	for progressed := true; progressed && len(s.outOfOrder) > 0; {
+		progressed = false
+		for seq, payload := range s.outOfOrder {
+			if seqAfter(seq, s.nextSeq) {
+				continue
+			}
+			delete(s.outOfOrder, seq)
+			s.outOfOrderBytes -= len(payload)
+			if overlap := int(s.nextSeq - seq); overlap < len(payload) {
+				data = append(slices.Clip(data), payload[overlap:]...)
+				s.nextSeq += uint32(len(payload) - overlap)
+				drained++
+				progressed = true
+			}
+		}
+	}
+	return data, drained
+}
+
+func (r *tcpReassembler) reassemble(packet gopacket.Packet) *tcpReassembly {
+	tcp, ok := packet.TransportLayer().(*layers.TCP)
+	if !ok || packet.NetworkLayer() == nil {
+		return nil
+	}
+	networkFlow := packet.NetworkLayer().NetworkFlow()
+	srcIP, _ := netip.AddrFromSlice(networkFlow.Src().Raw())
+	dstIP, _ := netip.AddrFromSlice(networkFlow.Dst().Raw())
+	key, direction := newTCPAnalysisKey(
+		netip.AddrPortFrom(srcIP.Unmap(), uint16(tcp.SrcPort)),
+		netip.AddrPortFrom(dstIP.Unmap(), uint16(tcp.DstPort)))
+
+	timestamp := packet.Metadata().Timestamp
+	flow, ok := r.flows[key]
+	if tcp.RST {
+		delete(r.flows, key)
+		return nil
+	}
+	if !ok || (tcp.SYN && !tcp.ACK) {
+		r.expire(timestamp)
+		flow = r.newFlow(uint16(tcp.SrcPort), uint16(tcp.DstPort))
+		r.flows[key] = flow
+	}
+	flow.last = timestamp
+
+	stream := &flow.streams[direction]
+	if tcp.SYN {
+		stream.seen, stream.nextSeq = true, tcp.Seq+1
+		stream.reset()
+		return nil
+	}
+
+	payload := tcp.Payload
+	if len(payload) == 0 {
+		return nil
+	}
+
+	// bytes missing from truncated packets cannot be reassembled
+	captureInfo := packet.Metadata().CaptureInfo
+	if packet.Metadata().Truncated || captureInfo.CaptureLength < captureInfo.Length {
+		stream.seen = false
+		stream.reset()
+		return nil
+	}
+
+	// connections already established when the capture started are reassembled from their 1st captured segment
+	if !stream.seen {
+		stream.seen, stream.nextSeq = true, tcp.Seq
+	}
+
+	if gap := int32(tcp.Seq - stream.nextSeq); gap > 0 {
+		// segments of flows not carrying framed protocols are decoded on their own
+		if flow.framer != nil && stream.hold(tcp.Seq, payload) {
+			return &tcpReassembly{pending: true}
+		}
+		// the gap is not going to be filled: resynchronize at this segment
+		stream.reset()
+		stream.nextSeq = tcp.Seq
+	} else if gap < 0 {
+		overlap := int(-gap)
+		if overlap >= len(payload) {
+			// bytes were already reassembled: whether they were retransmitted is told by the TCP analysis of the segment
+			if flow.framer != nil {
+				return &tcpReassembly{retransmission: tcpAnalysisOf(packet).isRetransmission()}
+			}
+			return nil
+		}
+		payload = payload[overlap:]
+	}
+	buffered := len(stream.pending)
+	// buffered bytes precede the payload
+	start := stream.nextSeq - uint32(buffered)
+	stream.nextSeq += uint32(len(payload))
+
+	data, drained := stream.drain(payload)
+	segments := stream.segments + 1 + drained
+
+	buffer := append(slices.Clip(stream.pending), data...)
+	complete, ok := flow.frame(buffer)
+	if !ok {
+		// not a framed protocol, or framing was lost: segments are decoded on their own
+		stream.pending, stream.segments = nil, 0
+		return nil
+	}
+
+	reassembly := &tcpReassembly{
+		seq:      start,
+		segments: segments,
+	}
+	if complete < len(buffer) {
+		rest := buffer[complete:]
+		if len(rest) > tcpReassemblyLimit {
+			stream.pending, stream.segments = nil, 0
+			return nil
+		}
+		reassembly.pending = true
+		stream.pending = bytes.Clone(rest)
+		if complete == 0 {
+			stream.segments = segments
+		} else {
+			stream.segments = 1
+		}
+	} else {
+		stream.pending, stream.segments = nil, 0
+	}
+
+	if complete > 0 {
+		// messages fully contained by the segment are decoded out of its own payload
+		if buffered == 0 && drained == 0 && !reassembly.pending {
+			return nil
+		}
+		reassembly.data = buffer[:complete]
+	}
+	return reassembly
+}
+
+// hold keeps a segment received ahead of a gap until the gap is filled, so that it is decoded along with
+// the segment filling the gap; it returns `false` if too many bytes are already waiting for the gap to be filled.
+func (s *tcpReassemblyStream) hold(seq uint32, payload []byte) bool {
+	if len(s.outOfOrder) >= tcpReassemblyOutOfOrderLimit ||
+		s.outOfOrderBytes+len(payload) > tcpReassemblyLimit {
+		return false
+	}
+	if s.outOfOrder == nil {
+		s.outOfOrder = make(map[uint32][]byte)
+	}
+	if _, ok := s.outOfOrder[seq]; !ok {
+		s.outOfOrder[seq] = bytes.Clone(payload)
+		s.outOfOrderBytes += len(payload)
+	}
+	return true
+}
+
+// expire forgets idle connections when too many connections are being reassembled.
+func (r *tcpReassembler) expire(now time.Time) {
+	if len(r.flows) < tcpReassemblyFlowsLimit {
+		return
+	}
+	for key, flow := range r.flows {
+		if now.Sub(flow.last) >= tcpReassemblyIdleTimeout {
+			delete(r.flows, key)
+		}
+	}
+	if len(r.flows) >= tcpReassemblyFlowsLimit {
+		clear(r.flows)
+	}
+}
+
+// observe attaches the reassembled payload of `packet` to its metadata so that it is available to translators.
+func (r *tcpReassembler) observe(packet gopacket.Packet) {
+	if r == nil {
+		return
+	}
+	if reassembly := r.reassemble(packet); reassembly != nil {
+		metadata := packet.Metadata()
+		metadata.AncillaryData = append(metadata.AncillaryData, reassembly)
+	}
+}
+
+func tcpReassemblyOf(packet gopacket.Packet) *tcpReassembly {
+	for _, data := range packet.Metadata().AncillaryData {
+		if reassembly, ok := data.(*tcpReassembly); ok {
+			return reassembly
+		}
+	}
+	return nil
+}
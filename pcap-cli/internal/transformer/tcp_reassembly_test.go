@@ -0,0 +1,185 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+type tcpReassemblyTestConn struct {
+	t           *testing.T
+	analyzer    *tcpAnalyzer
+	reassembler *tcpReassembler
+	port        layers.TCPPort
+	start       time.Time
+	serial      uint64
+}
+
+func (c *tcpReassemblyTestConn) segment(fromClient bool, seq uint32, payload []byte, flags string) *tcpReassembly {
+	client, server := net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: client, DstIP: server}
+	tcp := &layers.TCP{SrcPort: 40000, DstPort: c.port, Seq: seq, Window: 1024}
+	if !fromClient {
+		ip.SrcIP, ip.DstIP = server, client
+		tcp.SrcPort, tcp.DstPort = c.port, 40000
+	}
+	for _, flag := range flags {
+		switch flag {
+		case 'S':
+			tcp.SYN = true
+		case 'R':
+			tcp.RST = true
+		}
+	}
+	tcp.ACK = !tcp.SYN || !fromClient
+	tcp.SetNetworkLayerForChecksum(ip)
+
+	buffer := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	assert.NoError(c.t, gopacket.SerializeLayers(buffer, opts, ip, tcp, gopacket.Payload(payload)))
+
+	packet := gopacket.NewPacket(buffer.Bytes(), layers.LayerTypeIPv4, gopacket.Default)
+	packet.Metadata().Timestamp = c.start
+
+	// the same as transformers: retransmissions are detected by the TCP analysis before reassembling
+	c.serial++
+	c.analyzer.observe(packet, c.serial)
+	c.reassembler.observe(packet)
+	return tcpReassemblyOf(packet)
+}
+
+func newTCPReassemblyTestConn(t *testing.T, port layers.TCPPort, dbs *dbPorts) *tcpReassemblyTestConn {
+	c := &tcpReassemblyTestConn{
+		t: t, analyzer: newTCPAnalyzer(nil), reassembler: newTCPReassembler(dbs),
+		port: port, start: time.Unix(1700000000, 0),
+	}
+	assert.Nil(t, c.segment(true, 1000, nil, "S"))
+	assert.Nil(t, c.segment(false, 5000, nil, "S"))
+	return c
+}
+
+const (
+	tcpReassemblyTestHead  = "GET /orders HTTP/1.1\r\nHost: orders\r\n"
+	tcpReassemblyTestTrace = "traceparent: 00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01\r\n"
+	tcpReassemblyTestEnd   = "\r\n"
+)
+
+func TestTCPReassemblyHTTPRequestAcrossSegments(t *testing.T) {
+	t.Parallel()
+
+	c := newTCPReassemblyTestConn(t, 8080, nil)
+
+	// requests fully contained by a segment are decoded out of its own payload
+	request := tcpReassemblyTestHead + tcpReassemblyTestTrace + tcpReassemblyTestEnd
+	assert.Nil(t, c.segment(true, 1001, []byte(request), ""))
+
+	seq := uint32(1001 + len(request))
+	reassembly := c.segment(true, seq, []byte(tcpReassemblyTestHead), "")
+	if assert.NotNil(t, reassembly) {
+		assert.True(t, reassembly.pending)
+		assert.Nil(t, reassembly.data)
+	}
+
+	seq += uint32(len(tcpReassemblyTestHead))
+	reassembly = c.segment(true, seq, []byte(tcpReassemblyTestTrace+tcpReassemblyTestEnd), "")
+	if assert.NotNil(t, reassembly) {
+		assert.False(t, reassembly.pending)
+		assert.Equal(t, 2, reassembly.segments)
+		assert.Equal(t, request, string(reassembly.data))
+		// reassembled messages begin in the segment which carried their first byte
+		assert.Equal(t, uint32(1001+len(request)), reassembly.seq)
+	}
+}
+
+func TestTCPReassemblyOutOfOrderAndRetransmission(t *testing.T) {
+	t.Parallel()
+
+	c := newTCPReassemblyTestConn(t, 8080, nil)
+
+	head := uint32(1001)
+	trace := head + uint32(len(tcpReassemblyTestHead))
+	end := trace + uint32(len(tcpReassemblyTestTrace))
+
+	assert.True(t, c.segment(true, head, []byte(tcpReassemblyTestHead), "").pending)
+	// retransmitted bytes are not decoded again
+	assert.True(t, c.segment(true, head, []byte(tcpReassemblyTestHead), "").retransmission)
+	// the last segment is captured before the one filling the gap
+	assert.True(t, c.segment(true, end, []byte(tcpReassemblyTestEnd), "").pending)
+
+	// overlapping bytes are only reassembled once
+	reassembly := c.segment(true, trace-4, []byte(tcpReassemblyTestHead[len(tcpReassemblyTestHead)-4:]+tcpReassemblyTestTrace), "")
+	if assert.NotNil(t, reassembly) {
+		assert.False(t, reassembly.pending)
+		assert.Equal(t, 3, reassembly.segments)
+		assert.Equal(t, tcpReassemblyTestHead+tcpReassemblyTestTrace+tcpReassemblyTestEnd, string(reassembly.data))
+		assert.Equal(t, head, reassembly.seq)
+	}
+}
+
+func TestTCPReassemblyHTTP2Frames(t *testing.T) {
+	t.Parallel()
+
+	c := newTCPReassemblyTestConn(t, 8080, nil)
+
+	frame := make([]byte, http2FrameHeaderLen+16)
+	frame[2] = 16   // length
+	frame[3] = 0x01 // HEADERS
+	frame[8] = 1    // stream ID
+
+	preface := []byte("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n")
+	data := append(append(preface, frame...), frame[:5]...)
+
+	// the preface and the 1st frame are complete, the 2nd frame continues in the next segment
+	reassembly := c.segment(true, 1001, data, "")
+	if assert.NotNil(t, reassembly) {
+		assert.True(t, reassembly.pending)
+		assert.Equal(t, len(preface)+len(frame), len(reassembly.data))
+	}
+
+	reassembly = c.segment(true, 1001+uint32(len(data)), frame[5:], "")
+	if assert.NotNil(t, reassembly) {
+		assert.False(t, reassembly.pending)
+		assert.Equal(t, frame, reassembly.data)
+	}
+}
+
+func TestTCPReassemblyPostgresMessages(t *testing.T) {
+	t.Parallel()
+
+	c := newTCPReassemblyTestConn(t, 5432, newDBPorts([]string{"postgres:5432"}, false))
+
+	query := []byte("SELECT * FROM orders WHERE id = 1\x00")
+	message := make([]byte, 5, 5+len(query))
+	message[0] = 'Q'
+	binary.BigEndian.PutUint32(message[1:], uint32(4+len(query)))
+	message = append(message, query...)
+
+	assert.True(t, c.segment(true, 1001, message[:10], "").pending)
+
+	reassembly := c.segment(true, 1011, message[10:], "")
+	if assert.NotNil(t, reassembly) {
+		assert.Equal(t, message, reassembly.data)
+	}
+
+	// TLS is not reassembled
+	assert.Nil(t, c.segment(false, 5001, []byte{0x16, 0x03, 0x03, 0x00, 0x10}, ""))
+}
@@ -0,0 +1,158 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+type (
+	// tcpRTTEstimate is the round trip time of a connection when a segment was captured.
+	tcpRTTEstimate struct {
+		// from the `SYN` to the `ACK` completing the handshake; zero if the handshake was not observed
+		handshake time.Duration
+		// sum of the smoothed time each endpoint takes to respond to the other, as seen from the capture point
+		smoothed time.Duration
+	}
+
+	// tcpRTTSegment holds the fields of a TCP segment which are relevant to RTT estimation.
+	tcpRTTSegment struct {
+		seq, ack     uint32
+		length       uint32
+		syn, hasACK  bool
+		fin          bool
+		hasTS        bool
+		tsval, tsecr uint32
+	}
+
+	// tcpRTTTimer times 1 segment at a time sent by 1 endpoint;
+	// the sample completes when the other endpoint acknowledges the segment, or echoes its timestamp ( TSval ).
+	tcpRTTTimer struct {
+		timing  bool
+		end     uint32
+		tsval   uint32
+		hasTS   bool
+		at      time.Time
+		nextSeq uint32
+		sent    bool
+		samples uint32
+		srtt    time.Duration
+	}
+
+	// tcpRTT estimates the RTT of 1 connection; it must observe segments in capture order.
+	tcpRTT struct {
+		timers       [2]tcpRTTTimer
+		syn          time.Time
+		synDirection int
+		synACKed     bool
+		handshake    time.Duration
+	}
+)
+
+func newTCPRTTSegment(tcp *layers.TCP) *tcpRTTSegment {
+	segment := &tcpRTTSegment{
+		seq:    tcp.Seq,
+		ack:    tcp.Ack,
+		length: uint32(len(tcp.Payload)),
+		syn:    tcp.SYN,
+		hasACK: tcp.ACK,
+		fin:    tcp.FIN,
+	}
+	for _, option := range tcp.Options {
+		if option.OptionType == layers.TCPOptionKindTimestamps && len(option.OptionData) == 8 {
+			segment.hasTS = true
+			segment.tsval = binary.BigEndian.Uint32(option.OptionData[:4])
+			segment.tsecr = binary.BigEndian.Uint32(option.OptionData[4:])
+		}
+	}
+	return segment
+}
+
+// sample updates the smoothed RTT as described by RFC 6298: `SRTT <- 7/8 * SRTT + 1/8 * R'`.
+func (t *tcpRTTTimer) sample(rtt time.Duration) {
+	t.timing = false
+	if t.samples == 0 {
+		t.srtt = rtt
+	} else {
+		t.srtt += (rtt - t.srtt) / 8
+	}
+	t.samples++
+}
+
+// observe must be called with the `direction` in which `segment` was sent: `0` or `1`.
+func (r *tcpRTT) observe(direction int, segment *tcpRTTSegment, timestamp time.Time) {
+	sender, receiver := &r.timers[direction], &r.timers[1-direction]
+
+	if segment.syn && !segment.hasACK && r.syn.IsZero() {
+		r.syn, r.synDirection = timestamp, direction
+	}
+	if segment.syn && segment.hasACK && direction != r.synDirection && !r.syn.IsZero() {
+		r.synACKed = true
+	}
+	if r.synACKed && r.handshake == 0 && !segment.syn && segment.hasACK && direction == r.synDirection {
+		r.handshake = timestamp.Sub(r.syn)
+	}
+
+	if receiver.timing && segment.hasACK &&
+		(!seqAfter(receiver.end, segment.ack) ||
+			(receiver.hasTS && segment.hasTS && !seqAfter(receiver.tsval, segment.tsecr))) {
+		receiver.sample(timestamp.Sub(receiver.at))
+	}
+
+	// `SYN` and `FIN` consume 1 sequence number
+	length := segment.length
+	if segment.syn || segment.fin {
+		length += 1
+	}
+	if length == 0 {
+		return
+	}
+
+	end := segment.seq + length
+	if sender.sent && !seqAfter(end, sender.nextSeq) {
+		// Karn's algorithm: acknowledgements of retransmitted segments are ambiguous
+		sender.timing = false
+		return
+	}
+	sender.sent, sender.nextSeq = true, end
+	if !sender.timing {
+		sender.timing, sender.at = true, timestamp
+		sender.end, sender.tsval, sender.hasTS = end, segment.tsval, segment.hasTS
+	}
+}
+
+// estimate returns `nil` until the handshake is completed or the RTT is sampled.
+func (r *tcpRTT) estimate() *tcpRTTEstimate {
+	if r.handshake == 0 && r.timers[0].samples == 0 && r.timers[1].samples == 0 {
+		return nil
+	}
+	return &tcpRTTEstimate{
+		handshake: r.handshake,
+		smoothed:  r.timers[0].srtt + r.timers[1].srtt,
+	}
+}
+
+func tcpRTTOf(packet gopacket.Packet) *tcpRTTEstimate {
+	for _, data := range packet.Metadata().AncillaryData {
+		if estimate, ok := data.(*tcpRTTEstimate); ok {
+			return estimate
+		}
+	}
+	return nil
+}
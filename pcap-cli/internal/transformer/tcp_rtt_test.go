@@ -0,0 +1,78 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestTCPRTT verifies the handshake RTT, that samples are smoothed, and that retransmitted segments are not sampled.
+func TestTCPRTT(t *testing.T) {
+	t.Parallel()
+
+	start := time.Unix(1700000000, 0)
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+
+	rtt := &tcpRTT{}
+	rtt.observe(0, &tcpRTTSegment{seq: 1000, syn: true}, at(0))
+	assert.Nil(t, rtt.estimate())
+
+	rtt.observe(1, &tcpRTTSegment{seq: 5000, ack: 1001, syn: true, hasACK: true}, at(10))
+	rtt.observe(0, &tcpRTTSegment{seq: 1001, ack: 5001, hasACK: true}, at(12))
+	if estimate := rtt.estimate(); assert.NotNil(t, estimate) {
+		assert.Equal(t, 12*time.Millisecond, estimate.handshake)
+		assert.Equal(t, 12*time.Millisecond, estimate.smoothed)
+	}
+
+	// request acknowledged by the response after 18ms: the server takes 10ms + ( 18ms - 10ms ) / 8, and the client 2ms
+	rtt.observe(0, &tcpRTTSegment{seq: 1001, ack: 5001, length: 100, hasACK: true}, at(20))
+	rtt.observe(1, &tcpRTTSegment{seq: 5001, ack: 1101, length: 100, hasACK: true}, at(38))
+	assert.Equal(t, 13*time.Millisecond, rtt.estimate().smoothed)
+
+	// Karn's algorithm: the retransmitted response is acknowledged after 1ms, which must not be sampled
+	rtt.observe(1, &tcpRTTSegment{seq: 5001, ack: 1101, length: 100, hasACK: true}, at(300))
+	rtt.observe(0, &tcpRTTSegment{seq: 1101, ack: 5101, hasACK: true}, at(301))
+	assert.Equal(t, 13*time.Millisecond, rtt.estimate().smoothed)
+	assert.Equal(t, 12*time.Millisecond, rtt.estimate().handshake)
+}
+
+// TestTCPRTTTimestamps verifies that echoed timestamps complete samples, even if they do not acknowledge the timed segment.
+func TestTCPRTTTimestamps(t *testing.T) {
+	t.Parallel()
+
+	option := layers.TCPOption{OptionType: layers.TCPOptionKindTimestamps, OptionLength: 10, OptionData: make([]byte, 8)}
+	binary.BigEndian.PutUint32(option.OptionData[:4], 7)
+	binary.BigEndian.PutUint32(option.OptionData[4:], 3)
+	segment := newTCPRTTSegment(&layers.TCP{Seq: 1, Ack: 1, ACK: true, Options: []layers.TCPOption{option}, BaseLayer: layers.BaseLayer{Payload: []byte("data")}})
+	assert.True(t, segment.hasTS)
+	assert.Equal(t, uint32(7), segment.tsval)
+	assert.Equal(t, uint32(3), segment.tsecr)
+	assert.Equal(t, uint32(4), segment.length)
+
+	start := time.Unix(1700000000, 0)
+	rtt := &tcpRTT{}
+	rtt.observe(0, segment, start)
+	// only part of the segment is acknowledged, but its timestamp is echoed
+	rtt.observe(1, &tcpRTTSegment{seq: 1, ack: 3, hasACK: true, hasTS: true, tsval: 9, tsecr: 7}, start.Add(5*time.Millisecond))
+	if estimate := rtt.estimate(); assert.NotNil(t, estimate) {
+		assert.Equal(t, 5*time.Millisecond, estimate.smoothed)
+		assert.Zero(t, estimate.handshake)
+	}
+}
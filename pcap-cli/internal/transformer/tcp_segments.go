@@ -0,0 +1,65 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+type (
+	// the source port identifies the direction of a segment within a flow
+	tcpSegmentKey struct {
+		srcPort uint16
+		seq     uint32
+		len     uint32
+	}
+
+	// tcpSegments remembers which packet carried the latest `tcpSegmentsWindow` data segments of a TCP flow;
+	// it is not thread-safe: it is used by `tcpAnalyzer`, which observes packets sequentially.
+	tcpSegments struct {
+		serials map[tcpSegmentKey]uint64
+		keys    []tcpSegmentKey // ring buffer used to evict the oldest segments
+		next    int
+	}
+)
+
+const tcpSegmentsWindow = 1024
+
+func newTCPSegments() *tcpSegments {
+	return &tcpSegments{
+		serials: make(map[tcpSegmentKey]uint64),
+		keys:    make([]tcpSegmentKey, 0, tcpSegmentsWindow),
+	}
+}
+
+// track returns the serial of the packet which previously carried the same segment:
+//   - segments are not required to be tracked in serial order; i/e: a retransmission may be tracked before the original segment,
+//   - the lowest serial is always kept so that only segments seen after the original are reported as retransmissions.
+func (s *tcpSegments) track(key tcpSegmentKey, serial uint64) (uint64, bool) {
+	if original, ok := s.serials[key]; ok {
+		if original < serial {
+			return original, true
+		}
+		s.serials[key] = serial
+		return 0, false
+	}
+
+	if len(s.keys) < tcpSegmentsWindow {
+		s.keys = append(s.keys, key)
+	} else {
+		delete(s.serials, s.keys[s.next])
+		s.keys[s.next] = key
+	}
+	s.next = (s.next + 1) % tcpSegmentsWindow
+	s.serials[key] = serial
+
+	return 0, false
+}
@@ -0,0 +1,55 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestTCPSegments verifies retransmissions detection, including out of order translations and eviction.
+func TestTCPSegments(t *testing.T) {
+	t.Parallel()
+
+	segments := newTCPSegments()
+	segment := tcpSegmentKey{srcPort: 443, seq: 1000, len: 100}
+
+	_, ok := segments.track(segment, 10)
+	assert.False(t, ok)
+
+	original, ok := segments.track(segment, 12)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(10), original)
+
+	// same segment in the opposite direction is not a retransmission
+	_, ok = segments.track(tcpSegmentKey{srcPort: 50000, seq: 1000, len: 100}, 13)
+	assert.False(t, ok)
+
+	// the original segment translated after its retransmission
+	_, ok = segments.track(segment, 5)
+	assert.False(t, ok)
+	original, ok = segments.track(segment, 14)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(5), original)
+
+	// oldest segments are evicted
+	for i := uint32(1); i <= tcpSegmentsWindow; i++ {
+		segments.track(tcpSegmentKey{srcPort: 443, seq: 1000 + 100*i, len: 100}, 100+uint64(i))
+	}
+	assert.LessOrEqual(t, len(segments.serials), tcpSegmentsWindow)
+	_, ok = segments.track(segment, 2000)
+	assert.False(t, ok)
+}
@@ -0,0 +1,159 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+type (
+	// tcpState is the state of a TCP connection as seen from the capture point; states are named after Linux conntrack's.
+	tcpState uint8
+
+	// tcpStateTransition is attached to every TCP segment: `from` and `to` are the same if the segment did not change the state.
+	tcpStateTransition struct {
+		from, to tcpState
+	}
+
+	// CaptureTCPConnections counts TCP connections by state; connections are counted from their 1st captured segment.
+	CaptureTCPConnections struct {
+		// connections whose handshake is not complete: `SYN_SENT` or `SYN_RECV`
+		HalfOpen int64 `json:"half_open"`
+		// connections which are `ESTABLISHED`, or being closed: `FIN_WAIT`, `CLOSE_WAIT` or `LAST_ACK`
+		Established int64 `json:"established"`
+		// connections closed by `RST`
+		Resets uint64 `json:"resets"`
+		// half-open connections forgotten without completing the handshake; i/e: SYN floods, or unreachable services
+		HalfOpenExpired uint64 `json:"half_open_expired"`
+	}
+)
+
+const (
+	tcpStateNone tcpState = iota
+	tcpStateSynSent
+	tcpStateSynRecv
+	tcpStateEstablished
+	tcpStateFinWait
+	tcpStateCloseWait
+	tcpStateLastACK
+	tcpStateTimeWait
+	tcpStateClose
+)
+
+var tcpStateNames = [...]string{
+	tcpStateNone:        "NONE",
+	tcpStateSynSent:     "SYN_SENT",
+	tcpStateSynRecv:     "SYN_RECV",
+	tcpStateEstablished: "ESTABLISHED",
+	tcpStateFinWait:     "FIN_WAIT",
+	tcpStateCloseWait:   "CLOSE_WAIT",
+	tcpStateLastACK:     "LAST_ACK",
+	tcpStateTimeWait:    "TIME_WAIT",
+	tcpStateClose:       "CLOSE",
+}
+
+func (s tcpState) String() string {
+	if int(s) < len(tcpStateNames) {
+		return tcpStateNames[s]
+	}
+	return tcpStateNames[tcpStateNone]
+}
+
+func (s tcpState) isHalfOpen() bool {
+	return s == tcpStateSynSent || s == tcpStateSynRecv
+}
+
+func (s tcpState) isEstablished() bool {
+	return s >= tcpStateEstablished && s <= tcpStateLastACK
+}
+
+// nextTCPState returns the state of the connection after `tcp` is sent in `direction`:
+//   - `initiator` is the direction of the connection's `SYN`, and `finBy` the direction of the 1st `FIN`,
+//   - connections established before the capture started are `ESTABLISHED` from their 1st captured segment.
+func (f *tcpAnalysisFlow) nextTCPState(tcp *layers.TCP, direction int) tcpState {
+	state := f.state
+	switch {
+	case tcp.RST:
+		return tcpStateClose
+
+	case tcp.SYN && !tcp.ACK:
+		if state == tcpStateNone || state == tcpStateSynSent || state == tcpStateTimeWait || state == tcpStateClose {
+			f.initiator = direction
+			return tcpStateSynSent
+		}
+		return state
+
+	case tcp.SYN:
+		if state == tcpStateNone {
+			// the `SYN` was not captured
+			f.initiator = 1 - direction
+			return tcpStateSynRecv
+		}
+		if state == tcpStateSynSent && direction != f.initiator {
+			return tcpStateSynRecv
+		}
+		return state
+	}
+
+	switch state {
+	case tcpStateNone:
+		f.initiator = direction
+		state = tcpStateEstablished
+	case tcpStateSynSent, tcpStateSynRecv:
+		if direction == f.initiator && tcp.ACK {
+			state = tcpStateEstablished
+		}
+	}
+
+	switch {
+	case tcp.FIN && (state == tcpStateEstablished || state == tcpStateSynRecv):
+		f.finBy = direction
+		return tcpStateFinWait
+	case tcp.FIN && (state == tcpStateFinWait || state == tcpStateCloseWait) && direction != f.finBy:
+		return tcpStateLastACK
+	case tcp.ACK && state == tcpStateFinWait && direction != f.finBy:
+		return tcpStateCloseWait
+	case tcp.ACK && state == tcpStateLastACK && direction == f.finBy:
+		return tcpStateTimeWait
+	}
+	return state
+}
+
+// transition moves the connection to the state resulting from `tcp`, and counts connections by state.
+func (f *tcpAnalysisFlow) transition(tcp *layers.TCP, direction int, summary *CaptureSummary) *tcpStateTransition {
+	transition := &tcpStateTransition{from: f.state, to: f.nextTCPState(tcp, direction)}
+	f.state = transition.to
+	summary.observeTCPState(transition.from, transition.to)
+	return transition
+}
+
+// forget stops counting the connection by state: it is not analyzed anymore.
+func (f *tcpAnalysisFlow) forget(summary *CaptureSummary) {
+	if f.state.isHalfOpen() {
+		summary.observeTCPHalfOpenExpired()
+	}
+	summary.observeTCPState(f.state, tcpStateNone)
+	f.state = tcpStateNone
+}
+
+func tcpStateOf(packet gopacket.Packet) *tcpStateTransition {
+	for _, data := range packet.Metadata().AncillaryData {
+		if transition, ok := data.(*tcpStateTransition); ok {
+			return transition
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTCPStateTestConn(t *testing.T, summary *CaptureSummary) *tcpAnalysisTestConn {
+	return &tcpAnalysisTestConn{t: t, analyzer: newTCPAnalyzer(summary), start: time.Unix(1700000000, 0), window: 1024}
+}
+
+func (c *tcpAnalysisTestConn) state() string {
+	if transition := tcpStateOf(c.last); transition != nil {
+		return transition.from.String() + ">" + transition.to.String()
+	}
+	return ""
+}
+
+func TestTCPStateLifecycle(t *testing.T) {
+	t.Parallel()
+
+	summary := NewCaptureSummary()
+	c := newTCPStateTestConn(t, summary)
+
+	c.segment(0, true, 1000, 0, "", "S")
+	assert.Equal(t, "NONE>SYN_SENT", c.state())
+	assert.Equal(t, int64(1), summary.Totals().TCP.HalfOpen)
+
+	c.segment(10, false, 5000, 1001, "", "SA")
+	assert.Equal(t, "SYN_SENT>SYN_RECV", c.state())
+
+	c.segment(11, true, 1001, 5001, "", "A")
+	assert.Equal(t, "SYN_RECV>ESTABLISHED", c.state())
+	c.segment(12, true, 1001, 5001, "hello", "A")
+	assert.Equal(t, "ESTABLISHED>ESTABLISHED", c.state())
+
+	tcp := summary.Totals().TCP
+	assert.Equal(t, int64(0), tcp.HalfOpen)
+	assert.Equal(t, int64(1), tcp.Established)
+
+	// the server closes the connection 1st
+	c.segment(20, false, 5001, 1006, "", "FA")
+	assert.Equal(t, "ESTABLISHED>FIN_WAIT", c.state())
+	c.segment(21, true, 1006, 5002, "", "A")
+	assert.Equal(t, "FIN_WAIT>CLOSE_WAIT", c.state())
+	c.segment(22, true, 1006, 5002, "", "FA")
+	assert.Equal(t, "CLOSE_WAIT>LAST_ACK", c.state())
+	c.segment(23, false, 5002, 1007, "", "A")
+	assert.Equal(t, "LAST_ACK>TIME_WAIT", c.state())
+
+	tcp = summary.Totals().TCP
+	assert.Equal(t, int64(0), tcp.Established)
+	assert.Equal(t, uint64(0), tcp.Resets)
+}
+
+func TestTCPStateResetsAndHalfOpen(t *testing.T) {
+	t.Parallel()
+
+	summary := NewCaptureSummary()
+
+	// connections established before the capture started
+	established := newTCPStateTestConn(t, summary)
+	established.segment(0, true, 1001, 5001, "hello", "A")
+	assert.Equal(t, "NONE>ESTABLISHED", established.state())
+	established.segment(1, false, 5001, 1006, "", "R")
+	assert.Equal(t, "ESTABLISHED>CLOSE", established.state())
+
+	// unanswered `SYN`s leave connections half-open until they are forgotten
+	halfOpen := newTCPStateTestConn(t, summary)
+	halfOpen.segment(0, true, 1000, 0, "", "S")
+	halfOpen.segment(1000, true, 1000, 0, "", "S")
+	assert.Equal(t, "SYN_SENT>SYN_SENT", halfOpen.state())
+
+	tcp := summary.Totals().TCP
+	assert.Equal(t, int64(1), tcp.HalfOpen)
+	assert.Equal(t, int64(0), tcp.Established)
+	assert.Equal(t, uint64(1), tcp.Resets)
+
+	for _, flow := range halfOpen.analyzer.flows {
+		flow.forget(summary)
+	}
+	tcp = summary.Totals().TCP
+	assert.Equal(t, int64(0), tcp.HalfOpen)
+	assert.Equal(t, uint64(1), tcp.HalfOpenExpired)
+}
@@ -0,0 +1,68 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// translations are rendered as their summary when no template is provided
+const defaultTranslationTemplate = `{{ .message }}`
+
+var translationTemplateFuncs = template.FuncMap{
+	"json": func(value any) (string, error) {
+		jsonBytes, err := json.Marshal(value)
+		return string(jsonBytes), err
+	},
+	"join":  strings.Join,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	// allows to render optional fields; i/e: `{{ default "-" .HTTP }}`
+	"default": func(fallback, value any) any {
+		if value == nil {
+			return fallback
+		}
+		return value
+	},
+}
+
+func newTranslationTemplate(name, text string) (*template.Template, error) {
+	// fields which are not available in a translation must not fail rendering
+	return template.New(name).
+		Option("missingkey=zero").
+		Funcs(translationTemplateFuncs).
+		Parse(text)
+}
+
+// NewTranslationTemplate parses the Go `text/template` at `path`:
+//   - templates are executed with the JSON translation of every packet; i/e: `{{ .L3.src }}`,
+//   - functions `json`, `join`, `lower`, `upper` and `default` are available to templates.
+func NewTranslationTemplate(path string) (*template.Template, error) {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read template: %s", path)
+	}
+	tmpl, err := newTranslationTemplate(filepath.Base(path), string(text))
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid template: %s", path)
+	}
+	return tmpl, nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Jeffail/gabs/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+const templateTestTranslation = `{
+	"message": "summary",
+	"L3": {"src": "10.0.0.1", "dst": "10.0.0.2"},
+	"L4": {"src": 40000, "dst": 443, "flags": {"str": "PSH|ACK"}},
+	"DNS": {"answers": [{"name": "a.example"}, {"name": "b.example"}]}
+}`
+
+// TestTranslationTemplate verifies that templates are rendered using JSON translations.
+func TestTranslationTemplate(t *testing.T) {
+	t.Parallel()
+
+	translation, err := gabs.ParseJSON([]byte(templateTestTranslation))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{
+			name:     "default",
+			template: defaultTranslationTemplate,
+			expected: "summary",
+		},
+		{
+			name:     "fields",
+			template: `{{ .L3.src }}:{{ .L4.src }} > {{ .L3.dst }}:{{ .L4.dst }} | {{ lower .L4.flags.str }}`,
+			expected: "10.0.0.1:40000 > 10.0.0.2:443 | psh|ack",
+		},
+		{
+			name:     "functions",
+			template: `{{ default "-" .HTTP }} {{ json .L3 }}{{ range .DNS.answers }} {{ upper .name }}{{ end }}`,
+			expected: `- {"dst":"10.0.0.2","src":"10.0.0.1"} A.EXAMPLE B.EXAMPLE`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tmpl, err := newTranslationTemplate(tc.name, tc.template)
+			assert.NoError(t, err)
+
+			var output strings.Builder
+			assert.NoError(t, tmpl.Execute(&output, translation.Data()))
+			assert.Equal(t, tc.expected, output.String())
+		})
+	}
+
+	path := filepath.Join(t.TempDir(), "translation.tmpl")
+	assert.NoError(t, os.WriteFile(path, []byte(`{{ .message }}`), 0o644))
+	_, err = NewTranslationTemplate(path)
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.WriteFile(path, []byte(`{{ .message `), 0o644))
+	_, err = NewTranslationTemplate(path)
+	assert.Error(t, err)
+
+	_, err = NewTranslationTemplate(filepath.Join(t.TempDir(), "missing.tmpl"))
+	assert.Error(t, err)
+}
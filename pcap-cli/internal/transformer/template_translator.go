@@ -0,0 +1,108 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build json && template
+
+package transformer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"text/template"
+
+	"github.com/google/gopacket"
+	"github.com/pkg/errors"
+)
+
+type (
+	// TemplatePcapTranslator relies on `JSONPcapTranslator` to analyze packets,
+	// and then renders translations using a user provided Go `text/template`.
+	TemplatePcapTranslator struct {
+		*JSONPcapTranslator
+		template *template.Template
+	}
+)
+
+func init() {
+	registerTranslator(TEMPLATE, newTemplatePcapTranslator)
+}
+
+// for TEMPLATE translator, this method executes the template using the JSON translation as data
+func (t *TemplatePcapTranslator) finalize(
+	ctx context.Context,
+	ifaces netIfaceIndex,
+	iface *PcapIface,
+	serial *uint64,
+	p *gopacket.Packet,
+	conntrack bool,
+	packet fmt.Stringer,
+) (fmt.Stringer, error) {
+	// JSON translation is always available, even if `finalize` fails
+	translation, err := t.JSONPcapTranslator.finalizeJSON(ctx, ifaces, iface, serial, p, conntrack, packet)
+
+	json := t.asTranslation(translation)
+
+	var buffer bytes.Buffer
+	if renderErr := t.template.Execute(&buffer, json.Data()); renderErr != nil {
+		// partially rendered translations are replaced by the error so that it is visible in the output
+		renderErr = errors.Wrapf(renderErr, "failed to render translation #%d", *serial)
+		buffer.Reset()
+		buffer.WriteString(renderErr.Error() + "\n")
+		return &buffer, renderErr
+	}
+
+	// every translation is written in its own line
+	if buffer.Len() == 0 || buffer.Bytes()[buffer.Len()-1] != '\n' {
+		buffer.WriteByte('\n')
+	}
+
+	return &buffer, err
+}
+
+func (t *TemplatePcapTranslator) write(
+	_ context.Context,
+	writer io.Writer,
+	packet *fmt.Stringer,
+) (int, error) {
+	buffer, ok := (*packet).(*bytes.Buffer)
+	if !ok {
+		return 0, errors.New("invalid TEMPLATE translation")
+	}
+
+	writtenBytes, err := writer.Write(buffer.Bytes())
+	if err != nil {
+		return writtenBytes, errors.Wrap(err, "failed to write TEMPLATE translation")
+	}
+
+	return writtenBytes, nil
+}
+
+func newTemplatePcapTranslator(
+	ctx context.Context,
+	debug bool,
+	iface *PcapIface,
+	ephemerals *PcapEphemeralPorts,
+) PcapTranslator {
+	tmpl, ok := ctx.Value(ContextTemplate).(*template.Template)
+	if !ok || tmpl == nil {
+		tmpl = template.Must(newTranslationTemplate("default", defaultTranslationTemplate))
+	}
+
+	return &TemplatePcapTranslator{
+		JSONPcapTranslator: newJSONPcapTranslator(ctx, debug, iface, ephemerals).(*JSONPcapTranslator),
+		template:           tmpl,
+	}
+}
@@ -12,7 +12,7 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-//go:build text
+//go:build json && text
 
 package transformer
 
@@ -20,195 +20,279 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net"
+	"strconv"
 	"strings"
 
+	"github.com/Jeffail/gabs/v2"
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
-	"github.com/pterm/pterm"
+	"github.com/pkg/errors"
 )
 
 type (
+	// TextPcapTranslator relies on `JSONPcapTranslator` to analyze packets,
+	// and then renders a compact `tcpdump`-like single line summary per packet:
+	//   - flow and trace tracking is exactly the same for both formats,
+	//   - HTTP method/URL and status are included when available.
 	TextPcapTranslator struct {
-		iface *PcapIface
+		*JSONPcapTranslator
 	}
 
 	textPcapTranslation struct {
-		index   int // allows layers to be sorted on `String()` invocation
 		builder *strings.Builder
 	}
-
-	textPcapTranslations struct {
-		writer       io.Writer
-		translations map[int]*textPcapTranslation
-	}
-)
-
-var (
-	textPcapSerialStyle = pterm.NewStyle(pterm.FgBlack, pterm.BgRed)
-	textPcapHeaderStyle = pterm.NewStyle(pterm.FgBlack, pterm.BgCyan, pterm.Bold)
-	textPcapDataStyle   = pterm.NewStyle(pterm.FgBlack, pterm.BgWhite, pterm.Bold)
 )
 
 func init() {
-	translators.Store(TEXT, newTEXTPcapTranslator)
+	registerTranslator(TEXT, newTEXTPcapTranslator)
 }
 
 func (tt *textPcapTranslation) String() string {
 	return tt.builder.String()
 }
 
-func (tt *textPcapTranslations) String() string {
-	translations := (*tt).translations
-
-	printer := pterm.BulletListPrinter{
-		Bullet:      "•",
-		TextStyle:   &pterm.ThemeDefault.BulletListTextStyle,
-		BulletStyle: &pterm.ThemeDefault.BulletListBulletStyle,
-		Items:       make([]pterm.BulletListItem, len(translations)),
+func (t *TextPcapTranslator) writeEndpoint(text *strings.Builder, ip net.IP, port uint16) {
+	if ip.To4() == nil {
+		// same as `tcpdump`: IPv6 addresses are separated from ports using `.`
+		text.WriteString(ip.String())
+		text.WriteString(".")
+	} else {
+		text.WriteString(ip.String())
+		text.WriteString(":")
 	}
+	text.WriteString(strconv.FormatUint(uint64(port), 10))
+}
 
-	for key, value := range translations {
-		printer.Items[key] = pterm.BulletListItem{
-			Level:       key,                           // Level 0 (top level)
-			Text:        value.builder.String(),        // Text to display
-			TextStyle:   pterm.NewStyle(pterm.FgWhite), // Text color
-			BulletStyle: pterm.NewStyle(pterm.FgRed),   // Bullet color
+func (t *TextPcapTranslator) writeL4(text *strings.Builder, json *gabs.Container, srcIP, dstIP net.IP) {
+	switch proto, _ := json.S("L3", "proto", "num").Data().(layers.IPProtocol); proto {
+	case layers.IPProtocolTCP:
+		srcPort, _ := json.S("L4", "src").Data().(layers.TCPPort)
+		dstPort, _ := json.S("L4", "dst").Data().(layers.TCPPort)
+		text.WriteString(" TCP ")
+		t.writeEndpoint(text, srcIP, uint16(srcPort))
+		text.WriteString(" > ")
+		t.writeEndpoint(text, dstIP, uint16(dstPort))
+		flags, _ := json.S("L4", "flags", "str").Data().(string)
+		seq, _ := json.S("L4", "seq").Data().(uint32)
+		ack, _ := json.S("L4", "ack").Data().(uint32)
+		length, _ := json.S("L4", "len").Data().(string)
+		fmt.Fprintf(text, " [%s] seq %d ack %d len %s", flags, seq, ack, length)
+		if analysis, ok := json.S("L4", "analysis", "str").Data().(string); ok {
+			fmt.Fprintf(text, " [%s]", analysis)
+		}
+		if rtt, ok := json.S("L4", "rtt_ms").Data().(float64); ok {
+			fmt.Fprintf(text, " rtt %.3fms", rtt)
 		}
-	}
 
-	str, err := printer.Srender()
-	if err == nil {
-		return pterm.DefaultBox.Sprintln(str)
-	}
-	return ""
-}
+	case layers.IPProtocolUDP:
+		srcPort, _ := json.S("L4", "src").Data().(layers.UDPPort)
+		dstPort, _ := json.S("L4", "dst").Data().(layers.UDPPort)
+		text.WriteString(" UDP ")
+		t.writeEndpoint(text, srcIP, uint16(srcPort))
+		text.WriteString(" > ")
+		t.writeEndpoint(text, dstIP, uint16(dstPort))
+		size, _ := json.S("L4", "size").Data().(int)
+		fmt.Fprintf(text, " len %d", size)
+
+	case layers.IPProtocolSCTP:
+		srcPort, _ := json.S("L4", "src").Data().(layers.SCTPPort)
+		dstPort, _ := json.S("L4", "dst").Data().(layers.SCTPPort)
+		text.WriteString(" SCTP ")
+		t.writeEndpoint(text, srcIP, uint16(srcPort))
+		text.WriteString(" > ")
+		t.writeEndpoint(text, dstIP, uint16(dstPort))
+		vtag, _ := json.S("L4", "vtag").Data().(uint32)
+		chunks, _ := json.S("L4", "types").Data().([]string)
+		fmt.Fprintf(text, " vtag %d %s", vtag, strings.Join(chunks, ","))
+
+	case layers.IPProtocolICMPv4, layers.IPProtocolICMPv6:
+		if proto == layers.IPProtocolICMPv4 {
+			text.WriteString(" ICMP ")
+		} else {
+			text.WriteString(" ICMP6 ")
+		}
+		text.WriteString(srcIP.String())
+		text.WriteString(" > ")
+		text.WriteString(dstIP.String())
+		if msg, ok := json.S("ICMP", "msg").Data().(string); ok {
+			text.WriteString(" ")
+			text.WriteString(msg)
+		}
+		if mtu, ok := json.S("ICMP", "mtu").Data().(uint32); ok {
+			fmt.Fprintf(text, " mtu %d", mtu)
+		}
+		if flow, ok := json.S("ICMP", "orig", "flow").Data().(string); ok {
+			fmt.Fprintf(text, " flow %s", flow)
+		}
 
-func (t *TextPcapTranslator) done(_ context.Context) {
-	// not implemented
+	default:
+		text.WriteString(" ")
+		text.WriteString(proto.String())
+		text.WriteString(" ")
+		text.WriteString(srcIP.String())
+		text.WriteString(" > ")
+		text.WriteString(dstIP.String())
+	}
 }
 
-func (t *TextPcapTranslator) next(
-	ctx context.Context,
-	nic *PcapIface,
-	serial *uint64,
-	packet *gopacket.Packet,
-) fmt.Stringer {
-	text := new(strings.Builder)
-
-	metadata := (*packet).Metadata()
-	info := metadata.CaptureInfo
-
-	// text.WriteString(ctx.Value(ContextID))
-	text.WriteString(textPcapSerialStyle.Sprint(" ", *serial, " "))
-	text.WriteString(" | [iface: ")
-	text.WriteString(textPcapDataStyle.Sprint(" ", t.iface.Index, "/", t.iface.Name, " "))
-	text.WriteString("] | [timestamp: ")
-	text.WriteString(textPcapDataStyle.Sprint(" ", info.Timestamp.String(), " "))
-	text.WriteString("]")
-
-	// `next` returns the container to be used for merging all layers
-	return &textPcapTranslations{translations: map[int]*textPcapTranslation{0: {0, text}}}
-}
+func (t *TextPcapTranslator) writeL7(text *strings.Builder, json *gabs.Container) {
+	if HTTP := json.S("HTTP"); HTTP != nil {
+		if method, ok := HTTP.S("method").Data().(string); ok {
+			url, _ := HTTP.S("url").Data().(string)
+			fmt.Fprintf(text, " | HTTP %s %s", method, url)
+		} else if status, ok := HTTP.S("status").Data().(string); ok {
+			fmt.Fprintf(text, " | HTTP %s", status)
+			if latency, ok := HTTP.S("request", "latency").Data().(int64); ok {
+				fmt.Fprintf(text, " (%dms)", latency)
+			}
+		} else if proto, ok := HTTP.S("proto").Data().(string); ok {
+			fmt.Fprintf(text, " | %s", proto)
+		}
+	}
 
-func (t *TextPcapTranslator) asTranslation(buffer fmt.Stringer) *textPcapTranslation {
-	return buffer.(*textPcapTranslation)
-}
+	if DNS := json.S("DNS"); DNS != nil {
+		id, _ := DNS.S("id").Data().(uint16)
+		fmt.Fprintf(text, " | DNS %d", id)
+		if questions := DNS.S("questions").Children(); len(questions) > 0 {
+			name, _ := questions[0].S("name").Data().(string)
+			qtype, _ := questions[0].S("type").Data().(string)
+			fmt.Fprintf(text, " %s? %s", qtype, name)
+		}
+		if answers := DNS.S("answers").Children(); len(answers) > 0 {
+			fmt.Fprintf(text, " %d answers", len(answers))
+		}
+	}
 
-func (t *TextPcapTranslator) translateEthernetLayer(ctx context.Context, eth *layers.Ethernet) fmt.Stringer {
-	text := new(strings.Builder)
+	if SIP := json.S("SIP"); SIP != nil {
+		method, _ := SIP.S("method").Data().(string)
+		if code, ok := SIP.S("code").Data().(int); ok {
+			status, _ := SIP.S("status").Data().(string)
+			fmt.Fprintf(text, " | SIP %d %s (%s)", code, status, method)
+		} else {
+			uri, _ := SIP.S("uri").Data().(string)
+			fmt.Fprintf(text, " | SIP %s %s", method, uri)
+		}
+	}
 
-	text.WriteString(textPcapHeaderStyle.Sprint(" L2 "))
-	text.WriteString(" | [")
-	text.WriteString(textPcapDataStyle.Sprint(" ", eth.EthernetType.String(), " "))
-	text.WriteString("] | [src: ")
-	text.WriteString(textPcapDataStyle.Sprint(" ", eth.SrcMAC.String(), " "))
-	text.WriteString("] | [dst: ")
-	text.WriteString(textPcapDataStyle.Sprint(" ", eth.DstMAC.String(), " "))
-	text.WriteString("]")
+	if NTP := json.S("ntp"); NTP != nil {
+		mode, _ := NTP.S("mode").Data().(string)
+		stratum, _ := NTP.S("stratum").Data().(uint8)
+		fmt.Fprintf(text, " | NTP %s stratum %d", mode, stratum)
+		if offset, ok := NTP.S("offset").Data().(float64); ok {
+			fmt.Fprintf(text, " offset %.3fms", offset)
+		}
+	}
 
-	return &textPcapTranslation{1, text}
-}
+	if VPN := json.S("vpn"); VPN != nil {
+		proto, _ := VPN.S("proto").Data().(string)
+		if spi, ok := VPN.S("spi").Data().(string); ok {
+			fmt.Fprintf(text, " | %s spi %s", strings.ToUpper(proto), spi)
+		} else {
+			messageType, _ := VPN.S("type").Data().(string)
+			fmt.Fprintf(text, " | WireGuard %s", messageType)
+		}
+	}
 
-func (t *TextPcapTranslator) translateIPv4Layer(ctx context.Context, ip4 *layers.IPv4) fmt.Stringer {
-	// [TODO]: implement IPv4 layer translation
-	return &textPcapTranslation{2, new(strings.Builder)}
-}
+	if MULTICAST := json.S("multicast"); MULTICAST != nil {
+		proto, _ := MULTICAST.S("proto").Data().(string)
+		version, _ := MULTICAST.S("version").Data().(uint8)
+		messageType, _ := MULTICAST.S("type").Data().(string)
+		fmt.Fprintf(text, " | %sv%d %s", strings.ToUpper(proto), version, messageType)
+		if group, ok := MULTICAST.S("group").Data().(string); ok {
+			fmt.Fprintf(text, " %s", group)
+		}
+		if records := MULTICAST.S("records").Children(); len(records) > 0 {
+			fmt.Fprintf(text, " %d records", len(records))
+		}
+	}
 
-func (t *TextPcapTranslator) translateIPv6Layer(ctx context.Context, ip6 *layers.IPv6) fmt.Stringer {
-	// [TODO]: implement IPv6 layer translation
-	return &textPcapTranslation{2, new(strings.Builder)}
-}
+	if RTP := json.S("rtp"); RTP != nil {
+		ssrc, _ := RTP.S("ssrc").Data().(string)
+		seq, _ := RTP.S("seq").Data().(uint16)
+		lost, _ := RTP.S("stats", "lost").Data().(uint32)
+		fmt.Fprintf(text, " | RTP %s seq %d lost %d", ssrc, seq, lost)
+	}
 
-func (t *TextPcapTranslator) translateUDPLayer(ctx context.Context, udp *layers.UDP) fmt.Stringer {
-	// [TODO]: implement UDP layer translation
-	return &textPcapTranslation{3, new(strings.Builder)}
+	if trace, ok := json.S("logging.googleapis.com/trace").Data().(string); ok {
+		span, _ := json.S("logging.googleapis.com/spanId").Data().(string)
+		fmt.Fprintf(text, " | trace %s/%s", trace[strings.LastIndex(trace, "/")+1:], span)
+	}
 }
 
-func (t *TextPcapTranslator) translateTCPLayer(ctx context.Context, tcp *layers.TCP) fmt.Stringer {
-	// [TODO]: implement TCP layer translation
-	return &textPcapTranslation{3, new(strings.Builder)}
-}
+// for text translator, this method renders the JSON translation as a single line:
+//   - `{timestamp} #{serial} @{ifaceIndex}/{ifaceName} flow {flowID} {L4Proto} {src} > {dst} [{tcpFlags}] seq {tcpSeq} ack {tcpAck} len {tcpLen} | {L7}`
+func (t *TextPcapTranslator) finalize(
+	ctx context.Context,
+	ifaces netIfaceIndex,
+	iface *PcapIface,
+	serial *uint64,
+	p *gopacket.Packet,
+	conntrack bool,
+	packet fmt.Stringer,
+) (fmt.Stringer, error) {
+	// JSON translation is always available, even if `finalize` fails
+	translation, err := t.JSONPcapTranslator.finalizeJSON(ctx, ifaces, iface, serial, p, conntrack, packet)
+
+	json := t.asTranslation(translation)
+	text := new(strings.Builder)
 
-func (t *TextPcapTranslator) translateTLSLayer(ctx context.Context, tls *layers.TLS) fmt.Stringer {
-	// [TODO]: implement TLS layer translation
-	return &textPcapTranslation{4, new(strings.Builder)}
-}
+	timestamp, _ := json.S("meta", "timestamp").Data().(string)
+	ifaceIndex, ifaceName := t.iface.Index, t.iface.Name
+	if index, ok := json.S("iface", "index").Data().(uint8); ok {
+		ifaceIndex = index
+		ifaceName, _ = json.S("iface", "name").Data().(string)
+	}
+	flowID, _ := json.S("flow").Data().(string)
+
+	fmt.Fprintf(text, "%s #%d @%d/%s flow %s", timestamp, *serial, ifaceIndex, ifaceName, flowID)
+
+	srcIP, srcOK := json.S("L3", "src").Data().(net.IP)
+	dstIP, dstOK := json.S("L3", "dst").Data().(net.IP)
+	if srcOK && dstOK {
+		t.writeL4(text, json, srcIP, dstIP)
+	} else if json.Exists("ARP") {
+		srcIP, _ := json.S("ARP", "src", "IP").Data().(string)
+		dstIP, _ := json.S("ARP", "dst", "IP").Data().(string)
+		fmt.Fprintf(text, " ARP %s > %s", srcIP, dstIP)
+	}
 
-func (t *TextPcapTranslator) translateDNSLayer(ctx context.Context, dns *layers.DNS) fmt.Stringer {
-	// [TODO]: implement DNS layer translation
-	return &textPcapTranslation{4, new(strings.Builder)}
-}
+	t.writeL7(text, json)
 
-func (t *TextPcapTranslator) merge(ctx context.Context, tgt fmt.Stringer, src fmt.Stringer) (fmt.Stringer, error) {
-	srcTranslation := t.asTranslation(src)
-	switch typedObj := tgt.(type) {
-	case *textPcapTranslations:
-		// add reference to another layer translation
-		(*typedObj).translations[srcTranslation.index] = srcTranslation
-	case *textPcapTranslation:
-		// 1st `merge` invocation might not actually be a map (`textPcapTranslations`)
-		tgt = &textPcapTranslations{
-			translations: map[int]*textPcapTranslation{
-				typedObj.index:       typedObj,
-				srcTranslation.index: srcTranslation,
-			},
+	if errs := json.S("err").Children(); len(errs) > 0 {
+		if msg, ok := errs[0].S("msg").Data().(string); ok {
+			fmt.Fprintf(text, " | error: %s", msg)
 		}
 	}
-	return tgt, nil
-}
 
-func (t *TextPcapTranslator) finalize(ctx context.Context, iface *PcapIface, serial *uint64, p *gopacket.Packet, connTrack bool, packet fmt.Stringer) (fmt.Stringer, error) {
-	return packet, nil
+	text.WriteString("\n")
+
+	return &textPcapTranslation{text}, err
 }
 
-func (t *TextPcapTranslator) write(ctx context.Context, writer io.Writer, packet *fmt.Stringer) (int, error) {
-	translations := (*packet).(*textPcapTranslations)
-	translations.writer = writer
-	return io.WriteString(writer, translations.String())
+func (t *TextPcapTranslator) write(
+	_ context.Context,
+	writer io.Writer,
+	packet *fmt.Stringer,
+) (int, error) {
+	translation, ok := (*packet).(*textPcapTranslation)
+	if !ok {
+		return 0, errors.New("invalid text translation")
+	}
+	writtenBytes, err := io.WriteString(writer, translation.String())
+	if err != nil {
+		return writtenBytes, errors.Wrap(err, "failed to write text translation")
+	}
+	return writtenBytes, nil
 }
 
 func newTEXTPcapTranslator(
-	_ context.Context,
-	_ bool,
+	ctx context.Context,
+	debug bool,
 	iface *PcapIface,
-	_ *PcapEphemeralPorts,
+	ephemerals *PcapEphemeralPorts,
 ) PcapTranslator {
-	return &TextPcapTranslator{iface: iface}
-}
-
-// [TODO]: remove samples when all layers translations are implemented
-func (t *TextPcapTranslator) translate(packet *gopacket.Packet) error {
-	p := *packet
-
-	// Iterate over all layers, printing out each layer type
-	fmt.Println("All packet layers:")
-	for _, layer := range p.Layers() {
-		fmt.Println("- ", layer.LayerType())
-	}
-
-	// Check for errors
-	if err := p.ErrorLayer(); err != nil {
-		fmt.Println("Error decoding some part of the packet:", err)
+	return &TextPcapTranslator{
+		JSONPcapTranslator: newJSONPcapTranslator(ctx, debug, iface, ephemerals).(*JSONPcapTranslator),
 	}
-	return nil
 }
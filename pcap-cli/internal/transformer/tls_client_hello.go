@@ -0,0 +1,154 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"golang.org/x/crypto/cryptobyte"
+)
+
+const (
+	tlsRecordTypeHandshake      = uint8(22)
+	tlsHandshakeTypeClientHello = uint8(1)
+	tlsExtensionServerName      = uint16(0)
+	tlsExtensionALPN            = uint16(16)
+	tlsServerNameTypeHostName   = uint8(0)
+)
+
+// tlsServerName extracts the SNI from a TLS record carrying a `ClientHello`;
+// it only inspects the 1st record, which is where clients send the `ClientHello`.
+//   - see: https://datatracker.ietf.org/doc/html/rfc8446#section-4.1.2
+//   - see: https://datatracker.ietf.org/doc/html/rfc6066#section-3
+func tlsServerName(data []byte) (string, bool) {
+	record := cryptobyte.String(data)
+
+	var recordType uint8
+	var handshake cryptobyte.String
+	if !record.ReadUint8(&recordType) ||
+		recordType != tlsRecordTypeHandshake ||
+		!record.Skip(2) /* legacy_record_version */ ||
+		!record.ReadUint16LengthPrefixed(&handshake) {
+		return "", false
+	}
+
+	var handshakeType uint8
+	var clientHello cryptobyte.String
+	if !handshake.ReadUint8(&handshakeType) ||
+		handshakeType != tlsHandshakeTypeClientHello ||
+		!handshake.ReadUint24LengthPrefixed(&clientHello) {
+		return "", false
+	}
+
+	var sessionID, cipherSuites, compressionMethods, extensions cryptobyte.String
+	if !clientHello.Skip(2+32) /* legacy_version + random */ ||
+		!clientHello.ReadUint8LengthPrefixed(&sessionID) ||
+		!clientHello.ReadUint16LengthPrefixed(&cipherSuites) ||
+		!clientHello.ReadUint8LengthPrefixed(&compressionMethods) ||
+		!clientHello.ReadUint16LengthPrefixed(&extensions) {
+		return "", false
+	}
+
+	for !extensions.Empty() {
+		var extType uint16
+		var extData cryptobyte.String
+		if !extensions.ReadUint16(&extType) ||
+			!extensions.ReadUint16LengthPrefixed(&extData) {
+			return "", false
+		}
+
+		if extType != tlsExtensionServerName {
+			continue
+		}
+
+		var serverNameList cryptobyte.String
+		if !extData.ReadUint16LengthPrefixed(&serverNameList) {
+			return "", false
+		}
+
+		for !serverNameList.Empty() {
+			var nameType uint8
+			var hostName cryptobyte.String
+			if !serverNameList.ReadUint8(&nameType) ||
+				!serverNameList.ReadUint16LengthPrefixed(&hostName) {
+				return "", false
+			}
+			if nameType == tlsServerNameTypeHostName && len(hostName) > 0 {
+				return string(hostName), true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// tlsClientHelloNames extracts the SNI and ALPN protocols from a `ClientHello` handshake message without a record header;
+// handshake messages may be truncated, i/e: QUIC clients split large `ClientHello`s across packets,
+// so extensions are decoded until data is exhausted.
+//   - see: https://datatracker.ietf.org/doc/html/rfc7301#section-3.1
+func tlsClientHelloNames(data []byte) (string, []string) {
+	handshake := cryptobyte.String(data)
+
+	var handshakeType uint8
+	var sessionID, cipherSuites, compressionMethods cryptobyte.String
+	var extensionsLength uint16
+	if !handshake.ReadUint8(&handshakeType) ||
+		handshakeType != tlsHandshakeTypeClientHello ||
+		!handshake.Skip(3) /* length */ ||
+		!handshake.Skip(2+32) /* legacy_version + random */ ||
+		!handshake.ReadUint8LengthPrefixed(&sessionID) ||
+		!handshake.ReadUint16LengthPrefixed(&cipherSuites) ||
+		!handshake.ReadUint8LengthPrefixed(&compressionMethods) ||
+		!handshake.ReadUint16(&extensionsLength) {
+		return "", nil
+	}
+
+	var serverName string
+	var protocols []string
+	extensions := handshake
+	for !extensions.Empty() {
+		var extType uint16
+		var extData cryptobyte.String
+		if !extensions.ReadUint16(&extType) ||
+			!extensions.ReadUint16LengthPrefixed(&extData) {
+			break
+		}
+
+		switch extType {
+		case tlsExtensionServerName:
+			var serverNameList, hostName cryptobyte.String
+			var nameType uint8
+			if extData.ReadUint16LengthPrefixed(&serverNameList) &&
+				serverNameList.ReadUint8(&nameType) &&
+				nameType == tlsServerNameTypeHostName &&
+				serverNameList.ReadUint16LengthPrefixed(&hostName) {
+				serverName = string(hostName)
+			}
+
+		case tlsExtensionALPN:
+			var protocolList cryptobyte.String
+			if !extData.ReadUint16LengthPrefixed(&protocolList) {
+				continue
+			}
+			for !protocolList.Empty() {
+				var protocol cryptobyte.String
+				if !protocolList.ReadUint8LengthPrefixed(&protocol) {
+					break
+				}
+				protocols = append(protocols, string(protocol))
+			}
+		}
+	}
+
+	return serverName, protocols
+}
@@ -0,0 +1,64 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTLSClientHello(t *testing.T, serverName string) []byte {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	go func() {
+		defer client.Close()
+		tls.Client(client, &tls.Config{
+			ServerName:         serverName,
+			InsecureSkipVerify: true,
+		}).Handshake()
+	}()
+
+	record := make([]byte, 16384)
+	n, err := server.Read(record)
+	assert.NoError(t, err)
+
+	return record[:n]
+}
+
+// TestTLSServerName verifies SNI extraction from TLS records.
+func TestTLSServerName(t *testing.T) {
+	t.Parallel()
+
+	clientHello := newTLSClientHello(t, "example.com")
+
+	serverName, ok := tlsServerName(clientHello)
+	assert.True(t, ok)
+	assert.Equal(t, "example.com", serverName)
+
+	// truncated records must not be decoded
+	_, ok = tlsServerName(clientHello[:len(clientHello)/2])
+	assert.False(t, ok)
+
+	// IP addresses are not sent as SNI
+	_, ok = tlsServerName(newTLSClientHello(t, "127.0.0.1"))
+	assert.False(t, ok)
+
+	_, ok = tlsServerName([]byte("GET / HTTP/1.1\r\n"))
+	assert.False(t, ok)
+}
@@ -0,0 +1,125 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"encoding/hex"
+	"hash/fnv"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+type (
+	// traceHeaderRule extracts trace context from a header chosen by users; i/e: their own correlation IDs.
+	//   - the `trace` group of `pattern` is the trace ID, or the whole match if there is no such group,
+	//   - the `span` group is the span ID; if there is no such group, it is synthesized out of the trace ID,
+	//   - if `hash` is set, the trace ID is replaced by its hash so that any value becomes a valid trace ID.
+	traceHeaderRule struct {
+		header  string
+		pattern *regexp.Regexp
+		hash    bool
+	}
+
+	traceHeaderRules []*traceHeaderRule
+)
+
+const (
+	traceHeaderRuleHashPrefix = "hash:"
+	traceHeaderRulePattern    = "="
+	traceHeaderRuleTraceGroup = "trace"
+	traceHeaderRuleSpanGroup  = "span"
+)
+
+// newTraceHeaderRules parses rules formatted as `[hash:]{header}[={regex}]`; invalid rules are ignored.
+//
+// i/e: `hash:X-Request-Id`, `X-Correlation-Id=^(?P<trace>[0-9a-f]{32})/(?P<span>[0-9a-f]{16})$`
+func newTraceHeaderRules(rules []string) traceHeaderRules {
+	headerRules := make(traceHeaderRules, 0, len(rules))
+	for _, rule := range rules {
+		rule = strings.TrimSpace(rule)
+		hash := strings.HasPrefix(strings.ToLower(rule), traceHeaderRuleHashPrefix)
+		if hash {
+			rule = rule[len(traceHeaderRuleHashPrefix):]
+		}
+		header, rawPattern, hasPattern := strings.Cut(rule, traceHeaderRulePattern)
+		header = strings.TrimSpace(header)
+		if header == "" {
+			continue
+		}
+		headerRule := &traceHeaderRule{header: http.CanonicalHeaderKey(header), hash: hash}
+		if hasPattern {
+			pattern, err := regexp.Compile(rawPattern)
+			if err != nil {
+				continue
+			}
+			headerRule.pattern = pattern
+		}
+		headerRules = append(headerRules, headerRule)
+	}
+	if len(headerRules) == 0 {
+		return nil
+	}
+	return headerRules
+}
+
+// traceAndSpan returns the trace context of the 1st rule whose header is found and matched.
+func (r traceHeaderRules) traceAndSpan(headers *http.Header) *traceAndSpan {
+	for _, rule := range r {
+		if ts := rule.traceAndSpan(headers.Get(rule.header)); ts != nil {
+			ts.scheme = traceSchemeCustom
+			return ts
+		}
+	}
+	return nil
+}
+
+func (r *traceHeaderRule) traceAndSpan(value string) *traceAndSpan {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+
+	traceID, spanID := value, ""
+	if r.pattern != nil {
+		match := r.pattern.FindStringSubmatch(value)
+		if match == nil {
+			return nil
+		}
+		traceID = match[0]
+		if index := r.pattern.SubexpIndex(traceHeaderRuleTraceGroup); index > 0 {
+			traceID = match[index]
+		}
+		if index := r.pattern.SubexpIndex(traceHeaderRuleSpanGroup); index > 0 {
+			spanID = match[index]
+		}
+	}
+	if traceID == "" {
+		return nil
+	}
+
+	if r.hash {
+		digest := fnv.New128a()
+		digest.Write([]byte(traceID))
+		traceID = hex.EncodeToString(digest.Sum(nil))
+	}
+	if spanID == "" {
+		// responses are linked to requests by trace ID, so the span ID only needs to be stable
+		digest := fnv.New64a()
+		digest.Write([]byte(traceID))
+		spanID = hex.EncodeToString(digest.Sum(nil))
+	}
+	return &traceAndSpan{traceID: &traceID, spanID: &spanID}
+}
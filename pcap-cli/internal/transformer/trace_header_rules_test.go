@@ -0,0 +1,77 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestTraceHeaderRules verifies that custom headers are matched, hashed, and attempted before standard ones.
+func TestTraceHeaderRules(t *testing.T) {
+	t.Parallel()
+
+	rules := newTraceHeaderRules([]string{
+		"x-correlation-id=^(?P<trace>[0-9a-f]{32})/(?P<span>[0-9a-f]{16})$",
+		"HASH:X-Request-Id",
+		"X-Invalid=(",
+		"=^.+$",
+	})
+	assert.Len(t, rules, 2)
+	assert.Nil(t, newTraceHeaderRules([]string{"X-Invalid=("}))
+
+	headers := http.Header{}
+	headers.Set("X-Correlation-Id", "4bf92f3577b34da6a3ce929d0e0e4736/00f067aa0ba902b7")
+	ts := rules.traceAndSpan(&headers)
+	if assert.NotNil(t, ts) {
+		assert.Equal(t, traceSchemeCustom, ts.scheme)
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", *ts.traceID)
+		assert.Equal(t, "00f067aa0ba902b7", *ts.spanID)
+	}
+
+	// values not matching the pattern fall through to the next rule
+	headers.Set("X-Correlation-Id", "not-a-trace")
+	headers.Set("X-Request-Id", "req-42")
+	ts = rules.traceAndSpan(&headers)
+	if assert.NotNil(t, ts) {
+		assert.Len(t, *ts.traceID, 32)
+		assert.Len(t, *ts.spanID, 16)
+		assert.True(t, isTraceID(*ts.traceID, 32))
+		// hashing is stable: requests and responses carrying the same value share the trace ID
+		again := rules.traceAndSpan(&headers)
+		assert.Equal(t, *ts.traceID, *again.traceID)
+	}
+	assert.Nil(t, rules.traceAndSpan(&http.Header{}))
+
+	// custom headers take precedence over standard ones
+	headers.Set(traceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	strategy := newTraceStrategy(nil, nil, []string{"hash:X-Request-Id"})
+	if ts = strategy.extract(&headers); assert.NotNil(t, ts) {
+		assert.Equal(t, traceSchemeCustom, ts.scheme)
+	}
+	headers.Del("X-Request-Id")
+	if ts = strategy.extract(&headers); assert.NotNil(t, ts) {
+		assert.Equal(t, traceSchemeW3C, ts.scheme)
+	}
+
+	// without hashing, values are used verbatim
+	ts = newTraceHeaderRules([]string{"X-Trace"}).traceAndSpan(&http.Header{"X-Trace": {"abc"}})
+	if assert.NotNil(t, ts) {
+		assert.Equal(t, "abc", *ts.traceID)
+		assert.Len(t, *ts.spanID, 16)
+	}
+}
@@ -0,0 +1,322 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// traceScheme names a trace context propagation format; schemes are attempted in the configured order.
+type traceScheme string
+
+const (
+	traceSchemeCloud   traceScheme = "cloud"
+	traceSchemeW3C     traceScheme = "w3c"
+	traceSchemeGRPC    traceScheme = "grpc"
+	traceSchemeB3      traceScheme = "b3"
+	traceSchemeXRay    traceScheme = "xray"
+	traceSchemeDatadog traceScheme = "datadog"
+	// trace context extracted by rules configured by users
+	traceSchemeCustom traceScheme = "custom"
+)
+
+const (
+	// see: https://www.w3.org/TR/trace-context/#tracestate-header
+	tracestateHeader     = "tracestate"
+	tracestateMaxMembers = 32
+	// see: https://github.com/openzipkin/b3-propagation
+	b3Header        = "b3"
+	b3TraceIDHeader = "X-B3-TraceId"
+	b3SpanIDHeader  = "X-B3-SpanId"
+	// see: https://github.com/census-instrumentation/opencensus-specs/blob/master/encodings/BinaryEncoding.md
+	grpcTraceBinHeader = "grpc-trace-bin"
+	// see: https://docs.aws.amazon.com/xray/latest/devguide/xray-concepts.html#xray-concepts-tracingheader
+	amznTraceIDHeader = "X-Amzn-Trace-Id"
+	// see: https://docs.datadoghq.com/tracing/trace_collection/trace_context_propagation/
+	datadogTraceIDHeader  = "X-Datadog-Trace-Id"
+	datadogParentIDHeader = "X-Datadog-Parent-Id"
+	datadogTagsHeader     = "X-Datadog-Tags"
+	// upper 64 bits of 128 bits trace IDs
+	datadogTraceIDHighTag = "_dd.p.tid"
+)
+
+// guards schemes registered by programs embedding pcap-cli; see `RegisterTraceExtractor`
+var traceSchemesMu sync.RWMutex
+
+// Google Cloud and W3C trace headers take precedence over vendor specific ones; registered schemes are appended
+var defaultTraceSchemes = []traceScheme{
+	traceSchemeCloud, traceSchemeW3C, traceSchemeGRPC, traceSchemeB3, traceSchemeXRay, traceSchemeDatadog,
+}
+
+var traceSchemeExtractors = map[traceScheme]func(*http.Header) *traceAndSpan{
+	traceSchemeCloud: cloudTraceAndSpan,
+	traceSchemeW3C:   w3cTraceAndSpan,
+	traceSchemeGRPC:  grpcTraceAndSpan,
+	traceSchemeB3:    b3TraceAndSpan,
+	traceSchemeXRay: func(headers *http.Header) *traceAndSpan {
+		if header := headers.Get(amznTraceIDHeader); header != "" {
+			return amznTraceAndSpan(header)
+		}
+		return nil
+	},
+	traceSchemeDatadog: datadogTraceAndSpan,
+}
+
+// newTraceSchemes ignores unknown and repeated schemes; all schemes are used if none is valid.
+func newTraceSchemes(names []string) []traceScheme {
+	traceSchemesMu.RLock()
+	defer traceSchemesMu.RUnlock()
+
+	schemes := make([]traceScheme, 0, len(defaultTraceSchemes))
+	for _, name := range names {
+		scheme := traceScheme(strings.ToLower(strings.TrimSpace(name)))
+		if _, ok := traceSchemeExtractors[scheme]; ok && !slices.Contains(schemes, scheme) {
+			schemes = append(schemes, scheme)
+		}
+	}
+	if len(schemes) == 0 {
+		return defaultTraceSchemes
+	}
+	return schemes
+}
+
+// vendorTraceAndSpan extracts trace and span IDs from headers used outside of Google Cloud, other than W3C's.
+func vendorTraceAndSpan(headers *http.Header) *traceAndSpan {
+	return schemesTraceAndSpan(headers, []traceScheme{traceSchemeGRPC, traceSchemeB3, traceSchemeXRay, traceSchemeDatadog})
+}
+
+// schemesTraceAndSpan returns the trace context of the 1st scheme found in headers; all schemes are attempted if `schemes` is `nil`.
+func schemesTraceAndSpan(headers *http.Header, schemes []traceScheme) *traceAndSpan {
+	traceSchemesMu.RLock()
+	defer traceSchemesMu.RUnlock()
+
+	if schemes == nil {
+		schemes = defaultTraceSchemes
+	}
+	for _, scheme := range schemes {
+		if ts := traceSchemeExtractors[scheme](headers); ts != nil {
+			ts.scheme = scheme
+			return ts
+		}
+	}
+	return nil
+}
+
+// cloudTraceAndSpan keeps IDs of `X-Cloud-Trace-Context` as they are: span IDs are decimal numbers.
+func cloudTraceAndSpan(headers *http.Header) *traceAndSpan {
+	value := headers.Get(cloudTraceContextHeader)
+	if value == "" {
+		return nil
+	}
+	ts := traceAndSpanRegex[cloudTraceContextHeader].FindStringSubmatch(value)
+	if ts == nil {
+		return nil
+	}
+	return &traceAndSpan{traceID: &ts[1], spanID: &ts[2]}
+}
+
+// w3cTraceAndSpan extracts IDs from `traceparent`, and the members of `tracestate` if IDs are valid:
+//   - `{2 hex digits: version}-{32 hex digits: trace ID}-{16 hex digits: parent ID}-{2 hex digits: flags}`,
+//   - all zeros IDs, and version `ff`, are invalid; future versions may append fields.
+//
+// i/e: `00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01`
+func w3cTraceAndSpan(headers *http.Header) *traceAndSpan {
+	parts := strings.Split(strings.TrimSpace(headers.Get(traceparentHeader)), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || !isHex(parts[0]) || strings.EqualFold(parts[0], "ff") ||
+		(parts[0] == "00" && len(parts) != 4) {
+		return nil
+	}
+	traceID, spanID := strings.ToLower(parts[1]), strings.ToLower(parts[2])
+	if !isTraceID(traceID, 32) || !isTraceID(spanID, 16) {
+		return nil
+	}
+	return &traceAndSpan{traceID: &traceID, spanID: &spanID, state: parseTracestate(headers.Values(tracestateHeader))}
+}
+
+// parseTracestate returns `nil` if there are no members, or if any member is malformed;
+// headers may be repeated, and members beyond the limit are dropped.
+func parseTracestate(values []string) map[string]string {
+	var state map[string]string
+	for _, value := range values {
+		for _, member := range strings.Split(value, ",") {
+			member = strings.TrimSpace(member)
+			if member == "" {
+				continue
+			}
+			key, value, ok := strings.Cut(member, "=")
+			if !ok || key == "" || value == "" {
+				return nil
+			}
+			if state == nil {
+				state = make(map[string]string)
+			}
+			if _, found := state[key]; !found && len(state) < tracestateMaxMembers {
+				state[key] = value
+			}
+		}
+	}
+	return state
+}
+
+// grpcTraceAndSpan decodes the OpenCensus binary format propagated by gRPC as base64 encoded metadata:
+//   - `{version: 0}`, then fields prefixed by their ID: `0` is the trace ID ( 16 bytes ), `1` is the span ID ( 8 bytes ),
+//     and `2` is the trace options ( 1 byte ); fields are in order, and unknown fields end decoding.
+func grpcTraceAndSpan(headers *http.Header) *traceAndSpan {
+	value := strings.TrimRight(strings.TrimSpace(headers.Get(grpcTraceBinHeader)), "=")
+	if value == "" {
+		return nil
+	}
+	// binary metadata may be sent with or without padding
+	data, err := base64.RawStdEncoding.DecodeString(value)
+	if err != nil || len(data) < 1 || data[0] != 0 {
+		return nil
+	}
+
+	var traceID, spanID string
+decode:
+	for fields := data[1:]; len(fields) > 0; {
+		var size int
+		switch fields[0] {
+		case 0:
+			size = 16
+		case 1:
+			size = 8
+		case 2:
+			size = 1
+		default:
+			break decode
+		}
+		if len(fields) < 1+size {
+			return nil
+		}
+		switch fields[0] {
+		case 0:
+			traceID = hex.EncodeToString(fields[1 : 1+size])
+		case 1:
+			spanID = hex.EncodeToString(fields[1 : 1+size])
+		}
+		fields = fields[1+size:]
+	}
+	if !isTraceID(traceID, 32) || !isTraceID(spanID, 16) {
+		return nil
+	}
+	return &traceAndSpan{traceID: &traceID, spanID: &spanID}
+}
+
+// b3TraceAndSpan normalizes B3 trace headers into the format used by `traceparent`:
+//   - the single `b3` header is `{trace ID}-{span ID}[-{sampling}[-{parent span ID}]]`,
+//   - multiple headers are `X-B3-TraceId` and `X-B3-SpanId`,
+//   - 64 bits trace IDs are left-padded with zeros.
+//
+// i/e: `80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1-05e3ac9a4f6e3b90`
+func b3TraceAndSpan(headers *http.Header) *traceAndSpan {
+	var traceID, spanID string
+	if header := strings.TrimSpace(headers.Get(b3Header)); header != "" {
+		// a single field is only the sampling decision: `0`, `1` or `d`
+		parts := strings.Split(header, "-")
+		if len(parts) < 2 {
+			return nil
+		}
+		traceID, spanID = parts[0], parts[1]
+	} else {
+		traceID = strings.TrimSpace(headers.Get(b3TraceIDHeader))
+		spanID = strings.TrimSpace(headers.Get(b3SpanIDHeader))
+	}
+	traceID, spanID = strings.ToLower(traceID), strings.ToLower(spanID)
+	if len(traceID) == 16 {
+		traceID = strings.Repeat("0", 16) + traceID
+	}
+	if !isTraceID(traceID, 32) || !isTraceID(spanID, 16) {
+		return nil
+	}
+	return &traceAndSpan{traceID: &traceID, spanID: &spanID}
+}
+
+// amznTraceAndSpan normalizes X-Ray trace headers into the format used by `traceparent`:
+//   - `Root=1-{8 hex digits: epoch}-{24 hex digits}` becomes a 32 hex digits trace ID,
+//   - `Parent={16 hex digits}` is the span ID.
+//
+// i/e: `Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1`
+func amznTraceAndSpan(header string) *traceAndSpan {
+	var traceID, spanID string
+	for _, field := range strings.Split(header, ";") {
+		key, value, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(key) {
+		case "root":
+			parts := strings.Split(value, "-")
+			if len(parts) == 3 && parts[0] == "1" &&
+				len(parts[1]) == 8 && len(parts[2]) == 24 && isHex(parts[1]+parts[2]) {
+				traceID = strings.ToLower(parts[1] + parts[2])
+			}
+		case "parent":
+			if len(value) == 16 && isHex(value) {
+				spanID = strings.ToLower(value)
+			}
+		}
+	}
+	if traceID == "" || spanID == "" {
+		return nil
+	}
+	return &traceAndSpan{traceID: &traceID, spanID: &spanID}
+}
+
+// datadogTraceAndSpan normalizes Datadog trace headers into the format used by `traceparent`:
+//   - trace and parent IDs are unsigned decimal numbers,
+//   - trace IDs are 64 bits wide, unless the upper 64 bits are propagated using `x-datadog-tags`.
+func datadogTraceAndSpan(headers *http.Header) *traceAndSpan {
+	traceIDLow, err := strconv.ParseUint(strings.TrimSpace(headers.Get(datadogTraceIDHeader)), 10, 64)
+	if err != nil || traceIDLow == 0 {
+		return nil
+	}
+	parentID, err := strconv.ParseUint(strings.TrimSpace(headers.Get(datadogParentIDHeader)), 10, 64)
+	if err != nil || parentID == 0 {
+		return nil
+	}
+
+	traceIDHigh := uint64(0)
+	for _, tag := range strings.Split(headers.Get(datadogTagsHeader), ",") {
+		if key, value, ok := strings.Cut(strings.TrimSpace(tag), "="); ok && key == datadogTraceIDHighTag {
+			traceIDHigh, _ = strconv.ParseUint(value, 16, 64)
+		}
+	}
+
+	traceID := fmt.Sprintf("%016x%016x", traceIDHigh, traceIDLow)
+	spanID := fmt.Sprintf("%016x", parentID)
+	return &traceAndSpan{traceID: &traceID, spanID: &spanID}
+}
+
+// isTraceID returns whether the ID has the given number of hex digits, and if it is not all zeros.
+func isTraceID(id string, digits int) bool {
+	return len(id) == digits && isHex(id) && strings.Trim(id, "0") != ""
+}
+
+func isHex(value string) bool {
+	for _, c := range value {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
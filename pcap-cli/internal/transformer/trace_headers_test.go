@@ -0,0 +1,146 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestTraceHeaders verifies that gRPC, B3, X-Ray and Datadog trace headers are normalized into 32/16 hex digits IDs.
+func TestTraceHeaders(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		headers http.Header
+		traceID string
+		spanID  string
+	}{
+		{
+			name:    "amzn",
+			headers: http.Header{"X-Amzn-Trace-Id": {"Root=1-5759e988-BD862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1"}},
+			traceID: "5759e988bd862e3fe1be46a994272793",
+			spanID:  "53995c3f42cd8ad8",
+		},
+		{
+			name:    "amzn/root-only",
+			headers: http.Header{"X-Amzn-Trace-Id": {"Root=1-5759e988-bd862e3fe1be46a994272793"}},
+		},
+		{
+			name:    "datadog",
+			headers: http.Header{"X-Datadog-Trace-Id": {"1234567890123456789"}, "X-Datadog-Parent-Id": {"42"}},
+			traceID: "0000000000000000112210f47de98115",
+			spanID:  "000000000000002a",
+		},
+		{
+			name: "datadog/128",
+			headers: http.Header{
+				"X-Datadog-Trace-Id":  {"1"},
+				"X-Datadog-Parent-Id": {"2"},
+				"X-Datadog-Tags":      {"_dd.p.dm=-1,_dd.p.tid=640cfd8d00000000"},
+			},
+			traceID: "640cfd8d000000000000000000000001",
+			spanID:  "0000000000000002",
+		},
+		{
+			name:    "b3",
+			headers: http.Header{"B3": {"80F198EE56343BA864FE8B2A57D3EFF7-e457b5a2e4d86bd1-1-05e3ac9a4f6e3b90"}},
+			traceID: "80f198ee56343ba864fe8b2a57d3eff7",
+			spanID:  "e457b5a2e4d86bd1",
+		},
+		{
+			name:    "b3/64",
+			headers: http.Header{"X-B3-Traceid": {"a3ce929d0e0e4736"}, "X-B3-Spanid": {"00f067aa0ba902b7"}},
+			traceID: "0000000000000000a3ce929d0e0e4736",
+			spanID:  "00f067aa0ba902b7",
+		},
+		{
+			name:    "grpc",
+			headers: http.Header{"Grpc-Trace-Bin": {"AABL+S81d7NNpqPOkp0ODkc2AQDwZ6oLqQK3AgE"}},
+			traceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+			spanID:  "00f067aa0ba902b7",
+		},
+		{
+			name:    "grpc/truncated",
+			headers: http.Header{"Grpc-Trace-Bin": {"AABL+S81d7NNpqPOkp0ODkc2AQDwZ6o="}},
+		},
+		{
+			name:    "b3/sampling-only",
+			headers: http.Header{"B3": {"0"}},
+		},
+		{
+			name:    "datadog/invalid",
+			headers: http.Header{"X-Datadog-Trace-Id": {"abc"}, "X-Datadog-Parent-Id": {"2"}},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ts := vendorTraceAndSpan(&tc.headers)
+			if tc.traceID == "" {
+				assert.Nil(t, ts)
+				return
+			}
+			assert.NotNil(t, ts)
+			assert.Equal(t, tc.traceID, *ts.traceID)
+			assert.Equal(t, tc.spanID, *ts.spanID)
+		})
+	}
+}
+
+// TestTraceSchemes verifies that schemes are attempted in the configured order, and that `traceparent` is validated.
+func TestTraceSchemes(t *testing.T) {
+	t.Parallel()
+
+	headers := http.Header{}
+	headers.Set(traceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	headers.Add(tracestateHeader, "congo=t61rcWkgMzE")
+	headers.Add(tracestateHeader, "rojo=00f067aa0ba902b7")
+	headers.Set(b3Header, "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1")
+
+	ts := newTraceStrategy(nil, nil, nil).extract(&headers)
+	if assert.NotNil(t, ts) {
+		assert.Equal(t, traceSchemeW3C, ts.scheme)
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", *ts.traceID)
+		assert.Equal(t, map[string]string{"congo": "t61rcWkgMzE", "rojo": "00f067aa0ba902b7"}, ts.state)
+	}
+
+	ts = newTraceStrategy(nil, []string{"B3", "w3c", "unknown"}, nil).extract(&headers)
+	if assert.NotNil(t, ts) {
+		assert.Equal(t, traceSchemeB3, ts.scheme)
+		assert.Equal(t, "e457b5a2e4d86bd1", *ts.spanID)
+		assert.Nil(t, ts.state)
+	}
+
+	assert.Nil(t, newTraceStrategy(nil, []string{"xray"}, nil).extract(&headers))
+	assert.Equal(t, defaultTraceSchemes, newTraceSchemes([]string{"unknown"}))
+
+	for _, traceparent := range []string{
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-00",
+		"00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01",
+	} {
+		assert.Nil(t, w3cTraceAndSpan(&http.Header{"Traceparent": {traceparent}}), traceparent)
+	}
+	ts = w3cTraceAndSpan(&http.Header{"Traceparent": {"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future"}})
+	assert.NotNil(t, ts)
+}
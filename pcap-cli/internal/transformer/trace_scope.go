@@ -0,0 +1,137 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/segmentio/fasthash/fnv1a"
+)
+
+type (
+	// TraceScope restricts translations to flows that carried a trace of interest:
+	//   - traces are chosen by ID, by ID prefix, or by sampling 1 out of every N trace IDs,
+	//   - flows are identified by their 5-tuple regardless of direction, so both directions are in scope,
+	//   - trace IDs and prefixes may be added at any time; i/e: while debugging a misbehaving request path.
+	TraceScope struct {
+		mu       sync.RWMutex
+		ids      map[string]struct{}
+		prefixes []string
+		rate     uint64
+		// last time a packet of each scoped flow was seen
+		flows map[uint64]time.Time
+	}
+)
+
+const (
+	// trace IDs ending with this suffix are prefixes
+	traceScopePrefixSuffix = "*"
+	// scoped flows without packets for this long are forgotten once there are too many of them
+	traceScopeFlowTimeout = 10 * time.Minute
+	traceScopeFlowsLimit  = 4096
+)
+
+// NewTraceScope returns a scope without traces if no `traceIDs` are given and `rate` is `0`;
+// trace IDs may be prefixes if they end with `*`, i/e: `4bf92f35*`.
+func NewTraceScope(traceIDs []string, rate uint) *TraceScope {
+	scope := &TraceScope{
+		ids:   make(map[string]struct{}),
+		rate:  uint64(rate),
+		flows: make(map[uint64]time.Time),
+	}
+	scope.Add(traceIDs...)
+	return scope
+}
+
+// Add makes flows carrying any of the traces, or any of the prefixes ending with `*`, to be translated from now on.
+func (s *TraceScope) Add(traceIDs ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, traceID := range traceIDs {
+		traceID = strings.ToLower(strings.TrimSpace(traceID))
+		if prefix, ok := strings.CutSuffix(traceID, traceScopePrefixSuffix); ok {
+			if prefix != "" {
+				s.prefixes = append(s.prefixes, prefix)
+			}
+		} else if traceID != "" {
+			s.ids[traceID] = struct{}{}
+		}
+	}
+}
+
+func (s *TraceScope) matches(traceID string) bool {
+	traceID = strings.ToLower(traceID)
+	if s.rate > 0 && fnv1a.HashString64(traceID)%s.rate == 0 {
+		return true
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, ok := s.ids[traceID]; ok {
+		return true
+	}
+	for _, prefix := range s.prefixes {
+		if strings.HasPrefix(traceID, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// observe brings the flow of the packet into scope if it carries a trace of interest.
+func (s *TraceScope) observe(packet gopacket.Packet, ts *traceAndSpan) {
+	if s == nil || ts == nil || ts.traceID == nil || !s.matches(*ts.traceID) {
+		return
+	}
+	hash, ok := flowSamplingHash(packet)
+	if !ok {
+		return
+	}
+	timestamp := packet.Metadata().Timestamp
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, found := s.flows[hash]; !found && len(s.flows) >= traceScopeFlowsLimit {
+		for flow, lastSeen := range s.flows {
+			if timestamp.Sub(lastSeen) > traceScopeFlowTimeout {
+				delete(s.flows, flow)
+			}
+		}
+	}
+	s.flows[hash] = timestamp
+}
+
+// allows returns whether the translation of the packet must be written; flows are only in scope after carrying a trace of interest.
+func (s *TraceScope) allows(packet gopacket.Packet) bool {
+	if s == nil {
+		return true
+	}
+	hash, ok := flowSamplingHash(packet)
+	if !ok {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, found := s.flows[hash]; !found {
+		return false
+	}
+	if timestamp := packet.Metadata().Timestamp; timestamp.After(s.flows[hash]) {
+		s.flows[hash] = timestamp
+	}
+	return true
+}
@@ -0,0 +1,67 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestTraceScopeMatches verifies that traces are chosen by ID, by prefix, and by rate; and that IDs may be added later.
+func TestTraceScopeMatches(t *testing.T) {
+	t.Parallel()
+
+	scope := NewTraceScope([]string{" 4BF92F3577B34DA6A3CE929D0E0E4736 ", "5e1c*", "", "*"}, 0)
+	assert.True(t, scope.matches("4bf92f3577b34da6a3ce929d0e0e4736"))
+	assert.True(t, scope.matches("5E1C0000000000000000000000000001"))
+	assert.False(t, scope.matches("0af7651916cd43dd8448eb211c80319c"))
+
+	scope.Add("0af7651916cd43dd8448eb211c80319c")
+	assert.True(t, scope.matches("0af7651916cd43dd8448eb211c80319c"))
+
+	// every trace is chosen when sampling 1 out of every 1
+	assert.True(t, NewTraceScope(nil, 1).matches("0af7651916cd43dd8448eb211c80319c"))
+	assert.False(t, NewTraceScope(nil, 0).matches("0af7651916cd43dd8448eb211c80319c"))
+}
+
+// TestTraceScopeFlows verifies that both directions of a flow are in scope only after a matching trace is observed.
+func TestTraceScopeFlows(t *testing.T) {
+	t.Parallel()
+
+	client, server := net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)
+	request := newTestTCPPacket(t, client, server, 40000, 8080)
+	response := newTestTCPPacket(t, server, client, 8080, 40000)
+	other := newTestTCPPacket(t, client, server, 40001, 8080)
+
+	var unscoped *TraceScope
+	assert.True(t, unscoped.allows(request))
+	unscoped.observe(request, nil)
+
+	scope := NewTraceScope([]string{"4bf92f35*"}, 0)
+	assert.False(t, scope.allows(request))
+
+	uninteresting := "0af7651916cd43dd8448eb211c80319c"
+	scope.observe(request, &traceAndSpan{traceID: &uninteresting})
+	scope.observe(request, nil)
+	assert.False(t, scope.allows(request))
+
+	interesting := "4bf92f3577b34da6a3ce929d0e0e4736"
+	scope.observe(request, &traceAndSpan{traceID: &interesting})
+	assert.True(t, scope.allows(request))
+	assert.True(t, scope.allows(response))
+	assert.False(t, scope.allows(other))
+}
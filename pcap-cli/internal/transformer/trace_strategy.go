@@ -0,0 +1,195 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+type (
+	// TraceExtractor extracts trace context from the headers of HTTP/1.1 and HTTP/2 messages.
+	TraceExtractor interface {
+		// Extract returns `false` if headers do not carry trace context.
+		Extract(headers http.Header) (traceID, spanID string, ok bool)
+	}
+
+	// TraceExtractorFunc allows to use ordinary functions as `TraceExtractor`s.
+	TraceExtractorFunc func(headers http.Header) (traceID, spanID string, ok bool)
+
+	FlowMessageKind uint8
+
+	// FlowMessage is a request or a response detected by a `FlowStrategy`.
+	FlowMessage struct {
+		Kind FlowMessageKind
+		// identifies the request/response conversation; non multiplexed protocols should always use `1`
+		StreamID uint32
+		// optional: the RPC, command or operation
+		Name string
+		// optional: responses without trace context are linked to the traced request sent over the same stream
+		TraceID, SpanID string
+	}
+
+	// FlowStrategy detects request/response boundaries of application protocols unknown to pcap-cli;
+	// i/e: proprietary RPC protocols, so that they are trace-tracked the same way HTTP is.
+	FlowStrategy interface {
+		// Protocol names the protocol in translations.
+		Protocol() string
+		// Multiplexed is `true` if many streams are carried by the same connection concurrently; i/e: as HTTP/2.
+		Multiplexed() bool
+		// Messages returns `false` if the TCP segment payload does not belong to the protocol.
+		// It is invoked while holding the lock of the flow; so it must not block.
+		Messages(srcPort, dstPort uint16, payload []byte) ([]FlowMessage, bool)
+	}
+
+	// TraceStrategy allows programs embedding pcap-cli to replace how trace context is extracted:
+	//   - `Extractor` replaces the default extraction from HTTP headers,
+	//   - `Flows` are attempted, in order, on every TCP segment carrying data before HTTP is.
+	TraceStrategy struct {
+		Extractor TraceExtractor
+		Flows     []FlowStrategy
+	}
+
+	defaultTraceExtractor struct {
+		// attempted before schemes
+		headers traceHeaderRules
+		// all built-in and registered schemes if `nil`
+		schemes []traceScheme
+	}
+)
+
+const (
+	FlowMessageRequest FlowMessageKind = iota
+	FlowMessageResponse
+)
+
+// DefaultTraceExtractor extracts trace context from Google Cloud, W3C, gRPC, B3, AWS X-Ray and Datadog headers,
+// and then using registered extractors; it allows custom `TraceExtractor`s to fallback to the default behavior.
+var DefaultTraceExtractor TraceExtractor = &defaultTraceExtractor{}
+
+// RegisterTraceExtractor makes `extractor` available as the trace context scheme `name`:
+//   - registered schemes are attempted after built-in ones, in registration order,
+//   - `name` may be used to restrict and reorder schemes; see `ContextTraceSchemes`,
+//   - built-in schemes cannot be replaced, and it must be called before transformers are created.
+func RegisterTraceExtractor(name string, extractor TraceExtractor) error {
+	scheme := traceScheme(strings.ToLower(strings.TrimSpace(name)))
+	if scheme == "" || scheme == traceSchemeCustom || extractor == nil {
+		return fmt.Errorf("invalid trace extractor: %q", name)
+	}
+
+	traceSchemesMu.Lock()
+	defer traceSchemesMu.Unlock()
+
+	if _, ok := traceSchemeExtractors[scheme]; ok {
+		return fmt.Errorf("trace scheme already registered: %s", scheme)
+	}
+	traceSchemeExtractors[scheme] = func(headers *http.Header) *traceAndSpan {
+		return extractorTraceAndSpan(extractor, headers)
+	}
+	// schemes already returned by `newTraceSchemes` must not change
+	defaultTraceSchemes = append(slices.Clip(defaultTraceSchemes), scheme)
+	return nil
+}
+
+// LookupTraceExtractor returns the extractor of a built-in or registered scheme; i/e: `cloud` for `X-Cloud-Trace-Context`.
+func LookupTraceExtractor(name string) (TraceExtractor, bool) {
+	scheme := traceScheme(strings.ToLower(strings.TrimSpace(name)))
+
+	traceSchemesMu.RLock()
+	defer traceSchemesMu.RUnlock()
+
+	extract, ok := traceSchemeExtractors[scheme]
+	if !ok {
+		return nil, false
+	}
+	return TraceExtractorFunc(func(headers http.Header) (string, string, bool) {
+		if ts := extract(&headers); ts != nil {
+			return *ts.traceID, *ts.spanID, true
+		}
+		return "", "", false
+	}), true
+}
+
+func (f TraceExtractorFunc) Extract(headers http.Header) (string, string, bool) {
+	return f(headers)
+}
+
+func (k FlowMessageKind) String() string {
+	if k == FlowMessageResponse {
+		return "response"
+	}
+	return "request"
+}
+
+func (e *defaultTraceExtractor) Extract(headers http.Header) (string, string, bool) {
+	if ts := e.traceAndSpan(&headers); ts != nil {
+		return *ts.traceID, *ts.spanID, true
+	}
+	return "", "", false
+}
+
+func (e *defaultTraceExtractor) traceAndSpan(headers *http.Header) *traceAndSpan {
+	if ts := e.headers.traceAndSpan(headers); ts != nil {
+		return ts
+	}
+	return schemesTraceAndSpan(headers, e.schemes)
+}
+
+// newTraceStrategy uses the default extractor restricted to `schemes`, and preceded by `headers` rules,
+// if the strategy does not replace it.
+func newTraceStrategy(strategy *TraceStrategy, schemes, headers []string) *TraceStrategy {
+	extractor := DefaultTraceExtractor
+	if len(schemes) > 0 || len(headers) > 0 {
+		extractor = &defaultTraceExtractor{
+			headers: newTraceHeaderRules(headers),
+			schemes: newTraceSchemes(schemes),
+		}
+	}
+	if strategy == nil {
+		return &TraceStrategy{Extractor: extractor}
+	}
+	if strategy.Extractor == nil {
+		return &TraceStrategy{Extractor: extractor, Flows: strategy.Flows}
+	}
+	return strategy
+}
+
+func (s *TraceStrategy) extract(headers *http.Header) *traceAndSpan {
+	// the default extractor also reports the scheme, and W3C `tracestate`
+	if extractor, ok := s.Extractor.(*defaultTraceExtractor); ok {
+		return extractor.traceAndSpan(headers)
+	}
+	return extractorTraceAndSpan(s.Extractor, headers)
+}
+
+func extractorTraceAndSpan(extractor TraceExtractor, headers *http.Header) *traceAndSpan {
+	traceID, spanID, ok := extractor.Extract(*headers)
+	if !ok || traceID == "" || spanID == "" {
+		return nil
+	}
+	return &traceAndSpan{traceID: &traceID, spanID: &spanID}
+}
+
+// messages returns the messages detected by the 1st `FlowStrategy` that recognizes the payload
+func (s *TraceStrategy) messages(srcPort, dstPort uint16, payload []byte) (FlowStrategy, []FlowMessage) {
+	for _, flow := range s.Flows {
+		if messages, ok := flow.Messages(srcPort, dstPort, payload); ok {
+			return flow, messages
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,138 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testFlowStrategy struct{}
+
+func (s *testFlowStrategy) Protocol() string { return "test" }
+
+func (s *testFlowStrategy) Multiplexed() bool { return false }
+
+func (s *testFlowStrategy) Messages(_, dstPort uint16, payload []byte) ([]FlowMessage, bool) {
+	if !bytes.HasPrefix(payload, []byte("TEST ")) {
+		return nil, false
+	}
+	if dstPort == 9000 {
+		return []FlowMessage{{Kind: FlowMessageRequest, StreamID: 1, Name: string(payload[5:])}}, true
+	}
+	return []FlowMessage{{Kind: FlowMessageResponse, StreamID: 1}}, true
+}
+
+// TestTraceStrategy verifies that the default trace extraction can be replaced, and that flows are detected by the 1st matching strategy.
+func TestTraceStrategy(t *testing.T) {
+	t.Parallel()
+
+	headers := http.Header{}
+	headers.Add(traceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	strategy := newTraceStrategy(nil, nil, nil)
+	ts := strategy.extract(&headers)
+	if assert.NotNil(t, ts) {
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", *ts.traceID)
+		assert.Equal(t, "00f067aa0ba902b7", *ts.spanID)
+	}
+
+	strategy = newTraceStrategy(&TraceStrategy{
+		Extractor: TraceExtractorFunc(func(headers http.Header) (string, string, bool) {
+			if value := headers.Get("X-Request-Trace"); value != "" {
+				return value, "1", true
+			}
+			return DefaultTraceExtractor.Extract(headers)
+		}),
+	}, nil, nil)
+	ts = strategy.extract(&headers)
+	if assert.NotNil(t, ts) {
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", *ts.traceID)
+	}
+	headers.Set("X-Request-Trace", "abc")
+	ts = strategy.extract(&headers)
+	if assert.NotNil(t, ts) {
+		assert.Equal(t, "abc", *ts.traceID)
+		assert.Equal(t, "1", *ts.spanID)
+	}
+	assert.Nil(t, strategy.extract(&http.Header{}))
+
+	strategy = newTraceStrategy(&TraceStrategy{Flows: []FlowStrategy{&testFlowStrategy{}}}, nil, nil)
+	assert.NotNil(t, strategy.Extractor)
+
+	flow, messages := strategy.messages(40000, 9000, []byte("TEST ping"))
+	if assert.NotNil(t, flow) && assert.Len(t, messages, 1) {
+		assert.Equal(t, "test", flow.Protocol())
+		assert.Equal(t, FlowMessageRequest, messages[0].Kind)
+		assert.Equal(t, "ping", messages[0].Name)
+	}
+
+	flow, messages = strategy.messages(9000, 40000, []byte("TEST pong"))
+	if assert.NotNil(t, flow) && assert.Len(t, messages, 1) {
+		assert.Equal(t, "response", messages[0].Kind.String())
+	}
+
+	flow, _ = strategy.messages(40000, 9000, []byte("GET / HTTP/1.1\r\n"))
+	assert.Nil(t, flow)
+}
+
+// TestRegisterTraceExtractor verifies that registered schemes are attempted after built-in ones, and may be selected by name.
+// Registered schemes are global, so it does not run in parallel with tests relying on the default schemes.
+func TestRegisterTraceExtractor(t *testing.T) {
+	acme := TraceExtractorFunc(func(headers http.Header) (string, string, bool) {
+		traceID, spanID, ok := strings.Cut(headers.Get("X-Acme-Trace"), "/")
+		return traceID, spanID, ok
+	})
+
+	assert.NoError(t, RegisterTraceExtractor(" ACME ", acme))
+	assert.Error(t, RegisterTraceExtractor("acme", acme))
+	assert.Error(t, RegisterTraceExtractor("cloud", acme))
+	assert.Error(t, RegisterTraceExtractor("custom", acme))
+	assert.Error(t, RegisterTraceExtractor("", acme))
+	assert.Error(t, RegisterTraceExtractor("other", nil))
+
+	headers := http.Header{}
+	headers.Set("X-Acme-Trace", "abc/1")
+	traceID, spanID, ok := DefaultTraceExtractor.Extract(headers)
+	assert.True(t, ok)
+	assert.Equal(t, "abc", traceID)
+	assert.Equal(t, "1", spanID)
+
+	// built-in schemes take precedence
+	headers.Set(traceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	traceID, _, _ = DefaultTraceExtractor.Extract(headers)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", traceID)
+
+	strategy := newTraceStrategy(nil, []string{"acme"}, nil)
+	if ts := strategy.extract(&headers); assert.NotNil(t, ts) {
+		assert.Equal(t, "abc", *ts.traceID)
+		assert.Equal(t, traceScheme("acme"), ts.scheme)
+	}
+
+	cloud, ok := LookupTraceExtractor("cloud")
+	if assert.True(t, ok) {
+		headers.Set("X-Cloud-Trace-Context", "105445aa7843bc8bf206b12000100000/1;o=1")
+		traceID, spanID, ok = cloud.Extract(headers)
+		assert.True(t, ok)
+		assert.Equal(t, "105445aa7843bc8bf206b12000100000", traceID)
+		assert.Equal(t, "1", spanID)
+	}
+	_, ok = LookupTraceExtractor("unknown")
+	assert.False(t, ok)
+}
@@ -0,0 +1,69 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"sync"
+	"time"
+)
+
+// traceTrackingSampler decides which flows are trace-tracked: flows that are not tracked are still translated,
+// but their HTTP responses without trace headers are not linked to requests, and termination packets never wait on them.
+//   - `percent` keeps `hash(flow) mod 100 < percent`; flow IDs are hashes, so the choice is stable for the whole flow.
+//   - `rate` keeps at most `rate` new flows per second; `0` means no limit.
+type traceTrackingSampler struct {
+	percent uint64
+	rate    uint
+
+	mu      sync.Mutex
+	second  int64
+	tracked uint
+}
+
+// newTraceTrackingSampler returns `nil` if all flows must be trace-tracked.
+func newTraceTrackingSampler(percent, rate uint) *traceTrackingSampler {
+	if percent >= 100 && rate == 0 {
+		return nil
+	}
+	return &traceTrackingSampler{
+		percent: uint64(min(percent, 100)),
+		rate:    rate,
+	}
+}
+
+// sample must be called once per flow: the decision is not cached, and every accepted flow counts towards `rate`.
+func (s *traceTrackingSampler) sample(flowID uint64, now time.Time) bool {
+	if s == nil {
+		return true
+	}
+	if flowID%100 >= s.percent {
+		return false
+	}
+	if s.rate == 0 {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if second := now.Unix(); second != s.second {
+		s.second, s.tracked = second, 0
+	}
+	if s.tracked >= s.rate {
+		return false
+	}
+	s.tracked++
+	return true
+}
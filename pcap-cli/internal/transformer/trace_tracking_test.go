@@ -0,0 +1,88 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alphadose/haxmap"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestTraceTrackingSampler verifies that flows are chosen by their ID, and that at most N new flows are tracked per second.
+func TestTraceTrackingSampler(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1700000000, 0)
+
+	assert.Nil(t, newTraceTrackingSampler(100, 0))
+	assert.True(t, newTraceTrackingSampler(100, 0).sample(99, now))
+
+	percent := newTraceTrackingSampler(25, 0)
+	assert.True(t, percent.sample(124, now))
+	assert.False(t, percent.sample(125, now))
+	assert.False(t, percent.sample(199, now))
+
+	rate := newTraceTrackingSampler(100, 2)
+	assert.True(t, rate.sample(1, now))
+	assert.True(t, rate.sample(2, now.Add(500*time.Millisecond)))
+	assert.False(t, rate.sample(3, now.Add(900*time.Millisecond)))
+	assert.True(t, rate.sample(4, now.Add(time.Second)))
+
+	// flows which are not chosen do not count towards the rate
+	both := newTraceTrackingSampler(50, 1)
+	assert.False(t, both.sample(75, now))
+	assert.True(t, both.sample(10, now))
+	assert.False(t, both.sample(11, now))
+}
+
+// TestTraceTrackingBypass verifies that requests of flows which are not sampled do not hold back termination packets.
+func TestTraceTrackingBypass(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		percent uint
+		active  int64
+	}{
+		{percent: 100, active: 1},
+		{percent: 0, active: 0},
+	} {
+		fm := &flowMutex{
+			MutexMap:                  haxmap.New[uint64, *flowLockCarrier](),
+			flowToStreamToSequenceMap: haxmap.New[uint64, STSM](),
+			traceToHttpRequestMap:     haxmap.New[string, *httpRequest](),
+			sampler:                   newTraceTrackingSampler(tc.percent, 0),
+		}
+
+		serial, flowID := uint64(1), uint64(42)
+		var tcpFlags uint8
+		seq, ack := uint32(1000), uint32(2000)
+		traceID, spanID, streamID := "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", uint32(1)
+
+		lock, _ := fm.lock(context.Background(), &serial, &flowID, &tcpFlags, &seq, &ack, false)
+		assert.Equal(t, tc.percent == 100, lock.TraceTracked())
+		active, _ := lock.UnlockWithTraceAndSpan(context.Background(), &tcpFlags, false,
+			[]uint32{streamID}, nil,
+			map[uint32]*traceAndSpan{streamID: {traceID: &traceID, spanID: &spanID, streamID: &streamID}}, nil)
+		assert.Equal(t, tc.active, *active)
+
+		carrier, _ := fm.MutexMap.Get(flowID)
+		assert.Equal(t, tc.active, carrier.activeRequests.Load())
+		_, tracked := fm.flowToStreamToSequenceMap.Get(flowID)
+		assert.Equal(t, tc.percent == 100, tracked)
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+type (
+	// TrafficCounters are the packets, and their bytes on the wire, observed during a window.
+	TrafficCounters struct {
+		Packets uint64 `json:"packets"`
+		Bytes   uint64 `json:"bytes"`
+	}
+
+	// TrafficWindow aggregates all packets, and packets per L4 protocol, observed during the last `Seconds`.
+	TrafficWindow struct {
+		Seconds uint `json:"seconds"`
+		TrafficCounters
+		// protocols without packets during the window are omitted; non-IP packets are `other`
+		Protocols map[string]TrafficCounters `json:"protocols"`
+	}
+
+	// TrafficStats is a snapshot of the rolling windows of a `TrafficMeter`; only complete seconds are accounted for.
+	TrafficStats struct {
+		Iface     string        `json:"iface"`
+		Timestamp time.Time     `json:"timestamp"`
+		Second    TrafficWindow `json:"1s"`
+		Minute    TrafficWindow `json:"1m"`
+	}
+
+	trafficProtocol uint8
+
+	trafficBucket struct {
+		// unix second whose packets are counted by this bucket
+		second    int64
+		protocols [trafficProtocols]TrafficCounters
+	}
+
+	// TrafficMeter counts packets read by an engine, whether they are translated or not, into 1 second buckets:
+	//   - the last minute of buckets is kept, so that 1 second and 1 minute windows may be rolled at any time,
+	//   - protocols are those carried by the network layer; packets are not decoded any further.
+	TrafficMeter struct {
+		mu      sync.Mutex
+		iface   string
+		buckets [trafficBuckets]trafficBucket
+	}
+)
+
+const (
+	trafficTCP trafficProtocol = iota
+	trafficUDP
+	trafficICMP
+	trafficICMPv6
+	trafficSCTP
+	trafficOther
+	trafficProtocols
+)
+
+// 1 bucket per second of the longest window, and 1 for the second in progress
+const trafficBuckets = 61
+
+var trafficProtocolNames = [trafficProtocols]string{"tcp", "udp", "icmp", "icmpv6", "sctp", "other"}
+
+func NewTrafficMeter(iface string) *TrafficMeter {
+	return &TrafficMeter{iface: iface}
+}
+
+func trafficProtocolOf(packet gopacket.Packet) trafficProtocol {
+	var protocol layers.IPProtocol
+	switch network := packet.NetworkLayer().(type) {
+	case *layers.IPv4:
+		protocol = network.Protocol
+	case *layers.IPv6:
+		protocol = network.NextHeader
+	default:
+		return trafficOther
+	}
+
+	switch protocol {
+	case layers.IPProtocolTCP:
+		return trafficTCP
+	case layers.IPProtocolUDP:
+		return trafficUDP
+	case layers.IPProtocolICMPv4:
+		return trafficICMP
+	case layers.IPProtocolICMPv6:
+		return trafficICMPv6
+	case layers.IPProtocolSCTP:
+		return trafficSCTP
+	}
+	return trafficOther
+}
+
+// Observe counts `packet` into the second it was captured at; `nil` safe.
+func (m *TrafficMeter) Observe(packet gopacket.Packet) {
+	if m == nil || packet == nil {
+		return
+	}
+	metadata := packet.Metadata()
+	timestamp := metadata.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	m.observe(trafficProtocolOf(packet), uint64(metadata.Length), timestamp)
+}
+
+func (m *TrafficMeter) observe(protocol trafficProtocol, length uint64, timestamp time.Time) {
+	second := timestamp.Unix()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	bucket := &m.buckets[second%trafficBuckets]
+	if bucket.second != second {
+		if bucket.second > second {
+			// packets older than the buckets are not counted
+			return
+		}
+		*bucket = trafficBucket{second: second}
+	}
+	counters := &bucket.protocols[protocol]
+	counters.Packets += 1
+	counters.Bytes += length
+}
+
+func (w *TrafficWindow) add(protocol trafficProtocol, counters *TrafficCounters) {
+	if counters.Packets == 0 {
+		return
+	}
+	w.Packets += counters.Packets
+	w.Bytes += counters.Bytes
+	name := trafficProtocolNames[protocol]
+	total := w.Protocols[name]
+	total.Packets += counters.Packets
+	total.Bytes += counters.Bytes
+	w.Protocols[name] = total
+}
+
+// Stats rolls the windows ending at the last complete second before `now`; `nil` safe.
+func (m *TrafficMeter) Stats(now time.Time) *TrafficStats {
+	if m == nil {
+		return nil
+	}
+
+	stats := &TrafficStats{
+		Iface:     m.iface,
+		Timestamp: now,
+		Second:    TrafficWindow{Seconds: 1, Protocols: make(map[string]TrafficCounters)},
+		Minute:    TrafficWindow{Seconds: trafficBuckets - 1, Protocols: make(map[string]TrafficCounters)},
+	}
+	last := now.Unix() - 1
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.buckets {
+		bucket := &m.buckets[i]
+		if bucket.second > last || bucket.second <= last-int64(stats.Minute.Seconds) {
+			continue
+		}
+		for protocol := range trafficProtocols {
+			counters := &bucket.protocols[protocol]
+			stats.Minute.add(protocol, counters)
+			if bucket.second == last {
+				stats.Second.add(protocol, counters)
+			}
+		}
+	}
+	return stats
+}
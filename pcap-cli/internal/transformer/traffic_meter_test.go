@@ -0,0 +1,65 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestTrafficMeter verifies that packets are counted into the second they were captured at,
+// and that windows only account for complete seconds within the last minute.
+func TestTrafficMeter(t *testing.T) {
+	t.Parallel()
+
+	var disabled *TrafficMeter
+	disabled.Observe(newCaptureSummaryTestPacket(t, net.IPv4(10, 0, 0, 2)))
+	assert.Nil(t, disabled.Stats(time.Now()))
+
+	meter := NewTrafficMeter("eth0")
+	now := time.Unix(1_700_000_000, 500)
+
+	packet := newCaptureSummaryTestPacket(t, net.IPv4(10, 0, 0, 2))
+	packet.Metadata().Timestamp = now.Add(-time.Second)
+	meter.Observe(packet)
+	meter.observe(trafficTCP, 100, now.Add(-time.Second))
+	meter.observe(trafficTCP, 200, now.Add(-30*time.Second))
+	// neither the second in progress, nor seconds older than a minute, are accounted for
+	meter.observe(trafficTCP, 400, now)
+	meter.observe(trafficTCP, 800, now.Add(-61*time.Second))
+
+	stats := meter.Stats(now)
+	assert.Equal(t, "eth0", stats.Iface)
+	assert.Equal(t, uint(1), stats.Second.Seconds)
+	assert.Equal(t, uint64(2), stats.Second.Packets)
+	assert.Equal(t, uint64(100+packet.Metadata().Length), stats.Second.Bytes)
+	assert.Equal(t, map[string]TrafficCounters{
+		"tcp": {Packets: 1, Bytes: 100},
+		"udp": {Packets: 1, Bytes: uint64(packet.Metadata().Length)},
+	}, stats.Second.Protocols)
+
+	assert.Equal(t, uint(60), stats.Minute.Seconds)
+	assert.Equal(t, uint64(3), stats.Minute.Packets)
+	assert.Equal(t, TrafficCounters{Packets: 2, Bytes: 300}, stats.Minute.Protocols["tcp"])
+
+	// buckets are reused once their second is a minute old
+	meter.observe(trafficUDP, 10, now.Add(time.Minute))
+	stats = meter.Stats(now.Add(time.Minute + time.Second))
+	assert.Equal(t, map[string]TrafficCounters{"udp": {Packets: 1, Bytes: 10}}, stats.Second.Protocols)
+	assert.Equal(t, uint64(1), stats.Minute.Packets)
+}
@@ -19,7 +19,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net"
 	"os"
 	"regexp"
@@ -36,7 +36,8 @@ import (
 	concurrently "github.com/tejzpr/ordered-concurrently/v3"
 )
 
-var transformerLogger = log.New(os.Stderr, "[transformer] - ", log.LstdFlags)
+// logs of transformers created without `ContextLogger`, and of their translators created without it
+var transformerLogger = NewLogger(os.Stderr, slog.LevelInfo)
 
 type (
 	PcapTranslatorFactory = func(context.Context, bool, *PcapIface, *PcapEphemeralPorts) PcapTranslator
@@ -58,8 +59,13 @@ type (
 		translateICMPv6L3HeaderLayer(context.Context, fmt.Stringer, *layers.ICMPv6) fmt.Stringer
 		translateUDPLayer(context.Context, *layers.UDP) fmt.Stringer
 		translateTCPLayer(context.Context, *layers.TCP) fmt.Stringer
+		translateSCTPLayer(context.Context, *layers.SCTP) fmt.Stringer
 		translateTLSLayer(context.Context, *layers.TLS) fmt.Stringer
 		translateDNSLayer(context.Context, *layers.DNS) fmt.Stringer
+		translateDHCPv4Layer(context.Context, *layers.DHCPv4) fmt.Stringer
+		translateDHCPv6Layer(context.Context, *layers.DHCPv6) fmt.Stringer
+		translateSIPLayer(context.Context, *layers.SIP) fmt.Stringer
+		translateNTPLayer(context.Context, *layers.NTP) fmt.Stringer
 		translateErrorLayer(context.Context, *gopacket.DecodeFailure) fmt.Stringer
 		merge(context.Context, fmt.Stringer, fmt.Stringer) (fmt.Stringer, error)
 		finalize(context.Context, netIfaceIndex, *PcapIface, *uint64, *gopacket.Packet, bool, fmt.Stringer) (fmt.Stringer, error)
@@ -81,8 +87,9 @@ type (
 		translatorPool  *ants.PoolWithFunc
 		writerPool      *ants.MultiPoolWithFunc
 		writers         []io.Writer
+		router          *recordRouter
 		numWriters      *uint8
-		writeQueues     []chan *fmt.Stringer
+		writeQueues     []chan *pcapRecord
 		writeQueuesDone []chan struct{}
 		wg              *sync.WaitGroup
 		preserveOrder   bool
@@ -90,18 +97,65 @@ type (
 		apply           func(*pcapTranslatorWorker) error
 		counter         *atomic.Int64
 		filters         PcapFilters
-		debug, compat   bool
+		sampler         *flowSampler
+		budget          *latencyBudget
+		aggregator      *flowAggregator
+		drops           *packetDrops
+		// translations are dropped, instead of blocking publishing, if the queue of a writer is full
+		dropOnFullQueue bool
+		scope           *TraceScope
+		// payload rules are evaluated by workers: they may be expensive
+		payload *payloadRules
+		// RTT is always estimated, but the analysis is only translated when connection tracking is enabled
+		tcpAnalyzer *tcpAnalyzer
+		// L7 messages spanning multiple TCP segments are decoded out of reassembled streams
+		tcpReassembler *tcpReassembler
+		// fragments are reassembled before flows are sampled: only the 1st fragment carries ports
+		ipv4Defragmenter *ipv4Defragmenter
+		// translations outlive the capture: they are only aborted once drained, or when the drain deadline is exceeded
+		abort context.CancelCauseFunc
+		// `nil` unless `ContextPipelineTelemetry` is set
+		telemetry *PipelineTelemetry
+		// shared with the translator; see `ContextLogger`
+		logger *slog.Logger
+		// unix nanos of the last written translation, and of the last iteration of the reaper; see `Health`
+		writtenAt, reapedAt *atomic.Int64
+		debug, compat       bool
 	}
 
 	IPcapTransformer interface {
 		WaitDone(context.Context, *time.Duration)
 		Apply(context.Context, *gopacket.Packet, *uint64) error
+		Health() *TransformerHealth
+		FileHeader() PcapFileHeader
 	}
 
-	pcapWriteTask struct {
-		ctx         context.Context
-		writer      *uint8
+	// PcapFileHeader is implemented by translators whose translations depend on what was written before them into the same file;
+	// i/e: `pcapng` packets refer to interfaces which are declared once per file.
+	// Writers call it right before writing every translation, from the only goroutine that writes into files: rotations cannot split headers from translations.
+	PcapFileHeader interface {
+		// Header returns what must be written before `translation` into a file which declared `declared` interfaces so far, or `-1` if nothing was written into it yet,
+		// along with the number of interfaces declared by the file once it is written.
+		Header(translation []byte, declared int) ([]byte, int)
+	}
+
+	// pcapRecord is a translation along with the attributes used to route it into writers.
+	pcapRecord struct {
 		translation *fmt.Stringer
+		attributes  *recordAttributes
+		// translations of flows that did not carry a trace of interest are not written
+		outOfScope bool
+		// spans of the packet, if it is traced; the trace ends once the translation is published
+		tracer *pipelineTracer
+		// capture timestamp of the packet; see `ContextLatencyBudget`
+		capturedAt time.Time
+		serial     *uint64
+	}
+
+	pcapWriteTask struct {
+		ctx    context.Context
+		writer *uint8
+		record *pcapRecord
 	}
 
 	PcapIface struct {
@@ -112,6 +166,9 @@ type (
 
 	PcapEphemeralPorts struct {
 		Min, Max uint16
+		// range of ephemeral ports used by IPv6 sockets; if not set, `Min` and `Max` apply to both families.
+		// IPv4-mapped IPv6 addresses ( `::ffff:a.b.c.d` ) are IPv4.
+		Min6, Max6 uint16
 	}
 
 	ContextKey string
@@ -121,6 +178,80 @@ const (
 	ContextID      = ContextKey("id")
 	ContextLogName = ContextKey("logName")
 	ContextDebug   = ContextKey("debug")
+	// `*atomic.Bool` which replaces the `debug` argument of transformers, so that it may be toggled while they run
+	ContextDebugSwitch = ContextKey("debugSwitch")
+	// `*slog.Logger` which receives the logs of transformers and translators instead of `stderr`; see `NewLogger`
+	ContextLogger = ContextKey("logger")
+	// `[]string` of cookie names and `header:` prefixed header names
+	ContextSessionKeys = ContextKey("sessionKeys")
+	// `bool` to translate retransmitted TCP segments as references to the original ones
+	ContextCompactRetransmissions = ContextKey("compactRetransmissions")
+	// `[]string` of field paths to be included in, or excluded (`-` prefixed) from, JSON translations
+	ContextFields = ContextKey("fields")
+	// `bool` to score latency, loss, and connection rates against per destination baselines
+	ContextAnomalies = ContextKey("anomalies")
+	// `bool` to flag duplicate HTTP requests sent over different connections as retries or hedges
+	ContextRetries = ContextKey("retries")
+	// `bool` to attribute the latency of HTTP transactions to the setup of new connections
+	ContextConnectionSetup = ContextKey("connectionSetup")
+	// `*FlowEventHandlers` to be notified about connections, and HTTP requests and responses
+	ContextFlowEvents = ContextKey("flowEvents")
+	// `*TraceStrategy` to replace how trace context is extracted, and to trace-track non HTTP protocols
+	ContextTraceStrategy = ContextKey("traceStrategy")
+	// `[]string` of trace context schemes attempted in order: `cloud`, `w3c`, `grpc`, `b3`, `xray` and `datadog`; defaults to all
+	ContextTraceSchemes = ContextKey("traceSchemes")
+	// `[]string` of `[hash:]{header}[={regex}]` rules to extract trace context from custom headers; i/e: `hash:X-Request-Id`
+	ContextTraceHeaders = ContextKey("traceHeaders")
+	// `*TraceScope` to only write translations of flows which carried traces of interest
+	ContextTraceScope = ContextKey("traceScope")
+	// `uint` percentage of flows carrying traces which are trace-tracked; defaults to 100
+	ContextTraceTrackingPercent = ContextKey("traceTrackingPercent")
+	// `uint` N to trace-track at most N new flows per second; `0` means no limit
+	ContextTraceTrackingRate = ContextKey("traceTrackingRate")
+	// `[]string` of rules to stamp labels onto records of matching packets; i/e: `team=payments@port=8080`
+	ContextLabels = ContextKey("labels")
+	// `[]string` of `{name}={regex}` or `{name}=hex:{bytes}` rules matched against application payloads
+	ContextPayloadRules = ContextKey("payloadRules")
+	// `bool` to only translate packets whose payload matched any of the payload rules
+	ContextPayloadSelect = ContextKey("payloadSelect")
+	// `[]string` of `{protocol}:{port}` of Redis and Memcached servers; i/e: `redis:6379`, `memcached:11211`
+	ContextCachePorts = ContextKey("cachePorts")
+	// `bool` to replace Redis and Memcached keys with their keyed hash
+	ContextHashCacheKeys = ContextKey("hashCacheKeys")
+	// `[]string` of `{protocol}:{port}` of PostgreSQL and MySQL servers; i/e: `postgres:5432`, `mysql:3306`
+	ContextDBPorts = ContextKey("dbPorts")
+	// `bool` to include query text and error messages in translations of PostgreSQL and MySQL messages
+	ContextDBQueries = ContextKey("dbQueries")
+	// `[]string` of `{protocol}:{port}` of AMQP 0-9-1 and Kafka brokers; i/e: `amqp:5672`, `kafka:9092`
+	ContextBrokerPorts = ContextKey("brokerPorts")
+	// `uint` N to only translate packets of 1 out of every N flows; all instances sample the same flows
+	ContextFlowSampling = ContextKey("flowSampling")
+	// `uint` N to only translate the first N packets of every flow per interval; packets beyond it are aggregated
+	ContextFlowBudget = ContextKey("flowBudget")
+	// `time.Duration` interval to reset flow budgets and report top talkers; defaults to 1 minute
+	ContextFlowBudgetInterval = ContextKey("flowBudgetInterval")
+	// `*template.Template` used by the `template` format to render translations
+	ContextTemplate = ContextKey("template")
+	// `string` encoding of JSON translations: `json`, `cbor` or `msgpack`
+	ContextEncoding = ContextKey("encoding")
+	// `*MulticastGroups` to track multicast groups joined via IGMP and MLD
+	ContextMulticastGroups = ContextKey("multicastGroups")
+	// `*CaptureSummary` to count the anomalies found by JSON translators
+	ContextCaptureSummary = ContextKey("captureSummary")
+	// `*CorrelationIndex` to expose how JSON translators link responses to traced requests
+	ContextCorrelationIndex = ContextKey("correlationIndex")
+	// `*PipelineTelemetry` to measure, and trace, how packets go through all stages of transformers
+	ContextPipelineTelemetry = ContextKey("pipelineTelemetry")
+	// `time.Duration` which the p99 of the time since packets are captured until their translations are written must not exceed
+	ContextLatencyBudget = ContextKey("latencyBudget")
+	// `uint` max factor by which flow sampling is automatically increased while the latency budget is exceeded; 0 never engages it
+	ContextLatencyBudgetSampling = ContextKey("latencyBudgetSampling")
+	// `*DropCounters` to count packets which were not written, per reason
+	ContextDropCounters = ContextKey("dropCounters")
+	// `uint` 1 out of every N packets dropped for each reason is logged as a `dropped` record; 0 logs none
+	ContextDropRecords = ContextKey("dropRecords")
+	// `bool` to drop translations, instead of blocking, if the queue of a writer is full
+	ContextDropOnFullQueue = ContextKey("dropOnFullQueue")
 )
 
 //go:generate stringer -type=PcapTranslatorFmt
@@ -128,12 +259,20 @@ const (
 	TEXT PcapTranslatorFmt = iota
 	JSON
 	PROTO
+	PCAPNG
+	ECS
+	OTLP
+	TEMPLATE
 )
 
 var pcapTranslatorFmts = map[string]PcapTranslatorFmt{
-	"json":  JSON,
-	"text":  TEXT,
-	"proto": PROTO,
+	"json":     JSON,
+	"text":     TEXT,
+	"proto":    PROTO,
+	"pcapng":   PCAPNG,
+	"ecs":      ECS,
+	"otlp":     OTLP,
+	"template": TEMPLATE,
 }
 
 var translators sync.Map
@@ -147,6 +286,7 @@ const (
 	http11LineSeparator           = "\r\n"
 	http2RawFrameRegexStr         = `^\[FrameHeader\s(.+?)\]`
 	httpContentLengthHeader       = "Content-Length"
+	httpUserAgentHeader           = "User-Agent"
 	cloudTraceContextHeader       = "x-cloud-trace-context"
 	traceparentHeader             = "traceparent"
 
@@ -241,17 +381,17 @@ var (
 
 	traceAndSpanRegexStr = map[string]string{
 		cloudTraceContextHeader: `^(?P<trace>.+?)/(?P<span>.+?)(?:;o=.*)?$`,
-		traceparentHeader:       `^.+?-(?P<trace>.+?)-(?P<span>.+?)(?:-.+)?$`,
 	}
 	traceAndSpanRegex = map[string]*regexp.Regexp{
 		cloudTraceContextHeader: regexp.MustCompile(traceAndSpanRegexStr[cloudTraceContextHeader]),
-		traceparentHeader:       regexp.MustCompile(traceAndSpanRegexStr[traceparentHeader]),
 	}
 )
 
 var (
 	errUnavailableTranslation = errors.New("packet translation is unavailable")
 	errUnavailableTranslator  = errors.New("packet translator is unavailable")
+	errTranslationsDrained    = errors.New("all translations were written")
+	errDrainDeadlineExceeded  = errors.New("drain deadline exceeded")
 )
 
 func (t *PcapTransformer) writeTranslation(ctx context.Context, task *pcapWriteTask) error {
@@ -264,36 +404,70 @@ func (t *PcapTransformer) writeTranslation(ctx context.Context, task *pcapWriteT
 	case <-ctx.Done():
 		if *task.writer == 0 {
 			// best-effort: dump all non-written translations into `STDERR`
-			fmt.Fprintln(os.Stderr, (*task.translation).String())
+			fmt.Fprintln(os.Stderr, (*task.record.translation).String())
 		}
+		t.drops.drop(DropCancelled, task.record.serial)
 		return ctx.Err()
 	default:
-		_, err := t.translator.write(ctx, t.writers[*task.writer], task.translation)
+		writeAt := t.telemetry.now()
+		_, err := t.translator.write(ctx, t.writers[*task.writer], task.record.translation)
+		writtenAt := time.Now()
+		t.writtenAt.Store(writtenAt.UnixNano())
+		t.telemetry.observe(PipelineWrite, writeAt, writtenAt)
+		t.budget.observe(task.record.capturedAt, writtenAt)
 		return err
 	}
 }
 
 func (t *PcapTransformer) publishTranslation(
 	ctx context.Context,
-	translation *fmt.Stringer,
+	record *pcapRecord,
 ) error {
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
 	default:
-		if translation == nil {
+		if record == nil || record.translation == nil {
 			return fmt.Errorf("%s publishTranslation: %w",
 				*t.loggerPrefix, errUnavailableTranslation)
 		}
 	}
 
-	// fan-out translation into all writers
-	for _, translations := range t.writeQueues {
+	publishAt := t.telemetry.now()
+
+	if record.outOfScope {
+		t.drops.drop(DropOutOfScope, record.serial)
+	}
+
+	// fan-out translation into all writers whose routes accept it
+	for i, translations := range t.writeQueues {
+		if record.outOfScope || !t.router.accepts(i, record.attributes) {
+			// `Apply` committed all writers to write the translation
+			t.counter.Add(-1)
+			t.wg.Done()
+			continue
+		}
 		// if any of the consumers' buffers is full,
 		// the saturated/slower one will block and delay iterations.
 		// Blocking is more likely when `preserveOrder` is enabled.
-		translations <- translation
+		if !t.dropOnFullQueue {
+			translations <- record
+			continue
+		}
+		select {
+		case translations <- record:
+		default:
+			// overload is made visible as drops, so that other writers are not delayed
+			t.counter.Add(-1)
+			t.wg.Done()
+			t.drops.drop(DropQueueFull, record.serial)
+		}
 	}
+
+	published := t.telemetry.now()
+	t.telemetry.observe(PipelinePublish, publishAt, published)
+	record.tracer.span(PipelinePublish, publishAt, published)
+	record.tracer.end()
 	return nil
 }
 
@@ -303,16 +477,23 @@ func (t *PcapTransformer) produceTranslation(
 ) error {
 	translation := task.Run(ctx)
 	if translation == nil {
+		// the packet was dropped by the worker: `Apply` committed all writers to write its translation
+		rollbackTranslation(ctx, t)
 		return nil
 	}
-	return t.publishTranslation(ctx, translation.(*fmt.Stringer))
+	return t.publishTranslation(ctx, translation.(*pcapRecord))
 }
 
 func (t *PcapTransformer) produceTranslations(ctx context.Context) {
 	for translation := range t.och {
 		// translations are made available in the enqueued order
 		// consume translations and push them into translations consumers
-		if err := t.publishTranslation(ctx, translation.Value.(*fmt.Stringer)); err != nil {
+		record, _ := translation.Value.(*pcapRecord)
+		if err := t.publishTranslation(ctx, record); err != nil {
+			// packets without a translation were already counted by their worker
+			if record != nil {
+				t.drops.drop(DropCancelled, record.serial)
+			}
 			rollbackTranslation(ctx, t)
 		}
 	}
@@ -329,24 +510,32 @@ func (t *PcapTransformer) consumeTranslations(ctx context.Context, index *uint8)
 			// some translations may have been on-going when context was cancelled:
 			//   - fully consume the `writerQueue` and rollback the write commitment,
 			//   - block until `close` on the `writerQueue` is called by `WaitDone`
-			for translation := range t.writeQueues[*index] {
+			for record := range t.writeQueues[*index] {
 				// best-effort: dump all non-written translations into `STDERR`
 				if *index == 0 {
-					fmt.Fprintln(os.Stderr, (*translation).String())
+					fmt.Fprintln(os.Stderr, (*record.translation).String())
 				}
+				t.drops.drop(DropCancelled, record.serial)
 				droppedTranslations += 1
 				t.counter.Add(-1)
 				t.wg.Done()
 			}
-			transformerLogger.Printf("%s translations consumer DONE | writer:%d | dropped:%d\n", *t.loggerPrefix, *index+1, droppedTranslations)
+			t.logger.Info("translations consumer DONE",
+				"writer", *index+1, "dropped", droppedTranslations, "cause", context.Cause(ctx).Error())
 			close(t.writeQueuesDone[*index])
 			return ctx.Err()
 
-		case translation := <-t.writeQueues[*index]:
+		case record, ok := <-t.writeQueues[*index]:
+			if !ok {
+				// `WaitDone` closes the `writerQueue` only after all translations were written
+				t.logger.Info("translations consumer DONE", "writer", *index+1)
+				close(t.writeQueuesDone[*index])
+				return nil
+			}
 			task := &pcapWriteTask{
-				ctx:         ctx,
-				writer:      index,
-				translation: translation,
+				ctx:    ctx,
+				writer: index,
+				record: record,
 			}
 			if t.preserveOrder || t.connTracking {
 				// this is mostly blocking
@@ -365,7 +554,21 @@ func (t *PcapTransformer) waitForContextDone(ctx context.Context) error {
 	return ctx.Err()
 }
 
-// returns when all packets have been transformed and written
+// poolStats describes running and waiting tasks of worker pools; it is empty, and so not logged, if order is enforced:
+// worker pools are only created if order is not enforced.
+func (t *PcapTransformer) poolStats() slog.Attr {
+	if t.preserveOrder || t.connTracking {
+		return slog.Attr{}
+	}
+	return slog.Group("pools",
+		slog.Group("translators", slog.Int("running", t.translatorPool.Running()), slog.Int("waiting", t.translatorPool.Waiting())),
+		slog.Group("writers", slog.Int("running", t.writerPool.Running()), slog.Int("waiting", t.writerPool.Waiting())))
+}
+
+// WaitDone returns when all packets have been transformed and written, or when `timeout` is exceeded:
+//   - packets must no longer be applied: `Apply` rejects them as soon as the capture context is done,
+//   - translations which were already applied are drained: they are written even though `ctx` is done,
+//   - flows which are still open are summarized, and only then the transformer is aborted.
 func (t *PcapTransformer) WaitDone(ctx context.Context, timeout *time.Duration) {
 	ts := time.Now()
 	timer := time.NewTimer(*timeout)
@@ -373,25 +576,16 @@ func (t *PcapTransformer) WaitDone(ctx context.Context, timeout *time.Duration)
 	writeDoneChan := make(chan struct{})
 
 	go func(t *PcapTransformer, writeDone chan struct{}) {
-		if !t.preserveOrder && !t.connTracking {
-			transformerLogger.Printf("%s gracefully terminating | tp: %d/%d | wp: %d/%d | pending:%d | deadline: %v\n",
-				*t.loggerPrefix, t.translatorPool.Running(), t.translatorPool.Waiting(),
-				t.writerPool.Running(), t.writerPool.Waiting(), t.counter.Load(), timeout)
-		} else {
-			transformerLogger.Printf("%s gracefully terminating | pending: %d | deadline: %v\n", *t.loggerPrefix, t.counter.Load(), timeout)
-		}
+		t.logger.Info("gracefully terminating", t.poolStats(), "pending", t.counter.Load(), "deadline", timeout.String())
 		t.wg.Wait() // wait for all translations to be written
 		close(writeDone)
 	}(t, writeDoneChan)
 
 	select {
 	case <-timer.C:
-		if !t.preserveOrder && !t.connTracking {
-			transformerLogger.Printf("%s timed out waiting for graceful termination | tp: %d/%d | wp: %d/%d | pending:%d\n",
-				*t.loggerPrefix, t.translatorPool.Running(), t.translatorPool.Waiting(), t.writerPool.Running(), t.writerPool.Waiting(), t.counter.Load())
-		} else {
-			transformerLogger.Printf("%s timed out waiting for graceful termination | pending:%d\n", *t.loggerPrefix, t.counter.Load())
-		}
+		t.logger.Warn("timed out waiting for graceful termination", t.poolStats(), "pending", t.counter.Load())
+		// pending translations are dropped: consumers dump them into `STDERR` until their queues are closed
+		t.abort(errDrainDeadlineExceeded)
 		for _, writeQueue := range t.writeQueues {
 			close(writeQueue) // close writer channels
 		}
@@ -402,9 +596,7 @@ func (t *PcapTransformer) WaitDone(ctx context.Context, timeout *time.Duration)
 		if !timer.Stop() {
 			<-timer.C
 		}
-		transformerLogger.Printf("%s STOPPED | tp: %d/%d | wp: %d/%d | pending:%d | latency: %v\n",
-			*t.loggerPrefix, t.translatorPool.Running(), t.translatorPool.Waiting(),
-			t.writerPool.Running(), t.writerPool.Waiting(), t.counter.Load(), time.Since(ts))
+		t.logger.Info("STOPPED", t.poolStats(), "pending", t.counter.Load(), "latency", time.Since(ts).String())
 	}
 
 	for i, writeQueue := range t.writeQueues {
@@ -416,7 +608,7 @@ func (t *PcapTransformer) WaitDone(ctx context.Context, timeout *time.Duration)
 	_timeout := *timeout - time.Since(ts)
 	// if order is not enforced: there are 2 worker pools to be stopped
 	if _timeout > 0 && !t.preserveOrder && !t.connTracking {
-		transformerLogger.Printf("%s releasing worker pools | deadline: %v\n", *t.loggerPrefix, _timeout)
+		t.logger.Info("releasing worker pools", "deadline", _timeout.String())
 		var poolReleaserWG sync.WaitGroup
 		poolReleaserWG.Add(2)
 		go func(t *PcapTransformer, wg *sync.WaitGroup, deadline *time.Duration) {
@@ -428,28 +620,66 @@ func (t *PcapTransformer) WaitDone(ctx context.Context, timeout *time.Duration)
 			wg.Done()
 		}(t, &poolReleaserWG, &_timeout)
 		poolReleaserWG.Wait()
-		transformerLogger.Printf("%s released worker pools\n", *t.loggerPrefix)
+		t.logger.Info("released worker pools")
 	}
 
+	// the reaper and all other background tasks stop before open flows are summarized
+	t.abort(errTranslationsDrained)
+
 	// only safe to be called when nothing else is running
 	t.translator.done(ctx)
 
-	transformerLogger.Printf("%s TERMINATED | latency: %v\n", *t.loggerPrefix, time.Since(ts))
+	t.logger.Info("TERMINATED", "latency", time.Since(ts).String())
+}
+
+// FileHeader returns `nil` unless writers must write headers into files along with translations; see `PcapFileHeader`.
+func (t *PcapTransformer) FileHeader() PcapFileHeader {
+	if header, ok := t.translator.(PcapFileHeader); ok {
+		return header
+	}
+	return nil
 }
 
 func (t *PcapTransformer) Apply(ctx context.Context, packet *gopacket.Packet, serial *uint64) error {
+	var appliedAt time.Time
 	select {
 	case <-ctx.Done():
 		// reject applying transformer if context is already done.
+		t.drops.drop(DropCancelled, serial)
 		return ctx.Err()
 	default:
-		// applying transformer will write 1 translation into N>0 writers.
-		t.wg.Add(int(*t.numWriters))
-		t.counter.Add(int64(*t.numWriters))
+		// packets are measured since they were captured, even if they are not translated
+		appliedAt = t.telemetry.now()
+		t.telemetry.observe(PipelineCapture, (*packet).Metadata().Timestamp, appliedAt)
+		// the fragment completing an IPv4 datagram is translated as the whole datagram;
+		// i/e: DNS responses larger than the MTU can only be decoded once reassembled.
+		if datagram := t.ipv4Defragmenter.observe(*packet); datagram != nil {
+			packet = &datagram
+		}
+		if !t.sampler.sample(*packet) || !t.budget.sample(*packet) {
+			// the flow of this packet is not sampled: it must not be translated nor written
+			t.drops.drop(DropSampled, serial)
+			return nil
+		}
 	}
+	// packets are applied in capture order, but translated concurrently:
+	// TCP analysis depends on the order of segments, so it must be done before translating.
+	t.tcpAnalyzer.observe(*packet, *serial)
+	t.tcpReassembler.observe(*packet)
+	if !t.aggregator.admit(*packet) {
+		// the flow exhausted its budget: the packet is only counted, but connection states still see it
+		t.drops.drop(DropFlowBudget, serial)
+		return nil
+	}
+	// applying transformer will write 1 translation into N>0 writers.
+	t.wg.Add(int(*t.numWriters))
+	t.counter.Add(int64(*t.numWriters))
 	// It is assumed that packets will be produced faster than translations and writing operations, so:
 	//   - process/translate packets concurrently in order to avoid blocking `gopacket` packets channel as much as possible.
-	worker := newPcapTranslatorWorker(t.ifaces, t.iface, t.filters, serial, packet, t.translator, t.connTracking, t.compat)
+	worker := newPcapTranslatorWorker(t.ifaces, t.iface, t.filters, serial, packet, t.translator, t.router, t.scope, t.payload, t.connTracking, t.compat)
+	worker.logger, worker.drops = t.logger, t.drops
+	worker.telemetry, worker.tracer = t.telemetry, t.telemetry.trace(t.iface, *serial)
+	worker.tracer.span(PipelineCapture, (*packet).Metadata().Timestamp, appliedAt)
 	return t.apply(worker)
 }
 
@@ -466,6 +696,16 @@ func (t *PcapTransformer) writeTranslationFn(ctx context.Context, task interface
 	return t.writeTranslation(ctx, task.(*pcapWriteTask))
 }
 
+// registerTranslator makes a `PcapTranslator` available for the given format:
+//   - translators are only compiled when their build tag is set,
+//     so they must register themselves from `init`.
+//   - only the 1st registration of a format is used: others are reported as conflicts.
+func registerTranslator(format PcapTranslatorFmt, factory PcapTranslatorFactory) {
+	if _, loaded := translators.LoadOrStore(format, factory); loaded {
+		recordTranslatorConflict(fmt.Errorf("format %v is registered more than once", format))
+	}
+}
+
 func newTranslator(
 	ctx context.Context,
 	debug bool,
@@ -473,6 +713,10 @@ func newTranslator(
 	ephemerals *PcapEphemeralPorts,
 	format PcapTranslatorFmt,
 ) (PcapTranslator, error) {
+	if err := validateTranslators(ctx); err != nil {
+		return nil, fmt.Errorf("[%d/%s] - %w", iface.Index, iface.Name, err)
+	}
+
 	if factory, ok := translators.Load(format); ok {
 		return factory.(PcapTranslatorFactory)(ctx, debug, iface, ephemerals), nil
 	}
@@ -497,7 +741,7 @@ func rollbackTranslation(
 // Similarly, sinking translations into files can be safely done concurrently ( in whatever order goroutines are scheduled )
 func provideWorkerPools(ctx context.Context, transformer *PcapTransformer, numWriters *uint8) {
 	poolOpts := ants.Options{
-		Logger:      transformerLogger,
+		Logger:      slog.NewLogLogger(transformer.logger.Handler(), slog.LevelWarn),
 		PreAlloc:    false,
 		Nonblocking: false,
 		// see: https://github.com/panjf2000/ants/blob/v2.10.0/worker_loop_queue.go#L74
@@ -506,10 +750,10 @@ func provideWorkerPools(ctx context.Context, transformer *PcapTransformer, numWr
 	}
 
 	poolOpts.PanicHandler = func(i interface{}) {
+		transformer.drops.drop(DropPanic, nil)
 		rollbackTranslation(ctx, transformer)
 		// if any go routine panics, recover and print the stack
-		transformerLogger.Printf("%s panic: %+v\n%s\n",
-			*transformer.loggerPrefix, i, string(debug.Stack()))
+		transformer.logger.Error("panic", "error", fmt.Sprintf("%+v", i), "stack", string(debug.Stack()))
 	}
 
 	poolOptions := ants.WithOptions(poolOpts)
@@ -519,11 +763,14 @@ func provideWorkerPools(ctx context.Context, transformer *PcapTransformer, numWr
 	translatorPoolFn := func(i interface{}) {
 		select {
 		case <-ctx.Done():
+			transformer.drops.drop(DropCancelled, i.(*pcapTranslatorWorker).serial)
 			rollbackTranslation(ctx, transformer)
 			return
 		default:
 			if err := transformer.translatePacketFn(ctx, i); err != nil {
-				transformerLogger.Printf("%s translation failed: %+v\n", *transformer.loggerPrefix, err)
+				transformer.logger.Error("translation failed", "error", err.Error())
+				// translations are only rejected once the context is done
+				transformer.drops.drop(DropCancelled, i.(*pcapTranslatorWorker).serial)
 				rollbackTranslation(ctx, transformer)
 			}
 		}
@@ -579,6 +826,7 @@ func provideStrategy(
 		apply = func(t *PcapTransformer, w *pcapTranslatorWorker) error {
 			select {
 			case <-ctx.Done():
+				transformer.drops.drop(DropCancelled, w.serial)
 				rollbackTranslation(ctx, transformer)
 				return ctx.Err()
 			default:
@@ -599,7 +847,8 @@ func provideStrategy(
 	transformer.apply = func(w *pcapTranslatorWorker) error {
 		select {
 		case <-ctx.Done():
-			transformerLogger.Printf("%s #:%d | translation aborted", *w.loggerPrefix, *w.serial)
+			transformer.logger.Warn("translation aborted", "serial", *w.serial)
+			transformer.drops.drop(DropCancelled, w.serial)
 			// `Apply` commits `transformer` to write the packet translation,
 			// so if the context is done, commitment must be rolled back
 			rollbackTranslation(ctx, transformer)
@@ -623,19 +872,58 @@ func newTransformer(
 	debug, compat bool,
 ) (IPcapTransformer, error) {
 	pcapFmt := pcapTranslatorFmts[*format]
+	// the transformer keeps all values, but it is not cancelled along with the capture:
+	// packets applied before the capture context was done are drained by `WaitDone`
+	ctx, abort := context.WithCancelCause(context.WithoutCancel(ctx))
+	// translators log using the same logger, which describes the interface
+	logger := newContextLogger(ctx, debug).With(
+		slog.Group("iface", slog.Int("index", int(iface.Index)), slog.String("name", iface.Name)))
+	ctx = context.WithValue(ctx, ContextLogger, logger)
+	// translators which track flows report every iteration of their reaper
+	reapedAt := new(atomic.Int64)
+	ctx = context.WithValue(ctx, contextReapedAt, reapedAt)
 	translator, err := newTranslator(ctx, debug, iface, ephemerals, pcapFmt)
 	if err != nil {
+		abort(err)
 		return nil, err
 	}
 
 	loggerPrefix := fmt.Sprintf("[%d/%s] -", iface.Index, iface.Name)
 
+	samplingRate, _ := ctx.Value(ContextFlowSampling).(uint)
+	budget, _ := ctx.Value(ContextFlowBudget).(uint)
+	scope, _ := ctx.Value(ContextTraceScope).(*TraceScope)
+	payloadRuleSet, _ := ctx.Value(ContextPayloadRules).([]string)
+	payloadSelect, _ := ctx.Value(ContextPayloadSelect).(bool)
+	// an invalid rule must not be ignored: with `payloadSelect`, ignoring all rules translates all packets
+	payload, err := newPayloadRules(payloadRuleSet, payloadSelect)
+	if err != nil {
+		abort(err)
+		return nil, err
+	}
+	budgetInterval, _ := ctx.Value(ContextFlowBudgetInterval).(time.Duration)
+	var onTopTalkers func(*TopTalkersEvent)
+	if handlers, ok := ctx.Value(ContextFlowEvents).(*FlowEventHandlers); ok && handlers != nil {
+		onTopTalkers = handlers.OnTopTalkers
+	}
+	// database protocols are not self-describing: their messages are only framed on configured ports
+	dbPorts, _ := ctx.Value(ContextDBPorts).([]string)
+	// connections are counted by state along with the rest of the capture summary
+	summary, _ := ctx.Value(ContextCaptureSummary).(*CaptureSummary)
+	telemetry, _ := ctx.Value(ContextPipelineTelemetry).(*PipelineTelemetry)
+	latencyBudget, _ := ctx.Value(ContextLatencyBudget).(time.Duration)
+	budgetSampling, _ := ctx.Value(ContextLatencyBudgetSampling).(uint)
+	// engines share their counters, so that packets they discard are reported along with those dropped by transformers
+	dropCounters, _ := ctx.Value(ContextDropCounters).(*DropCounters)
+	dropRecords, _ := ctx.Value(ContextDropRecords).(uint)
+	dropOnFullQueue, _ := ctx.Value(ContextDropOnFullQueue).(bool)
+
 	numWriters := uint8(len(writers))
 	// not using `io.MultiWriter` as it writes to all writers sequentially
-	writeQueues := make([]chan *fmt.Stringer, numWriters)
+	writeQueues := make([]chan *pcapRecord, numWriters)
 	writeQueuesDone := make([]chan struct{}, numWriters)
 	for i := range writers {
-		writeQueues[i] = make(chan *fmt.Stringer, 50)
+		writeQueues[i] = make(chan *pcapRecord, 50)
 		writeQueuesDone[i] = make(chan struct{})
 	}
 
@@ -672,25 +960,44 @@ func newTransformer(
 	// same transformer, multiple strategies
 	// via multiple translator implementations
 	transformer := &PcapTransformer{
-		wg:              new(sync.WaitGroup),
-		ctx:             ctx,
-		iface:           iface,
-		ifaces:          ifaces,
-		filters:         filters,
-		ephemerals:      ephemerals,
-		loggerPrefix:    &loggerPrefix,
-		translator:      translator,
-		writers:         writers,
-		numWriters:      &numWriters,
-		writeQueues:     writeQueues,
-		writeQueuesDone: writeQueuesDone,
-		preserveOrder:   preserveOrder || connTracking,
-		connTracking:    connTracking,
-		counter:         new(atomic.Int64),
-		debug:           debug,
-		compat:          compat,
+		wg:               new(sync.WaitGroup),
+		ctx:              ctx,
+		iface:            iface,
+		ifaces:           ifaces,
+		filters:          filters,
+		sampler:          newFlowSampler(samplingRate),
+		budget:           newLatencyBudget(latencyBudget, samplingRate, budgetSampling, logger),
+		aggregator:       newFlowAggregator(iface, budget, budgetInterval, onTopTalkers),
+		drops:            newPacketDrops(dropCounters, dropRecords, logger),
+		dropOnFullQueue:  dropOnFullQueue,
+		scope:            scope,
+		payload:          payload,
+		ephemerals:       ephemerals,
+		loggerPrefix:     &loggerPrefix,
+		translator:       translator,
+		writers:          writers,
+		router:           newRecordRouter(ctx, writers),
+		numWriters:       &numWriters,
+		writeQueues:      writeQueues,
+		writeQueuesDone:  writeQueuesDone,
+		preserveOrder:    preserveOrder || connTracking,
+		connTracking:     connTracking,
+		counter:          new(atomic.Int64),
+		writtenAt:        new(atomic.Int64),
+		reapedAt:         reapedAt,
+		abort:            abort,
+		debug:            debug,
+		compat:           compat,
+		telemetry:        telemetry,
+		logger:           logger,
+		tcpAnalyzer:      newTCPAnalyzer(summary),
+		tcpReassembler:   newTCPReassembler(newDBPorts(dbPorts, false)),
+		ipv4Defragmenter: newIPv4Defragmenter(),
 	}
 
+	// nothing has been written yet: translations are stalled only if they are not written for a while after creation
+	transformer.writtenAt.Store(time.Now().UnixNano())
+
 	provideStrategy(ctx, transformer, preserveOrder, connTracking)
 
 	// `preserveOrder==true` causes writes to be sequential and blocking per `io.Writer`.
@@ -703,6 +1010,15 @@ func newTransformer(
 		provideWorkerPools(ctx, transformer, &numWriters)
 	}
 
+	if transformer.budget != nil {
+		go transformer.budget.watch(ctx)
+	}
+
+	if transformer.aggregator != nil {
+		transformer.aggregator.logger = logger
+		go transformer.aggregator.report(ctx)
+	}
+
 	// spawn consumers for all `io.Writer`s
 	// 1 consumer goroutine per `io.Writer`
 	for i := range writeQueues {
@@ -710,7 +1026,7 @@ func newTransformer(
 		go transformer.consumeTranslations(ctx, &index)
 	}
 
-	transformerLogger.Printf("%s CREATED | format:%s | writers:%d\n", loggerPrefix, *format, numWriters)
+	logger.Info("CREATED", "format", *format, "writers", numWriters, "sampling", max(samplingRate, 1), "budget", budget)
 
 	return transformer, nil
 }
@@ -0,0 +1,118 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	mapset "github.com/deckarep/golang-set/v2"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+// slowTestWriter counts writes, and takes its time doing so: translations are still pending when the capture stops.
+type slowTestWriter struct {
+	mu     sync.Mutex
+	writes int
+}
+
+func (w *slowTestWriter) Write(p []byte) (int, error) {
+	time.Sleep(5 * time.Millisecond)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.writes += 1
+	return len(p), nil
+}
+
+func (w *slowTestWriter) count() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.writes
+}
+
+func newTransformerTestPacket(t *testing.T, seq uint32, syn bool) gopacket.Packet {
+	packet := newTestPacket(t, newTestIPv4(net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)),
+		&layers.TCP{SrcPort: 40000, DstPort: 443, Seq: seq, SYN: syn, ACK: !syn, Window: 1024},
+		gopacket.Payload(make([]byte, 10)))
+	packet.Metadata().Timestamp = time.Now()
+	return packet
+}
+
+// TestTransformerDrain verifies that packets applied before the capture stops are written,
+// that packets applied after it are rejected, and that flows which are still open are summarized;
+// all packets are measured along the way, and 1 out of every 5 is traced.
+func TestTransformerDrain(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	reasons := []string{}
+	handlers := &FlowEventHandlers{
+		OnFlowSummary: func(event *FlowSummaryEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			reasons = append(reasons, event.Reason)
+		},
+	}
+
+	traces := atomic.Int64{}
+	telemetry := NewPipelineTelemetry(5, func(*PipelineTrace) { traces.Add(1) })
+
+	ctx := context.WithValue(context.Background(), ContextFlowEvents, handlers)
+	ctx, cancel := context.WithCancel(context.WithValue(ctx, ContextPipelineTelemetry, telemetry))
+	defer cancel()
+
+	writer := &slowTestWriter{}
+	format := "json"
+	transformer, err := NewConnTrackTransformer(ctx,
+		&PcapIface{Index: 1, Name: "eth0", Addrs: mapset.NewSet[string]()}, &PcapEphemeralPorts{Min: 32768, Max: 60999},
+		NewPcapFilters(), []io.Writer{writer}, &format, false, false)
+	if errors.Is(err, errUnavailableTranslator) {
+		t.Skip("the JSON translator is only available with the `json` build tag")
+	}
+	assert.NoError(t, err)
+
+	const packets = 20
+	for i := range packets {
+		packet := newTransformerTestPacket(t, uint32(i), i == 0)
+		serial := uint64(i)
+		assert.NoError(t, transformer.Apply(ctx, &packet, &serial))
+	}
+
+	cancel()
+
+	packet := newTransformerTestPacket(t, packets, false)
+	serial := uint64(packets)
+	assert.ErrorIs(t, transformer.Apply(ctx, &packet, &serial), context.Canceled)
+
+	deadline := 5 * time.Second
+	transformer.WaitDone(ctx, &deadline)
+
+	assert.Equal(t, packets, writer.count())
+	assert.Zero(t, transformer.Health().Pending)
+	assert.Equal(t, uint64(packets), telemetry.Stats()[PipelineWrite].Count)
+	assert.Equal(t, int64(packets/5), traces.Load())
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{flowSummaryCaptureEnd}, reasons)
+}
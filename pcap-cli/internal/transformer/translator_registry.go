@@ -0,0 +1,156 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/gopacket"
+)
+
+var (
+	errConflictingTranslators = errors.New("conflicting translators")
+
+	// `init` cannot fail: conflicting registrations are recorded, and reported when creating translators.
+	translatorConflicts   []error
+	translatorConflictsMu sync.Mutex
+)
+
+func recordTranslatorConflict(err error) {
+	translatorConflictsMu.Lock()
+	defer translatorConflictsMu.Unlock()
+	translatorConflicts = append(translatorConflicts, err)
+}
+
+// validateTranslators returns all conflicts that would make translations depend on registration or iteration order:
+//   - formats registered by more than one translator,
+//   - layer types handled by more than one layer translator, or both handled and skipped,
+//   - content detection rules that claim the same traffic; i/e: a port configured both as a cache and a database.
+func validateTranslators(ctx context.Context) error {
+	translatorConflictsMu.Lock()
+	conflicts := append([]error{}, translatorConflicts...)
+	translatorConflictsMu.Unlock()
+
+	conflicts = append(conflicts, validateLayerTranslators(packetLayerTranslators, packetLayerTranslatorsMap, skippedLayersList)...)
+	conflicts = append(conflicts, validateContentDetection(ctx)...)
+
+	if len(conflicts) == 0 {
+		return nil
+	}
+	return errors.Join(append([]error{errConflictingTranslators}, conflicts...)...)
+}
+
+func layerTranslatorID(translator packetLayerTranslator) uintptr {
+	return reflect.ValueOf(translator).Pointer()
+}
+
+// validateLayerTranslators verifies that there is exactly one translator per layer:
+// alternatives per layer must be mapped from a single layer type.
+func validateLayerTranslators(
+	alternatives [][]packetLayerTranslator,
+	translators layersTranslators,
+	skipped []gopacket.LayerType,
+) []error {
+	conflicts := []error{}
+
+	layerTypes := make(map[uintptr][]string, len(translators))
+	for layerType, translator := range translators {
+		id := layerTranslatorID(translator)
+		layerTypes[id] = append(layerTypes[id], layerType.String())
+	}
+
+	for layer, translators := range alternatives {
+		for alternative, translator := range translators {
+			mappedFrom := layerTypes[layerTranslatorID(translator)]
+			sort.Strings(mappedFrom)
+			switch len(mappedFrom) {
+			case 0:
+				conflicts = append(conflicts, fmt.Errorf("layer translator [%d][%d] is not mapped from any layer type", layer, alternative))
+			case 1:
+			default:
+				conflicts = append(conflicts, fmt.Errorf("layer translator [%d][%d] is mapped from many layer types: %s",
+					layer, alternative, strings.Join(mappedFrom, ",")))
+			}
+		}
+	}
+
+	for _, layerType := range skipped {
+		if _, ok := translators[layerType]; ok {
+			conflicts = append(conflicts, fmt.Errorf("layer type %s is both translated and skipped", layerType))
+		}
+	}
+
+	return conflicts
+}
+
+// validateContentDetection verifies that application layer detectors do not claim the same flows.
+func validateContentDetection(ctx context.Context) []error {
+	conflicts := []error{}
+
+	if traces, ok := ctx.Value(ContextTraceStrategy).(*TraceStrategy); ok && traces != nil {
+		protocols := make(map[string]int, len(traces.Flows))
+		for index, flow := range traces.Flows {
+			if flow == nil {
+				conflicts = append(conflicts, fmt.Errorf("flow strategy #%d is nil", index))
+				continue
+			}
+			if previous, ok := protocols[flow.Protocol()]; ok {
+				conflicts = append(conflicts, fmt.Errorf("flow strategies #%d and #%d detect the same protocol: %s",
+					previous, index, flow.Protocol()))
+				continue
+			}
+			protocols[flow.Protocol()] = index
+		}
+	}
+
+	// ports are `{protocol}:{port}`; detectors are attempted in order, so the 1st one would silently win
+	claims := make(map[uint16]string)
+	claim := func(source string, entries []string) {
+		for _, entry := range entries {
+			protocol, rawPort, ok := strings.Cut(strings.TrimSpace(entry), ":")
+			if !ok {
+				continue
+			}
+			port, err := strconv.ParseUint(rawPort, 10, 16)
+			if err != nil {
+				continue
+			}
+			claimant := source + "/" + strings.ToLower(protocol)
+			if previous, ok := claims[uint16(port)]; ok && previous != claimant {
+				conflicts = append(conflicts, fmt.Errorf("port %d is claimed by %s and %s", port, previous, claimant))
+				continue
+			}
+			claims[uint16(port)] = claimant
+		}
+	}
+	if cachePorts, ok := ctx.Value(ContextCachePorts).([]string); ok {
+		claim("cache", cachePorts)
+	}
+	if dbPorts, ok := ctx.Value(ContextDBPorts).([]string); ok {
+		claim("db", dbPorts)
+	}
+	if brokerPorts, ok := ctx.Value(ContextBrokerPorts).([]string); ok {
+		claim("broker", brokerPorts)
+	}
+
+	return conflicts
+}
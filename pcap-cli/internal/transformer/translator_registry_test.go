@@ -0,0 +1,71 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestLayerTranslatorsRegistry verifies that every layer is handled by exactly one translator.
+func TestLayerTranslatorsRegistry(t *testing.T) {
+	t.Parallel()
+
+	assert.Empty(t, validateLayerTranslators(packetLayerTranslators, packetLayerTranslatorsMap, skippedLayersList))
+
+	translate := func(context.Context, *pcapTranslatorWorker, bool) fmt.Stringer { return nil }
+	unmapped := func(context.Context, *pcapTranslatorWorker, bool) fmt.Stringer { return nil }
+
+	conflicts := validateLayerTranslators(
+		[][]packetLayerTranslator{{translate, unmapped}},
+		layersTranslators{
+			layers.LayerTypeTCP:       translate,
+			layers.LayerTypeUDP:       translate,
+			gopacket.LayerTypePayload: unmapped,
+		},
+		[]gopacket.LayerType{gopacket.LayerTypePayload})
+	if assert.Len(t, conflicts, 2) {
+		assert.ErrorContains(t, conflicts[0], "[0][0] is mapped from many layer types: TCP,UDP")
+		assert.ErrorContains(t, conflicts[1], "Payload is both translated and skipped")
+	}
+}
+
+// TestContentDetectionConflicts verifies that detectors claiming the same flows are reported.
+func TestContentDetectionConflicts(t *testing.T) {
+	t.Parallel()
+
+	assert.NoError(t, validateTranslators(context.Background()))
+
+	ctx := context.WithValue(context.Background(), ContextCachePorts, []string{"redis:6379", "memcached:11211"})
+	ctx = context.WithValue(ctx, ContextDBPorts, []string{"postgres:5432", "mysql:3306"})
+	assert.NoError(t, validateTranslators(ctx))
+
+	ctx = context.WithValue(ctx, ContextDBPorts, []string{"postgres:6379", "postgres:5432", "mysql:5432"})
+	ctx = context.WithValue(ctx, ContextTraceStrategy, &TraceStrategy{
+		Flows: []FlowStrategy{&testFlowStrategy{}, nil, &testFlowStrategy{}},
+	})
+
+	err := validateTranslators(ctx)
+	assert.ErrorIs(t, err, errConflictingTranslators)
+	assert.ErrorContains(t, err, "flow strategy #1 is nil")
+	assert.ErrorContains(t, err, "flow strategies #0 and #2 detect the same protocol: test")
+	assert.ErrorContains(t, err, "port 6379 is claimed by cache/redis and db/postgres")
+	assert.ErrorContains(t, err, "port 5432 is claimed by db/postgres and db/mysql")
+}
@@ -17,6 +17,7 @@ package transformer
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"net/netip"
 	"runtime/debug"
 	"sync"
@@ -35,10 +36,17 @@ type (
 		serial     *uint64
 		packet     *gopacket.Packet
 		translator PcapTranslator
+		router     *recordRouter
+		scope      *TraceScope
+		payload    *payloadRules
 		conntrack  bool
 		compat     bool
 
-		loggerPrefix *string
+		logger *slog.Logger
+		drops  *packetDrops
+
+		telemetry *PipelineTelemetry
+		tracer    *pipelineTracer
 	}
 
 	packetLayerTranslator = func(context.Context, *pcapTranslatorWorker, bool) fmt.Stringer
@@ -47,11 +55,17 @@ type (
 	httpRequest struct {
 		timestamp   *time.Time
 		url, method *string
+		// gRPC method: `/{package}.{service}/{method}`
+		rpc *string
 	}
 
 	traceAndSpan struct {
 		traceID, spanID *string
 		streamID        *uint32
+		// only available if extracted by the default extractor
+		scheme traceScheme
+		// members of W3C `tracestate`
+		state map[string]string
 	}
 )
 
@@ -104,6 +118,10 @@ var (
 			func(ctx context.Context, w *pcapTranslatorWorker, deep bool) fmt.Stringer {
 				return w.translateUDPLayer(ctx, deep)
 			},
+			// [2][4]
+			func(ctx context.Context, w *pcapTranslatorWorker, deep bool) fmt.Stringer {
+				return w.translateSCTPLayer(ctx, deep)
+			},
 		},
 
 		// [3]: L7
@@ -116,6 +134,22 @@ var (
 			func(ctx context.Context, w *pcapTranslatorWorker, deep bool) fmt.Stringer {
 				return w.translateTLSLayer(ctx, deep)
 			},
+			// [3][2]
+			func(ctx context.Context, w *pcapTranslatorWorker, deep bool) fmt.Stringer {
+				return w.translateDHCPv4Layer(ctx, deep)
+			},
+			// [3][3]
+			func(ctx context.Context, w *pcapTranslatorWorker, deep bool) fmt.Stringer {
+				return w.translateDHCPv6Layer(ctx, deep)
+			},
+			// [3][4]
+			func(ctx context.Context, w *pcapTranslatorWorker, deep bool) fmt.Stringer {
+				return w.translateSIPLayer(ctx, deep)
+			},
+			// [3][5]
+			func(ctx context.Context, w *pcapTranslatorWorker, deep bool) fmt.Stringer {
+				return w.translateNTPLayer(ctx, deep)
+			},
 		},
 	}
 
@@ -129,8 +163,13 @@ var (
 		layers.LayerTypeICMPv6:   packetLayerTranslators[2][1],
 		layers.LayerTypeTCP:      packetLayerTranslators[2][2],
 		layers.LayerTypeUDP:      packetLayerTranslators[2][3],
+		layers.LayerTypeSCTP:     packetLayerTranslators[2][4],
 		layers.LayerTypeDNS:      packetLayerTranslators[3][0],
 		layers.LayerTypeTLS:      packetLayerTranslators[3][1],
+		layers.LayerTypeDHCPv4:   packetLayerTranslators[3][2],
+		layers.LayerTypeDHCPv6:   packetLayerTranslators[3][3],
+		layers.LayerTypeSIP:      packetLayerTranslators[3][4],
+		layers.LayerTypeNTP:      packetLayerTranslators[3][5],
 		layers.LayerTypeARP: func(
 			ctx context.Context,
 			w *pcapTranslatorWorker,
@@ -161,9 +200,9 @@ var (
 		},
 	}
 
+	// layers without translators which must not be reported as unimplemented
 	skippedLayersList = []gopacket.LayerType{
 		gopacket.LayerTypePayload,
-		gopacket.LayerTypeDecodeFailure,
 		layers.LayerTypeLinuxSLL,
 	}
 	skippedLayers = mapset.NewSet(skippedLayersList...)
@@ -204,8 +243,9 @@ func (w *pcapTranslatorWorker) translateLayer(
 	case *layers.ICMPv6:
 		icmp6 := w.translator.translateICMPv6Layer(ctx, lType)
 
-		// [ToDo]: handle layers.ICMPv6TypePacketTooBig
+		// errors embed the original packet; `packet too big` also carries the MTU
 		if lType.TypeCode.Type() == layers.ICMPv6TypeDestinationUnreachable ||
+			lType.TypeCode.Type() == layers.ICMPv6TypePacketTooBig ||
 			lType.TypeCode.Type() == layers.ICMPv6TypeTimeExceeded {
 			return w.translator.translateICMPv6L3HeaderLayer(ctx, icmp6, lType)
 		}
@@ -232,10 +272,20 @@ func (w *pcapTranslatorWorker) translateLayer(
 		return w.translator.translateTCPLayer(ctx, lType)
 	case *layers.UDP:
 		return w.translator.translateUDPLayer(ctx, lType)
+	case *layers.SCTP:
+		return w.translator.translateSCTPLayer(ctx, lType)
 	case *layers.DNS:
 		return w.translator.translateDNSLayer(ctx, lType)
 	case *layers.TLS:
 		return w.translator.translateTLSLayer(ctx, lType)
+	case *layers.DHCPv4:
+		return w.translator.translateDHCPv4Layer(ctx, lType)
+	case *layers.DHCPv6:
+		return w.translator.translateDHCPv6Layer(ctx, lType)
+	case *layers.SIP:
+		return w.translator.translateSIPLayer(ctx, lType)
+	case *layers.NTP:
+		return w.translator.translateNTPLayer(ctx, lType)
 	case *gopacket.DecodeFailure:
 		// see: https://github.com/google/gopacket/blob/v1.1.19/decode.go#L118-L126
 		return w.translator.translateErrorLayer(ctx, lType)
@@ -282,6 +332,10 @@ func (w *pcapTranslatorWorker) translateUDPLayer(ctx context.Context, deep bool)
 	return w.translateLayer(ctx, layers.LayerTypeUDP, deep)
 }
 
+func (w *pcapTranslatorWorker) translateSCTPLayer(ctx context.Context, deep bool) fmt.Stringer {
+	return w.translateLayer(ctx, layers.LayerTypeSCTP, deep)
+}
+
 func (w *pcapTranslatorWorker) translateDNSLayer(ctx context.Context, deep bool) fmt.Stringer {
 	return w.translateLayer(ctx, layers.LayerTypeDNS, deep)
 }
@@ -308,6 +362,22 @@ func (w *pcapTranslatorWorker) translateTLSLayer(ctx context.Context, deep bool)
 	return w.translateLayer(ctx, layers.LayerTypeTLS, deep)
 }
 
+func (w *pcapTranslatorWorker) translateDHCPv4Layer(ctx context.Context, deep bool) fmt.Stringer {
+	return w.translateLayer(ctx, layers.LayerTypeDHCPv4, deep)
+}
+
+func (w *pcapTranslatorWorker) translateDHCPv6Layer(ctx context.Context, deep bool) fmt.Stringer {
+	return w.translateLayer(ctx, layers.LayerTypeDHCPv6, deep)
+}
+
+func (w *pcapTranslatorWorker) translateSIPLayer(ctx context.Context, deep bool) fmt.Stringer {
+	return w.translateLayer(ctx, layers.LayerTypeSIP, deep)
+}
+
+func (w *pcapTranslatorWorker) translateNTPLayer(ctx context.Context, deep bool) fmt.Stringer {
+	return w.translateLayer(ctx, layers.LayerTypeNTP, deep)
+}
+
 func (w *pcapTranslatorWorker) translateErrorLayer(ctx context.Context, deep bool) fmt.Stringer {
 	return w.translateLayer(ctx, gopacket.LayerTypeDecodeFailure, deep)
 }
@@ -351,8 +421,20 @@ func (w *pcapTranslatorWorker) isIPv4Allowed(
 		return src, dst, false
 	}
 
-	if !w.filters.HasIPv4s() {
-		// fail open: ALL IPv4s are allowed
+	if w.filters.HasDeniedIPv4s() &&
+		(w.filters.DeniesIPv4Addr(src) || w.filters.DeniesIPv4Addr(dst)) {
+		// deny overrides allow: it does not matter if the other side is allowed
+		return src, dst, false
+	}
+
+	if !w.filters.HasIPv4s() && !w.filters.HasAllowedHosts() {
+		// fail open: ALL IPv4s are allowed; unless names are allowed, as their IPs may not have been learned yet
+		return src, dst, true
+	}
+
+	if w.filters.HasAllowedHosts() &&
+		(w.filters.AllowsHostAddr(src) || w.filters.AllowsHostAddr(dst)) {
+		// the other side of packets to or from allowed names is never known in advance
 		return src, dst, true
 	}
 
@@ -375,14 +457,26 @@ func (w *pcapTranslatorWorker) isIPv6Allowed(
 		return src, dst, false
 	}
 
-	if !w.filters.HasIPv6s() {
-		// fail open: ALL IPv6s are allowed
+	if w.filters.HasDeniedIPv6s() &&
+		(w.filters.DeniesIPv6Addr(src) || w.filters.DeniesIPv6Addr(dst)) {
+		// deny overrides allow: it does not matter if the other side is allowed
+		return src, dst, false
+	}
+
+	if !w.filters.HasIPv6s() && !w.filters.HasAllowedHosts() {
+		// fail open: ALL IPv6s are allowed; unless names are allowed, as their IPs may not have been learned yet
+		return src, dst, true
+	}
+
+	if w.filters.HasAllowedHosts() &&
+		(w.filters.AllowsHostAddr(src) || w.filters.AllowsHostAddr(dst)) {
+		// the other side of packets to or from allowed names is never known in advance
 		return src, dst, true
 	}
 
 	if !w.filters.AllowsIPv6Addr(src) {
 		// fail fast: if SRC is not allowed, skip checking DST
-		return src, src, false
+		return src, dst, false
 	}
 
 	return src, dst, w.filters.AllowsIPv6Addr(dst)
@@ -455,6 +549,25 @@ func (w *pcapTranslatorWorker) isL4Allowed(
 		return &srcPort, &dstPort, true
 	}
 
+	layer = w.asLayer(ctx, layers.LayerTypeSCTP)
+	if layer != nil {
+		sctp := layer.(*layers.SCTP)
+
+		srcPort := uint16(sctp.SrcPort)
+		dstPort := uint16(sctp.DstPort)
+
+		if isProtosFilterAvailable && !w.filters.AllowsSCTP() {
+			// fail fast: if SCTP is not allowed, do not check ports
+			return &srcPort, &dstPort, false
+		}
+
+		if isL4AddrsFilterAvailable {
+			return w.arePortsAllowed(ctx, &srcPort, &dstPort)
+		}
+
+		return &srcPort, &dstPort, true
+	}
+
 	layer = w.asLayer(ctx, layers.LayerTypeUDP)
 	if layer == nil {
 		// the packet does not contain TCP/UDP information
@@ -490,7 +603,55 @@ func (w *pcapTranslatorWorker) isSocketAllowed(
 	return w.filters.AllowsSocket(srcAddr, srcPort, dstAddr, dstPort)
 }
 
+func (w *pcapTranslatorWorker) observeDNS(ctx context.Context) {
+	if dns, ok := w.asLayer(ctx, layers.LayerTypeDNS).(*layers.DNS); ok && dns.QR {
+		w.filters.ObserveDNS(dns, w.pkt(ctx).Metadata().Timestamp)
+	}
+}
+
+func (w *pcapTranslatorWorker) isL2Allowed(ctx context.Context) bool {
+	eth, ok := w.asLayer(ctx, layers.LayerTypeEthernet).(*layers.Ethernet)
+	if !ok {
+		// the packet does not contain Ethernet information
+		// fail open: nothing to verify
+		return true
+	}
+
+	if w.filters.HasL2Addrs() && !w.filters.AllowsAnyL2Addr(eth.SrcMAC, eth.DstMAC) {
+		return false
+	}
+
+	if !w.filters.HasVLANs() {
+		return true
+	}
+
+	tags := vlanTags(eth)
+	vlans := make([]uint16, len(tags))
+	for i, tag := range tags {
+		vlans[i] = tag.id
+	}
+	return w.filters.AllowsAnyVLAN(vlans...)
+}
+
+// shouldTranslate enforces filters in the following order; the 1st one that is not satisfied rejects the packet:
+//  1. denied MACs: if either the source or the destination is denied,
+//  2. allowed MACs: if there are any, either the source or the destination must be allowed,
+//  3. denied VLANs: if any of the tags is denied,
+//  4. allowed VLANs: if there are any, at least 1 tag must be allowed; untagged frames are rejected,
+//  5. L3 protocols: IPv4 and IPv6,
+//  6. denied networks: if either the source or the destination is denied,
+//  7. allowed networks: if there are any, both the source and the destination must be allowed,
+//  8. L4 protocols: TCP, UDP and SCTP,
+//  9. TCP flags: if there are any, at least 1 of them must be set,
+//  10. denied ports: if either the source or the destination port is denied,
+//  11. allowed ports: if there are any, either the source or the destination port must be allowed,
+//  12. denied sockets.
+//
+// Deny-lists always take precedence over allow-lists; packets without Ethernet, IP or L4 layers skip the corresponding filters.
 func (w *pcapTranslatorWorker) shouldTranslate(ctx context.Context) bool {
+	if !w.isL2Allowed(ctx) {
+		return false
+	}
 	srcAddr, dstAddr, l3Allowed := w.isL3Allowed(ctx)
 	srcPort, dstPort, l4Allowed := w.isL4Allowed(ctx)
 	if l3Allowed && l4Allowed {
@@ -500,6 +661,28 @@ func (w *pcapTranslatorWorker) shouldTranslate(ctx context.Context) bool {
 	return false
 }
 
+// allowedProfiles returns the names of the capture profiles whose filters allow the packet;
+// the filters of each profile are enforced in the same order as the filters of the capture.
+func (w *pcapTranslatorWorker) allowedProfiles(ctx context.Context) mapset.Set[string] {
+	if w.router == nil || len(w.router.profileFilters) == 0 {
+		return nil
+	}
+	profiles := mapset.NewThreadUnsafeSetWithSize[string](len(w.router.profileFilters))
+	for name, filters := range w.router.profileFilters {
+		if filters == nil {
+			profiles.Add(name)
+			continue
+		}
+		// all checks are implemented by the worker: a shallow copy enforces the filters of the profile instead
+		profileWorker := *w
+		profileWorker.filters = filters.Snapshot()
+		if profileWorker.shouldTranslate(ctx) {
+			profiles.Add(name)
+		}
+	}
+	return profiles
+}
+
 func (w *pcapTranslatorWorker) translate(
 	ctx context.Context,
 	index int,
@@ -542,8 +725,9 @@ func (w *pcapTranslatorWorker) translate(
 func (w *pcapTranslatorWorker) Run(ctx context.Context) (buffer interface{}) {
 	defer func() {
 		if r := recover(); r != nil {
-			transformerLogger.Printf("%s @translator | panic: %s\n%s\n",
-				*w.loggerPrefix, r, string(debug.Stack()))
+			w.logger.Error("translator panic",
+				"serial", *w.serial, "error", fmt.Sprint(r), "stack", string(debug.Stack()))
+			w.drops.drop(DropPanic, w.serial)
 			buffer = nil
 		}
 	}()
@@ -552,21 +736,39 @@ func (w *pcapTranslatorWorker) Run(ctx context.Context) (buffer interface{}) {
 	//   - if there aren't any filters, continue with translation.
 	// fail fast:
 	//   - do not translate any layers before enforcing filters.
-	if w.filters != nil && !w.shouldTranslate(ctx) {
+	if w.filters != nil && w.filters.HasHosts() {
+		// DNS responses must be observed even if they are filtered out: they resolve the watched names
+		w.observeDNS(ctx)
+	}
+	allowed := w.filters == nil || w.shouldTranslate(ctx)
+	// packets rejected by the filters of the capture are still translated if any capture profile allows them
+	profiles := w.allowedProfiles(ctx)
+	if !allowed && (profiles == nil || profiles.IsEmpty()) {
+		w.drops.drop(DropFiltered, w.serial)
+		return nil
+	}
+	// payload rules are the most expensive filter: they are only evaluated for packets allowed by all other filters
+	if !w.payload.match(*w.packet) {
+		w.drops.drop(DropFiltered, w.serial)
 		return nil
 	}
 
 	var _buffer fmt.Stringer = nil
 
+	translatedAt := w.telemetry.now()
+
+	reason := DropFailed
 	select {
 	case <-ctx.Done():
 		_buffer = nil
+		reason = DropCancelled
 	default:
 		_buffer = w.translator.next(ctx, w.iface, w.serial, w.packet)
 	}
 
 	if _buffer == nil {
-		transformerLogger.Printf("%s @translator | failed", *w.loggerPrefix)
+		w.logger.Warn("translator failed", "serial", *w.serial)
+		w.drops.drop(reason, w.serial)
 		buffer = nil
 		return nil
 	}
@@ -592,25 +794,60 @@ func (w *pcapTranslatorWorker) Run(ctx context.Context) (buffer interface{}) {
 		go w.translate(ctx, i, l, translations, &wg)
 	}
 
+	// merging starts as soon as the 1st layer is translated: it is traced from the 1st to the last merge
+	var mergedAt, merged time.Time
+	var merging time.Duration
 	for translation := range translations {
 		// translations are `nil` if layer is not available
 		if translation != nil {
+			mergeAt := w.telemetry.now()
 			// see: https://github.com/Jeffail/gabs?tab=readme-ov-file#merge-two-containers
 			_buffer, _ = w.translator.merge(ctx, _buffer, translation)
+			if w.telemetry != nil {
+				merged = time.Now()
+				merging += merged.Sub(mergeAt)
+				if mergedAt.IsZero() {
+					mergedAt = mergeAt
+				}
+			}
 		}
 	}
 
+	finalizedAt := w.telemetry.now()
+	w.telemetry.observe(PipelineTranslate, translatedAt, finalizedAt)
+	w.tracer.span(PipelineTranslate, translatedAt, finalizedAt)
+	if !mergedAt.IsZero() {
+		w.telemetry.record(PipelineMerge, merging)
+		w.tracer.span(PipelineMerge, mergedAt, merged)
+	}
+
 	select {
 	case <-ctx.Done():
 		// skip `finalize` deliver translation as-is
-		transformerLogger.Printf("%s @translator | incomplete", *w.loggerPrefix)
+		w.logger.Warn("translation incomplete", "serial", *w.serial)
 	default:
 		// `finalize` is the only method that is allowed to work across layers
 		_buffer, _ = w.translator.finalize(ctx, w.ifaces, w.iface, w.serial, w.packet, w.conntrack, _buffer)
+		finalized := w.telemetry.now()
+		w.telemetry.observe(PipelineFinalize, finalizedAt, finalized)
+		w.tracer.span(PipelineFinalize, finalizedAt, finalized)
+	}
+
+	attributes := w.router.attributes(w.ifaces, *w.packet)
+	if attributes != nil {
+		attributes.profiles, attributes.filtered = profiles, !allowed
 	}
 
-	buffer = &_buffer
-	return &_buffer
+	buffer = &pcapRecord{
+		translation: &_buffer,
+		attributes:  attributes,
+		// the packet carrying a trace of interest brings its flow into scope while being translated
+		outOfScope: !w.scope.allows(*w.packet),
+		tracer:     w.tracer,
+		capturedAt: (*w.packet).Metadata().Timestamp,
+		serial:     w.serial,
+	}
+	return buffer
 }
 
 func newPcapTranslatorWorker(
@@ -620,21 +857,31 @@ func newPcapTranslatorWorker(
 	serial *uint64,
 	packet *gopacket.Packet,
 	translator PcapTranslator,
+	router *recordRouter,
+	scope *TraceScope,
+	payload *payloadRules,
 	connTrack bool,
 	compat bool,
 ) *pcapTranslatorWorker {
-	loggerPrefix := fmt.Sprintf("[%d/%s] - #:%d |", iface.Index, iface.Name, *serial)
+	if filters != nil {
+		// filters may be updated while the packet is being checked: all checks must see the same filters
+		filters = filters.Snapshot()
+	}
 
 	worker := &pcapTranslatorWorker{
-		filters:      filters,
-		ifaces:       ifaces,
-		iface:        iface,
-		serial:       serial,
-		packet:       packet,
-		translator:   translator,
-		conntrack:    connTrack,
-		compat:       compat,
-		loggerPrefix: &loggerPrefix,
+		filters:    filters,
+		ifaces:     ifaces,
+		iface:      iface,
+		serial:     serial,
+		packet:     packet,
+		translator: translator,
+		router:     router,
+		scope:      scope,
+		payload:    payload,
+		conntrack:  connTrack,
+		compat:     compat,
+		// replaced by the logger of the transformer applying the packet
+		logger: transformerLogger,
 	}
 	return worker
 }
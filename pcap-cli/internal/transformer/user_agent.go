@@ -0,0 +1,130 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"regexp"
+	"strings"
+)
+
+type (
+	userAgentClass string
+
+	userAgent struct {
+		family  string
+		version string
+		class   userAgentClass
+	}
+
+	userAgentMatcher struct {
+		family string
+		class  userAgentClass
+		regex  *regexp.Regexp
+	}
+)
+
+const (
+	userAgentClassBot     = userAgentClass("bot")
+	userAgentClassProbe   = userAgentClass("probe")
+	userAgentClassLibrary = userAgentClass("library")
+	userAgentClassBrowser = userAgentClass("browser")
+	userAgentClassOther   = userAgentClass("other")
+
+	userAgentFamilyOther = "Other"
+)
+
+// matchers are evaluated in order, so more specific ones must go first:
+//   - crawlers and browsers usually include `Mozilla/5.0` and other browsers' tokens,
+//   - `Edge`/`Opera` include `Chrome`, and `Chrome` includes `Safari`.
+//
+// the 1st capturing group of every regex must be the version.
+var userAgentMatchers = []userAgentMatcher{
+	// probes: health checkers and uptime monitors
+	{"GoogleHC", userAgentClassProbe, regexp.MustCompile(`GoogleHC/(\d+(?:\.\d+)*)`)},
+	{"GoogleStackdriverMonitoring-UptimeChecks", userAgentClassProbe, regexp.MustCompile(`GoogleStackdriverMonitoring-UptimeChecks(?:/(\d+(?:\.\d+)*))?`)},
+	{"kube-probe", userAgentClassProbe, regexp.MustCompile(`kube-probe/(\d+(?:\.\d+)*)`)},
+	{"ELB-HealthChecker", userAgentClassProbe, regexp.MustCompile(`ELB-HealthChecker/(\d+(?:\.\d+)*)`)},
+	{"Envoy", userAgentClassProbe, regexp.MustCompile(`Envoy/HC()`)},
+	{"Consul Health Check", userAgentClassProbe, regexp.MustCompile(`Consul Health Check()`)},
+	{"Prometheus", userAgentClassProbe, regexp.MustCompile(`Prometheus/(\d+(?:\.\d+)*)`)},
+	{"Blackbox Exporter", userAgentClassProbe, regexp.MustCompile(`Blackbox Exporter/(\d+(?:\.\d+)*)`)},
+	// bots: crawlers and scanners
+	{"Googlebot", userAgentClassBot, regexp.MustCompile(`Googlebot(?:-\w+)?/(\d+(?:\.\d+)*)`)},
+	{"bingbot", userAgentClassBot, regexp.MustCompile(`bingbot/(\d+(?:\.\d+)*)`)},
+	{"YandexBot", userAgentClassBot, regexp.MustCompile(`YandexBot/(\d+(?:\.\d+)*)`)},
+	{"Baiduspider", userAgentClassBot, regexp.MustCompile(`Baiduspider(?:-\w+)?/(\d+(?:\.\d+)*)`)},
+	{"DuckDuckBot", userAgentClassBot, regexp.MustCompile(`DuckDuckBot(?:-\w+)?/(\d+(?:\.\d+)*)`)},
+	{"AhrefsBot", userAgentClassBot, regexp.MustCompile(`AhrefsBot/(\d+(?:\.\d+)*)`)},
+	{"SemrushBot", userAgentClassBot, regexp.MustCompile(`SemrushBot(?:-\w+)?/(\d+(?:\.\d+)*)`)},
+	{"facebookexternalhit", userAgentClassBot, regexp.MustCompile(`facebookexternalhit/(\d+(?:\.\d+)*)`)},
+	{"Censys", userAgentClassBot, regexp.MustCompile(`CensysInspect/(\d+(?:\.\d+)*)`)},
+	{"zgrab", userAgentClassBot, regexp.MustCompile(`zgrab/(\d+(?:\.\d+)*)`)},
+	{"masscan", userAgentClassBot, regexp.MustCompile(`masscan/(\d+(?:\.\d+)*)`)},
+	{"Nmap", userAgentClassBot, regexp.MustCompile(`Nmap Scripting Engine()`)},
+	// libraries and command line tools
+	{"curl", userAgentClassLibrary, regexp.MustCompile(`^curl/(\d+(?:\.\d+)*)`)},
+	{"Wget", userAgentClassLibrary, regexp.MustCompile(`^Wget/(\d+(?:\.\d+)*)`)},
+	{"Go-http-client", userAgentClassLibrary, regexp.MustCompile(`^Go-http-client/(\d+(?:\.\d+)*)`)},
+	{"python-requests", userAgentClassLibrary, regexp.MustCompile(`python-requests/(\d+(?:\.\d+)*)`)},
+	{"python-urllib", userAgentClassLibrary, regexp.MustCompile(`Python-urllib/(\d+(?:\.\d+)*)`)},
+	{"aiohttp", userAgentClassLibrary, regexp.MustCompile(`aiohttp/(\d+(?:\.\d+)*)`)},
+	{"httpx", userAgentClassLibrary, regexp.MustCompile(`python-httpx/(\d+(?:\.\d+)*)`)},
+	{"okhttp", userAgentClassLibrary, regexp.MustCompile(`okhttp/(\d+(?:\.\d+)*)`)},
+	{"Java", userAgentClassLibrary, regexp.MustCompile(`^Java/(\d+(?:\.\d+)*)`)},
+	{"Apache-HttpClient", userAgentClassLibrary, regexp.MustCompile(`Apache-HttpClient/(\d+(?:\.\d+)*)`)},
+	{"axios", userAgentClassLibrary, regexp.MustCompile(`axios/(\d+(?:\.\d+)*)`)},
+	{"node-fetch", userAgentClassLibrary, regexp.MustCompile(`node-fetch(?:/(\d+(?:\.\d+)*))?`)},
+	{"grpc", userAgentClassLibrary, regexp.MustCompile(`^grpc-[\w-]+/(\d+(?:\.\d+)*)`)},
+	{"PostmanRuntime", userAgentClassLibrary, regexp.MustCompile(`PostmanRuntime/(\d+(?:\.\d+)*)`)},
+	// browsers
+	{"Edge", userAgentClassBrowser, regexp.MustCompile(`Edg(?:e|A|iOS)?/(\d+(?:\.\d+)*)`)},
+	{"Opera", userAgentClassBrowser, regexp.MustCompile(`OPR/(\d+(?:\.\d+)*)`)},
+	{"Samsung Internet", userAgentClassBrowser, regexp.MustCompile(`SamsungBrowser/(\d+(?:\.\d+)*)`)},
+	{"Firefox", userAgentClassBrowser, regexp.MustCompile(`(?:Firefox|FxiOS)/(\d+(?:\.\d+)*)`)},
+	{"Chrome", userAgentClassBrowser, regexp.MustCompile(`(?:Chrome|CriOS)/(\d+(?:\.\d+)*)`)},
+	{"Safari", userAgentClassBrowser, regexp.MustCompile(`Version/(\d+(?:\.\d+)*).*Safari/`)},
+}
+
+// generic crawlers often identify themselves using any of these tokens
+var userAgentBotRegex = regexp.MustCompile(`(?i)(?:bot|crawler|spider|scanner|scraper)\b`)
+
+// parseUserAgent classifies the `User-Agent` header of HTTP requests;
+// unknown user agents are classified as `other`, unless they look like crawlers.
+func parseUserAgent(rawUserAgent string) *userAgent {
+	rawUserAgent = strings.TrimSpace(rawUserAgent)
+	if rawUserAgent == "" {
+		return nil
+	}
+
+	for _, matcher := range userAgentMatchers {
+		if match := matcher.regex.FindStringSubmatch(rawUserAgent); match != nil {
+			return &userAgent{
+				family:  matcher.family,
+				version: match[1],
+				class:   matcher.class,
+			}
+		}
+	}
+
+	if userAgentBotRegex.MatchString(rawUserAgent) {
+		return &userAgent{family: userAgentFamilyOther, class: userAgentClassBot}
+	}
+
+	return &userAgent{family: userAgentFamilyOther, class: userAgentClassOther}
+}
+
+func (ua *userAgent) isAutomated() bool {
+	return ua.class == userAgentClassBot || ua.class == userAgentClassProbe
+}
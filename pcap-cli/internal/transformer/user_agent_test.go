@@ -0,0 +1,58 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseUserAgent verifies family, version and classification of common user agents.
+func TestParseUserAgent(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		userAgent string
+		expected  *userAgent
+		automated bool
+	}{
+		{"empty", " ", nil, false},
+		{"chrome", "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36", &userAgent{"Chrome", "124.0.0.0", userAgentClassBrowser}, false},
+		{"edge", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36 Edg/124.0.2478.51", &userAgent{"Edge", "124.0.2478.51", userAgentClassBrowser}, false},
+		{"safari", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4.1 Safari/605.1.15", &userAgent{"Safari", "17.4.1", userAgentClassBrowser}, false},
+		{"firefox", "Mozilla/5.0 (X11; Linux x86_64; rv:125.0) Gecko/20100101 Firefox/125.0", &userAgent{"Firefox", "125.0", userAgentClassBrowser}, false},
+		{"googlebot", "Mozilla/5.0 AppleWebKit/537.36 (KHTML, like Gecko; compatible; Googlebot/2.1; +http://www.google.com/bot.html) Chrome/124.0.6367.155 Safari/537.36", &userAgent{"Googlebot", "2.1", userAgentClassBot}, true},
+		{"generic crawler", "Mozilla/5.0 (compatible; ExampleCrawler; +https://example.com)", &userAgent{userAgentFamilyOther, "", userAgentClassBot}, true},
+		{"google health check", "GoogleHC/1.0", &userAgent{"GoogleHC", "1.0", userAgentClassProbe}, true},
+		{"kubernetes probe", "kube-probe/1.29", &userAgent{"kube-probe", "1.29", userAgentClassProbe}, true},
+		{"curl", "curl/8.5.0", &userAgent{"curl", "8.5.0", userAgentClassLibrary}, false},
+		{"go", "Go-http-client/2.0", &userAgent{"Go-http-client", "2.0", userAgentClassLibrary}, false},
+		{"grpc", "grpc-go/1.64.1", &userAgent{"grpc", "1.64.1", userAgentClassLibrary}, false},
+		{"unknown", "my-app", &userAgent{userAgentFamilyOther, "", userAgentClassOther}, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			ua := parseUserAgent(tc.userAgent)
+			assert.Equal(t, tc.expected, ua)
+			if ua != nil {
+				assert.Equal(t, tc.automated, ua.isAutomated())
+			}
+		})
+	}
+}
@@ -14,7 +14,12 @@
 
 package transformer
 
-import "github.com/google/gopacket/layers"
+import (
+	"net"
+	"net/netip"
+
+	"github.com/google/gopacket/layers"
+)
 
 func parseTCPflags(tcp *layers.TCP) uint8 {
 	var setFlags uint8 = 0b00000000
@@ -47,18 +52,45 @@ func parseTCPflags(tcp *layers.TCP) uint8 {
 	return setFlags
 }
 
-func (eph *PcapEphemeralPorts) isEphemeralPort(port *uint16) bool {
+func (eph *PcapEphemeralPorts) hasIPv6Range() bool {
+	return eph.Min6 != 0 && eph.Min6 < eph.Max6
+}
+
+func (eph *PcapEphemeralPorts) isEphemeralPort(ip net.IP, port *uint16) bool {
+	if ip != nil && ip.To4() == nil && eph.hasIPv6Range() {
+		return *port >= eph.Min6 && *port <= eph.Max6
+	}
 	return *port >= eph.Min && *port <= eph.Max
 }
 
-func (eph *PcapEphemeralPorts) isEphemeralUDPPort(udpPort *layers.UDPPort) bool {
+func (eph *PcapEphemeralPorts) isEphemeralUDPPort(ip net.IP, udpPort *layers.UDPPort) bool {
 	port := uint16(*udpPort)
-	return eph.isEphemeralPort(&port)
+	return eph.isEphemeralPort(ip, &port)
 }
 
-func (eph *PcapEphemeralPorts) isEphemeralTCPPort(tcpPort *layers.TCPPort) bool {
+func (eph *PcapEphemeralPorts) isEphemeralTCPPort(ip net.IP, tcpPort *layers.TCPPort) bool {
 	port := uint16(*tcpPort)
-	return eph.isEphemeralPort(&port)
+	return eph.isEphemeralPort(ip, &port)
+}
+
+// clientOf returns the index of the endpoint which is the client of a connection whose handshake was not captured:
+// the only endpoint using an ephemeral port, or the endpoint using the highest port as ephemeral ports are usually higher.
+func (eph *PcapEphemeralPorts) clientOf(endpoints *[2]netip.AddrPort) int {
+	if eph != nil {
+		ports := [2]uint16{endpoints[0].Port(), endpoints[1].Port()}
+		isEphemeral0 := eph.isEphemeralPort(endpoints[0].Addr().Unmap().AsSlice(), &ports[0])
+		isEphemeral1 := eph.isEphemeralPort(endpoints[1].Addr().Unmap().AsSlice(), &ports[1])
+		if isEphemeral0 != isEphemeral1 {
+			if isEphemeral1 {
+				return 1
+			}
+			return 0
+		}
+	}
+	if endpoints[1].Port() > endpoints[0].Port() {
+		return 1
+	}
+	return 0
 }
 
 func isConnectionTermination(tcpFlags *uint8) bool {
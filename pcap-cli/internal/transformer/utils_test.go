@@ -15,6 +15,8 @@ package transformer
 // limitations under the License.
 
 import (
+	"net"
+	"net/netip"
 	"strconv"
 	"testing"
 
@@ -139,7 +141,7 @@ func TestIsEphemeralPort(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
 			portPtr := tt.port
-			got := eph.isEphemeralPort(&portPtr)
+			got := eph.isEphemeralPort(nil, &portPtr)
 			if tt.want {
 				assert.True(t, got, "Port %d should be ephemeral in range %d-%d", tt.port, eph.Min, eph.Max)
 			} else {
@@ -175,7 +177,7 @@ func TestIsEphemeralUDPPort(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
 			portPtr := tt.port
-			got := eph.isEphemeralUDPPort(&portPtr)
+			got := eph.isEphemeralUDPPort(nil, &portPtr)
 			if tt.want {
 				assert.True(t, got, "UDP Port %d should be ephemeral in range %d-%d", tt.port, eph.Min, eph.Max)
 			} else {
@@ -211,7 +213,7 @@ func TestIsEphemeralTCPPort(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
 			portPtr := tt.port
-			got := eph.isEphemeralTCPPort(&portPtr)
+			got := eph.isEphemeralTCPPort(nil, &portPtr)
 			if tt.want {
 				assert.True(t, got, "TCP Port %d should be ephemeral in range %d-%d", tt.port, eph.Min, eph.Max)
 			} else {
@@ -221,6 +223,60 @@ func TestIsEphemeralTCPPort(t *testing.T) {
 	}
 }
 
+// TestIsEphemeralPortPerFamily verifies that IPv6 sockets use their own range, if any.
+func TestIsEphemeralPortPerFamily(t *testing.T) {
+	t.Parallel()
+	eph := &PcapEphemeralPorts{
+		Min:  32768,
+		Max:  60999,
+		Min6: 49152,
+		Max6: 65535,
+	}
+
+	ip4, ip6 := net.ParseIP("10.0.0.1"), net.ParseIP("2001:db8::1")
+	mapped := net.ParseIP("::ffff:10.0.0.1")
+
+	port := uint16(40000)
+	assert.True(t, eph.isEphemeralPort(ip4, &port))
+	assert.True(t, eph.isEphemeralPort(mapped, &port), "IPv4-mapped addresses are IPv4")
+	assert.False(t, eph.isEphemeralPort(ip6, &port))
+
+	port = 62000
+	assert.False(t, eph.isEphemeralPort(ip4, &port))
+	assert.True(t, eph.isEphemeralPort(ip6, &port))
+
+	// without an IPv6 range, both families share the same range
+	eph.Min6, eph.Max6 = 0, 0
+	assert.False(t, eph.isEphemeralPort(ip6, &port))
+	port = 40000
+	assert.True(t, eph.isEphemeralPort(ip6, &port))
+}
+
+// TestEphemeralPortsClientOf verifies that clients are the endpoints using ephemeral ports of customized ranges.
+func TestEphemeralPortsClientOf(t *testing.T) {
+	t.Parallel()
+	// i/e: `net.ipv4.ip_local_port_range = 1024 4999`
+	eph := &PcapEphemeralPorts{Min: 1024, Max: 4999}
+
+	endpoints := [2]netip.AddrPort{
+		netip.MustParseAddrPort("10.0.0.1:8080"),
+		netip.MustParseAddrPort("10.0.0.2:2000"),
+	}
+	assert.Equal(t, 1, eph.clientOf(&endpoints))
+
+	// the highest port is the client if both or none of the ports are ephemeral
+	endpoints[1] = netip.MustParseAddrPort("10.0.0.2:9090")
+	assert.Equal(t, 1, eph.clientOf(&endpoints))
+	endpoints[0] = netip.MustParseAddrPort("10.0.0.1:3000")
+	endpoints[1] = netip.MustParseAddrPort("10.0.0.2:2000")
+	assert.Equal(t, 0, eph.clientOf(&endpoints))
+
+	// without ephemeral ports, the highest port is the client
+	var noEph *PcapEphemeralPorts = nil
+	endpoints[0] = netip.MustParseAddrPort("10.0.0.1:8080")
+	assert.Equal(t, 0, noEph.clientOf(&endpoints))
+}
+
 // TestIsConnectionTermination verifies if flags indicate a connection termination (FIN or RST).
 func TestIsConnectionTermination(t *testing.T) {
 	t.Parallel()
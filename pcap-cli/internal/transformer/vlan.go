@@ -0,0 +1,46 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"encoding/binary"
+
+	"github.com/google/gopacket/layers"
+)
+
+type vlanTag struct {
+	id       uint16
+	priority uint8
+	// drop eligible indicator
+	dei bool
+}
+
+// vlanTags decodes the 802.1Q and 802.1ad ( QinQ ) tags which follow the Ethernet header, outermost first.
+func vlanTags(eth *layers.Ethernet) []vlanTag {
+	tags := []vlanTag{}
+	ethernetType := eth.EthernetType
+	payload := eth.Payload
+	for (ethernetType == layers.EthernetTypeDot1Q || ethernetType == layers.EthernetTypeQinQ) && len(payload) >= 4 {
+		tci := binary.BigEndian.Uint16(payload[0:2])
+		tags = append(tags, vlanTag{
+			id:       tci & 0x0FFF,
+			priority: uint8(tci >> 13),
+			dei:      tci&0x1000 != 0,
+		})
+		ethernetType = layers.EthernetType(binary.BigEndian.Uint16(payload[2:4]))
+		payload = payload[4:]
+	}
+	return tags
+}
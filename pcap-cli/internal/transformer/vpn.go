@@ -0,0 +1,212 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"encoding/binary"
+	"sync"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/segmentio/fasthash/fnv1a"
+)
+
+type (
+	// vpnPacket is the clear text part of IPsec and WireGuard packets; payloads are always encrypted.
+	vpnPacket struct {
+		proto       string
+		messageType string
+		// IPsec security parameters index
+		spi uint32
+		// WireGuard indexes chosen by each peer during the handshake
+		sender, receiver uint32
+		// IPsec sequence number, or WireGuard nonce of transport data messages
+		counter    uint64
+		hasCounter bool
+		// packets observed for the same SPI or WireGuard index in the same direction
+		packets uint64
+	}
+
+	// vpnTunnels counts packets per tunnel, and remembers WireGuard receiver indexes announced by handshakes:
+	// transport data messages are too generic to be recognized on non standard ports otherwise.
+	vpnTunnels struct {
+		mu      sync.Mutex
+		indexes map[uint32]struct{}
+		packets map[uint64]uint64
+	}
+)
+
+const (
+	vpnProtoESP       = "esp"
+	vpnProtoAH        = "ah"
+	vpnProtoWireGuard = "wireguard"
+
+	vpnTunnelsLimit = 4096
+
+	// see: https://datatracker.ietf.org/doc/html/rfc3948#section-2.2
+	ipsecNATTraversalPort = 4500
+	wireGuardPort         = 51820
+
+	// see: https://www.wireguard.com/protocol/
+	wireGuardHandshakeInitiation = 1
+	wireGuardHandshakeResponse   = 2
+	wireGuardCookieReply         = 3
+	wireGuardTransportData       = 4
+
+	wireGuardHandshakeInitiationLen = 148
+	wireGuardHandshakeResponseLen   = 92
+	wireGuardCookieReplyLen         = 64
+	// header and authentication tag of an empty ( keepalive ) message
+	wireGuardTransportDataMinLen = 32
+)
+
+var wireGuardMessageTypes = map[byte]string{
+	wireGuardHandshakeInitiation: "handshake_initiation",
+	wireGuardHandshakeResponse:   "handshake_response",
+	wireGuardCookieReply:         "cookie_reply",
+	wireGuardTransportData:       "transport_data",
+}
+
+func newVPNTunnels() *vpnTunnels {
+	return &vpnTunnels{
+		indexes: make(map[uint32]struct{}),
+		packets: make(map[uint64]uint64),
+	}
+}
+
+// count returns how many packets have been observed for the tunnel, including the current one.
+func (v *vpnTunnels) count(flowID uint64, index uint32) uint64 {
+	key := fnv1a.AddUint64(flowID, uint64(index))
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if _, ok := v.packets[key]; !ok && len(v.packets) >= vpnTunnelsLimit {
+		// tunnels come and go: start over instead of keeping stale tunnels forever
+		v.packets = make(map[uint64]uint64)
+	}
+	v.packets[key] += 1
+	return v.packets[key]
+}
+
+func (v *vpnTunnels) learn(index uint32) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if len(v.indexes) >= vpnTunnelsLimit {
+		v.indexes = make(map[uint32]struct{})
+	}
+	v.indexes[index] = struct{}{}
+}
+
+func (v *vpnTunnels) isKnown(index uint32) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	_, ok := v.indexes[index]
+	return ok
+}
+
+// parseIPSec returns the ESP or AH header of packets carried directly by IP.
+func (v *vpnTunnels) parseIPSec(packet gopacket.Packet, flowID uint64) *vpnPacket {
+	var vpn *vpnPacket
+	if esp, ok := packet.Layer(layers.LayerTypeIPSecESP).(*layers.IPSecESP); ok {
+		vpn = &vpnPacket{proto: vpnProtoESP, spi: esp.SPI, counter: uint64(esp.Seq)}
+	} else if ah, ok := packet.Layer(layers.LayerTypeIPSecAH).(*layers.IPSecAH); ok {
+		vpn = &vpnPacket{proto: vpnProtoAH, spi: ah.SPI, counter: uint64(ah.Seq)}
+	} else {
+		return nil
+	}
+	vpn.hasCounter = true
+	vpn.packets = v.count(flowID, vpn.spi)
+	return vpn
+}
+
+// parseUDP recognizes ESP encapsulated in UDP by NAT traversal, and WireGuard messages.
+func (v *vpnTunnels) parseUDP(data []byte, srcPort, dstPort uint16, flowID uint64) *vpnPacket {
+	if srcPort == ipsecNATTraversalPort || dstPort == ipsecNATTraversalPort {
+		return v.parseNATTraversal(data, flowID)
+	}
+	return v.parseWireGuard(data, srcPort == wireGuardPort || dstPort == wireGuardPort, flowID)
+}
+
+// parseNATTraversal ignores IKE messages and NAT keepalives: see: https://datatracker.ietf.org/doc/html/rfc3948#section-2
+func (v *vpnTunnels) parseNATTraversal(data []byte, flowID uint64) *vpnPacket {
+	if len(data) < 8 {
+		return nil
+	}
+	spi := binary.BigEndian.Uint32(data[0:4])
+	// non-ESP marker
+	if spi == 0 {
+		return nil
+	}
+	vpn := &vpnPacket{
+		proto:      vpnProtoESP,
+		spi:        spi,
+		counter:    uint64(binary.BigEndian.Uint32(data[4:8])),
+		hasCounter: true,
+	}
+	vpn.packets = v.count(flowID, spi)
+	return vpn
+}
+
+// parseWireGuard only accepts transport data messages sent to or from the standard port,
+// or addressed to a receiver index announced by a handshake.
+func (v *vpnTunnels) parseWireGuard(data []byte, isWireGuardPort bool, flowID uint64) *vpnPacket {
+	if len(data) < wireGuardTransportDataMinLen || data[1] != 0 || data[2] != 0 || data[3] != 0 {
+		return nil
+	}
+
+	messageType, ok := wireGuardMessageTypes[data[0]]
+	if !ok {
+		return nil
+	}
+	vpn := &vpnPacket{proto: vpnProtoWireGuard, messageType: messageType}
+
+	switch data[0] {
+	case wireGuardHandshakeInitiation:
+		if len(data) != wireGuardHandshakeInitiationLen {
+			return nil
+		}
+		vpn.sender = binary.LittleEndian.Uint32(data[4:8])
+		v.learn(vpn.sender)
+		vpn.packets = v.count(flowID, vpn.sender)
+	case wireGuardHandshakeResponse:
+		if len(data) != wireGuardHandshakeResponseLen {
+			return nil
+		}
+		vpn.sender = binary.LittleEndian.Uint32(data[4:8])
+		vpn.receiver = binary.LittleEndian.Uint32(data[8:12])
+		v.learn(vpn.sender)
+		vpn.packets = v.count(flowID, vpn.sender)
+	case wireGuardCookieReply:
+		if len(data) != wireGuardCookieReplyLen {
+			return nil
+		}
+		vpn.receiver = binary.LittleEndian.Uint32(data[4:8])
+		vpn.packets = v.count(flowID, vpn.receiver)
+	case wireGuardTransportData:
+		// payloads are padded to 16 bytes
+		if len(data) < wireGuardTransportDataMinLen || len(data)%16 != 0 {
+			return nil
+		}
+		vpn.receiver = binary.LittleEndian.Uint32(data[4:8])
+		if !isWireGuardPort && !v.isKnown(vpn.receiver) {
+			return nil
+		}
+		vpn.counter = binary.LittleEndian.Uint64(data[8:16])
+		vpn.hasCounter = true
+		vpn.packets = v.count(flowID, vpn.receiver)
+	}
+
+	return vpn
+}
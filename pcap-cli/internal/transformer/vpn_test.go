@@ -0,0 +1,84 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newWireGuardMessage(messageType byte, size int, index uint32) []byte {
+	data := make([]byte, size)
+	data[0] = messageType
+	binary.LittleEndian.PutUint32(data[4:8], index)
+	return data
+}
+
+// TestWireGuard verifies that transport data messages on non standard ports are only recognized after a handshake announced their receiver index.
+func TestWireGuard(t *testing.T) {
+	t.Parallel()
+
+	tunnels := newVPNTunnels()
+
+	data := newWireGuardMessage(wireGuardTransportData, 48, 7)
+	binary.LittleEndian.PutUint64(data[8:16], 42)
+	assert.Nil(t, tunnels.parseUDP(data, 40000, 41000, 1))
+
+	vpn := tunnels.parseUDP(newWireGuardMessage(wireGuardHandshakeInitiation, wireGuardHandshakeInitiationLen, 7), 40000, 41000, 1)
+	if assert.NotNil(t, vpn) {
+		assert.Equal(t, "handshake_initiation", vpn.messageType)
+		assert.Equal(t, uint32(7), vpn.sender)
+		assert.False(t, vpn.hasCounter)
+	}
+
+	vpn = tunnels.parseUDP(data, 41000, 40000, 1)
+	if assert.NotNil(t, vpn) {
+		assert.Equal(t, "transport_data", vpn.messageType)
+		assert.Equal(t, uint32(7), vpn.receiver)
+		assert.Equal(t, uint64(42), vpn.counter)
+		assert.Equal(t, uint64(2), vpn.packets)
+	}
+
+	// handshakes must have their exact length
+	assert.Nil(t, tunnels.parseUDP(newWireGuardMessage(wireGuardHandshakeResponse, 100, 8), 40000, wireGuardPort, 1))
+	// transport data is padded to 16 bytes
+	assert.Nil(t, tunnels.parseUDP(newWireGuardMessage(wireGuardTransportData, 33, 9), 40000, wireGuardPort, 1))
+	// keepalives on the standard port
+	assert.NotNil(t, tunnels.parseUDP(newWireGuardMessage(wireGuardTransportData, 32, 9), 40000, wireGuardPort, 1))
+}
+
+// TestNATTraversal verifies that ESP is recognized on UDP port 4500, and that IKE messages are not.
+func TestNATTraversal(t *testing.T) {
+	t.Parallel()
+
+	tunnels := newVPNTunnels()
+
+	esp := []byte{0xc0, 0xff, 0xee, 0x01, 0x00, 0x00, 0x00, 0x05, 0xaa, 0xbb}
+	vpn := tunnels.parseUDP(esp, ipsecNATTraversalPort, ipsecNATTraversalPort, 1)
+	if assert.NotNil(t, vpn) {
+		assert.Equal(t, vpnProtoESP, vpn.proto)
+		assert.Equal(t, uint32(0xc0ffee01), vpn.spi)
+		assert.Equal(t, uint64(5), vpn.counter)
+		assert.Equal(t, uint64(1), vpn.packets)
+	}
+
+	ike := []byte{0x00, 0x00, 0x00, 0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+	assert.Nil(t, tunnels.parseUDP(ike, 40000, ipsecNATTraversalPort, 1))
+
+	// NAT keepalive
+	assert.Nil(t, tunnels.parseUDP([]byte{0xff}, 40000, ipsecNATTraversalPort, 1))
+}
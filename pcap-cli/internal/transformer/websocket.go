@@ -0,0 +1,173 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"encoding/binary"
+	"unicode/utf8"
+
+	"github.com/Jeffail/gabs/v2"
+)
+
+type (
+	webSocketFrame struct {
+		fin, masked bool
+		opcode      uint8
+		length      uint64
+		// the payload continues in subsequent TCP segments
+		partial bool
+		// only available for `close` frames
+		closeCode   uint16
+		closeReason string
+	}
+
+	// webSocketFlow is the state of a connection upgraded to WebSocket;
+	// it is not thread-safe: it must only be used while holding the flow lock.
+	webSocketFlow struct {
+		// bytes of partial payloads to be skipped from the next TCP segment; the source port identifies the direction
+		pending map[uint16]uint64
+	}
+)
+
+const (
+	webSocketUpgrade = "websocket"
+	// the smallest frame header: flags/opcode, and mask/length
+	webSocketMinHeaderLen = 2
+	// reasons longer than this are truncated
+	webSocketMaxCloseReason = 123
+)
+
+// see: https://www.rfc-editor.org/rfc/rfc6455#section-11.8
+var webSocketOpcodes = map[uint8]string{
+	0x0: "continuation",
+	0x1: "text",
+	0x2: "binary",
+	0x8: "close",
+	0x9: "ping",
+	0xA: "pong",
+}
+
+func newWebSocketFlow() *webSocketFlow {
+	return &webSocketFlow{pending: make(map[uint16]uint64, 2)}
+}
+
+func webSocketOpcodeName(opcode uint8) string {
+	if name, ok := webSocketOpcodes[opcode]; ok {
+		return name
+	}
+	return "reserved"
+}
+
+// frames decodes the WebSocket frames carried by a TCP segment sent from `srcPort`:
+//   - see: https://www.rfc-editor.org/rfc/rfc6455#section-5.2
+//   - frames may span multiple segments, and segments may carry multiple frames.
+func (w *webSocketFlow) frames(srcPort uint16, data []byte) []*webSocketFrame {
+	skip := w.pending[srcPort]
+	if skip >= uint64(len(data)) {
+		w.pending[srcPort] = skip - uint64(len(data))
+		return nil
+	}
+	data = data[skip:]
+	w.pending[srcPort] = 0
+
+	frames := []*webSocketFrame{}
+	for len(data) >= webSocketMinHeaderLen {
+		frame := &webSocketFrame{
+			fin:    data[0]&0x80 != 0,
+			opcode: data[0] & 0x0F,
+			masked: data[1]&0x80 != 0,
+			length: uint64(data[1] & 0x7F),
+		}
+
+		headerLen := webSocketMinHeaderLen
+		switch frame.length {
+		case 126:
+			headerLen += 2
+		case 127:
+			headerLen += 8
+		}
+		if frame.masked {
+			headerLen += 4
+		}
+		// headers split across segments cannot be decoded
+		if len(data) < headerLen {
+			break
+		}
+
+		switch frame.length {
+		case 126:
+			frame.length = uint64(binary.BigEndian.Uint16(data[2:4]))
+		case 127:
+			frame.length = binary.BigEndian.Uint64(data[2:10])
+		}
+
+		var mask []byte = nil
+		if frame.masked {
+			mask = data[headerLen-4 : headerLen]
+		}
+
+		frames = append(frames, frame)
+		data = data[headerLen:]
+
+		payload := data
+		if frame.length > uint64(len(data)) {
+			frame.partial = true
+			w.pending[srcPort] = frame.length - uint64(len(data))
+			data = nil
+		} else {
+			payload = data[:frame.length]
+			data = data[frame.length:]
+		}
+
+		if frame.opcode == 0x8 && len(payload) >= 2 {
+			frame.setClose(payload, mask)
+		}
+	}
+
+	return frames
+}
+
+func (f *webSocketFrame) setClose(payload, mask []byte) {
+	body := make([]byte, min(len(payload), 2+webSocketMaxCloseReason))
+	for i := range body {
+		body[i] = payload[i]
+		if mask != nil {
+			body[i] ^= mask[i%4]
+		}
+	}
+	f.closeCode = binary.BigEndian.Uint16(body[:2])
+	if reason := body[2:]; utf8.Valid(reason) {
+		f.closeReason = string(reason)
+	}
+}
+
+func (f *webSocketFrame) toJSON() *gabs.Container {
+	json := gabs.New()
+	json.Set(webSocketOpcodeName(f.opcode), "type")
+	json.Set(f.opcode, "opcode")
+	json.Set(f.fin, "fin")
+	json.Set(f.masked, "masked")
+	json.Set(f.length, "len")
+	if f.partial {
+		json.Set(true, "partial")
+	}
+	if f.opcode == 0x8 && f.closeCode != 0 {
+		json.Set(f.closeCode, "close", "code")
+		if f.closeReason != "" {
+			json.Set(f.closeReason, "close", "reason")
+		}
+	}
+	return json
+}
@@ -0,0 +1,63 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestWebSocketFrames verifies that frames are decoded per direction, including payloads that span multiple segments.
+func TestWebSocketFrames(t *testing.T) {
+	t.Parallel()
+
+	const clientPort, serverPort = 40000, 80
+
+	flow := newWebSocketFlow()
+
+	// masked `text` frame: "Hello", followed by the header of a `binary` frame with a 16 bits length
+	mask := []byte{0x37, 0xfa, 0x21, 0x3d}
+	segment := []byte{0x81, 0x85}
+	segment = append(segment, mask...)
+	for i, b := range []byte("Hello") {
+		segment = append(segment, b^mask[i%4])
+	}
+	segment = append(segment, 0x82, 0x7E, 0x01, 0x00, 'x', 'y')
+
+	frames := flow.frames(clientPort, segment)
+	assert.Len(t, frames, 2)
+	assert.True(t, frames[0].fin)
+	assert.True(t, frames[0].masked)
+	assert.Equal(t, "text", webSocketOpcodeName(frames[0].opcode))
+	assert.Equal(t, uint64(5), frames[0].length)
+	assert.Equal(t, "binary", webSocketOpcodeName(frames[1].opcode))
+	assert.Equal(t, uint64(256), frames[1].length)
+	assert.True(t, frames[1].partial)
+
+	// the server direction is not affected by pending client payloads
+	frames = flow.frames(serverPort, []byte{0x88, 0x0A, 0x03, 0xE8, 'g', 'o', 'i', 'n', 'g', ' ', 'a', 'w'})
+	assert.Len(t, frames, 1)
+	assert.Equal(t, uint16(1000), frames[0].closeCode)
+	assert.Equal(t, "going aw", frames[0].closeReason)
+	assert.Equal(t, map[string]any{"code": uint16(1000), "reason": "going aw"}, frames[0].toJSON().S("close").Data())
+
+	// the remainder of the `binary` payload is skipped
+	assert.Nil(t, flow.frames(clientPort, make([]byte, 200)))
+	frames = flow.frames(clientPort, append(make([]byte, 54), 0x89, 0x00))
+	assert.Len(t, frames, 1)
+	assert.Equal(t, "ping", webSocketOpcodeName(frames[0].opcode))
+	assert.False(t, frames[0].partial)
+}
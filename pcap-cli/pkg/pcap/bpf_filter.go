@@ -0,0 +1,226 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+)
+
+type (
+	// pcapFilterPlan describes which portion of the capture filter is enforced by the kernel, and which in software.
+	pcapFilterPlan struct {
+		// enforced by the kernel; empty if the kernel does not filter at all
+		filter       string
+		instructions []pcap.BPFInstruction
+		// complete filter enforced in software; empty if the kernel enforces it
+		software string
+		// filters removed from the kernel filter; empty if the filter was provided by users
+		degraded []PcapFilterProvider
+	}
+
+	bpfCompiler = func(string) ([]pcap.BPFInstruction, error)
+
+	PcapBPFInstruction = pcap.BPFInstruction
+
+	// PcapFilterError describes why a BPF filter, or a filter expression, could not be compiled:
+	//   - `Token` is the best guess of the token that broke the filter, found at `Offset`;
+	//   - `Token` is empty and `Offset` is `-1` if it could not be found.
+	PcapFilterError struct {
+		Filter string
+		Token  string
+		Offset int
+		Err    error
+	}
+
+	bpfToken struct {
+		text   string
+		offset int
+	}
+)
+
+// largest program accepted by the Linux kernel: `BPF_MAXINSNS`
+const bpfMaxInstructions = 4096
+
+// libpcap quotes names it cannot resolve; i/e: `unknown host 'exmaple.com'`
+var bpfQuotedToken = regexp.MustCompile(`'([^']+)'`)
+
+func (e *PcapFilterError) Error() string {
+	if e.Token == "" {
+		return fmt.Sprintf("invalid filter [%s]: %v", e.Filter, e.Err)
+	}
+	return fmt.Sprintf("invalid filter [%s]: %v; near '%s' at offset %d", e.Filter, e.Err, e.Token, e.Offset)
+}
+
+func (e *PcapFilterError) Unwrap() error {
+	return e.Err
+}
+
+func tokenizeBPFFilter(filter string) []bpfToken {
+	tokens := []bpfToken{}
+	start := -1
+	for i, r := range filter {
+		if unicode.IsSpace(r) {
+			if start >= 0 {
+				tokens = append(tokens, bpfToken{filter[start:i], start})
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, bpfToken{filter[start:], start})
+	}
+	return tokens
+}
+
+// findOffendingBPFToken guesses which token broke `filter`, as libpcap only reports the position of syntax errors in recent versions:
+//   - tokens quoted by the error are preferred; i/e: names of hosts, protocols or services,
+//   - otherwise, the token following the longest prefix of the filter that compiles is reported.
+func findOffendingBPFToken(filter string, err error, compile bpfCompiler) (string, int) {
+	tokens := tokenizeBPFFilter(filter)
+
+	if quoted := bpfQuotedToken.FindStringSubmatch(err.Error()); quoted != nil {
+		for _, token := range tokens {
+			if strings.Contains(token.text, quoted[1]) {
+				return token.text, token.offset
+			}
+		}
+	}
+
+	for i := len(tokens) - 1; i > 0; i-- {
+		if _, err := compile(filter[:tokens[i].offset]); err == nil {
+			return tokens[i].text, tokens[i].offset
+		}
+	}
+	if len(tokens) > 0 {
+		return tokens[0].text, tokens[0].offset
+	}
+	return "", -1
+}
+
+func newPcapFilterError(filter string, err error, compile bpfCompiler) *PcapFilterError {
+	token, offset := findOffendingBPFToken(filter, err, compile)
+	return &PcapFilterError{Filter: filter, Token: token, Offset: offset, Err: err}
+}
+
+// deadBPFCompiler compiles filters without opening a device: Ethernet is assumed, which is what most devices use.
+func deadBPFCompiler(snaplen int) bpfCompiler {
+	if snaplen <= 0 {
+		snaplen = 65536
+	}
+	return func(filter string) ([]pcap.BPFInstruction, error) {
+		return pcap.CompileBPFFilter(layers.LinkTypeEthernet, snaplen, filter)
+	}
+}
+
+// CompilePcapFilter compiles `filter` without capturing any packets; i/e: to validate a filter before using it.
+// Errors are `*PcapFilterError`s, which point at the token that broke the filter.
+func CompilePcapFilter(filter string, snaplen int) ([]PcapBPFInstruction, error) {
+	compile := deadBPFCompiler(snaplen)
+	instructions, err := compile(filter)
+	if err != nil {
+		return nil, newPcapFilterError(filter, err, compile)
+	}
+	return instructions, nil
+}
+
+// validatePcapFilter compiles the free form filter provided by users, if any, before starting to capture:
+// filters built from providers are generated, so they are not validated.
+func validatePcapFilter(config *PcapConfig) error {
+	if config.Compat || config.Filter == "" || strings.EqualFold(config.Filter, "DISABLED") {
+		return nil
+	}
+	_, err := CompilePcapFilter(config.Filter, config.Snaplen)
+	return err
+}
+
+func describeFilterProviders(providers []PcapFilterProvider) string {
+	descriptions := make([]string, len(providers))
+	for i, provider := range providers {
+		descriptions[i] = provider.String()
+	}
+	return strings.Join(descriptions, ", ")
+}
+
+// planPcapFilter compiles the capture filter; if the compiled program is too large for the kernel:
+//   - the complete filter is enforced in software, which is precise but more expensive,
+//   - generated filters are degraded into a broader kernel filter by removing the largest filters 1 at a time until it fits;
+//     i/e: long lists of hosts, networks or ports. Filters provided by users are free form expressions,
+//     so they are not degraded: the kernel does not filter at all.
+func planPcapFilter(
+	ctx context.Context,
+	filter *string,
+	providers []PcapFilterProvider,
+	exclude []string,
+	filters PcapFilters,
+	profiles []*PcapProfile,
+	compile bpfCompiler,
+) (*pcapFilterPlan, error) {
+	plan := &pcapFilterPlan{filter: *providePcapFilter(ctx, filter, providers, exclude, filters, profiles)}
+	if plan.filter == "" {
+		return plan, nil
+	}
+
+	instructions, err := compile(plan.filter)
+	if err != nil {
+		return plan, fmt.Errorf("BPF filter error: %w", err)
+	}
+	if len(instructions) <= bpfMaxInstructions {
+		plan.instructions = instructions
+		return plan, nil
+	}
+
+	plan.software, plan.filter = plan.filter, ""
+	if filter != nil && *filter != "" && !strings.EqualFold(*filter, "DISABLED") {
+		return plan, nil
+	}
+
+	kernel := make([]PcapFilterProvider, 0, len(providers))
+	for _, provider := range providers {
+		if provider != nil {
+			kernel = append(kernel, provider)
+		}
+	}
+	for len(kernel) > 0 {
+		largest, largestSize := 0, -1
+		for i, provider := range kernel {
+			if f, ok := provider.Get(ctx); ok && f != nil && len(*f) > largestSize {
+				largest, largestSize = i, len(*f)
+			}
+		}
+		plan.degraded = append(plan.degraded, kernel[largest])
+		kernel = slices.Delete(kernel, largest, largest+1)
+		if len(kernel) == 0 {
+			// the default filter is not broader than all generated filters; i/e: `arp`
+			break
+		}
+
+		degraded := *providePcapFilter(ctx, filter, kernel, exclude, filters, profiles)
+		if instructions, err := compile(degraded); err == nil && len(instructions) <= bpfMaxInstructions {
+			plan.filter, plan.instructions = degraded, instructions
+			return plan, nil
+		}
+	}
+	return plan, nil
+}
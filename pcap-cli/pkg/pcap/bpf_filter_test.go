@@ -0,0 +1,246 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/gopacket/pcap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// bpfFilterTestProvider generates a filter matching `hosts` hosts.
+type bpfFilterTestProvider struct {
+	name   string
+	filter string
+}
+
+func newBPFFilterTestProvider(name string, hosts int) *bpfFilterTestProvider {
+	terms := make([]string, hosts)
+	for i := range terms {
+		terms[i] = fmt.Sprintf("host 10.0.%d.%d", len(name), i)
+	}
+	return &bpfFilterTestProvider{name: name, filter: strings.Join(terms, " or ")}
+}
+
+func (p *bpfFilterTestProvider) String() string {
+	return p.name
+}
+
+func (p *bpfFilterTestProvider) Get(_ context.Context) (*string, bool) {
+	return &p.filter, true
+}
+
+func (p *bpfFilterTestProvider) Apply(_ context.Context, filter *string, _ PcapFilterMode) *string {
+	applied := fmt.Sprintf("(%s)", p.filter)
+	if *filter != "" {
+		applied = fmt.Sprintf("(%s) and %s", *filter, applied)
+	}
+	return &applied
+}
+
+// bpfFilterTestInstructionsPerHost makes 21 hosts too large for the kernel once the VLAN template doubles them.
+const bpfFilterTestInstructionsPerHost = 100
+
+// bpfFilterTestCompiler is a `bpfCompiler` which does not need libpcap:
+// programs have a fixed number of instructions per host, and filters containing `invalid` do not compile.
+func bpfFilterTestCompiler(filter string) ([]pcap.BPFInstruction, error) {
+	if strings.Contains(filter, "invalid") {
+		return nil, errors.New("syntax error")
+	}
+	return make([]pcap.BPFInstruction, strings.Count(filter, "host ")*bpfFilterTestInstructionsPerHost), nil
+}
+
+// TestPlanPcapFilter verifies which portion of oversized filters is enforced by the kernel, and which in software.
+func TestPlanPcapFilter(t *testing.T) {
+	t.Parallel()
+
+	large := newBPFFilterTestProvider("large", 25)
+	medium := newBPFFilterTestProvider("medium", 21)
+	small := newBPFFilterTestProvider("small", 1)
+	other := newBPFFilterTestProvider("other", 5)
+
+	userHosts := make([]string, 50)
+	for i := range userHosts {
+		userHosts[i] = fmt.Sprintf("host 192.168.0.%d", i)
+	}
+	oversized := strings.Join(userHosts, " or ")
+
+	tests := []struct {
+		name      string
+		filter    string
+		providers []PcapFilterProvider
+		// host primitives within the kernel filter; `0` if the kernel does not filter at all
+		hosts    int
+		software bool
+		degraded []string
+		err      bool
+	}{
+		{
+			name:      "fits",
+			providers: []PcapFilterProvider{small, other},
+			// generated filters match untagged and tagged frames
+			hosts: 2 * 6,
+		},
+		{
+			name:   "user_filter_fits",
+			filter: "host 10.0.0.1 or host 10.0.0.2",
+			hosts:  2,
+		},
+		{
+			name:     "user_filter_is_not_degraded",
+			filter:   oversized,
+			software: true,
+		},
+		{
+			name:      "largest_provider_is_degraded",
+			providers: []PcapFilterProvider{small, large, other},
+			hosts:     2 * 6,
+			software:  true,
+			degraded:  []string{"large"},
+		},
+		{
+			name:      "degraded_until_it_fits",
+			providers: []PcapFilterProvider{medium, small, large},
+			hosts:     2 * 1,
+			software:  true,
+			degraded:  []string{"large", "medium"},
+		},
+		{
+			name:      "all_providers_are_degraded",
+			providers: []PcapFilterProvider{large, medium},
+			software:  true,
+			degraded:  []string{"large", "medium"},
+		},
+		{
+			name:   "invalid",
+			filter: "invalid",
+			err:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			plan, err := planPcapFilter(context.Background(), &tt.filter, tt.providers, nil, nil, nil, bpfFilterTestCompiler)
+			if tt.err {
+				assert.ErrorContains(t, err, "BPF filter error")
+				return
+			}
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.hosts, strings.Count(plan.filter, "host "))
+			assert.Equal(t, tt.hosts*bpfFilterTestInstructionsPerHost, len(plan.instructions))
+			assert.Equal(t, tt.software, plan.software != "")
+			if tt.software && tt.filter != "" {
+				assert.Contains(t, plan.software, tt.filter)
+			}
+
+			var degraded []string
+			for _, provider := range plan.degraded {
+				degraded = append(degraded, provider.String())
+			}
+			assert.Equal(t, tt.degraded, degraded)
+		})
+	}
+}
+
+// TestFindOffendingBPFToken verifies that tokens quoted by errors are preferred, and that the prefix search is used otherwise.
+func TestFindOffendingBPFToken(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		filter string
+		err    string
+		token  string
+		offset int
+		// whether the prefix search compiles portions of the filter
+		compiles bool
+	}{
+		{
+			name:   "quoted",
+			filter: "tcp and host exmaple.com",
+			err:    "unknown host 'exmaple.com'",
+			token:  "exmaple.com",
+			offset: 13,
+		},
+		{
+			name:   "quoted_within_token",
+			filter: "tcp and port=https",
+			err:    "unknown port 'https'",
+			token:  "port=https",
+			offset: 8,
+		},
+		{
+			name:     "prefix",
+			filter:   "tcp and port invalid or udp",
+			err:      "syntax error",
+			token:    "invalid",
+			offset:   13,
+			compiles: true,
+		},
+		{
+			name:     "quoted_elsewhere",
+			filter:   "tcp and invalid",
+			err:      "unknown host 'exmaple.com'",
+			token:    "invalid",
+			offset:   8,
+			compiles: true,
+		},
+		{
+			name:     "no_prefix_compiles",
+			filter:   "invalid and tcp",
+			err:      "syntax error",
+			token:    "invalid",
+			offset:   0,
+			compiles: true,
+		},
+		{
+			name:   "empty",
+			filter: "  ",
+			err:    "syntax error",
+			token:  "",
+			offset: -1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			compiled := 0
+			compile := func(filter string) ([]pcap.BPFInstruction, error) {
+				compiled++
+				return bpfFilterTestCompiler(filter)
+			}
+
+			token, offset := findOffendingBPFToken(tt.filter, errors.New(tt.err), compile)
+			assert.Equal(t, tt.token, token)
+			assert.Equal(t, tt.offset, offset)
+			assert.Equal(t, tt.compiles, compiled > 0)
+		})
+	}
+
+	err := newPcapFilterError("tcp and port invalid", errors.New("syntax error"), bpfFilterTestCompiler)
+	assert.EqualError(t, err, "invalid filter [tcp and port invalid]: syntax error; near 'invalid' at offset 13")
+	assert.Equal(t, "syntax error", errors.Unwrap(err).Error())
+}
@@ -0,0 +1,241 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type (
+	// PcapManifest describes a file once it is complete, so that it can be verified after the fact:
+	//   - it is written next to the file it describes, as `{file}.manifest.json`,
+	//   - counters only include packets captured while the file was written by the engine which completed it;
+	//     translations of packets captured right before `End` may still be written into the next file.
+	PcapManifest struct {
+		File          string            `json:"file"`
+		Size          int64             `json:"size"`
+		SHA256        string            `json:"sha256"`
+		Iface         string            `json:"iface"`
+		Filter        string            `json:"filter"`
+		Format        string            `json:"format"`
+		SchemaVersion string            `json:"schemaVersion,omitempty"`
+		Start         time.Time         `json:"start"`
+		End           time.Time         `json:"end"`
+		Reason        string            `json:"reason"`
+		Packets       uint64            `json:"packets"`
+		Bytes         uint64            `json:"bytes"`
+		Errors        uint64            `json:"errors"`
+		Drops         PcapManifestDrops `json:"drops"`
+	}
+
+	// PcapManifestDrops are packets which did not make it into the file; see `PcapStats`.
+	PcapManifestDrops struct {
+		Kernel       uint64 `json:"kernel"`
+		Iface        uint64 `json:"iface"`
+		FilteredOut  uint64 `json:"filteredOut"`
+		PausedOut    uint64 `json:"pausedOut"`
+		TriggeredOut uint64 `json:"triggeredOut"`
+	}
+
+	// pcapManifestSource is the capture whose translations are written into the files of a writer.
+	pcapManifestSource struct {
+		engine PcapEngine
+		iface  string
+		format string
+	}
+
+	// pcapManifests tracks the file being written by a writer, so that its manifest is written when it is completed:
+	//   - files are completed when they are rotated, and when the writer is closed,
+	//   - nothing is tracked until an engine uses the writer; see `usePcapWriterManifests`.
+	pcapManifests struct {
+		mutex    sync.Mutex
+		source   *pcapManifestSource
+		file     string
+		start    time.Time
+		baseline *PcapStats
+		// why the current file is completed by the next rotation
+		reason string
+		// checksums are computed without blocking the rotation
+		pending sync.WaitGroup
+	}
+)
+
+const PcapManifestExtension = ".manifest.json"
+
+const (
+	pcapManifestRotation = "rotation"
+	pcapManifestStop     = "stop"
+	pcapManifestClose    = "close"
+)
+
+func newPcapManifests() *pcapManifests {
+	return &pcapManifests{reason: pcapManifestRotation}
+}
+
+// use replaces the capture described by manifests; i/e: when engines are re-created by a restart.
+func (m *pcapManifests) use(source *pcapManifestSource) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.source = source
+	m.baseline = source.engine.Stats()
+}
+
+// next completes the current file, if any, as `file` is about to be created.
+func (m *pcapManifests) next(file string) {
+	if m == nil {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.source == nil {
+		return
+	}
+
+	now := time.Now()
+	stats := m.source.engine.Stats()
+	if m.file != "" {
+		m.complete(m.describe(now, stats), false /* sync */)
+	}
+
+	m.file = file
+	m.start = now
+	m.baseline = stats
+	m.reason = pcapManifestRotation
+}
+
+// stop marks the current file as the last one of the capture; its rotation is caused by the capture being stopped.
+func (m *pcapManifests) stop() {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.reason = pcapManifestStop
+}
+
+// close completes the current file, and waits for all manifests to be written.
+func (m *pcapManifests) close() {
+	if m == nil {
+		return
+	}
+
+	m.mutex.Lock()
+	if m.source != nil && m.file != "" {
+		m.reason = pcapManifestClose
+		m.complete(m.describe(time.Now(), m.source.engine.Stats()), true /* sync */)
+		m.file = ""
+	}
+	m.mutex.Unlock()
+
+	m.pending.Wait()
+}
+
+func (m *pcapManifests) describe(end time.Time, stats *PcapStats) *PcapManifest {
+	return &PcapManifest{
+		File:          filepath.Base(m.file),
+		Iface:         m.source.iface,
+		Filter:        m.source.engine.Filter(),
+		Format:        m.source.format,
+		SchemaVersion: TranslationSchemaVersion(m.source.format),
+		Start:         m.start,
+		End:           end,
+		Reason:        m.reason,
+		Packets:       stats.Packets - m.baseline.Packets,
+		Bytes:         stats.Bytes - m.baseline.Bytes,
+		Errors:        stats.Errors - m.baseline.Errors,
+		Drops: PcapManifestDrops{
+			Kernel:       stats.Dropped - m.baseline.Dropped,
+			Iface:        stats.IfDropped - m.baseline.IfDropped,
+			FilteredOut:  stats.FilteredOut - m.baseline.FilteredOut,
+			PausedOut:    stats.PausedOut - m.baseline.PausedOut,
+			TriggeredOut: stats.TriggeredOut - m.baseline.TriggeredOut,
+		},
+	}
+}
+
+// complete writes the manifest of the current file:
+//   - the file is opened right away: it may be moved, or deleted, as soon as the next one is created,
+//   - files which are empty when the writer is closed are the ones created when captures were stopped.
+func (m *pcapManifests) complete(manifest *PcapManifest, sync bool) {
+	file, err := os.Open(m.file)
+	if err != nil {
+		pcapWriterLogger.Printf("manifest of %s not written: %v\n", m.file, err)
+		return
+	}
+
+	info, err := file.Stat()
+	if err != nil || (info.Size() == 0 && manifest.Reason == pcapManifestClose) {
+		file.Close()
+		return
+	}
+	manifest.Size = info.Size()
+
+	path := m.file + PcapManifestExtension
+	m.pending.Add(1)
+	write := func() {
+		defer m.pending.Done()
+		defer file.Close()
+		if err := writePcapManifest(file, path, manifest); err != nil {
+			pcapWriterLogger.Printf("manifest of %s not written: %v\n", manifest.File, err)
+		}
+	}
+
+	if sync {
+		write()
+	} else {
+		go write()
+	}
+}
+
+// writePcapManifest renames the manifest into `path` only once it is complete; i/e: so that it is not exported partially.
+func writePcapManifest(file *os.File, path string, manifest *PcapManifest) error {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return err
+	}
+	manifest.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".tmp", data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// usePcapWriterManifests unwraps writers decorated by routes and profiles; writers without files are ignored.
+func usePcapWriterManifests(writer PcapWriter, source *pcapManifestSource) {
+	switch w := writer.(type) {
+	case *routedPcapWriter:
+		usePcapWriterManifests(w.PcapWriter, source)
+	case *profiledPcapWriter:
+		usePcapWriterManifests(w.PcapWriter, source)
+	case *pcapWriter:
+		if w.fileNameProvider != nil {
+			w.fileNameProvider.manifests.use(source)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pcapManifestsTestEngine reports whatever stats it is given.
+type pcapManifestsTestEngine struct {
+	stats atomic.Pointer[PcapStats]
+}
+
+func newPcapManifestsTestEngine() *pcapManifestsTestEngine {
+	e := &pcapManifestsTestEngine{}
+	e.stats.Store(&PcapStats{})
+	return e
+}
+
+func (e *pcapManifestsTestEngine) Start(context.Context, []PcapWriter, <-chan *time.Duration) error {
+	return nil
+}
+
+func (e *pcapManifestsTestEngine) IsActive() bool { return true }
+
+func (e *pcapManifestsTestEngine) IsReady() bool { return true }
+
+func (e *pcapManifestsTestEngine) Stats() *PcapStats { return e.stats.Load() }
+
+func (e *pcapManifestsTestEngine) Filter() string { return "tcp port 443" }
+
+func newPcapManifestsTestFile(t *testing.T, directory, name, content string) string {
+	t.Helper()
+
+	file := filepath.Join(directory, name)
+	require.NoError(t, os.WriteFile(file, []byte(content), 0o644))
+	return file
+}
+
+func readPcapManifest(t *testing.T, file string) *PcapManifest {
+	t.Helper()
+
+	data, err := os.ReadFile(file + PcapManifestExtension)
+	require.NoError(t, err)
+
+	manifest := &PcapManifest{}
+	require.NoError(t, json.Unmarshal(data, manifest))
+	return manifest
+}
+
+// TestPcapManifests verifies that every completed file is described by its size, checksum,
+// and the counters of packets captured while it was written.
+func TestPcapManifests(t *testing.T) {
+	t.Parallel()
+
+	directory := t.TempDir()
+	engine := newPcapManifestsTestEngine()
+	engine.stats.Store(&PcapStats{Packets: 100, Bytes: 10000, Errors: 1})
+
+	manifests := newPcapManifests()
+	manifests.use(&pcapManifestSource{engine: engine, iface: "eth0", format: "json"})
+
+	first := newPcapManifestsTestFile(t, directory, "part__0_eth0.json", "first\n")
+	manifests.next(first)
+
+	engine.stats.Store(&PcapStats{
+		Packets: 110, Bytes: 11000, Errors: 2,
+		Dropped: 3, IfDropped: 4, FilteredOut: 5, PausedOut: 6, TriggeredOut: 7,
+	})
+
+	second := newPcapManifestsTestFile(t, directory, "part__1_eth0.json", "second\n")
+	manifests.next(second)
+
+	engine.stats.Store(&PcapStats{Packets: 115, Bytes: 11500, Errors: 2, Dropped: 3, IfDropped: 4, FilteredOut: 5, PausedOut: 6, TriggeredOut: 7})
+	manifests.close()
+
+	manifest := readPcapManifest(t, first)
+	checksum := sha256.Sum256([]byte("first\n"))
+	assert.Equal(t, "part__0_eth0.json", manifest.File)
+	assert.Equal(t, int64(len("first\n")), manifest.Size)
+	assert.Equal(t, hex.EncodeToString(checksum[:]), manifest.SHA256)
+	assert.Equal(t, "eth0", manifest.Iface)
+	assert.Equal(t, "tcp port 443", manifest.Filter)
+	assert.Equal(t, "json", manifest.Format)
+	assert.Equal(t, TranslationSchemaVersion("json"), manifest.SchemaVersion)
+	assert.Equal(t, pcapManifestRotation, manifest.Reason)
+	assert.False(t, manifest.End.Before(manifest.Start))
+	assert.Equal(t, uint64(10), manifest.Packets)
+	assert.Equal(t, uint64(1000), manifest.Bytes)
+	assert.Equal(t, uint64(1), manifest.Errors)
+	assert.Equal(t, PcapManifestDrops{Kernel: 3, Iface: 4, FilteredOut: 5, PausedOut: 6, TriggeredOut: 7}, manifest.Drops)
+
+	manifest = readPcapManifest(t, second)
+	assert.Equal(t, "part__1_eth0.json", manifest.File)
+	assert.Equal(t, pcapManifestClose, manifest.Reason)
+	assert.Equal(t, uint64(5), manifest.Packets)
+	assert.Equal(t, uint64(500), manifest.Bytes)
+	assert.Equal(t, uint64(0), manifest.Errors)
+	assert.Equal(t, PcapManifestDrops{}, manifest.Drops)
+	assert.True(t, manifest.Start.Equal(readPcapManifest(t, first).End))
+
+	assert.NoFileExists(t, first+PcapManifestExtension+".tmp")
+	assert.NoFileExists(t, second+PcapManifestExtension+".tmp")
+}
+
+// TestPcapManifestsStop verifies that the last file of a stopped capture is completed because of the stop,
+// and that the empty file created by the stop is not described.
+func TestPcapManifestsStop(t *testing.T) {
+	t.Parallel()
+
+	directory := t.TempDir()
+
+	manifests := newPcapManifests()
+	manifests.use(&pcapManifestSource{engine: newPcapManifestsTestEngine(), iface: "eth0", format: "pcap"})
+
+	last := newPcapManifestsTestFile(t, directory, "part__0_eth0.pcap", "last")
+	manifests.next(last)
+	manifests.stop()
+
+	empty := newPcapManifestsTestFile(t, directory, "part__1_eth0.pcap", "")
+	manifests.next(empty)
+	manifests.close()
+
+	assert.Equal(t, pcapManifestStop, readPcapManifest(t, last).Reason)
+	assert.NoFileExists(t, empty+PcapManifestExtension)
+}
+
+// TestPcapManifestsUntracked verifies that no manifests are written until an engine uses the writer,
+// nor for files which no longer exist when they are completed.
+func TestPcapManifestsUntracked(t *testing.T) {
+	t.Parallel()
+
+	t.Run("without_source", func(t *testing.T) {
+		t.Parallel()
+
+		directory := t.TempDir()
+		manifests := newPcapManifests()
+
+		file := newPcapManifestsTestFile(t, directory, "part__0_eth0.json", "untracked\n")
+		manifests.next(file)
+		manifests.next(newPcapManifestsTestFile(t, directory, "part__1_eth0.json", "untracked\n"))
+		manifests.close()
+
+		assert.NoFileExists(t, file+PcapManifestExtension)
+	})
+
+	t.Run("nil", func(t *testing.T) {
+		t.Parallel()
+
+		var manifests *pcapManifests
+		assert.NotPanics(t, func() {
+			manifests.next("part__0_eth0.json")
+			manifests.stop()
+			manifests.close()
+		})
+	})
+
+	t.Run("deleted_file", func(t *testing.T) {
+		t.Parallel()
+
+		directory := t.TempDir()
+		manifests := newPcapManifests()
+		manifests.use(&pcapManifestSource{engine: newPcapManifestsTestEngine(), iface: "eth0", format: "json"})
+
+		file := newPcapManifestsTestFile(t, directory, "part__0_eth0.json", "deleted\n")
+		manifests.next(file)
+		require.NoError(t, os.Remove(file))
+		manifests.close()
+
+		entries, err := os.ReadDir(directory)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+}
+
+// TestUsePcapWriterManifests verifies that writers decorated by routes and profiles describe the files of the writer they wrap.
+func TestUsePcapWriterManifests(t *testing.T) {
+	t.Parallel()
+
+	source := &pcapManifestSource{engine: newPcapManifestsTestEngine(), iface: "eth0", format: "json"}
+
+	provider := &pcapFileNameProvider{manifests: newPcapManifests()}
+	writer := &profiledPcapWriter{
+		PcapWriter: &routedPcapWriter{
+			PcapWriter: &pcapWriter{fileNameProvider: provider},
+		},
+	}
+
+	usePcapWriterManifests(writer, source)
+	assert.Same(t, source, provider.manifests.source)
+
+	assert.NotPanics(t, func() {
+		usePcapWriterManifests(&pcapWriter{}, source)
+		usePcapWriterManifests(&pcapManagerTestWriter{}, source)
+	})
+}
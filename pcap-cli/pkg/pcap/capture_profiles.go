@@ -0,0 +1,164 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/pcap-sidecar/pcap-cli/internal/transformer"
+	"github.com/wissance/stringFormatter"
+)
+
+type (
+	// PcapProfile is a named capture which shares the packet source, and the translations, of the capture it belongs to:
+	// packets are decoded once, and then written by the writers of every profile whose filters allow them.
+	PcapProfile struct {
+		Name string
+		// BPF expression of the packets of this profile: the kernel captures the packets of the capture and of all its profiles
+		Filter string
+		// packets captured for the capture, or for other profiles, are checked against these filters
+		Filters PcapFilters
+		// seconds after which files of this profile are rotated; `0` uses the interval of the capture
+		Interval int
+	}
+
+	profiledPcapWriter struct {
+		PcapWriter
+		profile *PcapProfile
+	}
+)
+
+const (
+	pcapProfilesSeparator = ";"
+	pcapProfileSeparator  = "@"
+	pcapProfileInterval   = ":"
+)
+
+var (
+	// names of profiles are part of the names of their files
+	pcapProfileName   = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+	pcapVLANPrimitive = regexp.MustCompile(`\bvlan\b`)
+)
+
+// NewPcapProfile compiles `expression` into the BPF expression and filters of the profile; see `CompilePcapFilterExpression`.
+func NewPcapProfile(name, expression string, interval int) (*PcapProfile, error) {
+	if !pcapProfileName.MatchString(name) {
+		return nil, fmt.Errorf("invalid profile name '%s': only letters, digits, '_' and '-' are allowed", name)
+	}
+	if interval < 0 {
+		return nil, fmt.Errorf("invalid rotation interval for profile '%s': %d", name, interval)
+	}
+
+	filters := NewPcapFilters()
+	parsed, err := compilePcapFilterExpression(expression, filters)
+	if err != nil {
+		return nil, fmt.Errorf("invalid profile '%s': %w", name, err)
+	}
+
+	// tagged frames are matched by the filter of the capture along with the ones of its profiles; see `withProfiles`
+	filter := strings.Join(parsed.terms, " and ")
+	if len(parsed.vlans) > 0 || len(parsed.deniedVLANs) > 0 {
+		filter = withVLANs(filter, parsed.vlans, parsed.deniedVLANs)
+	}
+
+	return &PcapProfile{Name: name, Filter: filter, Filters: filters, Interval: interval}, nil
+}
+
+// NewPcapProfiles parses `;` separated `{name}[:{interval}]@{filter expression}` rules;
+// i/e: `dns@udp and port 53;egress-443:300@port 443 and not net 10.0.0.0/8`.
+func NewPcapProfiles(rules string) ([]*PcapProfile, error) {
+	profiles := []*PcapProfile{}
+	names := make(map[string]struct{})
+	for _, rule := range strings.Split(rules, pcapProfilesSeparator) {
+		if rule = strings.TrimSpace(rule); rule == "" {
+			continue
+		}
+		rawName, expression, ok := strings.Cut(rule, pcapProfileSeparator)
+		if !ok {
+			return nil, fmt.Errorf("invalid profile '%s': '{name}@{filter expression}' expected", rule)
+		}
+
+		name, rawInterval, hasInterval := strings.Cut(strings.TrimSpace(rawName), pcapProfileInterval)
+		interval := 0
+		if hasInterval {
+			var err error
+			if interval, err = strconv.Atoi(strings.TrimSpace(rawInterval)); err != nil {
+				return nil, fmt.Errorf("invalid rotation interval for profile '%s': %s", name, rawInterval)
+			}
+		}
+
+		name = strings.TrimSpace(name)
+		if _, ok := names[name]; ok {
+			return nil, fmt.Errorf("duplicate profile '%s'", name)
+		}
+		names[name] = struct{}{}
+
+		profile, err := NewPcapProfile(name, expression, interval)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, profile)
+	}
+	return profiles, nil
+}
+
+// RotationInterval returns the interval of this profile, or `interval` if the profile does not set its own.
+func (p *PcapProfile) RotationInterval(interval int) int {
+	if p.Interval > 0 {
+		return p.Interval
+	}
+	return interval
+}
+
+// Writer makes `writer` only write translations of packets allowed by the filters of this profile.
+func (p *PcapProfile) Writer(writer PcapWriter) PcapWriter {
+	if writer == nil {
+		return writer
+	}
+	return &profiledPcapWriter{PcapWriter: writer, profile: p}
+}
+
+// Profile is used by transformers to select which records are written by this writer.
+func (w *profiledPcapWriter) Profile() (string, transformer.PcapFilters) {
+	filters, ok := w.profile.Filters.(transformer.PcapFilters)
+	if !ok {
+		filters = nil
+	}
+	return w.profile.Name, filters
+}
+
+// withProfiles makes the kernel capture the packets of all profiles along with the packets of the capture;
+// an empty `filter` already captures everything. Generated filters of captures wrap the result to match tagged frames.
+//
+// `vlan` shifts the offsets of the expressions that follow it, even across `or`: a free form filter of the capture may use it
+// as it comes last, but profiles using it make the kernel capture everything; their filters are still enforced in userspace.
+func withProfiles(filter string, profiles []*PcapProfile, exclude []string) string {
+	if filter == "" || len(profiles) == 0 {
+		return filter
+	}
+	terms := make([]string, 0, len(profiles)+1)
+	for _, profile := range profiles {
+		if profile.Filter == "" || pcapVLANPrimitive.MatchString(profile.Filter) {
+			return withExclusions("", exclude)
+		}
+		// exclusions apply to profiles as well: they are never captured
+		terms = append(terms, stringFormatter.Format("({0})", withExclusions(profile.Filter, exclude)))
+	}
+	terms = append(terms, stringFormatter.Format("({0})", filter))
+	return strings.Join(terms, " or ")
+}
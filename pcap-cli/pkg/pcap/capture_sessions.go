@@ -0,0 +1,346 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+type (
+	// PcapSession is a time-boxed capture: it starts at a given time, or when triggered, and ends after its max duration or max bytes.
+	PcapSession struct {
+		Name string `json:"name" yaml:"name"`
+		// RFC 3339 time; empty starts it as soon as previous sessions end, while `trigger` waits for `PcapSessions.Trigger`
+		Start string `json:"start,omitempty" yaml:"start"`
+		// seconds; `0` means no limit
+		Duration uint `json:"duration,omitempty" yaml:"duration"`
+		// bytes captured by all engines; `0` means no limit. `tcpdump` engines only report stats after they stop
+		MaxBytes uint64 `json:"max_bytes,omitempty" yaml:"max_bytes"`
+	}
+
+	PcapSessionState string
+
+	PcapSessionStatus struct {
+		*PcapSession
+		State     PcapSessionState `json:"state"`
+		StartedAt *time.Time       `json:"started_at,omitempty"`
+		EndedAt   *time.Time       `json:"ended_at,omitempty"`
+		Bytes     uint64           `json:"bytes"`
+		// why the session ended; i/e: `max duration`
+		Reason string `json:"reason,omitempty"`
+	}
+
+	// PcapSessions is a queue of sessions which run one after the other, in the order in which they were queued.
+	PcapSessions struct {
+		mutex    sync.Mutex
+		sessions []*pcapQueuedSession
+		// closed, and replaced, every time the queue changes
+		changed chan struct{}
+	}
+
+	pcapQueuedSession struct {
+		status    *PcapSessionStatus
+		startAt   time.Time
+		triggered bool
+		cancel    context.CancelCauseFunc
+	}
+)
+
+const (
+	PcapSessionQueued    PcapSessionState = "queued"
+	PcapSessionRunning   PcapSessionState = "running"
+	PcapSessionCompleted PcapSessionState = "completed"
+	PcapSessionCancelled PcapSessionState = "cancelled"
+
+	// value of `Start` of sessions which wait to be triggered
+	PcapSessionTrigger = "trigger"
+
+	pcapSessionStatsInterval = time.Second
+)
+
+var (
+	// cause of the context of sessions which ended; see `PcapSessions.Next`
+	ErrPcapSessionEnded = errors.New("session ended")
+
+	errPcapSessionMaxDuration = fmt.Errorf("%w: max duration", ErrPcapSessionEnded)
+	errPcapSessionMaxBytes    = fmt.Errorf("%w: max bytes", ErrPcapSessionEnded)
+	errPcapSessionCancelled   = fmt.Errorf("%w: cancelled", ErrPcapSessionEnded)
+)
+
+// startAt returns the time at which `s` may start; the zero time if it starts as soon as possible, or when triggered.
+func (s *PcapSession) startAt() (time.Time, error) {
+	if !pcapProfileName.MatchString(s.Name) {
+		return time.Time{}, fmt.Errorf("invalid session name '%s': only letters, digits, '_' and '-' are allowed", s.Name)
+	}
+	if s.Duration == 0 && s.MaxBytes == 0 {
+		return time.Time{}, fmt.Errorf("session '%s' requires a max duration or max bytes", s.Name)
+	}
+	if s.Start == "" || s.Start == PcapSessionTrigger {
+		return time.Time{}, nil
+	}
+	startAt, err := time.Parse(time.RFC3339, s.Start)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid start of session '%s': %w", s.Name, err)
+	}
+	return startAt, nil
+}
+
+func NewPcapSessions(sessions ...PcapSession) (*PcapSessions, error) {
+	s := &PcapSessions{
+		sessions: make([]*pcapQueuedSession, 0, len(sessions)),
+		changed:  make(chan struct{}),
+	}
+	for _, session := range sessions {
+		if err := s.Enqueue(session); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// notify must be called while holding `s.mutex`
+func (s *PcapSessions) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// find must be called while holding `s.mutex`; sessions which are still pending take precedence over ended ones.
+func (s *PcapSessions) find(name string) *pcapQueuedSession {
+	var found *pcapQueuedSession
+	for _, session := range s.sessions {
+		if session.status.Name != name {
+			continue
+		}
+		if found = session; !session.isEnded() {
+			return session
+		}
+	}
+	return found
+}
+
+// startAtOrNever is `nil` safe: without a start time, sessions wait for the queue to change.
+func (s *pcapQueuedSession) startAtOrNever() time.Time {
+	if s == nil || s.startAt.IsZero() {
+		return time.Now().Add(24 * time.Hour)
+	}
+	return s.startAt
+}
+
+func (s *pcapQueuedSession) isEnded() bool {
+	return s.status.State == PcapSessionCompleted || s.status.State == PcapSessionCancelled
+}
+
+// Enqueue adds `session` to the end of the queue; names of sessions may be reused once they end.
+func (s *PcapSessions) Enqueue(session PcapSession) error {
+	startAt, err := session.startAt()
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if queued := s.find(session.Name); queued != nil && !queued.isEnded() {
+		return fmt.Errorf("session '%s' is already %s", session.Name, queued.status.State)
+	}
+	s.sessions = append(s.sessions, &pcapQueuedSession{
+		status:  &PcapSessionStatus{PcapSession: &session, State: PcapSessionQueued},
+		startAt: startAt,
+	})
+	s.notify()
+	return nil
+}
+
+// Merge enqueues all `sessions` whose names were never queued before; i/e: after a config file is reloaded.
+func (s *PcapSessions) Merge(sessions ...PcapSession) error {
+	for _, session := range sessions {
+		s.mutex.Lock()
+		known := s.find(session.Name) != nil
+		s.mutex.Unlock()
+		if known {
+			continue
+		}
+		if err := s.Enqueue(session); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Trigger allows the queued session `name` to start once all sessions queued before it end.
+func (s *PcapSessions) Trigger(name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	session := s.find(name)
+	if session == nil {
+		return fmt.Errorf("unknown session: %s", name)
+	}
+	if session.status.State != PcapSessionQueued || session.status.Start != PcapSessionTrigger {
+		return fmt.Errorf("session '%s' is %s, and does not wait to be triggered", name, session.status.State)
+	}
+	session.triggered = true
+	s.notify()
+	return nil
+}
+
+// Cancel removes the queued session `name` from the queue, or ends it if it is running.
+func (s *PcapSessions) Cancel(name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	session := s.find(name)
+	if session == nil {
+		return fmt.Errorf("unknown session: %s", name)
+	}
+	switch session.status.State {
+	case PcapSessionQueued:
+		now := time.Now()
+		session.status.State = PcapSessionCancelled
+		session.status.EndedAt = &now
+		s.notify()
+	case PcapSessionRunning:
+		session.cancel(errPcapSessionCancelled)
+	default:
+		return fmt.Errorf("session '%s' is already %s", name, session.status.State)
+	}
+	return nil
+}
+
+func (s *PcapSessions) Status() []*PcapSessionStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	statuses := make([]*PcapSessionStatus, len(s.sessions))
+	for i, session := range s.sessions {
+		status := *session.status
+		statuses[i] = &status
+	}
+	return statuses
+}
+
+// next returns the 1st queued session, whether it may start now, and a channel which is closed when the queue changes.
+func (s *PcapSessions) next() (*pcapQueuedSession, bool, <-chan struct{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	index := slices.IndexFunc(s.sessions, func(session *pcapQueuedSession) bool {
+		return session.status.State == PcapSessionQueued
+	})
+	if index < 0 {
+		return nil, false, s.changed
+	}
+	session := s.sessions[index]
+	if session.status.Start == PcapSessionTrigger {
+		return session, session.triggered, s.changed
+	}
+	return session, !time.Now().Before(session.startAt), s.changed
+}
+
+// Next blocks until the 1st queued session may start, and returns a context which is done when the session ends:
+//   - its cause wraps `ErrPcapSessionEnded`, and `end` must be called once engines are stopped,
+//   - bytes are the ones captured by engines registered with `control` since the session started, even if they are re-created,
+//   - if there are no queued sessions, it returns `false` unless `wait` is set, in which case it waits for new ones.
+func (s *PcapSessions) Next(ctx context.Context, control *PcapControl, wait bool) (context.Context, func(), bool) {
+	for {
+		session, ready, changed := s.next()
+		if session == nil && !wait {
+			return nil, nil, false
+		}
+		if ready {
+			// sessions may be cancelled in between `next` and `start`
+			if sessionCtx, end, started := s.start(ctx, session, control); started {
+				return sessionCtx, end, true
+			}
+			continue
+		}
+
+		timer := time.NewTimer(time.Until(session.startAtOrNever()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, nil, false
+		case <-changed:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// start returns `false` if `session` is not queued anymore; i/e: it was cancelled after `next` returned it.
+func (s *PcapSessions) start(ctx context.Context, session *pcapQueuedSession, control *PcapControl) (context.Context, func(), bool) {
+	s.mutex.Lock()
+	if session.status.State != PcapSessionQueued {
+		s.mutex.Unlock()
+		return nil, nil, false
+	}
+	startedAt := time.Now()
+	status := session.status
+	status.State = PcapSessionRunning
+	status.StartedAt = &startedAt
+	ctx, session.cancel = context.WithCancelCause(ctx)
+	s.mutex.Unlock()
+
+	cancelTimeout := func() {}
+	if status.Duration > 0 {
+		ctx, cancelTimeout = context.WithTimeoutCause(ctx, time.Duration(status.Duration)*time.Second, errPcapSessionMaxDuration)
+	}
+
+	// engines may be re-created while the session runs, so bytes are measured from the moment it started
+	startedAtBytes := control.Bytes()
+	go func() {
+		ticker := time.NewTicker(pcapSessionStatsInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			bytes := control.Bytes() - startedAtBytes
+			s.mutex.Lock()
+			status.Bytes = bytes
+			s.mutex.Unlock()
+			if status.MaxBytes > 0 && bytes >= status.MaxBytes {
+				session.cancel(errPcapSessionMaxBytes)
+			}
+		}
+	}()
+
+	end := func() {
+		cancelTimeout()
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		endedAt := time.Now()
+		status.EndedAt = &endedAt
+		status.State = PcapSessionCompleted
+		cause := context.Cause(ctx)
+		if errors.Is(cause, errPcapSessionCancelled) {
+			status.State = PcapSessionCancelled
+		}
+		if cause != nil {
+			status.Reason = cause.Error()
+		}
+		session.cancel(nil)
+		s.notify()
+	}
+	return ctx, end, true
+}
@@ -0,0 +1,234 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type pcapSessionsTestEngine struct {
+	bytes atomic.Uint64
+}
+
+func (e *pcapSessionsTestEngine) Start(context.Context, []PcapWriter, <-chan *time.Duration) error {
+	return nil
+}
+
+func (e *pcapSessionsTestEngine) IsActive() bool { return true }
+
+func (e *pcapSessionsTestEngine) IsReady() bool { return true }
+
+func (e *pcapSessionsTestEngine) Stats() *PcapStats { return &PcapStats{Bytes: e.bytes.Load()} }
+
+func (e *pcapSessionsTestEngine) Filter() string { return "" }
+
+func pcapSessionStatus(t *testing.T, sessions *PcapSessions, name string) *PcapSessionStatus {
+	for _, status := range sessions.Status() {
+		if status.Name == name {
+			return status
+		}
+	}
+	require.Failf(t, "unknown session", "%s", name)
+	return nil
+}
+
+func waitForPcapSession(t *testing.T, ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "session did not end")
+		return nil
+	}
+}
+
+// TestPcapSessionsValidation verifies that sessions without limits, or with invalid start times, are rejected.
+func TestPcapSessionsValidation(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewPcapSessions(PcapSession{Name: "unlimited"})
+	assert.Error(t, err)
+	_, err = NewPcapSessions(PcapSession{Name: "white space", Duration: 1})
+	assert.Error(t, err)
+	_, err = NewPcapSessions(PcapSession{Name: "yesterday", Start: "yesterday", Duration: 1})
+	assert.Error(t, err)
+
+	sessions, err := NewPcapSessions(PcapSession{Name: "once", Duration: 1})
+	require.NoError(t, err)
+	assert.Error(t, sessions.Enqueue(PcapSession{Name: "once", Duration: 1}))
+}
+
+// TestPcapSessionsStartAt verifies that sessions do not start before their start time, and that they run in order.
+func TestPcapSessionsStartAt(t *testing.T) {
+	t.Parallel()
+
+	startAt := time.Now().Add(300 * time.Millisecond)
+	sessions, err := NewPcapSessions(
+		PcapSession{Name: "first", Start: startAt.Format(time.RFC3339Nano), Duration: 60},
+		PcapSession{Name: "second", Duration: 60},
+	)
+	require.NoError(t, err)
+	control := NewPcapControl(nil, nil)
+
+	ctx, end, ok := sessions.Next(context.Background(), control, false)
+	require.True(t, ok)
+	assert.False(t, time.Now().Before(startAt))
+	status := pcapSessionStatus(t, sessions, "first")
+	assert.Equal(t, PcapSessionRunning, status.State)
+	if assert.NotNil(t, status.StartedAt) {
+		assert.False(t, status.StartedAt.Before(startAt))
+	}
+	assert.Equal(t, PcapSessionQueued, pcapSessionStatus(t, sessions, "second").State)
+
+	require.NoError(t, sessions.Cancel("first"))
+	assert.ErrorIs(t, waitForPcapSession(t, ctx), ErrPcapSessionEnded)
+	end()
+	status = pcapSessionStatus(t, sessions, "first")
+	assert.Equal(t, PcapSessionCancelled, status.State)
+	assert.Equal(t, errPcapSessionCancelled.Error(), status.Reason)
+	assert.NotNil(t, status.EndedAt)
+
+	ctx, end, ok = sessions.Next(context.Background(), control, false)
+	require.True(t, ok)
+	assert.Equal(t, PcapSessionRunning, pcapSessionStatus(t, sessions, "second").State)
+	require.NoError(t, sessions.Cancel("second"))
+	waitForPcapSession(t, ctx)
+	end()
+
+	// without queued sessions, `Next` does not wait for new ones
+	_, _, ok = sessions.Next(context.Background(), control, false)
+	assert.False(t, ok)
+}
+
+// TestPcapSessionsTrigger verifies that sessions waiting to be triggered only start once they are.
+func TestPcapSessionsTrigger(t *testing.T) {
+	t.Parallel()
+
+	sessions, err := NewPcapSessions(
+		PcapSession{Name: "on-demand", Start: PcapSessionTrigger, Duration: 60},
+	)
+	require.NoError(t, err)
+	require.NoError(t, sessions.Enqueue(PcapSession{Name: "asap", Duration: 60}))
+
+	started := make(chan context.Context, 1)
+	go func() {
+		ctx, _, _ := sessions.Next(context.Background(), NewPcapControl(nil, nil), true)
+		started <- ctx
+	}()
+
+	select {
+	case <-started:
+		require.Fail(t, "session started before being triggered")
+	case <-time.After(100 * time.Millisecond):
+	}
+	assert.Error(t, sessions.Trigger("asap"))
+	assert.Error(t, sessions.Trigger("unknown"))
+	require.NoError(t, sessions.Trigger("on-demand"))
+
+	ctx := <-started
+	assert.Equal(t, PcapSessionRunning, pcapSessionStatus(t, sessions, "on-demand").State)
+	assert.Error(t, sessions.Trigger("on-demand"))
+	require.NoError(t, sessions.Cancel("on-demand"))
+	waitForPcapSession(t, ctx)
+}
+
+// TestPcapSessionsCancelBeforeStart verifies that sessions cancelled after being chosen to start, but before starting, do not run.
+func TestPcapSessionsCancelBeforeStart(t *testing.T) {
+	t.Parallel()
+
+	sessions, err := NewPcapSessions(PcapSession{Name: "cancelled", Duration: 60})
+	require.NoError(t, err)
+	control := NewPcapControl(nil, nil)
+
+	session, ready, _ := sessions.next()
+	require.True(t, ready)
+	require.NoError(t, sessions.Cancel("cancelled"))
+
+	_, _, started := sessions.start(context.Background(), session, control)
+	assert.False(t, started)
+	assert.Equal(t, PcapSessionCancelled, pcapSessionStatus(t, sessions, "cancelled").State)
+	assert.Error(t, sessions.Cancel("cancelled"))
+
+	_, _, ok := sessions.Next(context.Background(), control, false)
+	assert.False(t, ok)
+}
+
+// TestPcapSessionsMaxDuration verifies that sessions end after their max duration.
+func TestPcapSessionsMaxDuration(t *testing.T) {
+	t.Parallel()
+
+	sessions, err := NewPcapSessions(PcapSession{Name: "short", Duration: 1})
+	require.NoError(t, err)
+
+	ctx, end, ok := sessions.Next(context.Background(), NewPcapControl(nil, nil), false)
+	require.True(t, ok)
+	assert.ErrorIs(t, waitForPcapSession(t, ctx), errPcapSessionMaxDuration)
+	end()
+
+	status := pcapSessionStatus(t, sessions, "short")
+	assert.Equal(t, PcapSessionCompleted, status.State)
+	assert.Equal(t, errPcapSessionMaxDuration.Error(), status.Reason)
+	if assert.NotNil(t, status.StartedAt) && assert.NotNil(t, status.EndedAt) {
+		assert.GreaterOrEqual(t, status.EndedAt.Sub(*status.StartedAt), time.Second)
+	}
+}
+
+// TestPcapSessionsMaxBytes verifies that sessions end after their max bytes, even if engines are re-created while they run.
+func TestPcapSessionsMaxBytes(t *testing.T) {
+	t.Parallel()
+
+	sessions, err := NewPcapSessions(PcapSession{Name: "small", MaxBytes: 1000})
+	require.NoError(t, err)
+	control := NewPcapControl(nil, nil)
+
+	// bytes captured before the session started are not accounted
+	previous := &pcapSessionsTestEngine{}
+	previous.bytes.Store(5000)
+	control.Register("eth0", previous, nil)
+
+	ctx, end, ok := sessions.Next(context.Background(), control, false)
+	require.True(t, ok)
+	control.Reset(nil)
+
+	engine := &pcapSessionsTestEngine{}
+	control.Register("eth0", engine, nil)
+	engine.bytes.Store(600)
+	// i/e: the config file is reloaded
+	control.Reset(nil)
+	engine = &pcapSessionsTestEngine{}
+	control.Register("eth0", engine, nil)
+
+	select {
+	case <-ctx.Done():
+		require.Fail(t, "session ended before its max bytes")
+	case <-time.After(pcapSessionStatsInterval + 200*time.Millisecond):
+	}
+	assert.Equal(t, uint64(600), pcapSessionStatus(t, sessions, "small").Bytes)
+
+	engine.bytes.Store(400)
+	assert.ErrorIs(t, waitForPcapSession(t, ctx), errPcapSessionMaxBytes)
+	end()
+
+	status := pcapSessionStatus(t, sessions, "small")
+	assert.Equal(t, PcapSessionCompleted, status.State)
+	assert.Equal(t, errPcapSessionMaxBytes.Error(), status.Reason)
+	assert.Equal(t, uint64(1000), status.Bytes)
+}
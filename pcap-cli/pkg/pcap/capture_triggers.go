@@ -0,0 +1,255 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+type (
+	PcapTriggerCondition string
+
+	// PcapTrigger fires when at least `Threshold` packets matching `Condition` are captured within the same second.
+	PcapTrigger struct {
+		Condition PcapTriggerCondition
+		// `0` matches all ports: either port of `tcp_rst`, and the source port of responses otherwise
+		Port      uint16
+		Threshold uint
+	}
+
+	// PcapTriggers make engines behave as flight recorders: packets are only translated after a trigger fires,
+	// along with the ones captured within `Window` before it, and until no trigger fires for `Cooldown`.
+	PcapTriggers struct {
+		Triggers []*PcapTrigger
+		Window   time.Duration
+		Cooldown time.Duration
+	}
+
+	pcapTriggerCounter struct {
+		second int64
+		count  uint
+	}
+
+	// pcapFlightRecorder is the state of `PcapTriggers` for a single engine; it is not safe for concurrent use.
+	pcapFlightRecorder struct {
+		*PcapTriggers
+		counters     []pcapTriggerCounter
+		buffer       []gopacket.Packet
+		admitted     []gopacket.Packet
+		armed        bool
+		firedAt      time.Time
+		triggered    *atomic.Uint64
+		triggeredOut *atomic.Uint64
+		logger       *log.Logger
+		loggerPrefix string
+	}
+)
+
+const (
+	PcapTriggerTCPReset    PcapTriggerCondition = "tcp_rst"
+	PcapTriggerHTTP5xx     PcapTriggerCondition = "http_5xx"
+	PcapTriggerDNSServFail PcapTriggerCondition = "dns_servfail"
+
+	pcapTriggersSeparator = ";"
+	pcapTriggerPort       = "@"
+	pcapTriggerThreshold  = ">="
+
+	// packets buffered before a trigger fires, regardless of the window: a flood must not exhaust memory
+	pcapFlightRecorderLimit = 1 << 16
+)
+
+var pcapHTTP1Response = []byte("HTTP/1.")
+
+// NewPcapTriggers parses `;` separated `{condition}[@{port}][>={packets per second}]` rules;
+// i/e: `tcp_rst>=20;http_5xx@8080;dns_servfail>=5`. Thresholds default to 1.
+func NewPcapTriggers(rules string, window, cooldown time.Duration) (*PcapTriggers, error) {
+	triggers := &PcapTriggers{
+		Triggers: []*PcapTrigger{},
+		Window:   window,
+		Cooldown: cooldown,
+	}
+	for _, rule := range strings.Split(rules, pcapTriggersSeparator) {
+		if rule = strings.TrimSpace(rule); rule == "" {
+			continue
+		}
+		trigger := &PcapTrigger{Threshold: 1}
+
+		condition, threshold, hasThreshold := strings.Cut(rule, pcapTriggerThreshold)
+		if hasThreshold {
+			value, err := strconv.ParseUint(strings.TrimSpace(threshold), 10, 32)
+			if err != nil || value == 0 {
+				return nil, fmt.Errorf("invalid threshold of trigger '%s': %s", rule, threshold)
+			}
+			trigger.Threshold = uint(value)
+		}
+
+		condition, port, hasPort := strings.Cut(strings.TrimSpace(condition), pcapTriggerPort)
+		if hasPort {
+			value, err := strconv.ParseUint(strings.TrimSpace(port), 10, 16)
+			if err != nil || value == 0 {
+				return nil, fmt.Errorf("invalid port of trigger '%s': %s", rule, port)
+			}
+			trigger.Port = uint16(value)
+		}
+
+		switch trigger.Condition = PcapTriggerCondition(strings.TrimSpace(condition)); trigger.Condition {
+		case PcapTriggerTCPReset, PcapTriggerHTTP5xx, PcapTriggerDNSServFail:
+		default:
+			return nil, fmt.Errorf("invalid trigger '%s': condition must be 'tcp_rst', 'http_5xx' or 'dns_servfail'", rule)
+		}
+		triggers.Triggers = append(triggers.Triggers, trigger)
+	}
+
+	if len(triggers.Triggers) == 0 {
+		return nil, fmt.Errorf("no triggers: %s", rules)
+	}
+	if window < 0 || cooldown < 0 {
+		return nil, fmt.Errorf("window and cooldown of triggers must not be negative")
+	}
+	return triggers, nil
+}
+
+func (t *PcapTrigger) String() string {
+	rule := string(t.Condition)
+	if t.Port > 0 {
+		rule += pcapTriggerPort + strconv.Itoa(int(t.Port))
+	}
+	return rule + pcapTriggerThreshold + strconv.FormatUint(uint64(t.Threshold), 10)
+}
+
+func (t *PcapTrigger) matches(packet gopacket.Packet) bool {
+	switch t.Condition {
+	case PcapTriggerTCPReset:
+		tcp, ok := packet.Layer(layers.LayerTypeTCP).(*layers.TCP)
+		return ok && tcp.RST && (t.Port == 0 || uint16(tcp.SrcPort) == t.Port || uint16(tcp.DstPort) == t.Port)
+
+	case PcapTriggerHTTP5xx:
+		// only HTTP/1 status lines are visible without reassembling streams: HTTP/2 headers are compressed
+		tcp, ok := packet.Layer(layers.LayerTypeTCP).(*layers.TCP)
+		if !ok || (t.Port != 0 && uint16(tcp.SrcPort) != t.Port) {
+			return false
+		}
+		payload := tcp.LayerPayload()
+		return len(payload) >= 12 && bytes.HasPrefix(payload, pcapHTTP1Response) && payload[9] == '5'
+
+	case PcapTriggerDNSServFail:
+		dns, ok := packet.Layer(layers.LayerTypeDNS).(*layers.DNS)
+		if !ok || !dns.QR || dns.ResponseCode != layers.DNSResponseCodeServFail {
+			return false
+		}
+		if t.Port == 0 {
+			return true
+		}
+		if udp, ok := packet.Layer(layers.LayerTypeUDP).(*layers.UDP); ok {
+			return uint16(udp.SrcPort) == t.Port
+		}
+		tcp, ok := packet.Layer(layers.LayerTypeTCP).(*layers.TCP)
+		return ok && uint16(tcp.SrcPort) == t.Port
+	}
+	return false
+}
+
+func (c *pcapTriggerCounter) add(timestamp time.Time) uint {
+	if second := timestamp.Unix(); second != c.second {
+		c.second = second
+		c.count = 0
+	}
+	c.count++
+	return c.count
+}
+
+func newPcapFlightRecorder(
+	triggers *PcapTriggers,
+	triggered, triggeredOut *atomic.Uint64,
+	logger *log.Logger,
+	loggerPrefix string,
+) *pcapFlightRecorder {
+	return &pcapFlightRecorder{
+		PcapTriggers: triggers,
+		counters:     make([]pcapTriggerCounter, len(triggers.Triggers)),
+		buffer:       make([]gopacket.Packet, 0),
+		admitted:     make([]gopacket.Packet, 0, 1),
+		triggered:    triggered,
+		triggeredOut: triggeredOut,
+		logger:       logger,
+		loggerPrefix: loggerPrefix,
+	}
+}
+
+// admit returns the packets to be translated after `packet` is captured, in the order in which they were captured:
+//   - none while no trigger fired: `packet` is buffered,
+//   - all buffered packets, followed by `packet`, when a trigger fires,
+//   - only `packet` until no trigger fires for `Cooldown`.
+//
+// The returned slice is only valid until the next call.
+func (r *pcapFlightRecorder) admit(packet gopacket.Packet) []gopacket.Packet {
+	timestamp := packet.Metadata().Timestamp
+
+	var fired *PcapTrigger
+	for i, trigger := range r.Triggers {
+		if trigger.matches(packet) && r.counters[i].add(timestamp) >= trigger.Threshold {
+			fired = trigger
+		}
+	}
+
+	if fired != nil {
+		r.firedAt = timestamp
+		if !r.armed {
+			r.armed = true
+			r.triggered.Add(1)
+			r.logger.Printf("%s - trigger '%s' fired: translating %d buffered packets\n", r.loggerPrefix, fired, len(r.buffer))
+			admitted := append(r.buffer, packet)
+			r.buffer = make([]gopacket.Packet, 0, len(admitted))
+			return admitted
+		}
+	}
+
+	if r.armed {
+		if timestamp.Sub(r.firedAt) <= r.Cooldown {
+			r.admitted = append(r.admitted[:0], packet)
+			return r.admitted
+		}
+		r.armed = false
+		r.logger.Printf("%s - no trigger fired for %v: buffering packets\n", r.loggerPrefix, r.Cooldown)
+	}
+
+	r.buffer = append(r.buffer, packet)
+	evicted := 0
+	for evicted < len(r.buffer) &&
+		(len(r.buffer)-evicted > pcapFlightRecorderLimit || timestamp.Sub(r.buffer[evicted].Metadata().Timestamp) > r.Window) {
+		evicted++
+	}
+	if evicted > 0 {
+		clear(r.buffer[:evicted])
+		r.buffer = r.buffer[evicted:]
+		r.triggeredOut.Add(uint64(evicted))
+	}
+	return nil
+}
+
+// discard drops all buffered packets; i/e: when the engine stops.
+func (r *pcapFlightRecorder) discard() {
+	r.triggeredOut.Add(uint64(len(r.buffer)))
+	r.buffer = nil
+}
@@ -0,0 +1,201 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"io"
+	"log"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var pcapTriggersTestStart = time.Unix(1700000000, 0)
+
+// newPcapTriggersTestPacket serializes an IPv4 packet captured `at` after the start of the test.
+func newPcapTriggersTestPacket(t *testing.T, at time.Duration, transport gopacket.SerializableLayer, payload ...gopacket.SerializableLayer) gopacket.Packet {
+	ip := &layers.IPv4{Version: 4, TTL: 64, SrcIP: net.IPv4(10, 0, 0, 2), DstIP: net.IPv4(10, 0, 0, 1)}
+	switch l4 := transport.(type) {
+	case *layers.TCP:
+		ip.Protocol = layers.IPProtocolTCP
+		require.NoError(t, l4.SetNetworkLayerForChecksum(ip))
+	case *layers.UDP:
+		ip.Protocol = layers.IPProtocolUDP
+		require.NoError(t, l4.SetNetworkLayerForChecksum(ip))
+	}
+
+	buffer := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	require.NoError(t, gopacket.SerializeLayers(buffer, opts,
+		append([]gopacket.SerializableLayer{ip, transport}, payload...)...))
+
+	packet := gopacket.NewPacket(buffer.Bytes(), layers.LayerTypeIPv4, gopacket.Default)
+	packet.Metadata().Timestamp = pcapTriggersTestStart.Add(at)
+	return packet
+}
+
+func newPcapTriggersTestSegment(t *testing.T, at time.Duration, srcPort, dstPort layers.TCPPort, rst bool, payload string) gopacket.Packet {
+	return newPcapTriggersTestPacket(t, at,
+		&layers.TCP{SrcPort: srcPort, DstPort: dstPort, ACK: !rst, RST: rst, Window: 1024},
+		gopacket.Payload(payload))
+}
+
+func newPcapTriggersTestDNSResponse(t *testing.T, srcPort layers.UDPPort, code layers.DNSResponseCode) gopacket.Packet {
+	return newPcapTriggersTestPacket(t, 0,
+		&layers.UDP{SrcPort: srcPort, DstPort: 40000},
+		&layers.DNS{ID: 1, QR: true, ResponseCode: code})
+}
+
+// TestNewPcapTriggers verifies that rules are parsed with their defaults, and that invalid rules are rejected.
+func TestNewPcapTriggers(t *testing.T) {
+	t.Parallel()
+
+	triggers, err := NewPcapTriggers(" tcp_rst>=20; http_5xx@8080 ;;dns_servfail @ 53 >= 5", time.Second, 2*time.Second)
+	require.NoError(t, err)
+	rules := make([]string, len(triggers.Triggers))
+	for i, trigger := range triggers.Triggers {
+		rules[i] = trigger.String()
+	}
+	assert.Equal(t, []string{"tcp_rst>=20", "http_5xx@8080>=1", "dns_servfail@53>=5"}, rules)
+	assert.Equal(t, time.Second, triggers.Window)
+	assert.Equal(t, 2*time.Second, triggers.Cooldown)
+
+	for _, rules := range []string{
+		"",
+		" ; ",
+		"syn_flood",
+		"tcp_rst>=0",
+		"tcp_rst>=many",
+		"tcp_rst@0",
+		"tcp_rst@65536",
+		"http_5xx@http",
+	} {
+		_, err := NewPcapTriggers(rules, time.Second, time.Second)
+		assert.Error(t, err, rules)
+	}
+
+	_, err = NewPcapTriggers("tcp_rst", -time.Second, time.Second)
+	assert.Error(t, err)
+}
+
+// TestPcapTriggerMatches verifies which packets each condition matches, with and without ports.
+func TestPcapTriggerMatches(t *testing.T) {
+	t.Parallel()
+
+	reset := newPcapTriggersTestSegment(t, 0, 8080, 40000, true, "")
+	ack := newPcapTriggersTestSegment(t, 0, 8080, 40000, false, "")
+	response5xx := newPcapTriggersTestSegment(t, 0, 8080, 40000, false, "HTTP/1.1 503 Service Unavailable\r\n\r\n")
+	response2xx := newPcapTriggersTestSegment(t, 0, 8080, 40000, false, "HTTP/1.1 200 OK\r\n\r\n")
+	request := newPcapTriggersTestSegment(t, 0, 40000, 8080, false, "GET /500 HTTP/1.1\r\n\r\n")
+	servFail := newPcapTriggersTestDNSResponse(t, 53, layers.DNSResponseCodeServFail)
+	nxDomain := newPcapTriggersTestDNSResponse(t, 53, layers.DNSResponseCodeNXDomain)
+
+	tests := []struct {
+		name    string
+		trigger PcapTrigger
+		packet  gopacket.Packet
+		want    bool
+	}{
+		{"tcp_rst", PcapTrigger{Condition: PcapTriggerTCPReset}, reset, true},
+		{"tcp_rst_without_rst", PcapTrigger{Condition: PcapTriggerTCPReset}, ack, false},
+		{"tcp_rst_source_port", PcapTrigger{Condition: PcapTriggerTCPReset, Port: 8080}, reset, true},
+		{"tcp_rst_destination_port", PcapTrigger{Condition: PcapTriggerTCPReset, Port: 40000}, reset, true},
+		{"tcp_rst_other_port", PcapTrigger{Condition: PcapTriggerTCPReset, Port: 443}, reset, false},
+		{"tcp_rst_udp", PcapTrigger{Condition: PcapTriggerTCPReset}, servFail, false},
+		{"http_5xx", PcapTrigger{Condition: PcapTriggerHTTP5xx}, response5xx, true},
+		{"http_5xx_source_port", PcapTrigger{Condition: PcapTriggerHTTP5xx, Port: 8080}, response5xx, true},
+		{"http_5xx_other_port", PcapTrigger{Condition: PcapTriggerHTTP5xx, Port: 40000}, response5xx, false},
+		{"http_5xx_2xx", PcapTrigger{Condition: PcapTriggerHTTP5xx}, response2xx, false},
+		{"http_5xx_request", PcapTrigger{Condition: PcapTriggerHTTP5xx}, request, false},
+		{"http_5xx_without_payload", PcapTrigger{Condition: PcapTriggerHTTP5xx}, ack, false},
+		{"dns_servfail", PcapTrigger{Condition: PcapTriggerDNSServFail}, servFail, true},
+		{"dns_servfail_source_port", PcapTrigger{Condition: PcapTriggerDNSServFail, Port: 53}, servFail, true},
+		{"dns_servfail_other_port", PcapTrigger{Condition: PcapTriggerDNSServFail, Port: 5353}, servFail, false},
+		{"dns_servfail_nxdomain", PcapTrigger{Condition: PcapTriggerDNSServFail}, nxDomain, false},
+		{"dns_servfail_tcp", PcapTrigger{Condition: PcapTriggerDNSServFail}, reset, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, tt.trigger.matches(tt.packet))
+		})
+	}
+}
+
+// TestPcapFlightRecorder verifies that packets are buffered within the window until a trigger fires,
+// translated until no trigger fires for the cooldown, and buffered again afterwards.
+func TestPcapFlightRecorder(t *testing.T) {
+	t.Parallel()
+
+	triggers, err := NewPcapTriggers("tcp_rst>=2", 2*time.Second, 3*time.Second)
+	require.NoError(t, err)
+
+	var triggered, triggeredOut atomic.Uint64
+	recorder := newPcapFlightRecorder(triggers, &triggered, &triggeredOut, log.New(io.Discard, "", 0), "test")
+
+	at := func(ms int, rst bool) gopacket.Packet {
+		return newPcapTriggersTestSegment(t, time.Duration(ms)*time.Millisecond, 8080, 40000, rst, "")
+	}
+	admit := func(packet gopacket.Packet) []gopacket.Packet {
+		// the returned slice is only valid until the next call
+		return append([]gopacket.Packet(nil), recorder.admit(packet)...)
+	}
+
+	first, second, third := at(0, false), at(1000, false), at(2500, false)
+	assert.Empty(t, admit(first))
+	assert.Empty(t, admit(second))
+	// packets older than the window are discarded
+	assert.Empty(t, admit(third))
+	assert.Equal(t, uint64(1), triggeredOut.Load())
+
+	// the threshold is not reached by a single reset
+	reset := at(3000, true)
+	assert.Empty(t, admit(reset))
+	assert.Zero(t, triggered.Load())
+
+	// the trigger fires: buffered packets are translated in the order in which they were captured
+	fired := at(3500, true)
+	assert.Equal(t, []gopacket.Packet{second, third, reset, fired}, admit(fired))
+	assert.Equal(t, uint64(1), triggered.Load())
+
+	// packets are translated right away during the cooldown; resets below the threshold do not extend it
+	during := at(4000, false)
+	assert.Equal(t, []gopacket.Packet{during}, admit(during))
+	below := at(6400, true)
+	assert.Equal(t, []gopacket.Packet{below}, admit(below))
+
+	// the cooldown elapsed since the trigger fired: packets are buffered again
+	after := at(6600, false)
+	assert.Empty(t, admit(after))
+
+	// the trigger fires again within another second
+	again, refired := at(7000, true), at(7100, true)
+	assert.Empty(t, admit(again))
+	assert.Equal(t, []gopacket.Packet{after, again, refired}, admit(refired))
+	assert.Equal(t, uint64(2), triggered.Load())
+	assert.Equal(t, uint64(1), triggeredOut.Load())
+
+	// buffered packets are discarded when engines stop
+	assert.Empty(t, admit(at(20000, false)))
+	recorder.discard()
+	assert.Equal(t, uint64(2), triggeredOut.Load())
+}
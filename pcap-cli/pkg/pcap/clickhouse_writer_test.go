@@ -0,0 +1,233 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build clickhouse
+
+package pcap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// clickHousePcapWriterTestTable keeps inserted rows in memory, keyed by the columns of `clickHouseCreateTableTemplate`.
+type clickHousePcapWriterTestTable struct {
+	mu      sync.Mutex
+	columns []string
+	rows    []map[string]any
+	batches []int
+	// inserts which fail before rows are inserted
+	failures int
+	attempts int
+	closed   bool
+}
+
+func newClickHousePcapWriterTestTable() *clickHousePcapWriterTestTable {
+	table := &clickHousePcapWriterTestTable{}
+	definition := fmt.Sprintf(clickHouseCreateTableTemplate, "t")
+	definition = definition[strings.Index(definition, "(")+1 : strings.Index(definition, ") ENGINE")]
+	for _, column := range strings.Split(definition, ",\n") {
+		table.columns = append(table.columns, strings.Fields(column)[0])
+	}
+	return table
+}
+
+func (table *clickHousePcapWriterTestTable) insertBatch(_ context.Context, name string, rows []*clickHousePcapRecord) error {
+	table.mu.Lock()
+	defer table.mu.Unlock()
+
+	table.attempts++
+	if table.failures > 0 {
+		table.failures--
+		return errors.New("connection reset by peer")
+	}
+	if name != clickHouseDefaultTable {
+		return fmt.Errorf("unknown table: %s", name)
+	}
+	for _, row := range rows {
+		values := row.columns()
+		if len(values) != len(table.columns) {
+			return fmt.Errorf("%d values for %d columns", len(values), len(table.columns))
+		}
+		record := make(map[string]any, len(values))
+		for i, value := range values {
+			record[table.columns[i]] = value
+		}
+		table.rows = append(table.rows, record)
+	}
+	table.batches = append(table.batches, len(rows))
+	return nil
+}
+
+func (table *clickHousePcapWriterTestTable) Close() error {
+	table.mu.Lock()
+	defer table.mu.Unlock()
+	table.closed = true
+	return nil
+}
+
+func (table *clickHousePcapWriterTestTable) inserted() ([]map[string]any, []int) {
+	table.mu.Lock()
+	defer table.mu.Unlock()
+	return append([]map[string]any(nil), table.rows...), append([]int(nil), table.batches...)
+}
+
+func newClickHousePcapWriterTest(table *clickHousePcapWriterTestTable, batchSize int, interval time.Duration) *clickHousePcapWriter {
+	iface := "eth0"
+	return newClickHousePcapWriter(context.Background(), &iface, log.New(io.Discard, "", 0),
+		table, clickHouseDefaultTable, batchSize, interval)
+}
+
+func writeClickHousePcapWriterTest(t *testing.T, w *clickHousePcapWriter, serials ...uint64) {
+	lines := make([]string, len(serials))
+	for i, serial := range serials {
+		lines[i] = newPcapJSONTranslationTestLine(serial)
+	}
+	data := strings.Join(lines, "\n") + "\n"
+	n, err := w.Write([]byte(data))
+	require.NoError(t, err)
+	assert.Equal(t, len(data), n)
+}
+
+// TestClickHousePcapWriterRoundTrip verifies that translations are inserted in batches as columns of the table, and when flushing.
+func TestClickHousePcapWriterRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	table := newClickHousePcapWriterTestTable()
+	w := newClickHousePcapWriterTest(table, 3, time.Hour)
+
+	writeClickHousePcapWriterTest(t, w, 1, 2)
+	rows, _ := table.inserted()
+	assert.Empty(t, rows)
+
+	// a batch is inserted once it is full
+	writeClickHousePcapWriterTest(t, w, 3, 4)
+	require.NoError(t, waitOrDone(context.Background(), w.inflight))
+	rows, batches := table.inserted()
+	assert.Len(t, rows, 4)
+	assert.Equal(t, []int{4}, batches)
+
+	_, err := w.Write([]byte("not json\n"))
+	assert.ErrorContains(t, err, "invalid JSON translation")
+
+	// pending rows are inserted when flushing
+	writeClickHousePcapWriterTest(t, w, 5)
+	require.NoError(t, w.Flush(context.Background()))
+	rows, batches = table.inserted()
+	require.Len(t, rows, 5)
+	assert.Equal(t, []int{4, 1}, batches)
+
+	for i, row := range rows {
+		assert.Equal(t, uint64(i+1), row["serial"])
+	}
+	row := rows[0]
+	assert.True(t, pcapJSONTranslationTestTimestamp.Equal(row["timestamp"].(time.Time)))
+	assert.Equal(t, "123", row["flow"])
+	assert.Equal(t, int32(2), row["iface_index"])
+	assert.Equal(t, "eth0", row["iface_name"])
+	assert.Equal(t, int64(74), row["length"])
+	assert.Equal(t, "10.0.0.1", row["l3_src"])
+	assert.Equal(t, "10.0.0.2", row["l3_dst"])
+	assert.Equal(t, "IPv4", row["l3_proto"])
+	assert.Equal(t, int32(40000), row["l4_src"])
+	assert.Equal(t, int32(8080), row["l4_dst"])
+	assert.Equal(t, "PA", row["tcp_flags"])
+	assert.Equal(t, int64(1000), row["tcp_seq"])
+	assert.Equal(t, int64(2000), row["tcp_ack"])
+	assert.Equal(t, "GET", row["http_method"])
+	assert.Equal(t, "/health", row["http_url"])
+	assert.Equal(t, int32(200), row["http_code"])
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", row["trace_id"])
+	assert.Equal(t, "00f067aa0ba902b7", row["span_id"])
+	assert.Equal(t, "request", row["message"])
+	assert.Equal(t, newPcapJSONTranslationTestLine(1), row["json"])
+
+	// closing without pending rows only closes the connection
+	require.NoError(t, w.Close())
+	_, batches = table.inserted()
+	assert.Len(t, batches, 2)
+	assert.True(t, table.closed)
+}
+
+// TestClickHousePcapWriterInsertPeriodically verifies that pending rows are inserted every interval, even if batches are not full.
+func TestClickHousePcapWriterInsertPeriodically(t *testing.T) {
+	t.Parallel()
+
+	table := newClickHousePcapWriterTestTable()
+	w := newClickHousePcapWriterTest(table, 1000, 10*time.Millisecond)
+	defer w.Close()
+
+	writeClickHousePcapWriterTest(t, w, 1)
+	assert.Eventually(t, func() bool {
+		rows, _ := table.inserted()
+		return len(rows) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+// TestClickHousePcapWriterRetries verifies that failed inserts are retried, and that batches are dropped once all attempts fail.
+func TestClickHousePcapWriterRetries(t *testing.T) {
+	t.Parallel()
+
+	table := newClickHousePcapWriterTestTable()
+	table.failures = 1
+	w := newClickHousePcapWriterTest(table, 1000, time.Hour)
+
+	writeClickHousePcapWriterTest(t, w, 1)
+	require.NoError(t, w.Flush(context.Background()))
+	rows, _ := table.inserted()
+	assert.Len(t, rows, 1)
+	assert.Equal(t, 2, table.attempts)
+
+	// flushing returns as soon as its context is done
+	table.failures = sinkCallAttempts
+	writeClickHousePcapWriterTest(t, w, 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, w.Flush(ctx), context.Canceled)
+	rows, _ = table.inserted()
+	assert.Len(t, rows, 1)
+
+	require.NoError(t, w.Close())
+}
+
+// TestNewClickHousePcapWriterTable verifies that table names which cannot be used as is are rejected.
+func TestNewClickHousePcapWriterTable(t *testing.T) {
+	t.Parallel()
+
+	for table, valid := range map[string]bool{
+		"pcap_translations":      true,
+		"pcap.translations":      true,
+		"_translations2":         true,
+		"2translations":          false,
+		"pcap.translations.eth0": false,
+		"translations; DROP":     false,
+		"":                       false,
+	} {
+		assert.Equal(t, valid, clickHouseTableRegex.MatchString(table), table)
+	}
+
+	iface, dsn, table := "eth0", "clickhouse://127.0.0.1:9000/pcap", "translations; DROP"
+	_, err := NewClickHousePcapWriter(context.Background(), &iface, &dsn, &table)
+	assert.ErrorContains(t, err, "invalid ClickHouse table")
+}
@@ -0,0 +1,622 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type (
+	// PcapConfigFile is a declarative alternative to flags; see `LoadPcapConfigFile`.
+	PcapConfigFile struct {
+		// `google` or `tcpdump`; only used by programs which choose engines
+		Engine      string                  `json:"engine" yaml:"engine"`
+		Iface       string                  `json:"iface" yaml:"iface"`
+		Snaplen     int                     `json:"snaplen" yaml:"snaplen"`
+		TsType      string                  `json:"ts_type" yaml:"ts_type"`
+		Promisc     *bool                   `json:"promisc" yaml:"promisc"`
+		Format      string                  `json:"format" yaml:"format"`
+		Template    string                  `json:"template" yaml:"template"`
+		Filter      string                  `json:"filter" yaml:"filter"`
+		FilterExpr  string                  `json:"filter_expr" yaml:"filter_expr"`
+		Filters     *PcapFiltersUpdate      `json:"filters" yaml:"filters"`
+		Exclude     []string                `json:"exclude" yaml:"exclude"`
+		Ordered     bool                    `json:"ordered" yaml:"ordered"`
+		ConnTrack   bool                    `json:"conntrack" yaml:"conntrack"`
+		Ephemerals  string                  `json:"ephemerals" yaml:"ephemerals"`
+		Ephemerals6 string                  `json:"ephemerals6" yaml:"ephemerals6"`
+		Profiles    []PcapConfigFileProfile `json:"profiles" yaml:"profiles"`
+		Writers     []PcapConfigFileWriter  `json:"writers" yaml:"writers"`
+		Options     PcapConfigFileOptions   `json:"options" yaml:"options"`
+		// logs how packets of every flow are tracked; see `PcapContextDebugSwitch`
+		Debug bool `json:"debug" yaml:"debug"`
+		// captures only run during sessions, in order; see `PcapSessions`
+		Sessions []PcapSession `json:"sessions" yaml:"sessions"`
+		// `{condition}[@{port}][>={packets per second}]` rules; see `NewPcapTriggers`
+		Triggers []string `json:"triggers" yaml:"triggers"`
+		// seconds; default to 30 and 60
+		TriggerWindow   *uint `json:"trigger_window" yaml:"trigger_window"`
+		TriggerCooldown *uint `json:"trigger_cooldown" yaml:"trigger_cooldown"`
+		// describes every completed file in `{file}.manifest.json`; see `PcapManifest`
+		Manifests bool `json:"manifests" yaml:"manifests"`
+	}
+
+	PcapConfigFileProfile struct {
+		Name   string `json:"name" yaml:"name"`
+		Filter string `json:"filter" yaml:"filter"`
+		// seconds; the interval of the 1st file writer if 0
+		Interval int `json:"interval" yaml:"interval"`
+		// defaults to the path of the 1st file writer, suffixed by `-{name}`
+		Path string `json:"path" yaml:"path"`
+	}
+
+	// PcapConfigFileWriter describes 1 writer: `stdout`, `file`, `parquet`, `otlp` or `clickhouse`.
+	PcapConfigFileWriter struct {
+		Kind string `json:"kind" yaml:"kind"`
+		// `file` and `parquet` writers
+		Path      string `json:"path" yaml:"path"`
+		Extension string `json:"extension" yaml:"extension"`
+		Timezone  string `json:"timezone" yaml:"timezone"`
+		Interval  int    `json:"interval" yaml:"interval"`
+		// `otlp` writers
+		Endpoint string `json:"endpoint" yaml:"endpoint"`
+		// `clickhouse` writers
+		DSN   string `json:"dsn" yaml:"dsn"`
+		Table string `json:"table" yaml:"table"`
+		// only records matching any of these routes are written; i/e: `severity=error`
+		Routes []string `json:"routes" yaml:"routes"`
+	}
+
+	// PcapConfigFileOptions are the format options otherwise set using `PcapContext*` keys.
+	PcapConfigFileOptions struct {
+		Encoding               string   `json:"encoding" yaml:"encoding"`
+		Fields                 []string `json:"fields" yaml:"fields"`
+		Labels                 []string `json:"labels" yaml:"labels"`
+		PayloadRules           []string `json:"payload_rules" yaml:"payload_rules"`
+		PayloadSelect          bool     `json:"payload_select" yaml:"payload_select"`
+		SessionKeys            []string `json:"session_keys" yaml:"session_keys"`
+		TraceSchemes           []string `json:"trace_schemes" yaml:"trace_schemes"`
+		TraceHeaders           []string `json:"trace_headers" yaml:"trace_headers"`
+		TraceIDs               []string `json:"trace_ids" yaml:"trace_ids"`
+		TraceRate              uint     `json:"trace_rate" yaml:"trace_rate"`
+		CompactRetransmissions bool     `json:"compact_retransmissions" yaml:"compact_retransmissions"`
+		Anomalies              bool     `json:"anomalies" yaml:"anomalies"`
+		Retries                bool     `json:"retries" yaml:"retries"`
+		ConnectionSetup        bool     `json:"connection_setup" yaml:"connection_setup"`
+		CachePorts             []string `json:"cache_ports" yaml:"cache_ports"`
+		HashCacheKeys          bool     `json:"hash_cache_keys" yaml:"hash_cache_keys"`
+		DBPorts                []string `json:"db_ports" yaml:"db_ports"`
+		DBQueries              bool     `json:"db_queries" yaml:"db_queries"`
+		BrokerPorts            []string `json:"broker_ports" yaml:"broker_ports"`
+		SampleFlows            uint     `json:"sample_flows" yaml:"sample_flows"`
+		FlowBudget             uint     `json:"flow_budget" yaml:"flow_budget"`
+		// seconds
+		FlowBudgetInterval uint `json:"flow_budget_interval" yaml:"flow_budget_interval"`
+		// milliseconds
+		LatencyBudget   uint `json:"latency_budget" yaml:"latency_budget"`
+		LatencySampling uint `json:"latency_sampling" yaml:"latency_sampling"`
+		DropRecords     uint `json:"drop_records" yaml:"drop_records"`
+		DropOnFullQueue bool `json:"drop_on_full_queue" yaml:"drop_on_full_queue"`
+	}
+
+	// PcapConfigFileError names the key of the config file whose value is invalid; i/e: `writers[1].path`.
+	PcapConfigFileError struct {
+		Key string
+		Err error
+	}
+)
+
+var (
+	// `$${VAR}` escapes interpolation, while `$` alone is kept as-is: regular expressions are not mangled.
+	pcapConfigFileVarRegex = regexp.MustCompile(`\$\$|\$\{([a-zA-Z_][a-zA-Z0-9_]*)(?::-([^}]*))?\}`)
+
+	pcapConfigFileFormats   = []string{"", "default", "json", "text", "proto", "pcapng", "ecs", "otlp", "template"}
+	pcapConfigFileEncodings = []string{"", "json", "cbor", "msgpack"}
+)
+
+func (e *PcapConfigFileError) Error() string {
+	return e.Key + ": " + e.Err.Error()
+}
+
+func (e *PcapConfigFileError) Unwrap() error {
+	return e.Err
+}
+
+func newPcapConfigFileError(key string, format string, args ...any) error {
+	return &PcapConfigFileError{Key: key, Err: fmt.Errorf(format, args...)}
+}
+
+// interpolatePcapConfigFileValue replaces `${VAR}` with the value of the environment variable `VAR`, or with `default`
+// when using `${VAR:-default}` and `VAR` is unset or empty.
+func interpolatePcapConfigFileValue(value string, getenv func(string) string) string {
+	return pcapConfigFileVarRegex.ReplaceAllStringFunc(value, func(match string) string {
+		if match == "$$" {
+			return "$"
+		}
+		groups := pcapConfigFileVarRegex.FindStringSubmatch(match)
+		if value := getenv(groups[1]); value != "" {
+			return value
+		}
+		return groups[2]
+	})
+}
+
+// interpolatePcapConfigFileNode interpolates the scalar values of a decoded YAML document, but not its keys:
+// values of environment variables are never parsed as YAML, so they cannot add keys nor change the structure of the document.
+// Plain scalars are resolved again, so that `snaplen: ${SNAPLEN}` is still a number, while quoted or tagged ones keep their type.
+func interpolatePcapConfigFileNode(node *yaml.Node, getenv func(string) string) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		value := interpolatePcapConfigFileValue(node.Value, getenv)
+		if value != node.Value && node.Style&(yaml.TaggedStyle|yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle|yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+			node.Tag = ""
+		}
+		node.Value = value
+	case yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			interpolatePcapConfigFileNode(node.Content[i], getenv)
+		}
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, child := range node.Content {
+			interpolatePcapConfigFileNode(child, getenv)
+		}
+	}
+}
+
+// interpolatePcapConfigFileJSON interpolates the string values of a decoded JSON document, but not its keys.
+func interpolatePcapConfigFileJSON(value any, getenv func(string) string) any {
+	switch value := value.(type) {
+	case string:
+		return interpolatePcapConfigFileValue(value, getenv)
+	case map[string]any:
+		for key, child := range value {
+			value[key] = interpolatePcapConfigFileJSON(child, getenv)
+		}
+	case []any:
+		for i, child := range value {
+			value[i] = interpolatePcapConfigFileJSON(child, getenv)
+		}
+	}
+	return value
+}
+
+// interpolatePcapConfigFile decodes `document` to interpolate its values, and encodes it again so that it is decoded strictly.
+func interpolatePcapConfigFile(document []byte, isJSON bool, getenv func(string) string) ([]byte, error) {
+	if isJSON {
+		decoder := json.NewDecoder(bytes.NewReader(document))
+		decoder.UseNumber()
+		var value any
+		if err := decoder.Decode(&value); err != nil {
+			return nil, err
+		}
+		return json.Marshal(interpolatePcapConfigFileJSON(value, getenv))
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(document, &root); err != nil {
+		return nil, err
+	}
+	// empty documents
+	if root.Kind == 0 {
+		return document, nil
+	}
+	interpolatePcapConfigFileNode(&root, getenv)
+	return yaml.Marshal(&root)
+}
+
+// LoadPcapConfigFile reads a YAML or JSON document, chosen by the extension of `path`; see `ParsePcapConfigFile`.
+func LoadPcapConfigFile(path string) (*PcapConfigFile, error) {
+	document, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	isJSON := strings.EqualFold(filepath.Ext(path), ".json")
+	return ParsePcapConfigFile(document, isJSON)
+}
+
+// ParsePcapConfigFile interpolates environment variables into the values of `document`, decodes it, and validates it:
+//   - unknown keys are rejected, so that typos do not go unnoticed,
+//   - invalid values are reported as `*PcapConfigFileError`.
+func ParsePcapConfigFile(document []byte, isJSON bool) (*PcapConfigFile, error) {
+	document, err := interpolatePcapConfigFile(document, isJSON, os.Getenv)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config file: %w", err)
+	}
+	return parseInterpolatedPcapConfigFile(document, isJSON)
+}
+
+func parseInterpolatedPcapConfigFile(document []byte, isJSON bool) (*PcapConfigFile, error) {
+	file := &PcapConfigFile{}
+	var err error
+	if isJSON {
+		decoder := json.NewDecoder(bytes.NewReader(document))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(file)
+	} else {
+		decoder := yaml.NewDecoder(bytes.NewReader(document))
+		decoder.KnownFields(true)
+		if err = decoder.Decode(file); errors.Is(err, io.EOF) {
+			err = nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid config file: %w", err)
+	}
+
+	if err := file.validate(); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (f *PcapConfigFile) validate() error {
+	if f.Engine != "" && f.Engine != "google" && f.Engine != "tcpdump" {
+		return newPcapConfigFileError("engine", "must be 'google' or 'tcpdump': %s", f.Engine)
+	}
+	if f.Snaplen < 0 {
+		return newPcapConfigFileError("snaplen", "must not be negative: %d", f.Snaplen)
+	}
+	if !slices.Contains(pcapConfigFileFormats, f.Format) {
+		return newPcapConfigFileError("format", "unknown format: %s", f.Format)
+	}
+	if f.Format == "template" && f.Template == "" {
+		return newPcapConfigFileError("template", "required by the 'template' format")
+	}
+	if f.Filter != "" && f.FilterExpr != "" {
+		return newPcapConfigFileError("filter_expr", "'filter' and 'filter_expr' are mutually exclusive")
+	}
+	if f.FilterExpr != "" {
+		if _, err := CompilePcapFilterExpression(f.FilterExpr, NewPcapFilters()); err != nil {
+			return &PcapConfigFileError{Key: "filter_expr", Err: err}
+		}
+	}
+	if f.Filters != nil {
+		if err := f.Filters.apply(NewPcapFilters(), true /* add */); err != nil {
+			return &PcapConfigFileError{Key: "filters", Err: err}
+		}
+	}
+	if _, err := f.ephemerals(); err != nil {
+		return &PcapConfigFileError{Key: "ephemerals", Err: err}
+	}
+
+	for i, writer := range f.Writers {
+		key := fmt.Sprintf("writers[%d]", i)
+		switch writer.Kind {
+		case "stdout":
+		case "file", "parquet":
+			if writer.Path == "" {
+				return newPcapConfigFileError(key+".path", "required by '%s' writers", writer.Kind)
+			}
+		case "otlp":
+			if writer.Endpoint == "" {
+				return newPcapConfigFileError(key+".endpoint", "required by 'otlp' writers")
+			}
+		case "clickhouse":
+			if writer.DSN == "" {
+				return newPcapConfigFileError(key+".dsn", "required by 'clickhouse' writers")
+			}
+		default:
+			return newPcapConfigFileError(key+".kind", "must be 'stdout', 'file', 'parquet', 'otlp' or 'clickhouse': %s", writer.Kind)
+		}
+		if writer.Interval < 0 {
+			return newPcapConfigFileError(key+".interval", "must not be negative: %d", writer.Interval)
+		}
+		if writer.Timezone != "" {
+			if _, err := time.LoadLocation(writer.Timezone); err != nil {
+				return &PcapConfigFileError{Key: key + ".timezone", Err: err}
+			}
+		}
+	}
+
+	names := make(map[string]struct{}, len(f.Profiles))
+	for i, profile := range f.Profiles {
+		key := fmt.Sprintf("profiles[%d]", i)
+		if _, ok := names[profile.Name]; ok {
+			return newPcapConfigFileError(key+".name", "duplicate profile: %s", profile.Name)
+		}
+		names[profile.Name] = struct{}{}
+		if _, err := NewPcapProfile(profile.Name, profile.Filter, profile.Interval); err != nil {
+			return &PcapConfigFileError{Key: key, Err: err}
+		}
+		if profile.Path == "" && f.fileWriter() == nil {
+			return newPcapConfigFileError(key+".path", "required without 'file' or 'parquet' writers")
+		}
+	}
+
+	if _, err := f.triggers(); err != nil {
+		return &PcapConfigFileError{Key: "triggers", Err: err}
+	}
+
+	for i, rule := range f.Options.PayloadRules {
+		if err := ValidatePcapPayloadRules([]string{rule}); err != nil {
+			return &PcapConfigFileError{Key: fmt.Sprintf("options.payload_rules[%d]", i), Err: err}
+		}
+	}
+
+	sessions := make(map[string]struct{}, len(f.Sessions))
+	for i, session := range f.Sessions {
+		key := fmt.Sprintf("sessions[%d]", i)
+		if _, ok := sessions[session.Name]; ok {
+			return newPcapConfigFileError(key+".name", "duplicate session: %s", session.Name)
+		}
+		sessions[session.Name] = struct{}{}
+		if _, err := session.startAt(); err != nil {
+			return &PcapConfigFileError{Key: key, Err: err}
+		}
+	}
+
+	if !slices.Contains(pcapConfigFileEncodings, f.Options.Encoding) {
+		return newPcapConfigFileError("options.encoding", "must be 'json', 'cbor' or 'msgpack': %s", f.Options.Encoding)
+	}
+	// Parquet and ClickHouse writers are fed with JSON translations
+	for _, writer := range f.Writers {
+		if (writer.Kind == "parquet" || writer.Kind == "clickhouse") && f.Options.Encoding != "" && f.Options.Encoding != "json" {
+			return newPcapConfigFileError("options.encoding", "'%s' writers require 'json'", writer.Kind)
+		}
+	}
+	return nil
+}
+
+func (f *PcapConfigFile) ephemerals() (*PcapEphemeralPorts, error) {
+	ephemerals := f.Ephemerals
+	if ephemerals == "" {
+		ephemerals = PcapEphemeralPortsFromHost
+	}
+	return ParsePcapEphemeralPorts(ephemerals, f.Ephemerals6)
+}
+
+// triggers returns `nil` if the config file does not define triggers.
+func (f *PcapConfigFile) triggers() (*PcapTriggers, error) {
+	if len(f.Triggers) == 0 {
+		return nil, nil
+	}
+	window, cooldown := uint(30), uint(60)
+	if f.TriggerWindow != nil {
+		window = *f.TriggerWindow
+	}
+	if f.TriggerCooldown != nil {
+		cooldown = *f.TriggerCooldown
+	}
+	return NewPcapTriggers(strings.Join(f.Triggers, pcapTriggersSeparator), time.Duration(window)*time.Second, time.Duration(cooldown)*time.Second)
+}
+
+// fileWriter returns the 1st `file` or `parquet` writer, whose files are the ones of the capture.
+func (f *PcapConfigFile) fileWriter() *PcapConfigFileWriter {
+	for i, writer := range f.Writers {
+		if writer.Kind == "file" || writer.Kind == "parquet" {
+			return &f.Writers[i]
+		}
+	}
+	return nil
+}
+
+// NewConfig creates the configuration of engines; `Iface` must be set for every device to capture from.
+func (f *PcapConfigFile) NewConfig() (*PcapConfig, error) {
+	config := &PcapConfig{
+		Debug:     f.Debug,
+		Promisc:   f.Promisc == nil || *f.Promisc,
+		Iface:     f.Iface,
+		Snaplen:   f.Snaplen,
+		TsType:    f.TsType,
+		Format:    f.Format,
+		Filter:    f.Filter,
+		Output:    "stdout",
+		Ordered:   f.Ordered,
+		ConnTrack: f.ConnTrack,
+		Template:  f.Template,
+		Exclude:   f.Exclude,
+		Manifests: f.Manifests,
+	}
+
+	// `tcpdump` engines write the files of the capture by themselves
+	if writer := f.fileWriter(); writer != nil {
+		config.Output = writer.Path
+		config.Extension = writer.Extension
+		config.Interval = writer.Interval
+	}
+
+	if f.FilterExpr != "" || f.Filters != nil {
+		config.CompatFilters = NewPcapFilters()
+	}
+	if f.FilterExpr != "" {
+		filter, err := CompilePcapFilterExpression(f.FilterExpr, config.CompatFilters)
+		if err != nil {
+			return nil, &PcapConfigFileError{Key: "filter_expr", Err: err}
+		}
+		config.Filter = filter
+	}
+	if f.Filters != nil {
+		if err := f.Filters.apply(config.CompatFilters, true /* add */); err != nil {
+			return nil, &PcapConfigFileError{Key: "filters", Err: err}
+		}
+	}
+
+	ephemerals, err := f.ephemerals()
+	if err != nil {
+		return nil, &PcapConfigFileError{Key: "ephemerals", Err: err}
+	}
+	config.Ephemerals = ephemerals
+
+	if config.Triggers, err = f.triggers(); err != nil {
+		return nil, &PcapConfigFileError{Key: "triggers", Err: err}
+	}
+
+	for i, profile := range f.Profiles {
+		pcapProfile, err := NewPcapProfile(profile.Name, profile.Filter, profile.Interval)
+		if err != nil {
+			return nil, &PcapConfigFileError{Key: fmt.Sprintf("profiles[%d]", i), Err: err}
+		}
+		config.Profiles = append(config.Profiles, pcapProfile)
+	}
+
+	return config, nil
+}
+
+// Context adds the format options set by the config file to `ctx`; options which are not set are left as-is.
+func (f *PcapConfigFile) Context(ctx context.Context) context.Context {
+	options := &f.Options
+	if options.Encoding != "" {
+		ctx = context.WithValue(ctx, PcapContextEncoding, options.Encoding)
+	}
+	if len(options.Fields) > 0 {
+		ctx = context.WithValue(ctx, PcapContextFields, options.Fields)
+	}
+	if len(options.Labels) > 0 {
+		ctx = context.WithValue(ctx, PcapContextLabels, options.Labels)
+	}
+	if len(options.PayloadRules) > 0 {
+		ctx = context.WithValue(ctx, PcapContextPayloadRules, options.PayloadRules)
+		ctx = context.WithValue(ctx, PcapContextPayloadSelect, options.PayloadSelect)
+	}
+	if len(options.SessionKeys) > 0 {
+		ctx = context.WithValue(ctx, PcapContextSessionKeys, options.SessionKeys)
+	}
+	if len(options.TraceSchemes) > 0 {
+		ctx = context.WithValue(ctx, PcapContextTraceSchemes, options.TraceSchemes)
+	}
+	if len(options.TraceHeaders) > 0 {
+		ctx = context.WithValue(ctx, PcapContextTraceHeaders, options.TraceHeaders)
+	}
+	if len(options.TraceIDs) > 0 || options.TraceRate > 0 {
+		ctx = context.WithValue(ctx, PcapContextTraceScope, NewPcapTraceScope(options.TraceIDs, options.TraceRate))
+	}
+	if options.CompactRetransmissions {
+		ctx = context.WithValue(ctx, PcapContextCompactRetransmissions, true)
+	}
+	if options.Anomalies {
+		ctx = context.WithValue(ctx, PcapContextAnomalies, true)
+	}
+	if options.Retries {
+		ctx = context.WithValue(ctx, PcapContextRetries, true)
+	}
+	if options.ConnectionSetup {
+		ctx = context.WithValue(ctx, PcapContextConnectionSetup, true)
+	}
+	if len(options.CachePorts) > 0 {
+		ctx = context.WithValue(ctx, PcapContextCachePorts, options.CachePorts)
+	}
+	if options.HashCacheKeys {
+		ctx = context.WithValue(ctx, PcapContextHashCacheKeys, true)
+	}
+	if len(options.DBPorts) > 0 {
+		ctx = context.WithValue(ctx, PcapContextDBPorts, options.DBPorts)
+	}
+	if options.DBQueries {
+		ctx = context.WithValue(ctx, PcapContextDBQueries, true)
+	}
+	if len(options.BrokerPorts) > 0 {
+		ctx = context.WithValue(ctx, PcapContextBrokerPorts, options.BrokerPorts)
+	}
+	if options.SampleFlows > 0 {
+		ctx = context.WithValue(ctx, PcapContextFlowSampling, options.SampleFlows)
+	}
+	if options.FlowBudget > 0 {
+		ctx = context.WithValue(ctx, PcapContextFlowBudget, options.FlowBudget)
+	}
+	if options.FlowBudgetInterval > 0 {
+		ctx = context.WithValue(ctx, PcapContextFlowBudgetInterval, time.Duration(options.FlowBudgetInterval)*time.Second)
+	}
+	if options.LatencyBudget > 0 {
+		ctx = context.WithValue(ctx, PcapContextLatencyBudget, time.Duration(options.LatencyBudget)*time.Millisecond)
+	}
+	if options.LatencySampling > 0 {
+		ctx = context.WithValue(ctx, PcapContextLatencyBudgetSampling, options.LatencySampling)
+	}
+	if options.DropRecords > 0 {
+		ctx = context.WithValue(ctx, PcapContextDropRecords, options.DropRecords)
+	}
+	if options.DropOnFullQueue {
+		ctx = context.WithValue(ctx, PcapContextDropOnFullQueue, true)
+	}
+	return ctx
+}
+
+// profileWriter returns the writer whose kind is used by the profile at `index`, along with the path of its files.
+func (f *PcapConfigFile) profileWriter(index int) (*PcapConfigFileWriter, string) {
+	writer := &PcapConfigFileWriter{Kind: "file"}
+	if fileWriter := f.fileWriter(); fileWriter != nil {
+		writer = fileWriter
+	}
+	profile := &f.Profiles[index]
+	if profile.Path != "" {
+		return writer, profile.Path
+	}
+	return writer, writer.Path + "-" + profile.Name
+}
+
+func (w *PcapConfigFileWriter) newWriter(ctx context.Context, ifaceAndIndex, path *string, interval int) (PcapWriter, error) {
+	timezone := w.Timezone
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	switch w.Kind {
+	case "stdout":
+		return NewStdoutPcapWriter(ctx, ifaceAndIndex)
+	case "file":
+		return NewPcapWriter(ctx, ifaceAndIndex, path, &w.Extension, &timezone, interval)
+	case "parquet":
+		return NewParquetPcapWriter(ctx, ifaceAndIndex, path, &timezone, interval)
+	case "otlp":
+		return NewOTLPPcapWriter(ctx, ifaceAndIndex, &w.Endpoint)
+	case "clickhouse":
+		table := w.Table
+		if table == "" {
+			table = "pcap_translations"
+		}
+		return NewClickHousePcapWriter(ctx, ifaceAndIndex, &w.DSN, &table)
+	}
+	return nil, fmt.Errorf("unknown writer: %s", w.Kind)
+}
+
+// NewWriters creates the writers of the capture from the device identified by `ifaceAndIndex`, followed by those of profiles;
+// `profiles` must be the ones of the configuration created by `NewConfig`.
+func (f *PcapConfigFile) NewWriters(ctx context.Context, ifaceAndIndex *string, profiles []*PcapProfile) ([]PcapWriter, error) {
+	writers := make([]PcapWriter, 0, len(f.Writers)+len(profiles))
+	for i := range f.Writers {
+		writer := &f.Writers[i]
+		path := writer.Path
+		pcapWriter, err := writer.newWriter(ctx, ifaceAndIndex, &path, writer.Interval)
+		if err != nil {
+			return nil, &PcapConfigFileError{Key: fmt.Sprintf("writers[%d]", i), Err: err}
+		}
+		if len(writer.Routes) > 0 {
+			pcapWriter = &routedPcapWriter{PcapWriter: pcapWriter, routes: writer.Routes}
+		}
+		writers = append(writers, pcapWriter)
+	}
+
+	for i, profile := range profiles {
+		writer, path := f.profileWriter(i)
+		profileWriter, err := writer.newWriter(ctx, ifaceAndIndex, &path, profile.RotationInterval(writer.Interval))
+		if err != nil {
+			return nil, &PcapConfigFileError{Key: fmt.Sprintf("profiles[%d]", i), Err: err}
+		}
+		writers = append(writers, profile.Writer(profileWriter))
+	}
+	return writers, nil
+}
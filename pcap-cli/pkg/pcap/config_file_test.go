@@ -0,0 +1,169 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func pcapConfigFileTestEnv(env map[string]string) func(string) string {
+	return func(name string) string { return env[name] }
+}
+
+// TestInterpolatePcapConfigFileValue verifies variables, defaults and escaping.
+func TestInterpolatePcapConfigFileValue(t *testing.T) {
+	t.Parallel()
+
+	getenv := pcapConfigFileTestEnv(map[string]string{"IFACE": "eth0", "EMPTY": ""})
+
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"${IFACE}", "eth0"},
+		{"capture-${IFACE}-${IFACE}", "capture-eth0-eth0"},
+		{"${UNSET}", ""},
+		{"${UNSET:-lo}", "lo"},
+		{"${EMPTY:-lo}", "lo"},
+		{"${IFACE:-lo}", "eth0"},
+		{"${UNSET:-}", ""},
+		// `$$` escapes interpolation
+		{"$${IFACE}", "${IFACE}"},
+		{"$$", "$"},
+		// `$` alone is kept, so regular expressions do not need escaping
+		{"^/health$", "^/health$"},
+		{"$IFACE", "$IFACE"},
+		{"${1NVALID}", "${1NVALID}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, interpolatePcapConfigFileValue(tt.value, getenv))
+		})
+	}
+}
+
+// TestInterpolatePcapConfigFile verifies that values of environment variables cannot change the structure of documents.
+func TestInterpolatePcapConfigFile(t *testing.T) {
+	t.Parallel()
+
+	getenv := pcapConfigFileTestEnv(map[string]string{
+		"FILTER":  "tcp\nengine: tcpdump",
+		"SNAPLEN": "1500",
+		"PROMISC": "true",
+		"JSON":    `tcp", "engine": "tcpdump`,
+		"KEY":     "engine",
+	})
+
+	parse := func(document string, isJSON bool) *PcapConfigFile {
+		interpolated, err := interpolatePcapConfigFile([]byte(document), isJSON, getenv)
+		require.NoError(t, err)
+		file, err := parseInterpolatedPcapConfigFile(interpolated, isJSON)
+		require.NoError(t, err)
+		return file
+	}
+
+	file := parse("filter: ${FILTER}\nsnaplen: ${SNAPLEN}\npromisc: ${PROMISC}\niface: '${SNAPLEN}'\ntemplate: !!str ${SNAPLEN}\nexclude: [\"${FILTER}\"]\n", false)
+	assert.Equal(t, "tcp\nengine: tcpdump", file.Filter)
+	assert.Empty(t, file.Engine)
+	assert.Equal(t, 1500, file.Snaplen)
+	if assert.NotNil(t, file.Promisc) {
+		assert.True(t, *file.Promisc)
+	}
+	// quoted values are strings
+	assert.Equal(t, "1500", file.Iface)
+	assert.Equal(t, "1500", file.Template)
+	assert.Equal(t, []string{"tcp\nengine: tcpdump"}, file.Exclude)
+
+	file = parse(`{"filter": "${JSON}", "iface": "${UNSET:-lo}"}`, true)
+	assert.Equal(t, `tcp", "engine": "tcpdump`, file.Filter)
+	assert.Empty(t, file.Engine)
+	assert.Equal(t, "lo", file.Iface)
+
+	// keys are not interpolated
+	interpolated, err := interpolatePcapConfigFile([]byte("${KEY}: tcpdump\n"), false, getenv)
+	require.NoError(t, err)
+	_, err = parseInterpolatedPcapConfigFile(interpolated, false)
+	assert.Error(t, err)
+
+	// empty documents are valid
+	file = parse("", false)
+	assert.Empty(t, file.Filter)
+}
+
+// TestParsePcapConfigFileUnknownKeys verifies that typos are rejected.
+func TestParsePcapConfigFileUnknownKeys(t *testing.T) {
+	t.Parallel()
+
+	for _, document := range []string{
+		"ifcae: eth0\n",
+		"options:\n  encodign: cbor\n",
+		"writers:\n  - kind: stdout\n    pth: /tmp\n",
+	} {
+		_, err := ParsePcapConfigFile([]byte(document), false)
+		assert.Error(t, err, document)
+	}
+
+	_, err := ParsePcapConfigFile([]byte(`{"options": {"encodign": "cbor"}}`), true)
+	assert.Error(t, err)
+	_, err = ParsePcapConfigFile([]byte(`{"options": {"encoding": "cbor"}}`), true)
+	assert.NoError(t, err)
+}
+
+// TestPcapConfigFileError verifies that invalid values are reported along with the path of their keys.
+func TestPcapConfigFileError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		document string
+		key      string
+	}{
+		{"engine: pcap\n", "engine"},
+		{"snaplen: -1\n", "snaplen"},
+		{"format: yaml\n", "format"},
+		{"format: template\n", "template"},
+		{"filter: tcp\nfilter_expr: tcp\n", "filter_expr"},
+		{"filter_expr: port 0\n", "filter_expr"},
+		{"writers:\n  - kind: stdout\n  - kind: file\n", "writers[1].path"},
+		{"writers:\n  - kind: otlp\n", "writers[0].endpoint"},
+		{"writers:\n  - kind: kafka\n", "writers[0].kind"},
+		{"writers:\n  - kind: file\n    path: /tmp/pcap\n    timezone: Mars/Olympus\n", "writers[0].timezone"},
+		{"profiles:\n  - name: a\n    filter: tcp\n    path: /tmp/a\n  - name: a\n    filter: udp\n    path: /tmp/b\n", "profiles[1].name"},
+		{"profiles:\n  - name: a\n", "profiles[0]"},
+		{"profiles:\n  - name: a\n    filter: tcp\n", "profiles[0].path"},
+		{"sessions:\n  - name: a\n", "sessions[0]"},
+		{"sessions:\n  - name: a\n    duration: 1\n  - name: a\n    duration: 1\n", "sessions[1].name"},
+		{"options:\n  encoding: xml\n", "options.encoding"},
+		{"options:\n  payload_rules: ['tls=hex:16 03 01', 'bad=(']\n", "options.payload_rules[1]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := ParsePcapConfigFile([]byte(tt.document), false)
+			var configErr *PcapConfigFileError
+			if assert.True(t, errors.As(err, &configErr), "%v", err) {
+				assert.Equal(t, tt.key, configErr.Key)
+				assert.ErrorContains(t, err, tt.key+": ")
+			}
+		})
+	}
+}
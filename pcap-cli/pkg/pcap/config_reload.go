@@ -0,0 +1,198 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync/atomic"
+)
+
+type (
+	// PcapConfigChange is a key of the config file whose value is not the same anymore; i/e: `writers[0].path`.
+	PcapConfigChange struct {
+		Key string `json:"key"`
+		// engines must be re-created, which drops the state of tracked connections and requests still waiting for responses
+		Restart bool `json:"restart"`
+	}
+
+	// PcapConfigDiff describes how to go from the config file used by running engines to a new one; see `DiffPcapConfigFiles`.
+	PcapConfigDiff struct {
+		Previous *PcapConfigFile     `json:"-"`
+		Next     *PcapConfigFile     `json:"-"`
+		Changes  []*PcapConfigChange `json:"changes"`
+	}
+)
+
+var errPcapConfigRestart = errors.New("engines must be restarted")
+
+// DiffPcapConfigFiles compares all keys of both config files; only these changes are applied without restarting engines:
+//   - `filters`: if `previous` already enforced filters, by removing its own and adding the ones of `next`,
+//   - `debug`: if engines were started with a `PcapContextDebugSwitch`,
+//   - `path` of `file` and `parquet` writers, and of profiles: files created afterwards are named after the new path;
+//     `tcpdump` engines write files by themselves, so they must be restarted,
+//   - `sessions`: they are not applied by `Apply`, but new ones may be queued using `PcapSessions.Merge`.
+func DiffPcapConfigFiles(previous, next *PcapConfigFile) *PcapConfigDiff {
+	diff := &PcapConfigDiff{
+		Previous: previous,
+		Next:     next,
+		Changes:  make([]*PcapConfigChange, 0),
+	}
+
+	inPlace := func(key string) bool {
+		switch key {
+		case "filters":
+			return previous.Filters != nil || previous.FilterExpr != ""
+		case "debug":
+			return true
+		}
+		if strings.HasPrefix(key, "sessions") {
+			return true
+		}
+		if !strings.HasSuffix(key, ".path") || previous.Engine == "tcpdump" || next.Engine == "tcpdump" {
+			return false
+		}
+		// paths of profiles without `path` are derived from the 1st `file` or `parquet` writer
+		if strings.HasPrefix(key, "profiles[") {
+			return true
+		}
+		var index int
+		fmt.Sscanf(key, "writers[%d].path", &index)
+		kind := previous.Writers[index].Kind
+		return kind == "file" || kind == "parquet"
+	}
+
+	diff.compare("", reflect.ValueOf(previous).Elem(), reflect.ValueOf(next).Elem(), inPlace)
+	return diff
+}
+
+// compare records a change per field of `previous` and `next`, which must be structs of the same type;
+// fields of nested structs, and elements of slices of structs of the same length, are compared one by one.
+func (d *PcapConfigDiff) compare(prefix string, previous, next reflect.Value, inPlace func(string) bool) {
+	for i := range previous.NumField() {
+		field := previous.Type().Field(i)
+		key := prefix + strings.Split(field.Tag.Get("yaml"), ",")[0]
+		previousValue, nextValue := previous.Field(i), next.Field(i)
+
+		if reflect.DeepEqual(previousValue.Interface(), nextValue.Interface()) {
+			continue
+		}
+
+		switch {
+		case field.Type.Kind() == reflect.Struct:
+			d.compare(key+".", previousValue, nextValue, inPlace)
+			continue
+		case field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.Struct &&
+			previousValue.Len() == nextValue.Len():
+			for j := range previousValue.Len() {
+				d.compare(fmt.Sprintf("%s[%d].", key, j), previousValue.Index(j), nextValue.Index(j), inPlace)
+			}
+			continue
+		}
+
+		d.Changes = append(d.Changes, &PcapConfigChange{Key: key, Restart: !inPlace(key)})
+	}
+}
+
+func (d *PcapConfigDiff) IsEmpty() bool {
+	return len(d.Changes) == 0
+}
+
+func (d *PcapConfigDiff) RequiresRestart() bool {
+	for _, change := range d.Changes {
+		if change.Restart {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply applies all changes to running engines: `filters` and `debug` must be the ones they were started with,
+// and `writers` the ones created by `NewWriters` for each device; nothing is applied if any change requires a restart.
+func (d *PcapConfigDiff) Apply(filters PcapFilters, debug *atomic.Bool, writers ...[]PcapWriter) error {
+	if d.RequiresRestart() {
+		return errPcapConfigRestart
+	}
+
+	for _, change := range d.Changes {
+		switch {
+		case change.Key == "filters":
+			if err := d.applyFilters(filters); err != nil {
+				return &PcapConfigFileError{Key: change.Key, Err: err}
+			}
+		case change.Key == "debug":
+			if debug == nil {
+				return newPcapConfigFileError(change.Key, "engines were started without a debug switch")
+			}
+			debug.Store(d.Next.Debug)
+		}
+	}
+
+	// profiles without `path` may have been moved along with the 1st `file` or `parquet` writer
+	for _, deviceWriters := range writers {
+		for i, writer := range d.Next.Writers {
+			if writer.Path == d.Previous.Writers[i].Path || i >= len(deviceWriters) {
+				continue
+			}
+			if err := retargetPcapWriter(deviceWriters[i], writer.Path); err != nil {
+				return &PcapConfigFileError{Key: fmt.Sprintf("writers[%d].path", i), Err: err}
+			}
+		}
+		for i := range d.Next.Profiles {
+			_, previousPath := d.Previous.profileWriter(i)
+			_, path := d.Next.profileWriter(i)
+			index := len(d.Next.Writers) + i
+			if path == previousPath || index >= len(deviceWriters) {
+				continue
+			}
+			if err := retargetPcapWriter(deviceWriters[index], path); err != nil {
+				return &PcapConfigFileError{Key: fmt.Sprintf("profiles[%d].path", i), Err: err}
+			}
+		}
+	}
+	return nil
+}
+
+// applyFilters replaces the filters of the previous config file with the ones of the next one;
+// filters of `filter_expr` are compiled again, as removing the previous ones may have removed some of them.
+func (d *PcapConfigDiff) applyFilters(filters PcapFilters) error {
+	if filters == nil {
+		return errors.New("engines were started without filters")
+	}
+	// validate before removing anything
+	if d.Next.Filters != nil {
+		if err := d.Next.Filters.apply(NewPcapFilters(), true /* add */); err != nil {
+			return err
+		}
+	}
+	if d.Previous.Filters != nil {
+		if err := d.Previous.Filters.apply(filters, false /* add */); err != nil {
+			return err
+		}
+	}
+	if d.Next.Filters != nil {
+		if err := d.Next.Filters.apply(filters, true /* add */); err != nil {
+			return err
+		}
+	}
+	if d.Next.FilterExpr != "" {
+		if _, err := CompilePcapFilterExpression(d.Next.FilterExpr, filters); err != nil {
+			return err
+		}
+	}
+	return nil
+}
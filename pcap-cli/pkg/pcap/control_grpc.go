@@ -0,0 +1,252 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build grpc
+
+package pcap
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/GoogleCloudPlatform/pcap-sidecar/pcap-cli/internal/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type pcapControlServer struct {
+	pb.UnimplementedPcapControlServer
+	control *PcapControl
+}
+
+const (
+	pcapControlStatsInterval    = 10 * time.Second
+	pcapControlMinStatsInterval = time.Second
+)
+
+func pcapControlError(err error) error {
+	if errors.Is(err, errPcapControlUnavailable) {
+		return status.Error(codes.Unimplemented, err.Error())
+	}
+	return status.Error(codes.FailedPrecondition, err.Error())
+}
+
+func (s *pcapControlServer) captureStatus() *pb.CaptureStatus {
+	statuses := s.control.Status()
+	captures := make([]*pb.CaptureStatus_Capture, len(statuses))
+	for i, capture := range statuses {
+		captures[i] = &pb.CaptureStatus_Capture{
+			Name:   capture.Name,
+			Active: capture.Active,
+			Ready:  capture.Ready,
+			Paused: capture.Paused,
+			Filter: capture.Filter,
+			Stats: &pb.CaptureStatus_Stats{
+				Packets:     capture.Stats.Packets,
+				Bytes:       capture.Stats.Bytes,
+				Errors:      capture.Stats.Errors,
+				Anomalies:   capture.Stats.Anomalies,
+				FilteredOut: capture.Stats.FilteredOut,
+				PausedOut:   capture.Stats.PausedOut,
+			},
+		}
+	}
+	return &pb.CaptureStatus{Timestamp: timestamppb.Now(), Captures: captures}
+}
+
+func (s *pcapControlServer) StartCapture(context.Context, *pb.StartCaptureRequest) (*pb.CaptureStatus, error) {
+	if err := s.control.Start(); err != nil {
+		return nil, pcapControlError(err)
+	}
+	return s.captureStatus(), nil
+}
+
+func (s *pcapControlServer) StopCapture(context.Context, *pb.StopCaptureRequest) (*pb.CaptureStatus, error) {
+	if err := s.control.Stop(); err != nil {
+		return nil, pcapControlError(err)
+	}
+	return s.captureStatus(), nil
+}
+
+func toUint16s(values []uint32) []uint16 {
+	uint16s := make([]uint16, len(values))
+	for i, value := range values {
+		uint16s[i] = uint16(value)
+	}
+	return uint16s
+}
+
+func toUint8s(values []uint32) []uint8 {
+	uint8s := make([]uint8, len(values))
+	for i, value := range values {
+		uint8s[i] = uint8(value)
+	}
+	return uint8s
+}
+
+func toUint32s[T uint8 | uint16](values []T) []uint32 {
+	uint32s := make([]uint32, len(values))
+	for i, value := range values {
+		uint32s[i] = uint32(value)
+	}
+	return uint32s
+}
+
+func (s *pcapControlServer) UpdateFilters(_ context.Context, request *pb.UpdateFiltersRequest) (*pb.UpdateFiltersResponse, error) {
+	var add bool
+	switch request.GetOperation() {
+	case pb.UpdateFiltersRequest_OPERATION_ADD:
+		add = true
+	case pb.UpdateFiltersRequest_OPERATION_REMOVE:
+		add = false
+	default:
+		return nil, status.Error(codes.InvalidArgument, "operation is required")
+	}
+
+	filters := request.GetFilters()
+	for _, value := range [][]uint32{filters.GetVlans(), filters.GetDeniedVlans(), filters.GetPorts(), filters.GetDeniedPorts()} {
+		for _, v := range value {
+			if v > 0xFFFF {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid VLAN ID or port: %d", v)
+			}
+		}
+	}
+	for _, value := range [][]uint32{filters.GetL3Protos(), filters.GetL4Protos()} {
+		for _, v := range value {
+			if v > 0xFF {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid protocol: %d", v)
+			}
+		}
+	}
+
+	update := &PcapFiltersUpdate{
+		MACs:        filters.GetMacs(),
+		DeniedMACs:  filters.GetDeniedMacs(),
+		VLANs:       toUint16s(filters.GetVlans()),
+		DeniedVLANs: toUint16s(filters.GetDeniedVlans()),
+		L3Protos:    toUint8s(filters.GetL3Protos()),
+		IPv4:        filters.GetIpv4(),
+		IPv6:        filters.GetIpv6(),
+		DeniedIPv4:  filters.GetDeniedIpv4(),
+		DeniedIPv6:  filters.GetDeniedIpv6(),
+		L4Protos:    toUint8s(filters.GetL4Protos()),
+		Ports:       toUint16s(filters.GetPorts()),
+		DeniedPorts: toUint16s(filters.GetDeniedPorts()),
+		TCPFlags:    filters.GetTcpFlags(),
+		Hosts:       filters.GetHosts(),
+		DeniedHosts: filters.GetDeniedHosts(),
+	}
+	for _, socket := range filters.GetDeniedSockets() {
+		update.DeniedSockets = append(update.DeniedSockets, PcapFilterSocket{
+			Local:  socket.GetLocal(),
+			Remote: socket.GetRemote(),
+		})
+	}
+
+	view, err := s.control.UpdateFilters(update, add)
+	if errors.Is(err, errPcapControlUnavailable) {
+		return nil, pcapControlError(err)
+	} else if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return &pb.UpdateFiltersResponse{
+		Filters: &pb.Filters{
+			Macs:        view.MACs,
+			DeniedMacs:  view.DeniedMACs,
+			Vlans:       toUint32s(view.VLANs),
+			DeniedVlans: toUint32s(view.DeniedVLANs),
+			L3Protos:    toUint32s(view.L3Protos),
+			Ipv4:        view.IPv4,
+			Ipv6:        view.IPv6,
+			DeniedIpv4:  view.DeniedIPv4,
+			DeniedIpv6:  view.DeniedIPv6,
+			L4Protos:    toUint32s(view.L4Protos),
+			Ports:       toUint32s(view.Ports),
+			DeniedPorts: toUint32s(view.DeniedPorts),
+			TcpFlags:    view.TCPFlags,
+			Hosts:       view.Hosts,
+			DeniedHosts: view.DeniedHosts,
+		},
+		DeniedSockets: uint32(view.DeniedSockets),
+	}, nil
+}
+
+func (s *pcapControlServer) StreamStats(request *pb.StreamStatsRequest, stream pb.PcapControl_StreamStatsServer) error {
+	interval := pcapControlStatsInterval
+	if request.GetInterval() != nil {
+		interval = request.GetInterval().AsDuration()
+	}
+	if interval < pcapControlMinStatsInterval {
+		return status.Errorf(codes.InvalidArgument, "interval must be at least %v", pcapControlMinStatsInterval)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := stream.Send(s.captureStatus()); err != nil {
+			return err
+		}
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *pcapControlServer) StreamTranslations(request *pb.StreamTranslationsRequest, stream pb.PcapControl_StreamTranslationsServer) error {
+	subscription, err := s.control.SubscribeEncoded(request.GetCaptures(), pcapControlTranslationsBuffer, &PcapControlEncoding{
+		Fields:      request.GetFields(),
+		Compression: PcapControlCompression(request.GetCompression()),
+	})
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	defer subscription.Close()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case translation := <-subscription.Translations():
+			data, err := subscription.Encode(translation)
+			if err != nil {
+				// a single translation which cannot be encoded must not end the stream
+				subscription.dropped.Add(1)
+				continue
+			}
+			if err := stream.Send(&pb.Translation{
+				Capture: translation.Capture,
+				Data:    data,
+				Dropped: subscription.Dropped(),
+			}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// ServePcapControlGRPC serves the `PcapControl` gRPC service defined by `schema/proto/control.proto` using `control`;
+// it blocks until `listener` is closed.
+func ServePcapControlGRPC(listener net.Listener, control *PcapControl) error {
+	server := grpc.NewServer()
+	pb.RegisterPcapControlServer(server, &pcapControlServer{control: control})
+	return server.Serve(listener)
+}
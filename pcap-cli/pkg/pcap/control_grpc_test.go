@@ -0,0 +1,252 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build grpc
+
+package pcap
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/pcap-sidecar/pcap-cli/internal/pb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// newPcapControlGRPCTestClient serves `control` over an in-memory connection; the server stops along with the test.
+func newPcapControlGRPCTestClient(t *testing.T, control *PcapControl) pb.PcapControlClient {
+	listener := bufconn.Listen(1 << 20)
+	go ServePcapControlGRPC(listener, control)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		conn.Close()
+		listener.Close()
+	})
+	return pb.NewPcapControlClient(conn)
+}
+
+// TestPcapControlGRPCErrors verifies that errors of the control API are mapped to gRPC status codes.
+func TestPcapControlGRPCErrors(t *testing.T) {
+	t.Parallel()
+
+	unavailable := newPcapControlGRPCTestClient(t, NewPcapControl(nil, nil))
+
+	control := NewPcapControl(NewPcapFilters(), &PcapControlHooks{
+		Start: func() error { return errPcapManagerNotRunning },
+		Stop:  func() error { return nil },
+	})
+	control.Register("eth0", &pcapSessionsTestEngine{}, nil)
+	iface := "eth0"
+	control.Writer("eth0", &iface, "proto")
+	client := newPcapControlGRPCTestClient(t, control)
+
+	ctx := context.Background()
+	addPort := func(port uint32) error {
+		_, err := client.UpdateFilters(ctx, &pb.UpdateFiltersRequest{
+			Operation: pb.UpdateFiltersRequest_OPERATION_ADD,
+			Filters:   &pb.Filters{Ports: []uint32{port}},
+		})
+		return err
+	}
+	streamStats := func(interval time.Duration) error {
+		stream, err := client.StreamStats(ctx, &pb.StreamStatsRequest{Interval: durationpb.New(interval)})
+		if err == nil {
+			_, err = stream.Recv()
+		}
+		return err
+	}
+
+	tests := []struct {
+		name string
+		call func() error
+		code codes.Code
+	}{
+		{
+			name: "start_without_hook",
+			call: func() error {
+				_, err := unavailable.StartCapture(ctx, &pb.StartCaptureRequest{})
+				return err
+			},
+			code: codes.Unimplemented,
+		},
+		{
+			name: "start_failed",
+			call: func() error {
+				_, err := client.StartCapture(ctx, &pb.StartCaptureRequest{})
+				return err
+			},
+			code: codes.FailedPrecondition,
+		},
+		{
+			name: "stop",
+			call: func() error {
+				_, err := client.StopCapture(ctx, &pb.StopCaptureRequest{})
+				return err
+			},
+			code: codes.OK,
+		},
+		{
+			name: "filters_without_operation",
+			call: func() error {
+				_, err := client.UpdateFilters(ctx, &pb.UpdateFiltersRequest{})
+				return err
+			},
+			code: codes.InvalidArgument,
+		},
+		{
+			name: "filters_without_filters",
+			call: func() error {
+				_, err := unavailable.UpdateFilters(ctx, &pb.UpdateFiltersRequest{Operation: pb.UpdateFiltersRequest_OPERATION_ADD})
+				return err
+			},
+			code: codes.Unimplemented,
+		},
+		{
+			name: "invalid_port",
+			call: func() error { return addPort(0x10000) },
+			code: codes.InvalidArgument,
+		},
+		{
+			name: "stats_interval",
+			call: func() error { return streamStats(pcapControlMinStatsInterval / 2) },
+			code: codes.InvalidArgument,
+		},
+		{
+			name: "stats",
+			call: func() error { return streamStats(pcapControlMinStatsInterval) },
+			code: codes.OK,
+		},
+		{
+			name: "fields_of_proto_translations",
+			call: func() error {
+				stream, err := client.StreamTranslations(ctx, &pb.StreamTranslationsRequest{Fields: []string{"l3"}})
+				if err == nil {
+					_, err = stream.Recv()
+				}
+				return err
+			},
+			code: codes.InvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.code, status.Code(tt.call()))
+		})
+	}
+
+	assert.Equal(t, codes.FailedPrecondition, status.Code(pcapControlError(errors.New("failed"))))
+	assert.Equal(t, codes.Unimplemented, status.Code(pcapControlError(errPcapControlUnavailable)))
+}
+
+// TestPcapControlGRPCStatus verifies that the status of captures, and the filters which were updated, are returned.
+func TestPcapControlGRPCStatus(t *testing.T) {
+	t.Parallel()
+
+	engine := &pcapSessionsTestEngine{}
+	engine.bytes.Store(1500)
+	control := NewPcapControl(NewPcapFilters(), &PcapControlHooks{Stop: func() error { return nil }})
+	control.Register("eth0", engine, nil)
+	client := newPcapControlGRPCTestClient(t, control)
+
+	captures, err := client.StopCapture(context.Background(), &pb.StopCaptureRequest{})
+	require.NoError(t, err)
+	if assert.Len(t, captures.GetCaptures(), 1) {
+		assert.Equal(t, "eth0", captures.GetCaptures()[0].GetName())
+		assert.Equal(t, uint64(1500), captures.GetCaptures()[0].GetStats().GetBytes())
+	}
+
+	response, err := client.UpdateFilters(context.Background(), &pb.UpdateFiltersRequest{
+		Operation: pb.UpdateFiltersRequest_OPERATION_ADD,
+		Filters:   &pb.Filters{Ports: []uint32{443}, L4Protos: []uint32{6}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{443}, response.GetFilters().GetPorts())
+	assert.Equal(t, []uint32{6}, response.GetFilters().GetL4Protos())
+}
+
+// TestPcapControlGRPCStreamTranslations verifies that translations are streamed as requested,
+// and that translations which cannot be encoded are counted as dropped without ending streams.
+func TestPcapControlGRPCStreamTranslations(t *testing.T) {
+	t.Parallel()
+
+	control := NewPcapControl(nil, nil)
+	iface := "eth0"
+	writer := control.Writer("eth0", &iface, "json")
+	client := newPcapControlGRPCTestClient(t, control)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	all, err := client.StreamTranslations(ctx, &pb.StreamTranslationsRequest{})
+	require.NoError(t, err)
+	projected, err := client.StreamTranslations(ctx, &pb.StreamTranslationsRequest{
+		Captures: []string{"eth0"},
+		Fields:   []string{"l4"},
+	})
+	require.NoError(t, err)
+
+	// subscriptions are created by handlers: translations are only sent to them once they exist
+	require.Eventually(t, func() bool {
+		control.mutex.RLock()
+		defer control.mutex.RUnlock()
+		return len(control.subscribers) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	invalid := []byte("not json\n")
+	translation := []byte(`{"l3":{"src":"10.0.0.1"},"l4":{"src":1234}}` + "\n")
+	for _, data := range [][]byte{invalid, translation} {
+		_, err := writer.Write(data)
+		require.NoError(t, err)
+	}
+
+	for _, want := range [][]byte{invalid, translation} {
+		received, err := all.Recv()
+		require.NoError(t, err)
+		assert.Equal(t, "eth0", received.GetCapture())
+		assert.Equal(t, want, received.GetData())
+		assert.Zero(t, received.GetDropped())
+	}
+
+	received, err := projected.Recv()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"l4":{"src":1234}}`, string(received.GetData()))
+	assert.Equal(t, uint64(1), received.GetDropped())
+
+	// subscriptions end along with streams
+	cancel()
+	assert.Eventually(t, func() bool {
+		control.mutex.RLock()
+		defer control.mutex.RUnlock()
+		return len(control.subscribers) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
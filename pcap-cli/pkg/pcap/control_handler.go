@@ -0,0 +1,538 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+type (
+	// PcapControlHooks start and stop captures on behalf of `NewPcapControlHandler`:
+	//   - nil hooks are not available, and requests to use them are rejected.
+	PcapControlHooks struct {
+		Start func() error
+		Stop  func() error
+		// reloads the configuration of captures; i/e: from the config file they were created from
+		Reload func() error
+		// start and stop a single capture by the name it was registered with; i/e: engines owned by a `PcapManager`
+		StartCapture func(name string) error
+		StopCapture  func(name string) error
+	}
+
+	// PcapControl tracks running engines, and the writers they feed, so they can be operated using `NewPcapControlHandler`.
+	PcapControl struct {
+		mutex       sync.RWMutex
+		hooks       *PcapControlHooks
+		filters     PcapFilters
+		captures    []*pcapControlledCapture
+		subscribers map[*PcapControlSubscription]struct{}
+		// formats of the captures which write into `Writer`
+		formats  map[string]string
+		sessions *PcapSessions
+		// bytes captured by engines which are not registered anymore; see `Bytes`
+		forgottenBytes uint64
+	}
+
+	pcapControlledCapture struct {
+		name    string
+		engine  PcapEngine
+		writers []PcapWriter
+	}
+
+	PcapControlStatus struct {
+		Name   string     `json:"name"`
+		Active bool       `json:"active"`
+		Ready  bool       `json:"ready"`
+		Paused bool       `json:"paused"`
+		Filter string     `json:"filter"`
+		Stats  *PcapStats `json:"stats"`
+	}
+
+	PcapControlFilter struct {
+		Name   string `json:"name"`
+		Filter string `json:"filter"`
+	}
+)
+
+const (
+	PcapControlStatusPath = "/control/status"
+	PcapControlFilterPath = "/control/filter"
+	PcapControlStartPath  = "/control/start"
+	PcapControlStopPath   = "/control/stop"
+	PcapControlPausePath  = "/control/pause"
+	PcapControlResumePath = "/control/resume"
+	PcapControlRotatePath = "/control/rotate"
+	PcapControlReloadPath = "/control/reload"
+	// `{name}` is the name of a session; i/e: `/control/sessions/deploy/trigger`
+	PcapControlSessionsPath       = "/control/sessions"
+	PcapControlSessionTriggerPath = "/control/sessions/{name}/trigger"
+	PcapControlSessionCancelPath  = "/control/sessions/{name}/cancel"
+	// `{name}` is the name a capture was registered with; i/e: `/control/captures/eth0/pause`
+	PcapControlCapturePath       = "/control/captures/{name}"
+	PcapControlCaptureStartPath  = "/control/captures/{name}/start"
+	PcapControlCaptureStopPath   = "/control/captures/{name}/stop"
+	PcapControlCapturePausePath  = "/control/captures/{name}/pause"
+	PcapControlCaptureResumePath = "/control/captures/{name}/resume"
+	PcapControlCaptureRotatePath = "/control/captures/{name}/rotate"
+
+	// prefix of control addresses which are paths of unix sockets; i/e: `unix:/var/run/pcap.sock`
+	PcapControlUnixPrefix = "unix:"
+)
+
+var (
+	errPcapControlUnavailable    = errors.New("not available")
+	errPcapControlUnknownCapture = errors.New("capture is not registered")
+)
+
+// NewPcapControl creates an empty registry of captures; `filters` and `hooks` may be `nil`.
+func NewPcapControl(filters PcapFilters, hooks *PcapControlHooks) *PcapControl {
+	if hooks == nil {
+		hooks = &PcapControlHooks{}
+	}
+	return &PcapControl{
+		hooks:       hooks,
+		filters:     filters,
+		captures:    make([]*pcapControlledCapture, 0),
+		subscribers: make(map[*PcapControlSubscription]struct{}),
+		formats:     make(map[string]string),
+	}
+}
+
+// Reset forgets all captures, and replaces the filters updated by `UpdateFilters`; i/e: before engines are re-created.
+func (c *PcapControl) Reset(filters PcapFilters) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.filters = filters
+	for _, capture := range c.captures {
+		c.forget(capture)
+	}
+	c.captures = make([]*pcapControlledCapture, 0)
+}
+
+// forget must be called while holding `c.mutex`
+func (c *PcapControl) forget(capture *pcapControlledCapture) {
+	if stats := capture.engine.Stats(); stats != nil {
+		c.forgottenBytes += stats.Bytes
+	}
+}
+
+// Bytes returns the bytes captured by all engines ever registered, including those forgotten by `Reset`, `Register` and `Unregister`:
+// it never decreases, so bytes captured in between 2 calls are known even if engines are re-created; i/e: when config files are reloaded.
+func (c *PcapControl) Bytes() uint64 {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	bytes := c.forgottenBytes
+	for _, capture := range c.captures {
+		if stats := capture.engine.Stats(); stats != nil {
+			bytes += stats.Bytes
+		}
+	}
+	return bytes
+}
+
+// Register makes `engine` and `writers` available to the control API under `name`;
+// registering the same `name` again replaces them, so engines may be re-created by new executions.
+func (c *PcapControl) Register(name string, engine PcapEngine, writers []PcapWriter) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	capture := &pcapControlledCapture{name: name, engine: engine, writers: writers}
+	for i, registered := range c.captures {
+		if registered.name == name {
+			c.forget(registered)
+			c.captures[i] = capture
+			return
+		}
+	}
+	c.captures = append(c.captures, capture)
+}
+
+// Unregister forgets the capture registered under `name`; it is not stopped.
+func (c *PcapControl) Unregister(name string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.captures = slices.DeleteFunc(c.captures, func(capture *pcapControlledCapture) bool {
+		if capture.name != name {
+			return false
+		}
+		c.forget(capture)
+		return true
+	})
+}
+
+func (c *PcapControl) Status() []*PcapControlStatus {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	statuses := make([]*PcapControlStatus, len(c.captures))
+	for i, capture := range c.captures {
+		statuses[i] = capture.status()
+	}
+	return statuses
+}
+
+// CaptureStatus returns the status of the capture registered under `name`.
+func (c *PcapControl) CaptureStatus(name string) (*PcapControlStatus, error) {
+	capture, err := c.capture(name)
+	if err != nil {
+		return nil, err
+	}
+	return capture.status(), nil
+}
+
+func (c *PcapControl) capture(name string) (*pcapControlledCapture, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	for _, capture := range c.captures {
+		if capture.name == name {
+			return capture, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", errPcapControlUnknownCapture, name)
+}
+
+func (capture *pcapControlledCapture) status() *PcapControlStatus {
+	status := &PcapControlStatus{
+		Name:   capture.name,
+		Active: capture.engine.IsActive(),
+		Ready:  capture.engine.IsReady(),
+		Filter: capture.engine.Filter(),
+		Stats:  capture.engine.Stats(),
+	}
+	if engine, ok := capture.engine.(PcapPausableEngine); ok {
+		status.Paused = engine.IsPaused()
+	}
+	return status
+}
+
+func (c *PcapControl) Filters() []*PcapControlFilter {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	filters := make([]*PcapControlFilter, len(c.captures))
+	for i, capture := range c.captures {
+		filters[i] = &PcapControlFilter{Name: capture.name, Filter: capture.engine.Filter()}
+	}
+	return filters
+}
+
+// UseSessions makes the queue of `sessions` available to the control API.
+func (c *PcapControl) UseSessions(sessions *PcapSessions) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.sessions = sessions
+}
+
+func (c *PcapControl) currentSessions() (*PcapSessions, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if c.sessions == nil {
+		return nil, errPcapControlUnavailable
+	}
+	return c.sessions, nil
+}
+
+// Writers returns the writers of every capture, in the order in which captures were registered.
+func (c *PcapControl) Writers() [][]PcapWriter {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	writers := make([][]PcapWriter, len(c.captures))
+	for i, capture := range c.captures {
+		writers[i] = capture.writers
+	}
+	return writers
+}
+
+// Pause pauses all engines which can be paused; see `PcapPausableEngine`.
+func (c *PcapControl) Pause() error {
+	return c.forEachPausable(PcapPausableEngine.Pause)
+}
+
+func (c *PcapControl) Resume() error {
+	return c.forEachPausable(PcapPausableEngine.Resume)
+}
+
+func (c *PcapControl) forEachPausable(fn func(PcapPausableEngine) bool) error {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	pausable := false
+	for _, capture := range c.captures {
+		if engine, ok := capture.engine.(PcapPausableEngine); ok {
+			pausable = true
+			fn(engine)
+		}
+	}
+	if !pausable {
+		return errPcapControlUnavailable
+	}
+	return nil
+}
+
+// PauseCapture pauses the capture registered under `name`, if its engine can be paused.
+func (c *PcapControl) PauseCapture(name string) error {
+	return c.withPausable(name, PcapPausableEngine.Pause)
+}
+
+func (c *PcapControl) ResumeCapture(name string) error {
+	return c.withPausable(name, PcapPausableEngine.Resume)
+}
+
+func (c *PcapControl) withPausable(name string, fn func(PcapPausableEngine) bool) error {
+	capture, err := c.capture(name)
+	if err != nil {
+		return err
+	}
+	engine, ok := capture.engine.(PcapPausableEngine)
+	if !ok {
+		return errPcapControlUnavailable
+	}
+	fn(engine)
+	return nil
+}
+
+// RotateCapture rotates the files of the writers of the capture registered under `name`;
+// writers rotate files in between writes, so captures may be running.
+func (c *PcapControl) RotateCapture(name string) error {
+	capture, err := c.capture(name)
+	if err != nil {
+		return err
+	}
+	for _, writer := range capture.writers {
+		writer.Rotate()
+	}
+	return nil
+}
+
+// Rotate closes the current file of all writers, and creates a new one; writers without files ignore it.
+func (c *PcapControl) Rotate() error {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	for _, capture := range c.captures {
+		for _, writer := range capture.writers {
+			writer.Rotate()
+		}
+	}
+	return nil
+}
+
+// UpdateFilters applies `update` to the filters of `c`, and returns the filters being enforced afterwards.
+func (c *PcapControl) UpdateFilters(update *PcapFiltersUpdate, add bool) (*PcapFiltersView, error) {
+	filters := c.currentFilters()
+	if filters == nil {
+		return nil, errPcapControlUnavailable
+	}
+	if err := update.apply(filters, add); err != nil {
+		return nil, err
+	}
+	return filters.View(), nil
+}
+
+func (c *PcapControl) currentFilters() PcapFilters {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.filters
+}
+
+func (c *PcapControl) Start() error {
+	if c.hooks.Start == nil {
+		return errPcapControlUnavailable
+	}
+	return c.hooks.Start()
+}
+
+func (c *PcapControl) Stop() error {
+	if c.hooks.Stop == nil {
+		return errPcapControlUnavailable
+	}
+	return c.hooks.Stop()
+}
+
+func (c *PcapControl) Reload() error {
+	if c.hooks.Reload == nil {
+		return errPcapControlUnavailable
+	}
+	return c.hooks.Reload()
+}
+
+func (c *PcapControl) StartCapture(name string) error {
+	if c.hooks.StartCapture == nil {
+		return errPcapControlUnavailable
+	}
+	return c.hooks.StartCapture(name)
+}
+
+func (c *PcapControl) StopCapture(name string) error {
+	if c.hooks.StopCapture == nil {
+		return errPcapControlUnavailable
+	}
+	return c.hooks.StopCapture(name)
+}
+
+// NewPcapControlHandler allows to operate the captures registered with `control`:
+//   - `GET /control/status`: state, BPF filter, and stats of every capture,
+//   - `GET /control/filter`: BPF filter enforced by every capture,
+//   - `POST /control/start` and `POST /control/stop`: use the hooks of `control`,
+//   - `POST /control/pause` and `POST /control/resume`: discard packets without closing handles,
+//   - `POST /control/rotate`: rotate the files of all writers,
+//   - `POST /control/reload`: use the `Reload` hook of `control`,
+//   - `GET /control/captures/{name}`: status of a single capture; unknown captures are rejected with `404 Not Found`,
+//   - `POST /control/captures/{name}/{start,stop,pause,resume,rotate}`: operate a single capture, and render its status,
+//   - `GET /control/sessions`: state of all sessions; `POST /control/sessions` queues the `PcapSession` in the body,
+//   - `POST /control/sessions/{name}/trigger` and `POST /control/sessions/{name}/cancel`: see `PcapSessions`,
+//   - `/filters`: see `NewPcapFiltersHandler`; only if `control` has filters, which may be replaced by `Reset`,
+//   - `GET /healthz` and `GET /readyz`: see `NewPcapHealthHandler`,
+//   - `GET /metrics`: see `NewPcapMetricsHandler`.
+//
+// All `POST` endpoints render the resulting status; unavailable operations are rejected with `501 Not Implemented`.
+func NewPcapControlHandler(control *PcapControl) http.Handler {
+	operate := func(fn func() error) http.HandlerFunc {
+		return func(w http.ResponseWriter, _ *http.Request) {
+			if err := fn(); errors.Is(err, errPcapControlUnavailable) {
+				http.Error(w, err.Error(), http.StatusNotImplemented)
+				return
+			} else if err != nil {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			writeDebugJSON(w, control.Status())
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+PcapControlStatusPath, func(w http.ResponseWriter, _ *http.Request) {
+		writeDebugJSON(w, control.Status())
+	})
+	mux.HandleFunc("GET "+PcapControlFilterPath, func(w http.ResponseWriter, _ *http.Request) {
+		writeDebugJSON(w, control.Filters())
+	})
+	mux.HandleFunc("POST "+PcapControlStartPath, operate(control.Start))
+	mux.HandleFunc("POST "+PcapControlStopPath, operate(control.Stop))
+	mux.HandleFunc("POST "+PcapControlPausePath, operate(control.Pause))
+	mux.HandleFunc("POST "+PcapControlResumePath, operate(control.Resume))
+	mux.HandleFunc("POST "+PcapControlRotatePath, operate(control.Rotate))
+	mux.HandleFunc("POST "+PcapControlReloadPath, operate(control.Reload))
+
+	// captures are operated by name, and render their own status
+	operateCapture := func(fn func(string) error) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			name := r.PathValue("name")
+			err := fn(name)
+			var status *PcapControlStatus
+			if err == nil {
+				status, err = control.CaptureStatus(name)
+			}
+			if errors.Is(err, errPcapControlUnknownCapture) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			} else if errors.Is(err, errPcapControlUnavailable) {
+				http.Error(w, err.Error(), http.StatusNotImplemented)
+				return
+			} else if err != nil {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			writeDebugJSON(w, status)
+		}
+	}
+	mux.HandleFunc("GET "+PcapControlCapturePath, operateCapture(func(string) error {
+		return nil
+	}))
+	mux.HandleFunc("POST "+PcapControlCaptureStartPath, operateCapture(control.StartCapture))
+	mux.HandleFunc("POST "+PcapControlCaptureStopPath, operateCapture(control.StopCapture))
+	mux.HandleFunc("POST "+PcapControlCapturePausePath, operateCapture(control.PauseCapture))
+	mux.HandleFunc("POST "+PcapControlCaptureResumePath, operateCapture(control.ResumeCapture))
+	mux.HandleFunc("POST "+PcapControlCaptureRotatePath, operateCapture(control.RotateCapture))
+
+	// sessions render the state of all sessions instead of the one of captures
+	operateSessions := func(fn func(*PcapSessions, *http.Request) error) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			sessions, err := control.currentSessions()
+			if err == nil {
+				err = fn(sessions, r)
+			}
+			if errors.Is(err, errPcapControlUnavailable) {
+				http.Error(w, err.Error(), http.StatusNotImplemented)
+				return
+			} else if err != nil {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			writeDebugJSON(w, sessions.Status())
+		}
+	}
+	mux.HandleFunc("GET "+PcapControlSessionsPath, operateSessions(func(*PcapSessions, *http.Request) error {
+		return nil
+	}))
+	mux.HandleFunc("POST "+PcapControlSessionsPath, operateSessions(func(sessions *PcapSessions, r *http.Request) error {
+		var session PcapSession
+		if err := json.NewDecoder(r.Body).Decode(&session); err != nil {
+			return err
+		}
+		return sessions.Enqueue(session)
+	}))
+	mux.HandleFunc("POST "+PcapControlSessionTriggerPath, operateSessions(func(sessions *PcapSessions, r *http.Request) error {
+		return sessions.Trigger(r.PathValue("name"))
+	}))
+	mux.HandleFunc("POST "+PcapControlSessionCancelPath, operateSessions(func(sessions *PcapSessions, r *http.Request) error {
+		return sessions.Cancel(r.PathValue("name"))
+	}))
+
+	filters := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		filters := control.currentFilters()
+		if filters == nil {
+			http.Error(w, errPcapControlUnavailable.Error(), http.StatusNotImplemented)
+			return
+		}
+		NewPcapFiltersHandler(filters).ServeHTTP(w, r)
+	})
+	mux.Handle(PcapFiltersPath, filters)
+	mux.Handle(PcapFiltersPath+"/", filters)
+
+	mux.Handle("GET "+PcapControlTranslationsPath, newPcapControlTranslationsHandler(control))
+
+	health := NewPcapHealthHandler(control)
+	mux.Handle("GET "+PcapHealthzPath, health)
+	mux.Handle("GET "+PcapReadyzPath, health)
+	mux.Handle("GET "+PcapMetricsPath, NewPcapMetricsHandler(control))
+	return mux
+}
+
+// ListenPcapControl listens on `addr`, which is either `host:port` or `unix:{path}`:
+//   - a stale unix socket left behind by a previous execution is removed.
+func ListenPcapControl(addr string) (net.Listener, error) {
+	path, isUnix := strings.CutPrefix(addr, PcapControlUnixPrefix)
+	if !isUnix {
+		return net.Listen("tcp", addr)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,159 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type (
+	// PcapHealthCheckedEngine is implemented by engines which can tell if their goroutines are making progress.
+	PcapHealthCheckedEngine interface {
+		PcapEngine
+		CheckHealth() *PcapHealthCheck
+	}
+
+	// PcapQueuedWriter is implemented by writers which accept writes before persisting them.
+	PcapQueuedWriter interface {
+		PcapWriter
+		// writes accepted but not persisted yet, and how many writes may be accepted before writing blocks
+		Queue() (pending, capacity int)
+	}
+
+	// PcapHealthCheck explains why an engine is not healthy:
+	//   - `Failures` are reported by both `/healthz` and `/readyz`: the engine will not recover by itself,
+	//   - `Saturations` are only reported by `/readyz`: the engine is not keeping up with traffic.
+	PcapHealthCheck struct {
+		Failures    []string
+		Saturations []string
+	}
+
+	PcapHealthStatus struct {
+		Name    string   `json:"name"`
+		Healthy bool     `json:"healthy"`
+		Reasons []string `json:"reasons,omitempty"`
+	}
+
+	PcapHealthReport struct {
+		Healthy  bool                `json:"healthy"`
+		Reasons  []string            `json:"reasons,omitempty"`
+		Captures []*PcapHealthStatus `json:"captures"`
+	}
+)
+
+const (
+	PcapHealthzPath = "/healthz"
+	PcapReadyzPath  = "/readyz"
+)
+
+const (
+	pcapHeartbeatInterval = time.Second
+	// goroutines which did not make progress for this long are considered to be dead
+	pcapHealthDeadline = 30 * time.Second
+)
+
+func (c *PcapHealthCheck) fail(format string, args ...any) {
+	c.Failures = append(c.Failures, fmt.Sprintf(format, args...))
+}
+
+func (c *PcapHealthCheck) saturate(format string, args ...any) {
+	c.Saturations = append(c.Saturations, fmt.Sprintf(format, args...))
+}
+
+// Health checks every registered capture:
+//   - liveness only fails if engines or writers stopped making progress, so restarting the sidecar is the way to recover,
+//   - readiness additionally requires handles to be open, and translations and writes not to be saturated.
+func (c *PcapControl) Health(readiness bool) *PcapHealthReport {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	report := &PcapHealthReport{
+		Healthy:  true,
+		Captures: make([]*PcapHealthStatus, len(c.captures)),
+	}
+	// there is nothing to be ready for until captures are registered; i/e: while waiting for sessions
+	if readiness && len(c.captures) == 0 {
+		report.Healthy = false
+		report.Reasons = []string{"no capture is registered"}
+	}
+
+	for i, capture := range c.captures {
+		reasons := make([]string, 0)
+		if readiness && !capture.engine.IsReady() {
+			reasons = append(reasons, "pcap handle is not open")
+		}
+		if engine, ok := capture.engine.(PcapHealthCheckedEngine); ok {
+			check := engine.CheckHealth()
+			reasons = append(reasons, check.Failures...)
+			if readiness {
+				reasons = append(reasons, check.Saturations...)
+			}
+		}
+		if readiness {
+			for j, writer := range capture.writers {
+				if pending, capacity, ok := pcapWriterQueue(writer); ok && capacity > 0 && pending >= capacity {
+					reasons = append(reasons, fmt.Sprintf("queue of writer %d is full: %d/%d", j, pending, capacity))
+				}
+			}
+		}
+		report.Captures[i] = &PcapHealthStatus{
+			Name:    capture.name,
+			Healthy: len(reasons) == 0,
+			Reasons: reasons,
+		}
+		report.Healthy = report.Healthy && len(reasons) == 0
+	}
+
+	return report
+}
+
+// pcapWriterQueue unwraps writers decorated by routes and profiles.
+func pcapWriterQueue(writer PcapWriter) (int, int, bool) {
+	switch w := writer.(type) {
+	case *routedPcapWriter:
+		return pcapWriterQueue(w.PcapWriter)
+	case *profiledPcapWriter:
+		return pcapWriterQueue(w.PcapWriter)
+	case PcapQueuedWriter:
+		pending, capacity := w.Queue()
+		return pending, capacity, true
+	}
+	return 0, 0, false
+}
+
+// NewPcapHealthHandler serves Kubernetes probes for the captures registered with `control`:
+//   - `GET /healthz`: liveness; fails if the capture loop, or the goroutines translating and writing packets, died,
+//   - `GET /readyz`: readiness; also fails if handles are not open, or translations and writes are saturated.
+//
+// Both endpoints render a `PcapHealthReport` with the reasons of every failure, along with `503 Service Unavailable`.
+func NewPcapHealthHandler(control *PcapControl) http.Handler {
+	probe := func(readiness bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, _ *http.Request) {
+			report := control.Health(readiness)
+			if !report.Healthy {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+			writeDebugJSON(w, report)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+PcapHealthzPath, probe(false))
+	mux.HandleFunc("GET "+PcapReadyzPath, probe(true))
+	return mux
+}
@@ -0,0 +1,120 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+type (
+	// PcapTrafficEngine is implemented by engines which count the packets they read, whether they are translated or not.
+	PcapTrafficEngine interface {
+		PcapEngine
+		Traffic() *PcapTrafficStats
+	}
+
+	// pcapMetric is a family of samples rendered using the Prometheus text exposition format.
+	pcapMetric struct {
+		name, help, kind string
+		samples          []string
+	}
+)
+
+const PcapMetricsPath = "/metrics"
+
+var pcapMetricLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func (m *pcapMetric) sample(value uint64, labels ...string) {
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[i], pcapMetricLabelEscaper.Replace(labels[i+1])))
+	}
+	m.samples = append(m.samples, fmt.Sprintf("%s{%s} %d", m.name, strings.Join(pairs, ","), value))
+}
+
+func (m *pcapMetric) writeTo(w io.Writer) {
+	if len(m.samples) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+	for _, sample := range m.samples {
+		fmt.Fprintln(w, sample)
+	}
+}
+
+func (m *pcapMetric) window(capture string, window *PcapTrafficWindow, bytes bool) {
+	for _, protocol := range slices.Sorted(maps.Keys(window.Protocols)) {
+		counters := window.Protocols[protocol]
+		value := counters.Packets
+		if bytes {
+			value = counters.Bytes
+		}
+		m.sample(value, "capture", capture, "window", fmt.Sprintf("%ds", window.Seconds), "protocol", protocol)
+	}
+}
+
+// WriteMetrics renders the counters, and drops per reason, of all registered captures, and the traffic of those implementing `PcapTrafficEngine`,
+// using the Prometheus text exposition format.
+func (c *PcapControl) WriteMetrics(w io.Writer) {
+	packets := &pcapMetric{name: "pcap_packets_total", help: "Packets translated, or written by tcpdump, since the engine was created.", kind: "counter"}
+	bytes := &pcapMetric{name: "pcap_bytes_total", help: "Bytes of packets translated since the engine was created.", kind: "counter"}
+	dropped := &pcapMetric{name: "pcap_dropped_total", help: "Packets dropped by the kernel as buffers were full.", kind: "counter"}
+	trafficPackets := &pcapMetric{name: "pcap_traffic_packets", help: "Packets read during the last complete window, per L4 protocol.", kind: "gauge"}
+	trafficBytes := &pcapMetric{name: "pcap_traffic_bytes", help: "Bytes read during the last complete window, per L4 protocol.", kind: "gauge"}
+	drops := &pcapMetric{name: "pcap_drops_total", help: "Packets read but not written, per reason.", kind: "counter"}
+
+	c.mutex.RLock()
+	for _, capture := range c.captures {
+		stats := capture.engine.Stats()
+		packets.sample(stats.Packets, "capture", capture.name)
+		bytes.sample(stats.Bytes, "capture", capture.name)
+		dropped.sample(stats.Dropped, "capture", capture.name)
+		for _, reason := range slices.Sorted(maps.Keys(stats.Drops)) {
+			drops.sample(stats.Drops[reason], "capture", capture.name, "reason", reason)
+		}
+
+		engine, ok := capture.engine.(PcapTrafficEngine)
+		if !ok {
+			continue
+		}
+		if traffic := engine.Traffic(); traffic != nil {
+			trafficPackets.window(capture.name, &traffic.Second, false /* bytes */)
+			trafficPackets.window(capture.name, &traffic.Minute, false /* bytes */)
+			trafficBytes.window(capture.name, &traffic.Second, true /* bytes */)
+			trafficBytes.window(capture.name, &traffic.Minute, true /* bytes */)
+		}
+	}
+	c.mutex.RUnlock()
+
+	for _, metric := range []*pcapMetric{packets, bytes, dropped, drops, trafficPackets, trafficBytes} {
+		metric.writeTo(w)
+	}
+}
+
+// NewPcapMetricsHandler serves `GET /metrics` for the captures registered with `control`; see `WriteMetrics`.
+// Traffic is rolled over 1 second and 1 minute windows, so that it tells if packets are flowing without translating them.
+func NewPcapMetricsHandler(control *PcapControl) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+PcapMetricsPath, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		control.WriteMetrics(w)
+	})
+	return mux
+}
@@ -0,0 +1,272 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/GoogleCloudPlatform/pcap-sidecar/pcap-cli/internal/transformer"
+	mapset "github.com/deckarep/golang-set/v2"
+	"github.com/klauspost/compress/zstd"
+)
+
+type (
+	// PcapControlTranslation is a translation written by the capture named `Capture`, encoded according to its format.
+	PcapControlTranslation struct {
+		Capture string
+		Format  string
+		Data    []byte
+	}
+
+	// PcapControlCompression is how `PcapControlSubscription.Encode` compresses every translation on its own.
+	PcapControlCompression uint8
+
+	// PcapControlEncoding describes how a subscriber wants translations to be sent.
+	PcapControlEncoding struct {
+		// fields of JSON translations which are kept, using the syntax of `PcapContextFields`; all of them if empty:
+		// only captures whose format is `json` may be subscribed to with fields
+		Fields      []string
+		Compression PcapControlCompression
+	}
+
+	// PcapControlSubscription receives the translations written into the writers created by `PcapControl.Writer`.
+	PcapControlSubscription struct {
+		control      *PcapControl
+		captures     mapset.Set[string]
+		translations chan *PcapControlTranslation
+		dropped      *atomic.Uint64
+		// `Encode` is called by the goroutine of the subscriber: engines never wait for translations to be encoded
+		project func([]byte) ([]byte, error)
+		buffer  bytes.Buffer
+		gzip    *gzip.Writer
+		zstd    *zstd.Encoder
+	}
+
+	// controlPcapWriter never blocks engines: translations are dropped for subscribers which are not keeping up.
+	controlPcapWriter struct {
+		control *PcapControl
+		name    string
+		iface   *string
+		format  string
+	}
+)
+
+const (
+	PcapControlCompressionNone PcapControlCompression = iota
+	PcapControlCompressionGzip
+	PcapControlCompressionZstd
+)
+
+// translations queued per subscriber
+const pcapControlTranslationsBuffer = 1024
+
+var errPcapControlNotProjectable = errors.New("translations which are not JSON cannot be projected")
+
+var pcapControlCompressions = map[string]PcapControlCompression{
+	"":     PcapControlCompressionNone,
+	"none": PcapControlCompressionNone,
+	"gzip": PcapControlCompressionGzip,
+	"zstd": PcapControlCompressionZstd,
+}
+
+// ParsePcapControlCompression parses `none`, `gzip` or `zstd`; empty means `none`.
+func ParsePcapControlCompression(compression string) (PcapControlCompression, error) {
+	if value, ok := pcapControlCompressions[strings.ToLower(compression)]; ok {
+		return value, nil
+	}
+	return PcapControlCompressionNone, fmt.Errorf("unknown compression: %s", compression)
+}
+
+func isProjectablePcapControlFormat(format string) bool {
+	return format == "json"
+}
+
+// Writer creates a writer for the capture registered as `name`, which hands translations over to subscribers:
+//   - it must be added to the writers of the capture before its engine is started,
+//   - `format` is the format of the translations of the capture; see `PcapConfig.Format`.
+func (c *PcapControl) Writer(name string, iface *string, format string) PcapWriter {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.formats[name] = format
+
+	return &controlPcapWriter{control: c, name: name, iface: iface, format: format}
+}
+
+// Subscribe receives translations written by the captures named `captures`, or by all of them if empty;
+// up to `buffer` translations are queued before new ones are dropped. `Close` must be called once done.
+func (c *PcapControl) Subscribe(captures []string, buffer int) *PcapControlSubscription {
+	subscription, _ := c.SubscribeEncoded(captures, buffer, nil)
+	return subscription
+}
+
+// SubscribeEncoded is `Subscribe` for subscribers which send translations as described by `encoding`; see `Encode`:
+//   - fields are rejected if any of the captures subscribed to does not translate packets into JSON,
+//   - translations of captures which only write translations other than JSON after subscribing, i/e: once reloaded, are dropped.
+func (c *PcapControl) SubscribeEncoded(captures []string, buffer int, encoding *PcapControlEncoding) (*PcapControlSubscription, error) {
+	subscription := &PcapControlSubscription{
+		control:      c,
+		captures:     mapset.NewThreadUnsafeSet(captures...),
+		translations: make(chan *PcapControlTranslation, buffer),
+		dropped:      new(atomic.Uint64),
+	}
+
+	if encoding != nil {
+		subscription.project = transformer.NewJSONFieldsProjection(encoding.Fields)
+		switch encoding.Compression {
+		case PcapControlCompressionNone:
+		case PcapControlCompressionGzip:
+			subscription.gzip = gzip.NewWriter(&subscription.buffer)
+		case PcapControlCompressionZstd:
+			encoder, err := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+			if err != nil {
+				return nil, err
+			}
+			subscription.zstd = encoder
+		default:
+			return nil, fmt.Errorf("unknown compression: %d", encoding.Compression)
+		}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if subscription.project != nil {
+		for name, format := range c.formats {
+			if subscription.subscribes(name) && !isProjectablePcapControlFormat(format) {
+				subscription.close()
+				return nil, fmt.Errorf("capture %s: %w: format is %s", name, errPcapControlNotProjectable, format)
+			}
+		}
+	}
+	c.subscribers[subscription] = struct{}{}
+
+	return subscription, nil
+}
+
+// Encode projects the fields, and then compresses the data, of `translation` as requested by the subscriber;
+// it must only be called by the goroutine consuming `Translations`.
+func (s *PcapControlSubscription) Encode(translation *PcapControlTranslation) ([]byte, error) {
+	data := translation.Data
+	if s.project != nil {
+		projection, err := s.project(data)
+		if err != nil {
+			return nil, fmt.Errorf("fields of translations of capture %s cannot be projected: %w", translation.Capture, err)
+		}
+		data = projection
+	}
+
+	switch {
+	case s.gzip != nil:
+		s.buffer.Reset()
+		s.gzip.Reset(&s.buffer)
+		if _, err := s.gzip.Write(data); err != nil {
+			return nil, err
+		}
+		if err := s.gzip.Close(); err != nil {
+			return nil, err
+		}
+		return bytes.Clone(s.buffer.Bytes()), nil
+	case s.zstd != nil:
+		return s.zstd.EncodeAll(data, nil), nil
+	}
+	return data, nil
+}
+
+// subscribes returns whether translations of the capture named `name` are received.
+func (s *PcapControlSubscription) subscribes(name string) bool {
+	return s.captures.Cardinality() == 0 || s.captures.Contains(name)
+}
+
+func (s *PcapControlSubscription) Translations() <-chan *PcapControlTranslation {
+	return s.translations
+}
+
+// Dropped returns how many translations were dropped since the last time it was called.
+func (s *PcapControlSubscription) Dropped() uint64 {
+	return s.dropped.Swap(0)
+}
+
+func (s *PcapControlSubscription) Close() {
+	s.control.mutex.Lock()
+	defer s.control.mutex.Unlock()
+
+	if _, ok := s.control.subscribers[s]; ok {
+		delete(s.control.subscribers, s)
+		close(s.translations)
+		s.close()
+	}
+}
+
+func (s *PcapControlSubscription) close() {
+	if s.zstd != nil {
+		s.zstd.Close()
+	}
+}
+
+func (w *controlPcapWriter) Write(p []byte) (int, error) {
+	w.control.mutex.RLock()
+	defer w.control.mutex.RUnlock()
+
+	if len(w.control.subscribers) == 0 {
+		return len(p), nil
+	}
+
+	// engines may reuse `p` once it has been written
+	translation := &PcapControlTranslation{Capture: w.name, Format: w.format, Data: append([]byte(nil), p...)}
+	for subscription := range w.control.subscribers {
+		if !subscription.subscribes(w.name) {
+			continue
+		}
+		if subscription.project != nil && !isProjectablePcapControlFormat(w.format) {
+			// the stream of the subscriber must not fail: it may receive translations of other captures
+			subscription.dropped.Add(1)
+			continue
+		}
+		select {
+		case subscription.translations <- translation:
+		default:
+			subscription.dropped.Add(1)
+		}
+	}
+	return len(p), nil
+}
+
+func (w *controlPcapWriter) Close() error {
+	return nil
+}
+
+func (w *controlPcapWriter) Rotate() {}
+
+func (w *controlPcapWriter) Flush(_ context.Context) error {
+	return nil
+}
+
+func (w *controlPcapWriter) IsStdOutOrErr() bool {
+	return false
+}
+
+func (w *controlPcapWriter) GetIface() *string {
+	return w.iface
+}
+
+func (w *controlPcapWriter) Files() []string {
+	return nil
+}
@@ -0,0 +1,152 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPcapControlSubscriptionEncoding verifies that every subscriber receives translations projected, and compressed,
+// as it requested, regardless of how other subscribers receive them.
+func TestPcapControlSubscriptionEncoding(t *testing.T) {
+	t.Parallel()
+
+	control := NewPcapControl(nil, nil)
+	iface := "eth0"
+	writer := control.Writer("capture", &iface, "json")
+
+	raw := control.Subscribe(nil, 2)
+	defer raw.Close()
+	gzipped, err := control.SubscribeEncoded(nil, 2, &PcapControlEncoding{
+		Fields:      []string{"l4.src", "-l4.src"},
+		Compression: PcapControlCompressionGzip,
+	})
+	require.NoError(t, err)
+	defer gzipped.Close()
+	zstded, err := control.SubscribeEncoded([]string{"capture"}, 2, &PcapControlEncoding{
+		Fields:      []string{"tcp.dst"},
+		Compression: PcapControlCompressionZstd,
+	})
+	require.NoError(t, err)
+	defer zstded.Close()
+
+	_, err = control.SubscribeEncoded(nil, 2, &PcapControlEncoding{Compression: 7})
+	assert.Error(t, err)
+
+	translation := []byte(`{"timestamp":{"seconds":1},"l3":{"src":"10.0.0.1"},"l4":{"src":1234,"dst":443}}` + "\n")
+	_, err = writer.Write(translation)
+	require.NoError(t, err)
+
+	decode := func(subscription *PcapControlSubscription, decompress func([]byte) []byte) map[string]any {
+		data, err := subscription.Encode(<-subscription.Translations())
+		require.NoError(t, err)
+		data = decompress(data)
+		assert.True(t, bytes.HasSuffix(data, []byte("\n")))
+		var fields map[string]any
+		require.NoError(t, json.Unmarshal(data, &fields))
+		return fields
+	}
+
+	fields := decode(raw, func(data []byte) []byte { return data })
+	assert.Contains(t, fields, "l3")
+
+	fields = decode(gzipped, func(data []byte) []byte {
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		require.NoError(t, err)
+		decompressed, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		return decompressed
+	})
+	assert.Equal(t, map[string]any{"timestamp": map[string]any{"seconds": 1.0}, "l4": map[string]any{}}, fields)
+
+	decoder, err := zstd.NewReader(nil)
+	require.NoError(t, err)
+	defer decoder.Close()
+	fields = decode(zstded, func(data []byte) []byte {
+		decompressed, err := decoder.DecodeAll(data, nil)
+		require.NoError(t, err)
+		return decompressed
+	})
+	assert.Equal(t, map[string]any{"timestamp": map[string]any{"seconds": 1.0}, "l4": map[string]any{"dst": 443.0}}, fields)
+
+	// invalid JSON translations cannot be projected
+	_, err = writer.Write([]byte{0x0a, 0x01})
+	require.NoError(t, err)
+	<-gzipped.Translations()
+	_, err = zstded.Encode(<-zstded.Translations())
+	assert.Error(t, err)
+}
+
+// TestPcapControlSubscriptionFormats verifies that fields are rejected when subscribing to captures which do not translate packets into JSON,
+// instead of failing streams which are already running.
+func TestPcapControlSubscriptionFormats(t *testing.T) {
+	t.Parallel()
+
+	control := NewPcapControl(nil, nil)
+	iface := "eth0"
+	jsonWriter := control.Writer("json", &iface, "json")
+	fields := &PcapControlEncoding{Fields: []string{"l3"}}
+
+	all, err := control.SubscribeEncoded(nil, 2, fields)
+	require.NoError(t, err)
+	defer all.Close()
+
+	protoWriter := control.Writer("proto", &iface, "proto")
+
+	_, err = control.SubscribeEncoded(nil, 2, fields)
+	assert.ErrorIs(t, err, errPcapControlNotProjectable)
+	_, err = control.SubscribeEncoded([]string{"proto"}, 2, fields)
+	assert.ErrorIs(t, err, errPcapControlNotProjectable)
+
+	onlyJSON, err := control.SubscribeEncoded([]string{"json"}, 2, fields)
+	require.NoError(t, err)
+	defer onlyJSON.Close()
+	// without fields, translations of any format are sent as they are
+	raw, err := control.SubscribeEncoded([]string{"proto"}, 2, &PcapControlEncoding{Compression: PcapControlCompressionGzip})
+	require.NoError(t, err)
+	defer raw.Close()
+
+	// subscribers which projected fields before the capture was created miss its translations, but keep receiving the others
+	_, err = protoWriter.Write([]byte{0x0a, 0x01})
+	require.NoError(t, err)
+	_, err = jsonWriter.Write([]byte(`{"l3":{"src":"10.0.0.1"},"l4":{"src":1234}}` + "\n"))
+	require.NoError(t, err)
+
+	translation := <-all.Translations()
+	assert.Equal(t, "json", translation.Format)
+	data, err := all.Encode(translation)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"l3":{"src":"10.0.0.1"}}`, string(data))
+	assert.Equal(t, uint64(1), all.Dropped())
+
+	assert.Equal(t, "json", (<-onlyJSON.Translations()).Capture)
+	assert.Zero(t, onlyJSON.Dropped())
+	assert.Equal(t, "proto", (<-raw.Translations()).Format)
+
+	for _, compression := range []string{"", "none", "GZIP", "zstd"} {
+		_, err := ParsePcapControlCompression(compression)
+		assert.NoError(t, err, compression)
+	}
+	_, err = ParsePcapControlCompression("brotli")
+	assert.Error(t, err)
+}
@@ -0,0 +1,109 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/websocket"
+)
+
+// serves translations over WebSocket; i/e: `/control/translations?captures=eth0/0&fields=l3,l4&compression=zstd`
+const PcapControlTranslationsPath = "/control/translations"
+
+var errPcapControlCrossOrigin = errors.New("cross-origin requests are not allowed")
+
+func splitPcapControlList(list string) []string {
+	if list == "" {
+		return nil
+	}
+	return strings.Split(list, ",")
+}
+
+// newPcapControlTranslationsHandler streams translations to WebSocket clients, 1 message per translation:
+//   - `captures`, `fields` and `compression` query parameters are the same as those of `StreamTranslations`,
+//   - messages are text, unless they are compressed or translations are binary; i/e: `proto` or `pcapng`.
+func newPcapControlTranslationsHandler(control *PcapControl) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		compression, err := ParsePcapControlCompression(query.Get("compression"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		subscription, err := control.SubscribeEncoded(splitPcapControlList(query.Get("captures")), pcapControlTranslationsBuffer, &PcapControlEncoding{
+			Fields:      splitPcapControlList(query.Get("fields")),
+			Compression: compression,
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// the handshake may fail: `Handler` is not called then
+		defer subscription.Close()
+
+		websocket.Server{
+			// browsers send the origin of the page: only pages served by the control API itself may read translations
+			Handshake: func(_ *websocket.Config, r *http.Request) error {
+				if origin := r.Header.Get("Origin"); origin != "" {
+					if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+						return errPcapControlCrossOrigin
+					}
+				}
+				return nil
+			},
+			Handler: func(conn *websocket.Conn) {
+				streamPcapControlTranslations(r.Context(), conn, subscription)
+			},
+		}.ServeHTTP(w, r)
+	})
+}
+
+func streamPcapControlTranslations(ctx context.Context, conn *websocket.Conn, subscription *PcapControlSubscription) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// clients do not send messages: reading only detects that they are gone
+	go func() {
+		_, _ = io.Copy(io.Discard, conn)
+		cancel()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case translation := <-subscription.Translations():
+			data, err := subscription.Encode(translation)
+			if err != nil {
+				subscription.dropped.Add(1)
+				continue
+			}
+			conn.PayloadType = websocket.BinaryFrame
+			if subscription.gzip == nil && subscription.zstd == nil && utf8.Valid(data) {
+				conn.PayloadType = websocket.TextFrame
+			}
+			if _, err := conn.Write(data); err != nil {
+				return
+			}
+		}
+	}
+}
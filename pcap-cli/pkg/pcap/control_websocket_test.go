@@ -0,0 +1,96 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+)
+
+// TestPcapControlTranslationsWebSocket verifies that WebSocket clients receive translations as they requested them.
+func TestPcapControlTranslationsWebSocket(t *testing.T) {
+	t.Parallel()
+
+	control := NewPcapControl(nil, nil)
+	iface := "eth0"
+	jsonWriter := control.Writer("json", &iface, "json")
+	control.Writer("proto", &iface, "proto")
+
+	server := httptest.NewServer(NewPcapControlHandler(control))
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + PcapControlTranslationsPath
+
+	// subscriptions are validated before upgrading connections
+	for _, query := range []string{"?compression=brotli", "?fields=l3", "?captures=proto&fields=l3"} {
+		response, err := http.Get(server.URL + PcapControlTranslationsPath + query)
+		require.NoError(t, err)
+		response.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode, query)
+	}
+
+	// pages served by other origins cannot read translations
+	_, err := websocket.Dial(wsURL, "", "http://example.com")
+	assert.Error(t, err)
+
+	text, err := websocket.Dial(wsURL+"?captures=json&fields=l4", "", server.URL)
+	require.NoError(t, err)
+	defer text.Close()
+	compressed, err := websocket.Dial(wsURL+"?compression=gzip", "", server.URL)
+	require.NoError(t, err)
+	defer compressed.Close()
+
+	// subscriptions are created by handlers: translations are only sent to them once they exist
+	translation := []byte(`{"l3":{"src":"10.0.0.1"},"l4":{"src":1234}}` + "\n")
+	require.Eventually(t, func() bool {
+		control.mutex.RLock()
+		defer control.mutex.RUnlock()
+		return len(control.subscribers) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	_, err = jsonWriter.Write(translation)
+	require.NoError(t, err)
+
+	var message string
+	require.NoError(t, text.SetReadDeadline(time.Now().Add(5*time.Second)))
+	require.NoError(t, websocket.Message.Receive(text, &message))
+	assert.JSONEq(t, `{"l4":{"src":1234}}`, message)
+
+	var frame []byte
+	require.NoError(t, compressed.SetReadDeadline(time.Now().Add(5*time.Second)))
+	require.NoError(t, websocket.Message.Receive(compressed, &frame))
+	reader, err := gzip.NewReader(bytes.NewReader(frame))
+	require.NoError(t, err)
+	decompressed, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, translation, decompressed)
+
+	// subscriptions end along with connections
+	text.Close()
+	compressed.Close()
+	assert.Eventually(t, func() bool {
+		control.mutex.RLock()
+		defer control.mutex.RUnlock()
+		return len(control.subscribers) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
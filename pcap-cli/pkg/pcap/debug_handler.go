@@ -0,0 +1,65 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/GoogleCloudPlatform/pcap-sidecar/pcap-cli/internal/transformer"
+)
+
+type (
+	// PcapCorrelationIndex exposes how JSON translators link responses to traced requests:
+	//   - use `context.WithValue(ctx, PcapContextCorrelationIndex, index)` before starting engines,
+	//   - a single index may be shared by all engines; the most recent translator of every interface is reported.
+	PcapCorrelationIndex = transformer.CorrelationIndex
+	PcapCorrelationTrace = transformer.CorrelationTrace
+	PcapCorrelationFlow  = transformer.CorrelationFlow
+)
+
+const (
+	PcapContextCorrelationIndex = transformer.ContextCorrelationIndex
+
+	PcapDebugTracesPath = "/debug/traces"
+	PcapDebugFlowsPath  = "/debug/flows"
+)
+
+func NewPcapCorrelationIndex() *PcapCorrelationIndex {
+	return transformer.NewCorrelationIndex()
+}
+
+// NewPcapDebugHandler renders the contents of `index` as JSON:
+//   - `/debug/traces`: traced requests, and the streams of the connections which carried them,
+//   - `/debug/flows`: connections which carried traced requests, their streams, and TCP sequences of traced requests.
+func NewPcapDebugHandler(index *PcapCorrelationIndex) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+PcapDebugTracesPath, func(w http.ResponseWriter, _ *http.Request) {
+		writeDebugJSON(w, index.Traces())
+	})
+	mux.HandleFunc("GET "+PcapDebugFlowsPath, func(w http.ResponseWriter, _ *http.Request) {
+		writeDebugJSON(w, index.Flows())
+	})
+	return mux
+}
+
+func writeDebugJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,378 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+type (
+	// PcapManager owns named engines, along with the writers they feed:
+	//   - engines may capture from different interfaces, using different filters and writers,
+	//   - all engines are started and stopped together by `Run`, and each of them by name using `Start` and `Stop`,
+	//   - engines are registered with the `PcapControl` of the manager, so they are also operated by name using the control API.
+	PcapManager struct {
+		mutex   sync.Mutex
+		control *PcapControl
+		engines []*pcapManagedEngine
+		wg      sync.WaitGroup
+		// context of `Run`; engines are only started while it is running, and `Run` runs only once
+		ctx context.Context
+		ran bool
+		// given to engines to drain translations when they are stopped; see `PcapConfig.DrainDeadline`
+		drainDeadline time.Duration
+	}
+
+	pcapManagedEngine struct {
+		name    string
+		engine  PcapEngine
+		writers []PcapWriter
+		// all fields below are replaced every time the engine is started
+		stop         context.CancelFunc
+		stopDeadline chan *time.Duration
+		done         chan struct{}
+		err          error
+	}
+)
+
+var (
+	errPcapManagerRunning    = errors.New("manager can only run once")
+	errPcapManagerNotRunning = errors.New("manager is not running")
+	errPcapEngineRunning     = errors.New("engine is already running")
+	errPcapEngineStopped     = errors.New("engine is not running")
+	errPcapEngineExists      = errors.New("engine name is already in use")
+)
+
+// NewPcapManager creates a manager without engines; `filters` are the ones updated using its control API, and may be `nil`.
+func NewPcapManager(filters PcapFilters, drainDeadline time.Duration) *PcapManager {
+	if drainDeadline <= 0 {
+		drainDeadline = pcapDefaultStopDeadline
+	}
+	m := &PcapManager{
+		engines:       make([]*pcapManagedEngine, 0),
+		drainDeadline: drainDeadline,
+	}
+	m.control = NewPcapControl(filters, &PcapControlHooks{
+		Start:        m.startAll,
+		Stop:         m.stopAll,
+		StartCapture: m.Start,
+		StopCapture:  m.Stop,
+	})
+	return m
+}
+
+// Control returns the registry of all engines of the manager; serve it using `NewPcapControlHandler`.
+func (m *PcapManager) Control() *PcapControl {
+	return m.control
+}
+
+// Add makes `engine` and `writers` owned by the manager under `name`; if the manager is running, `engine` is started right away.
+func (m *PcapManager) Add(name string, engine PcapEngine, writers []PcapWriter) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, err := m.find(name); err == nil {
+		return fmt.Errorf("%w: %s", errPcapEngineExists, name)
+	}
+
+	managed := &pcapManagedEngine{name: name, engine: engine, writers: writers}
+	m.engines = append(m.engines, managed)
+	m.control.Register(name, engine, writers)
+
+	if m.ctx != nil {
+		m.start(managed)
+	}
+	return nil
+}
+
+// Remove stops the engine managed under `name`, if it is running, closes its writers, and forgets it.
+func (m *PcapManager) Remove(name string) error {
+	m.mutex.Lock()
+	managed, err := m.find(name)
+	if err != nil {
+		m.mutex.Unlock()
+		return err
+	}
+	m.engines = slices.DeleteFunc(m.engines, func(engine *pcapManagedEngine) bool {
+		return engine == managed
+	})
+	m.control.Unregister(name)
+	done := m.halt(managed)
+	m.mutex.Unlock()
+
+	<-done
+	managed.close()
+	return nil
+}
+
+// Run starts all engines, and blocks until `ctx` is done and all of them are stopped:
+//   - engines are given the drain deadline of the manager to stop,
+//   - writers of all engines are closed, except `stdout` and `stderr`, so a manager runs only once,
+//   - the errors of all engines which failed are returned; engines which were stopped did not fail.
+func (m *PcapManager) Run(ctx context.Context) error {
+	m.mutex.Lock()
+	if m.ran {
+		m.mutex.Unlock()
+		return errPcapManagerRunning
+	}
+	m.ctx, m.ran = ctx, true
+	for _, managed := range m.engines {
+		m.start(managed)
+	}
+	m.mutex.Unlock()
+
+	<-ctx.Done()
+
+	m.mutex.Lock()
+	// engines are not started once `ctx` is done, so nothing else is added to `wg`
+	m.ctx = nil
+	for _, managed := range m.engines {
+		m.halt(managed)
+	}
+	m.mutex.Unlock()
+
+	m.wg.Wait()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	errs := make([]error, 0)
+	for _, managed := range m.engines {
+		if managed.err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", managed.name, managed.err))
+		}
+		managed.close()
+	}
+	return errors.Join(errs...)
+}
+
+// Start starts the engine managed under `name` again after it was stopped; i/e: using `Stop`.
+func (m *PcapManager) Start(name string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	managed, err := m.find(name)
+	if err != nil {
+		return err
+	}
+	if m.ctx == nil {
+		return errPcapManagerNotRunning
+	}
+	if managed.isRunning() {
+		return fmt.Errorf("%w: %s", errPcapEngineRunning, name)
+	}
+	m.start(managed)
+	return nil
+}
+
+// Stop stops the engine managed under `name`, and blocks until it stops; its writers are not closed.
+func (m *PcapManager) Stop(name string) error {
+	m.mutex.Lock()
+	managed, err := m.find(name)
+	if err == nil && !managed.isRunning() {
+		err = fmt.Errorf("%w: %s", errPcapEngineStopped, name)
+	}
+	if err != nil {
+		m.mutex.Unlock()
+		return err
+	}
+	done := m.halt(managed)
+	m.mutex.Unlock()
+
+	<-done
+	return nil
+}
+
+func (m *PcapManager) startAll() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.ctx == nil {
+		return errPcapManagerNotRunning
+	}
+	for _, managed := range m.engines {
+		if !managed.isRunning() {
+			m.start(managed)
+		}
+	}
+	return nil
+}
+
+// stopAll does not block: the control API renders the status of engines while they stop.
+func (m *PcapManager) stopAll() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, managed := range m.engines {
+		m.halt(managed)
+	}
+	return nil
+}
+
+// Stats adds up the stats of all engines: counters are summed, and so are the packets of destinations and protocols seen by many engines.
+func (m *PcapManager) Stats() *PcapStats {
+	m.mutex.Lock()
+	stats := make([]*PcapStats, len(m.engines))
+	for i, managed := range m.engines {
+		stats[i] = managed.engine.Stats()
+	}
+	m.mutex.Unlock()
+
+	return mergePcapStats(stats...)
+}
+
+func (m *PcapManager) find(name string) (*pcapManagedEngine, error) {
+	for _, managed := range m.engines {
+		if managed.name == name {
+			return managed, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", errPcapControlUnknownCapture, name)
+}
+
+// start must be called holding the lock, and only while `Run` is running.
+func (m *PcapManager) start(managed *pcapManagedEngine) {
+	ctx, stop := context.WithCancel(m.ctx)
+	stopDeadline := make(chan *time.Duration, 1)
+	done := make(chan struct{})
+	managed.stop, managed.stopDeadline, managed.done, managed.err = stop, stopDeadline, done, nil
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer close(done)
+		defer stop()
+
+		// this is a blocking call
+		err := managed.engine.Start(ctx, managed.writers, stopDeadline)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			m.mutex.Lock()
+			managed.err = err
+			m.mutex.Unlock()
+		}
+	}()
+}
+
+// halt stops `managed` if it is running, and returns a channel which is closed once it stops; it must be called holding the lock.
+func (m *PcapManager) halt(managed *pcapManagedEngine) <-chan struct{} {
+	if managed.done == nil {
+		done := make(chan struct{})
+		close(done)
+		return done
+	}
+	deadline := m.drainDeadline
+	select {
+	case managed.stopDeadline <- &deadline:
+	default:
+		// the engine is already stopping
+	}
+	managed.stop()
+	return managed.done
+}
+
+func (managed *pcapManagedEngine) isRunning() bool {
+	if managed.done == nil {
+		return false
+	}
+	select {
+	case <-managed.done:
+		return false
+	default:
+		return true
+	}
+}
+
+func (managed *pcapManagedEngine) close() {
+	for _, writer := range managed.writers {
+		if !writer.IsStdOutOrErr() {
+			writer.Close()
+		}
+	}
+}
+
+func mergePcapStats(stats ...*PcapStats) *PcapStats {
+	merged := &PcapStats{}
+	destinations := make(map[string]uint64)
+	protocols := make(map[string]*PcapProtocol)
+	topDestinations := 0
+
+	for _, s := range stats {
+		if s == nil {
+			continue
+		}
+		merged.Packets += s.Packets
+		merged.Bytes += s.Bytes
+		merged.Errors += s.Errors
+		merged.Anomalies += s.Anomalies
+		merged.FilteredOut += s.FilteredOut
+		merged.PausedOut += s.PausedOut
+		merged.Triggered += s.Triggered
+		merged.TriggeredOut += s.TriggeredOut
+		merged.Dropped += s.Dropped
+		merged.IfDropped += s.IfDropped
+		for reason, dropped := range s.Drops {
+			if merged.Drops == nil {
+				merged.Drops = make(map[string]uint64, len(s.Drops))
+			}
+			merged.Drops[reason] += dropped
+		}
+		merged.TCP.HalfOpen += s.TCP.HalfOpen
+		merged.TCP.Established += s.TCP.Established
+		merged.TCP.Resets += s.TCP.Resets
+		merged.TCP.HalfOpenExpired += s.TCP.HalfOpenExpired
+		// memberships are reported per interface
+		merged.Multicast = append(merged.Multicast, s.Multicast...)
+
+		// engines report the same number of top destinations
+		topDestinations = max(topDestinations, len(s.TopDestinations))
+		for _, destination := range s.TopDestinations {
+			destinations[destination.Address] += destination.Packets
+		}
+		for _, protocol := range s.Protocols {
+			if known, ok := protocols[protocol.Path]; ok {
+				known.Packets += protocol.Packets
+				known.Bytes += protocol.Bytes
+			} else {
+				protocols[protocol.Path] = &protocol
+			}
+		}
+	}
+
+	for address, packets := range destinations {
+		merged.TopDestinations = append(merged.TopDestinations, PcapDestination{Address: address, Packets: packets})
+	}
+	slices.SortFunc(merged.TopDestinations, func(a, b PcapDestination) int {
+		if c := cmp.Compare(b.Packets, a.Packets); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Address, b.Address)
+	})
+	merged.TopDestinations = merged.TopDestinations[:min(len(merged.TopDestinations), topDestinations)]
+
+	for _, protocol := range protocols {
+		merged.Protocols = append(merged.Protocols, *protocol)
+	}
+	slices.SortFunc(merged.Protocols, func(a, b PcapProtocol) int {
+		return cmp.Compare(a.Path, b.Path)
+	})
+
+	return merged
+}
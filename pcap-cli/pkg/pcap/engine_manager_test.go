@@ -0,0 +1,225 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pcapManagerTestEngine captures until it is stopped, and reports every start and the stop deadline it was given.
+type pcapManagerTestEngine struct {
+	started  chan struct{}
+	deadline chan time.Duration
+	err      error
+	stats    *PcapStats
+}
+
+func newPcapManagerTestEngine() *pcapManagerTestEngine {
+	return &pcapManagerTestEngine{
+		started:  make(chan struct{}, 4),
+		deadline: make(chan time.Duration, 4),
+	}
+}
+
+func (e *pcapManagerTestEngine) Start(ctx context.Context, _ []PcapWriter, stopDeadline <-chan *time.Duration) error {
+	e.started <- struct{}{}
+	if e.err != nil {
+		return e.err
+	}
+	<-ctx.Done()
+	// the same as real engines: the stop deadline may be provided after the context is done
+	ctxDoneTS := time.Now()
+	e.deadline <- awaitStopDeadline(stopDeadline, ctxDoneTS, time.Minute).Sub(ctxDoneTS)
+	return ctx.Err()
+}
+
+func (e *pcapManagerTestEngine) IsActive() bool { return true }
+
+func (e *pcapManagerTestEngine) IsReady() bool { return true }
+
+func (e *pcapManagerTestEngine) Stats() *PcapStats { return e.stats }
+
+func (e *pcapManagerTestEngine) Filter() string { return "" }
+
+// pcapManagerTestWriter only records whether it was closed.
+type pcapManagerTestWriter struct {
+	closed atomic.Bool
+}
+
+func (w *pcapManagerTestWriter) Write(p []byte) (int, error) { return len(p), nil }
+
+func (w *pcapManagerTestWriter) Close() error {
+	w.closed.Store(true)
+	return nil
+}
+
+func (w *pcapManagerTestWriter) Rotate() {}
+
+func (w *pcapManagerTestWriter) Flush(context.Context) error { return nil }
+
+func (w *pcapManagerTestWriter) IsStdOutOrErr() bool { return false }
+
+func (w *pcapManagerTestWriter) GetIface() *string { return nil }
+
+func (w *pcapManagerTestWriter) Files() []string { return nil }
+
+func waitForPcapManager[T any](t *testing.T, events <-chan T, event string) T {
+	select {
+	case value := <-events:
+		return value
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "manager did not "+event)
+		var zero T
+		return zero
+	}
+}
+
+// TestPcapManagerAddRemoveWhileRunning verifies that engines added while the manager runs are started right away,
+// and that engines are given the drain deadline of the manager every time they are stopped.
+func TestPcapManagerAddRemoveWhileRunning(t *testing.T) {
+	t.Parallel()
+
+	manager := NewPcapManager(nil, 3*time.Second)
+
+	first, firstWriter := newPcapManagerTestEngine(), &pcapManagerTestWriter{}
+	require.NoError(t, manager.Add("first", first, []PcapWriter{firstWriter}))
+	assert.ErrorIs(t, manager.Start("first"), errPcapManagerNotRunning)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ran := make(chan error, 1)
+	go func() { ran <- manager.Run(ctx) }()
+	waitForPcapManager(t, first.started, "start the first engine")
+
+	second, secondWriter := newPcapManagerTestEngine(), &pcapManagerTestWriter{}
+	require.NoError(t, manager.Add("second", second, []PcapWriter{secondWriter}))
+	waitForPcapManager(t, second.started, "start the second engine")
+	assert.ErrorIs(t, manager.Add("second", newPcapManagerTestEngine(), nil), errPcapEngineExists)
+	assert.Len(t, manager.Control().Status(), 2)
+
+	require.NoError(t, manager.Remove("second"))
+	assert.Equal(t, 3*time.Second, waitForPcapManager(t, second.deadline, "stop the second engine"))
+	assert.True(t, secondWriter.closed.Load())
+	assert.Len(t, manager.Control().Status(), 1)
+	assert.ErrorIs(t, manager.Remove("second"), errPcapControlUnknownCapture)
+
+	// stopped engines keep their writers, and may be started again
+	require.NoError(t, manager.Stop("first"))
+	assert.Equal(t, 3*time.Second, waitForPcapManager(t, first.deadline, "stop the first engine"))
+	assert.False(t, firstWriter.closed.Load())
+	assert.ErrorIs(t, manager.Stop("first"), errPcapEngineStopped)
+	require.NoError(t, manager.Start("first"))
+	waitForPcapManager(t, first.started, "start the first engine again")
+	assert.ErrorIs(t, manager.Start("first"), errPcapEngineRunning)
+
+	cancel()
+	assert.NoError(t, waitForPcapManager(t, ran, "stop running"))
+	assert.Equal(t, 3*time.Second, waitForPcapManager(t, first.deadline, "stop all engines"))
+	assert.True(t, firstWriter.closed.Load())
+
+	assert.ErrorIs(t, manager.Run(context.Background()), errPcapManagerRunning)
+	assert.ErrorIs(t, manager.Start("first"), errPcapManagerNotRunning)
+}
+
+// TestPcapManagerErrors verifies that the errors of engines which failed are returned by `Run`, along with their names.
+func TestPcapManagerErrors(t *testing.T) {
+	t.Parallel()
+
+	manager := NewPcapManager(nil, 0)
+	assert.Equal(t, pcapDefaultStopDeadline, manager.drainDeadline)
+
+	failing := newPcapManagerTestEngine()
+	failing.err = errors.New("no such device")
+	require.NoError(t, manager.Add("failing", failing, nil))
+	stopped := newPcapManagerTestEngine()
+	require.NoError(t, manager.Add("stopped", stopped, nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ran := make(chan error, 1)
+	go func() { ran <- manager.Run(ctx) }()
+	waitForPcapManager(t, failing.started, "start the failing engine")
+	waitForPcapManager(t, stopped.started, "start the stopped engine")
+	cancel()
+
+	err := waitForPcapManager(t, ran, "stop running")
+	assert.ErrorIs(t, err, failing.err)
+	assert.EqualError(t, err, "failing: no such device")
+}
+
+// TestMergePcapStats verifies that counters are summed, and that destinations and protocols seen by many engines are merged.
+func TestMergePcapStats(t *testing.T) {
+	t.Parallel()
+
+	first := &PcapStats{
+		Packets: 10, Bytes: 1000, Dropped: 1,
+		Drops: map[string]uint64{"filtered": 2},
+		TCP:   PcapTCPConnections{Established: 1, Resets: 1},
+		TopDestinations: []PcapDestination{
+			{Address: "10.0.0.1", Packets: 6},
+			{Address: "10.0.0.2", Packets: 4},
+		},
+		Protocols: []PcapProtocol{
+			{Path: "eth:ip", Protocol: "ip", Depth: 1, Packets: 10, Bytes: 1000},
+			{Path: "eth:ip:tcp", Protocol: "tcp", Depth: 2, Packets: 10, Bytes: 1000},
+		},
+	}
+	second := &PcapStats{
+		Packets: 5, Bytes: 500, Errors: 1,
+		Drops: map[string]uint64{"filtered": 1, "queue_full": 3},
+		TCP:   PcapTCPConnections{HalfOpen: 2},
+		TopDestinations: []PcapDestination{
+			{Address: "10.0.0.2", Packets: 3},
+			{Address: "10.0.0.3", Packets: 2},
+		},
+		Protocols: []PcapProtocol{
+			{Path: "eth:ip", Protocol: "ip", Depth: 1, Packets: 5, Bytes: 500},
+			{Path: "eth:ip:udp", Protocol: "udp", Depth: 2, Packets: 5, Bytes: 500},
+		},
+	}
+
+	merged := mergePcapStats(first, nil, second)
+	assert.Equal(t, uint64(15), merged.Packets)
+	assert.Equal(t, uint64(1500), merged.Bytes)
+	assert.Equal(t, uint64(1), merged.Errors)
+	assert.Equal(t, uint64(1), merged.Dropped)
+	assert.Equal(t, map[string]uint64{"filtered": 3, "queue_full": 3}, merged.Drops)
+	assert.Equal(t, PcapTCPConnections{HalfOpen: 2, Established: 1, Resets: 1}, merged.TCP)
+	// engines report the same number of top destinations, so merged ones are truncated to it
+	assert.Equal(t, []PcapDestination{
+		{Address: "10.0.0.2", Packets: 7},
+		{Address: "10.0.0.1", Packets: 6},
+	}, merged.TopDestinations)
+	assert.Equal(t, []PcapProtocol{
+		{Path: "eth:ip", Protocol: "ip", Depth: 1, Packets: 15, Bytes: 1500},
+		{Path: "eth:ip:tcp", Protocol: "tcp", Depth: 2, Packets: 10, Bytes: 1000},
+		{Path: "eth:ip:udp", Protocol: "udp", Depth: 2, Packets: 5, Bytes: 500},
+	}, merged.Protocols)
+
+	// stats of engines are not modified
+	assert.Equal(t, uint64(10), first.Protocols[0].Packets)
+	assert.Equal(t, uint64(2), first.Drops["filtered"])
+
+	empty := mergePcapStats()
+	assert.Zero(t, empty.Packets)
+	assert.Empty(t, empty.TopDestinations)
+	assert.Nil(t, empty.Drops)
+}
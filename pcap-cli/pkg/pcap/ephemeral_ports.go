@@ -0,0 +1,113 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// `ParsePcapEphemeralPorts` reads the range of ephemeral ports from the host when given this value, or no value
+	PcapEphemeralPortsFromHost = "host"
+	// Linux applies this range to both IPv4 and IPv6 sockets
+	pcapHostEphemeralPortsFile = "/proc/sys/net/ipv4/ip_local_port_range"
+)
+
+// the range of the host does not change while capturing: it is only read once
+var readHostEphemeralPortsOnce = sync.OnceValues(func() (*PcapEphemeralPorts, error) {
+	rawRange, err := os.ReadFile(pcapHostEphemeralPortsFile)
+	if err != nil {
+		return nil, err
+	}
+	from, to, err := parseEphemeralPortRange(string(rawRange))
+	if err != nil {
+		return nil, err
+	}
+	return &PcapEphemeralPorts{Min: from, Max: to}, nil
+})
+
+// ReadHostEphemeralPorts returns the range of ephemeral ports configured by `net.ipv4.ip_local_port_range`.
+func ReadHostEphemeralPorts() (*PcapEphemeralPorts, error) {
+	ephemerals, err := readHostEphemeralPortsOnce()
+	if err != nil {
+		return nil, err
+	}
+	// callers own the returned range
+	hostEphemerals := *ephemerals
+	return &hostEphemerals, nil
+}
+
+// defaultEphemeralPorts returns the range of the host if available, or the range preferred by RFC 6056.
+func defaultEphemeralPorts() *PcapEphemeralPorts {
+	if ephemerals, err := ReadHostEphemeralPorts(); err == nil {
+		return ephemerals
+	}
+	return &PcapEphemeralPorts{Min: PCAP_MIN_EPHEMERAL_PORT, Max: PCAP_MAX_EPHEMERAL_PORT}
+}
+
+// parseEphemeralPortRange parses ranges formatted as `{min},{max}`, `{min}-{max}`,
+// or as they are written by `/proc/sys/net/ipv4/ip_local_port_range`: `{min}\t{max}`.
+func parseEphemeralPortRange(rawRange string) (uint16, uint16, error) {
+	portRange := strings.FieldsFunc(rawRange, func(r rune) bool {
+		return r == ',' || r == '-' || r == ' ' || r == '\t' || r == '\n'
+	})
+	if len(portRange) != 2 {
+		return 0, 0, fmt.Errorf("invalid ephemeral ports range '%s'", rawRange)
+	}
+
+	var values [2]uint16
+	for i, rawPort := range portRange {
+		port, err := strconv.ParseUint(rawPort, 10, 16)
+		// see: https://datatracker.ietf.org/doc/html/rfc6056#page-5
+		// a valid `ephemeral port` must be within RFC 6056 range: [1024/0x0400,65535/0xFFFF]
+		if err != nil || uint16(port) < pcap_min_ephemeral_port {
+			return 0, 0, fmt.Errorf("invalid ephemeral port '%s' in range '%s'", rawPort, rawRange)
+		}
+		values[i] = uint16(port)
+	}
+
+	if values[0] >= values[1] {
+		return 0, 0, fmt.Errorf("invalid ephemeral ports range '%s': %d is not lower than %d", rawRange, values[0], values[1])
+	}
+	return values[0], values[1], nil
+}
+
+// ParsePcapEphemeralPorts parses the ranges of ephemeral ports used by IPv4 and IPv6 sockets, i/e: `32768,60999`;
+// if `ephemerals` is empty or `host`, the range of the host is used; if `ephemerals6` is empty, `ephemerals` applies to both families.
+func ParsePcapEphemeralPorts(ephemerals, ephemerals6 string) (*PcapEphemeralPorts, error) {
+	var ephemeralPorts *PcapEphemeralPorts
+
+	if ephemerals = strings.TrimSpace(ephemerals); ephemerals == "" || ephemerals == PcapEphemeralPortsFromHost {
+		ephemeralPorts = defaultEphemeralPorts()
+	} else if from, to, err := parseEphemeralPortRange(ephemerals); err == nil {
+		ephemeralPorts = &PcapEphemeralPorts{Min: from, Max: to}
+	} else {
+		return nil, err
+	}
+
+	if ephemerals6 = strings.TrimSpace(ephemerals6); ephemerals6 != "" && ephemerals6 != PcapEphemeralPortsFromHost {
+		from, to, err := parseEphemeralPortRange(ephemerals6)
+		if err != nil {
+			return nil, err
+		}
+		ephemeralPorts.Min6, ephemeralPorts.Max6 = from, to
+	}
+
+	return ephemeralPorts, nil
+}
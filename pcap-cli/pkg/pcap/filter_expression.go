@@ -0,0 +1,522 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type (
+	// pcapFilterExpression is the result of parsing a filter expression:
+	// it is compiled into both a BPF expression and `PcapFilters`, so that the kernel and userspace agree.
+	pcapFilterExpression struct {
+		// BPF terms in the same order as they were written
+		terms []string
+
+		macs, deniedMACs   []string
+		vlans, deniedVLANs []uint16
+
+		l3Protos []L3Proto
+		l4Protos []L4Proto
+
+		networks4, networks6             []string
+		deniedNetworks4, deniedNetworks6 []string
+
+		ports, deniedPorts []uint16
+
+		tcpFlags []TCPFlag
+	}
+
+	pcapFilterExpressionParser struct {
+		expression string
+		tokens     []bpfToken
+		position   int
+		// kinds of allow-list terms already seen; i/e: `port`
+		seen   map[string]struct{}
+		parsed *pcapFilterExpression
+	}
+)
+
+var (
+	errFilterExpressionEnd = errors.New("unexpected end of expression")
+
+	filterExpressionL3Protos = map[string]L3Proto{
+		"ip":  L3_PROTO_IPv4,
+		"ip6": L3_PROTO_IPv6,
+	}
+
+	filterExpressionL4Protos = map[string]L4Proto{
+		"tcp":   L4_PROTO_TCP,
+		"udp":   L4_PROTO_UDP,
+		"icmp":  L4_PROTO_ICMP,
+		"icmp6": L4_PROTO_ICMP6,
+		"sctp":  L4_PROTO_SCTP,
+	}
+)
+
+// tokenizeFilterExpression splits on spaces; parenthesis and commas are tokens on their own.
+func tokenizeFilterExpression(expression string) []bpfToken {
+	tokens := []bpfToken{}
+	start := -1
+	flush := func(end int) {
+		if start >= 0 {
+			tokens = append(tokens, bpfToken{expression[start:end], start})
+			start = -1
+		}
+	}
+	for i, r := range expression {
+		switch {
+		case unicode.IsSpace(r):
+			flush(i)
+		case r == '(' || r == ')' || r == ',':
+			flush(i)
+			tokens = append(tokens, bpfToken{string(r), i})
+		case start < 0:
+			start = i
+		}
+	}
+	flush(len(expression))
+	return tokens
+}
+
+func (p *pcapFilterExpressionParser) errorAt(token *bpfToken, format string, args ...any) error {
+	err := &PcapFilterError{Filter: p.expression, Offset: -1, Err: fmt.Errorf(format, args...)}
+	if token != nil {
+		err.Token, err.Offset = token.text, token.offset
+	}
+	return err
+}
+
+func (p *pcapFilterExpressionParser) peek() *bpfToken {
+	if p.position >= len(p.tokens) {
+		return nil
+	}
+	return &p.tokens[p.position]
+}
+
+func (p *pcapFilterExpressionParser) next() (*bpfToken, error) {
+	token := p.peek()
+	if token == nil {
+		return nil, p.errorAt(nil, "%w", errFilterExpressionEnd)
+	}
+	p.position++
+	return token, nil
+}
+
+func (p *pcapFilterExpressionParser) accept(keyword string) bool {
+	if token := p.peek(); token != nil && strings.EqualFold(token.text, keyword) {
+		p.position++
+		return true
+	}
+	return false
+}
+
+// list parses either a single value, or a comma separated list of values optionally enclosed in parenthesis;
+// i/e: `443`, `443,8443` or `(443, 8443)`.
+func (p *pcapFilterExpressionParser) list() ([]bpfToken, error) {
+	enclosed := p.accept("(")
+	values := []bpfToken{}
+	for {
+		value, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		if value.text == "(" || value.text == ")" || value.text == "," {
+			return nil, p.errorAt(value, "expected a value")
+		}
+		values = append(values, *value)
+		if !p.accept(",") {
+			break
+		}
+	}
+	if enclosed {
+		token, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		if token.text != ")" {
+			return nil, p.errorAt(token, "expected ')'")
+		}
+	}
+	return values, nil
+}
+
+// once rejects repeating allow-list terms: `PcapFilters` merges values of the same kind as alternatives,
+// while repeating a term in BPF requires all of them to match; so lists must be used instead.
+// Errors name the `keyword` as it was written, as many keywords share the same `kind`; i/e: `host` and `net`.
+func (p *pcapFilterExpressionParser) once(kind, keyword string, token *bpfToken) error {
+	if _, ok := p.seen[kind]; ok {
+		return p.errorAt(token, "'%s' is repeated; use a list instead: %s (a,b)", keyword, keyword)
+	}
+	p.seen[kind] = struct{}{}
+	return nil
+}
+
+func (p *pcapFilterExpressionParser) networks(values []bpfToken) (networks4, networks6 []string, err error) {
+	for _, value := range values {
+		var prefix netip.Prefix
+		if strings.Contains(value.text, "/") {
+			prefix, err = netip.ParsePrefix(value.text)
+		} else {
+			var addr netip.Addr
+			if addr, err = netip.ParseAddr(value.text); err == nil {
+				prefix = netip.PrefixFrom(addr, addr.BitLen())
+			}
+		}
+		if err != nil {
+			return nil, nil, p.errorAt(&value, "invalid host or network: %w", err)
+		}
+		// BPF rejects networks with host bits set; i/e: `net 10.0.0.1/8`
+		prefix = prefix.Masked()
+		if prefix.Addr().Is4() {
+			networks4 = append(networks4, prefix.String())
+		} else {
+			networks6 = append(networks6, prefix.String())
+		}
+	}
+	return networks4, networks6, nil
+}
+
+func (p *pcapFilterExpressionParser) ports(values []bpfToken) ([]uint16, error) {
+	ports := make([]uint16, len(values))
+	for i, value := range values {
+		port, err := strconv.ParseUint(value.text, 10, 16)
+		if err != nil || port == 0 {
+			return nil, p.errorAt(&value, "invalid port")
+		}
+		ports[i] = uint16(port)
+	}
+	return ports, nil
+}
+
+func (p *pcapFilterExpressionParser) macs(values []bpfToken) ([]string, error) {
+	macs := make([]string, len(values))
+	for i, value := range values {
+		mac, err := net.ParseMAC(value.text)
+		if err != nil || len(mac) != 6 {
+			return nil, p.errorAt(&value, "invalid MAC")
+		}
+		macs[i] = mac.String()
+	}
+	return macs, nil
+}
+
+func (p *pcapFilterExpressionParser) vlans(values []bpfToken) ([]uint16, error) {
+	vlans := make([]uint16, len(values))
+	for i, value := range values {
+		vlan, err := strconv.ParseUint(value.text, 10, 12)
+		if err != nil || vlan == 0x0FFF {
+			return nil, p.errorAt(&value, "invalid VLAN ID")
+		}
+		vlans[i] = uint16(vlan)
+	}
+	return vlans, nil
+}
+
+func (p *pcapFilterExpressionParser) term() error {
+	negated := p.accept("not") || p.accept("!")
+
+	keyword, err := p.next()
+	if err != nil {
+		return err
+	}
+	kind := strings.ToLower(keyword.text)
+
+	switch kind {
+	case "mac":
+		values, err := p.list()
+		if err != nil {
+			return err
+		}
+		macs, err := p.macs(values)
+		if err != nil {
+			return err
+		}
+		if negated {
+			p.parsed.deniedMACs = append(p.parsed.deniedMACs, macs...)
+			p.parsed.terms = append(p.parsed.terms, "not "+bpfAnyOf("ether host", macs))
+			return nil
+		}
+		if err := p.once(kind, kind, keyword); err != nil {
+			return err
+		}
+		p.parsed.macs = macs
+		p.parsed.terms = append(p.parsed.terms, bpfAnyOf("ether host", macs))
+
+	case "vlan":
+		values, err := p.list()
+		if err != nil {
+			return err
+		}
+		vlans, err := p.vlans(values)
+		if err != nil {
+			return err
+		}
+		// `vlan` shifts the offsets of all other terms, so it is not added as a term; see `withVLANs`
+		if negated {
+			p.parsed.deniedVLANs = append(p.parsed.deniedVLANs, vlans...)
+			return nil
+		}
+		if err := p.once(kind, kind, keyword); err != nil {
+			return err
+		}
+		p.parsed.vlans = vlans
+
+	case "host", "net":
+		values, err := p.list()
+		if err != nil {
+			return err
+		}
+		networks4, networks6, err := p.networks(values)
+		if err != nil {
+			return err
+		}
+		if negated {
+			p.parsed.deniedNetworks4 = append(p.parsed.deniedNetworks4, networks4...)
+			p.parsed.deniedNetworks6 = append(p.parsed.deniedNetworks6, networks6...)
+			p.parsed.terms = append(p.parsed.terms, "not "+bpfAnyOf("net", append(networks4, networks6...)))
+			return nil
+		}
+		if err := p.once("net", kind, keyword); err != nil {
+			return err
+		}
+		p.parsed.networks4, p.parsed.networks6 = networks4, networks6
+		p.parsed.terms = append(p.parsed.terms, bpfBothEndsIn(networks4, networks6))
+
+	case "port":
+		values, err := p.list()
+		if err != nil {
+			return err
+		}
+		ports, err := p.ports(values)
+		if err != nil {
+			return err
+		}
+		names := make([]string, len(ports))
+		for i, port := range ports {
+			names[i] = strconv.FormatUint(uint64(port), 10)
+		}
+		if negated {
+			p.parsed.deniedPorts = append(p.parsed.deniedPorts, ports...)
+			p.parsed.terms = append(p.parsed.terms, "not "+bpfAnyOf("port", names))
+			return nil
+		}
+		if err := p.once(kind, kind, keyword); err != nil {
+			return err
+		}
+		p.parsed.ports = ports
+		p.parsed.terms = append(p.parsed.terms, bpfAnyOf("port", names))
+
+	case "tcp.flags":
+		if negated {
+			return p.errorAt(keyword, "'%s' cannot be negated", kind)
+		}
+		if !p.accept("has") {
+			return p.errorAt(p.peek(), "expected 'has'")
+		}
+		values, err := p.list()
+		if err != nil {
+			return err
+		}
+		if err := p.once(kind, "tcp.flags has", keyword); err != nil {
+			return err
+		}
+		p.parsed.tcpFlags = make([]TCPFlag, len(values))
+		for i, value := range values {
+			flag := TCPFlag(strings.ToUpper(value.text))
+			if flag.ToUint8() == 0 {
+				return p.errorAt(&value, "invalid TCP flag")
+			}
+			p.parsed.tcpFlags[i] = flag
+		}
+		p.parsed.terms = append(p.parsed.terms, bpfTCPFlags(p.parsed.tcpFlags))
+
+	case "proto":
+		if negated {
+			return p.errorAt(keyword, "protocols cannot be negated")
+		}
+		values, err := p.list()
+		if err != nil {
+			return err
+		}
+		return p.protos(values)
+
+	default:
+		if negated {
+			return p.errorAt(keyword, "protocols cannot be negated")
+		}
+		// protocols may also be used on their own; i/e: `tcp` is the same as `proto tcp`
+		return p.protos([]bpfToken{*keyword})
+	}
+
+	return nil
+}
+
+// protos accepts a list of either L3 or L4 protocols; mixing both is ambiguous, so it must be written as 2 terms.
+func (p *pcapFilterExpressionParser) protos(values []bpfToken) error {
+	names := make([]string, len(values))
+	l3Protos := []L3Proto{}
+	l4Protos := []L4Proto{}
+	for i, value := range values {
+		names[i] = strings.ToLower(value.text)
+		if proto, ok := filterExpressionL3Protos[names[i]]; ok {
+			l3Protos = append(l3Protos, proto)
+		} else if proto, ok := filterExpressionL4Protos[names[i]]; ok {
+			l4Protos = append(l4Protos, proto)
+		} else {
+			return p.errorAt(&value, "unknown keyword or protocol")
+		}
+		if len(l3Protos) > 0 && len(l4Protos) > 0 {
+			return p.errorAt(&value, "L3 and L4 protocols must not be mixed in the same list")
+		}
+	}
+
+	if len(l3Protos) > 0 {
+		if err := p.once("l3 proto", "proto", &values[0]); err != nil {
+			return err
+		}
+		p.parsed.l3Protos = l3Protos
+	} else {
+		if err := p.once("l4 proto", "proto", &values[0]); err != nil {
+			return err
+		}
+		p.parsed.l4Protos = l4Protos
+	}
+	p.parsed.terms = append(p.parsed.terms, bpfAnyOf("", names))
+	return nil
+}
+
+func (p *pcapFilterExpressionParser) parse() (*pcapFilterExpression, error) {
+	if len(p.tokens) == 0 {
+		return nil, p.errorAt(nil, "empty expression")
+	}
+	for {
+		if err := p.term(); err != nil {
+			return nil, err
+		}
+		token := p.peek()
+		if token == nil {
+			return p.parsed, nil
+		}
+		switch strings.ToLower(token.text) {
+		case "and", "&&":
+			p.position++
+		case "or", "||":
+			// userspace filters are conjunctions of allow-lists; so alternatives are only supported within lists
+			return nil, p.errorAt(token, "'or' is not supported; use a list instead: port (a,b)")
+		default:
+			return nil, p.errorAt(token, "expected 'and'")
+		}
+	}
+}
+
+// bpfAnyOf renders `(qualifier a or qualifier b)`; the parenthesis are omitted for a single value.
+func bpfAnyOf(qualifier string, values []string) string {
+	terms := make([]string, len(values))
+	for i, value := range values {
+		terms[i] = strings.TrimSpace(qualifier + " " + value)
+	}
+	if len(terms) == 1 {
+		return terms[0]
+	}
+	return "(" + strings.Join(terms, " or ") + ")"
+}
+
+// bpfBothEndsIn mirrors how `PcapFilters` enforces networks: both source and destination must be allowed.
+func bpfBothEndsIn(networks4, networks6 []string) string {
+	families := []string{}
+	for _, networks := range [][]string{networks4, networks6} {
+		if len(networks) > 0 {
+			families = append(families,
+				fmt.Sprintf("(%s and %s)", bpfAnyOf("src net", networks), bpfAnyOf("dst net", networks)))
+		}
+	}
+	if len(families) == 1 {
+		return families[0]
+	}
+	return "(" + strings.Join(families, " or ") + ")"
+}
+
+// bpfTCPFlags matches segments with any of `flags` set; `tcp[tcpflags]` does not work for IPv6,
+// so the flags are read using the offset from the IPv6 header assuming there are no extension headers.
+func bpfTCPFlags(flags []TCPFlag) string {
+	names := make([]string, len(flags))
+	var mask uint8
+	for i, flag := range flags {
+		names[i] = "tcp-" + strings.ToLower(string(flag))
+		mask |= flag.ToUint8()
+	}
+	return fmt.Sprintf("(tcp[tcpflags]&(%s)!=0 or (ip6 and tcp and ip6[13+40]&0x%x!=0))",
+		strings.Join(names, "|"), mask)
+}
+
+func (e *pcapFilterExpression) applyTo(filters PcapFilters) {
+	filters.AddMACs(e.macs...)
+	filters.DenyMACs(e.deniedMACs...)
+	filters.AddVLANs(e.vlans...)
+	filters.DenyVLANs(e.deniedVLANs...)
+	filters.AddL3Protos(e.l3Protos...)
+	filters.AddL4Protos(e.l4Protos...)
+	filters.AddIPv4Ranges(e.networks4...)
+	filters.AddIPv6Ranges(e.networks6...)
+	filters.DenyIPv4Ranges(e.deniedNetworks4...)
+	filters.DenyIPv6Ranges(e.deniedNetworks6...)
+	filters.AddPorts(e.ports...)
+	filters.DenyPorts(e.deniedPorts...)
+	filters.AddTCPFlags(e.tcpFlags...)
+}
+
+// CompilePcapFilterExpression compiles a filter expression into a BPF expression, and applies it to `filters`;
+// i/e: `host 10.0.0.0/8 and port (443,8443) and tcp.flags has SYN`:
+//   - terms are joined with `and`; alternatives are written as lists: `port (443,8443)`,
+//   - `host` and `net` allow packets whose source and destination are both within the given networks,
+//   - `not host`, `not net` and `not port` deny packets with either end matching,
+//   - `tcp.flags has (SYN,RST)` allows TCP segments with any of the given flags,
+//   - `mac` and `vlan` allow frames with either MAC, or any 802.1Q tag, within the given ones; `not` denies them,
+//   - `proto (tcp,udp)`, or simply `tcp`, allows the given L3 or L4 protocols.
+//
+// The BPF expression is never broader than `filters`, so packets allowed by the kernel are evaluated the same way in userspace;
+// except for lists of VLAN IDs, which the kernel cannot match exactly: see `withVLANs`.
+// `filters` is only updated if the whole expression is valid; errors are `*PcapFilterError`s.
+func CompilePcapFilterExpression(expression string, filters PcapFilters) (string, error) {
+	parsed, err := compilePcapFilterExpression(expression, filters)
+	if err != nil {
+		return "", err
+	}
+	return withVLANs(strings.Join(parsed.terms, " and "), parsed.vlans, parsed.deniedVLANs), nil
+}
+
+func compilePcapFilterExpression(expression string, filters PcapFilters) (*pcapFilterExpression, error) {
+	parser := &pcapFilterExpressionParser{
+		expression: expression,
+		tokens:     tokenizeFilterExpression(expression),
+		seen:       make(map[string]struct{}),
+		parsed:     &pcapFilterExpression{},
+	}
+	parsed, err := parser.parse()
+	if err != nil {
+		return nil, err
+	}
+	if filters != nil {
+		parsed.applyTo(filters)
+	}
+	return parsed, nil
+}
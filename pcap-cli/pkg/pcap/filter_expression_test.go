@@ -0,0 +1,207 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// emptyPcapFiltersView is the view of filters which allow everything; cases only describe what they change.
+func emptyPcapFiltersView() *PcapFiltersView {
+	return NewPcapFilters().View()
+}
+
+// TestCompilePcapFilterExpression verifies that the rendered BPF expression and `PcapFilters` describe the same packets.
+func TestCompilePcapFilterExpression(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		expression string
+		// terms joined by `and`, which match both untagged and tagged frames unless `vlan` is set; see `withVLANs`
+		bpf  string
+		vlan bool
+		view func(*PcapFiltersView)
+	}{
+		{
+			name:       "host",
+			expression: "host 10.0.0.1",
+			bpf:        "(src net 10.0.0.1/32 and dst net 10.0.0.1/32)",
+			view:       func(v *PcapFiltersView) { v.IPv4 = []string{"10.0.0.1/32"} },
+		},
+		{
+			name:       "host_list",
+			expression: "HOST (10.0.0.0/8, 2001:db8::/32)",
+			bpf:        "((src net 10.0.0.0/8 and dst net 10.0.0.0/8) or (src net 2001:db8::/32 and dst net 2001:db8::/32))",
+			view: func(v *PcapFiltersView) {
+				v.IPv4 = []string{"10.0.0.0/8"}
+				v.IPv6 = []string{"2001:db8::/32"}
+			},
+		},
+		{
+			name:       "net_and_not_host",
+			expression: "net 10.0.0.1/8 and not host 2001:db8::1",
+			bpf:        "(src net 10.0.0.0/8 and dst net 10.0.0.0/8) and not net 2001:db8::1/128",
+			view: func(v *PcapFiltersView) {
+				v.IPv4 = []string{"10.0.0.0/8"}
+				v.DeniedIPv6 = []string{"2001:db8::1/128"}
+			},
+		},
+		{
+			name:       "not_host_list",
+			expression: "! host (10.0.0.1,10.0.0.2)",
+			bpf:        "not (net 10.0.0.1/32 or net 10.0.0.2/32)",
+			view:       func(v *PcapFiltersView) { v.DeniedIPv4 = []string{"10.0.0.1/32", "10.0.0.2/32"} },
+		},
+		{
+			name:       "ports",
+			expression: "port (443, 8443) && not port 22",
+			bpf:        "(port 443 or port 8443) and not port 22",
+			view: func(v *PcapFiltersView) {
+				v.Ports = []uint16{443, 8443}
+				v.DeniedPorts = []uint16{22}
+			},
+		},
+		{
+			name:       "tcp_flags",
+			expression: "tcp.flags has (SYN,rst)",
+			bpf:        "(tcp[tcpflags]&(tcp-syn|tcp-rst)!=0 or (ip6 and tcp and ip6[13+40]&0x6!=0))",
+			view:       func(v *PcapFiltersView) { v.TCPFlags = []string{"RST", "SYN"} },
+		},
+		{
+			name:       "macs",
+			expression: "mac 00:11:22:33:44:55 and not mac (aa:bb:cc:dd:ee:ff,AA-BB-CC-DD-EE-00)",
+			bpf:        "ether host 00:11:22:33:44:55 and not (ether host aa:bb:cc:dd:ee:ff or ether host aa:bb:cc:dd:ee:00)",
+			view: func(v *PcapFiltersView) {
+				v.MACs = []string{"00:11:22:33:44:55"}
+				v.DeniedMACs = []string{"aa:bb:cc:dd:ee:00", "aa:bb:cc:dd:ee:ff"}
+			},
+		},
+		{
+			name:       "vlan",
+			expression: "vlan 100 and tcp",
+			bpf:        "vlan 100 and (tcp)",
+			vlan:       true,
+			view: func(v *PcapFiltersView) {
+				v.VLANs = []uint16{100}
+				v.L4Protos = []uint8{uint8(L4_PROTO_TCP)}
+			},
+		},
+		{
+			name:       "vlan_list",
+			expression: "vlan (1,2)",
+			bpf:        "vlan",
+			vlan:       true,
+			view:       func(v *PcapFiltersView) { v.VLANs = []uint16{1, 2} },
+		},
+		{
+			name:       "not_vlan",
+			expression: "not vlan 7 and udp",
+			bpf:        "(udp) or (not vlan 7 and (udp))",
+			vlan:       true,
+			view: func(v *PcapFiltersView) {
+				v.DeniedVLANs = []uint16{7}
+				v.L4Protos = []uint8{uint8(L4_PROTO_UDP)}
+			},
+		},
+		{
+			name:       "protos",
+			expression: "proto (ip, ip6) and proto (tcp,udp)",
+			bpf:        "(ip or ip6) and (tcp or udp)",
+			view: func(v *PcapFiltersView) {
+				v.L3Protos = []uint8{uint8(L3_PROTO_IPv4), uint8(L3_PROTO_IPv6)}
+				v.L4Protos = []uint8{uint8(L4_PROTO_TCP), uint8(L4_PROTO_UDP)}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			filters := NewPcapFilters()
+			bpf, err := CompilePcapFilterExpression(tt.expression, filters)
+			require.NoError(t, err)
+			if tt.vlan {
+				assert.Equal(t, tt.bpf, bpf)
+			} else {
+				assert.Equal(t, "("+tt.bpf+") or (vlan and ("+tt.bpf+"))", bpf)
+			}
+
+			view := emptyPcapFiltersView()
+			tt.view(view)
+			assert.Equal(t, view, filters.View())
+		})
+	}
+}
+
+// TestCompilePcapFilterExpressionErrors verifies that errors point at the token which made the expression invalid,
+// and that filters are not updated by invalid expressions.
+func TestCompilePcapFilterExpressionErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		expression string
+		token      string
+		offset     int
+		err        string
+	}{
+		{"empty", "  ", "", -1, "empty expression"},
+		{"end", "port (443", "", -1, errFilterExpressionEnd.Error()},
+		{"host_repeated", "host 10.0.0.1 and host 10.0.0.2", "host", 18, "'host' is repeated; use a list instead: host (a,b)"},
+		{"net_after_host", "host 10.0.0.1 and net 10.0.0.0/8", "net", 18, "'net' is repeated; use a list instead: net (a,b)"},
+		{"port_repeated", "port 80 and port 443", "port", 12, "'port' is repeated; use a list instead: port (a,b)"},
+		{"flags_repeated", "tcp.flags has SYN and tcp.flags has ACK", "tcp.flags", 22, "'tcp.flags has' is repeated; use a list instead: tcp.flags has (a,b)"},
+		{"proto_repeated", "tcp and udp", "udp", 8, "'proto' is repeated; use a list instead: proto (a,b)"},
+		{"or", "port 443 or port 80", "or", 9, "'or' is not supported; use a list instead: port (a,b)"},
+		{"missing_and", "tcp udp", "udp", 4, "expected 'and'"},
+		{"invalid_host", "host 10.0.0.256", "10.0.0.256", 5, "invalid host or network"},
+		{"invalid_port", "port (443, 0)", "0", 11, "invalid port"},
+		{"invalid_mac", "mac zz", "zz", 4, "invalid MAC"},
+		{"invalid_vlan", "vlan 4095", "4095", 5, "invalid VLAN ID"},
+		{"invalid_flag", "tcp.flags has (SYN, NOPE)", "NOPE", 20, "invalid TCP flag"},
+		{"missing_has", "tcp.flags SYN", "SYN", 10, "expected 'has'"},
+		{"negated_flags", "not tcp.flags has SYN", "tcp.flags", 4, "'tcp.flags' cannot be negated"},
+		{"negated_proto", "not tcp", "tcp", 4, "protocols cannot be negated"},
+		{"mixed_protos", "proto (ip, tcp)", "tcp", 11, "L3 and L4 protocols must not be mixed in the same list"},
+		{"unknown", "port 443 and sometimes", "sometimes", 13, "unknown keyword or protocol"},
+		{"unclosed_list", "port (443 8443)", "8443", 10, "expected ')'"},
+		{"empty_list", "port ()", ")", 6, "expected a value"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			filters := NewPcapFilters()
+			bpf, err := CompilePcapFilterExpression(tt.expression, filters)
+			assert.Empty(t, bpf)
+
+			var filterErr *PcapFilterError
+			require.True(t, errors.As(err, &filterErr))
+			assert.Equal(t, tt.expression, filterErr.Filter)
+			assert.Equal(t, tt.token, filterErr.Token)
+			assert.Equal(t, tt.offset, filterErr.Offset)
+			assert.ErrorContains(t, filterErr.Err, tt.err)
+
+			assert.Equal(t, emptyPcapFiltersView(), filters.View())
+		})
+	}
+}
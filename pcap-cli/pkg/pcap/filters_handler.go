@@ -0,0 +1,218 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/pcap-sidecar/pcap-cli/internal/transformer"
+)
+
+type (
+	// PcapFiltersView describes the filters being enforced; see `PcapFilters.View()`
+	PcapFiltersView = transformer.PcapFiltersView
+
+	PcapFilterSocket struct {
+		Local  string `json:"local" yaml:"local"`
+		Remote string `json:"remote" yaml:"remote"`
+	}
+
+	// PcapFiltersUpdate is the body of requests sent to `PcapFiltersAddPath` and `PcapFiltersRemovePath`:
+	//   - `ipv4` and `ipv6` accept both addresses and networks; i/e: `10.0.0.1` or `10.0.0.0/8`,
+	//   - `macs` only accept EUI-48 addresses, and `vlans` are matched against all the tags of a frame,
+	//   - `hosts` are resolved by the DNS responses being captured; i/e: `api.example.com` or `*.example.com`,
+	//   - adding `denied_*` denies them, while removing them allows them again; denied traffic is never translated.
+	PcapFiltersUpdate struct {
+		MACs          []string           `json:"macs,omitempty" yaml:"macs,omitempty"`
+		DeniedMACs    []string           `json:"denied_macs,omitempty" yaml:"denied_macs,omitempty"`
+		VLANs         []uint16           `json:"vlans,omitempty" yaml:"vlans,omitempty"`
+		DeniedVLANs   []uint16           `json:"denied_vlans,omitempty" yaml:"denied_vlans,omitempty"`
+		L3Protos      []uint8            `json:"l3_protos,omitempty" yaml:"l3_protos,omitempty"`
+		IPv4          []string           `json:"ipv4,omitempty" yaml:"ipv4,omitempty"`
+		IPv6          []string           `json:"ipv6,omitempty" yaml:"ipv6,omitempty"`
+		DeniedIPv4    []string           `json:"denied_ipv4,omitempty" yaml:"denied_ipv4,omitempty"`
+		DeniedIPv6    []string           `json:"denied_ipv6,omitempty" yaml:"denied_ipv6,omitempty"`
+		L4Protos      []uint8            `json:"l4_protos,omitempty" yaml:"l4_protos,omitempty"`
+		Ports         []uint16           `json:"ports,omitempty" yaml:"ports,omitempty"`
+		DeniedPorts   []uint16           `json:"denied_ports,omitempty" yaml:"denied_ports,omitempty"`
+		TCPFlags      []string           `json:"tcp_flags,omitempty" yaml:"tcp_flags,omitempty"`
+		DeniedSockets []PcapFilterSocket `json:"denied_sockets,omitempty" yaml:"denied_sockets,omitempty"`
+		Hosts         []string           `json:"hosts,omitempty" yaml:"hosts,omitempty"`
+		DeniedHosts   []string           `json:"denied_hosts,omitempty" yaml:"denied_hosts,omitempty"`
+	}
+)
+
+const (
+	PcapFiltersPath       = "/filters"
+	PcapFiltersAddPath    = "/filters/add"
+	PcapFiltersRemovePath = "/filters/remove"
+)
+
+func parseFilterNetworks(values []string, is6 bool) ([]string, error) {
+	networks := make([]string, 0, len(values))
+	for _, value := range values {
+		var prefix netip.Prefix
+		var err error
+		if strings.Contains(value, "/") {
+			prefix, err = netip.ParsePrefix(value)
+		} else {
+			var addr netip.Addr
+			if addr, err = netip.ParseAddr(value); err == nil {
+				prefix = netip.PrefixFrom(addr, addr.BitLen())
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if prefix.Addr().Is6() != is6 {
+			return nil, fmt.Errorf("wrong IP version: %s", value)
+		}
+		networks = append(networks, prefix.String())
+	}
+	return networks, nil
+}
+
+// apply validates the whole update before changing any filter.
+func (u *PcapFiltersUpdate) apply(filters PcapFilters, add bool) error {
+	for _, mac := range slices.Concat(u.MACs, u.DeniedMACs) {
+		if hwAddr, err := net.ParseMAC(mac); err != nil || len(hwAddr) != 6 {
+			return fmt.Errorf("invalid MAC: %s", mac)
+		}
+	}
+	for _, vlan := range slices.Concat(u.VLANs, u.DeniedVLANs) {
+		if vlan > 0x0FFE {
+			return fmt.Errorf("invalid VLAN ID: %d", vlan)
+		}
+	}
+	ipv4, err := parseFilterNetworks(u.IPv4, false /* is6 */)
+	if err != nil {
+		return fmt.Errorf("invalid ipv4: %w", err)
+	}
+	ipv6, err := parseFilterNetworks(u.IPv6, true /* is6 */)
+	if err != nil {
+		return fmt.Errorf("invalid ipv6: %w", err)
+	}
+	deniedIPv4, err := parseFilterNetworks(u.DeniedIPv4, false /* is6 */)
+	if err != nil {
+		return fmt.Errorf("invalid denied_ipv4: %w", err)
+	}
+	deniedIPv6, err := parseFilterNetworks(u.DeniedIPv6, true /* is6 */)
+	if err != nil {
+		return fmt.Errorf("invalid denied_ipv6: %w", err)
+	}
+
+	l3Protos := make([]L3Proto, len(u.L3Protos))
+	for i, proto := range u.L3Protos {
+		l3Protos[i] = L3Proto(proto)
+	}
+	l4Protos := make([]L4Proto, len(u.L4Protos))
+	for i, proto := range u.L4Protos {
+		l4Protos[i] = L4Proto(proto)
+	}
+	tcpFlags := make([]TCPFlag, len(u.TCPFlags))
+	for i, flag := range u.TCPFlags {
+		tcpFlags[i] = TCPFlag(strings.ToUpper(flag))
+		if tcpFlags[i].ToUint8() == 0 {
+			return fmt.Errorf("invalid TCP flag: %s", flag)
+		}
+	}
+	for _, socket := range u.DeniedSockets {
+		if _, err := netip.ParseAddrPort(socket.Local); err != nil {
+			return fmt.Errorf("invalid socket: %w", err)
+		}
+		if _, err := netip.ParseAddrPort(socket.Remote); err != nil {
+			return fmt.Errorf("invalid socket: %w", err)
+		}
+	}
+
+	if add {
+		filters.AddMACs(u.MACs...)
+		filters.DenyMACs(u.DeniedMACs...)
+		filters.AddVLANs(u.VLANs...)
+		filters.DenyVLANs(u.DeniedVLANs...)
+		filters.AddL3Protos(l3Protos...)
+		filters.AddIPv4Ranges(ipv4...)
+		filters.AddIPv6Ranges(ipv6...)
+		filters.DenyIPv4Ranges(deniedIPv4...)
+		filters.DenyIPv6Ranges(deniedIPv6...)
+		filters.AddL4Protos(l4Protos...)
+		filters.AddPorts(u.Ports...)
+		filters.DenyPorts(u.DeniedPorts...)
+		filters.AddTCPFlags(tcpFlags...)
+		filters.AddHosts(u.Hosts...)
+		filters.DenyHosts(u.DeniedHosts...)
+	} else {
+		filters.RemoveMACs(u.MACs...)
+		filters.AllowMACs(u.DeniedMACs...)
+		filters.RemoveVLANs(u.VLANs...)
+		filters.AllowVLANs(u.DeniedVLANs...)
+		filters.RemoveL3Protos(l3Protos...)
+		filters.RemoveIPv4Ranges(ipv4...)
+		filters.RemoveIPv6Ranges(ipv6...)
+		filters.AllowIPv4Ranges(deniedIPv4...)
+		filters.AllowIPv6Ranges(deniedIPv6...)
+		filters.RemoveL4Protos(l4Protos...)
+		filters.RemovePorts(u.Ports...)
+		filters.AllowPorts(u.DeniedPorts...)
+		filters.RemoveTCPFlags(tcpFlags...)
+		filters.RemoveHosts(u.Hosts...)
+		filters.RemoveDeniedHosts(u.DeniedHosts...)
+	}
+
+	for _, socket := range u.DeniedSockets {
+		if add {
+			filters.DenySocket(socket.Local, socket.Remote)
+		} else {
+			filters.AllowSocket(socket.Local, socket.Remote)
+		}
+	}
+	return nil
+}
+
+// NewPcapFiltersHandler allows to update `filters` while engines are running, without restarting them:
+//   - `GET /filters`: filters being enforced,
+//   - `POST /filters/add` and `POST /filters/remove`: apply a `PcapFiltersUpdate`, and render the resulting filters.
+//
+// Filters are enforced on packets already captured: they can only narrow what the BPF filter of engines allows.
+func NewPcapFiltersHandler(filters PcapFilters) http.Handler {
+	update := func(add bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			var u PcapFiltersUpdate
+			if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := u.apply(filters, add); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			writeDebugJSON(w, filters.View())
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+PcapFiltersPath, func(w http.ResponseWriter, _ *http.Request) {
+		writeDebugJSON(w, filters.View())
+	})
+	mux.HandleFunc("POST "+PcapFiltersAddPath, update(true /* add */))
+	mux.HandleFunc("POST "+PcapFiltersRemovePath, update(false /* add */))
+	return mux
+}
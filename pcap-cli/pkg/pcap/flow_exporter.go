@@ -0,0 +1,150 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/pcap-sidecar/pcap-cli/internal/transformer"
+)
+
+type (
+	PcapFlowExportVersion = transformer.FlowExportVersion
+
+	// PcapFlowExporter sends flow summaries to an IPFIX or NetFlow v9 collector over UDP:
+	//   - use `OnFlowSummary` as `PcapFlowEventHandlers.OnFlowSummary`,
+	//   - summaries are sent in batches, either when a batch is full or every `flowExportInterval`,
+	//   - a single exporter may be shared by all engines; `Close` sends pending summaries.
+	PcapFlowExporter struct {
+		collector string
+		logger    *log.Logger
+		conn      net.Conn
+		mu        *sync.Mutex
+		encoder   *transformer.FlowRecordEncoder
+		pending   []*PcapFlowSummaryEvent
+		done      chan struct{}
+	}
+)
+
+const (
+	PcapFlowExportIPFIX    = transformer.FlowExportIPFIX
+	PcapFlowExportNetFlow9 = transformer.FlowExportNetFlow9
+)
+
+const (
+	flowExportBatchSize = 64
+	flowExportInterval  = 5 * time.Second
+)
+
+func (x *PcapFlowExporter) OnFlowSummary(event *PcapFlowSummaryEvent) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.pending = append(x.pending, event)
+	if len(x.pending) >= flowExportBatchSize {
+		x.export()
+	}
+}
+
+// export must be called while holding `x.mu`; UDP writes do not block on collectors.
+func (x *PcapFlowExporter) export() error {
+	if len(x.pending) == 0 {
+		return nil
+	}
+	events := x.pending
+	x.pending = make([]*PcapFlowSummaryEvent, 0, flowExportBatchSize)
+
+	var errs error
+	for _, message := range x.encoder.Encode(events, time.Now()) {
+		if _, err := x.conn.Write(message); err != nil {
+			errs = errors.Join(errs, err)
+		}
+	}
+	if errs != nil {
+		x.logger.Printf("failed to export %d flows: %v\n", len(events), errs)
+	}
+	return errs
+}
+
+func (x *PcapFlowExporter) exportPeriodically() {
+	ticker := time.NewTicker(flowExportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-x.done:
+			return
+		case <-ticker.C:
+			x.mu.Lock()
+			x.export()
+			x.mu.Unlock()
+		}
+	}
+}
+
+// Exclusion is the BPF expression matching datagrams sent to the collector,
+// so that exporting flows does not produce more flows to be exported.
+func (x *PcapFlowExporter) Exclusion() string {
+	collector, ok := x.conn.RemoteAddr().(*net.UDPAddr)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("udp and dst host %s and dst port %d", collector.IP.String(), collector.Port)
+}
+
+func (x *PcapFlowExporter) Close() error {
+	close(x.done)
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	err := x.export()
+	return errors.Join(err, x.conn.Close())
+}
+
+// NewPcapFlowExporter connects to `collector` ( `host:port` ); `domain` is the observation domain ( IPFIX ) or source ID ( NetFlow v9 ).
+func NewPcapFlowExporter(collector string, version PcapFlowExportVersion, domain uint32) (*PcapFlowExporter, error) {
+	loggerPrefix := fmt.Sprintf("[pcap/exporter] - [%s] - ", version)
+	logger := log.New(os.Stderr, loggerPrefix, log.LstdFlags)
+
+	encoder, err := transformer.NewFlowRecordEncoder(version, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.Dial("udp", collector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid flow collector '%s': %w", collector, err)
+	}
+
+	x := &PcapFlowExporter{
+		collector: collector,
+		logger:    logger,
+		conn:      conn,
+		mu:        new(sync.Mutex),
+		encoder:   encoder,
+		pending:   make([]*PcapFlowSummaryEvent, 0, flowExportBatchSize),
+		done:      make(chan struct{}),
+	}
+
+	go x.exportPeriodically()
+
+	logger.Printf("- created: %s\n", collector)
+
+	return x, nil
+}
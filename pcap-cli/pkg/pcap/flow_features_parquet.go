@@ -0,0 +1,36 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build parquet
+
+package pcap
+
+import (
+	"errors"
+	"os"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+func writeFlowFeaturesParquet(output string, features []PcapFlowFeatures) error {
+	file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+
+	writer := parquet.NewGenericWriter[PcapFlowFeatures](file, parquet.Compression(&parquet.Zstd))
+	_, err = writer.Write(features)
+	// Parquet footer is written on `Close`
+	return errors.Join(err, writer.Close(), file.Close())
+}
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"os"
 	"strconv"
 	"strings"
@@ -37,6 +38,101 @@ func (p *Pcap) IsActive() bool {
 	return p.isActive.Load()
 }
 
+func (p *Pcap) IsReady() bool {
+	return p.isReady.Load()
+}
+
+func (p *Pcap) Stats() *PcapStats {
+	totals := p.summary.Totals()
+	return &PcapStats{
+		Packets:         totals.Packets,
+		Bytes:           totals.Bytes,
+		Errors:          totals.Errors,
+		Anomalies:       totals.Anomalies,
+		TopDestinations: totals.TopDestinations,
+		Protocols:       totals.Protocols,
+		Multicast:       p.multicast.Memberships(),
+		FilteredOut:     p.filteredOut.Load(),
+		PausedOut:       p.pausedOut.Load(),
+		Triggered:       p.triggered.Load(),
+		TriggeredOut:    p.triggeredOut.Load(),
+		Dropped:         p.dropped.Load(),
+		IfDropped:       p.ifDropped.Load(),
+		TCP:             totals.TCP,
+		Drops:           p.drops.Counts(),
+	}
+}
+
+// Traffic rolls the 1 second and 1 minute windows of packets read by the engine, whether they were translated or not.
+func (p *Pcap) Traffic() *PcapTrafficStats {
+	return p.traffic.Stats(time.Now())
+}
+
+// reportTraffic logs a `stats` document every `interval` until the capture is stopped.
+func (p *Pcap) reportTraffic(ctx context.Context, logger *slog.Logger, interval time.Duration) {
+	if logger == nil {
+		logger = NewPcapLogger(os.Stderr, slog.LevelInfo)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			logger.Info("stats", "stats", p.Traffic(), "drops", p.drops.Counts())
+		}
+	}
+}
+
+// CheckHealth reports if the capture loop, or the goroutines translating and writing packets, stopped making progress.
+func (p *Pcap) CheckHealth() *PcapHealthCheck {
+	check := &PcapHealthCheck{}
+	// the transformer is only available, and safe to be used, while the engine is ready
+	if !p.isActive.Load() || !p.isReady.Load() {
+		return check
+	}
+
+	if heartbeat := time.Unix(0, p.heartbeat.Load()); time.Since(heartbeat) > pcapHealthDeadline {
+		check.fail("capture loop is blocked since %s", heartbeat.Format(time.RFC3339))
+	}
+
+	health := p.fn.Health()
+	for _, writer := range health.Stopped {
+		check.fail("translations for writer %d are no longer consumed", writer)
+	}
+	if health.IsStalled(pcapHealthDeadline) {
+		check.fail("%d translations are pending, but none was written since %s", health.Pending, health.WrittenAt.Format(time.RFC3339))
+	}
+	if health.IsReaperStalled() {
+		check.fail("reaper of flow locks is blocked since %s", health.ReapedAt.Format(time.RFC3339))
+	}
+	for _, writer := range health.Saturated {
+		check.saturate("translations queue of writer %d is full: %d/%d", writer, health.Queued[writer], health.Capacity[writer])
+	}
+	return check
+}
+
+func (p *Pcap) Filter() string {
+	if filter := p.filter.Load(); filter != nil {
+		return *filter
+	}
+	return ""
+}
+
+// Pause keeps the handle open, so the kernel does not drop packets, but discards every packet read from it.
+func (p *Pcap) Pause() bool {
+	return p.isPaused.CompareAndSwap(false, true)
+}
+
+func (p *Pcap) Resume() bool {
+	return p.isPaused.CompareAndSwap(true, false)
+}
+
+func (p *Pcap) IsPaused() bool {
+	return p.isPaused.Load()
+}
+
 func (p *Pcap) newPcap(ctx context.Context) (*pcap.InactiveHandle, error) {
 	cfg := *p.config
 
@@ -107,6 +203,10 @@ func (p *Pcap) Start(
 	cfg := *p.config
 	debug := cfg.Debug
 	compat := cfg.Compat
+	// `PCAP_DEBUG` enables debug logging of all engines sharing the switch; only reloads disable it
+	if debugSwitch, ok := ctx.Value(PcapContextDebugSwitch).(*atomic.Bool); ok && debug {
+		debugSwitch.Store(true)
+	}
 
 	device := cfg.Device
 	var iface *transformer.PcapIface
@@ -132,14 +232,38 @@ func (p *Pcap) Start(
 
 	loggerPrefix := fmt.Sprintf("[%d/%s]", iface.Index, iface.Name)
 
+	// only available when the filter is too large for the kernel
+	var softwareFilter *pcap.BPF
+
 	if !compat {
 		// set packet capture filter; i/e: `tcp port 8080`
-		if filter := providePcapFilter(ctx, &cfg.Filter, cfg.Filters); *filter != "" {
-			if err = handle.SetBPFFilter(*filter); err != nil {
-				gopacketLogger.Printf("%s - BPF filter error: [%s] => %+v\n", loggerPrefix, *filter, err)
+		plan, err := planPcapFilter(ctx, &cfg.Filter, cfg.Filters, cfg.Exclude, cfg.CompatFilters, cfg.Profiles, handle.CompileBPFFilter)
+		if err != nil {
+			gopacketLogger.Printf("%s - BPF filter error: [%s] => %+v\n", loggerPrefix, plan.filter, err)
+			return err
+		}
+		if plan.software != "" {
+			if softwareFilter, err = pcap.NewBPF(handle.LinkType(), cfg.Snaplen, plan.software); err != nil {
+				gopacketLogger.Printf("%s - BPF filter error: [%s] => %+v\n", loggerPrefix, plan.software, err)
+				return fmt.Errorf("BPF filter error: %s", err)
+			}
+			gopacketLogger.Printf("%s - filter is too large for the kernel; enforcing in software: %s\n", loggerPrefix, plan.software)
+			if len(plan.degraded) > 0 {
+				gopacketLogger.Printf("%s - removed from the kernel filter: %s\n", loggerPrefix, describeFilterProviders(plan.degraded))
+			}
+		}
+		if plan.filter != "" {
+			if err = handle.SetBPFInstructionFilter(plan.instructions); err != nil {
+				gopacketLogger.Printf("%s - BPF filter error: [%s] => %+v\n", loggerPrefix, plan.filter, err)
 				return fmt.Errorf("BPF filter error: %s", err)
 			}
-			gopacketLogger.Printf("%s - filter: %s\n", loggerPrefix, *filter)
+			gopacketLogger.Printf("%s - filter: %s\n", loggerPrefix, plan.filter)
+		}
+		// the complete filter is the one being enforced, even if the kernel only enforces part of it
+		if plan.software != "" {
+			p.filter.Store(&plan.software)
+		} else {
+			p.filter.Store(&plan.filter)
 		}
 	}
 
@@ -149,7 +273,8 @@ func (p *Pcap) Start(
 	// https://github.com/google/gopacket/blob/master/packet.go#L660-L680
 	source.Lazy = true
 	// https://github.com/google/gopacket/blob/master/packet.go#L655-L659
-	source.NoCopy = true
+	//   - `pcapng` writes raw packets, so packets data must not be reused by the handle
+	source.NoCopy = cfg.Format != "pcapng"
 	source.SkipDecodeRecovery = false
 	source.DecodeStreamsAsDatagrams = true
 
@@ -160,6 +285,20 @@ func (p *Pcap) Start(
 	}
 
 	format := cfg.Format
+	if cfg.Template != "" {
+		tmpl, err := transformer.NewTranslationTemplate(cfg.Template)
+		if err != nil {
+			return err
+		}
+		ctx = context.WithValue(ctx, transformer.ContextTemplate, tmpl)
+	}
+	if cfg.Logger != nil {
+		ctx = context.WithValue(ctx, transformer.ContextLogger, cfg.Logger)
+	}
+	ctx = context.WithValue(ctx, transformer.ContextMulticastGroups, p.multicast)
+	ctx = context.WithValue(ctx, transformer.ContextCaptureSummary, p.summary)
+	ctx = context.WithValue(ctx, transformer.ContextDropCounters, p.drops)
+
 	compatFilters, ok := cfg.CompatFilters.(transformer.PcapFilters)
 	if !ok {
 		compatFilters = nil
@@ -175,12 +314,46 @@ func (p *Pcap) Start(
 	}
 
 	if err != nil {
-		return fmt.Errorf("invalid format: %s", err)
+		return fmt.Errorf("failed to create transformer: %w", err)
+	}
+
+	// i/e: `pcapng` files start with the blocks which describe interfaces
+	if header := p.fn.FileHeader(); header != nil {
+		for _, writer := range writers {
+			// only closed writers reject it, and they do not write translations either
+			if err := usePcapWriterHeader(writer, header); err != nil {
+				gopacketLogger.Printf("%s - failed to set header of writer: %v\n", loggerPrefix, err)
+			}
+		}
+	}
+
+	if cfg.Manifests {
+		source := &pcapManifestSource{engine: p, iface: iface.Name, format: format}
+		for _, writer := range writers {
+			usePcapWriterManifests(writer, source)
+		}
+	}
+
+	// packets arriving from now on will be translated; reading the 1st one blocks until it arrives
+	p.isReady.Store(true)
+	gopacketLogger.Printf("%s - packet capture is ready\n", loggerPrefix)
+
+	// packets accepted by the kernel filter may still be rejected by the complete filter
+	isFilteredOut := func(packet gopacket.Packet) bool {
+		if softwareFilter == nil || softwareFilter.Matches(packet.Metadata().CaptureInfo, packet.Data()) {
+			return false
+		}
+		p.filteredOut.Add(1)
+		p.drops.Add(transformer.DropFiltered)
+		return true
 	}
 
-	if firstPacket, err := source.NextPacket(); err == nil && firstPacket != nil {
+	if firstPacket, err := source.NextPacket(); err == nil && firstPacket != nil && !isFilteredOut(firstPacket) {
 		serial := uint64(0)
+		p.traffic.Observe(firstPacket)
+		p.summary.Observe(firstPacket)
 		if err = p.fn.Apply(ctx, &firstPacket, &serial); err != nil {
+			p.summary.ObserveError()
 			gopacketLogger.Printf("%s - #:0 | failed to translate 1st packet: %v\n", loggerPrefix, err)
 		}
 	} else {
@@ -191,8 +364,41 @@ func (p *Pcap) Start(
 
 	var packetsCounter atomic.Uint64
 	var ctxDoneTS time.Time
+
+	var recorder *pcapFlightRecorder
+	if cfg.Triggers != nil {
+		recorder = newPcapFlightRecorder(cfg.Triggers, p.triggered, p.triggeredOut, gopacketLogger, loggerPrefix)
+		gopacketLogger.Printf("%s - buffering packets until triggers fire\n", loggerPrefix)
+	}
+	translate := func(packet gopacket.Packet) {
+		serial := packetsCounter.Add(1)
+		p.summary.Observe(packet)
+		// non-blocking operation
+		if err = p.fn.Apply(ctx, &packet, &serial); err != nil && p.isActive.Load() {
+			p.summary.ObserveError()
+			gopacketLogger.Printf("%s - #:%d | failed to translate: %v\n", loggerPrefix, serial, err)
+		}
+	}
+
+	if cfg.StatsInterval > 0 {
+		go p.reportTraffic(ctx, cfg.Logger, cfg.StatsInterval)
+	}
+
+	// the capture loop proves it is not blocked even if no packets arrive; see `CheckHealth`
+	heartbeat := time.NewTicker(pcapHeartbeatInterval)
+	defer heartbeat.Stop()
+	p.heartbeat.Store(time.Now().UnixNano())
+
 	for p.isActive.Load() {
 		select {
+		case <-heartbeat.C:
+			p.heartbeat.Store(time.Now().UnixNano())
+			// the handle is only safe to be used by the capture loop: it is closed as soon as the loop ends
+			if stats, err := handle.Stats(); err == nil {
+				p.dropped.Store(uint64(stats.PacketsDropped))
+				p.ifDropped.Store(uint64(stats.PacketsIfDropped))
+			}
+
 		case <-ctx.Done():
 			if p.isActive.CompareAndSwap(true, false) {
 				ctxDoneTS = time.Now()
@@ -200,28 +406,58 @@ func (p *Pcap) Start(
 			}
 
 		case packet := <-source.Packets():
-			serial := packetsCounter.Add(1)
-			// non-blocking operation
-			if err = p.fn.Apply(ctx, &packet, &serial); err != nil && p.isActive.Load() {
-				gopacketLogger.Printf("%s - #:%d | failed to translate: %v\n", loggerPrefix, serial, err)
+			if isFilteredOut(packet) {
+				continue
+			}
+			// traffic is accounted for even if packets are not translated
+			p.traffic.Observe(packet)
+			if p.isPaused.Load() {
+				p.pausedOut.Add(1)
+				p.drops.Add(transformer.DropPaused)
+				continue
+			}
+			if recorder == nil {
+				translate(packet)
+				continue
+			}
+			for _, packet := range recorder.admit(packet) {
+				translate(packet)
 			}
 		}
 	}
 
-	gopacketLogger.Printf("%s - stopping packet capture\n", loggerPrefix)
+	if recorder != nil {
+		recorder.discard()
+	}
 
-	engineStopDeadline := <-stopDeadline
-	deadline := *engineStopDeadline - time.Since(ctxDoneTS)
+	p.isReady.Store(false)
+	p.filter.Store(nil)
+	// no more packets are read: those already applied are drained, and open flows are summarized
+	stopAt := awaitStopDeadline(stopDeadline, ctxDoneTS, cfg.DrainDeadline)
+	deadline := time.Until(stopAt)
+	gopacketLogger.Printf("%s - draining translations | deadline: %v\n", loggerPrefix, deadline)
 	p.fn.WaitDone(ctx, &deadline)
 
+	// all translations have been handed over to writers:
+	//   - persist whatever is still buffered before the process is terminated
+	flushDeadline := time.Until(stopAt)
+	if err := flushPcapWriters(writers, &flushDeadline); err != nil {
+		gopacketLogger.Printf("%s - failed to flush writers: %v\n", loggerPrefix, err)
+	}
+
 	gopacketLogger.Printf("%s – total packets: %d\n", loggerPrefix, packetsCounter.Load())
 
 	return ctx.Err()
 }
 
 func NewPcap(config *PcapConfig) (PcapEngine, error) {
-	var isActive atomic.Bool
+	if err := validatePcapFilter(config); err != nil {
+		return nil, err
+	}
+
+	var isActive, isReady atomic.Bool
 	isActive.Store(false)
+	isReady.Store(false)
 
 	debug := config.Debug
 	if debugEnvVar, err := strconv.ParseBool(os.Getenv("PCAP_DEBUG")); err == nil {
@@ -230,16 +466,40 @@ func NewPcap(config *PcapConfig) (PcapEngine, error) {
 
 	// `config.Ephemerals` is already a safe type,
 	// here the validation only enforces correctness of port range.
-	if config.Ephemerals == nil ||
-		config.Ephemerals.Min < pcap_min_ephemeral_port ||
+	if config.Ephemerals == nil {
+		config.Ephemerals = &PcapEphemeralPorts{}
+	}
+	if config.Ephemerals.Min < pcap_min_ephemeral_port ||
 		config.Ephemerals.Min >= config.Ephemerals.Max {
-		config.Ephemerals = &PcapEphemeralPorts{
-			Min: PCAP_MIN_EPHEMERAL_PORT,
-			Max: PCAP_MAX_EPHEMERAL_PORT,
-		}
+		// hosts may customize their range: assuming the default one misclassifies the direction of packets
+		defaults := defaultEphemeralPorts()
+		config.Ephemerals.Min = defaults.Min
+		config.Ephemerals.Max = defaults.Max
+	}
+	// an invalid IPv6 range is ignored: the IPv4 range applies to both families
+	if config.Ephemerals.Min6 < pcap_min_ephemeral_port ||
+		config.Ephemerals.Min6 >= config.Ephemerals.Max6 {
+		config.Ephemerals.Min6, config.Ephemerals.Max6 = 0, 0
 	}
 
-	pcap := Pcap{config: config, isActive: &isActive}
+	pcap := Pcap{
+		config:       config,
+		isActive:     &isActive,
+		isReady:      &isReady,
+		isPaused:     new(atomic.Bool),
+		filter:       new(atomic.Pointer[string]),
+		multicast:    transformer.NewMulticastGroups(),
+		summary:      transformer.NewCaptureSummary(),
+		traffic:      transformer.NewTrafficMeter(config.Iface),
+		drops:        transformer.NewDropCounters(),
+		filteredOut:  new(atomic.Uint64),
+		pausedOut:    new(atomic.Uint64),
+		triggered:    new(atomic.Uint64),
+		triggeredOut: new(atomic.Uint64),
+		heartbeat:    new(atomic.Int64),
+		dropped:      new(atomic.Uint64),
+		ifDropped:    new(atomic.Uint64),
+	}
 
 	if strings.EqualFold(config.Iface, anyDeviceName) {
 		config.Device = nil
@@ -0,0 +1,78 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+type (
+	// pcapJSONTranslation contains the subset of JSON translations fields that writers map into columns
+	pcapJSONTranslation struct {
+		Pcap struct {
+			Num uint64 `json:"num,string"`
+		} `json:"pcap"`
+		Meta struct {
+			Len       int64     `json:"len"`
+			Timestamp time.Time `json:"timestamp"`
+		} `json:"meta"`
+		Iface struct {
+			Index int32  `json:"index"`
+			Name  string `json:"name"`
+		} `json:"iface"`
+		L3 struct {
+			Src   string `json:"src"`
+			Dst   string `json:"dst"`
+			Proto struct {
+				Name string `json:"name"`
+			} `json:"proto"`
+		} `json:"L3"`
+		L4 struct {
+			Src   int32 `json:"src"`
+			Dst   int32 `json:"dst"`
+			Seq   int64 `json:"seq"`
+			Ack   int64 `json:"ack"`
+			Flags struct {
+				Str string `json:"str"`
+			} `json:"flags"`
+		} `json:"L4"`
+		HTTP struct {
+			Method string `json:"method"`
+			URL    string `json:"url"`
+			Code   int32  `json:"code"`
+		} `json:"HTTP"`
+		Flow    string `json:"flow"`
+		Message string `json:"message"`
+		Trace   string `json:"logging.googleapis.com/trace"`
+		Span    string `json:"logging.googleapis.com/spanId"`
+	}
+)
+
+const pcapJSONTraceIDSeparator = "/"
+
+func newPcapJSONTranslation(line []byte) (*pcapJSONTranslation, error) {
+	translation := &pcapJSONTranslation{}
+	if err := json.Unmarshal(line, translation); err != nil {
+		return nil, err
+	}
+	return translation, nil
+}
+
+// traceID returns the trace ID without the `projects/{project}/traces/` prefix used by Cloud Logging.
+func (t *pcapJSONTranslation) traceID() string {
+	return t.Trace[strings.LastIndex(t.Trace, pcapJSONTraceIDSeparator)+1:]
+}
@@ -0,0 +1,63 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var pcapJSONTranslationTestTimestamp = time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+
+// newPcapJSONTranslationTestLine returns a JSON translation, without its trailing new line, of the packet numbered `serial`.
+func newPcapJSONTranslationTestLine(serial uint64) string {
+	return fmt.Sprintf(`{"pcap":{"num":"%d"},"meta":{"len":74,"timestamp":"%s"},`+
+		`"iface":{"index":2,"name":"eth0"},"L3":{"src":"10.0.0.1","dst":"10.0.0.2","proto":{"name":"IPv4"}},`+
+		`"L4":{"src":40000,"dst":8080,"seq":1000,"ack":2000,"flags":{"str":"PA"}},`+
+		`"HTTP":{"method":"GET","url":"/health","code":200},"flow":"123","message":"request",`+
+		`"logging.googleapis.com/trace":"projects/project/traces/4bf92f3577b34da6a3ce929d0e0e4736",`+
+		`"logging.googleapis.com/spanId":"00f067aa0ba902b7"}`,
+		serial, pcapJSONTranslationTestTimestamp.Format(time.RFC3339Nano))
+}
+
+// TestPcapJSONTranslation verifies that the fields mapped into columns are decoded from JSON translations.
+func TestPcapJSONTranslation(t *testing.T) {
+	t.Parallel()
+
+	translation, err := newPcapJSONTranslation([]byte(newPcapJSONTranslationTestLine(7)))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(7), translation.Pcap.Num)
+	assert.True(t, pcapJSONTranslationTestTimestamp.Equal(translation.Meta.Timestamp))
+	assert.Equal(t, int64(74), translation.Meta.Len)
+	assert.Equal(t, "eth0", translation.Iface.Name)
+	assert.Equal(t, "IPv4", translation.L3.Proto.Name)
+	assert.Equal(t, int32(8080), translation.L4.Dst)
+	assert.Equal(t, "PA", translation.L4.Flags.Str)
+	assert.Equal(t, int32(200), translation.HTTP.Code)
+	// the prefix used by Cloud Logging is removed
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", translation.traceID())
+	assert.Equal(t, "00f067aa0ba902b7", translation.Span)
+
+	translation, err = newPcapJSONTranslation([]byte(`{"logging.googleapis.com/trace":"4bf92f3577b34da6a3ce929d0e0e4736"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", translation.traceID())
+
+	_, err = newPcapJSONTranslation([]byte(`{"pcap":{"num":7}}`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,203 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build otlp
+
+package pcap
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/GoogleCloudPlatform/pcap-sidecar/pcap-cli/internal/transformer"
+	colmetricsv1 "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracev1 "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonv1 "go.opentelemetry.io/proto/otlp/common/v1"
+	metricsv1 "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcev1 "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracev1 "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+)
+
+type (
+	// otlpTelemetrySink exports the stats of stages as a histogram, and every trace as a span per stage under a span per packet.
+	otlpTelemetrySink struct {
+		conn          *grpc.ClientConn
+		metricsClient colmetricsv1.MetricsServiceClient
+		traceClient   coltracev1.TraceServiceClient
+		resource      *resourcev1.Resource
+		scope         *commonv1.InstrumentationScope
+	}
+)
+
+const (
+	otlpPipelineMetricName = "pcap.pipeline.stage.duration"
+	otlpPipelineSpanName   = "pcap.packet"
+	// W3C `sampled` flag: all traced packets were sampled by `PcapPipelineTelemetry`
+	otlpPipelineTraceFlags = 0x01
+)
+
+func otlpPipelineAttribute(key, value string) *commonv1.KeyValue {
+	return &commonv1.KeyValue{Key: key, Value: &commonv1.AnyValue{Value: &commonv1.AnyValue_StringValue{StringValue: value}}}
+}
+
+func (s *otlpTelemetrySink) metrics(createdAt time.Time, stats []PcapPipelineStageStats) *metricsv1.Metric {
+	bounds := make([]float64, len(transformer.PipelineLatencyBounds))
+	for i, bound := range transformer.PipelineLatencyBounds {
+		bounds[i] = bound.Seconds()
+	}
+
+	now := uint64(time.Now().UnixNano())
+	points := make([]*metricsv1.HistogramDataPoint, 0, len(stats))
+	for _, stage := range stats {
+		sum, _max := stage.Sum.Seconds(), stage.Max.Seconds()
+		points = append(points, &metricsv1.HistogramDataPoint{
+			Attributes:        []*commonv1.KeyValue{otlpPipelineAttribute("pcap.stage", stage.Stage.String())},
+			StartTimeUnixNano: uint64(createdAt.UnixNano()),
+			TimeUnixNano:      now,
+			Count:             stage.Count,
+			Sum:               &sum,
+			Max:               &_max,
+			BucketCounts:      stage.Buckets,
+			ExplicitBounds:    bounds,
+		})
+	}
+
+	return &metricsv1.Metric{
+		Name:        otlpPipelineMetricName,
+		Description: "time spent by packets in every stage of the pipeline translating them",
+		Unit:        "s",
+		Data: &metricsv1.Metric_Histogram{Histogram: &metricsv1.Histogram{
+			DataPoints:             points,
+			AggregationTemporality: metricsv1.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+		}},
+	}
+}
+
+func (s *otlpTelemetrySink) spans(traces []*PcapPipelineTrace) ([]*tracev1.Span, error) {
+	spans := make([]*tracev1.Span, 0, len(traces)*4)
+	for _, trace := range traces {
+		if len(trace.Spans) == 0 {
+			continue
+		}
+
+		traceID, rootID := make([]byte, 16), make([]byte, 8)
+		if _, err := rand.Read(traceID); err != nil {
+			return nil, err
+		}
+		if _, err := rand.Read(rootID); err != nil {
+			return nil, err
+		}
+
+		attributes := []*commonv1.KeyValue{
+			otlpPipelineAttribute("pcap.iface", trace.Iface),
+			otlpPipelineAttribute("pcap.serial", strconv.FormatUint(trace.Serial, 10)),
+		}
+		root := &tracev1.Span{
+			TraceId:           traceID,
+			SpanId:            rootID,
+			Name:              otlpPipelineSpanName,
+			Kind:              tracev1.Span_SPAN_KIND_INTERNAL,
+			StartTimeUnixNano: uint64(trace.Spans[0].Start.UnixNano()),
+			EndTimeUnixNano:   uint64(trace.Spans[0].End.UnixNano()),
+			Flags:             otlpPipelineTraceFlags,
+			Attributes:        attributes,
+		}
+		spans = append(spans, root)
+
+		// stages are recorded in the order in which the packet went through them
+		for _, stage := range trace.Spans {
+			spanID := make([]byte, 8)
+			if _, err := rand.Read(spanID); err != nil {
+				return nil, err
+			}
+			root.StartTimeUnixNano = min(root.StartTimeUnixNano, uint64(stage.Start.UnixNano()))
+			root.EndTimeUnixNano = max(root.EndTimeUnixNano, uint64(stage.End.UnixNano()))
+			spans = append(spans, &tracev1.Span{
+				TraceId:           traceID,
+				SpanId:            spanID,
+				ParentSpanId:      rootID,
+				Name:              "pcap." + stage.Stage.String(),
+				Kind:              tracev1.Span_SPAN_KIND_INTERNAL,
+				StartTimeUnixNano: uint64(stage.Start.UnixNano()),
+				EndTimeUnixNano:   uint64(stage.End.UnixNano()),
+				Flags:             otlpPipelineTraceFlags,
+				Attributes:        attributes,
+			})
+		}
+	}
+	return spans, nil
+}
+
+func (s *otlpTelemetrySink) export(
+	ctx context.Context,
+	createdAt time.Time,
+	stats []PcapPipelineStageStats,
+	traces []*PcapPipelineTrace,
+) error {
+	metricsRequest := &colmetricsv1.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricsv1.ResourceMetrics{{
+			Resource: s.resource,
+			ScopeMetrics: []*metricsv1.ScopeMetrics{{
+				Scope:   s.scope,
+				Metrics: []*metricsv1.Metric{s.metrics(createdAt, stats)},
+			}},
+		}},
+	}
+	err := callSink(ctx, otlpExportTimeout, func(ctx context.Context) error {
+		_, err := s.metricsClient.Export(ctx, metricsRequest)
+		return err
+	})
+
+	spans, spansErr := s.spans(traces)
+	if spansErr != nil || len(spans) == 0 {
+		return errors.Join(err, spansErr)
+	}
+
+	traceRequest := &coltracev1.ExportTraceServiceRequest{
+		ResourceSpans: []*tracev1.ResourceSpans{{
+			Resource: s.resource,
+			ScopeSpans: []*tracev1.ScopeSpans{{
+				Scope: s.scope,
+				Spans: spans,
+			}},
+		}},
+	}
+	spansErr = callSink(ctx, otlpExportTimeout, func(ctx context.Context) error {
+		_, err := s.traceClient.Export(ctx, traceRequest)
+		return err
+	})
+	return errors.Join(err, spansErr)
+}
+
+func (s *otlpTelemetrySink) Close() error {
+	return s.conn.Close()
+}
+
+func newOTLPTelemetrySink(endpoint string) (pcapTelemetrySink, error) {
+	conn, err := newOTLPConn(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	return &otlpTelemetrySink{
+		conn:          conn,
+		metricsClient: colmetricsv1.NewMetricsServiceClient(conn),
+		traceClient:   coltracev1.NewTraceServiceClient(conn),
+		resource:      newOTLPResource(nil /* ifaceAndIndex */),
+		scope:         &commonv1.InstrumentationScope{Name: otlpScopeName},
+	}, nil
+}
@@ -0,0 +1,332 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build otlp
+
+package pcap
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/pcap-sidecar/pcap-cli/internal/transformer"
+	collogsv1 "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	coltracev1 "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonv1 "go.opentelemetry.io/proto/otlp/common/v1"
+	logsv1 "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcev1 "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracev1 "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
+)
+
+type (
+	// otlpPcapWriter exports `LogRecord`s written by the OTLP translator to an OTLP/gRPC endpoint:
+	//   - every `Write` must contain complete length-prefixed `LogRecord`s,
+	//   - records are exported in batches, either when a batch is full or every `otlpExportInterval`,
+	//   - `Span`s describing connection phases and HTTP exchanges are exported along with records,
+	//   - exports in flight outlive the engine's context so that they may complete within its stop deadline;
+	//     `Flush` waits for them, and `Close` cancels them.
+	otlpPcapWriter struct {
+		iface       *string
+		logger      *log.Logger
+		conn        *grpc.ClientConn
+		client      collogsv1.LogsServiceClient
+		traceClient coltracev1.TraceServiceClient
+		resource    *resourcev1.Resource
+		scope       *commonv1.InstrumentationScope
+		mu          *sync.Mutex
+		records     []*logsv1.LogRecord
+		spans       []*tracev1.Span
+		done        chan struct{}
+		ctx         context.Context
+		cancel      context.CancelFunc
+		inflight    *sync.WaitGroup
+	}
+)
+
+const (
+	otlpBatchSize      = 512
+	otlpExportInterval = 5 * time.Second
+	otlpExportTimeout  = 10 * time.Second
+	otlpScopeName      = "github.com/GoogleCloudPlatform/pcap-sidecar/pcap-cli"
+	otlpServiceName    = "pcap-sidecar"
+)
+
+var errOTLPInvalidRecord = errors.New("invalid OTLP record")
+
+func (w *otlpPcapWriter) Write(b []byte) (int, error) {
+	records := []*logsv1.LogRecord{}
+	spans := []*tracev1.Span{}
+
+	for data := b; len(data) > 0; {
+		if len(data) < 4 {
+			return 0, errOTLPInvalidRecord
+		}
+		frame := binary.LittleEndian.Uint32(data)
+		size := int(frame &^ transformer.OTLPSpanFrame)
+		if len(data) < 4+size {
+			return 0, errOTLPInvalidRecord
+		}
+		if frame&transformer.OTLPSpanFrame != 0 {
+			span := &tracev1.Span{}
+			if err := proto.Unmarshal(data[4:4+size], span); err != nil {
+				return 0, errors.Join(errOTLPInvalidRecord, err)
+			}
+			spans = append(spans, span)
+		} else {
+			record := &logsv1.LogRecord{}
+			if err := proto.Unmarshal(data[4:4+size], record); err != nil {
+				return 0, errors.Join(errOTLPInvalidRecord, err)
+			}
+			records = append(records, record)
+		}
+		data = data[4+size:]
+	}
+
+	w.mu.Lock()
+	w.records = append(w.records, records...)
+	w.spans = append(w.spans, spans...)
+	batch, spansBatch := w.nextBatch(otlpBatchSize)
+	w.mu.Unlock()
+
+	if batch != nil {
+		w.inflight.Add(1)
+		go func() {
+			defer w.inflight.Done()
+			w.export(w.ctx, batch, spansBatch)
+		}()
+	}
+
+	return len(b), nil
+}
+
+// nextBatch must be called while holding `w.mu`;
+// it returns `nil` if there are less than `size` pending records.
+// Pending `Span`s are always exported along with records, as they are much less frequent.
+func (w *otlpPcapWriter) nextBatch(size int) ([]*logsv1.LogRecord, []*tracev1.Span) {
+	if len(w.records) == 0 || len(w.records) < size {
+		return nil, nil
+	}
+	batch, spans := w.records, w.spans
+	w.records = make([]*logsv1.LogRecord, 0, otlpBatchSize)
+	w.spans = nil
+	return batch, spans
+}
+
+func (w *otlpPcapWriter) exportSpans(ctx context.Context, spans []*tracev1.Span) error {
+	request := &coltracev1.ExportTraceServiceRequest{
+		ResourceSpans: []*tracev1.ResourceSpans{{
+			Resource: w.resource,
+			ScopeSpans: []*tracev1.ScopeSpans{{
+				Scope: w.scope,
+				Spans: spans,
+			}},
+		}},
+	}
+
+	var response *coltracev1.ExportTraceServiceResponse
+	err := callSink(ctx, otlpExportTimeout, func(ctx context.Context) (err error) {
+		response, err = w.traceClient.Export(ctx, request)
+		return err
+	})
+	if err != nil {
+		w.logger.Printf("failed to export %d spans: %v\n", len(spans), err)
+		return err
+	}
+
+	if partial := response.GetPartialSuccess(); partial != nil && partial.GetRejectedSpans() > 0 {
+		w.logger.Printf("rejected %d/%d spans: %s\n",
+			partial.GetRejectedSpans(), len(spans), partial.GetErrorMessage())
+	}
+
+	return nil
+}
+
+// export retries every request within its own timeout until `ctx` is done.
+func (w *otlpPcapWriter) export(ctx context.Context, records []*logsv1.LogRecord, spans []*tracev1.Span) error {
+	var spansErr error
+	if len(spans) > 0 {
+		spansErr = w.exportSpans(ctx, spans)
+	}
+
+	request := &collogsv1.ExportLogsServiceRequest{
+		ResourceLogs: []*logsv1.ResourceLogs{{
+			Resource: w.resource,
+			ScopeLogs: []*logsv1.ScopeLogs{{
+				Scope:      w.scope,
+				LogRecords: records,
+			}},
+		}},
+	}
+
+	var response *collogsv1.ExportLogsServiceResponse
+	err := callSink(ctx, otlpExportTimeout, func(ctx context.Context) (err error) {
+		response, err = w.client.Export(ctx, request)
+		return err
+	})
+	if err != nil {
+		w.logger.Printf("failed to export %d records: %v\n", len(records), err)
+		return errors.Join(err, spansErr)
+	}
+
+	if partial := response.GetPartialSuccess(); partial != nil && partial.GetRejectedLogRecords() > 0 {
+		w.logger.Printf("rejected %d/%d records: %s\n",
+			partial.GetRejectedLogRecords(), len(records), partial.GetErrorMessage())
+	}
+
+	return spansErr
+}
+
+func (w *otlpPcapWriter) exportPeriodically() {
+	ticker := time.NewTicker(otlpExportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			w.mu.Lock()
+			batch, spans := w.nextBatch(1)
+			w.mu.Unlock()
+			if batch != nil {
+				w.export(w.ctx, batch, spans)
+			}
+		}
+	}
+}
+
+// Flush exports all pending records, and waits for exports in flight; it returns as soon as `ctx` is done.
+func (w *otlpPcapWriter) Flush(ctx context.Context) error {
+	w.mu.Lock()
+	batch, spans := w.nextBatch(1)
+	w.mu.Unlock()
+
+	var err error
+	if batch != nil {
+		err = w.export(ctx, batch, spans)
+	}
+	return errors.Join(err, waitOrDone(ctx, w.inflight))
+}
+
+func (w *otlpPcapWriter) Close() error {
+	close(w.done)
+	ctx, cancel := context.WithTimeout(context.Background(), otlpExportTimeout)
+	defer cancel()
+	err := w.Flush(ctx)
+	// exports still in flight are abandoned
+	w.cancel()
+	return errors.Join(err, w.conn.Close())
+}
+
+func (w *otlpPcapWriter) Rotate() {
+	// OTLP exports are not files: there is nothing to rotate
+}
+
+func (w *otlpPcapWriter) IsStdOutOrErr() bool {
+	return false
+}
+
+func (w *otlpPcapWriter) Files() []string {
+	return nil
+}
+
+func (w *otlpPcapWriter) GetIface() *string {
+	return w.iface
+}
+
+// newOTLPResource describes the process exporting telemetry; `ifaceAndIndex` is `nil` if it is not exported on behalf of a single interface.
+func newOTLPResource(ifaceAndIndex *string) *resourcev1.Resource {
+	attributes := []*commonv1.KeyValue{
+		{Key: "service.name", Value: &commonv1.AnyValue{Value: &commonv1.AnyValue_StringValue{StringValue: otlpServiceName}}},
+	}
+	if ifaceAndIndex != nil {
+		attributes = append(attributes, &commonv1.KeyValue{
+			Key: "pcap.iface", Value: &commonv1.AnyValue{Value: &commonv1.AnyValue_StringValue{StringValue: *ifaceAndIndex}},
+		})
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		attributes = append(attributes, &commonv1.KeyValue{
+			Key: "host.name", Value: &commonv1.AnyValue{Value: &commonv1.AnyValue_StringValue{StringValue: hostname}},
+		})
+	}
+	return &resourcev1.Resource{Attributes: attributes}
+}
+
+// newOTLPConn connects to an OTLP/gRPC `endpoint`:
+//   - `http://` endpoints are insecure: i/e: a collector running as a sidecar; `http://127.0.0.1:4317`,
+//   - endpoints without scheme or with `https://` use TLS.
+func newOTLPConn(endpoint string) (*grpc.ClientConn, error) {
+	target := endpoint
+	creds := credentials.NewTLS(&tls.Config{})
+	if _target, ok := strings.CutPrefix(target, "http://"); ok {
+		target = _target
+		creds = insecure.NewCredentials()
+	} else {
+		target = strings.TrimPrefix(target, "https://")
+	}
+
+	conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTLP endpoint '%s': %w", endpoint, err)
+	}
+	return conn, nil
+}
+
+// NewOTLPPcapWriter creates a writer which exports translations produced by the `otlp` format to `endpoint`; see `newOTLPConn`.
+func NewOTLPPcapWriter(ctx context.Context, ifaceAndIndex *string, endpoint *string) (PcapWriter, error) {
+	loggerPrefix := fmt.Sprintf("[pcap/writer] - [%s] – [otlp] - ", *ifaceAndIndex)
+	logger := log.New(os.Stderr, loggerPrefix, log.LstdFlags)
+
+	conn, err := newOTLPConn(*endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	// exports are not bound to the engine's context so that pending records are not lost when it is done
+	exportCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+
+	w := &otlpPcapWriter{
+		iface:       ifaceAndIndex,
+		logger:      logger,
+		conn:        conn,
+		client:      collogsv1.NewLogsServiceClient(conn),
+		traceClient: coltracev1.NewTraceServiceClient(conn),
+		resource:    newOTLPResource(ifaceAndIndex),
+		scope:       &commonv1.InstrumentationScope{Name: otlpScopeName},
+		mu:          new(sync.Mutex),
+		records:     make([]*logsv1.LogRecord, 0, otlpBatchSize),
+		done:        make(chan struct{}),
+		ctx:         exportCtx,
+		cancel:      cancel,
+		inflight:    new(sync.WaitGroup),
+	}
+
+	go w.exportPeriodically()
+
+	logger.Printf("- created: %s\n", *endpoint)
+
+	return w, nil
+}
@@ -0,0 +1,297 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build parquet
+
+package pcap
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+type (
+	// parquetPcapRecord is the stable column schema of Parquet files:
+	//   - core fields are available as columns,
+	//   - the complete JSON translation is available in the `json` column.
+	//
+	// columns must only be appended, and never removed nor renamed.
+	parquetPcapRecord struct {
+		Timestamp  time.Time `parquet:"timestamp,timestamp(nanosecond)"`
+		Serial     uint64    `parquet:"serial"`
+		Flow       string    `parquet:"flow,dict"`
+		IfaceIndex int32     `parquet:"iface_index"`
+		IfaceName  string    `parquet:"iface_name,dict"`
+		Length     int64     `parquet:"length"`
+		L3Src      string    `parquet:"l3_src,optional,dict"`
+		L3Dst      string    `parquet:"l3_dst,optional,dict"`
+		L3Proto    string    `parquet:"l3_proto,optional,dict"`
+		L4Src      int32     `parquet:"l4_src,optional"`
+		L4Dst      int32     `parquet:"l4_dst,optional"`
+		TCPFlags   string    `parquet:"tcp_flags,optional,dict"`
+		TCPSeq     int64     `parquet:"tcp_seq,optional"`
+		TCPAck     int64     `parquet:"tcp_ack,optional"`
+		HTTPMethod string    `parquet:"http_method,optional,dict"`
+		HTTPURL    string    `parquet:"http_url,optional"`
+		HTTPCode   int32     `parquet:"http_code,optional"`
+		TraceID    string    `parquet:"trace_id,optional"`
+		SpanID     string    `parquet:"span_id,optional"`
+		Message    string    `parquet:"message"`
+		JSON       string    `parquet:"json"`
+	}
+
+	// parquetPcapRecordsWriter writes row groups into a single Parquet file: every `Flush` ends a row group,
+	// and `Close` writes the footer which makes the file readable.
+	parquetPcapRecordsWriter interface {
+		Write([]parquetPcapRecord) (int, error)
+		Flush() error
+		Close() error
+	}
+
+	// parquetPcapFile writes row groups into a file on disk.
+	parquetPcapFile struct {
+		file   *os.File
+		writer *parquet.GenericWriter[parquetPcapRecord]
+	}
+
+	// parquetPcapWriter accumulates JSON translations and writes them into a new Parquet file per rotation window:
+	//   - Parquet files are only readable after being closed, so files are closed on every rotation,
+	//   - rows are written in row groups of `parquetRowGroupSize` to bound memory usage.
+	parquetPcapWriter struct {
+		iface            *string
+		logger           *log.Logger
+		fileNameProvider *pcapFileNameProvider
+		mu               *sync.Mutex
+		rows             []parquetPcapRecord
+		rowGroupSize     int
+		create           func(fileName string) (parquetPcapRecordsWriter, error)
+		writer           parquetPcapRecordsWriter
+	}
+)
+
+const (
+	parquetRowGroupSize  = 10_000
+	parquetPcapWriterExt = "parquet"
+)
+
+func createParquetPcapFile(fileName string) (parquetPcapRecordsWriter, error) {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Parquet file '%s': %w", fileName, err)
+	}
+	return &parquetPcapFile{
+		file:   file,
+		writer: parquet.NewGenericWriter[parquetPcapRecord](file, parquet.Compression(&parquet.Zstd)),
+	}, nil
+}
+
+func (f *parquetPcapFile) Write(rows []parquetPcapRecord) (int, error) {
+	return f.writer.Write(rows)
+}
+
+func (f *parquetPcapFile) Flush() error {
+	return f.writer.Flush()
+}
+
+// Close writes the Parquet footer before closing the file.
+func (f *parquetPcapFile) Close() error {
+	return errors.Join(f.writer.Close(), f.file.Sync(), f.file.Close())
+}
+
+func newParquetPcapRecord(line []byte) (*parquetPcapRecord, error) {
+	translation, err := newPcapJSONTranslation(line)
+	if err != nil {
+		return nil, err
+	}
+
+	return &parquetPcapRecord{
+		Timestamp:  translation.Meta.Timestamp,
+		Serial:     translation.Pcap.Num,
+		Flow:       translation.Flow,
+		IfaceIndex: translation.Iface.Index,
+		IfaceName:  translation.Iface.Name,
+		Length:     translation.Meta.Len,
+		L3Src:      translation.L3.Src,
+		L3Dst:      translation.L3.Dst,
+		L3Proto:    translation.L3.Proto.Name,
+		L4Src:      translation.L4.Src,
+		L4Dst:      translation.L4.Dst,
+		TCPFlags:   translation.L4.Flags.Str,
+		TCPSeq:     translation.L4.Seq,
+		TCPAck:     translation.L4.Ack,
+		HTTPMethod: translation.HTTP.Method,
+		HTTPURL:    translation.HTTP.URL,
+		HTTPCode:   translation.HTTP.Code,
+		TraceID:    translation.traceID(),
+		SpanID:     translation.Span,
+		Message:    translation.Message,
+		JSON:       string(line),
+	}, nil
+}
+
+// Write expects complete JSON translations: 1 per line.
+func (w *parquetPcapWriter) Write(b []byte) (int, error) {
+	records := make([]parquetPcapRecord, 0, 1)
+	for _, line := range bytes.Split(b, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		record, err := newParquetPcapRecord(line)
+		if err != nil {
+			return 0, fmt.Errorf("invalid JSON translation: %w", err)
+		}
+		records = append(records, *record)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.rows = append(w.rows, records...)
+	if len(w.rows) < w.rowGroupSize {
+		return len(b), nil
+	}
+
+	if err := w.writeRowGroup(); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// writeRowGroup must be called while holding `w.mu`
+func (w *parquetPcapWriter) writeRowGroup() error {
+	if len(w.rows) == 0 {
+		return nil
+	}
+
+	// files are lazily created to avoid empty files
+	if w.writer == nil {
+		writer, err := w.create(filepath.Join(w.fileNameProvider.root, w.fileNameProvider.get()))
+		if err != nil {
+			return err
+		}
+		w.writer = writer
+	}
+
+	if _, err := w.writer.Write(w.rows); err != nil {
+		return err
+	}
+	w.rows = w.rows[:0]
+
+	return w.writer.Flush()
+}
+
+// rotate must be called while holding `w.mu`
+func (w *parquetPcapWriter) rotate() error {
+	err := w.writeRowGroup()
+
+	if w.writer == nil {
+		return err
+	}
+
+	// Parquet footer is written on `Close`
+	err = errors.Join(err, w.writer.Close())
+	w.writer = nil
+
+	return err
+}
+
+func (w *parquetPcapWriter) Rotate() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.rotate(); err != nil {
+		w.logger.Printf("- ROTATE | error: %v\n", err)
+	}
+}
+
+// Flush writes all pending rows and closes the current Parquet file.
+func (w *parquetPcapWriter) Flush(_ context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.rotate()
+}
+
+func (w *parquetPcapWriter) Close() error {
+	return w.Flush(context.Background())
+}
+
+func (w *parquetPcapWriter) IsStdOutOrErr() bool {
+	return false
+}
+
+func (w *parquetPcapWriter) Files() []string {
+	return w.fileNameProvider.getFiles()
+}
+
+func (w *parquetPcapWriter) GetIface() *string {
+	return w.iface
+}
+
+func (w *parquetPcapWriter) Retarget(template string) error {
+	if err := w.fileNameProvider.retarget(template); err != nil {
+		return err
+	}
+	w.Rotate()
+	return nil
+}
+
+// NewParquetPcapWriter creates a writer which produces Parquet files from translations produced by the `json` format.
+func NewParquetPcapWriter(ctx context.Context, ifaceAndIndex, template, timezone *string, interval int) (PcapWriter, error) {
+	loggerPrefix := fmt.Sprintf("[pcap/writer] - [%s] – [%s] - ", *ifaceAndIndex, parquetPcapWriterExt)
+	logger := log.New(os.Stderr, loggerPrefix, log.LstdFlags)
+
+	extension := parquetPcapWriterExt
+
+	w := &parquetPcapWriter{
+		iface:            ifaceAndIndex,
+		logger:           logger,
+		fileNameProvider: newPcapWriterFileNameProvider(template, &extension, timezone),
+		mu:               new(sync.Mutex),
+		rows:             make([]parquetPcapRecord, 0, parquetRowGroupSize),
+		rowGroupSize:     parquetRowGroupSize,
+		create:           createParquetPcapFile,
+	}
+
+	go func(ctx context.Context, w *parquetPcapWriter, interval time.Duration) {
+		var ticks <-chan time.Time
+		if interval > 0 {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			ticks = ticker.C
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				// pending rows are written by `Flush` when the engine stops
+				return
+			case <-ticks:
+				w.Rotate()
+			}
+		}
+	}(ctx, w, time.Duration(interval)*time.Second)
+
+	logger.Println("- created")
+
+	return w, nil
+}
@@ -0,0 +1,167 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build parquet
+
+package pcap
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// parquetPcapWriterTestFile keeps the row groups written into a Parquet file in memory.
+type parquetPcapWriterTestFile struct {
+	name      string
+	rowGroups [][]parquetPcapRecord
+	pending   []parquetPcapRecord
+	closed    bool
+}
+
+func (f *parquetPcapWriterTestFile) Write(rows []parquetPcapRecord) (int, error) {
+	f.pending = append(f.pending, rows...)
+	return len(rows), nil
+}
+
+func (f *parquetPcapWriterTestFile) Flush() error {
+	f.rowGroups = append(f.rowGroups, f.pending)
+	f.pending = nil
+	return nil
+}
+
+func (f *parquetPcapWriterTestFile) Close() error {
+	f.closed = true
+	return nil
+}
+
+func newParquetPcapWriterTest(t *testing.T, rowGroupSize int) *parquetPcapWriter {
+	iface, template, timezone := "eth0", filepath.Join(t.TempDir(), "translations"), "UTC"
+	writer, err := NewParquetPcapWriter(context.Background(), &iface, &template, &timezone, 0)
+	require.NoError(t, err)
+	w := writer.(*parquetPcapWriter)
+	w.rowGroupSize = rowGroupSize
+	return w
+}
+
+func writeParquetPcapWriterTest(t *testing.T, w *parquetPcapWriter, serials ...uint64) {
+	lines := make([]string, len(serials))
+	for i, serial := range serials {
+		lines[i] = newPcapJSONTranslationTestLine(serial)
+	}
+	data := strings.Join(lines, "\n") + "\n"
+	n, err := w.Write([]byte(data))
+	require.NoError(t, err)
+	assert.Equal(t, len(data), n)
+}
+
+// TestParquetPcapWriterRoundTrip verifies that translations written into Parquet files are read back as rows.
+func TestParquetPcapWriterRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	w := newParquetPcapWriterTest(t, 2)
+	writeParquetPcapWriterTest(t, w, 1, 2, 3)
+	writeParquetPcapWriterTest(t, w, 4)
+	_, err := w.Write([]byte("not json\n"))
+	assert.ErrorContains(t, err, "invalid JSON translation")
+	require.NoError(t, w.Flush(context.Background()))
+
+	files := w.Files()
+	require.Len(t, files, 1)
+
+	rows, err := parquet.ReadFile[parquetPcapRecord](files[0])
+	require.NoError(t, err)
+	require.Len(t, rows, 4)
+	for i, row := range rows {
+		assert.Equal(t, uint64(i+1), row.Serial)
+	}
+
+	row := rows[0]
+	assert.True(t, pcapJSONTranslationTestTimestamp.Equal(row.Timestamp))
+	assert.Equal(t, "123", row.Flow)
+	assert.Equal(t, int32(2), row.IfaceIndex)
+	assert.Equal(t, "eth0", row.IfaceName)
+	assert.Equal(t, int64(74), row.Length)
+	assert.Equal(t, "10.0.0.1", row.L3Src)
+	assert.Equal(t, "10.0.0.2", row.L3Dst)
+	assert.Equal(t, "IPv4", row.L3Proto)
+	assert.Equal(t, int32(40000), row.L4Src)
+	assert.Equal(t, int32(8080), row.L4Dst)
+	assert.Equal(t, "PA", row.TCPFlags)
+	assert.Equal(t, int64(1000), row.TCPSeq)
+	assert.Equal(t, int64(2000), row.TCPAck)
+	assert.Equal(t, "GET", row.HTTPMethod)
+	assert.Equal(t, "/health", row.HTTPURL)
+	assert.Equal(t, int32(200), row.HTTPCode)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", row.TraceID)
+	assert.Equal(t, "00f067aa0ba902b7", row.SpanID)
+	assert.Equal(t, "request", row.Message)
+	assert.JSONEq(t, newPcapJSONTranslationTestLine(1), row.JSON)
+
+	// a row group is written every time there are enough rows, and when flushing
+	file, err := os.Open(files[0])
+	require.NoError(t, err)
+	defer file.Close()
+	info, err := file.Stat()
+	require.NoError(t, err)
+	parquetFile, err := parquet.OpenFile(file, info.Size())
+	require.NoError(t, err)
+	assert.Len(t, parquetFile.RowGroups(), 2)
+}
+
+// TestParquetPcapWriterRowGroups verifies when row groups are written, and that files are closed on every rotation.
+func TestParquetPcapWriterRowGroups(t *testing.T) {
+	t.Parallel()
+
+	w := newParquetPcapWriterTest(t, 3)
+	files := []*parquetPcapWriterTestFile{}
+	w.create = func(fileName string) (parquetPcapRecordsWriter, error) {
+		file := &parquetPcapWriterTestFile{name: fileName}
+		files = append(files, file)
+		return file, nil
+	}
+
+	// files are not created until there is a row group to write
+	writeParquetPcapWriterTest(t, w, 1, 2)
+	assert.Empty(t, files)
+	writeParquetPcapWriterTest(t, w, 3, 4)
+	require.Len(t, files, 1)
+	assert.Len(t, files[0].rowGroups, 1)
+	assert.Len(t, files[0].rowGroups[0], 4)
+	assert.False(t, files[0].closed)
+
+	writeParquetPcapWriterTest(t, w, 5)
+	w.Rotate()
+	assert.True(t, files[0].closed)
+	if assert.Len(t, files[0].rowGroups, 2) {
+		assert.Equal(t, uint64(5), files[0].rowGroups[1][0].Serial)
+	}
+
+	// rotating without pending rows creates no files
+	w.Rotate()
+	require.NoError(t, w.Flush(context.Background()))
+	assert.Len(t, files, 1)
+
+	writeParquetPcapWriterTest(t, w, 6)
+	require.NoError(t, w.Close())
+	require.Len(t, files, 2)
+	assert.True(t, files[1].closed)
+	assert.Equal(t, filepath.Join(filepath.Dir(files[0].name), "translations.parquet"), files[1].name)
+}
@@ -16,8 +16,13 @@ package pcap
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"sync/atomic"
@@ -39,36 +44,148 @@ type (
 
 	PcapEphemeralPorts = transformer.PcapEphemeralPorts
 
+	// multicast group memberships reported by IGMP and MLD; see `PcapEngine.Stats()`
+	PcapMulticastMembership = transformer.MulticastMembership
+
+	PcapDestination = transformer.CaptureDestination
+
+	// packets and bytes per layer path, i/e: `Ethernet/IPv4/TCP/TLS`; see `PcapEngine.Stats()`
+	PcapProtocol = transformer.CaptureProtocol
+
+	// TCP connections by state, i/e: half-open and reset connections; see `PcapEngine.Stats()`
+	PcapTCPConnections = transformer.CaptureTCPConnections
+
+	// significant differences between 2 captures; see `DiffCaptures`
+	PcapDiff = transformer.CaptureDiff
+
+	// numeric features of a flow; see `ExportFlowFeatures`
+	PcapFlowFeatures = transformer.CaptureFlowFeatures
+
+	// handlers of flow events; i/e: `context.WithValue(ctx, PcapContextFlowEvents, &PcapFlowEventHandlers{...})`
+	PcapFlowEventHandlers = transformer.FlowEventHandlers
+	PcapFlowEvent         = transformer.FlowEvent
+	PcapFlowStartEvent    = transformer.FlowStartEvent
+	PcapFlowEndEvent      = transformer.FlowEndEvent
+	PcapFlowStallEvent    = transformer.FlowStallEvent
+	PcapFlowSummaryEvent  = transformer.FlowSummaryEvent
+	PcapHTTPRequestEvent  = transformer.HTTPRequestEvent
+	PcapHTTPResponseEvent = transformer.HTTPResponseEvent
+	PcapTopTalkersEvent   = transformer.TopTalkersEvent
+	PcapFlowTalker        = transformer.FlowTalker
+
+	// strategies to extract trace context; i/e: `context.WithValue(ctx, PcapContextTraceStrategy, &PcapTraceStrategy{...})`
+	PcapTraceStrategy      = transformer.TraceStrategy
+	PcapTraceExtractor     = transformer.TraceExtractor
+	PcapTraceExtractorFunc = transformer.TraceExtractorFunc
+	PcapFlowStrategy       = transformer.FlowStrategy
+	PcapFlowMessage        = transformer.FlowMessage
+	PcapFlowMessageKind    = transformer.FlowMessageKind
+
+	// only writes translations of flows which carried traces of interest; see `NewPcapTraceScope`
+	PcapTraceScope = transformer.TraceScope
+
+	// packets and bytes read by engines over rolling windows, per L4 protocol; see `PcapTrafficEngine`
+	PcapTrafficStats    = transformer.TrafficStats
+	PcapTrafficWindow   = transformer.TrafficWindow
+	PcapTrafficCounters = transformer.TrafficCounters
+
+	// why packets read by engines were not written; see `PcapStats.Drops`
+	PcapDropReason = transformer.DropReason
+
+	// telemetry of the pipelines translating packets; see `PcapTelemetryExporter`
+	PcapPipelineTelemetry  = transformer.PipelineTelemetry
+	PcapPipelineTrace      = transformer.PipelineTrace
+	PcapPipelineStageStats = transformer.PipelineStageStats
+
 	PcapFilterMode uint8
 
 	PcapFilter struct {
 		Raw *string
 	}
 
-	// PCAP owns the behavior that will be exposed to consumers
+	// PCAP owns the behavior that will be exposed to consumers;
+	// filters may be updated while engines are running: packets are checked against the latest filters.
+	// `Deny*` filters take precedence over `Add*` ones: i/e: all IPs but a denied network are translated.
 	PcapFilters interface {
 		AddL3Proto(L3Proto)
 		AddL3Protos(...L3Proto)
+		RemoveL3Proto(L3Proto)
+		RemoveL3Protos(...L3Proto)
 		AddIPv4(string)
 		AddIPv4s(...string)
+		RemoveIPv4(string)
+		RemoveIPv4s(...string)
 		AddIPv6(string)
 		AddIPv6s(...string)
+		RemoveIPv6(string)
+		RemoveIPv6s(...string)
 		AddIPv4Range(string)
 		AddIPv4Ranges(...string)
+		RemoveIPv4Range(string)
+		RemoveIPv4Ranges(...string)
 		AddIPv6Range(string)
 		AddIPv6Ranges(...string)
+		RemoveIPv6Range(string)
+		RemoveIPv6Ranges(...string)
+		DenyIPv4(string)
+		DenyIPv4s(...string)
+		DenyIPv4Range(string)
+		DenyIPv4Ranges(...string)
+		AllowIPv4(string)
+		AllowIPv4s(...string)
+		AllowIPv4Range(string)
+		AllowIPv4Ranges(...string)
+		DenyIPv6(string)
+		DenyIPv6s(...string)
+		DenyIPv6Range(string)
+		DenyIPv6Ranges(...string)
+		AllowIPv6(string)
+		AllowIPv6s(...string)
+		AllowIPv6Range(string)
+		AllowIPv6Ranges(...string)
 		AddL4Proto(L4Proto)
 		AddL4Protos(...L4Proto)
+		RemoveL4Proto(L4Proto)
+		RemoveL4Protos(...L4Proto)
 		AllowSocket(string, string) bool
 		DenySocket(string, string) bool
 		AddPort(uint16)
 		AddPorts(...uint16)
+		RemovePort(uint16)
+		RemovePorts(...uint16)
 		DenyPort(uint16)
 		DenyPorts(...uint16)
 		AllowPort(uint16)
 		AllowPorts(...uint16)
 		AddTCPFlags(...TCPFlag)
 		CombineAndAddTCPFlags(...TCPFlag)
+		RemoveTCPFlags(...TCPFlag)
+		AddMAC(string)
+		AddMACs(...string)
+		RemoveMAC(string)
+		RemoveMACs(...string)
+		DenyMAC(string)
+		DenyMACs(...string)
+		AllowMAC(string)
+		AllowMACs(...string)
+		AddVLAN(uint16)
+		AddVLANs(...uint16)
+		RemoveVLAN(uint16)
+		RemoveVLANs(...uint16)
+		DenyVLAN(uint16)
+		DenyVLANs(...uint16)
+		AllowVLAN(uint16)
+		AllowVLANs(...uint16)
+		// names are resolved by the DNS responses being captured; their IPs expire along with the answers
+		AddHost(string)
+		AddHosts(...string)
+		RemoveHost(string)
+		RemoveHosts(...string)
+		DenyHost(string)
+		DenyHosts(...string)
+		RemoveDeniedHost(string)
+		RemoveDeniedHosts(...string)
+		View() *PcapFiltersView
 	}
 
 	PcapFilterProvider interface {
@@ -95,11 +212,76 @@ type (
 		Filters       []PcapFilterProvider
 		CompatFilters PcapFilters
 		Ephemerals    *PcapEphemeralPorts
+		// BPF expressions of traffic which must never be captured, regardless of `Filter` and `Filters`;
+		// i/e: connections to sinks of the program embedding PCAP CLI, which would otherwise capture its own uploads.
+		Exclude []string
+		// path of the Go `text/template` used by the `template` format
+		Template string
+		// named captures sharing the packets, and translations, of this one; only enforced by the `google` engine
+		Profiles []*PcapProfile
+		// packets are only translated around the moments in which triggers fire; only enforced by the `google` engine
+		Triggers *PcapTriggers
+		// a `PcapManifest` is written next to every file completed by writers; only written for the `google` engine
+		Manifests bool
+		// how long applied packets are drained once the capture stops, unless the caller sends a stop deadline;
+		// defaults to 2 seconds. Flows which are still open are summarized once translations are drained.
+		DrainDeadline time.Duration
+		// receives the logs of transformers, which are otherwise written into `stderr` as JSON; see `NewPcapLogger`.
+		// Debug logs of flows are only produced while `Debug`, or `PcapContextDebugSwitch`, is on. Only used by the `google` engine.
+		Logger *slog.Logger
+		// how often a `stats` document with the `PcapTrafficStats` of the capture is logged; `0` disables it.
+		// Only produced by the `google` engine, whose traffic is also available at `NewPcapMetricsHandler`.
+		StatsInterval time.Duration
 	}
 
 	PcapEngine interface {
 		Start(context.Context, []PcapWriter, <-chan *time.Duration) error
 		IsActive() bool
+		// the handle is open, the filter is compiled, and writers are initialized
+		IsReady() bool
+		Stats() *PcapStats
+		// BPF filter enforced by the running capture; empty if there is none, or the engine is not ready
+		Filter() string
+	}
+
+	// PcapPausableEngine is implemented by engines which may keep capturing while discarding all packets:
+	//   - `tcpdump` engines cannot be paused, as packets are written by `tcpdump` itself.
+	PcapPausableEngine interface {
+		PcapEngine
+		Pause() bool
+		Resume() bool
+		IsPaused() bool
+	}
+
+	// PcapStats describes everything captured since the engine was created:
+	//   - `tcpdump` engines only report `Packets`, and only after `tcpdump` exits.
+	PcapStats struct {
+		Packets uint64
+		Bytes   uint64
+		// packets which could not be translated
+		Errors    uint64
+		Anomalies uint64
+		// destinations which received the most packets
+		TopDestinations []PcapDestination
+		// protocol hierarchy of all packets; only available for `gopacket` engines
+		Protocols []PcapProtocol
+		// multicast groups joined by hosts reachable through the captured interface; only available for `gopacket` engines
+		Multicast []PcapMulticastMembership
+		// packets discarded by the software filter when the capture filter is too large for the kernel
+		FilteredOut uint64
+		// packets discarded while the engine was paused; see `PcapPausableEngine`
+		PausedOut uint64
+		// times triggers fired, and packets discarded as no trigger fired within their window; see `PcapTriggers`
+		Triggered    uint64
+		TriggeredOut uint64
+		// packets dropped by the kernel as buffers were full, and by the network interface; only available for `gopacket` engines
+		Dropped   uint64
+		IfDropped uint64
+		// TCP connections by state; only available for `gopacket` engines
+		TCP PcapTCPConnections
+		// packets which were read but not written, per reason; only available for `gopacket` engines:
+		// `filtered` and `out_of_scope` are discarded by design, while `cancelled` and `queue_full` are lost due to overload.
+		Drops map[string]uint64
 	}
 
 	PcapDevice struct {
@@ -110,6 +292,20 @@ type (
 	Pcap struct {
 		config         *PcapConfig
 		isActive       *atomic.Bool
+		isReady        *atomic.Bool
+		isPaused       *atomic.Bool
+		filter         *atomic.Pointer[string]
+		multicast      *transformer.MulticastGroups
+		summary        *transformer.CaptureSummary
+		traffic        *transformer.TrafficMeter
+		drops          *transformer.DropCounters
+		filteredOut    *atomic.Uint64
+		pausedOut      *atomic.Uint64
+		triggered      *atomic.Uint64
+		triggeredOut   *atomic.Uint64
+		heartbeat      *atomic.Int64
+		dropped        *atomic.Uint64
+		ifDropped      *atomic.Uint64
 		activeHandle   gopacket.PacketDataSource
 		inactiveHandle *pcap.InactiveHandle
 		fn             transformer.IPcapTransformer
@@ -118,6 +314,9 @@ type (
 	Tcpdump struct {
 		config   *PcapConfig
 		isActive *atomic.Bool
+		isReady  *atomic.Bool
+		filter   *atomic.Pointer[string]
+		packets  *atomic.Uint64
 		tcpdump  string
 	}
 )
@@ -131,10 +330,75 @@ const (
 	PcapContextID      = transformer.ContextID
 	PcapContextLogName = transformer.ContextLogName
 	PcapContextDebug   = transformer.ContextDebug
+	// `*atomic.Bool` to toggle debug logging of running engines; i/e: when reloading a config file
+	PcapContextDebugSwitch = transformer.ContextDebugSwitch
+	// selects cookies and headers to be hashed; i/e: `[]string{"SESSIONID", "header:X-Session-Id"}`
+	PcapContextSessionKeys = transformer.ContextSessionKeys
+	// translates retransmitted TCP segments as `retransmission of #serial`
+	PcapContextCompactRetransmissions = transformer.ContextCompactRetransmissions
+	// field paths to be included in, or excluded from, JSON translations
+	PcapContextFields = transformer.ContextFields
+	// scores latency, loss, and connection rates against EWMA baselines per destination
+	PcapContextAnomalies = transformer.ContextAnomalies
+	// flags duplicate HTTP requests sent over different connections within a short window as retries or hedges
+	PcapContextRetries = transformer.ContextRetries
+	// reports if HTTP transactions used new or reused connections, and the DNS, TCP and TLS setup latency they paid for
+	PcapContextConnectionSetup = transformer.ContextConnectionSetup
+	// subscribes `*PcapFlowEventHandlers` to connections, and HTTP requests and responses
+	PcapContextFlowEvents = transformer.ContextFlowEvents
+	// replaces how trace context is extracted from HTTP headers, and trace-tracks `*PcapTraceStrategy` flows
+	PcapContextTraceStrategy = transformer.ContextTraceStrategy
+	// restricts and orders the trace context schemes extracted by default; i/e: `[]string{"w3c", "b3"}`
+	PcapContextTraceSchemes = transformer.ContextTraceSchemes
+	// extracts trace context from custom headers before standard ones; i/e: `[]string{"hash:X-Request-Id"}`
+	PcapContextTraceHeaders = transformer.ContextTraceHeaders
+	// only writes translations of flows which carried traces of interest; i/e: `NewPcapTraceScope([]string{"4bf92f35*"}, 0)`
+	PcapContextTraceScope = transformer.ContextTraceScope
+	// links responses to requests only for this percentage of traced flows; i/e: `uint(10)`
+	PcapContextTraceTrackingPercent = transformer.ContextTraceTrackingPercent
+	// links responses to requests for at most N new traced flows per second; i/e: `uint(100)`
+	PcapContextTraceTrackingRate = transformer.ContextTraceTrackingRate
+	// stamps labels onto records of packets matching rules; i/e: `[]string{"team=payments@port=8080|8443,net=10.0.0.0/8"}`
+	PcapContextLabels = transformer.ContextLabels
+	// rules matched against application payloads; i/e: `[]string{"sqli=(?i)union\\s+select", "tls=hex:16 03 01"}`
+	PcapContextPayloadRules = transformer.ContextPayloadRules
+	// only packets whose payload matched any payload rule are translated
+	PcapContextPayloadSelect = transformer.ContextPayloadSelect
+	// summarizes Redis and Memcached commands and replies sent to these servers; i/e: `[]string{"redis:6379"}`
+	PcapContextCachePorts = transformer.ContextCachePorts
+	// hashes Redis and Memcached keys using the same salt as `PcapContextSessionKeys`
+	PcapContextHashCacheKeys = transformer.ContextHashCacheKeys
+	// decodes PostgreSQL and MySQL messages sent to these servers; i/e: `[]string{"postgres:5432", "mysql:3306"}`
+	PcapContextDBPorts = transformer.ContextDBPorts
+	// includes query text and error messages in translations of PostgreSQL and MySQL messages
+	PcapContextDBQueries = transformer.ContextDBQueries
+	// summarizes AMQP 0-9-1 and Kafka frames sent to these brokers; i/e: `[]string{"amqp:5672", "kafka:9092"}`
+	PcapContextBrokerPorts = transformer.ContextBrokerPorts
+	// only translates packets of 1 out of every N flows; i/e: `uint(10)`; flows are chosen by hashing their 5-tuple
+	PcapContextFlowSampling = transformer.ContextFlowSampling
+	// only translates the first N packets of every flow per interval; i/e: `uint(100)`; the rest are counted as top talkers
+	PcapContextFlowBudget = transformer.ContextFlowBudget
+	// resets flow budgets and reports top talkers every interval; i/e: `time.Minute`
+	PcapContextFlowBudgetInterval = transformer.ContextFlowBudgetInterval
+	// encodes JSON translations as `cbor` or `msgpack` instead of `json`
+	PcapContextEncoding = transformer.ContextEncoding
+	// measures every stage of the pipeline, and traces sampled packets through it; i/e: `NewPcapPipelineTelemetry(1000, nil)`
+	PcapContextPipelineTelemetry = transformer.ContextPipelineTelemetry
+	// warns if the p99 of the time since packets are captured until they are written exceeds it; i/e: `time.Second`
+	PcapContextLatencyBudget = transformer.ContextLatencyBudget
+	// translates fewer flows, up to N times fewer, while the latency budget is exceeded; i/e: `uint(8)`
+	PcapContextLatencyBudgetSampling = transformer.ContextLatencyBudgetSampling
+	// logs 1 out of every N packets dropped for each reason as a `dropped` record; i/e: `uint(1000)`
+	PcapContextDropRecords = transformer.ContextDropRecords
+	// drops translations, instead of blocking all writers, if the queue of a slow writer is full; i/e: `true`
+	PcapContextDropOnFullQueue = transformer.ContextDropOnFullQueue
 )
 
 const (
 	PcapDefaultFilter = "(tcp or udp or icmp or icmp6) and (ip or ip6 or arp)"
+	// `vlan` shifts the offsets of the expressions that follow it, so the untagged variant must come first;
+	// see: https://www.tcpdump.org/manpages/pcap-filter.7.html#:~:text=vlan%20%5Bvlan_id%5D
+	pcapVLANFilterTemplate = "({0}) or (vlan and ({0}))"
 )
 
 const (
@@ -169,12 +433,33 @@ const (
 	L4_PROTO_ICMP  = L4Proto(0x01)
 	L4_PROTO_ICMP4 = L4_PROTO_ICMP
 	L4_PROTO_ICMP6 = L4Proto(0x3A)
+	L4_PROTO_SCTP  = L4Proto(0x84)
+
+	FLOW_MESSAGE_REQUEST  = transformer.FlowMessageRequest
+	FLOW_MESSAGE_RESPONSE = transformer.FlowMessageResponse
 )
 
+// extracts trace context from Google Cloud, W3C, gRPC, B3, AWS X-Ray and Datadog headers, and then using registered extractors
+var PcapDefaultTraceExtractor = transformer.DefaultTraceExtractor
+
+// RegisterPcapTraceExtractor makes `extractor` available as the trace context scheme `name`;
+// it is attempted after built-in schemes, and may be selected using `PcapContextTraceSchemes`.
+func RegisterPcapTraceExtractor(name string, extractor PcapTraceExtractor) error {
+	return transformer.RegisterTraceExtractor(name, extractor)
+}
+
+// LookupPcapTraceExtractor returns the extractor of a built-in or registered scheme; i/e: `cloud`.
+func LookupPcapTraceExtractor(name string) (PcapTraceExtractor, bool) {
+	return transformer.LookupTraceExtractor(name)
+}
+
 func providePcapFilter(
 	ctx context.Context,
 	filter *string,
 	providers []PcapFilterProvider,
+	exclude []string,
+	filters PcapFilters,
+	profiles []*PcapProfile,
 ) *string {
 	select {
 	case <-ctx.Done():
@@ -186,9 +471,12 @@ func providePcapFilter(
 
 	// if `filter` is available, then providers are not used to build the BPF filter.
 	if filter != nil && *filter != "" && !strings.EqualFold(*filter, "DISABLED") {
-		// `filter` is extremely unsafe as it is a free form expression:
-		// [ToDo] – validate `filter` to enforce correctness of expressions.
-		pcapFilter = stringFormatter.Format("({0})", *filter)
+		// `filter` is a free form expression: engines refuse to be created if it does not compile; see `validatePcapFilter`.
+		if *filter == PcapDefaultFilter {
+			pcapFilter = withVLANFilter(withProfiles(withExclusions(*filter, exclude), profiles, exclude), filters)
+		} else {
+			pcapFilter = withProfiles(withExclusions(*filter, exclude), profiles, exclude)
+		}
 	} else if len(providers) > 0 {
 		for _, provider := range providers {
 			if provider != nil {
@@ -198,13 +486,69 @@ func providePcapFilter(
 				}
 			}
 		}
+		pcapFilter = withVLANFilter(withProfiles(withExclusions(pcapFilter, exclude), profiles, exclude), filters)
 	} else {
-		pcapFilter = string(PcapDefaultFilter)
+		pcapFilter = withVLANFilter(withProfiles(withExclusions(PcapDefaultFilter, exclude), profiles, exclude), filters)
 	}
 
 	return &pcapFilter
 }
 
+// withExclusions appends a negated term per excluded expression; an empty `filter` matches everything else.
+// Terms follow user provided filters, so a `vlan` primitive within them also shifts the offsets of exclusions.
+func withExclusions(filter string, exclude []string) string {
+	terms := make([]string, 0, len(exclude)+1)
+	if filter != "" {
+		terms = append(terms, stringFormatter.Format("({0})", filter))
+	}
+	for _, expression := range exclude {
+		if expression = strings.TrimSpace(expression); expression != "" {
+			terms = append(terms, stringFormatter.Format("not ({0})", expression))
+		}
+	}
+	return strings.Join(terms, " and ")
+}
+
+// withVLANFilter makes generated filters match both untagged and 802.1Q tagged frames;
+// user provided filters are not modified: they may already account for VLAN tags.
+func withVLANFilter(filter string, filters PcapFilters) string {
+	if filter == "" {
+		return filter
+	}
+	if filters == nil {
+		return stringFormatter.Format(pcapVLANFilterTemplate, filter)
+	}
+	view := filters.View()
+	return withVLANs(filter, view.VLANs, view.DeniedVLANs)
+}
+
+// withVLANs enforces allowed or denied VLAN IDs in the kernel when possible; an empty `filter` matches everything else.
+// Every `vlan` primitive matches the next tag, so `vlan 10 or vlan 20` matches an outer tag 10 or an inner tag 20:
+// IDs are only matched by the kernel if there is a single allowed or denied ID; otherwise the kernel
+// matches more frames than it should, and IDs are enforced in userspace only.
+func withVLANs(filter string, allowed, denied []uint16) string {
+	template := pcapVLANFilterTemplate
+	vlan := ""
+
+	switch {
+	case len(allowed) == 1:
+		// untagged frames are not allowed
+		vlan = fmt.Sprintf("vlan %d", allowed[0])
+		template = vlan + " and ({0})"
+	case len(allowed) > 1:
+		vlan = "vlan"
+		template = "vlan and ({0})"
+	case len(denied) == 1:
+		vlan = fmt.Sprintf("not vlan %d", denied[0])
+		template = "({0}) or (" + vlan + " and ({0}))"
+	}
+
+	if filter == "" {
+		return vlan
+	}
+	return stringFormatter.Format(template, filter)
+}
+
 func findAllDevs(compare func(*string) bool) ([]*PcapDevice, error) {
 	devices, err := pcap.FindAllDevs()
 	if err != nil {
@@ -240,3 +584,102 @@ func FindDevicesByName(deviceName *string) ([]*PcapDevice, error) {
 func NewPcapFilters() PcapFilters {
 	return transformer.NewPcapFilters()
 }
+
+// TranslationSchema returns the machine-readable schema of translations produced by `format`; i/e: `json` or `proto`.
+func TranslationSchema(format string) ([]byte, error) {
+	return transformer.TranslationSchema(format)
+}
+
+// TranslationSchemaVersion returns the `schemaVersion` of translations produced by `format`; empty if they are not versioned.
+func TranslationSchemaVersion(format string) string {
+	return transformer.TranslationSchemaVersion(format)
+}
+
+// DiffCaptures compares destinations, latency distributions and error rates of 2 captures:
+// PCAP or PCAPNG files, or JSON translations; i/e: a capture of a good revision against a bad one.
+func DiffCaptures(a, b string) (*PcapDiff, error) {
+	return transformer.DiffCaptures(a, b)
+}
+
+// ExtractFlowFeatures computes numeric features of all TCP and UDP flows of a capture:
+// a PCAP or PCAPNG file, or JSON translations.
+func ExtractFlowFeatures(capture string) ([]PcapFlowFeatures, error) {
+	return transformer.ExtractFlowFeatures(capture)
+}
+
+// ExportFlowFeatures writes features of all flows of `capture` into `output`:
+//   - `output` is a Parquet file if its extension is `parquet`, and a CSV file otherwise,
+//   - features are written as CSV to `writer` if `output` is empty.
+func ExportFlowFeatures(capture, output string, writer io.Writer) error {
+	features, err := transformer.ExtractFlowFeatures(capture)
+	if err != nil {
+		return err
+	}
+
+	if output == "" {
+		return transformer.WriteFlowFeaturesCSV(writer, features)
+	}
+	if filepath.Ext(output) == ".parquet" {
+		return writeFlowFeaturesParquet(output, features)
+	}
+
+	file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	return errors.Join(transformer.WriteFlowFeaturesCSV(file, features), file.Close())
+}
+
+// NewPcapTraceScope returns a scope of traces chosen by ID, by ID prefix ending with `*`, or by sampling 1 out of every `rate` trace IDs.
+func NewPcapTraceScope(traceIDs []string, rate uint) *PcapTraceScope {
+	return transformer.NewTraceScope(traceIDs, rate)
+}
+
+// SplitPcapPayloadRules splits rules separated by `;`; use `\;` to match a literal `;`.
+func SplitPcapPayloadRules(rules string) []string {
+	return transformer.SplitPayloadRules(rules)
+}
+
+// ValidatePcapPayloadRules fails naming the first rule which is not `{name}={regex}` nor `{name}=hex:{bytes}`;
+// captures using invalid rules fail to start instead of ignoring them.
+func ValidatePcapPayloadRules(rules []string) error {
+	return transformer.ValidatePayloadRules(rules)
+}
+
+// NewPcapLogger returns a logger which writes JSON lines into `w` using Cloud Logging severities; i/e: to be set as `PcapConfig.Logger`.
+func NewPcapLogger(w io.Writer, level slog.Leveler) *slog.Logger {
+	return transformer.NewLogger(w, level)
+}
+
+// NewPcapPipelineTelemetry returns telemetry which traces 1 out of every `sampleRate` packets, and passes every trace to `onTrace`;
+// tracing is disabled if `sampleRate` is `0` or `onTrace` is `nil`.
+func NewPcapPipelineTelemetry(sampleRate uint, onTrace func(*PcapPipelineTrace)) *PcapPipelineTelemetry {
+	return transformer.NewPipelineTelemetry(sampleRate, onTrace)
+}
+
+// WatchPcapTraceScope adds the trace IDs listed in `path`, 1 per line, to `scope` every time the file is modified;
+// lines starting with `#` are ignored. It returns when `ctx` is done.
+func WatchPcapTraceScope(ctx context.Context, scope *PcapTraceScope, path string, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	var modTime time.Time
+	for {
+		if info, err := os.Stat(path); err == nil && info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+			if content, err := os.ReadFile(path); err == nil {
+				for _, line := range strings.Split(string(content), "\n") {
+					if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+						scope.Add(line)
+					}
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -17,16 +17,20 @@ package pcap
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
 	"reflect"
+	"slices"
+	"sync"
 	"time"
 	"unsafe"
 
 	"dario.cat/mergo"
+	"github.com/GoogleCloudPlatform/pcap-sidecar/pcap-cli/internal/transformer"
 	"github.com/easyCZ/logrotate"
 	"github.com/itchyny/timefmt-go"
 )
@@ -38,28 +42,71 @@ type (
 		io.Writer
 		io.Closer
 		Rotate()
+		Flush(context.Context) error
 		IsStdOutOrErr() bool
 		GetIface() *string
+		// files created so far; writers that do not create files return `nil`
+		Files() []string
 	}
 
+	// PcapRetargetableWriter is implemented by writers whose files may be moved to a new location while engines run.
+	PcapRetargetableWriter interface {
+		PcapWriter
+		// rotates the current file: the next one, and all files after it, are named after `template`
+		Retarget(template string) error
+	}
+
+	// pcapWriter uses `logrotate` to create files, but writes them using its own goroutine:
+	//   - `logrotate` cannot be asked to rotate, nor to flush, by its own goroutine, which is the only one allowed to touch files,
+	//   - so writes, rotations and flushes are all enqueued, and applied by `listen` in the same order they were enqueued.
 	pcapWriter struct {
 		*logrotate.Writer
-		iface            *string
-		isStdOutOrErr    bool
-		v                reflect.Value
-		osFile           reflect.Value
-		osFileSync       reflect.Value
-		bufioWriter      reflect.Value
-		bufioWriterFlush reflect.Value
+		iface         *string
+		isStdOutOrErr bool
+		logger        *log.Logger
+		// `*os.File` and `*bufio.Writer` of the current file; only `listen` may use them
+		osFile      reflect.Value
+		bufioWriter reflect.Value
+		// files are rotated by `listen` once they are older than `lifetime`, if it is positive
+		lifetime         time.Duration
+		rotatedAt        time.Time
+		queue            chan *pcapWriterOp
+		pending          sync.WaitGroup
+		closing, done    chan struct{}
+		closeOnce        sync.Once
+		fileNameProvider *pcapFileNameProvider
+		// written into files along with translations, if the format requires it; only `listen` may use them
+		header   transformer.PcapFileHeader
+		declared int
+	}
+
+	// pcapWriterOp is either a write of `data`, or an operation on the current file acknowledged through `result`.
+	pcapWriterOp struct {
+		data   []byte
+		apply  func() error
+		result chan error
 	}
 
 	pcapFileNameProvider struct {
+		// `logrotate` joins file names with the directory of the 1st template, even after retargeting
+		root      string
 		directory string
 		template  string
+		extension string
 		location  *time.Location
+		mu        sync.Mutex
+		files     []string
+		// files are described once they are complete: creating a file completes the previous one
+		manifests *pcapManifests
 	}
 )
 
+// same capacity as the queue of `logrotate`
+const pcapWriterQueueSize = 1024
+
+// only the most recent files are remembered: a short `interval` would otherwise grow the list forever
+const pcapWriterFilesLimit = 1024
+
 var defaultLogrotateOptions logrotate.Options = logrotate.Options{
 	Directory:            "/",
 	MaximumFileSize:      0,
@@ -69,7 +116,9 @@ var defaultLogrotateOptions logrotate.Options = logrotate.Options{
 }
 
 //go:linkname rotate github.com/easyCZ/logrotate.(*Writer).rotate
-func rotate(w *logrotate.Writer)
+func rotate(w *logrotate.Writer) error
+
+var errPcapWriterClosed = errors.New("writer is closed")
 
 func makeSetable(v reflect.Value) reflect.Value {
 	return reflect.NewAt(v.Type(), unsafe.Pointer(v.UnsafeAddr())).Elem()
@@ -83,15 +132,120 @@ func getSetableField(v reflect.Value, field string) reflect.Value {
 	return makeSetable(getField(v, field))
 }
 
+// Write enqueues a copy of `p`, as writers must not retain it: it is non-blocking unless the queue is full.
+func (w *pcapWriter) Write(p []byte) (int, error) {
+	if err := w.enqueue(context.Background(), &pcapWriterOp{data: slices.Clone(p)}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// enqueue rejects operations once the writer is closing; `pending` prevents closing the queue while enqueueing.
+func (w *pcapWriter) enqueue(ctx context.Context, op *pcapWriterOp) error {
+	select {
+	case <-w.closing:
+		return errPcapWriterClosed
+	default:
+		w.pending.Add(1)
+		defer w.pending.Done()
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case w.queue <- op:
+		return nil
+	}
+}
+
+// do applies `apply` once all writes enqueued before it were written, and waits for it unless `ctx` is done first.
+func (w *pcapWriter) do(ctx context.Context, apply func() error) error {
+	op := &pcapWriterOp{apply: apply, result: make(chan error, 1)}
+	if err := w.enqueue(ctx, op); err != nil {
+		return err
+	}
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("%d pending writes: %w", len(w.queue), ctx.Err())
+	case err := <-op.result:
+		return err
+	}
+}
+
+func (w *pcapWriter) listen() {
+	defer close(w.done)
+	for op := range w.queue {
+		if op.apply != nil {
+			op.result <- op.apply()
+			continue
+		}
+		w.write(op.data)
+	}
+}
+
+// write must only be called by `listen`.
+func (w *pcapWriter) write(data []byte) {
+	// files are lazily created to avoid empty files
+	if w.osFile.IsNil() || (w.lifetime > 0 && time.Since(w.rotatedAt) > w.lifetime) {
+		if err := w.rotate(); err != nil {
+			w.logger.Println("- ROTATE | error:", err)
+			return
+		}
+	}
+	if w.header != nil {
+		// `os.Std{out|err}` is shared by the writers of all engines: nothing written before is known to be there
+		if w.isStdOutOrErr {
+			w.declared = -1
+		}
+		var header []byte
+		header, w.declared = w.header.Header(data, w.declared)
+		data = append(header, data...)
+	}
+	if _, err := w.bufioWriter.Interface().(*bufio.Writer).Write(data); err != nil {
+		w.logger.Println("- WRITE | error:", err)
+	}
+}
+
+// rotate must only be called by `listen`.
+func (w *pcapWriter) rotate() error {
+	// see: https://pkg.go.dev/cmd/compile#:~:text=//-,go%3Alinkname,-localname%20%5Bimportpath.name
+	err := rotate(w.Writer)
+	w.rotatedAt = time.Now()
+	w.declared = -1
+	return err
+}
+
+// flush must only be called by `listen`.
+func (w *pcapWriter) flush() error {
+	// nothing has been written yet: files are lazily created
+	if w.bufioWriter.IsNil() {
+		return nil
+	}
+	if err := w.bufioWriter.Interface().(*bufio.Writer).Flush(); err != nil {
+		return err
+	}
+	// `os.Std{out|err}` may be pipes which do not support `fsync`
+	if w.isStdOutOrErr || w.osFile.IsNil() {
+		return nil
+	}
+	return w.osFile.Interface().(*os.File).Sync()
+}
+
+// Rotate is applied once all writes enqueued before it were written: it is safe while engines are writing.
 func (w *pcapWriter) Rotate() {
-	// if `PcapWriter` encapsulates `std[out|err]` do not rotate,
-	// just call `Flush` on the underlying `bufio.Writer` for `os.Std{out|err}`
+	// if `PcapWriter` encapsulates `std[out|err]` do not rotate
 	if w.isStdOutOrErr {
 		return
 	}
 
-	// see: https://pkg.go.dev/cmd/compile#:~:text=//-,go%3Alinkname,-localname%20%5Bimportpath.name
-	rotate(w.Writer)
+	if err := w.do(context.Background(), w.rotate); err != nil {
+		w.logger.Println("- ROTATE | error:", err)
+	}
+}
+
+// Flush waits for all accepted writes to be written, and then flushes the underlying `bufio.Writer` and syncs the `os.File`.
+func (w *pcapWriter) Flush(ctx context.Context) error {
+	return w.do(ctx, w.flush)
 }
 
 func (w *pcapWriter) GetIface() *string {
@@ -102,10 +256,122 @@ func (w *pcapWriter) IsStdOutOrErr() bool {
 	return w.isStdOutOrErr
 }
 
+// Close writes all accepted writes, and completes the current file: its manifest, if any, is written before returning.
+func (w *pcapWriter) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.closing)
+		w.pending.Wait()
+		close(w.queue)
+	})
+	<-w.done
+	// `logrotate` flushes and syncs the current file
+	err := w.Writer.Close()
+	if w.fileNameProvider != nil {
+		w.fileNameProvider.manifests.close()
+	}
+	return err
+}
+
+func (w *pcapWriter) Files() []string {
+	return w.fileNameProvider.getFiles()
+}
+
+// Queue reports the writes enqueued which did not reach the `bufio.Writer` yet.
+func (w *pcapWriter) Queue() (int, int) {
+	return len(w.queue), cap(w.queue)
+}
+
+func (w *pcapWriter) Retarget(template string) error {
+	if w.isStdOutOrErr {
+		return errors.New("stdout cannot be retargeted")
+	}
+	if err := w.fileNameProvider.retarget(template); err != nil {
+		return err
+	}
+	return w.do(context.Background(), w.rotate)
+}
+
+// retargetPcapWriter unwraps `writer` until it finds a `PcapRetargetableWriter`.
+func retargetPcapWriter(writer PcapWriter, template string) error {
+	switch w := writer.(type) {
+	case *routedPcapWriter:
+		return retargetPcapWriter(w.PcapWriter, template)
+	case *profiledPcapWriter:
+		return retargetPcapWriter(w.PcapWriter, template)
+	case PcapRetargetableWriter:
+		return w.Retarget(template)
+	}
+	return errors.New("writer cannot be retargeted")
+}
+
+// usePcapWriterHeader unwraps writers decorated by routes and profiles; `header` is set by the goroutine which writes files.
+func usePcapWriterHeader(writer PcapWriter, header transformer.PcapFileHeader) error {
+	switch w := writer.(type) {
+	case *routedPcapWriter:
+		return usePcapWriterHeader(w.PcapWriter, header)
+	case *profiledPcapWriter:
+		return usePcapWriterHeader(w.PcapWriter, header)
+	case *pcapWriter:
+		return w.do(context.Background(), func() error {
+			w.header = header
+			// headers written before were not written by `header`: whatever follows starts a new one
+			w.declared = -1
+			return nil
+		})
+	}
+	return nil
+}
+
+// get returns the name of the next file, relative to `root`.
 func (p *pcapFileNameProvider) get() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
 	fileName := timefmt.Format(time.Now().In(p.location), p.template)
 	pcapWriterLogger.Printf("new file: %s\n", fileName)
-	return fileName
+
+	if len(p.files) >= pcapWriterFilesLimit {
+		p.files = p.files[1:]
+	}
+	path := filepath.Join(p.directory, fileName)
+	p.files = append(p.files, path)
+	p.manifests.next(path)
+
+	if p.directory == p.root {
+		return fileName
+	}
+	if relativePath, err := filepath.Rel(p.root, path); err == nil {
+		return relativePath
+	}
+	// `root` and `directory` are not both absolute, nor both relative
+	root, _ := filepath.Abs(p.root)
+	path, _ = filepath.Abs(path)
+	relativePath, _ := filepath.Rel(root, path)
+	return relativePath
+}
+
+// retarget names all files created after it after `template`, which must not include the extension.
+func (p *pcapFileNameProvider) retarget(template string) error {
+	directory := filepath.Dir(template)
+	if err := os.MkdirAll(directory, os.ModePerm); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.directory = directory
+	p.template = fmt.Sprintf("%s.%s", filepath.Base(template), p.extension)
+	return nil
+}
+
+// getFiles returns the paths of all files named by this provider; `nil` safe.
+func (p *pcapFileNameProvider) getFiles() []string {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.files)
 }
 
 func getPcapWriterLocationForTimezone(timezone *string) *time.Location {
@@ -116,12 +382,16 @@ func getPcapWriterLocationForTimezone(timezone *string) *time.Location {
 	return location
 }
 
-func newPcapWriterFileNameProvider(template, timezone *string) *pcapFileNameProvider {
-	fileNameTemplate := *template
+func newPcapWriterFileNameProvider(template, extension, timezone *string) *pcapFileNameProvider {
+	fileNameTemplate := fmt.Sprintf("%s.%s", *template, *extension)
+	directory := filepath.Dir(fileNameTemplate)
 	return &pcapFileNameProvider{
-		directory: filepath.Dir(fileNameTemplate),
+		root:      directory,
+		directory: directory,
 		template:  filepath.Base(fileNameTemplate),
+		extension: *extension,
 		location:  getPcapWriterLocationForTimezone(timezone),
+		manifests: newPcapManifests(),
 	}
 }
 
@@ -129,26 +399,58 @@ func newPcapWriterForStdout(logger *log.Logger) (*logrotate.Writer, error) {
 	return logrotate.New(logger, defaultLogrotateOptions)
 }
 
-func newPcapWriter(logger *log.Logger, template, extension, timezone *string, interval *int) (*logrotate.Writer, error) {
+func newPcapWriter(
+	logger *log.Logger,
+	template, extension, timezone *string,
+	interval *int,
+) (*logrotate.Writer, *pcapFileNameProvider, error) {
 	var fileMaxLifetime time.Duration = 0 // time.Minute
 	if *interval > 0 {
 		fileMaxLifetime = time.Duration(*interval) * time.Second
 	}
 
-	fileNameTemplate := fmt.Sprintf("%s.%s", *template, *extension)
-	fileNameProvider := newPcapWriterFileNameProvider(&fileNameTemplate, timezone)
+	fileNameProvider := newPcapWriterFileNameProvider(template, extension, timezone)
 
 	options := logrotate.Options{
-		Directory:       fileNameProvider.directory,
+		Directory:       fileNameProvider.root,
 		MaximumLifetime: fileMaxLifetime,
 		FileNameFunc:    func() string { return fileNameProvider.get() },
 	}
 
 	if err := mergo.Merge(&options, defaultLogrotateOptions); err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	writer, err := logrotate.New(logger, options)
+	return writer, fileNameProvider, err
+}
+
+// flushPcapWriters concurrently flushes all `writers` within `timeout`;
+// it uses its own context as the engine's context is already done when it is invoked.
+// Writers which are still flushing when `timeout` expires are abandoned: a stuck sink must not block the engine.
+func flushPcapWriters(writers []PcapWriter, timeout *time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	errs := make([]error, 0, len(writers))
+	for _, writer := range writers {
+		wg.Add(1)
+		go func(writer PcapWriter) {
+			defer wg.Done()
+			if err := writer.Flush(ctx); err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		}(writer)
 	}
 
-	return logrotate.New(logger, options)
+	if err := waitOrDone(ctx, &wg); err != nil {
+		return fmt.Errorf("writers did not flush in time: %w", err)
+	}
+	return errors.Join(errs...)
 }
 
 func isStdoutPcapWriter(template, extension *string, interval *int) bool {
@@ -172,28 +474,26 @@ func NewPcapWriter(ctx context.Context, ifaceAndInfex, template, extension, time
 
 	var err error
 	var writer *logrotate.Writer
+	var fileNameProvider *pcapFileNameProvider
 
 	if isStdOutOrErr {
 		// Using `logrotate` to make `os.Stdout` safe to be concurrently written by PCAP engines
 		writer, err = newPcapWriterForStdout(logger)
 	} else {
-		writer, err = newPcapWriter(logger, template, extension, timezone, &interval)
+		writer, fileNameProvider, err = newPcapWriter(logger, template, extension, timezone, &interval)
 	}
 
 	if err != nil {
 		return nil, err
 	}
 
-	// `logrotate` does not provide handles to `*bufio.Writer::Flush`/`*os.File::Syinc`
+	// `logrotate` does not provide handles to `*bufio.Writer::Flush`/`*os.File::Sync`
 	// the underlying Writer/File so it is necessary to get handles on them.
-	// Since PCAP engines are started atomically and current execution must complete
-	// before a new one can be started; it is safe to `flush` and `sync` PCAP files.
+	// Its own goroutine never sees any writes, so the goroutine of `pcapWriter` is the only one using them.
 	// https://github.com/easyCZ/logrotate/blob/master/writer.go
 	v := reflect.ValueOf(writer)
 	osFile := getSetableField(v, "f")
-	osFileSync := osFile.MethodByName("Sync")
 	bufioWriter := getSetableField(v, "bw")
-	bufioWriterFlush := bufioWriter.MethodByName("Flush")
 
 	if isStdOutOrErr {
 		// injecting `os.Stdout` into `logrotate.Writer` instance
@@ -201,16 +501,38 @@ func NewPcapWriter(ctx context.Context, ifaceAndInfex, template, extension, time
 		bufioWriter.Set(reflect.ValueOf(bufio.NewWriterSize(os.Stdout, 1)))
 	}
 
-	w := &pcapWriter{writer, ifaceAndInfex, isStdOutOrErr, v, osFile, osFileSync, bufioWriter, bufioWriterFlush}
+	w := &pcapWriter{
+		Writer:           writer,
+		iface:            ifaceAndInfex,
+		isStdOutOrErr:    isStdOutOrErr,
+		logger:           logger,
+		osFile:           osFile,
+		bufioWriter:      bufioWriter,
+		rotatedAt:        time.Now(),
+		queue:            make(chan *pcapWriterOp, pcapWriterQueueSize),
+		closing:          make(chan struct{}),
+		done:             make(chan struct{}),
+		fileNameProvider: fileNameProvider,
+		declared:         -1,
+	}
+	if interval > 0 {
+		w.lifetime = time.Duration(interval) * time.Second
+	}
 
-	go func(ctx context.Context, writer *logrotate.Writer, block bool) {
+	go w.listen()
+
+	go func(ctx context.Context, w *pcapWriter, block bool) {
 		if !block {
 			return
 		}
 		<-ctx.Done()
 		logger.Println("- ROTATE")
-		rotate(writer)
-	}(ctx, writer, !isStdOutOrErr)
+		fileNameProvider.manifests.stop()
+		// rotating is enqueued: it never runs concurrently with writes nor flushes
+		if err := w.do(context.Background(), w.rotate); err != nil && !errors.Is(err, errPcapWriterClosed) {
+			logger.Println("- ROTATE | error:", err)
+		}
+	}(ctx, w, !isStdOutOrErr)
 
 	logger.Println("- created")
 
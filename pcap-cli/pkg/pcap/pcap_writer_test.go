@@ -0,0 +1,147 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPcapWriterRotateWhileWriting verifies that rotating, retargeting and flushing files while they are being written
+// neither races with writes nor truncates nor interleaves them; run it using `-race`.
+func TestPcapWriterRotateWhileWriting(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	directory := t.TempDir()
+	iface := "test"
+	template, extension, timezone := filepath.Join(directory, "capture-%H%M%S%f"), "json", "UTC"
+	writer, err := NewPcapWriter(ctx, &iface, &template, &extension, &timezone, 0)
+	require.NoError(t, err)
+
+	const writers, lines = 4, 500
+	var wg sync.WaitGroup
+	for i := range writers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := range lines {
+				fmt.Fprintf(writer, "{\"writer\":%d,\"line\":%d}\n", i, j)
+			}
+		}(i)
+	}
+
+	retargeted := filepath.Join(directory, "retargeted", "capture-%H%M%S%f")
+	for i := range 20 {
+		writer.Rotate()
+		if i == 10 {
+			assert.NoError(t, writer.(PcapRetargetableWriter).Retarget(retargeted))
+		}
+		assert.NoError(t, writer.Flush(ctx))
+	}
+
+	wg.Wait()
+	assert.NoError(t, writer.Close())
+	// closed writers reject writes and rotations instead of panicking
+	_, err = writer.Write([]byte("{}\n"))
+	assert.ErrorIs(t, err, errPcapWriterClosed)
+	writer.Rotate()
+
+	written := 0
+	for _, file := range writer.Files() {
+		f, err := os.Open(file)
+		require.NoError(t, err)
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var writer, line int
+			_, err := fmt.Sscanf(scanner.Text(), "{\"writer\":%d,\"line\":%d}", &writer, &line)
+			assert.NoError(t, err, scanner.Text())
+			written += 1
+		}
+		f.Close()
+	}
+	assert.Equal(t, writers*lines, written)
+	assert.Greater(t, len(writer.Files()), 1)
+	assert.Equal(t, filepath.Join(directory, "retargeted"), filepath.Dir(writer.Files()[len(writer.Files())-1]))
+}
+
+// pcapWriterTestHeader declares 1 line per file.
+type pcapWriterTestHeader struct{}
+
+func (pcapWriterTestHeader) Header(_ []byte, declared int) ([]byte, int) {
+	if declared < 0 {
+		return []byte("#header\n"), 0
+	}
+	return nil, declared
+}
+
+// TestPcapWriterHeader verifies that headers are written once at the start of every file, even if files are rotated while writing.
+func TestPcapWriterHeader(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	directory := t.TempDir()
+	iface := "test"
+	template, extension, timezone := filepath.Join(directory, "capture-%H%M%S%f"), "pcapng", "UTC"
+	writer, err := NewPcapWriter(ctx, &iface, &template, &extension, &timezone, 0)
+	require.NoError(t, err)
+	require.NoError(t, usePcapWriterHeader(&routedPcapWriter{PcapWriter: writer}, pcapWriterTestHeader{}))
+
+	const writers, lines = 4, 250
+	var wg sync.WaitGroup
+	for i := range writers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := range lines {
+				fmt.Fprintf(writer, "%d:%d\n", i, j)
+			}
+		}(i)
+	}
+	for range 10 {
+		writer.Rotate()
+	}
+	wg.Wait()
+	require.NoError(t, writer.Close())
+
+	written := 0
+	for _, file := range writer.Files() {
+		f, err := os.Open(file)
+		require.NoError(t, err)
+		scanner := bufio.NewScanner(f)
+		for i := 0; scanner.Scan(); i++ {
+			if i == 0 {
+				assert.Equal(t, "#header", scanner.Text(), file)
+				continue
+			}
+			assert.NotEqual(t, "#header", scanner.Text(), file)
+			written += 1
+		}
+		f.Close()
+	}
+	assert.Equal(t, writers*lines, written)
+}
@@ -0,0 +1,138 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+type (
+	// PcapTelemetryExporter exports the telemetry of the pipelines translating packets of all engines:
+	//   - set `Telemetry()` as `PcapContextPipelineTelemetry`; a single exporter may be shared by all engines,
+	//   - stats of all stages are exported as cumulative metrics every `telemetryExportInterval`, along with traces of sampled packets,
+	//   - traces produced faster than they are exported are dropped; `Close` exports pending traces, and stats as of then.
+	PcapTelemetryExporter struct {
+		endpoint  string
+		logger    *log.Logger
+		telemetry *PcapPipelineTelemetry
+		sink      pcapTelemetrySink
+		mu        *sync.Mutex
+		traces    []*PcapPipelineTrace
+		dropped   uint64
+		done      chan struct{}
+	}
+
+	// pcapTelemetrySink encodes, and sends, telemetry to a collector; i/e: using OTLP.
+	pcapTelemetrySink interface {
+		export(context.Context, time.Time, []PcapPipelineStageStats, []*PcapPipelineTrace) error
+		Close() error
+	}
+)
+
+const (
+	telemetryExportInterval = 10 * time.Second
+	telemetryExportTimeout  = 10 * time.Second
+	telemetryMaxTraces      = 1024
+)
+
+// Telemetry measures the pipelines of all engines whose context holds it as `PcapContextPipelineTelemetry`.
+func (x *PcapTelemetryExporter) Telemetry() *PcapPipelineTelemetry {
+	return x.telemetry
+}
+
+func (x *PcapTelemetryExporter) onTrace(trace *PcapPipelineTrace) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if len(x.traces) >= telemetryMaxTraces {
+		x.dropped += 1
+		return
+	}
+	x.traces = append(x.traces, trace)
+}
+
+func (x *PcapTelemetryExporter) export(ctx context.Context) error {
+	x.mu.Lock()
+	traces, dropped := x.traces, x.dropped
+	x.traces, x.dropped = make([]*PcapPipelineTrace, 0, len(traces)), 0
+	x.mu.Unlock()
+
+	if dropped > 0 {
+		x.logger.Printf("dropped %d traces: sampling rate is too high\n", dropped)
+	}
+
+	err := x.sink.export(ctx, x.telemetry.CreatedAt(), x.telemetry.Stats(), traces)
+	if err != nil {
+		x.logger.Printf("failed to export telemetry: %v\n", err)
+	}
+	return err
+}
+
+func (x *PcapTelemetryExporter) exportPeriodically() {
+	ticker := time.NewTicker(telemetryExportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-x.done:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), telemetryExportTimeout)
+			x.export(ctx)
+			cancel()
+		}
+	}
+}
+
+// Close must be called once all engines are stopped: the last export describes all packets they translated.
+func (x *PcapTelemetryExporter) Close() error {
+	close(x.done)
+	ctx, cancel := context.WithTimeout(context.Background(), telemetryExportTimeout)
+	defer cancel()
+	err := x.export(ctx)
+	return errors.Join(err, x.sink.Close())
+}
+
+// NewPcapTelemetryExporter exports telemetry to the OTLP/gRPC `endpoint`; 1 out of every `sampleRate` packets is traced, and none if it is 0.
+func NewPcapTelemetryExporter(endpoint string, sampleRate uint) (*PcapTelemetryExporter, error) {
+	loggerPrefix := fmt.Sprintf("[pcap/telemetry] - [%s] - ", endpoint)
+	logger := log.New(os.Stderr, loggerPrefix, log.LstdFlags)
+
+	sink, err := newOTLPTelemetrySink(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	x := &PcapTelemetryExporter{
+		endpoint: endpoint,
+		logger:   logger,
+		sink:     sink,
+		mu:       new(sync.Mutex),
+		traces:   make([]*PcapPipelineTrace, 0),
+		done:     make(chan struct{}),
+	}
+	x.telemetry = NewPcapPipelineTelemetry(sampleRate, x.onTrace)
+
+	go x.exportPeriodically()
+
+	logger.Printf("created | traced packets: 1/%d\n", sampleRate)
+
+	return x, nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"sort"
+	"strings"
+)
+
+type (
+	// PcapRoutes maps writer targets to the routes of records they accept;
+	// i/e: `stdout@severity=error;/pcap/dns@proto=dns;/pcap/http@proto=http`.
+	PcapRoutes map[string][]string
+
+	routedPcapWriter struct {
+		PcapWriter
+		routes []string
+	}
+)
+
+const (
+	pcapRoutesSeparator = ";"
+	pcapRouteSeparator  = "@"
+)
+
+// NewPcapRoutes parses `;` separated `{target}@{route}` rules:
+//   - many rules may share the same target: its writer accepts records matching any of them,
+//   - rules without route make their target accept all records.
+func NewPcapRoutes(rules string) PcapRoutes {
+	routes := make(PcapRoutes)
+	for _, rule := range strings.Split(rules, pcapRoutesSeparator) {
+		target, route, _ := strings.Cut(strings.TrimSpace(rule), pcapRouteSeparator)
+		if target = strings.TrimSpace(target); target == "" {
+			continue
+		}
+		routes[target] = append(routes[target], strings.TrimSpace(route))
+	}
+	return routes
+}
+
+// Targets returns all targets in lexicographical order.
+func (r PcapRoutes) Targets() []string {
+	targets := make([]string, 0, len(r))
+	for target := range r {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+// Route returns `writer` as-is if `target` has no routes, so that it keeps accepting all records.
+func (r PcapRoutes) Route(target string, writer PcapWriter) PcapWriter {
+	routes, ok := r[target]
+	if !ok || writer == nil {
+		return writer
+	}
+	return &routedPcapWriter{PcapWriter: writer, routes: routes}
+}
+
+// Route is used by transformers to select which records are written by this writer.
+func (w *routedPcapWriter) Route() []string {
+	return w.routes
+}
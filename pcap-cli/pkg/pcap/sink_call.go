@@ -0,0 +1,97 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	sinkCallAttempts = 3
+	sinkCallBackoff  = 500 * time.Millisecond
+
+	// used when engines are not given a stop deadline in time, and `PcapConfig.DrainDeadline` is not set
+	pcapDefaultStopDeadline = 2 * time.Second
+)
+
+// callSink invokes `call` up to `sinkCallAttempts` times, every attempt is bound to its own `timeout`:
+//   - attempts are retried with exponential backoff, unless `ctx` is done,
+//   - the error of the last attempt is returned along with the reason why `ctx` is done, if it is.
+func callSink(ctx context.Context, timeout time.Duration, call func(context.Context) error) error {
+	backoff := sinkCallBackoff
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := call(attemptCtx)
+		cancel()
+
+		if err == nil {
+			return nil
+		}
+		if attempt == sinkCallAttempts {
+			return fmt.Errorf("%d attempts: %w", attempt, err)
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(fmt.Errorf("%d attempts: %w", attempt, err), ctx.Err())
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// waitOrDone waits for `wg` unless `ctx` is done first.
+func waitOrDone(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// awaitStopDeadline returns when an engine must be stopped after its context was done at `ctxDoneTS`:
+// engines must not hang if the stop deadline is never provided.
+func awaitStopDeadline(stopDeadline <-chan *time.Duration, ctxDoneTS time.Time, drainDeadline time.Duration) time.Time {
+	if drainDeadline <= 0 {
+		drainDeadline = pcapDefaultStopDeadline
+	}
+
+	timer := time.NewTimer(drainDeadline)
+	defer timer.Stop()
+
+	select {
+	case deadline, ok := <-stopDeadline:
+		if ok && deadline != nil {
+			return ctxDoneTS.Add(*deadline)
+		}
+		return ctxDoneTS.Add(drainDeadline)
+	case <-timer.C:
+		// nobody is coordinating this engine's stop: give it a fresh deadline
+		return time.Now().Add(drainDeadline)
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errSinkCallTest = errors.New("sink unavailable")
+
+// TestCallSink verifies that sink calls are retried until they succeed or attempts are exhausted, and that every attempt has its own timeout.
+func TestCallSink(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		failures int
+		attempts int
+		wantErr  bool
+	}{
+		{"first_attempt", 0, 1, false},
+		{"after_failures", 2, 3, false},
+		{"exhausted", sinkCallAttempts, sinkCallAttempts, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			timeout := time.Minute
+			attempts := 0
+
+			err := callSink(context.Background(), timeout, func(ctx context.Context) error {
+				attempts++
+				deadline, ok := ctx.Deadline()
+				require.True(t, ok)
+				assert.WithinDuration(t, time.Now().Add(timeout), deadline, time.Second)
+				if attempts <= tt.failures {
+					return errSinkCallTest
+				}
+				return nil
+			})
+
+			assert.Equal(t, tt.attempts, attempts)
+			if tt.wantErr {
+				require.ErrorIs(t, err, errSinkCallTest)
+				assert.Contains(t, err.Error(), fmt.Sprintf("%d attempts", sinkCallAttempts))
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+// TestCallSinkDone verifies that sink calls are not retried once the context is done, and that the reason is returned along with the last error.
+func TestCallSinkDone(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+
+	err := callSink(ctx, time.Minute, func(context.Context) error {
+		attempts++
+		cancel()
+		return errSinkCallTest
+	})
+
+	assert.Equal(t, 1, attempts)
+	require.ErrorIs(t, err, errSinkCallTest)
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Contains(t, err.Error(), "1 attempts")
+}
+
+// TestWaitOrDone verifies that waiting for a wait group returns as soon as either the group is done or the context is done.
+func TestWaitOrDone(t *testing.T) {
+	t.Parallel()
+
+	t.Run("group_done", func(t *testing.T) {
+		t.Parallel()
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			wg.Done()
+		}()
+
+		require.NoError(t, waitOrDone(context.Background(), &wg))
+	})
+
+	t.Run("context_done", func(t *testing.T) {
+		t.Parallel()
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		defer wg.Done()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		require.ErrorIs(t, waitOrDone(ctx, &wg), context.DeadlineExceeded)
+	})
+}
+
+// TestAwaitStopDeadline verifies that stop deadlines are relative to when the context was done, and that engines are given one if nobody provides it.
+func TestAwaitStopDeadline(t *testing.T) {
+	t.Parallel()
+
+	ctxDoneTS := time.Now().Add(-time.Second)
+	deadline := 5 * time.Second
+
+	tests := []struct {
+		name          string
+		drainDeadline time.Duration
+		send          func(chan *time.Duration)
+		want          time.Time
+	}{
+		{
+			name:          "provided",
+			drainDeadline: time.Second,
+			send:          func(c chan *time.Duration) { c <- &deadline },
+			want:          ctxDoneTS.Add(deadline),
+		},
+		{
+			name:          "nil",
+			drainDeadline: time.Second,
+			send:          func(c chan *time.Duration) { c <- nil },
+			want:          ctxDoneTS.Add(time.Second),
+		},
+		{
+			name:          "closed",
+			drainDeadline: time.Second,
+			send:          func(c chan *time.Duration) { close(c) },
+			want:          ctxDoneTS.Add(time.Second),
+		},
+		{
+			name:          "default_drain_deadline",
+			drainDeadline: 0,
+			send:          func(c chan *time.Duration) { close(c) },
+			want:          ctxDoneTS.Add(pcapDefaultStopDeadline),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			stopDeadline := make(chan *time.Duration, 1)
+			tt.send(stopDeadline)
+
+			assert.Equal(t, tt.want, awaitStopDeadline(stopDeadline, ctxDoneTS, tt.drainDeadline))
+		})
+	}
+
+	t.Run("never_provided", func(t *testing.T) {
+		t.Parallel()
+
+		drainDeadline := 20 * time.Millisecond
+		start := time.Now()
+
+		got := awaitStopDeadline(make(chan *time.Duration), ctxDoneTS, drainDeadline)
+
+		// the deadline is relative to when waiting for it timed out, not to when the context was done
+		assert.False(t, got.Before(start.Add(2*drainDeadline)))
+	})
+}
@@ -15,13 +15,17 @@
 package pcap
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"syscall"
@@ -33,10 +37,52 @@ import (
 
 var tcpdumpLogger = log.New(os.Stderr, "[tcpdump] - ", log.LstdFlags)
 
+// `tcpdump` reports `listening on {iface}` after the handle is activated and the filter is compiled
+var tcpdumpReadySignal = []byte("listening on")
+
+// `tcpdump` reports `{count} packets captured` when it exits
+var tcpdumpPacketsCaptured = regexp.MustCompile(`(?m)^(\d+) packets? captured`)
+
+// tcpdumpReadinessWriter flags `tcpdump` as ready when it reports that it is listening,
+// and keeps the number of captured packets reported on exit; output is passed through.
+type tcpdumpReadinessWriter struct {
+	io.Writer
+	isReady *atomic.Bool
+	packets *atomic.Uint64
+}
+
+func (w *tcpdumpReadinessWriter) Write(p []byte) (int, error) {
+	if !w.isReady.Load() && bytes.Contains(p, tcpdumpReadySignal) {
+		w.isReady.Store(true)
+	}
+	if match := tcpdumpPacketsCaptured.FindSubmatch(p); match != nil {
+		if packets, err := strconv.ParseUint(string(match[1]), 10, 64); err == nil {
+			w.packets.Add(packets)
+		}
+	}
+	return w.Writer.Write(p)
+}
+
 func (t *Tcpdump) IsActive() bool {
 	return t.isActive.Load()
 }
 
+func (t *Tcpdump) IsReady() bool {
+	return t.isReady.Load()
+}
+
+// Stats only include the number of captured packets: packets captured by `tcpdump` are not translated.
+func (t *Tcpdump) Stats() *PcapStats {
+	return &PcapStats{Packets: t.packets.Load()}
+}
+
+func (t *Tcpdump) Filter() string {
+	if filter := t.filter.Load(); filter != nil {
+		return *filter
+	}
+	return ""
+}
+
 func (t *Tcpdump) buildArgs(ctx context.Context) []string {
 	cfg := t.config
 
@@ -55,7 +101,8 @@ func (t *Tcpdump) buildArgs(ctx context.Context) []string {
 
 	if !cfg.Compat {
 		if filter := providePcapFilter(ctx,
-			&cfg.Filter, cfg.Filters); *filter != "" {
+			&cfg.Filter, cfg.Filters, cfg.Exclude, cfg.CompatFilters, nil /* profiles */); *filter != "" {
+			t.filter.Store(filter)
 			args = append(args, *filter)
 		}
 	}
@@ -113,7 +160,7 @@ func (t *Tcpdump) Start(
 	}
 
 	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd.Stderr = &tcpdumpReadinessWriter{Writer: os.Stderr, isReady: t.isReady, packets: t.packets}
 	cmd.WaitDelay = 1900 * time.Millisecond
 
 	cmdLine := strings.Join(cmd.Args[:], " ")
@@ -138,8 +185,7 @@ func (t *Tcpdump) Start(
 		cmdStopChan <- cmd.Wait()
 	}(cmd, cmdStopChan)
 
-	engineStopDeadline := <-stopDeadline
-	engineStopTimeout := *engineStopDeadline - time.Since(ctxDoneTS)
+	engineStopTimeout := time.Until(awaitStopDeadline(stopDeadline, ctxDoneTS, t.config.DrainDeadline))
 	timer := time.NewTimer(engineStopTimeout)
 
 	var err error
@@ -157,7 +203,9 @@ func (t *Tcpdump) Start(
 	killedProcs, numProcs, killErr := t.findAndKill(pid)
 	tcpdumpLogger.Printf("STOP [tcpdump(%d)] <%d/%d>: %+v\n", pid, killedProcs, numProcs, cmdLine)
 
+	t.isReady.Store(false)
 	t.isActive.Store(false)
+	t.filter.Store(nil)
 
 	return errors.Join(ctx.Err(), err, killErr)
 }
@@ -168,9 +216,21 @@ func NewTcpdump(config *PcapConfig) (PcapEngine, error) {
 		return nil, fmt.Errorf("tcpdump is unavailable")
 	}
 
-	var isActive atomic.Bool
-	isActive.Store(false)
+	if err := validatePcapFilter(config); err != nil {
+		return nil, err
+	}
 
-	tcpdump := Tcpdump{config: config, tcpdump: tcpdumpBin, isActive: &isActive}
+	var isActive, isReady atomic.Bool
+	isActive.Store(false)
+	isReady.Store(false)
+
+	tcpdump := Tcpdump{
+		config:   config,
+		tcpdump:  tcpdumpBin,
+		isActive: &isActive,
+		isReady:  &isReady,
+		filter:   new(atomic.Pointer[string]),
+		packets:  new(atomic.Uint64),
+	}
 	return &tcpdump, nil
 }
@@ -0,0 +1,30 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package schema provides the machine-readable schemas of translations.
+package schema
+
+import _ "embed"
+
+var (
+	// JSON is the JSON Schema of translations produced by the `json` format.
+	//
+	//go:embed json/translation.schema.json
+	JSON []byte
+
+	// Proto is the Protocol Buffers definition of translations produced by the `proto` format.
+	//
+	//go:embed proto/packet.proto
+	Proto []byte
+)
@@ -28,4 +28,5 @@ const (
 	PCAP_OSWMEM PcapEvent = "PCAP_OSWMEM"
 	PCAP_SIGNAL PcapEvent = "PCAP_SIGNAL"
 	PCAP_FSLOCK PcapEvent = "PCAP_FSLOCK"
+	PCAP_ROLLUP PcapEvent = "PCAP_ROLLUP"
 )
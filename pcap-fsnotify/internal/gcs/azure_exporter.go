@@ -0,0 +1,113 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcs
+
+import (
+	"context"
+	"io"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/GoogleCloudPlatform/pcap-sidecar/pcap-fsnotify/internal/log"
+	"github.com/pkg/errors"
+	sf "github.com/wissance/stringFormatter"
+	"go.uber.org/zap/zapcore"
+)
+
+type (
+	azureUploader struct {
+		container string
+		client    *azblob.Client
+	}
+)
+
+func (u *azureUploader) upload(
+	ctx context.Context,
+	name string,
+	reader io.Reader,
+) error {
+	// block blobs are uploaded in chunks, so the size of the PCAP file is not required in advance
+	_, err := u.client.UploadStream(ctx, u.container, name, reader, nil)
+	return err
+}
+
+func newAzureClient(
+	accountURL string,
+) (*azblob.Client, error) {
+	credential, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create Azure credential")
+	}
+
+	client, err := azblob.NewClient(accountURL, credential, &azblob.ClientOptions{
+		ClientOptions: policy.ClientOptions{
+			// uploads are retried by the exporter
+			Retry: policy.RetryOptions{
+				MaxRetries: -1,
+			},
+		},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create Azure Blob client")
+	}
+
+	return client, nil
+}
+
+// NewAzureExporter creates an exporter which uploads PCAP files into an Azure Blob Storage container:
+//   - `accountURL` is the Blob service endpoint; i/e: `https://${ACCOUNT}.blob.core.windows.net/`,
+//   - credentials are resolved using the Azure SDK default chain; i/e: environment, workload identity, managed identity.
+func NewAzureExporter(
+	logger *log.Logger,
+	accountURL string,
+	container string,
+	directory string,
+	maxRetries uint,
+	retriesDelay uint,
+) Exporter {
+	x := newExporter(logger, directory, maxRetries, retriesDelay)
+
+	client, err := newAzureClient(accountURL)
+	if err == nil {
+		logger.LogEvent(
+			zapcore.InfoLevel,
+			sf.Format("initialized Azure Blob exporter with container: {0}", container),
+			PCAP_EXPORT,
+			map[string]any{
+				"account":   accountURL,
+				"container": container,
+			},
+			nil)
+
+		return newObjectExporter(x, &azureUploader{
+			container: container,
+			client:    client,
+		})
+	}
+
+	logger.LogEvent(
+		zapcore.ErrorLevel,
+		"failed to create PCAP files exporter",
+		PCAP_EXPORT,
+		map[string]any{
+			"account":   accountURL,
+			"container": container,
+		},
+		err)
+
+	// return the NIL exporter by default
+	return NewNilExporter(logger)
+}
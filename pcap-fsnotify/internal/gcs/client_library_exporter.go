@@ -17,7 +17,6 @@ package gcs
 import (
 	"context"
 	"fmt"
-	"strings"
 	"time"
 
 	"cloud.google.com/go/storage"
@@ -177,23 +176,13 @@ func (x *libraryExporter) setHeaders(
 	)
 }
 
-func (x *libraryExporter) newObjectName(
-	srcPcapFile *string,
-	compress bool,
-) string {
-	tgtPcapFile := x.toTargetPcapFile(srcPcapFile, compress)
-	parts := strings.Split(tgtPcapFile, "/")
-	// skip local directory: `${0}/${1:PCAP_DIR}/...`
-	return strings.Join(parts[2:], "/")
-}
-
 func (x *libraryExporter) Export(
 	ctx context.Context,
 	srcPcapFile *string,
 	compress bool,
 	delete bool,
 ) (*string, *int64, error) {
-	tgtPcapFile := x.newObjectName(srcPcapFile, compress)
+	tgtPcapFile := x.toObjectName(srcPcapFile, compress)
 
 	object := x.newObject(srcPcapFile, &tgtPcapFile)
 
@@ -21,6 +21,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/GoogleCloudPlatform/pcap-sidecar/pcap-fsnotify/internal/constants"
@@ -172,28 +173,90 @@ func (x *exporter) export(
 		nil)
 
 	if delete {
-		// remove the source PCAP file if copying is sucessful
-		err = os.Remove(*srcPcapFile)
-		if err != nil {
-			x.logger.LogFsEvent(
-				zapcore.ErrorLevel,
-				fmt.Sprintf("failed to DELETE file: %s", *srcPcapFile),
-				PCAP_EXPORT,
-				*srcPcapFile,
-				*tgtPcapFile,
-				pcapBytes,
-				err)
-		} else {
-			x.logger.LogFsEvent(
-				zapcore.InfoLevel,
-				fmt.Sprintf("DELETED: %s", *srcPcapFile),
-				PCAP_EXPORT,
-				*srcPcapFile,
-				*tgtPcapFile,
-				pcapBytes,
-				nil)
-		}
+		x.deleteSource(srcPcapFile, tgtPcapFile, pcapBytes)
 	}
 
 	return pcapBytes, nil
 }
+
+// deleteSource removes the source PCAP file; it must only be called after the file is exported.
+func (x *exporter) deleteSource(
+	srcPcapFile *string,
+	tgtPcapFile *string,
+	pcapBytes int64,
+) {
+	if err := os.Remove(*srcPcapFile); err != nil {
+		x.logger.LogFsEvent(
+			zapcore.ErrorLevel,
+			fmt.Sprintf("failed to DELETE file: %s", *srcPcapFile),
+			PCAP_EXPORT,
+			*srcPcapFile,
+			*tgtPcapFile,
+			pcapBytes,
+			err)
+	} else {
+		x.logger.LogFsEvent(
+			zapcore.InfoLevel,
+			fmt.Sprintf("DELETED: %s", *srcPcapFile),
+			PCAP_EXPORT,
+			*srcPcapFile,
+			*tgtPcapFile,
+			pcapBytes,
+			nil)
+	}
+}
+
+// exportStream copies the source PCAP file into a pipe which is consumed by `upload`:
+//   - `upload` is used by exporters whose clients read objects' content, instead of providing a `Writer`,
+//   - the source PCAP file is only deleted after `upload` succeeds.
+func (x *exporter) exportStream(
+	srcPcapFile *string,
+	tgtPcapFile *string,
+	compress bool,
+	delete bool,
+	upload func(io.Reader) error,
+) (int64, error) {
+	reader, writer := io.Pipe()
+	result := make(chan int64, 1)
+
+	go func() {
+		pcapBytes, err := x.export(srcPcapFile, tgtPcapFile, writer, compress, false /* delete */)
+		// `upload` gets `EOF` if `err` is `nil`
+		writer.CloseWithError(err)
+		result <- pcapBytes
+	}()
+
+	err := upload(reader)
+	// unblocks `export` if `upload` failed before reading the whole PCAP file
+	reader.CloseWithError(err)
+	pcapBytes := <-result
+
+	if err != nil {
+		x.logger.LogFsEvent(
+			zapcore.ErrorLevel,
+			fmt.Sprintf("failed to UPLOAD file: %s", *srcPcapFile),
+			PCAP_EXPORT,
+			*srcPcapFile,
+			*tgtPcapFile,
+			pcapBytes,
+			err)
+		return pcapBytes, errors.Wrapf(err, "failed to UPLOAD file: %s", *srcPcapFile)
+	}
+
+	if delete {
+		x.deleteSource(srcPcapFile, tgtPcapFile, pcapBytes)
+	}
+
+	return pcapBytes, nil
+}
+
+// toObjectName returns the name of the object for the source PCAP file within a bucket or container.
+func (x *exporter) toObjectName(
+	srcPcapFile *string,
+	compress bool,
+) string {
+	tgtPcapFile := x.toTargetPcapFile(srcPcapFile, compress)
+	parts := strings.Split(tgtPcapFile, "/")
+	// skip local directory: `${0}/${1:PCAP_DIR}/...`
+	return strings.Join(parts[2:], "/")
+}
@@ -0,0 +1,81 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcs
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/avast/retry-go/v4"
+	"go.uber.org/zap/zapcore"
+)
+
+type (
+	// objectUploader uploads the content of a PCAP file as an object into a bucket or container.
+	objectUploader interface {
+		upload(ctx context.Context, name string, reader io.Reader) error
+	}
+
+	// objectExporter streams PCAP files into object storages which are not GCS; i/e: AWS S3, Azure Blob Storage.
+	objectExporter struct {
+		*exporter
+		uploader objectUploader
+	}
+)
+
+func newObjectExporter(
+	x *exporter,
+	uploader objectUploader,
+) *objectExporter {
+	return &objectExporter{
+		exporter: x,
+		uploader: uploader,
+	}
+}
+
+func (x *objectExporter) Export(
+	ctx context.Context,
+	srcPcapFile *string,
+	compress bool,
+	delete bool,
+) (*string, *int64, error) {
+	tgtPcapFile := x.toObjectName(srcPcapFile, compress)
+
+	// every attempt streams the whole PCAP file again, as the content of a failed upload cannot be read twice
+	pcapBytes, err := retry.DoWithData(func() (int64, error) {
+		return x.exportStream(srcPcapFile, &tgtPcapFile, compress, delete,
+			func(reader io.Reader) error {
+				return x.uploader.upload(ctx, tgtPcapFile, reader)
+			})
+	},
+		retry.Context(ctx),
+		retry.Attempts(x.maxRetries),
+		retry.Delay(x.retriesDelay),
+		retry.DelayType(retry.FixedDelay),
+		retry.LastErrorOnly(true),
+		retry.OnRetry(func(n uint, err error) {
+			x.logger.LogFsEvent(
+				zapcore.WarnLevel,
+				fmt.Sprintf("failed to UPLOAD file at attempt %d: %v", n+1, *srcPcapFile),
+				PCAP_EXPORT,
+				*srcPcapFile,
+				tgtPcapFile,
+				0,
+				err)
+		}))
+
+	return &tgtPcapFile, &pcapBytes, err
+}
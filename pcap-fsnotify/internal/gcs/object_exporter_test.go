@@ -0,0 +1,185 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/pcap-sidecar/pcap-fsnotify/internal/log"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type (
+	objectExporterTestUploader struct {
+		mu       sync.Mutex
+		failures int
+		attempts int
+		names    []string
+		objects  map[string][]byte
+	}
+)
+
+var (
+	objectExporterTestError   = errors.New("upload failed")
+	objectExporterTestContent = bytes.Repeat([]byte("pcap"), 4096)
+)
+
+func (u *objectExporterTestUploader) upload(
+	ctx context.Context,
+	name string,
+	reader io.Reader,
+) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.attempts++
+	u.names = append(u.names, name)
+
+	if u.attempts <= u.failures {
+		// fail after the upload started, so that the PCAP file must be streamed again
+		io.CopyN(io.Discard, reader, 1)
+		return objectExporterTestError
+	}
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	u.objects[name] = content
+	return nil
+}
+
+func newObjectExporterTest(
+	t *testing.T,
+	maxRetries uint,
+	failures int,
+) (*objectExporter, *objectExporterTestUploader, string) {
+	t.Helper()
+
+	srcPcapFile := filepath.Join(t.TempDir(), "part__0_eth0__20240101T000000.pcap")
+	require.NoError(t, os.WriteFile(srcPcapFile, objectExporterTestContent, 0o644))
+
+	uploader := &objectExporterTestUploader{
+		failures: failures,
+		objects:  make(map[string][]byte),
+	}
+
+	logger := log.NewLogger("test", "test", "test", "test", "test", "test", "test")
+	x := newObjectExporter(newExporter(logger, "/pcap", maxRetries, 0), uploader)
+
+	return x, uploader, srcPcapFile
+}
+
+// TestObjectExporterNames verifies that objects are named after the source PCAP file without the local directory.
+func TestObjectExporterNames(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		directory string
+		src       string
+		compress  bool
+		want      string
+	}{
+		{"plain", "/pcap", "/pcap-tmp/part__0_eth0__20240101T000000.pcap", false, "pcap-tmp/part__0_eth0__20240101T000000.pcap"},
+		{"compressed", "/pcap", "/pcap-tmp/part__0_eth0__20240101T000000.pcap", true, "pcap-tmp/part__0_eth0__20240101T000000.pcap.gz"},
+		{"nested", "/pcap", "/pcap-tmp/eth0/part__0_eth0__20240101T000000.pcapng", false, "pcap-tmp/eth0/part__0_eth0__20240101T000000.pcapng"},
+		{"trailing_slash", "/pcap/", "/pcap-tmp/part__0_eth0__20240101T000000.pcap", false, "pcap-tmp/part__0_eth0__20240101T000000.pcap"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			x := newExporter(nil, tt.directory, 1, 0)
+			assert.Equal(t, tt.want, x.toObjectName(&tt.src, tt.compress))
+		})
+	}
+}
+
+// TestObjectExporterRetries verifies that failed uploads stream the whole PCAP file again, and that it is only deleted after the upload succeeds.
+func TestObjectExporterRetries(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		maxRetries uint
+		failures   int
+		attempts   int
+		wantErr    bool
+	}{
+		{"first_attempt", 3, 0, 1, false},
+		{"after_failures", 3, 2, 3, false},
+		{"exhausted", 3, 5, 3, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			x, uploader, srcPcapFile := newObjectExporterTest(t, tt.maxRetries, tt.failures)
+			wantName := strings.TrimPrefix(srcPcapFile, "/")
+
+			tgtPcapFile, pcapBytes, err := x.Export(context.Background(), &srcPcapFile, false /* compress */, true /* delete */)
+
+			assert.Equal(t, wantName, *tgtPcapFile)
+			assert.Equal(t, tt.attempts, uploader.attempts)
+			for _, name := range uploader.names {
+				assert.Equal(t, wantName, name)
+			}
+
+			if tt.wantErr {
+				require.ErrorIs(t, err, objectExporterTestError)
+				assert.Empty(t, uploader.objects)
+				assert.FileExists(t, srcPcapFile)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, int64(len(objectExporterTestContent)), *pcapBytes)
+			assert.Equal(t, objectExporterTestContent, uploader.objects[wantName])
+			assert.NoFileExists(t, srcPcapFile)
+		})
+	}
+}
+
+// TestObjectExporterCompress verifies that compressed PCAP files are uploaded as gzip objects with the `gz` suffix.
+func TestObjectExporterCompress(t *testing.T) {
+	t.Parallel()
+
+	x, uploader, srcPcapFile := newObjectExporterTest(t, 1, 0)
+
+	tgtPcapFile, _, err := x.Export(context.Background(), &srcPcapFile, true /* compress */, false /* delete */)
+	require.NoError(t, err)
+
+	assert.Equal(t, strings.TrimPrefix(srcPcapFile, "/")+".gz", *tgtPcapFile)
+	assert.FileExists(t, srcPcapFile)
+
+	reader, err := gzip.NewReader(bytes.NewReader(uploader.objects[*tgtPcapFile]))
+	require.NoError(t, err)
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, objectExporterTestContent, content)
+}
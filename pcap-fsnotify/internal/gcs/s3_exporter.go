@@ -0,0 +1,96 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcs
+
+import (
+	"context"
+	"io"
+
+	"github.com/GoogleCloudPlatform/pcap-sidecar/pcap-fsnotify/internal/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	sf "github.com/wissance/stringFormatter"
+	"go.uber.org/zap/zapcore"
+)
+
+type (
+	s3Uploader struct {
+		bucket   string
+		uploader *manager.Uploader
+	}
+)
+
+func (u *s3Uploader) upload(
+	ctx context.Context,
+	name string,
+	reader io.Reader,
+) error {
+	// multipart uploads do not require to know the size of the PCAP file in advance
+	_, err := u.uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(u.bucket),
+		Key:    aws.String(name),
+		Body:   reader,
+	})
+	return err
+}
+
+// NewS3Exporter creates an exporter which uploads PCAP files into an AWS S3 bucket:
+//   - credentials and region are resolved using the AWS SDK default chain; i/e: `AWS_REGION`, IRSA, instance profiles.
+func NewS3Exporter(
+	ctx context.Context,
+	logger *log.Logger,
+	bucket string,
+	directory string,
+	maxRetries uint,
+	retriesDelay uint,
+) Exporter {
+	x := newExporter(logger, directory, maxRetries, retriesDelay)
+
+	cfg, err := config.LoadDefaultConfig(ctx,
+		// uploads are retried by the exporter
+		config.WithRetryMaxAttempts(1),
+		config.WithAppID("pcap-sidecar"),
+	)
+	if err == nil {
+		logger.LogEvent(
+			zapcore.InfoLevel,
+			sf.Format("initialized S3 exporter with bucket: {0}", bucket),
+			PCAP_EXPORT,
+			map[string]any{
+				"bucket": bucket,
+				"region": cfg.Region,
+			},
+			nil)
+
+		return newObjectExporter(x, &s3Uploader{
+			bucket:   bucket,
+			uploader: manager.NewUploader(s3.NewFromConfig(cfg)),
+		})
+	}
+
+	logger.LogEvent(
+		zapcore.ErrorLevel,
+		"failed to create PCAP files exporter",
+		PCAP_EXPORT,
+		map[string]any{
+			"bucket": bucket,
+		},
+		err)
+
+	// return the NIL exporter by default
+	return NewNilExporter(logger)
+}
@@ -0,0 +1,320 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollup
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/pcap-sidecar/pcap-fsnotify/internal/constants"
+	"github.com/GoogleCloudPlatform/pcap-sidecar/pcap-fsnotify/internal/log"
+	"github.com/pkg/errors"
+	"go.uber.org/zap/zapcore"
+)
+
+type (
+	// Compactor produces per-minute rollups from rotated JSON translations:
+	//   - rollups aggregate packets per destination and protocol,
+	//   - raw JSON files and rollups are deleted after their own retention period.
+	Compactor struct {
+		logger          *log.Logger
+		rawDirectory    string
+		rollupDirectory string
+		rawRetention    time.Duration
+		rollupRetention time.Duration
+	}
+
+	// translation contains the subset of JSON translations fields required to produce rollups
+	translation struct {
+		Meta struct {
+			Len       int64     `json:"len"`
+			Timestamp time.Time `json:"timestamp"`
+		} `json:"meta"`
+		Iface struct {
+			Name string `json:"name"`
+		} `json:"iface"`
+		Flow string `json:"flow"`
+		L2   *struct {
+			Type string `json:"type"`
+		} `json:"L2"`
+		ARP *struct{} `json:"ARP"`
+		L3  *struct {
+			Dst   string `json:"dst"`
+			Proto struct {
+				Name string `json:"name"`
+			} `json:"proto"`
+		} `json:"L3"`
+		L4 *struct {
+			Dst uint16 `json:"dst"`
+		} `json:"L4"`
+		Err []json.RawMessage `json:"err"`
+	}
+
+	rollupKey struct {
+		minute time.Time
+		iface  string
+		proto  string
+		dst    string
+		port   uint16
+	}
+
+	// Rollup is the aggregate of all packets sent to the same destination using the same protocol within a minute.
+	Rollup struct {
+		Minute  time.Time `json:"minute"`
+		Iface   string    `json:"iface"`
+		Proto   string    `json:"proto"`
+		Dst     string    `json:"dst,omitempty"`
+		Port    uint16    `json:"port,omitempty"`
+		Packets uint64    `json:"packets"`
+		Bytes   int64     `json:"bytes"`
+		Flows   int       `json:"flows"`
+		Errors  uint64    `json:"errors"`
+		Source  string    `json:"source"`
+
+		flows map[string]struct{}
+	}
+)
+
+const (
+	PCAP_ROLLUP = constants.PCAP_ROLLUP
+
+	rollupFilePrefix = "rollup__"
+	rollupFileExt    = ".json"
+	// translations may be larger than the default `bufio.Scanner` buffer
+	maxTranslationSize = 1024 * 1024
+)
+
+var (
+	// rotated JSON files exported by `pcapfsn`; compressed or not
+	rawFileRegex = regexp.MustCompile(`^part__.+\.json(?:\.gz)?$`)
+
+	rollupFileRegex = regexp.MustCompile(`^` + rollupFilePrefix + `.+\` + rollupFileExt + `$`)
+)
+
+func (t *translation) toRollupKey() *rollupKey {
+	key := &rollupKey{
+		minute: t.Meta.Timestamp.UTC().Truncate(time.Minute),
+		iface:  t.Iface.Name,
+	}
+
+	switch {
+	case t.L3 != nil:
+		key.proto = t.L3.Proto.Name
+		key.dst = t.L3.Dst
+		if t.L4 != nil {
+			key.port = t.L4.Dst
+		}
+	case t.ARP != nil:
+		key.proto = "ARP"
+	case t.L2 != nil:
+		key.proto = t.L2.Type
+	default:
+		key.proto = "unknown"
+	}
+
+	return key
+}
+
+// Compact aggregates all translations in the JSON file `srcFile`, and writes the resulting rollups into a new file.
+func (c *Compactor) Compact(ctx context.Context, srcFile string) (string, error) {
+	file, err := os.Open(srcFile)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to open JSON file: %s", srcFile)
+	}
+	defer file.Close()
+
+	source := filepath.Base(srcFile)
+	rollups := make(map[rollupKey]*Rollup)
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxTranslationSize)
+
+	invalid := 0
+	for scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+
+		t := &translation{}
+		if err := json.Unmarshal(scanner.Bytes(), t); err != nil || t.Meta.Timestamp.IsZero() {
+			invalid += 1
+			continue
+		}
+
+		key := t.toRollupKey()
+		rollup, ok := rollups[*key]
+		if !ok {
+			rollup = &Rollup{
+				Minute: key.minute,
+				Iface:  key.iface,
+				Proto:  key.proto,
+				Dst:    key.dst,
+				Port:   key.port,
+				Source: source,
+				flows:  make(map[string]struct{}),
+			}
+			rollups[*key] = rollup
+		}
+
+		rollup.Packets += 1
+		rollup.Bytes += t.Meta.Len
+		rollup.Errors += uint64(len(t.Err))
+		rollup.flows[t.Flow] = struct{}{}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", errors.Wrapf(err, "failed to read JSON file: %s", srcFile)
+	}
+
+	if invalid > 0 {
+		c.logger.LogFsEvent(zapcore.WarnLevel,
+			fmt.Sprintf("skipped %d invalid translations", invalid), PCAP_ROLLUP, srcFile, "", 0, nil)
+	}
+
+	if len(rollups) == 0 {
+		return "", nil
+	}
+
+	return c.write(source, rollups)
+}
+
+func (c *Compactor) write(source string, rollups map[rollupKey]*Rollup) (string, error) {
+	if err := os.MkdirAll(c.rollupDirectory, 0o755); err != nil {
+		return "", errors.Wrapf(err, "failed to create rollups directory: %s", c.rollupDirectory)
+	}
+
+	name := rollupFilePrefix + strings.TrimSuffix(source, filepath.Ext(source)) + rollupFileExt
+	tgtFile := filepath.Join(c.rollupDirectory, name)
+
+	file, err := os.OpenFile(tgtFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o666)
+	if err != nil {
+		return tgtFile, errors.Wrapf(err, "failed to create rollups file: %s", tgtFile)
+	}
+	defer file.Close()
+
+	// sorting makes rollups files easier to read and diff
+	lines := make([]*Rollup, 0, len(rollups))
+	for _, rollup := range rollups {
+		rollup.Flows = len(rollup.flows)
+		lines = append(lines, rollup)
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		if !lines[i].Minute.Equal(lines[j].Minute) {
+			return lines[i].Minute.Before(lines[j].Minute)
+		}
+		return lines[i].Packets > lines[j].Packets
+	})
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, rollup := range lines {
+		if err := encoder.Encode(rollup); err != nil {
+			return tgtFile, errors.Wrapf(err, "failed to write rollups file: %s", tgtFile)
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		return tgtFile, errors.Wrapf(err, "failed to write rollups file: %s", tgtFile)
+	}
+
+	return tgtFile, nil
+}
+
+func (c *Compactor) prune(directory string, fileRegex *regexp.Regexp, retention time.Duration) uint32 {
+	if retention <= 0 {
+		return 0
+	}
+
+	deadline := time.Now().Add(-retention)
+	deletedFiles := uint32(0)
+
+	filepath.WalkDir(directory, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || !fileRegex.MatchString(entry.Name()) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(deadline) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			c.logger.LogFsEvent(zapcore.ErrorLevel,
+				fmt.Sprintf("failed to DELETE expired file: %s", path), PCAP_ROLLUP, path, "", info.Size(), err)
+			return nil
+		}
+		deletedFiles += 1
+		return nil
+	})
+
+	return deletedFiles
+}
+
+// Prune deletes raw JSON files and rollups older than their retention periods.
+func (c *Compactor) Prune() {
+	rawFiles := c.prune(c.rawDirectory, rawFileRegex, c.rawRetention)
+	rollupFiles := c.prune(c.rollupDirectory, rollupFileRegex, c.rollupRetention)
+
+	if rawFiles > 0 || rollupFiles > 0 {
+		c.logger.LogEvent(zapcore.InfoLevel,
+			fmt.Sprintf("deleted %d raw JSON files and %d rollups files", rawFiles, rollupFiles),
+			PCAP_ROLLUP, map[string]any{"raw": rawFiles, "rollups": rollupFiles}, nil)
+	}
+}
+
+// Start prunes expired files every `interval` until `ctx` is done.
+func (c *Compactor) Start(ctx context.Context, interval time.Duration) {
+	if c.rawRetention <= 0 && c.rollupRetention <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.Prune()
+		}
+	}
+}
+
+// NewCompactor creates a compactor that writes rollups into `rollupDirectory`:
+//   - raw JSON files are looked up at `rawDirectory`; i/e: the GCS Fuse mount point,
+//   - retention periods of zero disable deleting files.
+func NewCompactor(
+	logger *log.Logger,
+	rawDirectory string,
+	rollupDirectory string,
+	rawRetention time.Duration,
+	rollupRetention time.Duration,
+) *Compactor {
+	return &Compactor{
+		logger:          logger,
+		rawDirectory:    rawDirectory,
+		rollupDirectory: rollupDirectory,
+		rawRetention:    rawRetention,
+		rollupRetention: rollupRetention,
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollup
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/pcap-sidecar/pcap-fsnotify/internal/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var compactorTestMinute = time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+func newCompactorTest(t *testing.T) (*Compactor, string, string) {
+	t.Helper()
+
+	rawDirectory := filepath.Join(t.TempDir(), "raw")
+	rollupDirectory := filepath.Join(t.TempDir(), "rollups")
+	require.NoError(t, os.MkdirAll(rawDirectory, 0o755))
+
+	logger := log.NewLogger("test", "test", "test", "test", "test", "test", "test")
+	return NewCompactor(logger, rawDirectory, rollupDirectory, time.Hour, time.Hour), rawDirectory, rollupDirectory
+}
+
+func newCompactorTestTranslation(offset time.Duration, flow, dst string, port uint16, length int64, errs int) string {
+	translation := map[string]any{
+		"meta":  map[string]any{"len": length, "timestamp": compactorTestMinute.Add(offset)},
+		"iface": map[string]any{"name": "eth0"},
+		"flow":  flow,
+		"L3":    map[string]any{"dst": dst, "proto": map[string]any{"name": "TCP"}},
+		"L4":    map[string]any{"dst": port},
+	}
+	if errs > 0 {
+		translation["err"] = make([]string, errs)
+	}
+	line, _ := json.Marshal(translation)
+	return string(line)
+}
+
+func writeCompactorTestFile(t *testing.T, directory, name string, lines ...string) string {
+	t.Helper()
+
+	file := filepath.Join(directory, name)
+	require.NoError(t, os.WriteFile(file, []byte(strings.Join(lines, "\n")+"\n"), 0o644))
+	return file
+}
+
+func readCompactorTestRollups(t *testing.T, file string) []*Rollup {
+	t.Helper()
+
+	f, err := os.Open(file)
+	require.NoError(t, err)
+	defer f.Close()
+
+	rollups := []*Rollup{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		rollup := &Rollup{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), rollup))
+		rollups = append(rollups, rollup)
+	}
+	require.NoError(t, scanner.Err())
+	return rollups
+}
+
+// TestCompact verifies that translations are aggregated per minute and destination, and that rollups are sorted by minute and then by packets.
+func TestCompact(t *testing.T) {
+	t.Parallel()
+
+	c, rawDirectory, rollupDirectory := newCompactorTest(t)
+
+	srcFile := writeCompactorTestFile(t, rawDirectory, "part__0_eth0__20240101T100000.json",
+		// the 2nd minute is written first, so that rollups must be sorted
+		newCompactorTestTranslation(time.Minute+time.Second, "f3", "10.0.0.3", 443, 10, 0),
+		newCompactorTestTranslation(time.Second, "f1", "10.0.0.1", 443, 100, 0),
+		newCompactorTestTranslation(2*time.Second, "f2", "10.0.0.2", 80, 50, 1),
+		newCompactorTestTranslation(3*time.Second, "f1", "10.0.0.1", 443, 200, 0),
+		"not a translation",
+		`{"meta":{"len":1}}`,
+		newCompactorTestTranslation(4*time.Second, "f4", "10.0.0.1", 443, 300, 2),
+		newCompactorTestTranslation(5*time.Second, "f2", "10.0.0.2", 80, 50, 0),
+		newCompactorTestTranslation(6*time.Second, "f1", "10.0.0.1", 443, 400, 0),
+	)
+
+	tgtFile, err := c.Compact(context.Background(), srcFile)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(rollupDirectory, "rollup__part__0_eth0__20240101T100000.json"), tgtFile)
+
+	rollups := readCompactorTestRollups(t, tgtFile)
+	require.Len(t, rollups, 3)
+
+	expected := []Rollup{
+		{Minute: compactorTestMinute, Dst: "10.0.0.1", Port: 443, Packets: 4, Bytes: 1000, Flows: 2, Errors: 2},
+		{Minute: compactorTestMinute, Dst: "10.0.0.2", Port: 80, Packets: 2, Bytes: 100, Flows: 1, Errors: 1},
+		{Minute: compactorTestMinute.Add(time.Minute), Dst: "10.0.0.3", Port: 443, Packets: 1, Bytes: 10, Flows: 1, Errors: 0},
+	}
+	for i, want := range expected {
+		t.Run(fmt.Sprintf("rollup_%d", i), func(t *testing.T) {
+			t.Parallel()
+
+			got := rollups[i]
+			assert.True(t, want.Minute.Equal(got.Minute))
+			assert.Equal(t, "eth0", got.Iface)
+			assert.Equal(t, "TCP", got.Proto)
+			assert.Equal(t, want.Dst, got.Dst)
+			assert.Equal(t, want.Port, got.Port)
+			assert.Equal(t, want.Packets, got.Packets)
+			assert.Equal(t, want.Bytes, got.Bytes)
+			assert.Equal(t, want.Flows, got.Flows)
+			assert.Equal(t, want.Errors, got.Errors)
+			assert.Equal(t, filepath.Base(srcFile), got.Source)
+		})
+	}
+}
+
+// TestCompactWithoutTranslations verifies that no rollups file is written if the JSON file contains no valid translations.
+func TestCompactWithoutTranslations(t *testing.T) {
+	t.Parallel()
+
+	c, rawDirectory, rollupDirectory := newCompactorTest(t)
+
+	srcFile := writeCompactorTestFile(t, rawDirectory, "part__0_eth0__20240101T100000.json", "not a translation")
+
+	tgtFile, err := c.Compact(context.Background(), srcFile)
+	require.NoError(t, err)
+	assert.Empty(t, tgtFile)
+	assert.NoDirExists(t, rollupDirectory)
+}
+
+// TestCompactCancelled verifies that compacting stops once the context is done.
+func TestCompactCancelled(t *testing.T) {
+	t.Parallel()
+
+	c, rawDirectory, rollupDirectory := newCompactorTest(t)
+
+	srcFile := writeCompactorTestFile(t, rawDirectory, "part__0_eth0__20240101T100000.json",
+		newCompactorTestTranslation(time.Second, "f1", "10.0.0.1", 443, 100, 0))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := c.Compact(ctx, srcFile)
+	require.ErrorIs(t, err, context.Canceled)
+	assert.NoDirExists(t, rollupDirectory)
+}
+
+// TestPrune verifies that only raw JSON files and rollups older than their retention periods are deleted.
+func TestPrune(t *testing.T) {
+	t.Parallel()
+
+	c, rawDirectory, rollupDirectory := newCompactorTest(t)
+	require.NoError(t, os.MkdirAll(rollupDirectory, 0o755))
+
+	expired := time.Now().Add(-2 * time.Hour)
+
+	files := []struct {
+		path    string
+		expired bool
+		deleted bool
+	}{
+		{filepath.Join(rawDirectory, "part__0_eth0__20240101T100000.json"), true, true},
+		{filepath.Join(rawDirectory, "part__1_eth0__20240101T100100.json.gz"), true, true},
+		{filepath.Join(rawDirectory, "part__2_eth0__20240101T100200.json"), false, false},
+		{filepath.Join(rawDirectory, "part__3_eth0__20240101T100300.pcap"), true, false},
+		{filepath.Join(rollupDirectory, "rollup__part__0_eth0__20240101T100000.json"), true, true},
+		{filepath.Join(rollupDirectory, "rollup__part__2_eth0__20240101T100200.json"), false, false},
+	}
+
+	for _, file := range files {
+		require.NoError(t, os.WriteFile(file.path, []byte("{}\n"), 0o644))
+		if file.expired {
+			require.NoError(t, os.Chtimes(file.path, expired, expired))
+		}
+	}
+
+	c.Prune()
+
+	for _, file := range files {
+		if file.deleted {
+			assert.NoFileExists(t, file.path)
+		} else {
+			assert.FileExists(t, file.path)
+		}
+	}
+}
@@ -35,6 +35,7 @@ import (
 	"github.com/GoogleCloudPlatform/pcap-sidecar/pcap-fsnotify/internal/constants"
 	"github.com/GoogleCloudPlatform/pcap-sidecar/pcap-fsnotify/internal/gcs"
 	"github.com/GoogleCloudPlatform/pcap-sidecar/pcap-fsnotify/internal/log"
+	"github.com/GoogleCloudPlatform/pcap-sidecar/pcap-fsnotify/internal/rollup"
 	"github.com/alphadose/haxmap"
 	"github.com/fsnotify/fsnotify"
 	"github.com/gofrs/flock"
@@ -55,6 +56,7 @@ const (
 	PCAP_OSWMEM = constants.PCAP_OSWMEM
 	PCAP_SIGNAL = constants.PCAP_SIGNAL
 	PCAP_FSLOCK = constants.PCAP_FSLOCK
+	PCAP_ROLLUP = constants.PCAP_ROLLUP
 )
 
 const (
@@ -62,6 +64,8 @@ const (
 	dockerCgroupMemoryUtilization = "/sys/fs/cgroup/memory.current"
 	procSysVmDropCaches           = "/proc/sys/vm/drop_caches"
 	pcapLockFile                  = "/var/lock/pcap.lock"
+	// manifests are written next to the files they describe by `tcpdumpw`; see `PCAP_MANIFESTS`
+	pcapManifestExtension = ".manifest.json"
 )
 
 var (
@@ -82,7 +86,15 @@ var (
 	gcs_export    = flag.Bool("gcs_export", true, "export PCAP files to GCS")
 	gcs_fuse      = flag.Bool("gcs_fuse", true, "export PCAP files using GCS Fuse")
 	gcs_bucket    = flag.String("gcs_bucket", "", "export PCAP files to this GCS bucket")
+	export_target = flag.String("export_target", "gcs", "object storage to export PCAP files to; any of: gcs, s3, azure")
+	s3_bucket     = flag.String("s3_bucket", "", "export PCAP files to this AWS S3 bucket; requires 'export_target' to be 's3'")
+	azure_account = flag.String("azure_account_url", "", "Azure Blob Storage endpoint; requires 'export_target' to be 'azure'")
+	azure_cont    = flag.String("azure_container", "", "export PCAP files to this Azure Blob Storage container")
 	instance_id   = flag.String("instance_id", "", "compute resource hosting the PCAP sidecar")
+	rollups       = flag.Bool("rollups", false, "produce per-minute rollups from JSON files")
+	rollups_dir   = flag.String("rollups_dir", "", "rollups destination directory; defaults to 'rollups' within 'gcs_dir'")
+	raw_ttl       = flag.Uint("raw_ttl", 0, "hours after which exported JSON files are deleted; 0 disables deleting them")
+	rollups_ttl   = flag.Uint("rollups_ttl", 0, "hours after which rollups are deleted; 0 disables deleting them")
 )
 
 var (
@@ -99,6 +111,8 @@ var (
 var (
 	logger   = log.NewLogger(projectID, service, gcpRegion, version, instanceID, sidecar, module)
 	exporter = gcs.NewNilExporter(logger)
+	// only available if rollups are enabled
+	compactor *rollup.Compactor = nil
 
 	counters *haxmap.Map[string, *atomic.Uint64]
 	lastPcap *haxmap.Map[string, string]
@@ -114,6 +128,27 @@ func movePcapToGcs(
 	return exporter.Export(ctx, srcPcap, compress, delete)
 }
 
+// rollupJSONFile must be called before exporting `srcFile`, as exporting deletes it.
+func rollupJSONFile(
+	ctx context.Context,
+	srcFile *string,
+	ext string,
+) {
+	if compactor == nil || ext != "json" {
+		return
+	}
+
+	rollupStart := time.Now()
+	tgtFile, err := compactor.Compact(ctx, *srcFile)
+	if err != nil {
+		logger.LogFsEvent(zapcore.ErrorLevel,
+			fmt.Sprintf("failed to ROLLUP file: %s", *srcFile), PCAP_ROLLUP, *srcFile, tgtFile, 0, err)
+		return
+	}
+	logger.LogFsEvent(zapcore.InfoLevel,
+		fmt.Sprintf("ROLLUP: %s (%s)", *srcFile, time.Since(rollupStart).String()), PCAP_ROLLUP, *srcFile, tgtFile, 0, nil)
+}
+
 func getCurrentMemoryUtilization(isGAE bool) (uint64, error) {
 	var err error
 	var memoryUtilizationFilePath string
@@ -155,6 +190,23 @@ func flushBuffers() (int, error) {
 	return fmt.Fprintln(fd, "3")
 }
 
+// exportPcapManifest exports manifests as soon as they are created: they are renamed into place only once complete.
+func exportPcapManifest(
+	ctx context.Context,
+	srcFile *string,
+	delete bool,
+) bool {
+	tgtFile, manifestBytes, moveErr := movePcapToGcs(ctx, srcFile, false /* compress */, delete)
+	if moveErr != nil {
+		logger.LogFsEvent(zapcore.ErrorLevel,
+			fmt.Sprintf("failed to export manifest: %s", *srcFile), PCAP_FSNERR, *srcFile, *tgtFile /* target PCAP file */, 0, moveErr)
+		return false
+	}
+	logger.LogFsEvent(zapcore.InfoLevel,
+		fmt.Sprintf("exported manifest: %s", *tgtFile), PCAP_EXPORT, *srcFile, *tgtFile, *manifestBytes, nil)
+	return true
+}
+
 func exportPcapFile(
 	ctx context.Context,
 	wg *sync.WaitGroup,
@@ -168,6 +220,10 @@ func exportPcapFile(
 		return false
 	}
 
+	if strings.HasSuffix(*srcFile, pcapManifestExtension) {
+		return exportPcapManifest(ctx, srcFile, delete)
+	}
+
 	rMatch := pcapDotExt.FindStringSubmatch(*srcFile)
 	if len(rMatch) == 0 || len(rMatch) < 3 {
 		return false
@@ -183,6 +239,7 @@ func exportPcapFile(
 	if flush {
 		logger.LogFsEvent(zapcore.InfoLevel,
 			fmt.Sprintf("flushing PCAP file: [%s] (%s/%s) %s", key, ext, iface, *srcFile), PCAP_EXPORT, *srcFile, "" /* target PCAP file */, 0, nil)
+		rollupJSONFile(ctx, srcFile, ext)
 		tgtPcapFileName, pcapBytes, moveErr := movePcapToGcs(ctx, srcFile, compress, delete)
 		if moveErr != nil {
 			logger.LogFsEvent(zapcore.ErrorLevel,
@@ -220,6 +277,7 @@ func exportPcapFile(
 
 	logger.LogFsEvent(zapcore.InfoLevel,
 		fmt.Sprintf("exporting PCAP file: (%s/%s/%d) %s", ext, iface, iteration, *srcFile), PCAP_EXPORT, lastPcapFileName, "" /* target PCAP file */, 0, nil)
+	rollupJSONFile(ctx, &lastPcapFileName, ext)
 	// move non-current PCAP file into `gcs_dir` which means that:
 	// 1. the GCS Bucket should have already been mounted
 	// 2. the directory hierarchy to store PCAP files already exists
@@ -299,11 +357,13 @@ func main() {
 		"gcs_export": *gcs_export,
 		"gcs_fuse":   *gcs_fuse,
 		"gcs_bucket": *gcs_bucket,
+		"export_to":  *export_target,
 		"pcap_ext":   pcapDotExt.String(),
 		"interval":   watchdogInterval.String(),
 		"gzip":       *gzip_pcaps,
 		"rt_env":     *rt_env,
 		"pcap_debug": *pcap_debug,
+		"rollups":    *rollups,
 	}
 
 	logger.LogEvent(zapcore.InfoLevel, "starting PCAP filesystem watcher", PCAP_FSNINI, args, nil)
@@ -323,13 +383,29 @@ func main() {
 
 	if *gcs_export {
 		// if GCS export is disabled, the PCAP files `exporter` is already initialized using `NewNilExporter`
-		if *gcs_fuse {
+		switch {
+		case strings.EqualFold(*export_target, "s3"):
+			exporter = gcs.NewS3Exporter(ctx, logger, *s3_bucket, *gcs_dir, *retries_max, *retries_delay)
+		case strings.EqualFold(*export_target, "azure"):
+			exporter = gcs.NewAzureExporter(logger, *azure_account, *azure_cont, *gcs_dir, *retries_max, *retries_delay)
+		case *gcs_fuse:
 			exporter = gcs.NewFuseExporter(logger, *gcs_dir, *retries_max, *retries_delay)
-		} else {
+		default:
 			exporter = gcs.NewClientLibraryExporter(ctx, logger, projectID, service, instanceID, *gcs_bucket, *gcs_dir, *retries_max, *retries_delay)
 		}
 	}
 
+	if *rollups {
+		rollupsDir := *rollups_dir
+		if rollupsDir == "" {
+			rollupsDir = filepath.Join(*gcs_dir, "rollups")
+		}
+		compactor = rollup.NewCompactor(logger, *gcs_dir, rollupsDir,
+			time.Duration(*raw_ttl)*time.Hour, time.Duration(*rollups_ttl)*time.Hour)
+		// expired files are deleted at the same pace at which new files are produced
+		go compactor.Start(ctx, watchdogInterval)
+	}
+
 	var wg sync.WaitGroup
 
 	// Watch the PCAP files source directory for FS events.
@@ -355,6 +431,9 @@ func main() {
 				if event.Has(fsnotify.Create) && pcapDotExt.MatchString(event.Name) {
 					wg.Add(1)
 					exportPcapFile(ctx, wg, pcapDotExt, &event.Name, *gzip_pcaps /* compress */, true /* delete */, false /* flush */)
+				} else if event.Has(fsnotify.Create) && strings.HasSuffix(event.Name, pcapManifestExtension) {
+					wg.Add(1)
+					go exportPcapFile(ctx, wg, pcapDotExt, &event.Name, false /* compress */, true /* delete */, false /* flush */)
 				} else if event.Has(fsnotify.Create) && tcpdumpwExitSignal.MatchString(event.Name) && isActive.CompareAndSwap(true, false) {
 					// `tcpdumpw` signals its termination by creating the file `TCPDUMPW_EXITED` is the source directory
 					tcpdumpwExitTS := time.Now()
@@ -0,0 +1,137 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// `pcap-wait` wraps workloads which must not start before the PCAP sidecar is capturing packets:
+//   - the workload is started when the PCAP sidecar signals that packet capturing is ready,
+//   - when the workload exits, the PCAP sidecar is signaled to stop packet capturing,
+//     and `pcap-wait` exits with the workload exit code once packet capturing is flushed.
+//
+// usage: pcap-wait [flags] -- command [args...]
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// files shared with `tcpdumpw` via `sync_dir`
+const (
+	readyFile          = "PCAP_READY"
+	workloadExitedFile = "WORKLOAD_EXITED"
+	flushedFile        = "PCAP_FLUSHED"
+)
+
+const pollInterval = 100 * time.Millisecond
+
+var (
+	sync_dir      = flag.String("sync_dir", "/pcap-sync", "directory shared with the PCAP sidecar")
+	ready_timeout = flag.Duration("ready_timeout", 60*time.Second, "how long to wait for packet capturing to be ready")
+	flush_timeout = flag.Duration("flush_timeout", 30*time.Second, "how long to wait for packet capturing to be flushed after the workload exits")
+	strict        = flag.Bool("strict", false, "do not start the workload if packet capturing is not ready on time")
+)
+
+var logger = log.New(os.Stderr, "[pcap-wait] - ", log.LstdFlags)
+
+// awaitFile returns `false` if `path` does not exist after `timeout`.
+func awaitFile(path string, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// exitCode follows shell conventions: workloads terminated by a signal exit with `128 + signal`.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return 1
+	}
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return exitErr.ExitCode()
+}
+
+func main() {
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		logger.Println("usage: pcap-wait [flags] -- command [args...]")
+		os.Exit(2)
+	}
+
+	if awaitFile(filepath.Join(*sync_dir, readyFile), *ready_timeout) {
+		logger.Println("packet capturing is ready")
+	} else if *strict {
+		logger.Printf("packet capturing is not ready after %v\n", *ready_timeout)
+		os.Exit(1)
+	} else {
+		logger.Printf("packet capturing is not ready after %v: starting workload anyway\n", *ready_timeout)
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	// signals must be handled before the workload starts, so none of them terminates `pcap-wait`
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP, syscall.SIGQUIT)
+
+	if err := cmd.Start(); err != nil {
+		logger.Printf("failed to start workload: %v\n", err)
+		os.Exit(127)
+	}
+
+	// the workload decides how to handle signals; `pcap-wait` exits when the workload does
+	go func() {
+		for s := range signals {
+			cmd.Process.Signal(s)
+		}
+	}()
+
+	code := exitCode(cmd.Wait())
+	signal.Stop(signals)
+	logger.Printf("workload exited: %d\n", code)
+
+	// `tcpdumpw` stops packet capturing when the workload exits, and signals when all writers are flushed
+	if err := os.WriteFile(filepath.Join(*sync_dir, workloadExitedFile),
+		[]byte(strconv.Itoa(code)), 0o666); err != nil {
+		logger.Printf("failed to signal workload exit: %v\n", err)
+	} else if awaitFile(filepath.Join(*sync_dir, flushedFile), *flush_timeout) {
+		logger.Println("packet capturing is flushed")
+	} else {
+		logger.Printf("packet capturing is not flushed after %v\n", *flush_timeout)
+	}
+
+	os.Exit(code)
+}
@@ -0,0 +1,89 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestAwaitFile verifies that files are awaited until they are created, or until the timeout.
+func TestAwaitFile(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		delay   time.Duration
+		create  bool
+		timeout time.Duration
+		want    bool
+	}{
+		{"exists", 0, true, 0, true},
+		{"created_later", 3 * pollInterval, true, time.Minute, true},
+		{"never_created", 0, false, 3 * pollInterval, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), readyFile)
+			if tt.create {
+				create := func() { os.WriteFile(path, nil, 0o666) }
+				if tt.delay == 0 {
+					create()
+				} else {
+					time.AfterFunc(tt.delay, create)
+				}
+			}
+
+			start := time.Now()
+			assert.Equal(t, tt.want, awaitFile(path, tt.timeout))
+			if !tt.want {
+				assert.GreaterOrEqual(t, time.Since(start), tt.timeout)
+			}
+		})
+	}
+}
+
+// TestExitCode verifies that workloads exit codes follow shell conventions.
+func TestExitCode(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		err  func() error
+		want int
+	}{
+		{"success", func() error { return exec.Command("sh", "-c", "exit 0").Run() }, 0},
+		{"failure", func() error { return exec.Command("sh", "-c", "exit 3").Run() }, 3},
+		{"signaled", func() error { return exec.Command("sh", "-c", "kill -TERM $$").Run() }, 128 + 15},
+		{"not_started", func() error { return errors.New("executable file not found") }, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tt.want, exitCode(tt.err()))
+		})
+	}
+}
@@ -22,8 +22,12 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"regexp"
 	"runtime/debug"
 	"strconv"
@@ -49,39 +53,90 @@ import (
 func UNUSED(x ...interface{}) {}
 
 var (
-	use_cron   = flag.Bool("use_cron", false, "perform packet capture at specific intervals")
-	cron_exp   = flag.String("cron_exp", "", "stardard cron expression; i/e: '1 * * * *'")
-	timezone   = flag.String("timezone", "UTC", "TimeZone to be used to schedule packet captures")
-	duration   = flag.Int("timeout", 0, "perform packet capture during this mount of seconds")
-	interval   = flag.Int("interval", 60, "seconds after which tcpdump rotates PCAP files")
-	snaplen    = flag.Int("snaplen", 0, "bytes to be captured from each packet")
-	extension  = flag.String("extension", "pcap", "extension to be used for tcpdump PCAP files")
-	directory  = flag.String("directory", "", "directory where PCAP files will be stored")
-	tcp_dump   = flag.Bool("tcpdump", true, "enable JSON PCAP using tcpdump")
-	json_dump  = flag.Bool("jsondump", false, "enable JSON PCAP using gopacket")
-	json_log   = flag.Bool("jsonlog", false, "enable JSON PCAP to stardard output")
-	ordered    = flag.Bool("ordered", false, "write JSON PCAP output as obtained from gopacket")
-	conntrack  = flag.Bool("conntrack", false, "enable connection tracking ('ordered' is also enabled)")
-	gcp_env    = flag.String("env", "run", "literal ID of the execution environment; any of: run, gae, gke")
-	gcp_run    = flag.Bool("run", true, "Cloud Run execution environment")
-	gcp_gae    = flag.Bool("gae", false, "App Engine execution environment")
-	gcp_gke    = flag.Bool("gke", false, "Kubernetes Engine execution environment")
-	pcap_iface = flag.String("iface", "", "prefix to scan for network interfaces to capture from")
-	hc_port    = flag.Uint("hc_port", 12345, "TCP port for health checking")
-	filter     = flag.String("filter", pcap.PcapDefaultFilter, "BPF filter to be used for capturing packets")
-	l3_protos  = flag.String("l3_protos", "ipv4,ipv6", "FQDNs to be translated into IPs to apply as packet filter")
-	l4_protos  = flag.String("l4_protos", "tcp,udp", "FQDNs to be translated into IPs to apply as packet filter")
-	hosts      = flag.String("hosts", "", "FQDNs to be translated into IPs to apply as packet filter")
-	ports      = flag.String("ports", "", "TCP/UDP ports to be used in any side of the 5-tuple for a packet to be captured")
-	ipv4       = flag.String("ipv4", "", "IPv4s or CIDR to be applied to the packet filter")
-	ipv6       = flag.String("ipv6", "", "IPv6s or CIDR to be applied to the packet filter")
-	tcp_flags  = flag.String("tcp_flags", "", "TCP flags to be set for a segment to be captured")
-	ephemerals = flag.String("ephemerals", "32768,65535", "range of ephemeral ports")
-	compat     = flag.Bool("compat", false, "apply filters in Cloud Run gen1 mode")
-	rt_env     = flag.String("rt_env", "cloud_run_gen2", "runtime where PCAP sidecar is used")
-	pcap_debug = flag.Bool("debug", false, "enable debug logs")
-
-	supervisor = flag.String("supervisor", "http://127.0.0.1:23456", "supervisord 'serverurl'")
+	use_cron     = flag.Bool("use_cron", false, "perform packet capture at specific intervals")
+	cron_exp     = flag.String("cron_exp", "", "stardard cron expression; i/e: '1 * * * *'")
+	timezone     = flag.String("timezone", "UTC", "TimeZone to be used to schedule packet captures")
+	duration     = flag.Int("timeout", 0, "perform packet capture during this mount of seconds")
+	interval     = flag.Int("interval", 60, "seconds after which tcpdump rotates PCAP files")
+	snaplen      = flag.Int("snaplen", 0, "bytes to be captured from each packet")
+	extension    = flag.String("extension", "pcap", "extension to be used for tcpdump PCAP files")
+	directory    = flag.String("directory", "", "directory where PCAP files will be stored")
+	tcp_dump     = flag.Bool("tcpdump", true, "enable JSON PCAP using tcpdump")
+	json_dump    = flag.Bool("jsondump", false, "enable JSON PCAP using gopacket")
+	json_log     = flag.Bool("jsonlog", false, "enable JSON PCAP to stardard output")
+	ordered      = flag.Bool("ordered", false, "write JSON PCAP output as obtained from gopacket")
+	conntrack    = flag.Bool("conntrack", false, "enable connection tracking ('ordered' is also enabled)")
+	gcp_env      = flag.String("env", "run", "literal ID of the execution environment; any of: run, gae, gke")
+	gcp_run      = flag.Bool("run", true, "Cloud Run execution environment")
+	gcp_gae      = flag.Bool("gae", false, "App Engine execution environment")
+	gcp_gke      = flag.Bool("gke", false, "Kubernetes Engine execution environment")
+	pcap_iface   = flag.String("iface", "", "prefix to scan for network interfaces to capture from")
+	hc_port      = flag.Uint("hc_port", 12345, "TCP port for health checking")
+	ready_file   = flag.String("ready_file", "", "file to be created when packet capturing is ready, and removed when it stops")
+	sync_dir     = flag.String("sync_dir", "", "directory shared with workloads wrapped by 'pcap-wait' to signal readiness, workload exit, and flushing")
+	export_url   = flag.String("export_url", "", "location where PCAP files are exported to; included in the capture summary")
+	filter       = flag.String("filter", pcap.PcapDefaultFilter, "BPF filter to be used for capturing packets")
+	filter_expr  = flag.String("filter_expr", "", "filter expression compiled into both the BPF filter and the filters enforced by the google engine; replaces 'filter' and all simple filters")
+	l3_protos    = flag.String("l3_protos", "ipv4,ipv6", "FQDNs to be translated into IPs to apply as packet filter")
+	l4_protos    = flag.String("l4_protos", "tcp,udp", "FQDNs to be translated into IPs to apply as packet filter")
+	hosts        = flag.String("hosts", "", "FQDNs to be translated into IPs to apply as packet filter")
+	ports        = flag.String("ports", "", "TCP/UDP ports to be used in any side of the 5-tuple for a packet to be captured")
+	ipv4         = flag.String("ipv4", "", "IPv4s or CIDR to be applied to the packet filter")
+	ipv6         = flag.String("ipv6", "", "IPv6s or CIDR to be applied to the packet filter")
+	tcp_flags    = flag.String("tcp_flags", "", "TCP flags to be set for a segment to be captured")
+	macs         = flag.String("macs", "", "MAC addresses to be applied to the packet filter; either the source or the destination must match")
+	vlans        = flag.String("vlans", "", "802.1Q VLAN IDs to be applied to the packet filter; untagged frames are not captured")
+	deny_ipv4    = flag.String("deny_ipv4", "", "IPv4s or CIDR which must never be captured, regardless of all other filters; i/e: '169.254.169.254,35.191.0.0/16'")
+	deny_ipv6    = flag.String("deny_ipv6", "", "IPv6s or CIDR which must never be captured, regardless of all other filters")
+	deny_ports   = flag.String("deny_ports", "", "TCP/UDP ports which must never be captured on any side of the 5-tuple, regardless of all other filters")
+	deny_macs    = flag.String("deny_macs", "", "MAC addresses which must never be captured, regardless of all other filters")
+	deny_vlans   = flag.String("deny_vlans", "", "802.1Q VLAN IDs which must never be captured, regardless of all other filters; i/e: VLANs of other tenants")
+	dns_hosts    = flag.String("dns_hosts", "", "FQDNs whose IPs are learned from the DNS responses being captured, and allowed until their TTL expires; enforced by the google engine only")
+	deny_hosts   = flag.String("deny_dns_hosts", "", "FQDNs whose IPs are learned from the DNS responses being captured, and denied until their TTL expires; enforced by the google engine only")
+	ephemerals   = flag.String("ephemerals", pcap.PcapEphemeralPortsFromHost, "comma separated range of ephemeral ports used to tell clients from services; 'host' reads it from '/proc/sys/net/ipv4/ip_local_port_range'")
+	ephemerals6  = flag.String("ephemerals6", "", "range of ephemeral ports of IPv6 sockets; if empty, '-ephemerals' applies to both IPv4 and IPv6")
+	compat       = flag.Bool("compat", false, "apply filters in Cloud Run gen1 mode")
+	rt_env       = flag.String("rt_env", "cloud_run_gen2", "runtime where PCAP sidecar is used")
+	pcap_debug   = flag.Bool("debug", false, "enable debug logs")
+	sessions     = flag.String("sessions", "", "comma separated list of cookies and 'header:' prefixed headers to be hashed")
+	compact      = flag.Bool("compact_retransmissions", false, "translate retransmitted TCP segments as references to the original ones")
+	fields       = flag.String("fields", "", "comma separated list of field paths to be included in JSON translations; '-' prefixed paths are excluded")
+	anomalies    = flag.Bool("anomalies", false, "score latency, loss, and connection rates against per destination baselines")
+	retries      = flag.Bool("retries", false, "flag duplicate HTTP requests sent over different connections as retries or hedges")
+	conn_setup   = flag.Bool("connection_setup", false, "attribute the latency of HTTP transactions to the DNS, TCP and TLS setup of new connections")
+	trace_scheme = flag.String("trace_schemes", "", "comma separated list of trace context schemes extracted from HTTP headers, in order: cloud, w3c, grpc, b3, xray and datadog; all if empty")
+	trace_header = flag.String("trace_headers", "", "semicolon separated list of '[hash:]{header}[={regex}]' rules to extract trace context from custom headers; i/e: 'hash:X-Request-Id'")
+	trace_ids    = flag.String("trace_ids", "", "comma separated list of trace IDs, or prefixes ending with '*', whose flows are the only ones written; i/e: '4bf92f35*'")
+	trace_rate   = flag.Uint("trace_rate", 0, "only write flows carrying 1 out of every N trace IDs; trace IDs are chosen by hashing them, so all instances choose the same traces; 0 disables it")
+	trace_file   = flag.String("trace_ids_file", "", "path of a file with 1 trace ID, or prefix ending with '*', per line whose flows are written; re-read every time it is modified")
+	track_pct    = flag.Uint("trace_tracking_percent", 100, "percentage of flows carrying traces whose responses are linked to requests; flows are chosen by hashing them")
+	track_rate   = flag.Uint("trace_tracking_rate", 0, "link responses to requests for at most N new flows carrying traces per second; 0 disables it")
+	labels       = flag.String("labels", "", "semicolon separated list of rules to stamp labels onto records of matching packets; i/e: 'team=payments@port=8080|8443,net=10.0.0.0/8'")
+	pay_rules    = flag.String("payload_rules", "", "semicolon separated list of '{name}={regex}' or '{name}=hex:{bytes}' rules matched against application payloads, use '\\;' to match ';'; i/e: 'sqli=(?i)union\\s+select;tls=hex:16 03 01'")
+	pay_select   = flag.Bool("payload_select", false, "only translate packets whose payload matched any of the payload rules")
+	cache_ports  = flag.String("cache_ports", "", "comma separated list of Redis and Memcached ports whose commands and replies are summarized; i/e: 'redis:6379,memcached:11211'")
+	hash_keys    = flag.Bool("hash_cache_keys", false, "hash the keys of Redis and Memcached commands instead of translating them verbatim")
+	db_ports     = flag.String("db_ports", "", "comma separated list of PostgreSQL and MySQL ports whose messages are decoded; i/e: 'postgres:5432,mysql:3306'")
+	db_queries   = flag.Bool("db_queries", false, "include query text and error messages in translations of PostgreSQL and MySQL messages")
+	broker_ports = flag.String("broker_ports", "", "comma separated list of AMQP 0-9-1 and Kafka ports whose frames are summarized; i/e: 'amqp:5672,kafka:9092'")
+	sample_flows = flag.Uint("sample_flows", 1, "only translate packets of 1 out of every N flows; flows are chosen by hashing their 5-tuple, so all instances sample the same flows")
+	flow_budget  = flag.Uint("flow_budget", 0, "only translate the first N packets of every flow per interval; packets beyond it are aggregated into a top talkers record per interval; 0 disables it")
+	budget_every = flag.Uint("flow_budget_interval", 60, "seconds after which flow budgets are reset and top talkers are logged")
+	stats_every  = flag.Uint("stats_interval", 0, "seconds between records describing the protocol hierarchy of packets captured so far; 0 disables them")
+	flow_summary = flag.Bool("flow_summaries", false, "log a summary of every TCP connection when it is no longer tracked: duration, packets and bytes per direction, RTT, retransmissions and HTTP requests")
+	flow_export  = flag.String("flow_collector", "", "'host:port' of an IPFIX or NetFlow v9 collector to send a record per direction of every TCP connection to, over UDP")
+	flow_version = flag.String("flow_export", "ipfix", "protocol used to send records to 'flow_collector': ipfix or netflow9")
+	debug_addr   = flag.String("debug_addr", "", "'host:port' to serve how JSON translators link responses to traced requests at '/debug/traces' and '/debug/flows'; i/e: 'localhost:6060'")
+	filters_addr = flag.String("filters_addr", "", "'host:port' to serve, and update at runtime, the packet filters enforced by the google engine at '/filters'; i/e: 'localhost:6061'")
+	health_addr  = flag.String("health_addr", "", "'host:port' to serve Kubernetes probes at '/healthz' and '/readyz', which fail with the reasons why PCAP tasks stopped making progress, or are not ready; i/e: ':12346'")
+	control_addr = flag.String("control_addr", "", "'host:port' or 'unix:{path}' to serve the control API at '/control' and '/filters': start, stop, pause, resume and rotation of PCAP tasks, their status and BPF filters; i/e: 'unix:/var/run/pcap.sock'")
+	drain_secs   = flag.Uint("drain_deadline", 2, "seconds given to PCAP tasks, once stopped, to translate and write the packets they already read, and to summarize open flows")
+	manifests    = flag.Bool("manifests", false, "write a '{file}.manifest.json' next to every completed JSON PCAP file: filter, interface, start and end time, packet, byte and drop counts, schema version and checksum")
+	profiles     = flag.String("profiles", "", "semicolon separated list of '{name}[:{interval}]@{filter expression}' capture profiles whose JSON records are written into their own files; i/e: 'dns@udp and port 53;egress-443:300@port 443'")
+	routes       = flag.String("routes", "", "semicolon separated list of '{target}@{route}' rules to route JSON records into writers: json, stdout or gae; i/e: 'stdout@severity=error;json@proto=dns|http'")
+
+	supervisor   = flag.String("supervisor", "http://127.0.0.1:23456", "supervisord 'serverurl'")
+	exclude_self = flag.Bool("exclude_self", true, "exclude traffic of pcap-sidecar's own processes and sinks: GCS uploads, supervisord control API, health checks and flow collector")
 
 	no_procs          = flag.String("no_procs", "gcsfuse", "process for which TCP sockets should be excluded")
 	no_procs_interval = flag.Uint("no_procs_interval", 15, "how often to reresh sockets owned by pcap-sidecar's processes")
@@ -93,6 +148,8 @@ type (
 		engine  pcap.PcapEngine   `json:"-"`
 		writers []pcap.PcapWriter `json:"-"`
 		iface   string            `json:"-"`
+		// either `tcpdump` or `jsondump`
+		kind string `json:"-"`
 	}
 
 	tcpdumpJob struct {
@@ -109,13 +166,38 @@ type (
 	jLogLevel string
 
 	jLogEntry struct {
-		Severity  jLogLevel        `json:"severity"`
-		Message   string           `json:"message"`
-		Sidecar   string           `json:"sidecar"`
-		Module    string           `json:"module"`
-		Job       tcpdumpJob       `json:"job,omitempty"`
-		Tags      []string         `json:"tags,omitempty"`
-		Timestamp map[string]int64 `json:"timestamp,omitempty"`
+		Severity  jLogLevel                  `json:"severity"`
+		Message   string                     `json:"message"`
+		Sidecar   string                     `json:"sidecar"`
+		Module    string                     `json:"module"`
+		Job       tcpdumpJob                 `json:"job,omitempty"`
+		Tags      []string                   `json:"tags,omitempty"`
+		Summary   *captureSummary            `json:"summary,omitempty"`
+		Flow      *pcap.PcapFlowSummaryEvent `json:"flow,omitempty"`
+		Talkers   *pcap.PcapTopTalkersEvent  `json:"top_talkers,omitempty"`
+		Timestamp map[string]int64           `json:"timestamp,omitempty"`
+	}
+
+	// captureSummary describes everything captured by all PCAP tasks of a job.
+	captureSummary struct {
+		// where `files` are exported to; files may be renamed or compressed when exported
+		Location string                `json:"location,omitempty"`
+		Tasks    []*captureTaskSummary `json:"tasks"`
+	}
+
+	captureTaskSummary struct {
+		Iface           string                   `json:"iface"`
+		Kind            string                   `json:"kind"`
+		Packets         uint64                   `json:"packets"`
+		Bytes           uint64                   `json:"bytes,omitempty"`
+		Errors          uint64                   `json:"errors,omitempty"`
+		Anomalies       uint64                   `json:"anomalies,omitempty"`
+		TopDestinations []pcap.PcapDestination   `json:"top_destinations,omitempty"`
+		MulticastGroups int                      `json:"multicast_groups,omitempty"`
+		Protocols       []pcap.PcapProtocol      `json:"protocols,omitempty"`
+		FilteredOut     uint64                   `json:"filtered_out,omitempty"`
+		TCP             *pcap.PcapTCPConnections `json:"tcp,omitempty"`
+		Files           []string                 `json:"files,omitempty"`
 	}
 )
 
@@ -134,8 +216,20 @@ var jid, xid atomic.Value
 
 var jobs *haxmap.Map[string, *tcpdumpJob]
 
+// cancels the running execution of the PCAP job; `nil` if there is none
+var stopExecution atomic.Pointer[context.CancelFunc]
+
 var emptyTcpdumpJob = tcpdumpJob{Jid: uuid.Nil.String()}
 
+// shared by all PCAP tasks of all jobs; `nil` if flows are not exported
+var flowExporter *pcap.PcapFlowExporter
+
+// shared by all PCAP tasks of all jobs so that trace IDs added at runtime apply to all of them; `nil` if not scoped
+var traceScope *pcap.PcapTraceScope
+
+// shared by all PCAP tasks of all jobs, so the debug server always reports the current ones; `nil` if not served
+var correlations *pcap.PcapCorrelationIndex
+
 var (
 	errTcpdumpDisabled  = errors.New("GCS PCAP export disabled")
 	errJsondumpDisabled = errors.New("GCS JSON export disabled")
@@ -170,7 +264,31 @@ const (
 	maxNoProcsInterval     = uint(240) // 4 minutes
 )
 
+const readinessPollInterval = 100 * time.Millisecond
+
+// files shared with `pcap-wait` via `sync_dir`
+const (
+	syncReadyFile          = "PCAP_READY"
+	syncWorkloadExitedFile = "WORKLOAD_EXITED"
+	syncFlushedFile        = "PCAP_FLUSHED"
+)
+
 func jlog(severity jLogLevel, job *tcpdumpJob, message string) {
+	jlogWithSummary(severity, job, message, nil)
+}
+
+func jlogWithSummary(severity jLogLevel, job *tcpdumpJob, message string, summary *captureSummary) {
+	jlogEntry(severity, job, message, summary, nil, nil)
+}
+
+func jlogEntry(
+	severity jLogLevel,
+	job *tcpdumpJob,
+	message string,
+	summary *captureSummary,
+	flow *pcap.PcapFlowSummaryEvent,
+	talkers *pcap.PcapTopTalkersEvent,
+) {
 	now := time.Now()
 
 	j := *job
@@ -184,6 +302,9 @@ func jlog(severity jLogLevel, job *tcpdumpJob, message string) {
 		Module:   moduleEnvVar,
 		Job:      j,
 		Tags:     j.Tags,
+		Summary:  summary,
+		Flow:     flow,
+		Talkers:  talkers,
 		Timestamp: map[string]int64{
 			"seconds": now.Unix(),
 			"nanos":   int64(now.Nanosecond()),
@@ -258,6 +379,12 @@ func start(ctx context.Context, timeout *time.Duration, job *tcpdumpJob) error {
 		defer cancel()
 	}
 
+	// executions may be stopped on demand using the control API
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+	stopExecution.Store(&stop)
+	defer stopExecution.Store(nil)
+
 	stopDeadline := make(chan *time.Duration, len(job.tasks))
 	for _, task := range job.tasks {
 		wg.Add(1)
@@ -273,17 +400,203 @@ func start(ctx context.Context, timeout *time.Duration, job *tcpdumpJob) error {
 		}(ctx, &wg, job, task)
 	}
 
+	go signalJobReady(ctx, job, *ready_file)
+
+	if *stats_every > 0 {
+		go reportProtocols(ctx, job, time.Duration(*stats_every)*time.Second)
+	}
+
 	// wait for context cancel/timeout
 	<-ctx.Done()
 	ctxDoneTS := time.Now()
 
-	deadline := 2 * time.Second
+	deadline := time.Duration(*drain_secs) * time.Second
 	waitJobDone(job, &wg, &ctxDoneTS, &deadline, stopDeadline)
 	close(stopDeadline)
 
 	return ctx.Err()
 }
 
+// newFlowEventHandlers logs 1 record per TCP connection when PCAP tasks stop tracking it, and/or sends it to the flow collector;
+// it also logs the top talkers of every interval if flow budgets are enabled. It returns `nil` if none is enabled.
+func newFlowEventHandlers(job *tcpdumpJob) *pcap.PcapFlowEventHandlers {
+	handlers := &pcap.PcapFlowEventHandlers{}
+	if *flow_summary || flowExporter != nil {
+		handlers.OnFlowSummary = func(flow *pcap.PcapFlowSummaryEvent) {
+			if flowExporter != nil {
+				flowExporter.OnFlowSummary(flow)
+			}
+			if !*flow_summary {
+				return
+			}
+			message := fmt.Sprintf("flow summary | %s > %s | %s | %s | %d/%d packets",
+				flow.Client, flow.Server, flow.End.Sub(flow.Start), flow.Reason, flow.FwdPackets, flow.BwdPackets)
+			jlogEntry(INFO, job, message, nil, flow, nil)
+		}
+	}
+	if *flow_budget > 0 {
+		handlers.OnTopTalkers = func(talkers *pcap.PcapTopTalkersEvent) {
+			message := fmt.Sprintf("top talkers | %s | %d flows | %d/%d packets aggregated",
+				talkers.Iface, talkers.Flows, talkers.AggregatedPackets, talkers.Packets)
+			jlogEntry(INFO, job, message, nil, nil, talkers)
+		}
+	}
+	if handlers.OnFlowSummary == nil && handlers.OnTopTalkers == nil {
+		return nil
+	}
+	return handlers
+}
+
+// reportProtocols periodically logs the protocol hierarchy of all `gopacket` PCAP tasks until `ctx` is done.
+func reportProtocols(ctx context.Context, job *tcpdumpJob, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// unlike `summarize`, files are not listed as PCAP tasks are still running
+		summary := &captureSummary{Tasks: make([]*captureTaskSummary, 0, len(job.tasks))}
+		message := "protocol hierarchy"
+		for _, task := range job.tasks {
+			stats := task.engine.Stats()
+			if len(stats.Protocols) == 0 {
+				continue
+			}
+			summary.Tasks = append(summary.Tasks, &captureTaskSummary{
+				Iface:     task.iface,
+				Kind:      task.kind,
+				Packets:   stats.Packets,
+				Bytes:     stats.Bytes,
+				Protocols: stats.Protocols,
+				TCP:       tcpConnectionsOf(stats),
+			})
+			message += fmt.Sprintf(" | %s/%s: %d packets, %d protocols", task.kind, task.iface, stats.Packets, len(stats.Protocols))
+		}
+
+		if len(summary.Tasks) > 0 {
+			jlogWithSummary(INFO, job, message, summary)
+		}
+	}
+}
+
+// isJobReady reports whether all PCAP tasks have an open handle, a compiled filter, and initialized writers.
+func isJobReady(job *tcpdumpJob) bool {
+	for _, task := range job.tasks {
+		if !task.engine.IsReady() {
+			return false
+		}
+	}
+	return len(job.tasks) > 0
+}
+
+// awaitJobReady returns `false` if `ctx` is done before all PCAP tasks are ready.
+func awaitJobReady(ctx context.Context, job *tcpdumpJob) bool {
+	ticker := time.NewTicker(readinessPollInterval)
+	defer ticker.Stop()
+
+	for !isJobReady(job) {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+	return true
+}
+
+// signalJobReady creates `readyFile` when all PCAP tasks are ready, and removes it when the job execution is done.
+func signalJobReady(ctx context.Context, job *tcpdumpJob, readyFile string) {
+	if !awaitJobReady(ctx, job) {
+		return
+	}
+
+	jlog(INFO, job, "PCAP job execution is ready")
+
+	if readyFile == "" {
+		return
+	}
+
+	readySignal, err := os.Create(readyFile)
+	if err != nil {
+		jlog(ERROR, job, fmt.Sprintf("readiness signal creation failed: %s | %s", readyFile, err.Error()))
+		return
+	}
+	readySignal.Close()
+	jlog(INFO, job, fmt.Sprintf("readiness signal created: %s", readyFile))
+
+	<-ctx.Done()
+
+	if err := os.Remove(readyFile); err != nil {
+		jlog(ERROR, job, fmt.Sprintf("readiness signal removal failed: %s | %s", readyFile, err.Error()))
+	}
+}
+
+// watchWorkloadExit stops packet capturing when the workload wrapped by `pcap-wait` exits.
+func watchWorkloadExit(ctx context.Context, job *tcpdumpJob, exitedSignal string, signals chan<- os.Signal) {
+	ticker := time.NewTicker(readinessPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if exitCode, err := os.ReadFile(exitedSignal); err == nil {
+				jlog(INFO, job, fmt.Sprintf("workload exited: %s", strings.TrimSpace(string(exitCode))))
+				signals <- syscall.SIGTERM
+				return
+			}
+		}
+	}
+}
+
+// startControlServer serves the control API for all PCAP tasks of `job` at `addr`:
+//   - executions are started by `start`, which is `nil` when the PCAP job is not scheduled.
+func startControlServer(addr string, job *tcpdumpJob, filters pcap.PcapFilters, start func() error) {
+	control := pcap.NewPcapControl(filters, &pcap.PcapControlHooks{
+		Start: start,
+		Stop: func() error {
+			if stop := stopExecution.Load(); stop != nil {
+				(*stop)()
+				return nil
+			}
+			return errors.New("no PCAP job execution is running")
+		},
+	})
+	for _, task := range job.tasks {
+		control.Register(task.kind+"/"+task.iface, task.engine, task.writers)
+	}
+
+	listener, err := pcap.ListenPcapControl(addr)
+	if err != nil {
+		jlog(ERROR, job, fmt.Sprintf("control server disabled: %v", err))
+		return
+	}
+	jlog(INFO, job, fmt.Sprintf("serving control API at: %s", addr))
+	if err := http.Serve(listener, pcap.NewPcapControlHandler(control)); err != nil {
+		jlog(ERROR, job, fmt.Sprintf("control server disabled: %v", err))
+	}
+}
+
+// startHealthServer serves Kubernetes probes for all PCAP tasks of `job` at `addr`:
+//   - unlike `hc_port`, which only proves that the process is alive, probes fail if the capture loop silently died.
+func startHealthServer(addr string, job *tcpdumpJob) {
+	control := pcap.NewPcapControl(nil /* filters */, nil /* hooks */)
+	for _, task := range job.tasks {
+		control.Register(task.kind+"/"+task.iface, task.engine, task.writers)
+	}
+
+	jlog(INFO, job, fmt.Sprintf("serving health probes at: %s", addr))
+	if err := http.ListenAndServe(addr, pcap.NewPcapHealthHandler(control)); err != nil {
+		jlog(ERROR, job, fmt.Sprintf("health server disabled: %v", err))
+	}
+}
+
 func tcpdump(
 	timeout time.Duration,
 	debug bool,
@@ -305,6 +618,56 @@ func tcpdump(
 	ctx = context.WithValue(ctx, pcap.PcapContextLogName,
 		fmt.Sprintf("projects/%s/pcap/%s", projectID, id))
 	ctx = context.WithValue(ctx, pcap.PcapContextDebug, debug)
+	if *sessions != "" {
+		ctx = context.WithValue(ctx, pcap.PcapContextSessionKeys, strings.Split(*sessions, ","))
+	}
+	ctx = context.WithValue(ctx, pcap.PcapContextCompactRetransmissions, *compact)
+	ctx = context.WithValue(ctx, pcap.PcapContextAnomalies, *anomalies)
+	ctx = context.WithValue(ctx, pcap.PcapContextRetries, *retries)
+	ctx = context.WithValue(ctx, pcap.PcapContextConnectionSetup, *conn_setup)
+	if *fields != "" {
+		ctx = context.WithValue(ctx, pcap.PcapContextFields, strings.Split(*fields, ","))
+	}
+	if *labels != "" {
+		ctx = context.WithValue(ctx, pcap.PcapContextLabels, strings.Split(*labels, ";"))
+	}
+	if *pay_rules != "" {
+		ctx = context.WithValue(ctx, pcap.PcapContextPayloadRules, pcap.SplitPcapPayloadRules(*pay_rules))
+		ctx = context.WithValue(ctx, pcap.PcapContextPayloadSelect, *pay_select)
+	}
+	if *trace_scheme != "" {
+		ctx = context.WithValue(ctx, pcap.PcapContextTraceSchemes, strings.Split(*trace_scheme, ","))
+	}
+	if *trace_header != "" {
+		ctx = context.WithValue(ctx, pcap.PcapContextTraceHeaders, strings.Split(*trace_header, ";"))
+	}
+	if traceScope != nil {
+		ctx = context.WithValue(ctx, pcap.PcapContextTraceScope, traceScope)
+	}
+	if *track_pct < 100 || *track_rate > 0 {
+		ctx = context.WithValue(ctx, pcap.PcapContextTraceTrackingPercent, *track_pct)
+		ctx = context.WithValue(ctx, pcap.PcapContextTraceTrackingRate, *track_rate)
+	}
+	if correlations != nil {
+		ctx = context.WithValue(ctx, pcap.PcapContextCorrelationIndex, correlations)
+	}
+	if *cache_ports != "" {
+		ctx = context.WithValue(ctx, pcap.PcapContextCachePorts, strings.Split(*cache_ports, ","))
+	}
+	ctx = context.WithValue(ctx, pcap.PcapContextHashCacheKeys, *hash_keys)
+	if *db_ports != "" {
+		ctx = context.WithValue(ctx, pcap.PcapContextDBPorts, strings.Split(*db_ports, ","))
+	}
+	ctx = context.WithValue(ctx, pcap.PcapContextDBQueries, *db_queries)
+	if *broker_ports != "" {
+		ctx = context.WithValue(ctx, pcap.PcapContextBrokerPorts, strings.Split(*broker_ports, ","))
+	}
+	ctx = context.WithValue(ctx, pcap.PcapContextFlowSampling, *sample_flows)
+	ctx = context.WithValue(ctx, pcap.PcapContextFlowBudget, *flow_budget)
+	ctx = context.WithValue(ctx, pcap.PcapContextFlowBudgetInterval, time.Duration(*budget_every)*time.Second)
+	if handlers := newFlowEventHandlers(job); handlers != nil {
+		ctx = context.WithValue(ctx, pcap.PcapContextFlowEvents, handlers)
+	}
 
 	err := start(ctx, &timeout, job)
 	if err == context.DeadlineExceeded || err == context.Canceled {
@@ -321,6 +684,7 @@ func newPcapConfig(
 	snaplen, interval int,
 	compat, ordered, conntrack bool,
 	ephemerals *pcap.PcapEphemeralPorts,
+	exclusions []string,
 ) *pcap.PcapConfig {
 	return &pcap.PcapConfig{
 		Compat:        compat,
@@ -338,6 +702,7 @@ func newPcapConfig(
 		Filters:       filters,
 		CompatFilters: compatFilters,
 		Ephemerals:    ephemerals,
+		Exclude:       exclusions,
 	}
 }
 
@@ -349,6 +714,8 @@ func createTasks(
 	snaplen, interval *int,
 	compat, tcpdump, jsondump, jsonlog, ordered, conntrack, gcpGAE *bool,
 	ephemerals *pcap.PcapEphemeralPorts,
+	exclusions []string,
+	profiles []*pcap.PcapProfile,
 ) []*pcapTask {
 	tasks := []*pcapTask{}
 
@@ -385,8 +752,8 @@ func createTasks(
 
 		output := fmt.Sprintf(runFileOutput, *directory, netIface.Index, netIface.Name)
 
-		tcpdumpCfg := newPcapConfig(iface, "pcap", output, *extension, *filter, filters, compatFilters, *snaplen, *interval, *compat, *ordered, *conntrack, ephemerals)
-		jsondumpCfg := newPcapConfig(iface, "json", output, "json", *filter, filters, compatFilters, *snaplen, *interval, *compat, *ordered, *conntrack, ephemerals)
+		tcpdumpCfg := newPcapConfig(iface, "pcap", output, *extension, *filter, filters, compatFilters, *snaplen, *interval, *compat, *ordered, *conntrack, ephemerals, exclusions)
+		jsondumpCfg := newPcapConfig(iface, "json", output, "json", *filter, filters, compatFilters, *snaplen, *interval, *compat, *ordered, *conntrack, ephemerals, exclusions)
 
 		// premature optimization is the root of all evil
 		var engineErr, writerErr error = nil, nil
@@ -399,7 +766,7 @@ func createTasks(
 			engineErr = errTcpdumpDisabled
 		}
 		if engineErr == nil {
-			tasks = append(tasks, &pcapTask{engine: tcpdumpEngine, writers: nil, iface: iface})
+			tasks = append(tasks, &pcapTask{engine: tcpdumpEngine, writers: nil, iface: iface, kind: "tcpdump"})
 			jlog(INFO, &emptyTcpdumpJob, fmt.Sprintf("configured 'tcpdump' for iface: %s", ifaceAndIndex))
 		} else if *tcpdump {
 			jlog(ERROR, &emptyTcpdumpJob, fmt.Sprintf("tcpdump GCS writer creation failed: %s (%s)", ifaceAndIndex, engineErr))
@@ -412,6 +779,9 @@ func createTasks(
 
 		engineErr = nil
 		jsondumpCfg.Ordered = *ordered
+		// profiles share the packets captured for JSON translations: `tcpdump` does not translate packets
+		jsondumpCfg.Profiles = profiles
+		jsondumpCfg.Manifests = *manifests
 
 		// some form of JSON packet capturing is enabled
 		jsondumpEngine, engineErr = pcap.NewPcap(jsondumpCfg)
@@ -421,6 +791,7 @@ func createTasks(
 		}
 
 		pcapWriters := []pcap.PcapWriter{}
+		pcapRoutes := pcap.NewPcapRoutes(*routes)
 
 		if *jsondump {
 			// writing JSON PCAP file is only enabled if `jsondump` is enabled
@@ -429,7 +800,7 @@ func createTasks(
 			jsondumpWriter, writerErr = nil, errJSONLogDisabled
 		}
 		if writerErr == nil {
-			pcapWriters = append(pcapWriters, jsondumpWriter)
+			pcapWriters = append(pcapWriters, pcapRoutes.Route("json", jsondumpWriter))
 			jlog(INFO, &emptyTcpdumpJob, fmt.Sprintf("configured JSON '%s' writer for iface: %s", output, ifaceAndIndex))
 		} else if *jsondump {
 			jlog(ERROR, &emptyTcpdumpJob, fmt.Sprintf("jsondump GCS writer creation failed: %s (%s)", ifaceAndIndex, writerErr))
@@ -442,7 +813,7 @@ func createTasks(
 			jsonlogWriter, writerErr = nil, errJSONLogDisabled
 		}
 		if writerErr == nil {
-			pcapWriters = append(pcapWriters, jsonlogWriter)
+			pcapWriters = append(pcapWriters, pcapRoutes.Route("stdout", jsonlogWriter))
 			jlog(INFO, &emptyTcpdumpJob, fmt.Sprintf("configured JSON 'stdout' writer for iface: %s", ifaceAndIndex))
 		} else if *jsonlog {
 			jlog(ERROR, &emptyTcpdumpJob, fmt.Sprintf("jsondump stdout writer creation failed: %s (%s)", ifaceAndIndex, writerErr))
@@ -457,14 +828,29 @@ func createTasks(
 			gaejsonWriter, writerErr = nil, errGaeDisabled
 		}
 		if writerErr == nil {
-			pcapWriters = append(pcapWriters, gaejsonWriter)
+			pcapWriters = append(pcapWriters, pcapRoutes.Route("gae", gaejsonWriter))
 			jlog(INFO, &emptyTcpdumpJob, fmt.Sprintf("configured GAE JSON '%s' writer for iface: %s", gaeOutput, ifaceAndIndex))
 		} else if isGAE {
 			jlog(ERROR, &emptyTcpdumpJob, fmt.Sprintf("jsondump GAE json writer creation failed: %s (%s)", ifaceAndIndex, errGaeDisabled))
 		}
 
+		// profiles write JSON files next to the ones of the capture, so that they are exported the same way
+		for _, profile := range profiles {
+			if !*jsondump {
+				break
+			}
+			profileOutput := fmt.Sprintf(runFileOutput, *directory, netIface.Index, netIface.Name+"-"+profile.Name)
+			profileWriter, writerErr := pcap.NewPcapWriter(ctx, &ifaceAndIndex, &profileOutput, &jsondumpCfg.Extension, timezone, profile.RotationInterval(*interval))
+			if writerErr != nil {
+				jlog(ERROR, &emptyTcpdumpJob, fmt.Sprintf("profile '%s' writer creation failed: %s (%s)", profile.Name, ifaceAndIndex, writerErr))
+				continue
+			}
+			pcapWriters = append(pcapWriters, profile.Writer(profileWriter))
+			jlog(INFO, &emptyTcpdumpJob, fmt.Sprintf("configured JSON '%s' writer of profile '%s' for iface: %s", profileOutput, profile.Name, ifaceAndIndex))
+		}
+
 		jlog(INFO, &emptyTcpdumpJob, fmt.Sprintf("configured 'jsondump' for iface: %s", ifaceAndIndex))
-		tasks = append(tasks, &pcapTask{engine: jsondumpEngine, writers: pcapWriters, iface: iface})
+		tasks = append(tasks, &pcapTask{engine: jsondumpEngine, writers: pcapWriters, iface: iface, kind: "jsondump"})
 	}
 
 	return tasks
@@ -500,6 +886,45 @@ func startTCPListener(ctx context.Context, port *uint, job *tcpdumpJob, stopChan
 	}
 }
 
+// tcpConnectionsOf returns `nil` if no TCP connections were tracked; i/e: `tcpdump` tasks.
+func tcpConnectionsOf(stats *pcap.PcapStats) *pcap.PcapTCPConnections {
+	if stats.TCP == (pcap.PcapTCPConnections{}) {
+		return nil
+	}
+	return &stats.TCP
+}
+
+// summarize collects stats from all PCAP tasks of `job`; it must only be called after all tasks are stopped.
+func summarize(job *tcpdumpJob) *captureSummary {
+	summary := &captureSummary{
+		Location: *export_url,
+		Tasks:    make([]*captureTaskSummary, 0, len(job.tasks)),
+	}
+
+	for _, task := range job.tasks {
+		stats := task.engine.Stats()
+		taskSummary := &captureTaskSummary{
+			Iface:           task.iface,
+			Kind:            task.kind,
+			Packets:         stats.Packets,
+			Bytes:           stats.Bytes,
+			Errors:          stats.Errors,
+			Anomalies:       stats.Anomalies,
+			TopDestinations: stats.TopDestinations,
+			MulticastGroups: len(stats.Multicast),
+			Protocols:       stats.Protocols,
+			FilteredOut:     stats.FilteredOut,
+			TCP:             tcpConnectionsOf(stats),
+		}
+		for _, writer := range task.writers {
+			taskSummary.Files = append(taskSummary.Files, writer.Files()...)
+		}
+		summary.Tasks = append(summary.Tasks, taskSummary)
+	}
+
+	return summary
+}
+
 func waitDone(job *tcpdumpJob, pcapMutex *flock.Flock, exitSignal *string) {
 	// wait for all PCAP tasks to be gracefully stopped
 	wg.Wait()
@@ -511,6 +936,22 @@ func waitDone(job *tcpdumpJob, pcapMutex *flock.Flock, exitSignal *string) {
 		}
 	}
 
+	// summaries of connections still tracked are emitted when PCAP tasks stop
+	if flowExporter != nil {
+		flowExporter.Close()
+	}
+
+	// a single record describing what was captured, and where to find it
+	summary := summarize(job)
+	message := fmt.Sprintf("capture summary | tasks: %d", len(summary.Tasks))
+	for _, task := range summary.Tasks {
+		message += fmt.Sprintf(" | %s/%s: %d packets, %d files", task.Kind, task.Iface, task.Packets, len(task.Files))
+	}
+	if summary.Location != "" {
+		message += fmt.Sprintf(" | location: %s", summary.Location)
+	}
+	jlogWithSummary(INFO, job, message, summary)
+
 	// `TCPDUMPW_EXITED` file creation signals `pcapfsn` to start its own termination process
 	terminationSignal, err := os.OpenFile(*exitSignal, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o666)
 
@@ -521,6 +962,16 @@ func waitDone(job *tcpdumpJob, pcapMutex *flock.Flock, exitSignal *string) {
 		jlog(ERROR, job, fmt.Sprintf("'tcpdumpw' termination signal creation failed: %s | %s", *exitSignal, err.Error()))
 	}
 
+	// `PCAP_FLUSHED` file creation allows `pcap-wait` to exit
+	if *sync_dir != "" {
+		flushedSignal := filepath.Join(*sync_dir, syncFlushedFile)
+		if err := os.WriteFile(flushedSignal, nil, 0o666); err == nil {
+			jlog(INFO, job, fmt.Sprintf("flush signal created: %s", flushedSignal))
+		} else {
+			jlog(ERROR, job, fmt.Sprintf("flush signal creation failed: %s | %s", flushedSignal, err.Error()))
+		}
+	}
+
 	if unlockErr := pcapMutex.Unlock(); unlockErr != nil {
 		jlog(ERROR, job, fmt.Sprintf("failed to release PCAP lock file: %v", unlockErr))
 	} else {
@@ -553,36 +1004,135 @@ func appendFilter(
 	return filters
 }
 
-func parseEphemeralPorts(ephemerals *string) *pcap.PcapEphemeralPorts {
-	// default ephemeral ports range
-	ephemeralPortRange := &pcap.PcapEphemeralPorts{
-		Min: pcap.PCAP_MIN_EPHEMERAL_PORT,
-		Max: pcap.PCAP_MAX_EPHEMERAL_PORT,
+// processes managed by supervisord whose sockets belong to pcap-sidecar itself
+var selfProcesses = []string{"gcsfuse", "pcapfsn", "tcpdumpw"}
+
+// withSelfProcesses appends pcap-sidecar's own processes to `no_procs` so that their sockets are not captured
+func withSelfProcesses(processes string) string {
+	names := []string{}
+	seen := make(map[string]struct{})
+	for _, name := range append(strings.Split(processes, ","), selfProcesses...) {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if _, ok := seen[name]; !ok {
+			seen[name] = struct{}{}
+			names = append(names, name)
+		}
 	}
+	return strings.Join(names, ",")
+}
 
-	if *ephemerals == "" {
-		return ephemeralPortRange
+// selfExclusions builds BPF expressions for pcap-sidecar's own connections which are not bound to a process:
+// sockets of a process are only known after it is discovered, and loopback/UDP endpoints are fixed at startup.
+func selfExclusions(exporter *pcap.PcapFlowExporter) []string {
+	exclusions := []string{}
+
+	if serverURL, err := url.Parse(*supervisor); err == nil && serverURL.Port() != "" {
+		if addrs, err := net.LookupIP(serverURL.Hostname()); err == nil && len(addrs) > 0 {
+			exclusions = append(exclusions, fmt.Sprintf("tcp and host %s and port %s", addrs[0].String(), serverURL.Port()))
+		}
 	}
 
-	ephemeralPorts := strings.SplitN(*ephemerals, ",", 2)
+	if *hc_port > 0 && *hc_port <= 0xFFFF {
+		exclusions = append(exclusions, fmt.Sprintf("tcp and host 127.0.0.1 and port %d", *hc_port))
+	}
 
-	if len(ephemeralPorts) != 2 {
-		return ephemeralPortRange
+	if exporter != nil {
+		if exclusion := exporter.Exclusion(); exclusion != "" {
+			exclusions = append(exclusions, exclusion)
+		}
 	}
 
-	for i, valueStr := range ephemeralPorts {
-		if value, err := strconv.ParseUint(valueStr, 10, 16); err != nil && value >= 0x0400 && value <= 0xFFFF {
-			// see: https://datatracker.ietf.org/doc/html/rfc6056#page-5
-			// a valid `ephemeral port` must be within RFC 6056 range: [1024/0x4000,65535/0xFFFF]
-			port := uint16(value)
-			if i == 0 && port < ephemeralPortRange.Max {
-				ephemeralPortRange.Min = uint16(value)
-			} else if port > ephemeralPortRange.Min {
-				ephemeralPortRange.Max = uint16(value)
-			}
+	return exclusions
+}
+
+func parseVLANs(rawVLANs string) []uint16 {
+	vlanIDs := []uint16{}
+	for _, vlanStr := range strings.Split(rawVLANs, ",") {
+		if vlanStr = strings.TrimSpace(vlanStr); vlanStr == "" {
+			continue
+		}
+		// 0xFFF is reserved
+		if vlan, err := strconv.ParseUint(vlanStr, 10, 12); err == nil && vlan < 0xFFF {
+			vlanIDs = append(vlanIDs, uint16(vlan))
+		} else {
+			jlog(ERROR, &emptyTcpdumpJob, fmt.Sprintf("invalid VLAN ID: %s", vlanStr))
+		}
+	}
+	return vlanIDs
+}
+
+// denyExclusions builds BPF expressions for the denied networks, ports and MACs, and denies them in `compatFilters` as well:
+// exclusions take precedence over all other filters, so denied traffic is neither written nor translated.
+// Denied VLANs are not exclusions, as `vlan` shifts the offsets of all other terms: the engine handles them.
+func denyExclusions(compatFilters pcap.PcapFilters) []string {
+	exclusions := []string{}
+
+	for _, macStr := range strings.Split(*deny_macs, ",") {
+		if macStr = strings.TrimSpace(macStr); macStr == "" {
+			continue
+		}
+		mac, err := net.ParseMAC(macStr)
+		if err != nil || len(mac) != 6 {
+			jlog(ERROR, &emptyTcpdumpJob, fmt.Sprintf("invalid denied MAC: %s", macStr))
+			continue
+		}
+		exclusions = append(exclusions, fmt.Sprintf("ether host %s", mac.String()))
+		compatFilters.DenyMAC(mac.String())
+	}
+
+	compatFilters.DenyVLANs(parseVLANs(*deny_vlans)...)
+
+	for _, IPorNET := range strings.Split(*deny_ipv4+","+*deny_ipv6, ",") {
+		if IPorNET = strings.TrimSpace(IPorNET); IPorNET == "" {
+			continue
+		}
+		var prefix netip.Prefix
+		if addr, err := netip.ParseAddr(IPorNET); err == nil {
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		} else if prefix, err = netip.ParsePrefix(IPorNET); err != nil {
+			jlog(ERROR, &emptyTcpdumpJob, fmt.Sprintf("invalid denied IP: %s", IPorNET))
+			continue
+		}
+		prefix = prefix.Masked()
+		exclusions = append(exclusions, fmt.Sprintf("net %s", prefix.String()))
+		if prefix.Addr().Is4() {
+			compatFilters.DenyIPv4Range(prefix.String())
+		} else {
+			compatFilters.DenyIPv6Range(prefix.String())
 		}
 	}
 
+	for _, portStr := range strings.Split(*deny_ports, ",") {
+		if portStr = strings.TrimSpace(portStr); portStr == "" {
+			continue
+		}
+		port, err := strconv.ParseUint(portStr, 10, 16)
+		if err != nil {
+			jlog(ERROR, &emptyTcpdumpJob, fmt.Sprintf("invalid denied port: %s", portStr))
+			continue
+		}
+		exclusions = append(exclusions, fmt.Sprintf("port %d", port))
+		compatFilters.DenyPort(uint16(port))
+	}
+
+	return exclusions
+}
+
+func parseEphemeralPorts(ephemerals, ephemerals6 *string) *pcap.PcapEphemeralPorts {
+	ephemeralPortRange, err := pcap.ParsePcapEphemeralPorts(*ephemerals, *ephemerals6)
+	if err == nil {
+		return ephemeralPortRange
+	}
+	jlog(ERROR, &emptyTcpdumpJob, fmt.Sprintf("invalid ephemeral ports: %s", err))
+
+	// IPv6 sockets use the IPv4 range unless a valid range is explicitly set
+	if ephemeralPortRange, err = pcap.ParsePcapEphemeralPorts(*ephemerals, ""); err == nil {
+		return ephemeralPortRange
+	}
+	// the range of the host is always valid: it falls back to the range preferred by RFC 6056
+	ephemeralPortRange, _ = pcap.ParsePcapEphemeralPorts(pcap.PcapEphemeralPortsFromHost, "")
 	return ephemeralPortRange
 }
 
@@ -600,6 +1150,15 @@ func main() {
 	jid.Store(uuid.Nil)
 	xid.Store(uuid.Nil)
 
+	if *sync_dir != "" {
+		if *ready_file == "" {
+			*ready_file = filepath.Join(*sync_dir, syncReadyFile)
+		}
+		// signals from previous executions must not be mistaken for current ones
+		os.Remove(filepath.Join(*sync_dir, syncWorkloadExitedFile))
+		os.Remove(filepath.Join(*sync_dir, syncFlushedFile))
+	}
+
 	if *compat || strings.EqualFold(*filter, "DISABLED") {
 		*filter = ""
 	} else {
@@ -609,12 +1168,28 @@ func main() {
 	compatFilters := pcap.NewPcapFilters()
 	filters := []pcap.PcapFilterProvider{}
 
+	if *filter_expr != "" {
+		bpfFilter, err := pcap.CompilePcapFilterExpression(*filter_expr, compatFilters)
+		if err != nil {
+			jlog(FATAL, &emptyTcpdumpJob, stringFormatter.Format("invalid filter expression: {0}", err))
+			os.Exit(1)
+		}
+		// in compat mode the kernel filter is built from simple filters, so the expression is only enforced by the google engine
+		if !*compat {
+			*filter = bpfFilter
+		}
+		jlog(INFO, &emptyTcpdumpJob, stringFormatter.Format("using filter expression: {0} => {1}", *filter_expr, bpfFilter))
+	}
+
 	if *compat || *filter == "" {
 		// if complex filter is empty, build it using 'Simple PCAP filters'
 		filters = appendFilter(ctx, filters, compatFilters, l3_protos, pcapFilter.NewL3ProtoFilterProvider)
 		filters = appendFilter(ctx, filters, compatFilters, l4_protos, pcapFilter.NewL4ProtoFilterProvider)
 		filters = appendFilter(ctx, filters, compatFilters, ports, pcapFilter.NewPortsFilterProvider)
 		filters = appendFilter(ctx, filters, compatFilters, tcp_flags, pcapFilter.NewTCPFlagsFilterProvider)
+		filters = appendFilter(ctx, filters, compatFilters, macs, pcapFilter.NewMACFilterProvider)
+		// `vlan` is not a term: it is added by the engine to the whole filter; see `pcap.PcapFilters.AddVLANs`
+		compatFilters.AddVLANs(parseVLANs(*vlans)...)
 
 		ipFilterProvider := pcapFilter.NewIPFilterProvider(ipv4, ipv6, hosts, compatFilters)
 		if _, ok := ipFilterProvider.Get(ctx); ok {
@@ -634,15 +1209,87 @@ func main() {
 	if noProcsInterval > maxNoProcsInterval {
 		noProcsInterval = maxNoProcsInterval
 	}
+	if *exclude_self {
+		*no_procs = withSelfProcesses(*no_procs)
+	}
 	processFilter := pcapFilter.NewProcessFilterProvider(supervisor, no_procs, uint8(noProcsInterval), *no_procs_debug, compatFilters)
 	// initialize `ProcessFilterProvider` for its side effects
 	filters = append(filters, processFilter.Initialize(ctx))
 
-	ephemeralPortRange := parseEphemeralPorts(ephemerals)
+	ephemeralPortRange := parseEphemeralPorts(ephemerals, ephemerals6)
+
+	if (*json_dump || *json_log) && *flow_export != "" {
+		exporter, err := pcap.NewPcapFlowExporter(*flow_export, pcap.PcapFlowExportVersion(*flow_version), 0)
+		if err == nil {
+			flowExporter = exporter
+			jlog(INFO, &emptyTcpdumpJob, fmt.Sprintf("exporting flows to: %s/%s", *flow_version, *flow_export))
+		} else {
+			jlog(ERROR, &emptyTcpdumpJob, fmt.Sprintf("flow exporter disabled: %v", err))
+		}
+	}
+
+	if *trace_ids != "" || *trace_rate > 0 || *trace_file != "" {
+		traceScope = pcap.NewPcapTraceScope(strings.Split(*trace_ids, ","), *trace_rate)
+		if *trace_file != "" {
+			go pcap.WatchPcapTraceScope(ctx, traceScope, *trace_file, 5*time.Second)
+		}
+		jlog(INFO, &emptyTcpdumpJob, fmt.Sprintf("scoped to traces: ids=%s rate=%d file=%s", *trace_ids, *trace_rate, *trace_file))
+	}
+
+	if (*json_dump || *json_log) && *debug_addr != "" {
+		correlations = pcap.NewPcapCorrelationIndex()
+		go func() {
+			jlog(INFO, &emptyTcpdumpJob, fmt.Sprintf("serving correlation state at: %s", *debug_addr))
+			if err := http.ListenAndServe(*debug_addr, pcap.NewPcapDebugHandler(correlations)); err != nil {
+				jlog(ERROR, &emptyTcpdumpJob, fmt.Sprintf("debug server disabled: %v", err))
+			}
+		}()
+	}
+
+	if *filters_addr != "" {
+		go func() {
+			jlog(INFO, &emptyTcpdumpJob, fmt.Sprintf("serving packet filters at: %s", *filters_addr))
+			if err := http.ListenAndServe(*filters_addr, pcap.NewPcapFiltersHandler(compatFilters)); err != nil {
+				jlog(ERROR, &emptyTcpdumpJob, fmt.Sprintf("filters server disabled: %v", err))
+			}
+		}()
+	}
+
+	var exclusions []string
+	if *exclude_self {
+		exclusions = selfExclusions(flowExporter)
+		jlog(INFO, &emptyTcpdumpJob, fmt.Sprintf("excluding own traffic: %s | %s", *no_procs, strings.Join(exclusions, " | ")))
+	}
+	if denied := denyExclusions(compatFilters); len(denied) > 0 {
+		exclusions = append(exclusions, denied...)
+		jlog(INFO, &emptyTcpdumpJob, fmt.Sprintf("excluding denied traffic: %s", strings.Join(denied, " | ")))
+	}
+	// IPs of these hosts rotate: they cannot be known when the BPF filter is compiled
+	if *dns_hosts != "" {
+		compatFilters.AddHosts(strings.Split(*dns_hosts, ",")...)
+		jlog(INFO, &emptyTcpdumpJob, fmt.Sprintf("allowing hosts resolved by DNS responses: %s", *dns_hosts))
+	}
+	if *deny_hosts != "" {
+		compatFilters.DenyHosts(strings.Split(*deny_hosts, ",")...)
+		jlog(INFO, &emptyTcpdumpJob, fmt.Sprintf("denying hosts resolved by DNS responses: %s", *deny_hosts))
+	}
+
+	pcapProfiles, err := pcap.NewPcapProfiles(*profiles)
+	if err != nil {
+		jlog(FATAL, &emptyTcpdumpJob, stringFormatter.Format("invalid capture profiles: {0}", err))
+		os.Exit(1)
+	}
+
+	if *pay_rules != "" {
+		if err := pcap.ValidatePcapPayloadRules(pcap.SplitPcapPayloadRules(*pay_rules)); err != nil {
+			jlog(FATAL, &emptyTcpdumpJob, stringFormatter.Format("invalid payload rules: {0}", err))
+			os.Exit(1)
+		}
+	}
 
 	tasks := createTasks(ctx, pcap_iface, timezone, directory, extension,
 		filter, filters, compatFilters, snaplen, interval, compat, tcp_dump,
-		json_dump, json_log, ordered, conntrack, gcp_gae, ephemeralPortRange)
+		json_dump, json_log, ordered, conntrack, gcp_gae, ephemeralPortRange, exclusions, pcapProfiles)
 
 	if len(tasks) == 0 {
 		jlog(FATAL, &emptyTcpdumpJob, "no PCAP tasks available")
@@ -688,6 +1335,10 @@ func main() {
 		}
 	}()
 
+	if *sync_dir != "" {
+		go watchWorkloadExit(ctx, job, filepath.Join(*sync_dir, syncWorkloadExitedFile), signals)
+	}
+
 	// Skip scheduling, execute `tcpdump` immediately
 	if !*use_cron {
 		id := uuid.New().String()
@@ -695,8 +1346,69 @@ func main() {
 		logName := fmt.Sprintf("projects/%s/pcaps/%s", os.Getenv("PROJECT_ID"), id)
 		ctx = context.WithValue(ctx, pcap.PcapContextLogName, logName)
 		ctx = context.WithValue(ctx, pcap.PcapContextDebug, *pcap_debug)
-		// start the TCP listener for health checks
-		go startTCPListener(ctx, hc_port, job, tcpStopChannel)
+		if *sessions != "" {
+			ctx = context.WithValue(ctx, pcap.PcapContextSessionKeys, strings.Split(*sessions, ","))
+		}
+		ctx = context.WithValue(ctx, pcap.PcapContextCompactRetransmissions, *compact)
+		ctx = context.WithValue(ctx, pcap.PcapContextAnomalies, *anomalies)
+		ctx = context.WithValue(ctx, pcap.PcapContextRetries, *retries)
+		ctx = context.WithValue(ctx, pcap.PcapContextConnectionSetup, *conn_setup)
+		if *fields != "" {
+			ctx = context.WithValue(ctx, pcap.PcapContextFields, strings.Split(*fields, ","))
+		}
+		if *labels != "" {
+			ctx = context.WithValue(ctx, pcap.PcapContextLabels, strings.Split(*labels, ";"))
+		}
+		if *pay_rules != "" {
+			ctx = context.WithValue(ctx, pcap.PcapContextPayloadRules, pcap.SplitPcapPayloadRules(*pay_rules))
+			ctx = context.WithValue(ctx, pcap.PcapContextPayloadSelect, *pay_select)
+		}
+		if *trace_scheme != "" {
+			ctx = context.WithValue(ctx, pcap.PcapContextTraceSchemes, strings.Split(*trace_scheme, ","))
+		}
+		if *trace_header != "" {
+			ctx = context.WithValue(ctx, pcap.PcapContextTraceHeaders, strings.Split(*trace_header, ";"))
+		}
+		if traceScope != nil {
+			ctx = context.WithValue(ctx, pcap.PcapContextTraceScope, traceScope)
+		}
+		if *track_pct < 100 || *track_rate > 0 {
+			ctx = context.WithValue(ctx, pcap.PcapContextTraceTrackingPercent, *track_pct)
+			ctx = context.WithValue(ctx, pcap.PcapContextTraceTrackingRate, *track_rate)
+		}
+		if correlations != nil {
+			ctx = context.WithValue(ctx, pcap.PcapContextCorrelationIndex, correlations)
+		}
+		if *cache_ports != "" {
+			ctx = context.WithValue(ctx, pcap.PcapContextCachePorts, strings.Split(*cache_ports, ","))
+		}
+		ctx = context.WithValue(ctx, pcap.PcapContextHashCacheKeys, *hash_keys)
+		if *db_ports != "" {
+			ctx = context.WithValue(ctx, pcap.PcapContextDBPorts, strings.Split(*db_ports, ","))
+		}
+		ctx = context.WithValue(ctx, pcap.PcapContextDBQueries, *db_queries)
+		if *broker_ports != "" {
+			ctx = context.WithValue(ctx, pcap.PcapContextBrokerPorts, strings.Split(*broker_ports, ","))
+		}
+		ctx = context.WithValue(ctx, pcap.PcapContextFlowSampling, *sample_flows)
+		ctx = context.WithValue(ctx, pcap.PcapContextFlowBudget, *flow_budget)
+		ctx = context.WithValue(ctx, pcap.PcapContextFlowBudgetInterval, time.Duration(*budget_every)*time.Second)
+		if handlers := newFlowEventHandlers(job); handlers != nil {
+			ctx = context.WithValue(ctx, pcap.PcapContextFlowEvents, handlers)
+		}
+		// start the TCP listener for health checks only after packet capturing is ready:
+		//   - startup probes must not succeed before packets from the very first request can be captured
+		go func(ctx context.Context) {
+			awaitJobReady(ctx, job)
+			startTCPListener(ctx, hc_port, job, tcpStopChannel)
+		}(ctx)
+		// without a schedule there is a single execution: once stopped, it cannot be started again
+		if *control_addr != "" {
+			go startControlServer(*control_addr, job, compatFilters, nil /* start */)
+		}
+		if *health_addr != "" {
+			go startHealthServer(*health_addr, job)
+		}
 		start(ctx, &timeout, job)
 		waitDone(job, pcapMutex, &exitSignal)
 		<-tcpStopChannel
@@ -773,6 +1485,13 @@ func main() {
 	// start the TCP listener for health checks
 	go startTCPListener(ctx, hc_port, job, tcpStopChannel)
 
+	if *control_addr != "" {
+		go startControlServer(*control_addr, job, compatFilters, j.RunNow)
+	}
+	if *health_addr != "" {
+		go startHealthServer(*health_addr, job)
+	}
+
 	// Block main goroutine until a signal is received
 	<-ctx.Done()
 
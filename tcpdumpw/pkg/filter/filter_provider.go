@@ -99,6 +99,10 @@ func NewPortsFilterProvider(rawFilter *string, compatFilters pcap.PcapFilters) p
 	return newPcapFilterProvider(rawFilter, compatFilters, newPortsFilterProvider)
 }
 
+func NewMACFilterProvider(rawFilter *string, compatFilters pcap.PcapFilters) pcap.PcapFilterProvider {
+	return newPcapFilterProvider(rawFilter, compatFilters, newMACFilterProvider)
+}
+
 func NewTCPFlagsFilterProvider(rawFilter *string, compatFilters pcap.PcapFilters) pcap.PcapFilterProvider {
 	return newPcapFilterProvider(rawFilter, compatFilters, newTCPFlagsFilterProvider)
 }
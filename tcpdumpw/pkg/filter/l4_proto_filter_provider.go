@@ -36,6 +36,7 @@ const (
 	l4_PROTO_UDP_FILTER     string = "udp"
 	l4_PROTO_ICMPv4_FILTER  string = "icmp"
 	l4_PROTO_ICMPv6_FILTER  string = "icmp6"
+	l4_PROTO_SCTP_FILTER    string = "sctp"
 )
 
 func (p *L4ProtoFilterProvider) Get(ctx context.Context) (*string, bool) {
@@ -71,6 +72,9 @@ func (p *L4ProtoFilterProvider) Get(ctx context.Context) (*string, bool) {
 		case "icmp6", "58", "0x3A":
 			l4Protos.Add(string(l4_PROTO_ICMPv6_FILTER))
 			p.AddL4Proto(pcap.L4_PROTO_ICMP6)
+		case "sctp", "132", "0x84":
+			l4Protos.Add(string(l4_PROTO_SCTP_FILTER))
+			p.AddL4Proto(pcap.L4_PROTO_SCTP)
 		}
 	}
 
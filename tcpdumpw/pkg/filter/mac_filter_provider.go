@@ -0,0 +1,86 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filter
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/pcap-sidecar/pcap-cli/pkg/pcap"
+	mapset "github.com/deckarep/golang-set/v2"
+	"github.com/wissance/stringFormatter"
+)
+
+type (
+	MACFilterProvider struct {
+		*pcap.PcapFilter
+		pcap.PcapFilters
+	}
+)
+
+func (p *MACFilterProvider) Get(ctx context.Context) (*string, bool) {
+	if *p.Raw == "" {
+		return nil, false
+	}
+
+	macSet := mapset.NewThreadUnsafeSet[string]()
+	for _, macStr := range strings.Split(*p.Raw, ",") {
+		macStr = strings.TrimSpace(macStr)
+		if macStr == "" || strings.EqualFold(macStr, "ALL") || strings.EqualFold(macStr, "ANY") {
+			continue
+		}
+		// only EUI-48 addresses are supported: the ones used by Ethernet
+		if mac, err := net.ParseMAC(macStr); err == nil && len(mac) == 6 {
+			macSet.Add(mac.String())
+			p.AddMAC(mac.String())
+		}
+	}
+
+	if macSet.IsEmpty() {
+		return nil, false
+	}
+
+	filter := stringFormatter.Format("ether host {0}",
+		strings.Join(macSet.ToSlice(), " or ether host "))
+
+	return &filter, true
+}
+
+func (p *MACFilterProvider) String() string {
+	if filter, ok := p.Get(context.Background()); ok {
+		return stringFormatter.Format("MACFilter[{0}] => ({1})", *p.Raw, *filter)
+	}
+	return "MACFilter[nil]"
+}
+
+func (p *MACFilterProvider) Apply(
+	ctx context.Context,
+	srcFilter *string,
+	mode pcap.PcapFilterMode,
+) *string {
+	return applyFilter(ctx, srcFilter, p, mode)
+}
+
+func newMACFilterProvider(
+	filter *pcap.PcapFilter,
+	compatFilters pcap.PcapFilters,
+) pcap.PcapFilterProvider {
+	provider := &MACFilterProvider{
+		PcapFilter:  filter,
+		PcapFilters: compatFilters,
+	}
+	return provider
+}